@@ -0,0 +1,50 @@
+import { findSession } from "@/lib/auth/session";
+import { InternalApiError } from "@/lib/data/internal-api";
+import { listStrReplaceFailures, formatStrReplaceFailuresJSONL } from "@/lib/llm/str-replace-failures";
+import { NextRequest, NextResponse } from "next/server";
+
+// GET returns the str_replace operations that failed to find old_str, with the file content at the
+// time of the failure, for building prompt tuning and evaluation datasets. It's admin only and
+// nothing is redacted. The worker filters and pages the failures, format=jsonl returns them one
+// per line with the next page's cursor in X-Next-Cursor.
+export async function GET(req: NextRequest) {
+  try {
+    const session = await findSession(req.cookies.get('token')?.value || '');
+    if (!session) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+    if (!session.user.isAdmin) {
+      return NextResponse.json({ error: 'Forbidden' }, { status: 403 });
+    }
+
+    const searchParams = new URLSearchParams(req.nextUrl.searchParams);
+    const format = searchParams.get('format') ?? 'json';
+    if (format !== 'json' && format !== 'jsonl') {
+      return NextResponse.json({ error: 'format must be json or jsonl' }, { status: 400 });
+    }
+    searchParams.delete('format');
+
+    let page;
+    try {
+      page = await listStrReplaceFailures(session.user.id, searchParams);
+    } catch (err) {
+      if (err instanceof InternalApiError && err.status < 500) {
+        return NextResponse.json({ error: err.message }, { status: err.status });
+      }
+      throw err;
+    }
+
+    if (format === 'jsonl') {
+      const headers: Record<string, string> = { 'Content-Type': 'application/x-ndjson' };
+      if (page.nextCursor) {
+        headers['X-Next-Cursor'] = page.nextCursor;
+      }
+      return new NextResponse(formatStrReplaceFailuresJSONL(page.failures), { headers });
+    }
+
+    return NextResponse.json(page);
+  } catch (err) {
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to list str_replace failures' }, { status: 500 });
+  }
+}
@@ -1,8 +1,8 @@
 import { NextRequest, NextResponse } from 'next/server';
-import { createWorkspaceFromArchiveAction } from '@/lib/workspace/actions/create-workspace-from-archive';
 import { findSession } from '@/lib/auth/session';
-import { Archive } from '@/lib/types/archive';
 import { userIdFromExtensionToken } from '@/lib/auth/extension-token';
+import { InternalApiError, postInternalApi } from '@/lib/data/internal-api';
+import { ImportReport } from '@/lib/types/workspace';
 
 export const config = {
   api: {
@@ -10,6 +10,10 @@ export const config = {
   },
 };
 
+// POST imports the Helm chart in the uploaded tar or tgz archive in the form's file field. The
+// worker validates the chart's files, the response has the new workspace's ID and the findings
+// of the import's validation in importReport. A chart that can't be imported is a 422 with the
+// report's fatal findings in error.
 export async function POST(req: NextRequest) {
   try {
     // if there's an auth header, use that to find the user
@@ -35,17 +39,18 @@ export async function POST(req: NextRequest) {
       return NextResponse.json({ error: 'No file provided' }, { status: 400 });
     }
 
-    const bytes = await file.arrayBuffer();
+    const importForm = new FormData();
+    importForm.append('file', file, file.name);
+    importForm.append('userId', userId);
+    importForm.append('importType', 'helm');
 
-    const archive: Archive = {
-      name: file.name,
-      content: new Uint8Array(bytes),
-    };
+    const workspace = await postInternalApi<{ id: string; importReport?: ImportReport }>("/api/workspace/import/archive", userId, importForm);
 
-    const workspace = await createWorkspaceFromArchiveAction(userId, formData, "helm");
-
-    return NextResponse.json({ workspaceId: workspace.id });
+    return NextResponse.json({ workspaceId: workspace.id, importReport: workspace.importReport });
   } catch (error) {
+    if (error instanceof InternalApiError && error.status < 500) {
+      return NextResponse.json({ error: error.message }, { status: error.status });
+    }
     console.error('Error processing upload:', error);
     return NextResponse.json(
       { error: 'Failed to process upload' },
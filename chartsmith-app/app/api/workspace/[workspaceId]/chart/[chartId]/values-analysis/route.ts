@@ -0,0 +1,41 @@
+import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
+import { InternalApiError } from "@/lib/data/internal-api";
+import { getValuesAnalysis } from "@/lib/workspace/values-analysis";
+import { NextRequest, NextResponse } from "next/server";
+
+// GET reports the values.yaml keys that no template references, and the keys templates
+// reference that values.yaml doesn't define, for a chart in the current revision.
+export async function GET(req: NextRequest) {
+  try {
+    // if there's an auth header, use that to find the user
+    const authHeader = req.headers.get('authorization');
+    if (!authHeader) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    const userId = await userIdFromExtensionToken(authHeader.split(' ')[1])
+
+    if (!userId) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    // path is /api/workspace/{workspaceId}/chart/{chartId}/values-analysis
+    const pathSegments = req.nextUrl.pathname.split('/');
+    pathSegments.pop(); // Remove 'values-analysis'
+    const chartId = pathSegments.pop();
+    pathSegments.pop(); // Remove 'chart'
+    const workspaceId = pathSegments.pop();
+    if (!workspaceId || !chartId) {
+      return NextResponse.json({ error: 'Workspace ID and chart ID are required' }, { status: 400 });
+    }
+
+    return NextResponse.json(await getValuesAnalysis(workspaceId, chartId, userId));
+  } catch (err) {
+    // the worker checks the role and finds the chart, pass on why it refused
+    if (err instanceof InternalApiError && err.status < 500) {
+      return NextResponse.json({ error: err.message }, { status: err.status });
+    }
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to analyze values' }, { status: 500 });
+  }
+}
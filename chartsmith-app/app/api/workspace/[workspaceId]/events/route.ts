@@ -0,0 +1,39 @@
+import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
+import { listWorkspaceEventsSince } from "@/lib/centrifugo/centrifugo";
+import { NextRequest, NextResponse } from "next/server";
+
+// GET returns the realtime events sent to a workspace after the `since` sequence, so that
+// a client that reconnects can replay what it missed.
+export async function GET(req: NextRequest) {
+  try {
+    // if there's an auth header, use that to find the user
+    const authHeader = req.headers.get('authorization');
+    if (!authHeader) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    const userId = await userIdFromExtensionToken(authHeader.split(' ')[1])
+
+    if (!userId) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    // path is /api/workspace/{workspaceId}/events
+    const pathSegments = req.nextUrl.pathname.split('/');
+    pathSegments.pop(); // Remove 'events'
+    const workspaceId = pathSegments.pop();
+    if (!workspaceId) {
+      return NextResponse.json({ error: 'Workspace ID is required' }, { status: 400 });
+    }
+
+    const since = Number(req.nextUrl.searchParams.get('since') ?? '0');
+    if (!Number.isInteger(since) || since < 0) {
+      return NextResponse.json({ error: 'since must be a non-negative integer' }, { status: 400 });
+    }
+
+    return NextResponse.json(await listWorkspaceEventsSince(workspaceId, since));
+  } catch (err) {
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to list events' }, { status: 500 });
+  }
+}
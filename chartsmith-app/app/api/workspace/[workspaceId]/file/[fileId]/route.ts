@@ -0,0 +1,57 @@
+import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
+import { FileBusyError, FileConflictError, saveFileContent } from "@/lib/workspace/patch";
+import { NextRequest, NextResponse } from "next/server";
+
+// PUT saves a user's edit of a file. The body is { revision, content, expectedVersion }, where
+// expectedVersion is the version of the file the edit was made on. If the file was written since,
+// nothing is saved and the response is a 409 with both contents so that they can be merged. While
+// another writer, such as a plan being applied, holds the file the response is a 503.
+export async function PUT(req: NextRequest) {
+  try {
+    // if there's an auth header, use that to find the user
+    const authHeader = req.headers.get('authorization');
+    if (!authHeader) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    const userId = await userIdFromExtensionToken(authHeader.split(' ')[1])
+
+    if (!userId) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    // path is /api/workspace/{workspaceId}/file/{fileId}
+    const pathSegments = req.nextUrl.pathname.split('/');
+    const fileId = pathSegments.pop();
+    if (!fileId) {
+      return NextResponse.json({ error: 'File ID is required' }, { status: 400 });
+    }
+
+    const body = await req.json();
+    const { revision, content, expectedVersion } = body ?? {};
+    if (typeof revision !== 'number' || typeof content !== 'string' || typeof expectedVersion !== 'number') {
+      return NextResponse.json({ error: 'revision, content and expectedVersion are required' }, { status: 400 });
+    }
+
+    try {
+      return NextResponse.json(await saveFileContent(fileId, revision, content, expectedVersion));
+    } catch (err) {
+      if (err instanceof FileConflictError) {
+        return NextResponse.json({
+          error: 'File was modified concurrently',
+          currentContent: err.currentContent,
+          currentContentPending: err.currentContentPending,
+          yourContent: content,
+          version: err.version,
+        }, { status: 409 });
+      }
+      if (err instanceof FileBusyError) {
+        return NextResponse.json({ error: err.message }, { status: 503 });
+      }
+      throw err;
+    }
+  } catch (err) {
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to save file' }, { status: 500 });
+  }
+}
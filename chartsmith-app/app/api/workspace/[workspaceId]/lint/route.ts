@@ -0,0 +1,43 @@
+import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
+import { listLintFindings } from "@/lib/workspace/lint";
+import { NextRequest, NextResponse } from "next/server";
+
+// GET returns the lint findings of a workspace, at the current revision or the one in ?revision=
+export async function GET(req: NextRequest) {
+  try {
+    // if there's an auth header, use that to find the user
+    const authHeader = req.headers.get('authorization');
+    if (!authHeader) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    const userId = await userIdFromExtensionToken(authHeader.split(' ')[1])
+
+    if (!userId) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    // path is /api/workspace/{workspaceId}/lint
+    const pathSegments = req.nextUrl.pathname.split('/');
+    pathSegments.pop(); // Remove 'lint'
+    const workspaceId = pathSegments.pop();
+    if (!workspaceId) {
+      return NextResponse.json({ error: 'Workspace ID is required' }, { status: 400 });
+    }
+
+    let revision: number | undefined;
+    const revisionParam = req.nextUrl.searchParams.get('revision');
+    if (revisionParam !== null) {
+      revision = parseInt(revisionParam, 10);
+      if (isNaN(revision) || revision < 0) {
+        return NextResponse.json({ error: 'Invalid revision' }, { status: 400 });
+      }
+    }
+
+    const findings = await listLintFindings(workspaceId, revision);
+    return NextResponse.json({ findings });
+  } catch (err) {
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to get lint findings' }, { status: 500 });
+  }
+}
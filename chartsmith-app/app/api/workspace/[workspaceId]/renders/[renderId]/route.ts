@@ -0,0 +1,40 @@
+import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
+import { getRenderedWorkspace } from "@/lib/workspace/rendered";
+import { NextRequest, NextResponse } from "next/server";
+
+// GET returns the full snapshot of a render, including the accumulated output of
+// each chart. Clients use this when they detect a gap in the render-stream sequence.
+export async function GET(req: NextRequest) {
+  try {
+    // if there's an auth header, use that to find the user
+    const authHeader = req.headers.get('authorization');
+    if (!authHeader) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    const userId = await userIdFromExtensionToken(authHeader.split(' ')[1])
+
+    if (!userId) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    // path is /api/workspace/{workspaceId}/renders/{renderId}
+    const pathSegments = req.nextUrl.pathname.split('/');
+    const renderId = pathSegments.pop();
+    pathSegments.pop(); // Remove 'renders'
+    const workspaceId = pathSegments.pop();
+    if (!workspaceId || !renderId) {
+      return NextResponse.json({ error: 'Workspace ID and render ID are required' }, { status: 400 });
+    }
+
+    const render = await getRenderedWorkspace(renderId);
+    if (render.workspaceId !== workspaceId) {
+      return NextResponse.json({ error: 'Render not found' }, { status: 404 });
+    }
+
+    return NextResponse.json(render);
+  } catch (err) {
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to get render' }, { status: 500 });
+  }
+}
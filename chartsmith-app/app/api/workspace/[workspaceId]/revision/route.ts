@@ -1,5 +1,6 @@
 import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
 import { getPlan, createRevision } from "@/lib/workspace/workspace";
+import { InternalApiError } from "@/lib/data/internal-api";
 import { NextRequest, NextResponse } from "next/server";
 
 export async function POST(req: NextRequest) {
@@ -39,6 +40,11 @@ export async function POST(req: NextRequest) {
 
     return NextResponse.json(workspace);
   } catch (error) {
+    // the worker refuses a plan while another plan of the workspace executes, and users that
+    // can't edit the workspace
+    if (error instanceof InternalApiError && error.status < 500) {
+      return NextResponse.json({ error: error.message, ...error.body }, { status: error.status });
+    }
     console.error(error);
     return NextResponse.json({ error: 'Internal Server Error' }, { status: 500 });
   }
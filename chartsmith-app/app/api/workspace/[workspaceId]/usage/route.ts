@@ -0,0 +1,38 @@
+import { userIdFromExtensionToken } from "@/lib/auth/extension-token";
+import { InternalApiError } from "@/lib/data/internal-api";
+import { getUsageSummary } from "@/lib/workspace/usage";
+import { NextRequest, NextResponse } from "next/server";
+
+// GET returns the LLM token usage of a workspace, in total and grouped by operation and day
+export async function GET(req: NextRequest) {
+  try {
+    // if there's an auth header, use that to find the user
+    const authHeader = req.headers.get('authorization');
+    if (!authHeader) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    const userId = await userIdFromExtensionToken(authHeader.split(' ')[1])
+
+    if (!userId) {
+      return NextResponse.json({ error: 'Unauthorized' }, { status: 401 });
+    }
+
+    // path is /api/workspace/{workspaceId}/usage
+    const pathSegments = req.nextUrl.pathname.split('/');
+    pathSegments.pop(); // Remove 'usage'
+    const workspaceId = pathSegments.pop();
+    if (!workspaceId) {
+      return NextResponse.json({ error: 'Workspace ID is required' }, { status: 400 });
+    }
+
+    return NextResponse.json(await getUsageSummary(workspaceId, userId));
+  } catch (err) {
+    // the worker checks the role, pass on why it refused
+    if (err instanceof InternalApiError && err.status < 500) {
+      return NextResponse.json({ error: err.message }, { status: err.status });
+    }
+    console.error(err);
+    return NextResponse.json({ error: 'Failed to get usage' }, { status: 500 });
+  }
+}
@@ -33,6 +33,7 @@ export default function RootLayout({
           <AuthProvider>
             <CommandMenuProvider>
               {children}
+              <Toaster />
             </CommandMenuProvider>
           </AuthProvider>
         </ThemeProvider>
@@ -1,6 +1,6 @@
 import { atom } from 'jotai'
-import type { Workspace, Plan, RenderedWorkspace, Chart, WorkspaceFile, Conversion, ConversionFile, ConversionStatus } from '@/lib/types/workspace'
-import { Message, FileNode } from '@/components/types'
+import type { Workspace, Plan, RenderedWorkspace, Chart, WorkspaceFile, Conversion, ConversionFile, ConversionStatus, SecretFinding } from '@/lib/types/workspace'
+import { Message, FileNode, PlanChanges } from '@/components/types'
 
 // Base atoms
 export const workspaceAtom = atom<Workspace | null>(null)
@@ -146,6 +146,33 @@ export const handlePlanUpdatedAtom = atom(
   }
 )
 
+// Handle plan changes, will merge the changed action files into the plan by chart and path. Returns
+// false when the plan isn't known, the caller fetches it.
+export const handlePlanChangesAtom = atom(
+  null,
+  (get, set, changes: PlanChanges): boolean => {
+    const plans = get(plansAtom)
+    const existingPlan = plans.find(p => p.id === changes.id)
+    if (!existingPlan) {
+      return false
+    }
+
+    const actionFiles = [...existingPlan.actionFiles]
+    for (const changed of changes.actionFiles) {
+      const index = actionFiles.findIndex(af => af.path === changed.path && (af.chartId ?? '') === (changed.chartId ?? ''))
+      if (index === -1) {
+        actionFiles.push(changed)
+      } else {
+        actionFiles[index] = changed
+      }
+    }
+
+    const updatedPlan = { ...existingPlan, status: changes.status, actionFiles }
+    set(plansAtom, plans.map(p => p.id === changes.id ? updatedPlan : p))
+    return true
+  }
+)
+
 // Handle conversion updated, will update the conversion if its found, otherwise it will add it to the list
 export const handleConversionUpdatedAtom = atom(
   null,
@@ -252,6 +279,9 @@ export const renderedFilesAtom = atom(get => {
   return getRenderedFilesByRevision(workspace.currentRevisionNumber);
 });
 
+// Secrets found in files written since the workspace was opened, the latest findings of each file
+export const secretFindingsAtom = atom<SecretFinding[]>([]);
+
 // Atom to track active renders
 export const activeRenderIdsAtom = atom<string[]>([]);
 
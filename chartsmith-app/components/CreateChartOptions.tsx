@@ -7,8 +7,12 @@ import { PromptModal } from "./PromptModal";
 import { createWorkspaceFromArchiveAction } from "@/lib/workspace/actions/create-workspace-from-archive";
 import { useSession } from "@/app/hooks/useSession";
 import { createWorkspaceFromPromptAction } from "@/lib/workspace/actions/create-workspace-from-prompt";
+import { listBootstrapTemplatesAction } from "@/lib/workspace/actions/list-bootstrap-templates";
+import { BootstrapTemplate } from "@/lib/workspace/bootstrap-templates";
 import { logger } from "@/lib/utils/logger";
 import { ArtifactHubSearchModal } from "./ArtifactHubSearchModal";
+import { useToast } from "./toast/use-toast";
+import { ImportReport } from "@/lib/types/workspace";
 
 const MAX_CHARS = 512;
 const WARNING_THRESHOLD = 500;
@@ -26,12 +30,23 @@ export function CreateChartOptions() {
   const [showArtifactHubSearch, setShowArtifactHubSearch] = useState(false);
   const [uploadType, setUploadType] = useState<'helm' | 'k8s' | null>(null);
   const [isApproachingLimit, setIsApproachingLimit] = useState(false);
+  const { toast } = useToast();
+  const [templates, setTemplates] = useState<BootstrapTemplate[]>([]);
+  const [bootstrapTemplate, setBootstrapTemplate] = useState<string | undefined>(undefined);
 
   useEffect(() => {
     // Focus the textarea on mount
     textareaRef.current?.focus();
   }, []);
   
+  // The scaffold picker is only shown when there's more than the default template
+  useEffect(() => {
+    if (!session) return;
+    listBootstrapTemplatesAction(session)
+      .then(setTemplates)
+      .catch((err) => logger.error("Failed to list bootstrap templates", { err }));
+  }, [session]);
+
   // Check if input is approaching character limit
   useEffect(() => {
     setIsApproachingLimit(prompt.length >= WARNING_THRESHOLD);
@@ -47,7 +62,7 @@ export function CreateChartOptions() {
     if (prompt.trim()) {
       try {
         setIsPromptLoading(true);
-        const w = await createWorkspaceFromPromptAction(session, prompt);
+        const w = await createWorkspaceFromPromptAction(session, prompt, bootstrapTemplate);
         router.replace(`/workspace/${w.id}`);
       } catch (err) {
         logger.error("Failed to create workspace", { err });
@@ -84,10 +99,30 @@ export function CreateChartOptions() {
     try {
       const formData = new FormData();
       formData.append('file', file);
-      formData.append('type', uploadType || 'helm'); // Send the upload type to the backend
 
-      const workspace = await createWorkspaceFromArchiveAction(session.id, formData, uploadType || 'helm');
-      router.replace(`/workspace/${workspace.id}`);
+      if (uploadType === 'k8s') {
+        const workspace = await createWorkspaceFromArchiveAction(session.id, formData, 'k8s');
+        router.replace(`/workspace/${workspace.id}`);
+        return;
+      }
+
+      // Helm charts are imported by the worker, which validates the chart's files
+      const response = await fetch('/api/upload-chart', { method: 'POST', body: formData });
+      const body: { workspaceId?: string; importReport?: ImportReport; error?: string } = await response.json().catch(() => ({}));
+      if (!response.ok || !body.workspaceId) {
+        toast({ title: "Unable to import the chart", description: body.error || "Failed to upload", variant: "destructive" });
+        setIsUploading(false);
+        return;
+      }
+
+      const warnings = body.importReport?.findings.filter((finding) => finding.severity === "warning") ?? [];
+      if (warnings.length > 0) {
+        toast({
+          title: `Imported with ${warnings.length} warning${warnings.length === 1 ? "" : "s"}`,
+          description: warnings.map((finding) => finding.path ? `${finding.path}: ${finding.message}` : finding.message).join("\n"),
+        });
+      }
+      router.replace(`/workspace/${body.workspaceId}`);
     } catch (error) {
       console.error('Error uploading:', error);
       alert("Failed to upload");
@@ -127,6 +162,23 @@ export function CreateChartOptions() {
             maxLength={MAX_CHARS}
           />
           
+          {templates.length > 1 && (
+            <div className="flex items-center gap-2 mt-2 text-xs sm:text-sm text-gray-400">
+              <label htmlFor="bootstrap-template">Start from</label>
+              <select
+                id="bootstrap-template"
+                value={bootstrapTemplate ?? templates.find((template) => template.default)?.name ?? ""}
+                onChange={(e) => setBootstrapTemplate(e.target.value)}
+                disabled={isPromptLoading}
+                className="bg-gray-800/60 border border-gray-700 rounded-md px-2 py-1 text-gray-300 focus:outline-none disabled:opacity-50"
+              >
+                {templates.map((template) => (
+                  <option key={template.name} value={template.name}>{template.name}</option>
+                ))}
+              </select>
+            </div>
+          )}
+
           {isApproachingLimit && (
             <div className="flex items-center mt-2 text-xs text-amber-500/90">
               <AlertCircle className="w-3.5 h-3.5 mr-1.5 flex-shrink-0" />
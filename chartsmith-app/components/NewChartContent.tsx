@@ -6,6 +6,7 @@ import { useAtom } from "jotai";
 import { ScrollingContent } from "./ScrollingContent";
 import { NewChartChatMessage } from "./NewChartChatMessage";
 import { createRevisionAction } from "@/lib/workspace/actions/create-revision";
+import { useToast } from "./toast/use-toast";
 import { useEffect, useState } from "react";
 
 interface NewChartContentProps {
@@ -17,6 +18,7 @@ interface NewChartContentProps {
 
 export function NewChartContent({ session, chatInput, setChatInput, handleSubmitChat }: NewChartContentProps) {
   const { theme } = useTheme();
+  const { toast } = useToast();
   const [messages] = useAtom(messagesAtom);
   const [isRendering] = useAtom(isRenderingAtom);
   const [, setWorkspace] = useAtom(workspaceAtom);
@@ -35,9 +37,13 @@ export function NewChartContent({ session, chatInput, setChatInput, handleSubmit
     const lastPlan = plans[plans.length - 1];
     if (!lastPlan) return;
 
-    const updatedWorkspace = await createRevisionAction(session, lastPlan.id);
-    if (updatedWorkspace) {
-      setWorkspace(updatedWorkspace);
+    const result = await createRevisionAction(session, lastPlan.id);
+    if (result.error) {
+      toast({ title: "Unable to create the chart", description: result.error, variant: "destructive" });
+      return;
+    }
+    if (result.workspace) {
+      setWorkspace(result.workspace);
     }
   };
 
@@ -10,10 +10,11 @@ import { useTheme } from "@/contexts/ThemeContext";
 // components
 import { Button } from "@/components/ui/Button";
 import { FeedbackModal } from "@/components/FeedbackModal";
+import { useToast } from "@/components/toast/use-toast";
 
 // actions
 import { ignorePlanAction } from "@/lib/workspace/actions/ignore-plan";
-import { ThumbsUp, ThumbsDown, Send, ChevronDown, ChevronUp, Plus, Pencil, Trash2 } from "lucide-react";
+import { ThumbsUp, ThumbsDown, Send, ChevronDown, ChevronUp, Plus, Pencil, Trash2, X } from "lucide-react";
 import { createRevisionAction } from "@/lib/workspace/actions/create-revision";
 import { messagesAtom, workspaceAtom, handlePlanUpdatedAtom, planByIdAtom } from "@/atoms/workspace";
 import { createChatMessageAction } from "@/lib/workspace/actions/create-chat-message";
@@ -48,6 +49,7 @@ export function PlanChatMessage({
   workspaceId,
 }: PlanChatMessageProps) {
   const { theme } = useTheme();
+  const { toast } = useToast();
 
   const [workspaceFromAtom, setWorkspace] = useAtom(workspaceAtom);
   const [messagesFromAtom, setMessages] = useAtom(messagesAtom);
@@ -148,9 +150,13 @@ export function PlanChatMessage({
     const wsId = workspaceId || plan.workspaceId;
     if (!wsId) return;
 
-    const updatedWorkspace = await createRevisionAction(session, plan.id);
-    if (updatedWorkspace && setWorkspace) {
-      setWorkspace(updatedWorkspace);
+    const result = await createRevisionAction(session, plan.id);
+    if (result.error) {
+      toast({ title: "Unable to proceed", description: result.error, variant: "destructive" });
+      return;
+    }
+    if (result.workspace && setWorkspace) {
+      setWorkspace(result.workspace);
     }
     onProceed?.();
   };
@@ -266,6 +272,10 @@ export function PlanChatMessage({
                                   <path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M5 13l4 4L19 7" />
                                 </svg>
                               </div>
+                            ) : action.status === 'failed' ? (
+                              <div className="text-red-500" title={action.error}>
+                                <X className="h-3 w-3" />
+                              </div>
                             ) : action.status === 'creating' ? (
                               <div
                                 className="rounded-full h-3 w-3 border border-primary/70 border-t-transparent"
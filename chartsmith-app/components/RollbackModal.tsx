@@ -118,7 +118,7 @@ export function RollbackModal({
         
         <div className="p-6">
           <p className={`${theme === "dark" ? "text-gray-300" : "text-gray-600"} mb-4`}>
-            Rolling back to a previous revision. This action is irreversible and will delete all changes made after this revision.
+            Rolling back to a previous revision. The files of this revision are restored as a new revision, the changes made after it stay in the history.
           </p>
           
           <div className="mt-4">
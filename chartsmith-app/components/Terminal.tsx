@@ -32,7 +32,12 @@ export function Terminal({
   const depUpdateStderrToShow = depUpdateStderrStreamed || chart.depUpdateStderr;
   const depUpdateStdoutToShow = depUpdateStdoutStreamed || chart.depUpdateStdout;
   const helmTemplateCommandToShow = helmTemplateCommandStreamed || chart.helmTemplateCommand;
-  const helmTemplateStderrToShow = helmTemplateStderrStreamed || chart.helmTemplateStderr;
+  const helmTemplateWarnings = chart.helmTemplateWarnings || [];
+  // warnings are shown on their own so that a successful render doesn't look like a failure
+  const helmTemplateStderrToShow = (helmTemplateStderrStreamed || chart.helmTemplateStderr || '')
+    .split('\n')
+    .filter(line => line.trim() !== '' && !helmTemplateWarnings.includes(line.trimEnd()))
+    .join('\n');
 
   return (
     <div
@@ -95,11 +100,21 @@ export function Terminal({
                   <span className="text-primary/70 whitespace-pre-wrap">{helmTemplateCommandToShow}</span>
                 </div>
               )}
+              {helmTemplateWarnings.length > 0 && (
+                <div className="mt-2 text-yellow-400 whitespace-pre-wrap">
+                  {helmTemplateWarnings.join('\n')}
+                </div>
+              )}
               {helmTemplateStderrToShow ? (
                 <div className="mt-2 text-red-400 whitespace-pre-wrap">
                   {helmTemplateStderrToShow}
                 </div>
               ) : null}
+              {chart.error && (
+                <div className="mt-2 text-red-400 whitespace-pre-wrap">
+                  {chart.error}
+                </div>
+              )}
               {chart.renderedFiles?.length > 0 && (
                 <div className="mt-4 space-y-1">
                   {chart.renderedFiles.map((file, index) => (
@@ -113,6 +128,12 @@ export function Terminal({
                   ))}
                 </div>
               )}
+              {chart.notes && (
+                <div className="mt-4">
+                  <div className="text-primary/70">NOTES:</div>
+                  <div className="mt-1 whitespace-pre-wrap">{chart.notes}</div>
+                </div>
+              )}
             </>
           )}
         </div>
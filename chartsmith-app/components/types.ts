@@ -1,4 +1,4 @@
-import { Plan, Workspace, WorkspaceFile, RenderedFile, Conversion, ConversionFile } from "@/lib/types/workspace";
+import { Plan, Workspace, WorkspaceFile, RenderedFile, RenderInventory, Conversion, ConversionFile, SecretFinding, ActionFile } from "@/lib/types/workspace";
 
 export interface FileNode {
   name: string;
@@ -87,22 +87,32 @@ export interface CentrifugoMessageData {
   chatMessage?: RawChatMessage;
   message?: RawMessage;
   plan?: RawPlan;
+  planChanges?: PlanChanges;
   revision?: RawRevision;
   file?: RawFile;
   workspaceId: string;
   eventType?: string;
+  eventSequence?: number;
   renderedFile?: RenderedFile;
   renderChartId?: string;
   renderId?: string;
+  inventory?: RenderInventory;
+  sequence?: number;
+  status?: string;
   depUpdateCommand?: string;
   depUpdateStdout?: string;
   depUpdateStderr?: string;
   helmTemplateCommand?: string;
   helmTemplateStdout?: string;
   helmTemplateStderr?: string;
+  warnings?: string[];
+  compatibility?: string;
+  notes?: string | null;
+  error?: string;
   conversion?: Conversion;
   conversionId?: string;
   conversionFile?: ConversionFile;
+  findings?: SecretFinding[];
   filePath?: string;
   status?: string;
   completedAt?: string;
@@ -166,6 +176,14 @@ export interface RawPlan {
   }[];
 }
 
+// PlanChanges is sent instead of a plan while it's executed and applied, with the action files that
+// changed since the last event
+export interface PlanChanges {
+  id: string;
+  status: string;
+  actionFiles: ActionFile[];
+}
+
 export interface RenderStreamEvent {
   workspaceId: string;
   renderChartId: string;
@@ -175,4 +193,6 @@ export interface RenderStreamEvent {
   helmTemplateCommand?: string;
   helmTemplateStdout?: string;
   helmTemplateStderr?: string;
+  warnings?: string[];
+  error?: string;
 }
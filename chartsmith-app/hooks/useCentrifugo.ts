@@ -13,6 +13,7 @@ import { getCentrifugoTokenAction } from "@/lib/centrifugo/actions/get-centrifug
 import { getWorkspaceAction } from "@/lib/workspace/actions/get-workspace";
 import { getWorkspaceMessagesAction } from "@/lib/workspace/actions/get-workspace-messages";
 import { getWorkspaceRenderAction } from "@/lib/workspace/actions/get-workspace-render";
+import { getPlanAction } from "@/lib/workspace/actions/get-plan";
 
 
 // atoms
@@ -21,10 +22,12 @@ import {
   rendersAtom,
   workspaceAtom,
   handlePlanUpdatedAtom,
+  handlePlanChangesAtom,
   chartsBeforeApplyingContentPendingAtom,
   handleConversionUpdatedAtom,
   handleConversionFileUpdatedAtom,
-  activeRenderIdsAtom
+  activeRenderIdsAtom,
+  secretFindingsAtom
  } from "@/atoms/workspace";
 import { selectedFileAtom } from "@/atoms/workspace";
 
@@ -32,8 +35,11 @@ import { selectedFileAtom } from "@/atoms/workspace";
 // types
 import { RenderedChart } from "@/lib/types/workspace";
 import { replayEventsAction } from "@/lib/centrifugo/actions/reply-events-action";
+import { replayWorkspaceEventsAction } from "@/lib/centrifugo/actions/replay-workspace-events-action";
 
 const RECONNECT_DELAY_MS = 1000;
+// how long to wait for an event that was skipped before asking the journal for it
+const EVENT_GAP_FILL_DELAY_MS = 2000;
 
 interface UseCentrifugoProps {
   session: Session | undefined;
@@ -43,6 +49,15 @@ export function useCentrifugo({
   session,
 }: UseCentrifugoProps) {
   const centrifugeRef = useRef<Centrifuge | null>(null);
+  const renderStreamSequencesRef = useRef<Record<string, number>>({});
+  // the journal sequence up to which every event was handled, used to replay missed events after
+  // a reconnect. Publishers take a sequence before they publish, so events can arrive out of
+  // order, the ones handled after a sequence that hasn't arrived yet are kept apart until it does.
+  const lastEventSequenceRef = useRef<number>(0);
+  const handledEventSequencesRef = useRef<Set<number>>(new Set());
+  const eventGapTimerRef = useRef<ReturnType<typeof setTimeout> | null>(null);
+  // fills a gap in the sequences from the journal, set for the workspace being watched
+  const fillEventGapRef = useRef<(() => Promise<void>) | null>(null);
 
   const [isReconnecting, setIsReconnecting] = useState(false);
 
@@ -54,7 +69,9 @@ export function useCentrifugo({
   const [, handleConversionUpdated] = useAtom(handleConversionUpdatedAtom)
   const [, handleConversionFileUpdated] = useAtom(handleConversionFileUpdatedAtom)
   const [, handlePlanUpdated] = useAtom(handlePlanUpdatedAtom);
+  const [, handlePlanChanges] = useAtom(handlePlanChangesAtom);
   const [, setActiveRenderIds] = useAtom(activeRenderIdsAtom);
+  const [, setSecretFindings] = useAtom(secretFindingsAtom);
   const [publicEnv, setPublicEnv] = useState<Record<string, string>>({});
 
   useEffect(() => {
@@ -269,6 +286,37 @@ export function useCentrifugo({
       return;
     }
 
+    // a gap in the sequence means we missed some output, so replace the render with a full snapshot
+    if (data.sequence !== undefined) {
+      const lastSequence = renderStreamSequencesRef.current[data.renderChartId] ?? 0;
+      renderStreamSequencesRef.current[data.renderChartId] = data.sequence;
+
+      if (data.sequence !== lastSequence + 1) {
+        const renderId = data.renderId;
+        const snapshot = await getWorkspaceRenderAction(session, renderId);
+        if (snapshot.completedAt) {
+          setActiveRenderIds(prev => prev.filter(id => id !== renderId));
+        }
+        const formattedSnapshot = {
+          ...snapshot,
+          createdAt: new Date(snapshot.createdAt),
+          completedAt: snapshot.completedAt ? new Date(snapshot.completedAt) : undefined,
+          charts: snapshot.charts.map(chart => ({
+            ...chart,
+            createdAt: new Date(chart.createdAt),
+            completedAt: chart.completedAt ? new Date(chart.completedAt) : undefined,
+          })),
+        };
+        setRenders(prev => {
+          if (!prev.find(render => render.id === renderId)) {
+            return [...prev, formattedSnapshot];
+          }
+          return prev.map(render => render.id === renderId ? formattedSnapshot : render);
+        });
+        return;
+      }
+    }
+
     // If this is a completion event (has completedAt or similar marker)
     if (data.completedAt) {
       setActiveRenderIds(prev => prev.filter(id => id !== data.renderId));
@@ -360,15 +408,18 @@ export function useCentrifugo({
               ? new Date(data.completedAt)
               : chart.completedAt;
 
+            // render-stream events only carry the output since the previous event
             return {
               ...chart,
-              helmTemplateCommand: data.helmTemplateCommand,
-              helmTemplateStderr: data.helmTemplateStderr,
-              helmTemplateStdout: data.helmTemplateStdout,
-              depUpdateCommand: data.depUpdateCommand,
-              depUpdateStderr: data.depUpdateStderr,
-              depUpdateStdout: data.depUpdateStdout,
+              helmTemplateCommand: (chart.helmTemplateCommand || '') + (data.helmTemplateCommand || ''),
+              helmTemplateStderr: (chart.helmTemplateStderr || '') + (data.helmTemplateStderr || ''),
+              helmTemplateWarnings: [...(chart.helmTemplateWarnings || []), ...(data.warnings || [])],
+              depUpdateCommand: (chart.depUpdateCommand || '') + (data.depUpdateCommand || ''),
+              depUpdateStderr: (chart.depUpdateStderr || '') + (data.depUpdateStderr || ''),
+              depUpdateStdout: (chart.depUpdateStdout || '') + (data.depUpdateStdout || ''),
               completedAt: chartCompletedAt,
+              error: data.error || chart.error,
+              compatibility: data.compatibility || chart.compatibility,
             };
           })
         };
@@ -430,6 +481,46 @@ export function useCentrifugo({
 
   }, [setRenders]);
 
+  // plans are sent as the action files that changed while they're applied, a plan that isn't known
+  // yet is fetched whole
+  const handlePlanChangesEvent = useCallback(async (data: CentrifugoMessageData) => {
+    if (!data.planChanges) return;
+    if (handlePlanChanges(data.planChanges)) return;
+    if (!session) return;
+
+    try {
+      const plan = await getPlanAction(session, data.planChanges.id);
+      handlePlanUpdated(plan);
+    } catch (err) {
+      console.error("Failed to fetch plan", err);
+    }
+  }, [session, handlePlanChanges, handlePlanUpdated]);
+
+  const handleRenderInventoryEvent = useCallback((data: CentrifugoMessageData) => {
+    if (!data.renderId || !data.inventory) return;
+
+    const inventory = data.inventory;
+    setRenders(prev => prev.map(r => r.id === data.renderId ? { ...r, inventory } : r));
+  }, [setRenders]);
+
+  const handleRenderNotesEvent = useCallback((data: CentrifugoMessageData) => {
+    if (!data.renderId || !data.renderChartId) return;
+
+    // a NOTES.txt that doesn't render arrives as a render-stream warning, only the notes are set here
+    const notes = data.notes ?? null;
+    setRenders(prev => prev.map(r => r.id !== data.renderId ? r : {
+      ...r,
+      charts: r.charts.map((chart: RenderedChart) => chart.id === data.renderChartId ? { ...chart, notes } : chart),
+    }));
+  }, [setRenders]);
+
+  const handleSecretFindingsEvent = useCallback((data: CentrifugoMessageData) => {
+    if (!data.findings) return;
+
+    const filePaths = new Set(data.findings.map(f => f.filePath));
+    setSecretFindings(prev => [...prev.filter(f => !filePaths.has(f.filePath)), ...data.findings!]);
+  }, [setSecretFindings]);
+
   const handleConversionFileUpdatedMessage = useCallback((data: CentrifugoMessageData) => {
     if (!data.conversionId || !data.conversionFile) return;
     handleConversionFileUpdated(data.conversionId, data.conversionFile);
@@ -443,7 +534,30 @@ export function useCentrifugo({
   const handleCentrifugoMessage = useCallback((message: { data: CentrifugoMessageData }) => {
     const eventType = message.data.eventType;
 
-    if (eventType === 'plan-updated') {
+    // events can arrive twice, once live and once from a replay
+    const eventSequence = message.data.eventSequence;
+    if (eventSequence !== undefined) {
+      const handled = handledEventSequencesRef.current;
+      if (eventSequence <= lastEventSequenceRef.current || handled.has(eventSequence)) {
+        return;
+      }
+      handled.add(eventSequence);
+      while (handled.delete(lastEventSequenceRef.current + 1)) {
+        lastEventSequenceRef.current++;
+      }
+
+      // an earlier event hasn't arrived, give it time before replaying it from the journal
+      if (handled.size > 0 && !eventGapTimerRef.current) {
+        eventGapTimerRef.current = setTimeout(() => {
+          eventGapTimerRef.current = null;
+          fillEventGapRef.current?.();
+        }, EVENT_GAP_FILL_DELAY_MS);
+      }
+    }
+
+    if (eventType === 'plan-updated' && message.data.planChanges) {
+      handlePlanChangesEvent(message.data);
+    } else if (eventType === 'plan-updated') {
       const plan = message.data.plan!;
       handlePlanUpdated({
         ...plan,
@@ -457,6 +571,12 @@ export function useCentrifugo({
       handleRenderStreamEvent(message.data);
     } else if (eventType === 'render-file') {
       handleRenderFileEvent(message.data);
+    } else if (eventType === 'render-inventory') {
+      handleRenderInventoryEvent(message.data);
+    } else if (eventType === 'render-notes') {
+      handleRenderNotesEvent(message.data);
+    } else if (eventType === 'secret-findings') {
+      handleSecretFindingsEvent(message.data);
     } else if (eventType === 'conversion-file') {
       handleConversionFileUpdatedMessage(message.data);
     } else if (eventType === 'conversion-status') {
@@ -471,12 +591,16 @@ export function useCentrifugo({
     }
   }, [
     handlePlanUpdated,
+    handlePlanChangesEvent,
     handleChatMessageUpdated,
     handleRevisionCreated,
     handleRenderStreamEvent,
     handleWorkspaceUpdated,
     handleArtifactUpdated,
     handleRenderFileEvent,
+    handleRenderInventoryEvent,
+    handleRenderNotesEvent,
+    handleSecretFindingsEvent,
     handleConversionFileUpdatedMessage,
     handleConversationUpdatedMessage
   ]);
@@ -493,7 +617,40 @@ export function useCentrifugo({
     if (!session?.user?.id || !workspace?.id) return;
 
     const channel = `${workspace.id}#${session.user.id}`;
+    const workspaceId = workspace.id;
     let cleanup: (() => void) | undefined;
+    lastEventSequenceRef.current = 0;
+    handledEventSequencesRef.current = new Set();
+
+    // replayJournal handles the events of the workspace's journal after the ones handled so far
+    const replayJournal = async () => {
+      const replay = await replayWorkspaceEventsAction(session, workspaceId, lastEventSequenceRef.current);
+      if (replay.truncated) {
+        // the events we missed were pruned, so reload the workspace instead
+        const freshWorkspace = await getWorkspaceAction(session, workspaceId);
+        if (freshWorkspace) {
+          setWorkspace(freshWorkspace);
+          setMessages(await getWorkspaceMessagesAction(session, workspaceId));
+        }
+      }
+      for (const event of replay.events) {
+        handleCentrifugoMessage({ data: event });
+      }
+    };
+
+    fillEventGapRef.current = async () => {
+      const handled = handledEventSequencesRef.current;
+      if (handled.size === 0) {
+        return;
+      }
+      const highest = Math.max(...Array.from(handled));
+      await replayJournal();
+      // what's still missing isn't in the journal, don't wait for it
+      if (lastEventSequenceRef.current < highest) {
+        lastEventSequenceRef.current = highest;
+        Array.from(handled).filter(s => s <= highest).forEach(s => handled.delete(s));
+      }
+    };
 
     // Move setupCentrifuge outside of the effect to avoid recreating on each render
     const setupCentrifuge = async () => {
@@ -571,6 +728,12 @@ export function useCentrifugo({
       sub.on("subscribed", async () => {
         console.log('Successfully subscribed to:', channel);
 
+        // after a reconnect, replay everything we missed from the workspace's event journal
+        if (lastEventSequenceRef.current > 0 || handledEventSequencesRef.current.size > 0) {
+          await replayJournal();
+          return;
+        }
+
         // call a server action to replay the events we maybe missed
         // when we first connected
         const replayedEvents = await replayEventsAction(session);
@@ -603,7 +766,14 @@ export function useCentrifugo({
     };
 
     setupCentrifuge();
-    return () => cleanup?.();
+    return () => {
+      if (eventGapTimerRef.current) {
+        clearTimeout(eventGapTimerRef.current);
+        eventGapTimerRef.current = null;
+      }
+      fillEventGapRef.current = null;
+      cleanup?.();
+    };
   }, [session?.user?.id, workspace?.id]); // Removed handleCentrifugoMessage from dependencies
 
   return {
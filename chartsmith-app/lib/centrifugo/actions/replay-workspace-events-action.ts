@@ -0,0 +1,11 @@
+"use server";
+
+import { Session } from "@/lib/types/session";
+import { logger } from "@/lib/utils/logger";
+import { listWorkspaceEventsSince, WorkspaceEventReplay } from "../centrifugo";
+
+export async function replayWorkspaceEventsAction(session: Session, workspaceId: string, since: number): Promise<WorkspaceEventReplay> {
+  logger.debug("replayWorkspaceEventsAction", { workspaceId, since });
+
+  return listWorkspaceEventsSince(workspaceId, since);
+}
@@ -22,6 +22,43 @@ export async function listReplayableEvents(userID: string): Promise<any[]> {
   }
 }
 
+export interface WorkspaceEventReplay {
+  events: any[];
+  // truncated is true when events after `since` were already pruned from the journal,
+  // and the client needs to reload the workspace instead of replaying
+  truncated: boolean;
+}
+
+export async function listWorkspaceEventsSince(workspaceId: string, since: number): Promise<WorkspaceEventReplay> {
+  logger.debug("listWorkspaceEventsSince", { workspaceId, since });
+  const db = getDB(await getParam("DB_URI"));
+  const result = await db.query(
+    `SELECT sequence, message_data FROM realtime_event_journal
+      WHERE workspace_id = $1 AND sequence > $2
+      ORDER BY sequence ASC`,
+    [workspaceId, since]
+  );
+
+  const events = result.rows.map((row) => ({
+    ...row.message_data,
+    eventSequence: Number(row.sequence),
+  }));
+
+  let truncated = false;
+  if (since > 0) {
+    const oldest = events.length > 0 ? events[0].eventSequence : undefined;
+    if (oldest !== undefined) {
+      truncated = oldest > since + 1;
+    } else {
+      const seqResult = await db.query(`SELECT last_sequence FROM realtime_event_sequence WHERE workspace_id = $1`, [workspaceId]);
+      const lastSequence = seqResult.rows.length > 0 ? Number(seqResult.rows[0].last_sequence) : 0;
+      truncated = lastSequence > since;
+    }
+  }
+
+  return { events, truncated };
+}
+
 export async function getCentrifugoToken(userID: string): Promise<string> {
   logger.debug("Getting centrifugo token for user", { userID });
   try {
@@ -0,0 +1,51 @@
+import { getParam } from "./param";
+
+// InternalApiError is a response from the worker's internal API that wasn't successful,
+// status is the worker's status so that routes can pass it on. body is the worker's response,
+// a 409 from a plan that's refused while another executes has the executing plan's planId.
+export class InternalApiError extends Error {
+  constructor(public status: number, message: string, public body: Record<string, unknown> = {}) {
+    super(message);
+  }
+}
+
+// getInternalApi requests path from the worker's internal API on behalf of userId, the worker
+// checks the user's role in the workspace.
+export async function getInternalApi<T>(path: string, userId: string): Promise<T> {
+  return requestInternalApi<T>("GET", path, userId);
+}
+
+// postInternalApi posts body to path of the worker's internal API on behalf of userId, as a
+// multipart form when it's FormData and as JSON otherwise.
+export async function postInternalApi<T>(path: string, userId: string, body: unknown): Promise<T> {
+  return requestInternalApi<T>("POST", path, userId, body);
+}
+
+async function requestInternalApi<T>(method: string, path: string, userId: string, body?: unknown): Promise<T> {
+  const url = await getParam("INTERNAL_API_URL");
+  const apiKey = await getParam("INTERNAL_API_KEY");
+
+  const headers: Record<string, string> = {
+    "X-Internal-API-Key": apiKey,
+    "X-Chartsmith-User-ID": userId,
+  };
+  // fetch sets the multipart boundary of a form itself
+  const isForm = body instanceof FormData;
+  if (body !== undefined && !isForm) {
+    headers["Content-Type"] = "application/json";
+  }
+
+  const response = await fetch(`${url.replace(/\/$/, "")}${path}`, {
+    method,
+    headers,
+    body: body === undefined ? undefined : isForm ? body : JSON.stringify(body),
+    cache: "no-store",
+  });
+
+  const responseBody = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new InternalApiError(response.status, responseBody.error || response.statusText, responseBody);
+  }
+
+  return responseBody as T;
+}
@@ -22,6 +22,18 @@ export async function getParam(key: string): Promise<string> {
         throw new Error("Database URI not configured. Set either CHARTSMITH_PG_URI or DB_URI environment variable.");
       }
       return dbUri;
+    case "INTERNAL_API_URL":
+      const internalApiUrl = process.env["CHARTSMITH_INTERNAL_API_URL"];
+      if (!internalApiUrl) {
+        throw new Error("Internal API URL not configured. Set the CHARTSMITH_INTERNAL_API_URL environment variable.");
+      }
+      return internalApiUrl;
+    case "INTERNAL_API_KEY":
+      const internalApiKey = process.env["CHARTSMITH_INTERNAL_API_KEY"];
+      if (!internalApiKey) {
+        throw new Error("Internal API key not configured. Set the CHARTSMITH_INTERNAL_API_KEY environment variable.");
+      }
+      return internalApiKey;
     default:
       throw new Error(`unknown param ${key}`);
   }
@@ -0,0 +1,28 @@
+import { formatStrReplaceFailuresJSONL, StrReplaceFailure } from '../str-replace-failures';
+
+describe('formatStrReplaceFailuresJSONL', () => {
+  test('writes one failure per line', () => {
+    const failure: StrReplaceFailure = {
+      id: 'a',
+      createdAt: '2025-03-01T12:00:00Z',
+      filePath: 'templates/deployment.yaml',
+      oldStr: 'replicas: 1\n',
+      newStr: 'replicas: 2\n',
+      fileContent: 'replicas:  1\n',
+      oldStrLen: 12,
+      newStrLen: 12,
+      errorMessage: 'not found',
+      failureKind: 'indentation',
+    };
+
+    const lines = formatStrReplaceFailuresJSONL([failure, { ...failure, id: 'b' }]).split('\n');
+    expect(lines).toHaveLength(3);
+    expect(JSON.parse(lines[0])).toEqual(failure);
+    expect(JSON.parse(lines[1]).id).toBe('b');
+    expect(lines[2]).toBe('');
+  });
+
+  test('is empty without failures', () => {
+    expect(formatStrReplaceFailuresJSONL([])).toBe('');
+  });
+});
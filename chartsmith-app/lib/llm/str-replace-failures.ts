@@ -0,0 +1,34 @@
+import { getInternalApi } from "@/lib/data/internal-api";
+
+export interface StrReplaceFailure {
+  id: string;
+  createdAt: string;
+  filePath: string;
+  oldStr: string;
+  newStr: string;
+  // the content of the file when old_str wasn't found in it
+  fileContent: string;
+  oldStrLen: number;
+  newStrLen: number;
+  contextBefore?: string;
+  contextAfter?: string;
+  errorMessage?: string;
+  failureKind?: string;
+}
+
+export interface StrReplaceFailurePage {
+  failures: StrReplaceFailure[];
+  // passed as cursor to get the next page, missing on the last page
+  nextCursor?: string;
+}
+
+export function formatStrReplaceFailuresJSONL(failures: StrReplaceFailure[]): string {
+  return failures.map(failure => JSON.stringify(failure) + "\n").join("");
+}
+
+// listStrReplaceFailures asks the worker for a page of failed str_replace operations on behalf of
+// userId, who must be an admin. query has the worker's limit, since, filePath and cursor filters.
+export async function listStrReplaceFailures(userId: string, query: URLSearchParams): Promise<StrReplaceFailurePage> {
+  const search = query.toString();
+  return getInternalApi<StrReplaceFailurePage>(`/api/admin/str-replace-failures${search ? `?${search}` : ""}`, userId);
+}
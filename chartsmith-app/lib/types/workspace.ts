@@ -16,12 +16,27 @@ export interface Workspace {
   createdByUserId?: string;
 }
 
+// ImportFinding is a problem the worker found validating the files of an imported chart. A fatal
+// finding, such as a missing Chart.yaml, aborts the import.
+export interface ImportFinding {
+  category: "missing_chart_yaml" | "invalid_chart_yaml" | "template_parse" | "file_too_large" | "binary_file" | "case_duplicate";
+  severity: "warning" | "fatal";
+  path?: string;
+  message: string;
+}
+
+export interface ImportReport {
+  findings: ImportFinding[];
+}
+
 export interface WorkspaceFile {
   id: string;
   revisionNumber: number;
   filePath: string;
   content: string;
   contentPending?: string;
+  // version is incremented on every write, writers pass the version they read to detect conflicts
+  version?: number;
 }
 
 export interface Chart {
@@ -38,6 +53,28 @@ export interface RenderedWorkspace {
   completedAt?: Date;
   charts: RenderedChart[];
   isAutorender: boolean;
+  // what the render deploys, set once it completes
+  inventory?: RenderInventory;
+}
+
+export interface RenderInventory {
+  kinds: Record<string, number>;
+  namespaces: string[];
+  images: string[];
+  totalReplicas: number;
+  // documents that aren't YAML objects with a kind
+  unparsed: number;
+}
+
+// a secret found in a file, the value is redacted
+export interface SecretFinding {
+  filePath: string;
+  detector: string;
+  line: number;
+  fingerprint: string;
+  redacted: string;
+  // set when content with the secret can be sent to the LLM
+  acknowledged: boolean;
 }
 
 export interface RenderedChart {
@@ -51,8 +88,15 @@ export interface RenderedChart {
   helmTemplateCommand?: string;
   helmTemplateStdout?: string;
   helmTemplateStderr?: string;
+  // lines of helmTemplateStderr that are non-fatal warnings, a render with only warnings succeeds
+  helmTemplateWarnings?: string[];
+  // the rendered NOTES.txt, null when the chart has none
+  notes?: string | null;
+  // one line summary of the Kubernetes versions the chart's output can be installed on
+  compatibility?: string;
   createdAt: Date;
   completedAt?: Date;
+  error?: string;
   renderedFiles: RenderedFile[];
 }
 
@@ -81,6 +125,8 @@ export interface Conversion {
   chatMessageIds: string[];
   createdAt: Date;
   sourceFiles: ConversionFile[];
+  // log records how the source was prepared for conversion, such as the Kustomize build
+  log?: string;
 }
 
 export enum ConversionFileStatus {
@@ -112,7 +158,11 @@ export interface Plan {
 export interface ActionFile {
   action: string;
   path: string;
+  chartId?: string;
+  // pending, creating, created or failed
   status: string;
+  // why the action failed, when status is failed
+  error?: string;
 }
 
 export interface ChatMessage {
@@ -136,6 +186,7 @@ export interface ChatMessage {
   isIgnored?: boolean;
   planId?: string;
   messageFromPersona?: ChatMessageFromPersona;
+  isSystemGenerated?: boolean;
 }
 
 export interface FollowupAction {
@@ -0,0 +1,72 @@
+import { filterHelmIgnored, HelmIgnore } from '../helmignore';
+
+describe('HelmIgnore', () => {
+  test('documented example', () => {
+    const rules = HelmIgnore.parse(`# comment
+.git
+*/temp*
+*/*/temp*
+temp?
+`);
+
+    for (const name of ['.git/HEAD', 'ci/temp-values.yaml', 'templates/tests/temp.yaml', 'tempA', 'templates/temp1']) {
+      expect(rules.ignoreFile(name)).toBe(true);
+    }
+    for (const name of ['Chart.yaml', 'values.yaml', 'temp.yaml', 'templates/deployment.yaml', 'templates/a/b/temp.yaml']) {
+      expect(rules.ignoreFile(name)).toBe(false);
+    }
+  });
+
+  test('single rules', () => {
+    const cases: [string, string, boolean, boolean][] = [
+      ['*.txt', 'cargo/a.txt', false, true],
+      ['cargo/*.txt', 'mast/a.txt', false, false],
+      ['ru[c-e]?er.txt', 'rudder.txt', false, true],
+      ['.*', '.', true, false],
+      ['cargo/', 'cargo', true, true],
+      ['helm.txt/', 'helm.txt', false, false],
+      ['!helm.txt', 'helm.txt', false, false],
+      ['!helm.txt', 'tiller.txt', false, true],
+      ['/a.txt', 'a.txt', false, true],
+      ['/a.txt', 'cargo/a.txt', false, false],
+    ];
+    for (const [pattern, name, isDir, expected] of cases) {
+      expect(HelmIgnore.parse(pattern).ignore(name, isDir)).toBe(expected);
+    }
+  });
+
+  test('a negation does not bring back a file ignored by an earlier rule', () => {
+    const rules = HelmIgnore.parse('*.txt\n!keep.txt\n');
+    expect(rules.ignoreFile('keep.txt')).toBe(true);
+    expect(rules.ignoreFile('Chart.yaml')).toBe(true);
+  });
+
+  test('a lone negation ignores everything else', () => {
+    const rules = HelmIgnore.parse('!keep.txt\n');
+    expect(rules.ignoreFile('keep.txt')).toBe(false);
+    expect(rules.ignoreFile('templates/keep.txt')).toBe(true);
+  });
+
+  test('rejects double star', () => {
+    expect(() => HelmIgnore.parse('templates/**/*.yaml')).toThrow();
+  });
+});
+
+describe('filterHelmIgnored', () => {
+  test('filters the files of the chart directory', () => {
+    const files = [
+      { filePath: 'Chart.yaml', content: '' },
+      { filePath: '.helmignore', content: 'ci/\n*.orig\n' },
+      { filePath: 'ci/values-test.yaml', content: '' },
+      { filePath: 'templates/deployment.yaml', content: '' },
+      { filePath: 'templates/deployment.yaml.orig', content: '' },
+      { filePath: 'templates/.deployment.yaml.swp', content: '' },
+    ];
+
+    expect(filterHelmIgnored(files, '').map(file => file.filePath)).toEqual([
+      'Chart.yaml',
+      '.helmignore',
+      'templates/deployment.yaml',
+    ]);
+  });
+});
@@ -0,0 +1,44 @@
+import { hasKustomization, isRemoteReference, validateKustomizations } from '../kustomize';
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+`;
+
+describe('kustomize', () => {
+  test('detects kustomizations', () => {
+    expect(hasKustomization([{ id: '1', revisionNumber: 1, filePath: 'base/kustomization.yaml', content: '' }])).toBe(true);
+    expect(hasKustomization([{ id: '1', revisionNumber: 1, filePath: 'deployment.yaml', content: deployment }])).toBe(false);
+  });
+
+  test('remote references', () => {
+    expect(isRemoteReference('../base')).toBe(false);
+    expect(isRemoteReference('deployment.yaml')).toBe(false);
+    expect(isRemoteReference('https://example.com/manifests.yaml')).toBe(true);
+    expect(isRemoteReference('github.com/example/app/config?ref=v1')).toBe(true);
+    expect(isRemoteReference('git@github.com:example/app.git')).toBe(true);
+  });
+
+  test('valid overlays', () => {
+    expect(validateKustomizations([
+      { id: '1', revisionNumber: 1, filePath: 'base/kustomization.yaml', content: 'resources:\n  - deployment.yaml\n' },
+      { id: '2', revisionNumber: 1, filePath: 'base/deployment.yaml', content: deployment },
+      { id: '3', revisionNumber: 1, filePath: 'overlays/prod/kustomization.yaml', content: 'resources:\n  - ../../base\npatches:\n  - path: replicas.yaml\n' },
+      { id: '4', revisionNumber: 1, filePath: 'overlays/prod/replicas.yaml', content: deployment },
+    ])).toBeNull();
+  });
+
+  test('rejects remote bases', () => {
+    expect(validateKustomizations([
+      { id: '1', revisionNumber: 1, filePath: 'kustomization.yaml', content: 'resources:\n  - github.com/example/app/config?ref=v1\n' },
+    ])).toContain('remote base');
+  });
+
+  test('rejects missing files', () => {
+    expect(validateKustomizations([
+      { id: '1', revisionNumber: 1, filePath: 'kustomization.yaml', content: 'resources:\n  - deployment.yaml\nconfigMapGenerator:\n  - name: config\n    files:\n      - app.properties\n' },
+      { id: '2', revisionNumber: 1, filePath: 'deployment.yaml', content: deployment },
+    ])).toContain('app.properties');
+  });
+});
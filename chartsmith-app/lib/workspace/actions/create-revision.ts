@@ -3,10 +3,26 @@
 import { Session } from "@/lib/types/session";
 import { createRevision, getPlan, getWorkspace } from "../workspace";
 import { Workspace } from "@/lib/types/workspace";
+import { InternalApiError } from "@/lib/data/internal-api";
 
-export async function createRevisionAction(session: Session, planId: string): Promise<Workspace | undefined> {
+interface CreateRevisionResult {
+  workspace?: Workspace;
+  error?: string;
+}
+
+export async function createRevisionAction(session: Session, planId: string): Promise<CreateRevisionResult> {
   const plan = await getPlan(planId);
-  await createRevision(plan, session.user.id);
+  try {
+    await createRevision(plan, session.user.id);
+  } catch (err) {
+    if (err instanceof InternalApiError && err.status === 409) {
+      return { error: "Another plan is being applied to this workspace. Try again once it finishes." };
+    }
+    if (err instanceof InternalApiError && err.status < 500) {
+      return { error: err.message };
+    }
+    throw err;
+  }
   const workspace = await getWorkspace(plan.workspaceId);
-  return workspace;
+  return { workspace };
 }
@@ -4,9 +4,12 @@ import { Session } from "@/lib/types/session";
 import { Workspace } from "@/lib/types/workspace";
 import { logger } from "@/lib/utils/logger";
 import { ChatMessageFromPersona, ChatMessageIntent, CreateChatMessageParams, createWorkspace } from "../workspace";
-import { getChartFromBytes, getFilesFromBytes } from "../archive";
+import { getFilesFromBytes } from "../archive";
+import { hasKustomization, validateKustomizations } from "../kustomize";
 
-export async function createWorkspaceFromArchiveAction(userId: string, formData: FormData, archiveType: 'helm' | 'k8s'): Promise<Workspace> {
+// createWorkspaceFromArchiveAction creates a workspace that converts the Kubernetes manifests in an
+// uploaded archive to a chart. Helm charts are imported by the worker, see /api/upload-chart.
+export async function createWorkspaceFromArchiveAction(userId: string, formData: FormData, archiveType: 'k8s'): Promise<Workspace> {
   const file = formData.get('file') as File;
   if (!file) {
     throw new Error('No file provided');
@@ -16,25 +19,22 @@ export async function createWorkspaceFromArchiveAction(userId: string, formData:
 
   const bytes = await file.arrayBuffer();
 
-  if (archiveType === 'helm') {
-    const baseChart = await getChartFromBytes(bytes, file.name);
+  if (archiveType === 'k8s') {
+    const looseFiles = await getFilesFromBytes(bytes, file.name);
 
-    const createChartMessageParams: CreateChatMessageParams = {
-      prompt: `Import the Helm chart from the uploaded file named ${file.name}`,
-      response: `Got it. I found a ${baseChart.name} chart in the ${file.name} file. What's next?`,
-      knownIntent: ChatMessageIntent.NON_PLAN,
-      responseRollbackToRevisionNumber: 1,
-      messageFromPersona: ChatMessageFromPersona.AUTO,
+    // a Kustomize project is built by the worker before it's converted, reject what it can't build
+    const isKustomize = hasKustomization(looseFiles);
+    if (isKustomize) {
+      const invalid = validateKustomizations(looseFiles);
+      if (invalid) {
+        throw new Error(invalid);
+      }
     }
-    const w: Workspace = await createWorkspace("archive", userId, createChartMessageParams, baseChart);
-
-    return w;
-  } else if (archiveType === 'k8s') {
-    const looseFiles = await getFilesFromBytes(bytes, file.name);
+    const source = isKustomize ? "Kustomize project" : "Kubernetes manifests";
 
     const createChartMessageParams: CreateChatMessageParams = {
-      prompt: `Create a Helm chart from the Kubernetes manifests in the uploaded file named ${file.name}`,
-      response: `I'll create a Helm chart from the Kubernetes manifests in the uploaded file named ${file.name}`,
+      prompt: `Create a Helm chart from the ${source} in the uploaded file named ${file.name}`,
+      response: `I'll create a Helm chart from the ${source} in the uploaded file named ${file.name}`,
       knownIntent: ChatMessageIntent.CONVERT_K8S_TO_HELM,
       additionalFiles: looseFiles,
       responseRollbackToRevisionNumber: 1,
@@ -5,14 +5,16 @@ import { ChatMessageFromPersona, CreateChatMessageParams, createWorkspace } from
 import { Workspace } from "@/lib/types/workspace";
 import { logger } from "@/lib/utils/logger";
 
-export async function createWorkspaceFromPromptAction(session: Session, prompt: string): Promise<Workspace> {
-  logger.info("Creating workspace from prompt", { prompt, userId: session.user.id });
+// bootstrapTemplate is the name of the scaffold the workspace starts from, the default one when
+// it's not given
+export async function createWorkspaceFromPromptAction(session: Session, prompt: string, bootstrapTemplate?: string): Promise<Workspace> {
+  logger.info("Creating workspace from prompt", { prompt, userId: session.user.id, bootstrapTemplate });
 
   const createChartMessageParams: CreateChatMessageParams = {
     prompt: prompt,
     messageFromPersona: ChatMessageFromPersona.AUTO,
   }
-  const w = await createWorkspace("prompt", session.user.id, createChartMessageParams);
+  const w = await createWorkspace("prompt", session.user.id, createChartMessageParams, undefined, undefined, bootstrapTemplate);
 
   return w;
 }
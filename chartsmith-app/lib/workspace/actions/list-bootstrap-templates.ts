@@ -0,0 +1,8 @@
+"use server";
+
+import { Session } from "@/lib/types/session";
+import { BootstrapTemplate, listBootstrapTemplates } from "../bootstrap-templates";
+
+export async function listBootstrapTemplatesAction(session: Session): Promise<BootstrapTemplate[]> {
+  return listBootstrapTemplates(session.user.id);
+}
@@ -3,6 +3,7 @@
 import { Session } from "@/lib/types/session";
 import { getWorkspace, rollbackToRevision } from "../workspace";
 import { Workspace } from "@/lib/types/workspace";
+import { InternalApiError } from "@/lib/data/internal-api";
 
 export async function rollbackWorkspaceAction(session: Session, workspaceId: string, revisionNumber: number): Promise<Workspace> {
   const workspace = await getWorkspace(workspaceId);
@@ -10,7 +11,17 @@ export async function rollbackWorkspaceAction(session: Session, workspaceId: str
     throw new Error("Workspace not found");
   }
 
-  await rollbackToRevision(workspaceId, revisionNumber);
+  try {
+    await rollbackToRevision(workspaceId, revisionNumber, session.user.id);
+  } catch (err) {
+    if (err instanceof InternalApiError && err.status === 409) {
+      throw new Error("A plan is being applied to this workspace. Try again once it finishes.");
+    }
+    if (err instanceof InternalApiError && err.status < 500) {
+      throw new Error(err.message);
+    }
+    throw err;
+  }
 
   const updatedWorkspace = await getWorkspace(workspaceId);
   if (!updatedWorkspace) {
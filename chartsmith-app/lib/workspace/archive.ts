@@ -8,6 +8,7 @@ import * as tar from 'tar';
 import gunzip from 'gunzip-maybe';
 import fetch from 'node-fetch';
 import yaml from 'yaml';
+import { filterHelmIgnored } from './helmignore';
 
 export async function getFilesFromBytes(bytes: ArrayBuffer, fileName: string): Promise<WorkspaceFile[]> {
   const id = srs.default({ length: 12, alphanumeric: true });
@@ -52,55 +53,6 @@ export async function getFilesFromBytes(bytes: ArrayBuffer, fileName: string): P
   return files;
 }
 
-export async function getChartFromBytes(bytes: ArrayBuffer, fileName: string): Promise<Chart> {
-  const id = srs.default({ length: 12, alphanumeric: true });
-
-  // save the bytes to a tmp file
-  const tmpDir = path.join(os.tmpdir(), 'chartsmith-chart-archive-' + Date.now());
-  await fs.mkdir(tmpDir);
-
-  // write the bytes to a file
-  const filePath = path.join(tmpDir, fileName);
-  await fs.writeFile(filePath, Buffer.from(bytes));
-
-  // Create extraction directory with base name (without extension)
-  const extractPath = path.join(tmpDir, 'extracted');
-  await fs.mkdir(extractPath);
-
-  // Check if the file is gzipped by looking at magic numbers
-  const fileBuffer = Buffer.from(bytes);
-  const isGzipped = fileBuffer[0] === 0x1f && fileBuffer[1] === 0x8b;
-
-  // Extract the file based on whether it's gzipped or not
-  await new Promise<void>((resolve, reject) => {
-    const readStream = fsSync.createReadStream(filePath);
-    const extractStream = tar.extract({ cwd: extractPath });
-
-    if (isGzipped) {
-      readStream
-        .pipe(gunzip())
-        .pipe(extractStream)
-        .on('finish', () => resolve())
-        .on('error', reject);
-    } else {
-      readStream
-        .pipe(extractStream)
-        .on('finish', () => resolve())
-        .on('error', reject);
-    }
-  });
-
-  const files: WorkspaceFile[] = await filesInArchive(extractPath);
-
-  const c: Chart = {
-    id: id,
-    name: await chartNameFromFiles(files),
-    files: files,
-  }
-
-  return c;
-}
-
 export async function getArchiveFromUrl(url: string): Promise<Chart> {
   // generate a random ID for the chart
   const id = srs.default({ length: 12, alphanumeric: true });
@@ -191,7 +143,21 @@ async function filesInArchive(extractPath: string): Promise<WorkspaceFile[]> {
 
   // remove anything in a "charts" directory
   const filesWithoutCharts = filesWithoutBinary.filter(file => !file.filePath.includes("charts/"));
-  return filesWithoutCharts;
+
+  // remove the files that the chart's .helmignore excludes, as helm would when loading the chart
+  return filterHelmIgnored(filesWithoutCharts, chartDirFromFiles(filesWithoutCharts));
+}
+
+// chartDirFromFiles returns the directory of the Chart.yaml with the shortest path, "" for the root
+function chartDirFromFiles(files: WorkspaceFile[]): string {
+  const chartYamls = files
+    .map(file => file.filePath.replace(/^\/+/, ""))
+    .filter(filePath => filePath === "Chart.yaml" || filePath.endsWith("/Chart.yaml"))
+    .sort((a, b) => a.length - b.length);
+  if (chartYamls.length === 0) {
+    return "";
+  }
+  return path.posix.dirname(chartYamls[0]).replace(/^\.$/, "");
 }
 
 async function chartNameFromFiles(files: WorkspaceFile[]): Promise<string> {
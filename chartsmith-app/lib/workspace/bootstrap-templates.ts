@@ -0,0 +1,13 @@
+import { getInternalApi } from "../data/internal-api";
+
+export interface BootstrapTemplate {
+  name: string;
+  default: boolean;
+}
+
+// listBootstrapTemplates asks the worker for the scaffold templates new workspaces can be created
+// from, ordered by name.
+export async function listBootstrapTemplates(userId: string): Promise<BootstrapTemplate[]> {
+  const response = await getInternalApi<{ templates: BootstrapTemplate[] }>("/api/bootstrap-templates", userId);
+  return response.templates;
+}
@@ -47,7 +47,8 @@ export async function listMessagesForWorkspace(workspaceID: string): Promise<Cha
                 workspace_chat.response_conversion_id,
                 workspace_chat.response_rollback_to_revision_number,
                 workspace_chat.revision_number,
-                workspace_chat.message_from_persona
+                workspace_chat.message_from_persona,
+                workspace_chat.is_system_generated
             FROM
                 workspace_chat
             WHERE
@@ -83,6 +84,7 @@ export async function listMessagesForWorkspace(workspaceID: string): Promise<Cha
         revisionNumber: row.revision_number,
         isComplete: true,
         messageFromPersona: row.message_from_persona,
+        isSystemGenerated: row.is_system_generated,
       };
 
       messages.push(message);
@@ -0,0 +1,162 @@
+// .helmignore with the same semantics as Helm, so that an imported chart only contains the files
+// Helm would load from it. This mirrors pkg/helmignore in the worker.
+
+export const HELMIGNORE_FILE_NAME = ".helmignore";
+
+// defaultRules are always applied by Helm, after the rules in the file
+const defaultRules = ["templates/.?*"];
+
+interface Pattern {
+  regex: RegExp;
+  negate: boolean;
+  mustDir: boolean;
+  // patterns without a / match the base name of the path
+  baseName: boolean;
+}
+
+// globToRegExp converts a glob with the syntax of Go's path.Match, where * and ? never match a /
+function globToRegExp(glob: string): RegExp {
+  let re = "";
+  for (let i = 0; i < glob.length; i++) {
+    const c = glob[i];
+    if (c === "*") {
+      re += "[^/]*";
+    } else if (c === "?") {
+      re += "[^/]";
+    } else if (c === "\\") {
+      i++;
+      if (i >= glob.length) {
+        throw new Error(`syntax error in pattern ${glob}`);
+      }
+      re += escapeRegExp(glob[i]);
+    } else if (c === "[") {
+      const end = glob.indexOf("]", i + 2);
+      if (end === -1) {
+        throw new Error(`syntax error in pattern ${glob}`);
+      }
+      let cls = glob.substring(i + 1, end);
+      let negated = false;
+      if (cls.startsWith("^")) {
+        negated = true;
+        cls = cls.substring(1);
+      }
+      if (cls === "" || /(^|[^\\])-$/.test(cls) || cls.startsWith("-")) {
+        throw new Error(`syntax error in pattern ${glob}`);
+      }
+      re += `[${negated ? "^/" : ""}${cls.replace(/[\]\[]/g, "\\$&")}]`;
+      i = end;
+    } else {
+      re += escapeRegExp(c);
+    }
+  }
+  return new RegExp(`^${re}$`);
+}
+
+function escapeRegExp(s: string): string {
+  return s.replace(/[.*+?^${}()|[\]\\\/]/g, "\\$&");
+}
+
+function basename(name: string): string {
+  const trimmed = name.replace(/\/+$/, "");
+  return trimmed.substring(trimmed.lastIndexOf("/") + 1);
+}
+
+export class HelmIgnore {
+  private patterns: Pattern[] = [];
+
+  // parse reads the content of a .helmignore: blank lines and lines starting with # are skipped,
+  // a leading ! negates a pattern and a trailing / only matches directories. ** isn't supported.
+  static parse(content: string): HelmIgnore {
+    const rules = new HelmIgnore();
+    for (const line of [...content.split(/\r?\n/), ...defaultRules]) {
+      rules.addRule(line);
+    }
+    return rules;
+  }
+
+  private addRule(line: string) {
+    let rule = line.trim();
+    if (rule === "" || rule.startsWith("#")) {
+      return;
+    }
+    if (rule.includes("**")) {
+      throw new Error(`double-star (**) syntax is not supported: ${rule}`);
+    }
+
+    const pattern: Pattern = { regex: /$^/, negate: false, mustDir: false, baseName: false };
+    if (rule.startsWith("!")) {
+      pattern.negate = true;
+      rule = rule.substring(1);
+    }
+    if (rule.endsWith("/")) {
+      pattern.mustDir = true;
+      rule = rule.substring(0, rule.length - 1);
+    }
+    if (rule.startsWith("/")) {
+      rule = rule.substring(1);
+    } else if (!rule.includes("/")) {
+      pattern.baseName = true;
+    }
+    pattern.regex = globToRegExp(rule);
+
+    this.patterns.push(pattern);
+  }
+
+  // ignore reports whether a path relative to the chart directory is ignored. The first rule that
+  // decides wins, and as in Helm a path that doesn't match a negated pattern is ignored, so
+  // "!keep.txt" doesn't bring back a keep.txt ignored by an earlier "*.txt".
+  ignore(name: string, isDir: boolean): boolean {
+    if (name === "" || name === "." || name === "./") {
+      return false;
+    }
+
+    for (const p of this.patterns) {
+      const matched = p.regex.test(p.baseName ? basename(name) : name.replace(/\/+$/, ""));
+      if (p.negate) {
+        if (p.mustDir && !isDir) {
+          return true;
+        }
+        if (!matched) {
+          return true;
+        }
+        continue;
+      }
+
+      if (p.mustDir && !isDir) {
+        continue;
+      }
+      if (matched) {
+        return true;
+      }
+    }
+
+    return false;
+  }
+
+  // ignoreFile reports whether a file is ignored, itself or because Helm skips one of its directories
+  ignoreFile(name: string): boolean {
+    const parts = name.replace(/^\/+/, "").split("/");
+    for (let i = 1; i < parts.length; i++) {
+      if (this.ignore(parts.slice(0, i).join("/"), true)) {
+        return true;
+      }
+    }
+    return this.ignore(parts.join("/"), false);
+  }
+}
+
+// filterHelmIgnored removes the files of the chart in chartDir ("" for the root) that its
+// .helmignore, or Helm's defaults when it has none, exclude. Files outside of chartDir are kept.
+export function filterHelmIgnored<T extends { filePath: string; content: string }>(files: T[], chartDir: string): T[] {
+  const prefix = chartDir === "" ? "" : `${chartDir.replace(/\/+$/, "")}/`;
+  const ignoreFile = files.find(file => file.filePath.replace(/^\/+/, "") === `${prefix}${HELMIGNORE_FILE_NAME}`);
+  const rules = HelmIgnore.parse(ignoreFile?.content ?? "");
+
+  return files.filter(file => {
+    const filePath = file.filePath.replace(/^\/+/, "");
+    if (!filePath.startsWith(prefix)) {
+      return true;
+    }
+    return !rules.ignoreFile(filePath.substring(prefix.length));
+  });
+}
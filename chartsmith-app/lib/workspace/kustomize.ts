@@ -0,0 +1,93 @@
+import path from "path";
+import yaml from "yaml";
+
+import { WorkspaceFile } from "../types/workspace";
+
+// Detection and validation of Kustomize projects in an archive. The worker builds them, this
+// rejects what it couldn't build before a conversion is created. This mirrors pkg/kustomize.
+
+export const KUSTOMIZATION_FILE_NAMES = ["kustomization.yaml", "kustomization.yml", "Kustomization"];
+
+export function isKustomization(filePath: string): boolean {
+  return KUSTOMIZATION_FILE_NAMES.includes(path.posix.basename(filePath));
+}
+
+export function hasKustomization(files: WorkspaceFile[]): boolean {
+  return files.some(file => isKustomization(file.filePath));
+}
+
+// isRemoteReference reports whether a reference is a URL or a git repository rather than a local path
+export function isRemoteReference(ref: string): boolean {
+  return ref.includes("://") ||
+    ref.startsWith("git@") ||
+    ref.includes("?ref=") ||
+    ref.includes("//") ||
+    /^[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+(:[0-9]+)?\//.test(ref);
+}
+
+function strings(value: unknown): string[] {
+  return Array.isArray(value) ? value.filter((v): v is string => typeof v === "string") : [];
+}
+
+function fileReferences(kustomization: Record<string, unknown>): string[] {
+  const refs = [...strings(kustomization.crds), ...strings(kustomization.patchesStrategicMerge)];
+  for (const key of ["patches", "patchesJson6902"]) {
+    for (const patch of (Array.isArray(kustomization[key]) ? kustomization[key] as Record<string, unknown>[] : [])) {
+      if (typeof patch?.path === "string") {
+        refs.push(patch.path);
+      }
+    }
+  }
+  for (const key of ["configMapGenerator", "secretGenerator"]) {
+    for (const generator of (Array.isArray(kustomization[key]) ? kustomization[key] as Record<string, unknown>[] : [])) {
+      // files can be given a key, as in key=path
+      refs.push(...strings(generator?.files).map(f => f.includes("=") ? f.substring(f.indexOf("=") + 1) : f));
+      refs.push(...strings(generator?.envs));
+      if (typeof generator?.env === "string") {
+        refs.push(generator.env);
+      }
+    }
+  }
+  return refs;
+}
+
+// validateKustomizations returns why the Kustomize project in the files can't be converted, or
+// null if it can be. Remote bases and references to files that aren't in the archive are rejected.
+export function validateKustomizations(files: WorkspaceFile[]): string | null {
+  const paths = new Set(files.map(file => path.posix.normalize(file.filePath)));
+  const dirs = new Set(files.filter(file => isKustomization(file.filePath)).map(file => path.posix.dirname(path.posix.normalize(file.filePath))));
+
+  for (const file of files) {
+    if (!isKustomization(file.filePath)) {
+      continue;
+    }
+
+    let kustomization: Record<string, unknown>;
+    try {
+      kustomization = yaml.parse(file.content) || {};
+    } catch (err) {
+      return `${file.filePath} is not valid YAML: ${err instanceof Error ? err.message : String(err)}`;
+    }
+
+    const dir = path.posix.dirname(path.posix.normalize(file.filePath));
+    const resourceRefs = [...strings(kustomization.resources), ...strings(kustomization.bases), ...strings(kustomization.components)];
+    for (const ref of [...resourceRefs, ...fileReferences(kustomization)]) {
+      if (isRemoteReference(ref)) {
+        return `${file.filePath} references the remote base ${ref}. Remote bases aren't supported, include the base in the archive instead.`;
+      }
+    }
+    for (const ref of resourceRefs) {
+      const target = path.posix.join(dir, ref);
+      if (!paths.has(target) && !dirs.has(target)) {
+        return `${file.filePath} references ${ref}, which is not in the archive.`;
+      }
+    }
+    for (const ref of fileReferences(kustomization)) {
+      if (!paths.has(path.posix.join(dir, ref))) {
+        return `${file.filePath} references ${ref}, which is not in the archive.`;
+      }
+    }
+  }
+
+  return null;
+}
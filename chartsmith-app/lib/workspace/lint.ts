@@ -0,0 +1,44 @@
+import { getDB } from "@/lib/data/db";
+import { getParam } from "@/lib/data/param";
+
+// This mirrors ListLintFindings in pkg/workspace/lint.go, keep them in sync.
+
+export interface LintFinding {
+  ruleId: string;
+  severity: "error" | "warning" | "info";
+  filePath: string;
+  line: number;
+  message: string;
+  suggestion?: string;
+}
+
+// listLintFindings returns the lint findings of a workspace at a revision, the current revision if
+// none is given
+export async function listLintFindings(workspaceId: string, revisionNumber?: number): Promise<LintFinding[]> {
+  const db = getDB(await getParam("DB_URI"));
+
+  if (revisionNumber === undefined) {
+    const workspaceResult = await db.query(`SELECT current_revision_number FROM workspace WHERE id = $1`, [workspaceId]);
+    if (workspaceResult.rows.length === 0) {
+      throw new Error(`Workspace ${workspaceId} not found`);
+    }
+    revisionNumber = workspaceResult.rows[0].current_revision_number as number;
+  }
+
+  const result = await db.query(
+    `SELECT rule_id, severity, file_path, line, message, suggestion
+      FROM workspace_lint_finding
+      WHERE workspace_id = $1 AND revision_number = $2
+      ORDER BY chart_id, idx`,
+    [workspaceId, revisionNumber],
+  );
+
+  return result.rows.map(row => ({
+    ruleId: row.rule_id,
+    severity: row.severity,
+    filePath: row.file_path,
+    line: row.line,
+    message: row.message,
+    suggestion: row.suggestion || undefined,
+  }));
+}
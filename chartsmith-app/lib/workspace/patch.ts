@@ -3,7 +3,79 @@ import { WorkspaceFile } from "../types/workspace";
 import { logger } from "../utils/logger";
 import { getDB } from "../data/db";
 import { getParam } from "../data/param";
+import { PoolClient } from "pg";
+
+// FILE_LOCK_TIMEOUT_MS is how long a write waits for a file another writer holds, it's the
+// worker's persistence.DefaultLockTimeout
+const FILE_LOCK_TIMEOUT_MS = 5000;
+
+// lockNotAvailable is the Postgres error code of a lock that wasn't taken within lock_timeout
+const lockNotAvailable = "55P03";
+
+// FileConflictError is thrown when a file was written by someone else since the caller read it.
+// It carries what's stored now so that the caller can offer to merge.
+export class FileConflictError extends Error {
+  constructor(
+    public fileId: string,
+    public currentContent: string,
+    public currentContentPending: string | undefined,
+    public version: number,
+  ) {
+    super(`File ${fileId} was modified concurrently, it is now at version ${version}`);
+    this.name = "FileConflictError";
+  }
+}
 
+// FileBusyError is thrown when another writer, such as a plan being applied, held the file for
+// longer than FILE_LOCK_TIMEOUT_MS.
+export class FileBusyError extends Error {
+  constructor(public fileId: string) {
+    super(`File ${fileId} is being written by another writer`);
+    this.name = "FileBusyError";
+  }
+}
+
+// withFileLock runs fn in a transaction that holds the file's advisory lock. It's the lock the
+// worker's lockFiles (pkg/workspace/file-lock.go) takes, so that an edit or a patch review can't
+// interleave with a plan or a new revision writing the same file.
+async function withFileLock<T>(fileID: string, revisionNumber: number, fn: (client: PoolClient) => Promise<T>): Promise<T> {
+  const db = getDB(await getParam("DB_URI"));
+  const client = await db.connect();
+  try {
+    await client.query('BEGIN');
+
+    const rows = await client.query(`SELECT workspace_id, file_path FROM workspace_file WHERE id = $1 AND revision_number = $2`, [fileID, revisionNumber]);
+    if (rows.rows.length === 0) {
+      throw new Error(`File ${fileID} not found at revision ${revisionNumber}`);
+    }
+    const { workspace_id: workspaceId, file_path: filePath } = rows.rows[0];
+
+    await client.query(`SELECT set_config('lock_timeout', $1, true)`, [`${FILE_LOCK_TIMEOUT_MS}ms`]);
+    try {
+      await client.query(`SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, [`workspace_file:${workspaceId}:${revisionNumber}:${filePath}`]);
+    } catch (err) {
+      if ((err as { code?: string }).code === lockNotAvailable) {
+        throw new FileBusyError(fileID);
+      }
+      throw err;
+    }
+    await client.query(`SET LOCAL lock_timeout TO DEFAULT`);
+
+    const result = await fn(client);
+    await client.query('COMMIT');
+    return result;
+  } catch (err) {
+    await client.query('ROLLBACK');
+    throw err;
+  } finally {
+    client.release();
+  }
+}
+
+async function throwConflict(fileID: string, revisionNumber: number): Promise<never> {
+  const current = await getFile(fileID, revisionNumber);
+  throw new FileConflictError(fileID, current.content, current.contentPending, current.version ?? 0);
+}
 
 export async function getFile(fileID: string, revisionNumber: number): Promise<WorkspaceFile> {
   logger.info(`Getting file ${fileID} at revision ${revisionNumber}`);
@@ -18,7 +90,8 @@ export async function getFile(fileID: string, revisionNumber: number): Promise<W
           workspace_id,
           file_path,
           content,
-          content_pending
+          content_pending,
+          version
         FROM
           workspace_file
         WHERE
@@ -36,6 +109,7 @@ export async function getFile(fileID: string, revisionNumber: number): Promise<W
       filePath: rows.rows[0].file_path,
       content: rows.rows[0].content,
       contentPending: rows.rows[0].content_pending,
+      version: rows.rows[0].version,
     }
 
     return file;
@@ -77,17 +151,18 @@ export async function rejectPatch(fileID: string, revisionNumber: number): Promi
   logger.info(`Rejecting patch for file ${fileID} at revision ${revisionNumber}`);
 
   try {
-    const db = getDB(await getParam("DB_URI"))
-    const rows = await db.query(`SELECT content_pending FROM workspace_file WHERE id = $1 AND revision_number = $2`, [fileID, revisionNumber]);
-    const row = rows.rows[0];
-
-    if (!row) {
-      throw new Error(`File ${fileID} not found at revision ${revisionNumber}`);
+    const written = await withFileLock(fileID, revisionNumber, async (client) => {
+      const rows = await client.query(`SELECT content_pending, version FROM workspace_file WHERE id = $1 AND revision_number = $2`, [fileID, revisionNumber]);
+      const row = rows.rows[0];
+
+      // clear the pending content, unless it was replaced since we read it
+      const result = await client.query(`UPDATE workspace_file SET content_pending = NULL, content_pending_base_sha = NULL, version = version + 1 WHERE id = $1 AND revision_number = $2 AND version = $3`, [fileID, revisionNumber, row.version]);
+      return result.rowCount !== 0;
+    });
+    if (!written) {
+      await throwConflict(fileID, revisionNumber);
     }
 
-    // update the file content to the pending content
-    await db.query(`UPDATE workspace_file SET content_pending = NULL WHERE id = $1 AND revision_number = $2`, [fileID, revisionNumber]);
-
     return getFile(fileID, revisionNumber);
   } catch (error) {
     logger.error(`Error rejecting patch for file ${fileID} at revision ${revisionNumber}: ${error}`);
@@ -127,24 +202,46 @@ export async function acceptPatch(fileID: string, revisionNumber: number): Promi
   logger.info(`Accepting patch for file ${fileID} at revision ${revisionNumber}`);
 
   try {
-    const db = getDB(await getParam("DB_URI"))
-    const rows = await db.query(`SELECT content_pending FROM workspace_file WHERE id = $1 AND revision_number = $2`, [fileID, revisionNumber]);
-    const row = rows.rows[0];
-
-    if (!row) {
-      throw new Error(`File ${fileID} not found at revision ${revisionNumber}`);
+    const written = await withFileLock(fileID, revisionNumber, async (client) => {
+      const rows = await client.query(`SELECT content_pending, version FROM workspace_file WHERE id = $1 AND revision_number = $2`, [fileID, revisionNumber]);
+      const row = rows.rows[0];
+
+      if (!row.content_pending) {
+        throw new Error(`File ${fileID} has no pending content at revision ${revisionNumber}`);
+      }
+
+      // update the file content to the pending content, unless the pending content was replaced since we read it
+      const result = await client.query(`UPDATE workspace_file SET content = $1, content_sha = encode(sha256(convert_to($1, 'UTF8')), 'hex'), content_pending = NULL, content_pending_base_sha = NULL, version = version + 1 WHERE id = $2 AND revision_number = $3 AND version = $4`, [row.content_pending, fileID, revisionNumber, row.version]);
+      return result.rowCount !== 0;
+    });
+    if (!written) {
+      await throwConflict(fileID, revisionNumber);
     }
 
-    if (!row.content_pending) {
-      throw new Error(`File ${fileID} has no pending content at revision ${revisionNumber}`);
-    }
+    return getFile(fileID, revisionNumber);
+  } catch (error) {
+    logger.error(`Error accepting patch for file ${fileID} at revision ${revisionNumber}: ${error}`);
+    throw error;
+  }
+}
+
+// saveFileContent writes a user's edit of a file, only if the file is still at expectedVersion.
+// Otherwise a FileConflictError is thrown and nothing is written.
+export async function saveFileContent(fileID: string, revisionNumber: number, content: string, expectedVersion: number): Promise<WorkspaceFile> {
+  logger.info(`Saving content for file ${fileID} at revision ${revisionNumber}, version ${expectedVersion}`);
 
-    // update the file content to the pending content
-    await db.query(`UPDATE workspace_file SET content = $1, content_pending = NULL WHERE id = $2 AND revision_number = $3`, [row.content_pending, fileID, revisionNumber]);
+  try {
+    const written = await withFileLock(fileID, revisionNumber, async (client) => {
+      const result = await client.query(`UPDATE workspace_file SET content = $1, content_sha = encode(sha256(convert_to($1, 'UTF8')), 'hex'), version = version + 1 WHERE id = $2 AND revision_number = $3 AND version = $4`, [content, fileID, revisionNumber, expectedVersion]);
+      return result.rowCount !== 0;
+    });
+    if (!written) {
+      await throwConflict(fileID, revisionNumber);
+    }
 
     return getFile(fileID, revisionNumber);
   } catch (error) {
-    logger.error(`Error accepting patch for file ${fileID} at revision ${revisionNumber}: ${error}`);
+    logger.error(`Error saving content for file ${fileID} at revision ${revisionNumber}: ${error}`);
     throw error;
   }
-}
\ No newline at end of file
+}
@@ -100,6 +100,8 @@ export async function listRenderedChartsForWorkspaceRender(renderId: string, wor
         workspace_rendered_chart.helm_template_command,
         workspace_rendered_chart.helm_template_stdout,
         workspace_rendered_chart.helm_template_stderr,
+        workspace_rendered_chart.helm_template_warnings,
+        workspace_rendered_chart.notes,
         workspace_rendered_chart.created_at,
         workspace_rendered_chart.completed_at
       FROM workspace_rendered_chart
@@ -124,6 +126,8 @@ export async function listRenderedChartsForWorkspaceRender(renderId: string, wor
         helmTemplateCommand: row.helm_template_command,
         helmTemplateStdout: row.helm_template_stdout,
         helmTemplateStderr: row.helm_template_stderr,
+        helmTemplateWarnings: row.helm_template_warnings || [],
+        notes: row.notes,
         createdAt: row.created_at,
         completedAt: row.completed_at,
         renderedFiles: [],
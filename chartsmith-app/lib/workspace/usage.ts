@@ -0,0 +1,23 @@
+import { getInternalApi } from "../data/internal-api";
+
+export interface UsageTotal {
+  operation: string;
+  day: string;
+  calls: number;
+  inputTokens: number;
+  outputTokens: number;
+}
+
+export interface UsageSummary {
+  workspaceId: string;
+  calls: number;
+  inputTokens: number;
+  outputTokens: number;
+  totals: UsageTotal[];
+}
+
+// getUsageSummary asks the worker for the token usage of a workspace, the totals are
+// GetUsageSummary in pkg/workspace/usage.go.
+export async function getUsageSummary(workspaceId: string, userId: string): Promise<UsageSummary> {
+  return getInternalApi<UsageSummary>(`/api/workspace/${encodeURIComponent(workspaceId)}/usage`, userId);
+}
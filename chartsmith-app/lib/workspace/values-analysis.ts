@@ -0,0 +1,22 @@
+import { getInternalApi } from "../data/internal-api";
+
+export interface ValuesReference {
+  path: string;
+  filePath: string;
+}
+
+export interface ValuesAnalysis {
+  chartId: string;
+  unusedKeys: string[];
+  undefinedKeys: ValuesReference[];
+  unknown: ValuesReference[];
+}
+
+// getValuesAnalysis asks the worker for the values usage of a chart in the current revision,
+// the analysis is AnalyzeValuesUsage in pkg/workspace/values-analysis.go.
+export async function getValuesAnalysis(workspaceId: string, chartId: string, userId: string): Promise<ValuesAnalysis> {
+  return getInternalApi<ValuesAnalysis>(
+    `/api/workspace/${encodeURIComponent(workspaceId)}/chart/${encodeURIComponent(chartId)}/values-analysis`,
+    userId,
+  );
+}
@@ -1,16 +1,18 @@
 import { getDB } from "../data/db";
 import { getParam } from "../data/param";
+import { postInternalApi } from "../data/internal-api";
 
 import { Chart, WorkspaceFile, Workspace, Plan, ActionFile, ChatMessage, FollowupAction, Conversion, ConversionStatus, ConversionFileStatus, ConversionFile } from "../types/workspace";
 import * as srs from "secure-random-string";
 import { logger } from "../utils/logger";
 import { enqueueWork } from "../utils/queue";
+import { hasKustomization } from "./kustomize";
 
 /**
  * Creates a new workspace with initialized files, charts, and content
  */
-export async function createWorkspace(createdType: string, userId: string, createChartMessageParams: CreateChatMessageParams, baseChart?: Chart, looseFiles?: WorkspaceFile[]): Promise<Workspace> {
-  logger.info("Creating new workspace", { createdType, userId });
+export async function createWorkspace(createdType: string, userId: string, createChartMessageParams: CreateChatMessageParams, baseChart?: Chart, looseFiles?: WorkspaceFile[], bootstrapTemplate?: string): Promise<Workspace> {
+  logger.info("Creating new workspace", { createdType, userId, bootstrapTemplate });
   try {
     const id = srs.default({ length: 12, alphanumeric: true });
     const db = getDB(await getParam("DB_URI"));
@@ -19,18 +21,19 @@ export async function createWorkspace(createdType: string, userId: string, creat
     try {
       await client.query("BEGIN");
 
-      const boostrapWorkspaceRow = await client.query(`select id, name, current_revision from bootstrap_workspace where name = $1`, ['default-workspace']);
+      const templateName = bootstrapTemplate || 'default-workspace';
+      const boostrapWorkspaceRow = await client.query(`select id, name, current_revision from bootstrap_workspace where name = $1`, [templateName]);
       if (boostrapWorkspaceRow.rowCount === 0) {
-        throw new Error("No default-workspace found in bootstrap_workspace table");
+        throw new Error(`No ${templateName} found in bootstrap_workspace table`);
       }
 
       // Determine initial revision number based on baseChart presence
       const initialRevisionNumber = baseChart ? 1 : 0;
 
       await client.query(
-        `INSERT INTO workspace (id, created_at, last_updated_at, name, created_by_user_id, created_type, current_revision_number)
-        VALUES ($1, now(), now(), $2, $3, $4, $5)`,
-        [id, boostrapWorkspaceRow.rows[0].name, userId, createdType, initialRevisionNumber],
+        `INSERT INTO workspace (id, created_at, last_updated_at, name, created_by_user_id, created_type, current_revision_number, bootstrap_template)
+        VALUES ($1, now(), now(), $2, $3, $4, $5, $6)`,
+        [id, boostrapWorkspaceRow.rows[0].name, userId, createdType, initialRevisionNumber, bootstrapTemplate || null],
       );
 
       await client.query(`INSERT INTO workspace_revision (workspace_id, revision_number, created_at, created_by_user_id, created_type, is_complete, is_rendered) VALUES ($1, $2, now(), $3, $4, true, false)`, [
@@ -54,8 +57,8 @@ export async function createWorkspace(createdType: string, userId: string, creat
 
           try {
           await client.query(
-            `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, embeddings)
-            VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+            `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, embeddings)
+            VALUES ($1, $2, $3, $4, $5, $6, encode(sha256(convert_to($6, 'UTF8')), 'hex'), $7)`,
             [fileId, initialRevisionNumber, chartId, id, file.filePath, file.content, null],
             );
           } catch (err) {
@@ -65,7 +68,7 @@ export async function createWorkspace(createdType: string, userId: string, creat
         }
       } else if (createdType !== "archive") {
         // Fallback to bootstrap charts if baseChart is not provided
-        const bootstrapCharts = await client.query(`SELECT id, name FROM bootstrap_chart`);
+        const bootstrapCharts = await client.query(`SELECT id, name FROM bootstrap_chart WHERE workspace_id = $1 AND revision_number = $2`, [boostrapWorkspaceRow.rows[0].id, boostrapWorkspaceRow.rows[0].current_revision]);
         for (const chart of bootstrapCharts.rows) {
           const chartId = srs.default({ length: 12, alphanumeric: true });
           await client.query(
@@ -74,12 +77,12 @@ export async function createWorkspace(createdType: string, userId: string, creat
             [chartId, id, chart.name, initialRevisionNumber],
           );
 
-          const boostrapChartFiles = await client.query(`SELECT file_path, content, embeddings FROM bootstrap_file WHERE chart_id = $1`, [chart.id]);
+          const boostrapChartFiles = await client.query(`SELECT file_path, content, embeddings FROM bootstrap_file WHERE chart_id = $1 AND revision_number = $2`, [chart.id, boostrapWorkspaceRow.rows[0].current_revision]);
           for (const file of boostrapChartFiles.rows) {
             const fileId = srs.default({ length: 12, alphanumeric: true });
             await client.query(
-              `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, embeddings)
-              VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+              `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, embeddings)
+              VALUES ($1, $2, $3, $4, $5, $6, encode(sha256(convert_to($6, 'UTF8')), 'hex'), $7)`,
               [fileId, initialRevisionNumber, chartId, id, file.file_path, file.content, file.embeddings],
             );
           }
@@ -89,8 +92,8 @@ export async function createWorkspace(createdType: string, userId: string, creat
             for (const file of looseFiles) {
               const fileId = srs.default({ length: 12, alphanumeric: true });
               await client.query(
-                `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, embeddings)
-                VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, embeddings)
+                VALUES ($1, $2, $3, $4, $5, $6, encode(sha256(convert_to($6, 'UTF8')), 'hex'), $7)`,
                 [fileId, initialRevisionNumber, null, id, file.filePath, file.content, null],
               );
             }
@@ -244,7 +247,8 @@ export async function createChatMessage(userId: string, workspaceId: string, par
       await renderWorkspace(workspaceId, chatMessageId);
     } else if (params.knownIntent === ChatMessageIntent.CONVERT_K8S_TO_HELM) {
       // this is a special type of a plan
-      const conversion = await createConversion(userId, workspaceId, chatMessageId, params.additionalFiles || []);
+      const sourceFiles = params.additionalFiles || [];
+      const conversion = await createConversion(userId, workspaceId, chatMessageId, sourceFiles, hasKustomization(sourceFiles) ? "kustomize" : "k8s");
       await enqueueWork("new_conversion", {
         conversionId: conversion.id,
       });
@@ -257,8 +261,10 @@ export async function createChatMessage(userId: string, workspaceId: string, par
   }
 }
 
-export async function createConversion(userId: string, workspaceId: string, chatMessageId: string, sourceFiles: WorkspaceFile[]): Promise<Conversion> {
-  logger.info("Creating conversion", { userId, workspaceId, chatMessageId });
+// createConversion records the files to convert, sourceType is "kustomize" when the worker has to build
+// them with kustomize first
+export async function createConversion(userId: string, workspaceId: string, chatMessageId: string, sourceFiles: WorkspaceFile[], sourceType: string = "k8s"): Promise<Conversion> {
+  logger.info("Creating conversion", { userId, workspaceId, chatMessageId, sourceType });
   try {
     const client = getDB(await getParam("DB_URI"));
 
@@ -267,7 +273,7 @@ export async function createConversion(userId: string, workspaceId: string, chat
 
       const conversionId: string = srs.default({ length: 12, alphanumeric: true });
 
-      await client.query(`INSERT INTO workspace_conversion (id, workspace_id, chat_message_ids, created_at, updated_at, source_type, status) VALUES ($1, $2, $3, now(), now(), $4, $5)`, [conversionId, workspaceId, [chatMessageId], "k8s", ConversionStatus.Pending]);
+      await client.query(`INSERT INTO workspace_conversion (id, workspace_id, chat_message_ids, created_at, updated_at, source_type, status) VALUES ($1, $2, $3, now(), now(), $4, $5)`, [conversionId, workspaceId, [chatMessageId], sourceType, ConversionStatus.Pending]);
 
       for (const file of sourceFiles) {
         const fileId: string = srs.default({ length: 12, alphanumeric: true });
@@ -293,7 +299,7 @@ export async function createConversion(userId: string, workspaceId: string, chat
 export async function getConversion(conversionId: string): Promise<Conversion> {
   try {
     const db = getDB(await getParam("DB_URI"));
-    const result = await db.query(`SELECT id, workspace_id, chat_message_ids, created_at, updated_at, source_type, status FROM workspace_conversion WHERE id = $1`, [conversionId]);
+    const result = await db.query(`SELECT id, workspace_id, chat_message_ids, created_at, updated_at, source_type, status, log FROM workspace_conversion WHERE id = $1`, [conversionId]);
 
     const conversion: Conversion = {
       id: result.rows[0].id,
@@ -303,6 +309,7 @@ export async function getConversion(conversionId: string): Promise<Conversion> {
       sourceType: result.rows[0].source_type,
       status: result.rows[0].status,
       sourceFiles: [],
+      log: result.rows[0].log || undefined,
     }
 
     // get the source files
@@ -543,14 +550,16 @@ export async function getPlan(planId: string): Promise<Plan> {
 
 async function listActionFiles(planId: string): Promise<ActionFile[]> {
   const db = getDB(await getParam("DB_URI"));
-  const result = await db.query(`SELECT action, path, status FROM workspace_plan_action_file WHERE plan_id = $1`, [planId]);
+  const result = await db.query(`SELECT action, path, chart_id, status, error FROM workspace_plan_action_file WHERE plan_id = $1`, [planId]);
   const actionFiles: ActionFile[] = [];
 
   for (const row of result.rows) {
     actionFiles.push({
       action: row.action,
       path: row.path,
+      chartId: row.chart_id || undefined,
       status: row.status,
+      error: row.error || undefined,
     });
   }
 
@@ -616,7 +625,7 @@ export async function listWorkspaces(userId: string): Promise<Workspace[]> {
             FROM
                 workspace
             WHERE
-                workspace.created_by_user_id = $1
+                workspace.created_by_user_id = $1 AND workspace.archived_at IS NULL
             ORDER BY
                 workspace.last_updated_at DESC
         `,
@@ -870,201 +879,31 @@ export async function listPlans(workspaceId: string): Promise<Plan[]> {
   }
 }
 
-export async function rollbackToRevision(workspaceId: string, revisionNumber: number) {
+// rollbackToRevision restores the files of a revision as a new revision and renders it. The later
+// revisions are kept in the history. It throws an InternalApiError with status 409 while a plan of
+// the workspace is executing.
+export async function rollbackToRevision(workspaceId: string, revisionNumber: number, userId: string): Promise<number> {
   logger.info("Rolling back to revision", { workspaceId, revisionNumber });
 
-  const db = getDB(await getParam("DB_URI"));
-
-  try {
-    await db.query('BEGIN');
-
-    await db.query(`update workspace set current_revision_number = $1 where id = $2`, [revisionNumber, workspaceId]);
-    await db.query(`delete from workspace_revision where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-
-    // get the render ids
-    const result = await db.query(`select id from workspace_rendered where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-    const renderIds = result.rows.map((row: { id: string }) => row.id);
-
-    await db.query(`delete from workspace_rendered where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-
-    // Only run the delete queries if there are render IDs to delete
-    if (renderIds.length > 0) {
-      // Properly escape render IDs as prepared statement parameters
-      const placeholders = renderIds.map((_, idx) => `$${idx + 1}`).join(',');
-      await db.query(`delete from workspace_rendered_chart where workspace_render_id in (${placeholders})`, renderIds);
-      await db.query(`delete from workspace_rendered_file where workspace_render_id in (${placeholders})`, renderIds);
-    }
-
-    // get the chat message ids for later revisions
-    const chatMessageResult = await db.query(`select id from workspace_chat where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-    const chatMessageIds = chatMessageResult.rows.map((row: { id: string }) => row.id);
-
-    await db.query(`delete from workspace_chat where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-
-    // get the plan ids for later revisions
-    const planResult = await db.query(`select id from workspace_plan where workspace_id = $1 and chat_message_ids @> $2`, [workspaceId, chatMessageIds]);
-    const planIds = planResult.rows.map((row: { id: string }) => row.id);
-
-    const planIdPlaceholders = planIds.map((_, idx) => `$${idx + 1}`).join(',');
-    await db.query(`delete from workspace_plan_action_file where plan_id in (${planIdPlaceholders})`, planIds);
-
-    await db.query(`delete from workspace_plan where id in (${planIdPlaceholders})`, planIds);
-
-
-    await db.query(`delete from workspace_file where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-
-    await db.query(`delete from workspace_chart where workspace_id = $1 and revision_number > $2`, [workspaceId, revisionNumber]);
-
-
-    await db.query('COMMIT');
-
-    // Find the chat message that initiated the rollback to associate it with the render
-    const chatMessages = await db.query(`
-      SELECT id FROM workspace_chat
-      WHERE workspace_id = $1 AND response_rollback_to_revision_number = $2
-      ORDER BY created_at DESC LIMIT 1`,
-      [workspaceId, revisionNumber]
-    );
-
-    let chatMessageId = "";
-    if (chatMessages?.rowCount && chatMessages.rowCount > 0) {
-      chatMessageId = chatMessages.rows[0].id;
-    }
+  const response = await postInternalApi<{ jobId: string; revisionNumber: number }>(`/api/workspace/${workspaceId}/rollback`, userId, {
+    revisionNumber,
+  });
 
-    // After successful rollback, enqueue a render job for the revision we rolled back to
-    await enqueueWork("render_workspace", {
-      workspaceId: workspaceId,
-      revisionNumber: revisionNumber,
-      chatMessageId: chatMessageId // Associate with the rollback chat message
-    });
-  } catch (err) {
-    await db.query('ROLLBACK');
-    throw err;
-  }
+  return response.revisionNumber;
 }
 
+// createRevision proceeds with a plan. The worker marks the plan proceeded, creates the revision
+// it's applied to and executes it, it throws an InternalApiError with status 409 when another plan
+// of the workspace is executing.
 export async function createRevision(plan: Plan, userID: string): Promise<number> {
   logger.info("Creating revision", { planId: plan.id, userID });
-  const db = getDB(await getParam("DB_URI"));
-
-  try {
-    // Start transaction
-    await db.query('BEGIN');
-
-    // set the plan as proceed_at now
-    await db.query(`UPDATE workspace_plan SET proceed_at = now() WHERE id = $1`, [plan.id]);
-
-    // Create new revision and get its number
-    const revisionResult = await db.query(
-      `
-        WITH latest_revision AS (
-          SELECT * FROM workspace_revision
-          WHERE workspace_id = $1
-          ORDER BY revision_number DESC
-          LIMIT 1
-        ),
-        next_revision AS (
-          SELECT COALESCE(MAX(revision_number), 0) + 1 as next_num
-          FROM workspace_revision
-          WHERE workspace_id = $1
-        )
-        INSERT INTO workspace_revision (
-          workspace_id, revision_number, created_at,
-          created_by_user_id, created_type, is_complete, is_rendered
-        )
-        SELECT
-          $1,
-          next_num,
-          NOW(),
-          $2,
-          COALESCE(lr.created_type, 'manual'),
-          false,
-          false
-        FROM next_revision
-        LEFT JOIN latest_revision lr ON true
-        RETURNING revision_number
-      `,
-      [plan.workspaceId, userID]
-    );
-
-    const newRevisionNumber = revisionResult.rows[0].revision_number;
-    const previousRevisionNumber = newRevisionNumber - 1;
-
-    // Copy workspace_chart records from previous revision
-    const previousCharts = await db.query(
-      `
-        SELECT
-          id,
-          name
-        FROM workspace_chart
-        WHERE workspace_id = $1 AND revision_number = $2
-      `,
-      [plan.workspaceId, previousRevisionNumber]
-    );
 
-    // insert workspace_chart records with same IDs but new revision number
-    for (const chart of previousCharts.rows) {
-      await db.query(
-        `INSERT INTO workspace_chart (id, revision_number, workspace_id, name) VALUES ($1, $2, $3, $4)`,
-        [chart.id, newRevisionNumber, plan.workspaceId, chart.name]
-      );
-    }
-
-    // Copy workspace_file records from previous revision
-    const previousFiles = await db.query(
-      `
-        SELECT
-          id,
-          chart_id,
-          workspace_id,
-          file_path,
-          content,
-          embeddings
-        FROM workspace_file
-        WHERE workspace_id = $1
-        AND revision_number = $2
-      `,
-      [plan.workspaceId, previousRevisionNumber]
-    );
-
-    // Insert workspace_file records with same IDs but new revision number
-    for (const file of previousFiles.rows) {
-      await db.query(
-        `
-          INSERT INTO workspace_file (
-            id, revision_number, chart_id, workspace_id, file_path,
-            content, embeddings
-          )
-          VALUES ($1, $2, $3, $4, $5, $6, $7)
-        `,
-        [
-          file.id,  // Keep the same ID
-          newRevisionNumber,
-          file.chart_id,
-          file.workspace_id,
-          file.file_path,
-          file.content,
-          file.embeddings
-        ]
-      );
-    }
-
-    // update the workspace to make this the current revision
-    await db.query(`UPDATE workspace SET current_revision_number = $1 WHERE id = $2`, [newRevisionNumber, plan.workspaceId]);
-
-    // Commit transaction
-    await db.query('COMMIT');
-
-    await enqueueWork("execute_plan", { planId: plan.id });
-
-    return newRevisionNumber;
+  const response = await postInternalApi<{ jobId: string; revisionNumber: number }>("/internal/plan/execute", userID, {
+    planId: plan.id,
+    createRevision: true,
+  });
 
-  } catch (err) {
-    // Rollback transaction on error
-    await db.query('ROLLBACK');
-    logger.error("Failed to create revision", { err });
-    throw err;
-  }
+  return response.revisionNumber;
 }
 
 async function listChartsForWorkspace(workspaceID: string, revisionNumber: number): Promise<Chart[]> {
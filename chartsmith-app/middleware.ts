@@ -22,7 +22,8 @@ const tokenAuthPaths = [
   '/api/auth/status',
   '/api/upload-chart',
   '/api/workspace',
-  '/api/push'
+  '/api/push',
+  '/api/admin'
 ];
 
 // This function can be marked `async` if using `await` inside
@@ -3,7 +3,7 @@ import WebSocket = require('ws');
 import { GlobalState, ConnectionStatus } from '../../types';
 import * as vscode from 'vscode';
 import { store, actions } from '../../state/store';
-import { workspaceIdAtom, Plan } from '../../state/atoms';
+import { workspaceIdAtom, plansAtom, Plan, ActionFile } from '../../state/atoms';
 import * as path from 'path';
 import { derivePushEndpoint } from '../endpoints';
 import { AuthData } from '../../types';
@@ -134,17 +134,50 @@ function handleChatMessageUpdated(data: any): void {
   }
 }
 
+/**
+ * The action files of a plan that changed while it's applied, sent instead of the plan
+ */
+interface PlanChanges {
+  id: string;
+  status: string;
+  actionFiles: ActionFile[];
+}
+
+/**
+ * Merge plan changes into the plan in the store
+ * @param changes The changed action files
+ * @returns The merged plan, or undefined when the plan isn't in the store. The whole plan is sent
+ * when it's applied.
+ */
+function mergePlanChanges(changes: PlanChanges): Plan | undefined {
+  const existing = store.get(plansAtom).find(p => p.id === changes.id);
+  if (!existing) {
+    return undefined;
+  }
+
+  const actionFiles = [...existing.actionFiles];
+  for (const changed of changes.actionFiles) {
+    // charts can have files at the same path
+    const index = actionFiles.findIndex(af => af.path === changed.path && (af.chartId ?? '') === (changed.chartId ?? ''));
+    if (index === -1) {
+      actionFiles.push(changed);
+    } else {
+      actionFiles[index] = changed;
+    }
+  }
+  return { ...existing, status: changes.status, actionFiles };
+}
+
 /**
  * Handle a plan event (created or updated)
  * @param data The message payload
  */
-function handlePlanEvent(data: { eventType: string, workspaceId: string, plan: Plan }): void {
-  if (!data.plan) {
+function handlePlanEvent(data: { eventType: string, workspaceId: string, plan?: Plan, planChanges?: PlanChanges }): void {
+  const plan = data.plan || (data.planChanges && mergePlanChanges(data.planChanges));
+  if (!plan) {
     return;
   }
 
-  const plan = data.plan;
-
   // Check if the plan has the expected structure
   if (!plan.id) {
     return;
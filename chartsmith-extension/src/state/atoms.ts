@@ -61,6 +61,7 @@ export interface Plan {
 export interface ActionFile {
   action: string;
   path: string;
+  chartId?: string;
   status: string;
   pendingContent?: string;
   content_pending?: string;  // API sends content_pending (snake_case)
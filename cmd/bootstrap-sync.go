@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func BootstrapSyncCmd() *cobra.Command {
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Update a bootstrap workspace from a chart directory",
+		Long: `Compare the charts of a directory with the stored bootstrap workspace of the same name, print
+the files that changed, and store the directory as a new revision of the bootstrap workspace.
+Added and modified files are embedded again. New workspaces keep being created from the previous
+revision until the new one is complete.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return fmt.Errorf("failed to bind flags: %w", err)
+			}
+
+			sess, err := session.NewSession(aws.NewConfig().WithCredentialsChainVerboseErrors(true))
+			if err != nil {
+				fmt.Printf("Failed to create aws session: %v\n", err)
+			}
+
+			if err := param.Init(sess); err != nil {
+				return fmt.Errorf("failed to init params: %w", err)
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+			ctx := cmd.Context()
+
+			pgOpts := persistence.PostgresOpts{
+				URI: param.Get().PGURI,
+			}
+			if err := persistence.InitPostgres(pgOpts); err != nil {
+				return fmt.Errorf("failed to initialize postgres connection: %w", err)
+			}
+
+			workspaceDir := v.GetString("workspace-dir")
+			name := v.GetString("name")
+			if name == "" {
+				name = filepath.Base(workspaceDir)
+			}
+
+			bootstrapWorkspace, err := workspace.GetBootstrapWorkspaceByName(ctx, name)
+			if err != nil {
+				return fmt.Errorf("failed to get bootstrap workspace %s, run bootstrap to create it: %w", name, err)
+			}
+
+			local, err := workspace.ReadBootstrapCharts(workspaceDir)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", workspaceDir, err)
+			}
+
+			changes := workspace.DiffBootstrapCharts(bootstrapWorkspace.Charts, local)
+			if len(changes) == 0 {
+				fmt.Printf("Bootstrap workspace %s is up to date at revision %d\n", name, bootstrapWorkspace.CurrentRevision)
+				return nil
+			}
+
+			counts := map[workspace.BootstrapChange]int{}
+			fmt.Printf("Changes to bootstrap workspace %s at revision %d:\n", name, bootstrapWorkspace.CurrentRevision)
+			for _, change := range changes {
+				fmt.Printf("  %-9s %s/%s\n", change.Change, change.ChartName, change.FilePath)
+				counts[change.Change]++
+			}
+			fmt.Printf("%d files changed: %d added, %d modified, %d deleted\n", len(changes),
+				counts[workspace.BootstrapFileAdded], counts[workspace.BootstrapFileModified], counts[workspace.BootstrapFileDeleted])
+
+			if v.GetBool("dry-run") {
+				fmt.Printf("Dry run, nothing was changed\n")
+				return nil
+			}
+
+			revisionNumber, err := workspace.SyncBootstrapWorkspace(ctx, bootstrapWorkspace, local)
+			if err != nil {
+				return fmt.Errorf("failed to sync bootstrap workspace %s: %w", name, err)
+			}
+
+			// so that bootstrap doesn't start the workspace over from the same directory
+			directoryHash, err := directoryHashDeterministic(workspaceDir)
+			if err != nil {
+				return fmt.Errorf("failed to hash workspace directory: %w", err)
+			}
+			conn := persistence.MustGetPooledPostgresSession()
+			defer conn.Release()
+			_, err = conn.Exec(ctx, `
+				INSERT INTO bootstrap_meta (key, value, workspace_id)
+				VALUES ('current_directory_hash', $1, $2)
+				ON CONFLICT (key, workspace_id) DO UPDATE SET value = $1
+			`, directoryHash, bootstrapWorkspace.ID)
+			if err != nil {
+				return fmt.Errorf("failed to store current directory hash: %w", err)
+			}
+
+			fmt.Printf("Bootstrap workspace %s is at revision %d\n", name, revisionNumber)
+			return nil
+		},
+	}
+
+	syncCmd.Flags().String("workspace-dir", filepath.Join("bootstrap", workspace.DefaultBootstrapTemplate), "Workspace directory with the charts to sync")
+	syncCmd.Flags().String("name", "", "Name of the bootstrap workspace, defaults to the name of the workspace directory")
+	syncCmd.Flags().Bool("dry-run", false, "Print the changes without applying them")
+
+	return syncCmd
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/replicatedhq/chartsmith/pkg/embedding"
 	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/secretscan"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	yaml "gopkg.in/yaml.v2"
@@ -50,8 +51,27 @@ func BootstrapCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			v := viper.GetViper()
 
-			if err := runBootstrap(cmd.Context(), param.Get().PGURI, v.GetString("workspace-dir"), v.GetBool("force")); err != nil {
-				return fmt.Errorf("failed to bootstrap workspace: %w", err)
+			pgOpts := persistence.PostgresOpts{
+				URI: param.Get().PGURI,
+			}
+			if err := persistence.InitPostgres(pgOpts); err != nil {
+				return fmt.Errorf("failed to initialize postgres connection: %w", err)
+			}
+
+			workspaceDirs := []string{v.GetString("workspace-dir")}
+			if v.GetBool("all") {
+				// every directory next to the workspace dir is a scaffold template
+				dirs, err := listBootstrapTemplateDirs(filepath.Dir(v.GetString("workspace-dir")))
+				if err != nil {
+					return fmt.Errorf("failed to list bootstrap templates: %w", err)
+				}
+				workspaceDirs = dirs
+			}
+
+			for _, workspaceDir := range workspaceDirs {
+				if err := runBootstrap(cmd.Context(), workspaceDir, v.GetBool("force")); err != nil {
+					return fmt.Errorf("failed to bootstrap workspace %s: %w", workspaceDir, err)
+				}
 			}
 
 			return nil
@@ -65,25 +85,48 @@ func BootstrapCmd() *cobra.Command {
 
 	bootstrapCmd.Flags().String("workspace-dir", filepath.Join(wd, "bootstrap", "default-workspace"), "Workspace directory")
 	bootstrapCmd.Flags().Bool("force", false, "Force bootstrap even if the directory is already bootstrapped")
+	bootstrapCmd.Flags().Bool("all", false, "Bootstrap every scaffold template in the parent of workspace-dir")
+
+	bootstrapCmd.AddCommand(BootstrapSyncCmd())
 
 	return bootstrapCmd
 }
 
-func runBootstrap(ctx context.Context, pgURI string, workspaceDir string, force bool) error {
+// listBootstrapTemplateDirs returns each directory in templatesDir that contains a charts directory
+func listBootstrapTemplateDirs(templatesDir string) ([]string, error) {
+	entries, err := os.ReadDir(templatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates directory: %w", err)
+	}
+
+	dirs := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(templatesDir, entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, "charts")); err != nil {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
+
+func runBootstrap(ctx context.Context, workspaceDir string, force bool) error {
 	// let's generate an ID for this bootstrap workspace, how about using a hash of the workspace dir string?
 	workspaceID := hashString(workspaceDir)
 	workspaceName := filepath.Base(workspaceDir)
 
-	currentDirectoryHash, err := directoryHashDeterministic(workspaceDir)
+	provider, err := embedding.Configured()
 	if err != nil {
-		return fmt.Errorf("failed to hash workspace directory: %w", err)
+		return fmt.Errorf("failed to get embedding provider: %w", err)
 	}
 
-	pgOpts := persistence.PostgresOpts{
-		URI: pgURI,
-	}
-	if err := persistence.InitPostgres(pgOpts); err != nil {
-		return fmt.Errorf("failed to initialize postgres connection: %w", err)
+	currentDirectoryHash, err := directoryHashDeterministic(workspaceDir)
+	if err != nil {
+		return fmt.Errorf("failed to hash workspace directory: %w", err)
 	}
 
 	conn := persistence.MustGetPooledPostgresSession()
@@ -124,6 +167,12 @@ func runBootstrap(ctx context.Context, pgURI string, workspaceDir string, force
 		return fmt.Errorf("failed to delete charts: %w", err)
 	}
 
+	// remove the revisions of earlier syncs, bootstrap starts over at revision 0
+	_, err = tx.Exec(ctx, "DELETE FROM bootstrap_revision where workspace_id = $1", workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete revisions: %w", err)
+	}
+
 	_, err = tx.Exec(ctx, "INSERT INTO bootstrap_workspace (id, name, current_revision) VALUES ($1, $2, $3) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, current_revision = EXCLUDED.current_revision", workspaceID, workspaceName, 0)
 	if err != nil {
 		return fmt.Errorf("failed to insert workspace: %w", err)
@@ -180,16 +229,24 @@ func runBootstrap(ctx context.Context, pgURI string, workspaceDir string, force
 				}
 				chartName = n
 			}
-			fmt.Printf("embedding %s...\n", relativePath)
-			embeddings, err := embedding.Embeddings(string(content))
-			if err != nil {
-				return fmt.Errorf("failed to get embeddings: %w", err)
+			// a scaffold isn't in a workspace that can acknowledge a secret, so files with one
+			// aren't sent to the embedding provider
+			var embeddings *string
+			if len(secretscan.Scan(relativePath, string(content))) > 0 {
+				fmt.Printf("not embedding %s, it has a secret\n", relativePath)
+			} else {
+				fmt.Printf("embedding %s...\n", relativePath)
+				e, err := embedding.Embeddings(string(content))
+				if err != nil {
+					return fmt.Errorf("failed to get embeddings: %w", err)
+				}
+				embeddings = &e
 			}
 
 			_, err = tx.Exec(ctx, `
-				INSERT INTO bootstrap_file (id, chart_id, workspace_id, file_path, content, embeddings)
-				VALUES ($1, $2, $3, $4, $5, $6)
-			`, hashString(relativePath), chartID, workspaceID, relativePath, content, embeddings)
+				INSERT INTO bootstrap_file (id, chart_id, workspace_id, file_path, content, embeddings, embeddings_provider)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+			`, hashString(filepath.Join(workspaceName, relativePath)), chartID, workspaceID, relativePath, content, embeddings, provider.Name())
 			if err != nil {
 				return fmt.Errorf("failed to insert file: %w", err)
 			}
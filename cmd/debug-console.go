@@ -15,16 +15,23 @@ import (
 func DebugConsoleCmd() *cobra.Command {
 	var workspaceID string
 	var nonInteractive bool
+	var execCommands string
+	var jsonOutput bool
 	
 	cmd := &cobra.Command{
-		Use:   "debug-console [command] [flags]",
-		Short: "Interactive debug console for chartsmith",
+		Use:     "debug-console [command] [flags]",
+		Aliases: []string{"debug"},
+		Short:   "Interactive debug console for chartsmith",
 		Long: `A development tool that provides an interactive console for debugging and testing
 chartsmith functionality without going through the LLM pipeline. This allows for faster
 testing of render, patch generation, and other features.
 
 When run without arguments, it launches an interactive console mode.
 When run with a command, it executes that command and exits, suitable for scripting.
+When run with --exec, it runs the semicolon separated commands one after the other without
+prompting, and exits non-zero if any of them failed. Commands that would ask for confirmation
+need their flag for it (--yes, --save). With --json, each command's result is printed as a JSON
+object on its own line.
 
 Examples:
   # Interactive mode
@@ -33,7 +40,10 @@ Examples:
   # Run a single command (non-interactive mode)
   debug-console new-revision --workspace-id abc123
   debug-console patch-file values.yaml --workspace-id abc123
-  debug-console render values.yaml --workspace-id abc123`,
+  debug-console render values.yaml --workspace-id abc123
+
+  # Run several commands (batch mode)
+  debug --workspace abc123 --exec "list-files; values-analysis; lint" --json`,
 		Args: cobra.ArbitraryArgs,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			// we always init params without aws,
@@ -54,19 +64,31 @@ Examples:
 				APIKey:  param.Get().CentrifugoAPIKey,
 			})
 
+			if execCommands != "" && len(args) > 0 {
+				return fmt.Errorf("pass either a command or --exec, not both")
+			}
+			if jsonOutput && execCommands == "" {
+				return fmt.Errorf("--json requires --exec")
+			}
+
 			// If we have command args, set non-interactive mode
-			if len(args) > 0 {
+			if len(args) > 0 || execCommands != "" {
 				nonInteractive = true
 			}
 
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// a command that fails isn't a usage error
+			cmd.SilenceUsage = true
+
 			// Pass the workspace ID and any command arguments
 			opts := debugcli.ConsoleOptions{
 				WorkspaceID:    workspaceID,
 				NonInteractive: nonInteractive,
 				Command:        args,
+				Exec:           execCommands,
+				JSON:           jsonOutput,
 			}
 			return debugcli.RunConsole(opts)
 		},
@@ -74,6 +96,9 @@ Examples:
 	
 	// Add flags
 	cmd.Flags().StringVar(&workspaceID, "workspace-id", "", "Workspace ID to use for commands")
+	cmd.Flags().StringVar(&workspaceID, "workspace", "", "Alias of --workspace-id")
+	cmd.Flags().StringVar(&execCommands, "exec", "", "Semicolon separated commands to run without prompting")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "With --exec, print each command's result as a JSON object on its own line")
 
 	return cmd
 }
@@ -10,7 +10,7 @@ import (
 
 func Execute() {
 	if err := RootCmd().Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
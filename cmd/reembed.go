@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func ReembedCmd() *cobra.Command {
+	reembedCmd := &cobra.Command{
+		Use:   "reembed",
+		Short: "Queue files whose embeddings are from another provider to be embedded again",
+		Long: `Queue a summarize task for every file with embeddings from a provider other than
+CHARTSMITH_EMBEDDING_PROVIDER. Run it after changing the provider, the worker embeds the files
+again as it works through the queue. Until then, those files aren't found by similarity search.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return fmt.Errorf("failed to bind flags: %w", err)
+			}
+
+			sess, err := session.NewSession(aws.NewConfig().WithCredentialsChainVerboseErrors(true))
+			if err != nil {
+				fmt.Printf("Failed to create aws session: %v\n", err)
+			}
+
+			if err := param.Init(sess); err != nil {
+				return fmt.Errorf("failed to init params: %w", err)
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v := viper.GetViper()
+
+			provider, err := embedding.Configured()
+			if err != nil {
+				return fmt.Errorf("failed to get embedding provider: %w", err)
+			}
+
+			pgOpts := persistence.PostgresOpts{
+				URI: param.Get().PGURI,
+			}
+			if err := persistence.InitPostgres(pgOpts); err != nil {
+				return fmt.Errorf("failed to initialize postgres connection: %w", err)
+			}
+
+			enqueued, err := workspace.EnqueueStaleEmbeddings(cmd.Context(), provider.Name(), v.GetInt("batch-size"))
+			if err != nil {
+				return fmt.Errorf("failed to enqueue stale embeddings after %d files: %w", enqueued, err)
+			}
+
+			fmt.Printf("Queued %d files to be embedded with %s\n", enqueued, provider.Name())
+			return nil
+		},
+	}
+
+	reembedCmd.Flags().Int("batch-size", workspace.DefaultReembedBatchSize, "How many files to read from the database at a time")
+
+	return reembedCmd
+}
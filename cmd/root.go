@@ -17,6 +17,7 @@ func RootCmd() *cobra.Command {
 	rootCmd.AddCommand(TestData())
 	rootCmd.AddCommand(ArtifactHubCmd())
 	rootCmd.AddCommand(DebugConsoleCmd())
+	rootCmd.AddCommand(ReembedCmd())
 
 	return rootCmd
 }
@@ -4,17 +4,30 @@ import (
 	"context"
 	"fmt"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/api"
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
+	"github.com/replicatedhq/chartsmith/pkg/integrations/replicated"
 	"github.com/replicatedhq/chartsmith/pkg/listener"
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/metrics"
 	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/provenance"
 	"github.com/replicatedhq/chartsmith/pkg/realtime"
 	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/slack"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 func RunCmd() *cobra.Command {
@@ -46,6 +59,40 @@ func RunCmd() *cobra.Command {
 				APIKey:  param.Get().CentrifugoAPIKey,
 			})
 
+			if err := realtime.InitPresence(param.Get().PresenceStore); err != nil {
+				return fmt.Errorf("invalid presence configuration: %w", err)
+			}
+
+			integrations.Register(replicated.New())
+			if err := integrations.Enable(integrations.EnabledNames()); err != nil {
+				return fmt.Errorf("invalid integrations configuration: %w", err)
+			}
+
+			if err := slack.ValidateConfig(); err != nil {
+				return fmt.Errorf("invalid slack notifications configuration: %w", err)
+			}
+
+			if err := llm.ValidateModels(); err != nil {
+				return fmt.Errorf("invalid model configuration: %w", err)
+			}
+
+			for _, warning := range provenance.ConfigFromParams().Warnings() {
+				logger.Warn(warning)
+			}
+
+			timeouts := param.Get().Timeouts
+			logger.Info("Timeouts",
+				zap.Duration("render", timeouts.RenderTotal),
+				zap.Duration("renderChart", timeouts.RenderChart),
+				zap.Duration("renderStall", timeouts.RenderStall),
+				zap.Duration("db", timeouts.DBOperation),
+				zap.Duration("llmInactivity", timeouts.LLMInactivity),
+				zap.Duration("llmRequest", timeouts.LLMRequest),
+				zap.Duration("fuzzyMatch", timeouts.FuzzyMatch),
+				zap.Duration("queueClaimInterval", timeouts.QueueClaimInterval),
+				zap.Duration("clusterDryRun", timeouts.ClusterDryRun),
+			)
+
 			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 			defer stop()
 
@@ -67,13 +114,119 @@ func runWorker(ctx context.Context, pgURI string) error {
 		return fmt.Errorf("failed to initialize postgres connection: %w", err)
 	}
 
+	if err := llm.SeedPrompts(ctx); err != nil {
+		return fmt.Errorf("failed to seed system prompts: %w", err)
+	}
+
+	if err := initHelmTemp(time.Now()); err != nil {
+		return fmt.Errorf("failed to initialize helm temp dir: %w", err)
+	}
+
+	if address := param.Get().MetricsAddress; address != "" {
+		go func() {
+			if err := metrics.Serve(ctx, address); err != nil {
+				logger.Error(err)
+			}
+		}()
+	}
+
+	if address := param.Get().InternalAPIAddress; address != "" {
+		if param.Get().InternalAPIKey == "" {
+			return fmt.Errorf("CHARTSMITH_INTERNAL_API_KEY is required to serve the internal API")
+		}
+		go func() {
+			if err := api.ServeInternal(ctx, address, param.Get().InternalAPIKey); err != nil {
+				logger.Error(err)
+			}
+		}()
+	}
+
 	// Start the connection heartbeat before starting the listeners
 	// This ensures our connections stay alive even during idle periods
 	listener.StartHeartbeat(ctx)
-	
+
 	if err := listener.StartListeners(ctx); err != nil {
 		return fmt.Errorf("failed to start listeners: %w", err)
 	}
 
 	return nil
 }
+
+// initHelmTemp configures where helm commands get temp directories, removes the ones a previous
+// worker left behind, and exposes their disk usage as metrics
+func initHelmTemp(now time.Time) error {
+	cfg := helmutils.TempConfig{
+		Root: param.Get().HelmTempDir,
+	}
+	if minFreeMB := param.Get().HelmMinFreeMB; minFreeMB != "" {
+		mb, err := strconv.ParseUint(minFreeMB, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CHARTSMITH_HELM_MIN_FREE_MB %q: %w", minFreeMB, err)
+		}
+		cfg.MinFreeBytes = mb << 20
+	}
+	helmutils.ConfigureTemp(cfg)
+
+	removed, err := helmutils.SweepTempDirs(now)
+	if err != nil {
+		// leftovers only cost disk space, the quota check protects renders
+		logger.Warn("failed to sweep helm temp dirs", zap.Error(err))
+	} else if len(removed) > 0 {
+		logger.Info("Removed leftover helm temp dirs", zap.Int("count", len(removed)))
+	}
+
+	metrics.Register("helm_temp", func() ([]metrics.Sample, error) {
+		usage, err := helmutils.CurrentTempUsage()
+		if err != nil {
+			return nil, err
+		}
+		return []metrics.Sample{
+			{Name: "chartsmith_helm_temp_dirs", Help: "Temp directories in use by helm commands.", Value: float64(usage.Dirs)},
+			{Name: "chartsmith_helm_temp_bytes", Help: "Bytes used by helm temp directories.", Value: float64(usage.Bytes)},
+			{Name: "chartsmith_helm_temp_free_bytes", Help: "Free bytes on the filesystem of the helm temp directories.", Value: float64(usage.FreeBytes)},
+		}, nil
+	})
+
+	metrics.Register("summary_cache", func() ([]metrics.Sample, error) {
+		stats := llm.GetSummaryCacheStats()
+		return []metrics.Sample{
+			{Name: "chartsmith_summary_cache_hits_total", Help: "File summaries served from the summary cache.", Value: float64(stats.Hits), Counter: true},
+			{Name: "chartsmith_summary_cache_misses_total", Help: "File summaries that weren't cached and were summarized by the LLM.", Value: float64(stats.Misses), Counter: true},
+			{Name: "chartsmith_summary_cache_errors_total", Help: "Summary cache reads and writes that failed.", Value: float64(stats.Errors), Counter: true},
+		}, nil
+	})
+
+	metrics.Register("execute_breaker", func() ([]metrics.Sample, error) {
+		stats := llm.GetExecuteBreakerStats()
+		open := 0.0
+		if stats.State != circuitbreaker.StateClosed {
+			open = 1
+		}
+		return []metrics.Sample{
+			{Name: "chartsmith_execute_breaker_open", Help: "1 when action executions are refused because the LLM keeps failing, including while a probe is in flight.", Value: open},
+			{Name: "chartsmith_execute_breaker_consecutive_failures", Help: "Action executions in a row that failed to reach the LLM.", Value: float64(stats.ConsecutiveFailures)},
+			{Name: "chartsmith_execute_breaker_opens_total", Help: "Times the circuit breaker of action executions opened.", Value: float64(stats.Opens), Counter: true},
+			{Name: "chartsmith_execute_breaker_rejections_total", Help: "Action executions refused by the open circuit breaker.", Value: float64(stats.Rejections), Counter: true},
+		}, nil
+	})
+
+	metrics.Register("values_edits", func() ([]metrics.Sample, error) {
+		stats := llm.GetValuesEditStats()
+		return []metrics.Sample{
+			{Name: "chartsmith_values_yaml_patch_total", Help: "Edits of values.yaml files made with yaml_patch.", Value: float64(stats.YAMLPatches), Counter: true},
+			{Name: "chartsmith_values_yaml_patch_failures_total", Help: "Edits of values.yaml files made with yaml_patch that failed.", Value: float64(stats.YAMLPatchFailures), Counter: true},
+			{Name: "chartsmith_values_str_replace_total", Help: "Edits of values.yaml files made with str_replace.", Value: float64(stats.StrReplaces), Counter: true},
+			{Name: "chartsmith_values_str_replace_failures_total", Help: "Edits of values.yaml files made with str_replace that failed.", Value: float64(stats.StrReplaceFailures), Counter: true},
+			{Name: "chartsmith_values_comments_restored_total", Help: "Comments above values.yaml keys that an action dropped and were restored.", Value: float64(stats.CommentsRestored), Counter: true},
+		}, nil
+	})
+
+	metrics.Register("queue_reconcile", func() ([]metrics.Sample, error) {
+		stats := listener.GetQueueReconcileStats()
+		return []metrics.Sample{
+			{Name: "chartsmith_queue_startup_released_total", Help: "Queue messages a stopped worker was processing that were released when the worker started.", Value: float64(stats.Released), Counter: true},
+		}, nil
+	})
+
+	return nil
+}
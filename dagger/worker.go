@@ -68,6 +68,12 @@ func buildEnvWorker(source *dagger.Directory) *dagger.Container {
 		WithExec([]string{"rm", "-rf", "linux-amd64", "helm-v3.17.0-linux-amd64.tar.gz"}).
 		WithExec([]string{"ln", "-s", "/usr/local/bin/helm-v3.17.0", "/usr/local/bin/helm"})
 
+	// Install kustomize, to build Kustomize projects before they're converted
+	buildContainer = buildContainer.
+		WithExec([]string{"curl", "-LO", "https://github.com/kubernetes-sigs/kustomize/releases/download/kustomize%2Fv5.6.0/kustomize_v5.6.0_linux_amd64.tar.gz"}).
+		WithExec([]string{"tar", "-xzf", "kustomize_v5.6.0_linux_amd64.tar.gz", "-C", "/usr/local/bin"}).
+		WithExec([]string{"rm", "kustomize_v5.6.0_linux_amd64.tar.gz"})
+
 	return buildContainer.
 		WithDirectory("/go/src/github.com/replicatedhq/chartsmith", source).
 		WithWorkdir("/go/src/github.com/replicatedhq/chartsmith").
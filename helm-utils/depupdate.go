@@ -0,0 +1,206 @@
+package helmutils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// MaxDepUpdateRetries is the number of times a transient helm dependency update failure is
+// retried before the render fails
+const MaxDepUpdateRetries = 3
+
+// depUpdateBackoff returns how long to wait before a retry, attempt starts at 1
+var depUpdateBackoff = func(attempt int) time.Duration {
+	return time.Duration(1<<(attempt-1)) * 2 * time.Second
+}
+
+// DepUpdateFailureClass is whether a failed helm dependency update is worth retrying
+type DepUpdateFailureClass string
+
+const (
+	// DepUpdateFailureTransient failures are caused by the network or a chart repository being
+	// unavailable, and may succeed when retried
+	DepUpdateFailureTransient DepUpdateFailureClass = "transient"
+	// DepUpdateFailureDeterministic failures are caused by the chart, and will fail again
+	DepUpdateFailureDeterministic DepUpdateFailureClass = "deterministic"
+)
+
+// DepUpdateFailure is the classified cause of a failed helm dependency update
+type DepUpdateFailure struct {
+	Class  DepUpdateFailureClass
+	Reason string
+}
+
+type depUpdatePattern struct {
+	pattern *regexp.Regexp
+	reason  string
+}
+
+// transient patterns are checked first, helm reports an unreachable repository as "not a valid
+// chart repository or cannot be reached" followed by the underlying cause
+var transientDepUpdatePatterns = []depUpdatePattern{
+	{regexp.MustCompile(`(?i)tls handshake timeout|tls: handshake failure|remote error: tls`), "TLS handshake with the chart repository failed"},
+	{regexp.MustCompile(`(?i)i/o timeout|client\.timeout exceeded|context deadline exceeded|timed out`), "timed out contacting the chart repository"},
+	{regexp.MustCompile(`(?i)connection reset by peer|connection refused|broken pipe|unexpected eof|server closed idle connection`), "connection to the chart repository failed"},
+	{regexp.MustCompile(`(?i)temporary failure in name resolution|server misbehaving`), "DNS lookup of the chart repository failed"},
+	{regexp.MustCompile(`(?i)\b5\d\d (internal server error|bad gateway|service unavailable|gateway timeout)|status code:? 5\d\d|: 5\d\d\b`), "chart repository returned a server error"},
+	{regexp.MustCompile(`(?i)429 too many requests|toomanyrequests`), "chart repository rate limited the request"},
+}
+
+var deterministicDepUpdatePatterns = []depUpdatePattern{
+	{regexp.MustCompile(`(?i)no repository definition for`), "unknown repository, add it with helm repo add or use a repository URL"},
+	{regexp.MustCompile(`(?i)can't get a valid version|no chart version found|chart "[^"]*" version "[^"]*" not found|not found in .* repository|: not found`), "chart version not found in the repository"},
+	{regexp.MustCompile(`(?i)could not find protocol handler`), "unsupported repository scheme"},
+	{regexp.MustCompile(`(?i)no such host`), "chart repository host not found"},
+	{regexp.MustCompile(`(?i)401 unauthorized|403 forbidden|unauthorized|denied`), "not authorized to access the chart repository"},
+	{regexp.MustCompile(`(?i)404 not found`), "chart repository not found"},
+	{regexp.MustCompile(`(?i)chart\.yaml file is missing|error converting yaml|validation: `), "invalid Chart.yaml"},
+}
+
+// ClassifyDepUpdateFailure classifies the stderr of a failed helm dependency update. Output that
+// doesn't match a known failure is deterministic, so an unknown failure is never retried.
+func ClassifyDepUpdateFailure(stderr string) DepUpdateFailure {
+	for _, p := range transientDepUpdatePatterns {
+		if p.pattern.MatchString(stderr) {
+			return DepUpdateFailure{Class: DepUpdateFailureTransient, Reason: p.reason}
+		}
+	}
+	for _, p := range deterministicDepUpdatePatterns {
+		if p.pattern.MatchString(stderr) {
+			return DepUpdateFailure{Class: DepUpdateFailureDeterministic, Reason: p.reason}
+		}
+	}
+	return DepUpdateFailure{Class: DepUpdateFailureDeterministic, Reason: "helm dependency update failed"}
+}
+
+// DepUpdateError is returned when helm dependency update fails with a deterministic failure,
+// or with a transient failure that persisted through every retry
+type DepUpdateError struct {
+	Failure  DepUpdateFailure
+	Attempts int
+	Err      error
+}
+
+func (e *DepUpdateError) Error() string {
+	if e.Failure.Class == DepUpdateFailureTransient {
+		return fmt.Sprintf("%s (%s, %d attempts): %v", e.Failure.Reason, e.Failure.Class, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("%s (%s): %v", e.Failure.Reason, e.Failure.Class, e.Err)
+}
+
+func (e *DepUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// runDepUpdateWithRetry runs helm dependency update, retrying transient failures with backoff.
+// A "--- retry N ---" marker is written to the stderr channel before each retry.
+func runDepUpdateWithRetry(ctx context.Context, helmCmd string, workingDir string, env []string, renderChannels RenderChannels) error {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			renderChannels.DepUpdateStderr <- fmt.Sprintf("--- retry %d ---\n", attempt)
+		}
+
+		stderr, err := runDepUpdate(ctx, helmCmd, workingDir, env, renderChannels, attempt == 0)
+		if err == nil {
+			return nil
+		}
+		// a cancelled render isn't retried, the render gave up on it
+		if ctx.Err() != nil {
+			return err
+		}
+
+		failure := ClassifyDepUpdateFailure(stderr + "\n" + err.Error())
+		if failure.Class == DepUpdateFailureTransient && attempt < MaxDepUpdateRetries {
+			logger.WarnCtx(ctx, "Retrying helm dependency update",
+				zap.String("reason", failure.Reason),
+				zap.Int("attempt", attempt+1),
+				zap.Error(err))
+			select {
+			case <-time.After(depUpdateBackoff(attempt + 1)):
+			case <-ctx.Done():
+				return errors.Wrap(ctx.Err(), "helm dependency update cancelled")
+			}
+			continue
+		}
+
+		return &DepUpdateError{Failure: failure, Attempts: attempt + 1, Err: err}
+	}
+}
+
+// runDepUpdate runs helm dependency update once, streaming its output to the render channels,
+// and returns its stderr. helm is killed when ctx is done, or after helmCommandTimeout.
+func runDepUpdate(parentCtx context.Context, helmCmd string, workingDir string, env []string, renderChannels RenderChannels, sendCmd bool) (string, error) {
+	timeout := helmCommandTimeout()
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	depUpdateCmd := exec.CommandContext(ctx, helmCmd, "dependency", "update", ".")
+	depUpdateCmd.Dir = workingDir
+	depUpdateCmd.Env = env
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	heartbeat := newCommandHeartbeat(renderChannels, RenderStageDepUpdate)
+	depUpdateCmd.Stdout = heartbeat.writer(stdoutWriter)
+	depUpdateCmd.Stderr = heartbeat.writer(stderrWriter)
+
+	stderr := strings.Builder{}
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	// Copy helm dep update stdout to the stdout channel
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stdoutReader)
+		for scanner.Scan() {
+			renderChannels.DepUpdateStdout <- scanner.Text() + "\n"
+		}
+		io.Copy(io.Discard, stdoutReader)
+	}()
+
+	// Copy helm dep update stderr to the stderr channel, keeping it to classify a failure
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(stderrReader)
+		for scanner.Scan() {
+			stderr.WriteString(scanner.Text() + "\n")
+			renderChannels.DepUpdateStderr <- scanner.Text() + "\n"
+		}
+		io.Copy(io.Discard, stderrReader)
+	}()
+
+	if sendCmd {
+		renderChannels.DepUpdateCmd <- depUpdateCmd.String()
+	}
+
+	stopHeartbeat := heartbeat.start()
+	err := depUpdateCmd.Run()
+	stopHeartbeat()
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	if parentCtx.Err() != nil {
+		return stderr.String(), errors.Wrap(parentCtx.Err(), "helm dependency update cancelled")
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return stderr.String(), errors.Errorf("helm dependency update timed out after %s", timeout)
+	}
+	if err != nil {
+		return stderr.String(), errors.Wrap(err, "helm dependency update failed")
+	}
+
+	return stderr.String(), nil
+}
@@ -0,0 +1,280 @@
+package helmutils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyDepUpdateFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		class  DepUpdateFailureClass
+		reason string
+	}{
+		{
+			name:   "dial timeout",
+			stderr: `Error: could not download https://charts.example.com/index.yaml: Get "https://charts.example.com/index.yaml": dial tcp 203.0.113.10:443: i/o timeout`,
+			class:  DepUpdateFailureTransient,
+			reason: "timed out contacting the chart repository",
+		},
+		{
+			name:   "client timeout",
+			stderr: `Error: Get "https://charts.bitnami.com/bitnami/index.yaml": net/http: request canceled (Client.Timeout exceeded while awaiting headers)`,
+			class:  DepUpdateFailureTransient,
+			reason: "timed out contacting the chart repository",
+		},
+		{
+			name:   "tls handshake timeout",
+			stderr: `Error: Get "https://registry-1.docker.io/v2/bitnamicharts/redis/tags/list": net/http: TLS handshake timeout`,
+			class:  DepUpdateFailureTransient,
+			reason: "TLS handshake with the chart repository failed",
+		},
+		{
+			name:   "service unavailable",
+			stderr: `Error: looks like "https://charts.example.com" is not a valid chart repository or cannot be reached: failed to fetch https://charts.example.com/index.yaml : 503 Service Unavailable`,
+			class:  DepUpdateFailureTransient,
+			reason: "chart repository returned a server error",
+		},
+		{
+			name:   "bad gateway from oci registry",
+			stderr: `Error: unexpected status from HEAD request to https://ghcr.io/v2/example/charts/app/manifests/1.2.3: 502 Bad Gateway`,
+			class:  DepUpdateFailureTransient,
+			reason: "chart repository returned a server error",
+		},
+		{
+			name:   "connection reset",
+			stderr: `Error: Get "https://charts.example.com/index.yaml": read tcp 10.0.0.2:51234->203.0.113.10:443: read: connection reset by peer`,
+			class:  DepUpdateFailureTransient,
+			reason: "connection to the chart repository failed",
+		},
+		{
+			name:   "our own timeout",
+			stderr: "helm dependency update timed out after 5m0s",
+			class:  DepUpdateFailureTransient,
+			reason: "timed out contacting the chart repository",
+		},
+		{
+			name:   "unknown repository",
+			stderr: `Error: no repository definition for @bitnami. Please add the missing repos via 'helm repo add'`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "unknown repository, add it with helm repo add or use a repository URL",
+		},
+		{
+			name:   "version not found",
+			stderr: `Error: can't get a valid version for 1 subchart(s): "redis" (repository "https://charts.bitnami.com/bitnami", version "99.0.0")`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "chart version not found in the repository",
+		},
+		{
+			name:   "chart not in repository",
+			stderr: `Error: chart "redis" version "99.0.0" not found in https://charts.bitnami.com/bitnami repository`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "chart version not found in the repository",
+		},
+		{
+			name:   "unknown host",
+			stderr: `Error: Get "https://charts.example.invalid/index.yaml": dial tcp: lookup charts.example.invalid on 127.0.0.11:53: no such host`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "chart repository host not found",
+		},
+		{
+			name:   "repository 404",
+			stderr: `Error: looks like "https://example.com/charts" is not a valid chart repository or cannot be reached: failed to fetch https://example.com/charts/index.yaml : 404 Not Found`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "chart repository not found",
+		},
+		{
+			name:   "unauthorized",
+			stderr: `Error: failed to authorize: failed to fetch oauth token: unexpected status from GET request to https://ghcr.io/token: 401 Unauthorized`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "not authorized to access the chart repository",
+		},
+		{
+			name:   "unsupported scheme",
+			stderr: `Error: could not find protocol handler for: s3`,
+			class:  DepUpdateFailureDeterministic,
+			reason: "unsupported repository scheme",
+		},
+		{
+			name:   "unrecognized output",
+			stderr: "Error: something unexpected happened",
+			class:  DepUpdateFailureDeterministic,
+			reason: "helm dependency update failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyDepUpdateFailure(tt.stderr)
+			if got.Class != tt.class {
+				t.Errorf("class = %q, want %q", got.Class, tt.class)
+			}
+			if got.Reason != tt.reason {
+				t.Errorf("reason = %q, want %q", got.Reason, tt.reason)
+			}
+		})
+	}
+}
+
+// fakeHelm writes a helm stand-in that prints stderr and fails until it has been run failures
+// times, then succeeds
+func fakeHelm(t *testing.T, stderr string, failures int) string {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+count=$(cat "` + dir + `/count" 2>/dev/null || echo 0)
+count=$((count + 1))
+echo $count > "` + dir + `/count"
+if [ $count -le ` + strconv.Itoa(failures) + ` ]; then
+  echo '` + stderr + `' >&2
+  exit 1
+fi
+echo "Saving 1 charts"
+`
+	path := filepath.Join(dir, "helm")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// drainRenderChannels collects everything written to the dep update channels until stop is closed
+func drainRenderChannels(renderChannels RenderChannels, stop chan struct{}) (*strings.Builder, chan struct{}) {
+	stderr := &strings.Builder{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case line := <-renderChannels.DepUpdateStderr:
+				stderr.WriteString(line)
+			case <-renderChannels.DepUpdateStdout:
+			case <-renderChannels.DepUpdateCmd:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return stderr, done
+}
+
+func TestRunDepUpdateWithRetry(t *testing.T) {
+	prev := depUpdateBackoff
+	depUpdateBackoff = func(int) time.Duration { return 0 }
+	t.Cleanup(func() { depUpdateBackoff = prev })
+
+	tests := []struct {
+		name        string
+		stderr      string
+		failures    int
+		wantErr     bool
+		wantRetries int
+	}{
+		{name: "transient then success", stderr: "Error: dial tcp 203.0.113.10:443: i/o timeout", failures: 2, wantRetries: 2},
+		{name: "transient every attempt", stderr: "Error: 503 Service Unavailable", failures: 9, wantErr: true, wantRetries: MaxDepUpdateRetries},
+		{name: "deterministic", stderr: "Error: no repository definition for @bitnami", failures: 1, wantErr: true, wantRetries: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderChannels := RenderChannels{
+				DepUpdateCmd:    make(chan string),
+				DepUpdateStderr: make(chan string),
+				DepUpdateStdout: make(chan string),
+			}
+			stop := make(chan struct{})
+			stderr, done := drainRenderChannels(renderChannels, stop)
+
+			err := runDepUpdateWithRetry(context.Background(), fakeHelm(t, tt.stderr, tt.failures), t.TempDir(), nil, renderChannels)
+			close(stop)
+			<-done
+
+			if tt.wantErr {
+				var depUpdateErr *DepUpdateError
+				if !errors.As(err, &depUpdateErr) {
+					t.Fatalf("expected a DepUpdateError, got %v", err)
+				}
+				if depUpdateErr.Attempts != tt.wantRetries+1 {
+					t.Errorf("attempts = %d, want %d", depUpdateErr.Attempts, tt.wantRetries+1)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := strings.Count(stderr.String(), "--- retry "); got != tt.wantRetries {
+				t.Errorf("retry markers = %d, want %d in %q", got, tt.wantRetries, stderr.String())
+			}
+			if got := strings.Count(stderr.String(), tt.stderr); got != min(tt.failures, MaxDepUpdateRetries+1) {
+				t.Errorf("stderr lines = %d, want one per failed attempt in %q", got, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunDepUpdateCancelled(t *testing.T) {
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	renderChannels := RenderChannels{
+		DepUpdateCmd:    make(chan string),
+		DepUpdateStderr: make(chan string),
+		DepUpdateStdout: make(chan string),
+	}
+	stop := make(chan struct{})
+	stderr, done := drainRenderChannels(renderChannels, stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := runDepUpdateWithRetry(ctx, helm, t.TempDir(), nil, renderChannels)
+	close(stop)
+	<-done
+
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected a cancelled error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("helm wasn't killed when the render was cancelled, it ran for %s", elapsed)
+	}
+	if strings.Contains(stderr.String(), "--- retry ") {
+		t.Errorf("a cancelled dependency update was retried: %q", stderr.String())
+	}
+}
+
+func TestRunDepUpdateTimeout(t *testing.T) {
+	prev := helmCommandTimeout
+	helmCommandTimeout = func() time.Duration { return 100 * time.Millisecond }
+	t.Cleanup(func() { helmCommandTimeout = prev })
+
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	renderChannels := RenderChannels{
+		DepUpdateCmd:    make(chan string),
+		DepUpdateStderr: make(chan string),
+		DepUpdateStdout: make(chan string),
+	}
+	stop := make(chan struct{})
+	_, done := drainRenderChannels(renderChannels, stop)
+
+	_, err := runDepUpdate(context.Background(), helm, t.TempDir(), nil, renderChannels, false)
+	close(stop)
+	<-done
+
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
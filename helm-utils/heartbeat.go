@@ -0,0 +1,103 @@
+package helmutils
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stages of a render, as reported by RenderHeartbeat
+const (
+	RenderStageDepUpdate = "dependency update"
+	RenderStageTemplate  = "template"
+	RenderStageNotes     = "notes"
+)
+
+// renderHeartbeatInterval is how often a running helm command beats when it isn't writing output.
+// It's a var so that tests can beat faster.
+var renderHeartbeatInterval = 10 * time.Second
+
+// RenderHeartbeat is sent while a helm command of a render is running, so that a render that's
+// slow but still making progress can be told apart from one that has stalled
+type RenderHeartbeat struct {
+	Stage string
+	// OutputBytes is how much the command has written to stdout and stderr so far
+	OutputBytes int64
+}
+
+// beat sends a heartbeat without blocking. A heartbeat the receiver hasn't read yet is as good as
+// a new one, so it's dropped when the channel is full.
+func (c RenderChannels) beat(heartbeat RenderHeartbeat) {
+	if c.Heartbeat == nil {
+		return
+	}
+	select {
+	case c.Heartbeat <- heartbeat:
+	default:
+	}
+}
+
+// commandHeartbeat beats for a helm command as it writes output, and every
+// renderHeartbeatInterval while it runs without writing any
+type commandHeartbeat struct {
+	channels RenderChannels
+	stage    string
+	written  atomic.Int64
+}
+
+func newCommandHeartbeat(channels RenderChannels, stage string) *commandHeartbeat {
+	return &commandHeartbeat{channels: channels, stage: stage}
+}
+
+// writer counts the output written to w towards the heartbeat
+func (h *commandHeartbeat) writer(w io.Writer) io.Writer {
+	return &heartbeatWriter{w: w, heartbeat: h}
+}
+
+// start beats until stop is called, call it when the command exits. No heartbeats are sent by
+// start once stop returns.
+func (h *commandHeartbeat) start() (stop func()) {
+	h.send()
+	if h.channels.Heartbeat == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(renderHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.send()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+func (h *commandHeartbeat) send() {
+	h.channels.beat(RenderHeartbeat{Stage: h.stage, OutputBytes: h.written.Load()})
+}
+
+type heartbeatWriter struct {
+	w         io.Writer
+	heartbeat *commandHeartbeat
+}
+
+func (w *heartbeatWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.heartbeat.written.Add(int64(n))
+	w.heartbeat.send()
+	return n, err
+}
@@ -0,0 +1,117 @@
+package helmutils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBeatNeverBlocks(t *testing.T) {
+	// no channel
+	RenderChannels{}.beat(RenderHeartbeat{Stage: RenderStageTemplate})
+
+	channels := RenderChannels{Heartbeat: make(chan RenderHeartbeat, 1)}
+	channels.beat(RenderHeartbeat{Stage: RenderStageTemplate, OutputBytes: 1})
+	channels.beat(RenderHeartbeat{Stage: RenderStageTemplate, OutputBytes: 2})
+
+	if got := <-channels.Heartbeat; got.OutputBytes != 1 {
+		t.Errorf("heartbeat = %+v, want the unread one", got)
+	}
+}
+
+func TestCommandHeartbeat(t *testing.T) {
+	prev := renderHeartbeatInterval
+	renderHeartbeatInterval = 10 * time.Millisecond
+	t.Cleanup(func() { renderHeartbeatInterval = prev })
+
+	channels := RenderChannels{Heartbeat: make(chan RenderHeartbeat, 1)}
+	heartbeat := newCommandHeartbeat(channels, RenderStageTemplate)
+
+	stop := heartbeat.start()
+	if got := <-channels.Heartbeat; got != (RenderHeartbeat{Stage: RenderStageTemplate}) {
+		t.Errorf("first heartbeat = %+v, want one at the start", got)
+	}
+
+	// a command that's running without writing output keeps beating
+	for i := 0; i < 3; i++ {
+		select {
+		case <-channels.Heartbeat:
+		case <-time.After(time.Second):
+			t.Fatal("no heartbeat while the command is running")
+		}
+	}
+
+	stop()
+	stop()
+	for len(channels.Heartbeat) > 0 {
+		<-channels.Heartbeat
+	}
+
+	// output beats with the bytes written so far
+	var output strings.Builder
+	if _, err := heartbeat.writer(&output).Write([]byte("kind: Service\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-channels.Heartbeat; got.OutputBytes != int64(len("kind: Service\n")) {
+		t.Errorf("heartbeat = %+v, want the output counted", got)
+	}
+	if output.String() != "kind: Service\n" {
+		t.Errorf("output = %q, the writer must pass output through", output.String())
+	}
+}
+
+func TestRunDepUpdateHeartbeats(t *testing.T) {
+	prev := renderHeartbeatInterval
+	renderHeartbeatInterval = 10 * time.Millisecond
+	t.Cleanup(func() { renderHeartbeatInterval = prev })
+
+	// a dependency update that's slow but writes nothing until it's done
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\nsleep 0.2\necho \"Saving 1 charts\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	renderChannels := RenderChannels{
+		DepUpdateCmd:    make(chan string),
+		DepUpdateStderr: make(chan string),
+		DepUpdateStdout: make(chan string),
+		Heartbeat:       make(chan RenderHeartbeat, 1),
+	}
+	stop := make(chan struct{})
+	_, drained := drainRenderChannels(renderChannels, stop)
+
+	heartbeats := []RenderHeartbeat{}
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for {
+			select {
+			case heartbeat := <-renderChannels.Heartbeat:
+				heartbeats = append(heartbeats, heartbeat)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	_, err := runDepUpdate(context.Background(), helm, dir, nil, renderChannels, true)
+	close(stop)
+	<-drained
+	<-collected
+	if err != nil {
+		t.Fatalf("runDepUpdate() error = %v", err)
+	}
+
+	if len(heartbeats) < 3 {
+		t.Fatalf("got %d heartbeats, want one at the start and keepalives while helm runs", len(heartbeats))
+	}
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Stage != RenderStageDepUpdate {
+			t.Errorf("stage = %q, want %q", heartbeat.Stage, RenderStageDepUpdate)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/replicatedhq/chartsmith/pkg/helmignore"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
 )
 
@@ -20,11 +21,17 @@ clusters:
   name: default
 `
 
-	tempDir, err := os.MkdirTemp("", "chartsmith")
+	tempDir, cleanup, err := NewTempDir("publish", workspaceID)
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
+	defer cleanup()
+
+	// the packaged chart only contains the files that .helmignore doesn't exclude
+	files, err = helmignore.FilterFiles(files, ".")
+	if err != nil {
+		return fmt.Errorf("failed to apply .helmignore: %w", err)
+	}
 
 	for _, file := range files {
 		filePath := filepath.Join(tempDir, file.FilePath)
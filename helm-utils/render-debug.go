@@ -0,0 +1,129 @@
+package helmutils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// debugLogLine matches the lines helm logs with --debug, "install.go:225: <time> [debug] ...",
+// the message is the first group
+var debugLogLine = regexp.MustCompile(`^[\w.-]+\.go:\d+: .*?\[debug\] (.*)$`)
+
+const (
+	userSuppliedValuesHeader = "USER-SUPPLIED VALUES:"
+	computedValuesHeader     = "COMPUTED VALUES:"
+)
+
+// splitDebugOutput takes what helm template --debug adds to its output out of output, so that what
+// is left is what helm template prints without --debug. The debug log lines, with the stack trace
+// helm logs when it fails, and the values blocks that some helm versions print go into the
+// returned RenderDebug.
+func splitDebugOutput(output string) (string, types.RenderDebug) {
+	debug := types.RenderDebug{}
+	lines := strings.Split(output, "\n")
+	kept := make([]string, 0, len(lines))
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if header := strings.TrimSpace(line); header == userSuppliedValuesHeader || header == computedValuesHeader {
+			block := []string{}
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" && !isValuesHeader(lines[i+1]) {
+				i++
+				block = append(block, lines[i])
+			}
+			values := strings.Join(block, "\n")
+			if values != "" {
+				values += "\n"
+			}
+			if header == userSuppliedValuesHeader {
+				debug.UserSuppliedValues = values
+			} else {
+				debug.ComputedValues = values
+			}
+			continue
+		}
+
+		m := debugLogLine.FindStringSubmatch(line)
+		if m == nil {
+			kept = append(kept, line)
+			continue
+		}
+
+		// a stack trace is a function on one line and its file, indented with a tab, on the next
+		entry := []string{m[1]}
+		for i+1 < len(lines) && isStackTraceLine(lines, i+1) {
+			i++
+			entry = append(entry, lines[i])
+		}
+		debug.Log = append(debug.Log, strings.Join(entry, "\n"))
+	}
+
+	return strings.Join(kept, "\n"), debug
+}
+
+func isValuesHeader(line string) bool {
+	header := strings.TrimSpace(line)
+	return header == userSuppliedValuesHeader || header == computedValuesHeader
+}
+
+func isStackTraceLine(lines []string, i int) bool {
+	if strings.HasPrefix(lines[i], "\t") {
+		return true
+	}
+	return lines[i] != "" && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t")
+}
+
+// computeDebugValues returns the values that the render used, the same way helm status --debug
+// prints them: the user-supplied values are those in valuesFile, empty when there is none, and the
+// computed values are those coalesced with the values of the chart in workingDir and its subcharts
+func computeDebugValues(workingDir string, valuesFile string) (string, string, error) {
+	chrt, err := loader.Load(workingDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	userValues := chartutil.Values{}
+	if valuesFile != "" {
+		userValues, err = chartutil.ReadValuesFile(valuesFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read values: %w", err)
+		}
+	}
+
+	computedValues, err := chartutil.CoalesceValues(chrt, userValues)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to coalesce values: %w", err)
+	}
+
+	userSupplied, err := userValues.YAML()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal user-supplied values: %w", err)
+	}
+	computed, err := computedValues.YAML()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal computed values: %w", err)
+	}
+
+	return userSupplied, computed, nil
+}
+
+// renderDebug splits the debug output out of output and fills in the values that helm didn't print
+func renderDebug(output []byte, workingDir string, valuesFile string) ([]byte, types.RenderDebug) {
+	remaining, debug := splitDebugOutput(string(output))
+	if debug.UserSuppliedValues == "" && debug.ComputedValues == "" {
+		userSupplied, computed, err := computeDebugValues(workingDir, valuesFile)
+		if err != nil {
+			debug.Warning = fmt.Sprintf("values were not computed: %v", err)
+		} else {
+			debug.UserSuppliedValues = userSupplied
+			debug.ComputedValues = computed
+		}
+	}
+	return []byte(remaining), debug
+}
@@ -0,0 +1,185 @@
+package helmutils
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+func TestSplitDebugOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		want      string
+		wantDebug types.RenderDebug
+	}{
+		{
+			name:   "no debug output",
+			output: "---\n# Source: mychart/templates/configmap.yaml\nkind: ConfigMap\n",
+			want:   "---\n# Source: mychart/templates/configmap.yaml\nkind: ConfigMap\n",
+		},
+		{
+			name: "debug log lines",
+			output: "install.go:225: 2026-10-17 09:00:00.1 +0000 UTC m=+0.02 [debug] Original chart version: \"\"\n" +
+				"install.go:242: 2026-10-17 09:00:00.2 +0000 UTC m=+0.03 [debug] CHART PATH: /tmp/render/mychart\n" +
+				"---\n# Source: mychart/templates/configmap.yaml\nkind: ConfigMap\n",
+			want: "---\n# Source: mychart/templates/configmap.yaml\nkind: ConfigMap\n",
+			wantDebug: types.RenderDebug{Log: []string{
+				`Original chart version: ""`,
+				"CHART PATH: /tmp/render/mychart",
+			}},
+		},
+		{
+			name: "stack trace of the error",
+			output: "Error: template: mychart/templates/configmap.yaml:4:10: executing \"mychart/templates/configmap.yaml\" at <.Values.host>: nil pointer\n" +
+				"helm.go:86: 2026-10-17 09:00:00.3 +0000 UTC m=+0.04 [debug] template: mychart/templates/configmap.yaml:4:10: nil pointer\n" +
+				"helm.sh/helm/v3/pkg/action.(*Install).RunWithContext\n" +
+				"\thelm.sh/helm/v3/pkg/action/install.go:309\n" +
+				"main.main\n" +
+				"\thelm.sh/helm/v3/cmd/helm/helm.go:85\n",
+			want: "Error: template: mychart/templates/configmap.yaml:4:10: executing \"mychart/templates/configmap.yaml\" at <.Values.host>: nil pointer\n",
+			wantDebug: types.RenderDebug{Log: []string{
+				"template: mychart/templates/configmap.yaml:4:10: nil pointer\n" +
+					"helm.sh/helm/v3/pkg/action.(*Install).RunWithContext\n" +
+					"\thelm.sh/helm/v3/pkg/action/install.go:309\n" +
+					"main.main\n" +
+					"\thelm.sh/helm/v3/cmd/helm/helm.go:85",
+			}},
+		},
+		{
+			name: "values blocks",
+			output: "USER-SUPPLIED VALUES:\nport: 9090\n\n" +
+				"COMPUTED VALUES:\nimage:\n  tag: latest\nport: 9090\n\n" +
+				"---\nkind: ConfigMap\n",
+			want: "\n\n---\nkind: ConfigMap\n",
+			wantDebug: types.RenderDebug{
+				UserSuppliedValues: "port: 9090\n",
+				ComputedValues:     "image:\n  tag: latest\nport: 9090\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotDebug := splitDebugOutput(tt.output)
+			if got != tt.want {
+				t.Errorf("splitDebugOutput() output = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(gotDebug, tt.wantDebug) {
+				t.Errorf("splitDebugOutput() debug = %#v, want %#v", gotDebug, tt.wantDebug)
+			}
+		})
+	}
+}
+
+func TestComputeDebugValues(t *testing.T) {
+	rootDir := t.TempDir()
+	chartDir := filepath.Join(rootDir, "mychart")
+	writeTestFile(t, filepath.Join(chartDir, "Chart.yaml"), "apiVersion: v2\nname: mychart\nversion: 0.1.0\n")
+	writeTestFile(t, filepath.Join(chartDir, "values.yaml"), "image:\n  repository: nginx\n  tag: latest\nport: 8080\n")
+	valuesFile := filepath.Join(rootDir, valuesOverlayFilename)
+	writeTestFile(t, valuesFile, "image:\n  tag: \"1.27\"\n")
+
+	userSupplied, computed, err := computeDebugValues(chartDir, valuesFile)
+	if err != nil {
+		t.Fatalf("computeDebugValues() error = %v", err)
+	}
+	if want := "image:\n  tag: \"1.27\"\n"; userSupplied != want {
+		t.Errorf("user-supplied values = %q, want %q", userSupplied, want)
+	}
+	if want := "image:\n  repository: nginx\n  tag: \"1.27\"\nport: 8080\n"; computed != want {
+		t.Errorf("computed values = %q, want %q", computed, want)
+	}
+
+	userSupplied, computed, err = computeDebugValues(chartDir, "")
+	if err != nil {
+		t.Fatalf("computeDebugValues() without values error = %v", err)
+	}
+	if userSupplied != "{}\n" || !strings.Contains(computed, "tag: latest") {
+		t.Errorf("without values = %q, %q, want the values of the chart", userSupplied, computed)
+	}
+
+	if _, _, err := computeDebugValues(filepath.Join(rootDir, "missing"), ""); err == nil {
+		t.Error("computeDebugValues() of a missing chart succeeded, want an error")
+	}
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRenderChartExecDebug renders a chart with --debug. It needs helm on the PATH.
+func TestRenderChartExecDebug(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping helm render in short mode")
+	}
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm not found, skipping render test")
+	}
+
+	files := []types.File{
+		{FilePath: "mychart/Chart.yaml", Content: "apiVersion: v2\nname: mychart\nversion: 0.1.0\n"},
+		{FilePath: "mychart/values.yaml", Content: "password: chart-default\n"},
+		{FilePath: "mychart/templates/configmap.yaml", Content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: values\n"},
+	}
+
+	channels := RenderChannels{
+		DepUpdateCmd:       make(chan string),
+		DepUpdateStderr:    make(chan string),
+		DepUpdateStdout:    make(chan string),
+		HelmTemplateCmd:    make(chan string),
+		HelmTemplateStderr: make(chan string),
+		HelmTemplateStdout: make(chan string),
+		Debug:              make(chan types.RenderDebug),
+		Done:               make(chan error),
+	}
+
+	go RenderChartExec(context.Background(), "debug-test", files, "password: hunter2\n", channels)
+
+	var cmd string
+	var output strings.Builder
+	var debug *types.RenderDebug
+	for done := false; !done; {
+		select {
+		case <-channels.DepUpdateCmd:
+		case <-channels.DepUpdateStderr:
+		case <-channels.DepUpdateStdout:
+		case cmd = <-channels.HelmTemplateCmd:
+		case stdout := <-channels.HelmTemplateStdout:
+			output.WriteString(stdout)
+		case stderr := <-channels.HelmTemplateStderr:
+			output.WriteString(stderr)
+		case d := <-channels.Debug:
+			debug = &d
+		case err := <-channels.Done:
+			if err != nil {
+				t.Fatalf("render failed: %v\n%s", err, output.String())
+			}
+			done = true
+		}
+	}
+
+	if !strings.HasSuffix(cmd, "--debug") {
+		t.Errorf("helm template command = %q, want --debug", cmd)
+	}
+	if debug == nil {
+		t.Fatal("no debug output was sent")
+	}
+	if !strings.Contains(debug.ComputedValues, "password: hunter2") || debug.Warning != "" {
+		t.Errorf("debug = %+v, want the computed values", debug)
+	}
+	if strings.Contains(output.String(), "[debug]") || strings.Contains(output.String(), "hunter2") {
+		t.Errorf("helm template output has the debug output:\n%s", output.String())
+	}
+}
@@ -5,14 +5,17 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/replicatedhq/chartsmith/pkg/helmignore"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
 
 	"github.com/pkg/errors"
 )
@@ -25,32 +28,56 @@ type RenderChannels struct {
 	HelmTemplateStderr chan string
 	HelmTemplateStdout chan string
 
+	// Heartbeat receives a heartbeat while helm runs, as it writes output and periodically when it
+	// doesn't. Sends never block, and no heartbeats are sent when it's nil.
+	Heartbeat chan RenderHeartbeat
+
+	// Notes receives the rendered NOTES.txt once helm template succeeds, before Done. Nothing is
+	// sent when it's nil.
+	Notes chan RenderNotes
+
+	// Debug receives what helm template --debug printed, before Done, whether helm template
+	// succeeded or not. helm template runs with --debug only when it's not nil, and the debug output
+	// is never sent to the stdout and stderr channels.
+	Debug chan types.RenderDebug
+
 	Done chan error
 }
 
+// helmCommandTimeout bounds each helm command of a render, a chart can't take longer than the
+// configured CHARTSMITH_TIMEOUT_RENDER_CHART to render. It's a var so that tests can time out sooner.
+var helmCommandTimeout = func() time.Duration {
+	return param.GetTimeouts().RenderChart
+}
+
+// valuesOverlayFilename is the name of the file the values passed to a render are written to
+const valuesOverlayFilename = "chartsmith-values-overlay.yaml"
+
 // RenderChartExec executes helm commands to render a chart with the given files and values
 // For backward compatibility, this function wraps RenderChartExecWithVersion with an empty version
-func RenderChartExec(files []types.File, valuesYAML string, renderChannels RenderChannels) error {
-	return RenderChartExecWithVersion(files, valuesYAML, renderChannels, "")
+func RenderChartExec(ctx context.Context, renderID string, files []types.File, valuesYAML string, renderChannels RenderChannels) error {
+	return RenderChartExecWithVersion(ctx, renderID, files, valuesYAML, renderChannels, "")
 }
 
 // RenderChartExecWithVersion executes helm commands with specific version to render a chart
-// with the given files and values
-func RenderChartExecWithVersion(files []types.File, valuesYAML string, renderChannels RenderChannels, helmVersion string) error {
+// with the given files and values. renderID names the temp directory the chart is written to.
+// The lines it logs include the fields of ctx, see logger.WithFields. Cancelling ctx kills the
+// helm command that's running and fails the render.
+func RenderChartExecWithVersion(ctx context.Context, renderID string, files []types.File, valuesYAML string, renderChannels RenderChannels, helmVersion string) error {
 	start := time.Now()
 	defer func() {
-		fmt.Printf("RenderChartExec completed in %v\n", time.Since(start))
+		logger.InfoCtx(ctx, "RenderChartExec completed", zap.Duration("duration", time.Since(start)))
 
 		// Add capture for panic recovery
 		if r := recover(); r != nil {
-			fmt.Printf("PANIC in RenderChartExec: %v\n", r)
+			logger.ErrorCtx(ctx, fmt.Errorf("PANIC in RenderChartExec: %v", r))
 			// Try to send error through the channel if it's still open
 			select {
 			case renderChannels.Done <- fmt.Errorf("panic in helm render: %v", r):
 				// Error sent successfully
 			default:
 				// Channel might be closed or unbuffered and no receiver
-				fmt.Printf("WARNING: Could not send panic through Done channel\n")
+				logger.WarnCtx(ctx, "Could not send panic through Done channel")
 			}
 		}
 	}()
@@ -92,12 +119,20 @@ clusters:
 
 	renderChannels.DepUpdateStdout <- fmt.Sprintf("Using chart directory: %s\n", chartDir)
 
-	rootDir, err := os.MkdirTemp("", "chartsmith")
+	// leave out the files that helm would skip when loading the chart directory
+	files, err = helmignore.FilterFiles(files, chartDir)
+	if err != nil {
+		renderChannels.Done <- errors.Wrap(err, "failed to apply .helmignore")
+		return errors.Wrap(err, "failed to apply .helmignore")
+	}
+	files, notesFiles := splitNotesFiles(files, chartDir)
+
+	rootDir, cleanup, err := NewTempDir("render", renderID)
 	if err != nil {
 		renderChannels.Done <- errors.Wrap(err, "failed to create temp dir")
 		return errors.Wrap(err, "failed to create temp dir")
 	}
-	defer os.RemoveAll(rootDir)
+	defer cleanup()
 
 	// Create fake kubeconfig file
 	fakeKubeconfigPath := filepath.Join(rootDir, "fake-kubeconfig.yaml")
@@ -124,117 +159,60 @@ clusters:
 	// Working directory for Helm commands is the directory containing Chart.yaml
 	workingDir := filepath.Join(rootDir, chartDir)
 
-	// helm dependency update
-	depUpdateCmd := exec.Command(helmCmd, "dependency", "update", ".")
-	depUpdateCmd.Dir = workingDir
-	depUpdateCmd.Env = []string{"KUBECONFIG=" + fakeKubeconfigPath}
-
-	depUpdateStdoutReader, depUpdateStdoutWriter := io.Pipe()
-	depUpdateStderrReader, depUpdateStderrWriter := io.Pipe()
-
-	depUpdateCmd.Stdout = depUpdateStdoutWriter
-	depUpdateCmd.Stderr = depUpdateStderrWriter
-
-	helmDepUpdateExitCh := make(chan error, 1)
-
-	// Copy helm dep update stdout to the stdout channel
-	go func() {
-		scanner := bufio.NewScanner(depUpdateStdoutReader)
-		for scanner.Scan() {
-			renderChannels.DepUpdateStdout <- scanner.Text() + "\n"
-		}
-	}()
-
-	// Copy helm dep update stderr to the stdout channel
-	go func() {
-		scanner := bufio.NewScanner(depUpdateStderrReader)
-		for scanner.Scan() {
-			renderChannels.DepUpdateStdout <- scanner.Text() + "\n"
-		}
-	}()
-
-	// Start the helm dep update process and wait for it to complete
-	go func() {
-		renderChannels.DepUpdateCmd <- depUpdateCmd.String()
-
-		if err := depUpdateCmd.Start(); err != nil {
-			helmDepUpdateExitCh <- errors.Wrap(err, "helm dependency update failed")
-			return
-		}
-
-		// Create a context with timeout for the command
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		defer cancel()
-
-		// Wait in a goroutine
-		done := make(chan error, 1)
-		go func() {
-			done <- depUpdateCmd.Wait()
-		}()
-
-		// Wait for completion or timeout
-		select {
-		case err := <-done:
-			if err != nil {
-				helmDepUpdateExitCh <- errors.Wrap(err, "helm dependency update failed")
-				return
-			}
-			helmDepUpdateExitCh <- nil
-		case <-ctx.Done():
-			// Attempt to kill the process if it times out
-			depUpdateCmd.Process.Kill()
-			helmDepUpdateExitCh <- errors.New("helm dependency update timed out after 5 minutes")
-		}
-	}()
-
-	// Wait for the process to complete
-	err = <-helmDepUpdateExitCh
-
-	// Close the pipes
-	depUpdateStdoutWriter.Close()
-	depUpdateStderrWriter.Close()
-
-	if err != nil {
+	// helm dependency update, retrying transient failures such as chart repository timeouts
+	if err := runDepUpdateWithRetry(ctx, helmCmd, workingDir, []string{"KUBECONFIG=" + fakeKubeconfigPath}, renderChannels); err != nil {
 		renderChannels.Done <- errors.Wrap(err, "failed to update dependencies")
 		return errors.Wrap(err, "failed to update dependencies")
 	}
 
-	// helm template with values
-	templateCmd := exec.Command(helmCmd, "template", "chartsmith", ".", "--include-crds", "--values", "/dev/stdin")
-	templateCmd.Env = []string{"KUBECONFIG=" + fakeKubeconfigPath}
-	templateCmd.Dir = workingDir
-
+	// the values are written outside of the chart directory so that the chart's own values.yaml
+	// is still loaded as the base and valuesYAML is layered over it
+	valuesFile := ""
 	if valuesYAML != "" {
-		valuesFile := filepath.Join(workingDir, "values.yaml")
+		valuesFile = filepath.Join(rootDir, valuesOverlayFilename)
 		if err := os.WriteFile(valuesFile, []byte(valuesYAML), 0644); err != nil {
 			renderChannels.Done <- fmt.Errorf("failed to write values file: %w", err)
 			return fmt.Errorf("failed to write values file: %w", err)
 		}
-		templateCmd.Args = append(templateCmd.Args, "-f", "values.yaml")
 	}
 
-	fmt.Printf("Running helm template with args: %v\n", templateCmd.Args)
+	// helm template with values
+	// Create a context with timeout for the template command, helm is killed when it's done
+	timeout := helmCommandTimeout()
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	templateCmd := exec.CommandContext(cmdCtx, helmCmd, templateArgs(valuesFile, renderChannels.Debug != nil)...)
+	templateCmd.Env = []string{"KUBECONFIG=" + fakeKubeconfigPath}
+	templateCmd.Dir = workingDir
+
+	logger.InfoCtx(ctx, "Running helm template", zap.Strings("args", templateCmd.Args))
 
 	// Send command to the command channel
 	renderChannels.HelmTemplateCmd <- templateCmd.String()
 
-	// Create a context with timeout for the template command
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
 	// Create a channel to receive the command result
 	cmdDone := make(chan struct {
 		output []byte
 		err    error
 	}, 1)
 
+	// stdout and stderr are combined, the heartbeat counts both
+	heartbeat := newCommandHeartbeat(renderChannels, RenderStageTemplate)
+	var combinedOutput bytes.Buffer
+	templateOutput := heartbeat.writer(&combinedOutput)
+	templateCmd.Stdout = templateOutput
+	templateCmd.Stderr = templateOutput
+
 	// Run the command with timeout in a goroutine
 	go func() {
-		output, err := templateCmd.CombinedOutput()
+		stopHeartbeat := heartbeat.start()
+		err := templateCmd.Run()
+		stopHeartbeat()
 		cmdDone <- struct {
 			output []byte
 			err    error
-		}{output, err}
+		}{combinedOutput.Bytes(), err}
 	}()
 
 	// Wait for completion or timeout
@@ -245,12 +223,21 @@ clusters:
 	case result := <-cmdDone:
 		output = result.output
 		cmdErr = result.err
-	case <-ctx.Done():
-		// Attempt to kill the process if it times out
-		templateCmd.Process.Kill()
-		renderChannels.HelmTemplateStderr <- "Helm template command timed out after 5 minutes\n"
-		renderChannels.Done <- errors.New("helm template command timed out after 5 minutes")
-		return errors.New("helm template command timed out after 5 minutes")
+	case <-cmdCtx.Done():
+		// exec kills helm when cmdCtx is done
+		err := fmt.Errorf("helm template command timed out after %s", timeout)
+		if ctx.Err() != nil {
+			err = fmt.Errorf("helm template command cancelled: %w", ctx.Err())
+		}
+		renderChannels.HelmTemplateStderr <- err.Error() + "\n"
+		renderChannels.Done <- err
+		return err
+	}
+
+	if renderChannels.Debug != nil {
+		var debug types.RenderDebug
+		output, debug = renderDebug(output, workingDir, valuesFile)
+		renderChannels.Debug <- debug
 	}
 
 	if cmdErr != nil {
@@ -288,12 +275,30 @@ clusters:
 	// always send the last buffer
 	renderChannels.HelmTemplateStdout <- strings.Join(buffer, "\n")
 
+	if renderChannels.Notes != nil {
+		renderChannels.Notes <- renderNotes(helmCmd, rootDir, workingDir, templateCmd.Env, valuesFile, notesFiles, renderChannels)
+	}
+
 	// Send completion signal through Done channel
 	renderChannels.Done <- nil
 
 	return nil
 }
 
+// templateArgs returns the arguments to helm template. helm always starts from the chart's
+// values.yaml and layers each values file over it in the order given, so the values in valuesFile
+// override the chart's values key by key, including nested keys.
+func templateArgs(valuesFile string, debug bool) []string {
+	args := []string{"template", "chartsmith", ".", "--include-crds", "--values", "/dev/stdin"}
+	if valuesFile != "" {
+		args = append(args, "--values", valuesFile)
+	}
+	if debug {
+		args = append(args, "--debug")
+	}
+	return args
+}
+
 // findExecutableForHelmVersion returns the path to the helm executable for the specified version
 func findExecutableForHelmVersion(helmVersion string) (string, error) {
 	if helmVersion == "" {
@@ -0,0 +1,142 @@
+package helmutils
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+func TestTemplateArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		valuesFile string
+		debug      bool
+		want       []string
+	}{
+		{
+			name: "chart values only",
+			want: []string{"template", "chartsmith", ".", "--include-crds", "--values", "/dev/stdin"},
+		},
+		{
+			name:       "values layered last",
+			valuesFile: "/tmp/render/chartsmith-values-overlay.yaml",
+			want:       []string{"template", "chartsmith", ".", "--include-crds", "--values", "/dev/stdin", "--values", "/tmp/render/chartsmith-values-overlay.yaml"},
+		},
+		{
+			name:       "debug",
+			valuesFile: "/tmp/render/chartsmith-values-overlay.yaml",
+			debug:      true,
+			want:       []string{"template", "chartsmith", ".", "--include-crds", "--values", "/dev/stdin", "--values", "/tmp/render/chartsmith-values-overlay.yaml", "--debug"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := templateArgs(tt.valuesFile, tt.debug)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("templateArgs(%q, %v) = %v, want %v", tt.valuesFile, tt.debug, got, tt.want)
+			}
+			lastValues := ""
+			for i, arg := range got {
+				if arg == "--values" && i+1 < len(got) {
+					lastValues = got[i+1]
+				}
+			}
+			if tt.valuesFile != "" && lastValues != tt.valuesFile {
+				t.Errorf("values file must be the last layer, got %v", got)
+			}
+		})
+	}
+}
+
+// renderForTest renders files with helm and returns the stdout of helm template
+func renderForTest(t *testing.T, files []types.File, valuesYAML string) string {
+	t.Helper()
+
+	channels := RenderChannels{
+		DepUpdateCmd:       make(chan string),
+		DepUpdateStderr:    make(chan string),
+		DepUpdateStdout:    make(chan string),
+		HelmTemplateCmd:    make(chan string),
+		HelmTemplateStderr: make(chan string),
+		HelmTemplateStdout: make(chan string),
+		Done:               make(chan error),
+	}
+
+	go RenderChartExec(context.Background(), "values-overlay-test", files, valuesYAML, channels)
+
+	var stdout, stderr strings.Builder
+	for {
+		select {
+		case <-channels.DepUpdateCmd:
+		case <-channels.DepUpdateStderr:
+		case <-channels.DepUpdateStdout:
+		case <-channels.HelmTemplateCmd:
+		case line := <-channels.HelmTemplateStderr:
+			stderr.WriteString(line)
+		case chunk := <-channels.HelmTemplateStdout:
+			stdout.WriteString(chunk)
+			stdout.WriteString("\n")
+		case err := <-channels.Done:
+			if err != nil {
+				t.Fatalf("render failed: %v\n%s", err, stderr.String())
+			}
+			return stdout.String()
+		}
+	}
+}
+
+// TestRenderChartExecLayersValues renders a chart with a profile that overrides nested keys. It
+// needs helm on the PATH.
+func TestRenderChartExecLayersValues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping helm render in short mode")
+	}
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm not found, skipping render test")
+	}
+
+	files := []types.File{
+		{FilePath: "mychart/Chart.yaml", Content: "apiVersion: v2\nname: mychart\nversion: 0.1.0\n"},
+		{FilePath: "mychart/values.yaml", Content: `image:
+  repository: nginx
+  tag: "1.25"
+resources:
+  limits:
+    cpu: 100m
+    memory: 128Mi
+`},
+		{FilePath: "mychart/templates/configmap.yaml", Content: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: values
+data:
+  image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+  cpu: "{{ .Values.resources.limits.cpu }}"
+  memory: "{{ .Values.resources.limits.memory }}"
+`},
+	}
+
+	base := renderForTest(t, files, "")
+	for _, want := range []string{`image: "nginx:1.25"`, `cpu: "100m"`, `memory: "128Mi"`} {
+		if !strings.Contains(base, want) {
+			t.Errorf("render without profile missing %s:\n%s", want, base)
+		}
+	}
+
+	profile := `image:
+  tag: "1.25-prod"
+resources:
+  limits:
+    cpu: 500m
+`
+	layered := renderForTest(t, files, profile)
+	for _, want := range []string{`image: "nginx:1.25-prod"`, `cpu: "500m"`, `memory: "128Mi"`} {
+		if !strings.Contains(layered, want) {
+			t.Errorf("render with profile missing %s:\n%s", want, layered)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package helmutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// notesRenderTimeout is how long rendering the NOTES.txt of a chart can take
+const notesRenderTimeout = 2 * time.Minute
+
+// RenderNotes is the NOTES.txt of a chart as rendered with the values of the render, with the
+// notes of its subcharts appended
+type RenderNotes struct {
+	// Notes is nil when neither the chart nor its subcharts have a NOTES.txt
+	Notes *string
+	// Warning is why the notes couldn't be rendered. It doesn't fail the render.
+	Warning string
+}
+
+// isNotesFile reports whether filePath is the NOTES.txt of the chart in chartDir or of one of its
+// subcharts
+func isNotesFile(filePath string, chartDir string) bool {
+	rel, err := filepath.Rel(chartDir, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return path.Base(rel) == "NOTES.txt" && strings.Contains("/"+rel, "/templates/")
+}
+
+// splitNotesFiles returns the files without the NOTES.txt of the chart and its subcharts, and the
+// NOTES.txt files. helm template renders NOTES.txt even though it doesn't print it, so the notes
+// are held back from it to keep an error in them from failing the render.
+func splitNotesFiles(files []types.File, chartDir string) ([]types.File, []types.File) {
+	templates := make([]types.File, 0, len(files))
+	notes := []types.File{}
+	for _, file := range files {
+		if isNotesFile(file.FilePath, chartDir) {
+			notes = append(notes, file)
+		} else {
+			templates = append(templates, file)
+		}
+	}
+	return templates, notes
+}
+
+// notesArgs returns the arguments to the helm install that renders the notes. helm template never
+// prints NOTES.txt, a client side dry run of an install returns them in the release instead.
+func notesArgs(valuesFile string) []string {
+	args := []string{"install", "chartsmith", ".", "--dry-run=client", "--render-subchart-notes", "--output", "json", "--values", "/dev/stdin"}
+	if valuesFile != "" {
+		args = append(args, "--values", valuesFile)
+	}
+	return args
+}
+
+// renderNotes writes the held back NOTES.txt files to rootDir and renders the notes of the chart
+// in workingDir. It's run once helm template has succeeded, so an error here is in the notes and
+// is returned as a warning.
+func renderNotes(helmCmd string, rootDir string, workingDir string, env []string, valuesFile string, notesFiles []types.File, renderChannels RenderChannels) RenderNotes {
+	for _, file := range notesFiles {
+		fileRenderPath := filepath.Join(rootDir, file.FilePath)
+		if err := os.MkdirAll(filepath.Dir(fileRenderPath), 0755); err != nil {
+			return RenderNotes{Warning: fmt.Sprintf("NOTES.txt was not rendered: failed to create dir %q: %v", filepath.Dir(fileRenderPath), err)}
+		}
+		if err := os.WriteFile(fileRenderPath, []byte(file.Content), 0644); err != nil {
+			return RenderNotes{Warning: fmt.Sprintf("NOTES.txt was not rendered: failed to write file %q: %v", fileRenderPath, err)}
+		}
+	}
+
+	if len(notesFiles) == 0 {
+		// a dependency pulled into charts/ can still have notes of its own
+		hasNotes, err := packagedSubchartsHaveNotes(filepath.Join(workingDir, "charts"))
+		if err != nil {
+			return RenderNotes{Warning: fmt.Sprintf("NOTES.txt was not rendered: %v", err)}
+		}
+		if !hasNotes {
+			return RenderNotes{}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notesRenderTimeout)
+	defer cancel()
+
+	notesCmd := exec.CommandContext(ctx, helmCmd, notesArgs(valuesFile)...)
+	notesCmd.Env = env
+	notesCmd.Dir = workingDir
+
+	heartbeat := newCommandHeartbeat(renderChannels, RenderStageNotes)
+	var stdout, stderr bytes.Buffer
+	notesCmd.Stdout = heartbeat.writer(&stdout)
+	notesCmd.Stderr = heartbeat.writer(&stderr)
+
+	stopHeartbeat := heartbeat.start()
+	err := notesCmd.Run()
+	stopHeartbeat()
+	if err != nil {
+		if ctx.Err() != nil {
+			return RenderNotes{Warning: fmt.Sprintf("NOTES.txt was not rendered: timed out after %s", notesRenderTimeout)}
+		}
+		return RenderNotes{Warning: notesWarning(stderr.String(), err)}
+	}
+
+	notes, err := parseReleaseNotes(stdout.Bytes())
+	if err != nil {
+		return RenderNotes{Warning: fmt.Sprintf("NOTES.txt was not rendered: %v", err)}
+	}
+	return RenderNotes{Notes: notes}
+}
+
+// parseReleaseNotes returns the notes of the release helm install prints as JSON, nil when they
+// rendered to nothing
+func parseReleaseNotes(output []byte) (*string, error) {
+	var release struct {
+		Info struct {
+			Notes string `json:"notes"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(output, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse release: %w", err)
+	}
+	if strings.TrimSpace(release.Info.Notes) == "" {
+		return nil, nil
+	}
+	return &release.Info.Notes, nil
+}
+
+// notesWarning describes why helm couldn't render the notes, from the error helm wrote last
+func notesWarning(stderr string, err error) string {
+	_, errs := SplitHelmTemplateStderr(stderr)
+	if len(errs) == 0 {
+		return fmt.Sprintf("NOTES.txt was not rendered: %v", err)
+	}
+
+	message := strings.Join(errs, " ")
+	message = strings.TrimPrefix(message, "Error: ")
+	message = strings.TrimPrefix(message, "INSTALLATION FAILED: ")
+	return "NOTES.txt was not rendered: " + strings.Join(strings.Fields(message), " ")
+}
+
+// packagedSubchartsHaveNotes reports whether one of the chart archives in chartsDir has a
+// NOTES.txt
+func packagedSubchartsHaveNotes(chartsDir string) (bool, error) {
+	entries, err := os.ReadDir(chartsDir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read %s: %w", chartsDir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tgz") {
+			continue
+		}
+		hasNotes, err := archiveHasNotes(filepath.Join(chartsDir, entry.Name()))
+		if err != nil {
+			return false, err
+		}
+		if hasNotes {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func archiveHasNotes(archivePath string) (bool, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", archivePath, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read %s: %w", archivePath, err)
+		}
+		// entries are under the chart's directory, so its own templates are never at the root
+		if isNotesFile(header.Name, ".") {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package helmutils
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+func TestSplitNotesFiles(t *testing.T) {
+	files := []types.File{
+		{FilePath: "mychart/Chart.yaml"},
+		{FilePath: "mychart/templates/NOTES.txt"},
+		{FilePath: "mychart/templates/deployment.yaml"},
+		{FilePath: "mychart/charts/redis/templates/NOTES.txt"},
+		{FilePath: "mychart/docs/NOTES.txt"},
+		{FilePath: "other/templates/NOTES.txt"},
+	}
+
+	templates, notes := splitNotesFiles(files, "mychart")
+
+	wantTemplates := []string{"mychart/Chart.yaml", "mychart/templates/deployment.yaml", "mychart/docs/NOTES.txt", "other/templates/NOTES.txt"}
+	wantNotes := []string{"mychart/templates/NOTES.txt", "mychart/charts/redis/templates/NOTES.txt"}
+	if got := filePaths(templates); !reflect.DeepEqual(got, wantTemplates) {
+		t.Errorf("templates = %v, want %v", got, wantTemplates)
+	}
+	if got := filePaths(notes); !reflect.DeepEqual(got, wantNotes) {
+		t.Errorf("notes = %v, want %v", got, wantNotes)
+	}
+}
+
+func filePaths(files []types.File) []string {
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.FilePath)
+	}
+	return paths
+}
+
+func TestParseReleaseNotes(t *testing.T) {
+	notes, err := parseReleaseNotes([]byte(`{"name": "chartsmith", "info": {"status": "pending-install", "notes": "Get the application URL:\n  kubectl port-forward svc/nginx 8080:80\n"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notes == nil || *notes != "Get the application URL:\n  kubectl port-forward svc/nginx 8080:80\n" {
+		t.Errorf("notes = %v", notes)
+	}
+
+	notes, err = parseReleaseNotes([]byte(`{"name": "chartsmith", "info": {"notes": "\n"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notes != nil {
+		t.Errorf("notes that render to nothing = %q, want nil", *notes)
+	}
+
+	if _, err := parseReleaseNotes([]byte("NOTES:\n")); err == nil {
+		t.Error("expected an error for output that isn't a release")
+	}
+}
+
+func TestNotesWarning(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{
+			name: "template error",
+			stderr: "coalesce.go:237: warning: skipped value for nginx.ingress: Not a table.\n" +
+				"Error: INSTALLATION FAILED: execution error at (nginx/templates/NOTES.txt:3:4):\n" +
+				"\timage.repository is required\n",
+			want: "NOTES.txt was not rendered: execution error at (nginx/templates/NOTES.txt:3:4): image.repository is required",
+		},
+		{
+			name: "no stderr",
+			want: "NOTES.txt was not rendered: exit status 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := notesWarning(tt.stderr, errors.New("exit status 1")); got != tt.want {
+				t.Errorf("notesWarning() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackagedSubchartsHaveNotes(t *testing.T) {
+	chartsDir := t.TempDir()
+
+	hasNotes, err := packagedSubchartsHaveNotes(filepath.Join(chartsDir, "missing"))
+	if err != nil || hasNotes {
+		t.Fatalf("no charts dir = %v, %v, want false", hasNotes, err)
+	}
+
+	writeChartArchive(t, filepath.Join(chartsDir, "common-1.0.0.tgz"), "common/Chart.yaml", "common/templates/_helpers.tpl")
+	hasNotes, err = packagedSubchartsHaveNotes(chartsDir)
+	if err != nil || hasNotes {
+		t.Fatalf("library chart = %v, %v, want false", hasNotes, err)
+	}
+
+	writeChartArchive(t, filepath.Join(chartsDir, "redis-17.0.0.tgz"), "redis/Chart.yaml", "redis/templates/NOTES.txt")
+	hasNotes, err = packagedSubchartsHaveNotes(chartsDir)
+	if err != nil || !hasNotes {
+		t.Fatalf("chart with notes = %v, %v, want true", hasNotes, err)
+	}
+}
+
+func writeChartArchive(t *testing.T, archivePath string, names ...string) {
+	t.Helper()
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// renderNotesForTest renders files with helm and returns the notes sent before Done
+func renderNotesForTest(t *testing.T, files []types.File, valuesYAML string) RenderNotes {
+	t.Helper()
+
+	channels := RenderChannels{
+		DepUpdateCmd:       make(chan string),
+		DepUpdateStderr:    make(chan string),
+		DepUpdateStdout:    make(chan string),
+		HelmTemplateCmd:    make(chan string),
+		HelmTemplateStderr: make(chan string),
+		HelmTemplateStdout: make(chan string),
+		Notes:              make(chan RenderNotes),
+		Done:               make(chan error),
+	}
+
+	go RenderChartExec(context.Background(), "notes-test", files, valuesYAML, channels)
+
+	var notes RenderNotes
+	var stderr strings.Builder
+	for {
+		select {
+		case <-channels.DepUpdateCmd:
+		case <-channels.DepUpdateStderr:
+		case <-channels.DepUpdateStdout:
+		case <-channels.HelmTemplateCmd:
+		case <-channels.HelmTemplateStdout:
+		case line := <-channels.HelmTemplateStderr:
+			stderr.WriteString(line)
+		case notes = <-channels.Notes:
+		case err := <-channels.Done:
+			if err != nil {
+				t.Fatalf("render failed: %v\n%s", err, stderr.String())
+			}
+			return notes
+		}
+	}
+}
+
+// TestRenderChartExecNotes renders charts with and without NOTES.txt. It needs helm on the PATH.
+func TestRenderChartExecNotes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping helm render in short mode")
+	}
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm not found, skipping render test")
+	}
+
+	files := []types.File{
+		{FilePath: "mychart/Chart.yaml", Content: "apiVersion: v2\nname: mychart\nversion: 0.1.0\n"},
+		{FilePath: "mychart/values.yaml", Content: "port: 8080\n"},
+		{FilePath: "mychart/templates/configmap.yaml", Content: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: values\n"},
+	}
+
+	if notes := renderNotesForTest(t, files, ""); notes.Notes != nil || notes.Warning != "" {
+		t.Errorf("chart without NOTES.txt = %+v, want no notes", notes)
+	}
+
+	withNotes := append(files, types.File{FilePath: "mychart/templates/NOTES.txt", Content: "Listening on {{ .Values.port }}\n"})
+	notes := renderNotesForTest(t, withNotes, "port: 9090\n")
+	if notes.Notes == nil || !strings.Contains(*notes.Notes, "Listening on 9090") || notes.Warning != "" {
+		t.Errorf("chart with NOTES.txt = %+v, want it rendered with the values", notes)
+	}
+
+	failing := append(files, types.File{FilePath: "mychart/templates/NOTES.txt", Content: "{{ required \"host is required\" .Values.host }}\n"})
+	notes = renderNotesForTest(t, failing, "")
+	if notes.Notes != nil || !strings.Contains(notes.Warning, "host is required") {
+		t.Errorf("chart with failing NOTES.txt = %+v, want a warning", notes)
+	}
+}
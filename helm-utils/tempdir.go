@@ -0,0 +1,210 @@
+package helmutils
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// tempDirPrefix starts the name of every directory helm commands run in, the sweep only removes
+// directories with this prefix so that it never touches other files in the root
+const tempDirPrefix = "chartsmith-"
+
+// TempConfig is where helm commands get their temp directories and how much disk they can use
+type TempConfig struct {
+	// Root is the directory temp directories are created in, the system temp dir if empty
+	Root string
+	// MinFreeBytes is the free space below which no new temp directories are created
+	MinFreeBytes uint64
+	// MaxAge is how old a temp directory is before the sweep removes it
+	MaxAge time.Duration
+}
+
+// DefaultTempConfig is used until ConfigureTemp is called
+var DefaultTempConfig = TempConfig{
+	MinFreeBytes: 1 << 30,
+	MaxAge:       time.Hour,
+}
+
+var (
+	tempConfigMu sync.RWMutex
+	tempConfig   = DefaultTempConfig
+)
+
+// ErrInsufficientDisk is returned instead of a temp directory when free space is below the quota
+var ErrInsufficientDisk = errors.New("insufficient free disk space for helm")
+
+// freeBytes returns the space available to unprivileged users on the filesystem of dir, it's a var
+// so that tests can fake a full disk
+var freeBytes = func(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// ConfigureTemp sets where temp directories are created and the quota, zero values use the defaults
+func ConfigureTemp(cfg TempConfig) {
+	if cfg.MinFreeBytes == 0 {
+		cfg.MinFreeBytes = DefaultTempConfig.MinFreeBytes
+	}
+	if cfg.MaxAge == 0 {
+		cfg.MaxAge = DefaultTempConfig.MaxAge
+	}
+
+	tempConfigMu.Lock()
+	defer tempConfigMu.Unlock()
+	tempConfig = cfg
+}
+
+func currentTempConfig() TempConfig {
+	tempConfigMu.RLock()
+	defer tempConfigMu.RUnlock()
+
+	cfg := tempConfig
+	if cfg.Root == "" {
+		cfg.Root = os.TempDir()
+	}
+	return cfg
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// NewTempDir creates a temp directory for a helm command, with kind and id (such as a render ID) in
+// its name so that leftovers can be traced back. It fails fast with ErrInsufficientDisk when the
+// free space is below the quota. The returned cleanup removes the directory and is meant to be
+// deferred, so that the directory is removed however the command ends, including a panic.
+func NewTempDir(kind string, id string) (string, func(), error) {
+	cfg := currentTempConfig()
+
+	if err := os.MkdirAll(cfg.Root, 0755); err != nil {
+		return "", nil, errors.Wrap(err, "failed to create temp root")
+	}
+
+	free, err := freeBytes(cfg.Root)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to check free disk space")
+	}
+	if free < cfg.MinFreeBytes {
+		return "", nil, errors.Wrapf(ErrInsufficientDisk, "%d MB free in %s, at least %d MB required", free>>20, cfg.Root, cfg.MinFreeBytes>>20)
+	}
+
+	pattern := tempDirPrefix + unsafeNameChars.ReplaceAllString(kind, "-") + "-"
+	if id != "" {
+		pattern += unsafeNameChars.ReplaceAllString(id, "-") + "-"
+	}
+	dir, err := os.MkdirTemp(cfg.Root, pattern)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to create temp dir")
+	}
+
+	cleanup := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			logger.Warn("failed to remove temp dir", zap.String("dir", dir), zap.Error(err))
+		}
+	}
+	return dir, cleanup, nil
+}
+
+// SweepTempDirs removes the temp directories in the root that were last modified before the max age,
+// which are left behind by a worker that was killed mid command. It returns the removed directories.
+func SweepTempDirs(now time.Time) ([]string, error) {
+	cfg := currentTempConfig()
+	return sweepTempDirs(cfg.Root, now.Add(-cfg.MaxAge))
+}
+
+func sweepTempDirs(root string, before time.Time) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read temp root")
+	}
+
+	removed := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed since it was listed
+			continue
+		}
+		if !info.ModTime().Before(before) {
+			continue
+		}
+
+		dir := filepath.Join(root, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, errors.Wrapf(err, "failed to remove %s", dir)
+		}
+		removed = append(removed, dir)
+	}
+
+	return removed, nil
+}
+
+// TempUsage is the disk used by temp directories
+type TempUsage struct {
+	Dirs      int
+	Bytes     int64
+	FreeBytes uint64
+}
+
+// CurrentTempUsage measures the temp directories in the root and the free space left
+func CurrentTempUsage() (*TempUsage, error) {
+	cfg := currentTempConfig()
+
+	usage, err := tempUsage(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	free, err := freeBytes(cfg.Root)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to check free disk space")
+	}
+	usage.FreeBytes = free
+
+	return usage, nil
+}
+
+func tempUsage(root string) (*TempUsage, error) {
+	usage := &TempUsage{}
+
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read temp root")
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+			continue
+		}
+		usage.Dirs++
+
+		// directories can be removed while they're walked, those errors aren't usage
+		filepath.Walk(filepath.Join(root, entry.Name()), func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				usage.Bytes += info.Size()
+			}
+			return nil
+		})
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,160 @@
+package helmutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTempTree creates a temp root with directories of the given ages, and a file and a directory
+// that aren't ours, which the sweep must leave alone however old they are
+func fakeTempTree(t *testing.T, now time.Time, ages map[string]time.Duration) string {
+	root := t.TempDir()
+	for name, age := range ages {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Join(dir, "templates"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "templates", "deployment.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(dir, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSweepTempDirs(t *testing.T) {
+	now := time.Now()
+	root := fakeTempTree(t, now, map[string]time.Duration{
+		"chartsmith-render-abc-1":  2 * time.Hour,
+		"chartsmith-publish-def-2": 61 * time.Minute,
+		"chartsmith-render-ghi-3":  10 * time.Minute,
+		"other-tool-4":             48 * time.Hour,
+	})
+	if err := os.WriteFile(filepath.Join(root, "chartsmith-file"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "chartsmith-file"), now.Add(-48*time.Hour), now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := sweepTempDirs(root, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range removed {
+		removed[i] = filepath.Base(removed[i])
+	}
+	sort.Strings(removed)
+	if strings.Join(removed, ",") != "chartsmith-publish-def-2,chartsmith-render-abc-1" {
+		t.Fatalf("unexpected removed dirs: %v", removed)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := []string{}
+	for _, entry := range entries {
+		remaining = append(remaining, entry.Name())
+	}
+	sort.Strings(remaining)
+	if strings.Join(remaining, ",") != "chartsmith-file,chartsmith-render-ghi-3,other-tool-4" {
+		t.Fatalf("unexpected remaining entries: %v", remaining)
+	}
+}
+
+func TestSweepTempDirsMissingRoot(t *testing.T) {
+	removed, err := sweepTempDirs(filepath.Join(t.TempDir(), "missing"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("unexpected removed dirs: %v", removed)
+	}
+}
+
+func TestNewTempDir(t *testing.T) {
+	root := t.TempDir()
+	ConfigureTemp(TempConfig{Root: root, MinFreeBytes: 1})
+	t.Cleanup(func() { ConfigureTemp(DefaultTempConfig) })
+
+	dir, cleanup, err := NewTempDir("render", "abc/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(dir), "chartsmith-render-abc-123-") {
+		t.Fatalf("unexpected temp dir name %s", dir)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := CurrentTempUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Dirs != 1 || usage.Bytes != int64(len("name: test\n")) || usage.FreeBytes == 0 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("temp dir wasn't removed: %v", err)
+	}
+}
+
+func TestNewTempDirRemovedOnPanic(t *testing.T) {
+	ConfigureTemp(TempConfig{Root: t.TempDir(), MinFreeBytes: 1})
+	t.Cleanup(func() { ConfigureTemp(DefaultTempConfig) })
+
+	var dir string
+	func() {
+		defer func() { recover() }()
+
+		var cleanup func()
+		var err error
+		dir, cleanup, err = NewTempDir("render", "panic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		panic("render failed")
+	}()
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("temp dir wasn't removed: %v", err)
+	}
+}
+
+func TestNewTempDirQuota(t *testing.T) {
+	root := t.TempDir()
+	ConfigureTemp(TempConfig{Root: root, MinFreeBytes: 100 << 20})
+	t.Cleanup(func() { ConfigureTemp(DefaultTempConfig) })
+
+	original := freeBytes
+	freeBytes = func(string) (uint64, error) { return 10 << 20, nil }
+	t.Cleanup(func() { freeBytes = original })
+
+	_, _, err := NewTempDir("render", "abc")
+	if !errors.Is(err, ErrInsufficientDisk) {
+		t.Fatalf("expected ErrInsufficientDisk, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "10 MB free") {
+		t.Fatalf("unexpected error message %q", err.Error())
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("temp dir was created despite the quota")
+	}
+}
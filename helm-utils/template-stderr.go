@@ -0,0 +1,156 @@
+package helmutils
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// helmWarningPatterns match the non-fatal lines helm template writes to stderr on a successful
+// render: "WARNING:" notices such as deprecated charts, the Go log lines from values coalescing
+// and the chart walk ("coalesce.go:286: warning: ...", "walk.go:75: found symbolic link ..."),
+// and klog warnings from client-go ("W0102 15:04:05.000000 ...")
+var helmWarningPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^warning:`),
+	regexp.MustCompile(`^[a-z_]+\.go:\d+: `),
+	regexp.MustCompile(`^W\d{4} \d{2}:\d{2}:\d{2}`),
+}
+
+// SplitHelmTemplateStderr splits the stderr of helm template into warnings and errors, one entry
+// per line. Indented lines continue the line before them and are classified with it.
+func SplitHelmTemplateStderr(stderr string) ([]string, []string) {
+	warnings := []string{}
+	errs := []string{}
+
+	isWarning := false
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			isWarning = isHelmWarning(line)
+		}
+
+		if isWarning {
+			warnings = append(warnings, line)
+		} else {
+			errs = append(errs, line)
+		}
+	}
+
+	return warnings, errs
+}
+
+func isHelmWarning(line string) bool {
+	for _, pattern := range helmWarningPatterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// TemplateErrorLocation is the chart file an error of helm template points to, and the line in it
+// when helm gives one
+type TemplateErrorLocation struct {
+	// Chart is the name of the chart, the top level chart for a file of a subchart
+	Chart string
+	// Path is the path of the file in the chart, "templates/deployment.yaml" or
+	// "charts/redis/templates/master.yaml"
+	Path string
+	// Line and Column are 0 when helm doesn't give them. The line of a YAML parse error is a line
+	// of the rendered manifest rather than of the template.
+	Line   int
+	Column int
+}
+
+// templateErrorLocationPatterns match where helm says an error is, the first group is the file
+// path including the chart name and the second and third the line and column:
+// "template: nginx/templates/deployment.yaml:12:20: executing ...", "parse error at
+// (nginx/templates/service.yaml:5): ...", "execution error at (nginx/templates/NOTES.txt:3:4): ..."
+// and "YAML parse error on nginx/templates/service.yaml: ... yaml: line 8: ..."
+var templateErrorLocationPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`template: ([^\s:()"]+/[^\s:()"]+):(\d+)(?::(\d+))?:`),
+	regexp.MustCompile(`\(([^\s:()"]+/[^\s:()"]+):(\d+)(?::(\d+))?\)`),
+	regexp.MustCompile(`YAML parse error on ([^\s:()"]+/[^\s:()"]+):(?:.*?\byaml: line (\d+):)?`),
+}
+
+// HelmTemplateErrorLocations returns where the error lines of helm template point to, in the order
+// helm mentions them, once each. An error raised in a helper points first to the template that
+// included it and then to the helper.
+func HelmTemplateErrorLocations(errs []string) []TemplateErrorLocation {
+	locations := []TemplateErrorLocation{}
+	seen := map[TemplateErrorLocation]bool{}
+	for _, line := range errs {
+		for _, location := range templateErrorLocations(line) {
+			if seen[location] {
+				continue
+			}
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+func templateErrorLocations(line string) []TemplateErrorLocation {
+	type match struct {
+		at       int
+		location TemplateErrorLocation
+	}
+	matches := []match{}
+	for _, pattern := range templateErrorLocationPatterns {
+		for _, m := range pattern.FindAllStringSubmatchIndex(line, -1) {
+			chart, filePath, ok := strings.Cut(line[m[2]:m[3]], "/")
+			if !ok {
+				continue
+			}
+			location := TemplateErrorLocation{Chart: chart, Path: filePath}
+			if len(m) > 4 && m[4] >= 0 {
+				location.Line, _ = strconv.Atoi(line[m[4]:m[5]])
+			}
+			if len(m) > 6 && m[6] >= 0 {
+				location.Column, _ = strconv.Atoi(line[m[6]:m[7]])
+			}
+			matches = append(matches, match{at: m[0], location: location})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].at < matches[j].at })
+
+	locations := make([]TemplateErrorLocation, 0, len(matches))
+	for _, m := range matches {
+		locations = append(locations, m.location)
+	}
+	return locations
+}
+
+// TrimHelmTemplateErrors keeps the error lines of helm template that say what went wrong, the
+// "Error:" lines and lines that point into the chart with the indented lines continuing them, and
+// drops the rest such as the stack traces printed with --debug. All the lines are kept when none
+// of them say, and at most maxLines lines are returned.
+func TrimHelmTemplateErrors(errs []string, maxLines int) []string {
+	trimmed := []string{}
+	keeping := false
+	for _, line := range errs {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if keeping {
+				trimmed = append(trimmed, line)
+			}
+			continue
+		}
+		keeping = strings.HasPrefix(line, "Error:") || len(templateErrorLocations(line)) > 0
+		if keeping {
+			trimmed = append(trimmed, line)
+		}
+	}
+	if len(trimmed) == 0 {
+		trimmed = append(trimmed, errs...)
+	}
+	if len(trimmed) > maxLines {
+		trimmed = trimmed[:maxLines]
+	}
+	return trimmed
+}
@@ -0,0 +1,213 @@
+package helmutils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitHelmTemplateStderr(t *testing.T) {
+	tests := []struct {
+		name         string
+		stderr       string
+		wantWarnings []string
+		wantErrors   []string
+	}{
+		{
+			name:         "empty",
+			stderr:       "",
+			wantWarnings: []string{},
+			wantErrors:   []string{},
+		},
+		{
+			name: "only warnings",
+			stderr: `WARNING: This chart is deprecated
+coalesce.go:286: warning: cannot overwrite table with non table for redis.master.persistence (map[enabled:true size:8Gi])
+walk.go:75: found symbolic link in path: /tmp/chartsmith-render-abc/templates/link.yaml resolves to /tmp/other.yaml. Contents of linked file included and used
+`,
+			wantWarnings: []string{
+				"WARNING: This chart is deprecated",
+				"coalesce.go:286: warning: cannot overwrite table with non table for redis.master.persistence (map[enabled:true size:8Gi])",
+				"walk.go:75: found symbolic link in path: /tmp/chartsmith-render-abc/templates/link.yaml resolves to /tmp/other.yaml. Contents of linked file included and used",
+			},
+			wantErrors: []string{},
+		},
+		{
+			name: "only an error",
+			stderr: `Error: template: nginx/templates/deployment.yaml:12:20: executing "nginx/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag
+`,
+			wantWarnings: []string{},
+			wantErrors: []string{
+				`Error: template: nginx/templates/deployment.yaml:12:20: executing "nginx/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag`,
+			},
+		},
+		{
+			name: "warnings before a fatal error",
+			stderr: `coalesce.go:237: warning: skipped value for nginx.ingress: Not a table.
+WARNING: Kubernetes configuration file is group-readable. This is insecure. Location: /tmp/kubeconfig
+Error: YAML parse error on nginx/templates/service.yaml: error converting YAML to JSON: yaml: line 8: did not find expected key
+`,
+			wantWarnings: []string{
+				"coalesce.go:237: warning: skipped value for nginx.ingress: Not a table.",
+				"WARNING: Kubernetes configuration file is group-readable. This is insecure. Location: /tmp/kubeconfig",
+			},
+			wantErrors: []string{
+				"Error: YAML parse error on nginx/templates/service.yaml: error converting YAML to JSON: yaml: line 8: did not find expected key",
+			},
+		},
+		{
+			name: "klog warning and indented continuation",
+			stderr: "W0102 15:04:05.000000   12345 warnings.go:70] policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+\n" +
+				"Error: execution error at (nginx/templates/NOTES.txt:3:4):\n" +
+				"\timage.repository is required\n",
+			wantWarnings: []string{
+				"W0102 15:04:05.000000   12345 warnings.go:70] policy/v1beta1 PodSecurityPolicy is deprecated in v1.21+",
+			},
+			wantErrors: []string{
+				"Error: execution error at (nginx/templates/NOTES.txt:3:4):",
+				"\timage.repository is required",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, errs := SplitHelmTemplateStderr(tt.stderr)
+			if !reflect.DeepEqual(warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", warnings, tt.wantWarnings)
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrors) {
+				t.Errorf("errors = %q, want %q", errs, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestHelmTemplateErrorLocations(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   []TemplateErrorLocation
+	}{
+		{
+			name:   "nil pointer",
+			stderr: `Error: template: nginx/templates/deployment.yaml:12:20: executing "nginx/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag`,
+			want:   []TemplateErrorLocation{{Chart: "nginx", Path: "templates/deployment.yaml", Line: 12, Column: 20}},
+		},
+		{
+			name:   "parse error has no column",
+			stderr: `Error: parse error at (nginx/templates/service.yaml:5): unexpected "}" in operand`,
+			want:   []TemplateErrorLocation{{Chart: "nginx", Path: "templates/service.yaml", Line: 5}},
+		},
+		{
+			name:   "function not defined",
+			stderr: `Error: parse error at (nginx/templates/configmap.yaml:7): function "toYml" not defined`,
+			want:   []TemplateErrorLocation{{Chart: "nginx", Path: "templates/configmap.yaml", Line: 7}},
+		},
+		{
+			name:   "required value",
+			stderr: "Error: execution error at (nginx/templates/secret.yaml:9:14): auth.password is required\n",
+			want:   []TemplateErrorLocation{{Chart: "nginx", Path: "templates/secret.yaml", Line: 9, Column: 14}},
+		},
+		{
+			name:   "error in an included helper",
+			stderr: `Error: template: nginx/templates/deployment.yaml:8:8: executing "nginx/templates/deployment.yaml" at <include "nginx.labels" .>: error calling include: template: nginx/templates/_helpers.tpl:40:14: executing "nginx.labels" at <.Values.labels.app>: nil pointer evaluating interface {}.app`,
+			want: []TemplateErrorLocation{
+				{Chart: "nginx", Path: "templates/deployment.yaml", Line: 8, Column: 8},
+				{Chart: "nginx", Path: "templates/_helpers.tpl", Line: 40, Column: 14},
+			},
+		},
+		{
+			name:   "subchart template",
+			stderr: `Error: template: app/charts/redis/templates/master/statefulset.yaml:31:22: executing "app/charts/redis/templates/master/statefulset.yaml" at <.Values.master.persistence.size>: nil pointer evaluating interface {}.size`,
+			want:   []TemplateErrorLocation{{Chart: "app", Path: "charts/redis/templates/master/statefulset.yaml", Line: 31, Column: 22}},
+		},
+		{
+			name:   "YAML parse error",
+			stderr: `Error: YAML parse error on nginx/templates/service.yaml: error converting YAML to JSON: yaml: line 8: did not find expected key`,
+			want:   []TemplateErrorLocation{{Chart: "nginx", Path: "templates/service.yaml", Line: 8}},
+		},
+		{
+			name:   "YAML parse error without a line",
+			stderr: `Error: YAML parse error on nginx/templates/ingress.yaml: error unmarshaling JSON: while decoding JSON: json: cannot unmarshal string into Go value of type releaseutil.SimpleHead`,
+			want:   []TemplateErrorLocation{{Chart: "nginx", Path: "templates/ingress.yaml"}},
+		},
+		{
+			name: "mentioned again on a later line",
+			stderr: "coalesce.go:237: warning: skipped value for nginx.ingress: Not a table.\n" +
+				"Error: execution error at (nginx/templates/NOTES.txt:3:4):\n" +
+				"\timage.repository is required\n" +
+				`Error: template: nginx/templates/NOTES.txt:3:4: executing "nginx/templates/NOTES.txt" at <required "image.repository is required" .Values.image.repository>: error calling required: image.repository is required`,
+			want: []TemplateErrorLocation{{Chart: "nginx", Path: "templates/NOTES.txt", Line: 3, Column: 4}},
+		},
+		{
+			name:   "no location",
+			stderr: "Error: chart requires kubeVersion: >=1.25.0-0 which is incompatible with Kubernetes v1.20.0",
+			want:   []TemplateErrorLocation{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := SplitHelmTemplateStderr(tt.stderr)
+			if got := HelmTemplateErrorLocations(errs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HelmTemplateErrorLocations() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimHelmTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []string
+		maxLines int
+		want     []string
+	}{
+		{
+			name: "debug stack trace",
+			errs: []string{
+				`Error: template: nginx/templates/deployment.yaml:12:20: executing "nginx/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag`,
+				"helm.sh/helm/v3/pkg/action.(*Install).RunWithContext",
+				"\thelm.sh/helm/v3/pkg/action/install.go:298",
+				"main.runInstall",
+				"\thelm.sh/helm/v3/cmd/helm/install.go:316",
+			},
+			maxLines: 10,
+			want: []string{
+				`Error: template: nginx/templates/deployment.yaml:12:20: executing "nginx/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag`,
+			},
+		},
+		{
+			name: "continuation is kept",
+			errs: []string{
+				"Error: execution error at (nginx/templates/NOTES.txt:3:4):",
+				"\timage.repository is required",
+			},
+			maxLines: 10,
+			want: []string{
+				"Error: execution error at (nginx/templates/NOTES.txt:3:4):",
+				"\timage.repository is required",
+			},
+		},
+		{
+			name:     "nothing says what went wrong",
+			errs:     []string{"signal: killed"},
+			maxLines: 10,
+			want:     []string{"signal: killed"},
+		},
+		{
+			name:     "at most maxLines",
+			errs:     []string{"Error: one", "Error: two", "Error: three"},
+			maxLines: 2,
+			want:     []string{"Error: one", "Error: two"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimHelmTemplateErrors(tt.errs, tt.maxLines); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TrimHelmTemplateErrors() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
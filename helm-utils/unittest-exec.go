@@ -0,0 +1,144 @@
+package helmutils
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// UnitTestChannels receive the output of helm unittest as it runs, the way RenderChannels do for
+// a render. Done receives nil when every test passed.
+type UnitTestChannels struct {
+	Cmd    chan string
+	Stdout chan string
+	Stderr chan string
+
+	Done chan error
+}
+
+var (
+	// ErrUnitTestPluginNotInstalled is returned when helm doesn't have the helm-unittest plugin
+	ErrUnitTestPluginNotInstalled = errors.New("the helm-unittest plugin is not installed")
+	// ErrUnitTestsFailed is returned when helm unittest ran and at least one test failed
+	ErrUnitTestsFailed = errors.New("unit tests failed")
+)
+
+// unitTestTimeout is how long helm unittest may run
+var unitTestTimeout = 5 * time.Minute
+
+// UnitTestPluginInstalled reports whether helm has the helm-unittest plugin
+func UnitTestPluginInstalled() (bool, error) {
+	out, err := exec.Command("helm", "plugin", "list").Output()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list helm plugins")
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "unittest" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RunUnitTests writes the files of a chart to a temp directory and runs helm unittest on it,
+// streaming its output to the channels. The files aren't filtered by .helmignore, which usually
+// ignores the tests directory that helm unittest reads. runID names the temp directory.
+func RunUnitTests(runID string, files []types.File, channels UnitTestChannels) error {
+	err := runUnitTests(runID, files, channels)
+	channels.Done <- err
+	return err
+}
+
+func runUnitTests(runID string, files []types.File, channels UnitTestChannels) error {
+	installed, err := UnitTestPluginInstalled()
+	if err != nil {
+		return err
+	}
+	if !installed {
+		return ErrUnitTestPluginNotInstalled
+	}
+
+	// the shortest Chart.yaml is the chart's own, the others belong to its subcharts
+	chartYAMLPath := ""
+	for _, file := range files {
+		if filepath.Base(file.FilePath) == "Chart.yaml" && (chartYAMLPath == "" || len(file.FilePath) < len(chartYAMLPath)) {
+			chartYAMLPath = file.FilePath
+		}
+	}
+	if chartYAMLPath == "" {
+		return errors.New("no Chart.yaml file found")
+	}
+	chartDir := filepath.Dir(chartYAMLPath)
+
+	rootDir, cleanup, err := NewTempDir("unittest", runID)
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp dir")
+	}
+	defer cleanup()
+
+	for _, file := range files {
+		filePath := filepath.Join(rootDir, filepath.Clean("/"+file.FilePath))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return errors.Wrapf(err, "failed to create dir %q", filepath.Dir(filePath))
+		}
+		if err := os.WriteFile(filePath, []byte(file.Content), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write file %q", filePath)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unitTestTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "helm", "unittest", "--color=false", ".")
+	cmd.Dir = filepath.Join(rootDir, chartDir)
+
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	stream := func(reader io.Reader, lines chan string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines <- scanner.Text() + "\n"
+		}
+		io.Copy(io.Discard, reader)
+	}
+	go stream(stdoutReader, channels.Stdout)
+	go stream(stderrReader, channels.Stderr)
+
+	channels.Cmd <- cmd.String()
+
+	err = cmd.Run()
+
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("helm unittest timed out after %s", unitTestTimeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return errors.Wrapf(ErrUnitTestsFailed, "helm unittest exited with %d", exitErr.ExitCode())
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to run helm unittest")
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package helmutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// fakeUnitTestHelm puts a helm on the PATH that lists the given plugins, and prints the tests it
+// finds and exits with exitCode when running helm unittest
+func fakeUnitTestHelm(t *testing.T, plugins string, exitCode int) {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+if [ "$1" = "plugin" ]; then
+	printf 'NAME\tVERSION\tDESCRIPTION\n` + plugins + `'
+	exit 0
+fi
+if [ "$1" = "unittest" ]; then
+	for f in tests/*_test.yaml; do echo "PASS	$f"; done
+	echo "some warning" >&2
+	exit ` + strconv.Itoa(exitCode) + `
+fi
+exit 2
+`
+	if err := os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ConfigureTemp(TempConfig{Root: t.TempDir(), MinFreeBytes: 1})
+	t.Cleanup(func() { ConfigureTemp(DefaultTempConfig) })
+}
+
+// runUnitTestsForTest runs the unit tests of files and returns the stdout, stderr and result
+func runUnitTestsForTest(files []types.File) (string, string, error) {
+	channels := UnitTestChannels{
+		Cmd:    make(chan string),
+		Stdout: make(chan string),
+		Stderr: make(chan string),
+		Done:   make(chan error),
+	}
+	go RunUnitTests("unittest-test", files, channels)
+
+	var stdout, stderr strings.Builder
+	for {
+		select {
+		case <-channels.Cmd:
+		case line := <-channels.Stdout:
+			stdout.WriteString(line)
+		case line := <-channels.Stderr:
+			stderr.WriteString(line)
+		case err := <-channels.Done:
+			return stdout.String(), stderr.String(), err
+		}
+	}
+}
+
+var unitTestChartFiles = []types.File{
+	{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: nginx\nversion: 1.0.0\n"},
+	{FilePath: ".helmignore", Content: "tests/\n"},
+	{FilePath: "templates/service.yaml", Content: "kind: Service\n"},
+	{FilePath: "tests/service_test.yaml", Content: "suite: service\n"},
+	{FilePath: "charts/redis/Chart.yaml", Content: "apiVersion: v2\nname: redis\nversion: 1.0.0\n"},
+}
+
+func TestRunUnitTests(t *testing.T) {
+	tests := []struct {
+		name       string
+		plugins    string
+		exitCode   int
+		wantErr    error
+		wantStdout string
+	}{
+		{name: "passing", plugins: `unittest\t0.8.2\tunit test\n`, wantStdout: "PASS\ttests/service_test.yaml\n"},
+		{name: "failing", plugins: `unittest\t0.8.2\tunit test\n`, exitCode: 1, wantErr: ErrUnitTestsFailed, wantStdout: "PASS\ttests/service_test.yaml\n"},
+		{name: "plugin not installed", plugins: `diff\t3.9.0\tdiff\n`, wantErr: ErrUnitTestPluginNotInstalled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeUnitTestHelm(t, tt.plugins, tt.exitCode)
+
+			stdout, stderr, err := runUnitTestsForTest(unitTestChartFiles)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("got stdout %q, want %q", stdout, tt.wantStdout)
+			}
+			if tt.wantStdout != "" && stderr != "some warning\n" {
+				t.Errorf("got stderr %q", stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var (
+	defineActionRegex  = regexp.MustCompile(`^(define|block)\s+"([^"]+)"`)
+	includeActionRegex = regexp.MustCompile(`(?:^|[\s(|])(?:include|template)\s+"([^"]+)"`)
+)
+
+// NodeType is what a node of a template graph stands for
+type NodeType string
+
+const (
+	// NodeTypeFile is a file under templates/
+	NodeTypeFile NodeType = "file"
+	// NodeTypeHelper is a named template, defined with define or block
+	NodeTypeHelper NodeType = "helper"
+	// NodeTypeValue is a values key, by dotted path
+	NodeTypeValue NodeType = "value"
+)
+
+// EdgeType is how the nodes of an edge are related
+type EdgeType string
+
+const (
+	// EdgeTypeUses is a file or helper that includes a helper or references a values key
+	EdgeTypeUses EdgeType = "uses"
+	// EdgeTypeDefines is a file that defines a helper
+	EdgeTypeDefines EdgeType = "defines"
+)
+
+// TemplateGraph is which templates include which helpers and which values keys the templates and
+// helpers reference, found by parsing the templates without rendering them. Nodes and edges are
+// sorted so that the same chart always has the same graph.
+type TemplateGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a file, helper or values key. IDs are the type and the name, such as
+// "file:templates/deployment.yaml", "helper:mychart.labels" and "value:image.tag".
+type GraphNode struct {
+	ID    string   `json:"id"`
+	Type  NodeType `json:"type"`
+	Label string   `json:"label"`
+	// FilePath is the path of a file, or the file a helper is defined in. It's empty for a helper
+	// that isn't defined in the chart's templates, such as one of a library chart.
+	FilePath string `json:"filePath,omitempty"`
+}
+
+// GraphEdge goes from the node that uses or defines to the node that's used or defined
+type GraphEdge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Type EdgeType `json:"type"`
+}
+
+func fileNodeID(filePath string) string { return "file:" + filePath }
+func helperNodeID(name string) string   { return "helper:" + name }
+func valueNodeID(path string) string    { return "value:" + path }
+
+// templateSection is the actions of a file that belong to the file itself, or to one helper it
+// defines
+type templateSection struct {
+	helper  string
+	actions strings.Builder
+}
+
+// BuildTemplateGraph returns the graph of the files under templates/ of a chart. References
+// inside a define belong to the helper, everything else belongs to the file. Helpers and values
+// paths that can't be resolved statically, such as include $name, aren't in the graph.
+func BuildTemplateGraph(files []types.File) *TemplateGraph {
+	nodes := map[string]GraphNode{}
+	edges := map[GraphEdge]bool{}
+	addNode := func(node GraphNode) {
+		if existing, ok := nodes[node.ID]; ok && existing.FilePath != "" {
+			return
+		}
+		nodes[node.ID] = node
+	}
+
+	for _, file := range files {
+		if !strings.HasPrefix(file.FilePath, "templates/") {
+			continue
+		}
+		fileID := fileNodeID(file.FilePath)
+		addNode(GraphNode{ID: fileID, Type: NodeTypeFile, Label: file.FilePath, FilePath: file.FilePath})
+
+		for _, section := range splitTemplateSections(file.Content) {
+			from := fileID
+			if section.helper != "" {
+				from = helperNodeID(section.helper)
+				addNode(GraphNode{ID: from, Type: NodeTypeHelper, Label: section.helper, FilePath: file.FilePath})
+				edges[GraphEdge{From: fileID, To: from, Type: EdgeTypeDefines}] = true
+			}
+
+			content := section.actions.String()
+			for _, m := range includeActionRegex.FindAllStringSubmatch(content, -1) {
+				to := helperNodeID(m[1])
+				addNode(GraphNode{ID: to, Type: NodeTypeHelper, Label: m[1]})
+				edges[GraphEdge{From: from, To: to, Type: EdgeTypeUses}] = true
+			}
+
+			references, scoped, _ := FindValuesReferences(types.File{FilePath: file.FilePath, Content: content})
+			for _, ref := range append(references, scoped...) {
+				if ref.Path == "" {
+					continue
+				}
+				to := valueNodeID(ref.Path)
+				addNode(GraphNode{ID: to, Type: NodeTypeValue, Label: ref.Path})
+				edges[GraphEdge{From: from, To: to, Type: EdgeTypeUses}] = true
+			}
+		}
+	}
+
+	graph := &TemplateGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		return graph.Nodes[i].ID < graph.Nodes[j].ID
+	})
+	for edge := range edges {
+		graph.Edges = append(graph.Edges, edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Type < b.Type
+	})
+	return graph
+}
+
+// splitTemplateSections splits the actions of a template into the file's own and those of each
+// define, so that the values a helper references are attributed to the helper. The actions that
+// open and close a define aren't in either. A block both defines a helper and uses it in place.
+func splitTemplateSections(content string) []*templateSection {
+	fileSection := &templateSection{}
+	sections := []*templateSection{fileSection}
+
+	// every open block, with the section its actions belong to, so that "end" closes the right one
+	type openBlock struct {
+		section *templateSection
+		defines bool
+	}
+	blocks := []openBlock{}
+	current := func() *templateSection {
+		if len(blocks) == 0 {
+			return fileSection
+		}
+		return blocks[len(blocks)-1].section
+	}
+
+	for _, match := range templateActionRegex.FindAllStringSubmatch(content, -1) {
+		action := strings.TrimSpace(match[1])
+		if action == "" || strings.HasPrefix(action, "/*") {
+			continue
+		}
+		keyword := strings.Fields(action)[0]
+
+		if m := defineActionRegex.FindStringSubmatch(action); m != nil {
+			if m[1] == "block" {
+				current().actions.WriteString(`{{ include "` + m[2] + `" }}` + "\n")
+			}
+			section := &templateSection{helper: m[2]}
+			sections = append(sections, section)
+			blocks = append(blocks, openBlock{section: section, defines: true})
+			continue
+		}
+
+		if keyword == "end" && len(blocks) > 0 && blocks[len(blocks)-1].defines {
+			blocks = blocks[:len(blocks)-1]
+			continue
+		}
+
+		section := current()
+		section.actions.WriteString(match[0])
+		section.actions.WriteString("\n")
+
+		switch keyword {
+		case "if", "with", "range":
+			blocks = append(blocks, openBlock{section: section})
+		case "end":
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+	}
+
+	return sections
+}
+
+// FilesUsingValues returns the paths of the files that use any of the values keys, directly or
+// through the helpers they include or define, sorted. A key is used by references to it, to a key
+// under it, or to a key above it, since those pass it along.
+func (g *TemplateGraph) FilesUsingValues(keys []string) []string {
+	if len(keys) == 0 {
+		return []string{}
+	}
+
+	uses := map[string][]string{}
+	for _, edge := range g.Edges {
+		uses[edge.From] = append(uses[edge.From], edge.To)
+	}
+
+	touched := map[string]bool{}
+	for _, node := range g.Nodes {
+		if node.Type != NodeTypeValue {
+			continue
+		}
+		for _, key := range keys {
+			if valuesPathsRelated(key, node.Label) {
+				touched[node.ID] = true
+			}
+		}
+	}
+
+	paths := []string{}
+	for _, node := range g.Nodes {
+		if node.Type != NodeTypeFile {
+			continue
+		}
+		visited := map[string]bool{}
+		stack := []string{node.ID}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			if touched[id] {
+				paths = append(paths, node.FilePath)
+				break
+			}
+			stack = append(stack, uses[id]...)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func valuesPathsRelated(a string, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
@@ -0,0 +1,170 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// graphFixtureChart has helpers that are used across three templates, and helpers that use other
+// helpers and values
+var graphFixtureChart = []types.File{
+	{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: mychart\nversion: 0.1.0\n"},
+	{FilePath: "values.yaml", Content: "replicaCount: 1\nimage:\n  repository: nginx\n  tag: latest\nservice:\n  port: 80\ningress:\n  enabled: false\n  hosts: []\nnameOverride: \"\"\n"},
+	{FilePath: "templates/_helpers.tpl", Content: `{{/* the name of the chart */}}
+{{- define "mychart.name" -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" }}
+{{- end }}
+
+{{- define "mychart.fullname" -}}
+{{- printf "%s-%s" .Release.Name (include "mychart.name" .) | trunc 63 }}
+{{- end }}
+
+{{- define "mychart.labels" -}}
+app.kubernetes.io/name: {{ include "mychart.name" . }}
+{{- if .Values.commonLabels }}
+{{ toYaml .Values.commonLabels }}
+{{- end }}
+{{- end }}
+`},
+	{FilePath: "templates/deployment.yaml", Content: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "mychart.fullname" . }}
+  labels:
+    {{- include "mychart.labels" . | nindent 4 }}
+spec:
+  replicas: {{ .Values.replicaCount }}
+  template:
+    spec:
+      containers:
+        - image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+`},
+	{FilePath: "templates/service.yaml", Content: `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ include "mychart.fullname" . }}
+  labels:
+    {{- include "mychart.labels" . | nindent 4 }}
+spec:
+  ports:
+    - port: {{ .Values.service.port }}
+`},
+	{FilePath: "templates/ingress.yaml", Content: `{{- if .Values.ingress.enabled }}
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: {{ include "mychart.fullname" . }}
+  labels:
+    {{- template "mychart.labels" . }}
+spec:
+  rules:
+  {{- with .Values.ingress }}
+  {{- range .hosts }}
+    - host: {{ .host }}
+  {{- end }}
+  {{- end }}
+          backend:
+            service:
+              port:
+                number: {{ $.Values.service.port }}
+{{- end }}
+`},
+}
+
+func TestBuildTemplateGraph(t *testing.T) {
+	graph := BuildTemplateGraph(graphFixtureChart)
+
+	assert.Equal(t, []GraphNode{
+		{ID: "file:templates/_helpers.tpl", Type: NodeTypeFile, Label: "templates/_helpers.tpl", FilePath: "templates/_helpers.tpl"},
+		{ID: "file:templates/deployment.yaml", Type: NodeTypeFile, Label: "templates/deployment.yaml", FilePath: "templates/deployment.yaml"},
+		{ID: "file:templates/ingress.yaml", Type: NodeTypeFile, Label: "templates/ingress.yaml", FilePath: "templates/ingress.yaml"},
+		{ID: "file:templates/service.yaml", Type: NodeTypeFile, Label: "templates/service.yaml", FilePath: "templates/service.yaml"},
+		{ID: "helper:mychart.fullname", Type: NodeTypeHelper, Label: "mychart.fullname", FilePath: "templates/_helpers.tpl"},
+		{ID: "helper:mychart.labels", Type: NodeTypeHelper, Label: "mychart.labels", FilePath: "templates/_helpers.tpl"},
+		{ID: "helper:mychart.name", Type: NodeTypeHelper, Label: "mychart.name", FilePath: "templates/_helpers.tpl"},
+		{ID: "value:commonLabels", Type: NodeTypeValue, Label: "commonLabels"},
+		{ID: "value:image.repository", Type: NodeTypeValue, Label: "image.repository"},
+		{ID: "value:image.tag", Type: NodeTypeValue, Label: "image.tag"},
+		{ID: "value:ingress", Type: NodeTypeValue, Label: "ingress"},
+		{ID: "value:ingress.enabled", Type: NodeTypeValue, Label: "ingress.enabled"},
+		{ID: "value:ingress.hosts", Type: NodeTypeValue, Label: "ingress.hosts"},
+		{ID: "value:nameOverride", Type: NodeTypeValue, Label: "nameOverride"},
+		{ID: "value:replicaCount", Type: NodeTypeValue, Label: "replicaCount"},
+		{ID: "value:service.port", Type: NodeTypeValue, Label: "service.port"},
+	}, graph.Nodes)
+
+	assert.Equal(t, []GraphEdge{
+		{From: "file:templates/_helpers.tpl", To: "helper:mychart.fullname", Type: EdgeTypeDefines},
+		{From: "file:templates/_helpers.tpl", To: "helper:mychart.labels", Type: EdgeTypeDefines},
+		{From: "file:templates/_helpers.tpl", To: "helper:mychart.name", Type: EdgeTypeDefines},
+		{From: "file:templates/deployment.yaml", To: "helper:mychart.fullname", Type: EdgeTypeUses},
+		{From: "file:templates/deployment.yaml", To: "helper:mychart.labels", Type: EdgeTypeUses},
+		{From: "file:templates/deployment.yaml", To: "value:image.repository", Type: EdgeTypeUses},
+		{From: "file:templates/deployment.yaml", To: "value:image.tag", Type: EdgeTypeUses},
+		{From: "file:templates/deployment.yaml", To: "value:replicaCount", Type: EdgeTypeUses},
+		{From: "file:templates/ingress.yaml", To: "helper:mychart.fullname", Type: EdgeTypeUses},
+		{From: "file:templates/ingress.yaml", To: "helper:mychart.labels", Type: EdgeTypeUses},
+		{From: "file:templates/ingress.yaml", To: "value:ingress", Type: EdgeTypeUses},
+		{From: "file:templates/ingress.yaml", To: "value:ingress.enabled", Type: EdgeTypeUses},
+		{From: "file:templates/ingress.yaml", To: "value:ingress.hosts", Type: EdgeTypeUses},
+		{From: "file:templates/ingress.yaml", To: "value:service.port", Type: EdgeTypeUses},
+		{From: "file:templates/service.yaml", To: "helper:mychart.fullname", Type: EdgeTypeUses},
+		{From: "file:templates/service.yaml", To: "helper:mychart.labels", Type: EdgeTypeUses},
+		{From: "file:templates/service.yaml", To: "value:service.port", Type: EdgeTypeUses},
+		{From: "helper:mychart.fullname", To: "helper:mychart.name", Type: EdgeTypeUses},
+		{From: "helper:mychart.labels", To: "helper:mychart.name", Type: EdgeTypeUses},
+		{From: "helper:mychart.labels", To: "value:commonLabels", Type: EdgeTypeUses},
+		{From: "helper:mychart.name", To: "value:nameOverride", Type: EdgeTypeUses},
+	}, graph.Edges)
+}
+
+func TestBuildTemplateGraphHelpers(t *testing.T) {
+	graph := BuildTemplateGraph([]types.File{
+		{FilePath: "templates/configmap.yaml", Content: `{{- block "mychart.data" . }}
+data: {{ .Values.data | toYaml }}
+{{- end }}
+{{ include "common.labels" . }}
+{{ include $name . }}
+{{ toYaml .Values }}
+`},
+		{FilePath: "README.md", Content: `{{ include "mychart.readme" . }}`},
+	})
+
+	assert.Contains(t, graph.Edges, GraphEdge{From: "file:templates/configmap.yaml", To: "helper:mychart.data", Type: EdgeTypeDefines}, "a block defines a helper")
+	assert.Contains(t, graph.Edges, GraphEdge{From: "file:templates/configmap.yaml", To: "helper:mychart.data", Type: EdgeTypeUses}, "and uses it in place")
+	assert.Contains(t, graph.Edges, GraphEdge{From: "helper:mychart.data", To: "value:data", Type: EdgeTypeUses})
+	assert.Contains(t, graph.Nodes, GraphNode{ID: "helper:common.labels", Type: NodeTypeHelper, Label: "common.labels"}, "a helper of a library chart has no file")
+	for _, node := range graph.Nodes {
+		assert.NotEqual(t, "helper:mychart.readme", node.ID, "only templates are parsed")
+		assert.NotEqual(t, "value:", node.ID, "the whole values can't be resolved to a key")
+	}
+}
+
+func TestFilesUsingValues(t *testing.T) {
+	graph := BuildTemplateGraph(graphFixtureChart)
+
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{name: "no keys", want: []string{}},
+		{name: "a key one template references", keys: []string{"image.tag"}, want: []string{"templates/deployment.yaml"}},
+		{name: "a parent of referenced keys", keys: []string{"image"}, want: []string{"templates/deployment.yaml"}},
+		{name: "a key under a referenced key", keys: []string{"ingress.hosts.0.host"}, want: []string{"templates/ingress.yaml"}},
+		{name: "a key used by two templates", keys: []string{"service.port"}, want: []string{"templates/ingress.yaml", "templates/service.yaml"}},
+		{
+			name: "a key used through helpers",
+			keys: []string{"nameOverride"},
+			want: []string{"templates/_helpers.tpl", "templates/deployment.yaml", "templates/ingress.yaml", "templates/service.yaml"},
+		},
+		{name: "a key nothing references", keys: []string{"tolerations"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, graph.FilesUsingValues(tt.keys))
+		})
+	}
+}
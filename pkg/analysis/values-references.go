@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var (
+	templateActionRegex     = regexp.MustCompile(`(?s)\{\{-?(.*?)-?\}\}`)
+	valuesIndexRegex        = regexp.MustCompile(`\bindex\s+\$?\.Values((?:\.\w+)*)((?:\s+[^\s|)]+)*)`)
+	valuesReferenceRegex    = regexp.MustCompile(`(^|[^\w$])(?:\$\w*)?\.Values((?:\.\w+)*)`)
+	relativeReferenceRegex  = regexp.MustCompile(`(^|[\s(|,])\.(\w+(?:\.\w+)*)`)
+	dotReferenceRegex       = regexp.MustCompile(`(^|[\s(|,])\.($|[\s)|,])`)
+	quotedStringRegex       = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|` + "`[^`]*`")
+	scopedValuesActionRegex = regexp.MustCompile(`^with\s+(\$?\.Values(?:\.\w+)*|\.\w+(?:\.\w+)*)\s*$`)
+)
+
+// FindValuesReferences returns the values paths a template references, the values paths it
+// scopes with blocks to, and the references that can't be resolved statically
+func FindValuesReferences(file types.File) ([]types.ValuesReference, []types.ValuesReference, []types.ValuesReference) {
+	var references, scoped, unknown []types.ValuesReference
+	addReference := func(path string) {
+		references = append(references, types.ValuesReference{Path: path, FilePath: file.FilePath})
+	}
+	addUnknown := func(path string) {
+		unknown = append(unknown, types.ValuesReference{Path: path, FilePath: file.FilePath})
+	}
+
+	// every block pushes the scope of "." inside it, nil when "." isn't known to be a values key,
+	// so that "end" pops the right one
+	scopes := []*string{nil}
+
+	for _, match := range templateActionRegex.FindAllStringSubmatch(file.Content, -1) {
+		action := strings.TrimSpace(match[1])
+		if action == "" || strings.HasPrefix(action, "/*") {
+			continue
+		}
+
+		current := scopes[len(scopes)-1]
+		keyword := strings.Fields(action)[0]
+
+		if keyword == "with" {
+			if scope := withValuesScope(action, current); scope != nil {
+				if *scope == "" {
+					addUnknown("")
+				} else {
+					scoped = append(scoped, types.ValuesReference{Path: *scope, FilePath: file.FilePath})
+				}
+				scopes = append(scopes, scope)
+				continue
+			}
+		}
+
+		// index with literal keys is a static reference, anything else is dynamic
+		action = valuesIndexRegex.ReplaceAllStringFunc(action, func(s string) string {
+			m := valuesIndexRegex.FindStringSubmatch(s)
+			path := strings.TrimPrefix(m[1], ".")
+			for _, arg := range strings.Fields(m[2]) {
+				if !strings.HasPrefix(arg, `"`) || !strings.HasSuffix(arg, `"`) || len(arg) < 2 {
+					addUnknown(path)
+					return ""
+				}
+				path = joinValuesPath(path, strings.Trim(arg, `"`))
+			}
+			addReference(path)
+			return ""
+		})
+
+		action = quotedStringRegex.ReplaceAllString(action, `""`)
+
+		for _, m := range valuesReferenceRegex.FindAllStringSubmatch(action, -1) {
+			path := strings.TrimPrefix(m[2], ".")
+			if path == "" {
+				// the whole values tree is passed somewhere, e.g. toYaml .Values
+				addUnknown(path)
+				continue
+			}
+			addReference(path)
+		}
+
+		if current != nil {
+			for _, m := range relativeReferenceRegex.FindAllStringSubmatch(action, -1) {
+				if strings.HasPrefix(m[2], "Values") {
+					continue
+				}
+				addReference(joinValuesPath(*current, m[2]))
+			}
+			if dotReferenceRegex.MatchString(action) {
+				addReference(*current)
+			}
+		}
+
+		switch keyword {
+		case "end":
+			if len(scopes) > 1 {
+				scopes = scopes[:len(scopes)-1]
+			}
+		case "if":
+			scopes = append(scopes, current)
+		case "with":
+			scopes = append(scopes, withValuesScope(action, current))
+		case "range", "define", "block":
+			scopes = append(scopes, nil)
+		}
+	}
+
+	return references, scoped, unknown
+}
+
+// withValuesScope returns the values path that a with action sets ".", if it's a values path
+func withValuesScope(action string, current *string) *string {
+	m := scopedValuesActionRegex.FindStringSubmatch(action)
+	if m == nil {
+		return nil
+	}
+
+	expr := strings.TrimPrefix(m[1], "$")
+	if strings.HasPrefix(expr, ".Values") {
+		path := strings.TrimPrefix(strings.TrimPrefix(expr, ".Values"), ".")
+		return &path
+	}
+	if current == nil {
+		return nil
+	}
+
+	path := joinValuesPath(*current, strings.TrimPrefix(expr, "."))
+	return &path
+}
+
+func joinValuesPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if key == "" {
+		return prefix
+	}
+	return prefix + "." + key
+}
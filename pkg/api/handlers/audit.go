@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	listAuditEvents = workspace.ListAuditEvents
+	auditEvent      = workspace.Audit
+)
+
+// AuditLogResponse is the response to GET /api/workspace/{id}/audit
+type AuditLogResponse struct {
+	// Events are oldest first
+	Events []workspacetypes.AuditEvent `json:"events"`
+	// NextCursor is passed as after to get the next page, it's empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// AuditLog responds with a page of the audit events of a workspace. eventType filters by a comma
+// separated list of event types, after is the nextCursor of the previous page, and limit is the
+// page size.
+func AuditLog(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+	query := r.URL.Query()
+
+	filter := workspace.AuditFilter{After: query.Get("after")}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > workspace.MaxAuditPageSize {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("limit must be a number from 1 to %d", workspace.MaxAuditPageSize)})
+			return
+		}
+		filter.Limit = n
+	}
+	for _, eventType := range strings.Split(query.Get("eventType"), ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			filter.EventTypes = append(filter.EventTypes, eventType)
+		}
+	}
+
+	events, nextCursor, err := listAuditEvents(r.Context(), workspaceID, filter)
+	if err != nil {
+		if errors.Is(err, workspace.ErrInvalidAuditCursor) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list audit events: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list audit events"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AuditLogResponse{Events: events, NextCursor: nextCursor})
+}
+
+// recordAudit records an audit event of a workspace, a failure is only logged since the request
+// it's recording already succeeded
+func recordAudit(ctx context.Context, workspaceID string, actor string, eventType string, payload map[string]interface{}) {
+	if err := auditEvent(ctx, workspaceID, actor, eventType, payload); err != nil {
+		logger.WarnCtx(ctx, "Failed to record audit event", zap.String("workspaceID", workspaceID), zap.String("eventType", eventType), zap.Error(err))
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubAudit records the types of the audit events handlers record
+func stubAudit(t *testing.T) *[]string {
+	recorded := []string{}
+	original := auditEvent
+	auditEvent = func(ctx context.Context, workspaceID string, actor string, eventType string, payload map[string]interface{}) error {
+		recorded = append(recorded, eventType)
+		return nil
+	}
+	t.Cleanup(func() { auditEvent = original })
+	return &recorded
+}
+
+func TestAuditLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		err        error
+		wantFilter workspace.AuditFilter
+		want       int
+		wantBody   string
+	}{
+		{
+			name:     "first page",
+			url:      "/api/workspace/ws/audit",
+			want:     http.StatusOK,
+			wantBody: `"events":[{"id":"event","workspaceId":"ws"`,
+		},
+		{
+			name:       "filtered page",
+			url:        "/api/workspace/ws/audit?eventType=render_started,%20render_failed&after=cursor&limit=20",
+			wantFilter: workspace.AuditFilter{EventTypes: []string{"render_started", "render_failed"}, After: "cursor", Limit: 20},
+			want:       http.StatusOK,
+			wantBody:   `"nextCursor":"next"`,
+		},
+		{name: "limit too large", url: "/api/workspace/ws/audit?limit=5000", want: http.StatusBadRequest, wantBody: "limit must be a number"},
+		{name: "bad cursor", url: "/api/workspace/ws/audit?after=garbage", wantFilter: workspace.AuditFilter{After: "garbage"}, err: workspace.ErrInvalidAuditCursor, want: http.StatusBadRequest, wantBody: "invalid audit cursor"},
+		{name: "database error", url: "/api/workspace/ws/audit", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to list audit events"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := listAuditEvents
+			t.Cleanup(func() { listAuditEvents = original })
+
+			listAuditEvents = func(ctx context.Context, workspaceID string, filter workspace.AuditFilter) ([]workspacetypes.AuditEvent, string, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, tt.wantFilter, filter)
+				if tt.err != nil {
+					return nil, "", tt.err
+				}
+				next := ""
+				if filter.After != "" {
+					next = "next"
+				}
+				return []workspacetypes.AuditEvent{{ID: "event", WorkspaceID: workspaceID, Actor: workspace.AuditActorSystem, EventType: workspace.AuditRenderStarted}}, next, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			AuditLog(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
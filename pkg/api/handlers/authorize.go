@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// UserIDHeader names the user a request to the internal API is made for. A request that changes a
+// workspace is refused when the user's role in it doesn't allow the change. Requests without it
+// are made by chartsmith itself and aren't checked.
+const UserIDHeader = "X-Chartsmith-User-ID"
+
+// these are vars so that the handlers can be tested without a database
+var (
+	getWorkspaceRole = workspace.GetWorkspaceRole
+	isAdminUser      = workspace.IsAdminUser
+)
+
+// requestUserID returns the user a request is made for, empty when it's made by chartsmith
+func requestUserID(r *http.Request) string {
+	return r.Header.Get(UserIDHeader)
+}
+
+// refuseRole responds with 403 and returns true when the role of userID in the workspace doesn't
+// allow what required does. An empty userID is chartsmith itself, which is never refused.
+func refuseRole(w http.ResponseWriter, ctx context.Context, workspaceID string, userID string, required workspacetypes.WorkspaceRole) bool {
+	if userID == "" {
+		return false
+	}
+
+	role, err := getWorkspaceRole(ctx, workspaceID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrWorkspaceNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "workspace not found"})
+		case errors.Is(err, workspace.ErrNotWorkspaceMember):
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(ctx, fmt.Errorf("failed to get workspace role: %w", err), zap.String("workspaceID", workspaceID), zap.String("userID", userID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to check workspace role"})
+		}
+		return true
+	}
+
+	if !workspace.RoleAllows(role, required) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: fmt.Sprintf("requires the %s role, user is a %s", required, role)})
+		return true
+	}
+	return false
+}
+
+// refuseNonAdmin responds with 403 and returns true when the user a request is made for isn't a
+// chartsmith admin. Requests made by chartsmith are never refused.
+func refuseNonAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID := requestUserID(r)
+	if userID == "" {
+		return false
+	}
+
+	isAdmin, err := isAdminUser(r.Context(), userID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to check if user is an admin: %w", err), zap.String("userID", userID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to check if user is an admin"})
+		return true
+	}
+	if !isAdmin {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: "requires an admin"})
+		return true
+	}
+	return false
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/recommendations"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubWorkspaceRole gives the users in roles their role in every workspace, other users aren't
+// members
+func stubWorkspaceRole(t *testing.T, roles map[string]workspacetypes.WorkspaceRole) {
+	t.Helper()
+	original := getWorkspaceRole
+	t.Cleanup(func() { getWorkspaceRole = original })
+
+	getWorkspaceRole = func(ctx context.Context, workspaceID string, userID string) (workspacetypes.WorkspaceRole, error) {
+		role, ok := roles[userID]
+		if !ok {
+			return "", workspace.ErrNotWorkspaceMember
+		}
+		return role, nil
+	}
+}
+
+// errReached is returned by the stubbed handler dependencies, so that a request that passes the
+// role check stops right after it
+var errReached = errors.New("reached")
+
+func TestRoleChecks(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{
+		"owner":  workspacetypes.WorkspaceRoleOwner,
+		"editor": workspacetypes.WorkspaceRoleEditor,
+		"viewer": workspacetypes.WorkspaceRoleViewer,
+	}
+
+	endpoints := []struct {
+		category string
+		required workspacetypes.WorkspaceRole
+		// request is made by userID, stub sets reached when the handler gets past the role check
+		request func(userID string) *http.Request
+		handler http.HandlerFunc
+		stub    func(reached *bool)
+	}{
+		{
+			category: "plan",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/plan/plan/proceed", nil)
+				req.SetPathValue("planID", "plan")
+				return withUser(req, userID)
+			},
+			handler: ProceedPlan,
+			stub: func(reached *bool) {
+				proceedReviewedPlan = func(ctx context.Context, workspaceID string, planID string) (*workspacetypes.Plan, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "chat message",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				// the user posting a message is named in its body
+				body, _ := json.Marshal(CreateChatMessageRequest{UserID: userID, Prompt: "add redis"})
+				return withUser(httptest.NewRequest(http.MethodPost, "/api/workspace/ws/messages", strings.NewReader(string(body))), "")
+			},
+			handler: CreateChatMessage,
+			stub: func(reached *bool) {
+				createChatMessage = func(ctx context.Context, workspaceID string, userID string, prompt string, a []workspacetypes.ChatAttachment) (*workspacetypes.Chat, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "file",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/revision/1/patches/file/accept", strings.NewReader(`{}`))
+				req.SetPathValue("revision", "1")
+				req.SetPathValue("fileID", "file")
+				return withUser(req, userID)
+			},
+			handler: AcceptPatch,
+			stub: func(reached *bool) {
+				acceptPatch = func(ctx context.Context, workspaceID string, revisionNumber int, fileID string, expectedVersion *int) (*workspacetypes.File, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "settings",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodPatch, "/api/workspace/ws/settings", strings.NewReader(`{"settings": {"autoRender": true}}`)), userID)
+			},
+			handler: UpdateWorkspaceSettings,
+			stub: func(reached *bool) {
+				setWorkspaceSettings = func(ctx context.Context, workspaceID string, values map[string]json.RawMessage) error {
+					*reached = true
+					return errReached
+				}
+			},
+		},
+		{
+			category: "archive",
+			required: workspacetypes.WorkspaceRoleOwner,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodPost, "/api/workspace/ws/archive", nil), userID)
+			},
+			handler: ArchiveWorkspace,
+			stub: func(reached *bool) {
+				archiveWorkspace = func(ctx context.Context, workspaceID string) (time.Time, error) {
+					*reached = true
+					return time.Time{}, errReached
+				}
+			},
+		},
+		{
+			category: "members",
+			required: workspacetypes.WorkspaceRoleOwner,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodPut, "/api/workspace/ws/members/new", strings.NewReader(`{"role": "viewer"}`))
+				req.SetPathValue("userID", "new")
+				return withUser(req, userID)
+			},
+			handler: SetWorkspaceMember,
+			stub: func(reached *bool) {
+				addWorkspaceMember = func(ctx context.Context, workspaceID string, userID string, role workspacetypes.WorkspaceRole) (*workspacetypes.WorkspaceMember, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "render",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodPost, "/internal/render", strings.NewReader(`{"workspaceId":"ws","revisionNumber":1}`)), userID)
+			},
+			handler: Render,
+			stub: func(reached *bool) {
+				workspaceArchived = func(ctx context.Context, workspaceID string) (bool, error) {
+					*reached = true
+					return false, errReached
+				}
+			},
+		},
+		{
+			category: "execute plan",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodPost, "/internal/plan/execute", strings.NewReader(`{"planId":"plan"}`)), userID)
+			},
+			handler: ExecutePlan,
+			stub: func(reached *bool) {
+				getExecutedPlan = func(ctx context.Context, planID string) (*workspacetypes.Plan, error) {
+					return &workspacetypes.Plan{ID: planID, WorkspaceID: "ws"}, nil
+				}
+				checkExecutionLock = func(ctx context.Context, planID string) error {
+					*reached = true
+					return errReached
+				}
+			},
+		},
+		{
+			category: "cluster dry run",
+			required: workspacetypes.WorkspaceRoleEditor,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/render/render/cluster-dry-run", strings.NewReader(`{"kubeconfig": "apiVersion: v1"}`))
+				req.SetPathValue("renderID", "render")
+				return withUser(req, userID)
+			},
+			handler: ClusterDryRun,
+			stub: func(reached *bool) {
+				clusterDryRunEnabled = func() bool {
+					*reached = true
+					return false
+				}
+			},
+		},
+		{
+			category: "audit log",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodGet, "/api/workspace/ws/audit", nil), userID)
+			},
+			handler: AuditLog,
+			stub: func(reached *bool) {
+				listAuditEvents = func(ctx context.Context, workspaceID string, filter workspace.AuditFilter) ([]workspacetypes.AuditEvent, string, error) {
+					*reached = true
+					return nil, "", errReached
+				}
+			},
+		},
+		{
+			category: "export",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/export", nil)
+				req.SetPathValue("chartID", "chart")
+				return withUser(req, userID)
+			},
+			handler: ExportChart,
+			stub: func(reached *bool) {
+				exportWorkspaceChart = func(ctx context.Context, workspaceID string, chartID string, restoreLineEndings bool) (*workspace.ChartArchive, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "file history",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodGet, "/api/workspace/ws/files/history?path=values.yaml", nil), userID)
+			},
+			handler: FileHistory,
+			stub: func(reached *bool) {
+				getFileHistory = func(ctx context.Context, workspaceID string, filePath string) ([]workspacetypes.FileHistoryEntry, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "dependency status",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/dependencies", nil)
+				req.SetPathValue("chartID", "chart")
+				return withUser(req, userID)
+			},
+			handler: DependencyStatus,
+			stub: func(reached *bool) {
+				getChartDependencyStatus = func(ctx context.Context, workspaceID string, chartID string) (*recommendations.DependencyReport, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "chart manifest",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/manifest", nil)
+				req.SetPathValue("chartID", "chart")
+				return withUser(req, userID)
+			},
+			handler: GetChartManifest,
+			stub: func(reached *bool) {
+				loadChartManifest = func(ctx context.Context, workspaceID string, chartID string) (*workspace.ChartManifest, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "list patches",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/revision/1/patches", nil)
+				req.SetPathValue("revision", "1")
+				return withUser(req, userID)
+			},
+			handler: ListPendingPatches,
+			stub: func(reached *bool) {
+				listPendingPatches = func(ctx context.Context, workspaceID string, revisionNumber int) ([]workspacetypes.PendingPatch, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "preview patch",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/revision/1/patches/file", nil)
+				req.SetPathValue("revision", "1")
+				req.SetPathValue("fileID", "file")
+				return withUser(req, userID)
+			},
+			handler: PreviewPatch,
+			stub: func(reached *bool) {
+				getPatchPreview = func(ctx context.Context, workspaceID string, revisionNumber int, fileID string) (*workspacetypes.PatchPreview, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "list values profiles",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/values-profiles", nil)
+				req.SetPathValue("chartID", "chart")
+				return withUser(req, userID)
+			},
+			handler: ListValuesProfiles,
+			stub: func(reached *bool) {
+				listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "values profile",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/values-profiles/prod", nil)
+				req.SetPathValue("chartID", "chart")
+				req.SetPathValue("name", "prod")
+				return withUser(req, userID)
+			},
+			handler: GetValuesProfile,
+			stub: func(reached *bool) {
+				getValuesProfile = func(ctx context.Context, workspaceID string, chartID string, name string) (*workspacetypes.ValuesProfile, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "read settings",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodGet, "/api/workspace/ws/settings", nil), userID)
+			},
+			handler: GetWorkspaceSettings,
+			stub: func(reached *bool) {
+				getWorkspaceSettings = func(ctx context.Context, workspaceID string) (map[string]any, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+		{
+			category: "run unit tests",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/chart/chart/unit-tests/run", nil)
+				req.SetPathValue("chartID", "chart")
+				return withUser(req, userID)
+			},
+			handler: RunUnitTests,
+			stub: func(reached *bool) {
+				unitTestsEnabled = func() bool {
+					*reached = true
+					return false
+				}
+			},
+		},
+		{
+			category: "list members",
+			required: workspacetypes.WorkspaceRoleViewer,
+			request: func(userID string) *http.Request {
+				return withUser(httptest.NewRequest(http.MethodGet, "/api/workspace/ws/members", nil), userID)
+			},
+			handler: ListWorkspaceMembers,
+			stub: func(reached *bool) {
+				listWorkspaceMembers = func(ctx context.Context, workspaceID string) ([]workspacetypes.WorkspaceMember, error) {
+					*reached = true
+					return nil, errReached
+				}
+			},
+		},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, userID := range []string{"owner", "editor", "viewer", "outsider"} {
+			t.Run(endpoint.category+"/"+userID, func(t *testing.T) {
+				stubWorkspaceRole(t, roles)
+				stubAudit(t)
+				restore := saveHandlerDeps()
+				t.Cleanup(restore)
+
+				reached := false
+				endpoint.stub(&reached)
+
+				req := endpoint.request(userID)
+				req.SetPathValue("id", "ws")
+				rec := httptest.NewRecorder()
+				endpoint.handler(rec, req)
+
+				allowed := userID != "outsider" && workspace.RoleAllows(roles[userID], endpoint.required)
+				assert.Equal(t, allowed, reached)
+				if !allowed {
+					assert.Equal(t, http.StatusForbidden, rec.Code)
+				}
+			})
+		}
+	}
+}
+
+func withUser(req *http.Request, userID string) *http.Request {
+	if userID != "" {
+		req.Header.Set(UserIDHeader, userID)
+	}
+	return req
+}
+
+// saveHandlerDeps saves the handler dependencies TestRoleChecks stubs and returns a func that
+// restores them
+func saveHandlerDeps() func() {
+	proceed, create, accept, setSettings, archive, add, list := proceedReviewedPlan, createChatMessage, acceptPatch, setWorkspaceSettings, archiveWorkspace, addWorkspaceMember, listWorkspaceMembers
+	archived, executed, lock, dryRunEnabled := workspaceArchived, getExecutedPlan, checkExecutionLock, clusterDryRunEnabled
+	audit, export, history, dependencies := listAuditEvents, exportWorkspaceChart, getFileHistory, getChartDependencyStatus
+	manifest, patches, preview, profiles, profile, settings, unitTests := loadChartManifest, listPendingPatches, getPatchPreview, listValuesProfiles, getValuesProfile, getWorkspaceSettings, unitTestsEnabled
+	return func() {
+		proceedReviewedPlan, createChatMessage, acceptPatch, setWorkspaceSettings, archiveWorkspace, addWorkspaceMember, listWorkspaceMembers = proceed, create, accept, setSettings, archive, add, list
+		workspaceArchived, getExecutedPlan, checkExecutionLock, clusterDryRunEnabled = archived, executed, lock, dryRunEnabled
+		listAuditEvents, exportWorkspaceChart, getFileHistory, getChartDependencyStatus = audit, export, history, dependencies
+		loadChartManifest, listPendingPatches, getPatchPreview, listValuesProfiles, getValuesProfile, getWorkspaceSettings, unitTestsEnabled = manifest, patches, preview, profiles, profile, settings, unitTests
+	}
+}
+
+func TestRefuseRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "made by chartsmith", userID: "", want: http.StatusOK},
+		{name: "member", userID: "editor", want: http.StatusOK},
+		{name: "unknown workspace", userID: "editor", err: workspace.ErrWorkspaceNotFound, want: http.StatusNotFound, wantBody: "workspace not found"},
+		{name: "database error", userID: "editor", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to check workspace role"},
+		{name: "role too low", userID: "viewer", want: http.StatusForbidden, wantBody: "requires the editor role, user is a viewer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := getWorkspaceRole
+			t.Cleanup(func() { getWorkspaceRole = original })
+			getWorkspaceRole = func(ctx context.Context, workspaceID string, userID string) (workspacetypes.WorkspaceRole, error) {
+				if tt.err != nil {
+					return "", tt.err
+				}
+				return workspacetypes.WorkspaceRole(userID), nil
+			}
+
+			rec := httptest.NewRecorder()
+			refused := refuseRole(rec, context.Background(), "ws", tt.userID, workspacetypes.WorkspaceRoleEditor)
+
+			assert.Equal(t, tt.want != http.StatusOK, refused)
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+)
+
+// listBootstrapTemplates is a var so that the handler can be tested without a database
+var listBootstrapTemplates = workspace.ListBootstrapTemplates
+
+// BootstrapTemplatesResponse is the response to GET /api/bootstrap-templates
+type BootstrapTemplatesResponse struct {
+	Templates []BootstrapTemplate `json:"templates"`
+}
+
+// BootstrapTemplate is a scaffold a new workspace can be created from
+type BootstrapTemplate struct {
+	Name string `json:"name"`
+	// Default is set on the template used when a workspace is created without one
+	Default bool `json:"default"`
+}
+
+// ListBootstrapTemplates responds with the scaffold templates new workspaces can be created from,
+// ordered by name
+func ListBootstrapTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := listBootstrapTemplates(r.Context())
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list bootstrap templates: %w", err))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list templates"})
+		return
+	}
+
+	response := BootstrapTemplatesResponse{Templates: []BootstrapTemplate{}}
+	for _, template := range templates {
+		response.Templates = append(response.Templates, BootstrapTemplate{
+			Name:    template.Name,
+			Default: template.Name == workspace.DefaultBootstrapTemplate,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBootstrapTemplates(t *testing.T) {
+	original := listBootstrapTemplates
+	t.Cleanup(func() { listBootstrapTemplates = original })
+
+	listBootstrapTemplates = func(ctx context.Context) ([]workspacetypes.BootstrapWorkspace, error) {
+		return []workspacetypes.BootstrapWorkspace{
+			{ID: "1", Name: "cronjob"},
+			{ID: "2", Name: workspace.DefaultBootstrapTemplate},
+		}, nil
+	}
+	rec := httptest.NewRecorder()
+	ListBootstrapTemplates(rec, httptest.NewRequest(http.MethodGet, "/api/bootstrap-templates", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response BootstrapTemplatesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, []BootstrapTemplate{
+		{Name: "cronjob"},
+		{Name: workspace.DefaultBootstrapTemplate, Default: true},
+	}, response.Templates)
+
+	listBootstrapTemplates = func(ctx context.Context) ([]workspacetypes.BootstrapWorkspace, error) {
+		return nil, errors.New("connection refused")
+	}
+	rec = httptest.NewRecorder()
+	ListBootstrapTemplates(rec, httptest.NewRequest(http.MethodGet, "/api/bootstrap-templates", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "failed to list templates")
+}
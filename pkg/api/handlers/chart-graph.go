@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// getChartTemplateGraph is a var so that the handler can be tested without a database
+var getChartTemplateGraph = workspace.GetChartTemplateGraph
+
+// ChartGraph responds with the graph of which templates of a chart in the current revision include
+// which helpers and reference which values keys, as nodes and edges that can be drawn as they are
+func ChartGraph(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	graph, err := getChartTemplateGraph(r.Context(), workspaceID, chartID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrChartNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to build template graph: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to build template graph"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, graph)
+}
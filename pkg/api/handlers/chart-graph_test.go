@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/analysis"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChartGraph(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{
+			name:     "graph",
+			userID:   "viewer",
+			want:     http.StatusOK,
+			wantBody: `"edges":[{"from":"file:templates/service.yaml","to":"value:service.port","type":"uses"}]`,
+		},
+		{name: "not a member", userID: "stranger", want: http.StatusForbidden, wantBody: `"error"`},
+		{name: "unknown chart", userID: "viewer", err: fmt.Errorf("%w: chart", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "database error", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to build template graph"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			original := getChartTemplateGraph
+			t.Cleanup(func() { getChartTemplateGraph = original })
+
+			getChartTemplateGraph = func(ctx context.Context, workspaceID string, chartID string) (*analysis.TemplateGraph, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "chart", chartID)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return analysis.BuildTemplateGraph([]workspacetypes.File{
+					{FilePath: "templates/service.yaml", Content: "port: {{ .Values.service.port }}\n"},
+				}), nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/graph", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			ChartGraph(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
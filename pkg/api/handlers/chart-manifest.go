@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	loadChartManifest = workspace.LoadChartManifest
+	saveChartManifest = workspace.SaveChartManifest
+)
+
+// chartManifestPath is the path of a chart's Chart.yaml in its files
+const chartManifestPath = "Chart.yaml"
+
+// ChartManifestResponse is the response to GET and PATCH /api/workspace/{id}/chart/{chartID}/manifest
+type ChartManifestResponse struct {
+	Manifest *workspace.ChartManifest `json:"manifest"`
+	// Warnings name the other users that have Chart.yaml open when it's changed
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// UpdateChartManifestRequest is the body of PATCH /api/workspace/{id}/chart/{chartID}/manifest.
+// Fields that aren't set are left as they are.
+type UpdateChartManifestRequest struct {
+	Version    *string `json:"version,omitempty"`
+	AppVersion *string `json:"appVersion,omitempty"`
+	// Dependencies replaces all the dependencies, an empty list removes them
+	Dependencies *[]workspace.ChartDependency `json:"dependencies,omitempty"`
+}
+
+func (r UpdateChartManifestRequest) validate() error {
+	if r.Version == nil && r.AppVersion == nil && r.Dependencies == nil {
+		return errors.New("one of version, appVersion or dependencies is required")
+	}
+	return nil
+}
+
+// GetChartManifest responds with the parsed Chart.yaml of a chart in the current revision
+func GetChartManifest(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	manifest, err := loadChartManifest(r.Context(), workspaceID, chartID)
+	if err != nil {
+		writeChartManifestError(w, r, err, "get", workspaceID, chartID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ChartManifestResponse{Manifest: manifest})
+}
+
+// UpdateChartManifest changes the version, appVersion or dependencies of a chart in the current
+// revision, writing its Chart.yaml as pending content
+func UpdateChartManifest(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	var req UpdateChartManifestRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	manifest, err := loadChartManifest(r.Context(), workspaceID, chartID)
+	if err != nil {
+		writeChartManifestError(w, r, err, "get", workspaceID, chartID)
+		return
+	}
+
+	if req.Version != nil {
+		err = manifest.SetVersion(*req.Version)
+	}
+	if err == nil && req.AppVersion != nil {
+		err = manifest.SetAppVersion(*req.AppVersion)
+	}
+	if err == nil && req.Dependencies != nil {
+		err = manifest.SetDependencies(*req.Dependencies)
+	}
+	if err != nil {
+		writeChartManifestError(w, r, err, "update", workspaceID, chartID)
+		return
+	}
+
+	if err := saveChartManifest(r.Context(), manifest); err != nil {
+		writeChartManifestError(w, r, err, "update", workspaceID, chartID)
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditFileEdited, map[string]interface{}{
+		"chartId": chartID,
+		"path":    chartManifestPath,
+	})
+
+	_, warnings := editingWarnings(r.Context(), workspaceID, chartManifestPath, requestUserID(r))
+	writeJSON(w, http.StatusOK, ChartManifestResponse{Manifest: manifest, Warnings: warnings})
+}
+
+func writeChartManifestError(w http.ResponseWriter, r *http.Request, err error, action string, workspaceID string, chartID string) {
+	switch {
+	case errors.Is(err, workspace.ErrChartNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+	case errors.Is(err, workspace.ErrChartManifestNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart has no Chart.yaml"})
+	case errors.Is(err, workspace.ErrInvalidChartManifest):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	case errors.Is(err, workspace.ErrConflict):
+		writeFileConflict(w, r, http.StatusConflict, "Chart.yaml was modified since it was read", workspaceID, chartManifestPath)
+	case errors.Is(err, workspace.ErrFileBusy):
+		writeFileConflict(w, r, http.StatusServiceUnavailable, "Chart.yaml is being written, try again", workspaceID, chartManifestPath)
+	default:
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to %s chart manifest: %w", action, err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: fmt.Sprintf("failed to %s chart manifest", action)})
+	}
+}
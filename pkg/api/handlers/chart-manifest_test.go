@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubChartManifest serves chartYAML as the Chart.yaml of every chart, or loadErr, and returns a
+// pointer to the content that's saved
+func stubChartManifest(t *testing.T, chartYAML string, loadErr error, saveErr error) *string {
+	t.Helper()
+	originalLoad, originalSave := loadChartManifest, saveChartManifest
+	t.Cleanup(func() { loadChartManifest, saveChartManifest = originalLoad, originalSave })
+
+	saved := ""
+	loadChartManifest = func(ctx context.Context, workspaceID string, chartID string) (*workspace.ChartManifest, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return workspace.ParseChartManifest(chartYAML)
+	}
+	saveChartManifest = func(ctx context.Context, manifest *workspace.ChartManifest) error {
+		if saveErr != nil {
+			return saveErr
+		}
+		content, err := manifest.Content()
+		require.NoError(t, err)
+		saved = content
+		return nil
+	}
+	return &saved
+}
+
+func TestGetChartManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "found", want: http.StatusOK, wantBody: `"version":"0.1.0"`},
+		{name: "unknown chart", err: fmt.Errorf("%w: chart in workspace ws", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "no Chart.yaml", err: workspace.ErrChartManifestNotFound, want: http.StatusNotFound, wantBody: "chart has no Chart.yaml"},
+		{name: "database error", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to get chart manifest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubChartManifest(t, "apiVersion: v2\nname: nginx\nversion: 0.1.0\n", tt.err, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/manifest", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			GetChartManifest(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestUpdateChartManifest(t *testing.T) {
+	stubPresentOnFile(t, map[string][]realtimetypes.Presence{
+		"Chart.yaml": {{WorkspaceID: "ws", UserID: "alice", UserName: "Alice", FilePath: "Chart.yaml"}},
+	})
+
+	tests := []struct {
+		name      string
+		body      string
+		saveErr   error
+		want      int
+		wantBody  string
+		wantSaved string
+	}{
+		{
+			name:      "version and dependencies",
+			body:      `{"version": "0.2.0", "dependencies": [{"name": "redis", "version": "17.0.0", "repository": "https://charts.bitnami.com/bitnami"}]}`,
+			want:      http.StatusOK,
+			wantBody:  `"version":"0.2.0"`,
+			wantSaved: "# nginx chart\napiVersion: v2\nname: nginx\nversion: 0.2.0\nappVersion: \"1.25\"\ndependencies:\n  - name: redis\n    version: 17.0.0\n    repository: https://charts.bitnami.com/bitnami\n",
+		},
+		{
+			name:     "nothing to change",
+			body:     `{}`,
+			want:     http.StatusBadRequest,
+			wantBody: "one of version, appVersion or dependencies is required",
+		},
+		{
+			name:     "invalid version",
+			body:     `{"version": "latest"}`,
+			want:     http.StatusBadRequest,
+			wantBody: "is not semver",
+		},
+		{
+			name:     "written since it was read",
+			body:     `{"appVersion": "1.26"}`,
+			saveErr:  fmt.Errorf("failed to write Chart.yaml: %w", workspace.ErrConflict),
+			want:     http.StatusConflict,
+			wantBody: "Chart.yaml was modified since it was read",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := stubChartManifest(t, "# nginx chart\napiVersion: v2\nname: nginx\nversion: 0.1.0\nappVersion: \"1.25\"\n", nil, tt.saveErr)
+			audited := stubAudit(t)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/workspace/ws/chart/chart/manifest", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			UpdateChartManifest(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantSaved, *saved)
+			if tt.want == http.StatusOK || tt.want == http.StatusConflict {
+				assert.Contains(t, rec.Body.String(), `"warnings":["Alice is editing Chart.yaml"]`)
+			}
+			if tt.want == http.StatusOK {
+				assert.Equal(t, []string{workspace.AuditFileEdited}, *audited)
+			} else {
+				assert.Empty(t, *audited)
+			}
+		})
+	}
+}
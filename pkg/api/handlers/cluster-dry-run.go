@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/clusterdryrun"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handler can be tested without a database, a cluster or a realtime
+// server
+var (
+	dryRunRender          = workspace.DryRunRender
+	clusterDryRunEnabled  = workspace.ClusterDryRunEnabled
+	sendClusterDryRunDone = sendClusterDryRunEvent
+)
+
+// ClusterDryRunRequest is the body of POST /api/workspace/{id}/render/{renderID}/cluster-dry-run
+type ClusterDryRunRequest struct {
+	// Kubeconfig is the contents of a kubeconfig for the cluster to validate against. It's only
+	// used for this request and never stored. Its credentials must be inline, kubeconfigs with
+	// exec or auth-provider credentials or paths to files are refused.
+	Kubeconfig string `json:"kubeconfig"`
+}
+
+func (r ClusterDryRunRequest) validate() error {
+	if strings.TrimSpace(r.Kubeconfig) == "" {
+		return errors.New("kubeconfig is required")
+	}
+	if _, err := clusterdryrun.ParseKubeconfig(r.Kubeconfig); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClusterDryRunChart is the dry run of one chart of a render
+type ClusterDryRunChart struct {
+	RenderedChartID string `json:"renderedChartId"`
+	ChartID         string `json:"chartId"`
+	// Validated is false for a chart that failed to render, it has no results
+	Validated bool                                 `json:"validated"`
+	Results   []workspacetypes.ClusterDryRunResult `json:"results"`
+}
+
+// ClusterDryRunResponse is the response to POST /api/workspace/{id}/render/{renderID}/cluster-dry-run
+type ClusterDryRunResponse struct {
+	Charts []ClusterDryRunChart `json:"charts"`
+}
+
+// ClusterDryRun validates the manifests of a render against a cluster with a server side dry run,
+// and responds with what the cluster said about each document. Documents in namespaces that don't
+// exist are reported apart from ones the cluster rejects. It's only available with
+// CHARTSMITH_CLUSTER_DRY_RUN=true.
+func ClusterDryRun(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	renderID := r.PathValue("renderID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	if !clusterDryRunEnabled() {
+		writeJSON(w, http.StatusNotImplemented, errorResponse{Error: "cluster dry runs are not enabled"})
+		return
+	}
+
+	var req ClusterDryRunRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	charts, err := dryRunRender(r.Context(), workspaceID, renderID, req.Kubeconfig)
+	if err != nil {
+		if errors.Is(err, workspace.ErrRenderNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "render not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to dry run render: %w", err), zap.String("workspaceID", workspaceID), zap.String("renderID", renderID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to dry run render"})
+		return
+	}
+
+	response := ClusterDryRunResponse{Charts: []ClusterDryRunChart{}}
+	for _, chart := range charts {
+		results := chart.ClusterDryRun
+		if results == nil {
+			results = []workspacetypes.ClusterDryRunResult{}
+		}
+		response.Charts = append(response.Charts, ClusterDryRunChart{
+			RenderedChartID: chart.ID,
+			ChartID:         chart.ChartID,
+			Validated:       chart.IsSuccess,
+			Results:         results,
+		})
+
+		if !chart.IsSuccess {
+			continue
+		}
+		// the results are stored with the render, clients that miss the event get them with it
+		if err := sendClusterDryRunDone(r.Context(), workspaceID, renderID, chart.ID, results); err != nil {
+			logger.WarnCtx(r.Context(), "Failed to send cluster dry run", zap.String("workspaceID", workspaceID), zap.String("renderID", renderID), zap.Error(err))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func sendClusterDryRunEvent(ctx context.Context, workspaceID string, renderID string, renderedChartID string, results []workspacetypes.ClusterDryRunResult) error {
+	userIDs, err := workspace.ListUserIDsForWorkspace(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return realtime.SendEvent(ctx, realtimetypes.Recipient{UserIDs: userIDs}, realtimetypes.ClusterDryRunEvent{
+		WorkspaceID:     workspaceID,
+		RenderID:        renderID,
+		RenderedChartID: renderedChartID,
+		Results:         results,
+	})
+}
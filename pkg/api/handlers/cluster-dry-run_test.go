@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// dryRunKubeconfig is the JSON string of a kubeconfig with an inline token
+const dryRunKubeconfig = `"apiVersion: v1\nkind: Config\nclusters:\n- name: a\n  cluster:\n    server: https://a\nusers:\n- name: a\n  user:\n    token: t\n"`
+
+func TestClusterDryRun(t *testing.T) {
+	charts := []workspacetypes.RenderedChart{
+		{ID: "rendered-a", ChartID: "a", IsSuccess: true, ClusterDryRun: []workspacetypes.ClusterDryRunResult{
+			{Kind: "Secret", Name: "creds", Namespace: "missing", Status: workspacetypes.ClusterDryRunNamespaceNotFound},
+		}},
+		{ID: "rendered-b", ChartID: "b", IsSuccess: false},
+	}
+
+	tests := []struct {
+		name       string
+		disabled   bool
+		body       string
+		err        error
+		want       int
+		wantBody   string
+		wantEvents []string
+	}{
+		{name: "validated", body: `{"kubeconfig": ` + dryRunKubeconfig + `}`, want: http.StatusOK, wantBody: `{"charts":[{"renderedChartId":"rendered-a","chartId":"a","validated":true,"results":[{"kind":"Secret","name":"creds","namespace":"missing","status":"namespace-not-found"}]},{"renderedChartId":"rendered-b","chartId":"b","validated":false,"results":[]}]}`, wantEvents: []string{"rendered-a"}},
+		{name: "disabled", disabled: true, body: `{"kubeconfig": ` + dryRunKubeconfig + `}`, want: http.StatusNotImplemented, wantBody: "not enabled"},
+		{name: "no kubeconfig", body: `{"kubeconfig": " "}`, want: http.StatusBadRequest, wantBody: "kubeconfig is required"},
+		{name: "exec credentials", body: `{"kubeconfig": "apiVersion: v1\nkind: Config\nclusters:\n- name: a\n  cluster:\n    server: https://a\nusers:\n- name: a\n  user:\n    exec:\n      command: sh\n"}`, want: http.StatusBadRequest, wantBody: "exec credentials aren't supported"},
+		{name: "unknown render", body: `{"kubeconfig": ` + dryRunKubeconfig + `}`, err: workspace.ErrRenderNotFound, want: http.StatusNotFound, wantBody: "render not found"},
+		{name: "database error", body: `{"kubeconfig": ` + dryRunKubeconfig + `}`, err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to dry run render"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalEnabled, originalDryRun, originalSend := clusterDryRunEnabled, dryRunRender, sendClusterDryRunDone
+			t.Cleanup(func() {
+				clusterDryRunEnabled, dryRunRender, sendClusterDryRunDone = originalEnabled, originalDryRun, originalSend
+			})
+
+			clusterDryRunEnabled = func() bool { return !tt.disabled }
+			dryRunRender = func(ctx context.Context, workspaceID string, renderID string, kubeconfig string) ([]workspacetypes.RenderedChart, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "render", renderID)
+				assert.Contains(t, kubeconfig, "token: t")
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return charts, nil
+			}
+			events := []string{}
+			sendClusterDryRunDone = func(ctx context.Context, workspaceID string, renderID string, renderedChartID string, results []workspacetypes.ClusterDryRunResult) error {
+				events = append(events, renderedChartID)
+				return errors.New("realtime is down")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/render/render/cluster-dry-run", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("renderID", "render")
+			rec := httptest.NewRecorder()
+			ClusterDryRun(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantEvents != nil {
+				assert.Equal(t, tt.wantEvents, events)
+			}
+		})
+	}
+}
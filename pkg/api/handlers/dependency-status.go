@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// getChartDependencyStatus is a var so that the handler can be tested without a database or a network
+var getChartDependencyStatus = workspace.GetChartDependencyStatus
+
+// DependencyStatus responds with how far each dependency in the Chart.yaml of a chart in the
+// current revision is behind the latest version in its repository. Unreachable repositories are
+// reported on their dependencies, not as an error.
+func DependencyStatus(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	report, err := getChartDependencyStatus(r.Context(), workspaceID, chartID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrChartNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to check dependencies: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to check dependencies"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/recommendations"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "reported", want: http.StatusOK, wantBody: `"status":"minor"`},
+		{name: "unknown chart", err: fmt.Errorf("%w: chart", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "invalid Chart.yaml", err: errors.New("failed to parse Chart.yaml"), want: http.StatusInternalServerError, wantBody: "failed to check dependencies"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := getChartDependencyStatus
+			t.Cleanup(func() { getChartDependencyStatus = original })
+
+			getChartDependencyStatus = func(ctx context.Context, workspaceID string, chartID string) (*recommendations.DependencyReport, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &recommendations.DependencyReport{Dependencies: []recommendations.DependencyStatus{
+					{Name: "redis", Version: "17.0.0", Current: "17.0.0", Latest: "17.3.1", Status: recommendations.DependencyMinorBehind},
+				}}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/dependency-status", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			DependencyStatus(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// findDuplicateFiles is a var so that the handler can be tested without a database
+var findDuplicateFiles = findCurrentDuplicateFiles
+
+// FindDuplicateFilesResponse is the response to GET /api/workspace/{id}/duplicates
+type FindDuplicateFilesResponse struct {
+	RevisionNumber int `json:"revisionNumber"`
+	// Pairs are the files of a chart suspected to be duplicates of each other, most similar first.
+	// Similarity is from 0 to 1, and Method is how it was measured.
+	Pairs []workspacetypes.DuplicateFilePair `json:"pairs"`
+	// Groups are the files connected by pairs, such as three copies of the same template
+	Groups []workspacetypes.DuplicateFileGroup `json:"groups"`
+}
+
+// FindDuplicateFiles responds with the files of the current revision of a workspace that are
+// suspected to be duplicates, leaving out the files matched by its duplicate_exclusions setting
+func FindDuplicateFiles(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	revisionNumber, report, err := findDuplicateFiles(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to find duplicate files: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to find duplicate files"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, FindDuplicateFilesResponse{
+		RevisionNumber: revisionNumber,
+		Pairs:          report.Pairs,
+		Groups:         report.Groups,
+	})
+}
+
+func findCurrentDuplicateFiles(ctx context.Context, workspaceID string) (int, *workspacetypes.DuplicateReport, error) {
+	ws, err := workspace.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	report, err := workspace.FindDuplicateFiles(ctx, workspaceID, ws.CurrentRevision)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ws.CurrentRevision, report, nil
+}
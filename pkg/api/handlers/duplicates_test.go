@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDuplicateFiles(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "found", userID: "viewer", want: http.StatusOK, wantBody: `{"revisionNumber":4,"pairs":[{"chartId":"app","filePath":"templates/api.yaml","otherFilePath":"templates/worker.yaml","similarity":0.95,"method":"content"}],"groups":[{"chartId":"app","filePaths":["templates/api.yaml","templates/worker.yaml"],"similarity":0.95}]}`},
+		{name: "not a member", userID: "stranger", want: http.StatusForbidden},
+		{name: "database error", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to find duplicate files"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			original := findDuplicateFiles
+			t.Cleanup(func() { findDuplicateFiles = original })
+			findDuplicateFiles = func(ctx context.Context, workspaceID string) (int, *workspacetypes.DuplicateReport, error) {
+				assert.Equal(t, "ws", workspaceID)
+				if tt.err != nil {
+					return 0, nil, tt.err
+				}
+				return 4, &workspacetypes.DuplicateReport{
+					Pairs:  []workspacetypes.DuplicateFilePair{{ChartID: "app", FilePath: "templates/api.yaml", OtherFilePath: "templates/worker.yaml", Similarity: 0.95, Method: workspacetypes.DuplicateMethodContent}},
+					Groups: []workspacetypes.DuplicateFileGroup{{ChartID: "app", FilePaths: []string{"templates/api.yaml", "templates/worker.yaml"}, Similarity: 0.95}},
+				}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/duplicates", nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			FindDuplicateFiles(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
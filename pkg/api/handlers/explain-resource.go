@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// explainRenderedResource is a var so that the handler can be tested without a database or an LLM
+var explainRenderedResource = llm.ExplainRenderedResource
+
+// ExplainResourceRequest is the body of POST /api/workspace/{id}/render/{renderID}/explain
+type ExplainResourceRequest struct {
+	// Path is the path of the rendered file, the path of the template it was rendered from
+	Path string `json:"path"`
+}
+
+func (r ExplainResourceRequest) validate() error {
+	if strings.TrimSpace(r.Path) == "" {
+		return errors.New("path is required")
+	}
+	return nil
+}
+
+// ExplainResource explains a rendered file of a render in markdown for an operator: what it
+// deploys, which values control it and how it's commonly tweaked
+func ExplainResource(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	renderID := r.PathValue("renderID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	var req ExplainResourceRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	explanation, err := explainRenderedResource(r.Context(), workspaceID, renderID, req.Path)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrRenderNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "render not found"})
+		case errors.Is(err, workspace.ErrRenderedFileNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("render has no rendered file %s", req.Path)})
+		case errors.Is(err, workspace.ErrSecretsNotAcknowledged):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to explain resource: %w", err), zap.String("workspaceID", workspaceID), zap.String("renderID", renderID), zap.String("path", req.Path))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to explain resource"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, explanation)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		want     int
+		wantBody string
+		wantPath string
+	}{
+		{name: "explained", body: `{"path":"templates/deployment.yaml"}`, want: http.StatusOK, wantBody: `"explanation":"## What it does"`, wantPath: "templates/deployment.yaml"},
+		{name: "no path", body: `{"path":" "}`, want: http.StatusBadRequest, wantBody: "path is required"},
+		{name: "unknown field", body: `{"file":"templates/deployment.yaml"}`, want: http.StatusBadRequest, wantBody: "invalid request body"},
+		{name: "unknown render", body: `{"path":"templates/deployment.yaml"}`, err: workspace.ErrRenderNotFound, want: http.StatusNotFound, wantBody: "render not found", wantPath: "templates/deployment.yaml"},
+		{name: "unknown file", body: `{"path":"templates/missing.yaml"}`, err: fmt.Errorf("failed to get rendered resource: %w", workspace.ErrRenderedFileNotFound), want: http.StatusNotFound, wantBody: "render has no rendered file templates/missing.yaml", wantPath: "templates/missing.yaml"},
+		{name: "unacknowledged secrets", body: `{"path":"templates/secret.yaml"}`, err: fmt.Errorf("%w: found in values.yaml", workspace.ErrSecretsNotAcknowledged), want: http.StatusConflict, wantBody: "found in values.yaml", wantPath: "templates/secret.yaml"},
+		{name: "llm error", body: `{"path":"templates/deployment.yaml"}`, err: errors.New("overloaded"), want: http.StatusInternalServerError, wantBody: "failed to explain resource", wantPath: "templates/deployment.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := explainRenderedResource
+			t.Cleanup(func() { explainRenderedResource = original })
+
+			var gotWorkspaceID, gotRenderID, gotPath string
+			explainRenderedResource = func(ctx context.Context, workspaceID string, renderID string, filePath string) (*llm.ResourceExplanation, error) {
+				gotWorkspaceID, gotRenderID, gotPath = workspaceID, renderID, filePath
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &llm.ResourceExplanation{Explanation: "## What it does"}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/render/render/explain", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("renderID", "render")
+			rec := httptest.NewRecorder()
+			ExplainResource(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantPath, gotPath)
+			if tt.wantPath != "" {
+				assert.Equal(t, "ws", gotWorkspaceID)
+				assert.Equal(t, "render", gotRenderID)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// exportWorkspaceChart is a var so that the handler can be tested without a database
+var exportWorkspaceChart = workspace.ExportWorkspaceChart
+
+// ExportChart responds with the packaged chart of the current revision. With ?format=zip it
+// responds with a zip of the archive and its provenance, when exports are signed. With
+// ?lineEndings=original, files imported with CRLF line endings are exported with them.
+func ExportChart(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "tgz" && format != "zip" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "format must be tgz or zip"})
+		return
+	}
+	lineEndings := r.URL.Query().Get("lineEndings")
+	if lineEndings != "" && lineEndings != "lf" && lineEndings != "original" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "lineEndings must be lf or original"})
+		return
+	}
+
+	archive, err := exportWorkspaceChart(r.Context(), workspaceID, chartID, lineEndings == "original")
+	if err != nil {
+		if errors.Is(err, workspace.ErrChartNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to export chart: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to export chart"})
+		return
+	}
+
+	if format != "zip" {
+		writeAttachment(w, "application/gzip", archive.Filename, archive.Content)
+		return
+	}
+
+	content, err := archive.Zip()
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to zip chart export: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to export chart"})
+		return
+	}
+	writeAttachment(w, "application/zip", strings.TrimSuffix(archive.Filename, ".tgz")+".zip", content)
+}
+
+func writeAttachment(w http.ResponseWriter, contentType string, filename string, content []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
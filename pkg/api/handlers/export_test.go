@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/provenance"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportChart(t *testing.T) {
+	signed := &workspace.ChartArchive{
+		Filename:  "nginx-1.2.3.tgz",
+		Content:   []byte("archive"),
+		Signature: &provenance.Signature{Filename: "nginx-1.2.3.tgz.prov", Content: []byte("prov")},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		err             error
+		want            int
+		wantType        string
+		wantDisposition string
+		wantBody        string
+		wantRestore     bool
+	}{
+		{name: "tgz by default", want: http.StatusOK, wantType: "application/gzip", wantDisposition: `attachment; filename="nginx-1.2.3.tgz"`, wantBody: "archive"},
+		{name: "tgz", query: "?format=tgz", want: http.StatusOK, wantType: "application/gzip", wantDisposition: `attachment; filename="nginx-1.2.3.tgz"`, wantBody: "archive"},
+		{name: "zip", query: "?format=zip", want: http.StatusOK, wantType: "application/zip", wantDisposition: `attachment; filename="nginx-1.2.3.zip"`},
+		{name: "original line endings", query: "?lineEndings=original", want: http.StatusOK, wantType: "application/gzip", wantDisposition: `attachment; filename="nginx-1.2.3.tgz"`, wantRestore: true},
+		{name: "unknown line endings", query: "?lineEndings=cr", want: http.StatusBadRequest, wantBody: "lineEndings must be lf or original"},
+		{name: "unknown format", query: "?format=tar", want: http.StatusBadRequest, wantBody: "format must be tgz or zip"},
+		{name: "unknown chart", err: fmt.Errorf("%w: chart in workspace ws", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "export error", err: errors.New("no Chart.yaml"), want: http.StatusInternalServerError, wantBody: "failed to export chart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := exportWorkspaceChart
+			t.Cleanup(func() { exportWorkspaceChart = original })
+
+			exportWorkspaceChart = func(ctx context.Context, workspaceID string, chartID string, restoreLineEndings bool) (*workspace.ChartArchive, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "chart", chartID)
+				assert.Equal(t, tt.wantRestore, restoreLineEndings)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return signed, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/export"+tt.query, nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			ExportChart(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantType != "" {
+				assert.Equal(t, tt.wantType, rec.Header().Get("Content-Type"))
+				assert.Equal(t, tt.wantDisposition, rec.Header().Get("Content-Disposition"))
+			}
+
+			if tt.wantType == "application/zip" {
+				zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+				require.NoError(t, err)
+				names := []string{}
+				for _, f := range zr.File {
+					names = append(names, f.Name)
+				}
+				assert.Equal(t, []string{"nginx-1.2.3.tgz", "nginx-1.2.3.tgz.prov"}, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// getFileHistory is a var so that the handler can be tested without a database
+var getFileHistory = workspace.GetFileHistory
+
+// FileHistoryResponse is the response to GET /api/workspace/{id}/files/history?path=...
+type FileHistoryResponse struct {
+	Path string `json:"path"`
+	// History is the revisions that created, changed or deleted the file, oldest first
+	History []workspacetypes.FileHistoryEntry `json:"history"`
+}
+
+// FileHistory responds with the revisions that changed a file, and the plans that changed it
+func FileHistory(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+	filePath := r.URL.Query().Get("path")
+	if filePath == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "path is required"})
+		return
+	}
+
+	history, err := getFileHistory(r.Context(), workspaceID, filePath)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get file history: %w", err), zap.String("workspaceID", workspaceID), zap.String("path", filePath))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get file history"})
+		return
+	}
+	if len(history) == 0 {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "file not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, FileHistoryResponse{Path: filePath, History: history})
+}
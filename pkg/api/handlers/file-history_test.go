@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		history  []workspacetypes.FileHistoryEntry
+		err      error
+		want     int
+		wantBody string
+	}{
+		{
+			name:     "history",
+			url:      "/api/workspace/ws/files/history?path=templates/ingress.yaml",
+			history:  []workspacetypes.FileHistoryEntry{{RevisionNumber: 2, Change: "created", PlanID: "plan", LinesAdded: 3}},
+			want:     http.StatusOK,
+			wantBody: `"history":[{"revisionNumber":2,"change":"created"`,
+		},
+		{name: "no path", url: "/api/workspace/ws/files/history", want: http.StatusBadRequest, wantBody: "path is required"},
+		{name: "never existed", url: "/api/workspace/ws/files/history?path=nope.yaml", history: []workspacetypes.FileHistoryEntry{}, want: http.StatusNotFound, wantBody: "file not found"},
+		{name: "database error", url: "/api/workspace/ws/files/history?path=values.yaml", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to get file history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := getFileHistory
+			t.Cleanup(func() { getFileHistory = original })
+
+			getFileHistory = func(ctx context.Context, workspaceID string, filePath string) ([]workspacetypes.FileHistoryEntry, error) {
+				assert.Equal(t, "ws", workspaceID)
+				return tt.history, tt.err
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			FileHistory(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
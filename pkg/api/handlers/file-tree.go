@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// getFileTree is a var so that the handler can be tested without a database
+var getFileTree = getFileTreeWithSummaries
+
+// GetFileTree responds with the files of a revision of a workspace as a tree grouped by chart, to
+// GET /api/workspace/{id}/tree?revision=N, the current revision without one. Files are flagged as
+// changed since the revision before. A lazy tree leaves out the children of its directories, they're
+// loaded with ?chartId=...&path=... for a directory of a chart, or ?path=... for a directory of
+// the files that aren't in a chart.
+func GetFileTree(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	revisionNumber := 0
+	if revision := r.URL.Query().Get("revision"); revision != "" {
+		n, err := strconv.Atoi(revision)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "revision must be a whole number, at least 1"})
+			return
+		}
+		revisionNumber = n
+	}
+
+	opts := workspace.FileTreeOptions{
+		ChartID: r.URL.Query().Get("chartId"),
+		Path:    r.URL.Query().Get("path"),
+	}
+	tree, err := getFileTree(r.Context(), workspaceID, revisionNumber, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrWorkspaceNotFound), errors.Is(err, workspace.ErrRevisionNotFound),
+			errors.Is(err, workspace.ErrChartNotFound), errors.Is(err, workspace.ErrFileTreePathNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get file tree: %w", err), zap.String("workspaceID", workspaceID), zap.Int("revision", revisionNumber))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get file tree"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// getFileTreeWithSummaries flags the files that the summary cache has a summary of by the model
+// that summarizes them now
+func getFileTreeWithSummaries(ctx context.Context, workspaceID string, revisionNumber int, opts workspace.FileTreeOptions) (*workspacetypes.FileTree, error) {
+	opts.SummaryModel = llm.ModelFor(llm.OperationSummarize)
+	return workspace.GetFileTree(ctx, workspaceID, revisionNumber, opts)
+}
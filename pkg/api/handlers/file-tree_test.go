@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFileTree(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name         string
+		url          string
+		userID       string
+		err          error
+		wantRevision int
+		wantOpts     workspace.FileTreeOptions
+		want         int
+		wantBody     string
+	}{
+		{
+			name:     "current revision",
+			url:      "/api/workspace/ws/tree",
+			userID:   "viewer",
+			want:     http.StatusOK,
+			wantBody: `"charts":[{"id":"chart","name":"nginx","fileCount":1,"changedFileCount":1,"children":[{"name":"values.yaml","path":"values.yaml","isDir":false,"size":12,"fileId":"values","changedSinceParentRevision":true}]}]`,
+		},
+		{
+			name:         "subtree of a revision",
+			url:          "/api/workspace/ws/tree?revision=3&chartId=chart&path=templates",
+			userID:       "viewer",
+			wantRevision: 3,
+			wantOpts:     workspace.FileTreeOptions{ChartID: "chart", Path: "templates"},
+			want:         http.StatusOK,
+		},
+		{name: "invalid revision", url: "/api/workspace/ws/tree?revision=latest", userID: "viewer", want: http.StatusBadRequest, wantBody: "revision must be a whole number"},
+		{name: "not a member", url: "/api/workspace/ws/tree", userID: "stranger", want: http.StatusForbidden},
+		{name: "revision not found", url: "/api/workspace/ws/tree?revision=9", userID: "viewer", wantRevision: 9, err: fmt.Errorf("%w: 9", workspace.ErrRevisionNotFound), want: http.StatusNotFound, wantBody: "revision not found: 9"},
+		{name: "directory not found", url: "/api/workspace/ws/tree?path=nope", userID: "viewer", wantOpts: workspace.FileTreeOptions{Path: "nope"}, err: fmt.Errorf("%w: nope", workspace.ErrFileTreePathNotFound), want: http.StatusNotFound},
+		{name: "database error", url: "/api/workspace/ws/tree", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to get file tree"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			original := getFileTree
+			t.Cleanup(func() { getFileTree = original })
+			getFileTree = func(ctx context.Context, workspaceID string, revisionNumber int, opts workspace.FileTreeOptions) (*workspacetypes.FileTree, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, tt.wantRevision, revisionNumber)
+				assert.Equal(t, tt.wantOpts, opts)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.FileTree{
+					RevisionNumber:   4,
+					FileCount:        1,
+					ChangedFileCount: 1,
+					Charts: []workspacetypes.FileTreeChart{{
+						ID:               "chart",
+						Name:             "nginx",
+						FileCount:        1,
+						ChangedFileCount: 1,
+						Children:         []workspacetypes.FileTreeNode{{Name: "values.yaml", Path: "values.yaml", Size: 12, FileID: "values", ChangedSinceParentRevision: true}},
+					}},
+					Files: []workspacetypes.FileTreeNode{},
+				}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			GetFileTree(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handler can be tested without a database
+var (
+	getRenderWorkspaceID     = workspace.GetRenderWorkspaceID
+	createFixPlanChatMessage = workspace.CreateFixPlanChatMessage
+)
+
+// CreateFixPlan posts a chat message on behalf of the user that quotes the template errors of a
+// failed render and asks for them to be fixed, and has a plan created for it
+func CreateFixPlan(w http.ResponseWriter, r *http.Request) {
+	renderID := r.PathValue("renderID")
+	userID := requestUserID(r)
+	if userID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("%s is required, the message is sent on behalf of the user", UserIDHeader)})
+		return
+	}
+
+	workspaceID, err := getRenderWorkspaceID(r.Context(), renderID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrRenderNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "render not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get render workspace: %w", err), zap.String("renderID", renderID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create fix plan"})
+		return
+	}
+	if refuseRole(w, r.Context(), workspaceID, userID, workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	chatMessage, err := createFixPlanChatMessage(r.Context(), renderID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrRenderNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "render not found"})
+		case errors.Is(err, workspace.ErrRenderHasNoErrors):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: workspace.ErrRenderHasNoErrors.Error()})
+		case errors.Is(err, workspace.ErrWorkspaceArchived):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: workspace.ErrWorkspaceArchived.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to create fix plan: %w", err), zap.String("workspaceID", workspaceID), zap.String("renderID", renderID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create fix plan"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, chatMessage)
+}
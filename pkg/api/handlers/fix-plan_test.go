@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateFixPlan(t *testing.T) {
+	tests := []struct {
+		name         string
+		userID       string
+		workspaceErr error
+		err          error
+		want         int
+		wantBody     string
+	}{
+		{name: "created", userID: "editor", want: http.StatusCreated, wantBody: `"isSystemGenerated":true`},
+		{name: "no user", want: http.StatusBadRequest, wantBody: "X-Chartsmith-User-ID is required"},
+		{name: "viewer", userID: "viewer", want: http.StatusForbidden},
+		{name: "unknown render", userID: "editor", workspaceErr: workspace.ErrRenderNotFound, want: http.StatusNotFound, wantBody: "render not found"},
+		{name: "render succeeded", userID: "editor", err: fmt.Errorf("%w: render", workspace.ErrRenderHasNoErrors), want: http.StatusConflict, wantBody: "render has no template errors"},
+		{name: "archived workspace", userID: "editor", err: fmt.Errorf("%w: ws", workspace.ErrWorkspaceArchived), want: http.StatusConflict, wantBody: "workspace is archived"},
+		{name: "database error", userID: "editor", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to create fix plan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalWorkspaceID, originalCreate := getRenderWorkspaceID, createFixPlanChatMessage
+			t.Cleanup(func() { getRenderWorkspaceID, createFixPlanChatMessage = originalWorkspaceID, originalCreate })
+			stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{
+				"editor": workspacetypes.WorkspaceRoleEditor,
+				"viewer": workspacetypes.WorkspaceRoleViewer,
+			})
+
+			getRenderWorkspaceID = func(ctx context.Context, renderID string) (string, error) {
+				assert.Equal(t, "render", renderID)
+				return "ws", tt.workspaceErr
+			}
+			created := false
+			createFixPlanChatMessage = func(ctx context.Context, renderID string, userID string) (*workspacetypes.Chat, error) {
+				assert.Equal(t, "render", renderID)
+				assert.Equal(t, tt.userID, userID)
+				created = true
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.Chat{ID: "chat", IsSystemGenerated: true}, nil
+			}
+
+			req := withUser(httptest.NewRequest(http.MethodPost, "/api/render/render/create-fix-plan", nil), tt.userID)
+			req.SetPathValue("renderID", "render")
+			rec := httptest.NewRecorder()
+			CreateFixPlan(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.want == http.StatusForbidden || tt.workspaceErr != nil || tt.userID == "" {
+				assert.False(t, created)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// getWorkspaceHealth is a var so that the handler can be tested without a database
+var getWorkspaceHealth = loadWorkspaceHealth
+
+// WorkspaceHealthResponse is the response to GET /api/workspace/{id}/health
+type WorkspaceHealthResponse struct {
+	// RevisionNumber is the latest revision that was scored, Score and Charts are its score. They're
+	// nil and empty when no revision was scored.
+	RevisionNumber *int                    `json:"revisionNumber"`
+	Score          *int                    `json:"score"`
+	Charts         []lintrules.ChartHealth `json:"charts"`
+	// Weights are the points the score is made of, see lintrules.HealthWeights
+	Weights lintrules.HealthWeights `json:"weights"`
+	// History is the score of every revision that was scored, oldest first
+	History []workspacetypes.RevisionHealth `json:"history"`
+}
+
+// WorkspaceHealth responds with the health score of a workspace's latest scored revision, how each
+// chart's score is made up, and the scores of earlier revisions
+func WorkspaceHealth(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	history, current, err := getWorkspaceHealth(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get workspace health: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get workspace health"})
+		return
+	}
+
+	response := WorkspaceHealthResponse{
+		Charts:  []lintrules.ChartHealth{},
+		Weights: lintrules.DefaultHealthWeights,
+		History: history,
+	}
+	if current != nil && len(history) > 0 {
+		latest := history[len(history)-1]
+		response.RevisionNumber = &latest.RevisionNumber
+		response.Score = &current.Score
+		response.Charts = current.Charts
+		response.Weights = current.Weights
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// loadWorkspaceHealth returns the health scores of the revisions of a workspace, and the health of
+// the latest one
+func loadWorkspaceHealth(ctx context.Context, workspaceID string) ([]workspacetypes.RevisionHealth, *lintrules.Health, error) {
+	history, err := workspace.ListRevisionHealth(ctx, workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(history) == 0 {
+		return history, nil, nil
+	}
+
+	current, err := workspace.GetRevisionHealth(ctx, workspaceID, history[len(history)-1].RevisionNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	return history, current, nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceHealth(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	current := &lintrules.Health{
+		Score:   70,
+		Charts:  []lintrules.ChartHealth{{ChartID: "chart", Score: 70, Categories: []lintrules.HealthCategory{{Name: "lint", Points: 40, MaxPoints: 60, Detail: "1 error, 1 warning"}}}},
+		Weights: lintrules.DefaultHealthWeights,
+	}
+
+	tests := []struct {
+		name      string
+		history   []workspacetypes.RevisionHealth
+		current   *lintrules.Health
+		err       error
+		want      int
+		wantScore *int
+		wantBody  string
+	}{
+		{
+			name:      "scored",
+			history:   []workspacetypes.RevisionHealth{{RevisionNumber: 1, CreatedAt: at, Score: 40}, {RevisionNumber: 3, CreatedAt: at, Score: 70}},
+			current:   current,
+			want:      http.StatusOK,
+			wantScore: &current.Score,
+			wantBody:  `"revisionNumber":3,"score":70,"charts":[{"chartId":"chart","score":70,"categories":[{"name":"lint","points":40,"maxPoints":60,"detail":"1 error, 1 warning"}]}]`,
+		},
+		{
+			name:     "never scored",
+			history:  []workspacetypes.RevisionHealth{},
+			want:     http.StatusOK,
+			wantBody: `"revisionNumber":null,"score":null,"charts":[],"weights":{"lint":60`,
+		},
+		{name: "database error", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to get workspace health"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := getWorkspaceHealth
+			t.Cleanup(func() { getWorkspaceHealth = original })
+
+			getWorkspaceHealth = func(ctx context.Context, workspaceID string) ([]workspacetypes.RevisionHealth, *lintrules.Health, error) {
+				assert.Equal(t, "ws", workspaceID)
+				return tt.history, tt.current, tt.err
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/health", nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			WorkspaceHealth(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var response WorkspaceHealthResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantScore, response.Score)
+			assert.Equal(t, tt.history, response.History)
+			assert.Equal(t, lintrules.DefaultHealthWeights, response.Weights, "the weights are documented in the response")
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/archiveimport"
+	"github.com/replicatedhq/chartsmith/pkg/gitimport"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handler can be tested without git or a database
+var (
+	importGitChart = func(ctx context.Context, source gitimport.Source) (*gitimport.ImportedChart, error) {
+		return gitimport.NewGitChartImporter(gitimport.DefaultLimits()).Import(ctx, source)
+	}
+	readArchive = func(r io.Reader) (*archiveimport.ImportedArchive, error) {
+		return archiveimport.Read(r, archiveimport.DefaultLimits())
+	}
+	createWorkspaceFromImport = workspace.CreateWorkspaceFromImport
+	sendImportProgress        = sendImportProgressEvent
+	sendImportSecretFindings  = sendImportSecretFindingsEvent
+	sendImportReport          = sendImportReportEvent
+)
+
+// maxArchiveRequestBytes limits the size of an uploaded archive, with the rest of the form
+const maxArchiveRequestBytes = 32 << 20
+
+// ImportGitRequest is the body of POST /api/workspace/import/git, it creates a workspace from a
+// chart in a Git repository
+type ImportGitRequest struct {
+	UserID string `json:"userId"`
+	// URL is the https URL of the repository
+	URL string `json:"url"`
+	// Ref is the branch, tag or commit, the default branch when it's empty
+	Ref string `json:"ref,omitempty"`
+	// Subdirectory is the directory of the chart, it's required when the repository has more than one
+	Subdirectory string `json:"subdirectory,omitempty"`
+	// Token authenticates to a private repository, it's used for this import only and isn't stored
+	Token string `json:"token,omitempty"`
+}
+
+func (r ImportGitRequest) validate() error {
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	if r.URL == "" {
+		return errors.New("url is required")
+	}
+	return nil
+}
+
+// ImportGit imports a chart from a Git repository and responds with the new workspace
+func ImportGit(w http.ResponseWriter, r *http.Request) {
+	var req ImportGitRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	chart, err := importGitChart(r.Context(), gitimport.Source{
+		URL:          req.URL,
+		Ref:          req.Ref,
+		Subdirectory: req.Subdirectory,
+		Token:        req.Token,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gitimport.ErrInvalidSource), errors.Is(err, gitimport.ErrFetchFailed):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		case errors.Is(err, gitimport.ErrNoChart), errors.Is(err, gitimport.ErrMultipleCharts),
+			errors.Is(err, gitimport.ErrTooManyFiles), errors.Is(err, gitimport.ErrFileTooLarge):
+			writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to import chart from git: %w", err), zap.String("url", req.URL))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to import chart"})
+		}
+		return
+	}
+
+	// the directory the chart was found in is recorded even when it wasn't given
+	subdirectory := chart.Dir
+	if subdirectory == "." {
+		subdirectory = ""
+	}
+	created, err := createWorkspaceFromImport(r.Context(), req.UserID, chart.Name, chart.Files, workspacetypes.WorkspaceSource{
+		URL:          req.URL,
+		Ref:          req.Ref,
+		Subdirectory: subdirectory,
+		CommitSHA:    chart.CommitSHA,
+	}, workspace.ImportOpts{
+		ImportType:      workspacetypes.ImportTypeHelm,
+		SkippedBinaries: chart.SkippedBinaries,
+		BinaryFiles:     chart.BinaryFiles,
+		Progress:        importProgressReporter(r.Context(), req.UserID),
+	})
+	if errors.Is(err, workspace.ErrInvalidEncoding) || errors.Is(err, workspace.ErrInvalidImport) {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to create workspace from git import: %w", err), zap.String("url", req.URL))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create workspace"})
+		return
+	}
+
+	sendImportedWorkspaceEvents(r.Context(), req.UserID, created)
+
+	logger.InfoCtx(r.Context(), "Imported chart from git",
+		zap.String("workspaceID", created.ID),
+		zap.String("url", req.URL),
+		zap.String("commitSHA", chart.CommitSHA))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// ImportArchiveRequest is the form of POST /api/workspace/import/archive, it creates a workspace
+// from a chart in an uploaded archive. The archive is the form's file field.
+type ImportArchiveRequest struct {
+	UserID string
+	// ImportType is what the archive has, a Helm chart when it's empty. Kubernetes manifests are
+	// converted to a chart from the app, they can't be imported here.
+	ImportType workspacetypes.ImportType
+}
+
+func (r ImportArchiveRequest) validate() error {
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	switch r.ImportType {
+	case "", workspacetypes.ImportTypeHelm:
+	case workspacetypes.ImportTypeK8s:
+		return errors.New("archives of Kubernetes manifests are converted to a chart from the app, only helm archives can be imported here")
+	default:
+		return fmt.Errorf("importType %q is not helm or k8s", r.ImportType)
+	}
+	return nil
+}
+
+// ImportArchive imports a chart from an uploaded tar or tgz archive and responds with the new
+// workspace, with the report of validating its files
+func ImportArchive(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveRequestBytes)
+	if err := r.ParseMultipartForm(maxArchiveRequestBytes); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+	req := ImportArchiveRequest{
+		UserID:     r.FormValue("userId"),
+		ImportType: workspacetypes.ImportType(r.FormValue("importType")),
+	}
+	if err := req.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "file is required"})
+		return
+	}
+	defer file.Close()
+
+	archive, err := readArchive(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, archiveimport.ErrInvalidArchive):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		case errors.Is(err, archiveimport.ErrTooManyFiles):
+			writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to read archive: %w", err), zap.String("archive", header.Filename))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to import chart"})
+		}
+		return
+	}
+
+	chartName := archive.Name
+	if chartName == "" {
+		chartName = archiveBaseName(header.Filename)
+	}
+	created, err := createWorkspaceFromImport(r.Context(), req.UserID, chartName, archive.Files, workspacetypes.WorkspaceSource{}, workspace.ImportOpts{
+		ImportType:      workspacetypes.ImportTypeHelm,
+		ArchiveName:     header.Filename,
+		SkippedBinaries: len(archive.BinaryFiles),
+		BinaryFiles:     archive.BinaryFiles,
+		OversizedFiles:  archive.OversizedFiles,
+		Progress:        importProgressReporter(r.Context(), req.UserID),
+	})
+	if errors.Is(err, workspace.ErrInvalidEncoding) || errors.Is(err, workspace.ErrInvalidImport) {
+		writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to create workspace from archive import: %w", err), zap.String("archive", header.Filename))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create workspace"})
+		return
+	}
+
+	sendImportedWorkspaceEvents(r.Context(), req.UserID, created)
+
+	logger.InfoCtx(r.Context(), "Imported chart from archive",
+		zap.String("workspaceID", created.ID),
+		zap.String("archive", header.Filename))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// archiveBaseName is the name of an archive without its extension, the name of a chart whose
+// Chart.yaml has none
+func archiveBaseName(filename string) string {
+	name := path.Base(filename)
+	for _, ext := range []string{".tgz", ".tar.gz", ".tar"} {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// importProgressReporter sends the progress of an import to the user importing the chart
+func importProgressReporter(ctx context.Context, userID string) func(workspaceID string, progress workspacetypes.ImportProgress) {
+	return func(workspaceID string, progress workspacetypes.ImportProgress) {
+		// the progress is stored on the workspace, clients that miss an event get it with it
+		if err := sendImportProgress(ctx, userID, workspaceID, progress); err != nil {
+			logger.WarnCtx(ctx, "Failed to send import progress", zap.String("workspaceID", workspaceID), zap.Error(err))
+		}
+	}
+}
+
+// sendImportedWorkspaceEvents tells the user importing a chart about the secrets in its files and
+// the report of validating them. Both are stored, a failed send is only logged.
+func sendImportedWorkspaceEvents(ctx context.Context, userID string, created *workspacetypes.Workspace) {
+	if err := sendImportSecretFindings(ctx, userID, created.ID, created.CurrentRevision); err != nil {
+		logger.WarnCtx(ctx, "Failed to send secret findings", zap.String("workspaceID", created.ID), zap.Error(err))
+	}
+	if created.ImportReport != nil {
+		if err := sendImportReport(ctx, userID, created.ID, *created.ImportReport); err != nil {
+			logger.WarnCtx(ctx, "Failed to send import report", zap.String("workspaceID", created.ID), zap.Error(err))
+		}
+	}
+}
+
+// sendImportProgressEvent sends the progress of an import to the user importing the chart, and
+// the stats of the import when it's complete
+func sendImportProgressEvent(ctx context.Context, userID string, workspaceID string, progress workspacetypes.ImportProgress) error {
+	recipient := realtimetypes.Recipient{UserIDs: []string{userID}}
+	if progress.Status == workspacetypes.ImportStatusComplete && progress.Stats != nil {
+		return realtime.SendEvent(ctx, recipient, realtimetypes.ImportCompleteEvent{
+			WorkspaceID: workspaceID,
+			Stats:       *progress.Stats,
+		})
+	}
+	return realtime.SendEvent(ctx, recipient, realtimetypes.ImportProgressEvent{
+		WorkspaceID: workspaceID,
+		Progress:    progress,
+	})
+}
+
+// sendImportReportEvent sends the report of validating an imported chart to the user importing it
+func sendImportReportEvent(ctx context.Context, userID string, workspaceID string, report workspacetypes.ImportReport) error {
+	return realtime.SendEvent(ctx, realtimetypes.Recipient{UserIDs: []string{userID}}, realtimetypes.ImportReportEvent{
+		WorkspaceID: workspaceID,
+		Report:      report,
+	})
+}
+
+// sendImportSecretFindingsEvent warns the user importing a chart about the secrets in its files
+func sendImportSecretFindingsEvent(ctx context.Context, userID string, workspaceID string, revisionNumber int) error {
+	findings, err := workspace.ListSecretFindings(ctx, workspaceID, revisionNumber)
+	if err != nil {
+		return fmt.Errorf("failed to list secret findings: %w", err)
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	return realtime.SendEvent(ctx, realtimetypes.Recipient{UserIDs: []string{userID}}, realtimetypes.SecretFindingsEvent{
+		WorkspaceID: workspaceID,
+		Findings:    findings,
+	})
+}
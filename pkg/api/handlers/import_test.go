@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/archiveimport"
+	"github.com/replicatedhq/chartsmith/pkg/gitimport"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importedReport is the report of the workspaces the stubbed createWorkspaceFromImport creates
+var importedReport = types.ImportReport{Findings: []types.ImportFinding{
+	{Category: types.ImportFindingBinaryFile, Severity: types.ImportFindingWarning, Path: "a.png", Message: "the file is binary and wasn't imported"},
+}}
+
+// importEvents are the realtime events an import sent
+type importEvents struct {
+	progress []types.ImportProgress
+	secrets  []string
+	reports  []types.ImportReport
+}
+
+// stubImportEvents records the realtime events of an import, failing every send. It also restores
+// createWorkspaceFromImport.
+func stubImportEvents(t *testing.T) *importEvents {
+	originalCreate, originalProgress, originalSecrets, originalReport := createWorkspaceFromImport, sendImportProgress, sendImportSecretFindings, sendImportReport
+	t.Cleanup(func() {
+		createWorkspaceFromImport, sendImportProgress, sendImportSecretFindings, sendImportReport = originalCreate, originalProgress, originalSecrets, originalReport
+	})
+
+	events := &importEvents{progress: []types.ImportProgress{}, secrets: []string{}, reports: []types.ImportReport{}}
+	sendImportProgress = func(ctx context.Context, userID string, workspaceID string, progress types.ImportProgress) error {
+		assert.Equal(t, "user", userID)
+		assert.Equal(t, "ws", workspaceID)
+		events.progress = append(events.progress, progress)
+		return errors.New("realtime is down")
+	}
+	sendImportSecretFindings = func(ctx context.Context, userID string, workspaceID string, revisionNumber int) error {
+		assert.Equal(t, "user", userID)
+		assert.Equal(t, 1, revisionNumber)
+		events.secrets = append(events.secrets, workspaceID)
+		return errors.New("realtime is down")
+	}
+	sendImportReport = func(ctx context.Context, userID string, workspaceID string, report types.ImportReport) error {
+		assert.Equal(t, "user", userID)
+		assert.Equal(t, "ws", workspaceID)
+		events.reports = append(events.reports, report)
+		return errors.New("realtime is down")
+	}
+	return events
+}
+
+func TestImportGit(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		importErr  error
+		createErr  error
+		want       int
+		wantBody   string
+		wantSource *types.WorkspaceSource
+	}{
+		{
+			name:       "imported",
+			body:       `{"userId":"user","url":"https://github.com/org/charts","ref":"main","token":"s3cret"}`,
+			want:       http.StatusCreated,
+			wantBody:   `"id":"ws"`,
+			wantSource: &types.WorkspaceSource{URL: "https://github.com/org/charts", Ref: "main", Subdirectory: "charts/nginx", CommitSHA: "abc123"},
+		},
+		{name: "missing url", body: `{"userId":"user"}`, want: http.StatusBadRequest, wantBody: "url is required"},
+		{name: "missing user", body: `{"url":"https://github.com/org/charts"}`, want: http.StatusBadRequest, wantBody: "userId is required"},
+		{
+			name:      "invalid source",
+			body:      `{"userId":"user","url":"http://github.com/org/charts"}`,
+			importErr: fmt.Errorf("%w: only https URLs can be imported", gitimport.ErrInvalidSource),
+			want:      http.StatusBadRequest,
+			wantBody:  "only https URLs can be imported",
+		},
+		{
+			name:      "fetch failed",
+			body:      `{"userId":"user","url":"https://github.com/org/private"}`,
+			importErr: fmt.Errorf("%w: authentication failed", gitimport.ErrFetchFailed),
+			want:      http.StatusBadRequest,
+			wantBody:  "failed to fetch repository",
+		},
+		{
+			name:      "multiple charts",
+			body:      `{"userId":"user","url":"https://github.com/org/charts"}`,
+			importErr: fmt.Errorf("%w: a, b", gitimport.ErrMultipleCharts),
+			want:      http.StatusUnprocessableEntity,
+			wantBody:  "a, b",
+		},
+		{
+			name:      "too large",
+			body:      `{"userId":"user","url":"https://github.com/org/charts"}`,
+			importErr: fmt.Errorf("%w: blob.bin larger than the limit", gitimport.ErrFileTooLarge),
+			want:      http.StatusUnprocessableEntity,
+			wantBody:  "blob.bin",
+		},
+		{
+			name:      "import error",
+			body:      `{"userId":"user","url":"https://github.com/org/charts"}`,
+			importErr: errors.New("disk full"),
+			want:      http.StatusInternalServerError,
+			wantBody:  "failed to import chart",
+		},
+		{
+			name:      "invalid encoding",
+			body:      `{"userId":"user","url":"https://github.com/org/charts"}`,
+			createErr: fmt.Errorf("%w: templates/configmap.yaml", workspace.ErrInvalidEncoding),
+			want:      http.StatusUnprocessableEntity,
+			wantBody:  "not valid UTF-8: templates/configmap.yaml",
+		},
+		{
+			name:      "invalid import",
+			body:      `{"userId":"user","url":"https://github.com/org/charts"}`,
+			createErr: fmt.Errorf("%w: there's no Chart.yaml at the root of the imported files", workspace.ErrInvalidImport),
+			want:      http.StatusUnprocessableEntity,
+			wantBody:  "no Chart.yaml at the root",
+		},
+		{
+			name:      "create error",
+			body:      `{"userId":"user","url":"https://github.com/org/charts"}`,
+			createErr: errors.New("connection refused"),
+			want:      http.StatusInternalServerError,
+			wantBody:  "failed to create workspace",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalImport := importGitChart
+			t.Cleanup(func() { importGitChart = originalImport })
+
+			importGitChart = func(ctx context.Context, source gitimport.Source) (*gitimport.ImportedChart, error) {
+				if tt.importErr != nil {
+					return nil, tt.importErr
+				}
+				assert.Equal(t, strings.Contains(tt.body, "s3cret"), source.Token == "s3cret")
+				return &gitimport.ImportedChart{Name: "nginx", Dir: "charts/nginx", CommitSHA: "abc123", Files: []types.File{{FilePath: "Chart.yaml"}}, SkippedBinaries: 2, BinaryFiles: []string{"a.png", "b.png"}}, nil
+			}
+			var gotSource *types.WorkspaceSource
+			events := stubImportEvents(t)
+			createWorkspaceFromImport = func(ctx context.Context, userID string, chartName string, files []types.File, source types.WorkspaceSource, opts workspace.ImportOpts) (*types.Workspace, error) {
+				if tt.createErr != nil {
+					return nil, tt.createErr
+				}
+				assert.Equal(t, "user", userID)
+				assert.Equal(t, "nginx", chartName)
+				assert.Len(t, files, 1)
+				assert.Equal(t, 2, opts.SkippedBinaries)
+				assert.Equal(t, []string{"a.png", "b.png"}, opts.BinaryFiles)
+				assert.Equal(t, types.ImportTypeHelm, opts.ImportType)
+				assert.Empty(t, opts.ArchiveName)
+				gotSource = &source
+				opts.Progress("ws", types.ImportProgress{Status: types.ImportStatusComplete, FilesProcessed: 1, FilesTotal: 1})
+				return &types.Workspace{ID: "ws", CurrentRevision: 1, Source: &source, ImportReport: &importedReport}, nil
+			}
+
+			rec := httptest.NewRecorder()
+			ImportGit(rec, httptest.NewRequest(http.MethodPost, "/api/workspace/import/git", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "s3cret")
+			if tt.wantSource != nil {
+				require.NotNil(t, gotSource)
+				assert.Equal(t, *tt.wantSource, *gotSource)
+				assert.Equal(t, []types.ImportProgress{{Status: types.ImportStatusComplete, FilesProcessed: 1, FilesTotal: 1}}, events.progress)
+				assert.Equal(t, []string{"ws"}, events.secrets)
+				assert.Equal(t, []types.ImportReport{importedReport}, events.reports)
+				assert.Contains(t, rec.Body.String(), `"importReport":{"findings":[{"category":"binary_file"`)
+			}
+		})
+	}
+}
+
+// archiveForm is a multipart form with the fields and, when archive isn't nil, an archive named
+// nginx-1.0.0.tgz
+func archiveForm(t *testing.T, fields map[string]string, archive []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.NoError(t, form.WriteField(name, value))
+	}
+	if archive != nil {
+		part, err := form.CreateFormFile("file", "nginx-1.0.0.tgz")
+		require.NoError(t, err)
+		_, err = part.Write(archive)
+		require.NoError(t, err)
+	}
+	require.NoError(t, form.Close())
+	return &body, form.FormDataContentType()
+}
+
+func TestImportArchive(t *testing.T) {
+	tests := []struct {
+		name      string
+		fields    map[string]string
+		noFile    bool
+		readErr   error
+		chartName string
+		createErr error
+		want      int
+		wantBody  string
+		wantName  string
+	}{
+		{name: "imported", fields: map[string]string{"userId": "user", "importType": "helm"}, chartName: "nginx", want: http.StatusCreated, wantBody: `"importReport"`, wantName: "nginx"},
+		{name: "named after the archive", fields: map[string]string{"userId": "user"}, want: http.StatusCreated, wantBody: `"id":"ws"`, wantName: "nginx-1.0.0"},
+		{name: "missing user", fields: map[string]string{}, want: http.StatusBadRequest, wantBody: "userId is required"},
+		{name: "manifests", fields: map[string]string{"userId": "user", "importType": "k8s"}, want: http.StatusBadRequest, wantBody: "only helm archives can be imported here"},
+		{name: "unknown import type", fields: map[string]string{"userId": "user", "importType": "zip"}, want: http.StatusBadRequest, wantBody: `importType \"zip\" is not helm or k8s`},
+		{name: "missing file", fields: map[string]string{"userId": "user"}, noFile: true, want: http.StatusBadRequest, wantBody: "file is required"},
+		{
+			name:     "invalid archive",
+			fields:   map[string]string{"userId": "user"},
+			readErr:  fmt.Errorf("%w: gzip: invalid header", archiveimport.ErrInvalidArchive),
+			want:     http.StatusBadRequest,
+			wantBody: "gzip: invalid header",
+		},
+		{
+			name:     "too many files",
+			fields:   map[string]string{"userId": "user"},
+			readErr:  fmt.Errorf("%w: the limit is 1000", archiveimport.ErrTooManyFiles),
+			want:     http.StatusUnprocessableEntity,
+			wantBody: "the limit is 1000",
+		},
+		{
+			name:      "no Chart.yaml",
+			fields:    map[string]string{"userId": "user"},
+			createErr: fmt.Errorf("%w: there's no Chart.yaml at the root of the imported files, they aren't a Helm chart", workspace.ErrInvalidImport),
+			want:      http.StatusUnprocessableEntity,
+			wantBody:  "aren't a Helm chart",
+			wantName:  "nginx-1.0.0",
+		},
+		{
+			name:      "create error",
+			fields:    map[string]string{"userId": "user"},
+			createErr: errors.New("connection refused"),
+			want:      http.StatusInternalServerError,
+			wantBody:  "failed to create workspace",
+			wantName:  "nginx-1.0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := stubImportEvents(t)
+			originalRead := readArchive
+			t.Cleanup(func() { readArchive = originalRead })
+
+			readArchive = func(r io.Reader) (*archiveimport.ImportedArchive, error) {
+				content, err := io.ReadAll(r)
+				require.NoError(t, err)
+				assert.Equal(t, "archive", string(content))
+				if tt.readErr != nil {
+					return nil, tt.readErr
+				}
+				return &archiveimport.ImportedArchive{
+					Name:           tt.chartName,
+					Files:          []types.File{{FilePath: "Chart.yaml"}},
+					BinaryFiles:    []string{"a.png"},
+					OversizedFiles: []string{"files/dump.sql"},
+				}, nil
+			}
+			var gotName string
+			createWorkspaceFromImport = func(ctx context.Context, userID string, chartName string, files []types.File, source types.WorkspaceSource, opts workspace.ImportOpts) (*types.Workspace, error) {
+				gotName = chartName
+				if tt.createErr != nil {
+					return nil, tt.createErr
+				}
+				assert.Equal(t, "user", userID)
+				assert.Len(t, files, 1)
+				assert.Equal(t, types.WorkspaceSource{}, source)
+				assert.Equal(t, types.ImportTypeHelm, opts.ImportType)
+				assert.Equal(t, "nginx-1.0.0.tgz", opts.ArchiveName)
+				assert.Equal(t, 1, opts.SkippedBinaries)
+				assert.Equal(t, []string{"a.png"}, opts.BinaryFiles)
+				assert.Equal(t, []string{"files/dump.sql"}, opts.OversizedFiles)
+				opts.Progress("ws", types.ImportProgress{Status: types.ImportStatusComplete, FilesProcessed: 1, FilesTotal: 1})
+				return &types.Workspace{ID: "ws", CurrentRevision: 1, ImportReport: &importedReport}, nil
+			}
+
+			var archive []byte
+			if !tt.noFile {
+				archive = []byte("archive")
+			}
+			body, contentType := archiveForm(t, tt.fields, archive)
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/import/archive", body)
+			req.Header.Set("Content-Type", contentType)
+			rec := httptest.NewRecorder()
+			ImportArchive(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantName, gotName)
+			if tt.want == http.StatusCreated {
+				assert.Len(t, events.progress, 1)
+				assert.Equal(t, []string{"ws"}, events.secrets)
+				assert.Equal(t, []types.ImportReport{importedReport}, events.reports)
+			} else {
+				assert.Empty(t, events.reports)
+			}
+		})
+	}
+}
+
+func TestArchiveBaseName(t *testing.T) {
+	assert.Equal(t, "nginx-1.0.0", archiveBaseName("nginx-1.0.0.tgz"))
+	assert.Equal(t, "nginx", archiveBaseName("uploads/nginx.tar.gz"))
+	assert.Equal(t, "nginx", archiveBaseName("nginx.tar"))
+	assert.Equal(t, "nginx.zip", archiveBaseName("nginx.zip"))
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+)
+
+// InternalAPIKeyHeader carries the key other services authenticate to the internal API with
+const InternalAPIKeyHeader = "X-Internal-API-Key"
+
+// RequestIDHeader carries the ID of a request, it's generated when the caller doesn't send one
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID a caller can send, longer IDs are replaced
+const maxRequestIDLength = 64
+
+// maxRequestBytes limits the size of a request body, the payloads are a few IDs
+const maxRequestBytes = 1 << 16
+
+// these are vars so that the handlers can be tested without a database
+var (
+	enqueueWork           = persistence.EnqueueWorkReturningID
+	workspaceArchived     = workspace.IsWorkspaceArchived
+	fileWorkspaceArchived = workspace.IsFileWorkspaceArchived
+	checkExecutionLock    = workspace.CheckPlanExecutionLock
+	getExecutedPlan       = getPlan
+	createPlanRevision    = workspace.CreatePlanRevision
+)
+
+// RenderRequest is the body of POST /internal/render, it renders a revision of a workspace
+type RenderRequest struct {
+	WorkspaceID    string `json:"workspaceId"`
+	RevisionNumber int    `json:"revisionNumber"`
+	// ForceAll renders every chart, not only the charts that changed since the previous revision
+	ForceAll bool `json:"forceAll,omitempty"`
+	// ValuesProfile is the name of a values profile to layer over values.yaml, it renders every chart
+	ValuesProfile string `json:"valuesProfile,omitempty"`
+	// Debug renders every chart with helm template --debug. The debug output is only returned by
+	// GET /api/workspace/{id}/render/{renderID}/status.
+	Debug bool `json:"debug,omitempty"`
+}
+
+// ExecutePlanRequest is the body of POST /internal/plan/execute, it executes a plan that's been reviewed
+type ExecutePlanRequest struct {
+	PlanID string `json:"planId"`
+	// ReviewFiles waits for each action file to be approved or rejected before the plan is applied
+	ReviewFiles bool `json:"reviewFiles,omitempty"`
+	// CreateRevision proceeds with the plan first, it's marked proceeded and the revision it's
+	// applied to is created from the current revision. This is what the app does when a user
+	// proceeds with a plan.
+	CreateRevision bool `json:"createRevision,omitempty"`
+}
+
+// SummarizeRequest is the body of POST /internal/summarize, it summarizes and embeds a revision of a file
+type SummarizeRequest struct {
+	FileID   string `json:"fileId"`
+	Revision int    `json:"revision"`
+}
+
+// EnqueueResponse is the response to a request that enqueued work
+type EnqueueResponse struct {
+	// JobID is the ID of the message in the work queue
+	JobID string `json:"jobId"`
+	// RevisionNumber is the revision a plan executed with createRevision is applied to
+	RevisionNumber int `json:"revisionNumber,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// ExecutionLockedResponse is the 409 response to executing a plan while another plan of the
+// workspace is executing
+type ExecutionLockedResponse struct {
+	Error string `json:"error"`
+	// PlanID is the plan that's executing
+	PlanID string `json:"planId"`
+}
+
+func (r RenderRequest) validate() error {
+	if r.WorkspaceID == "" {
+		return errors.New("workspaceId is required")
+	}
+	if r.RevisionNumber < 1 {
+		return errors.New("revisionNumber must be at least 1")
+	}
+	if r.ValuesProfile != "" {
+		if err := workspace.ValidateValuesProfile(r.ValuesProfile, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r ExecutePlanRequest) validate() error {
+	if r.PlanID == "" {
+		return errors.New("planId is required")
+	}
+	return nil
+}
+
+func (r SummarizeRequest) validate() error {
+	if r.FileID == "" {
+		return errors.New("fileId is required")
+	}
+	if r.Revision < 0 {
+		return errors.New("revision must not be negative")
+	}
+	return nil
+}
+
+// RequireInternalAPIKey only passes requests with the internal API key on to next. With no key
+// configured the internal API is disabled and every request is refused.
+func RequireInternalAPIKey(apiKey string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" {
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "internal API is not configured"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(InternalAPIKeyHeader)), []byte(apiKey)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid internal API key"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithRequestID adds the ID of each request to the lines logged while it's handled, see
+// logger.WithFields, and sends the ID back in the response
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			id, err := securerandom.Hex(8)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			requestID = id
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(logger.WithFields(r.Context(), zap.String("requestID", requestID))))
+	})
+}
+
+// Render enqueues a render of a workspace revision, the listener creates the render job
+func Render(w http.ResponseWriter, r *http.Request) {
+	var req RenderRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if refuseRole(w, r.Context(), req.WorkspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+	if refuseArchived(w, r.Context(), workspaceArchived, req.WorkspaceID) {
+		return
+	}
+	payload := map[string]interface{}{
+		"workspaceId":    req.WorkspaceID,
+		"revisionNumber": req.RevisionNumber,
+		"forceAll":       req.ForceAll,
+	}
+	if req.ValuesProfile != "" {
+		payload["valuesProfile"] = req.ValuesProfile
+	}
+	if req.Debug {
+		payload["debug"] = true
+	}
+	enqueue(w, r.Context(), "render_workspace", payload)
+}
+
+// ExecutePlan enqueues the execution of a plan
+func ExecutePlan(w http.ResponseWriter, r *http.Request) {
+	var req ExecutePlanRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	plan, err := getExecutedPlan(r.Context(), req.PlanID)
+	if err != nil {
+		writePlanError(w, r, err, "failed to get plan", "", req.PlanID)
+		return
+	}
+	if refuseRole(w, r.Context(), plan.WorkspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+	if err := checkExecutionLock(r.Context(), req.PlanID); err != nil {
+		if !writeExecutionLocked(w, err) {
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to check execution lock: %w", err), zap.String("planID", req.PlanID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to enqueue work"})
+		}
+		return
+	}
+	payload := map[string]interface{}{
+		"planId": req.PlanID,
+	}
+	if req.ReviewFiles {
+		payload["reviewFiles"] = true
+	}
+	if !req.CreateRevision {
+		enqueue(w, r.Context(), "execute_plan", payload)
+		return
+	}
+
+	// the lock is checked again with the revision, a plan can start executing since the check above
+	revisionNumber, err := createPlanRevision(r.Context(), req.PlanID, requestUserID(r))
+	if err != nil {
+		writePlanError(w, r, err, "failed to create revision", plan.WorkspaceID, req.PlanID)
+		return
+	}
+	recordAudit(r.Context(), plan.WorkspaceID, workspace.AuditActorUser, workspace.AuditPlanProceeded, map[string]interface{}{
+		"planId":         req.PlanID,
+		"revisionNumber": revisionNumber,
+	})
+
+	if id, ok := enqueueJob(w, r.Context(), "execute_plan", payload); ok {
+		writeJSON(w, http.StatusAccepted, EnqueueResponse{JobID: id, RevisionNumber: revisionNumber})
+	}
+}
+
+// Summarize enqueues the summary and embeddings of a file revision
+func Summarize(w http.ResponseWriter, r *http.Request) {
+	var req SummarizeRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if refuseArchived(w, r.Context(), fileWorkspaceArchived, req.FileID) {
+		return
+	}
+	enqueue(w, r.Context(), "new_summarize", map[string]interface{}{
+		"fileId":   req.FileID,
+		"revision": req.Revision,
+	})
+}
+
+// decode reads and validates a request body, writing a 400 and returning false if it's invalid
+func decode(w http.ResponseWriter, r *http.Request, req interface{ validate() error }) bool {
+	return decodeLimited(w, r, req, maxRequestBytes)
+}
+
+// decodeLimited is decode for bodies that can be larger than maxRequestBytes, such as ones with
+// file contents
+func decodeLimited(w http.ResponseWriter, r *http.Request, req interface{ validate() error }, maxBytes int64) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return false
+	}
+	if err := req.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+// refuseArchived writes a 409 and returns true when the workspace that id is or belongs to is
+// archived, nothing is enqueued for archived workspaces
+func refuseArchived(w http.ResponseWriter, ctx context.Context, archived func(context.Context, string) (bool, error), id string) bool {
+	isArchived, err := archived(ctx, id)
+	if err != nil {
+		logger.ErrorCtx(ctx, fmt.Errorf("failed to check if workspace is archived: %w", err), zap.String("id", id))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to enqueue work"})
+		return true
+	}
+	if isArchived {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: workspace.ErrWorkspaceArchived.Error()})
+		return true
+	}
+	return false
+}
+
+// writeExecutionLocked writes a 409 with the executing plan and returns true when err is a plan
+// refused by the execution lock of its workspace
+func writeExecutionLocked(w http.ResponseWriter, err error) bool {
+	var lockedErr *workspace.ExecutionLockedError
+	if !errors.As(err, &lockedErr) {
+		return false
+	}
+	writeJSON(w, http.StatusConflict, ExecutionLockedResponse{Error: lockedErr.Error(), PlanID: lockedErr.PlanID})
+	return true
+}
+
+func enqueue(w http.ResponseWriter, ctx context.Context, channel string, payload map[string]interface{}) {
+	if id, ok := enqueueJob(w, ctx, channel, payload); ok {
+		writeJSON(w, http.StatusAccepted, EnqueueResponse{JobID: id})
+	}
+}
+
+// enqueueJob enqueues work and returns its job ID, writing a 500 and returning false if it fails
+func enqueueJob(w http.ResponseWriter, ctx context.Context, channel string, payload map[string]interface{}) (string, bool) {
+	id, err := enqueueWork(ctx, channel, payload)
+	if err != nil {
+		logger.ErrorCtx(ctx, fmt.Errorf("failed to enqueue work from internal API: %w", err), zap.String("channel", channel))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to enqueue work"})
+		return "", false
+	}
+
+	logger.InfoCtx(ctx, "Enqueued work from internal API", zap.String("channel", channel), zap.String("jobID", id))
+	return id, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type enqueued struct {
+	channel string
+	payload interface{}
+}
+
+// stubEnqueue replaces the work queue with a slice of the enqueued messages, for workspaces that
+// aren't archived
+func stubEnqueue(t *testing.T, err error) *[]enqueued {
+	stubArchived(t, false)
+	stubExecutionLock(t, nil)
+	stubExecutedPlan(t)
+
+	messages := []enqueued{}
+	original := enqueueWork
+	enqueueWork = func(ctx context.Context, channel string, payload interface{}) (string, error) {
+		if err != nil {
+			return "", err
+		}
+		messages = append(messages, enqueued{channel: channel, payload: payload})
+		return "job-1", nil
+	}
+	t.Cleanup(func() { enqueueWork = original })
+	return &messages
+}
+
+// stubArchived makes every workspace archived or not
+func stubArchived(t *testing.T, archived bool) {
+	originalWorkspace, originalFile := workspaceArchived, fileWorkspaceArchived
+	workspaceArchived = func(ctx context.Context, workspaceID string) (bool, error) { return archived, nil }
+	fileWorkspaceArchived = func(ctx context.Context, fileID string) (bool, error) { return archived, nil }
+	t.Cleanup(func() { workspaceArchived, fileWorkspaceArchived = originalWorkspace, originalFile })
+}
+
+// stubExecutionLock makes checking the execution lock of every plan return err
+func stubExecutionLock(t *testing.T, err error) {
+	original := checkExecutionLock
+	checkExecutionLock = func(ctx context.Context, planID string) error { return err }
+	t.Cleanup(func() { checkExecutionLock = original })
+}
+
+// stubExecutedPlan makes every plan a plan of workspace ws, unknown plans are named missing
+func stubExecutedPlan(t *testing.T) {
+	original := getExecutedPlan
+	getExecutedPlan = func(ctx context.Context, planID string) (*workspacetypes.Plan, error) {
+		if planID == "missing" {
+			return nil, fmt.Errorf("%w: %s", workspace.ErrNoPlan, planID)
+		}
+		return &workspacetypes.Plan{ID: planID, WorkspaceID: "ws"}, nil
+	}
+	t.Cleanup(func() { getExecutedPlan = original })
+}
+
+func TestRequireInternalAPIKey(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		configured string
+		header     string
+		want       int
+	}{
+		{name: "valid key", configured: "secret", header: "secret", want: http.StatusNoContent},
+		{name: "wrong key", configured: "secret", header: "guess", want: http.StatusUnauthorized},
+		{name: "missing key", configured: "secret", header: "", want: http.StatusUnauthorized},
+		{name: "not configured", configured: "", header: "", want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/internal/render", nil)
+			if tt.header != "" {
+				req.Header.Set(InternalAPIKeyHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			RequireInternalAPIKey(tt.configured, next).ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	var got []zap.Field
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = logger.Fields(r.Context())
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		// want is the request ID, empty when it's generated
+		want string
+	}{
+		{name: "sent by the caller", header: "req-123", want: "req-123"},
+		{name: "not sent", header: ""},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/internal/render", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			WithRequestID(next).ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(RequestIDHeader)
+			if tt.want != "" {
+				assert.Equal(t, tt.want, requestID)
+			} else {
+				assert.Len(t, requestID, 16)
+			}
+			assert.Equal(t, []zap.Field{zap.String("requestID", requestID)}, got)
+		})
+	}
+}
+
+func TestHandlersEnqueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		body        string
+		wantChannel string
+		wantPayload map[string]interface{}
+	}{
+		{
+			name:        "render",
+			handler:     Render,
+			body:        `{"workspaceId":"ws","revisionNumber":2}`,
+			wantChannel: "render_workspace",
+			wantPayload: map[string]interface{}{"workspaceId": "ws", "revisionNumber": 2, "forceAll": false},
+		},
+		{
+			name:        "render with values profile",
+			handler:     Render,
+			body:        `{"workspaceId":"ws","revisionNumber":2,"valuesProfile":"prod"}`,
+			wantChannel: "render_workspace",
+			wantPayload: map[string]interface{}{"workspaceId": "ws", "revisionNumber": 2, "forceAll": false, "valuesProfile": "prod"},
+		},
+		{
+			name:        "debug render",
+			handler:     Render,
+			body:        `{"workspaceId":"ws","revisionNumber":2,"debug":true}`,
+			wantChannel: "render_workspace",
+			wantPayload: map[string]interface{}{"workspaceId": "ws", "revisionNumber": 2, "forceAll": false, "debug": true},
+		},
+		{
+			name:        "execute plan",
+			handler:     ExecutePlan,
+			body:        `{"planId":"plan"}`,
+			wantChannel: "execute_plan",
+			wantPayload: map[string]interface{}{"planId": "plan"},
+		},
+		{
+			name:        "execute plan with file review",
+			handler:     ExecutePlan,
+			body:        `{"planId":"plan","reviewFiles":true}`,
+			wantChannel: "execute_plan",
+			wantPayload: map[string]interface{}{"planId": "plan", "reviewFiles": true},
+		},
+		{
+			name:        "summarize",
+			handler:     Summarize,
+			body:        `{"fileId":"file","revision":3}`,
+			wantChannel: "new_summarize",
+			wantPayload: map[string]interface{}{"fileId": "file", "revision": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := stubEnqueue(t, nil)
+
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			require.Equal(t, http.StatusAccepted, rec.Code)
+			var resp EnqueueResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, "job-1", resp.JobID)
+
+			require.Len(t, *messages, 1)
+			assert.Equal(t, tt.wantChannel, (*messages)[0].channel)
+			assert.Equal(t, tt.wantPayload, (*messages)[0].payload)
+		})
+	}
+}
+
+func TestHandlersRejectInvalidPayloads(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		want    string
+	}{
+		{name: "render without workspace", handler: Render, body: `{"revisionNumber":1}`, want: "workspaceId is required"},
+		{name: "render without revision", handler: Render, body: `{"workspaceId":"ws"}`, want: "revisionNumber must be at least 1"},
+		{name: "render with invalid values profile", handler: Render, body: `{"workspaceId":"ws","revisionNumber":1,"valuesProfile":"../prod"}`, want: "invalid profile name"},
+		{name: "execute without plan", handler: ExecutePlan, body: `{}`, want: "planId is required"},
+		{name: "summarize without file", handler: Summarize, body: `{"revision":1}`, want: "fileId is required"},
+		{name: "unknown field", handler: ExecutePlan, body: `{"planId":"plan","status":"applied"}`, want: "unknown field"},
+		{name: "not json", handler: Summarize, body: `fileId=file`, want: "invalid request body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := stubEnqueue(t, nil)
+
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.want)
+			assert.Empty(t, *messages)
+		})
+	}
+}
+
+func TestHandlersEnqueueFailure(t *testing.T) {
+	stubEnqueue(t, errors.New("database unavailable"))
+
+	rec := httptest.NewRecorder()
+	ExecutePlan(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"planId":"plan"}`)))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "database unavailable")
+}
+
+func TestExecutePlanRefusedWhileAnotherPlanExecutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "locked", err: &workspace.ExecutionLockedError{WorkspaceID: "ws", PlanID: "executing"}, want: http.StatusConflict, wantBody: `"planId":"executing"`},
+		{name: "database error", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to enqueue work"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := stubEnqueue(t, nil)
+			stubExecutionLock(t, tt.err)
+
+			rec := httptest.NewRecorder()
+			ExecutePlan(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"planId":"plan"}`)))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "connection refused")
+			assert.Empty(t, *messages)
+		})
+	}
+}
+
+func TestExecutePlanCreatesRevision(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		want         int
+		wantBody     string
+		wantEnqueued bool
+	}{
+		{name: "created", want: http.StatusAccepted, wantBody: `"revisionNumber":3`, wantEnqueued: true},
+		{name: "locked", err: &workspace.ExecutionLockedError{WorkspaceID: "ws", PlanID: "executing"}, want: http.StatusConflict, wantBody: `"planId":"executing"`},
+		{name: "database error", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to create revision"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := stubEnqueue(t, nil)
+			audited := stubAudit(t)
+			stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{"user-1": workspacetypes.WorkspaceRoleEditor})
+
+			var createdBy string
+			original := createPlanRevision
+			createPlanRevision = func(ctx context.Context, planID string, userID string) (int, error) {
+				createdBy = userID
+				return 3, tt.err
+			}
+			t.Cleanup(func() { createPlanRevision = original })
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"planId":"plan","createRevision":true}`))
+			ExecutePlan(rec, withUser(req, "user-1"))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "connection refused")
+			assert.Equal(t, "user-1", createdBy)
+			if tt.wantEnqueued {
+				assert.Equal(t, []enqueued{{channel: "execute_plan", payload: map[string]interface{}{"planId": "plan"}}}, *messages)
+				assert.Equal(t, []string{workspace.AuditPlanProceeded}, *audited)
+			} else {
+				assert.Empty(t, *messages)
+				assert.Empty(t, *audited)
+			}
+		})
+	}
+}
+
+func TestExecutePlanUnknownPlan(t *testing.T) {
+	messages := stubEnqueue(t, nil)
+
+	rec := httptest.NewRecorder()
+	ExecutePlan(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"planId":"missing"}`)))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no plan found")
+	assert.Empty(t, *messages)
+}
+
+func TestHandlersRefuseArchivedWorkspaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{name: "render", handler: Render, body: `{"workspaceId":"ws","revisionNumber":2}`},
+		{name: "summarize", handler: Summarize, body: `{"fileId":"file","revision":3}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := stubEnqueue(t, nil)
+			stubArchived(t, true)
+
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.Contains(t, rec.Body.String(), "workspace is archived")
+			assert.Empty(t, *messages)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	listWorkspaceMembers  = workspace.ListWorkspaceMembers
+	addWorkspaceMember    = workspace.AddWorkspaceMember
+	removeWorkspaceMember = workspace.RemoveWorkspaceMember
+)
+
+// ListWorkspaceMembersResponse is the response to GET /api/workspace/{id}/members
+type ListWorkspaceMembersResponse struct {
+	// Members are the creator of the workspace first, then the others in the order they were added
+	Members []workspacetypes.WorkspaceMember `json:"members"`
+}
+
+// SetWorkspaceMemberRequest is the body of PUT /api/workspace/{id}/members/{userID}
+type SetWorkspaceMemberRequest struct {
+	// Role is owner, editor or viewer
+	Role string `json:"role"`
+}
+
+func (r SetWorkspaceMemberRequest) validate() error {
+	_, err := workspace.ParseWorkspaceRole(r.Role)
+	return err
+}
+
+// ListWorkspaceMembers responds with the members of a workspace and their roles
+func ListWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	members, err := listWorkspaceMembers(r.Context(), workspaceID)
+	if err != nil {
+		writeMemberError(w, r, err, "failed to list workspace members", workspaceID, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListWorkspaceMembersResponse{Members: members})
+}
+
+// SetWorkspaceMember gives a user a role in a workspace, or changes the role of a member. Only
+// owners can.
+func SetWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	userID := r.PathValue("userID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleOwner) {
+		return
+	}
+
+	var req SetWorkspaceMemberRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	member, err := addWorkspaceMember(r.Context(), workspaceID, userID, workspacetypes.WorkspaceRole(req.Role))
+	if err != nil {
+		writeMemberError(w, r, err, "failed to set workspace member", workspaceID, userID)
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditMemberChanged, map[string]interface{}{
+		"userId": userID,
+		"role":   req.Role,
+	})
+
+	writeJSON(w, http.StatusOK, member)
+}
+
+// RemoveWorkspaceMember takes away the role of a member of a workspace. Only owners can.
+func RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	userID := r.PathValue("userID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleOwner) {
+		return
+	}
+
+	if err := removeWorkspaceMember(r.Context(), workspaceID, userID); err != nil {
+		writeMemberError(w, r, err, "failed to remove workspace member", workspaceID, userID)
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditMemberChanged, map[string]interface{}{
+		"userId": userID,
+		"role":   nil,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeMemberError(w http.ResponseWriter, r *http.Request, err error, message string, workspaceID string, userID string) {
+	switch {
+	case errors.Is(err, workspace.ErrWorkspaceNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "workspace not found"})
+	case errors.Is(err, workspace.ErrNotWorkspaceMember):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, workspace.ErrInvalidWorkspaceRole), errors.Is(err, workspace.ErrWorkspaceCreator):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	default:
+		logger.ErrorCtx(r.Context(), fmt.Errorf("%s: %w", message, err), zap.String("workspaceID", workspaceID), zap.String("userID", userID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: message})
+	}
+}
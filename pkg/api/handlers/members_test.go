@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetWorkspaceMember(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "added", body: `{"role": "editor"}`, want: http.StatusOK, wantBody: `"role":"editor"`},
+		{name: "unknown role", body: `{"role": "admin"}`, want: http.StatusBadRequest, wantBody: "role must be owner, editor or viewer"},
+		{name: "creator", body: `{"role": "viewer"}`, err: workspace.ErrWorkspaceCreator, want: http.StatusBadRequest, wantBody: "always an owner"},
+		{name: "unknown workspace", body: `{"role": "viewer"}`, err: workspace.ErrWorkspaceNotFound, want: http.StatusNotFound, wantBody: "workspace not found"},
+		{name: "database error", body: `{"role": "viewer"}`, err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to set workspace member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audited := stubAudit(t)
+			original := addWorkspaceMember
+			t.Cleanup(func() { addWorkspaceMember = original })
+			addWorkspaceMember = func(ctx context.Context, workspaceID string, userID string, role workspacetypes.WorkspaceRole) (*workspacetypes.WorkspaceMember, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/workspace/ws/members/jane", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("userID", "jane")
+			rec := httptest.NewRecorder()
+			SetWorkspaceMember(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.want == http.StatusOK {
+				assert.Equal(t, []string{workspace.AuditMemberChanged}, *audited)
+			} else {
+				assert.Empty(t, *audited)
+			}
+		})
+	}
+}
+
+func TestRemoveWorkspaceMember(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "removed", want: http.StatusNoContent},
+		{name: "not a member", err: workspace.ErrNotWorkspaceMember, want: http.StatusNotFound},
+		{name: "creator", err: workspace.ErrWorkspaceCreator, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubAudit(t)
+			original := removeWorkspaceMember
+			t.Cleanup(func() { removeWorkspaceMember = original })
+			removeWorkspaceMember = func(ctx context.Context, workspaceID string, userID string) error {
+				return tt.err
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/workspace/ws/members/jane", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("userID", "jane")
+			rec := httptest.NewRecorder()
+			RemoveWorkspaceMember(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// maxChatMessageRequestBytes leaves room for every attachment at its largest, escaped as JSON
+const maxChatMessageRequestBytes = 2*workspace.MaxChatAttachments*workspace.MaxChatAttachmentBytes + maxRequestBytes
+
+// createChatMessage is a var so that the handler can be tested without a database
+var createChatMessage = workspace.CreateChatMessageWithAttachments
+
+// ChatAttachmentUpload is a file uploaded with a chat message
+type ChatAttachmentUpload struct {
+	Filename string `json:"filename"`
+	// Content is the text of the file, binary files can't be attached
+	Content string `json:"content"`
+	// ContentType is guessed from the filename when it's empty
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// CreateChatMessageRequest is the body of POST /api/workspace/{id}/messages
+type CreateChatMessageRequest struct {
+	UserID      string                 `json:"userId"`
+	Prompt      string                 `json:"prompt"`
+	Attachments []ChatAttachmentUpload `json:"attachments,omitempty"`
+}
+
+func (r CreateChatMessageRequest) validate() error {
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	if strings.TrimSpace(r.Prompt) == "" {
+		return errors.New("prompt is required")
+	}
+	return workspace.ValidateChatAttachments(r.attachments())
+}
+
+func (r CreateChatMessageRequest) attachments() []workspacetypes.ChatAttachment {
+	attachments := []workspacetypes.ChatAttachment{}
+	for _, upload := range r.Attachments {
+		attachments = append(attachments, workspacetypes.ChatAttachment{
+			Filename:    upload.Filename,
+			Content:     upload.Content,
+			ContentType: upload.ContentType,
+		})
+	}
+	return attachments
+}
+
+// CreateChatMessage posts a chat message with files attached to it. The attachments are given to
+// the intent classifier and the planner along with the prompt.
+func CreateChatMessage(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+
+	var req CreateChatMessageRequest
+	if !decodeLimited(w, r, &req, maxChatMessageRequestBytes) {
+		return
+	}
+	if refuseRole(w, r.Context(), workspaceID, req.UserID, workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	chatMessage, err := createChatMessage(r.Context(), workspaceID, req.UserID, req.Prompt, req.attachments())
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrWorkspaceNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "workspace not found"})
+		case errors.Is(err, workspace.ErrWorkspaceArchived):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: workspace.ErrWorkspaceArchived.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to create chat message: %w", err), zap.String("workspaceID", workspaceID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create chat message"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, chatMessage)
+}
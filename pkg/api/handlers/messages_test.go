@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateChatMessage(t *testing.T) {
+	tooLarge := strings.Repeat("a", workspace.MaxChatAttachmentBytes+1)
+
+	tests := []struct {
+		name            string
+		body            string
+		err             error
+		want            int
+		wantBody        string
+		wantAttachments []workspacetypes.ChatAttachment
+	}{
+		{
+			name:     "with attachments",
+			body:     `{"userId": "user", "prompt": "deploy this", "attachments": [{"filename": "deployment.yaml", "content": "kind: Deployment\n"}, {"filename": "notes", "content": "hi", "contentType": "text/markdown"}]}`,
+			want:     http.StatusCreated,
+			wantBody: `"id":"chat"`,
+			wantAttachments: []workspacetypes.ChatAttachment{
+				{Filename: "deployment.yaml", Content: "kind: Deployment\n"},
+				{Filename: "notes", Content: "hi", ContentType: "text/markdown"},
+			},
+		},
+		{name: "without attachments", body: `{"userId": "user", "prompt": "add redis"}`, want: http.StatusCreated, wantBody: `"id":"chat"`, wantAttachments: []workspacetypes.ChatAttachment{}},
+		{name: "no prompt", body: `{"userId": "user", "prompt": " "}`, want: http.StatusBadRequest, wantBody: "prompt is required"},
+		{name: "no user", body: `{"prompt": "add redis"}`, want: http.StatusBadRequest, wantBody: "userId is required"},
+		{name: "no filename", body: `{"userId": "user", "prompt": "p", "attachments": [{"content": "a"}]}`, want: http.StatusBadRequest, wantBody: "filename is required"},
+		{name: "path in filename", body: `{"userId": "user", "prompt": "p", "attachments": [{"filename": "../a.yaml", "content": "a"}]}`, want: http.StatusBadRequest, wantBody: "must not contain a path"},
+		{name: "too large", body: fmt.Sprintf(`{"userId": "user", "prompt": "p", "attachments": [{"filename": "a.txt", "content": %q}]}`, tooLarge), want: http.StatusBadRequest, wantBody: "is larger than"},
+		{name: "unknown workspace", body: `{"userId": "user", "prompt": "p"}`, err: fmt.Errorf("%w: ws", workspace.ErrWorkspaceNotFound), want: http.StatusNotFound, wantBody: "workspace not found"},
+		{name: "archived workspace", body: `{"userId": "user", "prompt": "p"}`, err: fmt.Errorf("%w: ws", workspace.ErrWorkspaceArchived), want: http.StatusConflict, wantBody: "workspace is archived"},
+		{name: "database error", body: `{"userId": "user", "prompt": "p"}`, err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to create chat message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := createChatMessage
+			t.Cleanup(func() { createChatMessage = original })
+			stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{"user": workspacetypes.WorkspaceRoleEditor})
+
+			var attachments []workspacetypes.ChatAttachment
+			createChatMessage = func(ctx context.Context, workspaceID string, userID string, prompt string, a []workspacetypes.ChatAttachment) (*workspacetypes.Chat, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "user", userID)
+				attachments = a
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.Chat{ID: "chat", Prompt: prompt}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/messages", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			CreateChatMessage(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantAttachments != nil {
+				assert.Equal(t, tt.wantAttachments, attachments)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database or realtime server
+var (
+	listPendingPatches = workspace.ListPendingPatches
+	getPatchPreview    = workspace.GetPatchPreview
+	acceptPatch        = workspace.AcceptPatch
+	rejectPatch        = workspace.RejectPatch
+	sendFileUpdated    = sendArtifactUpdated
+)
+
+// ListPendingPatchesResponse is the response to GET /api/workspace/{id}/revision/{revision}/patches
+type ListPendingPatchesResponse struct {
+	Patches []workspacetypes.PendingPatch `json:"patches"`
+}
+
+// ResolvePatchRequest is the body of POST .../patches/{fileID}/accept and .../reject
+type ResolvePatchRequest struct {
+	// Version is the version of the file the client last saw. When it's set, the patch is only
+	// resolved if the file hasn't been written since.
+	Version *int `json:"version,omitempty"`
+}
+
+func (r ResolvePatchRequest) validate() error {
+	return nil
+}
+
+// patchPathValues reads the workspace, revision and file of a patch request, writing a 400 and
+// returning false if the revision isn't a number
+func patchPathValues(w http.ResponseWriter, r *http.Request) (string, int, string, bool) {
+	revision, err := strconv.Atoi(r.PathValue("revision"))
+	if err != nil || revision < 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "revision must be a number"})
+		return "", 0, "", false
+	}
+	return r.PathValue("id"), revision, r.PathValue("fileID"), true
+}
+
+// ListPendingPatches responds with the files of a revision that have pending content
+func ListPendingPatches(w http.ResponseWriter, r *http.Request) {
+	workspaceID, revision, _, ok := patchPathValues(w, r)
+	if !ok {
+		return
+	}
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	patches, err := listPendingPatches(r.Context(), workspaceID, revision)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list pending patches: %w", err), zap.String("workspaceID", workspaceID), zap.Int("revision", revision))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list pending patches"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListPendingPatchesResponse{Patches: patches})
+}
+
+// PreviewPatch responds with a file before and after accepting its pending patch
+func PreviewPatch(w http.ResponseWriter, r *http.Request) {
+	workspaceID, revision, fileID, ok := patchPathValues(w, r)
+	if !ok {
+		return
+	}
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	preview, err := getPatchPreview(r.Context(), workspaceID, revision, fileID)
+	if err != nil {
+		writePatchError(w, r, err, "preview", workspaceID, revision, fileID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// AcceptPatch replaces a file's content with its pending content
+func AcceptPatch(w http.ResponseWriter, r *http.Request) {
+	resolvePatch(w, r, "accept", acceptPatch)
+}
+
+// RejectPatch discards a file's pending content
+func RejectPatch(w http.ResponseWriter, r *http.Request) {
+	resolvePatch(w, r, "reject", rejectPatch)
+}
+
+func resolvePatch(w http.ResponseWriter, r *http.Request, action string, resolve func(context.Context, string, int, string, *int) (*workspacetypes.File, error)) {
+	workspaceID, revision, fileID, ok := patchPathValues(w, r)
+	if !ok {
+		return
+	}
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+	var req ResolvePatchRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	file, err := resolve(r.Context(), workspaceID, revision, fileID, req.Version)
+	if err != nil {
+		writePatchError(w, r, err, action, workspaceID, revision, fileID)
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditFileEdited, map[string]interface{}{
+		"fileId":         fileID,
+		"path":           file.FilePath,
+		"revisionNumber": revision,
+		"patch":          action,
+	})
+
+	// the patch is resolved either way, clients that miss the event pick it up when they reload
+	if err := sendFileUpdated(r.Context(), file); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to send file update", zap.String("workspaceID", workspaceID), zap.String("fileID", fileID), zap.Error(err))
+	}
+
+	writeJSON(w, http.StatusOK, file)
+}
+
+func writePatchError(w http.ResponseWriter, r *http.Request, err error, action string, workspaceID string, revision int, fileID string) {
+	switch {
+	case errors.Is(err, workspace.ErrNoPendingPatch):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "file has no pending patch"})
+	case errors.Is(err, workspace.ErrConflict):
+		writeFileConflict(w, r, http.StatusConflict, "file was modified since it was read", workspaceID, patchFilePath(r.Context(), workspaceID, revision, fileID))
+	case errors.Is(err, workspace.ErrFileBusy):
+		writeFileConflict(w, r, http.StatusServiceUnavailable, "file is being written, try again", workspaceID, patchFilePath(r.Context(), workspaceID, revision, fileID))
+	default:
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to %s patch: %w", action, err), zap.String("workspaceID", workspaceID), zap.String("fileID", fileID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: fmt.Sprintf("failed to %s patch", action)})
+	}
+}
+
+// patchFilePath returns the path of a file with a pending patch, empty when it can't be read
+func patchFilePath(ctx context.Context, workspaceID string, revision int, fileID string) string {
+	patches, err := listPendingPatches(ctx, workspaceID, revision)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to list pending patches", zap.String("workspaceID", workspaceID), zap.Error(err))
+		return ""
+	}
+	for _, patch := range patches {
+		if patch.FileID == fileID {
+			return patch.FilePath
+		}
+	}
+	return ""
+}
+
+// sendArtifactUpdated sends the file to everyone in its workspace, so that other clients drop or
+// apply the pending content too
+func sendArtifactUpdated(ctx context.Context, file *workspacetypes.File) error {
+	userIDs, err := workspace.ListUserIDsForWorkspace(ctx, file.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return realtime.SendEvent(ctx, realtimetypes.Recipient{UserIDs: userIDs}, realtimetypes.ArtifactUpdatedEvent{
+		WorkspaceID:   file.WorkspaceID,
+		WorkspaceFile: file,
+	})
+}
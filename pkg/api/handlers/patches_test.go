@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSendFileUpdated records the files sent to clients
+func stubSendFileUpdated(t *testing.T) *[]*workspacetypes.File {
+	sent := []*workspacetypes.File{}
+	original := sendFileUpdated
+	sendFileUpdated = func(ctx context.Context, file *workspacetypes.File) error {
+		sent = append(sent, file)
+		return nil
+	}
+	t.Cleanup(func() { sendFileUpdated = original })
+	return &sent
+}
+
+func patchRequest(method string, path string, revision string, fileID string, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.SetPathValue("id", "ws")
+	req.SetPathValue("revision", revision)
+	req.SetPathValue("fileID", fileID)
+	return req
+}
+
+func TestListPendingPatches(t *testing.T) {
+	original := listPendingPatches
+	t.Cleanup(func() { listPendingPatches = original })
+	listPendingPatches = func(ctx context.Context, workspaceID string, revisionNumber int) ([]workspacetypes.PendingPatch, error) {
+		assert.Equal(t, "ws", workspaceID)
+		assert.Equal(t, 2, revisionNumber)
+		return []workspacetypes.PendingPatch{{FileID: "file", FilePath: "values.yaml", Stale: true}}, nil
+	}
+
+	rec := httptest.NewRecorder()
+	ListPendingPatches(rec, patchRequest(http.MethodGet, "/api/workspace/ws/revision/2/patches", "2", "", ""))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp ListPendingPatchesResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, []workspacetypes.PendingPatch{{FileID: "file", FilePath: "values.yaml", Stale: true}}, resp.Patches)
+
+	rec = httptest.NewRecorder()
+	ListPendingPatches(rec, patchRequest(http.MethodGet, "/api/workspace/ws/revision/latest/patches", "latest", "", ""))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestResolvePatch(t *testing.T) {
+	originalAccept, originalReject, originalList := acceptPatch, rejectPatch, listPendingPatches
+	t.Cleanup(func() { acceptPatch, rejectPatch, listPendingPatches = originalAccept, originalReject, originalList })
+	stubPresentOnFile(t, map[string][]realtimetypes.Presence{
+		"values.yaml": {{WorkspaceID: "ws", UserID: "alice", UserName: "Alice", FilePath: "values.yaml"}},
+	})
+	listPendingPatches = func(ctx context.Context, workspaceID string, revisionNumber int) ([]workspacetypes.PendingPatch, error) {
+		return []workspacetypes.PendingPatch{
+			{FileID: "moved", FilePath: "values.yaml"},
+			{FileID: "busy", FilePath: "values.yaml"},
+			{FileID: "other", FilePath: "Chart.yaml"},
+		}, nil
+	}
+
+	var gotVersion *int
+	acceptPatch = func(ctx context.Context, workspaceID string, revisionNumber int, fileID string, expectedVersion *int) (*workspacetypes.File, error) {
+		gotVersion = expectedVersion
+		return &workspacetypes.File{ID: fileID, WorkspaceID: workspaceID, FilePath: "values.yaml", Content: "replicaCount: 3", Version: 5}, nil
+	}
+	rejectPatch = func(ctx context.Context, workspaceID string, revisionNumber int, fileID string, expectedVersion *int) (*workspacetypes.File, error) {
+		switch fileID {
+		case "missing":
+			return nil, fmt.Errorf("%w: missing at revision 2", workspace.ErrNoPendingPatch)
+		case "moved":
+			return nil, fmt.Errorf("%w: values.yaml at revision 2 is at version 6, not 4", workspace.ErrConflict)
+		case "busy":
+			return nil, fmt.Errorf("%w: values.yaml at revision 2", workspace.ErrFileBusy)
+		}
+		return nil, fmt.Errorf("database unavailable")
+	}
+
+	t.Run("accept sends the file to other clients", func(t *testing.T) {
+		sent := stubSendFileUpdated(t)
+		audited := stubAudit(t)
+
+		rec := httptest.NewRecorder()
+		AcceptPatch(rec, patchRequest(http.MethodPost, "/api/workspace/ws/revision/2/patches/file/accept", "2", "file", `{"version":4}`))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, gotVersion)
+		assert.Equal(t, 4, *gotVersion)
+		require.Len(t, *sent, 1)
+		assert.Equal(t, "file", (*sent)[0].ID)
+		assert.Nil(t, (*sent)[0].ContentPending)
+		assert.Equal(t, []string{workspace.AuditFileEdited}, *audited)
+	})
+
+	tests := []struct {
+		fileID      string
+		want        int
+		wantBody    string
+		wantWarning bool
+	}{
+		{fileID: "missing", want: http.StatusNotFound, wantBody: "no pending patch"},
+		{fileID: "moved", want: http.StatusConflict, wantBody: "modified since it was read", wantWarning: true},
+		{fileID: "busy", want: http.StatusServiceUnavailable, wantBody: "file is being written", wantWarning: true},
+		{fileID: "other", want: http.StatusInternalServerError, wantBody: "failed to reject patch"},
+	}
+	for _, tt := range tests {
+		t.Run("reject "+tt.fileID, func(t *testing.T) {
+			sent := stubSendFileUpdated(t)
+			audited := stubAudit(t)
+
+			rec := httptest.NewRecorder()
+			RejectPatch(rec, patchRequest(http.MethodPost, "/api/workspace/ws/revision/2/patches/"+tt.fileID+"/reject", "2", tt.fileID, `{}`))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantWarning {
+				assert.Contains(t, rec.Body.String(), `"warnings":["Alice is editing values.yaml"]`, "a conflict names the other users that have the file open")
+			} else {
+				assert.NotContains(t, rec.Body.String(), "warnings")
+			}
+			assert.Empty(t, *sent, "nothing changed, there's nothing to send")
+			assert.Empty(t, *audited)
+		})
+	}
+}
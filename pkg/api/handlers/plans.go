@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database or realtime server
+var (
+	setActionFileReview = workspace.SetActionFileReview
+	proceedReviewedPlan = workspace.ProceedReviewedPlan
+	sendPlanUpdated     = sendPlanUpdatedEvent
+	getPlanStatus       = workspace.GetPlanExecutionStatus
+	getDryRunPlan       = getPlan
+	dryRunPlan          = llm.DryRunPlan
+	getRebasedPlan      = getPlan
+	rebasePlan          = workspace.RebasePlan
+)
+
+// ReviewActionFileRequest is the body of POST /api/workspace/{id}/plan/{planID}/review
+type ReviewActionFileRequest struct {
+	ChartID string `json:"chartId"`
+	Path    string `json:"path"`
+	// Review is approved, rejected or commented
+	Review workspacetypes.ActionFileReview `json:"review"`
+	// Note is given to the LLM when the file is applied, it's required to comment
+	Note string `json:"note,omitempty"`
+}
+
+func (r ReviewActionFileRequest) validate() error {
+	if r.Path == "" {
+		return errors.New("path is required")
+	}
+	return workspace.ValidateActionFileReview(r.Review, r.Note)
+}
+
+// ReviewActionFile records the review of an action file of a plan that's waiting for one
+func ReviewActionFile(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	planID := r.PathValue("planID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	var req ReviewActionFileRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	plan, err := setActionFileReview(r.Context(), workspaceID, planID, req.ChartID, req.Path, req.Review, req.Note)
+	if err != nil {
+		writePlanError(w, r, err, "failed to review action file", workspaceID, planID)
+		return
+	}
+
+	// the review is recorded either way, clients that miss the event pick it up when they reload
+	if err := sendPlanUpdated(r.Context(), plan); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to send plan update", zap.String("workspaceID", workspaceID), zap.String("planID", planID), zap.Error(err))
+	}
+
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// ProceedPlan applies a plan once every one of its files is approved or rejected
+func ProceedPlan(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	planID := r.PathValue("planID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	plan, err := proceedReviewedPlan(r.Context(), workspaceID, planID)
+	if err != nil {
+		writePlanError(w, r, err, "failed to proceed with plan", workspaceID, planID)
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditPlanProceeded, map[string]interface{}{
+		"planId": planID,
+	})
+
+	if err := sendPlanUpdated(r.Context(), plan); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to send plan update", zap.String("workspaceID", workspaceID), zap.String("planID", planID), zap.Error(err))
+	}
+
+	writeJSON(w, http.StatusAccepted, plan)
+}
+
+// PlanStatus returns a snapshot of how far the execution of a plan has got. It's polled, so it
+// answers 304 Not Modified when the snapshot's ETag matches If-None-Match.
+func PlanStatus(w http.ResponseWriter, r *http.Request) {
+	planID := r.PathValue("id")
+
+	status, err := getPlanStatus(r.Context(), planID)
+	if err != nil {
+		writePlanError(w, r, err, "failed to get plan status", "", planID)
+		return
+	}
+	if refuseRole(w, r.Context(), status.WorkspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	etag := planStatusETag(status)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// PlanDryRun previews the files a plan would change, without applying it. The preview spends at
+// most the configured budget on the LLM, complete is false when that left actions out. It's stored
+// on the plan, so that previewing it again before anything changes doesn't spend it again.
+func PlanDryRun(w http.ResponseWriter, r *http.Request) {
+	planID := r.PathValue("id")
+
+	plan, err := getDryRunPlan(r.Context(), planID)
+	if err != nil {
+		writePlanError(w, r, err, "failed to get plan", "", planID)
+		return
+	}
+	if refuseRole(w, r.Context(), plan.WorkspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	dryRun, err := dryRunPlan(r.Context(), plan)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrPlanNotPreviewable), errors.Is(err, workspace.ErrSecretsNotAcknowledged):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+		case errors.Is(err, circuitbreaker.ErrOpen):
+			writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+		default:
+			writePlanError(w, r, err, "failed to preview plan", plan.WorkspaceID, planID)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dryRun)
+}
+
+// RebasePlanResponse is the response to POST /api/plan/{id}/rebase
+type RebasePlanResponse struct {
+	// Plan is the new plan, waiting for review, its rebasedFromPlanId is the plan that was rebased
+	Plan *workspacetypes.Plan `json:"plan"`
+	// Rebased are the action files that were adjusted to the current revision, or that changed
+	// since the plan was created
+	Rebased []workspacetypes.ActionFileRebase `json:"rebased"`
+}
+
+// RebasePlan clones a plan that was created against an earlier revision onto the current one, so
+// that it can be executed after the files it changes moved on. The original plan isn't changed.
+func RebasePlan(w http.ResponseWriter, r *http.Request) {
+	planID := r.PathValue("id")
+
+	original, err := getRebasedPlan(r.Context(), planID)
+	if err != nil {
+		writePlanError(w, r, err, "failed to get plan", "", planID)
+		return
+	}
+	if refuseRole(w, r.Context(), original.WorkspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+	if refuseArchived(w, r.Context(), workspaceArchived, original.WorkspaceID) {
+		return
+	}
+
+	plan, rebased, err := rebasePlan(r.Context(), original)
+	if err != nil {
+		if errors.Is(err, workspace.ErrPlanNotRebaseable) {
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+			return
+		}
+		writePlanError(w, r, err, "failed to rebase plan", original.WorkspaceID, planID)
+		return
+	}
+
+	recordAudit(r.Context(), plan.WorkspaceID, workspace.AuditActorUser, workspace.AuditPlanCreated, map[string]interface{}{
+		"planId":            plan.ID,
+		"rebasedFromPlanId": planID,
+	})
+
+	if err := sendPlanUpdated(r.Context(), plan); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to send plan update", zap.String("workspaceID", plan.WorkspaceID), zap.String("planID", plan.ID), zap.Error(err))
+	}
+
+	writeJSON(w, http.StatusCreated, RebasePlanResponse{Plan: plan, Rebased: rebased})
+}
+
+// getPlan returns ErrNoPlan when the plan doesn't exist
+func getPlan(ctx context.Context, planID string) (*workspacetypes.Plan, error) {
+	plan, err := workspace.GetPlan(ctx, nil, planID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", workspace.ErrNoPlan, planID)
+		}
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planStatusETag identifies a plan status snapshot by when it was last updated. The status, counts
+// and render are included too, so that a write that didn't bump a timestamp still changes it.
+func planStatusETag(status *workspacetypes.PlanExecutionStatus) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%s\n%+v\n", status.PlanID, status.UpdatedAt.UnixNano(), status.Status, status.Counts)
+	if status.RevisionNumber != nil {
+		fmt.Fprintf(h, "revision %d\n", *status.RevisionNumber)
+	}
+	if render := status.Render; render != nil {
+		fmt.Fprintf(h, "render %s %t %d %d %d %s\n", render.ID, render.CompletedAt != nil, render.Charts, render.ChartsSucceeded, render.ChartsFailed, render.Error)
+		if render.Compatibility != nil {
+			fmt.Fprintf(h, "compatibility %s\n", render.Compatibility.Summary)
+		}
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+func writePlanError(w http.ResponseWriter, r *http.Request, err error, message string, workspaceID string, planID string) {
+	if writeExecutionLocked(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, workspace.ErrNoPlan), errors.Is(err, workspace.ErrActionFileNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, workspace.ErrPlanNotInFileReview), errors.Is(err, workspace.ErrPlanReviewIncomplete):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	default:
+		logger.ErrorCtx(r.Context(), fmt.Errorf("%s: %w", message, err), zap.String("workspaceID", workspaceID), zap.String("planID", planID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: message})
+	}
+}
+
+// sendPlanUpdatedEvent sends the plan, with the review of its files, to everyone in its workspace
+func sendPlanUpdatedEvent(ctx context.Context, plan *workspacetypes.Plan) error {
+	userIDs, err := workspace.ListUserIDsForWorkspace(ctx, plan.WorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return realtime.SendEvent(ctx, realtimetypes.Recipient{UserIDs: userIDs}, realtimetypes.PlanUpdatedEvent{
+		WorkspaceID: plan.WorkspaceID,
+		Plan:        plan,
+	})
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSendPlanUpdated records the plans sent to clients
+func stubSendPlanUpdated(t *testing.T) *[]*workspacetypes.Plan {
+	sent := []*workspacetypes.Plan{}
+	original := sendPlanUpdated
+	sendPlanUpdated = func(ctx context.Context, plan *workspacetypes.Plan) error {
+		sent = append(sent, plan)
+		return nil
+	}
+	t.Cleanup(func() { sendPlanUpdated = original })
+	return &sent
+}
+
+func planRequest(path string, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.SetPathValue("id", "ws")
+	req.SetPathValue("planID", "plan")
+	return req
+}
+
+func TestReviewActionFile(t *testing.T) {
+	original := setActionFileReview
+	t.Cleanup(func() { setActionFileReview = original })
+
+	setActionFileReview = func(ctx context.Context, workspaceID string, planID string, chartID string, path string, review workspacetypes.ActionFileReview, note string) (*workspacetypes.Plan, error) {
+		switch path {
+		case "missing.yaml":
+			return nil, fmt.Errorf("%w: missing.yaml in plan plan", workspace.ErrActionFileNotFound)
+		case "applied.yaml":
+			return nil, fmt.Errorf("%w: plan plan is applied", workspace.ErrPlanNotInFileReview)
+		case "broken.yaml":
+			return nil, errors.New("database unavailable")
+		}
+		return &workspacetypes.Plan{
+			ID:          planID,
+			WorkspaceID: workspaceID,
+			Status:      workspacetypes.PlanStatusReviewFiles,
+			ActionFiles: []workspacetypes.ActionFile{{Path: path, ChartID: chartID, Review: review, ReviewNote: note}},
+		}, nil
+	}
+
+	t.Run("sends the review to other clients", func(t *testing.T) {
+		sent := stubSendPlanUpdated(t)
+
+		rec := httptest.NewRecorder()
+		ReviewActionFile(rec, planRequest("/api/workspace/ws/plan/plan/review", `{"chartId":"chart","path":"values.yaml","review":"commented","note":"keep replicaCount at 2"}`))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var plan workspacetypes.Plan
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&plan))
+		assert.Equal(t, workspacetypes.ActionFileReviewCommented, plan.ActionFiles[0].Review)
+		assert.Equal(t, "keep replicaCount at 2", plan.ActionFiles[0].ReviewNote)
+
+		require.Len(t, *sent, 1)
+		assert.Equal(t, workspacetypes.ActionFileReviewCommented, (*sent)[0].ActionFiles[0].Review)
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		want     int
+		wantBody string
+	}{
+		{name: "unknown review", body: `{"path":"values.yaml","review":"maybe"}`, want: http.StatusBadRequest, wantBody: "review must be approved, rejected or commented"},
+		{name: "comment without note", body: `{"path":"values.yaml","review":"commented"}`, want: http.StatusBadRequest, wantBody: "needs a note"},
+		{name: "no path", body: `{"review":"approved"}`, want: http.StatusBadRequest, wantBody: "path is required"},
+		{name: "unknown file", body: `{"path":"missing.yaml","review":"approved"}`, want: http.StatusNotFound, wantBody: "action file not found"},
+		{name: "plan not in review", body: `{"path":"applied.yaml","review":"rejected"}`, want: http.StatusConflict, wantBody: "isn't waiting for a review"},
+		{name: "database error", body: `{"path":"broken.yaml","review":"approved"}`, want: http.StatusInternalServerError, wantBody: "failed to review action file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := stubSendPlanUpdated(t)
+
+			rec := httptest.NewRecorder()
+			ReviewActionFile(rec, planRequest("/api/workspace/ws/plan/plan/review", tt.body))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Empty(t, *sent)
+		})
+	}
+}
+
+func TestProceedPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "proceeds", want: http.StatusAccepted, wantBody: `"status":"applying"`},
+		{name: "incomplete review", err: fmt.Errorf("%w: templates/service.yaml", workspace.ErrPlanReviewIncomplete), want: http.StatusConflict, wantBody: "templates/service.yaml"},
+		{name: "unknown plan", err: fmt.Errorf("%w: plan", workspace.ErrNoPlan), want: http.StatusNotFound, wantBody: "no plan found"},
+		{name: "another plan executing", err: &workspace.ExecutionLockedError{WorkspaceID: "ws", PlanID: "executing"}, want: http.StatusConflict, wantBody: `"planId":"executing"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := proceedReviewedPlan
+			t.Cleanup(func() { proceedReviewedPlan = original })
+			proceedReviewedPlan = func(ctx context.Context, workspaceID string, planID string) (*workspacetypes.Plan, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.Plan{ID: planID, WorkspaceID: workspaceID, Status: workspacetypes.PlanStatusApplying}, nil
+			}
+			sent := stubSendPlanUpdated(t)
+			audited := stubAudit(t)
+
+			rec := httptest.NewRecorder()
+			ProceedPlan(rec, planRequest("/api/workspace/ws/plan/plan/proceed", ""))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.err == nil {
+				assert.Len(t, *sent, 1)
+				assert.Equal(t, []string{workspace.AuditPlanProceeded}, *audited)
+			} else {
+				assert.Empty(t, *sent)
+				assert.Empty(t, *audited)
+			}
+		})
+	}
+}
+
+func TestPlanStatus(t *testing.T) {
+	original := getPlanStatus
+	t.Cleanup(func() { getPlanStatus = original })
+
+	revision := 3
+	status := &workspacetypes.PlanExecutionStatus{
+		PlanID:         "plan",
+		WorkspaceID:    "ws",
+		Status:         workspacetypes.PlanStatusApplying,
+		ActionFiles:    []workspacetypes.ActionFile{{Path: "values.yaml", Status: "creating"}},
+		Counts:         workspacetypes.ActionFileCounts{Running: 1},
+		RevisionNumber: &revision,
+		UpdatedAt:      time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+	getPlanStatus = func(ctx context.Context, planID string) (*workspacetypes.PlanExecutionStatus, error) {
+		switch planID {
+		case "missing":
+			return nil, fmt.Errorf("%w: missing", workspace.ErrNoPlan)
+		case "broken":
+			return nil, errors.New("database unavailable")
+		}
+		return status, nil
+	}
+
+	get := func(planID string, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/plan/"+planID+"/status", nil)
+		req.SetPathValue("id", planID)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		PlanStatus(rec, req)
+		return rec
+	}
+
+	rec := get("plan", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	var got workspacetypes.PlanExecutionStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, 1, got.Counts.Running)
+	assert.Equal(t, 3, *got.RevisionNumber)
+
+	t.Run("unchanged poll isn't sent again", func(t *testing.T) {
+		rec := get("plan", etag)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("changed plan is sent", func(t *testing.T) {
+		status.Counts = workspacetypes.ActionFileCounts{Done: 1}
+		t.Cleanup(func() { status.Counts = workspacetypes.ActionFileCounts{Running: 1} })
+
+		rec := get("plan", etag)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+	})
+
+	t.Run("missing plan", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("missing", "").Code)
+	})
+
+	t.Run("stranger", func(t *testing.T) {
+		stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/plan/plan/status", nil)
+		req.SetPathValue("id", "plan")
+		rec := httptest.NewRecorder()
+		PlanStatus(rec, withUser(req, "stranger"))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = httptest.NewRecorder()
+		PlanStatus(rec, withUser(req, "viewer"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		rec := get("broken", "")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "database unavailable")
+	})
+}
+
+func TestPlanDryRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		planID   string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "previews", planID: "plan", userID: "editor", want: http.StatusOK, wantBody: `"complete":false`},
+		{name: "viewer", planID: "plan", userID: "viewer", want: http.StatusForbidden, wantBody: "requires the editor role"},
+		{name: "unknown plan", planID: "missing", userID: "editor", want: http.StatusNotFound, wantBody: "no plan found"},
+		{name: "applied plan", planID: "plan", userID: "editor", err: fmt.Errorf("%w: plan plan is applied", workspace.ErrPlanNotPreviewable), want: http.StatusConflict, wantBody: "is applied"},
+		{name: "unacknowledged secrets", planID: "plan", userID: "editor", err: workspace.ErrSecretsNotAcknowledged, want: http.StatusConflict},
+		{name: "llm unavailable", planID: "plan", userID: "editor", err: fmt.Errorf("failed to execute action: %w", circuitbreaker.ErrOpen), want: http.StatusServiceUnavailable},
+		{name: "llm error", planID: "plan", userID: "editor", err: errors.New("overloaded"), want: http.StatusInternalServerError, wantBody: "failed to preview plan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{
+				"editor": workspacetypes.WorkspaceRoleEditor,
+				"viewer": workspacetypes.WorkspaceRoleViewer,
+			})
+			originalGet, originalDryRun := getDryRunPlan, dryRunPlan
+			t.Cleanup(func() { getDryRunPlan, dryRunPlan = originalGet, originalDryRun })
+			getDryRunPlan = func(ctx context.Context, planID string) (*workspacetypes.Plan, error) {
+				if planID == "missing" {
+					return nil, fmt.Errorf("%w: %s", workspace.ErrNoPlan, planID)
+				}
+				return &workspacetypes.Plan{ID: planID, WorkspaceID: "ws", Status: workspacetypes.PlanStatusReviewFiles}, nil
+			}
+			previewed := false
+			dryRunPlan = func(ctx context.Context, plan *workspacetypes.Plan) (*workspacetypes.PlanDryRun, error) {
+				previewed = true
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.PlanDryRun{PlanID: plan.ID, Files: []workspacetypes.PlanDryRunFile{{Path: "values.yaml"}}}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/plan/"+tt.planID+"/dry-run", nil)
+			req.SetPathValue("id", tt.planID)
+			rec := httptest.NewRecorder()
+			PlanDryRun(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.want != http.StatusForbidden && tt.want != http.StatusNotFound, previewed)
+		})
+	}
+}
+
+func TestRebasePlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		planID   string
+		userID   string
+		archived bool
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "rebases", planID: "plan", userID: "editor", want: http.StatusCreated, wantBody: `"rebasedFromPlanId":"plan"`},
+		{name: "viewer", planID: "plan", userID: "viewer", want: http.StatusForbidden, wantBody: "requires the editor role"},
+		{name: "archived workspace", planID: "plan", userID: "editor", archived: true, want: http.StatusConflict, wantBody: "workspace is archived"},
+		{name: "unknown plan", planID: "missing", userID: "editor", want: http.StatusNotFound, wantBody: "no plan found"},
+		{name: "still planning", planID: "plan", userID: "editor", err: fmt.Errorf("%w: plan plan is planning", workspace.ErrPlanNotRebaseable), want: http.StatusConflict, wantBody: "is planning"},
+		{name: "database error", planID: "plan", userID: "editor", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to rebase plan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{
+				"editor": workspacetypes.WorkspaceRoleEditor,
+				"viewer": workspacetypes.WorkspaceRoleViewer,
+			})
+			originalGet, originalRebase, originalArchived := getRebasedPlan, rebasePlan, workspaceArchived
+			t.Cleanup(func() { getRebasedPlan, rebasePlan, workspaceArchived = originalGet, originalRebase, originalArchived })
+			workspaceArchived = func(ctx context.Context, id string) (bool, error) {
+				return tt.archived, nil
+			}
+			getRebasedPlan = func(ctx context.Context, planID string) (*workspacetypes.Plan, error) {
+				if planID == "missing" {
+					return nil, fmt.Errorf("%w: %s", workspace.ErrNoPlan, planID)
+				}
+				return &workspacetypes.Plan{ID: planID, WorkspaceID: "ws", Status: workspacetypes.PlanStatusReview}, nil
+			}
+			rebasePlan = func(ctx context.Context, original *workspacetypes.Plan) (*workspacetypes.Plan, []workspacetypes.ActionFileRebase, error) {
+				if tt.err != nil {
+					return nil, nil, tt.err
+				}
+				return &workspacetypes.Plan{ID: "rebased", WorkspaceID: "ws", Status: workspacetypes.PlanStatusReview, RebasedFromPlanID: original.ID},
+					[]workspacetypes.ActionFileRebase{{Path: "values.yaml", From: "update", To: "update", Drifted: true, Reason: "the file changed since the plan was created"}}, nil
+			}
+			sent := stubSendPlanUpdated(t)
+			audited := stubAudit(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/plan/"+tt.planID+"/rebase", nil)
+			req.SetPathValue("id", tt.planID)
+			rec := httptest.NewRecorder()
+			RebasePlan(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.want == http.StatusCreated {
+				assert.Contains(t, rec.Body.String(), `"rebased":[{"path":"values.yaml","from":"update","to":"update","drifted":true`)
+				require.Len(t, *sent, 1)
+				assert.Equal(t, "rebased", (*sent)[0].ID)
+				assert.Equal(t, []string{workspace.AuditPlanCreated}, *audited)
+			} else {
+				assert.Empty(t, *sent)
+				assert.Empty(t, *audited)
+			}
+		})
+	}
+}
+
+func TestPlanStatusETag(t *testing.T) {
+	updatedAt := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	base := func() *workspacetypes.PlanExecutionStatus {
+		return &workspacetypes.PlanExecutionStatus{PlanID: "plan", Status: workspacetypes.PlanStatusApplying, UpdatedAt: updatedAt}
+	}
+
+	etag := planStatusETag(base())
+	assert.Equal(t, etag, planStatusETag(base()))
+
+	later := base()
+	later.UpdatedAt = updatedAt.Add(time.Millisecond)
+	assert.NotEqual(t, etag, planStatusETag(later), "a later update changes the etag")
+
+	rendered := base()
+	rendered.Render = &workspacetypes.PlanRender{ID: "render", Charts: 1}
+	renderedETag := planStatusETag(rendered)
+	assert.NotEqual(t, etag, renderedETag)
+
+	rendered.Render.ChartsSucceeded = 1
+	assert.NotEqual(t, renderedETag, planStatusETag(rendered), "a chart finishing changes the etag")
+
+	renderedETag = planStatusETag(rendered)
+	rendered.Render.Compatibility = &workspacetypes.RenderCompatibility{Summary: "compatible with Kubernetes 1.21 and later"}
+	assert.NotEqual(t, renderedETag, planStatusETag(rendered), "checking compatibility changes the etag")
+}
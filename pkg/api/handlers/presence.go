@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database or realtime server
+var (
+	getUserName            = workspace.GetUserName
+	listPresenceRecipients = workspace.ListUserIDsForWorkspace
+	recordHeartbeat        = realtime.Heartbeat
+	leaveWorkspace         = realtime.Leave
+	getPresence            = realtime.GetPresence
+	presentOnFile          = realtime.PresentOnFile
+)
+
+// maxPresenceFilePathBytes bounds the file path a heartbeat sends, paths are stored and sent to
+// every user of the workspace
+const maxPresenceFilePathBytes = 1024
+
+// PresenceHeartbeatRequest is the body of POST /api/workspace/{id}/presence
+type PresenceHeartbeatRequest struct {
+	// FilePath is the path of the file the user has open, as in the workspace's files, empty when
+	// they don't have one open
+	FilePath string `json:"filePath"`
+}
+
+func (r PresenceHeartbeatRequest) validate() error {
+	if len(r.FilePath) > maxPresenceFilePathBytes {
+		return fmt.Errorf("filePath is longer than %d bytes", maxPresenceFilePathBytes)
+	}
+	return nil
+}
+
+// PresenceResponse is the response to GET and POST /api/workspace/{id}/presence
+type PresenceResponse struct {
+	// Present are the users that have the workspace open, ordered by user
+	Present []realtimetypes.Presence `json:"present"`
+}
+
+// FileConflictResponse is the 409 or 503 response to changing a file that was changed since it
+// was read or is being written
+type FileConflictResponse struct {
+	Error string `json:"error"`
+	// Editing are the other users that have the file open
+	Editing []realtimetypes.Presence `json:"editing,omitempty"`
+	// Warnings name each of them, such as "Alice is editing values.yaml"
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PresenceHeartbeat records that the user a request is made for has a workspace open with a
+// file. The user joins the workspace with their first heartbeat and leaves it when they stop
+// sending them, and every change is sent to the workspace as a presence-changed event.
+func PresenceHeartbeat(w http.ResponseWriter, r *http.Request) {
+	workspaceID, userID, ok := presencePathValues(w, r)
+	if !ok {
+		return
+	}
+
+	var req PresenceHeartbeatRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	// a user whose name can't be read is still present, they're named by their ID
+	userName, err := getUserName(r.Context(), userID)
+	if err != nil {
+		logger.WarnCtx(r.Context(), "Failed to get user name", zap.String("userID", userID), zap.Error(err))
+	}
+
+	userIDs, err := listPresenceRecipients(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list users: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to record presence"})
+		return
+	}
+
+	present, err := recordHeartbeat(r.Context(), realtimetypes.Recipient{UserIDs: userIDs}, realtimetypes.Presence{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		UserName:    userName,
+		FilePath:    req.FilePath,
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to record presence: %w", err), zap.String("workspaceID", workspaceID), zap.String("userID", userID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to record presence"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PresenceResponse{Present: present})
+}
+
+// LeaveWorkspace removes the user a request is made for from a workspace's presence, when they
+// close it without waiting for their heartbeats to run out
+func LeaveWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceID, userID, ok := presencePathValues(w, r)
+	if !ok {
+		return
+	}
+
+	userIDs, err := listPresenceRecipients(r.Context(), workspaceID)
+	if err == nil {
+		err = leaveWorkspace(r.Context(), realtimetypes.Recipient{UserIDs: userIDs}, workspaceID, userID)
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to remove presence: %w", err), zap.String("workspaceID", workspaceID), zap.String("userID", userID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to remove presence"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWorkspacePresence responds with the users that have a workspace open and the file each of
+// them is viewing
+func GetWorkspacePresence(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	present, err := getPresence(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get presence: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get presence"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PresenceResponse{Present: present})
+}
+
+// presencePathValues reads the workspace of a presence request and the user it's made for,
+// writing an error and returning false when there's no user or they aren't a member
+func presencePathValues(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	workspaceID := r.PathValue("id")
+	userID := requestUserID(r)
+	if userID == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("%s is required", UserIDHeader)})
+		return "", "", false
+	}
+	if refuseRole(w, r.Context(), workspaceID, userID, workspacetypes.WorkspaceRoleViewer) {
+		return "", "", false
+	}
+	return workspaceID, userID, true
+}
+
+// editingWarnings returns the users other than userID that have a file open, and a warning naming
+// each of them. Presence that can't be read gives no warnings.
+func editingWarnings(ctx context.Context, workspaceID string, filePath string, userID string) ([]realtimetypes.Presence, []string) {
+	editing, err := presentOnFile(ctx, workspaceID, filePath, userID)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to get presence", zap.String("workspaceID", workspaceID), zap.Error(err))
+		return nil, nil
+	}
+
+	warnings := []string{}
+	for _, p := range editing {
+		name := p.UserName
+		if name == "" {
+			name = p.UserID
+		}
+		warnings = append(warnings, fmt.Sprintf("%s is editing %s", name, p.FilePath))
+	}
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	return editing, warnings
+}
+
+// writeFileConflict responds to a change of a file that conflicts with another writer, naming the
+// other users that have the file open
+func writeFileConflict(w http.ResponseWriter, r *http.Request, status int, message string, workspaceID string, filePath string) {
+	response := FileConflictResponse{Error: message}
+	if filePath != "" {
+		response.Editing, response.Warnings = editingWarnings(r.Context(), workspaceID, filePath, requestUserID(r))
+	}
+	writeJSON(w, status, response)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPresentOnFile makes the users in editing, by file, have those files open
+func stubPresentOnFile(t *testing.T, editing map[string][]realtimetypes.Presence) {
+	original := presentOnFile
+	t.Cleanup(func() { presentOnFile = original })
+
+	presentOnFile = func(ctx context.Context, workspaceID string, filePath string, userID string) ([]realtimetypes.Presence, error) {
+		present := []realtimetypes.Presence{}
+		for _, p := range editing[filePath] {
+			if p.UserID != userID {
+				present = append(present, p)
+			}
+		}
+		return present, nil
+	}
+}
+
+// stubPresence records the heartbeats and leaves of the presence handlers
+func stubPresence(t *testing.T) (*[]realtimetypes.Presence, *[]string) {
+	originalName, originalRecipients, originalHeartbeat, originalLeave, originalGet := getUserName, listPresenceRecipients, recordHeartbeat, leaveWorkspace, getPresence
+	t.Cleanup(func() {
+		getUserName, listPresenceRecipients, recordHeartbeat, leaveWorkspace, getPresence = originalName, originalRecipients, originalHeartbeat, originalLeave, originalGet
+	})
+
+	heartbeats := []realtimetypes.Presence{}
+	left := []string{}
+	getUserName = func(ctx context.Context, userID string) (string, error) {
+		if userID == "bob" {
+			return "", errors.New("database unavailable")
+		}
+		return "Alice", nil
+	}
+	listPresenceRecipients = func(ctx context.Context, workspaceID string) ([]string, error) {
+		return []string{"alice", "bob"}, nil
+	}
+	recordHeartbeat = func(ctx context.Context, r realtimetypes.Recipient, presence realtimetypes.Presence) ([]realtimetypes.Presence, error) {
+		assert.Equal(t, []string{"alice", "bob"}, r.GetUserIDs(), "presence is sent to the users of the workspace")
+		heartbeats = append(heartbeats, presence)
+		return []realtimetypes.Presence{presence}, nil
+	}
+	leaveWorkspace = func(ctx context.Context, r realtimetypes.Recipient, workspaceID string, userID string) error {
+		left = append(left, userID)
+		return nil
+	}
+	getPresence = func(ctx context.Context, workspaceID string) ([]realtimetypes.Presence, error) {
+		return []realtimetypes.Presence{{WorkspaceID: workspaceID, UserID: "alice", UserName: "Alice", FilePath: "values.yaml"}}, nil
+	}
+	return &heartbeats, &left
+}
+
+func presenceRequest(method string, userID string, body string) *http.Request {
+	req := httptest.NewRequest(method, "/api/workspace/ws/presence", strings.NewReader(body))
+	req.SetPathValue("id", "ws")
+	return withUser(req, userID)
+}
+
+func TestPresenceHeartbeat(t *testing.T) {
+	stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{
+		"alice": workspacetypes.WorkspaceRoleViewer,
+		"bob":   workspacetypes.WorkspaceRoleEditor,
+	})
+
+	tests := []struct {
+		name          string
+		userID        string
+		body          string
+		want          int
+		wantBody      string
+		wantHeartbeat *realtimetypes.Presence
+	}{
+		{
+			name:          "viewer",
+			userID:        "alice",
+			body:          `{"filePath":"values.yaml"}`,
+			want:          http.StatusOK,
+			wantBody:      `"present":[{"workspaceId":"ws","userId":"alice","userName":"Alice","filePath":"values.yaml"`,
+			wantHeartbeat: &realtimetypes.Presence{WorkspaceID: "ws", UserID: "alice", UserName: "Alice", FilePath: "values.yaml"},
+		},
+		{
+			name:          "name can't be read",
+			userID:        "bob",
+			body:          `{}`,
+			want:          http.StatusOK,
+			wantHeartbeat: &realtimetypes.Presence{WorkspaceID: "ws", UserID: "bob"},
+		},
+		{name: "made by chartsmith", body: `{}`, want: http.StatusBadRequest, wantBody: "X-Chartsmith-User-ID is required"},
+		{name: "not a member", userID: "mallory", body: `{}`, want: http.StatusForbidden},
+		{name: "path too long", userID: "alice", body: `{"filePath":"` + strings.Repeat("a", maxPresenceFilePathBytes+1) + `"}`, want: http.StatusBadRequest, wantBody: "filePath is longer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			heartbeats, _ := stubPresence(t)
+
+			rec := httptest.NewRecorder()
+			PresenceHeartbeat(rec, presenceRequest(http.MethodPost, tt.userID, tt.body))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantHeartbeat == nil {
+				assert.Empty(t, *heartbeats)
+				return
+			}
+			require.Len(t, *heartbeats, 1)
+			assert.Equal(t, *tt.wantHeartbeat, (*heartbeats)[0])
+		})
+	}
+}
+
+func TestLeaveWorkspace(t *testing.T) {
+	stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{"alice": workspacetypes.WorkspaceRoleViewer})
+	_, left := stubPresence(t)
+
+	rec := httptest.NewRecorder()
+	LeaveWorkspace(rec, presenceRequest(http.MethodDelete, "alice", ""))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []string{"alice"}, *left)
+
+	rec = httptest.NewRecorder()
+	LeaveWorkspace(rec, presenceRequest(http.MethodDelete, "", ""))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, []string{"alice"}, *left)
+}
+
+func TestGetWorkspacePresence(t *testing.T) {
+	stubWorkspaceRole(t, map[string]workspacetypes.WorkspaceRole{"bob": workspacetypes.WorkspaceRoleViewer})
+	stubPresence(t)
+
+	for _, userID := range []string{"bob", ""} {
+		rec := httptest.NewRecorder()
+		GetWorkspacePresence(rec, presenceRequest(http.MethodGet, userID, ""))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"userName":"Alice","filePath":"values.yaml"`)
+	}
+
+	rec := httptest.NewRecorder()
+	GetWorkspacePresence(rec, presenceRequest(http.MethodGet, "mallory", ""))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestEditingWarnings(t *testing.T) {
+	stubPresentOnFile(t, map[string][]realtimetypes.Presence{
+		"values.yaml": {
+			{UserID: "alice", UserName: "Alice", FilePath: "values.yaml"},
+			{UserID: "bob", FilePath: "values.yaml"},
+		},
+	})
+
+	editing, warnings := editingWarnings(context.Background(), "ws", "values.yaml", "alice")
+	assert.Len(t, editing, 1)
+	assert.Equal(t, []string{"bob is editing values.yaml"}, warnings, "a user without a name is named by their ID, and users aren't warned about themselves")
+
+	editing, warnings = editingWarnings(context.Background(), "ws", "Chart.yaml", "alice")
+	assert.Nil(t, editing)
+	assert.Nil(t, warnings)
+
+	presentOnFile = func(ctx context.Context, workspaceID string, filePath string, userID string) ([]realtimetypes.Presence, error) {
+		return nil, errors.New("database unavailable")
+	}
+	_, warnings = editingWarnings(context.Background(), "ws", "values.yaml", "")
+	assert.Nil(t, warnings, "presence that can't be read gives no warnings")
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	listValuesProfiles  = workspace.ListValuesProfiles
+	getValuesProfile    = workspace.GetValuesProfile
+	setValuesProfile    = workspace.SetValuesProfile
+	deleteValuesProfile = workspace.DeleteValuesProfile
+)
+
+// ListValuesProfilesResponse is the response to GET /api/workspace/{id}/chart/{chartID}/values-profiles
+type ListValuesProfilesResponse struct {
+	Profiles []workspacetypes.ValuesProfile `json:"profiles"`
+}
+
+// SetValuesProfileRequest is the body of PUT .../values-profiles/{name}
+type SetValuesProfileRequest struct {
+	// Content is the values to layer over values.yaml, as YAML
+	Content string `json:"content"`
+}
+
+// DeleteValuesProfileResponse is the response to DELETE .../values-profiles/{name}
+type DeleteValuesProfileResponse struct {
+	// UsedByLatestRender is set when the latest render of the workspace used the deleted profile
+	UsedByLatestRender bool `json:"usedByLatestRender"`
+}
+
+func (r SetValuesProfileRequest) validate() error {
+	return nil
+}
+
+// ListValuesProfiles responds with the values profiles of a chart
+func ListValuesProfiles(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	profiles, err := listValuesProfiles(r.Context(), workspaceID, chartID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list values profiles: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list values profiles"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListValuesProfilesResponse{Profiles: profiles})
+}
+
+// GetValuesProfile responds with a values profile of a chart
+func GetValuesProfile(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	name := r.PathValue("name")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	profile, err := getValuesProfile(r.Context(), workspaceID, chartID, name)
+	if err != nil {
+		writeValuesProfileError(w, r, err, "failed to get values profile", workspaceID, chartID, name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// SetValuesProfile creates or replaces a values profile of a chart
+func SetValuesProfile(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	name := r.PathValue("name")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	var req SetValuesProfileRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := workspace.ValidateValuesProfile(name, req.Content); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	profile, err := setValuesProfile(r.Context(), workspaceID, chartID, name, req.Content)
+	if err != nil {
+		writeValuesProfileError(w, r, err, "failed to set values profile", workspaceID, chartID, name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, profile)
+}
+
+// DeleteValuesProfile deletes a values profile of a chart, even when the latest render used it
+func DeleteValuesProfile(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	name := r.PathValue("name")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	usedByLatestRender, err := deleteValuesProfile(r.Context(), workspaceID, chartID, name)
+	if err != nil {
+		writeValuesProfileError(w, r, err, "failed to delete values profile", workspaceID, chartID, name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DeleteValuesProfileResponse{UsedByLatestRender: usedByLatestRender})
+}
+
+func writeValuesProfileError(w http.ResponseWriter, r *http.Request, err error, message string, workspaceID string, chartID string, name string) {
+	if errors.Is(err, workspace.ErrValuesProfileNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "values profile not found"})
+		return
+	}
+	logger.ErrorCtx(r.Context(), fmt.Errorf("%s: %w", message, err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID), zap.String("profile", name))
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: message})
+}
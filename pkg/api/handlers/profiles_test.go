@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func valuesProfileRequest(method string, name string, body string) *http.Request {
+	req := httptest.NewRequest(method, "/api/workspace/ws/chart/chart/values-profiles/"+name, strings.NewReader(body))
+	req.SetPathValue("id", "ws")
+	req.SetPathValue("chartID", "chart")
+	req.SetPathValue("name", name)
+	return req
+}
+
+func TestSetValuesProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     string
+		body        string
+		setErr      error
+		want        int
+		wantBody    string
+		wantStored  bool
+		wantContent string
+	}{
+		{name: "created", profile: "prod", body: `{"content":"replicaCount: 3\n"}`, want: http.StatusOK, wantBody: `"name":"prod"`, wantStored: true, wantContent: "replicaCount: 3\n"},
+		{name: "invalid name", profile: "Prod_EU", body: `{"content":"replicaCount: 3\n"}`, want: http.StatusBadRequest, wantBody: "invalid profile name"},
+		{name: "not a mapping", profile: "prod", body: `{"content":"- replicaCount\n"}`, want: http.StatusBadRequest, wantBody: "values must be a mapping"},
+		{name: "database error", profile: "prod", body: `{"content":"replicaCount: 3\n"}`, setErr: errors.New("database unavailable"), want: http.StatusInternalServerError, wantBody: "failed to set values profile", wantStored: true, wantContent: "replicaCount: 3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := setValuesProfile
+			t.Cleanup(func() { setValuesProfile = original })
+
+			stored := false
+			var gotContent string
+			setValuesProfile = func(ctx context.Context, workspaceID string, chartID string, name string, content string) (*workspacetypes.ValuesProfile, error) {
+				stored = true
+				gotContent = content
+				if tt.setErr != nil {
+					return nil, tt.setErr
+				}
+				return &workspacetypes.ValuesProfile{ID: "profile", WorkspaceID: workspaceID, ChartID: chartID, Name: name, Content: content}, nil
+			}
+
+			rec := httptest.NewRecorder()
+			SetValuesProfile(rec, valuesProfileRequest(http.MethodPut, tt.profile, tt.body))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "database unavailable")
+			assert.Equal(t, tt.wantStored, stored)
+			assert.Equal(t, tt.wantContent, gotContent)
+		})
+	}
+}
+
+func TestDeleteValuesProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		used      bool
+		deleteErr error
+		want      int
+		wantBody  string
+	}{
+		{name: "unused", want: http.StatusOK, wantBody: `"usedByLatestRender":false`},
+		{name: "used by latest render", used: true, want: http.StatusOK, wantBody: `"usedByLatestRender":true`},
+		{name: "unknown profile", deleteErr: workspace.ErrValuesProfileNotFound, want: http.StatusNotFound, wantBody: "values profile not found"},
+		{name: "database error", deleteErr: errors.New("database unavailable"), want: http.StatusInternalServerError, wantBody: "failed to delete values profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := deleteValuesProfile
+			t.Cleanup(func() { deleteValuesProfile = original })
+
+			deleteValuesProfile = func(ctx context.Context, workspaceID string, chartID string, name string) (bool, error) {
+				return tt.used, tt.deleteErr
+			}
+
+			rec := httptest.NewRecorder()
+			DeleteValuesProfile(rec, valuesProfileRequest(http.MethodDelete, "prod", ""))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "database unavailable")
+		})
+	}
+}
+
+func TestListValuesProfiles(t *testing.T) {
+	original := listValuesProfiles
+	t.Cleanup(func() { listValuesProfiles = original })
+
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return []workspacetypes.ValuesProfile{
+			{Name: "dev", ChartID: chartID, Content: "debug: true\n"},
+			{Name: "prod", ChartID: chartID, Content: "replicaCount: 3\n"},
+		}, nil
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/values-profiles", nil)
+	req.SetPathValue("id", "ws")
+	req.SetPathValue("chartID", "chart")
+	rec := httptest.NewRecorder()
+	ListValuesProfiles(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp ListValuesProfilesResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	require.Len(t, resp.Profiles, 2)
+	assert.Equal(t, "dev", resp.Profiles[0].Name)
+	assert.Equal(t, "prod", resp.Profiles[1].Name)
+}
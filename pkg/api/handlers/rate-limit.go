@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// maxRateLimitedClients bounds the clients whose rate is tracked, clients that have been idle
+	// longest are forgotten first
+	maxRateLimitedClients = 10000
+	// rateLimitIdle is how long a client is remembered after its last request, by then its bucket
+	// has refilled
+	rateLimitIdle = 10 * time.Minute
+)
+
+// clientRateLimiter limits the requests of each client separately
+type clientRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	clients map[string]*clientRate
+}
+
+type clientRate struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// LimitRate responds with 429 to a client that makes more than limit requests a second, after a
+// burst of burst requests. Clients are told apart by their address, since the routes this guards
+// are served without the internal API key and a header naming the client could be made up.
+func LimitRate(limit rate.Limit, burst int, next http.Handler) http.Handler {
+	limiter := &clientRateLimiter{limit: limit, burst: burst, clients: map[string]*clientRate{}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.allow(clientAddress(r), time.Now()) {
+			w.Header().Set("Retry-After", "1")
+			writeJSON(w, http.StatusTooManyRequests, errorResponse{Error: "too many requests"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *clientRateLimiter) allow(client string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.clients[client]
+	if !ok {
+		if len(l.clients) >= maxRateLimitedClients {
+			l.forget(now)
+		}
+		c = &clientRate{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// forget drops the clients that have been idle for rateLimitIdle, or the one idle longest when
+// none has
+func (l *clientRateLimiter) forget(now time.Time) {
+	oldest := ""
+	for client, c := range l.clients {
+		if now.Sub(c.lastSeen) >= rateLimitIdle {
+			delete(l.clients, client)
+			continue
+		}
+		if oldest == "" || c.lastSeen.Before(l.clients[oldest].lastSeen) {
+			oldest = client
+		}
+	}
+	if len(l.clients) >= maxRateLimitedClients && oldest != "" {
+		delete(l.clients, oldest)
+	}
+}
+
+// clientAddress is the IP a request came from
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestLimitRate(t *testing.T) {
+	handler := LimitRate(rate.Limit(1), 2, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/share/token", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1001").Code, "the port isn't part of the client")
+	limited := get("10.0.0.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "1", limited.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1000").Code, "other clients have their own limit")
+}
+
+func TestClientRateLimiterForgets(t *testing.T) {
+	now := time.Now()
+	limiter := &clientRateLimiter{limit: rate.Limit(1), burst: 1, clients: map[string]*clientRate{}}
+	assert.True(t, limiter.allow("a", now))
+	assert.False(t, limiter.allow("a", now))
+	assert.True(t, limiter.allow("a", now.Add(time.Second)), "the bucket refills")
+
+	for i := range maxRateLimitedClients {
+		limiter.clients[string(rune(i+1000))] = &clientRate{limiter: rate.NewLimiter(1, 1), lastSeen: now.Add(-rateLimitIdle)}
+	}
+	assert.True(t, limiter.allow("b", now.Add(time.Second)))
+	assert.LessOrEqual(t, len(limiter.clients), 2, "idle clients are forgotten")
+}
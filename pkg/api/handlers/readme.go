@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// refreshChartReadme is a var so that the handler can be tested without a database or an LLM
+var refreshChartReadme = llm.RefreshChartReadme
+
+// GenerateReadmeResponse is the response to POST /api/workspace/{id}/chart/{chartID}/generate-readme
+type GenerateReadmeResponse struct {
+	// Readme is the README.md that was written as pending content of the chart
+	Readme string `json:"readme"`
+}
+
+// GenerateReadme writes a README.md documenting the values of a chart in the current revision
+func GenerateReadme(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	readme, err := refreshChartReadme(r.Context(), workspaceID, chartID)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrChartNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+		case errors.Is(err, workspace.ErrSecretsNotAcknowledged):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to generate readme: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to generate readme"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, GenerateReadmeResponse{Readme: readme})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateReadme(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "generated", want: http.StatusOK, wantBody: `"readme":"# nginx\n"`},
+		{name: "unknown chart", err: fmt.Errorf("%w: chart in workspace ws", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "unacknowledged secrets", err: fmt.Errorf("%w: found in values.yaml", workspace.ErrSecretsNotAcknowledged), want: http.StatusConflict, wantBody: "found in values.yaml"},
+		{name: "llm error", err: errors.New("overloaded"), want: http.StatusInternalServerError, wantBody: "failed to generate readme"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := refreshChartReadme
+			t.Cleanup(func() { refreshChartReadme = original })
+
+			var gotWorkspaceID, gotChartID string
+			refreshChartReadme = func(ctx context.Context, workspaceID string, chartID string) (string, error) {
+				gotWorkspaceID, gotChartID = workspaceID, chartID
+				if tt.err != nil {
+					return "", tt.err
+				}
+				return "# nginx\n", nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/chart/chart/generate-readme", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			GenerateReadme(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, "ws", gotWorkspaceID)
+			assert.Equal(t, "chart", gotChartID)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handler can be tested without a database
+var (
+	getRenderOfWorkspace       = workspace.GetRenderOfWorkspace
+	unacknowledgedDebugSecrets = workspace.UnacknowledgedDebugSecrets
+)
+
+const (
+	renderChartRendering = "rendering"
+	renderChartSucceeded = "succeeded"
+	renderChartFailed    = "failed"
+)
+
+// RenderStatusResponse is the response to GET /api/workspace/{id}/render/{renderID}/status
+type RenderStatusResponse struct {
+	ID             string     `json:"id"`
+	RevisionNumber int        `json:"revisionNumber"`
+	ValuesProfile  string     `json:"valuesProfile,omitempty"`
+	IsDebug        bool       `json:"isDebug"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	CompletedAt    *time.Time `json:"completedAt"`
+	// ArtifactsCompactedAt is set once the output of the render was dropped, debug output included
+	ArtifactsCompactedAt *time.Time          `json:"artifactsCompactedAt,omitempty"`
+	Charts               []RenderStatusChart `json:"charts"`
+}
+
+// RenderStatusChart is the status of one chart of a render
+type RenderStatusChart struct {
+	RenderedChartID string `json:"renderedChartId"`
+	ChartID         string `json:"chartId"`
+	// Status is rendering, succeeded or failed
+	Status   string   `json:"status"`
+	Warnings []string `json:"warnings"`
+	Errors   []string `json:"errors"`
+	// Debug is what helm template --debug printed, set for the charts of a debug render once they're
+	// rendered, unless it has secrets that haven't been acknowledged
+	Debug *workspacetypes.RenderDebug `json:"debug,omitempty"`
+	// DebugWithheld says why Debug isn't set when the chart has debug output
+	DebugWithheld *RenderDebugWithheld `json:"debugWithheld,omitempty"`
+}
+
+// RenderDebugWithheld is debug output that has secrets that haven't been acknowledged. It's shown
+// once the workspace or the files the secrets are in are acknowledged, or the secrets allowlisted.
+type RenderDebugWithheld struct {
+	Error   string                         `json:"error"`
+	Secrets []workspacetypes.SecretFinding `json:"secrets"`
+}
+
+// RenderStatus responds with the status of each chart of a render of a workspace, with the debug
+// output of a debug render. Debug output can have secrets from the values, so it's only returned
+// here, never in realtime events, and it's withheld while it has secrets that haven't been
+// acknowledged.
+func RenderStatus(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	renderID := r.PathValue("renderID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	rendered, err := getRenderOfWorkspace(r.Context(), workspaceID, renderID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrRenderNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "render not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get render: %w", err), zap.String("workspaceID", workspaceID), zap.String("renderID", renderID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get render status"})
+		return
+	}
+
+	response := RenderStatusResponse{
+		ID:                   rendered.ID,
+		RevisionNumber:       rendered.RevisionNumber,
+		ValuesProfile:        rendered.ValuesProfile,
+		IsDebug:              rendered.IsDebug,
+		CreatedAt:            rendered.CreatedAt,
+		CompletedAt:          rendered.CompletedAt,
+		ArtifactsCompactedAt: rendered.ArtifactsCompactedAt,
+		Charts:               []RenderStatusChart{},
+	}
+	for _, chart := range rendered.Charts {
+		status := RenderStatusChart{
+			RenderedChartID: chart.ID,
+			ChartID:         chart.ChartID,
+			Status:          renderChartStatus(chart),
+			Warnings:        chart.HelmTemplateWarnings,
+			Errors:          chart.HelmTemplateErrors,
+		}
+		if status.Warnings == nil {
+			status.Warnings = []string{}
+		}
+		if status.Errors == nil {
+			status.Errors = []string{}
+		}
+
+		if chart.Debug != nil {
+			secrets, err := unacknowledgedDebugSecrets(r.Context(), workspaceID, *chart.Debug)
+			if err != nil {
+				logger.ErrorCtx(r.Context(), fmt.Errorf("failed to check debug output for secrets: %w", err), zap.String("workspaceID", workspaceID), zap.String("renderID", renderID))
+				writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get render status"})
+				return
+			}
+			if len(secrets) > 0 {
+				status.DebugWithheld = &RenderDebugWithheld{
+					Error:   workspace.ErrSecretsNotAcknowledged.Error(),
+					Secrets: secrets,
+				}
+			} else {
+				status.Debug = chart.Debug
+			}
+		}
+
+		response.Charts = append(response.Charts, status)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// renderChartStatus is whether a chart is still rendering, charts that haven't completed have a zero
+// completion time
+func renderChartStatus(chart workspacetypes.RenderedChart) string {
+	switch {
+	case chart.CompletedAt == nil || chart.CompletedAt.IsZero():
+		return renderChartRendering
+	case chart.IsSuccess:
+		return renderChartSucceeded
+	default:
+		return renderChartFailed
+	}
+}
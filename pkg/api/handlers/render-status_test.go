@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderStatus(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+	completedAt := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	debug := &workspacetypes.RenderDebug{ComputedValues: "port: 9090\n", Log: []string{"CHART PATH: /tmp/render"}}
+	secret := workspacetypes.SecretFinding{FilePath: "values.yaml", Detector: "aws-access-key-id", Fingerprint: "fp", Redacted: "AKIA****10E"}
+
+	rendered := &workspacetypes.Rendered{
+		ID:      "render",
+		IsDebug: true,
+		Charts: []workspacetypes.RenderedChart{
+			{ID: "rendered-a", ChartID: "a", IsSuccess: true, CompletedAt: &completedAt, HelmTemplateWarnings: []string{"deprecated"}, Debug: debug},
+			{ID: "rendered-b", ChartID: "b", CompletedAt: &completedAt, HelmTemplateErrors: []string{"nil pointer"}, Debug: debug},
+			{ID: "rendered-c", ChartID: "c", CompletedAt: &time.Time{}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		userID    string
+		err       error
+		secrets   []workspacetypes.SecretFinding
+		want      int
+		wantBody  []string
+		notInBody []string
+	}{
+		{
+			name:   "debug render",
+			userID: "viewer",
+			want:   http.StatusOK,
+			wantBody: []string{
+				`"isDebug":true`,
+				`{"renderedChartId":"rendered-a","chartId":"a","status":"succeeded","warnings":["deprecated"],"errors":[],"debug":{"userSuppliedValues":"","computedValues":"port: 9090\n","log":["CHART PATH: /tmp/render"]}}`,
+				`"status":"failed","warnings":[],"errors":["nil pointer"]`,
+				`{"renderedChartId":"rendered-c","chartId":"c","status":"rendering","warnings":[],"errors":[]}`,
+			},
+		},
+		{
+			name:      "debug output with secrets",
+			userID:    "viewer",
+			secrets:   []workspacetypes.SecretFinding{secret},
+			want:      http.StatusOK,
+			wantBody:  []string{`"debugWithheld":{"error":"content has secrets that haven't been acknowledged","secrets":[{"filePath":"values.yaml"`},
+			notInBody: []string{"computedValues", "CHART PATH"},
+		},
+		{name: "not a member", userID: "stranger", want: http.StatusForbidden, notInBody: []string{"computedValues"}},
+		{name: "render of another workspace", userID: "viewer", err: workspace.ErrRenderNotFound, want: http.StatusNotFound, wantBody: []string{"render not found"}},
+		{name: "database error", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: []string{"failed to get render status"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			originalGet, originalSecrets := getRenderOfWorkspace, unacknowledgedDebugSecrets
+			t.Cleanup(func() { getRenderOfWorkspace, unacknowledgedDebugSecrets = originalGet, originalSecrets })
+			getRenderOfWorkspace = func(ctx context.Context, workspaceID string, renderID string) (*workspacetypes.Rendered, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "render", renderID)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return rendered, nil
+			}
+			unacknowledgedDebugSecrets = func(ctx context.Context, workspaceID string, d workspacetypes.RenderDebug) ([]workspacetypes.SecretFinding, error) {
+				assert.Equal(t, *debug, d)
+				return tt.secrets, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/render/render/status", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("renderID", "render")
+			rec := httptest.NewRecorder()
+			RenderStatus(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			for _, want := range tt.wantBody {
+				assert.Contains(t, rec.Body.String(), want)
+			}
+			for _, notWant := range tt.notInBody {
+				assert.NotContains(t, rec.Body.String(), notWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// listSecretFindings is a var so that the handler can be tested without a database
+var listSecretFindings = listCurrentSecretFindings
+
+// ListSecretFindingsResponse is the response to GET /api/workspace/{id}/secrets
+type ListSecretFindingsResponse struct {
+	// Findings are the secrets in the files of the current revision, with their values redacted.
+	// Allowlisted secrets are left out.
+	Findings []workspacetypes.SecretFinding `json:"findings"`
+}
+
+// ListSecretFindings responds with the secrets found in the files of the current revision of a
+// workspace, and whether each of them can be sent to LLMs
+func ListSecretFindings(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	findings, err := listSecretFindings(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list secret findings: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list secret findings"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListSecretFindingsResponse{Findings: findings})
+}
+
+func listCurrentSecretFindings(ctx context.Context, workspaceID string) ([]workspacetypes.SecretFinding, error) {
+	ws, err := workspace.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	return workspace.ListSecretFindings(ctx, workspaceID, ws.CurrentRevision)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSecretFindings(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "listed", userID: "viewer", want: http.StatusOK, wantBody: `"findings":[{"filePath":"values.yaml","detector":"aws-access-key-id","line":3,"fingerprint":"0123456789abcdef","redacted":"AKIA****","acknowledged":false}]`},
+		{name: "not a member", userID: "stranger", want: http.StatusForbidden},
+		{name: "database error", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to list secret findings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			original := listSecretFindings
+			t.Cleanup(func() { listSecretFindings = original })
+			listSecretFindings = func(ctx context.Context, workspaceID string) ([]workspacetypes.SecretFinding, error) {
+				assert.Equal(t, "ws", workspaceID)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return []workspacetypes.SecretFinding{{FilePath: "values.yaml", Detector: "aws-access-key-id", Line: 3, Fingerprint: "0123456789abcdef", Redacted: "AKIA****"}}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/secrets", nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			ListSecretFindings(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database or realtime server
+var (
+	getWorkspaceSettings = workspace.GetSettings
+	setWorkspaceSettings = workspace.SetSettings
+	sendSettingsUpdated  = sendSettingsUpdatedEvent
+	checkAppVersionSync  = workspace.AppVersionSyncWarnings
+)
+
+// WorkspaceSettingsResponse is the response to GET and PATCH /api/workspace/{id}/settings
+type WorkspaceSettingsResponse struct {
+	// Settings has every setting, with defaults for the ones that aren't set
+	Settings map[string]any `json:"settings"`
+	// Warnings describe the app_version_sync mappings that won't sync when they're changed, such
+	// as a values path that isn't in the chart's values.yaml. The mappings are saved anyway.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// UpdateWorkspaceSettingsRequest is the body of PATCH /api/workspace/{id}/settings
+type UpdateWorkspaceSettingsRequest struct {
+	// Settings are the settings to change, settings that aren't in it keep their values.
+	// Booleans can be sent as "true" or "on" and lists as comma separated strings.
+	Settings map[string]json.RawMessage `json:"settings"`
+}
+
+func (r UpdateWorkspaceSettingsRequest) validate() error {
+	if len(r.Settings) == 0 {
+		return errors.New("settings is required")
+	}
+	return nil
+}
+
+// GetWorkspaceSettings responds with the settings of a workspace
+func GetWorkspaceSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	settings, err := getWorkspaceSettings(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get workspace settings: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get settings"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, WorkspaceSettingsResponse{Settings: settings})
+}
+
+// UpdateWorkspaceSettings changes settings of a workspace and tells its clients. Unknown keys and
+// values of the wrong type are rejected without changing anything. A changed app_version_sync is
+// checked against the charts of the current revision, and what won't sync is returned as warnings.
+func UpdateWorkspaceSettings(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	var req UpdateWorkspaceSettingsRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	if err := setWorkspaceSettings(r.Context(), workspaceID, req.Settings); err != nil {
+		if errors.Is(err, workspace.ErrUnknownSetting) || errors.Is(err, workspace.ErrInvalidSetting) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to set workspace settings: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to set settings"})
+		return
+	}
+
+	settings, err := getWorkspaceSettings(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get workspace settings: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get settings"})
+		return
+	}
+
+	// the settings are saved either way, clients that miss the event pick them up when they reload
+	if err := sendSettingsUpdated(r.Context(), workspaceID, settings); err != nil {
+		logger.WarnCtx(r.Context(), "Failed to send settings update", zap.String("workspaceID", workspaceID), zap.Error(err))
+	}
+
+	var warnings []string
+	if _, ok := req.Settings[workspace.SettingAppVersionSync]; ok {
+		warnings, err = checkAppVersionSync(r.Context(), workspaceID)
+		if err != nil {
+			logger.WarnCtx(r.Context(), "Failed to check app version sync", zap.String("workspaceID", workspaceID), zap.Error(err))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, WorkspaceSettingsResponse{Settings: settings, Warnings: warnings})
+}
+
+func sendSettingsUpdatedEvent(ctx context.Context, workspaceID string, settings map[string]any) error {
+	userIDs, err := workspace.ListUserIDsForWorkspace(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return realtime.SendEvent(ctx, realtimetypes.Recipient{UserIDs: userIDs}, realtimetypes.SettingsUpdatedEvent{
+		WorkspaceID: workspaceID,
+		Settings:    settings,
+	})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateWorkspaceSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		want     int
+		wantBody string
+		wantSent bool
+		warnings []string
+	}{
+		{name: "updated", body: `{"settings": {"auto_generate_readme": "on"}}`, want: http.StatusOK, wantBody: `"auto_generate_readme":true`, wantSent: true},
+		{name: "app version sync", body: `{"settings": {"app_version_sync": [{"valuesPath": "image.digest"}]}}`, want: http.StatusOK, wantBody: `"warnings":["image.digest isn't a string, number or boolean in the values.yaml of chart nginx"]`, wantSent: true, warnings: []string{"image.digest isn't a string, number or boolean in the values.yaml of chart nginx"}},
+		{name: "empty", body: `{"settings": {}}`, want: http.StatusBadRequest, wantBody: "settings is required"},
+		{name: "unknown key", body: `{"settings": {"theme": "dark"}}`, err: fmt.Errorf("%w \"theme\", valid settings are auto_generate_readme", workspace.ErrUnknownSetting), want: http.StatusBadRequest, wantBody: "valid settings are auto_generate_readme"},
+		{name: "invalid value", body: `{"settings": {"auto_generate_readme": "maybe"}}`, err: fmt.Errorf("%w: auto_generate_readme", workspace.ErrInvalidSetting), want: http.StatusBadRequest, wantBody: "invalid setting"},
+		{name: "database error", body: `{"settings": {"auto_generate_readme": true}}`, err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to set settings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalGet, originalSet, originalSend, originalCheck := getWorkspaceSettings, setWorkspaceSettings, sendSettingsUpdated, checkAppVersionSync
+			t.Cleanup(func() {
+				getWorkspaceSettings, setWorkspaceSettings, sendSettingsUpdated, checkAppVersionSync = originalGet, originalSet, originalSend, originalCheck
+			})
+
+			stored := map[string]any{"auto_generate_readme": false}
+			setWorkspaceSettings = func(ctx context.Context, workspaceID string, values map[string]json.RawMessage) error {
+				if tt.err != nil {
+					return tt.err
+				}
+				stored["auto_generate_readme"] = true
+				return nil
+			}
+			getWorkspaceSettings = func(ctx context.Context, workspaceID string) (map[string]any, error) {
+				return stored, nil
+			}
+			checkAppVersionSync = func(ctx context.Context, workspaceID string) ([]string, error) {
+				return tt.warnings, nil
+			}
+			sent := false
+			sendSettingsUpdated = func(ctx context.Context, workspaceID string, settings map[string]any) error {
+				sent = true
+				assert.Equal(t, "ws", workspaceID)
+				return errors.New("realtime is down")
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/workspace/ws/settings", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			UpdateWorkspaceSettings(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantSent, sent)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	createShareLink   = workspace.CreateShareLink
+	listShareLinks    = workspace.ListShareLinks
+	revokeShareLink   = workspace.RevokeShareLink
+	getSharedSnapshot = workspace.GetSharedSnapshot
+)
+
+// CreateShareLinkRequest is the body of POST /api/workspace/{id}/share
+type CreateShareLinkRequest struct {
+	// RevisionNumber is the revision to share, the current revision when it's 0
+	RevisionNumber int `json:"revisionNumber"`
+	// ExpiresInHours is how long the link works, 7 days when it's 0 and at most 30 days
+	ExpiresInHours int `json:"expiresInHours"`
+}
+
+func (r CreateShareLinkRequest) validate() error {
+	if r.RevisionNumber < 0 {
+		return errors.New("revisionNumber can't be negative")
+	}
+	if r.ExpiresInHours < 0 || time.Duration(r.ExpiresInHours)*time.Hour > workspace.MaxShareLinkTTL {
+		return fmt.Errorf("expiresInHours must be between 1 and %d", int(workspace.MaxShareLinkTTL.Hours()))
+	}
+	return nil
+}
+
+// CreateShareLinkResponse is the response to POST /api/workspace/{id}/share
+type CreateShareLinkResponse struct {
+	workspacetypes.ShareLink
+	// Token is read with GET /api/share/{token}. It's only returned here.
+	Token string `json:"token"`
+}
+
+// ListShareLinksResponse is the response to GET /api/workspace/{id}/share
+type ListShareLinksResponse struct {
+	// ShareLinks are the links that haven't expired or been revoked, newest first, without their
+	// tokens
+	ShareLinks []workspacetypes.ShareLink `json:"shareLinks"`
+}
+
+// CreateShareLink creates a link that shows a revision of a workspace to anyone who has it, until
+// it expires or is revoked
+func CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	userID := requestUserID(r)
+	if refuseRole(w, r.Context(), workspaceID, userID, workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	var req CreateShareLinkRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	ttl := workspace.DefaultShareLinkTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	link, token, err := createShareLink(r.Context(), workspaceID, req.RevisionNumber, userID, ttl)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrRevisionNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		case errors.Is(err, workspace.ErrWorkspaceArchived):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: workspace.ErrWorkspaceArchived.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to create share link: %w", err), zap.String("workspaceID", workspaceID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create share link"})
+		}
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditShareLinkCreated, map[string]interface{}{
+		"shareLinkId":    link.ID,
+		"revisionNumber": link.RevisionNumber,
+		"expiresAt":      link.ExpiresAt,
+	})
+
+	writeJSON(w, http.StatusCreated, CreateShareLinkResponse{ShareLink: *link, Token: token})
+}
+
+// ListShareLinks responds with the share links of a workspace that still work
+func ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	links, err := listShareLinks(r.Context(), workspaceID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list share links: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list share links"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListShareLinksResponse{ShareLinks: links})
+}
+
+// RevokeShareLink stops a share link of a workspace from working
+func RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	shareLinkID := r.PathValue("shareID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	if err := revokeShareLink(r.Context(), workspaceID, shareLinkID); err != nil {
+		if errors.Is(err, workspace.ErrShareLinkNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "share link not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to revoke share link: %w", err), zap.String("workspaceID", workspaceID), zap.String("shareLinkID", shareLinkID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to revoke share link"})
+		return
+	}
+
+	recordAudit(r.Context(), workspaceID, workspace.AuditActorUser, workspace.AuditShareLinkRevoked, map[string]interface{}{
+		"shareLinkId": shareLinkID,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSharedSnapshot responds with the revision a share link shows. It's served without the
+// internal API key, so the response is the same 404 whether the token never existed, expired or
+// was revoked.
+func GetSharedSnapshot(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := getSharedSnapshot(r.Context(), r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, workspace.ErrShareLinkNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "share link not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to get shared snapshot: %w", err))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to get shared snapshot"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	writeJSON(w, http.StatusOK, snapshot)
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateShareLink(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"editor": workspacetypes.WorkspaceRoleEditor, "viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name         string
+		userID       string
+		body         string
+		err          error
+		want         int
+		wantBody     string
+		wantRevision int
+		wantTTL      time.Duration
+		wantAudit    []string
+	}{
+		{name: "current revision", userID: "editor", body: `{}`, want: http.StatusCreated, wantBody: `"token":"0123abcd"`, wantTTL: workspace.DefaultShareLinkTTL, wantAudit: []string{workspace.AuditShareLinkCreated}},
+		{name: "revision and expiry", userID: "editor", body: `{"revisionNumber":3,"expiresInHours":2}`, want: http.StatusCreated, wantBody: `"revisionNumber":3`, wantRevision: 3, wantTTL: 2 * time.Hour, wantAudit: []string{workspace.AuditShareLinkCreated}},
+		{name: "too long", userID: "editor", body: `{"expiresInHours":721}`, want: http.StatusBadRequest, wantBody: "expiresInHours must be between 1 and 720"},
+		{name: "negative revision", userID: "editor", body: `{"revisionNumber":-1}`, want: http.StatusBadRequest, wantBody: "revisionNumber can't be negative"},
+		{name: "viewer", userID: "viewer", body: `{}`, want: http.StatusForbidden},
+		{name: "unknown revision", userID: "editor", body: `{"revisionNumber":9}`, err: fmt.Errorf("%w: 9", workspace.ErrRevisionNotFound), want: http.StatusNotFound, wantBody: "revision not found: 9", wantRevision: 9, wantTTL: workspace.DefaultShareLinkTTL},
+		{name: "archived", userID: "editor", body: `{}`, err: fmt.Errorf("%w: ws", workspace.ErrWorkspaceArchived), want: http.StatusConflict, wantBody: "workspace is archived", wantTTL: workspace.DefaultShareLinkTTL},
+		{name: "database error", userID: "editor", body: `{}`, err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to create share link", wantTTL: workspace.DefaultShareLinkTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			audited := stubAudit(t)
+			original := createShareLink
+			t.Cleanup(func() { createShareLink = original })
+
+			var gotRevision int
+			var gotTTL time.Duration
+			createShareLink = func(ctx context.Context, workspaceID string, revisionNumber int, createdByUserID string, ttl time.Duration) (*workspacetypes.ShareLink, string, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, tt.userID, createdByUserID)
+				gotRevision, gotTTL = revisionNumber, ttl
+				if tt.err != nil {
+					return nil, "", tt.err
+				}
+				return &workspacetypes.ShareLink{ID: "share", WorkspaceID: workspaceID, RevisionNumber: max(revisionNumber, 1)}, "0123abcd", nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/share", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			CreateShareLink(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantRevision, gotRevision)
+			assert.Equal(t, tt.wantTTL, gotTTL)
+			assert.Equal(t, append([]string{}, tt.wantAudit...), *audited)
+		})
+	}
+}
+
+func TestRevokeShareLink(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"editor": workspacetypes.WorkspaceRoleEditor, "viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "revoked", userID: "editor", want: http.StatusNoContent},
+		{name: "viewer", userID: "viewer", want: http.StatusForbidden},
+		{name: "unknown link", userID: "editor", err: fmt.Errorf("%w: share", workspace.ErrShareLinkNotFound), want: http.StatusNotFound, wantBody: "share link not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			stubAudit(t)
+			original := revokeShareLink
+			t.Cleanup(func() { revokeShareLink = original })
+			revokeShareLink = func(ctx context.Context, workspaceID string, shareLinkID string) error {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "share", shareLinkID)
+				return tt.err
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/workspace/ws/share/share", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("shareID", "share")
+			rec := httptest.NewRecorder()
+			RevokeShareLink(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestGetSharedSnapshot(t *testing.T) {
+	original := getSharedSnapshot
+	t.Cleanup(func() { getSharedSnapshot = original })
+	getSharedSnapshot = func(ctx context.Context, token string) (*workspacetypes.SharedSnapshot, error) {
+		if token != "valid" {
+			return nil, workspace.ErrShareLinkNotFound
+		}
+		return &workspacetypes.SharedSnapshot{
+			WorkspaceName:  "shared",
+			RevisionNumber: 1,
+			Charts:         []workspacetypes.SharedChart{{Name: "app", Files: []workspacetypes.SharedFile{{Path: "values.yaml", Content: "replicaCount: 1"}}}},
+			Files:          []workspacetypes.SharedFile{},
+		}, nil
+	}
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/share/"+token, nil)
+		req.SetPathValue("token", token)
+		rec := httptest.NewRecorder()
+		GetSharedSnapshot(rec, req)
+		return rec
+	}
+
+	rec := get("valid")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"charts":[{"name":"app","files":[{"path":"values.yaml","content":"replicaCount: 1"}]}]`)
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+
+	// expired, revoked and unknown tokens are all ErrShareLinkNotFound, and look the same
+	notFound := get("expired")
+	assert.Equal(t, http.StatusNotFound, notFound.Code)
+	assert.Equal(t, get("unknown").Body.String(), notFound.Body.String())
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	listPromptSnippets  = workspace.ListPromptSnippets
+	getPromptSnippet    = workspace.GetPromptSnippet
+	setPromptSnippet    = workspace.SetPromptSnippet
+	deletePromptSnippet = workspace.DeletePromptSnippet
+)
+
+// ListPromptSnippetsResponse is the response to GET /api/user/{userID}/prompt-snippets
+type ListPromptSnippetsResponse struct {
+	Snippets []workspacetypes.PromptSnippet `json:"snippets"`
+}
+
+// SetPromptSnippetRequest is the body of PUT /api/user/{userID}/prompt-snippets/{name}
+type SetPromptSnippetRequest struct {
+	// Name is the snippet's name from the path, it isn't in the body
+	Name string `json:"-"`
+	// Content is the instruction, at most workspace.MaxPromptSnippetBytes
+	Content string `json:"content"`
+	// ApplyAutomatically gives the snippet to the LLM when planning and executing changes to the
+	// workspaces the user created
+	ApplyAutomatically bool `json:"applyAutomatically"`
+}
+
+func (r SetPromptSnippetRequest) validate() error {
+	return workspace.ValidatePromptSnippet(r.Name, r.Content)
+}
+
+// ListPromptSnippets responds with the prompt snippets of a user
+func ListPromptSnippets(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userID")
+	if refuseOtherUser(w, r, userID) {
+		return
+	}
+
+	snippets, err := listPromptSnippets(r.Context(), userID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list prompt snippets: %w", err), zap.String("userID", userID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list prompt snippets"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ListPromptSnippetsResponse{Snippets: snippets})
+}
+
+// GetPromptSnippet responds with a prompt snippet of a user
+func GetPromptSnippet(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userID")
+	name := r.PathValue("name")
+	if refuseOtherUser(w, r, userID) {
+		return
+	}
+
+	snippet, err := getPromptSnippet(r.Context(), userID, name)
+	if err != nil {
+		writePromptSnippetError(w, r, err, "failed to get prompt snippet", userID, name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snippet)
+}
+
+// SetPromptSnippet creates or replaces a prompt snippet of a user
+func SetPromptSnippet(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userID")
+	name := r.PathValue("name")
+	if refuseOtherUser(w, r, userID) {
+		return
+	}
+
+	req := SetPromptSnippetRequest{Name: name}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	snippet, err := setPromptSnippet(r.Context(), userID, name, req.Content, req.ApplyAutomatically)
+	if err != nil {
+		writePromptSnippetError(w, r, err, "failed to set prompt snippet", userID, name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, snippet)
+}
+
+// DeletePromptSnippet deletes a prompt snippet of a user
+func DeletePromptSnippet(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userID")
+	name := r.PathValue("name")
+	if refuseOtherUser(w, r, userID) {
+		return
+	}
+
+	if err := deletePromptSnippet(r.Context(), userID, name); err != nil {
+		writePromptSnippetError(w, r, err, "failed to delete prompt snippet", userID, name)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refuseOtherUser responds with 403 and returns true when a request made for a user is for the
+// snippets of another user. Requests made by chartsmith aren't refused.
+func refuseOtherUser(w http.ResponseWriter, r *http.Request, userID string) bool {
+	requestUser := requestUserID(r)
+	if requestUser == "" || requestUser == userID {
+		return false
+	}
+	writeJSON(w, http.StatusForbidden, errorResponse{Error: "prompt snippets can only be managed by their user"})
+	return true
+}
+
+func writePromptSnippetError(w http.ResponseWriter, r *http.Request, err error, message string, userID string, name string) {
+	if errors.Is(err, workspace.ErrPromptSnippetNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "prompt snippet not found"})
+		return
+	}
+	logger.ErrorCtx(r.Context(), fmt.Errorf("%s: %w", message, err), zap.String("userID", userID), zap.String("snippet", name))
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: message})
+}
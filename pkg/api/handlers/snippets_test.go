@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func promptSnippetRequest(method string, name string, body string) *http.Request {
+	req := httptest.NewRequest(method, "/api/user/user-1/prompt-snippets/"+name, strings.NewReader(body))
+	req.SetPathValue("userID", "user-1")
+	req.SetPathValue("name", name)
+	return req
+}
+
+func TestSetPromptSnippet(t *testing.T) {
+	tests := []struct {
+		name       string
+		snippet    string
+		body       string
+		user       string
+		setErr     error
+		want       int
+		wantBody   string
+		wantStored bool
+	}{
+		{name: "created", snippet: "labels", body: `{"content":"Add part-of labels.","applyAutomatically":true}`, want: http.StatusOK, wantBody: `"applyAutomatically":true`, wantStored: true},
+		{name: "made for the user", snippet: "labels", body: `{"content":"Add part-of labels."}`, user: "user-1", want: http.StatusOK, wantBody: `"name":"labels"`, wantStored: true},
+		{name: "another user", snippet: "labels", body: `{"content":"Add part-of labels."}`, user: "user-2", want: http.StatusForbidden, wantBody: "only be managed by their user"},
+		{name: "invalid name", snippet: "Labels", body: `{"content":"Add part-of labels."}`, want: http.StatusBadRequest, wantBody: "invalid snippet name"},
+		{name: "too large", snippet: "labels", body: `{"content":"` + strings.Repeat("a", workspace.MaxPromptSnippetBytes+1) + `"}`, want: http.StatusBadRequest, wantBody: "the most is"},
+		{name: "database error", snippet: "labels", body: `{"content":"Add part-of labels."}`, setErr: errors.New("database unavailable"), want: http.StatusInternalServerError, wantBody: "failed to set prompt snippet", wantStored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := setPromptSnippet
+			t.Cleanup(func() { setPromptSnippet = original })
+
+			stored := false
+			setPromptSnippet = func(ctx context.Context, userID string, name string, content string, applyAutomatically bool) (*workspacetypes.PromptSnippet, error) {
+				stored = true
+				if tt.setErr != nil {
+					return nil, tt.setErr
+				}
+				return &workspacetypes.PromptSnippet{ID: "snippet", UserID: userID, Name: name, Content: content, ApplyAutomatically: applyAutomatically}, nil
+			}
+
+			rec := httptest.NewRecorder()
+			SetPromptSnippet(rec, withUser(promptSnippetRequest(http.MethodPut, tt.snippet, tt.body), tt.user))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "database unavailable")
+			assert.Equal(t, tt.wantStored, stored)
+		})
+	}
+}
+
+func TestDeletePromptSnippet(t *testing.T) {
+	tests := []struct {
+		name      string
+		deleteErr error
+		want      int
+		wantBody  string
+	}{
+		{name: "deleted", want: http.StatusNoContent},
+		{name: "unknown snippet", deleteErr: workspace.ErrPromptSnippetNotFound, want: http.StatusNotFound, wantBody: "prompt snippet not found"},
+		{name: "database error", deleteErr: errors.New("database unavailable"), want: http.StatusInternalServerError, wantBody: "failed to delete prompt snippet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := deletePromptSnippet
+			t.Cleanup(func() { deletePromptSnippet = original })
+
+			deletePromptSnippet = func(ctx context.Context, userID string, name string) error {
+				return tt.deleteErr
+			}
+
+			rec := httptest.NewRecorder()
+			DeletePromptSnippet(rec, promptSnippetRequest(http.MethodDelete, "labels", ""))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "database unavailable")
+		})
+	}
+}
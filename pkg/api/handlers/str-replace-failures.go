@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+)
+
+const (
+	defaultStrReplaceFailuresPageSize = 100
+	maxStrReplaceFailuresPageSize     = 1000
+)
+
+// this is a var so that the handler can be tested without a database
+var getStrReplaceFailures = llm.GetStrReplaceFailures
+
+// StrReplaceFailuresResponse is the response to GET /api/admin/str-replace-failures
+type StrReplaceFailuresResponse struct {
+	// Failures are newest first
+	Failures []StrReplaceFailure `json:"failures"`
+	// NextCursor is passed as cursor to get the next page, it's empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// StrReplaceFailure is a str_replace operation whose old_str wasn't found in the file
+type StrReplaceFailure struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	FilePath  string    `json:"filePath"`
+	OldStr    string    `json:"oldStr"`
+	NewStr    string    `json:"newStr"`
+	// FileContent is the content of the file when old_str wasn't found in it
+	FileContent   string `json:"fileContent"`
+	OldStrLen     int    `json:"oldStrLen"`
+	NewStrLen     int    `json:"newStrLen"`
+	ContextBefore string `json:"contextBefore,omitempty"`
+	ContextAfter  string `json:"contextAfter,omitempty"`
+	ErrorMessage  string `json:"errorMessage,omitempty"`
+	FailureKind   string `json:"failureKind,omitempty"`
+}
+
+// StrReplaceFailures responds with a page of the str_replace operations that failed to find
+// old_str, with the file content at the time of the failure, for building prompt tuning and
+// evaluation datasets. It's admin only and nothing is redacted. limit is the page size, since an
+// RFC 3339 timestamp of the oldest failure, filePath the file, and cursor the nextCursor of the
+// previous page.
+func StrReplaceFailures(w http.ResponseWriter, r *http.Request) {
+	if refuseNonAdmin(w, r) {
+		return
+	}
+	query := r.URL.Query()
+
+	filter := llm.StrReplaceFailureFilter{Limit: defaultStrReplaceFailuresPageSize, FilePath: query.Get("filePath")}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxStrReplaceFailuresPageSize {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("limit must be a number from 1 to %d", maxStrReplaceFailuresPageSize)})
+			return
+		}
+		filter.Limit = n
+	}
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "since must be an RFC 3339 timestamp"})
+			return
+		}
+		filter.Since = &t
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := llm.DecodeStrReplaceFailureCursor(cursor)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		filter.After = after
+	}
+
+	failures, next, err := getStrReplaceFailures(r.Context(), filter)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list str_replace failures: %w", err))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list str_replace failures"})
+		return
+	}
+
+	response := StrReplaceFailuresResponse{Failures: make([]StrReplaceFailure, 0, len(failures))}
+	for _, failure := range failures {
+		response.Failures = append(response.Failures, StrReplaceFailure{
+			ID:            failure.ID,
+			CreatedAt:     failure.CreatedAt,
+			FilePath:      failure.FilePath,
+			OldStr:        failure.OldStr,
+			NewStr:        failure.NewStr,
+			FileContent:   failure.UpdatedContent,
+			OldStrLen:     failure.OldStrLen,
+			NewStrLen:     failure.NewStrLen,
+			ContextBefore: failure.ContextBefore,
+			ContextAfter:  failure.ContextAfter,
+			ErrorMessage:  failure.ErrorMessage,
+			FailureKind:   failure.FailureKind,
+		})
+	}
+	if next != nil {
+		response.NextCursor = llm.EncodeStrReplaceFailureCursor(*next)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrReplaceFailures(t *testing.T) {
+	createdAt := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	next := &llm.StrReplaceFailureCursor{CreatedAt: createdAt, ID: "failure-1"}
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		userID     string
+		query      string
+		err        error
+		wantStatus int
+		wantFilter llm.StrReplaceFailureFilter
+	}{
+		{name: "first page", userID: "admin", wantStatus: http.StatusOK, wantFilter: llm.StrReplaceFailureFilter{Limit: 100}},
+		{
+			name:       "filtered next page",
+			userID:     "admin",
+			query:      "?limit=5&filePath=values.yaml&since=2026-10-01T00:00:00Z&cursor=" + llm.EncodeStrReplaceFailureCursor(*next),
+			wantStatus: http.StatusOK,
+			wantFilter: llm.StrReplaceFailureFilter{Limit: 5, FilePath: "values.yaml", Since: &since, After: next},
+		},
+		{name: "not an admin", userID: "jane", wantStatus: http.StatusForbidden},
+		{name: "limit too large", userID: "admin", query: "?limit=1001", wantStatus: http.StatusBadRequest},
+		{name: "since not a timestamp", userID: "admin", query: "?since=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "invalid cursor", userID: "admin", query: "?cursor=nope", wantStatus: http.StatusBadRequest},
+		{name: "database error", userID: "admin", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubSystemPrompts(t)
+			filters := []llm.StrReplaceFailureFilter{}
+			original := getStrReplaceFailures
+			getStrReplaceFailures = func(ctx context.Context, filter llm.StrReplaceFailureFilter) ([]llm.StrReplaceLog, *llm.StrReplaceFailureCursor, error) {
+				filters = append(filters, filter)
+				if tt.err != nil {
+					return nil, nil, tt.err
+				}
+				return []llm.StrReplaceLog{{ID: "failure-1", CreatedAt: createdAt, FilePath: "values.yaml", OldStr: "a", UpdatedContent: "b", FailureKind: "indentation"}}, next, nil
+			}
+			t.Cleanup(func() { getStrReplaceFailures = original })
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/str-replace-failures"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			StrReplaceFailures(rec, withUser(req, tt.userID))
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+			assert.NotContains(t, rec.Body.String(), "connection refused")
+			if tt.wantStatus != http.StatusOK {
+				if tt.err == nil {
+					assert.Empty(t, filters)
+				}
+				return
+			}
+
+			assert.Equal(t, []llm.StrReplaceFailureFilter{tt.wantFilter}, filters)
+
+			var resp StrReplaceFailuresResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, []StrReplaceFailure{{ID: "failure-1", CreatedAt: createdAt, FilePath: "values.yaml", OldStr: "a", FileContent: "b", FailureKind: "indentation"}}, resp.Failures)
+			assert.Equal(t, llm.EncodeStrReplaceFailureCursor(*next), resp.NextCursor)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	listSystemPrompts            = workspace.ListSystemPrompts
+	createSystemPromptVersion    = workspace.CreateSystemPromptVersion
+	activateSystemPromptVersion  = workspace.ActivateSystemPromptVersion
+	invalidateSystemPromptsCache = llm.InvalidatePromptCache
+)
+
+// ListSystemPromptsResponse is the response to GET /api/admin/prompts
+type ListSystemPromptsResponse struct {
+	Prompts []SystemPromptVersions `json:"prompts"`
+}
+
+// SystemPromptVersions is a prompt of the registry and its versions, oldest first
+type SystemPromptVersions struct {
+	Name string `json:"name"`
+	// Extends is the prompt this one is appended to
+	Extends string `json:"extends,omitempty"`
+	// ActiveVersion is the version given to the LLM, 0 when the prompt has no versions yet and its
+	// default is given
+	ActiveVersion int                           `json:"activeVersion"`
+	Versions      []workspacetypes.SystemPrompt `json:"versions"`
+}
+
+// CreateSystemPromptVersionRequest is the body of POST /api/admin/prompts/{name}/versions
+type CreateSystemPromptVersionRequest struct {
+	// Content is the whole prompt, at most workspace.MaxSystemPromptBytes. A prompt that extends
+	// another is only what's appended to it.
+	Content string `json:"content"`
+	// Activate gives the new version to the LLM right away
+	Activate bool `json:"activate"`
+}
+
+func (r CreateSystemPromptVersionRequest) validate() error {
+	return workspace.ValidateSystemPrompt(r.Content)
+}
+
+// ListSystemPrompts responds with every prompt of the registry and all of its versions
+func ListSystemPrompts(w http.ResponseWriter, r *http.Request) {
+	if refuseNonAdmin(w, r) {
+		return
+	}
+
+	prompts, err := listSystemPrompts(r.Context())
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to list system prompts: %w", err))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list system prompts"})
+		return
+	}
+
+	byName := map[string][]workspacetypes.SystemPrompt{}
+	for _, prompt := range prompts {
+		byName[prompt.Name] = append(byName[prompt.Name], prompt)
+	}
+
+	response := ListSystemPromptsResponse{Prompts: []SystemPromptVersions{}}
+	for _, registered := range llm.RegisteredPrompts() {
+		versions := SystemPromptVersions{
+			Name:     string(registered.Name),
+			Extends:  string(registered.Extends),
+			Versions: byName[string(registered.Name)],
+		}
+		if versions.Versions == nil {
+			versions.Versions = []workspacetypes.SystemPrompt{}
+		}
+		for _, version := range versions.Versions {
+			if version.IsActive {
+				versions.ActiveVersion = version.Version
+			}
+		}
+		response.Prompts = append(response.Prompts, versions)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// CreateSystemPromptVersion adds a version of a prompt of the registry, and activates it when asked
+func CreateSystemPromptVersion(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if refuseNonAdmin(w, r) {
+		return
+	}
+	if _, ok := llm.FindRegisteredPrompt(name); !ok {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "prompt not found"})
+		return
+	}
+
+	var req CreateSystemPromptVersionRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	prompt, err := createSystemPromptVersion(r.Context(), name, req.Content, requestUserID(r))
+	if err != nil {
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to create system prompt version: %w", err), zap.String("prompt", name))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to create system prompt version"})
+		return
+	}
+
+	if req.Activate {
+		prompt, err = activateSystemPromptVersion(r.Context(), name, prompt.Version)
+		if err != nil {
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to activate system prompt version: %w", err), zap.String("prompt", name))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to activate system prompt version"})
+			return
+		}
+		invalidateSystemPromptsCache()
+	}
+
+	writeJSON(w, http.StatusCreated, prompt)
+}
+
+// ActivateSystemPromptVersion makes a version of a prompt the one given to the LLM. Other workers
+// give it once their cache of the active prompts expires.
+func ActivateSystemPromptVersion(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if refuseNonAdmin(w, r) {
+		return
+	}
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version < 1 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid version"})
+		return
+	}
+
+	prompt, err := activateSystemPromptVersion(r.Context(), name, version)
+	if err != nil {
+		if errors.Is(err, workspace.ErrSystemPromptNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "prompt version not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to activate system prompt version: %w", err), zap.String("prompt", name), zap.Int("version", version))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to activate system prompt version"})
+		return
+	}
+	invalidateSystemPromptsCache()
+
+	writeJSON(w, http.StatusOK, prompt)
+}
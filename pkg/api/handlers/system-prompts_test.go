@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubSystemPrompts makes admin the only admin user and returns how many times the prompt cache
+// was invalidated
+func stubSystemPrompts(t *testing.T) *int {
+	originalAdmin, originalList, originalCreate, originalActivate, originalInvalidate := isAdminUser, listSystemPrompts, createSystemPromptVersion, activateSystemPromptVersion, invalidateSystemPromptsCache
+	t.Cleanup(func() {
+		isAdminUser, listSystemPrompts, createSystemPromptVersion, activateSystemPromptVersion, invalidateSystemPromptsCache = originalAdmin, originalList, originalCreate, originalActivate, originalInvalidate
+	})
+
+	isAdminUser = func(ctx context.Context, userID string) (bool, error) {
+		return userID == "admin", nil
+	}
+	invalidated := 0
+	invalidateSystemPromptsCache = func() { invalidated++ }
+	return &invalidated
+}
+
+func TestListSystemPrompts(t *testing.T) {
+	createdAt := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody []string
+	}{
+		{
+			name:   "versions by prompt",
+			userID: "admin",
+			want:   http.StatusOK,
+			wantBody: []string{
+				`{"name":"common-system","activeVersion":2,"versions":[{"name":"common-system","version":1,"content":"v1","isActive":false,"createdAt":"2026-10-17T09:00:00Z","createdBy":"chartsmith"},{"name":"common-system","version":2,"content":"v2","isActive":true,"createdAt":"2026-10-17T09:00:00Z","createdBy":"admin"}]}`,
+				`{"name":"execute-plan-system","extends":"common-system","activeVersion":0,"versions":[]}`,
+			},
+		},
+		{name: "made by chartsmith", want: http.StatusOK, wantBody: []string{`"prompts":[`}},
+		{name: "not an admin", userID: "jane", want: http.StatusForbidden, wantBody: []string{"requires an admin"}},
+		{name: "database error", userID: "admin", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: []string{"failed to list system prompts"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubSystemPrompts(t)
+			listSystemPrompts = func(ctx context.Context) ([]workspacetypes.SystemPrompt, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return []workspacetypes.SystemPrompt{
+					{Name: "common-system", Version: 1, Content: "v1", CreatedAt: createdAt, CreatedBy: "chartsmith"},
+					{Name: "common-system", Version: 2, Content: "v2", IsActive: true, CreatedAt: createdAt, CreatedBy: "admin"},
+					{Name: "retired-prompt", Version: 1, Content: "old", IsActive: true, CreatedAt: createdAt},
+				}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/prompts", nil)
+			rec := httptest.NewRecorder()
+			ListSystemPrompts(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			for _, want := range tt.wantBody {
+				assert.Contains(t, rec.Body.String(), want)
+			}
+			assert.NotContains(t, rec.Body.String(), "retired-prompt", "only registered prompts are listed")
+		})
+	}
+}
+
+func TestCreateSystemPromptVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		userID          string
+		prompt          string
+		body            string
+		want            int
+		wantBody        string
+		wantActivated   bool
+		wantInvalidated int
+	}{
+		{name: "inactive version", userID: "admin", prompt: "common-system", body: `{"content":"You are ChartSmith."}`, want: http.StatusCreated, wantBody: `"version":4,"content":"You are ChartSmith.","isActive":false`},
+		{
+			name:            "activated version",
+			userID:          "admin",
+			prompt:          "common-system",
+			body:            `{"content":"You are ChartSmith.","activate":true}`,
+			want:            http.StatusCreated,
+			wantBody:        `"version":4,"content":"You are ChartSmith.","isActive":true`,
+			wantActivated:   true,
+			wantInvalidated: 1,
+		},
+		{name: "unknown prompt", userID: "admin", prompt: "missing", body: `{"content":"x"}`, want: http.StatusNotFound, wantBody: "prompt not found"},
+		{name: "empty content", userID: "admin", prompt: "common-system", body: `{"content":" "}`, want: http.StatusBadRequest, wantBody: "content is empty"},
+		{name: "too large", userID: "admin", prompt: "common-system", body: fmt.Sprintf(`{"content":%q}`, strings.Repeat("a", workspace.MaxSystemPromptBytes+1)), want: http.StatusBadRequest},
+		{name: "not an admin", userID: "jane", prompt: "common-system", body: `{"content":"x"}`, want: http.StatusForbidden, wantBody: "requires an admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalidated := stubSystemPrompts(t)
+			activated := false
+			createSystemPromptVersion = func(ctx context.Context, name string, content string, createdBy string) (*workspacetypes.SystemPrompt, error) {
+				assert.Equal(t, tt.userID, createdBy)
+				return &workspacetypes.SystemPrompt{Name: name, Version: 4, Content: content}, nil
+			}
+			activateSystemPromptVersion = func(ctx context.Context, name string, version int) (*workspacetypes.SystemPrompt, error) {
+				activated = true
+				assert.Equal(t, 4, version)
+				return &workspacetypes.SystemPrompt{Name: name, Version: version, Content: "You are ChartSmith.", IsActive: true}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/prompts/"+tt.prompt+"/versions", strings.NewReader(tt.body))
+			req.SetPathValue("name", tt.prompt)
+			rec := httptest.NewRecorder()
+			CreateSystemPromptVersion(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantActivated, activated)
+			assert.Equal(t, tt.wantInvalidated, *invalidated)
+		})
+	}
+}
+
+func TestActivateSystemPromptVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		userID          string
+		version         string
+		err             error
+		want            int
+		wantBody        string
+		wantInvalidated int
+	}{
+		{name: "activated", userID: "admin", version: "2", want: http.StatusOK, wantBody: `"version":2`, wantInvalidated: 1},
+		{name: "unknown version", userID: "admin", version: "9", err: fmt.Errorf("%w: common-system version 9", workspace.ErrSystemPromptNotFound), want: http.StatusNotFound, wantBody: "prompt version not found"},
+		{name: "invalid version", userID: "admin", version: "latest", want: http.StatusBadRequest, wantBody: "invalid version"},
+		{name: "database error", userID: "admin", version: "2", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to activate system prompt version"},
+		{name: "not an admin", userID: "jane", version: "2", want: http.StatusForbidden, wantBody: "requires an admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalidated := stubSystemPrompts(t)
+			activateSystemPromptVersion = func(ctx context.Context, name string, version int) (*workspacetypes.SystemPrompt, error) {
+				assert.Equal(t, "common-system", name)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspacetypes.SystemPrompt{Name: name, Version: version, IsActive: true}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/prompts/common-system/versions/"+tt.version+"/activate", nil)
+			req.SetPathValue("name", "common-system")
+			req.SetPathValue("version", tt.version)
+			rec := httptest.NewRecorder()
+			ActivateSystemPromptVersion(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, tt.wantInvalidated, *invalidated, "the prompt cache is invalidated once a version is activated")
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/chartunittest"
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database, an LLM or helm
+var (
+	generateChartUnitTests = llm.GenerateChartUnitTests
+	runChartUnitTests      = workspace.RunChartUnitTests
+	unitTestsEnabled       = workspace.UnitTestsEnabled
+)
+
+// GenerateUnitTestsRequest is the body of POST /api/workspace/{id}/chart/{chartID}/unit-tests
+type GenerateUnitTestsRequest struct {
+	// Templates are the paths of the templates to write suites for, such as
+	// templates/deployment.yaml. Empty writes a suite for every template.
+	Templates []string `json:"templates"`
+	// Enrich asks the LLM for test cases that override values, on top of the generated ones
+	Enrich bool `json:"enrich"`
+}
+
+// GenerateUnitTestsResponse is the response to POST /api/workspace/{id}/chart/{chartID}/unit-tests
+type GenerateUnitTestsResponse struct {
+	// Suites were written as pending content of the chart
+	Suites []llm.GeneratedUnitTests `json:"suites"`
+}
+
+func (r GenerateUnitTestsRequest) validate() error {
+	for _, template := range r.Templates {
+		if strings.TrimSpace(template) == "" {
+			return errors.New("templates must not be empty")
+		}
+	}
+	return nil
+}
+
+// GenerateUnitTests writes helm-unittest suites for templates of a chart in the current revision
+func GenerateUnitTests(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+
+	var req GenerateUnitTestsRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	suites, err := generateChartUnitTests(r.Context(), workspaceID, chartID, req.Templates, req.Enrich)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrChartNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+		case errors.Is(err, chartunittest.ErrNotTemplate):
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		case errors.Is(err, llm.ErrChartNotRendered), errors.Is(err, workspace.ErrSecretsNotAcknowledged):
+			writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to generate unit tests: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to generate unit tests"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, GenerateUnitTestsResponse{Suites: suites})
+}
+
+// RunUnitTests runs the helm-unittest suites of a chart in the current revision, including pending
+// ones, and responds with the output. It's only available with CHARTSMITH_HELM_UNITTEST=true.
+func RunUnitTests(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	if !unitTestsEnabled() {
+		writeJSON(w, http.StatusNotImplemented, errorResponse{Error: "unit tests are not enabled"})
+		return
+	}
+
+	result, err := runChartUnitTests(r.Context(), workspaceID, chartID)
+	if err != nil {
+		switch {
+		case errors.Is(err, workspace.ErrChartNotFound):
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+		case errors.Is(err, helmutils.ErrUnitTestPluginNotInstalled):
+			writeJSON(w, http.StatusNotImplemented, errorResponse{Error: err.Error()})
+		default:
+			logger.ErrorCtx(r.Context(), fmt.Errorf("failed to run unit tests: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to run unit tests"})
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/chartunittest"
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateUnitTests(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "generated", body: `{"templates": ["templates/service.yaml"], "enrich": true}`, want: http.StatusOK, wantBody: `"filePath":"tests/service_test.yaml"`},
+		{name: "every template", body: `{}`, want: http.StatusOK, wantBody: `"suites"`},
+		{name: "empty template", body: `{"templates": [""]}`, want: http.StatusBadRequest, wantBody: "templates must not be empty"},
+		{name: "unknown chart", body: `{}`, err: fmt.Errorf("%w: chart", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "not a template", body: `{"templates": ["values.yaml"]}`, err: fmt.Errorf("%w: values.yaml", chartunittest.ErrNotTemplate), want: http.StatusBadRequest, wantBody: "not a template: values.yaml"},
+		{name: "not rendered", body: `{}`, err: fmt.Errorf("%w: nginx", llm.ErrChartNotRendered), want: http.StatusConflict, wantBody: "no successful render"},
+		{name: "unacknowledged secrets", body: `{}`, err: fmt.Errorf("%w: found in values.yaml", workspace.ErrSecretsNotAcknowledged), want: http.StatusConflict, wantBody: "found in values.yaml"},
+		{name: "database error", body: `{}`, err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to generate unit tests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := generateChartUnitTests
+			t.Cleanup(func() { generateChartUnitTests = original })
+
+			var gotTemplates []string
+			var gotEnrich bool
+			generateChartUnitTests = func(ctx context.Context, workspaceID string, chartID string, templates []string, enrich bool) ([]llm.GeneratedUnitTests, error) {
+				gotTemplates, gotEnrich = templates, enrich
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return []llm.GeneratedUnitTests{{TemplatePath: "templates/service.yaml", FilePath: "tests/service_test.yaml"}}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/chart/chart/unit-tests", strings.NewReader(tt.body))
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			GenerateUnitTests(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.name == "generated" {
+				assert.Equal(t, []string{"templates/service.yaml"}, gotTemplates)
+				assert.True(t, gotEnrich)
+			}
+		})
+	}
+}
+
+func TestRunUnitTests(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "ran", want: http.StatusOK, wantBody: `"passed":false`},
+		{name: "disabled", disabled: true, want: http.StatusNotImplemented, wantBody: "unit tests are not enabled"},
+		{name: "plugin not installed", err: helmutils.ErrUnitTestPluginNotInstalled, want: http.StatusNotImplemented, wantBody: "plugin is not installed"},
+		{name: "unknown chart", err: fmt.Errorf("%w: chart", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "helm error", err: errors.New("no Chart.yaml file found"), want: http.StatusInternalServerError, wantBody: "failed to run unit tests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalRun, originalEnabled := runChartUnitTests, unitTestsEnabled
+			t.Cleanup(func() { runChartUnitTests, unitTestsEnabled = originalRun, originalEnabled })
+
+			ran := false
+			unitTestsEnabled = func() bool { return !tt.disabled }
+			runChartUnitTests = func(ctx context.Context, workspaceID string, chartID string) (*workspace.UnitTestResult, error) {
+				ran = true
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspace.UnitTestResult{Stdout: "FAIL\ttests/service_test.yaml\n"}, nil
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/chart/chart/unit-tests/run", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			RunUnitTests(rec, req)
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.Equal(t, !tt.disabled, ran)
+		})
+	}
+}
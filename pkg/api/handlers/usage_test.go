@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspaceUsage(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+	day := time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "usage", userID: "viewer", want: http.StatusOK, wantBody: `"totals":[{"operation":"plan","day":"2026-10-17","calls":2,"inputTokens":300,"outputTokens":50},{"operation":"summarize","day":"2026-10-18","calls":1,"inputTokens":10,"outputTokens":5}]`},
+		{name: "not a member", userID: "stranger", want: http.StatusForbidden, wantBody: `"error"`},
+		{name: "database error", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to get usage"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			original := getUsageSummary
+			t.Cleanup(func() { getUsageSummary = original })
+
+			getUsageSummary = func(ctx context.Context, workspaceID string) (*workspacetypes.UsageSummary, error) {
+				assert.Equal(t, "ws", workspaceID)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return workspace.AggregateUsage(workspaceID, []workspacetypes.LLMUsage{
+					{Operation: "summarize", InputTokens: 10, OutputTokens: 5, CreatedAt: day.Add(time.Hour)},
+					{Operation: "plan", InputTokens: 100, OutputTokens: 20, CreatedAt: day},
+					{Operation: "plan", InputTokens: 200, OutputTokens: 30, CreatedAt: day.Add(-time.Hour)},
+				}), nil
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/usage", nil)
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			WorkspaceUsage(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// getChartValuesAnalysis is a var so that the handler can be tested without a database
+var getChartValuesAnalysis = workspace.GetChartValuesAnalysis
+
+// ValuesAnalysis responds with the values.yaml keys that no template of a chart in the current
+// revision references, and the keys its templates reference that values.yaml doesn't define
+func ValuesAnalysis(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	chartID := r.PathValue("chartID")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+
+	analysis, err := getChartValuesAnalysis(r.Context(), workspaceID, chartID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrChartNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "chart not found"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to analyze values: %w", err), zap.String("workspaceID", workspaceID), zap.String("chartID", chartID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to analyze values"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, analysis)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuesAnalysis(t *testing.T) {
+	roles := map[string]workspacetypes.WorkspaceRole{"viewer": workspacetypes.WorkspaceRoleViewer}
+
+	tests := []struct {
+		name     string
+		userID   string
+		err      error
+		want     int
+		wantBody string
+	}{
+		{name: "analysis", userID: "viewer", want: http.StatusOK, wantBody: `"unusedKeys":["replicaCount"]`},
+		{name: "not a member", userID: "stranger", want: http.StatusForbidden, wantBody: `"error"`},
+		{name: "unknown chart", userID: "viewer", err: fmt.Errorf("%w: chart", workspace.ErrChartNotFound), want: http.StatusNotFound, wantBody: "chart not found"},
+		{name: "database error", userID: "viewer", err: errors.New("connection refused"), want: http.StatusInternalServerError, wantBody: "failed to analyze values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, roles)
+			original := getChartValuesAnalysis
+			t.Cleanup(func() { getChartValuesAnalysis = original })
+
+			getChartValuesAnalysis = func(ctx context.Context, workspaceID string, chartID string) (*workspacetypes.ValuesAnalysis, error) {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, "chart", chartID)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return workspace.AnalyzeValuesUsage(&workspacetypes.Chart{ID: chartID, Files: []workspacetypes.File{
+					{FilePath: "values.yaml", Content: "replicaCount: 1\nimage: nginx\n"},
+					{FilePath: "templates/deployment.yaml", Content: "image: {{ .Values.image }}\n"},
+				}})
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/workspace/ws/chart/chart/values-analysis", nil)
+			req.SetPathValue("id", "ws")
+			req.SetPathValue("chartID", "chart")
+			rec := httptest.NewRecorder()
+			ValuesAnalysis(rec, withUser(req, tt.userID))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the handlers can be tested without a database
+var (
+	forkWorkspace      = workspace.ForkWorkspace
+	archiveWorkspace   = workspace.ArchiveWorkspace
+	unarchiveWorkspace = workspace.UnarchiveWorkspace
+	rollbackWorkspace  = workspace.RollbackToRevision
+)
+
+// ForkWorkspaceRequest is the body of POST /api/workspace/{id}/fork, it copies the latest complete
+// revision of a workspace into a new workspace
+type ForkWorkspaceRequest struct {
+	Name   string `json:"name"`
+	UserID string `json:"userId"`
+	// IncludeChatHistory copies the chat messages and the conversation summary
+	IncludeChatHistory bool `json:"includeChatHistory,omitempty"`
+}
+
+func (r ForkWorkspaceRequest) validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	return nil
+}
+
+// ForkWorkspace creates a copy of a workspace and responds with the new workspace
+func ForkWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req ForkWorkspaceRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	sourceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), sourceID, req.UserID, workspacetypes.WorkspaceRoleViewer) {
+		return
+	}
+	fork, err := forkWorkspace(r.Context(), sourceID, req.Name, req.UserID, workspace.ForkWorkspaceOpts{
+		IncludeChatHistory: req.IncludeChatHistory,
+	})
+	if err != nil {
+		if errors.Is(err, workspace.ErrNoCompleteRevision) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "workspace not found or has no complete revision"})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to fork workspace: %w", err), zap.String("workspaceID", sourceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to fork workspace"})
+		return
+	}
+
+	logger.InfoCtx(r.Context(), "Forked workspace", zap.String("workspaceID", sourceID), zap.String("forkID", fork.ID))
+	writeJSON(w, http.StatusCreated, fork)
+}
+
+// ArchiveWorkspaceResponse is the response to POST /api/workspace/{id}/archive
+type ArchiveWorkspaceResponse struct {
+	// ArchivedAt is when the workspace was archived, it's purged once the retention period after it
+	// has passed
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// ArchiveWorkspace archives a workspace, nothing can be enqueued for it until it's unarchived
+func ArchiveWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleOwner) {
+		return
+	}
+	archivedAt, err := archiveWorkspace(r.Context(), workspaceID)
+	if err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to archive workspace: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to archive workspace"})
+		return
+	}
+
+	logger.InfoCtx(r.Context(), "Archived workspace", zap.String("workspaceID", workspaceID), zap.Time("archivedAt", archivedAt))
+	writeJSON(w, http.StatusOK, ArchiveWorkspaceResponse{ArchivedAt: archivedAt})
+}
+
+// UnarchiveWorkspace restores an archived workspace that hasn't been purged yet
+func UnarchiveWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleOwner) {
+		return
+	}
+	if err := unarchiveWorkspace(r.Context(), workspaceID); err != nil {
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to unarchive workspace: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to unarchive workspace"})
+		return
+	}
+
+	logger.InfoCtx(r.Context(), "Unarchived workspace", zap.String("workspaceID", workspaceID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RollbackWorkspaceRequest is the body of POST /api/workspace/{id}/rollback
+type RollbackWorkspaceRequest struct {
+	RevisionNumber int `json:"revisionNumber"`
+}
+
+func (r RollbackWorkspaceRequest) validate() error {
+	if r.RevisionNumber < 0 {
+		return errors.New("revisionNumber must not be negative")
+	}
+	return nil
+}
+
+// RollbackWorkspace restores a revision as a new revision, keeping the revisions after it, and
+// enqueues a render of it. It responds with the new revision.
+func RollbackWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req RollbackWorkspaceRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	workspaceID := r.PathValue("id")
+	if refuseRole(w, r.Context(), workspaceID, requestUserID(r), workspacetypes.WorkspaceRoleEditor) {
+		return
+	}
+	if refuseArchived(w, r.Context(), workspaceArchived, workspaceID) {
+		return
+	}
+	rollback, err := rollbackWorkspace(r.Context(), workspaceID, req.RevisionNumber, requestUserID(r))
+	if err != nil {
+		if writeExecutionLocked(w, err) {
+			return
+		}
+		if errors.Is(err, workspace.ErrWorkspaceNotFound) || errors.Is(err, workspace.ErrRevisionNotFound) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		}
+		logger.ErrorCtx(r.Context(), fmt.Errorf("failed to roll back workspace: %w", err), zap.String("workspaceID", workspaceID))
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to roll back workspace"})
+		return
+	}
+
+	logger.InfoCtx(r.Context(), "Rolled back workspace", zap.String("workspaceID", workspaceID),
+		zap.Int("fromRevision", req.RevisionNumber), zap.Int("revisionNumber", rollback.RevisionNumber))
+	id, ok := enqueueJob(w, r.Context(), "render_workspace", map[string]interface{}{
+		"workspaceId":    workspaceID,
+		"revisionNumber": rollback.RevisionNumber,
+		"chatMessageId":  rollback.ChatMessageID,
+	})
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusAccepted, EnqueueResponse{JobID: id, RevisionNumber: rollback.RevisionNumber})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type forkCall struct {
+	sourceID string
+	name     string
+	userID   string
+	opts     workspace.ForkWorkspaceOpts
+}
+
+// stubForkWorkspace replaces forking with a function that records its arguments
+func stubForkWorkspace(t *testing.T, err error) *[]forkCall {
+	stubWorkspaceRole(t, map[string]types.WorkspaceRole{"user": types.WorkspaceRoleViewer})
+	calls := []forkCall{}
+	original := forkWorkspace
+	forkWorkspace = func(ctx context.Context, sourceID string, name string, userID string, opts workspace.ForkWorkspaceOpts) (*types.Workspace, error) {
+		calls = append(calls, forkCall{sourceID: sourceID, name: name, userID: userID, opts: opts})
+		if err != nil {
+			return nil, err
+		}
+		return &types.Workspace{ID: "fork", Name: name, CurrentRevision: 3}, nil
+	}
+	t.Cleanup(func() { forkWorkspace = original })
+	return &calls
+}
+
+func forkRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/fork", strings.NewReader(body))
+	req.SetPathValue("id", "ws")
+	return req
+}
+
+func TestForkWorkspace(t *testing.T) {
+	calls := stubForkWorkspace(t, nil)
+
+	rec := httptest.NewRecorder()
+	ForkWorkspace(rec, forkRequest(`{"name":"risky refactor","userId":"user","includeChatHistory":true}`))
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var resp types.Workspace
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, "fork", resp.ID)
+	assert.Equal(t, 3, resp.CurrentRevision)
+
+	require.Len(t, *calls, 1)
+	assert.Equal(t, forkCall{sourceID: "ws", name: "risky refactor", userID: "user", opts: workspace.ForkWorkspaceOpts{IncludeChatHistory: true}}, (*calls)[0])
+}
+
+func TestForkWorkspaceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		forkErr  error
+		want     int
+		wantBody string
+	}{
+		{name: "without name", body: `{"userId":"user"}`, want: http.StatusBadRequest, wantBody: "name is required"},
+		{name: "without user", body: `{"name":"fork"}`, want: http.StatusBadRequest, wantBody: "userId is required"},
+		{name: "no complete revision", body: `{"name":"fork","userId":"user"}`, forkErr: workspace.ErrNoCompleteRevision, want: http.StatusNotFound, wantBody: "no complete revision"},
+		{name: "database error", body: `{"name":"fork","userId":"user"}`, forkErr: errors.New("database unavailable"), want: http.StatusInternalServerError, wantBody: "failed to fork workspace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubForkWorkspace(t, tt.forkErr)
+
+			rec := httptest.NewRecorder()
+			ForkWorkspace(rec, forkRequest(tt.body))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "database unavailable")
+		})
+	}
+}
+
+func archiveRequest(action string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/"+action, nil)
+	req.SetPathValue("id", "ws")
+	return req
+}
+
+func TestArchiveWorkspace(t *testing.T) {
+	archivedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "archived", wantStatus: http.StatusOK},
+		{name: "not found", err: workspace.ErrWorkspaceNotFound, wantStatus: http.StatusNotFound},
+		{name: "database error", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := []string{}
+			original := archiveWorkspace
+			archiveWorkspace = func(ctx context.Context, workspaceID string) (time.Time, error) {
+				calls = append(calls, workspaceID)
+				return archivedAt, tt.err
+			}
+			t.Cleanup(func() { archiveWorkspace = original })
+
+			rec := httptest.NewRecorder()
+			ArchiveWorkspace(rec, archiveRequest("archive"))
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, []string{"ws"}, calls)
+			assert.NotContains(t, rec.Body.String(), "connection refused")
+			if tt.wantStatus == http.StatusOK {
+				var resp ArchiveWorkspaceResponse
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.True(t, archivedAt.Equal(resp.ArchivedAt))
+			}
+		})
+	}
+}
+
+func TestUnarchiveWorkspace(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "unarchived", wantStatus: http.StatusNoContent},
+		{name: "not found or purged", err: workspace.ErrWorkspaceNotFound, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := unarchiveWorkspace
+			unarchiveWorkspace = func(ctx context.Context, workspaceID string) error { return tt.err }
+			t.Cleanup(func() { unarchiveWorkspace = original })
+
+			rec := httptest.NewRecorder()
+			UnarchiveWorkspace(rec, archiveRequest("unarchive"))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestRollbackWorkspace(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		err        error
+		wantStatus int
+	}{
+		{name: "rolled back", user: "editor", wantStatus: http.StatusAccepted},
+		{name: "plan executing", user: "editor", err: &workspace.ExecutionLockedError{WorkspaceID: "ws", PlanID: "plan-1"}, wantStatus: http.StatusConflict},
+		{name: "revision not found", user: "editor", err: workspace.ErrRevisionNotFound, wantStatus: http.StatusNotFound},
+		{name: "viewer refused", user: "viewer", wantStatus: http.StatusForbidden},
+		{name: "database error", user: "editor", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubWorkspaceRole(t, map[string]types.WorkspaceRole{"editor": types.WorkspaceRoleEditor, "viewer": types.WorkspaceRoleViewer})
+			messages := stubEnqueue(t, nil)
+			calls := []int{}
+			original := rollbackWorkspace
+			rollbackWorkspace = func(ctx context.Context, workspaceID string, revisionNumber int, userID string) (*workspace.Rollback, error) {
+				calls = append(calls, revisionNumber)
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &workspace.Rollback{RevisionNumber: 5, ChatMessageID: "chat-1"}, nil
+			}
+			t.Cleanup(func() { rollbackWorkspace = original })
+
+			req := httptest.NewRequest(http.MethodPost, "/api/workspace/ws/rollback", strings.NewReader(`{"revisionNumber":2}`))
+			req.SetPathValue("id", "ws")
+			rec := httptest.NewRecorder()
+			RollbackWorkspace(rec, withUser(req, tt.user))
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+			assert.NotContains(t, rec.Body.String(), "connection refused")
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Empty(t, calls)
+				return
+			}
+			assert.Equal(t, []int{2}, calls)
+			if tt.wantStatus != http.StatusAccepted {
+				assert.Empty(t, *messages)
+				return
+			}
+			var resp EnqueueResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			assert.Equal(t, EnqueueResponse{JobID: "job-1", RevisionNumber: 5}, resp)
+			require.Len(t, *messages, 1)
+			assert.Equal(t, "render_workspace", (*messages)[0].channel)
+			assert.Equal(t, map[string]interface{}{"workspaceId": "ws", "revisionNumber": 5, "chatMessageId": "chat-1"}, (*messages)[0].payload)
+		})
+	}
+}
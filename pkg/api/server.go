@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/api/handlers"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// shareRateLimit and shareRateBurst bound the requests each client makes to share links, which are
+// served without the internal API key
+const (
+	shareRateLimit = rate.Limit(5)
+	shareRateBurst = 20
+)
+
+// NewInternalHandler routes the internal API. Every route but share links requires the internal
+// API key, and every request gets an ID.
+func NewInternalHandler(apiKey string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /internal/render", handlers.Render)
+	mux.HandleFunc("POST /internal/plan/execute", handlers.ExecutePlan)
+	mux.HandleFunc("POST /internal/summarize", handlers.Summarize)
+	mux.HandleFunc("POST /api/workspace/{id}/fork", handlers.ForkWorkspace)
+	mux.HandleFunc("POST /api/workspace/{id}/archive", handlers.ArchiveWorkspace)
+	mux.HandleFunc("POST /api/workspace/{id}/unarchive", handlers.UnarchiveWorkspace)
+	mux.HandleFunc("POST /api/workspace/{id}/rollback", handlers.RollbackWorkspace)
+	mux.HandleFunc("GET /api/workspace/{id}/settings", handlers.GetWorkspaceSettings)
+	mux.HandleFunc("PATCH /api/workspace/{id}/settings", handlers.UpdateWorkspaceSettings)
+	mux.HandleFunc("GET /api/workspace/{id}/audit", handlers.AuditLog)
+	mux.HandleFunc("GET /api/workspace/{id}/members", handlers.ListWorkspaceMembers)
+	mux.HandleFunc("PUT /api/workspace/{id}/members/{userID}", handlers.SetWorkspaceMember)
+	mux.HandleFunc("DELETE /api/workspace/{id}/members/{userID}", handlers.RemoveWorkspaceMember)
+	mux.HandleFunc("GET /api/workspace/{id}/presence", handlers.GetWorkspacePresence)
+	mux.HandleFunc("POST /api/workspace/{id}/presence", handlers.PresenceHeartbeat)
+	mux.HandleFunc("DELETE /api/workspace/{id}/presence", handlers.LeaveWorkspace)
+	mux.HandleFunc("GET /api/bootstrap-templates", handlers.ListBootstrapTemplates)
+	mux.HandleFunc("POST /api/workspace/import/git", handlers.ImportGit)
+	mux.HandleFunc("POST /api/workspace/import/archive", handlers.ImportArchive)
+	mux.HandleFunc("GET /api/workspace/{id}/files/history", handlers.FileHistory)
+	mux.HandleFunc("GET /api/workspace/{id}/secrets", handlers.ListSecretFindings)
+	mux.HandleFunc("GET /api/workspace/{id}/duplicates", handlers.FindDuplicateFiles)
+	mux.HandleFunc("GET /api/workspace/{id}/tree", handlers.GetFileTree)
+	mux.HandleFunc("POST /api/workspace/{id}/share", handlers.CreateShareLink)
+	mux.HandleFunc("GET /api/workspace/{id}/share", handlers.ListShareLinks)
+	mux.HandleFunc("DELETE /api/workspace/{id}/share/{shareID}", handlers.RevokeShareLink)
+	mux.HandleFunc("GET /api/workspace/{id}/health", handlers.WorkspaceHealth)
+	mux.HandleFunc("GET /api/workspace/{id}/usage", handlers.WorkspaceUsage)
+	mux.HandleFunc("POST /api/workspace/{id}/chart/{chartID}/generate-readme", handlers.GenerateReadme)
+	mux.HandleFunc("POST /api/workspace/{id}/chart/{chartID}/unit-tests", handlers.GenerateUnitTests)
+	mux.HandleFunc("POST /api/workspace/{id}/chart/{chartID}/unit-tests/run", handlers.RunUnitTests)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/dependency-status", handlers.DependencyStatus)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/graph", handlers.ChartGraph)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/values-analysis", handlers.ValuesAnalysis)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/export", handlers.ExportChart)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/manifest", handlers.GetChartManifest)
+	mux.HandleFunc("PATCH /api/workspace/{id}/chart/{chartID}/manifest", handlers.UpdateChartManifest)
+	mux.HandleFunc("POST /api/workspace/{id}/plan/{planID}/review", handlers.ReviewActionFile)
+	mux.HandleFunc("POST /api/workspace/{id}/plan/{planID}/proceed", handlers.ProceedPlan)
+	mux.HandleFunc("GET /api/plan/{id}/status", handlers.PlanStatus)
+	mux.HandleFunc("POST /api/plan/{id}/dry-run", handlers.PlanDryRun)
+	mux.HandleFunc("POST /api/plan/{id}/rebase", handlers.RebasePlan)
+	mux.HandleFunc("GET /api/workspace/{id}/revision/{revision}/patches", handlers.ListPendingPatches)
+	mux.HandleFunc("GET /api/workspace/{id}/revision/{revision}/patches/{fileID}/preview", handlers.PreviewPatch)
+	mux.HandleFunc("POST /api/workspace/{id}/revision/{revision}/patches/{fileID}/accept", handlers.AcceptPatch)
+	mux.HandleFunc("POST /api/workspace/{id}/revision/{revision}/patches/{fileID}/reject", handlers.RejectPatch)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/values-profiles", handlers.ListValuesProfiles)
+	mux.HandleFunc("GET /api/workspace/{id}/chart/{chartID}/values-profiles/{name}", handlers.GetValuesProfile)
+	mux.HandleFunc("PUT /api/workspace/{id}/chart/{chartID}/values-profiles/{name}", handlers.SetValuesProfile)
+	mux.HandleFunc("DELETE /api/workspace/{id}/chart/{chartID}/values-profiles/{name}", handlers.DeleteValuesProfile)
+	mux.HandleFunc("GET /api/user/{userID}/prompt-snippets", handlers.ListPromptSnippets)
+	mux.HandleFunc("GET /api/user/{userID}/prompt-snippets/{name}", handlers.GetPromptSnippet)
+	mux.HandleFunc("PUT /api/user/{userID}/prompt-snippets/{name}", handlers.SetPromptSnippet)
+	mux.HandleFunc("DELETE /api/user/{userID}/prompt-snippets/{name}", handlers.DeletePromptSnippet)
+	mux.HandleFunc("POST /api/workspace/{id}/render/{renderID}/cluster-dry-run", handlers.ClusterDryRun)
+	mux.HandleFunc("POST /api/workspace/{id}/render/{renderID}/explain", handlers.ExplainResource)
+	mux.HandleFunc("GET /api/workspace/{id}/render/{renderID}/status", handlers.RenderStatus)
+	mux.HandleFunc("POST /api/render/{renderID}/create-fix-plan", handlers.CreateFixPlan)
+	mux.HandleFunc("POST /api/workspace/{id}/messages", handlers.CreateChatMessage)
+	mux.HandleFunc("GET /api/admin/prompts", handlers.ListSystemPrompts)
+	mux.HandleFunc("GET /api/admin/str-replace-failures", handlers.StrReplaceFailures)
+	mux.HandleFunc("POST /api/admin/prompts/{name}/versions", handlers.CreateSystemPromptVersion)
+	mux.HandleFunc("POST /api/admin/prompts/{name}/versions/{version}/activate", handlers.ActivateSystemPromptVersion)
+
+	public := http.NewServeMux()
+	public.Handle("GET /api/share/{token}", handlers.LimitRate(shareRateLimit, shareRateBurst, http.HandlerFunc(handlers.GetSharedSnapshot)))
+	public.Handle("/", handlers.RequireInternalAPIKey(apiKey, mux))
+	return handlers.WithRequestID(public)
+}
+
+// ServeInternal serves the internal API on address until ctx is done
+func ServeInternal(ctx context.Context, address string, apiKey string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           NewInternalHandler(apiKey),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving internal API", zap.String("address", address))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve internal API: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/api/handlers"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInternalHandlerRoutes(t *testing.T) {
+	handler := NewInternalHandler("secret")
+
+	req := httptest.NewRequest(http.MethodGet, "/internal/render", nil)
+	req.Header.Set(handlers.InternalAPIKeyHeader, "secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/internal/unknown", nil)
+	req.Header.Set(handlers.InternalAPIKeyHeader, "secret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// the key is checked before routing
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/unknown", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// only reading a share link is served without the key
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/share/token", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/workspace/ws/share", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// TestInternalHandlerEnqueues posts to each route and checks the message in the work queue. It
+// runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestInternalHandlerEnqueues(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping internal API integration test")
+	}
+
+	ctx := context.Background()
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	// executing a plan looks it up for its workspace
+	_, err = conn.Exec(ctx, `INSERT INTO workspace_plan (id, workspace_id, chat_message_ids, created_at, updated_at, version, status)
+		VALUES ('internal-api-test', 'internal-api-test', '{}', now(), now(), 1, 'review') ON CONFLICT (id) DO NOTHING`)
+	require.NoError(t, err)
+	defer conn.Exec(context.Background(), `DELETE FROM workspace_plan WHERE id = 'internal-api-test'`)
+
+	handler := NewInternalHandler("secret")
+
+	tests := []struct {
+		path        string
+		body        string
+		wantChannel string
+		wantPayload map[string]interface{}
+	}{
+		{
+			path:        "/internal/render",
+			body:        `{"workspaceId":"internal-api-test","revisionNumber":1}`,
+			wantChannel: "render_workspace",
+			wantPayload: map[string]interface{}{"workspaceId": "internal-api-test", "revisionNumber": float64(1), "forceAll": false},
+		},
+		{
+			path:        "/internal/plan/execute",
+			body:        `{"planId":"internal-api-test"}`,
+			wantChannel: "execute_plan",
+			wantPayload: map[string]interface{}{"planId": "internal-api-test"},
+		},
+		{
+			path:        "/internal/summarize",
+			body:        `{"fileId":"internal-api-test","revision":1}`,
+			wantChannel: "new_summarize",
+			wantPayload: map[string]interface{}{"fileId": "internal-api-test", "revision": float64(1)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(handlers.InternalAPIKeyHeader, "secret")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+			var resp handlers.EnqueueResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+			require.NotEmpty(t, resp.JobID)
+			t.Cleanup(func() {
+				conn.Exec(context.Background(), `DELETE FROM work_queue WHERE id = $1`, resp.JobID)
+			})
+
+			var channel string
+			var payload map[string]interface{}
+			err := conn.QueryRow(ctx, `SELECT channel, payload FROM work_queue WHERE id = $1 AND completed_at IS NULL`, resp.JobID).Scan(&channel, &payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChannel, channel)
+			assert.Equal(t, tt.wantPayload, payload)
+		})
+	}
+}
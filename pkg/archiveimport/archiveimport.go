@@ -0,0 +1,203 @@
+// Package archiveimport reads a Helm chart from an uploaded archive, a tar that's usually gzipped
+// the way helm package writes it. The archive is read as a stream, nothing is written to disk.
+package archiveimport
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/replicatedhq/chartsmith/pkg/helmignore"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrInvalidArchive is returned when the upload isn't a tar or a gzipped tar, or has a path
+	// outside of the archive
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrTooManyFiles is returned when the archive has more files than the limit
+	ErrTooManyFiles = errors.New("archive has too many files")
+)
+
+// Limits bound what's read from an archive
+type Limits struct {
+	// MaxFiles is the most files an archive can have
+	MaxFiles int
+	// MaxFileBytes is the size of the largest file that's imported, larger files are left out
+	MaxFileBytes int64
+}
+
+// DefaultLimits returns the limits used when none are given, the same as for Git imports
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFiles:     1000,
+		MaxFileBytes: 1 << 20,
+	}
+}
+
+// ImportedArchive is a chart read from an archive
+type ImportedArchive struct {
+	// Name is the name in Chart.yaml, it's empty when there's no Chart.yaml or it has no name
+	Name string
+	// Files are the files of the chart, relative to its directory. Subcharts in charts/, binary
+	// files, files larger than the limit and files the chart's .helmignore excludes are left out,
+	// as they are when importing from Git.
+	Files []types.File
+	// BinaryFiles are the paths of the binary files that were left out
+	BinaryFiles []string
+	// OversizedFiles are the paths of the files that were left out for being larger than the limit
+	OversizedFiles []string
+}
+
+// archiveEntry is a regular file of an archive
+type archiveEntry struct {
+	path      string
+	content   []byte
+	oversized bool
+}
+
+// Read reads the chart in an archive. A chart packaged by helm is in a directory named after it,
+// that directory is the root of the chart.
+func Read(r io.Reader, limits Limits) (*ImportedArchive, error) {
+	entries, err := readEntries(r, limits)
+	if err != nil {
+		return nil, err
+	}
+	chartDir := commonDir(entries)
+
+	archive := &ImportedArchive{
+		Files:          []types.File{},
+		BinaryFiles:    []string{},
+		OversizedFiles: []string{},
+	}
+	for _, entry := range entries {
+		filePath := strings.TrimPrefix(entry.path, chartDir)
+		if strings.HasPrefix(filePath, "charts/") {
+			continue
+		}
+		switch {
+		case entry.oversized:
+			archive.OversizedFiles = append(archive.OversizedFiles, filePath)
+		case isBinary(entry.content):
+			archive.BinaryFiles = append(archive.BinaryFiles, filePath)
+		default:
+			archive.Files = append(archive.Files, types.File{FilePath: filePath, Content: string(entry.content)})
+		}
+	}
+
+	archive.Files, err = helmignore.FilterFiles(archive.Files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply .helmignore: %w", err)
+	}
+	archive.Name = chartName(archive.Files)
+
+	return archive, nil
+}
+
+// readEntries reads the regular files of a tar, gunzipping it first when it's gzipped. A file
+// that's in the archive twice is read from its last entry.
+func readEntries(r io.Reader, limits Limits) ([]archiveEntry, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(2)
+	var reader io.Reader = buffered
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	entries := []archiveEntry{}
+	byPath := map[string]int{}
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		filePath := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if path.IsAbs(filePath) || filePath == ".." || strings.HasPrefix(filePath, "../") {
+			return nil, fmt.Errorf("%w: %s is outside of the archive", ErrInvalidArchive, header.Name)
+		}
+
+		entry := archiveEntry{path: filePath, oversized: header.Size > limits.MaxFileBytes}
+		if !entry.oversized {
+			entry.content, err = io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidArchive, filePath, err)
+			}
+		}
+
+		if i, ok := byPath[filePath]; ok {
+			entries[i] = entry
+			continue
+		}
+		if len(entries) == limits.MaxFiles {
+			return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyFiles, limits.MaxFiles)
+		}
+		byPath[filePath] = len(entries)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// commonDir returns the directory every file of the archive is in, with a trailing slash, or ""
+// when some files are at the root or in different directories
+func commonDir(entries []archiveEntry) string {
+	dir := ""
+	for _, entry := range entries {
+		first, _, ok := strings.Cut(entry.path, "/")
+		if !ok || (dir != "" && dir != first+"/") {
+			return ""
+		}
+		dir = first + "/"
+	}
+	return dir
+}
+
+// isBinary reports whether content isn't text, with the same check as Git imports
+func isBinary(content []byte) bool {
+	if !utf8.Valid(content) {
+		return true
+	}
+	for _, b := range content {
+		if b < 32 && b != '\t' && b != '\n' && b != '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+// chartName is the name in the Chart.yaml, empty when it can't be read. The import's validation
+// reports what's wrong with the Chart.yaml.
+func chartName(files []types.File) string {
+	for _, file := range files {
+		if file.FilePath != "Chart.yaml" {
+			continue
+		}
+		var chartYAML struct {
+			Name string `yaml:"name"`
+		}
+		if err := yaml.Unmarshal([]byte(file.Content), &chartYAML); err != nil {
+			return ""
+		}
+		return chartYAML.Name
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package archiveimport
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newArchive writes files to a tar, gzipped when gzipped is true
+func newArchive(t *testing.T, gzipped bool, files []struct{ path, content string }) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, file := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: file.path, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(file.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	if gz != nil {
+		require.NoError(t, gz.Close())
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	files := []struct{ path, content string }{
+		{"nginx/Chart.yaml", "apiVersion: v2\nname: nginx\nversion: 1.0.0\n"},
+		{"nginx/values.yaml", "replicaCount: 1\n"},
+		{"nginx/templates/svc.yaml", "kind: Service\n"},
+		{"nginx/templates/notes.bak", "ignored"},
+		{"nginx/.helmignore", "*.bak\n"},
+		{"nginx/logo.png", "\x89PNG\r\n\x1a\n\x00\x00"},
+		{"nginx/files/dump.sql", strings.Repeat("x", 128)},
+		{"nginx/charts/redis/Chart.yaml", "apiVersion: v2\nname: redis\nversion: 1.0.0\n"},
+	}
+
+	for _, gzipped := range []bool{true, false} {
+		archive, err := Read(bytes.NewReader(newArchive(t, gzipped, files)), Limits{MaxFiles: 10, MaxFileBytes: 64})
+		require.NoError(t, err)
+
+		assert.Equal(t, "nginx", archive.Name)
+		paths := []string{}
+		for _, file := range archive.Files {
+			paths = append(paths, file.FilePath)
+		}
+		assert.Equal(t, []string{"Chart.yaml", "values.yaml", "templates/svc.yaml", ".helmignore"}, paths)
+		assert.Equal(t, []string{"logo.png"}, archive.BinaryFiles)
+		assert.Equal(t, []string{"files/dump.sql"}, archive.OversizedFiles)
+	}
+}
+
+func TestReadFilesAtTheRoot(t *testing.T) {
+	archive, err := Read(bytes.NewReader(newArchive(t, true, []struct{ path, content string }{
+		{"./Chart.yaml", "apiVersion: v2\nname: nginx\nversion: 1.0.0\n"},
+		{"./templates/svc.yaml", "kind: Service\n"},
+		{"./templates/Svc.yaml", "kind: Service\n"},
+		{"./templates/svc.yaml", "kind: Service\nmetadata: {}\n"},
+	})), DefaultLimits())
+	require.NoError(t, err)
+
+	require.Len(t, archive.Files, 3)
+	assert.Equal(t, "Chart.yaml", archive.Files[0].FilePath)
+	// a path in the archive twice is read from its last entry, paths that differ in case are kept
+	assert.Equal(t, "templates/svc.yaml", archive.Files[1].FilePath)
+	assert.Equal(t, "kind: Service\nmetadata: {}\n", archive.Files[1].Content)
+	assert.Equal(t, "templates/Svc.yaml", archive.Files[2].FilePath)
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) []byte
+		wantErr error
+	}{
+		{
+			name:    "not an archive",
+			archive: func(t *testing.T) []byte { return []byte("apiVersion: v2\nname: nginx\nversion: 1.0.0\n") },
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name: "corrupt gzip",
+			archive: func(t *testing.T) []byte {
+				b := newArchive(t, true, []struct{ path, content string }{{"Chart.yaml", "name: nginx\n"}})
+				return b[:len(b)/2]
+			},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name: "path outside of the archive",
+			archive: func(t *testing.T) []byte {
+				return newArchive(t, true, []struct{ path, content string }{{"../etc/passwd", "root"}})
+			},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name: "too many files",
+			archive: func(t *testing.T) []byte {
+				return newArchive(t, true, []struct{ path, content string }{{"a.yaml", "a"}, {"b.yaml", "b"}, {"c.yaml", "c"}})
+			},
+			wantErr: ErrTooManyFiles,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(tt.archive(t)), Limits{MaxFiles: 2, MaxFileBytes: 1 << 20})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Package chartunittest generates helm-unittest test suites for the templates of a chart
+package chartunittest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReleaseName is the release name charts are rendered with, see templateArgs in helm-utils. Suites
+// use it so that names rendered from the release match the rendered output they were generated from.
+const ReleaseName = "chartsmith"
+
+// ErrNotTemplate is returned for a path that isn't a template that renders manifests
+var ErrNotTemplate = errors.New("not a template")
+
+// Assertions is the helm-unittest assertion types a suite may use, generated or not
+var Assertions = map[string]bool{
+	"containsDocument": true,
+	"contains":         true,
+	"notContains":      true,
+	"equal":            true,
+	"notEqual":         true,
+	"equalRaw":         true,
+	"exists":           true,
+	"notExists":        true,
+	"failedTemplate":   true,
+	"hasDocuments":     true,
+	"isAPIVersion":     true,
+	"isKind":           true,
+	"isNull":           true,
+	"isNotNull":        true,
+	"isEmpty":          true,
+	"isNotEmpty":       true,
+	"isSubset":         true,
+	"lengthEqual":      true,
+	"matchRegex":       true,
+	"notMatchRegex":    true,
+}
+
+// Suite is a helm-unittest test file
+type Suite struct {
+	Suite     string     `yaml:"suite"`
+	Templates []string   `yaml:"templates"`
+	Release   Release    `yaml:"release"`
+	Tests     []TestCase `yaml:"tests"`
+}
+
+// Release is the release the templates of a suite are rendered as
+type Release struct {
+	Name string `yaml:"name"`
+}
+
+// TestCase renders the templates of its suite with the chart's values, overridden by Set, and
+// checks the output with its assertions
+type TestCase struct {
+	It      string                 `yaml:"it"`
+	Set     map[string]interface{} `yaml:"set,omitempty"`
+	Asserts []Assertion            `yaml:"asserts"`
+}
+
+// Assertion is one assertion of a test case, such as isKind with {of: Deployment}. DocumentIndex
+// picks a document of the rendered output, nil checks every document.
+type Assertion struct {
+	Type          string
+	Params        map[string]interface{}
+	DocumentIndex *int
+}
+
+// MarshalYAML writes the assertion the way helm-unittest reads it, keyed by its type
+func (a Assertion) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+
+	params := &yaml.Node{}
+	if a.Params == nil {
+		params = &yaml.Node{Kind: yaml.MappingNode, Style: yaml.FlowStyle}
+	} else if err := params.Encode(a.Params); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", a.Type, err)
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: a.Type}, params)
+
+	if a.DocumentIndex != nil {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "documentIndex"},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: fmt.Sprint(*a.DocumentIndex)})
+	}
+	return node, nil
+}
+
+// ParseAssertion reads an assertion from its helm-unittest form, a map with one assertion type
+// and an optional documentIndex
+func ParseAssertion(raw map[string]interface{}) (Assertion, error) {
+	assertion := Assertion{}
+	for key, value := range raw {
+		if key == "documentIndex" {
+			index, ok := asInt(value)
+			if !ok || index < 0 {
+				return Assertion{}, fmt.Errorf("invalid documentIndex %v", value)
+			}
+			assertion.DocumentIndex = &index
+			continue
+		}
+		if !Assertions[key] {
+			return Assertion{}, fmt.Errorf("unknown assertion %q", key)
+		}
+		if assertion.Type != "" {
+			return Assertion{}, fmt.Errorf("more than one assertion: %s and %s", assertion.Type, key)
+		}
+		assertion.Type = key
+		if value != nil {
+			params, ok := value.(map[string]interface{})
+			if !ok {
+				return Assertion{}, fmt.Errorf("%s must be an object", key)
+			}
+			assertion.Params = params
+		}
+	}
+	if assertion.Type == "" {
+		return Assertion{}, errors.New("no assertion")
+	}
+	return assertion, nil
+}
+
+func asInt(value interface{}) (int, bool) {
+	switch n := value.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), n == float64(int(n))
+	}
+	return 0, false
+}
+
+// YAML returns the test file of the suite
+func (s Suite) YAML() (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(s); err != nil {
+		return "", fmt.Errorf("failed to encode suite: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode suite: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// IsTestableTemplate reports whether a chart file is a template that renders manifests, partials
+// and NOTES.txt render nothing to assert on
+func IsTestableTemplate(filePath string) bool {
+	if !strings.HasPrefix(filePath, "templates/") {
+		return false
+	}
+	base := path.Base(filePath)
+	if strings.HasPrefix(base, "_") {
+		return false
+	}
+	ext := path.Ext(base)
+	return ext == ".yaml" || ext == ".yml" || ext == ".tpl"
+}
+
+// TestFilePath is where the suite of a template is written. helm-unittest only looks for
+// tests/*_test.yaml by default, so templates in subdirectories are flattened.
+func TestFilePath(templatePath string) string {
+	name := strings.TrimPrefix(templatePath, "templates/")
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return "tests/" + strings.ReplaceAll(name, "/", "_") + "_test.yaml"
+}
+
+var (
+	// sourceLine is the comment helm template writes before each document
+	sourceLine = regexp.MustCompile(`(?m)^# Source: (.+)$`)
+	// documentSeparator splits a stream of YAML documents
+	documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+)
+
+// RenderedDocuments groups the documents of helm template output by the template of the chart
+// that rendered them, keyed by the template's path in the chart. Documents of subcharts are left
+// out, and empty documents aren't counted, the same as helm-unittest.
+func RenderedDocuments(helmTemplateStdout string, chartName string) map[string][]string {
+	documents := map[string][]string{}
+
+	for _, document := range documentSeparator.Split(helmTemplateStdout, -1) {
+		match := sourceLine.FindStringSubmatch(document)
+		if match == nil {
+			continue
+		}
+		source, ok := strings.CutPrefix(strings.TrimSpace(match[1]), chartName+"/")
+		if !ok || !strings.HasPrefix(source, "templates/") {
+			continue
+		}
+
+		body := strings.TrimSpace(sourceLine.ReplaceAllString(document, ""))
+		if body == "" {
+			continue
+		}
+		documents[source] = append(documents[source], body)
+	}
+
+	return documents
+}
+
+// renderedMetadata is what the generated assertions check in each document
+type renderedMetadata struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+}
+
+// GenerateSuite creates the suite of a template from the documents it rendered with the chart's
+// values: a test of the number of documents, and a test of the kind, API version and name of each.
+// Documents that don't parse only count towards the number of documents.
+func GenerateSuite(templatePath string, documents []string) Suite {
+	suite := Suite{
+		Suite:     fmt.Sprintf("test %s", strings.TrimPrefix(templatePath, "templates/")),
+		Templates: []string{templatePath},
+		Release:   Release{Name: ReleaseName},
+		Tests: []TestCase{
+			{
+				It: fmt.Sprintf("renders %s with the default values", documentCount(len(documents))),
+				Asserts: []Assertion{
+					{Type: "hasDocuments", Params: map[string]interface{}{"count": len(documents)}},
+				},
+			},
+		},
+	}
+
+	for i, document := range documents {
+		var metadata renderedMetadata
+		if err := yaml.Unmarshal([]byte(document), &metadata); err != nil || metadata.Kind == "" {
+			continue
+		}
+
+		index := i
+		asserts := []Assertion{
+			{Type: "isKind", Params: map[string]interface{}{"of": metadata.Kind}, DocumentIndex: &index},
+		}
+		if metadata.APIVersion != "" {
+			asserts = append(asserts, Assertion{Type: "isAPIVersion", Params: map[string]interface{}{"of": metadata.APIVersion}, DocumentIndex: &index})
+		}
+		if metadata.Metadata.Name != "" {
+			asserts = append(asserts, Assertion{Type: "equal", Params: map[string]interface{}{"path": "metadata.name", "value": metadata.Metadata.Name}, DocumentIndex: &index})
+		}
+
+		it := fmt.Sprintf("renders a %s", metadata.Kind)
+		if metadata.Metadata.Name != "" {
+			it = fmt.Sprintf("renders the %s %s", metadata.Kind, metadata.Metadata.Name)
+		}
+		suite.Tests = append(suite.Tests, TestCase{It: it, Asserts: asserts})
+	}
+
+	return suite
+}
+
+func documentCount(n int) string {
+	if n == 1 {
+		return "1 document"
+	}
+	return fmt.Sprintf("%d documents", n)
+}
@@ -0,0 +1,147 @@
+package chartunittest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const helmTemplateStdout = `---
+# Source: nginx/templates/serviceaccount.yaml
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: chartsmith-nginx
+---
+# Source: nginx/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: chartsmith-nginx
+---
+# Source: nginx/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: chartsmith-nginx-headless
+---
+# Source: nginx/templates/hpa.yaml
+---
+# Source: nginx/charts/redis/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: chartsmith-redis
+`
+
+func TestRenderedDocuments(t *testing.T) {
+	documents := RenderedDocuments(helmTemplateStdout, "nginx")
+
+	assert.Len(t, documents, 2)
+	assert.Len(t, documents["templates/serviceaccount.yaml"], 1)
+	require.Len(t, documents["templates/service.yaml"], 2)
+	assert.Contains(t, documents["templates/service.yaml"][1], "name: chartsmith-nginx-headless")
+	assert.NotContains(t, documents["templates/service.yaml"][0], "# Source")
+}
+
+func TestGenerateSuite(t *testing.T) {
+	documents := RenderedDocuments(helmTemplateStdout, "nginx")
+
+	content, err := GenerateSuite("templates/service.yaml", documents["templates/service.yaml"]).YAML()
+	require.NoError(t, err)
+
+	assert.Equal(t, `suite: test service.yaml
+templates:
+  - templates/service.yaml
+release:
+  name: chartsmith
+tests:
+  - it: renders 2 documents with the default values
+    asserts:
+      - hasDocuments:
+          count: 2
+  - it: renders the Service chartsmith-nginx
+    asserts:
+      - isKind:
+          of: Service
+        documentIndex: 0
+      - isAPIVersion:
+          of: v1
+        documentIndex: 0
+      - equal:
+          path: metadata.name
+          value: chartsmith-nginx
+        documentIndex: 0
+  - it: renders the Service chartsmith-nginx-headless
+    asserts:
+      - isKind:
+          of: Service
+        documentIndex: 1
+      - isAPIVersion:
+          of: v1
+        documentIndex: 1
+      - equal:
+          path: metadata.name
+          value: chartsmith-nginx-headless
+        documentIndex: 1
+`, content)
+}
+
+func TestGenerateSuiteWithoutDocuments(t *testing.T) {
+	suite := GenerateSuite("templates/hpa.yaml", nil)
+
+	require.Len(t, suite.Tests, 1)
+	assert.Equal(t, "renders 0 documents with the default values", suite.Tests[0].It)
+	assert.Equal(t, map[string]interface{}{"count": 0}, suite.Tests[0].Asserts[0].Params)
+}
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Assertion
+		wantErr string
+	}{
+		{
+			name: "with document index",
+			raw:  `{"equal": {"path": "spec.replicas", "value": 3}, "documentIndex": 1}`,
+			want: Assertion{Type: "equal", Params: map[string]interface{}{"path": "spec.replicas", "value": 3}, DocumentIndex: intPtr(1)},
+		},
+		{name: "without params", raw: `{"failedTemplate": null}`, want: Assertion{Type: "failedTemplate"}},
+		{name: "unknown", raw: `{"isGreat": {}}`, wantErr: `unknown assertion "isGreat"`},
+		{name: "two assertions", raw: `{"isKind": {"of": "Pod"}, "exists": {"path": "spec"}}`, wantErr: "more than one assertion"},
+		{name: "negative document index", raw: `{"isKind": {"of": "Pod"}, "documentIndex": -1}`, wantErr: "invalid documentIndex"},
+		{name: "params not an object", raw: `{"isKind": "Pod"}`, wantErr: "isKind must be an object"},
+		{name: "empty", raw: `{}`, wantErr: "no assertion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var raw map[string]interface{}
+			require.NoError(t, yaml.Unmarshal([]byte(tt.raw), &raw))
+
+			got, err := ParseAssertion(raw)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTestFilePath(t *testing.T) {
+	assert.Equal(t, "tests/deployment_test.yaml", TestFilePath("templates/deployment.yaml"))
+	assert.Equal(t, "tests/ingress_tls_test.yaml", TestFilePath("templates/ingress/tls.yml"))
+
+	assert.True(t, IsTestableTemplate("templates/deployment.yaml"))
+	assert.False(t, IsTestableTemplate("templates/_helpers.tpl"))
+	assert.False(t, IsTestableTemplate("templates/NOTES.txt"))
+	assert.False(t, IsTestableTemplate("values.yaml"))
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,170 @@
+// Package circuitbreaker stops calls to a service that keeps failing, so that the work waiting on
+// it fails fast instead of each caller waiting out its own timeout. After a number of consecutive
+// failures the circuit opens and calls are refused. Once a cooldown has passed a single call is
+// let through as a probe: it closes the circuit if it succeeds and opens it again if it fails.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOpen is wrapped by the errors returned for calls that are refused while the circuit is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State is the state of a circuit
+type State string
+
+const (
+	// StateClosed lets every call through
+	StateClosed State = "closed"
+	// StateOpen refuses calls until the cooldown has passed
+	StateOpen State = "open"
+	// StateHalfOpen has let one probe call through and refuses the others until it finishes
+	StateHalfOpen State = "half-open"
+)
+
+// OpenError is returned for a call refused by an open circuit. It wraps ErrOpen.
+type OpenError struct {
+	Name string
+	// After is how long until the circuit lets a probe call through
+	After time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %s, retry in %s", ErrOpen, e.Name, e.After.Round(time.Second))
+}
+
+func (e *OpenError) Unwrap() error {
+	return ErrOpen
+}
+
+// RetryAfter is how long until the call can be retried
+func (e *OpenError) RetryAfter() time.Duration {
+	return e.After
+}
+
+// Options configure a Breaker
+type Options struct {
+	// Name identifies the service in errors and stats
+	Name string
+	// FailureThreshold is the number of consecutive failures that opens the circuit
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a probe call is let through
+	Cooldown time.Duration
+	// IsFailure reports whether an error returned by a call means the service is failing. Other
+	// errors count as successes, the service answered. Every error is a failure when it's nil.
+	IsFailure func(err error) bool
+}
+
+// Stats is a snapshot of a Breaker
+type Stats struct {
+	Name                string     `json:"name"`
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	// Opens counts the times the circuit opened
+	Opens int64 `json:"opens"`
+	// Rejections counts the calls refused while the circuit was open
+	Rejections int64 `json:"rejections"`
+}
+
+// Breaker is a circuit breaker, safe to share between goroutines
+type Breaker struct {
+	opts Options
+	// now is a var so that tests can move the clock
+	now func() time.Time
+
+	mu                  sync.Mutex
+	state               State
+	consecutiveFailures int
+	openedAt            time.Time
+	opens               int64
+	rejections          int64
+}
+
+// New returns a closed Breaker
+func New(opts Options) *Breaker {
+	if opts.FailureThreshold < 1 {
+		opts.FailureThreshold = 1
+	}
+	return &Breaker{opts: opts, now: time.Now, state: StateClosed}
+}
+
+// Do calls fn unless the circuit is open, and records whether the service failed. The error of a
+// refused call is an *OpenError.
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// allow returns an *OpenError if a call can't be made now. A call allowed while the circuit is half
+// open is the probe.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed >= b.opts.Cooldown {
+			b.state = StateHalfOpen
+			return nil
+		}
+		b.rejections++
+		return &OpenError{Name: b.opts.Name, After: b.opts.Cooldown - elapsed}
+	case StateHalfOpen:
+		// the probe hasn't finished, it's retried after another cooldown if it fails
+		b.rejections++
+		return &OpenError{Name: b.opts.Name, After: b.opts.Cooldown}
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	failed := err != nil && (b.opts.IsFailure == nil || b.opts.IsFailure(err))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		b.state = StateClosed
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.consecutiveFailures++
+	if b.state == StateHalfOpen || b.consecutiveFailures >= b.opts.FailureThreshold {
+		if b.state != StateOpen {
+			b.opens++
+		}
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Stats returns a snapshot of the breaker
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := Stats{
+		Name:                b.opts.Name,
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		Opens:               b.opens,
+		Rejections:          b.rejections,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
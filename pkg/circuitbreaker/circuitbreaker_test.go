@@ -0,0 +1,113 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errDown     = errors.New("connection refused")
+	errBadInput = errors.New("bad request")
+)
+
+func newTestBreaker() (*Breaker, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := New(Options{
+		Name:             "llm",
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+		IsFailure:        func(err error) bool { return errors.Is(err, errDown) },
+	})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker(t *testing.T) {
+	b, now := newTestBreaker()
+	calls := 0
+	call := func(err error) func() error {
+		return func() error {
+			calls++
+			return err
+		}
+	}
+
+	// errors that aren't failures of the service don't count
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, errBadInput, b.Do(call(errBadInput)))
+	}
+	assert.Equal(t, StateClosed, b.Stats().State)
+
+	// a success resets the count
+	assert.Equal(t, errDown, b.Do(call(errDown)))
+	assert.Equal(t, errDown, b.Do(call(errDown)))
+	assert.NoError(t, b.Do(call(nil)))
+	assert.Equal(t, 0, b.Stats().ConsecutiveFailures)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, errDown, b.Do(call(errDown)))
+	}
+	stats := b.Stats()
+	assert.Equal(t, StateOpen, stats.State)
+	assert.Equal(t, int64(1), stats.Opens)
+	require.NotNil(t, stats.OpenedAt)
+
+	// open, calls fail fast
+	calls = 0
+	*now = now.Add(10 * time.Second)
+	err := b.Do(call(nil))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrOpen))
+	var openErr *OpenError
+	require.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 20*time.Second, openErr.RetryAfter())
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, int64(1), b.Stats().Rejections)
+
+	// after the cooldown, a failed probe opens the circuit again
+	*now = now.Add(20 * time.Second)
+	assert.Equal(t, errDown, b.Do(call(errDown)))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, StateOpen, b.Stats().State)
+	assert.Equal(t, int64(2), b.Stats().Opens)
+	assert.True(t, errors.Is(b.Do(call(nil)), ErrOpen))
+
+	// and a successful probe closes it
+	*now = now.Add(30 * time.Second)
+	assert.NoError(t, b.Do(call(nil)))
+	stats = b.Stats()
+	assert.Equal(t, StateClosed, stats.State)
+	assert.Nil(t, stats.OpenedAt)
+	assert.NoError(t, b.Do(call(nil)))
+}
+
+func TestBreakerHalfOpenAllowsOneProbe(t *testing.T) {
+	b, now := newTestBreaker()
+	for i := 0; i < 3; i++ {
+		b.Do(func() error { return errDown })
+	}
+	*now = now.Add(30 * time.Second)
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Do(func() error {
+			close(probing)
+			<-release
+			return nil
+		})
+	}()
+	<-probing
+
+	assert.Equal(t, StateHalfOpen, b.Stats().State)
+	assert.True(t, errors.Is(b.Do(func() error { return nil }), ErrOpen), "only the probe is let through")
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, StateClosed, b.Stats().State)
+}
@@ -0,0 +1,248 @@
+// Package clusterdryrun validates rendered manifests against a live cluster with
+// kubectl apply --dry-run=server, which runs the cluster's schema validation and admission
+// without changing anything.
+package clusterdryrun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// DocumentTimeout bounds the dry run of a single document. kubectl is given the same request
+	// timeout, so that a cluster that accepts the connection and never answers can't hold it.
+	DocumentTimeout = 15 * time.Second
+
+	// concurrency is how many documents are dry run at once
+	concurrency = 4
+)
+
+var (
+	// documentSeparator splits a stream of YAML documents, as helm template prints them
+	documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+	// sourceLine is the comment helm template writes before each document
+	sourceLine = regexp.MustCompile(`(?m)^# Source: (.+)$`)
+	// namespaceNotFound is how the API server rejects an object in a namespace that doesn't exist
+	namespaceNotFound = regexp.MustCompile(`namespaces? "[^"]*" not found`)
+)
+
+// applyCommand returns the kubectl command that dry runs the document on its stdin. It's a var so
+// that Validate can be tested without kubectl or a cluster.
+var applyCommand = func(ctx context.Context, kubeconfigPath string) (*exec.Cmd, error) {
+	kubectl, err := exec.LookPath("kubectl")
+	if err != nil {
+		return nil, errors.New("kubectl is not installed")
+	}
+	return exec.CommandContext(ctx, kubectl,
+		"--kubeconfig", kubeconfigPath,
+		"--request-timeout", DocumentTimeout.String(),
+		"apply", "--dry-run=server", "-f", "-",
+	), nil
+}
+
+// kubectlEnv is the whole environment kubectl runs with. It doesn't inherit the worker's, which
+// has its API keys, and its home is a temp dir so that it reads no config or cache of the worker.
+func kubectlEnv(home string) []string {
+	return []string{
+		"HOME=" + home,
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+	}
+}
+
+// ParseKubeconfig checks a kubeconfig sent to be validated against and returns it as kubectl is
+// given it. Credentials that run a command (exec and auth-provider) and the fields that name a
+// file (certificates, keys and token files) would run or read it on the worker, so a kubeconfig
+// must have its credentials inline, as certificate-authority-data, client-certificate-data,
+// client-key-data, a token or a username and password.
+func ParseKubeconfig(kubeconfig string) ([]byte, error) {
+	config, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	if len(config.Clusters) == 0 {
+		return nil, errors.New("kubeconfig has no clusters")
+	}
+
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return nil, fmt.Errorf("cluster %q: certificate-authority is a file path, use certificate-authority-data", name)
+		}
+	}
+	for name, user := range config.AuthInfos {
+		switch {
+		case user.Exec != nil:
+			return nil, fmt.Errorf("user %q: exec credentials aren't supported, use a token or client-certificate-data", name)
+		case user.AuthProvider != nil:
+			return nil, fmt.Errorf("user %q: auth-provider credentials aren't supported, use a token or client-certificate-data", name)
+		case user.TokenFile != "":
+			return nil, fmt.Errorf("user %q: tokenFile is a file path, use token", name)
+		case user.ClientCertificate != "":
+			return nil, fmt.Errorf("user %q: client-certificate is a file path, use client-certificate-data", name)
+		case user.ClientKey != "":
+			return nil, fmt.Errorf("user %q: client-key is a file path, use client-key-data", name)
+		}
+	}
+
+	// kubectl reads the config as it was checked, without fields the parser doesn't know
+	data, err := clientcmd.Write(*config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+	return data, nil
+}
+
+// document is the part of a rendered document the results identify it by
+type document struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// Validate dry runs each document of the manifests against the cluster of the kubeconfig, which
+// must pass ParseKubeconfig. The kubeconfig is written to a temp dir only readable by the worker,
+// which is also kubectl's home, for as long as kubectl needs it. A document that the cluster
+// rejects isn't an error, it's reported in its result, as are documents that aren't validated
+// before ctx is done.
+func Validate(ctx context.Context, kubeconfig string, manifests string) ([]types.ClusterDryRunResult, error) {
+	config, err := ParseKubeconfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// MkdirTemp creates the dir 0700
+	home, err := os.MkdirTemp("", "chartsmith-kubectl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubectl home: %w", err)
+	}
+	defer os.RemoveAll(home)
+
+	kubeconfigPath := filepath.Join(home, "kubeconfig")
+	if err := os.WriteFile(kubeconfigPath, config, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write kubeconfig file: %w", err)
+	}
+
+	documents := splitDocuments(manifests)
+	results := make([]types.ClusterDryRunResult, len(documents))
+
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	for i, body := range documents {
+		results[i] = describe(body)
+
+		wg.Add(1)
+		go func(i int, body string) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i].Status = types.ClusterDryRunError
+				results[i].Message = fmt.Sprintf("not validated: %v", ctx.Err())
+				return
+			}
+
+			results[i].Status, results[i].Message = dryRun(ctx, home, kubeconfigPath, body)
+		}(i, body)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// splitDocuments returns the documents of the manifests that aren't empty, like the ones helm
+// prints for a template that rendered nothing but its # Source: line
+func splitDocuments(manifests string) []string {
+	documents := []string{}
+	for _, body := range documentSeparator.Split(manifests, -1) {
+		for _, line := range strings.Split(body, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				documents = append(documents, strings.TrimSpace(body)+"\n")
+				break
+			}
+		}
+	}
+	return documents
+}
+
+// describe returns a result for the document with what identifies it, documents that don't parse
+// are still dry run, for the cluster to reject
+func describe(body string) types.ClusterDryRunResult {
+	result := types.ClusterDryRunResult{}
+	if match := sourceLine.FindStringSubmatch(body); match != nil {
+		result.Source = strings.TrimSpace(match[1])
+	}
+
+	var doc document
+	if err := yaml.Unmarshal([]byte(body), &doc); err == nil {
+		result.Kind = doc.Kind
+		result.Name = doc.Metadata.Name
+		result.Namespace = doc.Metadata.Namespace
+	}
+	return result
+}
+
+func dryRun(ctx context.Context, home string, kubeconfigPath string, body string) (string, string) {
+	ctx, cancel := context.WithTimeout(ctx, DocumentTimeout)
+	defer cancel()
+
+	cmd, err := applyCommand(ctx, kubeconfigPath)
+	if err != nil {
+		return types.ClusterDryRunError, err.Error()
+	}
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd.Env = kubectlEnv(home)
+	cmd.Stdin = strings.NewReader(body)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// the context kills kubectl, but not a child that keeps its output open
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return types.ClusterDryRunError, fmt.Sprintf("the cluster didn't answer: %v", ctx.Err())
+		}
+		output := strings.TrimSpace(stderr.String())
+		if output == "" {
+			output = err.Error()
+		}
+		return classify(output), output
+	}
+
+	return types.ClusterDryRunAccepted, strings.TrimSpace(stdout.String())
+}
+
+// classify tells a missing namespace and the cluster rejecting a document apart from kubectl not
+// getting an answer from the cluster
+func classify(output string) string {
+	switch {
+	case namespaceNotFound.MatchString(output):
+		return types.ClusterDryRunNamespaceNotFound
+	case strings.Contains(output, "Error from server"),
+		strings.Contains(output, "error validating data"),
+		strings.Contains(output, "strict decoding error"),
+		strings.Contains(output, "no matches for kind"),
+		strings.Contains(output, "error parsing"):
+		return types.ClusterDryRunRejected
+	default:
+		return types.ClusterDryRunError
+	}
+}
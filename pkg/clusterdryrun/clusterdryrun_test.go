@@ -0,0 +1,194 @@
+package clusterdryrun
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKubectl answers like kubectl apply --dry-run=server would for the document on its stdin,
+// depending on its name
+const fakeKubectl = `
+test -r "$0" || { echo "kubeconfig not readable" >&2; exit 1; }
+test "$HOME" = "$(dirname "$0")" || { echo "home isn't the kubeconfig's dir" >&2; exit 1; }
+test -z "$ANTHROPIC_API_KEY" || { echo "worker environment leaked" >&2; exit 1; }
+doc=$(cat)
+case "$doc" in
+  *"name: good"*) echo "configmap/good created (server dry run)" ;;
+  *"name: invalid"*) echo 'Error from server (Invalid): error when creating "STDIN": Deployment.apps "invalid" is invalid: spec.selector: Required value' >&2; exit 1 ;;
+  *"name: elsewhere"*) echo 'Error from server (NotFound): error when creating "STDIN": namespaces "missing" not found' >&2; exit 1 ;;
+  *"name: hangs"*) sleep 5 ;;
+  *) echo "Unable to connect to the server: dial tcp: i/o timeout" >&2; exit 1 ;;
+esac
+`
+
+// testKubeconfig has its credentials inline, like ParseKubeconfig requires
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+    certificate-authority-data: Y2E=
+users:
+- name: test
+  user:
+    token: secret
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`
+
+func stubKubectl(t *testing.T) {
+	original := applyCommand
+	t.Cleanup(func() { applyCommand = original })
+
+	applyCommand = func(ctx context.Context, kubeconfigPath string) (*exec.Cmd, error) {
+		return exec.CommandContext(ctx, "sh", "-c", fakeKubectl, kubeconfigPath), nil
+	}
+}
+
+func TestValidate(t *testing.T) {
+	stubKubectl(t)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-worker")
+
+	manifests := `---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: good
+  namespace: default
+---
+# Source: app/templates/empty.yaml
+---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: invalid
+---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: elsewhere
+  namespace: missing
+---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: unreachable
+`
+
+	results, err := Validate(context.Background(), testKubeconfig, manifests)
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.ClusterDryRunResult{
+		{Source: "app/templates/configmap.yaml", Kind: "ConfigMap", Name: "good", Namespace: "default", Status: types.ClusterDryRunAccepted, Message: "configmap/good created (server dry run)"},
+		{Source: "app/templates/deployment.yaml", Kind: "Deployment", Name: "invalid", Status: types.ClusterDryRunRejected, Message: `Error from server (Invalid): error when creating "STDIN": Deployment.apps "invalid" is invalid: spec.selector: Required value`},
+		{Source: "app/templates/secret.yaml", Kind: "Secret", Name: "elsewhere", Namespace: "missing", Status: types.ClusterDryRunNamespaceNotFound, Message: `Error from server (NotFound): error when creating "STDIN": namespaces "missing" not found`},
+		{Source: "app/templates/service.yaml", Kind: "Service", Name: "unreachable", Status: types.ClusterDryRunError, Message: "Unable to connect to the server: dial tcp: i/o timeout"},
+	}, results)
+}
+
+func TestValidateRemovesKubeconfig(t *testing.T) {
+	original := applyCommand
+	t.Cleanup(func() { applyCommand = original })
+
+	var kubeconfigPath string
+	applyCommand = func(ctx context.Context, path string) (*exec.Cmd, error) {
+		kubeconfigPath = path
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		return exec.CommandContext(ctx, "true"), nil
+	}
+
+	_, err := Validate(context.Background(), testKubeconfig, "kind: ConfigMap\nmetadata:\n  name: a\n")
+	require.NoError(t, err)
+	require.NotEmpty(t, kubeconfigPath)
+	assert.NoFileExists(t, kubeconfigPath)
+}
+
+func TestValidateTimeout(t *testing.T) {
+	stubKubectl(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results, err := Validate(ctx, testKubeconfig, "kind: ConfigMap\nmetadata:\n  name: hangs\n---\nkind: ConfigMap\nmetadata:\n  name: good\n")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	require.Len(t, results, 2)
+	assert.Equal(t, types.ClusterDryRunError, results[0].Status)
+	assert.Contains(t, results[0].Message, "the cluster didn't answer")
+	assert.Equal(t, types.ClusterDryRunAccepted, results[1].Status)
+}
+
+func TestParseKubeconfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster string
+		user    string
+		wantErr string
+	}{
+		{name: "inline", cluster: "certificate-authority-data: Y2E=", user: "client-certificate-data: Y2VydA==\n    client-key-data: a2V5"},
+		{name: "token", cluster: "insecure-skip-tls-verify: true", user: "token: secret"},
+		{name: "exec", cluster: "certificate-authority-data: Y2E=", user: "exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: sh\n      args: [-c, env]", wantErr: "exec credentials"},
+		{name: "auth provider", cluster: "certificate-authority-data: Y2E=", user: "auth-provider:\n      name: oidc", wantErr: "auth-provider credentials"},
+		{name: "token file", cluster: "certificate-authority-data: Y2E=", user: "tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token", wantErr: "tokenFile is a file path"},
+		{name: "client certificate file", cluster: "certificate-authority-data: Y2E=", user: "client-certificate: /etc/passwd", wantErr: "client-certificate is a file path"},
+		{name: "client key file", cluster: "certificate-authority-data: Y2E=", user: "client-key: /etc/shadow", wantErr: "client-key is a file path"},
+		{name: "certificate authority file", cluster: "certificate-authority: /etc/passwd", user: "token: secret", wantErr: "certificate-authority is a file path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeconfig := "apiVersion: v1\nkind: Config\nclusters:\n- name: test\n  cluster:\n    server: https://127.0.0.1:6443\n    " + tt.cluster +
+				"\nusers:\n- name: test\n  user:\n    " + tt.user + "\n"
+
+			config, err := ParseKubeconfig(kubeconfig)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, string(config), "https://127.0.0.1:6443")
+		})
+	}
+
+	_, err := ParseKubeconfig("apiVersion: v1\nkind: Config\n")
+	assert.EqualError(t, err, "kubeconfig has no clusters")
+
+	_, err = Validate(context.Background(), "apiVersion: v1\nkind: Config\nclusters:\n- name: a\n  cluster:\n    server: https://a\nusers:\n- name: a\n  user:\n    tokenFile: /etc/passwd\n", "kind: ConfigMap\n")
+	assert.ErrorContains(t, err, "tokenFile is a file path")
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{`Error from server (NotFound): error when creating "STDIN": namespaces "shop" not found`, types.ClusterDryRunNamespaceNotFound},
+		{`Error from server (Forbidden): error when creating "STDIN": admission webhook "policy" denied the request`, types.ClusterDryRunRejected},
+		{`error: error validating "STDIN": error validating data: ValidationError(Deployment.spec): unknown field "replica"`, types.ClusterDryRunRejected},
+		{`error: resource mapping not found for name: "a" namespace: "" from "STDIN": no matches for kind "Widget"`, types.ClusterDryRunRejected},
+		{`error: You must be logged in to the server (Unauthorized)`, types.ClusterDryRunError},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, classify(tt.output), tt.output)
+	}
+}
@@ -0,0 +1,68 @@
+package debugcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// batchResult is the JSON object printed for each command of a batch with --json
+type batchResult struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	OK      bool     `json:"ok"`
+	Error   string   `json:"error,omitempty"`
+	Result  result   `json:"result,omitempty"`
+}
+
+// splitBatch splits the commands of --exec on semicolons, and each command into its fields. Empty
+// commands are dropped so that a trailing semicolon is fine.
+func splitBatch(exec string) [][]string {
+	commands := [][]string{}
+	for _, command := range strings.Split(exec, ";") {
+		if fields := strings.Fields(command); len(fields) > 0 {
+			commands = append(commands, fields)
+		}
+	}
+	return commands
+}
+
+// runBatch runs commands one after the other, without readline and without asking anything, so
+// commands that would ask for confirmation need their flag for it. Every command runs even after
+// one fails, and the batch fails if any of them did.
+func (c *DebugConsole) runBatch(commands [][]string) error {
+	failed := 0
+	for _, command := range commands {
+		res, err := c.executeCommand(command[0], command[1:])
+		if err != nil {
+			failed++
+		}
+
+		if !c.options.JSON {
+			c.show(res, err)
+			continue
+		}
+
+		line := batchResult{
+			Command: command[0],
+			Args:    command[1:],
+			OK:      err == nil,
+			Result:  res,
+		}
+		if err != nil {
+			line.Error = err.Error()
+		}
+		b, err := json.Marshal(line)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal result of %s", command[0])
+		}
+		fmt.Fprintln(c.out, string(b))
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d commands failed", failed, len(commands))
+	}
+	return nil
+}
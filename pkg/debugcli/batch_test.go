@@ -0,0 +1,83 @@
+package debugcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBatch(t *testing.T) {
+	tests := []struct {
+		name string
+		exec string
+		want [][]string
+	}{
+		{name: "one command", exec: "list-files", want: [][]string{{"list-files"}}},
+		{name: "commands with args", exec: "list-files; render ./values.yaml;lint", want: [][]string{{"list-files"}, {"render", "./values.yaml"}, {"lint"}}},
+		{name: "empty commands are dropped", exec: " ; lint;; ", want: [][]string{{"lint"}}},
+		{name: "nothing", exec: "", want: [][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitBatch(tt.exec))
+		})
+	}
+}
+
+func TestRunBatchJSON(t *testing.T) {
+	var out, progress bytes.Buffer
+	c := &DebugConsole{
+		ctx:             context.Background(),
+		activeWorkspace: &workspacetypes.Workspace{ID: "ws", Name: "ws"},
+		options:         ConsoleOptions{NonInteractive: true, JSON: true},
+		out:             &out,
+		progress:        &progress,
+	}
+
+	err := c.runBatch(splitBatch("help; bogus --flag; patches preview"))
+	assert.EqualError(t, err, "2 of 3 commands failed")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3, "one line per command")
+
+	var results []map[string]any
+	for _, line := range lines {
+		var r map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &r), line)
+		results = append(results, r)
+	}
+
+	assert.Equal(t, "help", results[0]["command"])
+	assert.Equal(t, true, results[0]["ok"])
+	assert.Contains(t, results[0]["result"], "sections")
+
+	assert.Equal(t, "bogus", results[1]["command"])
+	assert.Equal(t, []any{"--flag"}, results[1]["args"])
+	assert.Equal(t, false, results[1]["ok"])
+	assert.Equal(t, "unknown command: bogus", results[1]["error"])
+	assert.NotContains(t, results[1], "result")
+
+	assert.Equal(t, false, results[2]["ok"])
+	assert.Contains(t, results[2]["error"], "usage: patches")
+}
+
+func TestRunBatchText(t *testing.T) {
+	var out bytes.Buffer
+	c := &DebugConsole{
+		ctx:             context.Background(),
+		activeWorkspace: &workspacetypes.Workspace{ID: "ws", Name: "ws"},
+		options:         ConsoleOptions{NonInteractive: true},
+		out:             &out,
+		progress:        &out,
+	}
+
+	require.NoError(t, c.runBatch(splitBatch("help")))
+	assert.Contains(t, out.String(), "Workspace Commands:")
+	assert.Contains(t, out.String(), "--exec")
+}
@@ -16,9 +16,13 @@ import (
 	"github.com/fatih/color"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pkg/errors"
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/listener"
 	"github.com/replicatedhq/chartsmith/pkg/llm"
 	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
 	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
 )
@@ -39,6 +43,8 @@ type ConsoleOptions struct {
 	WorkspaceID    string   // Workspace ID to use for commands
 	NonInteractive bool     // If true, run in non-interactive mode (execute command and exit)
 	Command        []string // Command to execute in non-interactive mode
+	Exec           string   // Semicolon separated commands to run in batch mode
+	JSON           bool     // If true, batch mode prints each command's result as a JSON object
 }
 
 // DebugConsole represents the debug console state
@@ -48,6 +54,11 @@ type DebugConsole struct {
 	activeWorkspace *workspacetypes.Workspace
 	readline        *readline.Instance
 	options         ConsoleOptions
+
+	// out is where results are rendered, progress is where commands report what they're doing.
+	// With --json, progress goes to stderr so that stdout only has the results.
+	out      io.Writer
+	progress io.Writer
 }
 
 // RunConsole initializes and runs the debug console with the given options
@@ -77,6 +88,11 @@ func RunConsole(options ConsoleOptions) error {
 		ctx:      ctx,
 		pgClient: pgClient,
 		options:  options,
+		out:      os.Stdout,
+		progress: os.Stdout,
+	}
+	if options.JSON {
+		console.progress = os.Stderr
 	}
 
 	// If workspace ID is provided, select it first
@@ -86,6 +102,17 @@ func RunConsole(options ConsoleOptions) error {
 		}
 	}
 
+	if options.Exec != "" {
+		if console.activeWorkspace == nil {
+			return errors.New("workspace ID is required for batch mode")
+		}
+		commands := splitBatch(options.Exec)
+		if len(commands) == 0 {
+			return errors.New("no commands specified in --exec")
+		}
+		return console.runBatch(commands)
+	}
+
 	if options.NonInteractive {
 		// Execute a single command and exit
 		if len(options.Command) == 0 {
@@ -152,6 +179,13 @@ func (c *DebugConsole) run() error {
 				readline.PcItem("randomize-yaml"),
 				readline.PcItem("create-plan"),
 				readline.PcItem("execute-plan"),
+				readline.PcItem("values-analysis"),
+				readline.PcItem("queue",
+					readline.PcItem("status"),
+					readline.PcItem("show"),
+					readline.PcItem("retry"),
+					readline.PcItem("purge"),
+				),
 				readline.PcItem("exit"),
 				readline.PcItem("quit"),
 			)...,
@@ -227,9 +261,7 @@ func (c *DebugConsole) run() error {
 						}
 					} else if len(args) == 0 {
 						// No arguments - list available workspaces
-						if err := c.listAvailableWorkspaces(); err != nil {
-							fmt.Println(boldRed("Error:"), err)
-						}
+						c.show(c.listAvailableWorkspaces())
 					} else {
 						fmt.Println(boldRed("Error: Invalid workspace command format. Use '/workspace' or '/workspace <id>'"))
 					}
@@ -238,13 +270,11 @@ func (c *DebugConsole) run() error {
 					if c.activeWorkspace == nil {
 						fmt.Println(boldRed("Error: No workspace selected. Use '/workspace <id>' to select a workspace"))
 					} else {
-						if err := c.createNewRevision(); err != nil {
-							fmt.Println(boldRed("Error:"), err)
-						}
+						c.show(c.createNewRevision())
 					}
 					continue
 				case "help":
-					c.showHelp()
+					c.show(c.showHelp(), nil)
 					continue
 				default:
 					fmt.Printf(boldRed("Error: Unknown command '/%s'\n"), cmd)
@@ -262,12 +292,26 @@ func (c *DebugConsole) run() error {
 		cmd := parts[0]
 		args := parts[1:]
 
-		if err := c.executeCommand(cmd, args); err != nil {
-			fmt.Println(boldRed("Error:"), err)
-		}
+		c.show(c.executeCommand(cmd, args))
 	}
 }
 
+// show renders the result of a command and the error it failed with, a command can fail after
+// producing a result
+func (c *DebugConsole) show(res result, err error) {
+	if res != nil {
+		res.render(c.out)
+	}
+	if err != nil {
+		fmt.Fprintln(c.out, boldRed("Error:"), err)
+	}
+}
+
+// progressf reports what a command is doing while it runs, it isn't part of the command's result
+func (c *DebugConsole) progressf(format string, args ...any) {
+	fmt.Fprintf(c.progress, format, args...)
+}
+
 // executeNonInteractiveCommand handles execution of a command in non-interactive mode
 func (c *DebugConsole) executeNonInteractiveCommand(args []string) error {
 	if len(args) == 0 {
@@ -296,21 +340,25 @@ func (c *DebugConsole) executeNonInteractiveCommand(args []string) error {
 		}
 	}
 
-	return c.executeCommand(cmd, filteredArgs)
+	res, err := c.executeCommand(cmd, filteredArgs)
+	if res != nil {
+		res.render(c.out)
+	}
+	return err
 }
 
-func (c *DebugConsole) executeCommand(cmd string, args []string) error {
+func (c *DebugConsole) executeCommand(cmd string, args []string) (result, error) {
 	// Most commands require an active workspace
-	if c.activeWorkspace == nil && cmd != "help" && cmd != "workspace" {
+	if c.activeWorkspace == nil && cmd != "help" && cmd != "workspace" && cmd != "queue" {
 		if c.options.NonInteractive {
-			return errors.New("workspace ID is required. Use --workspace-id flag")
+			return nil, errors.New("workspace ID is required. Use --workspace-id flag")
 		}
-		return errors.New("no workspace selected. Use '/workspace <id>' to select a workspace")
+		return nil, errors.New("no workspace selected. Use '/workspace <id>' to select a workspace")
 	}
 
 	switch cmd {
 	case "help":
-		c.showHelp()
+		return c.showHelp(), nil
 	case "workspace":
 		return c.listAvailableWorkspaces()
 	case "new-revision":
@@ -321,10 +369,10 @@ func (c *DebugConsole) executeCommand(cmd string, args []string) error {
 		// Check if current revision is complete before allowing patches
 		isComplete, err := c.isCurrentRevisionComplete()
 		if err != nil {
-			return errors.Wrap(err, "failed to check if current revision is complete")
+			return nil, errors.Wrap(err, "failed to check if current revision is complete")
 		}
 		if isComplete {
-			return errors.New("cannot generate patches for completed revision. Use 'new-revision' command first")
+			return nil, errors.New("cannot generate patches for completed revision. Use 'new-revision' command first")
 		}
 		return c.generatePatch(args)
 	case "apply-patch":
@@ -337,10 +385,25 @@ func (c *DebugConsole) executeCommand(cmd string, args []string) error {
 		return c.createPlan(args)
 	case "execute-plan":
 		return c.executePlan(args)
+	case "values-analysis":
+		return c.valuesAnalysis(args)
+	case "lint":
+		return c.lint(args)
+	case "fork":
+		return c.forkWorkspace(args)
+	case "readme":
+		return c.readme(args)
+	case "patches":
+		return c.patches(args)
+	case "history":
+		return c.fileHistory(args)
+	case "line-endings":
+		return c.lineEndings(args)
+	case "queue":
+		return c.queue(args)
 	default:
-		return fmt.Errorf("unknown command: %s", cmd)
+		return nil, fmt.Errorf("unknown command: %s", cmd)
 	}
-	return nil
 }
 
 // selectWorkspaceById selects a workspace by its ID
@@ -373,7 +436,7 @@ func (c *DebugConsole) selectWorkspaceById(id string) error {
 	chartRows, err := c.pgClient.Query(c.ctx, chartsQuery, id)
 	if err != nil {
 		if !c.options.NonInteractive {
-			fmt.Println(dimText("Warning: Failed to fetch charts for workspace"))
+			fmt.Fprintln(c.progress, dimText("Warning: Failed to fetch charts for workspace"))
 		}
 	} else {
 		defer chartRows.Close()
@@ -382,7 +445,7 @@ func (c *DebugConsole) selectWorkspaceById(id string) error {
 			var chart workspacetypes.Chart
 			if err := chartRows.Scan(&chart.ID, &chart.Name); err != nil {
 				if !c.options.NonInteractive {
-					fmt.Println(dimText(fmt.Sprintf("Warning: Failed to scan chart: %v", err)))
+					fmt.Fprintln(c.progress, dimText(fmt.Sprintf("Warning: Failed to scan chart: %v", err)))
 				}
 				continue
 			}
@@ -391,9 +454,9 @@ func (c *DebugConsole) selectWorkspaceById(id string) error {
 
 		if !c.options.NonInteractive {
 			if len(workspace.Charts) > 0 {
-				fmt.Printf(dimText("Found %d chart(s)\n"), len(workspace.Charts))
+				fmt.Fprintf(c.progress, dimText("Found %d chart(s)\n"), len(workspace.Charts))
 			} else {
-				fmt.Println(dimText("No charts found for this workspace"))
+				fmt.Fprintln(c.progress, dimText("No charts found for this workspace"))
 			}
 		}
 	}
@@ -401,7 +464,7 @@ func (c *DebugConsole) selectWorkspaceById(id string) error {
 	c.activeWorkspace = &workspace
 
 	if !c.options.NonInteractive {
-		fmt.Printf(boldGreen("Selected workspace: %s (ID: %s)\n"), workspace.Name, workspace.ID)
+		fmt.Fprintf(c.progress, boldGreen("Selected workspace: %s (ID: %s)\n"), workspace.Name, workspace.ID)
 	}
 
 	// Update completions after selecting a workspace
@@ -414,65 +477,64 @@ func (c *DebugConsole) selectWorkspaceById(id string) error {
 }
 
 // listAvailableWorkspaces shows available workspaces without selecting one
-func (c *DebugConsole) listAvailableWorkspaces() error {
+func (c *DebugConsole) listAvailableWorkspaces() (result, error) {
 	workspaces, err := c.listWorkspaces()
 	if err != nil {
-		return errors.Wrap(err, "failed to list workspaces")
-	}
-
-	if len(workspaces) == 0 {
-		fmt.Println(dimText("No workspaces found"))
-		return nil
+		return nil, errors.Wrap(err, "failed to list workspaces")
 	}
 
-	fmt.Println(boldBlue("Available Workspaces:"))
-	for i, ws := range workspaces {
-		fmt.Printf("  %d. %s (ID: %s)\n", i+1, ws.Name, ws.ID)
+	res := &workspacesResult{Workspaces: []workspaceSummary{}}
+	for _, ws := range workspaces {
+		res.Workspaces = append(res.Workspaces, workspaceSummary{ID: ws.ID, Name: ws.Name, CurrentRevision: ws.CurrentRevision})
 	}
-	fmt.Println()
-
-	fmt.Println(dimText("Use '/workspace <id>' to select a workspace"))
-	return nil
+	return res, nil
 }
 
-func (c *DebugConsole) showHelp() {
-	// Skip standard help in non-interactive mode, just show command-specific help
-	if c.options.NonInteractive {
-		// For now, just return as we'll implement command-specific help later
-		return
-	}
-
-	fmt.Println(boldBlue("Slash Commands:"))
-	fmt.Println("  " + boldGreen("/help") + "                 Show this help")
-	fmt.Println("  " + boldGreen("/workspace") + "            List available workspaces")
-	fmt.Println("  " + boldGreen("/workspace") + " <id>       Select a workspace by ID")
-	fmt.Println("  " + boldGreen("/new-revision") + "         Create a new revision for the current workspace")
-	fmt.Println()
-
-	fmt.Println(boldBlue("Workspace Commands:"))
-	fmt.Println("  " + boldGreen("workspace") + "             List available workspaces")
-	fmt.Println("  " + boldGreen("new-revision") + "          Create a new revision for the current workspace")
-	fmt.Println("  " + boldGreen("list-files") + "            List files in the current workspace")
-	fmt.Println("  " + boldGreen("render") + " <values-path>  Render workspace with values.yaml from file path")
-	fmt.Println("  " + boldGreen("patch-file") + " <file-path> [--count=N] [--output=<dir>]  Generate N patches for file (requires incomplete revision)")
-	fmt.Println("  " + boldGreen("apply-patch") + " <patch-id> Apply a previously generated patch")
-	fmt.Println("  " + boldGreen("randomize-yaml") + " <file-path> [--complexity=low|medium|high] Generate random YAML for testing")
-	fmt.Println("  " + boldGreen("create-plan") + " <prompt>  Create a plan from the LLM with the given prompt")
-	fmt.Println("  " + boldGreen("execute-plan") + " <plan-id> [--file-path=<path>]  Execute the specified plan, optionally on a specific file")
-	fmt.Println()
-
-	fmt.Println(boldBlue("General Commands:"))
-	fmt.Println("  " + boldGreen("help") + "                  Show this help")
-	fmt.Println("  " + boldGreen("exit") + "                  Exit the console")
-	fmt.Println("  " + boldGreen("quit") + "                  Exit the console")
-	fmt.Println()
-
-	fmt.Println(boldBlue("Command-line Usage:"))
-	fmt.Println("  These commands can also be run directly from the command line:")
-	fmt.Println("  " + boldGreen("debug-console new-revision --workspace-id <id>"))
-	fmt.Println("  " + boldGreen("debug-console patch-file values.yaml --workspace-id <id> [--count=N] [--output=<dir>]"))
-	fmt.Println("  " + boldGreen("debug-console render values.yaml --workspace-id <id>"))
-	fmt.Println()
+func (c *DebugConsole) showHelp() *helpResult {
+	return &helpResult{Sections: []helpSection{
+		{Title: "Slash Commands", Commands: []helpCommand{
+			{Name: "/help", Description: "Show this help"},
+			{Name: "/workspace", Description: "List available workspaces"},
+			{Name: "/workspace", Args: "<id>", Description: "Select a workspace by ID"},
+			{Name: "/new-revision", Description: "Create a new revision for the current workspace"},
+		}},
+		{Title: "Workspace Commands", Commands: []helpCommand{
+			{Name: "workspace", Description: "List available workspaces"},
+			{Name: "new-revision", Description: "Create a new revision for the current workspace"},
+			{Name: "list-files", Description: "List files in the current workspace"},
+			{Name: "render", Args: "<values-path>", Description: "Render workspace with values.yaml from file path"},
+			{Name: "patch-file", Args: "<file-path> [--count=N] [--output=<dir>]", Description: "Generate N patches for file (requires incomplete revision)"},
+			{Name: "apply-patch", Args: "<patch-id>", Description: "Apply a previously generated patch"},
+			{Name: "randomize-yaml", Args: "<file-path> [--complexity=low|medium|high] [--save]", Description: "Generate random YAML for testing, --save writes it to the file without asking"},
+			{Name: "create-plan", Args: "<prompt>", Description: "Create a plan from the LLM with the given prompt"},
+			{Name: "execute-plan", Args: "<plan-id> --file-path=<path> [--chart=<name>]", Description: "Execute the specified plan on a file, optionally of a specific chart"},
+			{Name: "values-analysis", Args: "[--chart=<name>]", Description: "Report unused and undefined values keys"},
+			{Name: "lint", Args: "[--chart=<name>]", Description: "Run the lint rules over the current revision, fails when a finding is an error"},
+			{Name: "fork", Args: "<name> [--with-chat]", Description: "Copy the latest complete revision into a new workspace and select it"},
+			{Name: "readme", Args: "[--chart=<name>] [--auto=on|off]", Description: "Generate README.md as pending content, or turn regenerating it after values changes on or off"},
+			{Name: "patches", Description: "List files with pending changes in the current revision, stale ones are flagged"},
+			{Name: "patches preview", Args: "<file-id>", Description: "Show the diff a pending change would apply"},
+			{Name: "patches accept|reject", Args: "<file-id>", Description: "Accept or discard a pending change"},
+			{Name: "history", Args: "<file-path>", Description: "Show the revisions and plans that created, changed or deleted a file"},
+			{Name: "line-endings", Args: "preserve|normalize", Description: "Keep CRLF line endings in files written to the workspace, or convert them to LF"},
+		}},
+		{Title: "Queue Commands", Commands: []helpCommand{
+			{Name: "queue status", Description: "Show total, in flight, available and dead messages per channel"},
+			{Name: "queue show", Args: "<id>", Description: "Show a message's payload, attempts and last error"},
+			{Name: "queue retry", Args: "<id> --yes", Description: "Make a message available again and notify its channel"},
+			{Name: "queue purge", Args: "<channel> --completed-older-than=24h --yes", Description: "Delete completed messages"},
+		}},
+		{Title: "General Commands", Commands: []helpCommand{
+			{Name: "help", Description: "Show this help"},
+			{Name: "exit", Description: "Exit the console"},
+			{Name: "quit", Description: "Exit the console"},
+		}},
+		{Title: "Command-line Usage", Commands: []helpCommand{
+			{Name: "debug-console new-revision", Args: "--workspace-id <id>", Description: "Run a single command"},
+			{Name: "debug-console patch-file", Args: "values.yaml --workspace-id <id> [--count=N] [--output=<dir>]", Description: "Run a single command with its flags"},
+			{Name: "debug-console", Args: "--workspace-id <id> --exec \"list-files; lint\" [--json]", Description: "Run semicolon separated commands without prompting, --json prints each result as a JSON line"},
+		}},
+	}}
 }
 
 func (c *DebugConsole) selectWorkspace() error {
@@ -574,6 +636,7 @@ func (c *DebugConsole) listWorkspaces() ([]workspacetypes.Workspace, error) {
 	query := `
         SELECT id, name, current_revision_number, created_at, last_updated_at
         FROM workspace
+        WHERE archived_at IS NULL
         ORDER BY last_updated_at DESC
         LIMIT 30
     `
@@ -597,9 +660,9 @@ func (c *DebugConsole) listWorkspaces() ([]workspacetypes.Workspace, error) {
 	return workspaces, nil
 }
 
-func (c *DebugConsole) listFiles() error {
+func (c *DebugConsole) listFiles() (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	query := `
@@ -611,60 +674,51 @@ func (c *DebugConsole) listFiles() error {
 
 	rows, err := c.pgClient.Query(c.ctx, query, c.activeWorkspace.ID)
 	if err != nil {
-		return errors.Wrap(err, "failed to query files")
+		return nil, errors.Wrap(err, "failed to query files")
 	}
 	defer rows.Close()
 
-	fmt.Println(boldBlue("Files in workspace:"))
-	count := 0
+	res := &filesResult{Files: []fileSummary{}}
 	for rows.Next() {
 		var id, filePath string
 		var contentSize int
 		err := rows.Scan(&id, &filePath, &contentSize)
 		if err != nil {
-			return errors.Wrap(err, "failed to scan file")
+			return nil, errors.Wrap(err, "failed to scan file")
 		}
-		fmt.Printf("  %s (%d bytes)\n", filePath, contentSize)
-		count++
-	}
-
-	if count == 0 {
-		fmt.Println(dimText("  No files found"))
-	} else {
-		fmt.Printf(dimText("\nTotal: %d files\n"), count)
+		res.Files = append(res.Files, fileSummary{Path: filePath, Size: contentSize})
 	}
 
-	return nil
+	return res, nil
 }
 
-func (c *DebugConsole) renderWorkspace(args []string) error {
+func (c *DebugConsole) renderWorkspace(args []string) (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	if len(args) < 1 {
-		return errors.New("usage: render <values-path>")
+		return nil, errors.New("usage: render <values-path>")
 	}
 
 	valuesPath := args[0]
 	valuesBytes, err := os.ReadFile(valuesPath)
 	if err != nil {
-		return errors.Wrapf(err, "failed to read values file: %s", valuesPath)
+		return nil, errors.Wrapf(err, "failed to read values file: %s", valuesPath)
 	}
 
 	valuesContent := string(valuesBytes)
 
-	fmt.Printf(boldBlue("Rendering workspace with values from %s\n"), valuesPath)
+	c.progressf(boldBlue("Rendering workspace with values from %s\n"), valuesPath)
 	startTime := time.Now()
 
 	// TODO: Implementation of render logic
 	// For now, just simulate the operation
-	fmt.Println(dimText("Starting render operation..."))
-	fmt.Println(dimText("Values content length: " + fmt.Sprintf("%d bytes", len(valuesContent))))
+	c.progressf("%s\n", dimText("Starting render operation..."))
+	c.progressf("%s\n", dimText("Values content length: "+fmt.Sprintf("%d bytes", len(valuesContent))))
 	time.Sleep(2 * time.Second) // Simulate rendering
 
 	elapsedTime := time.Since(startTime)
-	fmt.Printf(boldGreen("Render completed in %s\n"), elapsedTime)
 
 	// Here we'll need to insert the actual implementation
 	// This would involve:
@@ -672,16 +726,16 @@ func (c *DebugConsole) renderWorkspace(args []string) error {
 	// 2. Render each chart in the workspace
 	// 3. Insert the rendered files
 
-	return nil
+	return &messageResult{Message: fmt.Sprintf("Render completed in %s", elapsedTime)}, nil
 }
 
-func (c *DebugConsole) generatePatch(args []string) error {
+func (c *DebugConsole) generatePatch(args []string) (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	if len(args) < 1 {
-		return errors.New("usage: patch-file <file-path> [--count=N] [--output=<output-dir>]")
+		return nil, errors.New("usage: patch-file <file-path> [--count=N] [--output=<output-dir>]")
 	}
 
 	filePath := args[0]
@@ -697,7 +751,7 @@ func (c *DebugConsole) generatePatch(args []string) error {
 			var err error
 			count, err = strconv.Atoi(countStr)
 			if err != nil || count < 1 {
-				return errors.New("invalid count value, must be a positive integer")
+				return nil, errors.New("invalid count value, must be a positive integer")
 			}
 		} else if strings.HasPrefix(args[i], "--output=") {
 			outputDir = strings.TrimPrefix(args[i], "--output=")
@@ -712,10 +766,12 @@ func (c *DebugConsole) generatePatch(args []string) error {
 	var content string
 	err := c.pgClient.QueryRow(c.ctx, query, c.activeWorkspace.ID, filePath).Scan(&content)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get file content for: %s", filePath)
+		return nil, errors.Wrapf(err, "failed to get file content for: %s", filePath)
 	}
 
-	fmt.Printf(boldBlue("Generating %d patch(es) for file: %s\n"), count, filePath)
+	c.progressf(boldBlue("Generating %d patch(es) for file: %s\n"), count, filePath)
+
+	res := &generatedPatchesResult{FilePath: filePath, Patches: []generatedPatch{}}
 
 	// Create patch generator
 	patchGen := NewPatchGenerator(content)
@@ -733,7 +789,7 @@ func (c *DebugConsole) generatePatch(args []string) error {
 			// Create temporary files for original and modified content
 			tmpDir, err := os.MkdirTemp("", "chartsmith-patch")
 			if err != nil {
-				return errors.Wrap(err, "failed to create temp directory")
+				return nil, errors.Wrap(err, "failed to create temp directory")
 			}
 			defer os.RemoveAll(tmpDir)
 
@@ -742,18 +798,18 @@ func (c *DebugConsole) generatePatch(args []string) error {
 			modifiedFile := filepath.Join(tmpDir, "modified")
 
 			if err := os.WriteFile(originalFile, []byte(content), 0644); err != nil {
-				return errors.Wrap(err, "failed to write original content")
+				return nil, errors.Wrap(err, "failed to write original content")
 			}
 
 			// Create a temp file for the patch
 			tempPatchFile := filepath.Join(tmpDir, "patch.txt")
 			if err := os.WriteFile(tempPatchFile, []byte(patchContent), 0644); err != nil {
-				return errors.Wrap(err, "failed to write temp patch file")
+				return nil, errors.Wrap(err, "failed to write temp patch file")
 			}
 
 			// Copy original content to the modified file initially
 			if err := os.WriteFile(modifiedFile, []byte(content), 0644); err != nil {
-				return errors.Wrap(err, "failed to write modified content")
+				return nil, errors.Wrap(err, "failed to write modified content")
 			}
 
 			// Apply the patch using GNU patch command
@@ -780,7 +836,7 @@ func (c *DebugConsole) generatePatch(args []string) error {
 			// Read the generated diff
 			diffBytes, err := os.ReadFile(diffOutFile)
 			if err != nil {
-				return errors.Wrap(err, "failed to read diff output")
+				return nil, errors.Wrap(err, "failed to read diff output")
 			}
 
 			// Replace the original patch with the diff output, but with proper filenames
@@ -821,60 +877,59 @@ func (c *DebugConsole) generatePatch(args []string) error {
 			}
 		}
 
-		// Show the patch
-		fmt.Printf(boldGreen("\nPatch %d of %d (ID: %s):\n"), i, count, patchID)
-		fmt.Println(patchContent)
+		patch := generatedPatch{ID: patchID, Content: patchContent}
 
 		// If output directory is specified, save the patch
 		if outputDir != "" {
 			if err := os.MkdirAll(outputDir, 0755); err != nil {
-				return errors.Wrapf(err, "failed to create output directory: %s", outputDir)
+				return nil, errors.Wrapf(err, "failed to create output directory: %s", outputDir)
 			}
 
 			patchFile := filepath.Join(outputDir, fmt.Sprintf("%s.patch", patchID))
 			if err := os.WriteFile(patchFile, []byte(patchContent), 0644); err != nil {
-				return errors.Wrapf(err, "failed to write patch file: %s", patchFile)
+				return nil, errors.Wrapf(err, "failed to write patch file: %s", patchFile)
 			}
 
-			fmt.Printf("  Saved to: %s\n", patchFile)
+			patch.SavedTo = patchFile
 		}
 
+		res.Patches = append(res.Patches, patch)
 	}
 
-	return nil
+	return res, nil
 }
 
-func (c *DebugConsole) applyPatch(args []string) error {
+func (c *DebugConsole) applyPatch(args []string) (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	if len(args) < 1 {
-		return errors.New("usage: apply-patch <patch-id>")
+		return nil, errors.New("usage: apply-patch <patch-id>")
 	}
 
 	patchID := args[0]
 
 	// TODO: Implement actual patch application
 	// For now, just simulate it
-	fmt.Printf(boldBlue("Applying patch: %s\n"), patchID)
+	c.progressf(boldBlue("Applying patch: %s\n"), patchID)
 	time.Sleep(1 * time.Second)
-	fmt.Println(boldGreen("Patch applied successfully"))
 
-	return nil
+	return &messageResult{Message: "Patch applied successfully"}, nil
 }
 
-func (c *DebugConsole) randomizeYaml(args []string) error {
+func (c *DebugConsole) randomizeYaml(args []string) (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	if len(args) < 1 {
-		return errors.New("usage: randomize-yaml <file-path> [--complexity=low|medium|high]")
+		return nil, errors.New("usage: randomize-yaml <file-path> [--complexity=low|medium|high] [--save]")
 	}
 
 	filePath := args[0]
 	complexity := ComplexityMedium
+	save := false
 
 	// Parse optional arguments
 	for i := 1; i < len(args); i++ {
@@ -888,40 +943,48 @@ func (c *DebugConsole) randomizeYaml(args []string) error {
 			case "high":
 				complexity = ComplexityHigh
 			default:
-				return errors.New("invalid complexity value, must be low, medium, or high")
+				return nil, errors.New("invalid complexity value, must be low, medium, or high")
 			}
+		} else if args[i] == "--save" {
+			save = true
 		}
 	}
 
 	// Generate random YAML content
-	yamlContent := GenerateRandomYAML(YAMLComplexity(complexity))
-
-	// Ask user if they want to save it to a file
-	fmt.Printf(boldBlue("Generated YAML for complexity %s:\n\n"), complexity)
-	fmt.Println(yamlContent)
-
-	// Create a temporary readline instance for the yes/no prompt with history support
-	rlConfig := &readline.Config{
-		Prompt:                 "\n" + boldYellow("Save to file? (y/n): "),
-		HistoryLimit:           10,
-		DisableAutoSaveHistory: false,
-		HistorySearchFold:      true,
-		VimMode:                false,
-		AutoComplete:           readline.NewPrefixCompleter(readline.PcItem("y"), readline.PcItem("n")),
-	}
-	rl, err := readline.NewEx(rlConfig)
-	if err != nil {
-		return errors.Wrap(err, "failed to create readline instance")
-	}
-	defer rl.Close()
+	res := &yamlResult{
+		Complexity: complexity,
+		YAML:       GenerateRandomYAML(complexity),
+	}
+
+	// only the interactive console asks, everywhere else the YAML is saved with --save
+	if !save && c.readline != nil {
+		res.render(c.out)
+		res.shown = true
+
+		// Create a temporary readline instance for the yes/no prompt with history support
+		rlConfig := &readline.Config{
+			Prompt:                 "\n" + boldYellow("Save to file? (y/n): "),
+			HistoryLimit:           10,
+			DisableAutoSaveHistory: false,
+			HistorySearchFold:      true,
+			VimMode:                false,
+			AutoComplete:           readline.NewPrefixCompleter(readline.PcItem("y"), readline.PcItem("n")),
+		}
+		rl, err := readline.NewEx(rlConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create readline instance")
+		}
+		defer rl.Close()
 
-	response, err := rl.Readline()
-	if err != nil {
-		return errors.Wrap(err, "failed to read input")
+		response, err := rl.Readline()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read input")
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+		save = response == "y" || response == "yes"
 	}
-	response = strings.TrimSpace(response)
 
-	if strings.ToLower(response) == "y" || strings.ToLower(response) == "yes" {
+	if save {
 		// Create a timestamped filename if none provided
 		outputPath := filePath
 		if !strings.HasSuffix(outputPath, ".yaml") && !strings.HasSuffix(outputPath, ".yml") {
@@ -929,15 +992,13 @@ func (c *DebugConsole) randomizeYaml(args []string) error {
 		}
 
 		// Write the content to the file
-		err := os.WriteFile(outputPath, []byte(yamlContent), 0644)
-		if err != nil {
-			return errors.Wrapf(err, "failed to write YAML to file: %s", outputPath)
+		if err := os.WriteFile(outputPath, []byte(res.YAML), 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to write YAML to file: %s", outputPath)
 		}
-
-		fmt.Printf(boldGreen("YAML saved to: %s\n"), outputPath)
+		res.SavedTo = outputPath
 	}
 
-	return nil
+	return res, nil
 }
 
 // updateWorkspaceCompletions updates the readline completer with workspace IDs and file paths
@@ -966,6 +1027,14 @@ func (c *DebugConsole) updateWorkspaceCompletions(rl *readline.Instance) {
 		}
 	}
 
+	// Add queue channel completions
+	var channelCompletions []readline.PrefixCompleterInterface
+	if channels, err := listener.ListQueueChannels(c.ctx, c.pgClient); err == nil {
+		for _, channel := range channels {
+			channelCompletions = append(channelCompletions, readline.PcItem(channel))
+		}
+	}
+
 	// Build the full completer with workspace and file completions
 	completer := readline.NewPrefixCompleter(
 		readline.PcItem("/workspace", wsCompletions...),
@@ -981,6 +1050,18 @@ func (c *DebugConsole) updateWorkspaceCompletions(rl *readline.Instance) {
 		readline.PcItem("randomize-yaml", filePathCompletions...),
 		readline.PcItem("create-plan"),
 		readline.PcItem("execute-plan"),
+		readline.PcItem("values-analysis"),
+		readline.PcItem("history", filePathCompletions...),
+		readline.PcItem("line-endings",
+			readline.PcItem("preserve"),
+			readline.PcItem("normalize"),
+		),
+		readline.PcItem("queue",
+			readline.PcItem("status"),
+			readline.PcItem("show"),
+			readline.PcItem("retry"),
+			readline.PcItem("purge", channelCompletions...),
+		),
 		readline.PcItem("exit"),
 		readline.PcItem("quit"),
 	)
@@ -990,115 +1071,33 @@ func (c *DebugConsole) updateWorkspaceCompletions(rl *readline.Instance) {
 }
 
 // createNewRevision creates a new workspace revision
-func (c *DebugConsole) createNewRevision() error {
+func (c *DebugConsole) createNewRevision() (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	workspaceID := c.activeWorkspace.ID
 	var currentRevisionNumber int = c.activeWorkspace.CurrentRevision
 
-	fmt.Printf(boldBlue("Creating new revision for workspace %s (current revision: %d)\n"),
+	c.progressf(boldBlue("Creating new revision for workspace %s (current revision: %d)\n"),
 		c.activeWorkspace.Name, currentRevisionNumber)
 
-	// Start transaction
-	tx, err := c.pgClient.Begin(c.ctx)
-	if err != nil {
-		return errors.Wrap(err, "failed to begin transaction")
-	}
-	defer tx.Rollback(c.ctx) // Will be ignored if tx.Commit() is called
-
-	// Get next revision number
-	var newRevisionNumber int
-	err = tx.QueryRow(c.ctx, `
-		WITH latest_revision AS (
-			SELECT * FROM workspace_revision
-			WHERE workspace_id = $1
-			ORDER BY revision_number DESC
-			LIMIT 1
-		),
-		next_revision AS (
-			SELECT COALESCE(MAX(revision_number), 0) + 1 as next_num
-			FROM workspace_revision
-			WHERE workspace_id = $1
-		)
-		INSERT INTO workspace_revision (
-			workspace_id, revision_number, created_at,
-			created_by_user_id, created_type, is_complete, is_rendered, plan_id
-		)
-		SELECT
-			$1,
-			next_num,
-			NOW(),
-			'debug-console', -- created by debug console
-			'manual',        -- manual creation
-			false,           -- not complete
-			false,           -- not rendered
-			NULL             -- no plan
-		FROM next_revision
-		LEFT JOIN latest_revision lr ON true
-		RETURNING revision_number
-	`, workspaceID).Scan(&newRevisionNumber)
-	if err != nil {
-		return errors.Wrap(err, "failed to create revision record")
-	}
-
-	previousRevisionNumber := newRevisionNumber - 1
-
-	// Copy workspace_chart records from previous revision
-	result, err := tx.Exec(c.ctx, `
-		INSERT INTO workspace_chart (id, revision_number, workspace_id, name)
-		SELECT id, $1, workspace_id, name
-		FROM workspace_chart
-		WHERE workspace_id = $2 AND revision_number = $3
-	`, newRevisionNumber, workspaceID, previousRevisionNumber)
-	if err != nil {
-		return errors.Wrap(err, "failed to copy chart records")
-	}
-	chartRowsAffected := result.RowsAffected()
-
-	// Copy workspace_file records from previous revision
-	result, err = tx.Exec(c.ctx, `
-		INSERT INTO workspace_file (
-			id, revision_number, chart_id, workspace_id, file_path,
-			content, embeddings
-		)
-		SELECT
-			id, $1, chart_id, workspace_id, file_path,
-			content, embeddings
-		FROM workspace_file
-		WHERE workspace_id = $2 AND revision_number = $3
-	`, newRevisionNumber, workspaceID, previousRevisionNumber)
-	if err != nil {
-		return errors.Wrap(err, "failed to copy file records")
-	}
-	fileRowsAffected := result.RowsAffected()
-
-	// Update workspace current revision
-	_, err = tx.Exec(c.ctx, `
-		UPDATE workspace
-		SET current_revision_number = $1
-		WHERE id = $2
-	`, newRevisionNumber, workspaceID)
-	if err != nil {
-		return errors.Wrap(err, "failed to update workspace revision number")
-	}
-
-	// Commit transaction
-	err = tx.Commit(c.ctx)
+	newRevisionNumber, err := workspace.CreateRevision(c.ctx, workspaceID, currentRevisionNumber, workspace.CreateRevisionOpts{
+		UserID:      "debug-console", // created by debug console
+		CreatedType: "manual",
+	})
 	if err != nil {
-		return errors.Wrap(err, "failed to commit transaction")
+		return nil, errors.Wrap(err, "failed to create revision")
 	}
 
 	// Update local workspace revision number
 	c.activeWorkspace.CurrentRevision = newRevisionNumber
 
-	fmt.Printf(boldGreen("Created new revision %d - copied %d charts and %d files\n"),
-		newRevisionNumber, chartRowsAffected, fileRowsAffected)
-	fmt.Println(dimText("Revision is not marked as complete, and will not be rendered."))
-	fmt.Println(dimText("Use normal UI or API to set revision complete and trigger rendering."))
-
-	return nil
+	return &revisionResult{
+		WorkspaceID:    workspaceID,
+		FromRevision:   currentRevisionNumber,
+		RevisionNumber: newRevisionNumber,
+	}, nil
 }
 
 // getWorkspaceFiles returns a list of file paths in the current workspace
@@ -1185,31 +1184,31 @@ func formatAsDiffU(patch string, filePath string) string {
 }
 
 // createPlan implements the create-plan command to generate a plan using LLM
-func (c *DebugConsole) createPlan(args []string) error {
+func (c *DebugConsole) createPlan(args []string) (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	if len(args) < 1 {
-		return errors.New("usage: create-plan <prompt>")
+		return nil, errors.New("usage: create-plan <prompt>")
 	}
 
 	// Check if current revision is complete
 	isComplete, err := c.isCurrentRevisionComplete()
 	if err != nil {
-		return errors.Wrap(err, "failed to check if current revision is complete")
+		return nil, errors.Wrap(err, "failed to check if current revision is complete")
 	}
 	if isComplete {
-		return errors.New("cannot create plan for completed revision - use 'new-revision' command first")
+		return nil, errors.New("cannot create plan for completed revision - use 'new-revision' command first")
 	}
 
 	// Join all args to form the prompt
 	prompt := strings.Join(args, " ")
-	fmt.Printf(boldBlue("Creating plan with prompt: '%s'\n"), prompt)
+	c.progressf(boldBlue("Creating plan with prompt: '%s'\n"), prompt)
 
 	chat, err := workspace.CreateChatMessage(c.ctx, c.activeWorkspace.ID, prompt)
 	if err != nil {
-		return errors.Wrap(err, "failed to create chat message")
+		return nil, errors.Wrap(err, "failed to create chat message")
 	}
 
 	chatMessages := []workspacetypes.Chat{*chat}
@@ -1231,6 +1230,7 @@ func (c *DebugConsole) createPlan(args []string) error {
 
 	opts := llm.CreatePlanOpts{
 		ChatMessages:  chatMessages,
+		Workspace:     c.activeWorkspace,
 		Chart:         &c.activeWorkspace.Charts[0],
 		RelevantFiles: files,
 		IsUpdate:      false,
@@ -1241,7 +1241,7 @@ func (c *DebugConsole) createPlan(args []string) error {
 
 	go func() {
 		if err := llm.CreatePlan(c.ctx, streamCh, doneCh, opts); err != nil {
-			fmt.Println(dimText(fmt.Sprintf("Error: %v", err)))
+			c.progressf("%s\n", dimText(fmt.Sprintf("Error: %v", err)))
 		}
 	}()
 
@@ -1252,7 +1252,7 @@ func (c *DebugConsole) createPlan(args []string) error {
 		select {
 		case err := <-doneCh:
 			if err != nil {
-				return errors.Wrap(err, "failed to create plan")
+				return nil, errors.Wrap(err, "failed to create plan")
 			}
 
 			done = true
@@ -1263,92 +1263,104 @@ func (c *DebugConsole) createPlan(args []string) error {
 
 	p, err := workspace.CreatePlan(c.ctx, chat.ID, c.activeWorkspace.ID, false)
 	if err != nil {
-		return errors.Wrap(err, "failed to create plan")
+		return nil, errors.Wrap(err, "failed to create plan")
 	}
 
 	if err := workspace.AppendPlanDescription(c.ctx, p.ID, plan); err != nil {
-		return errors.Wrap(err, "failed to append plan description")
+		return nil, errors.Wrap(err, "failed to append plan description")
 	}
 
 	if err := workspace.UpdatePlanStatus(c.ctx, p.ID, workspacetypes.PlanStatusReview); err != nil {
-		return errors.Wrap(err, "failed to update plan status")
+		return nil, errors.Wrap(err, "failed to update plan status")
 	}
 
-	fmt.Printf(boldGreen("Plan created: %s\n"), p.ID)
-	return nil
+	return &planResult{PlanID: p.ID}, nil
 }
 
 // executePlan implements the execute-plan command to execute a previously created plan
-func (c *DebugConsole) executePlan(args []string) error {
+func (c *DebugConsole) executePlan(args []string) (result, error) {
 	if c.activeWorkspace == nil {
-		return errors.New("no workspace selected")
+		return nil, errors.New("no workspace selected")
 	}
 
 	if len(args) < 1 {
-		return errors.New("usage: execute-plan <plan-id> [--file-path=<path>]")
+		return nil, errors.New("usage: execute-plan <plan-id> --file-path=<path> [--chart=<name>]")
 	}
 
 	planID := args[0]
 	var filePath string
+	var chartName string
 
 	// Parse additional arguments
 	for i := 1; i < len(args); i++ {
 		if strings.HasPrefix(args[i], "--file-path=") {
 			filePath = strings.TrimPrefix(args[i], "--file-path=")
+		} else if strings.HasPrefix(args[i], "--chart=") {
+			chartName = strings.TrimPrefix(args[i], "--chart=")
 		}
 	}
 
-	if filePath != "" {
-		fmt.Printf(boldBlue("Executing plan with ID: %s on file: %s\n"), planID, filePath)
-	} else {
-		fmt.Printf(boldBlue("Executing plan with ID: %s\n"), planID)
+	if len(c.activeWorkspace.Charts) == 0 {
+		return nil, errors.New("no charts found in workspace")
+	}
+	chart := &c.activeWorkspace.Charts[0]
+	if chartName != "" {
+		chart = nil
+		for i := range c.activeWorkspace.Charts {
+			if c.activeWorkspace.Charts[i].Name == chartName {
+				chart = &c.activeWorkspace.Charts[i]
+				break
+			}
+		}
+		if chart == nil {
+			return nil, errors.Errorf("chart %s not found in workspace", chartName)
+		}
+	}
+
+	if filePath == "" {
+		return nil, errors.New("you need to specify a file path to execute the plan on with --file-path")
 	}
+	c.progressf(boldBlue("Executing plan with ID: %s on file: %s\n"), planID, filePath)
 
 	// Check if current revision is complete
 	isComplete, err := c.isCurrentRevisionComplete()
 	if err != nil {
-		return errors.Wrap(err, "failed to check if current revision is complete")
+		return nil, errors.Wrap(err, "failed to check if current revision is complete")
 	}
 	if isComplete {
-		return errors.New("cannot execute plan for completed revision - use 'new-revision' command first")
+		return nil, errors.New("cannot execute plan for completed revision - use 'new-revision' command first")
 	}
 
-	// Check if file exists if file path is provided
-	if filePath != "" {
-		query := `
-			SELECT count(*) FROM workspace_file
-			WHERE workspace_id = $1 AND file_path = $2 AND revision_number = $3
-		`
-		var count int
-		err := c.pgClient.QueryRow(c.ctx, query, c.activeWorkspace.ID, filePath, c.activeWorkspace.CurrentRevision).Scan(&count)
-		if err != nil {
-			return errors.Wrap(err, "failed to check if file exists")
-		}
-		if count == 0 {
-			return errors.Errorf("file %s does not exist in the current workspace revision", filePath)
-		}
+	// Check if file exists
+	query := `
+		SELECT count(*) FROM workspace_file
+		WHERE workspace_id = $1 AND file_path = $2 AND revision_number = $3 AND chart_id = $4
+	`
+	var count int
+	err = c.pgClient.QueryRow(c.ctx, query, c.activeWorkspace.ID, filePath, c.activeWorkspace.CurrentRevision, chart.ID).Scan(&count)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check if file exists")
+	}
+	if count == 0 {
+		return nil, errors.Errorf("file %s does not exist in chart %s in the current workspace revision", filePath, chart.Name)
 	}
 
 	plan, err := workspace.GetPlan(c.ctx, nil, planID)
 	if err != nil {
-		return errors.Wrap(err, "failed to get plan")
-	}
-
-	if filePath == "" {
-		fmt.Println("You need to specify a file path to execute the plan on")
-		return nil
+		return nil, errors.Wrap(err, "failed to get plan")
 	}
 
 	actionPlanWithPath := llmtypes.ActionPlanWithPath{
-		Path: filePath,
+		Path:    filePath,
+		ChartID: chart.ID,
 		ActionPlan: llmtypes.ActionPlan{
 			Action: "update",
 		},
 	}
 
-	files, err := workspace.ListFiles(c.ctx, c.activeWorkspace.ID, c.activeWorkspace.CurrentRevision, c.activeWorkspace.Charts[0].ID)
+	files, err := workspace.ListFiles(c.ctx, c.activeWorkspace.ID, c.activeWorkspace.CurrentRevision, chart.ID)
 	if err != nil {
-		return errors.Wrap(err, "failed to list files")
+		return nil, errors.Wrap(err, "failed to list files")
 	}
 
 	currentContent := ""
@@ -1359,16 +1371,14 @@ func (c *DebugConsole) executePlan(args []string) error {
 		}
 	}
 
-	interimContentCh := make(chan string)
+	interimContentCh := make(chan llmtypes.InterimContent, 1)
 	doneCh := make(chan error)
 
+	var finalContent string
 	go func() {
-		_, err := llm.ExecuteAction(c.ctx, actionPlanWithPath, plan, currentContent, interimContentCh)
-		if err != nil {
-			fmt.Println(dimText(fmt.Sprintf("Error: %v", err)))
-		}
-
-		doneCh <- nil
+		content, err := llm.ExecuteAction(c.ctx, actionPlanWithPath, plan, currentContent, interimContentCh)
+		finalContent = content
+		doneCh <- err
 	}()
 
 	done := false
@@ -1376,13 +1386,379 @@ func (c *DebugConsole) executePlan(args []string) error {
 		select {
 		case err := <-doneCh:
 			if err != nil {
-				return errors.Wrap(err, "failed to execute action")
+				return nil, errors.Wrap(err, "failed to execute action")
 			}
 			done = true
-		case stream := <-interimContentCh:
-			fmt.Printf(boldGreen("Interim content: %s\n"), stream)
+		case interimContent := <-interimContentCh:
+			c.progressf(boldGreen("Interim content (version %d): %s\n"), interimContent.Version, interimContent.Content)
 		}
 	}
 
-	return nil
+	return &actionResult{PlanID: plan.ID, ChartID: chart.ID, FilePath: filePath, Content: finalContent}, nil
+}
+
+func (c *DebugConsole) valuesAnalysis(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+
+	var chartName string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--chart=") {
+			chartName = strings.TrimPrefix(arg, "--chart=")
+		}
+	}
+
+	w, err := workspace.GetWorkspace(c.ctx, c.activeWorkspace.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get workspace")
+	}
+
+	res := &valuesAnalysisResult{Charts: []chartValuesAnalysis{}}
+	for i := range w.Charts {
+		if chartName != "" && w.Charts[i].Name != chartName {
+			continue
+		}
+
+		analysis, err := workspace.AnalyzeValuesUsage(&w.Charts[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to analyze values for chart %s", w.Charts[i].Name)
+		}
+		res.Charts = append(res.Charts, chartValuesAnalysis{Chart: w.Charts[i].Name, Analysis: analysis})
+	}
+
+	if len(res.Charts) == 0 && chartName != "" {
+		return nil, errors.Errorf("chart %s not found in workspace", chartName)
+	}
+
+	return res, nil
+}
+
+// lint runs the lint rules over the charts of the current revision without storing the findings.
+// It fails when a finding is an error, so that a batch running it fails too.
+func (c *DebugConsole) lint(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+
+	var chartName string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--chart=") {
+			return nil, errors.New("usage: lint [--chart=<name>]")
+		}
+		chartName = strings.TrimPrefix(arg, "--chart=")
+	}
+
+	disabled := lintrules.DisabledRules()
+	workspaceDisabled, err := workspace.GetSetting[[]string](c.ctx, c.activeWorkspace.ID, workspace.SettingDisabledLintRules)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get disabled lint rules")
+	}
+	disabled = append(disabled, workspaceDisabled...)
+
+	res := &lintResult{Findings: []lintrules.Finding{}}
+	found := false
+	for _, chart := range c.activeWorkspace.Charts {
+		if chartName != "" && chart.Name != chartName {
+			continue
+		}
+		found = true
+
+		files, err := workspace.ListFiles(c.ctx, c.activeWorkspace.ID, c.activeWorkspace.CurrentRevision, chart.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list files of chart %s", chart.Name)
+		}
+		res.Findings = append(res.Findings, lintrules.Run(files, disabled)...)
+	}
+	if !found && chartName != "" {
+		return nil, errors.Errorf("chart %s not found in workspace", chartName)
+	}
+
+	errorCount := 0
+	for _, finding := range res.Findings {
+		if finding.Severity == lintrules.SeverityError {
+			errorCount++
+		}
+	}
+	if errorCount > 0 {
+		return res, errors.Errorf("%d lint findings are errors", errorCount)
+	}
+
+	return res, nil
+}
+
+func (c *DebugConsole) forkWorkspace(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+
+	opts := workspace.ForkWorkspaceOpts{}
+	nameParts := []string{}
+	for _, arg := range args {
+		if arg == "--with-chat" {
+			opts.IncludeChatHistory = true
+			continue
+		}
+		nameParts = append(nameParts, arg)
+	}
+	if len(nameParts) == 0 {
+		return nil, errors.New("usage: fork <name> [--with-chat]")
+	}
+
+	fork, err := workspace.ForkWorkspace(c.ctx, c.activeWorkspace.ID, strings.Join(nameParts, " "), "debug-console", opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fork workspace")
+	}
+
+	res := &forkResult{
+		ForkedFrom:     c.activeWorkspace.Name,
+		ID:             fork.ID,
+		Name:           fork.Name,
+		RevisionNumber: fork.CurrentRevision,
+	}
+	return res, c.selectWorkspaceById(fork.ID)
+}
+
+func (c *DebugConsole) readme(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+
+	var chartName string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--chart="):
+			chartName = strings.TrimPrefix(arg, "--chart=")
+		case arg == "--auto=on", arg == "--auto=off":
+			enabled := arg == "--auto=on"
+			if err := workspace.SetAutoGenerateReadme(c.ctx, c.activeWorkspace.ID, enabled); err != nil {
+				return nil, errors.Wrap(err, "failed to set auto generate readme")
+			}
+			return &messageResult{Message: fmt.Sprintf("Regenerating README.md after values changes is %s", strings.TrimPrefix(arg, "--auto="))}, nil
+		default:
+			return nil, errors.New("usage: readme [--chart=<name>] [--auto=on|off]")
+		}
+	}
+
+	w, err := workspace.GetWorkspace(c.ctx, c.activeWorkspace.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get workspace")
+	}
+
+	for _, chart := range w.Charts {
+		if chartName != "" && chart.Name != chartName {
+			continue
+		}
+
+		readme, err := llm.RefreshChartReadme(c.ctx, w.ID, chart.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate README.md for chart %s", chart.Name)
+		}
+		return &readmeResult{Chart: chart.Name, Readme: readme}, nil
+	}
+
+	return nil, fmt.Errorf("chart %s not found", chartName)
+}
+
+func (c *DebugConsole) fileHistory(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+	if len(args) != 1 {
+		return nil, errors.New("usage: history <file-path>")
+	}
+
+	history, err := workspace.GetFileHistory(c.ctx, c.activeWorkspace.ID, args[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get file history")
+	}
+	return &fileHistoryResult{FilePath: args[0], History: history}, nil
+}
+
+func (c *DebugConsole) lineEndings(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+	if len(args) != 1 || (args[0] != "preserve" && args[0] != "normalize") {
+		return nil, errors.New("usage: line-endings preserve|normalize")
+	}
+
+	if err := workspace.SetPreserveLineEndings(c.ctx, c.activeWorkspace.ID, args[0] == "preserve"); err != nil {
+		return nil, errors.Wrap(err, "failed to set line endings")
+	}
+	if args[0] == "preserve" {
+		return &messageResult{Message: "CRLF line endings are kept in files written to this workspace"}, nil
+	}
+	return &messageResult{Message: "CRLF line endings are converted to LF in files written to this workspace"}, nil
+}
+
+func (c *DebugConsole) patches(args []string) (result, error) {
+	if c.activeWorkspace == nil {
+		return nil, errors.New("no workspace selected")
+	}
+	usage := "usage: patches | patches preview <file-id> | patches accept <file-id> | patches reject <file-id>"
+
+	if len(args) == 0 || args[0] == "list" {
+		patches, err := workspace.ListPendingPatches(c.ctx, c.activeWorkspace.ID, c.activeWorkspace.CurrentRevision)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list pending patches")
+		}
+		return &pendingPatchesResult{Patches: patches}, nil
+	}
+	if len(args) != 2 {
+		return nil, errors.New(usage)
+	}
+
+	fileID := args[1]
+	switch args[0] {
+	case "preview":
+		preview, err := workspace.GetPatchPreview(c.ctx, c.activeWorkspace.ID, c.activeWorkspace.CurrentRevision, fileID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to preview patch")
+		}
+		return &patchPreviewResult{PatchPreview: preview}, nil
+	case "accept", "reject":
+		resolve := workspace.AcceptPatch
+		if args[0] == "reject" {
+			resolve = workspace.RejectPatch
+		}
+		file, err := resolve(c.ctx, c.activeWorkspace.ID, c.activeWorkspace.CurrentRevision, fileID, nil)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to %s patch", args[0])
+		}
+
+		res := &resolvedPatchResult{Action: args[0], FileID: file.ID, FilePath: file.FilePath}
+		userIDs, err := workspace.ListUserIDsForWorkspace(c.ctx, c.activeWorkspace.ID)
+		if err != nil {
+			return res, errors.Wrap(err, "failed to list workspace users")
+		}
+		e := realtimetypes.ArtifactUpdatedEvent{WorkspaceID: c.activeWorkspace.ID, WorkspaceFile: file}
+		if err := realtime.SendEvent(c.ctx, realtimetypes.Recipient{UserIDs: userIDs}, e); err != nil {
+			return res, errors.Wrap(err, "failed to send file update")
+		}
+
+		return res, nil
+	default:
+		return nil, errors.New(usage)
+	}
+}
+
+func (c *DebugConsole) queue(args []string) (result, error) {
+	usage := "usage: queue status | queue show <id> | queue retry <id> --yes | queue purge <channel> --completed-older-than=<duration> --yes"
+	if len(args) < 1 {
+		return nil, errors.New(usage)
+	}
+
+	confirmed := false
+	positional := []string{}
+	var olderThan string
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--yes":
+			confirmed = true
+		case strings.HasPrefix(arg, "--completed-older-than="):
+			olderThan = strings.TrimPrefix(arg, "--completed-older-than=")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	switch args[0] {
+	case "status":
+		return c.queueStatus()
+	case "show":
+		if len(positional) != 1 {
+			return nil, errors.New("usage: queue show <id>")
+		}
+		return c.queueShow(positional[0])
+	case "retry":
+		if len(positional) != 1 {
+			return nil, errors.New("usage: queue retry <id> --yes")
+		}
+		return c.queueRetry(positional[0], confirmed)
+	case "purge":
+		if len(positional) != 1 || olderThan == "" {
+			return nil, errors.New("usage: queue purge <channel> --completed-older-than=<duration> --yes")
+		}
+		age, err := time.ParseDuration(olderThan)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid --completed-older-than %q", olderThan)
+		}
+		return c.queuePurge(positional[0], age, confirmed)
+	default:
+		return nil, errors.New(usage)
+	}
+}
+
+func (c *DebugConsole) queueStatus() (result, error) {
+	allStats, err := listener.ListQueueStats(c.ctx, c.pgClient)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get queue status")
+	}
+
+	res := &queueStatusResult{Channels: []queueChannelStats{}, DeadAttempts: listener.QueueDeadAttempts}
+	for _, stats := range allStats {
+		res.Channels = append(res.Channels, queueChannelStats{
+			Channel:   stats.Channel,
+			Total:     stats.Total,
+			InFlight:  stats.InFlight,
+			Available: stats.Available,
+			Dead:      stats.Dead,
+		})
+	}
+	return res, nil
+}
+
+func (c *DebugConsole) queueShow(id string) (result, error) {
+	msg, err := listener.GetQueueMessage(c.ctx, c.pgClient, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get queue message")
+	}
+	if msg == nil {
+		return nil, errors.Errorf("message %s not found", id)
+	}
+
+	return newQueueMessageResult(msg), nil
+}
+
+func (c *DebugConsole) queueRetry(id string, confirmed bool) (result, error) {
+	msg, err := listener.GetQueueMessage(c.ctx, c.pgClient, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get queue message")
+	}
+	if msg == nil {
+		return nil, errors.Errorf("message %s not found", id)
+	}
+	if msg.CompletedAt != nil {
+		return nil, errors.Errorf("message %s already completed", id)
+	}
+
+	if !confirmed {
+		return nil, errors.Errorf("refusing to make message %s on channel %s available and notify the channel without --yes", id, msg.Channel)
+	}
+
+	if err := listener.RetryQueueMessage(c.ctx, c.pgClient, id); err != nil {
+		return nil, errors.Wrap(err, "failed to retry queue message")
+	}
+
+	return &messageResult{Message: fmt.Sprintf("Message %s on channel %s is available for retry", id, msg.Channel)}, nil
+}
+
+func (c *DebugConsole) queuePurge(channel string, olderThan time.Duration, confirmed bool) (result, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	if !confirmed {
+		count, err := listener.CountCompletedQueueMessages(c.ctx, c.pgClient, channel, cutoff)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to count completed queue messages")
+		}
+		return nil, errors.Errorf("refusing to delete %d messages on channel %s that completed before %s without --yes", count, channel, cutoff.Format(time.RFC3339))
+	}
+
+	deleted, err := listener.PurgeCompletedQueueMessages(c.ctx, c.pgClient, channel, cutoff)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to purge queue messages")
+	}
+
+	return &purgeResult{Channel: channel, Deleted: deleted}, nil
 }
@@ -0,0 +1,410 @@
+package debugcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/listener"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// result is what a command produced. The console renders it for a person, batch mode with --json
+// prints it as a JSON object instead, so everything render shows is in a field with a json tag.
+type result interface {
+	render(w io.Writer)
+}
+
+// messageResult is the result of a command that only reports what it did
+type messageResult struct {
+	Message string `json:"message"`
+}
+
+func (r *messageResult) render(w io.Writer) {
+	fmt.Fprintln(w, boldGreen(r.Message))
+}
+
+type helpResult struct {
+	Sections []helpSection `json:"sections"`
+}
+
+type helpSection struct {
+	Title    string        `json:"title"`
+	Commands []helpCommand `json:"commands"`
+}
+
+type helpCommand struct {
+	Name        string `json:"name"`
+	Args        string `json:"args,omitempty"`
+	Description string `json:"description"`
+}
+
+func (r *helpResult) render(w io.Writer) {
+	for _, section := range r.Sections {
+		fmt.Fprintln(w, boldBlue(section.Title+":"))
+		for _, command := range section.Commands {
+			args := ""
+			if command.Args != "" {
+				args = " " + command.Args
+			}
+			padding := max(22-len(command.Name+args), 1)
+			fmt.Fprintf(w, "  %s%s%s%s\n", boldGreen(command.Name), args, strings.Repeat(" ", padding), command.Description)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+type workspaceSummary struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	CurrentRevision int    `json:"currentRevision"`
+}
+
+type workspacesResult struct {
+	Workspaces []workspaceSummary `json:"workspaces"`
+}
+
+func (r *workspacesResult) render(w io.Writer) {
+	if len(r.Workspaces) == 0 {
+		fmt.Fprintln(w, dimText("No workspaces found"))
+		return
+	}
+
+	fmt.Fprintln(w, boldBlue("Available Workspaces:"))
+	for i, ws := range r.Workspaces {
+		fmt.Fprintf(w, "  %d. %s (ID: %s)\n", i+1, ws.Name, ws.ID)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, dimText("Use '/workspace <id>' to select a workspace"))
+}
+
+type revisionResult struct {
+	WorkspaceID    string `json:"workspaceId"`
+	FromRevision   int    `json:"fromRevision"`
+	RevisionNumber int    `json:"revisionNumber"`
+}
+
+func (r *revisionResult) render(w io.Writer) {
+	fmt.Fprintf(w, boldGreen("Created new revision %d from revision %d\n"), r.RevisionNumber, r.FromRevision)
+	fmt.Fprintln(w, dimText("Revision is not marked as complete, and will not be rendered."))
+	fmt.Fprintln(w, dimText("Use normal UI or API to set revision complete and trigger rendering."))
+}
+
+type fileSummary struct {
+	Path string `json:"path"`
+	Size int    `json:"size"`
+}
+
+type filesResult struct {
+	Files []fileSummary `json:"files"`
+}
+
+func (r *filesResult) render(w io.Writer) {
+	fmt.Fprintln(w, boldBlue("Files in workspace:"))
+	for _, file := range r.Files {
+		fmt.Fprintf(w, "  %s (%d bytes)\n", file.Path, file.Size)
+	}
+
+	if len(r.Files) == 0 {
+		fmt.Fprintln(w, dimText("  No files found"))
+	} else {
+		fmt.Fprintf(w, dimText("\nTotal: %d files\n"), len(r.Files))
+	}
+}
+
+type generatedPatch struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	SavedTo string `json:"savedTo,omitempty"`
+}
+
+type generatedPatchesResult struct {
+	FilePath string           `json:"filePath"`
+	Patches  []generatedPatch `json:"patches"`
+}
+
+func (r *generatedPatchesResult) render(w io.Writer) {
+	for i, patch := range r.Patches {
+		fmt.Fprintf(w, boldGreen("\nPatch %d of %d (ID: %s):\n"), i+1, len(r.Patches), patch.ID)
+		fmt.Fprintln(w, patch.Content)
+		if patch.SavedTo != "" {
+			fmt.Fprintf(w, "  Saved to: %s\n", patch.SavedTo)
+		}
+	}
+}
+
+type yamlResult struct {
+	Complexity YAMLComplexity `json:"complexity"`
+	YAML       string         `json:"yaml"`
+	SavedTo    string         `json:"savedTo,omitempty"`
+
+	// shown is true when the YAML was shown before asking whether to save it
+	shown bool
+}
+
+func (r *yamlResult) render(w io.Writer) {
+	if !r.shown {
+		fmt.Fprintf(w, boldBlue("Generated YAML for complexity %s:\n\n"), r.Complexity)
+		fmt.Fprintln(w, r.YAML)
+	}
+	if r.SavedTo != "" {
+		fmt.Fprintf(w, boldGreen("YAML saved to: %s\n"), r.SavedTo)
+	}
+}
+
+type planResult struct {
+	PlanID string `json:"planId"`
+}
+
+func (r *planResult) render(w io.Writer) {
+	fmt.Fprintf(w, boldGreen("Plan created: %s\n"), r.PlanID)
+}
+
+type actionResult struct {
+	PlanID   string `json:"planId"`
+	ChartID  string `json:"chartId"`
+	FilePath string `json:"filePath"`
+	Content  string `json:"content"`
+}
+
+func (r *actionResult) render(w io.Writer) {
+	fmt.Fprintf(w, boldGreen("Executed plan %s on %s\n"), r.PlanID, r.FilePath)
+}
+
+type chartValuesAnalysis struct {
+	Chart    string                         `json:"chart"`
+	Analysis *workspacetypes.ValuesAnalysis `json:"analysis"`
+}
+
+type valuesAnalysisResult struct {
+	Charts []chartValuesAnalysis `json:"charts"`
+}
+
+func (r *valuesAnalysisResult) render(w io.Writer) {
+	if len(r.Charts) == 0 {
+		fmt.Fprintln(w, dimText("  No charts found"))
+		return
+	}
+	for _, chart := range r.Charts {
+		fmt.Fprintln(w, boldBlue(fmt.Sprintf("Values analysis for chart %s:", chart.Chart)))
+		fmt.Fprintln(w, workspace.FormatValuesAnalysis(chart.Analysis))
+	}
+}
+
+type forkResult struct {
+	ForkedFrom     string `json:"forkedFrom"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	RevisionNumber int    `json:"revisionNumber"`
+}
+
+func (r *forkResult) render(w io.Writer) {
+	fmt.Fprintf(w, boldGreen("Forked workspace %s into %s (ID: %s) at revision %d\n"), r.ForkedFrom, r.Name, r.ID, r.RevisionNumber)
+}
+
+type readmeResult struct {
+	Chart  string `json:"chart"`
+	Readme string `json:"readme"`
+}
+
+func (r *readmeResult) render(w io.Writer) {
+	fmt.Fprintln(w, boldBlue(fmt.Sprintf("README.md for chart %s (pending):", r.Chart)))
+	fmt.Fprintln(w, r.Readme)
+}
+
+type pendingPatchesResult struct {
+	Patches []workspacetypes.PendingPatch `json:"patches"`
+}
+
+func (r *pendingPatchesResult) render(w io.Writer) {
+	if len(r.Patches) == 0 {
+		fmt.Fprintln(w, dimText("No pending changes"))
+		return
+	}
+	for _, patch := range r.Patches {
+		line := fmt.Sprintf("  %s  %s", dimText(patch.FileID), patch.FilePath)
+		if patch.IsNewFile {
+			line += boldGreen(" (new)")
+		}
+		if patch.Stale {
+			line += boldYellow(" (stale, the file changed after this was written)")
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+type patchPreviewResult struct {
+	*workspacetypes.PatchPreview
+}
+
+func (r *patchPreviewResult) render(w io.Writer) {
+	if r.Stale {
+		fmt.Fprintln(w, boldYellow("The file changed after this patch was written, accepting it discards that change"))
+	}
+	fmt.Fprintln(w, r.Diff)
+}
+
+type resolvedPatchResult struct {
+	// Action is accept or reject
+	Action   string `json:"action"`
+	FileID   string `json:"fileId"`
+	FilePath string `json:"filePath"`
+}
+
+func (r *resolvedPatchResult) render(w io.Writer) {
+	fmt.Fprintf(w, boldGreen("%sed the pending change to %s\n"), strings.TrimSuffix(r.Action, "e"), r.FilePath)
+}
+
+type fileHistoryResult struct {
+	FilePath string                            `json:"filePath"`
+	History  []workspacetypes.FileHistoryEntry `json:"history"`
+}
+
+func (r *fileHistoryResult) render(w io.Writer) {
+	if len(r.History) == 0 {
+		fmt.Fprintln(w, dimText(fmt.Sprintf("%s was never in this workspace", r.FilePath)))
+		return
+	}
+
+	for _, entry := range r.History {
+		line := fmt.Sprintf("  r%-4d %s  %-8s %s %s",
+			entry.RevisionNumber,
+			dimText(entry.CreatedAt.Format("2006-01-02 15:04")),
+			entry.Change,
+			boldGreen(fmt.Sprintf("+%d", entry.LinesAdded)),
+			boldRed(fmt.Sprintf("-%d", entry.LinesRemoved)))
+		if entry.PlanID != "" {
+			line += dimText(fmt.Sprintf("  plan %s", entry.PlanID))
+		}
+		if entry.Prompt != "" {
+			line += fmt.Sprintf("  %q", entry.Prompt)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+type lintResult struct {
+	Findings []lintrules.Finding `json:"findings"`
+}
+
+func (r *lintResult) render(w io.Writer) {
+	if len(r.Findings) == 0 {
+		fmt.Fprintln(w, dimText("No lint findings"))
+		return
+	}
+	for _, finding := range r.Findings {
+		severity := dimText(string(finding.Severity))
+		switch finding.Severity {
+		case lintrules.SeverityError:
+			severity = boldRed(string(finding.Severity))
+		case lintrules.SeverityWarning:
+			severity = boldYellow(string(finding.Severity))
+		}
+		fmt.Fprintf(w, "  %-7s %s:%d  %s %s\n", severity, finding.FilePath, finding.Line, finding.Message, dimText(finding.RuleID))
+		if finding.Suggestion != "" {
+			fmt.Fprintf(w, "          %s\n", dimText(finding.Suggestion))
+		}
+	}
+}
+
+type queueChannelStats struct {
+	Channel   string `json:"channel"`
+	Total     int    `json:"total"`
+	InFlight  int    `json:"inFlight"`
+	Available int    `json:"available"`
+	Dead      int    `json:"dead"`
+}
+
+type queueStatusResult struct {
+	Channels []queueChannelStats `json:"channels"`
+	// DeadAttempts is how many times a message has failed when it's dead
+	DeadAttempts int `json:"deadAttempts"`
+}
+
+func (r *queueStatusResult) render(w io.Writer) {
+	if len(r.Channels) == 0 {
+		fmt.Fprintln(w, dimText("No incomplete messages in the queue"))
+		return
+	}
+
+	fmt.Fprintln(w, boldBlue(fmt.Sprintf("%-30s %8s %10s %10s %6s", "CHANNEL", "TOTAL", "IN FLIGHT", "AVAILABLE", "DEAD")))
+	for _, stats := range r.Channels {
+		line := fmt.Sprintf("%-30s %8d %10d %10d %6d", stats.Channel, stats.Total, stats.InFlight, stats.Available, stats.Dead)
+		if stats.Dead > 0 {
+			line = boldRed(line)
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintln(w, dimText(fmt.Sprintf("\nDead messages have failed %d or more times", r.DeadAttempts)))
+}
+
+type queueMessageResult struct {
+	ID           string          `json:"id"`
+	Channel      string          `json:"channel"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	Status       string          `json:"status"`
+	Priority     *int            `json:"priority"`
+	AttemptCount int             `json:"attemptCount"`
+	LastError    string          `json:"lastError,omitempty"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+func newQueueMessageResult(msg *listener.QueueMessage) *queueMessageResult {
+	status := "available"
+	switch {
+	case msg.CompletedAt != nil:
+		status = fmt.Sprintf("completed at %s", msg.CompletedAt.Format(time.RFC3339))
+	case msg.ProcessingStartedAt != nil && msg.ClaimedUntil != nil && msg.ClaimedUntil.Before(time.Now()):
+		status = fmt.Sprintf("claim expired at %s, waiting to be claimed again", msg.ClaimedUntil.Format(time.RFC3339))
+	case msg.ProcessingStartedAt != nil:
+		status = fmt.Sprintf("in flight since %s", msg.ProcessingStartedAt.Format(time.RFC3339))
+	}
+
+	// payloads are JSON, one that isn't is kept as a string so the result can still be marshalled
+	payload := json.RawMessage(msg.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(msg.Payload))
+	}
+
+	return &queueMessageResult{
+		ID:           msg.ID,
+		Channel:      msg.Channel,
+		CreatedAt:    msg.CreatedAt,
+		Status:       status,
+		Priority:     msg.Priority,
+		AttemptCount: msg.AttemptCount,
+		LastError:    msg.LastError,
+		Payload:      payload,
+	}
+}
+
+func (r *queueMessageResult) render(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", boldBlue("ID:"), r.ID)
+	fmt.Fprintf(w, "%s %s\n", boldBlue("Channel:"), r.Channel)
+	fmt.Fprintf(w, "%s %s\n", boldBlue("Created:"), r.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "%s %s\n", boldBlue("Status:"), r.Status)
+	if r.Priority != nil {
+		fmt.Fprintf(w, "%s %d\n", boldBlue("Priority:"), *r.Priority)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", boldBlue("Priority:"), dimText("channel default"))
+	}
+	fmt.Fprintf(w, "%s %d\n", boldBlue("Attempts:"), r.AttemptCount)
+	if r.LastError != "" {
+		fmt.Fprintf(w, "%s %s\n", boldBlue("Last error:"), boldRed(r.LastError))
+	}
+	fmt.Fprintln(w, boldBlue("Payload:"))
+	fmt.Fprintln(w, string(r.Payload))
+}
+
+type purgeResult struct {
+	Channel string `json:"channel"`
+	Deleted int64  `json:"deleted"`
+}
+
+func (r *purgeResult) render(w io.Writer) {
+	fmt.Fprintf(w, boldGreen("Deleted %d completed messages from channel %s\n"), r.Deleted, r.Channel)
+}
@@ -0,0 +1,60 @@
+package diff
+
+import "strings"
+
+// Stat counts the lines added and removed to turn original into modified, the way diff --stat does
+func Stat(originalContent, modifiedContent string) (added int, removed int) {
+	original := splitLines(originalContent)
+	modified := splitLines(modifiedContent)
+
+	common := longestCommonSubsequence(original, modified)
+	return len(modified) - common, len(original) - common
+}
+
+// Similarity is the share of lines a and b have in common, in order: twice the lines in common over
+// the lines of both. It's 1 for identical content and 0 when no line is shared.
+func Similarity(a, b string) float64 {
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+	if len(aLines)+len(bLines) == 0 {
+		return 1
+	}
+	return float64(2*longestCommonSubsequence(aLines, bLines)) / float64(len(aLines)+len(bLines))
+}
+
+// MaxSimilarity is the highest Similarity of content with aLines lines and content with bLines
+// lines, it's cheap enough to rule out pairs before comparing them
+func MaxSimilarity(aLines, bLines int) float64 {
+	if aLines+bLines == 0 {
+		return 1
+	}
+	return float64(2*min(aLines, bLines)) / float64(aLines+bLines)
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// longestCommonSubsequence returns the number of lines a and b have in common, in order. It only
+// keeps two rows of the table, so memory is linear in the length of b.
+func longestCommonSubsequence(a, b []string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				current[j] = previous[j-1] + 1
+			case previous[j] >= current[j-1]:
+				current[j] = previous[j]
+			default:
+				current[j] = current[j-1]
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
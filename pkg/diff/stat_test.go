@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStat(t *testing.T) {
+	tests := []struct {
+		name        string
+		original    string
+		modified    string
+		wantAdded   int
+		wantRemoved int
+	}{
+		{name: "unchanged", original: "a\nb\n", modified: "a\nb\n"},
+		{name: "created", original: "", modified: "a\nb\n", wantAdded: 2},
+		{name: "deleted", original: "a\nb\nc", modified: "", wantRemoved: 3},
+		{name: "changed line", original: "a\nb\nc\n", modified: "a\nB\nc\n", wantAdded: 1, wantRemoved: 1},
+		{name: "inserted and removed", original: "a\nb\nc\n", modified: "x\na\nc\ny\n", wantAdded: 2, wantRemoved: 1},
+		{name: "trailing newline", original: "a\nb", modified: "a\nb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := Stat(tt.original, tt.modified)
+			assert.Equal(t, tt.wantAdded, added)
+			assert.Equal(t, tt.wantRemoved, removed)
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want float64
+	}{
+		{name: "identical", a: "a\nb\n", b: "a\nb\n", want: 1},
+		{name: "both empty", want: 1},
+		{name: "one empty", a: "a\n", want: 0},
+		{name: "one line of four changed", a: "a\nb\nc\nd\n", b: "a\nB\nc\nd\n", want: 0.75},
+		{name: "nothing shared", a: "a\nb\n", b: "c\nd\n", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, Similarity(tt.a, tt.b), 0.0001)
+			assert.GreaterOrEqual(t, MaxSimilarity(len(splitLines(tt.a)), len(splitLines(tt.b))), Similarity(tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+)
+
+const (
+	// DefaultProvider is the embedding provider used when CHARTSMITH_EMBEDDING_PROVIDER isn't set
+	DefaultProvider = "voyage-01"
+
+	// LegacyProvider made the embeddings that were stored before their provider was recorded
+	LegacyProvider = "voyage-01"
+)
+
+// EmbeddingProvider turns text into embedding vectors. Vectors of different providers can't be
+// compared, so each stored embedding records the provider that made it.
+type EmbeddingProvider interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// Dimensions is the length of every vector the provider returns
+	Dimensions() int
+	// Name identifies the provider and model, such as voyage-01
+	Name() string
+}
+
+// providers are the embedding providers that can be configured, by name
+var providers = map[string]func(params param.Params) EmbeddingProvider{
+	"voyage-01": func(params param.Params) EmbeddingProvider {
+		return newVoyageProvider("voyage-01", 1024, params.VoyageAPIKey)
+	},
+	"voyage-3": func(params param.Params) EmbeddingProvider {
+		return newVoyageProvider("voyage-3", 1024, params.VoyageAPIKey)
+	},
+	"voyage-3-lite": func(params param.Params) EmbeddingProvider {
+		return newVoyageProvider("voyage-3-lite", 512, params.VoyageAPIKey)
+	},
+	"voyage-code-3": func(params param.Params) EmbeddingProvider {
+		return newVoyageProvider("voyage-code-3", 1024, params.VoyageAPIKey)
+	},
+}
+
+// Configured returns the provider named by CHARTSMITH_EMBEDDING_PROVIDER. It's a var so that code
+// that embeds can be tested without calling a provider.
+var Configured = func() (EmbeddingProvider, error) {
+	params := param.Get()
+	return newProvider(params.EmbeddingProvider, params)
+}
+
+// newProvider returns the provider with a name, or the default provider for an empty name
+func newProvider(name string, params param.Params) (EmbeddingProvider, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultProvider
+	}
+
+	construct, ok := providers[name]
+	if !ok {
+		names := []string{}
+		for n := range providers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown embedding provider %q, must be one of %s", name, strings.Join(names, ", "))
+	}
+	return construct(params), nil
+}
+
+// FormatVector formats a vector as a PostgreSQL vector literal
+func FormatVector(vector []float32) string {
+	values := make([]string, len(vector))
+	for i, v := range vector {
+		values[i] = fmt.Sprintf("%.6f", v)
+	}
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+// voyageProvider embeds with a Voyage AI model
+type voyageProvider struct {
+	model      string
+	dimensions int
+	apiKey     string
+	url        string
+}
+
+var _ EmbeddingProvider = &voyageProvider{}
+
+func newVoyageProvider(model string, dimensions int, apiKey string) *voyageProvider {
+	return &voyageProvider{model: model, dimensions: dimensions, apiKey: apiKey, url: VOYAGE_API_URL}
+}
+
+func (p *voyageProvider) Name() string {
+	return p.model
+}
+
+func (p *voyageProvider) Dimensions() int {
+	return p.dimensions
+}
+
+func (p *voyageProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	if p.apiKey == "" {
+		return nil, fmt.Errorf("VOYAGE_API_KEY environment variable not set")
+	}
+
+	jsonData, err := json.Marshal(embeddingRequest{
+		Model: p.model,
+		Input: []string{text},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("request creation error: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("response read error: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, body)
+	}
+
+	var embeddings embeddingResponse
+	if err := json.Unmarshal(body, &embeddings); err != nil {
+		return nil, fmt.Errorf("unmarshal error: %v", err)
+	}
+
+	if len(embeddings.Data) == 0 {
+		return nil, fmt.Errorf("no embeddings generated")
+	}
+
+	vector := make([]float32, len(embeddings.Data[0].Embedding))
+	for i, v := range embeddings.Data[0].Embedding {
+		vector[i] = float32(v)
+	}
+	if len(vector) != p.dimensions {
+		return nil, fmt.Errorf("%s returned %d dimensions, expected %d", p.model, len(vector), p.dimensions)
+	}
+
+	return vector, nil
+}
@@ -0,0 +1,60 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvider(t *testing.T) {
+	provider, err := newProvider("", param.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultProvider, provider.Name())
+	assert.Equal(t, 1024, provider.Dimensions())
+
+	provider, err = newProvider(" voyage-3-lite ", param.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, "voyage-3-lite", provider.Name())
+	assert.Equal(t, 512, provider.Dimensions())
+
+	_, err = newProvider("word2vec", param.Params{})
+	assert.ErrorContains(t, err, `unknown embedding provider "word2vec", must be one of voyage-01, voyage-3, voyage-3-lite, voyage-code-3`)
+}
+
+func TestVoyageProviderEmbed(t *testing.T) {
+	var gotModel string
+	embedding := []float64{0.1, 0.2, 0.3}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var req embeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		gotModel = req.Model
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{"embedding": embedding}},
+		})
+	}))
+	defer server.Close()
+
+	provider := newVoyageProvider("voyage-test", 3, "key")
+	provider.url = server.URL
+
+	vector, err := provider.Embed(context.Background(), "kind: ConfigMap")
+	require.NoError(t, err)
+	assert.Equal(t, "voyage-test", gotModel)
+	assert.Equal(t, []float32{0.1, 0.2, 0.3}, vector)
+	assert.Equal(t, "[0.100000,0.200000,0.300000]", FormatVector(vector))
+
+	// a vector of the wrong length would be stored as if the provider made it
+	embedding = []float64{0.1, 0.2}
+	_, err = provider.Embed(context.Background(), "kind: ConfigMap")
+	assert.ErrorContains(t, err, "voyage-test returned 2 dimensions, expected 3")
+
+	_, err = newVoyageProvider("voyage-test", 3, "").Embed(context.Background(), "kind: ConfigMap")
+	assert.ErrorContains(t, err, "VOYAGE_API_KEY")
+}
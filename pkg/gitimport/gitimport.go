@@ -0,0 +1,515 @@
+// Package gitimport imports a Helm chart from a Git repository. The repository is fetched shallowly
+// into a temporary directory and read from the git object store, so nothing is checked out and
+// the files outside of the chart are never read.
+package gitimport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/replicatedhq/chartsmith/pkg/helmignore"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrInvalidSource is returned for a URL, ref or subdirectory that can't be imported
+	ErrInvalidSource = errors.New("invalid git source")
+	// ErrFetchFailed is returned when the repository can't be fetched, it's usually a wrong URL or ref or a missing token
+	ErrFetchFailed = errors.New("failed to fetch repository")
+	// ErrNoChart is returned when there's no Chart.yaml in the repository, or in the subdirectory
+	ErrNoChart = errors.New("no chart found")
+	// ErrMultipleCharts is returned when the repository has more than one chart and no subdirectory was given
+	ErrMultipleCharts = errors.New("repository has more than one chart, choose one with the subdirectory")
+	// ErrTooManyFiles is returned when the chart has more files than the limit
+	ErrTooManyFiles = errors.New("chart has too many files")
+	// ErrFileTooLarge is returned when a file of the chart is larger than the limit
+	ErrFileTooLarge = errors.New("chart file is too large")
+)
+
+// Source is where a chart is imported from
+type Source struct {
+	// URL is the https URL of the repository
+	URL string
+	// Ref is the branch, tag or commit to import, the default branch when it's empty
+	Ref string
+	// Subdirectory is the directory of the chart in the repository. It's only needed when the
+	// repository has more than one chart.
+	Subdirectory string
+	// Token authenticates to a private repository, it's sent as the password of basic auth the
+	// way GitHub, GitLab and Bitbucket accept access tokens
+	Token string
+}
+
+// Limits bound what's read from a repository
+type Limits struct {
+	// MaxFiles is the most files a chart can have
+	MaxFiles int
+	// MaxFileBytes is the size of the largest file a chart can have
+	MaxFileBytes int64
+}
+
+// DefaultLimits returns the limits used when none are given
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFiles:     1000,
+		MaxFileBytes: 1 << 20,
+	}
+}
+
+// ImportedChart is a chart read from a repository
+type ImportedChart struct {
+	// Name is the name in Chart.yaml
+	Name string
+	// Dir is the directory of the chart in the repository, "." for the root
+	Dir string
+	// CommitSHA is the commit the chart was read from
+	CommitSHA string
+	// Files are the files of the chart, relative to its directory. Subcharts in charts/, binary
+	// files and files the chart's .helmignore excludes are left out, as they are when importing
+	// an archive.
+	Files []types.File
+	// SkippedBinaries is how many binary files were left out
+	SkippedBinaries int
+	// BinaryFiles are the paths of the binary files that were left out, relative to the chart
+	BinaryFiles []string
+}
+
+// GitChartImporter imports charts with the git binary
+type GitChartImporter struct {
+	Limits Limits
+
+	// schemes are the URL schemes that can be imported, tests allow file
+	schemes []string
+}
+
+// NewGitChartImporter returns an importer for https repositories
+func NewGitChartImporter(limits Limits) *GitChartImporter {
+	return &GitChartImporter{
+		Limits:  limits,
+		schemes: []string{"https"},
+	}
+}
+
+// treeEntry is a file in the tree of the fetched commit
+type treeEntry struct {
+	oid  string
+	path string
+}
+
+// Import fetches the commit at the source's ref and reads the chart in it
+func (i *GitChartImporter) Import(ctx context.Context, source Source) (*ImportedChart, error) {
+	subdirectory, err := i.validate(source)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "chartsmith-git-import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo := &gitRepo{dir: dir, token: source.Token}
+	if _, err := repo.run(ctx, nil, "init", "--quiet"); err != nil {
+		return nil, err
+	}
+
+	ref := source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// blobs over the size limit aren't fetched, they're reported as too large without downloading them
+	fetchArgs := []string{"fetch", "--quiet", "--depth", "1", "--no-tags", fmt.Sprintf("--filter=blob:limit=%d", i.Limits.MaxFileBytes+1), source.URL, ref}
+	if _, err := repo.run(ctx, nil, fetchArgs...); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFetchFailed, err)
+	}
+
+	commitSHA, err := repo.run(ctx, nil, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := repo.listTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chartDir, err := findChartDir(entries, subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	chartEntries := filesInChart(entries, chartDir)
+	if len(chartEntries) > i.Limits.MaxFiles {
+		return nil, fmt.Errorf("%w: %s has %d files, the limit is %d", ErrTooManyFiles, chartDir, len(chartEntries), i.Limits.MaxFiles)
+	}
+
+	if err := repo.checkSizes(ctx, chartEntries, i.Limits.MaxFileBytes); err != nil {
+		return nil, err
+	}
+
+	contents, err := repo.readBlobs(ctx, chartEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []types.File{}
+	binaryFiles := []string{}
+	for _, entry := range chartEntries {
+		content := contents[entry.oid]
+		if isBinary(content) {
+			binaryFiles = append(binaryFiles, relativeToChart(entry.path, chartDir))
+			continue
+		}
+		files = append(files, types.File{
+			FilePath: relativeToChart(entry.path, chartDir),
+			Content:  string(content),
+		})
+	}
+
+	files, err = helmignore.FilterFiles(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply .helmignore: %w", err)
+	}
+
+	name, err := chartName(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImportedChart{
+		Name:            name,
+		Dir:             chartDir,
+		CommitSHA:       strings.TrimSpace(commitSHA),
+		Files:           files,
+		SkippedBinaries: len(binaryFiles),
+		BinaryFiles:     binaryFiles,
+	}, nil
+}
+
+// validate checks the source and returns the cleaned subdirectory, "" when none was given
+func (i *GitChartImporter) validate(source Source) (string, error) {
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	allowed := false
+	for _, scheme := range i.schemes {
+		if u.Scheme == scheme {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return "", fmt.Errorf("%w: only %s URLs can be imported", ErrInvalidSource, strings.Join(i.schemes, ", "))
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("%w: pass credentials as a token, not in the URL", ErrInvalidSource)
+	}
+
+	// a ref that starts with - would be read as an option
+	if strings.HasPrefix(source.Ref, "-") {
+		return "", fmt.Errorf("%w: ref %q", ErrInvalidSource, source.Ref)
+	}
+
+	if source.Subdirectory == "" {
+		return "", nil
+	}
+	subdirectory := path.Clean(strings.Trim(source.Subdirectory, "/"))
+	if subdirectory == ".." || strings.HasPrefix(subdirectory, "../") {
+		return "", fmt.Errorf("%w: subdirectory %q is outside of the repository", ErrInvalidSource, source.Subdirectory)
+	}
+	return subdirectory, nil
+}
+
+// findChartDir returns the directory of the chart. Charts inside another chart are its subcharts,
+// so only the outermost charts are candidates.
+func findChartDir(entries []treeEntry, subdirectory string) (string, error) {
+	chartDirs := []string{}
+	for _, entry := range entries {
+		if path.Base(entry.path) == "Chart.yaml" {
+			chartDirs = append(chartDirs, path.Dir(entry.path))
+		}
+	}
+
+	if subdirectory != "" {
+		for _, dir := range chartDirs {
+			if dir == subdirectory {
+				return dir, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s has no Chart.yaml", ErrNoChart, subdirectory)
+	}
+
+	// parents sort before the charts inside them
+	sort.Strings(chartDirs)
+	candidates := []string{}
+	for _, dir := range chartDirs {
+		nested := false
+		for _, candidate := range candidates {
+			if isInDir(dir, candidate) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			candidates = append(candidates, dir)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("%w: the repository has no Chart.yaml", ErrNoChart)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrMultipleCharts, strings.Join(candidates, ", "))
+	}
+}
+
+// filesInChart returns the regular files of the chart, without its subcharts
+func filesInChart(entries []treeEntry, chartDir string) []treeEntry {
+	files := []treeEntry{}
+	for _, entry := range entries {
+		if !isInDir(entry.path, chartDir) {
+			continue
+		}
+		if strings.HasPrefix(relativeToChart(entry.path, chartDir), "charts/") {
+			continue
+		}
+		files = append(files, entry)
+	}
+	return files
+}
+
+func isInDir(p string, dir string) bool {
+	return dir == "." || strings.HasPrefix(p, dir+"/")
+}
+
+func relativeToChart(p string, chartDir string) string {
+	if chartDir == "." {
+		return p
+	}
+	return strings.TrimPrefix(p, chartDir+"/")
+}
+
+// isBinary reports whether content isn't text, with the same check as archive imports
+func isBinary(content []byte) bool {
+	if !utf8.Valid(content) {
+		return true
+	}
+	for _, b := range content {
+		if b < 32 && b != '\t' && b != '\n' && b != '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+func chartName(files []types.File) (string, error) {
+	for _, file := range files {
+		if file.FilePath != "Chart.yaml" {
+			continue
+		}
+		var chartYAML struct {
+			Name string `yaml:"name"`
+		}
+		if err := yaml.Unmarshal([]byte(file.Content), &chartYAML); err != nil {
+			return "", fmt.Errorf("failed to parse Chart.yaml: %w", err)
+		}
+		if chartYAML.Name == "" {
+			return "", fmt.Errorf("%w: Chart.yaml has no name", ErrNoChart)
+		}
+		return chartYAML.Name, nil
+	}
+	return "", fmt.Errorf("%w: Chart.yaml is excluded by .helmignore", ErrNoChart)
+}
+
+// gitRepo runs git in a repository, authenticating with the token if there is one
+type gitRepo struct {
+	dir   string
+	token string
+}
+
+func (r *gitRepo) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = r.env()
+	cmd.Stdin = stdin
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, r.redact(strings.TrimSpace(stderr.String())))
+	}
+	return stdout.String(), nil
+}
+
+// env keeps git from prompting and reading the user's config, and passes the token in a header
+// so that it isn't in the command line or the remote URL
+func (r *gitRepo) env() []string {
+	env := append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		// blobs missing from a partial clone are over the size limit, they're never fetched one by one
+		"GIT_NO_LAZY_FETCH=1",
+	)
+	if r.token == "" {
+		return env
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + r.token))
+	return append(env,
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+	)
+}
+
+func (r *gitRepo) redact(s string) string {
+	if r.token == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, r.token, "[redacted]")
+}
+
+// listTree lists the files of the fetched commit. Symlinks and submodules are skipped.
+func (r *gitRepo) listTree(ctx context.Context) ([]treeEntry, error) {
+	out, err := r.run(ctx, nil, "ls-tree", "-r", "-z", "--full-tree", "FETCH_HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []treeEntry{}
+	for _, line := range strings.Split(out, "\x00") {
+		if line == "" {
+			continue
+		}
+		meta, p, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, fmt.Errorf("unexpected ls-tree output %q", line)
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected ls-tree output %q", line)
+		}
+		if fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		entries = append(entries, treeEntry{oid: fields[2], path: p})
+	}
+	return entries, nil
+}
+
+// checkSizes returns ErrFileTooLarge naming the files over the limit. Blobs over the limit weren't
+// fetched when the server supports filters, so they're missing.
+func (r *gitRepo) checkSizes(ctx context.Context, entries []treeEntry, maxBytes int64) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	out, err := r.run(ctx, nil, "rev-list", "--objects", "--missing=print", "FETCH_HEAD")
+	if err != nil {
+		return err
+	}
+	missing := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if oid, ok := strings.CutPrefix(line, "?"); ok {
+			missing[oid] = true
+		}
+	}
+
+	tooLarge := []string{}
+	present := []treeEntry{}
+	for _, entry := range entries {
+		if missing[entry.oid] {
+			tooLarge = append(tooLarge, entry.path)
+		} else {
+			present = append(present, entry)
+		}
+	}
+
+	if len(present) > 0 {
+		out, err = r.run(ctx, oidList(present), "cat-file", "--batch-check=%(objectname) %(objectsize)")
+		if err != nil {
+			return err
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if len(lines) != len(present) {
+			return fmt.Errorf("cat-file checked %d objects, expected %d", len(lines), len(present))
+		}
+		for i, line := range lines {
+			_, size, _ := strings.Cut(line, " ")
+			n, err := strconv.ParseInt(size, 10, 64)
+			if err != nil {
+				return fmt.Errorf("unexpected cat-file output %q", line)
+			}
+			if n > maxBytes {
+				tooLarge = append(tooLarge, present[i].path)
+			}
+		}
+	}
+
+	if len(tooLarge) > 0 {
+		sort.Strings(tooLarge)
+		return fmt.Errorf("%w: %s larger than the limit of %d bytes", ErrFileTooLarge, strings.Join(tooLarge, ", "), maxBytes)
+	}
+	return nil
+}
+
+// readBlobs reads the content of the files, keyed by object ID
+func (r *gitRepo) readBlobs(ctx context.Context, entries []treeEntry) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	if len(entries) == 0 {
+		return contents, nil
+	}
+	out, err := r.run(ctx, oidList(entries), "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(strings.NewReader(out))
+	for range entries {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cat-file header: %w", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected cat-file header %q", header)
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected cat-file header %q", header)
+		}
+		content := make([]byte, size+1) // the content is followed by a newline
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", fields[0], err)
+		}
+		contents[fields[0]] = content[:size]
+	}
+	return contents, nil
+}
+
+func oidList(entries []treeEntry) io.Reader {
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry.oid)
+		b.WriteString("\n")
+	}
+	return strings.NewReader(b.String())
+}
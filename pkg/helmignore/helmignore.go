@@ -0,0 +1,186 @@
+// Package helmignore implements .helmignore with the same semantics as Helm, so that the files we
+// store, render and package are the files Helm would load from the chart directory.
+package helmignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// FileName is the name of the ignore file in the chart directory
+const FileName = ".helmignore"
+
+// defaultRules are always applied by Helm, after the rules in the file
+var defaultRules = []string{"templates/.?*"}
+
+// Rules is a parsed .helmignore
+type Rules struct {
+	patterns []*pattern
+}
+
+type pattern struct {
+	raw     string
+	rule    string
+	negate  bool
+	mustDir bool
+	// anchored patterns start with / and match the path from the chart root
+	anchored bool
+}
+
+// Parse parses the content of a .helmignore. Each line is a glob pattern, blank lines and lines
+// starting with # are skipped, a leading ! negates the pattern and a trailing / only matches
+// directories. Patterns without a / match the base name of the path, other patterns match the
+// whole path. ** isn't supported, as in Helm. Helm's defaults are appended to the rules.
+func Parse(content string) (*Rules, error) {
+	r := &Rules{}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		if err := r.parseRule(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("failed to parse rule %q: %w", scanner.Text(), err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+
+	for _, rule := range defaultRules {
+		if err := r.parseRule(rule); err != nil {
+			return nil, fmt.Errorf("failed to parse default rule %q: %w", rule, err)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Rules) parseRule(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || strings.HasPrefix(rule, "#") {
+		return nil
+	}
+
+	if strings.Contains(rule, "**") {
+		return errors.New("double-star (**) syntax is not supported")
+	}
+
+	// a non-empty name is matched so that a bad pattern isn't hidden by a short circuit
+	if _, err := path.Match(rule, "abc"); err != nil {
+		return err
+	}
+
+	p := &pattern{raw: rule}
+	if strings.HasPrefix(rule, "!") {
+		p.negate = true
+		rule = rule[1:]
+	}
+	if strings.HasSuffix(rule, "/") {
+		p.mustDir = true
+		rule = strings.TrimSuffix(rule, "/")
+	}
+	if strings.HasPrefix(rule, "/") {
+		p.anchored = true
+		rule = strings.TrimPrefix(rule, "/")
+	}
+	p.rule = rule
+
+	r.patterns = append(r.patterns, p)
+	return nil
+}
+
+func (p *pattern) match(name string) bool {
+	if !p.anchored && !strings.Contains(p.rule, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(p.rule, name)
+	return ok
+}
+
+// Ignore reports whether a path relative to the chart directory is ignored. Rules are evaluated in
+// order and the first decision wins. This includes Helm's handling of negation: a path that
+// doesn't match a negated pattern is ignored, and a path that matches one moves on to the next
+// rule, so "!keep.txt" doesn't bring back a keep.txt ignored by an earlier "*.txt".
+func (r *Rules) Ignore(name string, isDir bool) bool {
+	if name == "" || name == "." || name == "./" {
+		return false
+	}
+
+	for _, p := range r.patterns {
+		if p.negate {
+			if p.mustDir && !isDir {
+				return true
+			}
+			if !p.match(name) {
+				return true
+			}
+			continue
+		}
+
+		if p.mustDir && !isDir {
+			continue
+		}
+		if p.match(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IgnoreFile reports whether a file is ignored, either itself or because Helm would skip one of
+// the directories it's in when walking the chart
+func (r *Rules) IgnoreFile(name string) bool {
+	name = strings.TrimPrefix(path.Clean(name), "/")
+
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if r.Ignore(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+
+	return r.Ignore(name, false)
+}
+
+// FilterFiles removes the files of the chart in chartDir that its .helmignore, or Helm's defaults
+// when it has none, exclude. Files outside of chartDir are kept.
+func FilterFiles(files []types.File, chartDir string) ([]types.File, error) {
+	chartDir = path.Clean(chartDir)
+	ignorePath := path.Join(chartDir, FileName)
+
+	content := ""
+	for _, file := range files {
+		if path.Clean(file.FilePath) == ignorePath {
+			content = file.Content
+			break
+		}
+	}
+
+	rules, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ignorePath, err)
+	}
+
+	filtered := make([]types.File, 0, len(files))
+	for _, file := range files {
+		rel := path.Clean(file.FilePath)
+		if chartDir != "." {
+			if !strings.HasPrefix(rel, chartDir+"/") {
+				filtered = append(filtered, file)
+				continue
+			}
+			rel = strings.TrimPrefix(rel, chartDir+"/")
+		}
+
+		if rules.IgnoreFile(rel) {
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+
+	return filtered, nil
+}
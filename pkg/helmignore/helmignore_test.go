@@ -0,0 +1,151 @@
+package helmignore
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the cases of Helm's own rules tests, cargo and mast are directories
+func TestIgnoreSingleRule(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		isDir   bool
+		expect  bool
+	}{
+		{"helm.txt", "helm.txt", false, true},
+		{"helm.*", "helm.txt", false, true},
+		{"helm.*", "rudder.txt", false, false},
+		{"*.txt", "tiller.txt", false, true},
+		{"*.txt", "cargo/a.txt", false, true},
+		{"cargo/*.txt", "cargo/a.txt", false, true},
+		{"cargo/*.*", "cargo/a.txt", false, true},
+		{"cargo/*.txt", "mast/a.txt", false, false},
+		{"ru[c-e]?er.txt", "rudder.txt", false, true},
+		{"templates/.?*", "templates/.dotfile", false, true},
+
+		{".*", ".", true, false},
+		{".*", "./", true, false},
+		{".*", ".joonix", false, true},
+		{".*", "helm.txt", false, false},
+		{".*", "", false, false},
+
+		{"cargo/", "cargo", true, true},
+		{"cargo/", "cargo/", true, true},
+		{"cargo/", "mast/", true, false},
+		{"helm.txt/", "helm.txt", false, false},
+
+		{"!helm.txt", "helm.txt", false, false},
+		{"!helm.txt", "tiller.txt", false, true},
+		{"!*.txt", "cargo", true, true},
+		{"!cargo/", "mast/", true, true},
+
+		{"/a.txt", "a.txt", false, true},
+		{"/a.txt", "cargo/a.txt", false, false},
+		{"/cargo/a.txt", "cargo/a.txt", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			rules, err := Parse(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, rules.Ignore(tt.name, tt.isDir))
+		})
+	}
+}
+
+func TestIgnoreFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		ignored []string
+		kept    []string
+	}{
+		{
+			name: "documented example",
+			content: `# comment
+.git
+*/temp*
+*/*/temp*
+temp?
+`,
+			ignored: []string{".git/HEAD", "ci/temp-values.yaml", "templates/tests/temp.yaml", "tempA", "templates/temp1"},
+			kept:    []string{"Chart.yaml", "values.yaml", "temp.yaml", "templates/deployment.yaml", "templates/a/b/temp.yaml"},
+		},
+		{
+			name:    "directories only",
+			content: "ci/\nvalues.yaml/\n",
+			ignored: []string{"ci/values-test.yaml", "templates/ci/job.yaml"},
+			kept:    []string{"values.yaml", "templates/deployment.yaml"},
+		},
+		{
+			// the first rule that decides wins, so the negation can't bring keep.txt back
+			name:    "negation after a match",
+			content: "*.txt\n!keep.txt\n",
+			ignored: []string{"keep.txt", "notes.txt", "Chart.yaml", "templates/deployment.yaml"},
+		},
+		{
+			// a lone negation ignores everything it doesn't match, including directories
+			name:    "lone negation",
+			content: "!keep.txt\n",
+			ignored: []string{"Chart.yaml", "templates/keep.txt"},
+			kept:    []string{"keep.txt"},
+		},
+		{
+			name:    "default rules",
+			content: "",
+			ignored: []string{"templates/.swp", "templates/.hidden.yaml"},
+			kept:    []string{".gitignore", "templates/deployment.yaml", "templates/_helpers.tpl"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(tt.content)
+			require.NoError(t, err)
+			for _, name := range tt.ignored {
+				assert.True(t, rules.IgnoreFile(name), name)
+			}
+			for _, name := range tt.kept {
+				assert.False(t, rules.IgnoreFile(name), name)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse("templates/**/*.yaml")
+	assert.Error(t, err)
+
+	_, err = Parse("[a-")
+	assert.Error(t, err)
+}
+
+func TestFilterFiles(t *testing.T) {
+	files := []types.File{
+		{FilePath: "mychart/Chart.yaml"},
+		{FilePath: "mychart/.helmignore", Content: "ci/\n*.orig\n"},
+		{FilePath: "mychart/ci/values-test.yaml"},
+		{FilePath: "mychart/templates/deployment.yaml"},
+		{FilePath: "mychart/templates/deployment.yaml.orig"},
+		{FilePath: "mychart/templates/.deployment.yaml.swp"},
+		{FilePath: "other/ci/values.yaml"},
+	}
+
+	filtered, err := FilterFiles(files, "mychart")
+	require.NoError(t, err)
+
+	paths := []string{}
+	for _, file := range filtered {
+		paths = append(paths, file.FilePath)
+	}
+	assert.Equal(t, []string{"mychart/Chart.yaml", "mychart/.helmignore", "mychart/templates/deployment.yaml", "other/ci/values.yaml"}, paths)
+
+	filtered, err = FilterFiles([]types.File{{FilePath: "Chart.yaml"}, {FilePath: "templates/.swp"}}, ".")
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "Chart.yaml", filtered[0].FilePath)
+}
@@ -0,0 +1,151 @@
+// Package integrations lets vendor specific behavior hook into the chart pipeline without the
+// pipeline knowing about the vendor. An integration is registered at startup and only runs when
+// it's enabled by CHARTSMITH_INTEGRATIONS.
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// DefaultEnabled are the integrations enabled when CHARTSMITH_INTEGRATIONS isn't set
+var DefaultEnabled = []string{"replicated"}
+
+// disableAll is the value of CHARTSMITH_INTEGRATIONS that enables no integrations
+const disableAll = "none"
+
+// Hooks are the points in the pipeline an integration can change. Any hook may be nil.
+type Hooks struct {
+	// PlanContext returns instructions for the planner, added to every plan prompt
+	PlanContext func(ctx context.Context, w *types.Workspace) []string
+	// ValidateRender checks the rendered output of a chart and returns a message for each problem
+	ValidateRender func(ctx context.Context, w *types.Workspace, chartFiles []types.File, rendered []types.RenderedFile) []string
+	// MutateExport changes the files of a chart as it leaves chartsmith, when it's published or
+	// created by a conversion
+	MutateExport func(ctx context.Context, w *types.Workspace, files []types.File) ([]types.File, error)
+}
+
+// Integration is vendor specific behavior
+type Integration interface {
+	// Name identifies the integration in CHARTSMITH_INTEGRATIONS
+	Name() string
+	// Enabled returns false for workspaces the integration doesn't apply to. The workspace is nil
+	// when a chart isn't in a workspace yet.
+	Enabled(w *types.Workspace) bool
+	Hooks() Hooks
+}
+
+var registered = map[string]Integration{}
+
+var enabled = map[string]bool{}
+
+// Register makes an integration available to enable, it panics if the name is already registered
+func Register(integration Integration) {
+	name := integration.Name()
+	if _, ok := registered[name]; ok {
+		panic(fmt.Sprintf("integration %q is already registered", name))
+	}
+	registered[name] = integration
+}
+
+// Registered returns the names of the registered integrations, sorted
+func Registered() []string {
+	names := make([]string, 0, len(registered))
+	for name := range registered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnabledNames returns the integrations turned on by CHARTSMITH_INTEGRATIONS, DefaultEnabled when
+// it isn't set and none when it's "none"
+func EnabledNames() []string {
+	value := strings.TrimSpace(param.Get().Integrations)
+	if value == "" {
+		return append([]string{}, DefaultEnabled...)
+	}
+	if value == disableAll {
+		return []string{}
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Enable replaces the enabled integrations, every name must be registered
+func Enable(names []string) error {
+	next := map[string]bool{}
+	for _, name := range names {
+		if _, ok := registered[name]; !ok {
+			return fmt.Errorf("unknown integration %q, registered integrations are %s", name, strings.Join(Registered(), ", "))
+		}
+		next[name] = true
+	}
+	enabled = next
+	return nil
+}
+
+// Active returns the enabled integrations that apply to a workspace, sorted by name
+func Active(w *types.Workspace) []Integration {
+	active := []Integration{}
+	for _, name := range Registered() {
+		if enabled[name] && registered[name].Enabled(w) {
+			active = append(active, registered[name])
+		}
+	}
+	return active
+}
+
+// PlanContext returns the planner instructions of every active integration
+func PlanContext(ctx context.Context, w *types.Workspace) []string {
+	instructions := []string{}
+	for _, integration := range Active(w) {
+		if hook := integration.Hooks().PlanContext; hook != nil {
+			instructions = append(instructions, hook(ctx, w)...)
+		}
+	}
+	return instructions
+}
+
+// ValidateRender returns the problems every active integration finds in a rendered chart, each
+// prefixed with the name of the integration that found it
+func ValidateRender(ctx context.Context, w *types.Workspace, chartFiles []types.File, rendered []types.RenderedFile) []string {
+	problems := []string{}
+	for _, integration := range Active(w) {
+		hook := integration.Hooks().ValidateRender
+		if hook == nil {
+			continue
+		}
+		for _, problem := range hook(ctx, w, chartFiles, rendered) {
+			problems = append(problems, fmt.Sprintf("[%s] %s", integration.Name(), problem))
+		}
+	}
+	return problems
+}
+
+// MutateExport passes the files of a chart through every active integration in turn
+func MutateExport(ctx context.Context, w *types.Workspace, files []types.File) ([]types.File, error) {
+	for _, integration := range Active(w) {
+		hook := integration.Hooks().MutateExport
+		if hook == nil {
+			continue
+		}
+		mutated, err := hook(ctx, w, files)
+		if err != nil {
+			return nil, fmt.Errorf("integration %s failed to mutate export: %w", integration.Name(), err)
+		}
+		files = mutated
+	}
+	return files, nil
+}
@@ -0,0 +1,133 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeIntegration struct {
+	name    string
+	applies func(w *types.Workspace) bool
+	hooks   Hooks
+}
+
+func (f fakeIntegration) Name() string { return f.name }
+
+func (f fakeIntegration) Enabled(w *types.Workspace) bool {
+	return f.applies == nil || f.applies(w)
+}
+
+func (f fakeIntegration) Hooks() Hooks { return f.hooks }
+
+// resetRegistry empties the registry for the test and restores it after
+func resetRegistry(t *testing.T) {
+	originalRegistered, originalEnabled := registered, enabled
+	registered, enabled = map[string]Integration{}, map[string]bool{}
+	t.Cleanup(func() { registered, enabled = originalRegistered, originalEnabled })
+}
+
+func appendLabel(label string) func(ctx context.Context, w *types.Workspace, files []types.File) ([]types.File, error) {
+	return func(ctx context.Context, w *types.Workspace, files []types.File) ([]types.File, error) {
+		mutated := []types.File{}
+		for _, file := range files {
+			file.Content += label
+			mutated = append(mutated, file)
+		}
+		return mutated, nil
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	resetRegistry(t)
+
+	Register(fakeIntegration{name: "acme"})
+	assert.Panics(t, func() { Register(fakeIntegration{name: "acme"}) })
+	assert.Equal(t, []string{"acme"}, Registered())
+}
+
+func TestEnableUnknownIntegration(t *testing.T) {
+	resetRegistry(t)
+	Register(fakeIntegration{name: "acme"})
+	require.NoError(t, Enable([]string{"acme"}))
+
+	err := Enable([]string{"acme", "initech"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown integration "initech"`)
+	assert.Len(t, Active(nil), 1, "a failed Enable keeps the enabled integrations")
+}
+
+func TestEnabledNames(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "", want: DefaultEnabled},
+		{value: "none", want: []string{}},
+		{value: " acme, ,replicated", want: []string{"acme", "replicated"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("CHARTSMITH_INTEGRATIONS", tt.value)
+			require.NoError(t, param.Init(nil))
+
+			assert.Equal(t, tt.want, EnabledNames())
+		})
+	}
+}
+
+func TestHooksRunForActiveIntegrations(t *testing.T) {
+	resetRegistry(t)
+	Register(fakeIntegration{
+		name: "acme",
+		hooks: Hooks{
+			PlanContext: func(ctx context.Context, w *types.Workspace) []string { return []string{"use acme images"} },
+			ValidateRender: func(ctx context.Context, w *types.Workspace, chartFiles []types.File, rendered []types.RenderedFile) []string {
+				return []string{"missing acme label"}
+			},
+			MutateExport: appendLabel("# acme\n"),
+		},
+	})
+	Register(fakeIntegration{
+		name:    "initech",
+		applies: func(w *types.Workspace) bool { return w != nil && w.ID == "initech-workspace" },
+		hooks:   Hooks{MutateExport: appendLabel("# initech\n")},
+	})
+	Register(fakeIntegration{name: "disabled", hooks: Hooks{MutateExport: appendLabel("# disabled\n")}})
+	require.NoError(t, Enable([]string{"acme", "initech"}))
+
+	ctx := context.Background()
+	w := &types.Workspace{ID: "initech-workspace"}
+
+	assert.Equal(t, []string{"use acme images"}, PlanContext(ctx, w))
+	assert.Equal(t, []string{"[acme] missing acme label"}, ValidateRender(ctx, w, nil, nil))
+
+	files, err := MutateExport(ctx, w, []types.File{{FilePath: "Chart.yaml", Content: "name: chart\n"}})
+	require.NoError(t, err)
+	assert.Equal(t, "name: chart\n# acme\n# initech\n", files[0].Content, "hooks are chained in name order")
+
+	files, err = MutateExport(ctx, &types.Workspace{ID: "other"}, []types.File{{FilePath: "Chart.yaml", Content: "name: chart\n"}})
+	require.NoError(t, err)
+	assert.Equal(t, "name: chart\n# acme\n", files[0].Content, "initech doesn't apply to other workspaces")
+}
+
+func TestMutateExportError(t *testing.T) {
+	resetRegistry(t)
+	Register(fakeIntegration{
+		name: "acme",
+		hooks: Hooks{MutateExport: func(ctx context.Context, w *types.Workspace, files []types.File) ([]types.File, error) {
+			return nil, errors.New("no Chart.yaml")
+		}},
+	})
+	require.NoError(t, Enable([]string{"acme"}))
+
+	_, err := MutateExport(context.Background(), nil, []types.File{})
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "integration acme failed to mutate export"))
+}
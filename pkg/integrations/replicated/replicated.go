@@ -0,0 +1,174 @@
+// Package replicated is the integration that prepares charts for distribution with Replicated:
+// charts depend on the Replicated SDK subchart and pull images through the Replicated proxy.
+package replicated
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Name is the name to enable the integration with in CHARTSMITH_INTEGRATIONS
+	Name = "replicated"
+
+	// SDKChartName, SDKRepository and SDKVersion are the Replicated SDK dependency added to charts
+	SDKChartName  = "replicated"
+	SDKRepository = "oci://registry.replicated.com/library"
+	SDKVersion    = "1.0.0-beta.32"
+)
+
+var planInstructions = []string{
+	`If the chart is named 'new-chart', the word "replicated" is not part of the new name.`,
+	`If there is a replicated subchart defined, do not remove it.`,
+	`The default location of images will be "proxy.replicated.com/appslug".`,
+}
+
+// Integration implements integrations.Integration
+type Integration struct{}
+
+func New() Integration {
+	return Integration{}
+}
+
+func (Integration) Name() string {
+	return Name
+}
+
+// Enabled applies the integration to every workspace
+func (Integration) Enabled(w *types.Workspace) bool {
+	return true
+}
+
+func (Integration) Hooks() integrations.Hooks {
+	return integrations.Hooks{
+		PlanContext: func(ctx context.Context, w *types.Workspace) []string {
+			return append([]string{}, planInstructions...)
+		},
+		ValidateRender: validateRender,
+		MutateExport:   addSDKDependency,
+	}
+}
+
+// addSDKDependency adds the Replicated SDK to the dependencies in Chart.yaml, unless the chart
+// already depends on it
+func addSDKDependency(ctx context.Context, w *types.Workspace, files []types.File) ([]types.File, error) {
+	mutated := make([]types.File, len(files))
+	copy(mutated, files)
+
+	for i := range mutated {
+		if mutated[i].FilePath != "Chart.yaml" {
+			continue
+		}
+
+		content, err := withSDKDependency(mutated[i].Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add the replicated dependency to Chart.yaml: %w", err)
+		}
+		mutated[i].Content = content
+	}
+
+	return mutated, nil
+}
+
+// validateRender reports a chart that depends on the Replicated SDK without rendering it, which
+// happens when replicated.enabled is false or the dependency condition doesn't match
+func validateRender(ctx context.Context, w *types.Workspace, chartFiles []types.File, rendered []types.RenderedFile) []string {
+	for _, file := range chartFiles {
+		if file.FilePath != "Chart.yaml" {
+			continue
+		}
+
+		content := file.Content
+		if file.ContentPending != nil {
+			content = *file.ContentPending
+		}
+		if !hasSDKDependency(content) {
+			return nil
+		}
+
+		for _, renderedFile := range rendered {
+			if strings.HasPrefix(renderedFile.FilePath, "charts/"+SDKChartName+"/") {
+				return nil
+			}
+		}
+		return []string{"the chart depends on the Replicated SDK but it rendered no resources, check that replicated.enabled isn't false"}
+	}
+
+	return nil
+}
+
+func hasSDKDependency(chartYAML string) bool {
+	var chart struct {
+		Dependencies []struct {
+			Name string `yaml:"name"`
+		} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal([]byte(chartYAML), &chart); err != nil {
+		return false
+	}
+	for _, dependency := range chart.Dependencies {
+		if dependency.Name == SDKChartName {
+			return true
+		}
+	}
+	return false
+}
+
+// withSDKDependency returns chartYAML with the SDK appended to its dependencies, keeping the
+// other fields and comments
+func withSDKDependency(chartYAML string) (string, error) {
+	if hasSDKDependency(chartYAML) {
+		return chartYAML, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(chartYAML), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("Chart.yaml is not a mapping")
+	}
+	root := doc.Content[0]
+
+	var dependencies *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "dependencies" {
+			dependencies = root.Content[i+1]
+			break
+		}
+	}
+	if dependencies == nil {
+		dependencies = &yaml.Node{}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "dependencies"}, dependencies)
+	}
+	if dependencies.Kind != yaml.SequenceNode {
+		// an empty "dependencies:" is a null scalar
+		*dependencies = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+
+	dependency := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, kv := range [][2]string{{"name", SDKChartName}, {"repository", SDKRepository}, {"version", SDKVersion}} {
+		dependency.Content = append(dependency.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv[0]},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv[1]})
+	}
+	dependencies.Content = append(dependencies.Content, dependency)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", fmt.Errorf("failed to encode Chart.yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode Chart.yaml: %w", err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,157 @@
+package replicated
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enable registers the integration once and enables only it, or nothing when on is false
+func enable(t *testing.T, on bool) {
+	if !slices.Contains(integrations.Registered(), Name) {
+		integrations.Register(New())
+	}
+	names := []string{}
+	if on {
+		names = []string{Name}
+	}
+	require.NoError(t, integrations.Enable(names))
+	t.Cleanup(func() { require.NoError(t, integrations.Enable(nil)) })
+}
+
+func TestWithSDKDependency(t *testing.T) {
+	tests := []struct {
+		name      string
+		chartYAML string
+		want      string
+	}{
+		{
+			name: "without dependencies",
+			chartYAML: `apiVersion: v2
+name: nginx
+version: 0.1.0
+`,
+			want: `apiVersion: v2
+name: nginx
+version: 0.1.0
+dependencies:
+  - name: replicated
+    repository: oci://registry.replicated.com/library
+    version: 1.0.0-beta.32
+`,
+		},
+		{
+			name: "with other dependencies and comments",
+			chartYAML: `apiVersion: v2
+name: nginx # the chart name
+version: 0.1.0
+dependencies:
+  - name: redis
+    repository: https://charts.bitnami.com/bitnami
+    version: 17.0.0
+`,
+			want: `apiVersion: v2
+name: nginx # the chart name
+version: 0.1.0
+dependencies:
+  - name: redis
+    repository: https://charts.bitnami.com/bitnami
+    version: 17.0.0
+  - name: replicated
+    repository: oci://registry.replicated.com/library
+    version: 1.0.0-beta.32
+`,
+		},
+		{
+			name: "with empty dependencies",
+			chartYAML: `apiVersion: v2
+name: nginx
+dependencies:
+`,
+			want: `apiVersion: v2
+name: nginx
+dependencies:
+  - name: replicated
+    repository: oci://registry.replicated.com/library
+    version: 1.0.0-beta.32
+`,
+		},
+		{
+			name: "already a dependency",
+			chartYAML: `apiVersion: v2
+name: nginx
+dependencies:
+- name: replicated
+  repository: oci://registry.replicated.com/library
+  version: 1.0.0
+`,
+			want: `apiVersion: v2
+name: nginx
+dependencies:
+- name: replicated
+  repository: oci://registry.replicated.com/library
+  version: 1.0.0
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withSDKDependency(tt.chartYAML)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateRender(t *testing.T) {
+	withSDK := []types.File{{FilePath: "Chart.yaml", Content: "name: nginx\ndependencies:\n- name: replicated\n"}}
+	withoutSDK := []types.File{{FilePath: "Chart.yaml", Content: "name: nginx\n"}}
+	sdkRendered := []types.RenderedFile{
+		{FilePath: "templates/deployment.yaml"},
+		{FilePath: "charts/replicated/templates/replicated-deployment.yaml"},
+	}
+	sdkNotRendered := []types.RenderedFile{{FilePath: "templates/deployment.yaml"}}
+
+	ctx := context.Background()
+	assert.Empty(t, validateRender(ctx, nil, withSDK, sdkRendered))
+	assert.Empty(t, validateRender(ctx, nil, withoutSDK, sdkNotRendered))
+	assert.Len(t, validateRender(ctx, nil, withSDK, sdkNotRendered), 1)
+}
+
+func TestDisabledIntegrationLeavesNoReplicatedContent(t *testing.T) {
+	ctx := context.Background()
+	w := &types.Workspace{ID: "workspace"}
+	chart := []types.File{
+		{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: nginx\nversion: 0.1.0\n"},
+		{FilePath: "values.yaml", Content: "image:\n  repository: nginx\n"},
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		enable(t, true)
+
+		assert.Contains(t, strings.Join(integrations.PlanContext(ctx, w), "\n"), "proxy.replicated.com")
+
+		files, err := integrations.MutateExport(ctx, w, chart)
+		require.NoError(t, err)
+		assert.Contains(t, files[0].Content, SDKRepository)
+		assert.Equal(t, "apiVersion: v2\nname: nginx\nversion: 0.1.0\n", chart[0].Content, "the input files aren't changed")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		enable(t, false)
+
+		assert.Empty(t, integrations.PlanContext(ctx, w))
+
+		files, err := integrations.MutateExport(ctx, w, chart)
+		require.NoError(t, err)
+		for _, file := range files {
+			assert.NotContains(t, strings.ToLower(file.Content), "replicated", file.FilePath)
+		}
+	})
+}
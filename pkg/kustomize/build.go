@@ -0,0 +1,82 @@
+package kustomize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// buildCommand returns the command that builds the kustomization in dir, kustomize if it's
+// installed and kubectl's built in kustomize otherwise
+var buildCommand = func(ctx context.Context, dir string) (*exec.Cmd, error) {
+	if kustomize, err := exec.LookPath("kustomize"); err == nil {
+		return exec.CommandContext(ctx, kustomize, "build", dir), nil
+	}
+	if kubectl, err := exec.LookPath("kubectl"); err == nil {
+		return exec.CommandContext(ctx, kubectl, "kustomize", dir), nil
+	}
+	return nil, errors.New("neither kustomize nor kubectl is installed")
+}
+
+// Builder builds the kustomizations of an archive, which is written to a temp dir until Close
+type Builder struct {
+	root string
+}
+
+// NewBuilder writes the files of an archive to a temp dir to build from
+func NewBuilder(files map[string]string) (*Builder, error) {
+	root, err := os.MkdirTemp("", "chartsmith-kustomize")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+
+	for filePath, content := range files {
+		target := filepath.Join(root, filepath.FromSlash(filePath))
+		if !isWithin(root, target) {
+			os.RemoveAll(root)
+			return nil, fmt.Errorf("file %s is outside of the archive", filePath)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			os.RemoveAll(root)
+			return nil, fmt.Errorf("failed to create dir for %s: %w", filePath, err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			os.RemoveAll(root)
+			return nil, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+	}
+
+	return &Builder{root: root}, nil
+}
+
+func isWithin(root string, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	return err == nil && rel != ".." && !filepath.IsAbs(rel) && (len(rel) < 3 || rel[:3] != ".."+string(filepath.Separator))
+}
+
+// Build runs kustomize build on a kustomization directory of the archive and returns the manifests
+func (b *Builder) Build(ctx context.Context, dir string) (string, error) {
+	cmd, err := buildCommand(ctx, filepath.Join(b.root, filepath.FromSlash(dir)))
+	if err != nil {
+		return "", err
+	}
+
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to build %s: %w: %s", dir, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.String(), nil
+}
+
+// Close removes the temp dir
+func (b *Builder) Close() error {
+	return os.RemoveAll(b.root)
+}
@@ -0,0 +1,309 @@
+// Package kustomize finds the kustomizations in an imported archive, checks that everything they
+// reference is in the archive, and builds them into flat manifests that can be converted to a chart.
+package kustomize
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the names kustomize looks for in a directory, in order
+var FileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// ErrRemoteReference is returned for kustomizations that reference resources outside of the archive
+var ErrRemoteReference = errors.New("remote kustomize references are not supported")
+
+// ErrMissingReference is returned for kustomizations that reference files that aren't in the archive
+var ErrMissingReference = errors.New("kustomization references a file that is not in the archive")
+
+// Kustomization is the part of a kustomization file that references other files
+type Kustomization struct {
+	// Dir is the directory of the kustomization in the archive, "." for the root
+	Dir string
+	// Path is the path of the kustomization file in the archive
+	Path string
+
+	Resources             []string               `yaml:"resources"`
+	Bases                 []string               `yaml:"bases"`
+	Components            []string               `yaml:"components"`
+	Crds                  []string               `yaml:"crds"`
+	PatchesStrategicMerge []string               `yaml:"patchesStrategicMerge"`
+	Patches               []patch                `yaml:"patches"`
+	PatchesJSON6902       []patch                `yaml:"patchesJson6902"`
+	ConfigMapGenerator    []generator            `yaml:"configMapGenerator"`
+	SecretGenerator       []generator            `yaml:"secretGenerator"`
+	Unknown               map[string]interface{} `yaml:",inline"`
+}
+
+type patch struct {
+	Path string `yaml:"path"`
+}
+
+type generator struct {
+	Files   []string               `yaml:"files"`
+	Envs    []string               `yaml:"envs"`
+	Env     string                 `yaml:"env"`
+	Unknown map[string]interface{} `yaml:",inline"`
+}
+
+// IsKustomization reports whether a file path is a kustomization file
+func IsKustomization(filePath string) bool {
+	base := path.Base(filePath)
+	for _, name := range FileNames {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Find parses the kustomizations in an archive, files maps paths in the archive to their content
+func Find(files map[string]string) ([]Kustomization, error) {
+	kustomizations := []Kustomization{}
+	for filePath, content := range files {
+		if !IsKustomization(filePath) {
+			continue
+		}
+
+		k := Kustomization{}
+		if err := yaml.Unmarshal([]byte(content), &k); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+		}
+		k.Path = path.Clean(filePath)
+		k.Dir = path.Dir(k.Path)
+		kustomizations = append(kustomizations, k)
+	}
+
+	sort.Slice(kustomizations, func(i, j int) bool {
+		return kustomizations[i].Dir < kustomizations[j].Dir
+	})
+	return kustomizations, nil
+}
+
+// resourceReferences are the references that can be a directory with another kustomization
+func (k Kustomization) resourceReferences() []string {
+	refs := append([]string{}, k.Resources...)
+	refs = append(refs, k.Bases...)
+	return append(refs, k.Components...)
+}
+
+// fileReferences are the references that must be files
+func (k Kustomization) fileReferences() []string {
+	refs := append([]string{}, k.Crds...)
+	refs = append(refs, k.PatchesStrategicMerge...)
+	for _, p := range append(append([]patch{}, k.Patches...), k.PatchesJSON6902...) {
+		if p.Path != "" {
+			refs = append(refs, p.Path)
+		}
+	}
+	for _, g := range append(append([]generator{}, k.ConfigMapGenerator...), k.SecretGenerator...) {
+		for _, f := range g.Files {
+			// files can be given a key, as in key=path
+			if _, p, ok := strings.Cut(f, "="); ok {
+				f = p
+			}
+			refs = append(refs, f)
+		}
+		refs = append(refs, g.Envs...)
+		if g.Env != "" {
+			refs = append(refs, g.Env)
+		}
+	}
+	return refs
+}
+
+var remoteHostRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+(:[0-9]+)?/`)
+
+// isRemote reports whether a reference is a URL or a git repository rather than a local path
+func isRemote(ref string) bool {
+	return strings.Contains(ref, "://") ||
+		strings.HasPrefix(ref, "git@") ||
+		strings.Contains(ref, "?ref=") ||
+		strings.Contains(ref, "//") ||
+		remoteHostRegex.MatchString(ref)
+}
+
+// Validate checks that the kustomizations only reference files in the archive
+func Validate(kustomizations []Kustomization, files map[string]string) error {
+	dirs := map[string]bool{}
+	for _, k := range kustomizations {
+		dirs[k.Dir] = true
+	}
+
+	for _, k := range kustomizations {
+		for _, ref := range k.resourceReferences() {
+			if isRemote(ref) {
+				return fmt.Errorf("%w: %s references %s", ErrRemoteReference, k.Path, ref)
+			}
+			target := path.Join(k.Dir, ref)
+			if _, ok := files[target]; !ok && !dirs[target] {
+				return fmt.Errorf("%w: %s references %s", ErrMissingReference, k.Path, ref)
+			}
+		}
+		for _, ref := range k.fileReferences() {
+			if isRemote(ref) {
+				return fmt.Errorf("%w: %s references %s", ErrRemoteReference, k.Path, ref)
+			}
+			if _, ok := files[path.Join(k.Dir, ref)]; !ok {
+				return fmt.Errorf("%w: %s references %s", ErrMissingReference, k.Path, ref)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Layout is how the kustomizations of an archive relate to each other
+type Layout struct {
+	// Base is the directory of the kustomization that is converted to the chart
+	Base string
+	// Overlays are the directories of the kustomizations that build on the base, their
+	// differences from the base become values
+	Overlays []string
+	// Independent are the directories of other kustomizations that don't share the base, their
+	// manifests are converted along with the base
+	Independent []string
+}
+
+// Plan works out which kustomization to convert. The roots are the kustomizations that no other
+// kustomization references. A single root is the base. When there are several, the nearest
+// kustomization they all build on is the base and the roots are its overlays.
+func Plan(kustomizations []Kustomization) (*Layout, error) {
+	if len(kustomizations) == 0 {
+		return nil, errors.New("no kustomization found")
+	}
+
+	isDir := map[string]bool{}
+	for _, k := range kustomizations {
+		isDir[k.Dir] = true
+	}
+
+	children := map[string][]string{}
+	referenced := map[string]bool{}
+	for _, k := range kustomizations {
+		for _, ref := range k.resourceReferences() {
+			target := path.Join(k.Dir, ref)
+			if isDir[target] {
+				children[k.Dir] = append(children[k.Dir], target)
+				referenced[target] = true
+			}
+		}
+	}
+
+	roots := []string{}
+	for _, k := range kustomizations {
+		if !referenced[k.Dir] {
+			roots = append(roots, k.Dir)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("kustomizations reference each other in a cycle")
+	}
+	if len(roots) == 1 {
+		return &Layout{Base: roots[0]}, nil
+	}
+
+	// the kustomizations each root builds on, not including itself
+	reachable := func(root string) map[string]bool {
+		seen := map[string]bool{}
+		stack := append([]string{}, children[root]...)
+		for len(stack) > 0 {
+			dir := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			stack = append(stack, children[dir]...)
+		}
+		return seen
+	}
+
+	// group the roots that build on a common kustomization, these are overlays of it
+	type group struct {
+		common map[string]bool
+		roots  []string
+	}
+	groups := []*group{}
+	for _, root := range roots {
+		r := reachable(root)
+		var found *group
+		for _, g := range groups {
+			shared := map[string]bool{}
+			for dir := range g.common {
+				if r[dir] {
+					shared[dir] = true
+				}
+			}
+			if len(shared) > 0 {
+				g.common = shared
+				g.roots = append(g.roots, root)
+				found = g
+				break
+			}
+		}
+		if found == nil {
+			groups = append(groups, &group{common: r, roots: []string{root}})
+		}
+	}
+
+	// the group with the most overlays is converted, with its base as the chart
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].roots) > len(groups[j].roots)
+	})
+
+	layout := &Layout{}
+	for i, g := range groups {
+		if i == 0 && len(g.roots) > 1 {
+			layout.Base = nearest(g.common, children)
+			layout.Overlays = g.roots
+			continue
+		}
+		if len(g.roots) > 1 {
+			layout.Independent = append(layout.Independent, nearest(g.common, children))
+			continue
+		}
+		if layout.Base == "" {
+			layout.Base = g.roots[0]
+			continue
+		}
+		layout.Independent = append(layout.Independent, g.roots[0])
+	}
+
+	sort.Strings(layout.Overlays)
+	sort.Strings(layout.Independent)
+	return layout, nil
+}
+
+// nearest returns the kustomization in dirs that none of the others in dirs build on
+func nearest(dirs map[string]bool, children map[string][]string) string {
+	candidates := []string{}
+	for dir := range dirs {
+		candidates = append(candidates, dir)
+	}
+	sort.Strings(candidates)
+
+	for _, dir := range candidates {
+		isChild := false
+		for _, other := range candidates {
+			if other == dir {
+				continue
+			}
+			for _, child := range children[other] {
+				if child == dir {
+					isChild = true
+				}
+			}
+		}
+		if !isChild {
+			return dir
+		}
+	}
+	return candidates[0]
+}
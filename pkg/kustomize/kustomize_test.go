@@ -0,0 +1,169 @@
+package kustomize
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive reads a testdata dir as the files of an archive
+func readArchive(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	root := filepath.Join("testdata", dir)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestFindAndPlanOverlays(t *testing.T) {
+	files := readArchive(t, "overlays")
+
+	kustomizations, err := Find(files)
+	require.NoError(t, err)
+	require.Len(t, kustomizations, 3)
+	assert.Equal(t, "base", kustomizations[0].Dir)
+	assert.Equal(t, []string{"deployment.yaml", "service.yaml"}, kustomizations[0].Resources)
+
+	require.NoError(t, Validate(kustomizations, files))
+
+	layout, err := Plan(kustomizations)
+	require.NoError(t, err)
+	assert.Equal(t, &Layout{Base: "base", Overlays: []string{"overlays/dev", "overlays/prod"}}, layout)
+}
+
+func TestValidateErrors(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want error
+	}{
+		{dir: "remote", want: ErrRemoteReference},
+		{dir: "missing", want: ErrMissingReference},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			files := readArchive(t, tt.dir)
+			kustomizations, err := Find(files)
+			require.NoError(t, err)
+			assert.ErrorIs(t, Validate(kustomizations, files), tt.want)
+		})
+	}
+}
+
+func TestIsRemote(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{ref: "../base", want: false},
+		{ref: "deployment.yaml", want: false},
+		{ref: "config/default", want: false},
+		{ref: "https://example.com/manifests.yaml", want: true},
+		{ref: "github.com/example/app/config?ref=v1", want: true},
+		{ref: "git@github.com:example/app.git", want: true},
+		{ref: "github.com/example/app//config", want: true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isRemote(tt.ref), tt.ref)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name           string
+		kustomizations []Kustomization
+		want           *Layout
+	}{
+		{
+			name:           "single",
+			kustomizations: []Kustomization{{Dir: "."}},
+			want:           &Layout{Base: "."},
+		},
+		{
+			name: "overlays of a nested base",
+			kustomizations: []Kustomization{
+				{Dir: "base"},
+				{Dir: "components/web", Resources: []string{"../../base"}},
+				{Dir: "overlays/a", Resources: []string{"../../components/web"}},
+				{Dir: "overlays/b", Resources: []string{"../../components/web"}},
+			},
+			want: &Layout{Base: "components/web", Overlays: []string{"overlays/a", "overlays/b"}},
+		},
+		{
+			name: "independent",
+			kustomizations: []Kustomization{
+				{Dir: "app"},
+				{Dir: "app/overlays/a", Resources: []string{"../.."}},
+				{Dir: "app/overlays/b", Resources: []string{"../.."}},
+				{Dir: "monitoring"},
+			},
+			want: &Layout{Base: "app", Overlays: []string{"app/overlays/a", "app/overlays/b"}, Independent: []string{"monitoring"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := Plan(tt.kustomizations)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, layout)
+		})
+	}
+
+	_, err := Plan([]Kustomization{
+		{Dir: "a", Resources: []string{"../b"}},
+		{Dir: "b", Resources: []string{"../a"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestBuild(t *testing.T) {
+	if _, err := exec.LookPath("kustomize"); err != nil {
+		if _, err := exec.LookPath("kubectl"); err != nil {
+			t.Skip("neither kustomize nor kubectl is installed")
+		}
+	}
+
+	builder, err := NewBuilder(readArchive(t, "overlays"))
+	require.NoError(t, err)
+	defer builder.Close()
+
+	base, err := builder.Build(context.Background(), "base")
+	require.NoError(t, err)
+	baseResources, err := SplitManifests(base)
+	require.NoError(t, err)
+	require.Len(t, baseResources, 2)
+
+	prod, err := builder.Build(context.Background(), "overlays/prod")
+	require.NoError(t, err)
+	prodResources, err := SplitManifests(prod)
+	require.NoError(t, err)
+
+	values, unmapped := OverlayValues(baseResources, prodResources)
+	assert.Equal(t, map[string]interface{}{
+		"replicaCount": 3,
+		"image":        map[string]interface{}{"repository": "nginx", "tag": "1.26"},
+	}, values)
+	assert.Empty(t, unmapped)
+}
+
+func TestNewBuilderRejectsEscapingPaths(t *testing.T) {
+	_, err := NewBuilder(map[string]string{"../outside.yaml": "kind: ConfigMap"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,262 @@
+package kustomize
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Resource is a manifest from a kustomize build
+type Resource struct {
+	Kind    string
+	Name    string
+	Content string
+	object  map[string]interface{}
+}
+
+// Key identifies a resource in a build, the namespace isn't part of it because the chart is
+// installed into a single namespace
+func (r Resource) Key() string {
+	return r.Kind + "/" + r.Name
+}
+
+// SplitManifests splits the output of kustomize build into its resources
+func SplitManifests(manifests string) ([]Resource, error) {
+	resources := []Resource{}
+	decoder := yaml.NewDecoder(strings.NewReader(manifests))
+	for {
+		object := map[string]interface{}{}
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifests: %w", err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+
+		content := bytes.Buffer{}
+		encoder := yaml.NewEncoder(&content)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(object); err != nil {
+			return nil, fmt.Errorf("failed to encode manifest: %w", err)
+		}
+
+		r := Resource{Content: content.String(), object: object}
+		r.Kind, _ = object["kind"].(string)
+		if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+			r.Name, _ = metadata["name"].(string)
+		}
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
+
+// FileName is the name of the file a resource is converted from
+func (r Resource) FileName() string {
+	return strings.ToLower(r.Kind) + "-" + r.Name + ".yaml"
+}
+
+var workloadKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+}
+
+// OverlayValues maps the differences between the build of an overlay and the build of its base to
+// the values a converted chart uses for them. This is only possible for the values every converted
+// chart has: the replica count, image and resources of a chart with a single workload with a single
+// container. The differences that can't be mapped are returned as descriptions for the log.
+func OverlayValues(base []Resource, overlay []Resource) (map[string]interface{}, []string) {
+	baseByKey := map[string]Resource{}
+	workloads := []string{}
+	for _, r := range base {
+		baseByKey[r.Key()] = r
+		if workloadKinds[r.Kind] {
+			workloads = append(workloads, r.Key())
+		}
+	}
+
+	// the container of the only workload, if there is exactly one of each
+	mappedWorkload, mappedContainer := "", ""
+	if len(workloads) == 1 {
+		containers := containerNames(baseByKey[workloads[0]].object)
+		if len(containers) == 1 {
+			mappedWorkload, mappedContainer = workloads[0], containers[0]
+		}
+	}
+
+	values := map[string]interface{}{}
+	unmapped := []string{}
+	seen := map[string]bool{}
+	for _, r := range overlay {
+		seen[r.Key()] = true
+		b, ok := baseByKey[r.Key()]
+		if !ok {
+			unmapped = append(unmapped, fmt.Sprintf("%s is only in the overlay", r.Key()))
+			continue
+		}
+
+		baseLeaves := flatten(b.object)
+		overlayLeaves := flatten(r.object)
+		paths := []string{}
+		for p := range overlayLeaves {
+			paths = append(paths, p)
+		}
+		for p := range baseLeaves {
+			if _, ok := overlayLeaves[p]; !ok {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+
+		for _, p := range paths {
+			overlayValue, inOverlay := overlayLeaves[p]
+			baseValue, inBase := baseLeaves[p]
+			if inOverlay && inBase && fmt.Sprint(overlayValue) == fmt.Sprint(baseValue) {
+				continue
+			}
+			if strings.HasPrefix(p, "metadata.namespace") {
+				// the release namespace replaces namespaces
+				continue
+			}
+			if !inOverlay {
+				unmapped = append(unmapped, fmt.Sprintf("%s: %s is removed by the overlay", r.Key(), p))
+				continue
+			}
+
+			if r.Key() == mappedWorkload && mapWorkloadValue(values, p, overlayValue, mappedContainer) {
+				continue
+			}
+			unmapped = append(unmapped, fmt.Sprintf("%s: %s is %v in the overlay", r.Key(), p, overlayValue))
+		}
+	}
+	for _, r := range base {
+		if !seen[r.Key()] {
+			unmapped = append(unmapped, fmt.Sprintf("%s is removed by the overlay", r.Key()))
+		}
+	}
+
+	return values, unmapped
+}
+
+func mapWorkloadValue(values map[string]interface{}, p string, value interface{}, container string) bool {
+	if p == "spec.replicas" {
+		values["replicaCount"] = value
+		return true
+	}
+
+	containerPrefix := "spec.template.spec.containers[" + container + "]."
+	rest, ok := strings.CutPrefix(p, containerPrefix)
+	if !ok {
+		return false
+	}
+
+	if rest == "image" {
+		image, ok := value.(string)
+		if !ok {
+			return false
+		}
+		repository, tag := splitImage(image)
+		imageValues := map[string]interface{}{"repository": repository}
+		if tag != "" {
+			imageValues["tag"] = tag
+		}
+		values["image"] = imageValues
+		return true
+	}
+
+	if resourcePath, ok := strings.CutPrefix(rest, "resources."); ok {
+		setPath(values, append([]string{"resources"}, strings.Split(resourcePath, ".")...), value)
+		return true
+	}
+
+	return false
+}
+
+// splitImage splits an image into its repository and tag, a digest stays on the repository
+func splitImage(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	i := strings.LastIndex(image, ":")
+	if i == -1 || strings.Contains(image[i:], "/") {
+		return image, ""
+	}
+	return image[:i], image[i+1:]
+}
+
+func setPath(values map[string]interface{}, keys []string, value interface{}) {
+	current := values
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
+
+func containerNames(object map[string]interface{}) []string {
+	names := []string{}
+	for p := range flatten(object) {
+		rest, ok := strings.CutPrefix(p, "spec.template.spec.containers[")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rest, "]")
+		found := false
+		for _, n := range names {
+			if n == name {
+				found = true
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flatten returns the scalar leaves of an object by their dotted path. List items with a name are
+// keyed by the name, so that reordering a list isn't a difference, and other items by their index.
+func flatten(object map[string]interface{}) map[string]interface{} {
+	leaves := map[string]interface{}{}
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, child := range v {
+				p := key
+				if prefix != "" {
+					p = prefix + "." + key
+				}
+				walk(p, child)
+			}
+		case []interface{}:
+			for i, child := range v {
+				key := fmt.Sprint(i)
+				if m, ok := child.(map[string]interface{}); ok {
+					if name, ok := m["name"].(string); ok {
+						key = name
+					}
+				}
+				walk(fmt.Sprintf("%s[%s]", prefix, key), child)
+			}
+		default:
+			leaves[prefix] = v
+		}
+	}
+	walk("", object)
+	return leaves
+}
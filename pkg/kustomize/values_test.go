@@ -0,0 +1,129 @@
+package kustomize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseManifests = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: web
+          image: registry.example.com:5000/web:1.0
+          resources:
+            limits:
+              memory: 128Mi
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80
+`
+
+func TestSplitManifests(t *testing.T) {
+	resources, err := SplitManifests(baseManifests + "---\n")
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	assert.Equal(t, "Deployment/web", resources[0].Key())
+	assert.Equal(t, "deployment-web.yaml", resources[0].FileName())
+	assert.Equal(t, "Service/web", resources[1].Key())
+	assert.Contains(t, resources[1].Content, "port: 80")
+}
+
+func TestOverlayValues(t *testing.T) {
+	base, err := SplitManifests(baseManifests)
+	require.NoError(t, err)
+
+	overlay, err := SplitManifests(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: prod
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - name: web
+          image: registry.example.com:5000/web:2.0
+          resources:
+            limits:
+              memory: 512Mi
+              cpu: "1"
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: LoadBalancer
+  ports:
+    - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+`)
+	require.NoError(t, err)
+
+	values, unmapped := OverlayValues(base, overlay)
+	assert.Equal(t, map[string]interface{}{
+		"replicaCount": 3,
+		"image":        map[string]interface{}{"repository": "registry.example.com:5000/web", "tag": "2.0"},
+		"resources": map[string]interface{}{
+			"limits": map[string]interface{}{"memory": "512Mi", "cpu": "1"},
+		},
+	}, values)
+	assert.Equal(t, []string{
+		"Service/web: spec.type is LoadBalancer in the overlay",
+		"ConfigMap/extra is only in the overlay",
+	}, unmapped)
+}
+
+func TestOverlayValuesMultipleWorkloads(t *testing.T) {
+	base, err := SplitManifests(baseManifests + `---
+apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  replicas: 1
+`)
+	require.NoError(t, err)
+
+	overlay, err := SplitManifests(baseManifests)
+	require.NoError(t, err)
+
+	values, unmapped := OverlayValues(base, overlay)
+	assert.Empty(t, values)
+	assert.Equal(t, []string{"StatefulSet/db is removed by the overlay"}, unmapped)
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image, repository, tag string
+	}{
+		{"nginx", "nginx", ""},
+		{"nginx:1.25", "nginx", "1.25"},
+		{"localhost:5000/nginx", "localhost:5000/nginx", ""},
+		{"localhost:5000/nginx:1.25", "localhost:5000/nginx", "1.25"},
+		{"nginx@sha256:abc", "nginx@sha256:abc", ""},
+	}
+	for _, tt := range tests {
+		repository, tag := splitImage(tt.image)
+		assert.Equal(t, tt.repository, repository, tt.image)
+		assert.Equal(t, tt.tag, tag, tt.image)
+	}
+}
@@ -0,0 +1,43 @@
+package lintrules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// hardcodedImageRule finds container images written into templates, which can't be overridden
+// or upgraded through values
+type hardcodedImageRule struct{}
+
+func (hardcodedImageRule) ID() string {
+	return "hardcoded-image"
+}
+
+func (r hardcodedImageRule) Check(files []types.File) []Finding {
+	findings := []Finding{}
+	for _, file := range manifestTemplates(files) {
+		for i, line := range strings.Split(file.Content, "\n") {
+			trimmed := strings.TrimPrefix(strings.TrimSpace(line), "- ")
+			value, ok := strings.CutPrefix(trimmed, "image:")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value == "" || strings.Contains(value, "{{") {
+				continue
+			}
+
+			findings = append(findings, Finding{
+				RuleID:     r.ID(),
+				Severity:   SeverityWarning,
+				FilePath:   file.FilePath,
+				Line:       i + 1,
+				Message:    fmt.Sprintf("image %s is hard-coded, it should come from values", value),
+				Suggestion: strings.Replace(line, "image: "+value, `image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"`, 1),
+			})
+		}
+	}
+	return findings
+}
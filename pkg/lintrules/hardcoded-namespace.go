@@ -0,0 +1,43 @@
+package lintrules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// hardcodedNamespaceRule finds namespaces written into templates, which install resources outside
+// of the release namespace
+type hardcodedNamespaceRule struct{}
+
+func (hardcodedNamespaceRule) ID() string {
+	return "hardcoded-namespace"
+}
+
+func (r hardcodedNamespaceRule) Check(files []types.File) []Finding {
+	findings := []Finding{}
+	for _, file := range manifestTemplates(files) {
+		for i, line := range strings.Split(file.Content, "\n") {
+			trimmed := strings.TrimPrefix(strings.TrimSpace(line), "- ")
+			value, ok := strings.CutPrefix(trimmed, "namespace:")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value == "" || strings.Contains(value, "{{") {
+				continue
+			}
+
+			findings = append(findings, Finding{
+				RuleID:     r.ID(),
+				Severity:   SeverityError,
+				FilePath:   file.FilePath,
+				Line:       i + 1,
+				Message:    fmt.Sprintf("namespace %s is hard-coded, the resource should be in the release namespace", value),
+				Suggestion: strings.Replace(line, "namespace: "+value, "namespace: {{ .Release.Namespace }}", 1),
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,191 @@
+package lintrules
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// the best practices a chart gets health points for
+const (
+	PracticeReadme       = "readme"
+	PracticeValuesSchema = "values-schema"
+	PracticeNotes        = "notes"
+	PracticeRender       = "render"
+)
+
+// HealthCategoryLint is the category of the health score that lint findings take points from
+const HealthCategoryLint = "lint"
+
+// HealthWeights are the points a chart's health score is made of. A chart starts with Lint points and
+// loses the points of its severity for each lint finding, down to zero, and gets the points of each
+// best practice it follows. The total is scaled to 0-100.
+type HealthWeights struct {
+	Lint      int              `json:"lint"`
+	Findings  map[Severity]int `json:"findings"`
+	Practices map[string]int   `json:"practices"`
+}
+
+// DefaultHealthWeights are the weights health scores are computed with
+var DefaultHealthWeights = HealthWeights{
+	Lint: 60,
+	Findings: map[Severity]int{
+		SeverityError:   15,
+		SeverityWarning: 5,
+		SeverityInfo:    1,
+	},
+	Practices: map[string]int{
+		PracticeReadme:       10,
+		PracticeValuesSchema: 10,
+		PracticeNotes:        5,
+		PracticeRender:       15,
+	},
+}
+
+// practiceOrder is the order the practices are listed in a score's categories
+var practiceOrder = []string{PracticeReadme, PracticeValuesSchema, PracticeNotes, PracticeRender}
+
+// ChartHealthInput is what the health score of a chart is computed from
+type ChartHealthInput struct {
+	ChartID  string
+	Files    []types.File
+	Findings []Finding
+	// RenderSucceeded is nil when the chart hasn't been rendered
+	RenderSucceeded *bool
+}
+
+// HealthCategory is the points a chart got for a part of its health score
+type HealthCategory struct {
+	Name      string `json:"name"`
+	Points    int    `json:"points"`
+	MaxPoints int    `json:"maxPoints"`
+	Detail    string `json:"detail"`
+}
+
+// ChartHealth is the health score of a chart, and how it was made up
+type ChartHealth struct {
+	ChartID    string           `json:"chartId"`
+	Score      int              `json:"score"`
+	Categories []HealthCategory `json:"categories"`
+}
+
+// Health is the health score of a workspace, the average of its charts' scores
+type Health struct {
+	Score   int           `json:"score"`
+	Charts  []ChartHealth `json:"charts"`
+	Weights HealthWeights `json:"weights"`
+}
+
+// ScoreHealth computes the health score of each chart and of the workspace they're in. Files with
+// pending content are scored as they'll be once accepted, like Run lints them.
+func ScoreHealth(charts []ChartHealthInput, weights HealthWeights) Health {
+	health := Health{Charts: []ChartHealth{}, Weights: weights}
+	if len(charts) == 0 {
+		return health
+	}
+
+	total := 0
+	for _, chart := range charts {
+		chartHealth := scoreChartHealth(chart, weights)
+		health.Charts = append(health.Charts, chartHealth)
+		total += chartHealth.Score
+	}
+	health.Score = int(math.Round(float64(total) / float64(len(charts))))
+
+	return health
+}
+
+func scoreChartHealth(chart ChartHealthInput, weights HealthWeights) ChartHealth {
+	categories := []HealthCategory{lintHealth(chart.Findings, weights)}
+
+	hasFile := map[string]bool{}
+	for _, file := range chart.Files {
+		content := file.Content
+		if file.ContentPending != nil {
+			content = *file.ContentPending
+		}
+		if strings.TrimSpace(content) != "" {
+			hasFile[file.FilePath] = true
+		}
+	}
+
+	for _, practice := range practiceOrder {
+		maxPoints, ok := weights.Practices[practice]
+		if !ok {
+			continue
+		}
+		followed, detail := false, ""
+		switch practice {
+		case PracticeReadme:
+			followed, detail = hasFile["README.md"], fileDetail("README.md", hasFile["README.md"])
+		case PracticeValuesSchema:
+			followed, detail = hasFile["values.schema.json"], fileDetail("values.schema.json", hasFile["values.schema.json"])
+		case PracticeNotes:
+			followed, detail = hasFile["templates/NOTES.txt"], fileDetail("templates/NOTES.txt", hasFile["templates/NOTES.txt"])
+		case PracticeRender:
+			switch {
+			case chart.RenderSucceeded == nil:
+				detail = "not rendered yet"
+			case *chart.RenderSucceeded:
+				followed, detail = true, "renders"
+			default:
+				detail = "render failed"
+			}
+		}
+
+		points := 0
+		if followed {
+			points = maxPoints
+		}
+		categories = append(categories, HealthCategory{Name: practice, Points: points, MaxPoints: maxPoints, Detail: detail})
+	}
+
+	points, maxPoints := 0, 0
+	for _, category := range categories {
+		points += category.Points
+		maxPoints += category.MaxPoints
+	}
+	score := 0
+	if maxPoints > 0 {
+		score = int(math.Round(100 * float64(points) / float64(maxPoints)))
+	}
+
+	return ChartHealth{ChartID: chart.ChartID, Score: score, Categories: categories}
+}
+
+// lintHealth takes the points of each finding from the lint category
+func lintHealth(findings []Finding, weights HealthWeights) HealthCategory {
+	counts := map[Severity]int{}
+	penalty := 0
+	for _, f := range findings {
+		counts[f.Severity]++
+		penalty += weights.Findings[f.Severity]
+	}
+
+	detail := "no findings"
+	if len(findings) > 0 {
+		parts := []string{}
+		for _, severity := range []Severity{SeverityError, SeverityWarning, SeverityInfo} {
+			if counts[severity] > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[severity], severity))
+			}
+		}
+		detail = strings.Join(parts, ", ")
+	}
+
+	return HealthCategory{
+		Name:      HealthCategoryLint,
+		Points:    max(weights.Lint-penalty, 0),
+		MaxPoints: weights.Lint,
+		Detail:    detail,
+	}
+}
+
+func fileDetail(path string, found bool) string {
+	if found {
+		return "has " + path
+	}
+	return "no " + path
+}
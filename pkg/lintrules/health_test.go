@@ -0,0 +1,109 @@
+package lintrules
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreHealth(t *testing.T) {
+	files := loadFixture(t, "health")
+	findings := Run(files, nil)
+	// the fixture hard-codes a namespace and leaves out the resources of a container
+	require.Equal(t, []location{
+		{"templates/deployment.yaml", 5},
+		{"templates/deployment.yaml", 10},
+	}, locations(findings))
+
+	succeeded, failed := true, false
+	schema := `{"type": "object"}`
+
+	tests := []struct {
+		name            string
+		files           []types.File
+		renderSucceeded *bool
+		wantScore       int
+		wantCategories  map[string]int
+	}{
+		{
+			name:            "rendered",
+			files:           files,
+			renderSucceeded: &succeeded,
+			wantScore:       70,
+			wantCategories:  map[string]int{"lint": 40, "readme": 10, "values-schema": 0, "notes": 5, "render": 15},
+		},
+		{
+			name:            "not rendered yet",
+			files:           files,
+			renderSucceeded: nil,
+			wantScore:       55,
+			wantCategories:  map[string]int{"lint": 40, "readme": 10, "values-schema": 0, "notes": 5, "render": 0},
+		},
+		{
+			name:            "render failed",
+			files:           files,
+			renderSucceeded: &failed,
+			wantScore:       55,
+			wantCategories:  map[string]int{"lint": 40, "readme": 10, "values-schema": 0, "notes": 5, "render": 0},
+		},
+		{
+			name:            "pending schema",
+			files:           append(append([]types.File{}, files...), types.File{FilePath: "values.schema.json", ContentPending: &schema}),
+			renderSucceeded: &succeeded,
+			wantScore:       80,
+			wantCategories:  map[string]int{"lint": 40, "readme": 10, "values-schema": 10, "notes": 5, "render": 15},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := ScoreHealth([]ChartHealthInput{{
+				ChartID:         "chart-1",
+				Files:           tt.files,
+				Findings:        findings,
+				RenderSucceeded: tt.renderSucceeded,
+			}}, DefaultHealthWeights)
+
+			assert.Equal(t, tt.wantScore, health.Score)
+			require.Len(t, health.Charts, 1)
+			assert.Equal(t, "chart-1", health.Charts[0].ChartID)
+			assert.Equal(t, tt.wantScore, health.Charts[0].Score)
+
+			points := map[string]int{}
+			for _, category := range health.Charts[0].Categories {
+				points[category.Name] = category.Points
+			}
+			assert.Equal(t, tt.wantCategories, points)
+			assert.Equal(t, "1 error, 1 warning", health.Charts[0].Categories[0].Detail)
+		})
+	}
+}
+
+func TestScoreHealthAveragesCharts(t *testing.T) {
+	succeeded := true
+	// a chart with every practice and no findings, and one with nothing but a failing lint
+	perfect := ChartHealthInput{
+		ChartID: "perfect",
+		Files: []types.File{
+			{FilePath: "README.md", Content: "# perfect"},
+			{FilePath: "values.schema.json", Content: "{}"},
+			{FilePath: "templates/NOTES.txt", Content: "installed"},
+		},
+		RenderSucceeded: &succeeded,
+	}
+	empty := ChartHealthInput{
+		ChartID:  "empty",
+		Files:    []types.File{{FilePath: "README.md", Content: "  \n"}},
+		Findings: []Finding{{Severity: SeverityError}, {Severity: SeverityError}, {Severity: SeverityError}, {Severity: SeverityError}, {Severity: SeverityInfo}},
+	}
+
+	health := ScoreHealth([]ChartHealthInput{perfect, empty}, DefaultHealthWeights)
+	assert.Equal(t, 50, health.Score)
+	assert.Equal(t, 100, health.Charts[0].Score)
+	assert.Equal(t, 0, health.Charts[1].Score, "lint points don't go below zero, and an empty README doesn't count")
+	assert.Equal(t, DefaultHealthWeights, health.Weights)
+
+	assert.Zero(t, ScoreHealth(nil, DefaultHealthWeights).Score)
+}
@@ -0,0 +1,100 @@
+// Package lintrules checks chart templates for problems that generated templates commonly have.
+// Rules run over the workspace files, including pending content, rather than rendered output, so
+// that findings point at the line of the template to change.
+package lintrules
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Finding is a problem found by a rule, at a 1-based line of a file
+type Finding struct {
+	RuleID     string   `json:"ruleId"`
+	Severity   Severity `json:"severity"`
+	FilePath   string   `json:"filePath"`
+	Line       int      `json:"line"`
+	Message    string   `json:"message"`
+	Suggestion string   `json:"suggestion,omitempty"`
+}
+
+// Rule checks the files of a single chart
+type Rule interface {
+	// ID identifies the rule in findings and in DISABLED_LINT_RULES
+	ID() string
+	Check(files []types.File) []Finding
+}
+
+var rules = []Rule{
+	valuesGuardRule{},
+	hardcodedNamespaceRule{},
+	standardLabelsRule{},
+	resourceLimitsRule{},
+	hardcodedImageRule{},
+}
+
+// Register adds a rule that runs after the built in rules
+func Register(rule Rule) {
+	rules = append(rules, rule)
+}
+
+// Rules returns the registered rules, in the order they run
+func Rules() []Rule {
+	return append([]Rule{}, rules...)
+}
+
+// DisabledRules returns the IDs of the rules turned off by DISABLED_LINT_RULES
+func DisabledRules() []string {
+	disabled := []string{}
+	for _, id := range strings.Split(param.Get().DisabledLintRules, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			disabled = append(disabled, id)
+		}
+	}
+	return disabled
+}
+
+// Run runs every rule that isn't disabled over the files of a chart, and returns the findings
+// ordered by file and line. Files with pending content are checked as they'll be once accepted.
+func Run(files []types.File, disabled []string) []Finding {
+	isDisabled := map[string]bool{}
+	for _, id := range disabled {
+		isDisabled[id] = true
+	}
+
+	current := make([]types.File, 0, len(files))
+	for _, file := range files {
+		if file.ContentPending != nil {
+			file.Content = *file.ContentPending
+		}
+		current = append(current, file)
+	}
+
+	findings := []Finding{}
+	for _, rule := range rules {
+		if isDisabled[rule.ID()] {
+			continue
+		}
+		findings = append(findings, rule.Check(current)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].FilePath != findings[j].FilePath {
+			return findings[i].FilePath < findings[j].FilePath
+		}
+		return findings[i].Line < findings[j].Line
+	})
+
+	return findings
+}
@@ -0,0 +1,93 @@
+package lintrules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadFixture reads the chart in testdata/<name> as workspace files
+func loadFixture(t *testing.T, name string) []types.File {
+	root := filepath.Join("testdata", name)
+	files := []types.File{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, types.File{FilePath: filepath.ToSlash(rel), Content: string(content)})
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+type location struct {
+	filePath string
+	line     int
+}
+
+func locations(findings []Finding) []location {
+	l := []location{}
+	for _, f := range findings {
+		l = append(l, location{f.FilePath, f.Line})
+	}
+	return l
+}
+
+func TestRun(t *testing.T) {
+	files := append(loadFixture(t, "hardcoded-namespace"), loadFixture(t, "hardcoded-image")...)
+
+	findings := Run(files, []string{"resource-limits"})
+	assert.Equal(t, []location{
+		{"templates/deployment.yaml", 12},
+		{"templates/deployment.yaml", 13},
+		{"templates/rolebinding.yaml", 8},
+		{"templates/service.yaml", 5},
+	}, locations(findings))
+
+	findings = Run(files, []string{"resource-limits", "hardcoded-image"})
+	assert.Len(t, findings, 2)
+	for _, f := range findings {
+		assert.Equal(t, "hardcoded-namespace", f.RuleID)
+	}
+
+	// the containers in the image fixture don't set resources
+	findings = Run(files, nil)
+	assert.Len(t, findings, 7)
+}
+
+func TestRunChecksPendingContent(t *testing.T) {
+	pending := "apiVersion: v1\nkind: Service\nmetadata:\n  namespace: {{ .Release.Namespace }}\n"
+	files := []types.File{{FilePath: "templates/service.yaml", Content: "metadata:\n  namespace: default\n", ContentPending: &pending}}
+
+	assert.Empty(t, Run(files, nil))
+}
+
+func TestDisabledRules(t *testing.T) {
+	t.Setenv("DISABLED_LINT_RULES", " values-guard, ,hardcoded-image")
+	initParams(t)
+
+	assert.Equal(t, []string{"values-guard", "hardcoded-image"}, DisabledRules())
+}
+
+func TestRuleIDsAreUnique(t *testing.T) {
+	seen := map[string]bool{}
+	for _, rule := range Rules() {
+		assert.False(t, seen[rule.ID()], rule.ID())
+		seen[rule.ID()] = true
+	}
+	assert.Len(t, seen, 5)
+}
@@ -0,0 +1,77 @@
+package lintrules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// resourceLimitsRule finds containers without resources, which are scheduled without requests and
+// can use all of a node's memory and CPU
+type resourceLimitsRule struct{}
+
+var containerNameRegex = regexp.MustCompile(`^-\s+name:\s*(.+)$`)
+
+func (resourceLimitsRule) ID() string {
+	return "resource-limits"
+}
+
+func (r resourceLimitsRule) Check(files []types.File) []Finding {
+	findings := []Finding{}
+	for _, file := range manifestTemplates(files) {
+		lines := strings.Split(file.Content, "\n")
+		for i, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if trimmed != "containers:" && trimmed != "initContainers:" {
+				continue
+			}
+
+			end := blockEnd(lines, i, indentation(line))
+			itemIndent := -1
+			for j := i + 1; j < end; j++ {
+				item := lines[j]
+				if !isStructural(item) || !strings.HasPrefix(strings.TrimSpace(item), "- ") {
+					continue
+				}
+				if itemIndent == -1 {
+					itemIndent = indentation(item)
+				}
+				if indentation(item) != itemIndent {
+					continue
+				}
+
+				itemEnd := blockEnd(lines, j, itemIndent)
+				if hasResources(lines[j:itemEnd]) {
+					continue
+				}
+
+				name := "container"
+				if m := containerNameRegex.FindStringSubmatch(strings.TrimSpace(item)); m != nil {
+					name = fmt.Sprintf("container %s", strings.Trim(m[1], `"'`))
+				}
+				keyIndent := strings.Repeat(" ", itemIndent+2)
+				findings = append(findings, Finding{
+					RuleID:     r.ID(),
+					Severity:   SeverityWarning,
+					FilePath:   file.FilePath,
+					Line:       j + 1,
+					Message:    fmt.Sprintf("%s has no resource requests or limits", name),
+					Suggestion: fmt.Sprintf("%sresources:\n%s  {{- toYaml .Values.resources | nindent %d }}", keyIndent, keyIndent, itemIndent+4),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// hasResources reports whether a container sets resources, including as its first key ("- resources:")
+func hasResources(lines []string) bool {
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimPrefix(strings.TrimSpace(line), "- "), "resources:") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package lintrules
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func initParams(t *testing.T) {
+	require.NoError(t, param.Init(nil))
+}
+
+func TestValuesGuardRule(t *testing.T) {
+	findings := valuesGuardRule{}.Check(loadFixture(t, "values-guard"))
+
+	assert.Equal(t, []location{
+		{"templates/deployment.yaml", 20},
+		{"templates/deployment.yaml", 29},
+	}, locations(findings))
+	assert.Equal(t, SeverityWarning, findings[0].Severity)
+	assert.Contains(t, findings[0].Message, ".Values.tolerations")
+	assert.Equal(t, "{{- with .Values.tolerations }}\n      tolerations:\n        {{- toYaml . | nindent 8 }}\n{{- end }}", findings[0].Suggestion)
+}
+
+func TestHardcodedNamespaceRule(t *testing.T) {
+	findings := hardcodedNamespaceRule{}.Check(loadFixture(t, "hardcoded-namespace"))
+
+	assert.ElementsMatch(t, []location{
+		{"templates/service.yaml", 5},
+		{"templates/rolebinding.yaml", 8},
+	}, locations(findings))
+	for _, f := range findings {
+		assert.Equal(t, SeverityError, f.Severity)
+		assert.Contains(t, f.Suggestion, "namespace: {{ .Release.Namespace }}")
+	}
+}
+
+func TestStandardLabelsRule(t *testing.T) {
+	files := loadFixture(t, "standard-labels")
+	findings := standardLabelsRule{}.Check(files)
+
+	assert.ElementsMatch(t, []location{
+		{"templates/deployment.yaml", 13},
+		{"templates/service.yaml", 5},
+	}, locations(findings))
+	for _, f := range findings {
+		assert.Contains(t, f.Message, "mychart.labels")
+	}
+
+	// without a labels helper there's nothing to include
+	withoutHelpers := files[:0]
+	for _, f := range files {
+		if f.FilePath != "templates/_helpers.tpl" {
+			withoutHelpers = append(withoutHelpers, f)
+		}
+	}
+	assert.Empty(t, standardLabelsRule{}.Check(withoutHelpers))
+}
+
+func TestResourceLimitsRule(t *testing.T) {
+	findings := resourceLimitsRule{}.Check(loadFixture(t, "resource-limits"))
+
+	assert.Equal(t, []location{
+		{"templates/deployment.yaml", 9},
+		{"templates/deployment.yaml", 17},
+	}, locations(findings))
+	assert.Equal(t, "container migrate has no resource requests or limits", findings[0].Message)
+	assert.Equal(t, "container sidecar has no resource requests or limits", findings[1].Message)
+	assert.Equal(t, "          resources:\n            {{- toYaml .Values.resources | nindent 12 }}", findings[1].Suggestion)
+}
+
+func TestHardcodedImageRule(t *testing.T) {
+	findings := hardcodedImageRule{}.Check(loadFixture(t, "hardcoded-image"))
+
+	assert.Equal(t, []location{
+		{"templates/deployment.yaml", 12},
+		{"templates/deployment.yaml", 13},
+	}, locations(findings))
+	assert.Equal(t, "image nginx:1.25 is hard-coded, it should come from values", findings[0].Message)
+	assert.Equal(t, `        - image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"`, findings[1].Suggestion)
+}
@@ -0,0 +1,59 @@
+package lintrules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// standardLabelsRule finds resources whose labels don't include the chart's labels helper, so they
+// are missing the labels the rest of the chart's resources have. Charts without a labels helper
+// aren't checked.
+type standardLabelsRule struct{}
+
+var labelsHelperRegex = regexp.MustCompile(`{{-?\s*define\s+"([^"]+\.labels)"`)
+
+func (standardLabelsRule) ID() string {
+	return "standard-labels"
+}
+
+func (r standardLabelsRule) Check(files []types.File) []Finding {
+	helper := ""
+	for _, file := range files {
+		if m := labelsHelperRegex.FindStringSubmatch(file.Content); m != nil {
+			helper = m[1]
+			break
+		}
+	}
+	if helper == "" {
+		return []Finding{}
+	}
+
+	findings := []Finding{}
+	for _, file := range manifestTemplates(files) {
+		lines := strings.Split(file.Content, "\n")
+		for i, line := range lines {
+			if strings.TrimSpace(line) != "labels:" || parentKey(lines, i) != "metadata" {
+				continue
+			}
+
+			indent := indentation(line)
+			end := blockEnd(lines, i, indent)
+			if strings.Contains(strings.Join(lines[i+1:end], "\n"), fmt.Sprintf("include %q", helper)) {
+				continue
+			}
+
+			findings = append(findings, Finding{
+				RuleID:     r.ID(),
+				Severity:   SeverityWarning,
+				FilePath:   file.FilePath,
+				Line:       i + 1,
+				Message:    fmt.Sprintf("labels don't include the %s helper", helper),
+				Suggestion: fmt.Sprintf("%slabels:\n%s  {{- include %q . | nindent %d }}", strings.Repeat(" ", indent), strings.Repeat(" ", indent), helper, indent+2),
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,93 @@
+package lintrules
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// isManifestTemplate reports whether a file is a template that renders Kubernetes manifests
+func isManifestTemplate(filePath string) bool {
+	if !strings.HasPrefix(filePath, "templates/") && !strings.Contains(filePath, "/templates/") {
+		return false
+	}
+	ext := path.Ext(filePath)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// manifestTemplates returns the files that render Kubernetes manifests
+func manifestTemplates(files []types.File) []types.File {
+	templates := []types.File{}
+	for _, file := range files {
+		if isManifestTemplate(file.FilePath) {
+			templates = append(templates, file)
+		}
+	}
+	return templates
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// isStructural reports whether a line is part of the YAML structure, as opposed to a blank line,
+// a comment or a line that only has template actions, which can be at any indentation
+func isStructural(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "{{")
+}
+
+// blockEnd returns the index of the first line after start that is indented no more than indent
+func blockEnd(lines []string, start int, indent int) int {
+	for i := start + 1; i < len(lines); i++ {
+		if isStructural(lines[i]) && indentation(lines[i]) <= indent {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// parentKey returns the key of the mapping that the line at index i is in, or "" at the top level
+func parentKey(lines []string, i int) string {
+	indent := indentation(lines[i])
+	for j := i - 1; j >= 0; j-- {
+		if isStructural(lines[j]) && indentation(lines[j]) < indent {
+			key, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(lines[j]), "- "), ":")
+			return key
+		}
+	}
+	return ""
+}
+
+var templateActionRegex = regexp.MustCompile(`{{-?\s*(if|with|range|define|block|else|end)\b(.*?)-?}}`)
+
+// blockTracker follows the if, with, range, define and block actions that enclose each line
+type blockTracker struct {
+	stack []string
+}
+
+// enclosing returns the actions of the blocks that are open at the start of the current line
+func (b *blockTracker) enclosing() []string {
+	return b.stack
+}
+
+// advance updates the open blocks with the actions on a line
+func (b *blockTracker) advance(line string) {
+	for _, m := range templateActionRegex.FindAllStringSubmatch(line, -1) {
+		switch m[1] {
+		case "end":
+			if len(b.stack) > 0 {
+				b.stack = b.stack[:len(b.stack)-1]
+			}
+		case "else":
+			// else if adds its condition to the block it continues
+			if len(b.stack) > 0 {
+				b.stack[len(b.stack)-1] += " " + m[2]
+			}
+		default:
+			b.stack = append(b.stack, m[1]+" "+m[2])
+		}
+	}
+}
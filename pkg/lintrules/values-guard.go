@@ -0,0 +1,104 @@
+package lintrules
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// valuesGuardRule finds values that values.yaml doesn't set, rendered with toYaml outside of an if
+// or with on the same value, which renders a null section unless the user sets them
+type valuesGuardRule struct{}
+
+var toYamlValuesRegex = regexp.MustCompile(`toYaml\s+\(?\s*\.Values\.([A-Za-z0-9_.]+)`)
+
+func (valuesGuardRule) ID() string {
+	return "values-guard"
+}
+
+func (r valuesGuardRule) Check(files []types.File) []Finding {
+	values := chartValues(files)
+
+	findings := []Finding{}
+	for _, file := range manifestTemplates(files) {
+		lines := strings.Split(file.Content, "\n")
+		blocks := &blockTracker{}
+		for i, line := range lines {
+			for _, m := range toYamlValuesRegex.FindAllStringSubmatch(line, -1) {
+				value := ".Values." + m[1]
+				if hasValue(values, m[1]) || isGuarded(blocks.enclosing(), value) || strings.Contains(line, "default") {
+					continue
+				}
+
+				key := parentKey(lines, i)
+				findings = append(findings, Finding{
+					RuleID:     r.ID(),
+					Severity:   SeverityWarning,
+					FilePath:   file.FilePath,
+					Line:       i + 1,
+					Message:    fmt.Sprintf("%s isn't in values.yaml and is rendered without checking that it's set", value),
+					Suggestion: guardSuggestion(key, value, indentation(line)),
+				})
+			}
+			blocks.advance(line)
+		}
+	}
+	return findings
+}
+
+// chartValues returns the parsed values.yaml of the chart, or nil if it has none or it isn't valid
+func chartValues(files []types.File) map[string]interface{} {
+	for _, file := range files {
+		if path.Base(file.FilePath) != "values.yaml" || strings.Contains(file.FilePath, "templates/") {
+			continue
+		}
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(file.Content), &values); err != nil {
+			return nil
+		}
+		return values
+	}
+	return nil
+}
+
+// hasValue reports whether a dotted path is set in values, to anything including an empty map or list
+func hasValue(values map[string]interface{}, valuePath string) bool {
+	var current interface{} = values
+	for _, key := range strings.Split(valuePath, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if current, ok = m[key]; !ok {
+			return false
+		}
+	}
+	return current != nil
+}
+
+// isGuarded reports whether one of the enclosing blocks checks the value, or a parent of it
+func isGuarded(enclosing []string, value string) bool {
+	for _, block := range enclosing {
+		if !strings.HasPrefix(block, "if ") && !strings.HasPrefix(block, "with ") {
+			continue
+		}
+		for _, field := range strings.FieldsFunc(block, func(r rune) bool { return r == ' ' || r == '(' || r == ')' }) {
+			if field == value || strings.HasPrefix(value, field+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func guardSuggestion(key string, value string, indent int) string {
+	keyIndent := strings.Repeat(" ", max(indent-2, 0))
+	if key == "" {
+		return fmt.Sprintf("{{- with %s }}\n%s{{- toYaml . | nindent %d }}\n{{- end }}", value, keyIndent, indent)
+	}
+	return fmt.Sprintf("{{- with %s }}\n%s%s:\n%s  {{- toYaml . | nindent %d }}\n{{- end }}", value, keyIndent, key, keyIndent, indent)
+}
@@ -3,15 +3,19 @@ package listener
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
 	"github.com/replicatedhq/chartsmith/pkg/llm"
 	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/realtime"
 	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/secretscan"
 	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"go.uber.org/zap"
@@ -48,7 +52,7 @@ func applyPlanLockKeyExtractor(payload []byte) (string, error) {
 
 // handleApplyPlanNotification handles a apply_plan notification by processing
 // all action files for a plan in sequence
-func handleApplyPlanNotification(ctx context.Context, payload string) error {
+func handleApplyPlanNotification(ctx context.Context, payload string) (err error) {
 	logger.Info("New apply plan notification received", zap.String("payload", payload))
 
 	// Parse the payload
@@ -62,6 +66,20 @@ func handleApplyPlanNotification(ctx context.Context, payload string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get plan: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: plan.WorkspaceID, PlanID: plan.ID})
+	ctx = logger.WithFields(ctx, zap.String("workspaceID", plan.WorkspaceID), zap.String("planID", plan.ID))
+
+	// Hold the workspace's execution lock until the plan is applied or fails. execute_plan already
+	// holds it for this plan, unless the files were reviewed first.
+	releaseLock, err := lockPlanExecution(ctx, plan)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if !keepsExecutionLock(err) {
+			releaseLock()
+		}
+	}()
 
 	// Get the workspace
 	w, err := workspace.GetWorkspace(ctx, plan.WorkspaceID)
@@ -90,146 +108,411 @@ func handleApplyPlanNotification(ctx context.Context, payload string) error {
 		WorkspaceID: w.ID,
 		Plan:        plan,
 	}
-	if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+	if err := planUpdates.sendPlan(ctx, realtimeRecipient, e); err != nil {
 		return fmt.Errorf("failed to send plan update: %w", err)
 	}
 
-	// Process each action file sequentially
-	for i, actionFile := range plan.ActionFiles {
-		// Skip already completed action files
-		if actionFile.Status == string(llmtypes.ActionPlanStatusCreated) {
+	if err := applyPlan(ctx, w, plan, realtimeRecipient); err != nil {
+		return err
+	}
+
+	// Get the final plan state
+	finalPlan, err := workspace.GetPlan(ctx, nil, plan.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get final plan: %w", err)
+	}
+
+	// Send final plan update, with the health score of the revision the plan built. The revision
+	// isn't rendered yet, it's scored again once it is.
+	var healthScore *int
+	if health, err := scoreRevisionHealth(ctx, w, w.CurrentRevision, nil); err != nil {
+		logger.WarnCtx(ctx, "Failed to score revision health", zap.Error(err))
+	} else {
+		healthScore = &health.Score
+	}
+	finalEvent := realtimetypes.PlanUpdatedEvent{
+		WorkspaceID: w.ID,
+		Plan:        finalPlan,
+		HealthScore: healthScore,
+	}
+	if err := planUpdates.sendPlan(ctx, realtimeRecipient, finalEvent); err != nil {
+		return fmt.Errorf("failed to send final plan update: %w", err)
+	}
+
+	// Create a render job for the completed revision
+	if len(finalPlan.ChatMessageIDs) > 0 {
+		chatMessageID := finalPlan.ChatMessageIDs[len(finalPlan.ChatMessageIDs)-1]
+		if err := workspace.EnqueueRenderWorkspaceForRevisionWithPendingContent(
+			ctx, finalPlan.WorkspaceID, w.CurrentRevision, chatMessageID); err != nil {
+			return fmt.Errorf("failed to create render job for completed plan: %w", err)
+		}
+	} else {
+		logger.WarnCtx(ctx, "No chat messages found for plan, skipping render association")
+	}
+
+	return nil
+}
+
+// these are replaced in tests to run applyActionFile without a database or LLM
+var (
+	setActionFileStatus = updateActionFileStatus
+	executeAction       = processActionFile
+	lintWorkspace       = lintRevision
+	sendPlanEvent       = realtime.SendEvent
+	refreshReadme       = llm.RefreshChartReadme
+	setPlanStatus       = workspace.UpdatePlanStatus
+	completeRevision    = workspace.SetRevisionComplete
+	syncAppVersions     = workspace.SyncAppVersions
+	sendArtifactEvent   = realtime.SendEvent
+)
+
+// applyPlan applies the action files of a plan, refreshes the READMEs of charts whose values
+// changed when the workspace asks for it, syncs the appVersion of the charts the workspace maps to
+// a values path, and completes the plan's revision
+func applyPlan(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, realtimeRecipient realtimetypes.Recipient) error {
+	if err := applyActionFiles(ctx, w, plan, realtimeRecipient); err != nil {
+		return err
+	}
+
+	if w.AutoGenerateReadme {
+		for _, chartID := range chartsWithValuesChanges(w, plan.ActionFiles) {
+			if _, err := refreshReadme(ctx, w.ID, chartID); err != nil {
+				// the plan's changes are applied, a stale README isn't worth failing them for
+				logger.WarnCtx(ctx, "Failed to refresh README.md after values changes",
+					zap.String("chartID", chartID),
+					zap.Error(err))
+			}
+		}
+	}
+
+	// the synced Chart.yaml is part of the revision, so it's written before the revision completes
+	syncs, err := syncAppVersions(ctx, w.ID)
+	if err != nil {
+		// the plan's changes are applied, an appVersion that wasn't synced isn't worth failing them for
+		logger.WarnCtx(ctx, "Failed to sync appVersion", zap.Error(err))
+	}
+	for _, sync := range syncs {
+		chartYAML := sync.ChartYAML
+		if err := sendArtifactEvent(ctx, realtimeRecipient, realtimetypes.ArtifactUpdatedEvent{WorkspaceID: w.ID, WorkspaceFile: &chartYAML}); err != nil {
+			logger.WarnCtx(ctx, "Failed to send synced Chart.yaml", zap.String("chartID", sync.ChartID), zap.Error(err))
+		}
+		recordAudit(ctx, w.ID, workspace.AuditActorSystem, workspace.AuditAppVersionSynced, map[string]interface{}{
+			"chartId":        sync.ChartID,
+			"valuesPath":     sync.ValuesPath,
+			"from":           sync.From,
+			"to":             sync.To,
+			"revisionNumber": w.CurrentRevision,
+		})
+	}
+
+	if err := setPlanStatus(ctx, plan.ID, workspacetypes.PlanStatusApplied); err != nil {
+		return fmt.Errorf("failed to set plan status: %w", err)
+	}
+
+	if err := completeRevision(ctx, w.ID, w.CurrentRevision); err != nil {
+		return fmt.Errorf("failed to mark revision as complete: %w", err)
+	}
+	recordAudit(ctx, w.ID, workspace.AuditActorSystem, workspace.AuditRevisionCompleted, map[string]interface{}{
+		"planId":         plan.ID,
+		"revisionNumber": w.CurrentRevision,
+	})
+
+	return nil
+}
+
+// chartsWithValuesChanges returns the IDs of the charts whose values.yaml a plan changes, in the
+// order they're first changed
+func chartsWithValuesChanges(w *workspacetypes.Workspace, actionFiles []workspacetypes.ActionFile) []string {
+	chartIDs := []string{}
+	seen := map[string]bool{}
+	for _, actionFile := range actionFiles {
+		if actionFile.Path != "values.yaml" {
+			continue
+		}
+		// action files from before charts were scoped don't have a chart ID
+		c, err := workspace.FindChart(w, actionFile.ChartID)
+		if err != nil {
 			continue
 		}
+		if !seen[c.ID] {
+			seen[c.ID] = true
+			chartIDs = append(chartIDs, c.ID)
+		}
+	}
+	return chartIDs
+}
 
-		logger.Info("Processing action file",
+// applyActionFiles applies the action files of a plan sequentially, skipping the ones that are
+// already created and, when the files were reviewed, the ones that weren't approved
+func applyActionFiles(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, realtimeRecipient realtimetypes.Recipient) error {
+	toApply := workspace.ActionFilesToApply(plan)
+	for i, actionFile := range toApply {
+		logger.InfoCtx(ctx, "Processing action file",
 			zap.String("path", actionFile.Path),
+			zap.String("chartID", actionFile.ChartID),
 			zap.String("action", actionFile.Action),
 			zap.Int("index", i),
-			zap.Int("total", len(plan.ActionFiles)))
+			zap.Int("total", len(toApply)))
 
-		// Update the action file status to creating
-		if err := updateActionFileStatus(ctx, plan.ID, actionFile.Path, string(llmtypes.ActionPlanStatusCreating)); err != nil {
-			return fmt.Errorf("failed to update action file status: %w", err)
+		if err := applyActionFile(ctx, w, plan.ID, actionFile, realtimeRecipient); err != nil {
+			// the plan stops here, the file's last status isn't held back for the window
+			if flushErr := planUpdates.flush(plan.ID); flushErr != nil {
+				logger.WarnCtx(ctx, "Failed to send plan update", zap.Error(flushErr))
+			}
+			return fmt.Errorf("failed to process action file: %w", err)
 		}
+	}
+	return nil
+}
+
+// applyActionFile executes a single action file, moving it to creating while it runs and then to
+// created or failed. Each transition is written before the change is sent, so the UI never sees a
+// status that isn't in the database. Changes are sent through planUpdates, a burst of them is one
+// event.
+func applyActionFile(ctx context.Context, w *workspacetypes.Workspace, planID string, actionFile workspacetypes.ActionFile, realtimeRecipient realtimetypes.Recipient) error {
+	ctx = logger.WithFields(ctx, zap.String("path", actionFile.Path), zap.String("chartID", actionFile.ChartID))
 
-		// Get the updated plan for realtime updates
-		updatedPlan, err := workspace.GetPlan(ctx, nil, plan.ID)
+	transition := func(status llmtypes.ActionPlanStatus, errMessage string, lintFindings *int) (*workspacetypes.Plan, error) {
+		updatedPlan, err := setActionFileStatus(ctx, planID, actionFile.ChartID, actionFile.Path, string(status), errMessage)
 		if err != nil {
-			return fmt.Errorf("failed to get updated plan: %w", err)
+			return nil, fmt.Errorf("failed to update action file status: %w", err)
 		}
 
-		// Send realtime update
-		e := realtimetypes.PlanUpdatedEvent{
-			WorkspaceID: w.ID,
-			Plan:        updatedPlan,
-		}
-		if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
-			return fmt.Errorf("failed to send plan update: %w", err)
+		if err := planUpdates.changed(ctx, realtimeRecipient, w.ID, updatedPlan, actionFile.ChartID, actionFile.Path, lintFindings); err != nil {
+			return nil, fmt.Errorf("failed to send plan update: %w", err)
 		}
 
-		// Process the file
-		if err := processActionFile(ctx, w, updatedPlan, actionFile, realtimeRecipient); err != nil {
-			return fmt.Errorf("failed to process action file: %w", err)
+		return updatedPlan, nil
+	}
+
+	auditPayload := func(status llmtypes.ActionPlanStatus, errMessage string) map[string]interface{} {
+		payload := map[string]interface{}{
+			"planId":  planID,
+			"chartId": actionFile.ChartID,
+			"path":    actionFile.Path,
+			"action":  actionFile.Action,
+			"status":  string(status),
+		}
+		if errMessage != "" {
+			payload["error"] = errMessage
 		}
+		return payload
 	}
 
-	// First update the status
-	if err := workspace.UpdatePlanStatus(ctx, plan.ID, workspacetypes.PlanStatusApplied); err != nil {
-		return fmt.Errorf("failed to set plan status: %w", err)
+	updatedPlan, err := transition(llmtypes.ActionPlanStatusCreating, "", nil)
+	if err != nil {
+		return err
 	}
+	recordAudit(ctx, w.ID, workspace.AuditActorLLMExecutor, workspace.AuditActionStarted, auditPayload(llmtypes.ActionPlanStatusCreating, ""))
 
-	if err := workspace.SetRevisionComplete(ctx, w.ID, w.CurrentRevision); err != nil {
-		return fmt.Errorf("failed to mark revision as complete: %w", err)
+	if err := executeAction(ctx, w, updatedPlan, actionFile, realtimeRecipient); err != nil {
+		// the LLM is down, the file goes back to pending and is applied when the plan is retried
+		status := llmtypes.ActionPlanStatusFailed
+		if errors.Is(err, circuitbreaker.ErrOpen) {
+			status = llmtypes.ActionPlanStatusPending
+		}
+		if _, transitionErr := transition(status, err.Error(), nil); transitionErr != nil {
+			logger.ErrorCtx(ctx, fmt.Errorf("failed to mark action file as %s: %w", status, transitionErr))
+		}
+		recordAudit(ctx, w.ID, workspace.AuditActorLLMExecutor, workspace.AuditActionFinished, auditPayload(status, err.Error()))
+		return err
 	}
 
-	// Get the final plan state
-	finalPlan, err := workspace.GetPlan(ctx, nil, plan.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get final plan: %w", err)
+	// lint findings are informational, so a failure to lint doesn't fail the action
+	var lintFindings *int
+	if count, err := lintWorkspace(ctx, w); err != nil {
+		logger.WarnCtx(ctx, "Failed to lint workspace", zap.Error(err))
+	} else {
+		lintFindings = &count
 	}
 
-	// Send final plan update
-	finalEvent := realtimetypes.PlanUpdatedEvent{
-		WorkspaceID: w.ID,
-		Plan:        finalPlan,
+	if _, err := transition(llmtypes.ActionPlanStatusCreated, "", lintFindings); err != nil {
+		return err
 	}
-	if err := realtime.SendEvent(ctx, realtimeRecipient, finalEvent); err != nil {
-		return fmt.Errorf("failed to send final plan update: %w", err)
+	recordAudit(ctx, w.ID, workspace.AuditActorLLMExecutor, workspace.AuditActionFinished, auditPayload(llmtypes.ActionPlanStatusCreated, ""))
+
+	return nil
+}
+
+// lintRevision runs the lint rules over every chart in the current revision of a workspace,
+// stores the findings, and returns how many there are
+func lintRevision(ctx context.Context, w *workspacetypes.Workspace) (int, error) {
+	disabled, err := disabledLintRules(ctx, w.ID)
+	if err != nil {
+		return 0, err
 	}
 
-	// Create a render job for the completed revision
-	if len(finalPlan.ChatMessageIDs) > 0 {
-		chatMessageID := finalPlan.ChatMessageIDs[len(finalPlan.ChatMessageIDs)-1]
-		if err := workspace.EnqueueRenderWorkspaceForRevisionWithPendingContent(
-			ctx, finalPlan.WorkspaceID, w.CurrentRevision, chatMessageID); err != nil {
-			return fmt.Errorf("failed to create render job for completed plan: %w", err)
+	count := 0
+	for _, chart := range w.Charts {
+		files, err := workspace.ListFiles(ctx, w.ID, w.CurrentRevision, chart.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list files: %w", err)
 		}
-	} else {
-		logger.Warn("No chat messages found for plan, skipping render association",
-			zap.String("planID", finalPlan.ID))
+
+		findings := lintrules.Run(files, disabled)
+		if err := workspace.SetLintFindings(ctx, w.ID, w.CurrentRevision, chart.ID, findings); err != nil {
+			return 0, fmt.Errorf("failed to set lint findings: %w", err)
+		}
+		count += len(findings)
 	}
 
-	return nil
+	return count, nil
+}
+
+// disabledLintRules returns the IDs of the lint rules turned off by DISABLED_LINT_RULES and by the
+// workspace's settings
+func disabledLintRules(ctx context.Context, workspaceID string) ([]string, error) {
+	disabled := lintrules.DisabledRules()
+	workspaceDisabled, err := workspace.GetSetting[[]string](ctx, workspaceID, workspace.SettingDisabledLintRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disabled lint rules: %w", err)
+	}
+	return append(disabled, workspaceDisabled...), nil
+}
+
+// allowedActionFileStatuses are the statuses an action file can be set to
+var allowedActionFileStatuses = map[string]bool{
+	string(llmtypes.ActionPlanStatusPending):  true,
+	string(llmtypes.ActionPlanStatusCreating): true,
+	string(llmtypes.ActionPlanStatusCreated):  true,
+	string(llmtypes.ActionPlanStatusFailed):   true,
 }
 
-// updateActionFileStatus updates the status of an action file in a plan
-func updateActionFileStatus(ctx context.Context, planID, path, status string) error {
+// updateActionFileStatus updates the status of an action file in a plan, and returns the updated plan.
+// errMessage is stored with the failed status, and cleared by any other status.
+func updateActionFileStatus(ctx context.Context, planID, chartID, path, status, errMessage string) (*workspacetypes.Plan, error) {
+	if !allowedActionFileStatuses[status] {
+		return nil, fmt.Errorf("invalid action file status %q", status)
+	}
+	if status != string(llmtypes.ActionPlanStatusFailed) {
+		errMessage = ""
+	}
+
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
 	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
 	plan, err := workspace.GetPlan(ctx, tx, planID)
 	if err != nil {
-		return fmt.Errorf("failed to get plan: %w", err)
+		return nil, fmt.Errorf("failed to get plan: %w", err)
 	}
 
 	for i, item := range plan.ActionFiles {
-		if item.Path == path {
+		if item.ChartID == chartID && item.Path == path {
 			plan.ActionFiles[i].Status = status
+			plan.ActionFiles[i].Error = errMessage
+			stampActionFile(&plan.ActionFiles[i], status, time.Now())
 			break
 		}
 	}
 
 	if err := workspace.UpdatePlanActionFiles(ctx, tx, plan.ID, plan.ActionFiles); err != nil {
-		return fmt.Errorf("failed to update plan: %w", err)
+		return nil, fmt.Errorf("failed to update plan: %w", err)
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return plan, nil
+}
+
+// stampActionFile records when an action file was started and finished for the status it's set to.
+// A file that's started again loses the times of its earlier attempt.
+func stampActionFile(actionFile *workspacetypes.ActionFile, status string, now time.Time) {
+	switch status {
+	case string(llmtypes.ActionPlanStatusPending):
+		actionFile.StartedAt = nil
+		actionFile.FinishedAt = nil
+	case string(llmtypes.ActionPlanStatusCreating):
+		actionFile.StartedAt = &now
+		actionFile.FinishedAt = nil
+	case string(llmtypes.ActionPlanStatusCreated), string(llmtypes.ActionPlanStatusFailed):
+		if actionFile.StartedAt == nil {
+			actionFile.StartedAt = &now
+		}
+		actionFile.FinishedAt = &now
+	}
 }
 
+// maxActionFileConflictRetries is how many times an action is applied to a file that keeps being
+// written by someone else while the action executes
+const maxActionFileConflictRetries = 3
+
 // processActionFile processes a single action file for a plan
 func processActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, actionFile workspacetypes.ActionFile, realtimeRecipient realtimetypes.Recipient) error {
-	// Get chart and current content
-	currentContent := ""
-	var chartID string
+	c, err := workspace.FindChart(w, actionFile.ChartID)
+	if err != nil {
+		return fmt.Errorf("failed to find chart for action file: %w", err)
+	}
 
-	if len(w.Charts) > 0 {
-		c := w.Charts[0]
-		chartID = c.ID
+	return withConflictRetry(maxActionFileConflictRetries, func(attempt int) error {
+		if attempt > 0 {
+			logger.InfoCtx(ctx, "File was modified while executing action, re-applying the action",
+				zap.Int("attempt", attempt+1))
+		}
+		return executeActionFile(ctx, w, plan, actionFile, c.ID, realtimeRecipient)
+	})
+}
 
-		for _, file := range c.Files {
-			if file.FilePath == actionFile.Path {
-				currentContent = file.Content
-				break
-			}
+// withConflictRetry calls fn until it returns something other than workspace.ErrConflict, at most
+// attempts times
+func withConflictRetry(attempts int, fn func(attempt int) error) error {
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		err = fn(attempt)
+		if !errors.Is(err, workspace.ErrConflict) {
+			return err
 		}
-	} else {
-		return fmt.Errorf("no charts found in workspace")
+	}
+	return err
+}
+
+// executeActionFile applies an action to the current content of the file, and writes the result
+// as pending content if nothing else wrote the file in the meantime
+func executeActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, actionFile workspacetypes.ActionFile, chartID string, realtimeRecipient realtimetypes.Recipient) error {
+	// Get the file from the workspace, if it exists. This is read before executing so that the
+	// version we write against is the version of the content we executed on
+	files, err := workspace.ListFiles(ctx, w.ID, w.CurrentRevision, chartID)
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
 	}
 
-	// Set up channels for content updates
-	interimContentCh := make(chan string)
-	finalContentCh := make(chan string)
-	errCh := make(chan error)
+	var file *workspacetypes.File
+	for _, f := range files {
+		if f.FilePath == actionFile.Path {
+			file = &f
+			break
+		}
+	}
+
+	// an action on values-<name>.yaml updates the values profile of that name, unless the chart
+	// has its own file at that path
+	if file == nil {
+		profile, err := valuesProfileForPath(ctx, w.ID, chartID, actionFile.Path)
+		if err != nil {
+			return fmt.Errorf("failed to get values profile for action file: %w", err)
+		}
+		if profile != nil {
+			return executeValuesProfileAction(ctx, plan, actionFile, profile)
+		}
+	}
+
+	currentContent := ""
+	if file != nil {
+		currentContent = file.Content
+	}
+
+	// Set up channels for content updates, ExecuteAction replaces an update that hasn't been read
+	// yet so a buffer of one always holds the latest content
+	interimContentCh := make(chan llmtypes.InterimContent, 1)
+	finalContentCh := make(chan string, 1)
+	errCh := make(chan error, 1)
 
 	// Process the file in a goroutine
 	go func() {
@@ -239,7 +522,9 @@ func processActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *w
 				Type:   "file",
 				Status: llmtypes.ActionPlanStatusPending,
 			},
-			Path: actionFile.Path,
+			Path:       actionFile.Path,
+			ChartID:    chartID,
+			ReviewNote: actionFile.ReviewNote,
 		}
 
 		finalContent, err := llm.ExecuteAction(ctx, apwp, plan, currentContent, interimContentCh)
@@ -249,27 +534,13 @@ func processActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *w
 		}
 
 		finalContentCh <- finalContent
-		errCh <- nil
 	}()
 
 	// Set up timeouts
 	timeout := time.After(10 * time.Minute)
 	noActivityTimeout := time.After(3 * time.Minute)
 	lastActivity := time.Now()
-
-	// Get the file from the workspace, if it exists
-	files, err := workspace.ListFiles(ctx, w.ID, w.CurrentRevision, chartID)
-	if err != nil {
-		return fmt.Errorf("failed to list files: %w", err)
-	}
-
-	var file *workspacetypes.File
-	for _, f := range files {
-		if f.FilePath == actionFile.Path {
-			file = &f
-			break
-		}
-	}
+	lastVersion := 0
 
 	// Process updates until done
 	for {
@@ -295,6 +566,16 @@ func processActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *w
 			lastActivity = time.Now()
 			noActivityTimeout = time.After(3 * time.Minute)
 
+			if interimContent.Version <= lastVersion {
+				continue
+			}
+			if skipped := interimContent.Version - lastVersion - 1; skipped > 0 {
+				logger.DebugCtx(ctx, "Coalesced interim content updates",
+					zap.Int("version", interimContent.Version),
+					zap.Int("skipped", skipped))
+			}
+			lastVersion = interimContent.Version
+
 			if file == nil {
 				// We need to create the file since we got content
 				err := workspace.AddFileToChart(ctx, chartID, w.ID, w.CurrentRevision, actionFile.Path, "")
@@ -319,7 +600,7 @@ func processActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *w
 				return fmt.Errorf("file not found in workspace")
 			}
 
-			file.ContentPending = &interimContent
+			file.ContentPending = &interimContent.Content
 
 			e := realtimetypes.ArtifactUpdatedEvent{
 				WorkspaceID:   w.ID,
@@ -332,30 +613,69 @@ func processActionFile(ctx context.Context, w *workspacetypes.Workspace, plan *w
 
 		case finalContent := <-finalContentCh:
 			// Save final content
-			if err := workspace.SetFileContentPending(ctx, actionFile.Path, w.CurrentRevision, chartID, w.ID, finalContent); err != nil {
+			var expectedVersion *int
+			if file != nil {
+				expectedVersion = &file.Version
+			}
+			if err := workspace.SetFileContentPending(ctx, actionFile.Path, w.CurrentRevision, chartID, w.ID, finalContent, expectedVersion); err != nil {
 				return fmt.Errorf("failed to set file content pending: %w", err)
 			}
 
-			// Update action file status
-			if err := updateActionFileStatus(ctx, plan.ID, actionFile.Path, string(llmtypes.ActionPlanStatusCreated)); err != nil {
-				return fmt.Errorf("failed to update action file status: %w", err)
+			if len(secretscan.Scan(actionFile.Path, finalContent)) > 0 {
+				if err := sendSecretFindings(ctx, realtimeRecipient, w.ID, w.CurrentRevision, actionFile.Path); err != nil {
+					logger.WarnCtx(ctx, "Failed to send secret findings", zap.Error(err))
+				}
 			}
 
-			// Send plan update
-			updatedPlan, err := workspace.GetPlan(ctx, nil, plan.ID)
-			if err != nil {
-				return fmt.Errorf("failed to get updated plan: %w", err)
-			}
+			return nil
+		}
+	}
+}
 
-			e := realtimetypes.PlanUpdatedEvent{
-				WorkspaceID: w.ID,
-				Plan:        updatedPlan,
-			}
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
-				return fmt.Errorf("failed to send plan update: %w", err)
-			}
+// valuesProfileForPath returns the values profile a path of a chart refers to, or nil if the path
+// isn't the file name of a profile of the chart
+func valuesProfileForPath(ctx context.Context, workspaceID string, chartID string, path string) (*workspacetypes.ValuesProfile, error) {
+	name, ok := workspace.ValuesProfileNameFromFilename(path)
+	if !ok {
+		return nil, nil
+	}
 
-			return nil
+	profile, err := getValuesProfile(ctx, workspaceID, chartID, name)
+	if err != nil {
+		if errors.Is(err, workspace.ErrValuesProfileNotFound) {
+			return nil, nil
 		}
+		return nil, err
 	}
+	return profile, nil
+}
+
+// executeValuesProfileAction applies an action to the content of a values profile and saves the
+// result. Profiles aren't revisioned, so the result is saved directly rather than as pending content.
+func executeValuesProfileAction(ctx context.Context, plan *workspacetypes.Plan, actionFile workspacetypes.ActionFile, profile *workspacetypes.ValuesProfile) error {
+	apwp := llmtypes.ActionPlanWithPath{
+		ActionPlan: llmtypes.ActionPlan{
+			Action: actionFile.Action,
+			Type:   "file",
+			Status: llmtypes.ActionPlanStatusPending,
+		},
+		Path:    actionFile.Path,
+		ChartID: profile.ChartID,
+	}
+
+	// profiles aren't streamed to the editor, so interim content is discarded
+	finalContent, err := llm.ExecuteAction(ctx, apwp, plan, profile.Content, nil)
+	if err != nil {
+		return fmt.Errorf("failed to execute action: %w", err)
+	}
+
+	if _, err := workspace.SetValuesProfile(ctx, profile.WorkspaceID, profile.ChartID, profile.Name, finalContent); err != nil {
+		return fmt.Errorf("failed to set values profile: %w", err)
+	}
+
+	logger.InfoCtx(ctx, "Updated values profile from plan",
+		zap.String("chartID", profile.ChartID),
+		zap.String("profile", profile.Name))
+
+	return nil
 }
@@ -0,0 +1,439 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionedFile is an in-memory file that is only written when the writer read the current version
+type versionedFile struct {
+	mu      sync.Mutex
+	content string
+	version int
+}
+
+func (f *versionedFile) read() (string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.content, f.version
+}
+
+func (f *versionedFile) write(content string, expectedVersion int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.version != expectedVersion {
+		return fmt.Errorf("%w: at version %d, not %d", workspace.ErrConflict, f.version, expectedVersion)
+	}
+	f.content = content
+	f.version++
+	return nil
+}
+
+func TestWithConflictRetryConcurrentWriters(t *testing.T) {
+	file := &versionedFile{content: "a: 1\n"}
+
+	// both writers read the file before either writes, so one of them has to re-apply its edit
+	var read sync.WaitGroup
+	read.Add(2)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	attempts := make([]int, 2)
+	for i, line := range []string{"b: 2\n", "c: 3\n"} {
+		wg.Add(1)
+		go func(i int, line string) {
+			defer wg.Done()
+			errs[i] = withConflictRetry(maxActionFileConflictRetries, func(attempt int) error {
+				attempts[i]++
+				content, version := file.read()
+				if attempt == 0 {
+					read.Done()
+					read.Wait()
+				}
+				return file.write(content+line, version)
+			})
+		}(i, line)
+	}
+	wg.Wait()
+
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	assert.Equal(t, 3, attempts[0]+attempts[1], "exactly one writer should have retried")
+
+	content, version := file.read()
+	assert.Equal(t, 2, version)
+	assert.True(t, strings.HasPrefix(content, "a: 1\n"))
+	assert.Contains(t, content, "b: 2\n")
+	assert.Contains(t, content, "c: 3\n")
+}
+
+func TestWithConflictRetryGivesUp(t *testing.T) {
+	calls := 0
+	err := withConflictRetry(3, func(attempt int) error {
+		calls++
+		return fmt.Errorf("failed to set file content pending: %w", workspace.ErrConflict)
+	})
+	assert.True(t, errors.Is(err, workspace.ErrConflict))
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	other := errors.New("failed to execute action")
+	err = withConflictRetry(3, func(attempt int) error {
+		calls++
+		return other
+	})
+	assert.Equal(t, other, err)
+	assert.Equal(t, 1, calls)
+}
+
+// stubApplyActionFile replaces the database, LLM and realtime dependencies of applyActionFile with an
+// in-memory plan, an action that returns actionErr, and a list of the plan events sent. Changes are
+// sent as they're made.
+func stubApplyActionFile(t *testing.T, plan *workspacetypes.Plan, actionErr error) *[]realtimetypes.PlanUpdatedEvent {
+	origSet, origExecute, origLint, origSend, origUpdates := setActionFileStatus, executeAction, lintWorkspace, sendPlanEvent, planUpdates
+	t.Cleanup(func() {
+		setActionFileStatus, executeAction, lintWorkspace, sendPlanEvent, planUpdates = origSet, origExecute, origLint, origSend, origUpdates
+	})
+	planUpdates = newPlanUpdateCoalescer(0)
+
+	setActionFileStatus = func(ctx context.Context, planID, chartID, path, status, errMessage string) (*workspacetypes.Plan, error) {
+		for i, item := range plan.ActionFiles {
+			if item.ChartID == chartID && item.Path == path {
+				plan.ActionFiles[i].Status = status
+				plan.ActionFiles[i].Error = errMessage
+			}
+		}
+		// a copy, as a plan read from the database would be
+		updated := *plan
+		updated.ActionFiles = append([]workspacetypes.ActionFile{}, plan.ActionFiles...)
+		return &updated, nil
+	}
+	executeAction = func(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, actionFile workspacetypes.ActionFile, realtimeRecipient realtimetypes.Recipient) error {
+		return actionErr
+	}
+	lintWorkspace = func(ctx context.Context, w *workspacetypes.Workspace) (int, error) {
+		return 3, nil
+	}
+
+	events := []realtimetypes.PlanUpdatedEvent{}
+	sendPlanEvent = func(ctx context.Context, r realtimetypes.Recipient, e realtimetypes.Event) error {
+		events = append(events, e.(realtimetypes.PlanUpdatedEvent))
+		return nil
+	}
+	stubAuditEvents(t)
+
+	return &events
+}
+
+// recordedAudit is an audit event recorded by a stubbed auditEvent
+type recordedAudit struct {
+	Actor     string
+	EventType string
+	Path      string
+}
+
+// stubAuditEvents records the audit events of a flow in memory, with the path of the action file
+// an event is about
+func stubAuditEvents(t *testing.T) *[]recordedAudit {
+	original := auditEvent
+	t.Cleanup(func() { auditEvent = original })
+
+	recorded := []recordedAudit{}
+	auditEvent = func(ctx context.Context, workspaceID string, actor string, eventType string, payload map[string]interface{}) error {
+		path, _ := payload["path"].(string)
+		recorded = append(recorded, recordedAudit{Actor: actor, EventType: eventType, Path: path})
+		return nil
+	}
+	return &recorded
+}
+
+func TestApplyActionFileStatuses(t *testing.T) {
+	actionFile := workspacetypes.ActionFile{Action: "update", Path: "templates/deployment.yaml", ChartID: "chart", Status: "pending"}
+
+	tests := []struct {
+		name           string
+		actionErr      error
+		expectStatuses []string
+		expectError    string
+	}{
+		{
+			name:           "success",
+			expectStatuses: []string{"creating", "created"},
+		},
+		{
+			name:           "failing action",
+			actionErr:      errors.New("failed to execute action: old_str not found"),
+			expectStatuses: []string{"creating", "failed"},
+			expectError:    "failed to execute action: old_str not found",
+		},
+		{
+			name:           "llm down",
+			actionErr:      &circuitbreaker.OpenError{Name: "anthropic", After: 20 * time.Second},
+			expectStatuses: []string{"creating", "pending"},
+			expectError:    "circuit breaker is open: anthropic, retry in 20s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &workspacetypes.Plan{
+				ID:          "plan",
+				WorkspaceID: "workspace",
+				ActionFiles: []workspacetypes.ActionFile{actionFile, {Action: "create", Path: "templates/service.yaml", ChartID: "chart", Status: "pending"}},
+			}
+			events := stubApplyActionFile(t, plan, tt.actionErr)
+
+			err := applyActionFile(context.Background(), &workspacetypes.Workspace{ID: "workspace"}, plan.ID, actionFile, realtimetypes.Recipient{})
+			if tt.actionErr != nil {
+				assert.ErrorIs(t, err, tt.actionErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			statuses := []string{}
+			for _, e := range *events {
+				assert.Equal(t, "workspace", e.WorkspaceID)
+				assert.Nil(t, e.Plan, "a change is sent without the rest of the plan")
+				require.NotNil(t, e.Changes)
+				require.Len(t, e.Changes.ActionFiles, 1)
+				assert.Equal(t, "templates/deployment.yaml", e.Changes.ActionFiles[0].Path)
+				statuses = append(statuses, e.Changes.ActionFiles[0].Status)
+			}
+			assert.Equal(t, tt.expectStatuses, statuses)
+
+			last := (*events)[len(*events)-1]
+			assert.Equal(t, tt.expectError, last.Changes.ActionFiles[0].Error)
+
+			// only a completed action is linted
+			assert.Nil(t, (*events)[0].LintFindings)
+			if tt.actionErr == nil {
+				require.NotNil(t, last.LintFindings)
+				assert.Equal(t, 3, *last.LintFindings)
+			} else {
+				assert.Nil(t, last.LintFindings)
+			}
+		})
+	}
+}
+
+func TestStampActionFile(t *testing.T) {
+	started := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(time.Minute)
+	now := started.Add(time.Hour)
+
+	tests := []struct {
+		name           string
+		actionFile     workspacetypes.ActionFile
+		status         string
+		wantStartedAt  *time.Time
+		wantFinishedAt *time.Time
+	}{
+		{
+			name:          "creating starts the file",
+			status:        "creating",
+			wantStartedAt: &now,
+		},
+		{
+			name:          "creating again starts a new attempt",
+			actionFile:    workspacetypes.ActionFile{StartedAt: &started, FinishedAt: &finished},
+			status:        "creating",
+			wantStartedAt: &now,
+		},
+		{
+			name:           "created finishes the file",
+			actionFile:     workspacetypes.ActionFile{StartedAt: &started},
+			status:         "created",
+			wantStartedAt:  &started,
+			wantFinishedAt: &now,
+		},
+		{
+			name:           "failed before it was started",
+			status:         "failed",
+			wantStartedAt:  &now,
+			wantFinishedAt: &now,
+		},
+		{
+			name:       "pending clears the times",
+			actionFile: workspacetypes.ActionFile{StartedAt: &started, FinishedAt: &finished},
+			status:     "pending",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actionFile := tt.actionFile
+			stampActionFile(&actionFile, tt.status, now)
+			assert.Equal(t, tt.wantStartedAt, actionFile.StartedAt)
+			assert.Equal(t, tt.wantFinishedAt, actionFile.FinishedAt)
+		})
+	}
+}
+
+func TestChartsWithValuesChanges(t *testing.T) {
+	w := &workspacetypes.Workspace{
+		ID:     "ws",
+		Charts: []workspacetypes.Chart{{ID: "app"}, {ID: "db"}},
+	}
+
+	chartIDs := chartsWithValuesChanges(w, []workspacetypes.ActionFile{
+		{Path: "templates/deployment.yaml", ChartID: "app"},
+		{Path: "values.yaml", ChartID: "db"},
+		{Path: "values.yaml"},
+		{Path: "values.yaml", ChartID: "db"},
+		{Path: "values.yaml", ChartID: "removed"},
+	})
+
+	assert.Equal(t, []string{"db", "app"}, chartIDs)
+}
+
+func TestValuesProfileForPath(t *testing.T) {
+	stubGetValuesProfile(t, map[string]string{"app/prod": "replicaCount: 3\n"}, nil)
+
+	tests := []struct {
+		name        string
+		path        string
+		wantProfile string
+	}{
+		{name: "profile file name", path: "values-prod.yaml", wantProfile: "prod"},
+		{name: "no such profile", path: "values-dev.yaml"},
+		{name: "chart values", path: "values.yaml"},
+		{name: "template", path: "templates/values-prod.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := valuesProfileForPath(context.Background(), "ws", "app", tt.path)
+			require.NoError(t, err)
+			if tt.wantProfile == "" {
+				assert.Nil(t, profile)
+				return
+			}
+			require.NotNil(t, profile)
+			assert.Equal(t, tt.wantProfile, profile.Name)
+		})
+	}
+}
+
+func TestApplyActionFilesSkipsRejected(t *testing.T) {
+	plan := &workspacetypes.Plan{
+		ID:          "plan",
+		WorkspaceID: "workspace",
+		ActionFiles: []workspacetypes.ActionFile{
+			{Action: "update", Path: "values.yaml", ChartID: "chart", Status: "pending", Review: workspacetypes.ActionFileReviewApproved},
+			{Action: "create", Path: "templates/hpa.yaml", ChartID: "chart", Status: "pending", Review: workspacetypes.ActionFileReviewRejected},
+			{Action: "update", Path: "templates/deployment.yaml", ChartID: "chart", Status: "pending", Review: workspacetypes.ActionFileReviewApproved, ReviewNote: "keep the existing probes"},
+		},
+	}
+	stubApplyActionFile(t, plan, nil)
+
+	executed := []workspacetypes.ActionFile{}
+	executeAction = func(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, actionFile workspacetypes.ActionFile, realtimeRecipient realtimetypes.Recipient) error {
+		executed = append(executed, actionFile)
+		return nil
+	}
+
+	require.NoError(t, applyActionFiles(context.Background(), &workspacetypes.Workspace{ID: "workspace"}, plan, realtimetypes.Recipient{}))
+
+	require.Len(t, executed, 2)
+	assert.Equal(t, "values.yaml", executed[0].Path)
+	assert.Equal(t, "templates/deployment.yaml", executed[1].Path)
+	assert.Equal(t, "keep the existing probes", executed[1].ReviewNote)
+
+	assert.Equal(t, "created", plan.ActionFiles[0].Status)
+	assert.Equal(t, "pending", plan.ActionFiles[1].Status, "a rejected file is never applied")
+	assert.Equal(t, "created", plan.ActionFiles[2].Status)
+}
+
+func TestApplyPlanAuditEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		actionErr error
+		want      []recordedAudit
+		// wantSteps are the steps after the action files, in the order they're taken
+		wantSteps []string
+	}{
+		{
+			name: "applied",
+			want: []recordedAudit{
+				{Actor: workspace.AuditActorLLMExecutor, EventType: workspace.AuditActionStarted, Path: "values.yaml"},
+				{Actor: workspace.AuditActorLLMExecutor, EventType: workspace.AuditActionFinished, Path: "values.yaml"},
+				{Actor: workspace.AuditActorLLMExecutor, EventType: workspace.AuditActionStarted, Path: "templates/service.yaml"},
+				{Actor: workspace.AuditActorLLMExecutor, EventType: workspace.AuditActionFinished, Path: "templates/service.yaml"},
+				{Actor: workspace.AuditActorSystem, EventType: workspace.AuditAppVersionSynced},
+				{Actor: workspace.AuditActorSystem, EventType: workspace.AuditRevisionCompleted},
+			},
+			wantSteps: []string{"sync", "send Chart.yaml", "set status", "complete revision"},
+		},
+		{
+			name:      "failing action",
+			actionErr: errors.New("failed to execute action: old_str not found"),
+			want: []recordedAudit{
+				{Actor: workspace.AuditActorLLMExecutor, EventType: workspace.AuditActionStarted, Path: "values.yaml"},
+				{Actor: workspace.AuditActorLLMExecutor, EventType: workspace.AuditActionFinished, Path: "values.yaml"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &workspacetypes.Plan{
+				ID:          "plan",
+				WorkspaceID: "workspace",
+				ActionFiles: []workspacetypes.ActionFile{
+					{Action: "update", Path: "values.yaml", ChartID: "chart", Status: "pending"},
+					{Action: "create", Path: "templates/service.yaml", ChartID: "chart", Status: "pending"},
+				},
+			}
+			stubApplyActionFile(t, plan, tt.actionErr)
+			recorded := stubAuditEvents(t)
+
+			origStatus, origComplete, origSync, origSendArtifact := setPlanStatus, completeRevision, syncAppVersions, sendArtifactEvent
+			t.Cleanup(func() {
+				setPlanStatus, completeRevision, syncAppVersions, sendArtifactEvent = origStatus, origComplete, origSync, origSendArtifact
+			})
+			var steps []string
+			setPlanStatus = func(ctx context.Context, planID string, status workspacetypes.PlanStatus) error {
+				steps = append(steps, "set status")
+				return nil
+			}
+			completeRevision = func(ctx context.Context, workspaceID string, revisionNumber int) error {
+				steps = append(steps, "complete revision")
+				return nil
+			}
+			chartYAML := "apiVersion: v2\nname: chart\nversion: 0.1.0\nappVersion: \"1.1.0\"\n"
+			syncAppVersions = func(ctx context.Context, workspaceID string) ([]workspace.AppVersionSync, error) {
+				steps = append(steps, "sync")
+				return []workspace.AppVersionSync{{ChartID: "chart", ValuesPath: "image.tag", From: "1.0.0", To: "1.1.0",
+					ChartYAML: workspacetypes.File{ID: "chart-yaml", ChartID: "chart", FilePath: "Chart.yaml", ContentPending: &chartYAML}}}, nil
+			}
+			sendArtifactEvent = func(ctx context.Context, r realtimetypes.Recipient, e realtimetypes.Event) error {
+				updated := e.(realtimetypes.ArtifactUpdatedEvent)
+				assert.Equal(t, "chart-yaml", updated.WorkspaceFile.ID)
+				assert.Equal(t, chartYAML, *updated.WorkspaceFile.ContentPending)
+				steps = append(steps, "send Chart.yaml")
+				return nil
+			}
+
+			err := applyPlan(context.Background(), &workspacetypes.Workspace{ID: "workspace", CurrentRevision: 2}, plan, realtimetypes.Recipient{})
+			if tt.actionErr != nil {
+				assert.ErrorIs(t, err, tt.actionErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, *recorded)
+			assert.Equal(t, tt.wantSteps, steps)
+		})
+	}
+}
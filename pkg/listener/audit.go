@@ -0,0 +1,23 @@
+package listener
+
+import (
+	"context"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"go.uber.org/zap"
+)
+
+// auditEvent is a var so that tests can observe the audit events of a flow without a database
+var auditEvent = workspace.Audit
+
+// recordAudit records an audit event of a workspace. The audit log is for debugging, so a failure
+// to record an event is logged and doesn't fail the work that caused it.
+func recordAudit(ctx context.Context, workspaceID string, actor string, eventType string, payload map[string]interface{}) {
+	if err := auditEvent(ctx, workspaceID, actor, eventType, payload); err != nil {
+		logger.WarnCtx(ctx, "Failed to record audit event",
+			zap.String("workspaceID", workspaceID),
+			zap.String("eventType", eventType),
+			zap.Error(err))
+	}
+}
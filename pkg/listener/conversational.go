@@ -35,6 +35,7 @@ func handleConverationalNotification(ctx context.Context, payload string) error
 	if err != nil {
 		return fmt.Errorf("error getting chat message: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: chatMessage.WorkspaceID, ChatMessageID: chatMessage.ID})
 
 	w, err := workspace.GetWorkspace(ctx, chatMessage.WorkspaceID)
 	if err != nil {
@@ -50,12 +51,19 @@ func handleConverationalNotification(ctx context.Context, payload string) error
 		UserIDs: userIDs,
 	}
 
+	// the response stops streaming when this returns before it's done
+	llmCtx, cancelLLM := context.WithCancel(ctx)
+	defer cancelLLM()
+
 	streamCh := make(chan string, 1)
 	doneCh := make(chan error, 1)
 	go func() {
-		if err := llm.ConversationalChatMessage(ctx, streamCh, doneCh, w, chatMessage); err != nil {
+		if err := llm.ConversationalChatMessage(llmCtx, streamCh, doneCh, w, chatMessage); err != nil {
 			fmt.Printf("Failed to create conversational chat message: %v\n", err)
-			doneCh <- fmt.Errorf("error creating conversational chat message: %w", err)
+			select {
+			case doneCh <- fmt.Errorf("error creating conversational chat message: %w", err):
+			case <-llmCtx.Done():
+			}
 		}
 	}()
 
@@ -82,6 +90,8 @@ func handleConverationalNotification(ctx context.Context, payload string) error
 			if err := workspace.AppendChatMessageResponse(ctx, chatMessage.ID, stream); err != nil {
 				return fmt.Errorf("failed to write chat message response to database: %w", err)
 			}
+		case <-ctx.Done():
+			return fmt.Errorf("chat message response wasn't finished: %w", ctx.Err())
 		case err := <-doneCh:
 			if err != nil {
 				return fmt.Errorf("error creating initial plan: %w", err)
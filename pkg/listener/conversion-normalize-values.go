@@ -29,6 +29,7 @@ func handleConversionNormalizeValuesNotification(ctx context.Context, payload st
 	if err := json.Unmarshal([]byte(payload), &p); err != nil {
 		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: p.WorkspaceID})
 
 	c, err := workspace.GetConversion(ctx, p.ConversionID)
 	if err != nil {
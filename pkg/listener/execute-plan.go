@@ -10,7 +10,6 @@ import (
 	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
-	"github.com/replicatedhq/chartsmith/pkg/realtime"
 	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
 	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
@@ -19,6 +18,8 @@ import (
 
 type executePlanPayload struct {
 	PlanID string `json:"planId"`
+	// ReviewFiles waits for each action file to be reviewed before the plan is applied
+	ReviewFiles bool `json:"reviewFiles"`
 }
 
 func handleExecutePlanNotification(ctx context.Context, payload string) error {
@@ -36,6 +37,21 @@ func handleExecutePlanNotification(ctx context.Context, payload string) error {
 	if err != nil {
 		return fmt.Errorf("error getting plan: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: plan.WorkspaceID, PlanID: plan.ID})
+	ctx = logger.WithFields(ctx, zap.String("workspaceID", plan.WorkspaceID), zap.String("planID", plan.ID))
+
+	releaseLock, err := lockPlanExecution(ctx, plan)
+	if err != nil {
+		return err
+	}
+	// the lock is handed to the apply_plan job, it's released here when the plan fails or waits
+	// for its files to be reviewed
+	keepLock := false
+	defer func() {
+		if !keepLock {
+			releaseLock()
+		}
+	}()
 
 	w, err := workspace.GetWorkspace(ctx, plan.WorkspaceID)
 	if err != nil {
@@ -61,51 +77,35 @@ func handleExecutePlanNotification(ctx context.Context, payload string) error {
 		WorkspaceID: w.ID,
 		Plan:        plan,
 	}
-	if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+	if err := planUpdates.sendPlan(ctx, realtimeRecipient, e); err != nil {
 		return fmt.Errorf("failed to send plan update: %w", err)
 	}
 
 	detailedPlanStreamCh := make(chan string, 1)
 	detailedPlanActionCreatedCh := make(chan llmtypes.ActionPlanWithPath, 1)
+	// unbuffered, so that every skipped action is received before the plan is done
+	detailedPlanSkippedActionCh := make(chan llmtypes.SkippedActionPlan)
 	detailedPlanDoneCh := make(chan error, 1)
+	// the detailed plan stops streaming when this returns before it's done
+	llmCtx, cancelLLM := context.WithCancel(ctx)
+	defer cancelLLM()
 	go func() {
-		expandedPrompt, err := llm.ExpandPrompt(ctx, plan.Description)
-		if err != nil {
-			detailedPlanDoneCh <- fmt.Errorf("failed to expand prompt: %w", err)
-			return
-		}
-
-		var chartID *string
-		if len(w.Charts) > 0 {
-			chartID = &w.Charts[0].ID
-		}
-
-		relevantFiles, err := workspace.ChooseRelevantFilesForChatMessage(
-			ctx,
-			w,
-			workspace.WorkspaceFilter{
-				ChartID: chartID,
-			},
-			w.CurrentRevision,
-			expandedPrompt,
-		)
-
-		// make sure we only change 10 files max, and nothing lower than a 0.8 similarity score
-		maxFiles := 10
-		if len(relevantFiles) < maxFiles {
-			maxFiles = len(relevantFiles)
+		finalRelevantFiles, err := llm.ChooseExecutePlanFiles(llmCtx, w, plan.Description)
+		if err == nil {
+			if err = llm.CreateExecutePlan(llmCtx, detailedPlanActionCreatedCh, detailedPlanSkippedActionCh, detailedPlanStreamCh, detailedPlanDoneCh, w, plan, &w.Charts[0], finalRelevantFiles); err != nil {
+				err = fmt.Errorf("failed to create execute plan: %w", err)
+			}
 		}
-		relevantFiles = relevantFiles[:maxFiles]
-		finalRelevantFiles := []workspacetypes.File{}
-		for _, file := range relevantFiles {
-			if file.Similarity >= 0.8 {
-				finalRelevantFiles = append(finalRelevantFiles, file.File)
+		if err != nil {
+			select {
+			case detailedPlanDoneCh <- err:
+			case <-llmCtx.Done():
 			}
 		}
-		llm.CreateExecutePlan(ctx, detailedPlanActionCreatedCh, detailedPlanStreamCh, detailedPlanDoneCh, w, plan, &w.Charts[0], finalRelevantFiles)
 	}()
 
 	var buffer strings.Builder
+	skippedActions := []llmtypes.SkippedActionPlan{}
 	done := false
 	for !done {
 		select {
@@ -113,6 +113,9 @@ func handleExecutePlanNotification(ctx context.Context, payload string) error {
 			// Trust the stream's spacing and just append
 			buffer.WriteString(stream)
 
+		case skipped := <-detailedPlanSkippedActionCh:
+			skippedActions = append(skippedActions, skipped)
+
 		case actionPlanWithPath := <-detailedPlanActionCreatedCh:
 			// get the plan from the db again, using a tx to lock
 			tx, err := conn.Begin(ctx)
@@ -129,12 +132,8 @@ func handleExecutePlanNotification(ctx context.Context, payload string) error {
 				currentPlan.ActionFiles = []workspacetypes.ActionFile{}
 			}
 
-			actionFile := workspacetypes.ActionFile{
-				Action: actionPlanWithPath.Action,
-				Path:   actionPlanWithPath.Path,
-				Status: string(llmtypes.ActionPlanStatusPending),
-			}
-			currentPlan.ActionFiles = append(currentPlan.ActionFiles, actionFile)
+			// a later action for a file that's listed replaces its action
+			currentPlan.ActionFiles = llm.AddActionFile(currentPlan.ActionFiles, actionPlanWithPath)
 
 			if err := workspace.UpdatePlanActionFiles(ctx, tx, currentPlan.ID, currentPlan.ActionFiles); err != nil {
 				return fmt.Errorf("error updating plan action files: %w", err)
@@ -144,22 +143,39 @@ func handleExecutePlanNotification(ctx context.Context, payload string) error {
 				return fmt.Errorf("failed to commit transaction: %w", err)
 			}
 
-			e := realtimetypes.PlanUpdatedEvent{
-				WorkspaceID: w.ID,
-				Plan:        currentPlan,
-			}
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+			if err := planUpdates.changed(ctx, realtimeRecipient, w.ID, currentPlan, actionPlanWithPath.ChartID, actionPlanWithPath.Path, nil); err != nil {
 				return fmt.Errorf("failed to send plan update: %w", err)
 			}
 
 			// We'll let the apply_plan handler process these actions later
 			// No need to enqueue individual execute_action jobs
 
+		case <-ctx.Done():
+			return fmt.Errorf("detailed plan wasn't finished: %w", ctx.Err())
+
 		case err := <-detailedPlanDoneCh:
 			if err != nil {
 				return fmt.Errorf("error creating initial plan: %w", err)
 			}
 
+			// the plan is applied or reviewed next, maybe by another worker, so the files listed
+			// so far are sent before it starts
+			if len(skippedActions) > 0 {
+				if err := sendSkippedActions(ctx, plan.ID, realtimeRecipient, skippedActions); err != nil {
+					return err
+				}
+			} else if err := planUpdates.flush(plan.ID); err != nil {
+				return fmt.Errorf("failed to send plan update: %w", err)
+			}
+
+			if p.ReviewFiles {
+				if err := waitForFileReview(ctx, w.ID, plan.ID, realtimeRecipient); err != nil {
+					return err
+				}
+				done = true
+				continue
+			}
+
 			// Enqueue a single apply_plan job after all action files are collected
 			// This is what starts the actual processing
 			if err := persistence.EnqueueWork(ctx, "apply_plan", map[string]interface{}{
@@ -167,10 +183,55 @@ func handleExecutePlanNotification(ctx context.Context, payload string) error {
 			}); err != nil {
 				return fmt.Errorf("failed to enqueue apply plan: %w", err)
 			}
+			keepLock = true
 
 			done = true
 		}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// sendSkippedActions notes the malformed actions that were left out of a plan in its description,
+// and sends the plan with the note and the files listed so far
+func sendSkippedActions(ctx context.Context, planID string, realtimeRecipient realtimetypes.Recipient, skipped []llmtypes.SkippedActionPlan) error {
+	if err := workspace.AppendPlanDescription(ctx, planID, llm.SkippedActionsNote(skipped)); err != nil {
+		return fmt.Errorf("failed to note skipped actions: %w", err)
+	}
+
+	plan, err := workspace.GetPlan(ctx, nil, planID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	e := realtimetypes.PlanUpdatedEvent{
+		WorkspaceID: plan.WorkspaceID,
+		Plan:        plan,
+	}
+	if err := planUpdates.sendPlan(ctx, realtimeRecipient, e); err != nil {
+		return fmt.Errorf("failed to send plan update: %w", err)
+	}
+	return nil
+}
+
+// waitForFileReview moves a plan whose action files are collected to review-files instead of
+// applying it. It's applied when every file is approved or rejected, see workspace.ProceedReviewedPlan.
+func waitForFileReview(ctx context.Context, workspaceID string, planID string, realtimeRecipient realtimetypes.Recipient) error {
+	if err := workspace.UpdatePlanStatus(ctx, planID, workspacetypes.PlanStatusReviewFiles); err != nil {
+		return fmt.Errorf("error updating plan status: %w", err)
+	}
+
+	plan, err := workspace.GetPlan(ctx, nil, planID)
+	if err != nil {
+		return fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	e := realtimetypes.PlanUpdatedEvent{
+		WorkspaceID: workspaceID,
+		Plan:        plan,
+	}
+	if err := planUpdates.sendPlan(ctx, realtimeRecipient, e); err != nil {
+		return fmt.Errorf("failed to send plan update: %w", err)
+	}
+	return nil
+}
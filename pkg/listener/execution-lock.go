@@ -0,0 +1,44 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that the execution lock can be tested without a database
+var (
+	acquireExecutionLock = workspace.AcquireExecutionLock
+	releaseExecutionLock = workspace.ReleaseExecutionLock
+)
+
+// lockPlanExecution acquires the execution lock of a plan's workspace, so that only one plan of a
+// workspace executes at a time. The API checks the lock before a plan is enqueued, but two plans
+// can be enqueued before either is handled, so the handlers acquire it too. A plan refused by the
+// lock returns a *workspace.ExecutionLockedError, its message is held and handled again later.
+// The returned func releases the lock.
+func lockPlanExecution(ctx context.Context, plan *workspacetypes.Plan) (func(), error) {
+	if err := acquireExecutionLock(ctx, plan.WorkspaceID, plan.ID); err != nil {
+		return nil, fmt.Errorf("failed to lock plan execution: %w", err)
+	}
+
+	release := func() {
+		// the handler's context can be done by the time it releases the lock
+		if err := releaseExecutionLock(context.WithoutCancel(ctx), plan.WorkspaceID, plan.ID); err != nil {
+			logger.WarnCtx(ctx, "Failed to release execution lock", zap.Error(err))
+		}
+	}
+	return release, nil
+}
+
+// keepsExecutionLock returns true when a plan that failed with err will be handled again soon, so
+// that it keeps its workspace's lock until then
+func keepsExecutionLock(err error) bool {
+	var retry retryLater
+	return err != nil && errors.As(err, &retry)
+}
@@ -0,0 +1,83 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubExecutionLocks keeps execution locks in memory, one per workspace, with no staleness
+func stubExecutionLocks(t *testing.T) map[string]string {
+	locks := map[string]string{}
+	originalAcquire, originalRelease := acquireExecutionLock, releaseExecutionLock
+	acquireExecutionLock = func(ctx context.Context, workspaceID string, planID string) error {
+		if holder, ok := locks[workspaceID]; ok && holder != planID {
+			return &workspace.ExecutionLockedError{WorkspaceID: workspaceID, PlanID: holder}
+		}
+		locks[workspaceID] = planID
+		return nil
+	}
+	releaseExecutionLock = func(ctx context.Context, workspaceID string, planID string) error {
+		if locks[workspaceID] == planID {
+			delete(locks, workspaceID)
+		}
+		return nil
+	}
+	t.Cleanup(func() { acquireExecutionLock, releaseExecutionLock = originalAcquire, originalRelease })
+	return locks
+}
+
+func TestLockPlanExecution(t *testing.T) {
+	locks := stubExecutionLocks(t)
+	ctx := context.Background()
+	planA := &workspacetypes.Plan{ID: "a", WorkspaceID: "ws"}
+	planB := &workspacetypes.Plan{ID: "b", WorkspaceID: "ws"}
+
+	releaseA, err := lockPlanExecution(ctx, planA)
+	require.NoError(t, err)
+
+	// apply_plan acquires the lock execute_plan handed it
+	_, err = lockPlanExecution(ctx, planA)
+	require.NoError(t, err)
+
+	// a plan enqueued past the API's check is held until the lock is released
+	_, err = lockPlanExecution(ctx, planB)
+	var lockedErr *workspace.ExecutionLockedError
+	require.ErrorAs(t, err, &lockedErr)
+	assert.Equal(t, "a", lockedErr.PlanID)
+	assert.True(t, keepsExecutionLock(err), "the refused message is held, not failed")
+
+	// a plan of another workspace isn't refused
+	_, err = lockPlanExecution(ctx, &workspacetypes.Plan{ID: "c", WorkspaceID: "other"})
+	require.NoError(t, err)
+
+	releaseA()
+	assert.Equal(t, map[string]string{"other": "c"}, locks)
+	_, err = lockPlanExecution(ctx, planB)
+	require.NoError(t, err)
+}
+
+func TestKeepsExecutionLock(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "applied", err: nil, want: false},
+		{name: "failed", err: errors.New("failed to process action file"), want: false},
+		{name: "llm circuit open", err: fmt.Errorf("failed to process action file: %w", &circuitbreaker.OpenError{Name: "anthropic", After: time.Minute}), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, keepsExecutionLock(tt.err))
+		})
+	}
+}
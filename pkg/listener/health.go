@@ -0,0 +1,175 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// maxReadyReconnectAttempts is how many reconnect attempts in a row the worker stays ready for.
+// A blip reconnects in one or two, a worker stuck past this should be taken out of service.
+const maxReadyReconnectAttempts = 3
+
+// listenerHealth is the state of the LISTEN connection, written by the listener and read by the
+// health endpoints
+type listenerHealth struct {
+	mu                sync.Mutex
+	subscribed        bool
+	reconnectAttempts int
+	consecutiveErrors int
+}
+
+func (h *listenerHealth) setSubscribed(subscribed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribed = subscribed
+}
+
+func (h *listenerHealth) setReconnectAttempts(attempts int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reconnectAttempts = attempts
+}
+
+func (h *listenerHealth) setConsecutiveErrors(count int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.consecutiveErrors = count
+}
+
+// Status is a snapshot of the listener, served as JSON on /status
+type Status struct {
+	// Subscribed is true when the LISTEN connection is up and listening on every channel
+	Subscribed bool `json:"subscribed"`
+	// ReconnectAttempts is the number of attempts of the reconnect in progress, 0 when connected
+	ReconnectAttempts int `json:"reconnectAttempts"`
+	// ConsecutiveErrors counts failed waits of the LISTEN connection for notifications since the
+	// last one that succeeded, the errors of each channel are in its ChannelStatus
+	ConsecutiveErrors int                      `json:"consecutiveErrors"`
+	Channels          map[string]ChannelStatus `json:"channels"`
+	// CircuitBreakers are the breakers in front of the services handlers call. An open breaker
+	// doesn't make the worker unready, the work waits in the queue until the service is back.
+	CircuitBreakers []circuitbreaker.Stats `json:"circuitBreakers"`
+}
+
+// ChannelStatus is the state of the processor of one work queue channel
+type ChannelStatus struct {
+	Processing      bool       `json:"processing"`
+	LastProcessedAt *time.Time `json:"lastProcessedAt,omitempty"`
+	MaxWorkers      int        `json:"maxWorkers"`
+	BusyWorkers     int        `json:"busyWorkers"`
+	// OldestUnclaimedSeconds is how long the oldest unclaimed message had waited when the channel
+	// was last polled, at StatsAt
+	OldestUnclaimedSeconds float64    `json:"oldestUnclaimedSeconds"`
+	StatsAt                *time.Time `json:"statsAt,omitempty"`
+	// ConsecutiveErrors counts the polls and messages of the channel that failed since the last
+	// one that succeeded, the channel backs off from polling while it's above 0
+	ConsecutiveErrors int64 `json:"consecutiveErrors"`
+}
+
+// Ready returns nil when the worker can take work, or why it can't
+func (s Status) Ready() error {
+	if s.ReconnectAttempts > maxReadyReconnectAttempts {
+		return fmt.Errorf("reconnecting to the database, attempt %d", s.ReconnectAttempts)
+	}
+	if !s.Subscribed {
+		return errors.New("not listening for notifications")
+	}
+	return nil
+}
+
+// Status returns a snapshot of the listener's connection and channel processors
+func (l *Listener) Status() Status {
+	l.health.mu.Lock()
+	status := Status{
+		Subscribed:        l.health.subscribed,
+		ReconnectAttempts: l.health.reconnectAttempts,
+		ConsecutiveErrors: l.health.consecutiveErrors,
+		Channels:          map[string]ChannelStatus{},
+		CircuitBreakers:   []circuitbreaker.Stats{llm.GetExecuteBreakerStats()},
+	}
+	l.health.mu.Unlock()
+
+	for channel, processor := range l.processors {
+		status.Channels[channel] = ChannelStatus{
+			Processing:      processor.processing.Load(),
+			LastProcessedAt: processor.lastProcessedAt.Load(),
+			MaxWorkers:      processor.maxWorkers,
+			BusyWorkers:     len(processor.workerPool),
+
+			OldestUnclaimedSeconds: time.Duration(processor.oldestUnclaimedAge.Load()).Seconds(),
+			StatsAt:                processor.statsAt.Load(),
+			ConsecutiveErrors:      processor.consecutiveErrors.Load(),
+		}
+	}
+
+	return status
+}
+
+// statusSource is what the health endpoints read, a *Listener outside of tests
+type statusSource interface {
+	Status() Status
+}
+
+// checkDatabase is a var so that the health endpoints can be tested without a database
+var checkDatabase = ensureActiveConnection
+
+// HealthHandler serves /healthz, which only checks that the process is up, /readyz, which checks
+// the database and the LISTEN subscriptions, and /status with the state of every channel
+func HealthHandler(source statusSource) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := source.Status().Ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		if err := checkDatabase(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(source.Status())
+	})
+	return mux
+}
+
+// ServeHealth serves the health endpoints of the listener on address until ctx is done
+func ServeHealth(ctx context.Context, address string, l *Listener) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           HealthHandler(l),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving health endpoints", zap.String("address", address))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve health endpoints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubStatus Status
+
+func (s stubStatus) Status() Status {
+	return Status(s)
+}
+
+func stubCheckDatabase(t *testing.T, err error) {
+	original := checkDatabase
+	checkDatabase = func(ctx context.Context) error {
+		return err
+	}
+	t.Cleanup(func() { checkDatabase = original })
+}
+
+func TestHealthz(t *testing.T) {
+	stubCheckDatabase(t, errors.New("connection refused"))
+
+	rec := httptest.NewRecorder()
+	HealthHandler(stubStatus{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code, "liveness doesn't depend on the database")
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   Status
+		dbErr    error
+		want     int
+		wantBody string
+	}{
+		{name: "subscribed", status: Status{Subscribed: true}, want: http.StatusOK},
+		{name: "a reconnect in progress", status: Status{Subscribed: false, ReconnectAttempts: 2}, want: http.StatusServiceUnavailable, wantBody: "not listening"},
+		{name: "reconnecting for too long", status: Status{ReconnectAttempts: maxReadyReconnectAttempts + 1}, want: http.StatusServiceUnavailable, wantBody: "reconnecting to the database, attempt 4"},
+		{name: "before subscribing", status: Status{}, want: http.StatusServiceUnavailable, wantBody: "not listening"},
+		{name: "database down", status: Status{Subscribed: true}, dbErr: errors.New("connection check failed"), want: http.StatusServiceUnavailable, wantBody: "connection check failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubCheckDatabase(t, tt.dbErr)
+
+			rec := httptest.NewRecorder()
+			HealthHandler(stubStatus(tt.status)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.want, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestStatusEndpoint(t *testing.T) {
+	processedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	status := Status{
+		Subscribed:        true,
+		ConsecutiveErrors: 1,
+		Channels: map[string]ChannelStatus{
+			"new_plan":      {Processing: true, LastProcessedAt: &processedAt, MaxWorkers: 5, BusyWorkers: 2},
+			"new_summarize": {MaxWorkers: 5, ConsecutiveErrors: 2},
+		},
+		CircuitBreakers: []circuitbreaker.Stats{{Name: "anthropic", State: circuitbreaker.StateOpen, ConsecutiveFailures: 5, OpenedAt: &processedAt, Opens: 1, Rejections: 3}},
+	}
+
+	rec := httptest.NewRecorder()
+	HealthHandler(stubStatus(status)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, status, got)
+}
+
+func TestListenerStatus(t *testing.T) {
+	l := &Listener{handlers: map[string]NotificationHandler{}, processors: map[string]*queueProcessor{}}
+	l.AddHandler(context.Background(), "new_plan", 5, time.Second, 0, nil, nil)
+	l.AddHandler(context.Background(), "new_summarize", 2, time.Second, 0, nil, nil)
+
+	processedAt := time.Now()
+	l.processors["new_plan"].processing.Store(true)
+	l.processors["new_plan"].lastProcessedAt.Store(&processedAt)
+	l.processors["new_plan"].workerPool <- struct{}{}
+	l.processors["new_summarize"].consecutiveErrors.Store(3)
+	l.health.setSubscribed(true)
+	l.health.setConsecutiveErrors(2)
+
+	status := l.Status()
+	assert.True(t, status.Subscribed)
+	assert.Equal(t, 2, status.ConsecutiveErrors)
+	assert.Equal(t, ChannelStatus{Processing: true, LastProcessedAt: &processedAt, MaxWorkers: 5, BusyWorkers: 1}, status.Channels["new_plan"])
+	assert.Equal(t, ChannelStatus{MaxWorkers: 2, ConsecutiveErrors: 3}, status.Channels["new_summarize"])
+	require.Len(t, status.CircuitBreakers, 1)
+	assert.Equal(t, "anthropic", status.CircuitBreakers[0].Name)
+	assert.NoError(t, status.Ready())
+
+	l.health.setSubscribed(false)
+	l.health.setReconnectAttempts(maxReadyReconnectAttempts + 1)
+	assert.Error(t, l.Status().Ready())
+}
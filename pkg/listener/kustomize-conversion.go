@@ -0,0 +1,166 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/kustomize"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+type kustomizeBuilder interface {
+	Build(ctx context.Context, dir string) (string, error)
+	Close() error
+}
+
+// newKustomizeBuilder is a var so that tests don't need kustomize installed
+var newKustomizeBuilder = func(files map[string]string) (kustomizeBuilder, error) {
+	return kustomize.NewBuilder(files)
+}
+
+// kustomizeConversion is a Kustomize project prepared for conversion
+type kustomizeConversion struct {
+	// SourceFiles are the built manifests to convert, one per resource
+	SourceFiles map[string]string
+	// ConvertedFiles are the values files for the overlays, added to the chart as they are
+	ConvertedFiles map[string]string
+	Log            []string
+}
+
+// prepareKustomizeConversion replaces the files of a Kustomize conversion with the manifests built
+// from it, so that the rest of the conversion is the same as for loose manifests
+func prepareKustomizeConversion(ctx context.Context, c *workspacetypes.Conversion) error {
+	conversionFiles, err := workspace.ListFilesToConvert(ctx, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list files to convert: %w", err)
+	}
+
+	files := map[string]string{}
+	for _, file := range conversionFiles {
+		files[file.FilePath] = file.FileContent
+	}
+
+	prepared, err := buildKustomizeConversion(ctx, files)
+	if err != nil {
+		if logErr := workspace.AppendConversionLog(ctx, c.ID, err.Error()); logErr != nil {
+			logger.Warn("failed to append conversion log", zap.String("conversionId", c.ID), zap.Error(logErr))
+		}
+		return fmt.Errorf("failed to build kustomize project: %w", err)
+	}
+
+	if err := workspace.ReplaceConversionSourceFiles(ctx, c.ID, prepared.SourceFiles, prepared.ConvertedFiles); err != nil {
+		return fmt.Errorf("failed to replace conversion files: %w", err)
+	}
+
+	if err := workspace.AppendConversionLog(ctx, c.ID, prepared.Log...); err != nil {
+		return fmt.Errorf("failed to append conversion log: %w", err)
+	}
+
+	return nil
+}
+
+// buildKustomizeConversion builds the base of a Kustomize project, and any kustomizations that are
+// independent of it, into manifests. The differences of each overlay from the base are mapped to a
+// values-<overlay>.yaml where possible, and logged where not.
+func buildKustomizeConversion(ctx context.Context, files map[string]string) (*kustomizeConversion, error) {
+	kustomizations, err := kustomize.Find(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := kustomize.Validate(kustomizations, files); err != nil {
+		return nil, err
+	}
+	layout, err := kustomize.Plan(kustomizations)
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := newKustomizeBuilder(files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare kustomize build: %w", err)
+	}
+	defer builder.Close()
+
+	result := &kustomizeConversion{
+		SourceFiles:    map[string]string{},
+		ConvertedFiles: map[string]string{},
+		Log:            []string{},
+	}
+
+	build := func(dir string) ([]kustomize.Resource, error) {
+		manifests, err := builder.Build(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		return kustomize.SplitManifests(manifests)
+	}
+
+	base, err := build(layout.Base)
+	if err != nil {
+		return nil, err
+	}
+	result.Log = append(result.Log, fmt.Sprintf("Built %d resources from the base %s", len(base), layout.Base))
+	for _, r := range base {
+		result.SourceFiles[r.FileName()] = r.Content
+	}
+
+	for _, dir := range layout.Independent {
+		resources, err := build(dir)
+		if err != nil {
+			return nil, err
+		}
+		result.Log = append(result.Log, fmt.Sprintf("Built %d resources from %s", len(resources), dir))
+		for _, r := range resources {
+			fileName := r.FileName()
+			if _, ok := result.SourceFiles[fileName]; ok {
+				fileName = strings.ReplaceAll(dir, "/", "-") + "-" + fileName
+			}
+			result.SourceFiles[fileName] = r.Content
+		}
+	}
+
+	for _, dir := range layout.Overlays {
+		resources, err := build(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		values, unmapped := kustomize.OverlayValues(base, resources)
+		for _, difference := range unmapped {
+			result.Log = append(result.Log, fmt.Sprintf("Overlay %s: not mapped to values: %s", dir, difference))
+		}
+		if len(values) == 0 {
+			result.Log = append(result.Log, fmt.Sprintf("Overlay %s: no differences mapped to values", dir))
+			continue
+		}
+
+		fileName := "values-" + path.Base(dir) + ".yaml"
+		if _, ok := result.ConvertedFiles[fileName]; ok {
+			fileName = "values-" + strings.ReplaceAll(dir, "/", "-") + ".yaml"
+		}
+		content := bytes.Buffer{}
+		encoder := yaml.NewEncoder(&content)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(values); err != nil {
+			return nil, fmt.Errorf("failed to marshal values for %s: %w", dir, err)
+		}
+		result.ConvertedFiles[fileName] = fmt.Sprintf("# Values for the %s overlay of the Kustomize project\n%s", dir, content.String())
+
+		keys := []string{}
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result.Log = append(result.Log, fmt.Sprintf("Overlay %s: mapped %s to %s", dir, strings.Join(keys, ", "), fileName))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/kustomize"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubKustomizeBuilder returns canned manifests for each kustomization dir
+type stubKustomizeBuilder map[string]string
+
+func (b stubKustomizeBuilder) Build(ctx context.Context, dir string) (string, error) {
+	manifests, ok := b[dir]
+	if !ok {
+		return "", fmt.Errorf("no build for %s", dir)
+	}
+	return manifests, nil
+}
+
+func (b stubKustomizeBuilder) Close() error {
+	return nil
+}
+
+func deploymentManifest(replicas int, image string) string {
+	return fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: %d
+  template:
+    spec:
+      containers:
+        - name: web
+          image: %s
+`, replicas, image)
+}
+
+func TestBuildKustomizeConversion(t *testing.T) {
+	service := `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  type: ClusterIP
+`
+
+	stub := stubKustomizeBuilder{
+		"base":          deploymentManifest(1, "nginx:1.25") + "---\n" + service,
+		"overlays/dev":  deploymentManifest(1, "nginx:1.25") + "---\n" + service,
+		"overlays/prod": deploymentManifest(3, "nginx:1.26") + "---\n" + service + "  externalTrafficPolicy: Local\n",
+	}
+	original := newKustomizeBuilder
+	newKustomizeBuilder = func(files map[string]string) (kustomizeBuilder, error) { return stub, nil }
+	defer func() { newKustomizeBuilder = original }()
+
+	files := map[string]string{
+		"base/kustomization.yaml":          "resources:\n  - deployment.yaml\n  - service.yaml\n",
+		"base/deployment.yaml":             deploymentManifest(1, "nginx:1.25"),
+		"base/service.yaml":                service,
+		"overlays/dev/kustomization.yaml":  "resources:\n  - ../../base\n",
+		"overlays/prod/kustomization.yaml": "resources:\n  - ../../base\n",
+	}
+
+	result, err := buildKustomizeConversion(context.Background(), files)
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"deployment-web.yaml", "service-web.yaml"}, mapKeys(result.SourceFiles))
+	assert.Equal(t, map[string]string{
+		"values-prod.yaml": "# Values for the overlays/prod overlay of the Kustomize project\nimage:\n  repository: nginx\n  tag: \"1.26\"\nreplicaCount: 3\n",
+	}, result.ConvertedFiles)
+	assert.Equal(t, []string{
+		"Built 2 resources from the base base",
+		"Overlay overlays/dev: no differences mapped to values",
+		"Overlay overlays/prod: not mapped to values: Service/web: spec.externalTrafficPolicy is Local in the overlay",
+		"Overlay overlays/prod: mapped image, replicaCount to values-prod.yaml",
+	}, result.Log)
+}
+
+func TestBuildKustomizeConversionRejectsRemoteBases(t *testing.T) {
+	_, err := buildKustomizeConversion(context.Background(), map[string]string{
+		"kustomization.yaml": "resources:\n  - https://github.com/example/app/config?ref=v1\n",
+	})
+	assert.ErrorIs(t, err, kustomize.ErrRemoteReference)
+}
+
+func mapKeys(m map[string]string) []string {
+	result := []string{}
+	for k := range m {
+		result = append(result, k)
+	}
+	return result
+}
@@ -2,14 +2,17 @@ package listener
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
 	"github.com/replicatedhq/chartsmith/pkg/param"
 	"go.uber.org/zap"
@@ -18,34 +21,79 @@ import (
 // NotificationHandler is a function type that handles notifications
 type NotificationHandler func(notification *pgconn.Notification) error
 
+// retryLater is implemented by handler errors that know when the work can be retried, such as a
+// call refused by an open circuit breaker. The message is held until then rather than claimed
+// again on the next poll.
+type retryLater interface {
+	RetryAfter() time.Duration
+}
+
 // LockKeyExtractor is a function type that extracts the lock key from the payload
 type LockKeyExtractor func(payload []byte) (string, error)
 
 // Listener manages PostgreSQL LISTEN/NOTIFY subscriptions
 type Listener struct {
-	conn              *pgx.Conn
+	conn              *pgx.Conn     // dedicated connection, used only for LISTEN / WaitForNotification
+	pool              *pgxpool.Pool // shared pool for all queue claim / update operations
+	poolMaxConns      int32
 	handlers          map[string]NotificationHandler
 	reconnectInterval time.Duration
 	maxReconnectRetry int
 	processors        map[string]*queueProcessor
 	pgURI             string // Store the connection string for pooled connections
 	queueLocks        map[string]map[string]chan struct{}
+	periodicTasks     []periodicTask
 	mu                sync.Mutex
+	health            listenerHealth
+	queueAgeAlerter   *queueAgeAlerter
+}
+
+// PeriodicTask is background work that the listener runs on an interval, such as pruning old rows
+type PeriodicTask func(ctx context.Context) error
+
+type periodicTask struct {
+	name     string
+	interval time.Duration
+	task     PeriodicTask
 }
 
 const (
 	WorkQueueTable = "work_queue"
+
+	// starvationThreshold is how long a message can wait before it's boosted
+	// ahead of newer, higher priority messages
+	starvationThreshold = 5 * time.Minute
+	starvationBoost     = 100
+
+	// defaultQueuePoolMaxConns bounds the number of connections the listener
+	// will open for queue operations, regardless of how many messages are in flight
+	defaultQueuePoolMaxConns = 10
+
+	// channelErrorBackoff is how long a channel waits before polling again after an error, it
+	// doubles with each error in a row up to maxChannelErrorBackoff
+	channelErrorBackoff    = time.Second
+	maxChannelErrorBackoff = 30 * time.Second
 )
 
 type queueProcessor struct {
 	channel          string
+	defaultPriority  int
 	handler          NotificationHandler
 	workerPool       chan struct{}
-	processing       bool
+	processing       atomic.Bool
 	pollTicker       *time.Ticker
 	maxWorkers       int
 	maxDuration      time.Duration // Maximum time a task can be processing before considered failed
 	lockKeyExtractor LockKeyExtractor
+	lastProcessedAt  atomic.Pointer[time.Time]
+	// oldestUnclaimedAge and statsAt are from the queue statistics of the channel's last poll
+	oldestUnclaimedAge atomic.Int64
+	statsAt            atomic.Pointer[time.Time]
+	// fairnessKey is the payload field messages are shared out by, see SetFairnessKey
+	fairnessKey string
+	// consecutiveErrors counts the polls and messages of the channel that failed in a row, the
+	// channel backs off for longer with each one without slowing the other channels down
+	consecutiveErrors atomic.Int64
 }
 
 // NewListener creates a new Listener instance
@@ -56,21 +104,25 @@ func NewListener() *Listener {
 		maxReconnectRetry: 0,               // 0 means unlimited retries
 		processors:        make(map[string]*queueProcessor),
 		pgURI:             param.Get().PGURI,
+		poolMaxConns:      defaultQueuePoolMaxConns,
 		queueLocks:        make(map[string]map[string]chan struct{}),
 		mu:                sync.Mutex{},
 	}
 }
 
-// AddHandler registers a handler for a specific type of work
-func (l *Listener) AddHandler(ctx context.Context, channel string, maxWorkers int, maxDuration time.Duration, handler NotificationHandler, lockKeyExtractor LockKeyExtractor) error {
+// AddHandler registers a handler for a specific type of work. defaultPriority is used
+// for messages that were enqueued without an explicit priority. Priorities only order the messages
+// of one channel, each channel claims for its own maxWorkers and doesn't wait on the others.
+func (l *Listener) AddHandler(ctx context.Context, channel string, maxWorkers int, maxDuration time.Duration, defaultPriority int, handler NotificationHandler, lockKeyExtractor LockKeyExtractor) error {
 	l.handlers[channel] = handler
 
 	// Initialize queue processor
 	l.processors[channel] = &queueProcessor{
 		channel:          channel,
+		defaultPriority:  defaultPriority,
 		handler:          handler,
 		workerPool:       make(chan struct{}, maxWorkers),
-		pollTicker:       time.NewTicker(5 * time.Second),
+		pollTicker:       time.NewTicker(param.GetTimeouts().QueueClaimInterval),
 		maxWorkers:       maxWorkers,
 		maxDuration:      maxDuration,
 		lockKeyExtractor: lockKeyExtractor,
@@ -79,12 +131,64 @@ func (l *Listener) AddHandler(ctx context.Context, channel string, maxWorkers in
 	return nil
 }
 
+// SetFairnessKey makes a channel share its workers between the values of a payload field, such as
+// workspaceId, instead of claiming the oldest messages first. Each claim takes the oldest message
+// of the values whose last message completed longest ago, and a value never has more than one
+// message in flight, so a workspace that queued a batch can't starve the others.
+func (l *Listener) SetFairnessKey(channel string, payloadField string) {
+	if processor, ok := l.processors[channel]; ok {
+		processor.fairnessKey = payloadField
+	}
+}
+
+// AddPeriodicTask registers a task to run every interval while the listener is running
+func (l *Listener) AddPeriodicTask(name string, interval time.Duration, task PeriodicTask) {
+	l.periodicTasks = append(l.periodicTasks, periodicTask{
+		name:     name,
+		interval: interval,
+		task:     task,
+	})
+}
+
+// runPeriodicTask runs a task every interval until ctx is done. Errors are logged, the task
+// runs again on the next tick.
+func (l *Listener) runPeriodicTask(ctx context.Context, t periodicTask) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.task(ctx); err != nil {
+				logger.Error(fmt.Errorf("periodic task %s failed: %w", t.name, err))
+			}
+		}
+	}
+}
+
 // Start begins listening for notifications
 func (l *Listener) Start(ctx context.Context) error {
 	logger.Info("Starting listener")
 
-	// Establish initial connection
 	var err error
+
+	// All queue operations share a single pool so that a busy channel can't
+	// open an unbounded number of connections. The pool connects lazily.
+	if l.pool == nil {
+		l.pool, err = newQueuePool(ctx, l.pgURI, l.poolMaxConns)
+		if err != nil {
+			return fmt.Errorf("failed to create queue connection pool: %w", err)
+		}
+	}
+
+	// release what a worker that stopped was processing before any channel is claimed from
+	reconcileCtx, reconcileCancel := context.WithTimeout(ctx, param.GetTimeouts().DBOperation)
+	l.reconcileInFlight(reconcileCtx)
+	reconcileCancel()
+
+	// Establish initial connection
 	connectionTimeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
@@ -162,18 +266,22 @@ func (l *Listener) Start(ctx context.Context) error {
 
 		// Check for existing work in each queue and start processing
 		processor := l.processors[channel]
-		if !processor.processing {
-			processor.processing = true
+		if processor.processing.CompareAndSwap(false, true) {
 			go l.processQueue(ctx, processor)
 		}
 	}
 
 	logger.Info("Successfully subscribed to all channels",
 		zap.Int("channelCount", channelCount))
+	l.health.setSubscribed(true)
 
 	// Start processing notifications in a separate goroutine
 	go l.processNotifications(ctx)
 
+	for _, t := range l.periodicTasks {
+		go l.runPeriodicTask(ctx, t)
+	}
+
 	logger.Info("Listener started successfully")
 	return nil
 }
@@ -200,22 +308,10 @@ func (l *Listener) processNotifications(ctx context.Context) {
 				if time.Since(lastSuccessTime) > healthCheckInterval*2 {
 					logger.Warn("No notification received in a while, performing health check")
 
-					// Use a dedicated connection for health checks
+					// Health checks use the queue pool, the dedicated connection is busy waiting for notifications
 					healthCtx, healthCancel := context.WithTimeout(ctx, 5*time.Second)
-					
-					// Create a new connection just for this health check
-					healthConn, err := pgx.Connect(healthCtx, l.pgURI)
-					if err != nil {
-						logger.Error(fmt.Errorf("health check connection failed: %w", err))
-						healthCancel()
-						continue
-					}
-					
 					var result int
-					err = healthConn.QueryRow(healthCtx, "SELECT 1").Scan(&result)
-					
-					// Always close the health check connection
-					healthConn.Close(healthCtx) 
+					err := l.pool.QueryRow(healthCtx, "SELECT 1").Scan(&result)
 					healthCancel()
 
 					if err != nil {
@@ -225,7 +321,8 @@ func (l *Listener) processNotifications(ctx context.Context) {
 						if reconnectErr := l.reconnect(ctx); reconnectErr != nil {
 							logger.Error(fmt.Errorf("failed to reconnect after health check: %w", reconnectErr))
 						} else {
-							consecutiveErrors = 0        // Reset on successful reconnect
+							consecutiveErrors = 0 // Reset on successful reconnect
+							l.health.setConsecutiveErrors(0)
 							lastSuccessTime = time.Now() // Update last success time after reconnect
 						}
 					} else {
@@ -308,6 +405,7 @@ func (l *Listener) processNotifications(ctx context.Context) {
 			}
 
 			consecutiveErrors++
+			l.health.setConsecutiveErrors(consecutiveErrors)
 			// Check if this is a timeout error (expected during periods of inactivity)
 			if strings.Contains(err.Error(), "context deadline exceeded") || strings.Contains(err.Error(), "timeout") {
 				// Log timeout errors at DEBUG level
@@ -340,6 +438,7 @@ func (l *Listener) processNotifications(ctx context.Context) {
 				} else {
 					// Reset error counter on successful reconnect
 					consecutiveErrors = 0
+					l.health.setConsecutiveErrors(0)
 					lastSuccessTime = time.Now()
 				}
 			}
@@ -348,6 +447,7 @@ func (l *Listener) processNotifications(ctx context.Context) {
 
 		// Reset error counter and update last success time on successful notification
 		consecutiveErrors = 0
+		l.health.setConsecutiveErrors(0)
 		lastSuccessTime = time.Now()
 
 		processor, exists := l.processors[notification.Channel]
@@ -357,8 +457,7 @@ func (l *Listener) processNotifications(ctx context.Context) {
 		}
 
 		// Trigger processing if not already processing
-		if !processor.processing {
-			processor.processing = true
+		if processor.processing.CompareAndSwap(false, true) {
 			go l.processQueue(ctx, processor)
 		}
 	}
@@ -366,9 +465,17 @@ func (l *Listener) processNotifications(ctx context.Context) {
 
 // processQueue handles message processing for a specific queue
 func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor) {
-	defer func() { processor.processing = false }()
+	defer processor.processing.Store(false)
 
 	for {
+		if backoff := channelBackoff(processor.consecutiveErrors.Load()); backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			logger.Info("Received context done, existing process queue")
@@ -382,109 +489,31 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 		// Create a context with timeout for database operations
 		dbCtx, dbCancel := context.WithTimeout(ctx, 10*time.Second)
 		
-		// PHASE 1: Get queue statistics with a dedicated connection
-		statsConn, err := pgx.Connect(dbCtx, l.pgURI)
+		// PHASE 1: Get queue statistics
+		stats, err := GetQueueStats(dbCtx, l.pool, processor.channel)
 		if err != nil {
-			logger.Error(fmt.Errorf("failed to connect to database for queue stats: %w", err))
-			dbCancel()
-			return
-		}
-
-		// Get queue statistics
-		var total, inFlight, available int
-		err = statsConn.QueryRow(dbCtx, fmt.Sprintf(`
-			SELECT
-				COUNT(*) as total,
-				COUNT(CASE WHEN processing_started_at IS NOT NULL AND completed_at IS NULL THEN 1 END) as in_flight,
-				COUNT(CASE WHEN processing_started_at IS NULL AND completed_at IS NULL THEN 1 END) as available
-			FROM %s
-			WHERE channel = $1
-			AND completed_at IS NULL`, WorkQueueTable), processor.channel).Scan(&total, &inFlight, &available)
-		
-		// Always close the connection when done
-		statsConn.Close(dbCtx)
-
-		if err != nil {
-			logger.Error(fmt.Errorf("failed to get queue statistics: %w", err))
+			logger.Error(err, zap.Int64("consecutiveErrors", processor.consecutiveErrors.Add(1)))
 			dbCancel()
 			return
 		} else {
 			logger.Info("queue status",
 				zap.String("channel", processor.channel),
-				zap.Int("total", total),
-				zap.Int("in_flight", inFlight),
-				zap.Int("available", available))
-		}
-
-		// PHASE 2: Get messages to process with a dedicated connection
-		fetchConn, err := pgx.Connect(dbCtx, l.pgURI)
-		if err != nil {
-			logger.Error(fmt.Errorf("failed to connect to database for message fetching: %w", err))
-			dbCancel()
-			return
+				zap.Int("total", stats.Total),
+				zap.Int("in_flight", stats.InFlight),
+				zap.Int("available", stats.Available),
+				zap.Int("dead", stats.Dead),
+				zap.Duration("oldest_unclaimed_age", stats.OldestUnclaimedAge))
+			l.recordQueueStats(ctx, processor, *stats, time.Now())
 		}
 
-		// Query and lock unprocessed messages atomically
-		// This SQL's logic has been fixed to NOT increment attempt_count for new messages
-		rows, err := fetchConn.Query(dbCtx, fmt.Sprintf(`
-			WITH next_available_messages AS (
-				SELECT id, payload
-				FROM %s
-				WHERE completed_at IS NULL
-				AND channel = $1
-				AND (
-					processing_started_at IS NULL
-					OR processing_started_at < NOW() - $2::interval
-				)
-				ORDER BY created_at ASC
-				LIMIT %d
-				FOR UPDATE SKIP LOCKED
-			)
-			UPDATE %s AS wq
-			SET processing_started_at = NOW(),
-				-- Only increment for timed out messages, not for new ones
-				attempt_count = CASE 
-					WHEN wq.processing_started_at IS NOT NULL THEN COALESCE(wq.attempt_count, 0) + 1
-					ELSE 0
-				END 
-			FROM next_available_messages
-			WHERE wq.id = next_available_messages.id
-			RETURNING wq.id, wq.payload, COALESCE(wq.attempt_count, 0)::int`,
-			WorkQueueTable, processor.maxWorkers, WorkQueueTable),
-			processor.channel, processor.maxDuration.String())
-
+		// PHASE 2: Get messages to process
+		messages, err := l.claimMessages(dbCtx, processor)
+		dbCancel()
 		if err != nil {
-			logger.Error(fmt.Errorf("failed to query messages: %w", err))
-			fetchConn.Close(dbCtx)
-			dbCancel()
+			logger.Error(fmt.Errorf("failed to query messages: %w", err), zap.Int64("consecutiveErrors", processor.consecutiveErrors.Add(1)))
 			return
 		}
 
-		// Count how many messages we're about to process
-		messages := make([]struct {
-			id           string
-			payload      []byte
-			attemptCount int
-		}, 0)
-
-		for rows.Next() {
-			var msg struct {
-				id           string
-				payload      []byte
-				attemptCount int
-			}
-			if err := rows.Scan(&msg.id, &msg.payload, &msg.attemptCount); err != nil {
-				logger.Error(fmt.Errorf("failed to scan message: %w", err))
-				continue
-			}
-			messages = append(messages, msg)
-		}
-		rows.Close()
-		
-		// Close the fetch connection as soon as we're done with it
-		fetchConn.Close(dbCtx)
-		dbCancel()
-
 		if len(messages) > 0 {
 			logger.Info("processing messages",
 				zap.Int("count", len(messages)),
@@ -506,7 +535,7 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 			// Wait for worker slot
 			processor.workerPool <- struct{}{}
 
-			go func(messageID string, messagePayload []byte) {
+			go func(messageID string, messagePayload []byte, claimedAt time.Time) {
 				defer func() { <-processor.workerPool }()
 
 				startTime := time.Now()
@@ -535,27 +564,35 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 					}()
 				}
 
-				// Process message
+				// Process message, holding the claim for as long as it takes
+				releaseClaim := l.holdClaim(ctx, processor, messageID, claimedAt)
 				handlerErr := processor.handler(notification)
+				releaseClaim()
 
 				// Create a new context with timeout for database operations
 				updateCtx, updateCancel := context.WithTimeout(ctx, 10*time.Second)
 				
-				// Use a new pooled connection for updating the message status
-				updateConn, connErr := pgx.Connect(updateCtx, l.pgURI)
-				if connErr != nil {
-					logger.Error(fmt.Errorf("failed to connect to database for message update: %w", connErr))
-					updateCancel()
-					return
-				}
-				
 				var dbErr error
 				
-				if handlerErr != nil {
+				var retry retryLater
+				if handlerErr != nil && errors.As(handlerErr, &retry) {
+					// Hold the message until it can be retried, claiming it then counts the attempt
+					_, dbErr = l.pool.Exec(updateCtx, fmt.Sprintf(`
+						UPDATE %s
+						SET processing_started_at = NOW(),
+							claimed_until = NOW() + $3::interval,
+							last_error = $2
+						WHERE id = $1`, WorkQueueTable),
+						messageID, handlerErr.Error(), retry.RetryAfter().String())
+					if dbErr != nil {
+						logger.Error(fmt.Errorf("failed to hold message %s for retry: %w", messageID, dbErr))
+					}
+				} else if handlerErr != nil {
 					// If processing failed, mark it as available for retry
-					_, dbErr = updateConn.Exec(updateCtx, fmt.Sprintf(`
+					_, dbErr = l.pool.Exec(updateCtx, fmt.Sprintf(`
 						UPDATE %s
 						SET processing_started_at = NULL,
+							claimed_until = NULL,
 							last_error = $2,
 							attempt_count = attempt_count + 1
 						WHERE id = $1`, WorkQueueTable),
@@ -565,7 +602,7 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 					}
 				} else {
 					// Mark as completed
-					_, dbErr = updateConn.Exec(updateCtx, fmt.Sprintf(`
+					_, dbErr = l.pool.Exec(updateCtx, fmt.Sprintf(`
 						UPDATE %s
 						SET completed_at = NOW()
 						WHERE id = $1`, WorkQueueTable), messageID)
@@ -573,14 +610,25 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 						logger.Error(fmt.Errorf("failed to mark message %s as completed: %w", messageID, dbErr))
 					}
 				}
-				
-				// Always clean up the database connection
-				updateConn.Close(updateCtx)
+
 				updateCancel()
+
+				// the next message of this message's fairness key could only be claimed once
+				// this one was done, claim it now instead of waiting for the next poll
+				if processor.fairnessKey != "" && processor.processing.CompareAndSwap(false, true) {
+					go l.processQueue(ctx, processor)
+				}
 				
+				if (handlerErr != nil && !errors.As(handlerErr, &retry)) || dbErr != nil {
+					processor.consecutiveErrors.Add(1)
+				}
 				if handlerErr != nil || dbErr != nil {
 					return
 				}
+				processor.consecutiveErrors.Store(0)
+
+				processedAt := time.Now()
+				processor.lastProcessedAt.Store(&processedAt)
 
 				// Log successful completion with duration
 				logger.Info("message processed",
@@ -588,7 +636,7 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 					zap.String("channel", processor.channel),
 					zap.Duration("duration", time.Since(startTime)))
 
-			}(msg.id, msg.payload)
+			}(msg.id, msg.payload, msg.claimedAt)
 		}
 
 		// If no messages found, stop processing until next notification
@@ -598,6 +646,167 @@ func (l *Listener) processQueue(ctx context.Context, processor *queueProcessor)
 	}
 }
 
+// channelBackoff is how long a channel waits before polling after count errors in a row
+func channelBackoff(count int64) time.Duration {
+	if count <= 0 {
+		return 0
+	}
+	backoff := channelErrorBackoff
+	for i := int64(1); i < count && backoff < maxChannelErrorBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxChannelErrorBackoff)
+}
+
+type queueMessage struct {
+	id           string
+	payload      []byte
+	attemptCount int
+	// claimedAt identifies this claim of the message, it changes when the message is claimed again
+	claimedAt time.Time
+}
+
+// claimMessages locks and returns up to maxWorkers available messages for the processor's channel.
+// Messages are claimed in priority order, then oldest first. Priority isn't compared across
+// channels, a high priority message only goes ahead of the lower ones of its own channel. Messages
+// without a priority use the channel default, and messages that have waited longer than starvationThreshold are boosted.
+// Channels with a fairness key are claimed round-robin instead, see SetFairnessKey. A claim lasts
+// maxDuration and is held for longer while its message is processed, see holdClaim, so only the
+// messages of workers that died are claimed again.
+func (l *Listener) claimMessages(ctx context.Context, processor *queueProcessor) ([]queueMessage, error) {
+	query, args := claimMessagesQuery(processor)
+	rows, err := l.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []queueMessage{}
+	for rows.Next() {
+		var msg queueMessage
+		if err := rows.Scan(&msg.id, &msg.payload, &msg.attemptCount, &msg.claimedAt); err != nil {
+			logger.Error(fmt.Errorf("failed to scan message: %w", err))
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// fairnessWindow is how far back completed messages count when finding the fairness key that was
+// served longest ago, keys without a message completed in the window are served first
+const fairnessWindow = 24 * time.Hour
+
+// claimMessagesQuery returns the query that claims the next messages of a processor, and its arguments
+func claimMessagesQuery(processor *queueProcessor) (string, []any) {
+	if processor.fairnessKey != "" {
+		return fairClaimMessagesQuery(processor)
+	}
+
+	// This SQL's logic has been fixed to NOT increment attempt_count for new messages
+	return fmt.Sprintf(`
+		WITH next_available_messages AS (
+			SELECT id,
+				COALESCE(priority, $3) +
+					CASE WHEN created_at < NOW() - $4::interval THEN $5 ELSE 0 END AS effective_priority
+			FROM %s
+			WHERE completed_at IS NULL
+			AND channel = $1
+			AND (
+				processing_started_at IS NULL
+				OR COALESCE(claimed_until, processing_started_at + $2::interval) < NOW()
+			)
+			ORDER BY effective_priority DESC, created_at ASC
+			LIMIT %d
+			FOR UPDATE SKIP LOCKED
+		),
+		claimed AS (
+			UPDATE %s AS wq
+			SET processing_started_at = NOW(),
+				claimed_until = NOW() + $2::interval,
+				-- Only increment for timed out messages, not for new ones
+				attempt_count = CASE
+					WHEN wq.processing_started_at IS NOT NULL THEN COALESCE(wq.attempt_count, 0) + 1
+					ELSE 0
+				END
+			FROM next_available_messages
+			WHERE wq.id = next_available_messages.id
+			RETURNING wq.id, wq.payload, COALESCE(wq.attempt_count, 0)::int AS attempt_count,
+				wq.processing_started_at, next_available_messages.effective_priority, wq.created_at
+		)
+		SELECT id, payload, attempt_count, processing_started_at FROM claimed
+		ORDER BY effective_priority DESC, created_at ASC`,
+			WorkQueueTable, processor.maxWorkers, WorkQueueTable),
+		[]any{processor.channel, processor.maxDuration.String(), processor.defaultPriority, starvationThreshold.String(), starvationBoost}
+}
+
+// fairClaimMessagesQuery claims the oldest available message of each fairness key that has nothing
+// in flight, taking first the keys whose last message completed longest ago. Starvation boosts
+// aren't needed, every key is served in turn. Messages are locked after they're picked since FOR
+// UPDATE can't be used with DISTINCT ON or window functions.
+func fairClaimMessagesQuery(processor *queueProcessor) (string, []any) {
+	return fmt.Sprintf(`
+		WITH in_flight AS (
+			SELECT DISTINCT COALESCE(payload->>$4, '') AS fairness_key
+			FROM %[1]s
+			WHERE completed_at IS NULL
+			AND channel = $1
+			AND COALESCE(claimed_until, processing_started_at + $2::interval) >= NOW()
+		),
+		last_completed AS (
+			SELECT COALESCE(payload->>$4, '') AS fairness_key, MAX(completed_at) AS completed_at
+			FROM %[1]s
+			WHERE channel = $1
+			AND completed_at > NOW() - $5::interval
+			GROUP BY 1
+		),
+		oldest_per_key AS (
+			SELECT DISTINCT ON (COALESCE(payload->>$4, '')) id, COALESCE(payload->>$4, '') AS fairness_key,
+				COALESCE(priority, $3) AS effective_priority, created_at
+			FROM %[1]s
+			WHERE completed_at IS NULL
+			AND channel = $1
+			AND (
+				processing_started_at IS NULL
+				OR COALESCE(claimed_until, processing_started_at + $2::interval) < NOW()
+			)
+			AND COALESCE(payload->>$4, '') NOT IN (SELECT fairness_key FROM in_flight)
+			ORDER BY COALESCE(payload->>$4, ''), COALESCE(priority, $3) DESC, created_at ASC
+		),
+		next_keys AS (
+			SELECT oldest_per_key.id,
+				ROW_NUMBER() OVER (ORDER BY last_completed.completed_at ASC NULLS FIRST,
+					oldest_per_key.effective_priority DESC, oldest_per_key.created_at ASC) AS claim_order
+			FROM oldest_per_key
+			LEFT JOIN last_completed ON last_completed.fairness_key = oldest_per_key.fairness_key
+			ORDER BY claim_order
+			LIMIT %[2]d
+		),
+		next_available_messages AS (
+			SELECT wq.id, next_keys.claim_order
+			FROM %[1]s wq
+			JOIN next_keys ON next_keys.id = wq.id
+			FOR UPDATE OF wq SKIP LOCKED
+		),
+		claimed AS (
+			UPDATE %[1]s AS wq
+			SET processing_started_at = NOW(),
+				claimed_until = NOW() + $2::interval,
+				attempt_count = CASE
+					WHEN wq.processing_started_at IS NOT NULL THEN COALESCE(wq.attempt_count, 0) + 1
+					ELSE 0
+				END
+			FROM next_available_messages
+			WHERE wq.id = next_available_messages.id
+			RETURNING wq.id, wq.payload, COALESCE(wq.attempt_count, 0)::int AS attempt_count,
+				wq.processing_started_at, next_available_messages.claim_order
+		)
+		SELECT id, payload, attempt_count, processing_started_at FROM claimed
+		ORDER BY claim_order`, WorkQueueTable, processor.maxWorkers),
+		[]any{processor.channel, processor.maxDuration.String(), processor.defaultPriority, processor.fairnessKey, fairnessWindow.String()}
+}
+
 // getQueueLock returns the lock channel for a queue and lockKey, creating it if it doesn't exist
 func (l *Listener) getQueueLock(queueName, lockKey string) chan struct{} {
 	l.mu.Lock()
@@ -627,9 +836,11 @@ func (l *Listener) reconnect(ctx context.Context) error {
 
 	// Log reconnection attempt
 	logger.Info("Database connection lost, attempting to reconnect...")
+	l.health.setSubscribed(false)
 
 	for maxAttempts == 0 || attempt < maxAttempts {
 		attempt++
+		l.health.setReconnectAttempts(attempt)
 
 		// Close the old connection if it exists
 		if l.conn != nil {
@@ -726,11 +937,12 @@ func (l *Listener) reconnect(ctx context.Context) error {
 				}
 
 				logger.Info("Successfully reconnected and resubscribed to all channels")
+				l.health.setReconnectAttempts(0)
+				l.health.setSubscribed(true)
 
 				// Immediately check for any pending work in queues
 				for _, processor := range l.processors {
-					if !processor.processing {
-						processor.processing = true
+					if processor.processing.CompareAndSwap(false, true) {
 						go l.processQueue(ctx, processor)
 					}
 				}
@@ -771,8 +983,34 @@ func (l *Listener) reconnect(ctx context.Context) error {
 
 // Stop gracefully shuts down the listener
 func (l *Listener) Stop(ctx context.Context) error {
+	if l.pool != nil {
+		l.pool.Close()
+		l.pool = nil
+	}
 	if l.conn != nil {
 		return l.conn.Close(ctx)
 	}
 	return nil
+}
+
+// newQueuePool creates the connection pool used for queue claim and update operations
+func newQueuePool(ctx context.Context, pgURI string, maxConns int32) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(pgURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres uri: %w", err)
+	}
+
+	if maxConns > 0 {
+		poolConfig.MaxConns = maxConns
+	}
+	poolConfig.MaxConnLifetime = 30 * time.Minute
+	poolConfig.MaxConnIdleTime = 5 * time.Minute
+	poolConfig.HealthCheckPeriod = 1 * time.Minute
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pool: %w", err)
+	}
+
+	return pool, nil
 }
\ No newline at end of file
@@ -0,0 +1,300 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPGURI returns the database used for listener integration tests, skipping the test if
+// CHARTSMITH_TEST_PG_URI isn't set
+func testPGURI(t *testing.T) string {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping listener integration test")
+	}
+
+	os.Setenv("CHARTSMITH_PG_URI", connStr)
+	require.NoError(t, param.Init(nil))
+
+	return connStr
+}
+
+// TestListenerConnectionUsage processes 100 queued messages through a listener
+// with a small queue pool and verifies the number of client connections stays bounded.
+// It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestListenerConnectionUsage(t *testing.T) {
+	connStr := testPGURI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	// a single connection used by the test to seed and observe the database
+	observer, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer observer.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, observer))
+
+	channel := fmt.Sprintf("stress_test_%d", time.Now().UnixNano())
+	defer observer.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+
+	countConnections := func() int {
+		var connections int
+		err := observer.QueryRow(ctx, `
+			SELECT COUNT(*) FROM pg_stat_activity
+			WHERE datname = current_database()
+			AND backend_type = 'client backend'
+			AND pid <> pg_backend_pid()`).Scan(&connections)
+		require.NoError(t, err)
+		return connections
+	}
+	baseline := countConnections()
+
+	const messageCount = 100
+	for i := 0; i < messageCount; i++ {
+		_, err := observer.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1, $2, $3, NOW())`,
+			fmt.Sprintf("%s-%d", channel, i), channel, fmt.Sprintf(`{"n": %d}`, i))
+		require.NoError(t, err)
+	}
+
+	var processed int64
+	l := NewListener()
+	l.poolMaxConns = 3
+	err = l.AddHandler(ctx, channel, 10, time.Minute, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt64(&processed, 1)
+		return nil
+	}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, l.Start(ctx))
+	defer l.Stop(context.Background())
+
+	maxConnections := 0
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		connections := countConnections() - baseline
+		if connections > maxConnections {
+			maxConnections = connections
+		}
+
+		var remaining int
+		err := observer.QueryRow(ctx, `SELECT COUNT(*) FROM work_queue WHERE channel = $1 AND completed_at IS NULL`, channel).Scan(&remaining)
+		require.NoError(t, err)
+		if remaining == 0 {
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	assert.Equal(t, int64(messageCount), atomic.LoadInt64(&processed))
+
+	// the queue pool plus the dedicated LISTEN connection
+	assert.LessOrEqual(t, maxConnections, int(l.poolMaxConns)+1)
+}
+
+func TestClaimMessagesPriorityOrder(t *testing.T) {
+	connStr := testPGURI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	channel := fmt.Sprintf("priority_test_%d", time.Now().UnixNano())
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+
+	high := persistence.WorkPriorityHigh
+	low := persistence.WorkPriorityLow
+	now := time.Now()
+
+	messages := []struct {
+		id        string
+		priority  *int
+		createdAt time.Time
+	}{
+		{id: "default-new", priority: nil, createdAt: now.Add(-1 * time.Second)},
+		{id: "high-new", priority: &high, createdAt: now.Add(-2 * time.Second)},
+		{id: "low-new", priority: &low, createdAt: now.Add(-3 * time.Second)},
+		{id: "high-older", priority: &high, createdAt: now.Add(-4 * time.Second)},
+		{id: "low-starved", priority: &low, createdAt: now.Add(-2 * starvationThreshold)},
+	}
+	for _, msg := range messages {
+		_, err := conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at, priority) VALUES ($1, $2, '{}', $3, $4)`,
+			fmt.Sprintf("%s-%s", channel, msg.id), channel, msg.createdAt, msg.priority)
+		require.NoError(t, err)
+	}
+
+	l := NewListener()
+	l.pool, err = newQueuePool(ctx, connStr, 2)
+	require.NoError(t, err)
+	defer l.pool.Close()
+
+	processor := &queueProcessor{
+		channel:         channel,
+		defaultPriority: persistence.WorkPriorityNormal,
+		maxWorkers:      1,
+		maxDuration:     time.Minute,
+	}
+
+	claimed := []string{}
+	for i := 0; i < len(messages); i++ {
+		batch, err := l.claimMessages(ctx, processor)
+		require.NoError(t, err)
+		require.Len(t, batch, 1)
+		claimed = append(claimed, batch[0].id)
+	}
+
+	expected := []string{"low-starved", "high-older", "high-new", "default-new", "low-new"}
+	for i := range expected {
+		expected[i] = fmt.Sprintf("%s-%s", channel, expected[i])
+	}
+	assert.Equal(t, expected, claimed)
+
+	batch, err := l.claimMessages(ctx, processor)
+	require.NoError(t, err)
+	assert.Empty(t, batch)
+}
+
+func TestRunPeriodicTask(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runs atomic.Int32
+	l := &Listener{}
+	done := make(chan struct{})
+	go func() {
+		l.runPeriodicTask(ctx, periodicTask{
+			name:     "test",
+			interval: 10 * time.Millisecond,
+			task: func(ctx context.Context) error {
+				// errors are logged and the task keeps running
+				if runs.Add(1) == 1 {
+					return fmt.Errorf("first run fails")
+				}
+				return nil
+			},
+		})
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("periodic task did not stop when the context was canceled")
+	}
+}
+
+// TestClaimMessagesFairness queues six messages for one workspace and two for another, and checks
+// that the workspaces take turns and never have two messages in flight
+func TestClaimMessagesFairness(t *testing.T) {
+	connStr := testPGURI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	channel := fmt.Sprintf("fairness_test_%d", time.Now().UnixNano())
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+
+	// the busy workspace queued its batch before the other workspace sent anything
+	now := time.Now()
+	for i := 1; i <= 6; i++ {
+		_, err := conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1, $2, $3, $4)`,
+			fmt.Sprintf("%s-busy-%d", channel, i), channel, `{"workspaceId": "busy"}`, now.Add(time.Duration(i-20)*time.Second))
+		require.NoError(t, err)
+	}
+	for i := 1; i <= 2; i++ {
+		_, err := conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1, $2, $3, $4)`,
+			fmt.Sprintf("%s-quiet-%d", channel, i), channel, `{"workspaceId": "quiet"}`, now.Add(time.Duration(i-10)*time.Second))
+		require.NoError(t, err)
+	}
+
+	l := NewListener()
+	l.pool, err = newQueuePool(ctx, connStr, 2)
+	require.NoError(t, err)
+	defer l.pool.Close()
+
+	processor := &queueProcessor{
+		channel:         channel,
+		defaultPriority: persistence.WorkPriorityHigh,
+		maxWorkers:      5,
+		maxDuration:     time.Minute,
+		fairnessKey:     "workspaceId",
+	}
+
+	claimedIDs := func(batch []queueMessage) []string {
+		ids := []string{}
+		for _, msg := range batch {
+			ids = append(ids, strings.TrimPrefix(msg.id, channel+"-"))
+		}
+		return ids
+	}
+
+	// with five workers, each workspace still only gets one message in flight
+	batch, err := l.claimMessages(ctx, processor)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"busy-1", "quiet-1"}, claimedIDs(batch))
+
+	batch, err = l.claimMessages(ctx, processor)
+	require.NoError(t, err)
+	assert.Empty(t, batch)
+
+	_, err = conn.Exec(ctx, `UPDATE work_queue SET processing_started_at = NULL WHERE channel = $1`, channel)
+	require.NoError(t, err)
+
+	// one worker, completing each message before claiming the next
+	processor.maxWorkers = 1
+	order := []string{}
+	for {
+		batch, err := l.claimMessages(ctx, processor)
+		require.NoError(t, err)
+		if len(batch) == 0 {
+			break
+		}
+		require.Len(t, batch, 1)
+		order = append(order, claimedIDs(batch)...)
+
+		_, err = conn.Exec(ctx, `UPDATE work_queue SET completed_at = clock_timestamp() WHERE id = $1`, batch[0].id)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"busy-1", "quiet-1", "busy-2", "quiet-2", "busy-3", "busy-4", "busy-5", "busy-6"}, order)
+}
+
+func TestChannelBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), channelBackoff(0))
+	assert.Equal(t, time.Second, channelBackoff(1))
+	assert.Equal(t, 2*time.Second, channelBackoff(2))
+	assert.Equal(t, 16*time.Second, channelBackoff(5))
+	assert.Equal(t, maxChannelErrorBackoff, channelBackoff(6))
+	assert.Equal(t, maxChannelErrorBackoff, channelBackoff(100))
+}
@@ -28,6 +28,7 @@ func handleConversionNextFileNotification(ctx context.Context, payload string) e
 	if err := json.Unmarshal([]byte(payload), &p); err != nil {
 		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: p.WorkspaceID})
 
 	w, err := workspace.GetWorkspace(ctx, p.WorkspaceID)
 	if err != nil {
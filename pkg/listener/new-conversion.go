@@ -80,6 +80,13 @@ func handleNewConversionNotification(ctx context.Context, payload string) error
 		return fmt.Errorf("failed to send conversation status event: %w", err)
 	}
 
+	// a kustomize project is built into the manifests that are converted
+	if c.SourceType == workspacetypes.ConversionSourceTypeKustomize {
+		if err := prepareKustomizeConversion(ctx, c); err != nil {
+			return fmt.Errorf("failed to prepare kustomize conversion: %w", err)
+		}
+	}
+
 	// we need to inject a values.yaml and a Chart.yaml into the conversion
 	// other files that might be injected happen in the final stage, but these
 	// are needed
@@ -96,6 +103,19 @@ func handleNewConversionNotification(ctx context.Context, payload string) error
 		return nil
 	}
 
+	// the files are sent to an LLM to be converted, so their secrets are recorded before they are
+	secretFindings := []workspacetypes.SecretFinding{}
+	for _, file := range conversionFiles {
+		findings, err := workspace.RecordSecretFindings(ctx, c.WorkspaceID, file.FilePath, file.FileContent)
+		if err != nil {
+			return fmt.Errorf("failed to record secret findings: %w", err)
+		}
+		secretFindings = append(secretFindings, findings...)
+	}
+	if err := sendSecretFindingsEvent(ctx, realtimeRecipient, c.WorkspaceID, secretFindings); err != nil {
+		logger.Warn("Failed to send secret findings", zap.String("workspaceID", c.WorkspaceID), zap.Error(err))
+	}
+
 	if err := persistence.EnqueueWork(ctx, "conversion_next_file", map[string]interface{}{
 		"workspaceId":  c.WorkspaceID,
 		"conversionId": c.ID,
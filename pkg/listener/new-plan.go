@@ -11,10 +11,16 @@ import (
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/realtime"
 	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/slack"
 	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
 )
 
+// listChatAttachments is a var so that the files given to the planner can be tested without a
+// database
+var listChatAttachments = workspace.ListChatMessageAttachments
+
 type newPlanPayload struct {
 	PlanID          string                `json:"planId"`
 	AdditionalFiles []workspacetypes.File `json:"additionalFiles,omitempty"`
@@ -35,6 +41,8 @@ func handleNewPlanNotification(ctx context.Context, payload string) error {
 	if err != nil {
 		return fmt.Errorf("error getting plan: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: plan.WorkspaceID, PlanID: plan.ID})
+	ctx = logger.WithFields(ctx, zap.String("workspaceID", plan.WorkspaceID), zap.String("planID", plan.ID))
 
 	w, err := workspace.GetWorkspace(ctx, plan.WorkspaceID)
 	if err != nil {
@@ -56,18 +64,34 @@ func handleNewPlanNotification(ctx context.Context, payload string) error {
 
 	plan.Status = workspacetypes.PlanStatusPlanning
 
+	additionalFiles, err := planAdditionalFiles(ctx, plan, p.AdditionalFiles)
+	if err != nil {
+		return fmt.Errorf("error getting additional files: %w", err)
+	}
+
+	// the plan stops streaming when this returns before it's done
+	llmCtx, cancelLLM := context.WithCancel(ctx)
+	defer cancelLLM()
+
 	streamCh := make(chan string, 1)
 	doneCh := make(chan error, 1)
 	go func() {
+		var err error
 		if w.CurrentRevision == 0 {
-			if err := createInitialPlan(ctx, streamCh, doneCh, w, plan, p.AdditionalFiles); err != nil {
+			if err = createInitialPlan(llmCtx, streamCh, doneCh, w, plan, additionalFiles); err != nil {
 				fmt.Printf("Failed to create initial plan: %v\n", err)
-				doneCh <- fmt.Errorf("error creating initial plan: %w", err)
+				err = fmt.Errorf("error creating initial plan: %w", err)
 			}
 		} else {
-			if err := createUpdatePlan(ctx, streamCh, doneCh, w, plan, p.AdditionalFiles); err != nil {
+			if err = createUpdatePlan(llmCtx, streamCh, doneCh, w, plan, additionalFiles); err != nil {
 				fmt.Printf("Failed to create update plan: %v\n", err)
-				doneCh <- fmt.Errorf("error creating update plan: %w", err)
+				err = fmt.Errorf("error creating update plan: %w", err)
+			}
+		}
+		if err != nil {
+			select {
+			case doneCh <- err:
+			case <-llmCtx.Done():
 			}
 		}
 	}()
@@ -95,8 +119,13 @@ func handleNewPlanNotification(ctx context.Context, payload string) error {
 			if err := workspace.AppendPlanDescription(ctx, plan.ID, stream); err != nil {
 				return fmt.Errorf("error appending plan description: %w", err)
 			}
+		case <-ctx.Done():
+			return fmt.Errorf("plan wasn't finished: %w", ctx.Err())
 		case err := <-doneCh:
 			if err != nil {
+				if notifyErr := slack.NotifyPlanFailed(ctx, w.ID, plan.ID, err); notifyErr != nil {
+					logger.ErrorCtx(ctx, fmt.Errorf("failed to notify slack of plan failure: %w", notifyErr))
+				}
 				return fmt.Errorf("error creating initial plan: %w", err)
 			}
 
@@ -123,15 +152,34 @@ func handleNewPlanNotification(ctx context.Context, payload string) error {
 	return nil
 }
 
+// planAdditionalFiles returns the files uploaded with the plan's payload followed by the files
+// attached to the chat messages the plan is for
+func planAdditionalFiles(ctx context.Context, plan *workspacetypes.Plan, uploaded []workspacetypes.File) ([]workspacetypes.File, error) {
+	attachments, err := listChatAttachments(ctx, plan.ChatMessageIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat message attachments: %w", err)
+	}
+
+	files := append([]workspacetypes.File{}, uploaded...)
+	return append(files, llm.AttachmentFiles(attachments)...), nil
+}
+
 func createInitialPlan(ctx context.Context, streamCh chan string, doneCh chan error, w *workspacetypes.Workspace, plan *workspacetypes.Plan, additionalFiles []workspacetypes.File) error {
 	chatMessages, err := workspace.ListChatMessagesForWorkspace(ctx, w.ID)
 	if err != nil {
 		return fmt.Errorf("error listing chat messages after plan: %w", err)
 	}
 
+	conversation, err := llm.CondenseConversation(ctx, w.ID, chatMessages)
+	if err != nil {
+		return fmt.Errorf("error condensing conversation: %w", err)
+	}
+
 	opts := llm.CreateInitialPlanOpts{
-		ChatMessages:    chatMessages,
-		AdditionalFiles: additionalFiles,
+		ChatMessages:        conversation.Messages,
+		ConversationSummary: conversation.Summary,
+		AdditionalFiles:     additionalFiles,
+		BootstrapTemplate:   w.BootstrapTemplate,
 	}
 	if err := llm.CreateInitialPlan(ctx, streamCh, doneCh, opts); err != nil {
 		return fmt.Errorf("error creating initial plan: %w", err)
@@ -192,11 +240,26 @@ func createUpdatePlan(ctx context.Context, streamCh chan string, doneCh chan err
 		}
 	}
 
+	conversation, err := llm.CondenseConversation(ctx, w.ID, chatMessages)
+	if err != nil {
+		return fmt.Errorf("error condensing conversation: %w", err)
+	}
+
+	// a plan that can't see the recent changes is still better than no plan
+	recentChanges, err := workspace.DiffFilesWithParentRevision(ctx, w, finalRelevantFiles)
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to diff files with the parent revision", zap.Error(err))
+	}
+
 	opts := llm.CreatePlanOpts{
-		ChatMessages:  chatMessages,
-		Chart:         &w.Charts[0],
-		RelevantFiles: finalRelevantFiles,
-		IsUpdate:      true,
+		ChatMessages:        conversation.Messages,
+		ConversationSummary: conversation.Summary,
+		Workspace:           w,
+		Chart:               &w.Charts[0],
+		RelevantFiles:       finalRelevantFiles,
+		IsUpdate:            true,
+		RecentChanges:       recentChanges,
+		AdditionalFiles:     additionalFiles,
 	}
 
 	if err := llm.CreatePlan(ctx, streamCh, doneCh, opts); err != nil {
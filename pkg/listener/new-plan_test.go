@@ -0,0 +1,40 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanAdditionalFiles(t *testing.T) {
+	original := listChatAttachments
+	t.Cleanup(func() { listChatAttachments = original })
+
+	listChatAttachments = func(ctx context.Context, messageIDs ...string) ([]workspacetypes.ChatAttachment, error) {
+		assert.Equal(t, []string{"first", "second"}, messageIDs)
+		return []workspacetypes.ChatAttachment{
+			{MessageID: "second", Filename: "deployment.yaml", Content: "kind: Deployment\n"},
+		}, nil
+	}
+
+	plan := &workspacetypes.Plan{ID: "plan", ChatMessageIDs: []string{"first", "second"}}
+	uploaded := []workspacetypes.File{{FilePath: "Chart.yaml", Content: "name: app\n"}}
+
+	files, err := planAdditionalFiles(context.Background(), plan, uploaded)
+	require.NoError(t, err)
+	assert.Equal(t, []workspacetypes.File{
+		{FilePath: "Chart.yaml", Content: "name: app\n"},
+		{FilePath: "deployment.yaml", Content: "kind: Deployment\n"},
+	}, files)
+	assert.Len(t, uploaded, 1)
+
+	listChatAttachments = func(ctx context.Context, messageIDs ...string) ([]workspacetypes.ChatAttachment, error) {
+		return nil, errors.New("connection refused")
+	}
+	_, err = planAdditionalFiles(context.Background(), plan, uploaded)
+	assert.ErrorContains(t, err, "connection refused")
+}
@@ -19,6 +19,9 @@ import (
 type newIntentPayload struct {
 	ChatMessageID string `json:"chatMessageId"`
 	WorkspaceID   string `json:"workspaceId"`
+	// ForcePlan skips classifying the intent of messages that always ask for a plan, such as one
+	// asking for the errors of a render to be fixed
+	ForcePlan bool `json:"forcePlan,omitempty"`
 }
 
 func handleNewIntentNotification(ctx context.Context, payload string) error {
@@ -33,6 +36,8 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get chat message: %w", err)
 	}
+	ctx = llm.WithUsageAttribution(ctx, llm.UsageAttribution{WorkspaceID: chatMessage.WorkspaceID, ChatMessageID: chatMessage.ID})
+	ctx = logger.WithFields(ctx, zap.String("workspaceID", chatMessage.WorkspaceID), zap.String("chatMessageID", chatMessage.ID))
 
 	logger.Debug("chat message", zap.Any("chatMessage", chatMessage))
 	w, err := workspace.GetWorkspace(ctx, chatMessage.WorkspaceID)
@@ -49,9 +54,17 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 		isInitialPrompt = false
 	}
 
-	intent, err := llm.GetChatMessageIntent(ctx, chatMessage.Prompt, isInitialPrompt, chatMessage.MessageFromPersona)
+	attachments, err := listChatAttachments(ctx, chatMessage.ID)
 	if err != nil {
-		return fmt.Errorf("failed to get conversational and plan intent: %w", err)
+		return fmt.Errorf("failed to list chat message attachments: %w", err)
+	}
+
+	intent := &workspacetypes.Intent{IsPlan: true, IsChartDeveloper: true}
+	if !p.ForcePlan {
+		intent, err = llm.GetChatMessageIntent(ctx, llm.PromptWithAttachments(chatMessage.Prompt, attachments), isInitialPrompt, chatMessage.MessageFromPersona)
+		if err != nil {
+			return fmt.Errorf("failed to get conversational and plan intent: %w", err)
+		}
 	}
 
 	if err := workspace.UpdateChatMessageIntent(ctx, chatMessage.ID, intent); err != nil {
@@ -92,14 +105,20 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 		zap.Bool("is_render", intent.IsRender),
 	)
 
+	// the feedback streamed below stops when this returns before it's done
+	llmCtx, cancelLLM := context.WithCancel(ctx)
+	defer cancelLLM()
+
 	// if it's not possible to answer the question using the personal requested, we have an error
 	if chatMessage.MessageFromPersona != nil {
 		fmt.Printf("chatMessage.MessageFromPersona: %v\n", *chatMessage.MessageFromPersona)
+
 		if *chatMessage.MessageFromPersona == workspacetypes.ChatMessageFromPersonaDeveloper && !intent.IsChartDeveloper {
+			feedbackOpts := personaFeedbackOpts(ctx, w, chatMessage)
 			streamCh := make(chan string)
 			doneCh := make(chan error)
 			go func() {
-				if err := llm.FeedbackOnNotDeveloperIntentWhenRequested(ctx, streamCh, doneCh, chatMessage); err != nil {
+				if err := llm.FeedbackOnNotDeveloperIntentWhenRequested(llmCtx, streamCh, doneCh, feedbackOpts); err != nil {
 					fmt.Printf("Failed to get feedback on not developer intent when requested: %v\n", err)
 				}
 			}()
@@ -127,6 +146,8 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 					if err := workspace.SetChatMessageResponse(ctx, chatMessage.ID, cleanedResponse); err != nil {
 						return fmt.Errorf("failed to write chat message response to database: %w", err)
 					}
+				case <-ctx.Done():
+					return fmt.Errorf("feedback wasn't finished: %w", ctx.Err())
 				case err := <-doneCh:
 					if err != nil {
 						fmt.Printf("Failed to get feedback on ambiguous intent: %v\n", err)
@@ -139,10 +160,11 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 		}
 
 		if *chatMessage.MessageFromPersona == workspacetypes.ChatMessageFromPersonaOperator && !intent.IsChartOperator {
+			feedbackOpts := personaFeedbackOpts(ctx, w, chatMessage)
 			streamCh := make(chan string)
 			doneCh := make(chan error)
 			go func() {
-				if err := llm.FeedbackOnNotOperatorIntentWhenRequested(ctx, streamCh, doneCh, chatMessage); err != nil {
+				if err := llm.FeedbackOnNotOperatorIntentWhenRequested(llmCtx, streamCh, doneCh, feedbackOpts); err != nil {
 					fmt.Printf("Failed to get feedback on not operator intent when requested: %v\n", err)
 				}
 			}()
@@ -170,6 +192,8 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 					if err := workspace.SetChatMessageResponse(ctx, chatMessage.ID, cleanedResponse); err != nil {
 						return fmt.Errorf("failed to write chat message response to database: %w", err)
 					}
+				case <-ctx.Done():
+					return fmt.Errorf("feedback wasn't finished: %w", ctx.Err())
 				case err := <-doneCh:
 					if err != nil {
 						fmt.Printf("Failed to get feedback on ambiguous intent: %v\n", err)
@@ -187,7 +211,7 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 		streamCh := make(chan string)
 		doneCh := make(chan error)
 		go func() {
-			if err := llm.FeedbackOnAmbiguousIntent(ctx, streamCh, doneCh, chatMessage); err != nil {
+			if err := llm.FeedbackOnAmbiguousIntent(llmCtx, streamCh, doneCh, llm.FeedbackOpts{ChatMessage: chatMessage, Workspace: w}); err != nil {
 				fmt.Printf("Failed to get feedback on ambiguous intent: %v\n", err)
 			}
 		}()
@@ -215,6 +239,8 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 				if err := workspace.SetChatMessageResponse(ctx, chatMessage.ID, cleanedResponse); err != nil {
 					return fmt.Errorf("failed to write chat message response to database: %w", err)
 				}
+			case <-ctx.Done():
+				return fmt.Errorf("feedback wasn't finished: %w", ctx.Err())
 			case err := <-doneCh:
 				if err != nil {
 					fmt.Printf("Failed to get feedback on ambiguous intent: %v\n", err)
@@ -227,15 +253,35 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 	// if the intent is proceed, we need to send a message to the planner
 	if intent.IsProceed && plan != nil {
 		// create a revision
-		rev, err := workspace.CreateRevision(ctx, w.ID, &plan.ID, userIDs[0])
+		revisionNumber, err := workspace.CreateRevision(ctx, w.ID, w.CurrentRevision, workspace.CreateRevisionOpts{
+			PlanID: &plan.ID,
+			UserID: userIDs[0],
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create revision: %w", err)
 		}
+		recordAudit(ctx, w.ID, workspace.AuditActorUser, workspace.AuditPlanProceeded, map[string]interface{}{
+			"planId":         plan.ID,
+			"revisionNumber": revisionNumber,
+			"chatMessageId":  chatMessage.ID,
+		})
+
+		if err := persistence.EnqueueWork(ctx, "execute_plan", map[string]interface{}{
+			"planId": plan.ID,
+		}); err != nil {
+			logger.WarnCtx(ctx, "failed to enqueue execute_plan notification", zap.Error(err))
+			// but do not exit, the revision has already been created
+		}
+
+		rev, err := workspace.GetRevision(ctx, w.ID, revisionNumber)
+		if err != nil {
+			return fmt.Errorf("failed to get revision: %w", err)
+		}
 
 		// send a realtime message about the new revision
 		e := realtimetypes.RevisionCreatedEvent{
 			WorkspaceID: w.ID,
-			Revision:    rev,
+			Revision:    *rev,
 			Workspace:   *w,
 		}
 
@@ -252,7 +298,7 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 			streamCh := make(chan string)
 			doneCh := make(chan error)
 			go func() {
-				if err := llm.DeclineOffTopicChatMessage(ctx, streamCh, doneCh, chatMessage); err != nil {
+				if err := llm.DeclineOffTopicChatMessage(llmCtx, streamCh, doneCh, llm.FeedbackOpts{ChatMessage: chatMessage, Workspace: w}); err != nil {
 					fmt.Printf("Failed to decline off-topic chat message: %v\n", err)
 				}
 			}()
@@ -280,6 +326,8 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 					if err := workspace.SetChatMessageResponse(ctx, chatMessage.ID, cleanedResponse); err != nil {
 						return fmt.Errorf("failed to write chat message response to database: %w", err)
 					}
+				case <-ctx.Done():
+					return fmt.Errorf("feedback wasn't finished: %w", ctx.Err())
 				case err := <-doneCh:
 					if err != nil {
 						fmt.Printf("Failed to decline off-topic chat message: %v\n", err)
@@ -313,10 +361,14 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 
 	// if the message suggests a plan, send a message to the planner
 	if intent.IsPlan && !intent.IsConversational {
-		_, err := workspace.CreatePlan(ctx, chatMessage.ID, w.ID, true)
+		plan, err := workspace.CreatePlan(ctx, chatMessage.ID, w.ID, true)
 		if err != nil {
 			return fmt.Errorf("failed to create plan: %w", err)
 		}
+		recordAudit(ctx, w.ID, workspace.AuditActorSystem, workspace.AuditPlanCreated, map[string]interface{}{
+			"planId":        plan.ID,
+			"chatMessageId": chatMessage.ID,
+		})
 
 		chatMessageWithPlanID, err := workspace.GetChatMessage(ctx, chatMessage.ID)
 		if err != nil {
@@ -347,3 +399,14 @@ func handleNewIntentNotification(ctx context.Context, payload string) error {
 
 	return nil
 }
+
+// personaFeedbackOpts includes the chart structure and relevant files with a persona response so
+// that the answer is specific to this chart rather than generic helm advice
+func personaFeedbackOpts(ctx context.Context, w *workspacetypes.Workspace, chatMessage *workspacetypes.Chat) llm.FeedbackOpts {
+	feedbackOpts, err := llm.NewFeedbackOpts(ctx, w, chatMessage)
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to get chart context for feedback, continuing without it", zap.Error(err))
+		return llm.FeedbackOpts{ChatMessage: chatMessage, Workspace: w}
+	}
+	return feedbackOpts
+}
@@ -3,6 +3,7 @@ package listener
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/replicatedhq/chartsmith/pkg/embedding"
@@ -36,12 +37,27 @@ func handleNewSummarizeNotification(ctx context.Context, payload string) error {
 		return nil
 	}
 
+	// embeddings are made by a model provider, a file with a secret that hasn't been acknowledged
+	// isn't embedded, like it isn't sent to the LLM
+	if err := workspace.CheckSecretsForLLM(ctx, fileRevision.WorkspaceID, []string{fileRevision.Content}); err != nil {
+		if errors.Is(err, workspace.ErrSecretsNotAcknowledged) {
+			logger.Info("Not embedding file with an unacknowledged secret", zap.String("fileID", p.FileID), zap.Int("revision", p.Revision))
+			return nil
+		}
+		return fmt.Errorf("failed to check file for secrets: %w", err)
+	}
+
+	provider, err := embedding.Configured()
+	if err != nil {
+		return fmt.Errorf("failed to get embedding provider: %w", err)
+	}
+
 	embeddings, err := embedding.Embeddings(fileRevision.Content)
 	if err != nil {
 		return fmt.Errorf("failed to get embeddings: %w", err)
 	}
 
-	err = workspace.SetFileEmbeddings(ctx, p.FileID, p.Revision, embeddings)
+	err = workspace.SetFileEmbeddings(ctx, p.FileID, p.Revision, embeddings, provider.Name(), provider.Dimensions())
 	if err != nil {
 		return fmt.Errorf("failed to set summary and embeddings: %w", err)
 	}
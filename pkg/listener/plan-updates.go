@@ -0,0 +1,170 @@
+package listener
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// planUpdateWindow is how long the changes to a plan are collected before they're sent as one
+// event. Applying a plan changes the status of each of its action files twice, sending the whole
+// plan to every user for each change was most of the realtime traffic of a plan.
+const planUpdateWindow = 500 * time.Millisecond
+
+// planUpdates collects the changes to the action files of plans while they're executed and applied
+var planUpdates = newPlanUpdateCoalescer(planUpdateWindow)
+
+// planUpdateCoalescer sends the changes to the action files of a plan as one PlanUpdatedEvent per
+// window, with only the files that changed. Events are sent with sendPlanEvent, one at a time, so a
+// plan's events are sent in the order they're made.
+type planUpdateCoalescer struct {
+	// window is how long changes are collected, changes are sent at once when it's zero
+	window time.Duration
+
+	// sendMu is held while an event is sent, pending changes are taken under it so that a flush
+	// can't pass an event sent after the changes were made
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingPlanUpdate
+}
+
+// pendingPlanUpdate is the changes to a plan that haven't been sent yet
+type pendingPlanUpdate struct {
+	ctx          context.Context
+	recipient    realtimetypes.Recipient
+	workspaceID  string
+	plan         *workspacetypes.Plan
+	changed      []actionFileKey
+	lintFindings *int
+	timer        *time.Timer
+}
+
+// actionFileKey identifies an action file of a plan
+type actionFileKey struct {
+	chartID string
+	path    string
+}
+
+func newPlanUpdateCoalescer(window time.Duration) *planUpdateCoalescer {
+	return &planUpdateCoalescer{
+		window:  window,
+		pending: map[string]*pendingPlanUpdate{},
+	}
+}
+
+// changed records a change to the action file at chartID and path of a plan, where plan is the
+// plan after the change. The changes are sent a window after the first of them, or at once when
+// the file failed, since the plan stops there. Only an immediate send returns its error, a later
+// one is logged.
+func (c *planUpdateCoalescer) changed(ctx context.Context, recipient realtimetypes.Recipient, workspaceID string, plan *workspacetypes.Plan, chartID string, path string, lintFindings *int) error {
+	key := actionFileKey{chartID: chartID, path: path}
+
+	c.mu.Lock()
+	update, ok := c.pending[plan.ID]
+	if !ok {
+		update = &pendingPlanUpdate{ctx: context.WithoutCancel(ctx), recipient: recipient, workspaceID: workspaceID}
+		c.pending[plan.ID] = update
+		if c.window > 0 {
+			planID := plan.ID
+			update.timer = time.AfterFunc(c.window, func() {
+				if err := c.flush(planID); err != nil {
+					logger.WarnCtx(update.ctx, "Failed to send plan update", zap.String("planID", planID), zap.Error(err))
+				}
+			})
+		}
+	}
+	update.plan = plan
+	update.recipient = recipient
+	if lintFindings != nil {
+		update.lintFindings = lintFindings
+	}
+	seen := false
+	for _, changed := range update.changed {
+		seen = seen || changed == key
+	}
+	if !seen {
+		update.changed = append(update.changed, key)
+	}
+	c.mu.Unlock()
+
+	if c.window > 0 && !isTerminalActionFileChange(plan, key) {
+		return nil
+	}
+	return c.flush(plan.ID)
+}
+
+// flush sends the pending changes to a plan now, if there are any
+func (c *planUpdateCoalescer) flush(planID string) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	update := c.take(planID)
+	if update == nil {
+		return nil
+	}
+
+	changes := &realtimetypes.PlanChanges{
+		PlanID:      update.plan.ID,
+		Status:      update.plan.Status,
+		ActionFiles: []workspacetypes.ActionFile{},
+	}
+	for _, key := range update.changed {
+		for _, actionFile := range update.plan.ActionFiles {
+			if actionFile.ChartID == key.chartID && actionFile.Path == key.path {
+				changes.ActionFiles = append(changes.ActionFiles, actionFile)
+				break
+			}
+		}
+	}
+
+	return sendPlanEvent(update.ctx, update.recipient, realtimetypes.PlanUpdatedEvent{
+		WorkspaceID:  update.workspaceID,
+		Changes:      changes,
+		LintFindings: update.lintFindings,
+	})
+}
+
+// sendPlan sends a whole plan now. The plan must have been read after the pending changes to it
+// were written, they're dropped.
+func (c *planUpdateCoalescer) sendPlan(ctx context.Context, recipient realtimetypes.Recipient, e realtimetypes.PlanUpdatedEvent) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if e.Plan != nil {
+		c.take(e.Plan.ID)
+	}
+	return sendPlanEvent(ctx, recipient, e)
+}
+
+// take removes the pending changes to a plan and returns them, nil when there are none
+func (c *planUpdateCoalescer) take(planID string) *pendingPlanUpdate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	update, ok := c.pending[planID]
+	if !ok {
+		return nil
+	}
+	delete(c.pending, planID)
+	if update.timer != nil {
+		update.timer.Stop()
+	}
+	return update
+}
+
+// isTerminalActionFileChange is true when the action file failed to apply
+func isTerminalActionFileChange(plan *workspacetypes.Plan, key actionFileKey) bool {
+	for _, actionFile := range plan.ActionFiles {
+		if actionFile.ChartID == key.chartID && actionFile.Path == key.path {
+			return actionFile.Status == string(llmtypes.ActionPlanStatusFailed)
+		}
+	}
+	return false
+}
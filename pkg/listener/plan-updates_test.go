@@ -0,0 +1,121 @@
+package listener
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordPlanEvents replaces sendPlanEvent with one that records the plan events sent
+func recordPlanEvents(t *testing.T) func() []realtimetypes.PlanUpdatedEvent {
+	original := sendPlanEvent
+	t.Cleanup(func() { sendPlanEvent = original })
+
+	var mu sync.Mutex
+	events := []realtimetypes.PlanUpdatedEvent{}
+	sendPlanEvent = func(ctx context.Context, r realtimetypes.Recipient, e realtimetypes.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e.(realtimetypes.PlanUpdatedEvent))
+		return nil
+	}
+	return func() []realtimetypes.PlanUpdatedEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]realtimetypes.PlanUpdatedEvent{}, events...)
+	}
+}
+
+// planWithFiles is a plan being applied with count pending action files
+func planWithFiles(count int) *workspacetypes.Plan {
+	plan := &workspacetypes.Plan{ID: "plan", WorkspaceID: "workspace", Status: workspacetypes.PlanStatusApplying}
+	for i := 0; i < count; i++ {
+		plan.ActionFiles = append(plan.ActionFiles, workspacetypes.ActionFile{ChartID: "chart", Path: string(rune('a'+i)) + ".yaml", Status: "pending"})
+	}
+	return plan
+}
+
+// withStatus is a copy of plan with the action file at index i in status
+func withStatus(plan *workspacetypes.Plan, i int, status string) *workspacetypes.Plan {
+	plan.ActionFiles[i].Status = status
+	updated := *plan
+	updated.ActionFiles = append([]workspacetypes.ActionFile{}, plan.ActionFiles...)
+	return &updated
+}
+
+func TestPlanUpdatesBurst(t *testing.T) {
+	events := recordPlanEvents(t)
+	c := newPlanUpdateCoalescer(50 * time.Millisecond)
+	plan := planWithFiles(5)
+
+	// 10 changes, each file to creating and then to created
+	for i := 0; i < 5; i++ {
+		for _, status := range []string{"creating", "created"} {
+			require.NoError(t, c.changed(context.Background(), realtimetypes.Recipient{}, "workspace", withStatus(plan, i, status), "chart", plan.ActionFiles[i].Path, nil))
+		}
+	}
+
+	require.Eventually(t, func() bool { return len(events()) > 0 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, c.flush(plan.ID))
+
+	sent := events()
+	assert.LessOrEqual(t, len(sent), 3)
+
+	// the last status of each file is the one the clients end up with
+	statuses := map[string]string{}
+	for _, e := range sent {
+		assert.Nil(t, e.Plan)
+		require.NotNil(t, e.Changes)
+		assert.Equal(t, "plan", e.Changes.PlanID)
+		assert.Equal(t, workspacetypes.PlanStatusApplying, e.Changes.Status)
+		for _, actionFile := range e.Changes.ActionFiles {
+			statuses[actionFile.Path] = actionFile.Status
+		}
+	}
+	assert.Equal(t, map[string]string{"a.yaml": "created", "b.yaml": "created", "c.yaml": "created", "d.yaml": "created", "e.yaml": "created"}, statuses)
+}
+
+func TestPlanUpdatesFailedFileIsSentAtOnce(t *testing.T) {
+	events := recordPlanEvents(t)
+	c := newPlanUpdateCoalescer(time.Hour)
+	plan := planWithFiles(2)
+
+	require.NoError(t, c.changed(context.Background(), realtimetypes.Recipient{}, "workspace", withStatus(plan, 0, "created"), "chart", "a.yaml", nil))
+	require.NoError(t, c.changed(context.Background(), realtimetypes.Recipient{}, "workspace", withStatus(plan, 1, "creating"), "chart", "b.yaml", nil))
+	assert.Empty(t, events())
+
+	require.NoError(t, c.changed(context.Background(), realtimetypes.Recipient{}, "workspace", withStatus(plan, 1, "failed"), "chart", "b.yaml", nil))
+	sent := events()
+	require.Len(t, sent, 1)
+	assert.Equal(t, []workspacetypes.ActionFile{
+		{ChartID: "chart", Path: "a.yaml", Status: "created"},
+		{ChartID: "chart", Path: "b.yaml", Status: "failed"},
+	}, sent[0].Changes.ActionFiles)
+
+	// nothing is left to send
+	require.NoError(t, c.flush(plan.ID))
+	assert.Len(t, events(), 1)
+}
+
+func TestPlanUpdatesSendPlanDropsPendingChanges(t *testing.T) {
+	events := recordPlanEvents(t)
+	c := newPlanUpdateCoalescer(time.Hour)
+	plan := planWithFiles(1)
+
+	require.NoError(t, c.changed(context.Background(), realtimetypes.Recipient{}, "workspace", withStatus(plan, 0, "created"), "chart", "a.yaml", nil))
+
+	plan.Status = workspacetypes.PlanStatusApplied
+	require.NoError(t, c.sendPlan(context.Background(), realtimetypes.Recipient{}, realtimetypes.PlanUpdatedEvent{WorkspaceID: "workspace", Plan: plan}))
+	require.NoError(t, c.flush(plan.ID))
+
+	sent := events()
+	require.Len(t, sent, 1, "the plan has the changes, they aren't sent after it")
+	assert.Equal(t, plan, sent[0].Plan)
+	assert.Nil(t, sent[0].Changes)
+}
@@ -0,0 +1,182 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// QueueDeadAttempts is the number of failed attempts after which a message is reported as dead.
+// Dead messages are still retried by the listener, they're reported so an operator can look at them.
+const QueueDeadAttempts = 5
+
+// queueStatsColumns is shared by the listener and the queue commands in the debug console so
+// that both report the same numbers
+var queueStatsColumns = fmt.Sprintf(`
+	COUNT(*) as total,
+	COUNT(CASE WHEN processing_started_at IS NOT NULL AND completed_at IS NULL THEN 1 END) as in_flight,
+	COUNT(CASE WHEN processing_started_at IS NULL AND completed_at IS NULL THEN 1 END) as available,
+	COUNT(CASE WHEN COALESCE(attempt_count, 0) >= %d AND completed_at IS NULL THEN 1 END) as dead,
+	COALESCE(EXTRACT(EPOCH FROM NOW()::timestamp - MIN(CASE WHEN processing_started_at IS NULL AND completed_at IS NULL THEN created_at END)), 0)::float8 as oldest_unclaimed_seconds`, QueueDeadAttempts)
+
+type queueDB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// QueueStats counts the incomplete messages in a channel
+type QueueStats struct {
+	Channel   string
+	Total     int
+	InFlight  int
+	Available int
+	Dead      int
+	// OldestUnclaimedAge is how long the oldest available message has waited to the second, 0 when
+	// there's none
+	OldestUnclaimedAge time.Duration
+}
+
+// scanQueueStats scans the queueStatsColumns of a row into stats, after the columns in dest
+func scanQueueStats(row pgx.Row, stats *QueueStats, dest ...any) error {
+	var oldestUnclaimedSeconds float64
+	dest = append(dest, &stats.Total, &stats.InFlight, &stats.Available, &stats.Dead, &oldestUnclaimedSeconds)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	stats.OldestUnclaimedAge = time.Duration(oldestUnclaimedSeconds * float64(time.Second)).Round(time.Second)
+	return nil
+}
+
+// QueueMessage is a row in the work queue
+type QueueMessage struct {
+	ID                  string
+	Channel             string
+	Payload             []byte
+	Priority            *int
+	CreatedAt           time.Time
+	ProcessingStartedAt *time.Time
+	ClaimedUntil        *time.Time
+	CompletedAt         *time.Time
+	AttemptCount        int
+	LastError           string
+}
+
+// GetQueueStats returns the stats for incomplete messages in a channel
+func GetQueueStats(ctx context.Context, db queueDB, channel string) (*QueueStats, error) {
+	stats := QueueStats{Channel: channel}
+	row := db.QueryRow(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE channel = $1 AND completed_at IS NULL`, queueStatsColumns, WorkQueueTable), channel)
+	err := scanQueueStats(row, &stats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue statistics: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// ListQueueStats returns the stats for incomplete messages in every channel that has any
+func ListQueueStats(ctx context.Context, db queueDB) ([]QueueStats, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`SELECT channel, %s FROM %s WHERE completed_at IS NULL GROUP BY channel ORDER BY channel`, queueStatsColumns, WorkQueueTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue statistics: %w", err)
+	}
+	defer rows.Close()
+
+	allStats := []QueueStats{}
+	for rows.Next() {
+		var stats QueueStats
+		if err := scanQueueStats(rows, &stats, &stats.Channel); err != nil {
+			return nil, fmt.Errorf("failed to scan queue statistics: %w", err)
+		}
+		allStats = append(allStats, stats)
+	}
+
+	return allStats, rows.Err()
+}
+
+// ListQueueChannels returns every channel that has messages in the queue
+func ListQueueChannels(ctx context.Context, db queueDB) ([]string, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`SELECT DISTINCT channel FROM %s ORDER BY channel`, WorkQueueTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue channels: %w", err)
+	}
+	defer rows.Close()
+
+	channels := []string{}
+	for rows.Next() {
+		var channel string
+		if err := rows.Scan(&channel); err != nil {
+			return nil, fmt.Errorf("failed to scan queue channel: %w", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+// GetQueueMessage returns a message from the work queue, or nil if it doesn't exist
+func GetQueueMessage(ctx context.Context, db queueDB, id string) (*QueueMessage, error) {
+	var msg QueueMessage
+	var lastError *string
+	err := db.QueryRow(ctx, fmt.Sprintf(`SELECT id, channel, payload, priority, created_at, processing_started_at, claimed_until, completed_at, COALESCE(attempt_count, 0)::int, last_error
+		FROM %s WHERE id = $1`, WorkQueueTable), id).Scan(
+		&msg.ID, &msg.Channel, &msg.Payload, &msg.Priority, &msg.CreatedAt, &msg.ProcessingStartedAt, &msg.ClaimedUntil, &msg.CompletedAt, &msg.AttemptCount, &lastError)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get queue message: %w", err)
+	}
+	if lastError != nil {
+		msg.LastError = *lastError
+	}
+
+	return &msg, nil
+}
+
+// RetryQueueMessage makes an incomplete message available to be claimed immediately, and
+// notifies its channel so a listener picks it up
+func RetryQueueMessage(ctx context.Context, db queueDB, id string) error {
+	var channel string
+	err := db.QueryRow(ctx, fmt.Sprintf(`UPDATE %s SET processing_started_at = NULL, claimed_until = NULL
+		WHERE id = $1 AND completed_at IS NULL
+		RETURNING channel`, WorkQueueTable), id).Scan(&channel)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("message %s not found or already completed", id)
+		}
+		return fmt.Errorf("failed to reset queue message: %w", err)
+	}
+
+	if _, err := db.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, id); err != nil {
+		return fmt.Errorf("failed to notify: %w", err)
+	}
+
+	return nil
+}
+
+// CountCompletedQueueMessages returns the number of messages in a channel that completed before cutoff
+func CountCompletedQueueMessages(ctx context.Context, db queueDB, channel string, cutoff time.Time) (int, error) {
+	var count int
+	err := db.QueryRow(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE channel = $1 AND completed_at < $2`, WorkQueueTable),
+		channel, cutoff).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count completed queue messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// PurgeCompletedQueueMessages deletes messages in a channel that completed before cutoff
+func PurgeCompletedQueueMessages(ctx context.Context, db queueDB, channel string, cutoff time.Time) (int64, error) {
+	tag, err := db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE channel = $1 AND completed_at < $2`, WorkQueueTable),
+		channel, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge completed queue messages: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,72 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQueueAdmin seeds a channel with messages in each state and checks the stats, retry and purge
+// operations used by the debug console. It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestQueueAdmin(t *testing.T) {
+	connStr := testPGURI(t)
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	channel := fmt.Sprintf("queue_admin_test_%d", time.Now().UnixNano())
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+
+	seed := func(id string, processingStartedAt *time.Time, completedAt *time.Time, attempts int) {
+		_, err := conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at, processing_started_at, completed_at, attempt_count)
+			VALUES ($1, $2, '{"id": "x"}', NOW(), $3, $4, $5)`, channel+id, channel, processingStartedAt, completedAt, attempts)
+		require.NoError(t, err)
+	}
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	seed("-available", nil, nil, 0)
+	seed("-inflight", &now, nil, 0)
+	seed("-dead", &now, nil, QueueDeadAttempts)
+	seed("-recent", &now, &now, 0)
+	seed("-old", &old, &old, 0)
+
+	stats, err := GetQueueStats(ctx, conn, channel)
+	require.NoError(t, err)
+	assert.Equal(t, QueueStats{Channel: channel, Total: 3, InFlight: 2, Available: 1, Dead: 1}, *stats)
+
+	allStats, err := ListQueueStats(ctx, conn)
+	require.NoError(t, err)
+	assert.Contains(t, allStats, *stats)
+
+	require.NoError(t, RetryQueueMessage(ctx, conn, channel+"-dead"))
+	msg, err := GetQueueMessage(ctx, conn, channel+"-dead")
+	require.NoError(t, err)
+	assert.Nil(t, msg.ProcessingStartedAt)
+	assert.Equal(t, QueueDeadAttempts, msg.AttemptCount)
+
+	assert.Error(t, RetryQueueMessage(ctx, conn, channel+"-recent"))
+
+	cutoff := now.Add(-24 * time.Hour)
+	count, err := CountCompletedQueueMessages(ctx, conn, channel, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	deleted, err := PurgeCompletedQueueMessages(ctx, conn, channel, cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	msg, err = GetQueueMessage(ctx, conn, channel+"-old")
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+}
@@ -0,0 +1,130 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// DefaultQueueAgeAlertCooldown is how long after alerting about a channel it's alerted about again
+// while its backlog lasts, when CHARTSMITH_QUEUE_ALERT_COOLDOWN isn't set
+const DefaultQueueAgeAlertCooldown = time.Hour
+
+// QueueAgeAlert is called when the oldest unclaimed message of a channel has waited longer than
+// threshold
+type QueueAgeAlert func(ctx context.Context, channel string, age time.Duration, threshold time.Duration) error
+
+// queueAgeAlerter alerts about each channel whose oldest unclaimed message is older than its
+// threshold, at most once per cooldown across every worker replica
+type queueAgeAlerter struct {
+	threshold time.Duration
+	cooldown  time.Duration
+	alert     QueueAgeAlert
+
+	// claim and release are claimQueueAgeAlert and releaseQueueAgeAlert, they're fields so that the
+	// cooldown can be tested without a database
+	claim   func(ctx context.Context, channel string, now time.Time, cooldown time.Duration) (bool, error)
+	release func(ctx context.Context, channel string, alertedAt time.Time) error
+}
+
+// SetQueueAgeAlert calls alert when the oldest unclaimed message of a channel has waited longer
+// than threshold, and again after cooldown if it still has. The age is measured with the queue
+// statistics each channel's processor reads before claiming messages. When the alert is sent is
+// kept in the database, so that only one replica alerts.
+func (l *Listener) SetQueueAgeAlert(threshold time.Duration, cooldown time.Duration, alert QueueAgeAlert) {
+	l.queueAgeAlerter = &queueAgeAlerter{
+		threshold: threshold,
+		cooldown:  cooldown,
+		alert:     alert,
+		claim: func(ctx context.Context, channel string, now time.Time, cooldown time.Duration) (bool, error) {
+			return claimQueueAgeAlert(ctx, l.pool, channel, now, cooldown)
+		},
+		release: func(ctx context.Context, channel string, alertedAt time.Time) error {
+			return releaseQueueAgeAlert(ctx, l.pool, channel, alertedAt)
+		},
+	}
+}
+
+// claimQueueAgeAlert records that channel is alerted about at now and returns true, or returns
+// false when it was alerted about within cooldown, by this replica or another
+func claimQueueAgeAlert(ctx context.Context, db queueDB, channel string, now time.Time, cooldown time.Duration) (bool, error) {
+	tag, err := db.Exec(ctx, `INSERT INTO work_queue_alert (channel, alerted_at) VALUES ($1, $2)
+		ON CONFLICT (channel) DO UPDATE SET alerted_at = EXCLUDED.alerted_at
+		WHERE work_queue_alert.alerted_at <= $2 - $3::interval`, channel, now.UTC(), cooldown.String())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim queue age alert: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// releaseQueueAgeAlert forgets the alert claimed at alertedAt, so that an alert that failed to send
+// is tried again
+func releaseQueueAgeAlert(ctx context.Context, db queueDB, channel string, alertedAt time.Time) error {
+	if _, err := db.Exec(ctx, `DELETE FROM work_queue_alert WHERE channel = $1 AND alerted_at = $2`, channel, alertedAt.UTC()); err != nil {
+		return fmt.Errorf("failed to release queue age alert: %w", err)
+	}
+	return nil
+}
+
+// observe alerts when age is past the threshold and the channel hasn't been alerted about within
+// the cooldown. A failed alert is tried again the next time. It returns true when it alerted.
+func (a *queueAgeAlerter) observe(ctx context.Context, channel string, age time.Duration, now time.Time) bool {
+	if a == nil || age <= a.threshold {
+		return false
+	}
+
+	claimed, err := a.claim(ctx, channel, now, a.cooldown)
+	if err != nil {
+		logger.Error(err, zap.String("channel", channel))
+		return false
+	}
+	if !claimed {
+		return false
+	}
+
+	if err := a.alert(ctx, channel, age, a.threshold); err != nil {
+		logger.Error(fmt.Errorf("failed to alert about queue backlog: %w", err), zap.String("channel", channel))
+		if err := a.release(ctx, channel, now); err != nil {
+			logger.Error(err, zap.String("channel", channel))
+		}
+		return false
+	}
+	logger.Warn("queue backlog",
+		zap.String("channel", channel),
+		zap.Duration("oldestUnclaimedAge", age),
+		zap.Duration("threshold", a.threshold))
+	return true
+}
+
+// recordQueueStats keeps the statistics a processor read for /status and metrics, and alerts when
+// its channel has a backlog
+func (l *Listener) recordQueueStats(ctx context.Context, processor *queueProcessor, stats QueueStats, now time.Time) {
+	processor.oldestUnclaimedAge.Store(int64(stats.OldestUnclaimedAge))
+	processor.statsAt.Store(&now)
+	l.queueAgeAlerter.observe(ctx, processor.channel, stats.OldestUnclaimedAge, now)
+}
+
+// queueAgeSamples is a gauge of the oldest unclaimed message age of each channel
+func (l *Listener) queueAgeSamples() ([]metrics.Sample, error) {
+	channels := make([]string, 0, len(l.processors))
+	for channel := range l.processors {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	samples := []metrics.Sample{}
+	for _, channel := range channels {
+		samples = append(samples, metrics.Sample{
+			Name:   "chartsmith_queue_oldest_unclaimed_seconds",
+			Help:   "How long the oldest unclaimed message of a work queue channel has waited, as of the channel's last poll.",
+			Labels: map[string]string{"channel": channel},
+			Value:  time.Duration(l.processors[channel].oldestUnclaimedAge.Load()).Seconds(),
+		})
+	}
+	return samples, nil
+}
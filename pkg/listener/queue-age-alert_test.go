@@ -0,0 +1,202 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type queueAgeAlertCall struct {
+	channel   string
+	age       time.Duration
+	threshold time.Duration
+}
+
+// recordQueueAgeAlerts sets an alert on l that records its calls and fails while failing is true.
+// When it was last sent is kept in memory instead of the database.
+func recordQueueAgeAlerts(l *Listener, threshold time.Duration, cooldown time.Duration, failing *bool) *[]queueAgeAlertCall {
+	calls := []queueAgeAlertCall{}
+	l.SetQueueAgeAlert(threshold, cooldown, func(ctx context.Context, channel string, age time.Duration, threshold time.Duration) error {
+		if failing != nil && *failing {
+			return errors.New("slack is down")
+		}
+		calls = append(calls, queueAgeAlertCall{channel: channel, age: age, threshold: threshold})
+		return nil
+	})
+
+	alertedAt := map[string]time.Time{}
+	l.queueAgeAlerter.claim = func(ctx context.Context, channel string, now time.Time, cooldown time.Duration) (bool, error) {
+		if last, ok := alertedAt[channel]; ok && now.Sub(last) < cooldown {
+			return false, nil
+		}
+		alertedAt[channel] = now
+		return true, nil
+	}
+	l.queueAgeAlerter.release = func(ctx context.Context, channel string, at time.Time) error {
+		if alertedAt[channel].Equal(at) {
+			delete(alertedAt, channel)
+		}
+		return nil
+	}
+	return &calls
+}
+
+// useQueueAgeAlertDB keeps when l last alerted in the database conn is connected to
+func useQueueAgeAlertDB(l *Listener, conn *pgx.Conn) {
+	l.queueAgeAlerter.claim = func(ctx context.Context, channel string, now time.Time, cooldown time.Duration) (bool, error) {
+		return claimQueueAgeAlert(ctx, conn, channel, now, cooldown)
+	}
+	l.queueAgeAlerter.release = func(ctx context.Context, channel string, alertedAt time.Time) error {
+		return releaseQueueAgeAlert(ctx, conn, channel, alertedAt)
+	}
+}
+
+func TestQueueAgeAlertCooldown(t *testing.T) {
+	l := &Listener{handlers: map[string]NotificationHandler{}, processors: map[string]*queueProcessor{}}
+	l.AddHandler(context.Background(), "new_plan", 5, time.Second, 0, nil, nil)
+	l.AddHandler(context.Background(), "new_summarize", 2, time.Second, 0, nil, nil)
+	failing := false
+	calls := recordQueueAgeAlerts(l, 10*time.Minute, time.Hour, &failing)
+
+	ctx := context.Background()
+	now := time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC)
+	plan, summarize := l.processors["new_plan"], l.processors["new_summarize"]
+
+	l.recordQueueStats(ctx, plan, QueueStats{OldestUnclaimedAge: 10 * time.Minute}, now)
+	assert.Empty(t, *calls, "not older than the threshold")
+
+	l.recordQueueStats(ctx, plan, QueueStats{OldestUnclaimedAge: 11 * time.Minute}, now)
+	l.recordQueueStats(ctx, plan, QueueStats{OldestUnclaimedAge: 12 * time.Minute}, now.Add(time.Minute))
+	l.recordQueueStats(ctx, plan, QueueStats{OldestUnclaimedAge: time.Hour}, now.Add(59*time.Minute))
+	assert.Equal(t, []queueAgeAlertCall{{channel: "new_plan", age: 11 * time.Minute, threshold: 10 * time.Minute}}, *calls, "alerted once in the cooldown")
+
+	l.recordQueueStats(ctx, summarize, QueueStats{OldestUnclaimedAge: 20 * time.Minute}, now.Add(time.Minute))
+	assert.Len(t, *calls, 2, "channels cool down separately")
+
+	l.recordQueueStats(ctx, plan, QueueStats{OldestUnclaimedAge: 70 * time.Minute}, now.Add(time.Hour))
+	assert.Len(t, *calls, 3, "alerted again after the cooldown")
+
+	failing = true
+	l.recordQueueStats(ctx, summarize, QueueStats{OldestUnclaimedAge: 90 * time.Minute}, now.Add(2*time.Hour))
+	failing = false
+	l.recordQueueStats(ctx, summarize, QueueStats{OldestUnclaimedAge: 91 * time.Minute}, now.Add(2*time.Hour+time.Minute))
+	require.Len(t, *calls, 4, "a failed alert is tried again")
+	assert.Equal(t, 91*time.Minute, (*calls)[3].age)
+
+	status := l.Status()
+	assert.Equal(t, 91*time.Minute.Seconds(), status.Channels["new_summarize"].OldestUnclaimedSeconds)
+	require.NotNil(t, status.Channels["new_summarize"].StatsAt)
+	assert.Equal(t, now.Add(2*time.Hour+time.Minute), *status.Channels["new_summarize"].StatsAt)
+}
+
+func TestQueueAgeAlertDisabled(t *testing.T) {
+	l := &Listener{handlers: map[string]NotificationHandler{}, processors: map[string]*queueProcessor{}}
+	l.AddHandler(context.Background(), "new_plan", 5, time.Second, 0, nil, nil)
+
+	l.recordQueueStats(context.Background(), l.processors["new_plan"], QueueStats{OldestUnclaimedAge: 24 * time.Hour}, time.Now())
+	assert.Equal(t, 24*time.Hour.Seconds(), l.Status().Channels["new_plan"].OldestUnclaimedSeconds)
+}
+
+// TestQueueAgeFromSeededRows seeds a channel with messages that have waited a while and checks the
+// age the queue statistics measure, the gauge and that the alert fires once. It runs against the
+// database in CHARTSMITH_TEST_PG_URI.
+func TestQueueAgeFromSeededRows(t *testing.T) {
+	connStr := testPGURI(t)
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	channel := fmt.Sprintf("queue_age_test_%d", time.Now().UnixNano())
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue_alert WHERE channel = $1`, channel)
+
+	// the oldest message is being processed, so the oldest unclaimed one is 30 minutes old
+	seed := []string{
+		`INSERT INTO work_queue (id, channel, payload, created_at, processing_started_at) VALUES ($1 || '-claimed', $1, '{}', NOW() - interval '2 hours', NOW())`,
+		`INSERT INTO work_queue (id, channel, payload, created_at, completed_at) VALUES ($1 || '-completed', $1, '{}', NOW() - interval '3 hours', NOW())`,
+		`INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1 || '-old', $1, '{}', NOW() - interval '30 minutes')`,
+		`INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1 || '-new', $1, '{}', NOW())`,
+	}
+	for _, statement := range seed {
+		_, err := conn.Exec(ctx, statement, channel)
+		require.NoError(t, err, statement)
+	}
+
+	stats, err := GetQueueStats(ctx, conn, channel)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Available)
+	assert.InDelta(t, (30 * time.Minute).Seconds(), stats.OldestUnclaimedAge.Seconds(), 5)
+
+	l := &Listener{handlers: map[string]NotificationHandler{}, processors: map[string]*queueProcessor{}}
+	l.AddHandler(ctx, channel, 1, time.Second, 0, nil, nil)
+	calls := recordQueueAgeAlerts(l, 15*time.Minute, time.Hour, nil)
+	useQueueAgeAlertDB(l, conn)
+
+	l.recordQueueStats(ctx, l.processors[channel], *stats, time.Now())
+	stats, err = GetQueueStats(ctx, conn, channel)
+	require.NoError(t, err)
+	l.recordQueueStats(ctx, l.processors[channel], *stats, time.Now())
+	require.Len(t, *calls, 1)
+	assert.Equal(t, channel, (*calls)[0].channel)
+
+	samples, err := l.queueAgeSamples()
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, map[string]string{"channel": channel}, samples[0].Labels)
+	assert.Equal(t, "chartsmith_queue_oldest_unclaimed_seconds", samples[0].Name)
+	assert.InDelta(t, (30 * time.Minute).Seconds(), samples[0].Value, 5)
+}
+
+// TestQueueAgeAlertOncePerReplicas checks that replicas sharing the database alert about a channel
+// once per cooldown, and that an alert that failed is sent by the next replica to see the backlog.
+// It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestQueueAgeAlertOncePerReplicas(t *testing.T) {
+	connStr := testPGURI(t)
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	channel := fmt.Sprintf("queue_alert_test_%d", time.Now().UnixNano())
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue_alert WHERE channel = $1`, channel)
+
+	failing := true
+	replicas := []*Listener{}
+	calls := []*[]queueAgeAlertCall{}
+	for i := 0; i < 3; i++ {
+		l := &Listener{handlers: map[string]NotificationHandler{}, processors: map[string]*queueProcessor{}}
+		l.AddHandler(ctx, channel, 1, time.Second, 0, nil, nil)
+		calls = append(calls, recordQueueAgeAlerts(l, 10*time.Minute, time.Hour, &failing))
+		useQueueAgeAlertDB(l, conn)
+		replicas = append(replicas, l)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	backlog := QueueStats{OldestUnclaimedAge: 20 * time.Minute}
+
+	replicas[0].recordQueueStats(ctx, replicas[0].processors[channel], backlog, now)
+	failing = false
+	for i, l := range replicas {
+		l.recordQueueStats(ctx, l.processors[channel], backlog, now.Add(time.Duration(i+1)*time.Minute))
+	}
+	require.Len(t, *calls[0], 1, "the failed alert was released and sent again")
+	assert.Empty(t, *calls[1], "another replica alerted within the cooldown")
+	assert.Empty(t, *calls[2], "another replica alerted within the cooldown")
+
+	replicas[1].recordQueueStats(ctx, replicas[1].processors[channel], backlog, now.Add(time.Hour+time.Minute))
+	assert.Len(t, *calls[1], 1, "alerted again after the cooldown")
+}
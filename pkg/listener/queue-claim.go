@@ -0,0 +1,123 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// QueueClaimSweepInterval is how often claims that expired long ago are looked for
+	QueueClaimSweepInterval = 15 * time.Minute
+
+	// queueClaimSweepAge is how long a claim has to have been expired before the sweep releases it.
+	// Expired claims are taken over by the next claim, the ones left this long are on channels
+	// nothing is claiming from.
+	queueClaimSweepAge = time.Hour
+
+	// minClaimExtendInterval keeps channels with a short maxDuration from extending their claims
+	// more often than the database needs
+	minClaimExtendInterval = time.Second
+)
+
+// claimExtendInterval is how often a claim that lasts maxDuration is extended while its message is
+// processed, often enough that a slow extension doesn't let it expire
+func claimExtendInterval(maxDuration time.Duration) time.Duration {
+	interval := maxDuration / 3
+	if interval < minClaimExtendInterval {
+		return minClaimExtendInterval
+	}
+	return interval
+}
+
+// holdClaim extends the claim on a message every claimExtendInterval until release is called, so
+// that a handler that takes longer than the channel's maxDuration doesn't have its message claimed
+// by another worker. A claim that was taken over, because this worker couldn't extend it in time,
+// isn't extended any more.
+func (l *Listener) holdClaim(ctx context.Context, processor *queueProcessor, messageID string, claimedAt time.Time) (release func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(claimExtendInterval(processor.maxDuration))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				extendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				held, err := extendClaim(extendCtx, l.pool, messageID, claimedAt, processor.maxDuration)
+				cancel()
+				if err != nil {
+					logger.Warn("Failed to extend queue claim",
+						zap.String("id", messageID),
+						zap.String("channel", processor.channel),
+						zap.Error(err))
+					continue
+				}
+				if !held {
+					logger.Warn("Queue claim was taken over while the message was processed",
+						zap.String("id", messageID),
+						zap.String("channel", processor.channel))
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// extendClaim makes a claim last another maxDuration, returning false when the message was claimed
+// again or completed since claimedAt
+func extendClaim(ctx context.Context, db queueDB, messageID string, claimedAt time.Time, maxDuration time.Duration) (bool, error) {
+	tag, err := db.Exec(ctx, fmt.Sprintf(`UPDATE %s SET claimed_until = NOW() + $3::interval
+		WHERE id = $1 AND processing_started_at = $2 AND completed_at IS NULL`, WorkQueueTable),
+		messageID, claimedAt, maxDuration.String())
+	if err != nil {
+		return false, fmt.Errorf("failed to extend claim: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SweepExpiredClaims logs and releases the claims on incomplete messages that expired more than
+// olderThan ago, returning how many it released. Their messages are available to be claimed again.
+func SweepExpiredClaims(ctx context.Context, db queueDB, olderThan time.Duration) (int, error) {
+	rows, err := db.Query(ctx, fmt.Sprintf(`UPDATE %s
+		SET processing_started_at = NULL, claimed_until = NULL
+		WHERE completed_at IS NULL
+		AND processing_started_at IS NOT NULL
+		AND COALESCE(claimed_until, processing_started_at) < NOW() - $1::interval
+		RETURNING id, channel, COALESCE(attempt_count, 0)::int`, WorkQueueTable), olderThan.String())
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired claims: %w", err)
+	}
+	defer rows.Close()
+
+	released := 0
+	for rows.Next() {
+		var id, channel string
+		var attemptCount int
+		if err := rows.Scan(&id, &channel, &attemptCount); err != nil {
+			return released, fmt.Errorf("failed to scan released claim: %w", err)
+		}
+		logger.Warn("Released expired queue claim",
+			zap.String("id", id),
+			zap.String("channel", channel),
+			zap.Int("attempt", attemptCount))
+		released++
+	}
+
+	return released, rows.Err()
+}
@@ -0,0 +1,150 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimExtendInterval(t *testing.T) {
+	assert.Equal(t, 20*time.Second, claimExtendInterval(time.Minute))
+	assert.Equal(t, minClaimExtendInterval, claimExtendInterval(time.Second))
+}
+
+// TestClaimExpiry checks that a message whose claim expired is taken over by the next claim, and
+// that a claim that's still held, or was extended past maxDuration, can't be. It runs against the
+// database in CHARTSMITH_TEST_PG_URI.
+func TestClaimExpiry(t *testing.T) {
+	connStr := testPGURI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	l := NewListener()
+	l.pool, err = newQueuePool(ctx, connStr, 2)
+	require.NoError(t, err)
+	defer l.pool.Close()
+
+	for _, fairnessKey := range []string{"", "workspaceId"} {
+		t.Run(fmt.Sprintf("fairness key %q", fairnessKey), func(t *testing.T) {
+			channel := fmt.Sprintf("claim_expiry_test_%d", time.Now().UnixNano())
+			defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+
+			processor := &queueProcessor{
+				channel:         channel,
+				defaultPriority: persistence.WorkPriorityNormal,
+				maxWorkers:      5,
+				maxDuration:     time.Minute,
+				fairnessKey:     fairnessKey,
+			}
+
+			seed := func(id string, workspaceID string, processingStartedAt *time.Time, claimedUntil *time.Time) {
+				_, err := conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at, processing_started_at, claimed_until)
+					VALUES ($1, $2, $3, NOW() - interval '1 hour', $4, $5)`,
+					channel+id, channel, fmt.Sprintf(`{"workspaceId": %q}`, workspaceID), processingStartedAt, claimedUntil)
+				require.NoError(t, err)
+			}
+
+			now := time.Now()
+			longAgo := now.Add(-time.Hour)
+			expired := now.Add(-time.Minute)
+			held := now.Add(time.Minute)
+
+			// claimed by a worker that died, the claim expired a minute ago
+			seed("-stale", "a", &longAgo, &expired)
+			// claimed long ago, but extended by a worker that's still processing it
+			seed("-extended", "b", &longAgo, &held)
+			// claimed before claims had an expiry, it expires maxDuration after it was claimed
+			seed("-legacy-stale", "c", &longAgo, nil)
+			seed("-legacy-active", "d", &now, nil)
+
+			batch, err := l.claimMessages(ctx, processor)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, msg := range batch {
+				ids = append(ids, msg.id)
+				assert.WithinDuration(t, time.Now(), msg.claimedAt, time.Minute)
+			}
+			assert.ElementsMatch(t, []string{channel + "-stale", channel + "-legacy-stale"}, ids)
+
+			// the new claims are held, nothing else can be claimed
+			batch, err = l.claimMessages(ctx, processor)
+			require.NoError(t, err)
+			assert.Empty(t, batch)
+
+			msg, err := GetQueueMessage(ctx, conn, channel+"-stale")
+			require.NoError(t, err)
+			require.NotNil(t, msg.ClaimedUntil)
+			assert.True(t, msg.ClaimedUntil.After(time.Now().UTC().Add(-time.Minute)))
+		})
+	}
+}
+
+// TestExtendClaim checks that a worker can only extend its own claim. It runs against the database
+// in CHARTSMITH_TEST_PG_URI.
+func TestExtendClaim(t *testing.T) {
+	connStr := testPGURI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	l := NewListener()
+	l.pool, err = newQueuePool(ctx, connStr, 2)
+	require.NoError(t, err)
+	defer l.pool.Close()
+
+	channel := fmt.Sprintf("extend_claim_test_%d", time.Now().UnixNano())
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = $1`, channel)
+	_, err = conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1, $2, '{}', NOW())`, channel+"-msg", channel)
+	require.NoError(t, err)
+
+	processor := &queueProcessor{channel: channel, maxWorkers: 1, maxDuration: time.Second}
+	batch, err := l.claimMessages(ctx, processor)
+	require.NoError(t, err)
+	require.Len(t, batch, 1)
+
+	held, err := extendClaim(ctx, conn, batch[0].id, batch[0].claimedAt, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	// past maxDuration, the extended claim is still held
+	time.Sleep(1100 * time.Millisecond)
+	stolen, err := l.claimMessages(ctx, processor)
+	require.NoError(t, err)
+	assert.Empty(t, stolen, "an extended claim can't be taken over")
+
+	held, err = extendClaim(ctx, conn, batch[0].id, batch[0].claimedAt.Add(-time.Second), time.Hour)
+	require.NoError(t, err)
+	assert.False(t, held, "a claim that was taken over can't be extended")
+
+	// an ancient claim is released by the sweep
+	_, err = conn.Exec(ctx, `UPDATE work_queue SET claimed_until = NOW() - interval '2 hours' WHERE id = $1`, batch[0].id)
+	require.NoError(t, err)
+	released, err := SweepExpiredClaims(ctx, conn, time.Hour)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, released, 1)
+
+	msg, err := GetQueueMessage(ctx, conn, batch[0].id)
+	require.NoError(t, err)
+	assert.Nil(t, msg.ProcessingStartedAt)
+	assert.Nil(t, msg.ClaimedUntil)
+}
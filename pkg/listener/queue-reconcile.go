@@ -0,0 +1,86 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// reconciledMessages counts the messages released by startup reconciliation since the worker started
+var reconciledMessages atomic.Int64
+
+// QueueReconcileStats counts what startup reconciliation did
+type QueueReconcileStats struct {
+	Released int64
+}
+
+// GetQueueReconcileStats returns what startup reconciliation did since the worker started
+func GetQueueReconcileStats() QueueReconcileStats {
+	return QueueReconcileStats{Released: reconciledMessages.Load()}
+}
+
+// ReconcileInFlight releases the messages a worker that stopped was processing, so that they're
+// available as soon as the listener starts. A message is released when it's incomplete and its
+// claim expired, which is maxDuration of its channel after it was claimed unless the claim was
+// extended, so messages held by other workers that are still running aren't touched. Releasing a
+// message counts an attempt, like a failure does. It returns how many messages of each channel it
+// released.
+func ReconcileInFlight(ctx context.Context, db queueDB, maxDurations map[string]time.Duration) (map[string]int, error) {
+	channels := make([]string, 0, len(maxDurations))
+	for channel := range maxDurations {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	released := map[string]int{}
+	for _, channel := range channels {
+		tag, err := db.Exec(ctx, fmt.Sprintf(`UPDATE %s
+			SET processing_started_at = NULL,
+				claimed_until = NULL,
+				attempt_count = COALESCE(attempt_count, 0) + 1,
+				last_error = 'worker stopped while processing'
+			WHERE channel = $1
+			AND completed_at IS NULL
+			AND processing_started_at IS NOT NULL
+			AND COALESCE(claimed_until, processing_started_at + $2::interval) < NOW()`, WorkQueueTable),
+			channel, maxDurations[channel].String())
+		if err != nil {
+			return released, fmt.Errorf("failed to release in-flight messages of %s: %w", channel, err)
+		}
+		released[channel] = int(tag.RowsAffected())
+	}
+
+	return released, nil
+}
+
+// reconcileInFlight releases the messages of the listener's channels that a stopped worker was
+// processing, logging how many of each it released. A failure is logged, expired claims are taken
+// over by the next claim anyway.
+func (l *Listener) reconcileInFlight(ctx context.Context) {
+	maxDurations := map[string]time.Duration{}
+	for channel, processor := range l.processors {
+		maxDurations[channel] = processor.maxDuration
+	}
+
+	released, err := ReconcileInFlight(ctx, l.pool, maxDurations)
+	if err != nil {
+		logger.Warn("Failed to reconcile in-flight queue messages", zap.Error(err))
+	}
+
+	total := 0
+	for channel, count := range released {
+		total += count
+		if count > 0 {
+			logger.Info("Released in-flight queue messages of a stopped worker",
+				zap.String("channel", channel),
+				zap.Int("count", count),
+				zap.Duration("maxDuration", maxDurations[channel]))
+		}
+	}
+	reconciledMessages.Add(int64(total))
+}
@@ -0,0 +1,97 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReconcileInFlight checks that the messages a stopped worker left claimed are released at
+// startup, using the maxDuration of their channel, and that claims still held are left alone. It
+// runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestReconcileInFlight(t *testing.T) {
+	connStr := testPGURI(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	defer conn.Close(context.Background())
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	suffix := time.Now().UnixNano()
+	fast := fmt.Sprintf("reconcile_fast_test_%d", suffix)
+	slow := fmt.Sprintf("reconcile_slow_test_%d", suffix)
+	defer conn.Exec(context.Background(), `DELETE FROM work_queue WHERE channel = ANY($1)`, []string{fast, slow})
+
+	seed := func(id string, channel string, processingStartedAt *time.Time, claimedUntil *time.Time, completedAt *time.Time) {
+		_, err := conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at, processing_started_at, claimed_until, completed_at, attempt_count)
+			VALUES ($1, $2, '{}', NOW() - interval '1 hour', $3, $4, $5, 0)`,
+			channel+id, channel, processingStartedAt, claimedUntil, completedAt)
+		require.NoError(t, err)
+	}
+
+	now := time.Now()
+	twoMinutesAgo := now.Add(-2 * time.Minute)
+	held := now.Add(time.Minute)
+
+	// started two minutes ago, longer than fast's maxDuration but not slow's
+	seed("-stuck", fast, &twoMinutesAgo, nil, nil)
+	seed("-running", slow, &twoMinutesAgo, nil, nil)
+	// extended by a worker that's still processing it
+	seed("-extended", fast, &twoMinutesAgo, &held, nil)
+	seed("-done", fast, &twoMinutesAgo, nil, &now)
+	seed("-waiting", fast, nil, nil, nil)
+
+	before := GetQueueReconcileStats().Released
+
+	l := NewListener()
+	l.pool, err = newQueuePool(ctx, connStr, 2)
+	require.NoError(t, err)
+	defer l.pool.Close()
+	for channel, maxDuration := range map[string]time.Duration{fast: time.Minute, slow: 10 * time.Minute} {
+		l.processors[channel] = &queueProcessor{
+			channel:         channel,
+			defaultPriority: persistence.WorkPriorityNormal,
+			maxWorkers:      5,
+			maxDuration:     maxDuration,
+		}
+	}
+
+	released, err := ReconcileInFlight(ctx, l.pool, map[string]time.Duration{fast: time.Minute, slow: 10 * time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{fast: 1, slow: 0}, released)
+
+	var attemptCount int
+	var lastError string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT attempt_count, last_error FROM work_queue WHERE id = $1 AND processing_started_at IS NULL`, fast+"-stuck").Scan(&attemptCount, &lastError))
+	assert.Equal(t, 1, attemptCount)
+	assert.Equal(t, "worker stopped while processing", lastError)
+
+	// the released message is claimable with the one that was waiting, the others aren't
+	batch, err := l.claimMessages(ctx, l.processors[fast])
+	require.NoError(t, err)
+	ids := []string{}
+	for _, msg := range batch {
+		ids = append(ids, msg.id)
+	}
+	assert.ElementsMatch(t, []string{fast + "-stuck", fast + "-waiting"}, ids)
+
+	batch, err = l.claimMessages(ctx, l.processors[slow])
+	require.NoError(t, err)
+	assert.Empty(t, batch)
+
+	// the listener reconciles every channel it has a handler for when it starts
+	seed("-stuck-again", fast, &twoMinutesAgo, nil, nil)
+	l.reconcileInFlight(ctx)
+	assert.Equal(t, before+1, GetQueueReconcileStats().Released)
+}
@@ -0,0 +1,87 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+)
+
+var (
+	// ErrRenderStalled is returned for a chart whose helm commands stopped writing output
+	ErrRenderStalled = errors.New("render stalled")
+	// ErrRenderTimedOut is returned for a chart that was still rendering at the absolute maximum
+	ErrRenderTimedOut = errors.New("render timed out")
+)
+
+// watchRenderHeartbeats watches the heartbeats of a chart's render. The returned channel receives
+// ErrRenderStalled when helm writes no output for stallTimeout, or ErrRenderTimedOut once the
+// render has taken maxDuration even though it's still making progress. Only a heartbeat that
+// reports more output or a new stage is progress, the keepalives helm-utils sends while helm runs
+// quietly aren't. It receives nothing when ctx is done first, cancel ctx when the render finishes.
+func watchRenderHeartbeats(ctx context.Context, heartbeats <-chan helmutils.RenderHeartbeat, stallTimeout time.Duration, maxDuration time.Duration) <-chan error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		stall := time.NewTimer(stallTimeout)
+		defer stall.Stop()
+		deadline := time.NewTimer(maxDuration)
+		defer deadline.Stop()
+
+		last := helmutils.RenderHeartbeat{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case heartbeat, ok := <-heartbeats:
+				if !ok {
+					heartbeats = nil
+					continue
+				}
+				if heartbeat != last {
+					stall.Reset(stallTimeout)
+				}
+				last = heartbeat
+			case <-stall.C:
+				errCh <- fmt.Errorf("%w: no output from helm for %s%s", ErrRenderStalled, stallTimeout, lastHeartbeatDescription(last))
+				return
+			case <-deadline.C:
+				errCh <- fmt.Errorf("%w: still rendering after %s%s", ErrRenderTimedOut, maxDuration, lastHeartbeatDescription(last))
+				return
+			}
+		}
+	}()
+
+	return errCh
+}
+
+// lastHeartbeatDescription describes where a render was when it was given up on
+func lastHeartbeatDescription(heartbeat helmutils.RenderHeartbeat) string {
+	if heartbeat.Stage == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (last heartbeat during helm %s, %d bytes of output)", heartbeat.Stage, heartbeat.OutputBytes)
+}
+
+// drainRenderChannels reads what a render still sends until it returns, so that a render that was
+// given up on isn't left blocked on a channel no one reads. done receives once the render returns.
+func drainRenderChannels(c helmutils.RenderChannels, done <-chan error) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.DepUpdateCmd:
+		case <-c.DepUpdateStderr:
+		case <-c.DepUpdateStdout:
+		case <-c.HelmTemplateCmd:
+		case <-c.HelmTemplateStderr:
+		case <-c.HelmTemplateStdout:
+		case <-c.Heartbeat:
+		case <-c.Notes:
+		case <-c.Debug:
+		case <-c.Done:
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// feedHeartbeats sends a heartbeat every interval until stop is closed, like helm writing output
+func feedHeartbeats(heartbeats chan helmutils.RenderHeartbeat, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	written := int64(0)
+	for {
+		select {
+		case <-ticker.C:
+			written += 100
+			select {
+			case heartbeats <- helmutils.RenderHeartbeat{Stage: helmutils.RenderStageTemplate, OutputBytes: written}:
+			default:
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func TestWatchRenderHeartbeats(t *testing.T) {
+	t.Run("stalled render fails after the stall timeout", func(t *testing.T) {
+		heartbeats := make(chan helmutils.RenderHeartbeat, 1)
+		heartbeats <- helmutils.RenderHeartbeat{Stage: helmutils.RenderStageDepUpdate, OutputBytes: 42}
+
+		start := time.Now()
+		errCh := watchRenderHeartbeats(context.Background(), heartbeats, 50*time.Millisecond, time.Minute)
+
+		select {
+		case err := <-errCh:
+			assert.True(t, errors.Is(err, ErrRenderStalled), err.Error())
+			assert.Contains(t, err.Error(), "last heartbeat during helm dependency update, 42 bytes of output")
+			assert.Less(t, time.Since(start), 5*time.Second, "a stall isn't held to the absolute maximum")
+		case <-time.After(5 * time.Second):
+			t.Fatal("stalled render wasn't failed")
+		}
+	})
+
+	t.Run("slow render keeps going while it makes progress", func(t *testing.T) {
+		heartbeats := make(chan helmutils.RenderHeartbeat, 1)
+		stop := make(chan struct{})
+		go feedHeartbeats(heartbeats, 10*time.Millisecond, stop)
+
+		errCh := watchRenderHeartbeats(context.Background(), heartbeats, 100*time.Millisecond, time.Minute)
+
+		// several times longer than the stall timeout
+		select {
+		case err := <-errCh:
+			t.Fatalf("render making progress was failed: %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		// and it's failed once the output stops
+		close(stop)
+		select {
+		case err := <-errCh:
+			assert.True(t, errors.Is(err, ErrRenderStalled), err.Error())
+			assert.Contains(t, err.Error(), "during helm template")
+		case <-time.After(5 * time.Second):
+			t.Fatal("render wasn't failed after its output stopped")
+		}
+	})
+
+	t.Run("keepalives without output aren't progress", func(t *testing.T) {
+		heartbeats := make(chan helmutils.RenderHeartbeat, 1)
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					select {
+					case heartbeats <- helmutils.RenderHeartbeat{Stage: helmutils.RenderStageTemplate, OutputBytes: 100}:
+					default:
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+
+		errCh := watchRenderHeartbeats(context.Background(), heartbeats, 100*time.Millisecond, time.Minute)
+
+		select {
+		case err := <-errCh:
+			assert.True(t, errors.Is(err, ErrRenderStalled), err.Error())
+			assert.Contains(t, err.Error(), "no output from helm for 100ms")
+		case <-time.After(5 * time.Second):
+			t.Fatal("render that only sent keepalives wasn't failed")
+		}
+	})
+
+	t.Run("render making progress fails at the absolute maximum", func(t *testing.T) {
+		heartbeats := make(chan helmutils.RenderHeartbeat, 1)
+		stop := make(chan struct{})
+		defer close(stop)
+		go feedHeartbeats(heartbeats, 10*time.Millisecond, stop)
+
+		errCh := watchRenderHeartbeats(context.Background(), heartbeats, 100*time.Millisecond, 300*time.Millisecond)
+
+		select {
+		case err := <-errCh:
+			assert.True(t, errors.Is(err, ErrRenderTimedOut), err.Error())
+			assert.Contains(t, err.Error(), "still rendering after 300ms")
+		case <-time.After(5 * time.Second):
+			t.Fatal("render wasn't failed at the absolute maximum")
+		}
+	})
+
+	t.Run("finished render isn't failed", func(t *testing.T) {
+		heartbeats := make(chan helmutils.RenderHeartbeat, 1)
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := watchRenderHeartbeats(ctx, heartbeats, 20*time.Millisecond, 40*time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-errCh:
+			require.Failf(t, "finished render was failed", "%v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestDrainRenderChannels(t *testing.T) {
+	channels := helmutils.RenderChannels{
+		HelmTemplateStdout: make(chan string),
+		Done:               make(chan error),
+	}
+	done := make(chan error, 1)
+
+	// a render that was given up on still sends its output and Done before it returns
+	go func() {
+		channels.HelmTemplateStdout <- "apiVersion: v1\n"
+		channels.Done <- errors.New("helm template command cancelled")
+		done <- nil
+	}()
+
+	drained := make(chan struct{})
+	go func() {
+		drainRenderChannels(channels, done)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("render was left blocked on its channels")
+	}
+}
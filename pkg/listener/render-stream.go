@@ -0,0 +1,142 @@
+package listener
+
+import (
+	"context"
+	"time"
+
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+)
+
+// renderStreamDebounce is the minimum time between render stream events for a single chart
+const renderStreamDebounce = 250 * time.Millisecond
+
+type realtimeSender func(ctx context.Context, r realtimetypes.Recipient, e realtimetypes.Event) error
+
+type renderStreamField int
+
+const (
+	renderStreamDepUpdateCommand renderStreamField = iota
+	renderStreamDepUpdateStdout
+	renderStreamDepUpdateStderr
+	renderStreamHelmTemplateCommand
+	renderStreamHelmTemplateStderr
+)
+
+// renderStreamer coalesces the output of a chart render into RenderStreamEvents that
+// carry only the output produced since the last event, sending at most one event per
+// debounce interval
+type renderStreamer struct {
+	send      realtimeSender
+	recipient realtimetypes.Recipient
+	interval  time.Duration
+	now       func() time.Time
+
+	workspaceID   string
+	renderID      string
+	renderChartID string
+
+	sequence   int64
+	lastSentAt time.Time
+	pending    realtimetypes.RenderStreamEvent
+	hasPending bool
+}
+
+func newRenderStreamer(send realtimeSender, recipient realtimetypes.Recipient, workspaceID string, renderID string, renderChartID string) *renderStreamer {
+	return &renderStreamer{
+		send:          send,
+		recipient:     recipient,
+		interval:      renderStreamDebounce,
+		now:           time.Now,
+		workspaceID:   workspaceID,
+		renderID:      renderID,
+		renderChartID: renderChartID,
+	}
+}
+
+// append adds output to the next event without sending it
+func (s *renderStreamer) append(field renderStreamField, delta string) {
+	if delta == "" {
+		return
+	}
+
+	switch field {
+	case renderStreamDepUpdateCommand:
+		s.pending.DepUpdateCommand += delta
+	case renderStreamDepUpdateStdout:
+		s.pending.DepUpdateStdout += delta
+	case renderStreamDepUpdateStderr:
+		s.pending.DepUpdateStderr += delta
+	case renderStreamHelmTemplateCommand:
+		s.pending.HelmTemplateCommand += delta
+	case renderStreamHelmTemplateStderr:
+		s.pending.HelmTemplateStderr += delta
+	default:
+		return
+	}
+
+	s.hasPending = true
+}
+
+// maybeFlush sends the pending output if the debounce interval has passed since the last event
+func (s *renderStreamer) maybeFlush(ctx context.Context) error {
+	if !s.hasPending {
+		return nil
+	}
+	if s.now().Sub(s.lastSentAt) < s.interval {
+		return nil
+	}
+
+	return s.flush(ctx, nil)
+}
+
+// complete sends any pending output along with the completion time. This is always sent,
+// even if there is no pending output, so that clients know the chart has finished
+func (s *renderStreamer) complete(ctx context.Context, completedAt time.Time) error {
+	return s.flush(ctx, &completedAt)
+}
+
+// completeUnchanged sends the completion event of a chart that wasn't rendered because it didn't
+// change, with the reused output appended before it
+func (s *renderStreamer) completeUnchanged(ctx context.Context, completedAt time.Time) error {
+	s.pending.Status = realtimetypes.RenderStreamStatusSkippedUnchanged
+	return s.flush(ctx, &completedAt)
+}
+
+// appendWarnings adds helm template warnings to the next event without sending it
+func (s *renderStreamer) appendWarnings(warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+
+	s.pending.Warnings = append(s.pending.Warnings, warnings...)
+	s.hasPending = true
+}
+
+// setCompatibility sets the compatibility summary sent with the completion event
+func (s *renderStreamer) setCompatibility(summary string) {
+	s.pending.Compatibility = summary
+	s.hasPending = true
+}
+
+// fail records why the render failed, to be sent with the completion event
+func (s *renderStreamer) fail(reason string) {
+	s.pending.Error = reason
+	s.hasPending = true
+}
+
+func (s *renderStreamer) flush(ctx context.Context, completedAt *time.Time) error {
+	s.sequence++
+
+	e := s.pending
+	e.WorkspaceID = s.workspaceID
+	e.RenderID = s.renderID
+	e.RenderChartID = s.renderChartID
+	e.Sequence = s.sequence
+	e.CompletedAt = completedAt
+
+	s.pending = realtimetypes.RenderStreamEvent{}
+	s.hasPending = false
+	s.lastSentAt = s.now()
+
+	return s.send(ctx, s.recipient, e)
+}
@@ -0,0 +1,207 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRealtimeSender struct {
+	events []realtimetypes.RenderStreamEvent
+	sizes  []int
+}
+
+func (f *fakeRealtimeSender) send(ctx context.Context, r realtimetypes.Recipient, e realtimetypes.Event) error {
+	messageData, err := e.GetMessageData()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(messageData)
+	if err != nil {
+		return err
+	}
+
+	f.events = append(f.events, e.(realtimetypes.RenderStreamEvent))
+	f.sizes = append(f.sizes, len(b))
+	return nil
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestRenderStreamer(sender *fakeRealtimeSender, clock *fakeClock) *renderStreamer {
+	s := newRenderStreamer(sender.send, realtimetypes.Recipient{UserIDs: []string{"user"}}, "workspace", "render", "render-chart")
+	s.now = clock.Now
+	return s
+}
+
+func TestRenderStreamerSendsDeltas(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+	line := strings.Repeat("x", 100) + "\n"
+	chunks := 1000
+
+	for i := 0; i < chunks; i++ {
+		streamer.append(renderStreamDepUpdateStdout, line)
+		require.NoError(t, streamer.maybeFlush(ctx))
+		clock.now = clock.now.Add(renderStreamDebounce)
+	}
+	require.NoError(t, streamer.complete(ctx, clock.now))
+
+	require.Len(t, sender.events, chunks+1)
+
+	// every event is about the size of one chunk, rather than growing with the output
+	for i, size := range sender.sizes {
+		assert.Less(t, size, 2*len(line)+500, "event %d", i)
+	}
+
+	full := ""
+	for i, e := range sender.events {
+		assert.Equal(t, int64(i+1), e.Sequence)
+		full += e.DepUpdateStdout
+	}
+	assert.Equal(t, strings.Repeat(line, chunks), full)
+}
+
+func TestRenderStreamerDebounce(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+
+	// the first event goes out immediately
+	streamer.append(renderStreamDepUpdateCommand, "helm dependency update")
+	require.NoError(t, streamer.maybeFlush(ctx))
+	require.Len(t, sender.events, 1)
+
+	// a burst within the debounce interval is coalesced
+	for i := 0; i < 10; i++ {
+		clock.now = clock.now.Add(renderStreamDebounce / 20)
+		streamer.append(renderStreamDepUpdateStdout, "line\n")
+		require.NoError(t, streamer.maybeFlush(ctx))
+	}
+	require.Len(t, sender.events, 1)
+
+	clock.now = clock.now.Add(renderStreamDebounce)
+	require.NoError(t, streamer.maybeFlush(ctx))
+	require.Len(t, sender.events, 2)
+	assert.Equal(t, strings.Repeat("line\n", 10), sender.events[1].DepUpdateStdout)
+	assert.Empty(t, sender.events[1].DepUpdateCommand)
+
+	// nothing pending, nothing sent
+	clock.now = clock.now.Add(renderStreamDebounce)
+	require.NoError(t, streamer.maybeFlush(ctx))
+	require.Len(t, sender.events, 2)
+}
+
+func TestRenderStreamerCompleteSendsOnce(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+
+	require.NoError(t, streamer.maybeFlush(ctx))
+	streamer.append(renderStreamHelmTemplateStderr, "warning")
+	require.NoError(t, streamer.complete(ctx, clock.now))
+
+	require.Len(t, sender.events, 1)
+	completed := 0
+	for _, e := range sender.events {
+		if e.CompletedAt != nil {
+			completed++
+		}
+	}
+	assert.Equal(t, 1, completed)
+	assert.Equal(t, "warning", sender.events[0].HelmTemplateStderr)
+	assert.Equal(t, "workspace", sender.events[0].WorkspaceID)
+	assert.Equal(t, "render", sender.events[0].RenderID)
+	assert.Equal(t, "render-chart", sender.events[0].RenderChartID)
+}
+
+func TestRenderStreamerFailSendsReasonOnCompletion(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+
+	streamer.append(renderStreamDepUpdateStderr, "--- retry 1 ---\n")
+	streamer.fail("unknown repository, add it with helm repo add or use a repository URL (deterministic)")
+	require.NoError(t, streamer.complete(ctx, clock.now))
+
+	require.Len(t, sender.events, 1)
+	assert.NotNil(t, sender.events[0].CompletedAt)
+	assert.Equal(t, "--- retry 1 ---\n", sender.events[0].DepUpdateStderr)
+	assert.Contains(t, sender.events[0].Error, "unknown repository")
+}
+
+func TestRenderStreamerSendsCompatibilityOnCompletion(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+
+	streamer.setCompatibility("compatible with Kubernetes 1.24 and earlier, 1 resource uses deprecated or removed APIs")
+	require.NoError(t, streamer.complete(ctx, clock.now))
+
+	require.Len(t, sender.events, 1)
+	assert.NotNil(t, sender.events[0].CompletedAt)
+	assert.Equal(t, "compatible with Kubernetes 1.24 and earlier, 1 resource uses deprecated or removed APIs", sender.events[0].Compatibility)
+}
+
+func TestRenderStreamerSendsNewWarnings(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+
+	streamer.appendWarnings([]string{"WARNING: This chart is deprecated"})
+	require.NoError(t, streamer.maybeFlush(ctx))
+	clock.now = clock.now.Add(renderStreamDebounce)
+
+	streamer.appendWarnings(nil)
+	streamer.appendWarnings([]string{"coalesce.go:286: warning: cannot overwrite table with non table for redis.master"})
+	require.NoError(t, streamer.complete(ctx, clock.now))
+
+	require.Len(t, sender.events, 2)
+	assert.Equal(t, []string{"WARNING: This chart is deprecated"}, sender.events[0].Warnings)
+	assert.Equal(t, []string{"coalesce.go:286: warning: cannot overwrite table with non table for redis.master"}, sender.events[1].Warnings)
+	assert.Empty(t, sender.events[1].Error)
+}
+
+func TestRenderStreamerCompleteUnchanged(t *testing.T) {
+	sender := &fakeRealtimeSender{}
+	clock := &fakeClock{now: time.Now()}
+	streamer := newTestRenderStreamer(sender, clock)
+
+	ctx := context.Background()
+
+	streamer.append(renderStreamHelmTemplateCommand, "helm template chartsmith .")
+	streamer.appendWarnings([]string{"WARNING: This chart is deprecated"})
+	require.NoError(t, streamer.completeUnchanged(ctx, clock.now))
+
+	require.Len(t, sender.events, 1)
+	assert.Equal(t, int64(1), sender.events[0].Sequence)
+	assert.Equal(t, realtimetypes.RenderStreamStatusSkippedUnchanged, sender.events[0].Status)
+	assert.NotNil(t, sender.events[0].CompletedAt)
+	assert.Equal(t, "helm template chartsmith .", sender.events[0].HelmTemplateCommand)
+	assert.Equal(t, []string{"WARNING: This chart is deprecated"}, sender.events[0].Warnings)
+}
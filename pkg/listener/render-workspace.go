@@ -3,6 +3,7 @@ package listener
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime/debug"
 	"strings"
@@ -10,9 +11,12 @@ import (
 	"time"
 
 	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/replicatedhq/chartsmith/pkg/realtime"
 	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/slack"
 	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"go.uber.org/zap"
@@ -24,10 +28,20 @@ type renderWorkspacePayload struct {
 	RevisionNumber    int    `json:"revisionNumber"`
 	ChatMessageID     string `json:"chatMessageId"`
 	UsePendingContent *bool  `json:"usePendingContent"`
+	ForceAll          bool   `json:"forceAll"`
+	ValuesProfile     string `json:"valuesProfile"`
+	Debug             bool   `json:"debug"`
 }
 
 // Note: ensureActiveConnection is now defined in heartbeat.go
 
+// checkRenderConnection and getRendered are vars so that tests can observe the context a render
+// is handled with
+var (
+	checkRenderConnection = ensureActiveConnection
+	getRendered           = workspace.GetRendered
+)
+
 func handleRenderWorkspaceNotification(ctx context.Context, payload string) error {
 	startTime := time.Now()
 
@@ -35,13 +49,15 @@ func handleRenderWorkspaceNotification(ctx context.Context, payload string) erro
 	defer func() {
 		if r := recover(); r != nil {
 			err := fmt.Errorf("PANIC in handleRenderWorkspaceNotification: %v", r)
-			logger.Error(err)
-			logger.Error(fmt.Errorf("Stack trace (if available):\n%s", string(debug.Stack())))
+			logger.ErrorCtx(ctx, err)
+			logger.ErrorCtx(ctx, fmt.Errorf("Stack trace (if available):\n%s", string(debug.Stack())))
 		}
 	}()
 
+	timeouts := param.GetTimeouts()
+
 	// Create a timeout context to ensure we don't hang indefinitely
-	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Minute) // Increased timeout to 10 minutes
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeouts.RenderTotal)
 	defer cancel()
 
 	// Use a separate shorter timeout just for the connection check
@@ -49,7 +65,7 @@ func handleRenderWorkspaceNotification(ctx context.Context, payload string) erro
 	defer connCheckCancel()
 
 	// Verify connection is active before proceeding
-	if err := ensureActiveConnection(connCheckCtx); err != nil {
+	if err := checkRenderConnection(connCheckCtx); err != nil {
 		logger.Error(fmt.Errorf("connection check failed before processing notification: %w", err))
 		// Continue anyway, as we're using a fresh connection below
 	}
@@ -65,38 +81,54 @@ func handleRenderWorkspaceNotification(ctx context.Context, payload string) erro
 			zap.String("payload", payload))
 		return fmt.Errorf("failed to unmarshal render workspace notification: %w", err)
 	}
+	if p.ID != "" {
+		ctx = logger.WithFields(ctx, zap.String("renderID", p.ID))
+	} else {
+		ctx = logger.WithFields(ctx, zap.String("workspaceID", p.WorkspaceID))
+	}
 
 	// Handle request from TypeScript side with workspaceId and revisionNumber
 	if p.ID == "" && p.WorkspaceID != "" && p.RevisionNumber > 0 {
 		// Create a new render job for this workspace/revision
 		chatMessageID := p.ChatMessageID // Use the provided chat message ID
-		if err := workspace.EnqueueRenderWorkspaceForRevision(ctx, p.WorkspaceID, p.RevisionNumber, chatMessageID); err != nil {
+		enqueue := workspace.EnqueueRenderWorkspaceForRevision
+		if p.ForceAll {
+			enqueue = workspace.EnqueueFullRenderWorkspaceForRevision
+		}
+		if p.ValuesProfile != "" {
+			enqueue = func(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string) error {
+				return workspace.EnqueueRenderWorkspaceWithValuesProfile(ctx, workspaceID, revisionNumber, chatMessageID, p.ValuesProfile)
+			}
+		}
+		if p.Debug {
+			enqueue = func(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string) error {
+				return workspace.EnqueueDebugRenderWorkspace(ctx, workspaceID, revisionNumber, chatMessageID, p.ValuesProfile)
+			}
+		}
+		if err := enqueue(ctx, p.WorkspaceID, p.RevisionNumber, chatMessageID); err != nil {
 			return fmt.Errorf("failed to enqueue render job from TS request: %w", err)
 		}
 		return nil
 	}
 
-	renderedWorkspace, err := workspace.GetRendered(ctx, p.ID)
+	renderedWorkspace, err := getRendered(timeoutCtx, p.ID)
 
 	if err != nil {
-		logger.Error(fmt.Errorf("failed to get rendered: %w", err))
+		logger.ErrorCtx(ctx, fmt.Errorf("failed to get rendered: %w", err))
 		if strings.Contains(err.Error(), "context deadline exceeded") ||
 			strings.Contains(err.Error(), "context canceled") {
-			logger.Error(fmt.Errorf("timeout fetching render job, marking as failed: %w", err),
-				zap.String("renderID", p.ID))
+			logger.ErrorCtx(ctx, fmt.Errorf("timeout fetching render job, marking as failed: %w", err))
 			// Try to mark the render as failed and return
 			workspace.FailRendered(context.Background(), p.ID, "Timeout fetching render data")
 			return fmt.Errorf("timeout fetching render job: %w", err)
 		}
 
-		logger.Error(fmt.Errorf("failed to get rendered: %w", err),
-			zap.String("renderID", p.ID))
+		logger.ErrorCtx(ctx, fmt.Errorf("failed to get rendered: %w", err))
 		return fmt.Errorf("failed to get rendered job with ID %s: %w", p.ID, err)
 	}
 
-	logger.Info("Successfully retrieved render job",
-		zap.String("renderID", p.ID),
-		zap.String("workspaceID", renderedWorkspace.WorkspaceID),
+	ctx = logger.WithFields(ctx, zap.String("workspaceID", renderedWorkspace.WorkspaceID))
+	logger.InfoCtx(ctx, "Successfully retrieved render job",
 		zap.Int("chartCount", len(renderedWorkspace.Charts)),
 	)
 
@@ -104,18 +136,47 @@ func handleRenderWorkspaceNotification(ctx context.Context, payload string) erro
 	if err != nil {
 		if strings.Contains(err.Error(), "context deadline exceeded") ||
 			strings.Contains(err.Error(), "context canceled") {
-			logger.Error(fmt.Errorf("timeout fetching workspace, marking render as failed: %w", err),
-				zap.String("workspaceID", renderedWorkspace.WorkspaceID))
+			logger.ErrorCtx(ctx, fmt.Errorf("timeout fetching workspace, marking render as failed: %w", err))
 			// Try to mark the render as failed and return
 			workspace.FailRendered(context.Background(), p.ID, "Timeout fetching workspace data")
 			return fmt.Errorf("timeout fetching workspace: %w", err)
 		}
 
-		logger.Error(fmt.Errorf("failed to get workspace: %w", err),
-			zap.String("workspaceID", renderedWorkspace.WorkspaceID))
+		logger.ErrorCtx(ctx, fmt.Errorf("failed to get workspace: %w", err))
 		return fmt.Errorf("failed to get workspace for render: %w", err)
 	}
 
+	renderAudit := map[string]interface{}{
+		"renderId":       renderedWorkspace.ID,
+		"revisionNumber": renderedWorkspace.RevisionNumber,
+	}
+	if renderedWorkspace.ValuesProfile != "" {
+		renderAudit["valuesProfile"] = renderedWorkspace.ValuesProfile
+	}
+	renderFailed := func(reason string) {
+		payload := map[string]interface{}{"error": reason}
+		for k, v := range renderAudit {
+			payload[k] = v
+		}
+		recordAudit(context.Background(), w.ID, workspace.AuditActorSystem, workspace.AuditRenderFailed, payload)
+	}
+	recordAudit(ctx, w.ID, workspace.AuditActorSystem, workspace.AuditRenderStarted, renderAudit)
+
+	usePendingContent := p.UsePendingContent != nil && *p.UsePendingContent
+
+	// charts with no file changes since the parent revision reuse the previous render
+	changedCharts := map[string]bool{}
+	renderAll := p.ForceAll || renderedWorkspace.RevisionNumber == 0 || renderedWorkspace.ValuesProfile != "" || renderedWorkspace.IsDebug
+	if !renderAll {
+		changedFiles, err := workspace.ListChangedFilesBetweenRevisions(ctx, w.ID, renderedWorkspace.RevisionNumber-1, renderedWorkspace.RevisionNumber, usePendingContent)
+		if err != nil {
+			logger.WarnCtx(ctx, "failed to list changed files, rendering all charts", zap.Error(err))
+			renderAll = true
+		} else {
+			changedCharts = workspace.ChartsWithChanges(changedFiles)
+		}
+	}
+
 	// we need to render each chart in separate goroutines
 	// and create a sync group to wait for them all to complete
 	wg := sync.WaitGroup{}
@@ -127,21 +188,28 @@ func handleRenderWorkspaceNotification(ctx context.Context, payload string) erro
 		wg.Add(1)
 		go func(chart workspacetypes.RenderedChart) {
 			defer wg.Done()
-
-			usePendingContent := p.UsePendingContent != nil && *p.UsePendingContent
+			ctx := logger.WithFields(ctx, zap.String("chartID", chart.ChartID), zap.String("renderChartID", chart.ID))
+
+			if !renderAll && !changedCharts[chart.ChartID] {
+				reused, err := reuseRenderedChart(ctx, &chart, renderedWorkspace, w)
+				if err != nil {
+					logger.ErrorCtx(ctx, err)
+					errorChan <- err
+					return
+				}
+				if reused {
+					return
+				}
+			}
 
 			if err := renderChart(ctx, &chart, renderedWorkspace, w, usePendingContent); err != nil {
-				logger.Error(err)
+				logger.ErrorCtx(ctx, err)
 				errorChan <- err
 			}
 		}(chart)
 	}
 
-	// Create a timeout for waiting on goroutines - 8 minutes (keeping 2 minutes for finalization)
-	renderTimeout := 8 * time.Minute
-	renderTimeoutTimer := time.NewTimer(renderTimeout)
-	defer renderTimeoutTimer.Stop()
-
+	// each chart fails itself when helm stalls or renders for too long, see watchRenderHeartbeats
 	// Create a channel for completion
 	waitDone := make(chan struct{})
 	go func() {
@@ -152,68 +220,151 @@ func handleRenderWorkspaceNotification(ctx context.Context, payload string) erro
 	// Wait for either completion, errors, or timeout
 	select {
 	case <-waitDone:
-		logger.Info("All chart renders completed successfully",
-			zap.String("renderID", renderedWorkspace.ID),
+		logger.InfoCtx(ctx, "All chart renders completed successfully",
 			zap.Duration("duration", time.Since(startTime)),
 		)
 	case err := <-errorChan:
-		logger.Error(fmt.Errorf("chart render failed: %w", err),
-			zap.String("renderID", renderedWorkspace.ID),
+		logger.ErrorCtx(ctx, fmt.Errorf("chart render failed: %w", err),
 			zap.Duration("elapsedTime", time.Since(startTime)),
 		)
 		// Mark the render as failed
 		workspace.FailRendered(context.Background(), renderedWorkspace.ID, err.Error())
+		renderFailed(err.Error())
 		return fmt.Errorf("chart render failed: %w", err)
-	case <-renderTimeoutTimer.C:
-		logger.Error(fmt.Errorf("timeout waiting for chart renders to complete"),
-			zap.String("renderID", renderedWorkspace.ID),
-			zap.Duration("elapsedTime", time.Since(startTime)),
-			zap.Duration("timeout", renderTimeout),
-		)
-		// Mark the render as failed
-		workspace.FailRendered(context.Background(), renderedWorkspace.ID, "Render operation timed out")
-		return fmt.Errorf("timeout waiting for chart renders to complete")
 	case <-timeoutCtx.Done():
-		logger.Error(fmt.Errorf("context canceled during render operation"),
-			zap.String("renderID", renderedWorkspace.ID),
+		logger.ErrorCtx(ctx, fmt.Errorf("context canceled during render operation"),
 			zap.Duration("elapsedTime", time.Since(startTime)),
 		)
 		// Mark the render as failed
 		workspace.FailRendered(context.Background(), renderedWorkspace.ID, "Context canceled during render")
+		renderFailed("Context canceled during render")
 		return fmt.Errorf("context canceled during render operation")
 	}
 
 	// Create a new timeout context for the final database operation
-	finishCtx, finishCancel := context.WithTimeout(ctx, 30*time.Second)
+	finishCtx, finishCancel := context.WithTimeout(ctx, timeouts.DBOperation)
 	defer finishCancel()
 
 	if err := workspace.FinishRendered(finishCtx, renderedWorkspace.ID); err != nil {
 		if strings.Contains(err.Error(), "context deadline exceeded") ||
 			strings.Contains(err.Error(), "context canceled") {
-			logger.Error(fmt.Errorf("timeout finalizing render: %w", err),
-				zap.String("renderID", renderedWorkspace.ID))
+			logger.ErrorCtx(ctx, fmt.Errorf("timeout finalizing render: %w", err))
 			// Try one more time with a background context
 			if finalErr := workspace.FinishRendered(context.Background(), renderedWorkspace.ID); finalErr != nil {
-				logger.Error(fmt.Errorf("final attempt to finish render failed: %w", finalErr),
-					zap.String("renderID", renderedWorkspace.ID))
+				logger.ErrorCtx(ctx, fmt.Errorf("final attempt to finish render failed: %w", finalErr))
 				return fmt.Errorf("timeout finalizing render: %w", err)
 			}
 		} else {
-			logger.Error(fmt.Errorf("failed to finish rendered workspace: %w", err),
-				zap.String("renderID", renderedWorkspace.ID))
+			logger.ErrorCtx(ctx, fmt.Errorf("failed to finish rendered workspace: %w", err))
 			return fmt.Errorf("failed to finish rendered workspace: %w", err)
 		}
 	}
 
+	recordAudit(ctx, w.ID, workspace.AuditActorSystem, workspace.AuditRenderFinished, renderAudit)
+
+	inventoryCtx, inventoryCancel := context.WithTimeout(ctx, timeouts.DBOperation)
+	defer inventoryCancel()
+	recordRenderInventory(inventoryCtx, renderedWorkspace.ID)
+
+	compatibilityCtx, compatibilityCancel := context.WithTimeout(ctx, timeouts.DBOperation)
+	defer compatibilityCancel()
+	recordRenderCompatibility(compatibilityCtx, renderedWorkspace.ID, usePendingContent)
+
+	healthCtx, healthCancel := context.WithTimeout(ctx, timeouts.DBOperation)
+	defer healthCancel()
+	recordRenderHealth(healthCtx, w, renderedWorkspace.ID)
+
 	return nil
 }
 
+// these are vars so that recording the inventory and compatibility can be tested without a database
+// or realtime server
+var (
+	setRenderedInventory     = workspace.SetRenderedInventory
+	setRenderedCompatibility = workspace.SetRenderedCompatibility
+	listRenderChartFiles     = workspace.ListFiles
+	listRenderUserIDs        = workspace.ListUserIDsForWorkspace
+	sendRenderEvent          = realtime.SendEvent
+)
+
+// recordRenderInventory builds the inventory of a completed render from the output of its charts,
+// stores it on the render and sends it to the workspace. The render is complete either way, so
+// failures are only logged.
+func recordRenderInventory(ctx context.Context, renderID string) {
+	rendered, err := getRendered(ctx, renderID)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to get render for inventory", zap.Error(err))
+		return
+	}
+
+	manifests := []string{}
+	for _, chart := range rendered.Charts {
+		if chart.IsSuccess {
+			manifests = append(manifests, chart.HelmTemplateStdout)
+		}
+	}
+	inventory := workspace.BuildRenderInventory(manifests...)
+
+	if err := setRenderedInventory(ctx, renderID, inventory); err != nil {
+		logger.WarnCtx(ctx, "Failed to store render inventory", zap.Error(err))
+		return
+	}
+
+	userIDs, err := listRenderUserIDs(ctx, rendered.WorkspaceID)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to list users for render inventory", zap.Error(err))
+		return
+	}
+	e := realtimetypes.RenderInventoryEvent{
+		WorkspaceID: rendered.WorkspaceID,
+		RenderID:    renderID,
+		Inventory:   inventory,
+	}
+	if err := sendRenderEvent(ctx, realtimetypes.Recipient{UserIDs: userIDs}, e); err != nil {
+		logger.WarnCtx(ctx, "Failed to send render inventory event", zap.Error(err))
+	}
+}
+
+// recordRenderCompatibility checks which Kubernetes versions the output of a completed render can be
+// installed on, and which of its charts' templates use deprecated or removed APIs, and stores the
+// report on the render. Failures are only logged, like the inventory's.
+func recordRenderCompatibility(ctx context.Context, renderID string, usePendingContent bool) {
+	rendered, err := getRendered(ctx, renderID)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to get render for compatibility", zap.Error(err))
+		return
+	}
+
+	manifests := []string{}
+	templates := map[string]string{}
+	for _, chart := range rendered.Charts {
+		if !chart.IsSuccess {
+			continue
+		}
+		manifests = append(manifests, chart.HelmTemplateStdout)
+
+		files, err := listRenderChartFiles(ctx, rendered.WorkspaceID, rendered.RevisionNumber, chart.ChartID)
+		if err != nil {
+			logger.WarnCtx(ctx, "Failed to list chart files for compatibility", zap.String("chartID", chart.ChartID), zap.Error(err))
+			return
+		}
+		for path, content := range workspace.ChartTemplates(files, usePendingContent) {
+			templates[path] = content
+		}
+	}
+	compatibility := workspace.CheckRenderCompatibility(manifests, templates)
+
+	if err := setRenderedCompatibility(ctx, renderID, compatibility); err != nil {
+		logger.WarnCtx(ctx, "Failed to store render compatibility", zap.Error(err))
+	}
+}
+
 func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChart, renderedWorkspace *workspacetypes.Rendered, w *workspacetypes.Workspace, usePendingContent bool) error {
 	// Add panic recovery
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error(fmt.Errorf("PANIC in renderChart: %v", r))
-			logger.Error(fmt.Errorf("Stack trace (if available):\n%s", string(debug.Stack())))
+			logger.ErrorCtx(ctx, fmt.Errorf("PANIC in renderChart: %v", r))
+			logger.ErrorCtx(ctx, fmt.Errorf("Stack trace (if available):\n%s", string(debug.Stack())))
 		}
 	}()
 
@@ -227,9 +378,7 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 
 	if chart == nil {
 		err := fmt.Errorf("chart ID %s not found in workspace %s", renderedChart.ChartID, w.ID)
-		logger.Error(err,
-			zap.String("chartID", renderedChart.ChartID),
-			zap.String("workspaceID", w.ID))
+		logger.ErrorCtx(ctx, err)
 
 		// Update the rendered chart to mark it as failed
 		workspace.FinishRenderedChart(context.Background(), renderedChart.ID,
@@ -240,7 +389,7 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 	}
 
 	// Create a shorter timeout for database operations
-	dbCtx, dbCancel := context.WithTimeout(ctx, 30*time.Second)
+	dbCtx, dbCancel := context.WithTimeout(ctx, param.GetTimeouts().DBOperation)
 	defer dbCancel()
 
 	userIDs, err := workspace.ListUserIDsForWorkspace(dbCtx, w.ID)
@@ -253,7 +402,7 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 			err = fmt.Errorf("failed to list user IDs for workspace: %w", err)
 		}
 
-		logger.Error(err, zap.String("workspaceID", w.ID))
+		logger.ErrorCtx(ctx, err)
 
 		// Update the rendered chart to mark it as failed
 		workspace.FinishRenderedChart(context.Background(), renderedChart.ID,
@@ -274,24 +423,45 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 		HelmTemplateCmd:    make(chan string, 1),
 		HelmTemplateStderr: make(chan string, 1),
 		HelmTemplateStdout: make(chan string, 1),
+		Heartbeat:          make(chan helmutils.RenderHeartbeat, 1),
+		Notes:              make(chan helmutils.RenderNotes, 1),
 
 		Done: make(chan error),
 	}
+	if renderedWorkspace.IsDebug {
+		renderChannels.Debug = make(chan workspacetypes.RenderDebug, 1)
+	}
 
-	done := make(chan error)
-	go func(usePendingContent bool) {
-		files := chart.Files
+	valuesYAML, err := valuesProfileContent(dbCtx, w.ID, chart.ID, renderedWorkspace.ValuesProfile)
+	if err != nil {
+		logger.ErrorCtx(ctx, err)
 
-		err := helmutils.RenderChartExec(files, "", renderChannels)
-		if err != nil {
-			done <- err
-			return
-		}
-		done <- nil
-	}(usePendingContent)
+		workspace.FinishRenderedChart(context.Background(), renderedChart.ID,
+			"", "", "", "", "",
+			fmt.Sprintf("Failed to load values profile %s: %v", renderedWorkspace.ValuesProfile, err), false)
+
+		return err
+	}
+
+	// the chart fails when helm stops writing output, or at the absolute maximum
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+	timeouts := param.GetTimeouts()
+	renderStalled := watchRenderHeartbeats(watchCtx, renderChannels.Heartbeat, timeouts.RenderStall, timeouts.RenderChart)
+
+	// helm is killed when the chart is given up on, and what the render still sends is drained
+	renderCtx, cancelRender := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	defer func() {
+		cancelRender()
+		go drainRenderChannels(renderChannels, done)
+	}()
+	go func() {
+		done <- helmutils.RenderChartExec(renderCtx, renderedChart.ID, chart.Files, valuesYAML, renderChannels)
+	}()
 
 	// Create a new context just for database operations
-	filesCtx, filesCancel := context.WithTimeout(ctx, 30*time.Second)
+	filesCtx, filesCancel := context.WithTimeout(ctx, param.GetTimeouts().DBOperation)
 	defer filesCancel()
 
 	workspaceFiles, err := workspace.ListFiles(filesCtx, w.ID, renderedWorkspace.RevisionNumber, chart.ID)
@@ -304,7 +474,7 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 			err = fmt.Errorf("failed to list files: %w", err)
 		}
 
-		logger.Error(err)
+		logger.ErrorCtx(ctx, err)
 
 		// Update the rendered chart to mark it as failed
 		workspace.FinishRenderedChart(context.Background(), renderedChart.ID,
@@ -316,44 +486,57 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 
 	renderedFiles := []workspacetypes.RenderedFile{}
 
+	streamer := newRenderStreamer(realtime.SendEvent, realtimeRecipient, w.ID, renderedWorkspace.ID, renderedChart.ID)
+
+	flushTicker := time.NewTicker(renderStreamDebounce)
+	defer flushTicker.Stop()
+
 	for {
 		select {
 		case err := <-renderChannels.Done:
+			// the debug output is sent before Done and can still be buffered
+			select {
+			case debug := <-renderChannels.Debug:
+				if err := setRenderedChartDebug(ctx, renderedChart, debug); err != nil {
+					return err
+				}
+			default:
+			}
+
 			isSuccess := true
 			if err != nil {
 				isSuccess = false
-				logger.Errorf("Render error: %v", err)
+				logger.ErrorCtx(ctx, fmt.Errorf("render error: %w", err))
+				streamer.fail(err.Error())
+				if notifyErr := slack.NotifyRenderFailed(ctx, w.ID, renderedWorkspace.RevisionNumber, err); notifyErr != nil {
+					logger.ErrorCtx(ctx, fmt.Errorf("failed to notify slack of render failure: %w", notifyErr))
+				}
 			}
 
 			if err := workspace.FinishRenderedChart(ctx, renderedChart.ID, renderedChart.DepupdateCommand, renderedChart.DepupdateStdout, renderedChart.DepupdateStderr, renderedChart.HelmTemplateCommand, renderedChart.HelmTemplateStdout, renderedChart.HelmTemplateStderr, isSuccess); err != nil {
 				return fmt.Errorf("failed to finish rendered chart: %w", err)
 			}
 
-			now := time.Now()
-			e := realtimetypes.RenderStreamEvent{
-				WorkspaceID:         w.ID,
-				RenderID:            renderedWorkspace.ID,
-				RenderChartID:       renderedChart.ID,
-				DepUpdateCommand:    renderedChart.DepupdateCommand,
-				DepUpdateStdout:     renderedChart.DepupdateStdout,
-				DepUpdateStderr:     renderedChart.DepupdateStderr,
-				HelmTemplateCommand: renderedChart.HelmTemplateCommand,
-				HelmTemplateStdout:  renderedChart.HelmTemplateStdout,
-				HelmTemplateStderr:  renderedChart.HelmTemplateStderr,
-				CompletedAt:         &now,
+			updatedRenderedFiles, err := parseRenderedFiles(ctx, renderedChart.HelmTemplateStdout, chart.Name, &renderedFiles, workspaceFiles)
+			if err != nil {
+				return fmt.Errorf("failed to parse rendered files: %w", err)
 			}
 
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
-				return fmt.Errorf("failed to send render stream event: %w", err)
-			}
+			if isSuccess {
+				if problems := integrations.ValidateRender(ctx, w, workspaceFiles, renderedFiles); len(problems) > 0 {
+					renderedChart.HelmTemplateWarnings = append(renderedChart.HelmTemplateWarnings, problems...)
+					streamer.appendWarnings(problems)
+					if err := workspace.SetRenderedChartHelmTemplateWarnings(ctx, renderedChart.ID, renderedChart.HelmTemplateWarnings); err != nil {
+						return fmt.Errorf("failed to set rendered chart helmTemplateWarnings: %w", err)
+					}
+				}
 
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
-				return fmt.Errorf("failed to send render stream event: %w", err)
+				compatibility := workspace.CheckRenderCompatibility([]string{renderedChart.HelmTemplateStdout}, workspace.ChartTemplates(workspaceFiles, usePendingContent))
+				streamer.setCompatibility(compatibility.Summary)
 			}
 
-			updatedRenderedFiles, err := parseRenderedFiles(ctx, renderedChart.HelmTemplateStdout, chart.Name, &renderedFiles, workspaceFiles)
-			if err != nil {
-				return fmt.Errorf("failed to parse rendered files: %w", err)
+			if err := streamer.complete(ctx, time.Now()); err != nil {
+				return fmt.Errorf("failed to send render stream event: %w", err)
 			}
 
 			for _, file := range updatedRenderedFiles {
@@ -370,29 +553,72 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 					}
 				}
 
-				if err := workspace.SetRenderedFileContents(ctx, w.ID, renderedWorkspace.RevisionNumber, file.FilePath, file.RenderedContent); err != nil {
-					return fmt.Errorf("failed to set rendered file contents: %w", err)
+				if err := setRenderedFileContents(ctx, renderedWorkspace, renderedChart, file); err != nil {
+					return err
 				}
 			}
 
 			return nil
 
-		case depUpdateCommand := <-renderChannels.DepUpdateCmd:
-			renderedChart.DepupdateCommand += depUpdateCommand
+		case err := <-renderStalled:
+			logger.ErrorCtx(ctx, fmt.Errorf("chart render failed: %w", err))
+
+			renderedChart.HelmTemplateStderr += err.Error() + "\n"
+			streamer.fail(err.Error())
+			if notifyErr := slack.NotifyRenderFailed(ctx, w.ID, renderedWorkspace.RevisionNumber, err); notifyErr != nil {
+				logger.ErrorCtx(ctx, fmt.Errorf("failed to notify slack of render failure: %w", notifyErr))
+			}
+
+			if finishErr := workspace.FinishRenderedChart(context.Background(), renderedChart.ID, renderedChart.DepupdateCommand, renderedChart.DepupdateStdout, renderedChart.DepupdateStderr, renderedChart.HelmTemplateCommand, renderedChart.HelmTemplateStdout, renderedChart.HelmTemplateStderr, false); finishErr != nil {
+				logger.ErrorCtx(ctx, fmt.Errorf("failed to finish rendered chart: %w", finishErr))
+			}
+			if sendErr := streamer.complete(ctx, time.Now()); sendErr != nil {
+				logger.ErrorCtx(ctx, fmt.Errorf("failed to send render stream event: %w", sendErr))
+			}
 
-			e := realtimetypes.RenderStreamEvent{
-				WorkspaceID:         w.ID,
-				RenderID:            renderedWorkspace.ID,
-				RenderChartID:       renderedChart.ID,
-				DepUpdateCommand:    renderedChart.DepupdateCommand,
-				DepUpdateStdout:     renderedChart.DepupdateStdout,
-				DepUpdateStderr:     renderedChart.DepupdateStderr,
-				HelmTemplateCommand: renderedChart.HelmTemplateCommand,
-				HelmTemplateStdout:  renderedChart.HelmTemplateStdout,
-				HelmTemplateStderr:  renderedChart.HelmTemplateStderr,
+			return err
+
+		case <-flushTicker.C:
+			if err := streamer.maybeFlush(ctx); err != nil {
+				return fmt.Errorf("failed to send render stream event: %w", err)
+			}
+
+		case debug := <-renderChannels.Debug:
+			if err := setRenderedChartDebug(ctx, renderedChart, debug); err != nil {
+				return err
+			}
+
+		case notes := <-renderChannels.Notes:
+			renderedChart.Notes = notes.Notes
+			if err := workspace.SetRenderedChartNotes(ctx, renderedChart.ID, renderedChart.Notes); err != nil {
+				return fmt.Errorf("failed to set rendered chart notes: %w", err)
 			}
 
+			// a NOTES.txt that doesn't render is a warning, the render still succeeds
+			if notes.Warning != "" {
+				renderedChart.HelmTemplateWarnings = append(renderedChart.HelmTemplateWarnings, notes.Warning)
+				streamer.appendWarnings([]string{notes.Warning})
+				if err := workspace.SetRenderedChartHelmTemplateWarnings(ctx, renderedChart.ID, renderedChart.HelmTemplateWarnings); err != nil {
+					return fmt.Errorf("failed to set rendered chart helmTemplateWarnings: %w", err)
+				}
+			}
+
+			e := realtimetypes.RenderNotesEvent{
+				WorkspaceID:   w.ID,
+				RenderID:      renderedWorkspace.ID,
+				RenderChartID: renderedChart.ID,
+				Notes:         notes.Notes,
+				Warning:       notes.Warning,
+			}
 			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+				return fmt.Errorf("failed to send render notes event: %w", err)
+			}
+
+		case depUpdateCommand := <-renderChannels.DepUpdateCmd:
+			renderedChart.DepupdateCommand += depUpdateCommand
+			streamer.append(renderStreamDepUpdateCommand, depUpdateCommand)
+
+			if err := streamer.maybeFlush(ctx); err != nil {
 				return fmt.Errorf("failed to send render stream event: %w", err)
 			}
 
@@ -402,20 +628,9 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 
 		case depUpdateStdout := <-renderChannels.DepUpdateStdout:
 			renderedChart.DepupdateStdout += depUpdateStdout
+			streamer.append(renderStreamDepUpdateStdout, depUpdateStdout)
 
-			e := realtimetypes.RenderStreamEvent{
-				WorkspaceID:         w.ID,
-				RenderID:            renderedWorkspace.ID,
-				RenderChartID:       renderedChart.ID,
-				DepUpdateCommand:    renderedChart.DepupdateCommand,
-				DepUpdateStdout:     renderedChart.DepupdateStdout,
-				DepUpdateStderr:     renderedChart.DepupdateStderr,
-				HelmTemplateCommand: renderedChart.HelmTemplateCommand,
-				HelmTemplateStdout:  renderedChart.HelmTemplateStdout,
-				HelmTemplateStderr:  renderedChart.HelmTemplateStderr,
-			}
-
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+			if err := streamer.maybeFlush(ctx); err != nil {
 				return fmt.Errorf("failed to send render stream event: %w", err)
 			}
 
@@ -425,20 +640,9 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 
 		case depUpdateStderr := <-renderChannels.DepUpdateStderr:
 			renderedChart.DepupdateStderr += depUpdateStderr
+			streamer.append(renderStreamDepUpdateStderr, depUpdateStderr)
 
-			e := realtimetypes.RenderStreamEvent{
-				WorkspaceID:         w.ID,
-				RenderChartID:       renderedChart.ID,
-				RenderID:            renderedWorkspace.ID,
-				DepUpdateCommand:    renderedChart.DepupdateCommand,
-				DepUpdateStdout:     renderedChart.DepupdateStdout,
-				DepUpdateStderr:     renderedChart.DepupdateStderr,
-				HelmTemplateCommand: renderedChart.HelmTemplateCommand,
-				HelmTemplateStdout:  renderedChart.HelmTemplateStdout,
-				HelmTemplateStderr:  renderedChart.HelmTemplateStderr,
-			}
-
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+			if err := streamer.maybeFlush(ctx); err != nil {
 				return fmt.Errorf("failed to send render stream event: %w", err)
 			}
 
@@ -448,20 +652,9 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 
 		case helmTemplateCommand := <-renderChannels.HelmTemplateCmd:
 			renderedChart.HelmTemplateCommand += helmTemplateCommand
+			streamer.append(renderStreamHelmTemplateCommand, helmTemplateCommand)
 
-			e := realtimetypes.RenderStreamEvent{
-				WorkspaceID:         w.ID,
-				RenderID:            renderedWorkspace.ID,
-				RenderChartID:       renderedChart.ID,
-				DepUpdateCommand:    renderedChart.DepupdateCommand,
-				DepUpdateStdout:     renderedChart.DepupdateStdout,
-				DepUpdateStderr:     renderedChart.DepupdateStderr,
-				HelmTemplateCommand: renderedChart.HelmTemplateCommand,
-				HelmTemplateStdout:  renderedChart.HelmTemplateStdout,
-				HelmTemplateStderr:  renderedChart.HelmTemplateStderr,
-			}
-
-			if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+			if err := streamer.maybeFlush(ctx); err != nil {
 				return fmt.Errorf("failed to send render stream event: %w", err)
 			}
 
@@ -497,8 +690,8 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 					}
 				}
 
-				if err := workspace.SetRenderedFileContents(ctx, w.ID, renderedWorkspace.RevisionNumber, file.FilePath, file.RenderedContent); err != nil {
-					return fmt.Errorf("failed to set rendered file contents: %w", err)
+				if err := setRenderedFileContents(ctx, renderedWorkspace, renderedChart, file); err != nil {
+					return err
 				}
 			}
 
@@ -508,19 +701,161 @@ func renderChart(ctx context.Context, renderedChart *workspacetypes.RenderedChar
 
 		case helmTemplateStderr := <-renderChannels.HelmTemplateStderr:
 			renderedChart.HelmTemplateStderr += helmTemplateStderr
+			streamer.append(renderStreamHelmTemplateStderr, helmTemplateStderr)
+
+			// warnings are never reclassified, so the new ones are those past the count already sent
+			warnings, templateErrors := helmutils.SplitHelmTemplateStderr(renderedChart.HelmTemplateStderr)
+			streamer.appendWarnings(warnings[len(renderedChart.HelmTemplateWarnings):])
+			renderedChart.HelmTemplateWarnings = warnings
+			renderedChart.HelmTemplateErrors = templateErrors
+
+			if err := streamer.maybeFlush(ctx); err != nil {
+				return fmt.Errorf("failed to send render stream event: %w", err)
+			}
+
 			if err := workspace.SetRenderedChartHelmTemplateStderr(ctx, renderedChart.ID, renderedChart.HelmTemplateStderr); err != nil {
 				return fmt.Errorf("failed to set rendered chart helmTemplateStderr: %w", err)
 			}
+			if err := workspace.SetRenderedChartHelmTemplateWarnings(ctx, renderedChart.ID, renderedChart.HelmTemplateWarnings); err != nil {
+				return fmt.Errorf("failed to set rendered chart helmTemplateWarnings: %w", err)
+			}
+			if err := workspace.SetRenderedChartHelmTemplateErrors(ctx, renderedChart.ID, renderedChart.HelmTemplateErrors); err != nil {
+				return fmt.Errorf("failed to set rendered chart helmTemplateErrors: %w", err)
+			}
+		}
+	}
+}
+
+// setRenderedChartDebug stores the debug output of a chart. It's never sent in a realtime event
+// because it can have secrets, clients get it from the render status API.
+func setRenderedChartDebug(ctx context.Context, renderedChart *workspacetypes.RenderedChart, debug workspacetypes.RenderDebug) error {
+	renderedChart.Debug = &debug
+	if err := workspace.SetRenderedChartDebug(ctx, renderedChart.ID, debug); err != nil {
+		return fmt.Errorf("failed to set rendered chart debug: %w", err)
+	}
+	return nil
+}
+
+// getValuesProfile is a var so that rendering with a profile can be tested without a database
+var getValuesProfile = workspace.GetValuesProfile
+
+// valuesProfileContent returns the values to layer over the values.yaml of a chart when rendering
+// with the named profile. A chart without a profile of that name renders with its own values.
+func valuesProfileContent(ctx context.Context, workspaceID string, chartID string, name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	profile, err := getValuesProfile(ctx, workspaceID, chartID, name)
+	if err != nil {
+		if errors.Is(err, workspace.ErrValuesProfileNotFound) {
+			logger.InfoCtx(ctx, "Chart has no values profile, rendering with values.yaml",
+				zap.String("valuesProfile", name))
+			return "", nil
 		}
+		return "", fmt.Errorf("failed to get values profile: %w", err)
+	}
+
+	return profile.Content, nil
+}
+
+// storeRenderedFile is a var so that the rendered files that are stored can be tested without a database
+var storeRenderedFile = workspace.SetRenderedFileContents
+
+// setRenderedFileContents stores a rendered file as the rendered file of the revision. Files of
+// renders with a values profile or debug output aren't stored, they'd replace what the chart's own
+// values render to, which is what later revisions reuse. They're only sent in realtime events.
+func setRenderedFileContents(ctx context.Context, renderedWorkspace *workspacetypes.Rendered, renderedChart *workspacetypes.RenderedChart, file workspacetypes.RenderedFile) error {
+	if renderedWorkspace.ValuesProfile != "" || renderedWorkspace.IsDebug {
+		return nil
+	}
+	if err := storeRenderedFile(ctx, renderedWorkspace.WorkspaceID, renderedWorkspace.RevisionNumber, renderedChart.ID, file.FilePath, file.RenderedContent); err != nil {
+		return fmt.Errorf("failed to set rendered file contents: %w", err)
+	}
+	return nil
+}
+
+// reuseRenderedChart completes a rendered chart by copying the previous revision's render of the
+// same chart forward. It returns false if there is no previous render to reuse.
+func reuseRenderedChart(ctx context.Context, renderedChart *workspacetypes.RenderedChart, renderedWorkspace *workspacetypes.Rendered, w *workspacetypes.Workspace) (bool, error) {
+	previousRevision := renderedWorkspace.RevisionNumber - 1
+
+	previous, err := workspace.GetPreviousRenderedChart(ctx, w.ID, previousRevision, renderedChart.ChartID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get previous rendered chart: %w", err)
 	}
+	if previous == nil {
+		return false, nil
+	}
+
+	chartFiles, err := workspace.ListFiles(ctx, w.ID, renderedWorkspace.RevisionNumber, renderedChart.ChartID)
+	if err != nil {
+		return false, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	renderedFiles, err := workspace.ReuseRenderedChart(ctx, w.ID, previousRevision, renderedWorkspace.RevisionNumber, renderedChart.ID, previous, chartFiles)
+	if err != nil {
+		return false, fmt.Errorf("failed to reuse rendered chart: %w", err)
+	}
+
+	logger.InfoCtx(ctx, "Chart unchanged since previous revision, reused previous render",
+		zap.Int("fileCount", len(renderedFiles)),
+	)
+
+	userIDs, err := workspace.ListUserIDsForWorkspace(ctx, w.ID)
+	if err != nil {
+		return true, fmt.Errorf("failed to list user IDs for workspace: %w", err)
+	}
+	realtimeRecipient := realtimetypes.Recipient{
+		UserIDs: userIDs,
+	}
+
+	// the streamer numbers the event like the ones of a chart that's rendered
+	streamer := newRenderStreamer(realtime.SendEvent, realtimeRecipient, w.ID, renderedWorkspace.ID, renderedChart.ID)
+	streamer.append(renderStreamDepUpdateCommand, previous.DepupdateCommand)
+	streamer.append(renderStreamDepUpdateStdout, previous.DepupdateStdout)
+	streamer.append(renderStreamDepUpdateStderr, previous.DepupdateStderr)
+	streamer.append(renderStreamHelmTemplateCommand, previous.HelmTemplateCommand)
+	streamer.append(renderStreamHelmTemplateStderr, previous.HelmTemplateStderr)
+	streamer.appendWarnings(previous.HelmTemplateWarnings)
+	if previous.IsSuccess {
+		streamer.setCompatibility(workspace.CheckRenderCompatibility([]string{previous.HelmTemplateStdout}, workspace.ChartTemplates(chartFiles, false)).Summary)
+	}
+	if err := streamer.completeUnchanged(ctx, time.Now()); err != nil {
+		return true, fmt.Errorf("failed to send render stream event: %w", err)
+	}
+
+	notesEvent := realtimetypes.RenderNotesEvent{
+		WorkspaceID:   w.ID,
+		RenderID:      renderedWorkspace.ID,
+		RenderChartID: renderedChart.ID,
+		Notes:         previous.Notes,
+	}
+	if err := realtime.SendEvent(ctx, realtimeRecipient, notesEvent); err != nil {
+		return true, fmt.Errorf("failed to send render notes event: %w", err)
+	}
+
+	for _, file := range renderedFiles {
+		e := realtimetypes.RenderFileEvent{
+			WorkspaceID:   w.ID,
+			RenderID:      renderedWorkspace.ID,
+			RenderChartID: renderedChart.ID,
+			RenderedFile:  file,
+		}
+		if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+			return true, fmt.Errorf("failed to send render updated event: %w", err)
+		}
+	}
+
+	return true, nil
 }
 
 func parseRenderedFiles(ctx context.Context, stdout string, chartName string, renderedFiles *[]workspacetypes.RenderedFile, workspaceFiles []workspacetypes.File) ([]workspacetypes.RenderedFile, error) {
 	// Add panic recovery
 	defer func() {
 		if r := recover(); r != nil {
-			logger.Error(fmt.Errorf("PANIC in parseRenderedFiles: %v", r))
-			logger.Error(fmt.Errorf("Stack trace (if available):\n%s", string(debug.Stack())))
+			logger.ErrorCtx(ctx, fmt.Errorf("PANIC in parseRenderedFiles: %v", r))
+			logger.ErrorCtx(ctx, fmt.Errorf("Stack trace (if available):\n%s", string(debug.Stack())))
 		}
 	}()
 	if stdout == "" {
@@ -0,0 +1,225 @@
+package listener
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubGetValuesProfile serves profiles from a map keyed by chart ID and name
+func stubGetValuesProfile(t *testing.T, profiles map[string]string, err error) {
+	original := getValuesProfile
+	getValuesProfile = func(ctx context.Context, workspaceID string, chartID string, name string) (*workspacetypes.ValuesProfile, error) {
+		if err != nil {
+			return nil, err
+		}
+		content, ok := profiles[chartID+"/"+name]
+		if !ok {
+			return nil, workspace.ErrValuesProfileNotFound
+		}
+		return &workspacetypes.ValuesProfile{WorkspaceID: workspaceID, ChartID: chartID, Name: name, Content: content}, nil
+	}
+	t.Cleanup(func() { getValuesProfile = original })
+}
+
+func TestValuesProfileContent(t *testing.T) {
+	stubGetValuesProfile(t, map[string]string{"app/prod": "resources:\n  limits:\n    cpu: 500m\n"}, nil)
+
+	tests := []struct {
+		name    string
+		chartID string
+		profile string
+		want    string
+	}{
+		{name: "no profile", chartID: "app", want: ""},
+		{name: "chart with profile", chartID: "app", profile: "prod", want: "resources:\n  limits:\n    cpu: 500m\n"},
+		{name: "chart without profile renders its own values", chartID: "db", profile: "prod", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := valuesProfileContent(context.Background(), "ws", tt.chartID, tt.profile)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValuesProfileContentError(t *testing.T) {
+	stubGetValuesProfile(t, nil, errors.New("database unavailable"))
+
+	_, err := valuesProfileContent(context.Background(), "ws", "app", "prod")
+	assert.ErrorContains(t, err, "database unavailable")
+}
+
+func TestSetRenderedFileContents(t *testing.T) {
+	tests := []struct {
+		name     string
+		rendered workspacetypes.Rendered
+		want     bool
+	}{
+		{name: "chart values", rendered: workspacetypes.Rendered{WorkspaceID: "ws", RevisionNumber: 2}, want: true},
+		{name: "values profile", rendered: workspacetypes.Rendered{WorkspaceID: "ws", RevisionNumber: 2, ValuesProfile: "prod"}},
+		{name: "debug", rendered: workspacetypes.Rendered{WorkspaceID: "ws", RevisionNumber: 2, IsDebug: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := storeRenderedFile
+			t.Cleanup(func() { storeRenderedFile = original })
+			stored := []string{}
+			storeRenderedFile = func(ctx context.Context, workspaceID string, revisionNumber int, renderedChartID string, filePath string, renderedContent string) error {
+				assert.Equal(t, "ws", workspaceID)
+				assert.Equal(t, 2, revisionNumber)
+				stored = append(stored, renderedChartID+"/"+filePath)
+				return nil
+			}
+
+			file := workspacetypes.RenderedFile{FilePath: "templates/deployment.yaml", RenderedContent: "kind: Deployment\n"}
+			require.NoError(t, setRenderedFileContents(context.Background(), &tt.rendered, &workspacetypes.RenderedChart{ID: "rendered-chart"}, file))
+
+			if tt.want {
+				assert.Equal(t, []string{"rendered-chart/templates/deployment.yaml"}, stored)
+			} else {
+				assert.Empty(t, stored)
+			}
+		})
+	}
+}
+
+func TestRenderWorkspaceTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		render string
+		want   time.Duration
+	}{
+		{name: "default", want: 35 * time.Minute},
+		{name: "configured", render: "45m", want: 45 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CHARTSMITH_TIMEOUT_RENDER", tt.render)
+			require.NoError(t, param.Init(nil))
+
+			originalCheck, originalGet := checkRenderConnection, getRendered
+			t.Cleanup(func() { checkRenderConnection, getRendered = originalCheck, originalGet })
+
+			checkRenderConnection = func(ctx context.Context) error { return nil }
+			var deadline time.Time
+			var hasDeadline bool
+			getRendered = func(ctx context.Context, id string) (*workspacetypes.Rendered, error) {
+				deadline, hasDeadline = ctx.Deadline()
+				return nil, errors.New("stop")
+			}
+
+			start := time.Now()
+			err := handleRenderWorkspaceNotification(context.Background(), `{"id":"render-1"}`)
+			require.Error(t, err)
+
+			require.True(t, hasDeadline)
+			assert.WithinDuration(t, start.Add(tt.want), deadline, 5*time.Second)
+		})
+	}
+}
+
+func TestRecordRenderInventory(t *testing.T) {
+	originalGet, originalSet, originalUsers, originalSend := getRendered, setRenderedInventory, listRenderUserIDs, sendRenderEvent
+	t.Cleanup(func() {
+		getRendered, setRenderedInventory, listRenderUserIDs, sendRenderEvent = originalGet, originalSet, originalUsers, originalSend
+	})
+
+	getRendered = func(ctx context.Context, id string) (*workspacetypes.Rendered, error) {
+		return &workspacetypes.Rendered{
+			ID:          id,
+			WorkspaceID: "ws",
+			Charts: []workspacetypes.RenderedChart{
+				{IsSuccess: true, HelmTemplateStdout: "---\nkind: Deployment\nspec:\n  replicas: 2\n  template:\n    spec:\n      containers:\n        - image: nginx:1.25\n"},
+				{IsSuccess: false, HelmTemplateStdout: "kind: Secret\n"},
+			},
+		}, nil
+	}
+	var stored workspacetypes.RenderInventory
+	setRenderedInventory = func(ctx context.Context, renderID string, inventory workspacetypes.RenderInventory) error {
+		assert.Equal(t, "render", renderID)
+		stored = inventory
+		return nil
+	}
+	listRenderUserIDs = func(ctx context.Context, workspaceID string) ([]string, error) {
+		return []string{"user"}, nil
+	}
+	var sent []realtimetypes.Event
+	sendRenderEvent = func(ctx context.Context, recipient realtimetypes.Recipient, e realtimetypes.Event) error {
+		assert.Equal(t, []string{"user"}, recipient.UserIDs)
+		sent = append(sent, e)
+		return nil
+	}
+
+	recordRenderInventory(context.Background(), "render")
+
+	want := workspacetypes.RenderInventory{
+		Kinds:         map[string]int{"Deployment": 1},
+		Namespaces:    []string{},
+		Images:        []string{"nginx:1.25"},
+		TotalReplicas: 2,
+	}
+	assert.Equal(t, want, stored, "failed charts aren't counted")
+	require.Len(t, sent, 1)
+	assert.Equal(t, realtimetypes.RenderInventoryEvent{WorkspaceID: "ws", RenderID: "render", Inventory: want}, sent[0])
+
+	// the event isn't sent when the inventory can't be stored
+	sent = nil
+	setRenderedInventory = func(ctx context.Context, renderID string, inventory workspacetypes.RenderInventory) error {
+		return errors.New("connection refused")
+	}
+	recordRenderInventory(context.Background(), "render")
+	assert.Empty(t, sent)
+}
+
+func TestRecordRenderCompatibility(t *testing.T) {
+	originalGet, originalSet, originalFiles := getRendered, setRenderedCompatibility, listRenderChartFiles
+	t.Cleanup(func() {
+		getRendered, setRenderedCompatibility, listRenderChartFiles = originalGet, originalSet, originalFiles
+	})
+
+	getRendered = func(ctx context.Context, id string) (*workspacetypes.Rendered, error) {
+		return &workspacetypes.Rendered{
+			ID:             id,
+			WorkspaceID:    "ws",
+			RevisionNumber: 3,
+			Charts: []workspacetypes.RenderedChart{
+				{ChartID: "app", IsSuccess: true, HelmTemplateStdout: "---\n# Source: app/templates/cronjob.yaml\napiVersion: batch/v1beta1\nkind: CronJob\nmetadata:\n  name: cleanup\n"},
+				{ChartID: "broken", IsSuccess: false, HelmTemplateStdout: "apiVersion: extensions/v1beta1\nkind: Deployment\n"},
+			},
+		}, nil
+	}
+	listRenderChartFiles = func(ctx context.Context, workspaceID string, revisionNumber int, chartID string) ([]workspacetypes.File, error) {
+		assert.Equal(t, "ws", workspaceID)
+		assert.Equal(t, 3, revisionNumber)
+		assert.Equal(t, "app", chartID, "the templates of failed charts aren't read")
+		return []workspacetypes.File{
+			{FilePath: "templates/cronjob.yaml", Content: "apiVersion: batch/v1beta1\nkind: CronJob\n"},
+			{FilePath: "templates/psp.yaml", Content: "{{- if .Values.psp }}\napiVersion: policy/v1beta1\nkind: PodSecurityPolicy\n{{- end }}\n"},
+		}, nil
+	}
+	var stored workspacetypes.RenderCompatibility
+	setRenderedCompatibility = func(ctx context.Context, renderID string, compatibility workspacetypes.RenderCompatibility) error {
+		assert.Equal(t, "render", renderID)
+		stored = compatibility
+		return nil
+	}
+
+	recordRenderCompatibility(context.Background(), "render", false)
+
+	assert.Equal(t, "1.24", stored.MaxKubeVersion, "the removed CronJob API limits the range, the failed chart doesn't")
+	assert.Equal(t, "compatible with Kubernetes 1.24 and earlier, 1 resource uses deprecated or removed APIs, 1 more in templates not rendered with these values", stored.Summary)
+	require.Len(t, stored.Findings, 2)
+	assert.Equal(t, "cleanup", stored.Findings[0].Name)
+	assert.Equal(t, "templates/psp.yaml", stored.Findings[1].Template)
+	assert.False(t, stored.Findings[1].Rendered)
+}
@@ -0,0 +1,77 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// these are vars so that scoring a revision can be tested without a database
+var (
+	listHealthFiles        = workspace.ListFiles
+	getHealthDisabledRules = disabledLintRules
+	setRevisionHealth      = workspace.SetRevisionHealth
+)
+
+// scoreRevisionHealth computes the health score of the charts of a revision and stores it on the
+// revision. renderSucceeded is whether each chart rendered, by chart ID, charts that aren't in it
+// haven't been rendered.
+func scoreRevisionHealth(ctx context.Context, w *workspacetypes.Workspace, revisionNumber int, renderSucceeded map[string]bool) (*lintrules.Health, error) {
+	disabled, err := getHealthDisabledRules(ctx, w.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	charts := []lintrules.ChartHealthInput{}
+	for _, chart := range w.Charts {
+		files, err := listHealthFiles(ctx, w.ID, revisionNumber, chart.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+
+		input := lintrules.ChartHealthInput{
+			ChartID:  chart.ID,
+			Files:    files,
+			Findings: lintrules.Run(files, disabled),
+		}
+		if succeeded, ok := renderSucceeded[chart.ID]; ok {
+			input.RenderSucceeded = &succeeded
+		}
+		charts = append(charts, input)
+	}
+
+	health := lintrules.ScoreHealth(charts, lintrules.DefaultHealthWeights)
+	if err := setRevisionHealth(ctx, w.ID, revisionNumber, health); err != nil {
+		return nil, fmt.Errorf("failed to set revision health: %w", err)
+	}
+
+	return &health, nil
+}
+
+// recordRenderHealth scores the revision of a completed render again, now that whether its charts
+// render is known. Renders with a values profile don't render the chart as it's installed by
+// default, so they don't change the score. Failures are only logged, like the inventory's.
+func recordRenderHealth(ctx context.Context, w *workspacetypes.Workspace, renderID string) {
+	rendered, err := getRendered(ctx, renderID)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to get render for health", zap.Error(err))
+		return
+	}
+	if rendered.ValuesProfile != "" {
+		return
+	}
+
+	renderSucceeded := map[string]bool{}
+	for _, chart := range rendered.Charts {
+		renderSucceeded[chart.ChartID] = chart.IsSuccess
+	}
+
+	if _, err := scoreRevisionHealth(ctx, w, rendered.RevisionNumber, renderSucceeded); err != nil {
+		logger.WarnCtx(ctx, "Failed to score revision health", zap.Error(err))
+	}
+}
@@ -0,0 +1,92 @@
+package listener
+
+import (
+	"context"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRevisionHealth scores revisions from files and returns the health each revision is stored with
+func stubRevisionHealth(t *testing.T, files map[string][]workspacetypes.File) map[int]lintrules.Health {
+	originalFiles, originalDisabled, originalSet := listHealthFiles, getHealthDisabledRules, setRevisionHealth
+	t.Cleanup(func() {
+		listHealthFiles, getHealthDisabledRules, setRevisionHealth = originalFiles, originalDisabled, originalSet
+	})
+
+	listHealthFiles = func(ctx context.Context, workspaceID string, revisionNumber int, chartID string) ([]workspacetypes.File, error) {
+		return files[chartID], nil
+	}
+	getHealthDisabledRules = func(ctx context.Context, workspaceID string) ([]string, error) {
+		return []string{"resource-limits"}, nil
+	}
+	stored := map[int]lintrules.Health{}
+	setRevisionHealth = func(ctx context.Context, workspaceID string, revisionNumber int, health lintrules.Health) error {
+		assert.Equal(t, "ws", workspaceID)
+		stored[revisionNumber] = health
+		return nil
+	}
+	return stored
+}
+
+func TestScoreRevisionHealth(t *testing.T) {
+	stored := stubRevisionHealth(t, map[string][]workspacetypes.File{
+		"app": {
+			{FilePath: "README.md", Content: "# app"},
+			{FilePath: "templates/service.yaml", Content: "metadata:\n  namespace: default\n"},
+			{FilePath: "templates/deployment.yaml", Content: "kind: Deployment\nspec:\n  containers:\n    - name: app\n"},
+		},
+	})
+	w := &workspacetypes.Workspace{ID: "ws", Charts: []workspacetypes.Chart{{ID: "app"}}}
+
+	health, err := scoreRevisionHealth(context.Background(), w, 4, nil)
+	require.NoError(t, err)
+	// 60 lint points less 15 for the hard-coded namespace, the disabled rule's finding doesn't
+	// count, and 10 for the README of the 100
+	assert.Equal(t, 55, health.Score)
+	assert.Equal(t, *health, stored[4])
+	assert.Equal(t, "not rendered yet", health.Charts[0].Categories[4].Detail)
+
+	health, err = scoreRevisionHealth(context.Background(), w, 4, map[string]bool{"app": true})
+	require.NoError(t, err)
+	assert.Equal(t, 70, health.Score)
+	assert.Equal(t, 70, stored[4].Score)
+}
+
+func TestRecordRenderHealth(t *testing.T) {
+	stored := stubRevisionHealth(t, map[string][]workspacetypes.File{})
+	originalGet := getRendered
+	t.Cleanup(func() { getRendered = originalGet })
+
+	rendered := &workspacetypes.Rendered{
+		ID:             "render",
+		WorkspaceID:    "ws",
+		RevisionNumber: 3,
+		Charts: []workspacetypes.RenderedChart{
+			{ChartID: "app", IsSuccess: true},
+			{ChartID: "broken", IsSuccess: false},
+		},
+	}
+	getRendered = func(ctx context.Context, id string) (*workspacetypes.Rendered, error) {
+		return rendered, nil
+	}
+	w := &workspacetypes.Workspace{ID: "ws", Charts: []workspacetypes.Chart{{ID: "app"}, {ID: "broken"}}}
+
+	recordRenderHealth(context.Background(), w, "render")
+
+	require.Contains(t, stored, 3)
+	render := map[string]string{}
+	for _, chart := range stored[3].Charts {
+		render[chart.ChartID] = chart.Categories[4].Detail
+	}
+	assert.Equal(t, map[string]string{"app": "renders", "broken": "render failed"}, render)
+
+	// a render with a values profile doesn't score the revision
+	delete(stored, 3)
+	rendered.ValuesProfile = "prod"
+	recordRenderHealth(context.Background(), w, "render")
+	assert.Empty(t, stored)
+}
@@ -0,0 +1,48 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	realtimetypes "github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// sendSecretFindings warns the users of a workspace about the secrets in files of a revision that
+// were just written. Nothing is sent when the files have no secrets.
+func sendSecretFindings(ctx context.Context, realtimeRecipient realtimetypes.Recipient, workspaceID string, revisionNumber int, filePaths ...string) error {
+	findings, err := workspace.ListSecretFindings(ctx, workspaceID, revisionNumber)
+	if err != nil {
+		return fmt.Errorf("failed to list secret findings: %w", err)
+	}
+
+	written := map[string]bool{}
+	for _, filePath := range filePaths {
+		written[filePath] = true
+	}
+	inWritten := []workspacetypes.SecretFinding{}
+	for _, f := range findings {
+		if written[f.FilePath] {
+			inWritten = append(inWritten, f)
+		}
+	}
+
+	return sendSecretFindingsEvent(ctx, realtimeRecipient, workspaceID, inWritten)
+}
+
+func sendSecretFindingsEvent(ctx context.Context, realtimeRecipient realtimetypes.Recipient, workspaceID string, findings []workspacetypes.SecretFinding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	e := realtimetypes.SecretFindingsEvent{
+		WorkspaceID: workspaceID,
+		Findings:    findings,
+	}
+	if err := realtime.SendEvent(ctx, realtimeRecipient, e); err != nil {
+		return fmt.Errorf("failed to send secret findings event: %w", err)
+	}
+	return nil
+}
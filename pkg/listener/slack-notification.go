@@ -2,23 +2,24 @@ package listener
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
-	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/slack"
 )
 
-func handleNewSlackNotification(ctx context.Context, id string) error {
-	conn := persistence.MustGetPooledPostgresSession()
-	defer conn.Release()
+type slackNotificationPayload struct {
+	ID string `json:"id"`
+}
 
-	slackNotification, err := slack.GetSlackNotification(ctx, id)
-	if err != nil {
-		return fmt.Errorf("failed to get slack notification: %w", err)
+func handleNewSlackNotification(ctx context.Context, payload string) error {
+	var p slackNotificationPayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return fmt.Errorf("failed to unmarshal payload: %w", err)
 	}
 
-	if err := slack.SendNotificationToSlack(slackNotification); err != nil {
-		return fmt.Errorf("failed to send notification to slack: %w", err)
+	if err := slack.DeliverNotification(ctx, p.ID); err != nil {
+		return fmt.Errorf("failed to deliver slack notification: %w", err)
 	}
 
 	return nil
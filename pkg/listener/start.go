@@ -4,23 +4,67 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/llm"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/metrics"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/realtime"
+	"github.com/replicatedhq/chartsmith/pkg/slack"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
 )
 
 func StartListeners(ctx context.Context) error {
+	retention, err := archiveRetention(param.Get().ArchiveRetentionDays)
+	if err != nil {
+		return err
+	}
+	auditLogRetention, err := auditRetention(param.Get().AuditRetentionDays)
+	if err != nil {
+		return err
+	}
+	rendersKept, err := renderArtifactsKept(param.Get().RenderArtifactsKept)
+	if err != nil {
+		return err
+	}
+	renderCompactionDryRun := strings.EqualFold(strings.TrimSpace(param.Get().RenderCompactionDryRun), "true")
+	intentWorkers, err := intentConcurrency(param.Get().IntentConcurrency)
+	if err != nil {
+		return err
+	}
+	summaryTTL, err := summaryCacheTTL(param.Get().SummaryCacheTTLDays)
+	if err != nil {
+		return err
+	}
+	summaryMaxEntries, err := summaryCacheMaxEntries(param.Get().SummaryCacheMaxEntries)
+	if err != nil {
+		return err
+	}
+	queueAlertAge, queueAlertCooldown, err := queueAgeAlert(param.Get().QueueAlertAge, param.Get().QueueAlertCooldown)
+	if err != nil {
+		return err
+	}
+
+	// interactive work (intent, plans, conversations) is prioritized over
+	// background work like summarizing files
 	l := NewListener()
-	l.AddHandler(ctx, "new_intent", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "new_intent", intentWorkers, time.Second*10, persistence.WorkPriorityHigh, func(notification *pgconn.Notification) error {
 		if err := handleNewIntentNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle new intent notification: %w", err))
 			return fmt.Errorf("failed to handle new intent notification: %w", err)
 		}
 		return nil
 	}, nil)
+	// one chat message per workspace at a time, taking turns, so that a workspace that sent a
+	// batch of messages doesn't hold up everyone else
+	l.SetFairnessKey("new_intent", "workspaceId")
 
-	l.AddHandler(ctx, "new_summarize", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "new_summarize", 5, time.Second*10, persistence.WorkPriorityLow, func(notification *pgconn.Notification) error {
 		if err := handleNewSummarizeNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle new summarize notification: %w", err))
 			return fmt.Errorf("failed to handle new summarize notification: %w", err)
@@ -28,7 +72,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "new_plan", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "new_plan", 5, time.Second*10, persistence.WorkPriorityHigh, func(notification *pgconn.Notification) error {
 		if err := handleNewPlanNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle new plan notification: %w", err))
 			return fmt.Errorf("failed to handle new plan notification: %w", err)
@@ -36,7 +80,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "new_converational", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "new_converational", 5, time.Second*10, persistence.WorkPriorityHigh, func(notification *pgconn.Notification) error {
 		if err := handleConverationalNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle new converational notification: %w", err))
 			return fmt.Errorf("failed to handle new converational notification: %w", err)
@@ -44,7 +88,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "execute_plan", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "execute_plan", 5, time.Second*10, persistence.WorkPriorityHigh, func(notification *pgconn.Notification) error {
 		if err := handleExecutePlanNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle execute plan notification: %w", err))
 			return fmt.Errorf("failed to handle execute plan notification: %w", err)
@@ -52,7 +96,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "apply_plan", 10, time.Minute*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "apply_plan", 10, time.Minute*10, persistence.WorkPriorityHigh, func(notification *pgconn.Notification) error {
 		if err := handleApplyPlanNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle apply plan notification: %w", err))
 			return fmt.Errorf("failed to handle apply plan notification: %w", err)
@@ -60,7 +104,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, applyPlanLockKeyExtractor)
 
-	l.AddHandler(ctx, "render_workspace", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "render_workspace", 5, time.Second*10, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
 		if err := handleRenderWorkspaceNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle render workspace notification: %w", err))
 			return fmt.Errorf("failed to handle render workspace notification: %w", err)
@@ -68,7 +112,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "new_conversion", 5, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "new_conversion", 5, time.Second*10, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
 		if err := handleNewConversionNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle new conversion notification: %w", err))
 			return fmt.Errorf("failed to handle new conversion notification: %w", err)
@@ -76,7 +120,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "conversion_next_file", 10, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "conversion_next_file", 10, time.Second*10, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
 		if err := handleConversionNextFileNotificationWithLock(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle conversion file notification: %w", err))
 			return fmt.Errorf("failed to handle conversion file notification: %w", err)
@@ -84,7 +128,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, conversionFileLockKeyExtractor)
 
-	l.AddHandler(ctx, "conversion_normalize_values", 10, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "conversion_normalize_values", 10, time.Second*10, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
 		if err := handleConversionNormalizeValuesNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle conversion normalize values notification: %w", err))
 			return fmt.Errorf("failed to handle conversion normalize values notification: %w", err)
@@ -92,7 +136,7 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
-	l.AddHandler(ctx, "conversion_simplify", 10, time.Second*10, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "conversion_simplify", 10, time.Second*10, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
 		if err := handleConversionSimplifyNotificationWithLock(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle conversion simplify notification: %w", err))
 			return fmt.Errorf("failed to handle conversion simplify notification: %w", err)
@@ -101,7 +145,7 @@ func StartListeners(ctx context.Context) error {
 	}, nil)
 
 	// Add handler for workspace publishing with high concurrency (20 concurrent workers)
-	l.AddHandler(ctx, "publish_workspace", 20, time.Minute*5, func(notification *pgconn.Notification) error {
+	l.AddHandler(ctx, "publish_workspace", 20, time.Minute*5, persistence.WorkPriorityNormal, func(notification *pgconn.Notification) error {
 		if err := handlePublishWorkspaceNotification(ctx, notification.Payload); err != nil {
 			logger.Error(fmt.Errorf("failed to handle publish workspace notification: %w", err))
 			return fmt.Errorf("failed to handle publish workspace notification: %w", err)
@@ -109,6 +153,50 @@ func StartListeners(ctx context.Context) error {
 		return nil
 	}, nil)
 
+	// slack rate limits are retried within the handler, so a notification can take a while
+	l.AddHandler(ctx, slack.NotificationChannel, 2, time.Minute, persistence.WorkPriorityLow, func(notification *pgconn.Notification) error {
+		if err := handleNewSlackNotification(ctx, notification.Payload); err != nil {
+			logger.Error(fmt.Errorf("failed to handle new slack notification: %w", err))
+			return fmt.Errorf("failed to handle new slack notification: %w", err)
+		}
+		return nil
+	}, nil)
+
+	l.AddPeriodicTask("prune_realtime_event_journal", realtime.JournalPruneInterval, realtime.PruneJournal)
+	l.AddPeriodicTask("expire_presence", realtime.PresenceSweepInterval, func(ctx context.Context) error {
+		return realtime.ExpirePresence(ctx, workspace.ListUserIDsForWorkspace)
+	})
+	l.AddPeriodicTask("purge_archived_workspaces", workspace.ArchivePurgeInterval, func(ctx context.Context) error {
+		return workspace.PurgeArchivedWorkspaces(ctx, retention)
+	})
+	l.AddPeriodicTask("prune_audit_log", workspace.AuditPruneInterval, func(ctx context.Context) error {
+		return workspace.PruneAuditLog(ctx, auditLogRetention)
+	})
+	l.AddPeriodicTask("compact_render_artifacts", workspace.RenderCompactionInterval, func(ctx context.Context) error {
+		return workspace.CompactRenderArtifacts(ctx, rendersKept, renderCompactionDryRun)
+	})
+	l.AddPeriodicTask("prune_summary_cache", llm.SummaryCachePruneInterval, func(ctx context.Context) error {
+		return llm.PruneSummaryCache(ctx, summaryTTL, summaryMaxEntries)
+	})
+	l.AddPeriodicTask("prune_intent_cache", llm.IntentCachePruneInterval, llm.PruneIntentCache)
+	l.AddPeriodicTask("sweep_queue_claims", QueueClaimSweepInterval, func(ctx context.Context) error {
+		_, err := SweepExpiredClaims(ctx, l.pool, queueClaimSweepAge)
+		return err
+	})
+
+	if queueAlertAge > 0 {
+		l.SetQueueAgeAlert(queueAlertAge, queueAlertCooldown, slack.NotifyQueueBacklog)
+	}
+	metrics.Register("queue_age", l.queueAgeSamples)
+
+	if address := param.Get().HealthAddress; address != "" {
+		go func() {
+			if err := ServeHealth(ctx, address, l); err != nil {
+				logger.Error(err)
+			}
+		}()
+	}
+
 	l.Start(ctx)
 	defer l.Stop(ctx)
 
@@ -136,4 +224,96 @@ func handleConversionNextFileNotificationWithLock(ctx context.Context, payload s
 
 func handleConversionSimplifyNotificationWithLock(ctx context.Context, payload string) error {
 	return handleConversionSimplifyNotification(ctx, payload)
-}
\ No newline at end of file
+}
+
+// archiveRetention is how long archived workspaces are kept, from CHARTSMITH_ARCHIVE_RETENTION_DAYS
+func archiveRetention(days string) (time.Duration, error) {
+	return retentionDays("CHARTSMITH_ARCHIVE_RETENTION_DAYS", days, workspace.DefaultArchiveRetention)
+}
+
+// auditRetention is how long audit events are kept, from CHARTSMITH_AUDIT_RETENTION_DAYS
+func auditRetention(days string) (time.Duration, error) {
+	return retentionDays("CHARTSMITH_AUDIT_RETENTION_DAYS", days, workspace.DefaultAuditRetention)
+}
+
+// renderArtifactsKept is how many of the latest renders of a workspace keep their artifacts, from
+// CHARTSMITH_RENDER_ARTIFACTS_KEPT
+func renderArtifactsKept(value string) (int, error) {
+	if value == "" {
+		return workspace.DefaultRenderArtifactsKept, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid CHARTSMITH_RENDER_ARTIFACTS_KEPT %q: must be a whole number, at least 1", value)
+	}
+	return n, nil
+}
+
+func retentionDays(name string, days string, defaultRetention time.Duration) (time.Duration, error) {
+	if days == "" {
+		return defaultRetention, nil
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s %q: must be a whole number of days, at least 1", name, days)
+	}
+	return time.Duration(n) * 24 * time.Hour, nil
+}
+
+// summaryCacheTTL is how long an unused summary is cached, from CHARTSMITH_SUMMARY_CACHE_TTL_DAYS
+func summaryCacheTTL(days string) (time.Duration, error) {
+	return retentionDays("CHARTSMITH_SUMMARY_CACHE_TTL_DAYS", days, llm.DefaultSummaryCacheTTL)
+}
+
+// summaryCacheMaxEntries is how many summaries are cached, from CHARTSMITH_SUMMARY_CACHE_MAX
+func summaryCacheMaxEntries(value string) (int, error) {
+	if value == "" {
+		return llm.DefaultSummaryCacheMaxEntries, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid CHARTSMITH_SUMMARY_CACHE_MAX %q: must be a whole number", value)
+	}
+	return n, nil
+}
+
+// defaultIntentConcurrency is how many chat messages are classified at once, each from a
+// different workspace
+const defaultIntentConcurrency = 10
+
+// intentConcurrency is the number of new_intent workers, from CHARTSMITH_INTENT_CONCURRENCY
+func intentConcurrency(value string) (int, error) {
+	if value == "" {
+		return defaultIntentConcurrency, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid CHARTSMITH_INTENT_CONCURRENCY %q: must be a whole number, at least 1", value)
+	}
+	return n, nil
+}
+
+// queueAgeAlert is how long the oldest unclaimed message of a channel can wait before alerting
+// about it, from CHARTSMITH_QUEUE_ALERT_AGE and 0 when it isn't set, and how long before alerting
+// about the same channel again, from CHARTSMITH_QUEUE_ALERT_COOLDOWN
+func queueAgeAlert(age string, cooldown string) (time.Duration, time.Duration, error) {
+	alertAge := time.Duration(0)
+	if age != "" {
+		d, err := time.ParseDuration(age)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid CHARTSMITH_QUEUE_ALERT_AGE %q: must be a positive duration such as 15m", age)
+		}
+		alertAge = d
+	}
+
+	alertCooldown := DefaultQueueAgeAlertCooldown
+	if cooldown != "" {
+		d, err := time.ParseDuration(cooldown)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid CHARTSMITH_QUEUE_ALERT_COOLDOWN %q: must be a positive duration such as 1h", cooldown)
+		}
+		alertCooldown = d
+	}
+
+	return alertAge, alertCooldown, nil
+}
@@ -0,0 +1,132 @@
+package listener
+
+import (
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/llm"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default", days: "", want: workspace.DefaultArchiveRetention},
+		{name: "days", days: "7", want: 7 * 24 * time.Hour},
+		{name: "zero", days: "0", wantErr: true},
+		{name: "duration", days: "168h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := archiveRetention(tt.days)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "CHARTSMITH_ARCHIVE_RETENTION_DAYS")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuditRetention(t *testing.T) {
+	got, err := auditRetention("")
+	require.NoError(t, err)
+	assert.Equal(t, workspace.DefaultAuditRetention, got)
+
+	got, err = auditRetention("14")
+	require.NoError(t, err)
+	assert.Equal(t, 14*24*time.Hour, got)
+
+	_, err = auditRetention("-1")
+	assert.ErrorContains(t, err, "CHARTSMITH_AUDIT_RETENTION_DAYS")
+}
+
+func TestRenderArtifactsKept(t *testing.T) {
+	got, err := renderArtifactsKept("")
+	require.NoError(t, err)
+	assert.Equal(t, workspace.DefaultRenderArtifactsKept, got)
+
+	got, err = renderArtifactsKept("3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got)
+
+	for _, invalid := range []string{"0", "-1", "all"} {
+		_, err := renderArtifactsKept(invalid)
+		assert.ErrorContains(t, err, "CHARTSMITH_RENDER_ARTIFACTS_KEPT", invalid)
+	}
+}
+
+func TestIntentConcurrency(t *testing.T) {
+	got, err := intentConcurrency("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultIntentConcurrency, got)
+
+	got, err = intentConcurrency("3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, got)
+
+	for _, invalid := range []string{"0", "-1", "two"} {
+		_, err := intentConcurrency(invalid)
+		assert.ErrorContains(t, err, "CHARTSMITH_INTENT_CONCURRENCY", invalid)
+	}
+}
+
+func TestSummaryCacheParams(t *testing.T) {
+	ttl, err := summaryCacheTTL("")
+	require.NoError(t, err)
+	assert.Equal(t, llm.DefaultSummaryCacheTTL, ttl)
+
+	ttl, err = summaryCacheTTL("7")
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, ttl)
+
+	maxEntries, err := summaryCacheMaxEntries("")
+	require.NoError(t, err)
+	assert.Equal(t, llm.DefaultSummaryCacheMaxEntries, maxEntries)
+
+	maxEntries, err = summaryCacheMaxEntries("500")
+	require.NoError(t, err)
+	assert.Equal(t, 500, maxEntries)
+
+	for _, invalid := range []string{"-1", "lots"} {
+		_, err := summaryCacheMaxEntries(invalid)
+		assert.ErrorContains(t, err, "CHARTSMITH_SUMMARY_CACHE_MAX", invalid)
+	}
+}
+
+func TestQueueAgeAlert(t *testing.T) {
+	tests := []struct {
+		name         string
+		age          string
+		cooldown     string
+		wantAge      time.Duration
+		wantCooldown time.Duration
+		wantErr      string
+	}{
+		{name: "disabled", wantCooldown: DefaultQueueAgeAlertCooldown},
+		{name: "age", age: "15m", wantAge: 15 * time.Minute, wantCooldown: DefaultQueueAgeAlertCooldown},
+		{name: "cooldown", age: "15m", cooldown: "30m", wantAge: 15 * time.Minute, wantCooldown: 30 * time.Minute},
+		{name: "minutes without a unit", age: "15", wantErr: "CHARTSMITH_QUEUE_ALERT_AGE"},
+		{name: "zero age", age: "0s", wantErr: "CHARTSMITH_QUEUE_ALERT_AGE"},
+		{name: "negative cooldown", age: "15m", cooldown: "-1h", wantErr: "CHARTSMITH_QUEUE_ALERT_COOLDOWN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			age, cooldown, err := queueAgeAlert(tt.age, tt.cooldown)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAge, age)
+			assert.Equal(t, tt.wantCooldown, cooldown)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// validActionPlanActions and validActionPlanTypes are what the detailed plan prompt allows in an
+// action tag
+var (
+	validActionPlanActions = map[string]bool{"create": true, "update": true, "delete": true}
+	validActionPlanTypes   = map[string]bool{"file": true}
+)
+
+// actionPlanValidator checks the actions of a plan as they stream, so that a malformed action is
+// skipped instead of failing when it's executed
+type actionPlanValidator struct {
+	w *workspacetypes.Workspace
+	c *workspacetypes.Chart
+	// queued is the action queued for each chart and path
+	queued map[string]string
+}
+
+func newActionPlanValidator(w *workspacetypes.Workspace, c *workspacetypes.Chart) *actionPlanValidator {
+	return &actionPlanValidator{w: w, c: c, queued: map[string]string{}}
+}
+
+// validate returns the action to queue, scoped to its chart, or why it's skipped. An action for a
+// path that's already queued with the same action returns neither. One with another action is
+// queued again, the last action for a path replaces the ones before it.
+func (v *actionPlanValidator) validate(ctx context.Context, action types.ActionPlanWithPath) (*types.ActionPlanWithPath, *types.SkippedActionPlan) {
+	if reason := actionPlanProblem(action); reason != "" {
+		logger.WarnCtx(ctx, "Skipping malformed plan action",
+			zap.String("path", action.Path),
+			zap.String("type", action.Type),
+			zap.String("action", action.Action),
+			zap.String("reason", reason))
+		return nil, &types.SkippedActionPlan{Path: action.Path, Type: action.Type, Action: action.Action, Reason: reason}
+	}
+
+	scoped := scopeActionPlan(v.w, v.c, action.Path, action.ActionPlan)
+	key := scoped.ChartID + "/" + scoped.Path
+	previous, ok := v.queued[key]
+	if ok && previous == scoped.Action {
+		return nil, nil
+	}
+	if ok {
+		logger.WarnCtx(ctx, "Plan has conflicting actions for a path, using the last",
+			zap.String("path", action.Path),
+			zap.String("previousAction", previous),
+			zap.String("action", scoped.Action))
+	}
+	v.queued[key] = scoped.Action
+	return &scoped, nil
+}
+
+// actionPlanProblem returns why an action can't be queued, empty when it can
+func actionPlanProblem(action types.ActionPlanWithPath) string {
+	if !validActionPlanTypes[action.Type] {
+		return fmt.Sprintf("unknown type %q", action.Type)
+	}
+	if !validActionPlanActions[action.Action] {
+		return fmt.Sprintf("unknown action %q, must be create, update or delete", action.Action)
+	}
+
+	p := action.Path
+	switch {
+	case strings.TrimSpace(p) == "":
+		return "path is empty"
+	case strings.HasPrefix(p, "/") || strings.Contains(p, `\`) || (len(p) > 1 && p[1] == ':'):
+		return "path must be relative to the chart"
+	case path.Clean(p) != p:
+		return fmt.Sprintf("path isn't clean, it would be %s", path.Clean(p))
+	case p == ".." || strings.HasPrefix(p, "../"):
+		return "path is outside the chart"
+	}
+	return ""
+}
+
+// AddActionFile adds an action streamed by CreateExecutePlan to the action files of a plan. An
+// action for a file that's already listed replaces its action.
+func AddActionFile(actionFiles []workspacetypes.ActionFile, action types.ActionPlanWithPath) []workspacetypes.ActionFile {
+	for i, actionFile := range actionFiles {
+		if actionFile.ChartID == action.ChartID && actionFile.Path == action.Path {
+			actionFiles[i].Action = action.Action
+			return actionFiles
+		}
+	}
+	return append(actionFiles, workspacetypes.ActionFile{
+		Action:  action.Action,
+		Path:    action.Path,
+		ChartID: action.ChartID,
+		Status:  string(types.ActionPlanStatusPending),
+	})
+}
+
+// SkippedActionsNote is appended to the description of a plan that had actions skipped, so that
+// the user sees what wasn't done
+func SkippedActionsNote(skipped []types.SkippedActionPlan) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\n**Skipped actions**\n\nThese actions were left out of the plan because they're malformed:\n")
+	for _, action := range skipped {
+		fmt.Fprintf(&b, "- `%s` %s (%s): %s\n", action.Path, action.Action, action.Type, action.Reason)
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActionPlanProblem(t *testing.T) {
+	tests := []struct {
+		name   string
+		action types.ActionPlanWithPath
+		want   string
+	}{
+		{name: "create", action: actionPlan("file", "create", "templates/service.yaml")},
+		{name: "update", action: actionPlan("file", "update", "values.yaml")},
+		{name: "delete", action: actionPlan("file", "delete", "frontend/templates/deployment.yaml")},
+		{name: "unknown type", action: actionPlan("directory", "create", "templates"), want: `unknown type "directory"`},
+		{name: "unknown action", action: actionPlan("file", "rename", "values.yaml"), want: `unknown action "rename", must be create, update or delete`},
+		{name: "empty path", action: actionPlan("file", "create", " "), want: "path is empty"},
+		{name: "absolute path", action: actionPlan("file", "update", "/etc/passwd"), want: "path must be relative to the chart"},
+		{name: "backslashes", action: actionPlan("file", "update", `templates\service.yaml`), want: "path must be relative to the chart"},
+		{name: "drive letter", action: actionPlan("file", "update", "C:templates/service.yaml"), want: "path must be relative to the chart"},
+		{name: "not clean", action: actionPlan("file", "create", "templates/./service.yaml"), want: "path isn't clean, it would be templates/service.yaml"},
+		{name: "trailing slash", action: actionPlan("file", "create", "templates/"), want: "path isn't clean, it would be templates"},
+		{name: "outside the chart", action: actionPlan("file", "create", "../values.yaml"), want: "path is outside the chart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, actionPlanProblem(tt.action))
+		})
+	}
+}
+
+func TestActionPlanValidatorDedupes(t *testing.T) {
+	ctx := context.Background()
+	w := twoChartPlanWorkspace()
+	v := newActionPlanValidator(w, &w.Charts[0])
+
+	queued, skipped := v.validate(ctx, actionPlan("file", "update", "backend/templates/deployment.yaml"))
+	assert.Nil(t, skipped)
+	require.NotNil(t, queued)
+	assert.Equal(t, "chart-backend", queued.ChartID)
+	assert.Equal(t, "templates/deployment.yaml", queued.Path)
+
+	queued, skipped = v.validate(ctx, actionPlan("file", "update", "backend/templates/deployment.yaml"))
+	assert.Nil(t, queued, "the same action for a path is queued once")
+	assert.Nil(t, skipped)
+
+	queued, _ = v.validate(ctx, actionPlan("file", "update", "templates/deployment.yaml"))
+	require.NotNil(t, queued, "the same path in another chart is another file")
+	assert.Equal(t, "chart-frontend", queued.ChartID)
+
+	queued, _ = v.validate(ctx, actionPlan("file", "delete", "backend/templates/deployment.yaml"))
+	require.NotNil(t, queued, "a conflicting action is queued again")
+	assert.Equal(t, "delete", queued.Action)
+
+	queued, skipped = v.validate(ctx, actionPlan("file", "update", "/values.yaml"))
+	assert.Nil(t, queued)
+	require.NotNil(t, skipped)
+	assert.Equal(t, types.SkippedActionPlan{Path: "/values.yaml", Type: "file", Action: "update", Reason: "path must be relative to the chart"}, *skipped)
+}
+
+func TestAddActionFile(t *testing.T) {
+	actionFiles := AddActionFile(nil, types.ActionPlanWithPath{Path: "values.yaml", ChartID: "chart", ActionPlan: types.ActionPlan{Action: "update"}})
+	actionFiles = AddActionFile(actionFiles, types.ActionPlanWithPath{Path: "values.yaml", ChartID: "other", ActionPlan: types.ActionPlan{Action: "create"}})
+	actionFiles = AddActionFile(actionFiles, types.ActionPlanWithPath{Path: "values.yaml", ChartID: "chart", ActionPlan: types.ActionPlan{Action: "delete"}})
+
+	assert.Equal(t, []workspacetypes.ActionFile{
+		{Action: "delete", Path: "values.yaml", ChartID: "chart", Status: string(types.ActionPlanStatusPending)},
+		{Action: "create", Path: "values.yaml", ChartID: "other", Status: string(types.ActionPlanStatusPending)},
+	}, actionFiles)
+}
+
+func TestSkippedActionsNote(t *testing.T) {
+	assert.Empty(t, SkippedActionsNote(nil))
+
+	note := SkippedActionsNote([]types.SkippedActionPlan{
+		{Path: "/etc/passwd", Type: "file", Action: "update", Reason: "path must be relative to the chart"},
+		{Path: "values.yaml", Type: "file", Action: "rename", Reason: `unknown action "rename", must be create, update or delete`},
+	})
+	assert.True(t, strings.HasPrefix(note, "\n\n**Skipped actions**\n"), "the note is a paragraph after the description")
+	assert.Contains(t, note, "- `/etc/passwd` update (file): path must be relative to the chart\n")
+	assert.Contains(t, note, "- `values.yaml` rename (file): unknown action \"rename\", must be create, update or delete\n")
+}
+
+func TestCreateExecutePlanSkipsMalformedActions(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("PLAN_MODEL", "")
+	require.NoError(t, param.Init(nil))
+
+	fake := newFakeAnthropic(t)
+	fake.text = strings.Join([]string{
+		`<chartsmithArtifactPlan title="Add a service">`,
+		`<chartsmithActionPlan type="file" action="create" path="frontend/templates/service.yaml">add a service</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" action="rename" path="frontend/values.yaml">rename the values</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" action="update" path="/etc/passwd">outside the chart</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" action="update" path="backend/templates/deployment.yaml">point at the service</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" action="update" path="backend/templates/deployment.yaml">again</chartsmithActionPlan>`,
+		`</chartsmithArtifactPlan>`,
+	}, "\n")
+	stubUserConventions(t, nil)
+	stubNoConversationMemory(t)
+
+	w := twoChartPlanWorkspace()
+	w.CurrentRevision = 1
+	actionCh := make(chan types.ActionPlanWithPath, 10)
+	skippedCh := make(chan types.SkippedActionPlan, 10)
+	streamCh := make(chan string, 10)
+	doneCh := make(chan error, 1)
+	require.NoError(t, CreateExecutePlan(context.Background(), actionCh, skippedCh, streamCh, doneCh, w, &workspacetypes.Plan{ID: "plan", Description: "add a service"}, &w.Charts[0], nil))
+	require.NoError(t, <-doneCh)
+	close(actionCh)
+	close(skippedCh)
+
+	queued := []string{}
+	for action := range actionCh {
+		queued = append(queued, action.ChartID+" "+action.Action+" "+action.Path)
+	}
+	assert.Equal(t, []string{
+		"chart-frontend create templates/service.yaml",
+		"chart-backend update templates/deployment.yaml",
+	}, queued, "only valid actions are queued, and a repeated one once")
+
+	skipped := []string{}
+	for action := range skippedCh {
+		skipped = append(skipped, action.Path+": "+action.Reason)
+	}
+	assert.Equal(t, []string{
+		`frontend/values.yaml: unknown action "rename", must be create, update or delete`,
+		"/etc/passwd: path must be relative to the chart",
+	}, skipped)
+}
+
+func actionPlan(typ string, action string, path string) types.ActionPlanWithPath {
+	return types.ActionPlanWithPath{Path: path, ActionPlan: types.ActionPlan{Type: typ, Action: action}}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+const (
+	// additionalFilesTokenBudget is the estimated number of tokens of attached and uploaded files
+	// given to the planner before they're truncated
+	additionalFilesTokenBudget = 32000
+
+	// intentAttachmentsTokenBudget is smaller, the intent only needs to know what the files are
+	intentAttachmentsTokenBudget = 2000
+)
+
+// AttachmentFiles returns chat message attachments as files, the shape the planner takes uploaded
+// files in
+func AttachmentFiles(attachments []workspacetypes.ChatAttachment) []workspacetypes.File {
+	files := make([]workspacetypes.File, 0, len(attachments))
+	for _, attachment := range attachments {
+		files = append(files, workspacetypes.File{
+			FilePath: attachment.Filename,
+			Content:  attachment.Content,
+		})
+	}
+	return files
+}
+
+// PromptWithAttachments appends the attachments of a chat message to its prompt, so that the
+// intent is classified knowing what was attached
+func PromptWithAttachments(prompt string, attachments []workspacetypes.ChatAttachment) string {
+	if len(attachments) == 0 {
+		return prompt
+	}
+	return prompt + "\n\n" + formatAdditionalFiles(AttachmentFiles(attachments), intentAttachmentsTokenBudget)
+}
+
+// additionalFilesMessages gives the planner the files the user attached or uploaded, as a single
+// message with each file between markers so that its content isn't mistaken for instructions
+func additionalFilesMessages(files []workspacetypes.File) []anthropic.MessageParam {
+	if len(files) == 0 {
+		return nil
+	}
+
+	text := "The user attached these files to the conversation, use them as a reference for the plan.\n" +
+		formatAdditionalFiles(files, additionalFilesTokenBudget)
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))}
+}
+
+// formatAdditionalFiles writes each file between markers, truncating them to share tokenBudget
+// with a note on each file that was cut short
+func formatAdditionalFiles(files []workspacetypes.File, tokenBudget int) string {
+	budgeted := budgetFileContents(files, tokenBudget)
+
+	var sb strings.Builder
+	for i, file := range budgeted {
+		fmt.Fprintf(&sb, "=== BEGIN ATTACHMENT: %s ===\n", file.FilePath)
+		sb.WriteString(strings.TrimSuffix(file.Content, "\n"))
+		sb.WriteString("\n")
+		if len(file.Content) != len(files[i].Content) {
+			fmt.Fprintf(&sb, "(%s was truncated from %d characters to fit in the prompt)\n", file.FilePath, len(files[i].Content))
+		}
+		sb.WriteString("=== END ATTACHMENT ===\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,24 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromptWithAttachments(t *testing.T) {
+	assert.Equal(t, "add a redis", PromptWithAttachments("add a redis", nil))
+
+	prompt := PromptWithAttachments("use these values", []workspacetypes.ChatAttachment{
+		{Filename: "values-prod.yaml", Content: "replicaCount: 3\n"},
+		{Filename: "notes.txt", Content: strings.Repeat("x", intentAttachmentsTokenBudget*approxCharsPerToken) + "\nlast line"},
+	})
+
+	assert.True(t, strings.HasPrefix(prompt, "use these values\n\n=== BEGIN ATTACHMENT: values-prod.yaml ===\nreplicaCount: 3\n=== END ATTACHMENT ===\n"))
+	assert.Contains(t, prompt, "=== BEGIN ATTACHMENT: notes.txt ===")
+	assert.Contains(t, prompt, "(notes.txt was truncated from")
+	assert.NotContains(t, prompt, "last line")
+	assert.True(t, strings.HasSuffix(prompt, "=== END ATTACHMENT ===\n"))
+}
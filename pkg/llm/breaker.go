@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+)
+
+const (
+	// executeBreakerThreshold is the number of executions in a row that fail to reach the LLM
+	// before the rest are refused
+	executeBreakerThreshold = 5
+	// executeBreakerCooldown is how long executions are refused before one is tried again
+	executeBreakerCooldown = 30 * time.Second
+)
+
+// executeBreaker is shared by every action the worker executes, so that while the LLM is down the
+// queued actions fail fast and are retried later instead of each waiting out its own timeout
+var executeBreaker = newExecuteBreaker()
+
+func newExecuteBreaker() *circuitbreaker.Breaker {
+	return circuitbreaker.New(circuitbreaker.Options{
+		Name:             "anthropic",
+		FailureThreshold: executeBreakerThreshold,
+		Cooldown:         executeBreakerCooldown,
+		IsFailure:        isLLMUnavailable,
+	})
+}
+
+// GetExecuteBreakerStats returns the state of the circuit breaker of action executions
+func GetExecuteBreakerStats() circuitbreaker.Stats {
+	return executeBreaker.Stats()
+}
+
+// isLLMUnavailable returns true when an error means the LLM couldn't be reached or failed on its
+// side. Requests it rejected, such as one that's too long, don't say anything about its health.
+func isLLMUnavailable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
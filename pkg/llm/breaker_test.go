@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteActionCircuitBreaker(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+
+	// the LLM is down until healthy is set, then it answers like the scripted fake
+	var healthy atomic.Bool
+	var requests atomic.Int32
+	scripted := &scriptedAnthropic{turns: [][]fakeToolUse{{{Command: "create", Path: "templates/hpa.yaml", NewStr: "kind: HorizontalPodAutoscaler"}}}}
+	serveScripted := scripted.serveHTTP(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !healthy.Load() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"type":"error","error":{"type":"api_error","message":"unavailable"}}`))
+			return
+		}
+		serveScripted(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	previousOptions, previousRecordUsage, previousBreaker := anthropicClientOptions, recordUsage, executeBreaker
+	anthropicClientOptions = []option.RequestOption{option.WithBaseURL(server.URL), option.WithMaxRetries(0)}
+	recordUsage = func(ctx context.Context, usage workspacetypes.LLMUsage) error { return nil }
+	executeBreaker = circuitbreaker.New(circuitbreaker.Options{
+		Name:             "anthropic",
+		FailureThreshold: 2,
+		Cooldown:         50 * time.Millisecond,
+		IsFailure:        isLLMUnavailable,
+	})
+	t.Cleanup(func() {
+		anthropicClientOptions, recordUsage, executeBreaker = previousOptions, previousRecordUsage, previousBreaker
+	})
+
+	actionPlanWithPath := llmtypes.ActionPlanWithPath{
+		ActionPlan: llmtypes.ActionPlan{Action: "create"},
+		Path:       "templates/hpa.yaml",
+	}
+	plan := &workspacetypes.Plan{Description: "Add an HPA"}
+	execute := func() (string, error) {
+		return ExecuteAction(context.Background(), actionPlanWithPath, plan, "", nil)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := execute()
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, circuitbreaker.ErrOpen), "the first failures reach the LLM")
+	}
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, circuitbreaker.StateOpen, GetExecuteBreakerStats().State)
+
+	// open, executions fail fast without a request
+	_, err := execute()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, circuitbreaker.ErrOpen))
+	var retry interface{ RetryAfter() time.Duration }
+	require.True(t, errors.As(err, &retry))
+	assert.Greater(t, retry.RetryAfter(), time.Duration(0))
+	assert.Equal(t, int32(2), requests.Load())
+
+	// the probe after the cooldown finds the LLM back and closes the circuit
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	content, err := execute()
+	require.NoError(t, err)
+	assert.Equal(t, "kind: HorizontalPodAutoscaler", content)
+	assert.Equal(t, circuitbreaker.StateClosed, GetExecuteBreakerStats().State)
+}
+
+func TestIsLLMUnavailable(t *testing.T) {
+	assert.True(t, isLLMUnavailable(errors.New("dial tcp: connection refused")))
+	assert.False(t, isLLMUnavailable(context.Canceled))
+	assert.True(t, isLLMUnavailable(fmt.Errorf("failed: %w", &anthropic.Error{StatusCode: http.StatusServiceUnavailable})))
+	assert.False(t, isLLMUnavailable(fmt.Errorf("failed: %w", &anthropic.Error{StatusCode: http.StatusBadRequest})), "a rejected request")
+}
@@ -18,8 +18,9 @@ func CleanUpConvertedValuesYAML(ctx context.Context, valuesYAML string) (string,
 		return "", fmt.Errorf("failed to get anthropic client: %w", err)
 	}
 
+	ctx, systemPrompt := withPrompt(ctx, promptCleanupConvertedValuesSystem)
 	messages := []anthropic.MessageParam{
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(cleanupConvertedValuesSystemPrompt)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)),
 		anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`
 Here is the converted values.yaml file:
 ---
@@ -29,14 +30,22 @@ Here is the converted values.yaml file:
 		),
 	}
 
-	response, err := client.Messages.New(context.TODO(), anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationConvertValues)),
 		MaxTokens: anthropic.F(int64(8192)),
 		Messages:  anthropic.F(messages),
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return "", err
+	}
+
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	response, err := client.Messages.New(requestCtx, params)
 	if err != nil {
 		return "", fmt.Errorf("failed to create message: %w", err)
 	}
+	recordAnthropicUsage(ctx, OperationConvertValues, response)
 
 	artifacts, err := parseArtifactsInResponse(response.Content[0].Text)
 	if err != nil {
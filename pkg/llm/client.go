@@ -9,13 +9,32 @@ import (
 	"github.com/replicatedhq/chartsmith/pkg/param"
 )
 
+// anthropicClientOptions are added to every client, tests use this to point clients at a fake server
+var anthropicClientOptions []option.RequestOption
+
 func newAnthropicClient(ctx context.Context) (*anthropic.Client, error) {
 	if param.Get().AnthropicAPIKey == "" {
 		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
 	}
-	client := anthropic.NewClient(
-		option.WithAPIKey(param.Get().AnthropicAPIKey),
-	)
+	opts := append([]option.RequestOption{option.WithAPIKey(param.Get().AnthropicAPIKey)}, anthropicClientOptions...)
+	client := anthropic.NewClient(opts...)
 
 	return client, nil
 }
+
+// withLLMRequestTimeout bounds an LLM call that doesn't stream its response, so that a provider
+// that never answers doesn't hold a worker until the job is reaped
+func withLLMRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, param.GetTimeouts().LLMRequest)
+}
+
+// sendContext sends v on ch unless ctx is done first. A streaming call sends with this so that it
+// returns when its caller stops receiving, instead of blocking forever.
+func sendContext[T any](ctx context.Context, ch chan T, v T) error {
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
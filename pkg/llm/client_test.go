@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/jpoz/groq"
+	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+// verifyNoLeaks fails the test when it leaves goroutines behind. It's called first, so that it
+// runs after every other cleanup, once the fake servers are closed.
+func verifyNoLeaks(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+}
+
+// hangingLLM points the Anthropic and Groq clients at a server that accepts requests and never
+// answers them
+func hangingLLM(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the client went away once the request is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	previousOptions, previousGroqBaseURL := anthropicClientOptions, groqBaseURL
+	anthropicClientOptions = []option.RequestOption{option.WithBaseURL(server.URL), option.WithMaxRetries(0)}
+	groqBaseURL = server.URL
+	t.Cleanup(func() {
+		anthropicClientOptions, groqBaseURL = previousOptions, previousGroqBaseURL
+	})
+}
+
+func TestLLMRequestTimeout(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("CHARTSMITH_TIMEOUT_LLM_REQUEST", "200ms")
+	require.NoError(t, param.Init(nil))
+	t.Cleanup(func() {
+		os.Unsetenv("CHARTSMITH_TIMEOUT_LLM_REQUEST")
+		param.Init(nil)
+	})
+
+	tests := []struct {
+		name string
+		call func(ctx context.Context) error
+	}{
+		{
+			name: "anthropic",
+			call: func(ctx context.Context) error {
+				_, err := summarizeContentWithClaude(ctx, "kind: Service")
+				return err
+			},
+		},
+		{
+			name: "groq",
+			call: func(ctx context.Context) error {
+				_, err := createIntentCompletion(ctx, []groq.Message{{Role: "user", Content: "add an ingress"}})
+				return err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifyNoLeaks(t)
+			hangingLLM(t)
+
+			start := time.Now()
+			err := tt.call(context.Background())
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), 2*time.Second, "the call returns at the LLM request timeout")
+		})
+	}
+}
+
+func TestCreateExecutePlanStopsWithContext(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+	stubUserConventions(t, nil)
+	stubNoConversationMemory(t)
+
+	t.Run("provider never answers", func(t *testing.T) {
+		verifyNoLeaks(t)
+		hangingLLM(t)
+
+		w := twoChartPlanWorkspace()
+		w.CurrentRevision = 1
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := CreateExecutePlan(ctx, make(chan types.ActionPlanWithPath), make(chan types.SkippedActionPlan), make(chan string), make(chan error), w, &workspacetypes.Plan{ID: "plan"}, &w.Charts[0], nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("caller stops receiving", func(t *testing.T) {
+		verifyNoLeaks(t)
+		fake := newFakeAnthropic(t)
+		fake.text = `<chartsmithArtifactPlan title="Add a service">
+<chartsmithActionPlan type="file" action="create" path="templates/service.yaml"></chartsmithActionPlan>
+</chartsmithArtifactPlan>`
+
+		w := twoChartPlanWorkspace()
+		w.CurrentRevision = 1
+		ctx, cancel := context.WithCancel(context.Background())
+		returned := make(chan error, 1)
+		go func() {
+			// nothing receives the action, as when the caller returned early
+			returned <- CreateExecutePlan(ctx, make(chan types.ActionPlanWithPath), make(chan types.SkippedActionPlan), make(chan string), make(chan error), w, &workspacetypes.Plan{ID: "plan"}, &w.Charts[0], nil)
+		}()
+		require.Eventually(t, func() bool {
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			return len(fake.requests) == 1
+		}, 2*time.Second, 10*time.Millisecond)
+		// the response is streamed once it's requested, and sending its action blocks
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-returned:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(2 * time.Second):
+			t.Fatal("CreateExecutePlan is still blocked sending its action")
+		}
+	})
+}
+
+func TestGroqFeedbackStopsWithContext(t *testing.T) {
+	verifyNoLeaks(t)
+	hangingLLM(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := FeedbackOnAmbiguousIntent(ctx, make(chan string), make(chan error, 1), FeedbackOpts{ChatMessage: &workspacetypes.Chat{Prompt: "hi"}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// ConversationTokenBudget is the most tokens of chat history, summary included, sent with a prompt
+const ConversationTokenBudget = 24000
+
+// messageTokenOverhead is the estimated cost of the role and framing of each message
+const messageTokenOverhead = 4
+
+// EstimateTokens estimates the tokens in text at 4 characters a token, which is close for English
+// and YAML and errs high for code with long identifiers
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func estimateChatTokens(chat workspacetypes.Chat) int {
+	tokens := EstimateTokens(chat.Prompt) + messageTokenOverhead
+	if chat.Response != "" {
+		tokens += EstimateTokens(chat.Response) + messageTokenOverhead
+	}
+	return tokens
+}
+
+// Conversation is the chat history to send with a prompt: a summary of the older messages and the
+// recent messages in full, oldest first
+type Conversation struct {
+	Summary  string
+	Messages []workspacetypes.Chat
+}
+
+// EstimateTokens estimates the tokens of the messages the conversation is sent as
+func (c Conversation) EstimateTokens() int {
+	tokens := 0
+	if c.Summary != "" {
+		tokens += EstimateTokens(conversationSummaryPrefix+c.Summary) + messageTokenOverhead
+	}
+	for _, chat := range c.Messages {
+		tokens += estimateChatTokens(chat)
+	}
+	return tokens
+}
+
+const conversationSummaryPrefix = "Summary of the earlier conversation about this chart:\n\n"
+
+// MessageParams returns the conversation as messages, the summary first
+func (c Conversation) MessageParams() []anthropic.MessageParam {
+	messages := []anthropic.MessageParam{}
+	if c.Summary != "" {
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(conversationSummaryPrefix+c.Summary)))
+	}
+	for _, chat := range c.Messages {
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(chat.Prompt)))
+		if chat.Response != "" {
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(chat.Response)))
+		}
+	}
+	return messages
+}
+
+// conversation memory is a var so that callers can be tested without a database or an LLM
+var (
+	getConversationMemory = workspace.GetConversationMemory
+	setConversationMemory = workspace.SetConversationMemory
+	summarizeTranscript   = summarizeTranscriptWithClaude
+)
+
+// CondenseConversation fits the chat history of a workspace into the token budget. Messages that
+// don't fit are summarized, oldest first, and the summary is appended to the workspace's memory so
+// that they're only summarized once. Messages already in the memory are left out.
+func CondenseConversation(ctx context.Context, workspaceID string, chats []workspacetypes.Chat) (*Conversation, error) {
+	memory, err := getConversationMemory(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation memory: %w", err)
+	}
+
+	// the summaries are attributed to the workspace, so that they're checked for its secrets
+	ctx = WithUsageAttribution(ctx, UsageAttribution{WorkspaceID: workspaceID})
+	conversation, updated, err := condenseConversation(ctx, *memory, chats, ConversationTokenBudget, summarizeTranscript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to condense conversation: %w", err)
+	}
+
+	if updated != nil {
+		ok, err := setConversationMemory(ctx, workspaceID, memory, updated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save conversation memory: %w", err)
+		}
+		if !ok {
+			// the summary for this prompt is still right, the next prompt summarizes on top of
+			// the memory that was saved first
+			logger.Info("conversation memory was updated concurrently, not saving", zap.String("workspaceID", workspaceID))
+		}
+	}
+
+	return conversation, nil
+}
+
+// condenseConversation splits chats into the recent messages that fit in the budget with the
+// summary, and summarizes the rest onto the summary. It returns the new memory, or nil if the
+// memory didn't change.
+func condenseConversation(ctx context.Context, memory workspacetypes.ConversationMemory, chats []workspacetypes.Chat, budget int, summarize func(ctx context.Context, transcript string) (string, error)) (*Conversation, *workspacetypes.ConversationMemory, error) {
+	all := append([]workspacetypes.Chat{}, chats...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.Before(all[j].CreatedAt)
+	})
+
+	// leave out the messages in the summary, but never the newest, which is what's being answered
+	sorted := make([]workspacetypes.Chat, 0, len(all))
+	for i, chat := range all {
+		if i < len(all)-1 && memory.SummarizedThrough != nil && !chat.CreatedAt.After(*memory.SummarizedThrough) {
+			continue
+		}
+		sorted = append(sorted, chat)
+	}
+
+	changed := false
+	for {
+		conversation := &Conversation{Summary: memory.Summary}
+		available := budget - conversation.EstimateTokens()
+
+		// the newest messages that fit, always including the newest message
+		keep := len(sorted)
+		used := 0
+		for keep > 0 {
+			tokens := estimateChatTokens(sorted[keep-1])
+			if keep < len(sorted) && used+tokens > available {
+				break
+			}
+			used += tokens
+			keep--
+		}
+
+		if keep == 0 {
+			conversation.Messages = sorted
+			if !changed {
+				return conversation, nil, nil
+			}
+			return conversation, &memory, nil
+		}
+
+		// summarize what doesn't fit, in batches that fit in the budget themselves
+		evicted := sorted[:keep]
+		for len(evicted) > 0 {
+			batch := 0
+			batchTokens := 0
+			for batch < len(evicted) {
+				tokens := estimateChatTokens(evicted[batch])
+				if batch > 0 && batchTokens+tokens > budget {
+					break
+				}
+				batchTokens += tokens
+				batch++
+			}
+
+			summary, err := summarize(ctx, formatTranscript(evicted[:batch]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to summarize chat messages: %w", err)
+			}
+			memory.Summary = appendSummary(memory.Summary, summary)
+			through := evicted[batch-1].CreatedAt
+			memory.SummarizedThrough = &through
+			evicted = evicted[batch:]
+		}
+		sorted = sorted[keep:]
+		changed = true
+
+		// an append only summary grows with the workspace, once it takes half the budget it's
+		// condensed as a whole
+		if EstimateTokens(memory.Summary) > budget/2 {
+			summary, err := summarize(ctx, memory.Summary)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to condense summary: %w", err)
+			}
+			memory.Summary = strings.TrimSpace(summary)
+		}
+	}
+}
+
+func appendSummary(summary string, addition string) string {
+	addition = strings.TrimSpace(addition)
+	if summary == "" {
+		return addition
+	}
+	return summary + "\n\n" + addition
+}
+
+func formatTranscript(chats []workspacetypes.Chat) string {
+	transcript := strings.Builder{}
+	for _, chat := range chats {
+		fmt.Fprintf(&transcript, "User: %s\n\n", chat.Prompt)
+		if chat.Response != "" {
+			fmt.Fprintf(&transcript, "Assistant: %s\n\n", chat.Response)
+		}
+	}
+	return transcript.String()
+}
+
+func summarizeTranscriptWithClaude(ctx context.Context, transcript string) (string, error) {
+	userMessage := `The following is part of a conversation about a Helm chart. Summarize it in a few short paragraphs for someone continuing the conversation. Keep every decision, requirement, name, value and file that was mentioned, and leave out pleasantries.
+
+` + transcript
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationSummarize)),
+		MaxTokens: anthropic.F(int64(2048)),
+		Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage))}),
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return "", err
+	}
+
+	client, err := newAnthropicClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create anthropic client: %w", err)
+	}
+
+	startTime := time.Now()
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	resp, err := client.Messages.New(requestCtx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	recordAnthropicUsage(ctx, OperationSummarize, resp)
+
+	logger.Debug("Summarized conversation", zap.Duration("duration", time.Since(startTime)))
+
+	if len(resp.Content) == 0 {
+		return "", fmt.Errorf("empty conversation summary")
+	}
+	return resp.Content[0].Text, nil
+}
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syntheticHistory returns n chat messages a minute apart, each prompt and response a few hundred tokens
+func syntheticHistory(n int) []workspacetypes.Chat {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	chats := []workspacetypes.Chat{}
+	for i := 0; i < n; i++ {
+		chats = append(chats, workspacetypes.Chat{
+			ID:        fmt.Sprintf("chat-%03d", i),
+			Prompt:    fmt.Sprintf("message %d: %s", i, strings.Repeat("please change the ingress annotations ", 30)),
+			Response:  fmt.Sprintf("response %d: %s", i, strings.Repeat("I updated templates/ingress.yaml and values.yaml ", 30)),
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return chats
+}
+
+// stubSummarizer records the transcripts it was asked to summarize and returns a short summary of each
+type stubSummarizer struct {
+	transcripts []string
+}
+
+func (s *stubSummarizer) summarize(ctx context.Context, transcript string) (string, error) {
+	s.transcripts = append(s.transcripts, transcript)
+	return fmt.Sprintf("summary %d", len(s.transcripts)), nil
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 1, EstimateTokens("abc"))
+	assert.Equal(t, 1, EstimateTokens("abcd"))
+	assert.Equal(t, 2, EstimateTokens("abcde"))
+}
+
+func TestCondenseConversationFitsBudget(t *testing.T) {
+	history := syntheticHistory(100)
+	// newest first, as ListChatMessagesForWorkspace returns them
+	reversed := []workspacetypes.Chat{}
+	for i := len(history) - 1; i >= 0; i-- {
+		reversed = append(reversed, history[i])
+	}
+
+	budget := 4000
+	stub := &stubSummarizer{}
+	conversation, memory, err := condenseConversation(context.Background(), workspacetypes.ConversationMemory{}, reversed, budget, stub.summarize)
+	require.NoError(t, err)
+	require.NotNil(t, memory)
+
+	assert.LessOrEqual(t, conversation.EstimateTokens(), budget)
+	require.NotEmpty(t, conversation.Messages)
+	assert.Equal(t, "chat-099", conversation.Messages[len(conversation.Messages)-1].ID)
+	for i := 1; i < len(conversation.Messages); i++ {
+		assert.True(t, conversation.Messages[i-1].CreatedAt.Before(conversation.Messages[i].CreatedAt))
+	}
+
+	// every message is either summarized or sent, once
+	summarized := 0
+	for _, transcript := range stub.transcripts {
+		summarized += strings.Count(transcript, "User: ")
+	}
+	assert.Equal(t, 100, summarized+len(conversation.Messages))
+	assert.Equal(t, conversation.Summary, memory.Summary)
+	assert.Equal(t, history[99-len(conversation.Messages)].CreatedAt, *memory.SummarizedThrough)
+	// each batch sent to the summarizer fits in the budget itself
+	for _, transcript := range stub.transcripts {
+		assert.LessOrEqual(t, EstimateTokens(transcript), budget+100)
+	}
+}
+
+func TestCondenseConversationIsIncremental(t *testing.T) {
+	history := syntheticHistory(100)
+	budget := 4000
+
+	first := &stubSummarizer{}
+	_, memory, err := condenseConversation(context.Background(), workspacetypes.ConversationMemory{}, history[:90], budget, first.summarize)
+	require.NoError(t, err)
+	require.NotNil(t, memory)
+
+	// the next prompt only summarizes the messages that fell out of the budget since, and appends
+	// to the summary rather than rewriting it
+	second := &stubSummarizer{}
+	conversation, updated, err := condenseConversation(context.Background(), *memory, history, budget, second.summarize)
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.True(t, strings.HasPrefix(updated.Summary, memory.Summary+"\n\n"))
+	for _, transcript := range second.transcripts {
+		for _, chat := range history {
+			if !chat.CreatedAt.After(*memory.SummarizedThrough) {
+				assert.NotContains(t, transcript, chat.Prompt)
+			}
+		}
+	}
+	assert.LessOrEqual(t, conversation.EstimateTokens(), budget)
+	assert.Equal(t, "chat-099", conversation.Messages[len(conversation.Messages)-1].ID)
+
+	// a history that fits doesn't touch the memory
+	unchanged := &stubSummarizer{}
+	conversation, none, err := condenseConversation(context.Background(), *updated, history, budget, unchanged.summarize)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+	assert.Empty(t, unchanged.transcripts)
+	assert.Equal(t, updated.Summary, conversation.Summary)
+}
+
+func TestCondenseConversationCompactsLongSummary(t *testing.T) {
+	history := syntheticHistory(10)
+
+	long := &stubSummarizer{}
+	summarize := func(ctx context.Context, transcript string) (string, error) {
+		long.transcripts = append(long.transcripts, transcript)
+		if strings.HasPrefix(transcript, "User: ") {
+			return strings.Repeat("long summary ", 200), nil
+		}
+		return "compacted", nil
+	}
+
+	conversation, memory, err := condenseConversation(context.Background(), workspacetypes.ConversationMemory{}, history, 1500, summarize)
+	require.NoError(t, err)
+	require.NotNil(t, memory)
+	assert.LessOrEqual(t, conversation.EstimateTokens(), 1500)
+	assert.True(t, strings.HasPrefix(memory.Summary, "compacted"))
+}
+
+func TestCondenseConversationKeepsNewestMessage(t *testing.T) {
+	history := syntheticHistory(3)
+	through := history[2].CreatedAt
+
+	conversation, memory, err := condenseConversation(context.Background(), workspacetypes.ConversationMemory{Summary: "earlier", SummarizedThrough: &through}, history, 4000, (&stubSummarizer{}).summarize)
+	require.NoError(t, err)
+	assert.Nil(t, memory)
+	require.Len(t, conversation.Messages, 1)
+	assert.Equal(t, "chat-002", conversation.Messages[0].ID)
+}
+
+func TestCondenseConversationChecksSecrets(t *testing.T) {
+	originalGet, originalSet, originalSummarize, originalSecrets := getConversationMemory, setConversationMemory, summarizeTranscript, checkSecretsForLLM
+	t.Cleanup(func() {
+		getConversationMemory, setConversationMemory, summarizeTranscript, checkSecretsForLLM = originalGet, originalSet, originalSummarize, originalSecrets
+	})
+
+	getConversationMemory = func(ctx context.Context, workspaceID string) (*workspacetypes.ConversationMemory, error) {
+		return &workspacetypes.ConversationMemory{}, nil
+	}
+	setConversationMemory = func(ctx context.Context, workspaceID string, previous *workspacetypes.ConversationMemory, memory *workspacetypes.ConversationMemory) (bool, error) {
+		return true, nil
+	}
+	checked := []string{}
+	checkSecretsForLLM = func(ctx context.Context, workspaceID string, texts []string) error {
+		checked = append(checked, workspaceID)
+		return fmt.Errorf("%w: found in values.yaml", workspace.ErrSecretsNotAcknowledged)
+	}
+	// the real summarizer, which is refused before it needs a client
+	summarizeTranscript = summarizeTranscriptWithClaude
+	require.NoError(t, param.Init(nil))
+
+	_, err := CondenseConversation(context.Background(), "ws", syntheticHistory(200))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, workspace.ErrSecretsNotAcknowledged)
+	assert.Equal(t, []string{"ws"}, checked)
+}
@@ -17,9 +17,11 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 		return fmt.Errorf("failed to create anthropic client: %w", err)
 	}
 
+	ctx, systemPrompt := withPrompt(ctx, promptChatOnlySystem)
+	ctx, instructions := withPrompt(ctx, promptChatOnlyInstructions)
 	messages := []anthropic.MessageParam{
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(chatOnlySystemPrompt)),
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(chatOnlyInstructions)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(instructions)),
 	}
 
 	var c *workspacetypes.Chart
@@ -83,10 +85,25 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 			return fmt.Errorf("failed to list chat messages: %w", err)
 		}
 
+		priorChatMessages := []workspacetypes.Chat{}
 		for _, chat := range previousChatMessages {
 			if chat.ID == chatMessage.ID {
 				continue
 			}
+			priorChatMessages = append(priorChatMessages, chat)
+		}
+
+		conversation := &Conversation{}
+		if len(priorChatMessages) > 0 {
+			conversation, err = CondenseConversation(ctx, w.ID, priorChatMessages)
+			if err != nil {
+				return fmt.Errorf("failed to condense conversation: %w", err)
+			}
+		}
+		if conversation.Summary != "" {
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(conversationSummaryPrefix+conversation.Summary)))
+		}
+		for _, chat := range conversation.Messages {
 			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(chat.Prompt)))
 		}
 
@@ -133,34 +150,42 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 	}
 
 	for {
-		stream := client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
-			Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+		params := anthropic.MessageNewParams{
+			Model:     anthropic.F(ModelFor(OperationChat)),
 			MaxTokens: anthropic.F(int64(8192)),
 			Messages:  anthropic.F(messages),
 			Tools:     anthropic.F(toolUnionParams),
-		})
+		}
+		if err := guardSecrets(ctx, params); err != nil {
+			return err
+		}
+
+		stream := client.Messages.NewStreaming(ctx, params)
 
 		message := anthropic.Message{}
 		for stream.Next() {
 			event := stream.Current()
 			err := message.Accumulate(event)
 			if err != nil {
-				doneCh <- fmt.Errorf("failed to accumulate message: %w", err)
+				sendContext(ctx, doneCh, fmt.Errorf("failed to accumulate message: %w", err))
 				return err
 			}
 
 			switch event := event.AsUnion().(type) {
 			case anthropic.ContentBlockDeltaEvent:
 				if event.Delta.Text != "" {
-					streamCh <- event.Delta.Text
+					if err := sendContext(ctx, streamCh, event.Delta.Text); err != nil {
+						return err
+					}
 				}
 			}
 		}
 
 		if stream.Err() != nil {
-			doneCh <- stream.Err()
+			sendContext(ctx, doneCh, stream.Err())
 			return stream.Err()
 		}
+		recordAnthropicUsage(ctx, OperationChat, &message)
 
 		messages = append(messages, message.ToParam())
 
@@ -177,7 +202,7 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 						SemverField string `json:"semver_field"`
 					}
 					if err := json.Unmarshal(block.Input, &input); err != nil {
-						doneCh <- fmt.Errorf("failed to unmarshal tool input: %w", err)
+						sendContext(ctx, doneCh, fmt.Errorf("failed to unmarshal tool input: %w", err))
 						return err
 					}
 
@@ -194,13 +219,13 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 						ChartName string `json:"chart_name"`
 					}
 					if err := json.Unmarshal(block.Input, &input); err != nil {
-						doneCh <- fmt.Errorf("failed to unmarshal tool input: %w", err)
+						sendContext(ctx, doneCh, fmt.Errorf("failed to unmarshal tool input: %w", err))
 						return err
 					}
 
 					version, err := recommendations.GetLatestSubchartVersion(input.ChartName)
 					if err != nil && err != recommendations.ErrNoArtifactHubPackage {
-						doneCh <- fmt.Errorf("failed to get latest subchart version: %w", err)
+						sendContext(ctx, doneCh, fmt.Errorf("failed to get latest subchart version: %w", err))
 						return err
 					} else if err == recommendations.ErrNoArtifactHubPackage {
 						response = "?"
@@ -211,7 +236,7 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 
 				b, err := json.Marshal(response)
 				if err != nil {
-					doneCh <- fmt.Errorf("failed to marshal tool response: %w", err)
+					sendContext(ctx, doneCh, fmt.Errorf("failed to marshal tool response: %w", err))
 					return err
 				}
 
@@ -229,8 +254,7 @@ func ConversationalChatMessage(ctx context.Context, streamCh chan string, doneCh
 		})
 	}
 
-	doneCh <- nil
-	return nil
+	return sendContext(ctx, doneCh, nil)
 }
 
 func getChartStructure(ctx context.Context, c *workspacetypes.Chart) (string, error) {
@@ -240,3 +264,32 @@ func getChartStructure(ctx context.Context, c *workspacetypes.Chart) (string, er
 	}
 	return structure, nil
 }
+
+// getPlanStructure returns the structure of c, or of every chart when the workspace has more
+// than one, with file paths prefixed by the chart name so the planner can refer to them unambiguously
+func getPlanStructure(ctx context.Context, w *workspacetypes.Workspace, c *workspacetypes.Chart) (string, error) {
+	if w == nil || len(w.Charts) <= 1 {
+		return getChartStructure(ctx, c)
+	}
+
+	structure := fmt.Sprintf("This workspace contains %d charts. Every file path in the plan must start with the chart name.\n", len(w.Charts))
+	for i := range w.Charts {
+		structure += fmt.Sprintf("Chart: %s\n", w.Charts[i].Name)
+		for _, file := range w.Charts[i].Files {
+			structure += fmt.Sprintf("File: %s\n", workspace.ChartScopedPath(w, &w.Charts[i], file.FilePath))
+		}
+	}
+	return structure, nil
+}
+
+// planFilePath is the path of file as the planner sees it in getPlanStructure
+func planFilePath(w *workspacetypes.Workspace, file workspacetypes.File) string {
+	if w == nil {
+		return file.FilePath
+	}
+	c, err := workspace.FindChart(w, file.ChartID)
+	if err != nil {
+		return file.FilePath
+	}
+	return workspace.ChartScopedPath(w, c, file.FilePath)
+}
@@ -0,0 +1,350 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// convertDocumentConcurrency is how many documents of a manifest are converted at once
+const convertDocumentConcurrency = 4
+
+// convertManifestDocument converts one document, it's a var so that tests can convert without an LLM
+var convertManifestDocument = convertDocument
+
+var (
+	manifestDocumentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+	templateNameUnsafeChars   = regexp.MustCompile(`[^a-z0-9.-]+`)
+)
+
+// ValuesConflict is a values key that two documents of a manifest gave different defaults. The
+// first document's default is kept.
+type ValuesConflict struct {
+	// Key is the dotted path of the key, such as web.image.tag
+	Key     string
+	Kept    interface{}
+	Dropped interface{}
+	// Document is the index of the document whose default was dropped
+	Document int
+}
+
+// splitManifestDocuments returns the documents of a manifest, leaving out the ones that are empty
+// or only comments
+func splitManifestDocuments(content string) []string {
+	documents := []string{}
+	for _, document := range manifestDocumentSeparator.Split(content, -1) {
+		empty := true
+		for _, line := range strings.Split(document, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				empty = false
+				break
+			}
+		}
+		if !empty {
+			documents = append(documents, strings.TrimLeft(document, "\n"))
+		}
+	}
+	return documents
+}
+
+// convertDocuments converts each document of a manifest on its own, so that the LLM doesn't merge
+// or drop resources. Each document is converted against the same values.yaml, and the values they
+// add are merged, a key given different defaults keeps the first. The template of each document is
+// named after its resource, templates/<kind>-<name>.yaml.
+func convertDocuments(ctx context.Context, opts ConvertFileOpts, documents []string) (map[string]string, string, error) {
+	type converted struct {
+		files      map[string]string
+		valuesYAML string
+		err        error
+	}
+	results := make([]converted, len(documents))
+
+	sem := make(chan struct{}, convertDocumentConcurrency)
+	var wg sync.WaitGroup
+	for i, document := range documents {
+		wg.Add(1)
+		go func(i int, document string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			files, valuesYAML, err := convertManifestDocument(ctx, ConvertFileOpts{
+				Path:       opts.Path,
+				Content:    document,
+				ValuesYAML: opts.ValuesYAML,
+			})
+			results[i] = converted{files: files, valuesYAML: valuesYAML, err: err}
+		}(i, document)
+	}
+	wg.Wait()
+
+	valuesYAMLs := make([]string, len(results))
+	for i, result := range results {
+		if result.err != nil {
+			return nil, "", fmt.Errorf("failed to convert document %d of %s: %w", i+1, opts.Path, result.err)
+		}
+		valuesYAMLs[i] = result.valuesYAML
+	}
+
+	valuesYAML, conflicts, err := mergeConvertedValues(opts.ValuesYAML, valuesYAMLs)
+	if err != nil {
+		// values that aren't a map are merged the way a single document's are, as text
+		logger.Warn("Failed to merge values of converted documents, merging them in order", zap.String("path", opts.Path), zap.Error(err))
+		valuesYAML = opts.ValuesYAML
+		for _, documentValuesYAML := range valuesYAMLs {
+			if valuesYAML, err = mergeValuesYAML(valuesYAML, documentValuesYAML); err != nil {
+				return nil, "", fmt.Errorf("failed to merge values of %s: %w", opts.Path, err)
+			}
+		}
+	}
+	for _, conflict := range conflicts {
+		logger.Warn("Documents of a converted manifest gave a values key different defaults",
+			zap.String("path", opts.Path),
+			zap.String("key", conflict.Key),
+			zap.Any("kept", conflict.Kept),
+			zap.Any("dropped", conflict.Dropped),
+			zap.Int("document", conflict.Document+1))
+	}
+
+	files := map[string]string{}
+	for i, result := range results {
+		templatePath := resourceTemplatePath(documents[i])
+		paths := make([]string, 0, len(result.files))
+		for p := range result.files {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		for _, p := range paths {
+			content := result.files[p]
+			if path.Ext(p) == ".tpl" {
+				files[p] = mergeHelpersFile(files[p], content)
+				continue
+			}
+			if templatePath != "" && isManifestTemplate(p) {
+				p = templatePath
+				// only the first template of a document is its resource
+				templatePath = ""
+			}
+			files[uniqueFilePath(files, p)] = content
+		}
+	}
+
+	return files, valuesYAML, nil
+}
+
+// resourceTemplatePath returns templates/<kind>-<name>.yaml for a document, or an empty string when
+// it has no kind
+func resourceTemplatePath(document string) string {
+	var resource struct {
+		Kind     string `yaml:"kind"`
+		Metadata struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+	}
+	if err := yaml.Unmarshal([]byte(document), &resource); err != nil || resource.Kind == "" {
+		return ""
+	}
+
+	name := strings.ToLower(resource.Kind)
+	if resource.Metadata.Name != "" {
+		name += "-" + resource.Metadata.Name
+	}
+	name = strings.Trim(templateNameUnsafeChars.ReplaceAllString(strings.ToLower(name), "-"), "-.")
+	return "templates/" + name + ".yaml"
+}
+
+// isManifestTemplate returns true for a template that renders a manifest, rather than helpers or notes
+func isManifestTemplate(p string) bool {
+	return strings.HasPrefix(p, "templates/") && (path.Ext(p) == ".yaml" || path.Ext(p) == ".yml")
+}
+
+// uniqueFilePath returns p, or p with a numeric suffix before its extension when files already has it
+func uniqueFilePath(files map[string]string, p string) string {
+	if _, ok := files[p]; !ok {
+		return p
+	}
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, n, ext)
+		if _, ok := files[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// mergeHelpersFile adds the content of a helpers file converted from another document, unless every
+// helper it defines is already defined
+func mergeHelpersFile(existing string, incoming string) string {
+	if strings.TrimSpace(existing) == "" {
+		return incoming
+	}
+
+	defined := map[string]bool{}
+	for _, helper := range getDefinedHelpers([]workspacetypes.File{{FilePath: prePassHelpersPath, Content: existing}}) {
+		defined[helper.Name] = true
+	}
+	for _, helper := range getDefinedHelpers([]workspacetypes.File{{FilePath: prePassHelpersPath, Content: incoming}}) {
+		if !defined[helper.Name] {
+			return strings.TrimRight(existing, "\n") + "\n\n" + incoming
+		}
+	}
+	return existing
+}
+
+// mergeConvertedValues merges what each document's conversion added to baseYAML. The additions of
+// each document are merged with mergeValuesYAML, so the order, comments and anchors of baseYAML are
+// kept. A key that two documents set to different defaults keeps the first and is returned as a
+// conflict. Keys a conversion removed or left as they were in baseYAML don't change the result.
+func mergeConvertedValues(baseYAML string, convertedYAMLs []string) (string, []ValuesConflict, error) {
+	base := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(baseYAML), &base); err != nil {
+		return "", nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+	}
+	if base == nil {
+		base = map[string]interface{}{}
+	}
+
+	// merged is the values merged so far, it's what later documents conflict with
+	merged := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(baseYAML), &merged); err != nil {
+		return "", nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+	}
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+
+	valuesYAML := baseYAML
+	conflicts := []ValuesConflict{}
+	// setBy is the document that set each key
+	setBy := map[string]int{}
+	for i, convertedYAML := range convertedYAMLs {
+		converted := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(convertedYAML), &converted); err != nil {
+			return "", nil, fmt.Errorf("failed to parse values.yaml of document %d: %w", i+1, err)
+		}
+		skipped := map[string]bool{}
+		mergeValuesAdditions(merged, base, converted, "", i, setBy, &conflicts, skipped)
+
+		additions, err := withoutValuesKeys(convertedYAML, skipped)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to parse values.yaml of document %d: %w", i+1, err)
+		}
+		if additions == "" {
+			continue
+		}
+		if valuesYAML, err = mergeValuesYAML(valuesYAML, additions); err != nil {
+			return "", nil, fmt.Errorf("failed to merge values of document %d: %w", i+1, err)
+		}
+	}
+
+	return valuesYAML, conflicts, nil
+}
+
+// withoutValuesKeys returns values with the keys whose dotted paths are in keys left out, and the
+// mappings that are left empty by that. It's empty when no key is left.
+func withoutValuesKeys(values string, keys map[string]bool) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(values), &doc); err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", nil
+	}
+	if !removeValuesKeys(doc.Content[0], "", keys) {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return "", fmt.Errorf("failed to encode values: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode values: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// removeValuesKeys removes the keys in keys from mapping, and returns whether any key is left
+func removeValuesKeys(mapping *yaml.Node, prefix string, keys map[string]bool) bool {
+	content := []*yaml.Node{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		dotted := key.Value
+		if prefix != "" {
+			dotted = prefix + "." + key.Value
+		}
+		if keys[dotted] {
+			continue
+		}
+		if value.Kind == yaml.MappingNode && len(value.Content) > 0 && !removeValuesKeys(value, dotted, keys) {
+			continue
+		}
+		content = append(content, key, value)
+	}
+	mapping.Content = content
+	return len(content) > 0
+}
+
+// mergeValuesAdditions merges the keys a document's conversion added or changed into merged, and
+// adds the dotted paths of the keys that aren't merged to skipped, the keys that are the same as in
+// base and the keys that conflict with an earlier document
+func mergeValuesAdditions(merged map[string]interface{}, base map[string]interface{}, converted map[string]interface{}, prefix string, document int, setBy map[string]int, conflicts *[]ValuesConflict, skipped map[string]bool) {
+	keys := make([]string, 0, len(converted))
+	for key := range converted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := converted[key]
+		dotted := key
+		if prefix != "" {
+			dotted = prefix + "." + key
+		}
+
+		baseValue, inBase := base[key]
+		if inBase && reflect.DeepEqual(baseValue, value) {
+			skipped[dotted] = true
+			continue
+		}
+
+		valueMap, valueIsMap := value.(map[string]interface{})
+		mergedMap, mergedIsMap := merged[key].(map[string]interface{})
+		if valueIsMap && (mergedIsMap || merged[key] == nil) {
+			if mergedMap == nil {
+				mergedMap = map[string]interface{}{}
+				merged[key] = mergedMap
+			}
+			baseMap, _ := baseValue.(map[string]interface{})
+			if baseMap == nil {
+				baseMap = map[string]interface{}{}
+			}
+			mergeValuesAdditions(mergedMap, baseMap, valueMap, dotted, document, setBy, conflicts, skipped)
+			continue
+		}
+
+		if first, ok := setBy[dotted]; ok && first != document && !reflect.DeepEqual(merged[key], value) {
+			*conflicts = append(*conflicts, ValuesConflict{Key: dotted, Kept: merged[key], Dropped: value, Document: document})
+			skipped[dotted] = true
+			continue
+		}
+		merged[key] = value
+		setBy[dotted] = document
+	}
+}
@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// stubConvertManifestDocument converts documents with convert instead of the LLM
+func stubConvertManifestDocument(t *testing.T, convert func(opts ConvertFileOpts) (map[string]string, string, error)) {
+	original := convertManifestDocument
+	t.Cleanup(func() { convertManifestDocument = original })
+	convertManifestDocument = func(ctx context.Context, opts ConvertFileOpts) (map[string]string, string, error) {
+		return convert(opts)
+	}
+}
+
+func TestConvertFileMultipleDocuments(t *testing.T) {
+	require.NoError(t, param.Init(nil))
+	manifest, err := os.ReadFile(filepath.Join("testdata", "convert", "three-documents.yaml"))
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	stubConvertManifestDocument(t, func(opts ConvertFileOpts) (map[string]string, string, error) {
+		calls.Add(1)
+		assert.Equal(t, "global:\n  env: prod\n", opts.ValuesYAML, "every document is converted against the same values")
+		assert.Equal(t, 1, len(splitManifestDocuments(opts.Content)))
+
+		// the LLM names every template the same, and each document adds its own values
+		switch {
+		case strings.Contains(opts.Content, "kind: Deployment"):
+			return map[string]string{
+				"templates/manifest.yaml": "kind: Deployment",
+				"templates/_helpers.tpl":  "{{- define \"chart.fullname\" -}}\nfull\n{{- end }}\n",
+			}, "global:\n  env: prod\nweb:\n  replicaCount: 2\n  port: 8080\n", nil
+		case strings.Contains(opts.Content, "kind: Service"):
+			return map[string]string{
+				"templates/manifest.yaml": "kind: Service",
+				"templates/_helpers.tpl":  "{{- define \"chart.fullname\" -}}\nfull\n{{- end }}\n",
+			}, "global:\n  env: prod\nweb:\n  port: 80\n  serviceType: ClusterIP\n", nil
+		default:
+			return map[string]string{
+				"templates/manifest.yaml": "kind: ConfigMap",
+			}, "global:\n  env: prod\nconfig:\n  logLevel: info\n", nil
+		}
+	})
+
+	files, valuesYAML, err := ConvertFile(context.Background(), ConvertFileOpts{
+		Path:       "manifests/web.yaml",
+		Content:    string(manifest),
+		ValuesYAML: "global:\n  env: prod\n",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, map[string]string{
+		"templates/deployment-web.yaml":       "kind: Deployment",
+		"templates/service-web.yaml":          "kind: Service",
+		"templates/configmap-web-config.yaml": "kind: ConfigMap",
+		"templates/_helpers.tpl":              "{{- define \"chart.fullname\" -}}\nfull\n{{- end }}\n",
+	}, files)
+
+	var values map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(valuesYAML), &values))
+	assert.Equal(t, map[string]interface{}{
+		"global": map[string]interface{}{"env": "prod"},
+		// the service's port conflicts with the deployment's, the deployment's is kept
+		"web":    map[string]interface{}{"replicaCount": 2, "port": 8080, "serviceType": "ClusterIP"},
+		"config": map[string]interface{}{"logLevel": "info"},
+	}, values)
+}
+
+func TestConvertFileMultipleDocumentsError(t *testing.T) {
+	stubConvertManifestDocument(t, func(opts ConvertFileOpts) (map[string]string, string, error) {
+		if strings.Contains(opts.Content, "kind: Service") {
+			return nil, "", errors.New("rate limited")
+		}
+		return map[string]string{"templates/a.yaml": opts.Content}, opts.ValuesYAML, nil
+	})
+
+	_, _, err := ConvertFile(context.Background(), ConvertFileOpts{
+		Path:    "manifests/web.yaml",
+		Content: "kind: Deployment\n---\nkind: Service\n",
+	})
+	assert.ErrorContains(t, err, "failed to convert document 2 of manifests/web.yaml: rate limited")
+}
+
+func TestConvertFileSingleDocument(t *testing.T) {
+	stubConvertManifestDocument(t, func(opts ConvertFileOpts) (map[string]string, string, error) {
+		return map[string]string{"templates/deployment.yaml": opts.Content}, opts.ValuesYAML, nil
+	})
+
+	// a leading separator and an empty trailing document don't make a manifest multi-document
+	files, _, err := ConvertFile(context.Background(), ConvertFileOpts{
+		Path:    "deployment.yaml",
+		Content: "---\nkind: Deployment\n---\n# nothing here\n",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"templates/deployment.yaml": "---\nkind: Deployment\n---\n# nothing here\n"}, files)
+}
+
+func TestMergeConvertedValues(t *testing.T) {
+	require.NoError(t, param.Init(nil))
+	tests := []struct {
+		name          string
+		base          string
+		converted     []string
+		want          string
+		wantConflicts []ValuesConflict
+	}{
+		{
+			name:      "additions are merged",
+			base:      "a: 1\n",
+			converted: []string{"a: 1\nb: 2\n", "a: 1\nc:\n  d: 3\n"},
+			want:      "a: 1\nb: 2\nc:\n  d: 3\n",
+		},
+		{
+			name:          "same key with different defaults keeps the first",
+			converted:     []string{"web:\n  port: 8080\n", "web:\n  port: 80\n"},
+			want:          "web:\n  port: 8080\n",
+			wantConflicts: []ValuesConflict{{Key: "web.port", Kept: 8080, Dropped: 80, Document: 1}},
+		},
+		{
+			name:      "same key with the same default isn't a conflict",
+			converted: []string{"web:\n  port: 8080\n", "web:\n  port: 8080\n"},
+			want:      "web:\n  port: 8080\n",
+		},
+		{
+			name:      "a change to a base key is kept",
+			base:      "replicas: 1\n",
+			converted: []string{"replicas: 1\n", "replicas: 3\n"},
+			want:      "replicas: 3\n",
+		},
+		{
+			name:      "removed keys stay",
+			base:      "a: 1\nb: 2\n",
+			converted: []string{"a: 1\n"},
+			want:      "a: 1\nb: 2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts, err := mergeConvertedValues(tt.base, tt.converted)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			if tt.wantConflicts == nil {
+				assert.Empty(t, conflicts)
+			} else {
+				assert.Equal(t, tt.wantConflicts, conflicts)
+			}
+		})
+	}
+}
+
+func TestConvertFileMultipleDocumentsKeepsValuesFormatting(t *testing.T) {
+	require.NoError(t, param.Init(nil))
+
+	base := `# Default values for web.
+global:
+  # the environment, used in labels
+  env: prod
+
+resources: &resources
+  limits:
+    cpu: 100m
+
+web:
+  resources: *resources
+  port: 8080 # the container port
+`
+
+	stubConvertManifestDocument(t, func(opts ConvertFileOpts) (map[string]string, string, error) {
+		// the LLM answers with the values re-marshaled, without comments and with anchors expanded
+		if strings.Contains(opts.Content, "kind: Deployment") {
+			return map[string]string{"templates/manifest.yaml": "kind: Deployment"},
+				"global:\n  env: prod\nresources:\n  limits:\n    cpu: 100m\nweb:\n  resources:\n    limits:\n      cpu: 100m\n  port: 8080\n  replicaCount: 2\n", nil
+		}
+		return map[string]string{"templates/manifest.yaml": "kind: Service"},
+			"global:\n  env: prod\nweb:\n  port: 8080\n  replicaCount: 3\nservice:\n  type: ClusterIP\n", nil
+	})
+
+	_, valuesYAML, err := ConvertFile(context.Background(), ConvertFileOpts{
+		Path:       "manifests/web.yaml",
+		Content:    "kind: Deployment\n---\nkind: Service\n",
+		ValuesYAML: base,
+	})
+	require.NoError(t, err)
+
+	// the comments and anchors of values.yaml are kept, and the service's replicaCount conflicts
+	// with the deployment's and isn't written
+	assert.Equal(t, `# Default values for web.
+global:
+  # the environment, used in labels
+  env: prod
+
+resources: &resources
+  limits:
+    cpu: 100m
+
+web:
+  resources: *resources
+  port: 8080 # the container port
+  replicaCount: 2
+service:
+  type: ClusterIP
+`, valuesYAML)
+}
+
+func TestUniqueFilePath(t *testing.T) {
+	files := map[string]string{"templates/service-web.yaml": "", "templates/service-web-2.yaml": ""}
+	assert.Equal(t, "templates/service-web-3.yaml", uniqueFilePath(files, "templates/service-web.yaml"))
+	assert.Equal(t, "templates/NOTES.txt", uniqueFilePath(files, "templates/NOTES.txt"))
+}
+
+func TestResourceTemplatePath(t *testing.T) {
+	assert.Equal(t, "templates/deployment-web.yaml", resourceTemplatePath("kind: Deployment\nmetadata:\n  name: web\n"))
+	assert.Equal(t, "templates/clusterrole-system-controller.yaml", resourceTemplatePath("kind: ClusterRole\nmetadata:\n  name: system:controller\n"))
+	assert.Equal(t, "templates/namespace.yaml", resourceTemplatePath("kind: Namespace\n"))
+	assert.Equal(t, "", resourceTemplatePath("data: {}\n"))
+}
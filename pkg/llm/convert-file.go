@@ -8,10 +8,8 @@ import (
 	anthropic "github.com/anthropics/anthropic-sdk-go"
 	"github.com/jpoz/groq"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
-	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/sourcegraph/go-diff/diff"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 )
 
 type ConvertFileOpts struct {
@@ -20,26 +18,57 @@ type ConvertFileOpts struct {
 	ValuesYAML string
 }
 
-// ConvertFile is sync and will return a map of path:content
+// ConvertFile is sync and will return a map of path:content. A manifest with more than one
+// document has each converted on its own, see convertDocuments.
 func ConvertFile(ctx context.Context, opts ConvertFileOpts) (map[string]string, string, error) {
 	logger.Info("Converting file",
 		zap.String("path", opts.Path),
 	)
 
-	return convertFileUsingGroq(ctx, opts)
+	documents := splitManifestDocuments(opts.Content)
+	if len(documents) > 1 {
+		return convertDocuments(ctx, opts, documents)
+	}
+	return convertManifestDocument(ctx, opts)
 }
 
-func convertFileUsingGroq(ctx context.Context, opts ConvertFileOpts) (map[string]string, string, error) {
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
+// convertDocument converts a manifest with a single document
+func convertDocument(ctx context.Context, opts ConvertFileOpts) (map[string]string, string, error) {
+	// the mechanical substitutions are made before the LLM sees the manifest, a manifest the
+	// pre-pass can't parse is sent as it is
+	prePass, err := convertPrePass(opts.Content, opts.ValuesYAML)
+	if err != nil {
+		logger.Warn("Skipping conversion pre-pass", zap.String("path", opts.Path), zap.Error(err))
+		return convertFileUsingGroq(ctx, opts, nil)
+	}
+
+	valuesYAML, err := mergeValuesYAML(opts.ValuesYAML, prePass.ValuesYAML)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to merge pre-pass values: %w", err)
+	}
+	opts.Content = prePass.Content
+	opts.ValuesYAML = valuesYAML
+
+	files, updatedValuesYAML, err := convertFileUsingGroq(ctx, opts, prePass)
+	if err != nil {
+		return nil, "", err
+	}
+	addPrePassHelpers(files, prePass.Helpers)
 
+	return files, updatedValuesYAML, nil
+}
+
+func convertFileUsingGroq(ctx context.Context, opts ConvertFileOpts, prePass *convertPrePassResult) (map[string]string, string, error) {
+	ctx, executePlanPrompt := withPrompt(ctx, promptExecutePlanSystem)
+	ctx, convertFilePrompt := withPrompt(ctx, promptConvertFileSystem)
 	messages := []groq.Message{
 		{
 			Role:    "system",
-			Content: executePlanSystemPrompt,
+			Content: executePlanPrompt,
 		},
 		{
 			Role:    "system",
-			Content: convertFileSystemPrompt,
+			Content: convertFilePrompt,
 		},
 		{
 			Role: "user",
@@ -60,14 +89,23 @@ Convert the following Kubernetes manifest to a helm template:
 			`, opts.Content),
 		},
 	}
+	if prePass != nil {
+		messages = append(messages, groq.Message{Role: "user", Content: prePassMessage(prePass)})
+	}
 
-	response, err := client.CreateChatCompletion(groq.CompletionCreateParams{
-		Model:    "llama-3.3-70b-versatile",
+	params := groq.CompletionCreateParams{
+		Model:    ModelFor(OperationConvert),
 		Messages: messages,
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return nil, "", err
+	}
+
+	response, err := createGroqChatCompletion(ctx, params)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to get converted file content: %w", err)
 	}
+	recordGroqUsage(ctx, OperationConvert, ModelFor(OperationConvert), &response.Usage)
 
 	artifacts, err := parseArtifactsInResponse(response.Choices[0].Message.Content)
 	if err != nil {
@@ -120,15 +158,17 @@ Convert the following Kubernetes manifest to a helm template:
 	return artifactsMap, updatedValuesYAML, nil
 }
 
-func convertFileUsingClaude(ctx context.Context, opts ConvertFileOpts) (map[string]string, string, error) {
+func convertFileUsingClaude(ctx context.Context, opts ConvertFileOpts, prePass *convertPrePassResult) (map[string]string, string, error) {
 	client, err := newAnthropicClient(ctx)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to get anthropic client: %w", err)
 	}
 
+	ctx, executePlanPrompt := withPrompt(ctx, promptExecutePlanSystem)
+	ctx, convertFilePrompt := withPrompt(ctx, promptConvertFileSystem)
 	messages := []anthropic.MessageParam{
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(executePlanSystemPrompt)),
-		anthropic.NewUserMessage(anthropic.NewTextBlock(convertFileSystemPrompt)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(executePlanPrompt)),
+		anthropic.NewUserMessage(anthropic.NewTextBlock(convertFilePrompt)),
 		anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`
 Here is the existing values.yaml file:
 ---
@@ -144,15 +184,26 @@ Convert the following Kubernetes manifest to a helm template:
 			`, opts.Content)),
 		),
 	}
+	if prePass != nil {
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(prePassMessage(prePass))))
+	}
 
-	response, err := client.Messages.New(context.TODO(), anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationConvertValues)),
 		MaxTokens: anthropic.F(int64(8192)),
 		Messages:  anthropic.F(messages),
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return nil, "", err
+	}
+
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	response, err := client.Messages.New(requestCtx, params)
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to create message: %w", err)
 	}
+	recordAnthropicUsage(ctx, OperationConvertValues, response)
 
 	artifacts, err := parseArtifactsInResponse(response.Content[0].Text)
 	if err != nil {
@@ -301,50 +352,3 @@ func extractAddedContent(patchContent string) string {
 
 	return strings.Join(contentLines, "\n")
 }
-
-// mergeValuesYAML merges the new values into the existing values
-func mergeValuesYAML(existingYAML, newYAML string) (string, error) {
-	// Check if the newYAML is empty
-	if strings.TrimSpace(newYAML) == "" {
-		return existingYAML, nil
-	}
-
-	// Try to parse both as YAML to see if they're valid
-	var existingValues, newValues map[string]interface{}
-	existingErr := yaml.Unmarshal([]byte(existingYAML), &existingValues)
-	newErr := yaml.Unmarshal([]byte(newYAML), &newValues)
-
-	// If either isn't valid YAML or is null after parsing, treat as text
-	if existingErr != nil || newErr != nil || existingValues == nil || newValues == nil {
-		logger.Info("One or both YAML files couldn't be parsed as maps, treating as text")
-		// Simple text append with a separator if both have content
-		if strings.TrimSpace(existingYAML) != "" && strings.TrimSpace(newYAML) != "" {
-			return existingYAML + "\n# Added by conversion\n" + newYAML, nil
-		}
-		// If existing is empty, just use new
-		if strings.TrimSpace(existingYAML) == "" {
-			return newYAML, nil
-		}
-		// Otherwise return existing
-		return existingYAML, nil
-	}
-
-	// If we get here, both are valid YAML maps, so do the normal merge
-	// If existing values is nil, initialize it
-	if existingValues == nil {
-		existingValues = make(map[string]interface{})
-	}
-
-	// Merge new values into existing values
-	for k, v := range newValues {
-		existingValues[k] = v
-	}
-
-	// Marshal back to YAML
-	mergedYAML, err := yaml.Marshal(existingValues)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal merged values: %w", err)
-	}
-
-	return string(mergedYAML), nil
-}
@@ -0,0 +1,420 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// the named templates the pre-pass includes, they are added to the converted chart's helpers
+const (
+	prePassFullnameHelper = "chart.fullname"
+	prePassLabelsHelper   = "chart.labels"
+	prePassHelpersPath    = "templates/_helpers.tpl"
+)
+
+// labels that chart.labels sets, they are removed from a manifest's labels in favor of the include
+var prePassStandardLabels = map[string]bool{
+	"app.kubernetes.io/name":       true,
+	"app.kubernetes.io/instance":   true,
+	"app.kubernetes.io/version":    true,
+	"app.kubernetes.io/managed-by": true,
+	"helm.sh/chart":                true,
+}
+
+// kinds whose spec.replicas is moved to values
+var prePassScalableKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"ReplicaSet":  true,
+}
+
+// prePassHelperDefinitions are the helpers the pre-pass relies on, in the order they're written
+var prePassHelperDefinitions = []struct {
+	Name       string
+	Definition string
+}{
+	{"chart.name", `{{- define "chart.name" -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" }}
+{{- end }}`},
+	{prePassFullnameHelper, `{{- define "chart.fullname" -}}
+{{- if .Values.fullnameOverride }}
+{{- .Values.fullnameOverride | trunc 63 | trimSuffix "-" }}
+{{- else }}
+{{- $name := default .Chart.Name .Values.nameOverride }}
+{{- if contains $name .Release.Name }}
+{{- .Release.Name | trunc 63 | trimSuffix "-" }}
+{{- else }}
+{{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" }}
+{{- end }}
+{{- end }}
+{{- end }}`},
+	{"chart.chart", `{{- define "chart.chart" -}}
+{{- printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 63 | trimSuffix "-" }}
+{{- end }}`},
+	{"chart.selectorLabels", `{{- define "chart.selectorLabels" -}}
+app.kubernetes.io/name: {{ include "chart.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end }}`},
+	{prePassLabelsHelper, `{{- define "chart.labels" -}}
+helm.sh/chart: {{ include "chart.chart" . }}
+{{ include "chart.selectorLabels" . }}
+{{- if .Chart.AppVersion }}
+app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
+{{- end }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- end }}`},
+}
+
+var (
+	prePassTokenRegex      = regexp.MustCompile(`__chartsmith_prepass_\d+__`)
+	prePassLabelsLineRegex = regexp.MustCompile(`(?m)^( *)__chartsmith_prepass_\d+__: ""$`)
+)
+
+// convertPrePassResult is a manifest with the mechanical substitutions already templated
+type convertPrePassResult struct {
+	// Content is the partially templated manifest
+	Content string
+	// ValuesYAML are the values the substitutions read, empty when there are none
+	ValuesYAML string
+	// ValuesKeys are the dotted paths of the values the pre-pass created, in the order they were created
+	ValuesKeys []string
+	// Helpers are the named templates Content includes
+	Helpers []string
+}
+
+// prePass collects the substitutions of one manifest. Templated values are written as tokens
+// while the manifest is still YAML, and swapped for the template text after it's encoded.
+type prePass struct {
+	tokens     map[string]string
+	values     map[string]interface{}
+	valuesKeys []string
+	helpers    map[string]bool
+	labelsKey  string
+}
+
+// convertPrePass makes the substitutions of a conversion that don't need judgement: the name and
+// namespace, standard labels, container images and replicas. Everything else in the manifest is
+// left as it was for the LLM. Values are created under a key derived from the resource name, one
+// that isn't in existingValuesYAML already.
+func convertPrePass(content string, existingValuesYAML string) (*convertPrePassResult, error) {
+	var doc yaml.Node
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	var next yaml.Node
+	if err := decoder.Decode(&next); err == nil {
+		return nil, fmt.Errorf("manifest has more than one document")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("manifest is not a mapping")
+	}
+	root := doc.Content[0]
+
+	kind := scalarValue(mappingValue(root, "kind"))
+	metadata := mappingValue(root, "metadata")
+	if kind == "" || metadata == nil || metadata.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("manifest has no kind or metadata")
+	}
+
+	p := &prePass{
+		tokens:  map[string]string{},
+		values:  map[string]interface{}{},
+		helpers: map[string]bool{},
+	}
+	component := prePassComponentKey(scalarValue(mappingValue(metadata, "name")), kind, existingValuesYAML)
+
+	if name := mappingValue(metadata, "name"); name != nil && name.Kind == yaml.ScalarNode {
+		p.template(name, fmt.Sprintf(`{{ include %q . }}`, prePassFullnameHelper))
+		p.helpers[prePassFullnameHelper] = true
+	}
+	if namespace := mappingValue(metadata, "namespace"); namespace != nil && namespace.Kind == yaml.ScalarNode {
+		p.template(namespace, `{{ .Release.Namespace }}`)
+	}
+	p.templateLabels(metadata)
+
+	spec := mappingValue(root, "spec")
+	if prePassScalableKinds[kind] {
+		if replicas := mappingValue(spec, "replicas"); replicas != nil && replicas.Kind == yaml.ScalarNode {
+			if count, err := strconv.Atoi(replicas.Value); err == nil {
+				p.setValue(count, component, "replicaCount")
+				p.template(replicas, fmt.Sprintf(`{{ .Values.%s.replicaCount }}`, component))
+			}
+		}
+	}
+
+	podSpec := prePassPodSpec(kind, root)
+	for i, container := range sequenceItems(mappingValue(podSpec, "containers")) {
+		key := []string{component}
+		if i > 0 {
+			key = append(key, prePassValuesKey(scalarValue(mappingValue(container, "name"))))
+		}
+		p.templateImage(container, key)
+	}
+	for _, container := range sequenceItems(mappingValue(podSpec, "initContainers")) {
+		p.templateImage(container, []string{component, prePassValuesKey(scalarValue(mappingValue(container, "name")))})
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	result := &convertPrePassResult{
+		Content:    p.render(buf.String()),
+		ValuesKeys: p.valuesKeys,
+	}
+	for _, helper := range prePassHelperDefinitions {
+		if p.helpers[helper.Name] {
+			result.Helpers = append(result.Helpers, helper.Name)
+		}
+	}
+	if len(p.values) > 0 {
+		var values bytes.Buffer
+		encoder := yaml.NewEncoder(&values)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(p.values); err != nil {
+			return nil, fmt.Errorf("failed to encode values: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, fmt.Errorf("failed to encode values: %w", err)
+		}
+		result.ValuesYAML = values.String()
+	}
+
+	return result, nil
+}
+
+// template replaces a scalar with a token that render swaps for text
+func (p *prePass) template(node *yaml.Node, text string) {
+	token := fmt.Sprintf("__chartsmith_prepass_%d__", len(p.tokens))
+	p.tokens[token] = text
+	node.Value = token
+	node.Tag = "!!str"
+	node.Style = 0
+}
+
+// templateLabels replaces the standard labels of a resource with the labels helper, which sets them
+func (p *prePass) templateLabels(metadata *yaml.Node) {
+	labels := mappingValue(metadata, "labels")
+	if labels == nil {
+		metadata.Content = append(metadata.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "labels"},
+			&yaml.Node{Kind: yaml.MappingNode},
+		)
+		labels = metadata.Content[len(metadata.Content)-1]
+	}
+	if labels.Kind != yaml.MappingNode {
+		return
+	}
+
+	kept := []*yaml.Node{}
+	for i := 0; i+1 < len(labels.Content); i += 2 {
+		if !prePassStandardLabels[labels.Content[i].Value] {
+			kept = append(kept, labels.Content[i], labels.Content[i+1])
+		}
+	}
+
+	p.labelsKey = fmt.Sprintf("__chartsmith_prepass_%d__", len(p.tokens))
+	p.tokens[p.labelsKey] = ""
+	labels.Style = 0
+	labels.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: p.labelsKey},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "", Style: yaml.DoubleQuotedStyle},
+	}, kept...)
+	p.helpers[prePassLabelsHelper] = true
+}
+
+// templateImage moves the image of a container to repository and tag values under key. Images
+// pinned by digest are left as they are.
+func (p *prePass) templateImage(container *yaml.Node, key []string) {
+	image := mappingValue(container, "image")
+	if image == nil || image.Kind != yaml.ScalarNode || image.Value == "" || strings.Contains(image.Value, "@") {
+		return
+	}
+
+	repository, tag := splitImage(image.Value)
+	imageKey := append(append([]string{}, key...), "image")
+	p.setValue(repository, append(imageKey, "repository")...)
+	p.setValue(tag, append(imageKey, "tag")...)
+
+	path := strings.Join(imageKey, ".")
+	p.template(image, fmt.Sprintf(`"{{ .Values.%s.repository }}:{{ .Values.%s.tag }}"`, path, path))
+}
+
+func (p *prePass) setValue(value interface{}, key ...string) {
+	values := p.values
+	for _, part := range key[:len(key)-1] {
+		child, ok := values[part].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			values[part] = child
+		}
+		values = child
+	}
+	values[key[len(key)-1]] = value
+	p.valuesKeys = append(p.valuesKeys, strings.Join(key, "."))
+}
+
+// render swaps the tokens in an encoded manifest for their template text
+func (p *prePass) render(encoded string) string {
+	if p.labelsKey != "" {
+		encoded = prePassLabelsLineRegex.ReplaceAllStringFunc(encoded, func(line string) string {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+			return fmt.Sprintf(`%s{{- include %q . | nindent %d }}`, indent, prePassLabelsHelper, len(indent))
+		})
+	}
+	return prePassTokenRegex.ReplaceAllStringFunc(encoded, func(token string) string {
+		return p.tokens[token]
+	})
+}
+
+// prePassPodSpec returns the pod spec of a workload, or nil for kinds that don't have one
+func prePassPodSpec(kind string, root *yaml.Node) *yaml.Node {
+	spec := mappingValue(root, "spec")
+	switch kind {
+	case "Pod":
+		return spec
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		return mappingValue(mappingValue(spec, "template"), "spec")
+	case "CronJob":
+		jobSpec := mappingValue(mappingValue(spec, "jobTemplate"), "spec")
+		return mappingValue(mappingValue(jobSpec, "template"), "spec")
+	}
+	return nil
+}
+
+// prePassComponentKey is the top level values key for a resource. The kind is added to it when
+// the existing values already use the key, so that another resource's values aren't overwritten.
+func prePassComponentKey(name string, kind string, existingValuesYAML string) string {
+	key := prePassValuesKey(name)
+	if key == "" || !unicode.IsLetter(rune(key[0])) {
+		key = prePassValuesKey(kind) + upperFirst(key)
+	}
+
+	existing := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(existingValuesYAML), &existing); err == nil {
+		if _, ok := existing[key]; ok {
+			key += upperFirst(prePassValuesKey(kind))
+		}
+	}
+	return key
+}
+
+// prePassValuesKey turns a kubernetes name like my-app into a values key like myApp
+func prePassValuesKey(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, part := range parts {
+		if i == 0 {
+			parts[i] = strings.ToLower(part[:1]) + part[1:]
+		} else {
+			parts[i] = upperFirst(part)
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// splitImage splits an image reference into its repository and tag, the tag defaults to latest.
+// A colon before the last slash is a registry port, not a tag.
+func splitImage(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+func sequenceItems(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+// addPrePassHelpers adds the helpers the pre-pass included to the converted files, keeping any
+// helpers file the LLM returned and only adding the definitions it's missing
+func addPrePassHelpers(files map[string]string, helpers []string) {
+	if len(helpers) == 0 {
+		return
+	}
+
+	existing := files[prePassHelpersPath]
+	defined := map[string]bool{}
+	for _, helper := range getDefinedHelpers([]workspacetypes.File{{FilePath: prePassHelpersPath, Content: existing}}) {
+		defined[helper.Name] = true
+	}
+
+	definitions := []string{}
+	for _, helper := range prePassHelperDefinitions {
+		if !defined[helper.Name] {
+			definitions = append(definitions, helper.Definition)
+		}
+	}
+	if len(definitions) == 0 {
+		return
+	}
+
+	content := strings.Join(definitions, "\n\n") + "\n"
+	if strings.TrimSpace(existing) != "" {
+		content = strings.TrimRight(existing, "\n") + "\n\n" + content
+	}
+	files[prePassHelpersPath] = content
+}
+
+// prePassMessage tells the LLM what the pre-pass already templated, so it only makes the
+// conversions that need judgement
+func prePassMessage(result *convertPrePassResult) string {
+	var sb strings.Builder
+	sb.WriteString("The manifest has already been partially templated. The name, namespace, standard labels, container images and replicas are wired to the chart, keep these as they are.\n")
+	if len(result.Helpers) > 0 {
+		fmt.Fprintf(&sb, "The %s helpers are defined in %s, do not define them again.\n", strings.Join(result.Helpers, " and "), prePassHelpersPath)
+	}
+	if len(result.ValuesKeys) > 0 {
+		sb.WriteString("The existing values.yaml already has these keys for this manifest, do not add them again:\n")
+		for _, key := range result.ValuesKeys {
+			fmt.Fprintf(&sb, "- %s\n", key)
+		}
+	}
+	sb.WriteString("Only convert what is left that needs judgement, like probes, env wiring, resources and conditionals.\n")
+	return sb.String()
+}
@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertPrePass(t *testing.T) {
+	tests := []struct {
+		name           string
+		manifest       string
+		existingValues string
+		wantContent    string
+		wantValues     string
+		wantKeys       []string
+	}{
+		{
+			name: "deployment",
+			manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web-frontend
+  namespace: shop
+  labels:
+    app.kubernetes.io/name: web-frontend
+    app.kubernetes.io/managed-by: kubectl
+    tier: frontend
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: web-frontend
+  template:
+    metadata:
+      labels:
+        app: web-frontend
+    spec:
+      initContainers:
+      - name: migrate
+        image: registry.example.com:5000/shop/migrate:v2
+      containers:
+      - name: web
+        image: nginx:1.25
+        readinessProbe:
+          httpGet:
+            path: /healthz
+            port: 80
+      - name: log-shipper
+        image: fluent/fluent-bit
+`,
+			existingValues: "replicaCount: 1\n",
+			wantContent: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "chart.fullname" . }}
+  namespace: {{ .Release.Namespace }}
+  labels:
+    {{- include "chart.labels" . | nindent 4 }}
+    tier: frontend
+spec:
+  replicas: {{ .Values.webFrontend.replicaCount }}
+  selector:
+    matchLabels:
+      app: web-frontend
+  template:
+    metadata:
+      labels:
+        app: web-frontend
+    spec:
+      initContainers:
+        - name: migrate
+          image: "{{ .Values.webFrontend.migrate.image.repository }}:{{ .Values.webFrontend.migrate.image.tag }}"
+      containers:
+        - name: web
+          image: "{{ .Values.webFrontend.image.repository }}:{{ .Values.webFrontend.image.tag }}"
+          readinessProbe:
+            httpGet:
+              path: /healthz
+              port: 80
+        - name: log-shipper
+          image: "{{ .Values.webFrontend.logShipper.image.repository }}:{{ .Values.webFrontend.logShipper.image.tag }}"
+`,
+			wantValues: `webFrontend:
+  image:
+    repository: nginx
+    tag: "1.25"
+  logShipper:
+    image:
+      repository: fluent/fluent-bit
+      tag: latest
+  migrate:
+    image:
+      repository: registry.example.com:5000/shop/migrate
+      tag: v2
+  replicaCount: 3
+`,
+			wantKeys: []string{
+				"webFrontend.replicaCount",
+				"webFrontend.image.repository",
+				"webFrontend.image.tag",
+				"webFrontend.logShipper.image.repository",
+				"webFrontend.logShipper.image.tag",
+				"webFrontend.migrate.image.repository",
+				"webFrontend.migrate.image.tag",
+			},
+		},
+		{
+			name: "deployment whose key is already in values",
+			manifest: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: api
+        image: example/api@sha256:0123456789abcdef
+`,
+			existingValues: "api:\n  enabled: true\n",
+			wantContent: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "chart.fullname" . }}
+  labels:
+    {{- include "chart.labels" . | nindent 4 }}
+spec:
+  replicas: {{ .Values.apiDeployment.replicaCount }}
+  template:
+    spec:
+      containers:
+        - name: api
+          image: example/api@sha256:0123456789abcdef
+`,
+			wantValues: "apiDeployment:\n  replicaCount: 2\n",
+			wantKeys:   []string{"apiDeployment.replicaCount"},
+		},
+		{
+			name: "service",
+			manifest: `apiVersion: v1
+kind: Service
+metadata:
+  name: web-frontend
+spec:
+  selector:
+    app: web-frontend
+  ports:
+  - port: 80
+    targetPort: 80
+`,
+			wantContent: `apiVersion: v1
+kind: Service
+metadata:
+  name: {{ include "chart.fullname" . }}
+  labels:
+    {{- include "chart.labels" . | nindent 4 }}
+spec:
+  selector:
+    app: web-frontend
+  ports:
+    - port: 80
+      targetPort: 80
+`,
+		},
+		{
+			name: "configmap",
+			manifest: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+  labels:
+    helm.sh/chart: old-1.0.0
+data:
+  LOG_LEVEL: info
+  config.yaml: |
+    listen: 0.0.0.0:80
+`,
+			wantContent: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "chart.fullname" . }}
+  labels:
+    {{- include "chart.labels" . | nindent 4 }}
+data:
+  LOG_LEVEL: info
+  config.yaml: |
+    listen: 0.0.0.0:80
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := convertPrePass(tt.manifest, tt.existingValues)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantContent, result.Content)
+			assert.Equal(t, tt.wantValues, result.ValuesYAML)
+			assert.Equal(t, tt.wantKeys, result.ValuesKeys)
+			assert.Equal(t, []string{"chart.fullname", "chart.labels"}, result.Helpers)
+		})
+	}
+}
+
+func TestConvertPrePassRejectsUnsupportedManifests(t *testing.T) {
+	for _, manifest := range []string{
+		"kind: ConfigMap\nmetadata:\n  name: a\n---\nkind: ConfigMap\nmetadata:\n  name: b\n",
+		"- not\n- a\n- mapping\n",
+		"data:\n  key: value\n",
+		"kind: [",
+	} {
+		_, err := convertPrePass(manifest, "")
+		assert.Error(t, err, manifest)
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image          string
+		wantRepository string
+		wantTag        string
+	}{
+		{"nginx", "nginx", "latest"},
+		{"nginx:1.25", "nginx", "1.25"},
+		{"localhost:5000/app", "localhost:5000/app", "latest"},
+		{"localhost:5000/app:v1", "localhost:5000/app", "v1"},
+	}
+
+	for _, tt := range tests {
+		repository, tag := splitImage(tt.image)
+		assert.Equal(t, tt.wantRepository, repository, tt.image)
+		assert.Equal(t, tt.wantTag, tag, tt.image)
+	}
+}
+
+func TestAddPrePassHelpers(t *testing.T) {
+	files := map[string]string{"templates/deployment.yaml": "kind: Deployment\n"}
+	addPrePassHelpers(files, []string{"chart.fullname"})
+	helpers := files["templates/_helpers.tpl"]
+	for _, name := range []string{"chart.name", "chart.fullname", "chart.chart", "chart.selectorLabels", "chart.labels"} {
+		assert.Contains(t, helpers, `define "`+name+`"`)
+	}
+
+	// a helpers file from the LLM is kept, only the missing definitions are added
+	files = map[string]string{"templates/_helpers.tpl": "{{- define \"chart.name\" -}}\nmine\n{{- end }}\n"}
+	addPrePassHelpers(files, []string{"chart.fullname"})
+	helpers = files["templates/_helpers.tpl"]
+	assert.True(t, strings.HasPrefix(helpers, "{{- define \"chart.name\" -}}\nmine\n{{- end }}\n\n"))
+	assert.Equal(t, 1, strings.Count(helpers, `define "chart.name"`))
+	assert.Contains(t, helpers, `define "chart.fullname"`)
+
+	files = map[string]string{}
+	addPrePassHelpers(files, nil)
+	assert.Empty(t, files)
+}
@@ -3,15 +3,19 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
 	"strings"
 	"time"
 
 	anthropic "github.com/anthropics/anthropic-sdk-go"
 	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/replicatedhq/chartsmith/pkg/yamlpatch"
 	"github.com/tuvistavie/securerandom"
 	"go.uber.org/zap"
 )
@@ -23,9 +27,8 @@ const (
 	Model_Sonnet37 = "claude-3-7-sonnet-20250219"
 	Model_Sonnet35 = "claude-3-5-sonnet-20241022"
 
-	minFuzzyMatchLen  = 50 // Minimum length for fuzzy matching
-	fuzzyMatchTimeout = 10 * time.Second
-	chunkSize         = 200 // Increased chunk size for better performance
+	minFuzzyMatchLen = 50  // Minimum length for fuzzy matching
+	chunkSize        = 200 // Increased chunk size for better performance
 )
 
 type CreateWorkspaceFromArchiveAction struct {
@@ -47,6 +50,7 @@ type StrReplaceLog struct {
 	ContextBefore  string    `json:"context_before,omitempty"`
 	ContextAfter   string    `json:"context_after,omitempty"`
 	ErrorMessage   string    `json:"error_message,omitempty"`
+	FailureKind    string    `json:"failure_kind,omitempty"`
 }
 
 // logStrReplaceOperation logs detailed information about each str_replace operation to the database
@@ -116,14 +120,14 @@ func logStrReplaceOperation(ctx context.Context, filePath, oldStr, newStr string
 	return nil
 }
 
-// UpdateStrReplaceLogErrorMessage updates the error message for a recently logged str_replace operation
-func UpdateStrReplaceLogErrorMessage(ctx context.Context, filePath, oldStr, errorMessage string) error {
+// UpdateStrReplaceLogErrorMessage updates the error message and failure classification for a recently logged str_replace operation
+func UpdateStrReplaceLogErrorMessage(ctx context.Context, filePath, oldStr, errorMessage string, failureKind StrReplaceFailureKind) error {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
 	query := `
 		UPDATE str_replace_log
-		SET error_message = $1
+		SET error_message = $1, failure_kind = $4
 		WHERE id IN (
 			SELECT id FROM str_replace_log
 			WHERE file_path = $2 AND old_str = $3 AND found = false
@@ -132,7 +136,7 @@ func UpdateStrReplaceLogErrorMessage(ctx context.Context, filePath, oldStr, erro
 		)
 	`
 
-	_, err := conn.Exec(ctx, query, errorMessage, filePath, oldStr)
+	_, err := conn.Exec(ctx, query, errorMessage, filePath, oldStr, string(failureKind))
 	if err != nil {
 		return fmt.Errorf("failed to update error message in str_replace log: %w", err)
 	}
@@ -151,7 +155,7 @@ func GetStrReplaceLogs(ctx context.Context, limit int, foundOnly bool, filePath
 		SELECT
 			id, created_at, file_path, found, old_str, new_str,
 			updated_content, old_str_len, new_str_len,
-			context_before, context_after, error_message
+			context_before, context_after, error_message, failure_kind
 		FROM str_replace_log
 		WHERE 1=1
 	`)
@@ -189,7 +193,7 @@ func GetStrReplaceLogs(ctx context.Context, limit int, foundOnly bool, filePath
 	var logs []StrReplaceLog
 	for rows.Next() {
 		var log StrReplaceLog
-		var contextBefore, contextAfter, errorMessage interface{}
+		var contextBefore, contextAfter, errorMessage, failureKind interface{}
 
 		err := rows.Scan(
 			&log.ID,
@@ -204,6 +208,7 @@ func GetStrReplaceLogs(ctx context.Context, limit int, foundOnly bool, filePath
 			&contextBefore,
 			&contextAfter,
 			&errorMessage,
+			&failureKind,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan str_replace log row: %w", err)
@@ -219,6 +224,9 @@ func GetStrReplaceLogs(ctx context.Context, limit int, foundOnly bool, filePath
 		if errorMessage != nil {
 			log.ErrorMessage = errorMessage.(string)
 		}
+		if failureKind != nil {
+			log.FailureKind = failureKind.(string)
+		}
 
 		logs = append(logs, log)
 	}
@@ -230,9 +238,13 @@ func GetStrReplaceLogs(ctx context.Context, limit int, foundOnly bool, filePath
 	return logs, nil
 }
 
-// GetStrReplaceFailures retrieves a list of failed str_replace operations
-func GetStrReplaceFailures(ctx context.Context, limit int) ([]StrReplaceLog, error) {
-	return GetStrReplaceLogs(ctx, limit, false, "")
+// GetStrReplaceFailures retrieves a page of failed str_replace operations and the cursor for the
+// next page
+func GetStrReplaceFailures(ctx context.Context, filter StrReplaceFailureFilter) ([]StrReplaceLog, *StrReplaceFailureCursor, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return ListStrReplaceFailures(ctx, conn, filter)
 }
 
 func PerformStringReplacement(content, oldStr, newStr string) (string, bool, error) {
@@ -255,10 +267,17 @@ func PerformStringReplacement(content, oldStr, newStr string) (string, bool, err
 		updatedContent := strings.ReplaceAll(content, oldStr, newStr)
 		return updatedContent, true, nil
 	}
-	
+
+	// files written before line endings were normalized can still have CRLF, the LLM sends LF
+	if updatedContent, ok := replaceIgnoringCRLF(content, oldStr, newStr); ok {
+		logger.Debug("Found match ignoring CRLF line endings, performing replacement")
+		return updatedContent, true, nil
+	}
+
 	logger.Debug("No exact match found, attempting fuzzy matching")
 
 	// Create a context with timeout for fuzzy matching
+	fuzzyMatchTimeout := param.GetTimeouts().FuzzyMatch
 	ctx, cancel := context.WithTimeout(context.Background(), fuzzyMatchTimeout)
 	defer cancel()
 
@@ -316,6 +335,23 @@ func PerformStringReplacement(content, oldStr, newStr string) (string, bool, err
 	}
 }
 
+// replaceIgnoringCRLF replaces oldStr in content comparing with LF line endings, the result keeps
+// the CRLF line endings of content
+func replaceIgnoringCRLF(content, oldStr, newStr string) (string, bool) {
+	if !strings.Contains(content, "\r\n") {
+		return content, false
+	}
+
+	normalized := strings.ReplaceAll(content, "\r\n", "\n")
+	oldStr = strings.ReplaceAll(oldStr, "\r\n", "\n")
+	if oldStr == "" || !strings.Contains(normalized, oldStr) {
+		return content, false
+	}
+
+	updated := strings.ReplaceAll(normalized, oldStr, strings.ReplaceAll(newStr, "\r\n", "\n"))
+	return strings.ReplaceAll(updated, "\n", "\r\n"), true
+}
+
 func findBestMatchRegion(content, oldStr string, minMatchLen int) (int, int) {
 	// Early return if strings are too small
 	if len(oldStr) < minMatchLen {
@@ -434,8 +470,47 @@ func findBestMatchRegion(content, oldStr string, minMatchLen int) (int, int) {
 	return -1, -1
 }
 
-func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWithPath, plan *workspacetypes.Plan, currentContent string, interimContentCh chan string) (string, error) {
+// maxOffPathToolCalls is how many times the model can try to change a file other than the action's
+// before the action fails
+const maxOffPathToolCalls = 5
+
+// ErrTooManyOffPathToolCalls is returned when the model keeps trying to change files outside the
+// action, so that the plan fails instead of looping
+var ErrTooManyOffPathToolCalls = errors.New("too many tool calls outside the action's file")
+
+// isActionPath reports whether a tool call's path is the file of the action. Models sometimes add
+// a leading slash or ./ to the path they were given.
+func isActionPath(toolPath string, actionPath string) bool {
+	clean := func(p string) string {
+		return path.Clean("/" + strings.TrimSpace(p))
+	}
+	return clean(toolPath) == clean(actionPath)
+}
+
+// offPathToolResponse is the tool result for a change to a file other than the action's
+func offPathToolResponse(actionPath string) string {
+	return fmt.Sprintf("Error: only %s may be modified by this action. Other files are changed by their own actions in the plan, make this change to %s only.", actionPath, actionPath)
+}
+
+// withReviewNote appends the reviewer's note on a file to the instructions for changing it
+func withReviewNote(instructions string, note string) string {
+	if strings.TrimSpace(note) == "" {
+		return instructions
+	}
+	return instructions + "\n\nThe reviewer left this note on the file, adjust the change to it:\n" + note
+}
+
+// ExecuteAction applies an action of a plan to the content of its file and returns the new content.
+// The content is sent to interimContentCh as it changes, see interimContentSender, sends never
+// block and a nil channel discards them.
+func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWithPath, plan *workspacetypes.Plan, currentContent string, interimContentCh chan llmtypes.InterimContent) (string, error) {
+	// ctx is replaced before the activity monitor below starts using it
+	ctx, systemPrompt := withPrompt(ctx, promptExecutePlanSystem)
+	ctx, instructions := withPrompt(ctx, promptDetailedPlanInstructions)
+
 	updatedContent := currentContent
+	interimContent := newInterimContentSender(interimContentCh, InterimContentInterval)
+	defer interimContent.Close()
 	lastActivity := time.Now()
 
 	// Create a goroutine to monitor for activity timeouts and a channel for errors
@@ -443,22 +518,23 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 	activityDone := make(chan struct{})
 	errCh := make(chan error, 1)
 
+	inactivityTimeout := param.GetTimeouts().LLMInactivity
 	go func() {
-		ticker := time.NewTicker(30 * time.Second)
+		ticker := time.NewTicker(inactivityTimeout / 4)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
-				// If no activity for 2 minutes, consider the LLM stuck
-				if time.Since(lastActivity) > 2*time.Minute {
-					errMsg := fmt.Sprintf("No activity from LLM for 2 minutes, operation stalled (last activity at %s)",
-						lastActivity.Format(time.RFC3339))
-					logger.Warn(errMsg)
+				// If no activity for the inactivity timeout, consider the LLM stuck
+				if time.Since(lastActivity) > inactivityTimeout {
+					errMsg := fmt.Sprintf("No activity from LLM for %s, operation stalled (last activity at %s)",
+						inactivityTimeout, lastActivity.Format(time.RFC3339))
+					logger.WarnCtx(ctx, errMsg)
 
 					// Send error to the error channel and exit
 					select {
-					case errCh <- fmt.Errorf(errMsg):
+					case errCh <- fmt.Errorf("%s", errMsg):
 					default:
 						// Channel already has an error
 					}
@@ -481,10 +557,14 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 	}
 
 	messages := []anthropic.MessageParam{
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(executePlanSystemPrompt)),
-		anthropic.NewUserMessage(anthropic.NewTextBlock(detailedPlanInstructions)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)),
+		anthropic.NewUserMessage(anthropic.NewTextBlock(instructions)),
 	}
 
+	// the snippets were recorded when the plan was detailed, each action isn't recorded again
+	conventionMessages, _ := userConventionsMessages(ctx, plan.WorkspaceID)
+	messages = append(messages, conventionMessages...)
+
 	// Add more explicit instructions about the file workflow
 	workflowInstructions := `
 		Important workflow instructions:
@@ -496,26 +576,32 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 	messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(plan.Description)))
 
 	if actionPlanWithPath.Action == "create" {
-		logger.Debug("create file", zap.String("path", actionPlanWithPath.Path))
+		logger.DebugCtx(ctx, "create file", zap.String("path", actionPlanWithPath.Path))
 		createMessage := fmt.Sprintf("Create the file at %s", actionPlanWithPath.Path)
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(workflowInstructions+createMessage)))
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(withReviewNote(workflowInstructions+createMessage, actionPlanWithPath.ReviewNote))))
 	} else if actionPlanWithPath.Action == "update" {
-		logger.Debug("update file", zap.String("path", actionPlanWithPath.Path))
+		logger.DebugCtx(ctx, "update file", zap.String("path", actionPlanWithPath.Path))
 		updateMessage := fmt.Sprintf(`The file at %s needs to be updated according to the plan.`,
 			actionPlanWithPath.Path)
 
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(workflowInstructions+updateMessage)))
+		instructions := workflowInstructions
+		if isValuesFile(actionPlanWithPath.Path) {
+			instructions += yamlPatchInstructions
+		}
+
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(withReviewNote(instructions+updateMessage, actionPlanWithPath.ReviewNote))))
 	}
 
 	tools := []anthropic.ToolParam{
 		{
-			Name: anthropic.F(TextEditor_Sonnet35),
+			Name:        anthropic.F(TextEditor_Sonnet35),
+			Description: anthropic.F(textEditorToolDescription),
 			InputSchema: anthropic.F(interface{}(map[string]interface{}{
 				"type": "object",
 				"properties": map[string]interface{}{
 					"command": map[string]interface{}{
 						"type": "string",
-						"enum": []string{"view", "str_replace", "create"},
+						"enum": []string{"view", "str_replace", "create", "yaml_patch"},
 					},
 					"path": map[string]interface{}{
 						"type": "string",
@@ -526,6 +612,23 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 					"new_str": map[string]interface{}{
 						"type": "string",
 					},
+					"operations": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"op": map[string]interface{}{
+									"type": "string",
+									"enum": []string{yamlpatch.OpSet, yamlpatch.OpDelete, yamlpatch.OpAppend},
+								},
+								"path": map[string]interface{}{
+									"type": "string",
+								},
+								"value": map[string]interface{}{},
+							},
+							"required": []string{"op", "path"},
+						},
+					},
 				},
 			})),
 		},
@@ -539,36 +642,44 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 	var disabled anthropic.ThinkingConfigEnabledType
 	disabled = "disabled"
 
+	offPathToolCalls := 0
 	for {
-		stream := client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
-			Model:     anthropic.F(Model_Sonnet35),
+		params := anthropic.MessageNewParams{
+			Model:     anthropic.F(ModelFor(OperationExecute)),
 			MaxTokens: anthropic.F(int64(8192)),
 			Messages:  anthropic.F(messages),
 			Tools:     anthropic.F(toolUnionParams),
 			Thinking: anthropic.F[anthropic.ThinkingConfigParamUnion](anthropic.ThinkingConfigEnabledParam{
 				Type: anthropic.F(disabled),
 			}),
-		})
+		}
+		if err := guardSecrets(ctx, params); err != nil {
+			return "", err
+		}
 
 		message := anthropic.Message{}
-		for stream.Next() {
-			event := stream.Current()
-			err := message.Accumulate(event)
-			if err != nil {
-				return "", err
-			}
+		err := executeBreaker.Do(func() error {
+			stream := client.Messages.NewStreaming(ctx, params)
+			for stream.Next() {
+				event := stream.Current()
+				err := message.Accumulate(event)
+				if err != nil {
+					return err
+				}
 
-			switch event := event.AsUnion().(type) {
-			case anthropic.ContentBlockDeltaEvent:
-				if event.Delta.Text != "" {
-					fmt.Printf("%s", event.Delta.Text)
+				switch event := event.AsUnion().(type) {
+				case anthropic.ContentBlockDeltaEvent:
+					if event.Delta.Text != "" {
+						fmt.Printf("%s", event.Delta.Text)
+					}
 				}
 			}
+			return stream.Err()
+		})
+		if err != nil {
+			return "", err
 		}
-
-		if stream.Err() != nil {
-			return "", stream.Err()
-		}
+		recordAnthropicUsage(ctx, OperationExecute, &message)
 
 		messages = append(messages, message.ToParam())
 
@@ -581,10 +692,11 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 				var response interface{}
 
 				var input struct {
-					Command string `json:"command"`
-					Path    string `json:"path"`
-					OldStr  string `json:"old_str"`
-					NewStr  string `json:"new_str"`
+					Command    string                `json:"command"`
+					Path       string                `json:"path"`
+					OldStr     string                `json:"old_str"`
+					NewStr     string                `json:"new_str"`
+					Operations []yamlpatch.Operation `json:"operations"`
 				}
 
 				if err := json.Unmarshal(block.Input, &input); err != nil {
@@ -594,13 +706,29 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 				// Update last activity timestamp on each tool use
 				lastActivity = time.Now()
 
-				logger.Info("LLM text_editor tool use",
+				logger.InfoCtx(ctx, "LLM text_editor tool use",
 					zap.String("command", input.Command),
 					zap.String("path", input.Path),
 					zap.Int("old_str_len", len(input.OldStr)),
-					zap.Int("new_str_len", len(input.NewStr)))
+					zap.Int("new_str_len", len(input.NewStr)),
+					zap.Int("operations", len(input.Operations)))
+
+				isError := false
+				if (input.Command == "create" || input.Command == "str_replace" || input.Command == "yaml_patch") && !isActionPath(input.Path, actionPlanWithPath.Path) {
+					offPathToolCalls++
+					logger.WarnCtx(ctx, "Rejected LLM tool call outside the action's file",
+						zap.String("command", input.Command),
+						zap.String("path", input.Path),
+						zap.String("actionPath", actionPlanWithPath.Path),
+						zap.Int("offPathToolCalls", offPathToolCalls))
+
+					if offPathToolCalls > maxOffPathToolCalls {
+						return "", fmt.Errorf("%w: %d tool calls tried to change files other than %s", ErrTooManyOffPathToolCalls, offPathToolCalls, actionPlanWithPath.Path)
+					}
 
-				if input.Command == "view" {
+					response = offPathToolResponse(actionPlanWithPath.Path)
+					isError = true
+				} else if input.Command == "view" {
 					if updatedContent == "" {
 						// File doesn't exist yet
 						response = "Error: File does not exist. Use create instead."
@@ -613,13 +741,14 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 
 					// Log every str_replace operation, successful or not
 					if err := logStrReplaceOperation(ctx, input.Path, input.OldStr, input.NewStr, updatedContent, found); err != nil {
-						logger.Warn("str_replace logging failed", zap.Error(err))
+						logger.WarnCtx(ctx, "str_replace logging failed", zap.Error(err))
 					}
 
 					// Perform the actual string replacement with our extracted function
-					logger.Debug("performing string replacement")
+					logger.DebugCtx(ctx, "performing string replacement")
 					newContent, success, replaceErr := PerformStringReplacement(updatedContent, input.OldStr, input.NewStr)
-					logger.Debug("string replacement complete", zap.String("success", fmt.Sprintf("%t", success)))
+					logger.DebugCtx(ctx, "string replacement complete", zap.String("success", fmt.Sprintf("%t", success)))
+					recordValuesEdit(input.Path, input.Command, success)
 
 					if !success {
 						// Create error message and update the log
@@ -628,18 +757,20 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 							errorMsg = replaceErr.Error()
 						}
 
+						// Work out why it failed so the model gets a hint it can act on
+						diagnosis := diagnoseStrReplaceFailure(updatedContent, input.OldStr)
+
 						// Update the error message in the database
-						logger.Debug("updating error message in str_replace log", zap.String("error_msg", errorMsg))
-						if err := UpdateStrReplaceLogErrorMessage(ctx, input.Path, input.OldStr, errorMsg); err != nil {
-							logger.Warn("Failed to update error message in str_replace log", zap.Error(err))
+						logger.DebugCtx(ctx, "updating error message in str_replace log", zap.String("error_msg", errorMsg), zap.String("failure_kind", string(diagnosis.Kind)))
+						if err := UpdateStrReplaceLogErrorMessage(ctx, input.Path, input.OldStr, errorMsg, diagnosis.Kind); err != nil {
+							logger.WarnCtx(ctx, "Failed to update error message in str_replace log", zap.Error(err))
 						}
 
-						response = "Error: String to replace not found in file. Please use smaller, more precise replacements."
+						response = diagnosis.ToolResponse()
 					} else {
 						updatedContent = newContent
 
-						// Send updated content through the channel
-						interimContentCh <- updatedContent
+						interimContent.Update(updatedContent)
 						response = "Content replaced successfully"
 					}
 				} else if input.Command == "create" {
@@ -648,9 +779,17 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 					} else {
 						updatedContent = input.NewStr
 
-						interimContentCh <- updatedContent
+						interimContent.Update(updatedContent)
 						response = "Created"
 					}
+				} else if input.Command == "yaml_patch" {
+					patched, result, failed := applyYAMLPatch(ctx, input.Path, updatedContent, input.Operations)
+					if !failed {
+						updatedContent = patched
+						interimContent.Update(updatedContent)
+					}
+					response = result
+					isError = failed
 				}
 
 				b, err := json.Marshal(response)
@@ -658,7 +797,7 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 					return "", err
 				}
 
-				toolResults = append(toolResults, anthropic.NewToolResultBlock(block.ID, string(b), false))
+				toolResults = append(toolResults, anthropic.NewToolResultBlock(block.ID, string(b), isError))
 			}
 		}
 
@@ -672,5 +811,9 @@ func ExecuteAction(ctx context.Context, actionPlanWithPath llmtypes.ActionPlanWi
 		})
 	}
 
+	if isValuesFile(actionPlanWithPath.Path) {
+		updatedContent = restoreValuesComments(ctx, actionPlanWithPath.Path, currentContent, updatedContent)
+	}
+
 	return updatedContent, nil
 }
@@ -2,13 +2,17 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
 	"github.com/replicatedhq/chartsmith/pkg/param"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExecuteAction(t *testing.T) {
@@ -1130,7 +1134,7 @@ unsupported:
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			patchStreamCh := make(chan string)
+			patchStreamCh := make(chan llmtypes.InterimContent)
 			got, err := ExecuteAction(ctx, tt.actionPlanWithPath, tt.plan, tt.currentContent, patchStreamCh)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ExecuteAction() error = %v, wantErr %v", err, tt.wantErr)
@@ -1140,3 +1144,106 @@ unsupported:
 		})
 	}
 }
+
+func TestWithReviewNote(t *testing.T) {
+	if got := withReviewNote("Create the file at templates/hpa.yaml", " "); got != "Create the file at templates/hpa.yaml" {
+		t.Errorf("a blank note changed the instructions: %q", got)
+	}
+
+	got := withReviewNote("Create the file at templates/hpa.yaml", "target 70% CPU")
+	want := "Create the file at templates/hpa.yaml\n\nThe reviewer left this note on the file, adjust the change to it:\ntarget 70% CPU"
+	if got != want {
+		t.Errorf("withReviewNote() = %q, want %q", got, want)
+	}
+}
+
+func TestIsActionPath(t *testing.T) {
+	tests := []struct {
+		toolPath   string
+		actionPath string
+		want       bool
+	}{
+		{toolPath: "values.yaml", actionPath: "values.yaml", want: true},
+		{toolPath: "/values.yaml", actionPath: "values.yaml", want: true},
+		{toolPath: "./values.yaml", actionPath: "values.yaml", want: true},
+		{toolPath: " templates/deployment.yaml", actionPath: "/templates/deployment.yaml", want: true},
+		{toolPath: "templates/../values.yaml", actionPath: "values.yaml", want: true},
+		{toolPath: "other/values.yaml", actionPath: "values.yaml", want: false},
+		{toolPath: "Chart.yaml", actionPath: "values.yaml", want: false},
+		{toolPath: "", actionPath: "values.yaml", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.toolPath+"->"+tt.actionPath, func(t *testing.T) {
+			assert.Equal(t, tt.want, isActionPath(tt.toolPath, tt.actionPath))
+		})
+	}
+}
+
+func TestExecuteActionRejectsOffPathToolCalls(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+
+	actionPlanWithPath := llmtypes.ActionPlanWithPath{
+		ActionPlan: llmtypes.ActionPlan{Action: "create"},
+		Path:       "templates/hpa.yaml",
+	}
+	plan := &workspacetypes.Plan{Description: "Add an HPA"}
+
+	t.Run("off path call is rejected and the action continues", func(t *testing.T) {
+		fake := newScriptedAnthropic(t,
+			[]fakeToolUse{{Command: "create", Path: "values.yaml", NewStr: "autoscaling: {}"}},
+			[]fakeToolUse{{Command: "create", Path: "templates/hpa.yaml", NewStr: "kind: HorizontalPodAutoscaler"}},
+		)
+
+		interimContentCh := make(chan llmtypes.InterimContent, 10)
+		content, err := ExecuteAction(context.Background(), actionPlanWithPath, plan, "", interimContentCh)
+		require.NoError(t, err)
+		assert.Equal(t, "kind: HorizontalPodAutoscaler", content)
+		assert.Equal(t, []llmtypes.InterimContent{{Version: 1, Content: "kind: HorizontalPodAutoscaler"}}, drain(interimContentCh))
+
+		require.Len(t, fake.requests, 3)
+		rejection := fake.requests[1]
+		assert.Contains(t, rejection, `"tool_use_id":"toolu_0_0"`)
+		assert.Contains(t, rejection, `"is_error":true`)
+		assert.Contains(t, rejection, "only templates/hpa.yaml may be modified by this action")
+		assert.Contains(t, fake.requests[2], `"tool_use_id":"toolu_1_0"`)
+		assert.Contains(t, fake.requests[2], `"is_error":false`)
+	})
+
+	t.Run("too many off path calls fail the action", func(t *testing.T) {
+		offPath := []fakeToolUse{}
+		for i := 0; i <= maxOffPathToolCalls; i++ {
+			offPath = append(offPath, fakeToolUse{Command: "str_replace", Path: "values.yaml", OldStr: "a", NewStr: "b"})
+		}
+		fake := newScriptedAnthropic(t, offPath[:3], offPath[3:], []fakeToolUse{{Command: "create", Path: "templates/hpa.yaml", NewStr: "never"}})
+
+		interimContentCh := make(chan llmtypes.InterimContent, 10)
+		_, err := ExecuteAction(context.Background(), actionPlanWithPath, plan, "", interimContentCh)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrTooManyOffPathToolCalls), err.Error())
+		assert.Contains(t, err.Error(), "6 tool calls tried to change files other than templates/hpa.yaml")
+		assert.Len(t, fake.requests, 2, "the action stops without another request")
+		assert.Empty(t, drain(interimContentCh))
+	})
+
+	t.Run("views of other files are allowed", func(t *testing.T) {
+		fake := newScriptedAnthropic(t, []fakeToolUse{{Command: "view", Path: "values.yaml"}})
+
+		_, err := ExecuteAction(context.Background(), actionPlanWithPath, plan, "", nil)
+		require.NoError(t, err)
+		require.Len(t, fake.requests, 2)
+		assert.False(t, strings.Contains(fake.requests[1], "may be modified by this action"))
+	})
+}
+
+func drain(ch chan llmtypes.InterimContent) []llmtypes.InterimContent {
+	values := []llmtypes.InterimContent{}
+	for {
+		select {
+		case v := <-ch:
+			values = append(values, v)
+		default:
+			return values
+		}
+	}
+}
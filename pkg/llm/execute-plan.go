@@ -7,11 +7,58 @@ import (
 	anthropic "github.com/anthropics/anthropic-sdk-go"
 	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"go.uber.org/zap"
 )
 
-func CreateExecutePlan(ctx context.Context, planActionCreatedCh chan types.ActionPlanWithPath, streamCh chan string, doneCh chan error, w *workspacetypes.Workspace, plan *workspacetypes.Plan, c *workspacetypes.Chart, relevantFiles []workspacetypes.File) error {
+// maxExecutePlanFiles is how many of the files most relevant to a plan are given to the LLM when it
+// details the plan's actions
+const maxExecutePlanFiles = 10
+
+// ChooseExecutePlanFiles returns the files of the first chart of a workspace that are most relevant
+// to a plan's description, at most maxExecutePlanFiles with a similarity of at least 0.8
+func ChooseExecutePlanFiles(ctx context.Context, w *workspacetypes.Workspace, description string) ([]workspacetypes.File, error) {
+	expandedPrompt, err := ExpandPrompt(ctx, description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand prompt: %w", err)
+	}
+
+	var chartID *string
+	if len(w.Charts) > 0 {
+		chartID = &w.Charts[0].ID
+	}
+
+	relevantFiles, err := workspace.ChooseRelevantFilesForChatMessage(
+		ctx,
+		w,
+		workspace.WorkspaceFilter{
+			ChartID: chartID,
+		},
+		w.CurrentRevision,
+		expandedPrompt,
+	)
+	if err != nil {
+		// the plan can still be detailed from its description, without the content of any file
+		logger.WarnCtx(ctx, "Failed to choose relevant files for plan", zap.Error(err))
+	}
+
+	if len(relevantFiles) > maxExecutePlanFiles {
+		relevantFiles = relevantFiles[:maxExecutePlanFiles]
+	}
+	files := []workspacetypes.File{}
+	for _, file := range relevantFiles {
+		if file.Similarity >= 0.8 {
+			files = append(files, file.File)
+		}
+	}
+	return files, nil
+}
+
+// CreateExecutePlan details the actions of a plan. Each action is sent to planActionCreatedCh as
+// it streams, scoped to its chart, and each malformed action to skippedActionCh instead. When ctx
+// is done before the caller receives what's sent, the stream stops and ctx's error is returned.
+func CreateExecutePlan(ctx context.Context, planActionCreatedCh chan types.ActionPlanWithPath, skippedActionCh chan types.SkippedActionPlan, streamCh chan string, doneCh chan error, w *workspacetypes.Workspace, plan *workspacetypes.Plan, c *workspacetypes.Chart, relevantFiles []workspacetypes.File) error {
 	logger.Debug("Creating execution plan",
 		zap.String("workspace_id", w.ID),
 		zap.String("chart_id", c.ID),
@@ -24,39 +71,66 @@ func CreateExecutePlan(ctx context.Context, planActionCreatedCh chan types.Actio
 		return err
 	}
 
+	ctx, systemPrompt := withPrompt(ctx, promptDetailedPlanSystem)
+	ctx, instructions := withPrompt(ctx, promptDetailedPlanInstructions)
 	messages := []anthropic.MessageParam{
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(detailedPlanSystemPrompt)),
-		anthropic.NewUserMessage(anthropic.NewTextBlock(detailedPlanInstructions)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)),
+		anthropic.NewUserMessage(anthropic.NewTextBlock(instructions)),
 	}
 
+	conventionMessages, conventions := userConventionsMessages(ctx, w.ID)
+	recordUserConventions(ctx, w.ID, "execute-plan", conventions)
+	messages = append(messages, conventionMessages...)
+
 	if w.CurrentRevision == 0 {
-		bootsrapChartUserMessage, err := summarizeBootstrapChart(ctx)
+		bootsrapChartUserMessage, err := summarizeBootstrapChart(ctx, w.BootstrapTemplate, plan.Description)
 		if err != nil {
 			return fmt.Errorf("failed to summarize bootstrap chart: %w", err)
 		}
 		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(bootsrapChartUserMessage)))
 	} else {
-		chartStructure, err := getChartStructure(ctx, c)
+		chartStructure, err := getPlanStructure(ctx, w, c)
 		if err != nil {
 			return fmt.Errorf("failed to get chart structure: %w", err)
 		}
 		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`I am working on a Helm chart that has the following structure: %s`, chartStructure))))
 
-		for _, file := range relevantFiles {
-			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`File: %s, Content: %s`, file.FilePath, file.Content))))
+		for _, file := range budgetPlanFiles(relevantFiles, plan.Description, planFilesTokenBudget) {
+			if file.Note != "" {
+				logger.InfoCtx(ctx, "Cut down a file to fit the plan prompt", zap.String("path", file.FilePath), zap.String("note", file.Note))
+			}
+			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(formatPlanFile(planFilePath(w, file.File), file))))
 		}
+
+		if helpers := getDefinedHelpers(c.Files); len(helpers) > 0 {
+			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(formatDefinedHelpers(helpers))))
+		}
+	}
+
+	// the plan was made with the conversation, its summary is context for the details the plan
+	// description leaves out
+	memory, err := getConversationMemory(ctx, w.ID)
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to get conversation memory", zap.Error(err))
+	} else if memory.Summary != "" {
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(conversationSummaryPrefix+memory.Summary)))
 	}
 
 	messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(plan.Description)))
 
-	stream := client.Messages.NewStreaming(context.TODO(), anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationPlan)),
 		MaxTokens: anthropic.F(int64(8192)),
 		Messages:  anthropic.F(messages),
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return err
+	}
 
-	fullResponseWithTags := ""
-	actionPlans := make(map[string]types.ActionPlan)
+	stream := client.Messages.NewStreaming(ctx, params)
+
+	parser := newPlanStreamParser()
+	validator := newActionPlanValidator(w, c)
 
 	message := anthropic.Message{}
 	for stream.Next() {
@@ -66,40 +140,54 @@ func CreateExecutePlan(ctx context.Context, planActionCreatedCh chan types.Actio
 		switch delta := event.Delta.(type) {
 		case anthropic.ContentBlockDeltaEventDelta:
 			if delta.Text != "" {
-				fullResponseWithTags += delta.Text
-
-				aps, err := parseActionsInResponse(fullResponseWithTags)
-				if err != nil {
-					return fmt.Errorf("error parsing artifacts in response: %w", err)
-				}
-
-				for path, action := range aps {
-					// only add if the full struct is there
-					if path != "" && action.Type != "" && action.Action != "" {
-						// if the item is not already in the map, we need to stream it back to the caller
-						if _, ok := actionPlans[path]; !ok {
-							action.Status = types.ActionPlanStatusPending
-							actionPlanWithPath := types.ActionPlanWithPath{
-								Path:       path,
-								ActionPlan: action,
-							}
-							planActionCreatedCh <- actionPlanWithPath
+				// each action is streamed back to the caller once, when its opening tag is complete
+				for _, action := range parser.Write(delta.Text) {
+					action.Status = types.ActionPlanStatusPending
+					queued, skipped := validator.validate(ctx, action)
+					if skipped != nil {
+						if err := sendContext(ctx, skippedActionCh, *skipped); err != nil {
+							return err
+						}
+					}
+					if queued != nil {
+						if err := sendContext(ctx, planActionCreatedCh, *queued); err != nil {
+							return err
 						}
-
-						actionPlans[path] = action
 					}
 				}
 			}
 		}
 	}
 
-	if stream.Err() != nil {
-		doneCh <- stream.Err()
+	if err := stream.Err(); err != nil {
+		return sendContext(ctx, doneCh, err)
 	}
+	recordAnthropicUsage(ctx, OperationPlan, &message)
 
-	doneCh <- nil
+	if err := sendContext(ctx, doneCh, nil); err != nil {
+		return err
+	}
 
 	// The plan will be set to "applied" status when all actions are complete
 
 	return nil
 }
+
+// scopeActionPlan resolves the chart a planned path belongs to. Paths that can't be resolved
+// (usually a new file without a chart name prefix) fall back to the chart being planned.
+func scopeActionPlan(w *workspacetypes.Workspace, c *workspacetypes.Chart, path string, action types.ActionPlan) types.ActionPlanWithPath {
+	chart, chartPath, err := workspace.ResolveChartPath(w, path)
+	if err != nil {
+		logger.Warn("failed to resolve chart for planned path, using the planned chart",
+			zap.String("path", path),
+			zap.String("chart_id", c.ID),
+			zap.Error(err))
+		chart, chartPath = c, path
+	}
+
+	return types.ActionPlanWithPath{
+		Path:       chartPath,
+		ChartID:    chart.ID,
+		ActionPlan: action,
+	}
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func twoChartPlanWorkspace() *workspacetypes.Workspace {
+	return &workspacetypes.Workspace{
+		ID: "workspace",
+		Charts: []workspacetypes.Chart{
+			{
+				ID:   "chart-frontend",
+				Name: "frontend",
+				Files: []workspacetypes.File{
+					{ChartID: "chart-frontend", FilePath: "templates/deployment.yaml", Content: "frontend"},
+				},
+			},
+			{
+				ID:   "chart-backend",
+				Name: "backend",
+				Files: []workspacetypes.File{
+					{ChartID: "chart-backend", FilePath: "templates/deployment.yaml", Content: "backend"},
+				},
+			},
+		},
+	}
+}
+
+// stubNoConversationMemory makes the conversation memory of every workspace fail to be read, a
+// plan is detailed without it
+func stubNoConversationMemory(t *testing.T) {
+	original := getConversationMemory
+	t.Cleanup(func() { getConversationMemory = original })
+	getConversationMemory = func(ctx context.Context, workspaceID string) (*workspacetypes.ConversationMemory, error) {
+		return nil, errors.New("database unavailable")
+	}
+}
+
+func TestGetPlanStructureMultiChart(t *testing.T) {
+	w := twoChartPlanWorkspace()
+
+	structure, err := getPlanStructure(context.Background(), w, &w.Charts[0])
+	require.NoError(t, err)
+	assert.Contains(t, structure, "Chart: frontend")
+	assert.Contains(t, structure, "File: frontend/templates/deployment.yaml")
+	assert.Contains(t, structure, "Chart: backend")
+	assert.Contains(t, structure, "File: backend/templates/deployment.yaml")
+
+	// a single chart keeps the existing unprefixed structure
+	single := &workspacetypes.Workspace{Charts: w.Charts[:1]}
+	structure, err = getPlanStructure(context.Background(), single, &single.Charts[0])
+	require.NoError(t, err)
+	assert.Equal(t, "File: templates/deployment.yaml", structure)
+}
+
+func TestScopeActionPlanNoCrossWrites(t *testing.T) {
+	w := twoChartPlanWorkspace()
+
+	response := `<chartsmithArtifactPlan title="Scale both deployments">
+<chartsmithActionPlan type="file" action="update" path="frontend/templates/deployment.yaml"></chartsmithActionPlan>
+<chartsmithActionPlan type="file" action="update" path="backend/templates/deployment.yaml"></chartsmithActionPlan>
+</chartsmithArtifactPlan>`
+
+	actions, err := parseActionsInResponse(response)
+	require.NoError(t, err)
+	require.Len(t, actions, 2)
+
+	paths := []string{}
+	for path := range actions {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// execute each action against an in memory copy of the workspace files
+	files := map[string]map[string]string{}
+	for _, c := range w.Charts {
+		files[c.ID] = map[string]string{}
+		for _, f := range c.Files {
+			files[c.ID][f.FilePath] = f.Content
+		}
+	}
+
+	for _, path := range paths {
+		apwp := scopeActionPlan(w, &w.Charts[0], path, actions[path])
+		assert.Equal(t, "templates/deployment.yaml", apwp.Path)
+		files[apwp.ChartID][apwp.Path] += " updated by " + path
+	}
+
+	assert.Equal(t, "frontend updated by frontend/templates/deployment.yaml", files["chart-frontend"]["templates/deployment.yaml"])
+	assert.Equal(t, "backend updated by backend/templates/deployment.yaml", files["chart-backend"]["templates/deployment.yaml"])
+}
+
+func TestScopeActionPlanFallsBackToPlannedChart(t *testing.T) {
+	w := twoChartPlanWorkspace()
+
+	apwp := scopeActionPlan(w, &w.Charts[1], "templates/service.yaml", llmtypes.ActionPlan{Type: "file", Action: "create"})
+	assert.Equal(t, "chart-backend", apwp.ChartID)
+	assert.Equal(t, "templates/service.yaml", apwp.Path)
+}
@@ -29,8 +29,10 @@ Here is the prompt:
 %s
 	`, prompt)
 
-	resp, err := client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	resp, err := client.Messages.New(requestCtx, anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationPlan)),
 		MaxTokens: anthropic.F(int64(8192)),
 		Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage))}),
 	})
@@ -42,6 +44,7 @@ Here is the prompt:
 	if resp == nil {
 		return "", fmt.Errorf("received nil response from Anthropic API")
 	}
+	recordAnthropicUsage(ctx, OperationPlan, resp)
 
 	if len(resp.Content) == 0 {
 		return "", fmt.Errorf("received empty content from Anthropic API")
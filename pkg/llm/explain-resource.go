@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// these are vars so that explanations can be tested without a database
+var (
+	getRenderedResource     = workspace.GetRenderedResource
+	getCachedExplanation    = workspace.GetRenderedExplanation
+	setCachedExplanation    = workspace.SetRenderedExplanation
+	explainRenderedResource = explainRenderedResourceWithClaude
+)
+
+// ResourceExplanation is a markdown explanation of a rendered file for an operator
+type ResourceExplanation struct {
+	Explanation string `json:"explanation"`
+	// Cached is true when the explanation was written for an earlier request
+	Cached bool `json:"cached"`
+}
+
+// ExplainRenderedResource explains what a rendered file of a render deploys, which values control
+// it and how it's commonly tweaked, for an operator installing the chart. Explanations are cached
+// per render and path, a render's output doesn't change. A cache that can't be read or written is
+// logged and the file is explained without it.
+func ExplainRenderedResource(ctx context.Context, workspaceID string, renderID string, filePath string) (*ResourceExplanation, error) {
+	ctx = WithUsageAttribution(ctx, UsageAttribution{WorkspaceID: workspaceID})
+
+	explanation, ok, err := getCachedExplanation(ctx, workspaceID, renderID, filePath)
+	if err != nil {
+		logger.WarnCtx(ctx, "Failed to read cached explanation", zap.String("renderID", renderID), zap.String("path", filePath), zap.Error(err))
+	} else if ok {
+		return &ResourceExplanation{Explanation: explanation, Cached: true}, nil
+	}
+
+	resource, err := getRenderedResource(ctx, workspaceID, renderID, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rendered resource: %w", err)
+	}
+
+	explanation, err = explainRenderedResource(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setCachedExplanation(ctx, workspaceID, renderID, filePath, ModelFor(OperationChat), explanation); err != nil {
+		logger.WarnCtx(ctx, "Failed to cache explanation", zap.String("renderID", renderID), zap.String("path", filePath), zap.Error(err))
+	}
+
+	return &ResourceExplanation{Explanation: explanation}, nil
+}
+
+// explainResourceMessage is the prompt asking for an explanation of a rendered file, with its
+// template and the values the template references
+func explainResourceMessage(resource *workspace.RenderedResource) (string, error) {
+	values := "The template doesn't reference any values."
+	if len(resource.Values) > 0 {
+		b, err := yaml.Marshal(resource.Values)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal values: %w", err)
+		}
+		values = "Each key is the dotted path of a key in values.yaml:\n" + string(b)
+	}
+
+	return fmt.Sprintf(`An operator installing this Helm chart is looking at the manifest rendered from %s and wants to understand it.
+
+Template:
+%s
+
+Rendered manifest:
+%s
+
+Values the template references, with their defaults from values.yaml:
+%s
+
+Explain in markdown, with a heading for each part:
+- What the resource does once it's installed in a cluster.
+- Which values control it, and what each of them changes in the rendered manifest.
+- Common tweaks an operator makes to it, as the values to set with helm install --set or a values file.
+
+Only suggest changes to values, never to the template.`, resource.FilePath, resource.Template, resource.Rendered, values), nil
+}
+
+func explainRenderedResourceWithClaude(ctx context.Context, resource *workspace.RenderedResource) (string, error) {
+	client, err := newAnthropicClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to create anthropic client: %w", err)
+	}
+
+	userMessage, err := explainResourceMessage(resource)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, systemPrompt := withPrompt(ctx, promptEndUserSystem)
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationChat)),
+		MaxTokens: anthropic.F(int64(4096)),
+		System:    anthropic.F([]anthropic.TextBlockParam{anthropic.NewTextBlock(systemPrompt)}),
+		Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage))}),
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return "", err
+	}
+
+	startTime := time.Now()
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	resp, err := client.Messages.New(requestCtx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to explain resource: %w", err)
+	}
+	recordAnthropicUsage(ctx, OperationChat, resp)
+
+	logger.DebugCtx(ctx, "Explained rendered resource", zap.String("renderID", resource.RenderID), zap.String("path", resource.FilePath), zap.Duration("duration", time.Since(startTime)))
+
+	if len(resp.Content) == 0 || resp.Content[0].Text == "" {
+		return "", fmt.Errorf("empty explanation response")
+	}
+	return resp.Content[0].Text, nil
+}
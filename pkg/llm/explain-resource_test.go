@@ -0,0 +1,122 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var explainedResource = workspace.RenderedResource{
+	RenderID: "render",
+	FilePath: "templates/deployment.yaml",
+	Template: "kind: Deployment\nspec:\n  replicas: {{ .Values.replicaCount }}\n",
+	Rendered: "kind: Deployment\nspec:\n  replicas: 3\n",
+	Values:   map[string]interface{}{"replicaCount": 3},
+}
+
+// stubExplanations replaces the rendered resource and the explanation cache, getErr fails every
+// cache lookup. It returns the cache, keyed by render and path.
+func stubExplanations(t *testing.T, getErr error) map[string]string {
+	t.Helper()
+	cache := map[string]string{}
+	originalResource, originalGet, originalSet, originalSecrets := getRenderedResource, getCachedExplanation, setCachedExplanation, checkSecretsForLLM
+	t.Cleanup(func() {
+		getRenderedResource, getCachedExplanation, setCachedExplanation, checkSecretsForLLM = originalResource, originalGet, originalSet, originalSecrets
+	})
+
+	getRenderedResource = func(ctx context.Context, workspaceID string, renderID string, filePath string) (*workspace.RenderedResource, error) {
+		if filePath != explainedResource.FilePath {
+			return nil, workspace.ErrRenderedFileNotFound
+		}
+		resource := explainedResource
+		return &resource, nil
+	}
+	getCachedExplanation = func(ctx context.Context, workspaceID string, renderID string, filePath string) (string, bool, error) {
+		if getErr != nil {
+			return "", false, getErr
+		}
+		explanation, ok := cache[renderID+"/"+filePath]
+		return explanation, ok, nil
+	}
+	setCachedExplanation = func(ctx context.Context, workspaceID string, renderID string, filePath string, model string, explanation string) error {
+		cache[renderID+"/"+filePath] = explanation
+		return nil
+	}
+	checkSecretsForLLM = func(ctx context.Context, workspaceID string, texts []string) error { return nil }
+	return cache
+}
+
+func TestExplainRenderedResource(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+	fake := newFakeAnthropic(t)
+	fake.text = "## What it does\nRuns the app."
+	cache := stubExplanations(t, nil)
+
+	explanation, err := ExplainRenderedResource(context.Background(), "ws", "render", "templates/deployment.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, &ResourceExplanation{Explanation: "## What it does\nRuns the app."}, explanation)
+	assert.Equal(t, map[string]string{"render/templates/deployment.yaml": "## What it does\nRuns the app."}, cache)
+
+	require.Len(t, fake.requests, 1)
+	var request struct {
+		Model  string `json:"model"`
+		System []struct {
+			Text string `json:"text"`
+		} `json:"system"`
+		Messages []struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(fake.requests[0]), &request))
+	assert.Equal(t, ModelFor(OperationChat), request.Model)
+	require.Len(t, request.System, 1)
+	assert.Equal(t, endUserSystemPrompt, request.System[0].Text, "explanations are written by the operator persona")
+	require.Len(t, request.Messages, 1)
+	prompt := request.Messages[0].Content[0].Text
+	assert.Contains(t, prompt, explainedResource.Template)
+	assert.Contains(t, prompt, explainedResource.Rendered)
+	assert.Contains(t, prompt, "replicaCount: 3")
+
+	// the second request is answered from the cache
+	explanation, err = ExplainRenderedResource(context.Background(), "ws", "render", "templates/deployment.yaml")
+	require.NoError(t, err)
+	assert.True(t, explanation.Cached)
+	assert.Len(t, fake.requests, 1)
+	require.Len(t, fake.usage, 1)
+	assert.Equal(t, "ws", fake.usage[0].WorkspaceID)
+}
+
+func TestExplainRenderedResourceErrors(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+	fake := newFakeAnthropic(t)
+	cache := stubExplanations(t, errors.New("connection refused"))
+
+	_, err := ExplainRenderedResource(context.Background(), "ws", "render", "templates/missing.yaml")
+	assert.ErrorIs(t, err, workspace.ErrRenderedFileNotFound)
+	assert.Empty(t, fake.requests)
+
+	// a cache that can't be read doesn't fail the explanation
+	explanation, err := ExplainRenderedResource(context.Background(), "ws", "render", "templates/deployment.yaml")
+	require.NoError(t, err)
+	assert.False(t, explanation.Cached)
+	assert.Len(t, cache, 1)
+}
+
+func TestExplainResourceMessageWithoutValues(t *testing.T) {
+	resource := explainedResource
+	resource.Values = map[string]interface{}{}
+	message, err := explainResourceMessage(&resource)
+	require.NoError(t, err)
+	assert.Contains(t, message, "The template doesn't reference any values.")
+	assert.Contains(t, message, "templates/deployment.yaml")
+}
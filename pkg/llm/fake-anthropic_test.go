@@ -0,0 +1,180 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/replicatedhq/chartsmith/pkg/yamlpatch"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAnthropic answers every message request with a fixed text and fixed usage, streaming or not,
+// and captures the model and raw body of each request and the usage recorded for it
+type fakeAnthropic struct {
+	text         string
+	inputTokens  int64
+	outputTokens int64
+
+	mu       sync.Mutex
+	models   []string
+	requests []string
+	usage    []workspacetypes.LLMUsage
+}
+
+func newFakeAnthropic(t *testing.T) *fakeAnthropic {
+	fake := &fakeAnthropic{text: "expanded", inputTokens: 120, outputTokens: 30}
+
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP(t)))
+	t.Cleanup(server.Close)
+
+	previousOptions := anthropicClientOptions
+	anthropicClientOptions = []option.RequestOption{option.WithBaseURL(server.URL), option.WithMaxRetries(0)}
+	previousRecordUsage := recordUsage
+	recordUsage = func(ctx context.Context, usage workspacetypes.LLMUsage) error {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		fake.usage = append(fake.usage, usage)
+		return nil
+	}
+	t.Cleanup(func() {
+		anthropicClientOptions = previousOptions
+		recordUsage = previousRecordUsage
+	})
+
+	return fake
+}
+
+func (f *fakeAnthropic) serveHTTP(t *testing.T) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		require.NoError(t, json.Unmarshal(raw, &body))
+		f.mu.Lock()
+		f.models = append(f.models, body.Model)
+		f.requests = append(f.requests, string(raw))
+		f.mu.Unlock()
+
+		text, _ := json.Marshal(f.text)
+
+		if !body.Stream {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"id":"msg_1","type":"message","role":"assistant","model":%q,"content":[{"type":"text","text":%s}],"stop_reason":"end_turn","usage":{"input_tokens":%d,"output_tokens":%d}}`,
+				body.Model, text, f.inputTokens, f.outputTokens)
+			return
+		}
+
+		// the output tokens in message_start are a placeholder, the final count is in message_delta
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			fmt.Sprintf(`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":%q,"content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":%d,"output_tokens":1}}}`, body.Model, f.inputTokens),
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			fmt.Sprintf(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":%s}}`, text),
+			`{"type":"content_block_stop","index":0}`,
+			fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":%d}}`, f.outputTokens),
+			`{"type":"message_stop"}`,
+		}
+		for _, event := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(event), &typed))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}
+}
+
+// fakeToolUse is a text_editor tool call made by a scripted fake
+type fakeToolUse struct {
+	Command string `json:"command"`
+	Path    string `json:"path"`
+	OldStr  string `json:"old_str,omitempty"`
+	NewStr  string `json:"new_str,omitempty"`
+
+	Operations []yamlpatch.Operation `json:"operations,omitempty"`
+}
+
+// scriptedAnthropic streams the tool calls of each turn in order, then ends the conversation. It
+// captures the raw body of every request.
+type scriptedAnthropic struct {
+	turns [][]fakeToolUse
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newScriptedAnthropic(t *testing.T, turns ...[]fakeToolUse) *scriptedAnthropic {
+	fake := &scriptedAnthropic{turns: turns}
+
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP(t)))
+	t.Cleanup(server.Close)
+
+	previousOptions := anthropicClientOptions
+	anthropicClientOptions = []option.RequestOption{option.WithBaseURL(server.URL), option.WithMaxRetries(0)}
+	previousRecordUsage := recordUsage
+	recordUsage = func(ctx context.Context, usage workspacetypes.LLMUsage) error { return nil }
+	t.Cleanup(func() {
+		anthropicClientOptions = previousOptions
+		recordUsage = previousRecordUsage
+	})
+
+	return fake
+}
+
+func (f *scriptedAnthropic) serveHTTP(t *testing.T) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		f.mu.Lock()
+		turn := len(f.requests)
+		f.requests = append(f.requests, string(body))
+		f.mu.Unlock()
+
+		events := []string{
+			`{"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","model":"fake","content":[],"stop_reason":null,"stop_sequence":null,"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		}
+		stopReason := "end_turn"
+		if turn < len(f.turns) {
+			stopReason = "tool_use"
+			for i, toolUse := range f.turns[turn] {
+				input, err := json.Marshal(toolUse)
+				require.NoError(t, err)
+				events = append(events,
+					fmt.Sprintf(`{"type":"content_block_start","index":%d,"content_block":{"type":"tool_use","id":"toolu_%d_%d","name":"text_editor_20241022","input":%s}}`, i, turn, i, input),
+					fmt.Sprintf(`{"type":"content_block_stop","index":%d}`, i),
+				)
+			}
+		} else {
+			events = append(events,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"done"}}`,
+				`{"type":"content_block_stop","index":0}`,
+			)
+		}
+		events = append(events,
+			fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":%q,"stop_sequence":null},"usage":{"output_tokens":5}}`, stopReason),
+			`{"type":"message_stop"}`,
+		)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			var typed struct {
+				Type string `json:"type"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(event), &typed))
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typed.Type, event)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jpoz/groq"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"go.uber.org/zap"
+)
+
+// groqBaseURL is where completions are requested, tests use this to point them at a fake server
+var groqBaseURL = "https://api.groq.com"
+
+// createGroqChatCompletion makes the request groq.Client.CreateChatCompletion makes, with ctx. The
+// client doesn't take a context, so a provider that never answers would hold the worker until the
+// request is reaped. A completion that isn't streamed is also bounded by the LLM request timeout.
+// A streamed completion's channel is closed when the response ends or ctx is done.
+func createGroqChatCompletion(ctx context.Context, params groq.CompletionCreateParams) (*groq.ChatCompletion, error) {
+	if !params.Stream {
+		var cancel context.CancelFunc
+		ctx, cancel = withLLMRequestTimeout(ctx)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal completion params: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, groqBaseURL+"/openai/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create completion request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+param.Get().GroqAPIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var errResp groq.ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err != nil {
+			return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
+		}
+		return nil, errResp.Error
+	}
+
+	if !params.Stream {
+		defer resp.Body.Close()
+		var result groq.ChatCompletion
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("failed to decode completion: %w", err)
+		}
+		return &result, nil
+	}
+
+	result := groq.ChatCompletion{Stream: make(chan *groq.ChatChunkCompletion, 100)}
+	go readGroqStream(ctx, resp.Body, result.Stream)
+	return &result, nil
+}
+
+// readGroqStream sends each chunk of a streamed completion until the response ends or ctx is
+// done, then closes the channel and the response
+func readGroqStream(ctx context.Context, body io.ReadCloser, stream chan *groq.ChatChunkCompletion) {
+	defer close(stream)
+	defer body.Close()
+
+	reader := groq.NewStreamReader(body)
+	for {
+		event, err := reader.Next()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				logger.WarnCtx(ctx, "Failed to read groq stream", zap.Error(err))
+			}
+			return
+		}
+		if bytes.HasPrefix(event.Data, []byte("[DONE]")) {
+			return
+		}
+
+		var chunk groq.ChatChunkCompletion
+		if err := json.Unmarshal(event.Data, &chunk); err != nil {
+			logger.WarnCtx(ctx, "Failed to parse groq stream chunk", zap.Error(err))
+			continue
+		}
+		if err := sendContext(ctx, stream, &chunk); err != nil {
+			return
+		}
+	}
+}
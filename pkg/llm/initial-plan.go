@@ -13,9 +13,11 @@ import (
 )
 
 type CreateInitialPlanOpts struct {
-	ChatMessages    []workspacetypes.Chat
-	PreviousPlans   []workspacetypes.Plan
-	AdditionalFiles []workspacetypes.File
+	ChatMessages        []workspacetypes.Chat
+	ConversationSummary string // summary of the chat messages before ChatMessages, see CondenseConversation
+	PreviousPlans       []workspacetypes.Plan
+	AdditionalFiles     []workspacetypes.File
+	BootstrapTemplate   string // scaffold template to base the plan on, empty for the default
 }
 
 func CreateInitialPlan(ctx context.Context, streamCh chan string, doneCh chan error, opts CreateInitialPlanOpts) error {
@@ -30,38 +32,40 @@ func CreateInitialPlan(ctx context.Context, streamCh chan string, doneCh chan er
 		return fmt.Errorf("failed to create anthropic client: %w", err)
 	}
 
+	ctx, systemPrompt := withPrompt(ctx, promptInitialPlanSystem)
+	ctx, instructions := withPrompt(ctx, promptInitialPlanInstructions)
 	messages := []anthropic.MessageParam{
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(initialPlanSystemPrompt)),
-		anthropic.NewAssistantMessage(anthropic.NewTextBlock(initialPlanInstructions)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock(instructions)),
 	}
+	messages = append(messages, integrationPlanMessages(ctx, nil)...)
 
 	// summarize the bootstrap chart and include it as a user message
-	bootsrapChartUserMessage, err := summarizeBootstrapChart(ctx)
+	bootsrapChartUserMessage, err := summarizeBootstrapChart(ctx, opts.BootstrapTemplate, latestPrompt(opts.ChatMessages))
 	if err != nil {
 		return fmt.Errorf("failed to summarize bootstrap chart: %w", err)
 	}
 	messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(bootsrapChartUserMessage)))
 
-	for _, chatMessage := range opts.ChatMessages {
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(chatMessage.Prompt)))
-		if chatMessage.Response != "" {
-			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(chatMessage.Response)))
-		}
-	}
+	conversation := Conversation{Summary: opts.ConversationSummary, Messages: opts.ChatMessages}
+	messages = append(messages, conversation.MessageParams()...)
 
-	for _, additionalFile := range opts.AdditionalFiles {
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(additionalFile.Content)))
-	}
+	messages = append(messages, additionalFilesMessages(opts.AdditionalFiles)...)
 
 	initialUserMessage := "Describe the plan only (do not write code) to create a helm chart based on the previous discussion. "
 
 	messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(initialUserMessage)))
 
-	stream := client.Messages.NewStreaming(context.TODO(), anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationPlan)),
 		MaxTokens: anthropic.F(int64(8192)),
 		Messages:  anthropic.F(messages),
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return err
+	}
+
+	stream := client.Messages.NewStreaming(ctx, params)
 
 	message := anthropic.Message{}
 	for stream.Next() {
@@ -71,30 +75,44 @@ func CreateInitialPlan(ctx context.Context, streamCh chan string, doneCh chan er
 		switch delta := event.Delta.(type) {
 		case anthropic.ContentBlockDeltaEventDelta:
 			if delta.Text != "" {
-				streamCh <- delta.Text
+				if err := sendContext(ctx, streamCh, delta.Text); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
-	if stream.Err() != nil {
-		doneCh <- stream.Err()
+	if err := stream.Err(); err != nil {
+		return sendContext(ctx, doneCh, err)
 	}
+	recordAnthropicUsage(ctx, OperationPlan, &message)
 
-	doneCh <- nil
+	if err := sendContext(ctx, doneCh, nil); err != nil {
+		return err
+	}
 	return nil
 }
 
-func summarizeBootstrapChart(ctx context.Context) (string, error) {
-	bootstrapWorkspace, err := workspace.GetBootstrapWorkspace(ctx)
+// summarizeBootstrapChart describes the scaffold template the chart is based on, an empty
+// template name uses the default scaffold. The files share the plan files budget, see
+// budgetPlanFiles.
+func summarizeBootstrapChart(ctx context.Context, templateName string, prompt string) (string, error) {
+	bootstrapWorkspace, err := workspace.GetBootstrapWorkspaceByName(ctx, templateName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get bootstrap workspace: %w", err)
 	}
 
-	filesWithContent := map[string]string{}
+	files := []workspacetypes.File{}
 	for _, chart := range bootstrapWorkspace.Charts {
-		for _, file := range chart.Files {
-			filesWithContent[file.FilePath] = file.Content
+		files = append(files, chart.Files...)
+	}
+
+	filesWithContent := map[string]string{}
+	for _, file := range budgetPlanFiles(files, prompt, planFilesTokenBudget) {
+		if file.Note != "" {
+			file.Content = fmt.Sprintf("(%s)\n%s", file.Note, file.Content)
 		}
+		filesWithContent[file.FilePath] = file.Content
 	}
 
 	encoded, err := json.Marshal(filesWithContent)
@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// prompts shorter than this are checked against the deterministic intent table
+	maxDeterministicPromptLen = 40
+
+	// intentCacheTTL is how long an llm classification is reused for the same prompt
+	intentCacheTTL = 24 * time.Hour
+
+	// IntentCachePruneInterval is how often classifications older than the TTL are pruned
+	IntentCachePruneInterval = time.Hour
+)
+
+var (
+	proceedIntent = workspacetypes.Intent{
+		IsProceed:        true,
+		IsChartDeveloper: true,
+	}
+	renderIntent = workspacetypes.Intent{
+		IsRender:         true,
+		IsChartDeveloper: true,
+	}
+
+	// deterministicIntents are the short follow-ups we see constantly and
+	// don't need a model to classify
+	deterministicIntents = map[string]workspacetypes.Intent{
+		"proceed":            proceedIntent,
+		"go ahead":           proceedIntent,
+		"go":                 proceedIntent,
+		"yes":                proceedIntent,
+		"yes please":         proceedIntent,
+		"yep":                proceedIntent,
+		"ok":                 proceedIntent,
+		"okay":               proceedIntent,
+		"looks good":         proceedIntent,
+		"looks good to me":   proceedIntent,
+		"lgtm":               proceedIntent,
+		"sounds good":        proceedIntent,
+		"do it":              proceedIntent,
+		"continue":           proceedIntent,
+		"approve":            proceedIntent,
+		"approved":           proceedIntent,
+		"apply":              proceedIntent,
+		"apply it":           proceedIntent,
+		"ship it":            proceedIntent,
+		"render":             renderIntent,
+		"render it":          renderIntent,
+		"render the chart":   renderIntent,
+		"render chart":       renderIntent,
+		"test it":            renderIntent,
+		"test the chart":     renderIntent,
+		"validate":           renderIntent,
+		"validate the chart": renderIntent,
+		"helm template":      renderIntent,
+	}
+)
+
+// normalizeIntentPrompt lowercases, trims and collapses whitespace in a prompt
+// so that trivially different prompts share a cache entry
+func normalizeIntentPrompt(prompt string) string {
+	return strings.Join(strings.Fields(strings.ToLower(prompt)), " ")
+}
+
+// lookupDeterministicIntent returns a fixed classification for short, well known prompts
+func lookupDeterministicIntent(normalizedPrompt string) (*workspacetypes.Intent, bool) {
+	if len(normalizedPrompt) >= maxDeterministicPromptLen {
+		return nil, false
+	}
+
+	trimmed := strings.TrimRight(normalizedPrompt, ".!?, ")
+	intent, ok := deterministicIntents[trimmed]
+	if !ok {
+		return nil, false
+	}
+
+	return &intent, true
+}
+
+func intentPersonaKey(messageFromPersona *workspacetypes.ChatMessageFromPersona) string {
+	if messageFromPersona == nil {
+		return string(workspacetypes.ChatMessageFromPersonaAuto)
+	}
+	return string(*messageFromPersona)
+}
+
+func intentCacheKey(normalizedPrompt string, persona string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(persona+"\n"+normalizedPrompt)))
+}
+
+func getCachedIntent(ctx context.Context, normalizedPrompt string, persona string) (*workspacetypes.Intent, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT intent FROM intent_cache WHERE cache_key = $1 AND created_at > $2`
+	var intentJSON []byte
+	if err := conn.QueryRow(ctx, query, intentCacheKey(normalizedPrompt, persona), time.Now().Add(-intentCacheTTL)).Scan(&intentJSON); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query intent cache: %w", err)
+	}
+
+	var intent workspacetypes.Intent
+	if err := json.Unmarshal(intentJSON, &intent); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached intent: %w", err)
+	}
+
+	return &intent, nil
+}
+
+func setCachedIntent(ctx context.Context, normalizedPrompt string, persona string, intent *workspacetypes.Intent) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	intentJSON, err := json.Marshal(intent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal intent: %w", err)
+	}
+
+	query := `INSERT INTO intent_cache (cache_key, normalized_prompt, persona, intent, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (cache_key) DO UPDATE SET intent = EXCLUDED.intent, created_at = EXCLUDED.created_at`
+	if _, err := conn.Exec(ctx, query, intentCacheKey(normalizedPrompt, persona), normalizedPrompt, persona, intentJSON); err != nil {
+		return fmt.Errorf("failed to insert intent cache: %w", err)
+	}
+
+	return nil
+}
+
+// PruneIntentCache deletes the classifications that are too old to be reused
+func PruneIntentCache(ctx context.Context) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	expired, err := conn.Exec(ctx, `DELETE FROM intent_cache WHERE created_at <= $1`, time.Now().Add(-intentCacheTTL))
+	if err != nil {
+		return fmt.Errorf("failed to prune expired intents: %w", err)
+	}
+
+	if expired.RowsAffected() > 0 {
+		logger.Info("Pruned intent cache", zap.Int64("expired", expired.RowsAffected()))
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeIntentPrompt(t *testing.T) {
+	tests := []struct {
+		name     string
+		prompt   string
+		expected string
+	}{
+		{
+			name:     "lowercases",
+			prompt:   "Proceed",
+			expected: "proceed",
+		},
+		{
+			name:     "trims and collapses whitespace",
+			prompt:   "  Go \t  Ahead\n",
+			expected: "go ahead",
+		},
+		{
+			name:     "empty",
+			prompt:   "   ",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeIntentPrompt(tt.prompt))
+		})
+	}
+}
+
+func TestLookupDeterministicIntent(t *testing.T) {
+	tests := []struct {
+		name     string
+		prompt   string
+		expected *workspacetypes.Intent
+	}{
+		{
+			name:     "proceed",
+			prompt:   "proceed",
+			expected: &proceedIntent,
+		},
+		{
+			name:     "go ahead with punctuation",
+			prompt:   "go ahead!",
+			expected: &proceedIntent,
+		},
+		{
+			name:     "render",
+			prompt:   "render the chart.",
+			expected: &renderIntent,
+		},
+		{
+			name:     "unknown prompt",
+			prompt:   "add a redis dependency",
+			expected: nil,
+		},
+		{
+			name:     "long prompt is never deterministic",
+			prompt:   "proceed, but first rename the deployment to something else",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intent, ok := lookupDeterministicIntent(normalizeIntentPrompt(tt.prompt))
+			if tt.expected == nil {
+				assert.False(t, ok)
+				assert.Nil(t, intent)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, *tt.expected, *intent)
+		})
+	}
+}
+
+func TestGetChatMessageIntent_DeterministicPromptsSkipLLM(t *testing.T) {
+	original := classifyIntent
+	defer func() { classifyIntent = original }()
+
+	classifyIntent = func(ctx context.Context, prompt string, messageFromPersona *workspacetypes.ChatMessageFromPersona) (*workspacetypes.Intent, error) {
+		t.Fatalf("unexpected llm call for prompt %q", prompt)
+		return nil, nil
+	}
+
+	developer := workspacetypes.ChatMessageFromPersonaDeveloper
+
+	tests := []struct {
+		name    string
+		prompt  string
+		persona *workspacetypes.ChatMessageFromPersona
+	}{
+		{
+			name:   "proceed",
+			prompt: "proceed",
+		},
+		{
+			name:   "go ahead",
+			prompt: "go ahead",
+		},
+		{
+			name:    "go ahead from developer",
+			prompt:  "  Go Ahead ",
+			persona: &developer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intent, err := GetChatMessageIntent(context.Background(), tt.prompt, false, tt.persona)
+			require.NoError(t, err)
+			assert.True(t, intent.IsProceed)
+			assert.False(t, intent.IsPlan)
+		})
+	}
+}
+
+func TestGetChatMessageIntent_InitialPromptBypassesCache(t *testing.T) {
+	original := classifyIntent
+	defer func() { classifyIntent = original }()
+
+	calls := 0
+	classifyIntent = func(ctx context.Context, prompt string, messageFromPersona *workspacetypes.ChatMessageFromPersona) (*workspacetypes.Intent, error) {
+		calls++
+		return &workspacetypes.Intent{IsProceed: true}, nil
+	}
+
+	intent, err := GetChatMessageIntent(context.Background(), "proceed", true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.True(t, intent.IsPlan)
+	assert.False(t, intent.IsProceed)
+}
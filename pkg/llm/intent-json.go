@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jpoz/groq"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// intentJSONRecovery is how the JSON of an intent response was recovered
+type intentJSONRecovery string
+
+const (
+	// intentJSONStrict is a response that was only the JSON object
+	intentJSONStrict intentJSONRecovery = "strict"
+	// intentJSONExtracted is a JSON object found in a response with other text around it
+	intentJSONExtracted intentJSONRecovery = "extracted"
+	// intentJSONLenient is a JSON object with trailing commas or single quoted strings
+	intentJSONLenient intentJSONRecovery = "lenient"
+)
+
+// intentJSONNudge is sent once when the model's intent response can't be parsed
+const intentJSONNudge = "Your response could not be parsed. Respond with only the JSON object, with no other text."
+
+// requestIntentCompletion is the groq call that classifies a prompt, it's a variable so tests can
+// replace it
+var requestIntentCompletion = createIntentCompletion
+
+func createIntentCompletion(ctx context.Context, messages []groq.Message) (string, error) {
+	response, err := createGroqChatCompletion(ctx, groq.CompletionCreateParams{
+		Model: ModelFor(OperationIntent),
+		ResponseFormat: groq.ResponseFormat{
+			Type: "json_object",
+		},
+		Messages: messages,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get chat message intent: %w", err)
+	}
+	recordGroqUsage(ctx, OperationIntent, ModelFor(OperationIntent), &response.Usage)
+
+	if len(response.Choices) == 0 {
+		return "", errors.New("intent response has no choices")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+// parseIntentResponse parses the JSON object in an intent response. When it can't be recovered
+// from the response, the model is asked once more for only the JSON.
+func parseIntentResponse(ctx context.Context, messages []groq.Message, content string) (map[string]interface{}, error) {
+	parsed, recovery, err := parseIntentJSON(content)
+	if err == nil {
+		if recovery != intentJSONStrict {
+			logger.Info("Recovered intent response", zap.String("recovery", string(recovery)))
+		}
+		return parsed, nil
+	}
+
+	logger.Warn("failed to parse intent response, asking for only JSON",
+		zap.String("response", truncateIntentResponse(content)),
+		zap.Error(err))
+
+	retryMessages := append([]groq.Message{}, messages...)
+	retryMessages = append(retryMessages,
+		groq.Message{Role: "assistant", Content: content},
+		groq.Message{Role: "user", Content: intentJSONNudge},
+	)
+	retryContent, err := requestIntentCompletion(ctx, retryMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, recovery, err = parseIntentJSON(retryContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse intent response after asking for only JSON: %w", err)
+	}
+
+	logger.Info("Recovered intent response", zap.String("recovery", "retry-"+string(recovery)))
+	return parsed, nil
+}
+
+// parseIntentJSON parses the first JSON object in content, tolerating text around it, trailing
+// commas and single quoted strings. It returns how the object was recovered.
+func parseIntentJSON(content string) (map[string]interface{}, intentJSONRecovery, error) {
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &parsed); err == nil && parsed != nil {
+		return parsed, intentJSONStrict, nil
+	}
+
+	block, ok := extractJSONObject(content)
+	if !ok {
+		return nil, "", fmt.Errorf("no JSON object in intent response %q", truncateIntentResponse(content))
+	}
+
+	if err := json.Unmarshal([]byte(block), &parsed); err == nil && parsed != nil {
+		return parsed, intentJSONExtracted, nil
+	}
+
+	if err := json.Unmarshal([]byte(lenientJSON(block)), &parsed); err != nil {
+		return nil, "", fmt.Errorf("invalid JSON object in intent response %q: %w", truncateIntentResponse(block), err)
+	}
+	return parsed, intentJSONLenient, nil
+}
+
+// extractJSONObject returns the first balanced {...} block in s. Braces inside single or double
+// quoted strings don't count towards the balance.
+func extractJSONObject(s string) (string, bool) {
+	start := strings.IndexByte(s, '{')
+	if start < 0 {
+		return "", false
+	}
+
+	depth := 0
+	var quote byte
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[start : i+1], true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// lenientJSON rewrites the mistakes models make when writing JSON by hand: single quoted strings
+// become double quoted and trailing commas before a closing brace or bracket are removed
+func lenientJSON(s string) string {
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote == '"':
+			sb.WriteByte(c)
+			if c == '\\' && i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			} else if c == '"' {
+				quote = 0
+			}
+
+		case quote == '\'':
+			switch {
+			case c == '\\' && i+1 < len(s) && s[i+1] == '\'':
+				i++
+				sb.WriteByte('\'')
+			case c == '\\' && i+1 < len(s):
+				i++
+				sb.WriteByte(c)
+				sb.WriteByte(s[i])
+			case c == '"':
+				sb.WriteString(`\"`)
+			case c == '\'':
+				sb.WriteByte('"')
+				quote = 0
+			default:
+				sb.WriteByte(c)
+			}
+
+		case c == '"':
+			quote = '"'
+			sb.WriteByte(c)
+
+		case c == '\'':
+			quote = '\''
+			sb.WriteByte('"')
+
+		case c == ',':
+			next := strings.TrimLeft(s[i+1:], " \t\r\n")
+			if strings.HasPrefix(next, "}") || strings.HasPrefix(next, "]") {
+				continue
+			}
+			sb.WriteByte(c)
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// truncateIntentResponse shortens a response for logs and errors
+func truncateIntentResponse(s string) string {
+	const maxLen = 200
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jpoz/groq"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIntentJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		recovery intentJSONRecovery
+	}{
+		{
+			name:     "only json",
+			content:  `{"isPlan": true, "isConversational": false}`,
+			recovery: intentJSONStrict,
+		},
+		{
+			name:     "surrounding whitespace",
+			content:  "\n  {\"isPlan\": true, \"isConversational\": false}\n",
+			recovery: intentJSONStrict,
+		},
+		{
+			name:     "leading sentence",
+			content:  `Here is the JSON you asked for: {"isPlan": true, "isConversational": false}`,
+			recovery: intentJSONExtracted,
+		},
+		{
+			name:     "code fence",
+			content:  "```json\n{\"isPlan\": true, \"isConversational\": false}\n```",
+			recovery: intentJSONExtracted,
+		},
+		{
+			name:     "trailing explanation with braces",
+			content:  "Sure! {\"isPlan\": true, \"isConversational\": false}\nI set isPlan because the user wants {changes}.",
+			recovery: intentJSONExtracted,
+		},
+		{
+			name:     "brace inside a string",
+			content:  `Result: {"isPlan": true, "reason": "edit {{ .Values.image }}", "isConversational": false}`,
+			recovery: intentJSONExtracted,
+		},
+		{
+			name:     "single quoted keys",
+			content:  `{'isPlan': true, 'isConversational': false}`,
+			recovery: intentJSONLenient,
+		},
+		{
+			name:     "trailing commas",
+			content:  "{\n  \"isPlan\": true,\n  \"isConversational\": false,\n  \"tags\": [\"a\", \"b\",],\n}",
+			recovery: intentJSONLenient,
+		},
+		{
+			name:     "single quotes with apostrophe and double quote",
+			content:  `Here you go: {'isPlan': true, 'reason': 'user\'s "ingress" request', 'isConversational': false,}`,
+			recovery: intentJSONLenient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, recovery, err := parseIntentJSON(tt.content)
+			require.NoError(t, err)
+			assert.Equal(t, tt.recovery, recovery)
+			assert.Equal(t, true, parsed["isPlan"])
+			assert.Equal(t, false, parsed["isConversational"])
+		})
+	}
+}
+
+func TestParseIntentJSONUnrecoverable(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "prose", content: "I think the user wants to plan a change to the chart.", wantErr: "no JSON object in intent response"},
+		{name: "unbalanced", content: `Here it is: {"isPlan": true, "isConversational": false`, wantErr: "no JSON object in intent response"},
+		{name: "not json inside braces", content: `{isPlan: yes please}`, wantErr: "invalid JSON object in intent response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseIntentJSON(tt.content)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+// stubIntentCompletion replaces the groq call with responses served in order, and records the
+// messages of each request
+func stubIntentCompletion(t *testing.T, responses ...string) *[][]groq.Message {
+	requests := [][]groq.Message{}
+	original := requestIntentCompletion
+	requestIntentCompletion = func(ctx context.Context, messages []groq.Message) (string, error) {
+		requests = append(requests, messages)
+		if len(requests) > len(responses) {
+			return "", errors.New("unexpected intent request")
+		}
+		return responses[len(requests)-1], nil
+	}
+	t.Cleanup(func() { requestIntentCompletion = original })
+	return &requests
+}
+
+func TestGetChatMessageIntentFromLLMRecovers(t *testing.T) {
+	require.NoError(t, param.Init(nil))
+
+	tests := []struct {
+		name         string
+		responses    []string
+		wantRequests int
+	}{
+		{name: "strict", responses: []string{`{"isPlan": true, "isRender": true}`}, wantRequests: 1},
+		{name: "leading sentence", responses: []string{`Here is the JSON you asked for: {"isPlan": true, "isRender": true}`}, wantRequests: 1},
+		{name: "single quotes", responses: []string{`{'isPlan': true, 'isRender': true,}`}, wantRequests: 1},
+		{name: "asks again", responses: []string{`The user wants a plan and a render.`, `{"isPlan": true, "isRender": true}`}, wantRequests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := stubIntentCompletion(t, tt.responses...)
+
+			intent, err := getChatMessageIntentFromLLM(context.Background(), "add an ingress and render it", nil)
+			require.NoError(t, err)
+			assert.Equal(t, &workspacetypes.Intent{IsPlan: true, IsRender: true}, intent)
+
+			require.Len(t, *requests, tt.wantRequests)
+			if tt.wantRequests == 2 {
+				retry := (*requests)[1]
+				require.Len(t, retry, 3)
+				assert.Equal(t, "assistant", retry[1].Role)
+				assert.Equal(t, tt.responses[0], retry[1].Content)
+				assert.Equal(t, intentJSONNudge, retry[2].Content)
+			}
+		})
+	}
+}
+
+func TestGetChatMessageIntentFromLLMUnrecoverable(t *testing.T) {
+	require.NoError(t, param.Init(nil))
+	requests := stubIntentCompletion(t, "I can't classify that.", "Still not JSON, sorry.")
+
+	_, err := getChatMessageIntentFromLLM(context.Background(), "hello", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse intent response after asking for only JSON")
+	assert.Contains(t, err.Error(), "Still not JSON")
+	assert.Len(t, *requests, 2, "the model is only asked again once")
+}
@@ -2,24 +2,83 @@ package llm
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/jpoz/groq"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
-	"github.com/replicatedhq/chartsmith/pkg/param"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"go.uber.org/zap"
 )
 
+// classifyIntent is the llm call used to classify a prompt, it's a variable so tests can replace it
+var classifyIntent = getChatMessageIntentFromLLM
+
 func GetChatMessageIntent(ctx context.Context, prompt string, isInitialPrompt bool, messageFromPersona *workspacetypes.ChatMessageFromPersona) (*workspacetypes.Intent, error) {
 	logger.Debug("GetChatMessageIntent",
 		zap.String("prompt", prompt),
 		zap.Bool("isInitialPrompt", isInitialPrompt))
 
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
+	// for initial prompts, we always assume it's a plan, but we still hit the llm because
+	// it could be totally off topic. these are never cached.
+	if isInitialPrompt {
+		intent, err := classifyIntent(ctx, prompt, messageFromPersona)
+		if err != nil {
+			return nil, err
+		}
+
+		intent.IsPlan = true
+		intent.IsProceed = false
+
+		logger.Debug("GetChatMessageIntent result",
+			zap.Any("intent", intent),
+		)
+		return intent, nil
+	}
+
+	normalizedPrompt := normalizeIntentPrompt(prompt)
+	persona := intentPersonaKey(messageFromPersona)
+
+	if persona != string(workspacetypes.ChatMessageFromPersonaOperator) {
+		if intent, ok := lookupDeterministicIntent(normalizedPrompt); ok {
+			logger.Debug("GetChatMessageIntent deterministic result",
+				zap.Any("intent", intent),
+			)
+			return intent, nil
+		}
+	}
+
+	cachedIntent, err := getCachedIntent(ctx, normalizedPrompt, persona)
+	if err != nil {
+		logger.Warn("failed to get cached intent", zap.Error(err))
+	} else if cachedIntent != nil {
+		logger.Debug("GetChatMessageIntent cached result",
+			zap.Any("intent", cachedIntent),
+		)
+		return cachedIntent, nil
+	}
+
+	intent, err := classifyIntent(ctx, prompt, messageFromPersona)
+	if err != nil {
+		return nil, err
+	}
 
+	if err := setCachedIntent(ctx, normalizedPrompt, persona, intent); err != nil {
+		logger.Warn("failed to cache intent", zap.Error(err))
+	}
+
+	logger.Debug("GetChatMessageIntent result",
+		zap.Any("intent", intent),
+	)
+	return intent, nil
+}
+
+func getChatMessageIntentFromLLM(ctx context.Context, prompt string, messageFromPersona *workspacetypes.ChatMessageFromPersona) (*workspacetypes.Intent, error) {
 	// deepseek r1 recommends no system prompt, include everything in the user prompt
+	systemPromptName := promptCommonSystem
+	if messageFromPersona != nil && *messageFromPersona == workspacetypes.ChatMessageFromPersonaOperator {
+		systemPromptName = promptEndUserSystem
+	}
+	ctx, systemPrompt := withPrompt(ctx, systemPromptName)
 	userMessage := ""
 
 	if messageFromPersona == nil || *messageFromPersona == workspacetypes.ChatMessageFromPersonaAuto {
@@ -41,7 +100,7 @@ func GetChatMessageIntent(ctx context.Context, prompt string, isInitialPrompt bo
 		- isRender: true if the prompt is a request to render or test or validate the chart, false otherwise
 
 		Important: Do not respond with anything other than the JSON object.`,
-			commonSystemPrompt, prompt)
+			systemPrompt, prompt)
 
 	} else if *messageFromPersona == workspacetypes.ChatMessageFromPersonaDeveloper {
 		userMessage = fmt.Sprintf(`%s
@@ -61,7 +120,7 @@ func GetChatMessageIntent(ctx context.Context, prompt string, isInitialPrompt bo
 		- isRender: true if the prompt is a request to render or test or validate the chart, false otherwise
 
 		Important: Do not respond with anything other than the JSON object.`,
-			commonSystemPrompt, prompt)
+			systemPrompt, prompt)
 
 	} else if *messageFromPersona == workspacetypes.ChatMessageFromPersonaOperator {
 		userMessage = fmt.Sprintf(`%s
@@ -79,30 +138,25 @@ func GetChatMessageIntent(ctx context.Context, prompt string, isInitialPrompt bo
 		- isChartOperator: true if it's possible to answer this question as if it was asked by the chat operator and can be completed without making any changes to the chart templates or files, false if otherwise
 
 		Important: Do not respond with anything other than the JSON object.`,
-			endUserSystemPrompt, prompt)
+			systemPrompt, prompt)
 
 	}
 
-	response, err := client.CreateChatCompletion(groq.CompletionCreateParams{
-		Model: "llama-3.3-70b-versatile",
-		ResponseFormat: groq.ResponseFormat{
-			Type: "json_object",
+	messages := []groq.Message{
+		{
+			Role:    "user",
+			Content: userMessage,
 		},
-		Messages: []groq.Message{
-			{
-				Role:    "user",
-				Content: userMessage,
-			},
-		},
-	})
+	}
+
+	content, err := requestIntentCompletion(ctx, messages)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat message intent: %w", err)
+		return nil, err
 	}
 
-	var parsedResponse map[string]interface{}
-	err = json.Unmarshal([]byte(response.Choices[0].Message.Content), &parsedResponse)
+	parsedResponse, err := parseIntentResponse(ctx, messages, content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		return nil, err
 	}
 
 	intent := &workspacetypes.Intent{}
@@ -129,135 +183,86 @@ func GetChatMessageIntent(ctx context.Context, prompt string, isInitialPrompt bo
 		intent.IsRender = value
 	}
 
-	// for initial prompts, we always assume it's a plan, but we still hit this because
-	// it could be totally off topic
-	if isInitialPrompt {
-		intent.IsPlan = true
-		intent.IsProceed = false
-	}
-
-	logger.Debug("GetChatMessageIntent result",
-		zap.Any("intent", intent),
-	)
 	return intent, nil
 }
 
-func FeedbackOnNotDeveloperIntentWhenRequested(ctx context.Context, streamCh chan string, doneCh chan error, chatMessage *workspacetypes.Chat) error {
+func FeedbackOnNotDeveloperIntentWhenRequested(ctx context.Context, streamCh chan string, doneCh chan error, opts FeedbackOpts) error {
 	logger.Debug("FeedbackOnNotDeveloperIntentWhenRequested",
-		zap.String("prompt", chatMessage.Prompt),
+		zap.String("prompt", opts.ChatMessage.Prompt),
 	)
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
-
-	chatCompletion, err := client.CreateChatCompletion(groq.CompletionCreateParams{
-		Model:  "llama-3.3-70b-versatile",
-		Stream: true,
-		Messages: []groq.Message{
-			{
-				Role:    "system",
-				Content: "You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. They asked you the following question and asked you to answer it as a developer. However, you are unable to answer the question as a developer. Explain to the user that the message cannot be answered as a chart developer and why.",
-			},
-			{
-				Role:    "user",
-				Content: chatMessage.Prompt,
-			},
-		},
+
+	chatCompletion, err := createGroqChatCompletion(ctx, groq.CompletionCreateParams{
+		Model:    ModelFor(OperationIntent),
+		Stream:   true,
+		Messages: buildFeedbackMessages("You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. They asked you the following question and asked you to answer it as a developer. However, you are unable to answer the question as a developer. Explain to the user that the message cannot be answered as a chart developer and why.", opts),
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to get chat message intent: %w", err)
+		err = fmt.Errorf("failed to get chat message intent: %w", err)
+		sendContext(ctx, doneCh, err)
+		return err
 	}
 
-	for delta := range chatCompletion.Stream {
-		streamCh <- delta.Choices[0].Delta.Content
+	if err := streamGroqCompletion(ctx, OperationIntent, chatCompletion, streamCh); err != nil {
+		return err
 	}
 
-	doneCh <- nil
-	return nil
+	return sendContext(ctx, doneCh, nil)
 }
 
-func FeedbackOnNotOperatorIntentWhenRequested(ctx context.Context, streamCh chan string, doneCh chan error, chatMessage *workspacetypes.Chat) error {
+func FeedbackOnNotOperatorIntentWhenRequested(ctx context.Context, streamCh chan string, doneCh chan error, opts FeedbackOpts) error {
 	logger.Debug("FeedbackOnNotOperatorIntentWhenRequested",
-		zap.String("prompt", chatMessage.Prompt),
+		zap.String("prompt", opts.ChatMessage.Prompt),
 	)
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
-
-	chatCompletion, err := client.CreateChatCompletion(groq.CompletionCreateParams{
-		Model:  "llama-3.3-70b-versatile",
-		Stream: true,
-		Messages: []groq.Message{
-			{
-				Role:    "system",
-				Content: "You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. They asked you the following question and asked you to answer it as an operator. However, you are unable to answer the question as an operator. Explain to the user that the message cannot be answered as a chart operator / end-user and why.",
-			},
-			{
-				Role:    "user",
-				Content: chatMessage.Prompt,
-			},
-		},
+
+	chatCompletion, err := createGroqChatCompletion(ctx, groq.CompletionCreateParams{
+		Model:    ModelFor(OperationIntent),
+		Stream:   true,
+		Messages: buildFeedbackMessages("You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. They asked you the following question and asked you to answer it as an operator. However, you are unable to answer the question as an operator. Explain to the user that the message cannot be answered as a chart operator / end-user and why.", opts),
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to get chat message intent: %w", err)
+		err = fmt.Errorf("failed to get chat message intent: %w", err)
+		sendContext(ctx, doneCh, err)
+		return err
 	}
 
-	for delta := range chatCompletion.Stream {
-		streamCh <- delta.Choices[0].Delta.Content
+	if err := streamGroqCompletion(ctx, OperationIntent, chatCompletion, streamCh); err != nil {
+		return err
 	}
 
-	doneCh <- nil
-	return nil
+	return sendContext(ctx, doneCh, nil)
 }
 
-func FeedbackOnAmbiguousIntent(ctx context.Context, streamCh chan string, doneCh chan error, chatMessage *workspacetypes.Chat) error {
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
-
-	chatCompletion, err := client.CreateChatCompletion(groq.CompletionCreateParams{
-		Model:  "llama-3.3-70b-versatile",
-		Stream: true,
-		Messages: []groq.Message{
-			{
-				Role:    "system",
-				Content: "You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. You are given a prompt from the user, and you are unable to figure out it's intent. Politelty ask the user to clarify their message.",
-			},
-			{
-				Role:    "user",
-				Content: chatMessage.Prompt,
-			},
-		},
+func FeedbackOnAmbiguousIntent(ctx context.Context, streamCh chan string, doneCh chan error, opts FeedbackOpts) error {
+	chatCompletion, err := createGroqChatCompletion(ctx, groq.CompletionCreateParams{
+		Model:    ModelFor(OperationIntent),
+		Stream:   true,
+		Messages: buildFeedbackMessages("You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. You are given a prompt from the user, and you are unable to figure out it's intent. Politelty ask the user to clarify their message.", opts),
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to get chat message intent: %w", err)
+		err = fmt.Errorf("failed to get chat message intent: %w", err)
+		sendContext(ctx, doneCh, err)
+		return err
 	}
 
-	for delta := range chatCompletion.Stream {
-		streamCh <- delta.Choices[0].Delta.Content
+	if err := streamGroqCompletion(ctx, OperationIntent, chatCompletion, streamCh); err != nil {
+		return err
 	}
 
-	doneCh <- nil
-	return nil
+	return sendContext(ctx, doneCh, nil)
 }
 
-func DeclineOffTopicChatMessage(ctx context.Context, streamCh chan string, doneCh chan error, chatMessage *workspacetypes.Chat) error {
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
-
-	chatCompletion, err := client.CreateChatCompletion(groq.CompletionCreateParams{
-		Model:  "llama-3.3-70b-versatile",
-		Stream: true,
-		Messages: []groq.Message{
-			{
-				Role:    "system",
-				Content: "You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. You are given a prompt from the user and you need to decline the prompt because it is off topic.",
-			},
-			{
-				Role:    "user",
-				Content: chatMessage.Prompt,
-			},
-		},
+func DeclineOffTopicChatMessage(ctx context.Context, streamCh chan string, doneCh chan error, opts FeedbackOpts) error {
+	chatCompletion, err := createGroqChatCompletion(ctx, groq.CompletionCreateParams{
+		Model:    ModelFor(OperationIntent),
+		Stream:   true,
+		Messages: buildFeedbackMessages("You are Chartsmith, an expert Helm chart developer. You are currently pairing with a user who is trying to create a Helm chart. You are given a prompt from the user and you need to decline the prompt because it is off topic.", opts),
 	})
 
 	if err != nil {
-		doneCh <- fmt.Errorf("failed to decline off-topic chat message: %w", err)
+		sendContext(ctx, doneCh, fmt.Errorf("failed to decline off-topic chat message: %w", err))
 		return fmt.Errorf("failed to decline off-topic chat message: %w", err)
 	}
 
@@ -265,10 +270,9 @@ func DeclineOffTopicChatMessage(ctx context.Context, streamCh chan string, doneC
 	// to this llm package.
 	// so we need to make sure we only send the delta to the streamCh
 
-	for delta := range chatCompletion.Stream {
-		streamCh <- delta.Choices[0].Delta.Content
+	if err := streamGroqCompletion(ctx, OperationIntent, chatCompletion, streamCh); err != nil {
+		return err
 	}
 
-	doneCh <- nil
-	return nil
+	return sendContext(ctx, doneCh, nil)
 }
@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"sync"
+	"time"
+
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+)
+
+// InterimContentInterval is the least time between two interim content updates of an action. The
+// changes in between are coalesced into the latest one.
+const InterimContentInterval = 300 * time.Millisecond
+
+// interimContentSender sends the interim content of an action without ever blocking on the
+// consumer. Updates within the interval of the last one are held back and only the latest is
+// sent when the interval ends. When the channel is full the update the consumer hasn't read is
+// replaced, so a slow consumer always gets the latest content. Sends to an unbuffered channel
+// are dropped unless the consumer is waiting, so consumers should give the channel a buffer of 1.
+type interimContentSender struct {
+	ch       chan llmtypes.InterimContent
+	interval time.Duration
+
+	mu       sync.Mutex
+	version  int
+	pending  *llmtypes.InterimContent
+	lastSent time.Time
+	timer    *time.Timer
+	closed   bool
+}
+
+// newInterimContentSender returns a sender for ch, a nil ch discards every update
+func newInterimContentSender(ch chan llmtypes.InterimContent, interval time.Duration) *interimContentSender {
+	return &interimContentSender{ch: ch, interval: interval}
+}
+
+// Update records a new version of the content, sending it now or when the interval ends
+func (s *interimContentSender) Update(content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ch == nil || s.closed {
+		return
+	}
+
+	s.version++
+	s.pending = &llmtypes.InterimContent{Version: s.version, Content: content}
+
+	wait := s.interval - time.Since(s.lastSent)
+	if wait <= 0 {
+		s.flushLocked()
+		return
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(wait, s.flush)
+	}
+}
+
+// Close sends the content that's held back, if any, and stops sending updates
+func (s *interimContentSender) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if s.ch != nil {
+		s.flushLocked()
+	}
+	s.closed = true
+}
+
+func (s *interimContentSender) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.pending == nil {
+		return
+	}
+	// an update sent since the timer was set restarted the interval
+	if wait := s.interval - time.Since(s.lastSent); wait > 0 {
+		s.timer = time.AfterFunc(wait, s.flush)
+		return
+	}
+	s.flushLocked()
+}
+
+func (s *interimContentSender) flushLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.pending == nil {
+		return
+	}
+
+	update := *s.pending
+	s.pending = nil
+	s.lastSent = time.Now()
+
+	for {
+		select {
+		case s.ch <- update:
+			return
+		default:
+		}
+
+		// the consumer hasn't read the previous update, replace it with this one
+		select {
+		case <-s.ch:
+		default:
+			// an unbuffered channel without a waiting consumer
+			return
+		}
+	}
+}
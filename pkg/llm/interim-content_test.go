@@ -0,0 +1,74 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterimContentSenderStalledConsumer(t *testing.T) {
+	ch := make(chan llmtypes.InterimContent, 1)
+	sender := newInterimContentSender(ch, 0)
+
+	// nothing reads the channel while the action makes its changes, and no update blocks
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 50; i++ {
+			sender.Update(string(rune('a' + i%26)))
+		}
+		sender.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("updates blocked on a stalled consumer")
+	}
+
+	// the consumer catches up with the latest content, and can tell it missed versions
+	assert.Equal(t, []llmtypes.InterimContent{{Version: 50, Content: "x"}}, drain(ch))
+}
+
+func TestInterimContentSenderCoalesces(t *testing.T) {
+	ch := make(chan llmtypes.InterimContent, 1)
+	sender := newInterimContentSender(ch, 100*time.Millisecond)
+
+	start := time.Now()
+	sender.Update("v1")
+	sender.Update("v2")
+	sender.Update("v3")
+
+	// the first update is sent right away, the ones after it wait for the interval
+	assert.Equal(t, []llmtypes.InterimContent{{Version: 1, Content: "v1"}}, drain(ch))
+
+	select {
+	case update := <-ch:
+		assert.Equal(t, llmtypes.InterimContent{Version: 3, Content: "v3"}, update)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the held back update wasn't sent")
+	}
+
+	// closing sends what's held back without waiting, and nothing is sent after
+	sender.Update("v4")
+	sender.Close()
+	assert.Equal(t, []llmtypes.InterimContent{{Version: 4, Content: "v4"}}, drain(ch))
+	sender.Update("v5")
+	time.Sleep(150 * time.Millisecond)
+	assert.Empty(t, drain(ch))
+}
+
+func TestInterimContentSenderWithoutChannel(t *testing.T) {
+	sender := newInterimContentSender(nil, 0)
+	sender.Update("content")
+	sender.Close()
+
+	unbuffered := make(chan llmtypes.InterimContent)
+	sender = newInterimContentSender(unbuffered, 0)
+	sender.Update("dropped, nothing is waiting")
+	sender.Close()
+	require.Empty(t, drain(unbuffered))
+}
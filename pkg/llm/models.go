@@ -0,0 +1,105 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"go.uber.org/zap"
+)
+
+// Operation is a kind of LLM call. Each operation is served by a single provider, so a model
+// configured for an operation must be a model that provider serves.
+type Operation string
+
+const (
+	// OperationIntent classifies chat messages and answers off topic ones (Groq)
+	OperationIntent Operation = "intent"
+	// OperationChat answers conversational chat messages (Anthropic)
+	OperationChat Operation = "chat"
+	// OperationPlan expands prompts and creates plans (Anthropic)
+	OperationPlan Operation = "plan"
+	// OperationExecute executes plan actions against files (Anthropic)
+	OperationExecute Operation = "execute"
+	// OperationSummarize summarizes files (Anthropic)
+	OperationSummarize Operation = "summarize"
+	// OperationConvert converts Kubernetes manifests to templates (Groq)
+	OperationConvert Operation = "convert"
+	// OperationConvertValues cleans up the values.yaml of a conversion, and converts files when
+	// conversion uses Anthropic (Anthropic)
+	OperationConvertValues Operation = "convert-values"
+)
+
+const groqLlama70B = "llama-3.3-70b-versatile"
+
+var defaultModels = map[Operation]string{
+	OperationIntent:        groqLlama70B,
+	OperationChat:          Model_Sonnet37,
+	OperationPlan:          Model_Sonnet37,
+	OperationExecute:       Model_Sonnet35,
+	OperationSummarize:     Model_Sonnet37,
+	OperationConvert:       groqLlama70B,
+	OperationConvertValues: Model_Sonnet37,
+}
+
+// operations in the order they're logged
+var operations = []Operation{
+	OperationIntent,
+	OperationChat,
+	OperationPlan,
+	OperationExecute,
+	OperationSummarize,
+	OperationConvert,
+	OperationConvertValues,
+}
+
+func configuredModel(op Operation) string {
+	p := param.Get()
+	switch op {
+	case OperationIntent:
+		return p.IntentModel
+	case OperationChat:
+		return p.ChatModel
+	case OperationPlan:
+		return p.PlanModel
+	case OperationExecute:
+		return p.ExecuteModel
+	case OperationSummarize:
+		return p.SummarizeModel
+	case OperationConvert:
+		return p.ConvertModel
+	case OperationConvertValues:
+		return p.ConvertValuesModel
+	}
+	return ""
+}
+
+// ModelFor returns the model to use for an operation, the configured model if there is one
+func ModelFor(op Operation) string {
+	if model := strings.TrimSpace(configuredModel(op)); model != "" {
+		return model
+	}
+	return defaultModels[op]
+}
+
+// ValidateModels checks that every operation resolves to a model and logs the effective mapping.
+// A model that is configured but blank is an error rather than silently falling back to the default.
+func ValidateModels() error {
+	fields := []zap.Field{}
+	for _, op := range operations {
+		configured := configuredModel(op)
+		if configured != "" && strings.TrimSpace(configured) == "" {
+			return fmt.Errorf("model for operation %q is configured but blank", op)
+		}
+
+		model := ModelFor(op)
+		if model == "" {
+			return fmt.Errorf("no model for operation %q", op)
+		}
+		fields = append(fields, zap.String(string(op), model))
+	}
+
+	logger.Info("LLM models", fields...)
+	return nil
+}
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelForDefaults(t *testing.T) {
+	for _, env := range []string{"INTENT_MODEL", "CHAT_MODEL", "PLAN_MODEL", "EXECUTE_MODEL", "SUMMARIZE_MODEL", "CONVERT_MODEL", "CONVERT_VALUES_MODEL"} {
+		t.Setenv(env, "")
+	}
+	require.NoError(t, param.Init(nil))
+
+	for _, op := range operations {
+		assert.Equal(t, defaultModels[op], ModelFor(op), string(op))
+	}
+	assert.NoError(t, ValidateModels())
+}
+
+func TestModelForEnvOverride(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("PLAN_MODEL", "claude-3-5-haiku-20241022")
+	t.Setenv("SUMMARIZE_MODEL", " claude-3-5-haiku-latest ")
+	require.NoError(t, param.Init(nil))
+
+	assert.Equal(t, "claude-3-5-haiku-20241022", ModelFor(OperationPlan))
+	assert.Equal(t, "claude-3-5-haiku-latest", ModelFor(OperationSummarize))
+
+	fake := newFakeAnthropic(t)
+
+	expanded, err := ExpandPrompt(context.Background(), "add an ingress")
+	require.NoError(t, err)
+	assert.Equal(t, "expanded", expanded)
+
+	_, err = summarizeContentWithClaude(context.Background(), "kind: Service")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"claude-3-5-haiku-20241022", "claude-3-5-haiku-latest"}, fake.models)
+}
+
+func TestValidateModelsBlank(t *testing.T) {
+	t.Setenv("INTENT_MODEL", "   ")
+	require.NoError(t, param.Init(nil))
+
+	assert.Error(t, ValidateModels())
+}
@@ -7,6 +7,13 @@ import (
 	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
 )
 
+// actionPlanStartRegex matches the opening tag of an action in a plan, an action is streamed as
+// soon as its opening tag is complete
+var actionPlanStartRegex = regexp.MustCompile(`<chartsmithActionPlan\s+type="([^"]+)"\s+action="([^"]+)"\s+path="([^"]+)"[^>]*>`)
+
+// actionPlanTagPrefix is how every opening tag of an action starts
+const actionPlanTagPrefix = "<chartsmithActionPlan"
+
 type HelmResponse struct {
 	Title     string
 	Artifacts []types.Artifact
@@ -100,8 +107,7 @@ func (p *Parser) ParsePlan(chunk string) {
 	}
 
 	// Find all action plans - modified regex to be more flexible
-	fileStartRegex := regexp.MustCompile(`<chartsmithActionPlan\s+type="([^"]+)"\s+action="([^"]+)"\s+path="([^"]+)"[^>]*>`)
-	startMatches := fileStartRegex.FindAllStringSubmatch(p.buffer, -1)
+	startMatches := actionPlanStartRegex.FindAllStringSubmatch(p.buffer, -1)
 
 	for _, match := range startMatches {
 		if len(match) != 4 {
@@ -138,3 +144,56 @@ func (p *Parser) ParsePlan(chunk string) {
 func (p *Parser) GetResult() HelmResponse {
 	return p.result
 }
+
+// planStreamParser finds the actions in a plan as it streams. Unlike Parser, it only keeps the end
+// of the response that can still hold an incomplete tag, so each chunk is scanned once no matter
+// how long the response gets.
+type planStreamParser struct {
+	tail string // starts at the earliest position an action tag that isn't parsed yet can start
+}
+
+func newPlanStreamParser() *planStreamParser {
+	return &planStreamParser{}
+}
+
+// Write adds a chunk of the response and returns the actions whose opening tags it completed, in
+// the order they appear, with their attributes as written. Checking them, and dropping repeated
+// paths, is left to actionPlanValidator.
+func (p *planStreamParser) Write(chunk string) []types.ActionPlanWithPath {
+	p.tail += chunk
+
+	actions := []types.ActionPlanWithPath{}
+	consumed := 0
+	for _, match := range actionPlanStartRegex.FindAllStringSubmatchIndex(p.tail, -1) {
+		consumed = match[1]
+
+		actions = append(actions, types.ActionPlanWithPath{
+			Path: p.tail[match[6]:match[7]],
+			ActionPlan: types.ActionPlan{
+				Type:   p.tail[match[2]:match[3]],
+				Action: p.tail[match[4]:match[5]],
+			},
+		})
+	}
+
+	p.tail = p.tail[consumed+p.unparsedStart(p.tail[consumed:]):]
+	return actions
+}
+
+// unparsedStart returns where the next action tag can start in text that has no complete tags.
+// A tag whose opening is closed without matching never will, so it's skipped. Without a tag,
+// the end is kept in case it's the start of a tag prefix that's split across chunks.
+func (p *planStreamParser) unparsedStart(text string) int {
+	offset := 0
+	for {
+		i := strings.Index(text[offset:], actionPlanTagPrefix)
+		if i == -1 {
+			return max(offset, len(text)-(len(actionPlanTagPrefix)-1))
+		}
+		start := offset + i
+		if !strings.Contains(text[start:], ">") {
+			return start
+		}
+		offset = start + len(actionPlanTagPrefix)
+	}
+}
@@ -1,6 +1,7 @@
 package llm
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -148,3 +149,152 @@ name: wordpr`,
 		})
 	}
 }
+
+// syntheticPlanResponse is a plan of about size bytes with an action for each of paths, with
+// descriptions long enough to fill it
+func syntheticPlanResponse(paths []string, size int) string {
+	description := "- Keep the existing labels and selectors, and template the replica count from values\n"
+	perAction := size / len(paths)
+
+	response := strings.Builder{}
+	response.WriteString(`<chartsmithArtifactPlan id="plan" title="Synthetic plan">` + "\n\n")
+	for i, path := range paths {
+		action := "update"
+		if i%3 == 0 {
+			action = "create"
+		}
+		start := response.Len()
+		response.WriteString(`<chartsmithActionPlan type="file" action="` + action + `" path="` + path + `">` + "\n")
+		for response.Len()-start < perAction {
+			response.WriteString(description)
+		}
+		response.WriteString("</chartsmithActionPlan>\n\n")
+	}
+	response.WriteString("</chartsmithArtifactPlan>")
+	return response.String()
+}
+
+func syntheticPlanPaths(n int) []string {
+	paths := []string{}
+	for i := 0; i < n; i++ {
+		paths = append(paths, fmt.Sprintf("templates/resource-%02d.yaml", i))
+	}
+	return paths
+}
+
+func chunkString(s string, size int) []string {
+	chunks := []string{}
+	for len(s) > size {
+		chunks = append(chunks, s[:size])
+		s = s[size:]
+	}
+	return append(chunks, s)
+}
+
+// legacyStreamedActions is how execute-plan streamed actions before planStreamParser, re-parsing
+// the whole response on every chunk
+func legacyStreamedActions(chunks []string) []types.ActionPlanWithPath {
+	emitted := []types.ActionPlanWithPath{}
+	fullResponseWithTags := ""
+	actionPlans := make(map[string]types.ActionPlan)
+	for _, chunk := range chunks {
+		fullResponseWithTags += chunk
+		aps, _ := parseActionsInResponse(fullResponseWithTags)
+		for path, action := range aps {
+			if path != "" && action.Type != "" && action.Action != "" {
+				if _, ok := actionPlans[path]; !ok {
+					emitted = append(emitted, types.ActionPlanWithPath{Path: path, ActionPlan: action})
+				}
+				actionPlans[path] = action
+			}
+		}
+	}
+	return emitted
+}
+
+func streamedActions(chunks []string) []types.ActionPlanWithPath {
+	parser := newPlanStreamParser()
+	emitted := []types.ActionPlanWithPath{}
+	for _, chunk := range chunks {
+		emitted = append(emitted, parser.Write(chunk)...)
+	}
+	return emitted
+}
+
+func TestPlanStreamParserMatchesLegacy(t *testing.T) {
+	response := syntheticPlanResponse(syntheticPlanPaths(40), 8*1024)
+
+	// re-parsing the synthetic response one byte at a time takes seconds. Chunks smaller than the
+	// space between tags complete at most one tag each, so the legacy order doesn't depend on map
+	// iteration.
+	for _, size := range []int{7, 16, 64} {
+		t.Run(fmt.Sprintf("chunks of %d", size), func(t *testing.T) {
+			chunks := chunkString(response, size)
+			assert.Equal(t, legacyStreamedActions(chunks), streamedActions(chunks))
+		})
+	}
+}
+
+func TestPlanStreamParserReturnsTagsAsWritten(t *testing.T) {
+	edgeCases := strings.Join([]string{
+		`<chartsmithArtifactPlan title="Edge cases">`,
+		`<chartsmithActionPlan type="file" action="update" path="/values.yaml">leading slash</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" path="templates/wrong-order.yaml" action="create">never parsed</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" action="create" path="templates/service.yaml">first</chartsmithActionPlan>`,
+		`<chartsmithActionPlan type="file" action="delete" path="templates/service.yaml">duplicate path</chartsmithActionPlan>`,
+		"<chartsmithActionPlan\n  type=\"file\"\n  action=\"update\"\n  path=\"Chart.yaml\">attributes on lines</chartsmithActionPlan>",
+		`</chartsmithArtifactPlan>`,
+	}, "\n")
+
+	// a leading slash and a repeated path are left for actionPlanValidator
+	want := []types.ActionPlanWithPath{
+		{Path: "/values.yaml", ActionPlan: types.ActionPlan{Type: "file", Action: "update"}},
+		{Path: "templates/service.yaml", ActionPlan: types.ActionPlan{Type: "file", Action: "create"}},
+		{Path: "templates/service.yaml", ActionPlan: types.ActionPlan{Type: "file", Action: "delete"}},
+		{Path: "Chart.yaml", ActionPlan: types.ActionPlan{Type: "file", Action: "update"}},
+	}
+	for _, size := range []int{1, 3, 5, 7, 16, 64, len(edgeCases)} {
+		assert.Equal(t, want, streamedActions(chunkString(edgeCases, size)), "chunks of %d", size)
+	}
+}
+
+func TestPlanStreamParserOneChunk(t *testing.T) {
+	paths := syntheticPlanPaths(40)
+	response := syntheticPlanResponse(paths, 20*1024)
+
+	// the whole response in one chunk is returned in document order
+	got := streamedActions([]string{response})
+	require.Len(t, got, len(paths))
+	for i, action := range got {
+		assert.Equal(t, paths[i], action.Path)
+	}
+}
+
+func TestPlanStreamParserBoundsTail(t *testing.T) {
+	parser := newPlanStreamParser()
+	for _, chunk := range chunkString(syntheticPlanResponse(syntheticPlanPaths(40), 200*1024), 16) {
+		parser.Write(chunk)
+		assert.LessOrEqual(t, len(parser.tail), 256, "the tail only holds an incomplete tag")
+	}
+}
+
+func BenchmarkExecutePlanParsing(b *testing.B) {
+	paths := syntheticPlanPaths(40)
+	response := syntheticPlanResponse(paths, 200*1024)
+	chunks := chunkString(response, 16)
+
+	b.Run("legacy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if got := legacyStreamedActions(chunks); len(got) != len(paths) {
+				b.Fatalf("got %d actions", len(got))
+			}
+		}
+	})
+	b.Run("incremental", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if got := streamedActions(chunks); len(got) != len(paths) {
+				b.Fatalf("got %d actions", len(got))
+			}
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jpoz/groq"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// feedbackTopK is the number of relevant files included with a persona response
+	feedbackTopK = 5
+
+	// DefaultFeedbackTokenBudget is the estimated number of tokens of file content included with a
+	// persona response before files are summarized, CHARTSMITH_FEEDBACK_TOKEN_BUDGET overrides it
+	DefaultFeedbackTokenBudget = 8000
+
+	// approxCharsPerToken is a rough estimate used to keep prompts bounded without a tokenizer
+	approxCharsPerToken = 4
+)
+
+// summarizeFeedbackFile is a var so that budgeting can be tested without the LLM
+var summarizeFeedbackFile = SummarizeContent
+
+// FeedbackOpts is the context passed to the persona-aware feedback responses
+type FeedbackOpts struct {
+	ChatMessage    *workspacetypes.Chat
+	Workspace      *workspacetypes.Workspace
+	ChartStructure string
+	RelevantFiles  []workspacetypes.File
+}
+
+// NewFeedbackOpts builds the chart context for a feedback response, including the structure of
+// every chart and the top K files of any chart most relevant to the chat message. Files that don't
+// fit in the token budget are replaced by their summaries.
+func NewFeedbackOpts(ctx context.Context, w *workspacetypes.Workspace, chatMessage *workspacetypes.Chat) (FeedbackOpts, error) {
+	opts := FeedbackOpts{
+		ChatMessage: chatMessage,
+		Workspace:   w,
+	}
+
+	if w == nil || len(w.Charts) == 0 {
+		return opts, nil
+	}
+
+	tokenBudget, err := feedbackTokenBudget(param.Get().FeedbackTokenBudget)
+	if err != nil {
+		return opts, err
+	}
+
+	chartStructure, err := getPlanStructure(ctx, w, &w.Charts[0])
+	if err != nil {
+		return opts, fmt.Errorf("failed to get chart structure: %w", err)
+	}
+	opts.ChartStructure = chartStructure
+
+	relevantFiles, err := workspace.ChooseRelevantFilesForChatMessage(
+		ctx,
+		w,
+		workspace.WorkspaceFilter{},
+		w.CurrentRevision,
+		chatMessage.Prompt,
+	)
+	if err != nil {
+		return opts, fmt.Errorf("failed to choose relevant files: %w", err)
+	}
+
+	if len(relevantFiles) > feedbackTopK {
+		relevantFiles = relevantFiles[:feedbackTopK]
+	}
+	files := []workspacetypes.File{}
+	for _, relevantFile := range relevantFiles {
+		file := relevantFile.File
+		file.FilePath = planFilePath(w, file)
+		files = append(files, file)
+	}
+	opts.RelevantFiles = summarizeFileContents(ctx, files, tokenBudget)
+
+	return opts, nil
+}
+
+// feedbackTokenBudget parses CHARTSMITH_FEEDBACK_TOKEN_BUDGET
+func feedbackTokenBudget(budget string) (int, error) {
+	if budget == "" {
+		return DefaultFeedbackTokenBudget, nil
+	}
+	n, err := strconv.Atoi(budget)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid CHARTSMITH_FEEDBACK_TOKEN_BUDGET %q: must be a whole number, at least 1", budget)
+	}
+	return n, nil
+}
+
+// buildFeedbackMessages returns the message list for a feedback response, with the chart
+// structure and relevant files between the system prompt and the user's prompt. The files are
+// expected to be budgeted already.
+func buildFeedbackMessages(systemPrompt string, opts FeedbackOpts) []groq.Message {
+	messages := []groq.Message{
+		{
+			Role:    "system",
+			Content: systemPrompt,
+		},
+	}
+
+	if opts.ChartStructure != "" {
+		messages = append(messages, groq.Message{
+			Role:    "assistant",
+			Content: fmt.Sprintf("I am working on a Helm chart that has the following structure: %s", opts.ChartStructure),
+		})
+	}
+
+	for _, file := range opts.RelevantFiles {
+		messages = append(messages, groq.Message{
+			Role:    "assistant",
+			Content: fmt.Sprintf("File: %s, Content: %s", file.FilePath, file.Content),
+		})
+	}
+
+	prompt := ""
+	if opts.ChatMessage != nil {
+		prompt = opts.ChatMessage.Prompt
+	}
+	messages = append(messages, groq.Message{
+		Role:    "user",
+		Content: prompt,
+	})
+
+	return messages
+}
+
+// budgetFileContents returns the files unchanged if they fit in the token budget,
+// otherwise each file is truncated to an equal share of the budget
+func budgetFileContents(files []workspacetypes.File, tokenBudget int) []workspacetypes.File {
+	return shrinkFileContents(files, tokenBudget, truncateFileContent)
+}
+
+// summarizeFileContents returns the files unchanged if they fit in the token budget, otherwise
+// each file longer than an equal share of the budget is replaced by its summary. A summary that's
+// still too long, or a file that can't be summarized, is cut at the share.
+func summarizeFileContents(ctx context.Context, files []workspacetypes.File, tokenBudget int) []workspacetypes.File {
+	return shrinkFileContents(files, tokenBudget, func(content string, maxChars int) string {
+		return summarizeFileContent(ctx, content, maxChars)
+	})
+}
+
+// shrinkFileContents shrinks the content of each file longer than an equal share of the token
+// budget to the share when the files don't fit in it
+func shrinkFileContents(files []workspacetypes.File, tokenBudget int, shrink func(content string, maxChars int) string) []workspacetypes.File {
+	if len(files) == 0 {
+		return files
+	}
+
+	maxChars := tokenBudget * approxCharsPerToken
+
+	totalChars := 0
+	for _, file := range files {
+		totalChars += len(file.Content)
+	}
+	if totalChars <= maxChars {
+		return files
+	}
+
+	perFileChars := maxChars / len(files)
+	budgeted := make([]workspacetypes.File, 0, len(files))
+	for _, file := range files {
+		if len(file.Content) > perFileChars {
+			file.Content = shrink(file.Content, perFileChars)
+		}
+		budgeted = append(budgeted, file)
+	}
+
+	return budgeted
+}
+
+// summarizeFileContent returns the summary of content that's longer than maxChars, cut to maxChars
+func summarizeFileContent(ctx context.Context, content string, maxChars int) string {
+	summary, err := summarizeFeedbackFile(ctx, content)
+	if err != nil || summary == "" {
+		if err != nil {
+			logger.WarnCtx(ctx, "failed to summarize file for feedback, truncating it", zap.Error(err))
+		}
+		return truncateFileContent(content, maxChars)
+	}
+
+	return truncateFileContent("(summary of the file, it's too long to include) "+summary, maxChars)
+}
+
+// truncateFileContent keeps whole lines from the start of content up to maxChars
+func truncateFileContent(content string, maxChars int) string {
+	if len(content) <= maxChars {
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+
+	var sb strings.Builder
+	kept := 0
+	for _, line := range lines {
+		if sb.Len()+len(line)+1 > maxChars {
+			break
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		kept++
+	}
+
+	sb.WriteString(fmt.Sprintf("... (%d more lines truncated)", len(lines)-kept))
+	return sb.String()
+}
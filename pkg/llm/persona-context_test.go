@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildFeedbackMessages(t *testing.T) {
+	opts := FeedbackOpts{
+		ChatMessage:    &workspacetypes.Chat{Prompt: "how do I enable TLS in this chart?"},
+		ChartStructure: "File: Chart.yamlFile: values.yamlFile: templates/ingress.yaml",
+		RelevantFiles: []workspacetypes.File{
+			{FilePath: "templates/ingress.yaml", Content: "{{- if .Values.ingress.tls }}"},
+		},
+	}
+
+	messages := buildFeedbackMessages("system prompt", opts)
+	require.Len(t, messages, 4)
+
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Equal(t, "system prompt", messages[0].Content)
+
+	assert.Equal(t, "assistant", messages[1].Role)
+	assert.Contains(t, messages[1].Content, "I am working on a Helm chart that has the following structure:")
+	assert.Contains(t, messages[1].Content, opts.ChartStructure)
+
+	assert.Contains(t, messages[2].Content, "File: templates/ingress.yaml")
+
+	assert.Equal(t, "user", messages[3].Role)
+	assert.Equal(t, opts.ChatMessage.Prompt, messages[3].Content)
+}
+
+func TestBuildFeedbackMessages_NoChartContext(t *testing.T) {
+	messages := buildFeedbackMessages("system prompt", FeedbackOpts{
+		ChatMessage: &workspacetypes.Chat{Prompt: "what's the weather?"},
+	})
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Equal(t, "user", messages[1].Role)
+}
+
+func TestBudgetFileContents(t *testing.T) {
+	small := workspacetypes.File{FilePath: "small.yaml", Content: "a: b\n"}
+	large := workspacetypes.File{FilePath: "large.yaml", Content: strings.Repeat("key: value\n", 1000)}
+
+	tests := []struct {
+		name        string
+		files       []workspacetypes.File
+		tokenBudget int
+		maxChars    int
+		truncated   bool
+	}{
+		{
+			name:        "fits in budget",
+			files:       []workspacetypes.File{small},
+			tokenBudget: 100,
+			truncated:   false,
+		},
+		{
+			name:        "exceeds budget",
+			files:       []workspacetypes.File{small, large},
+			tokenBudget: 100,
+			maxChars:    100 * approxCharsPerToken,
+			truncated:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budgeted := budgetFileContents(tt.files, tt.tokenBudget)
+			require.Len(t, budgeted, len(tt.files))
+
+			if !tt.truncated {
+				assert.Equal(t, tt.files, budgeted)
+				return
+			}
+
+			total := 0
+			for _, file := range budgeted {
+				total += len(file.Content)
+			}
+			// allow for the truncation marker on each file
+			assert.LessOrEqual(t, total, tt.maxChars+len(budgeted)*40)
+			assert.Contains(t, budgeted[1].Content, "more lines truncated")
+
+			// the original files are not modified
+			assert.Equal(t, large.Content, tt.files[1].Content)
+		})
+	}
+}
+
+func TestSummarizeFileContents(t *testing.T) {
+	small := workspacetypes.File{FilePath: "small.yaml", Content: "a: b\n"}
+	large := workspacetypes.File{FilePath: "large.yaml", Content: strings.Repeat("key: value\n", 1000)}
+
+	tests := []struct {
+		name        string
+		files       []workspacetypes.File
+		tokenBudget int
+		summary     string
+		summaryErr  error
+		want        string
+	}{
+		{
+			name:        "fits in budget",
+			files:       []workspacetypes.File{small},
+			tokenBudget: 100,
+		},
+		{
+			name:        "summarized",
+			files:       []workspacetypes.File{small, large},
+			tokenBudget: 100,
+			summary:     "a config map of repeated keys",
+			want:        "(summary of the file, it's too long to include) a config map of repeated keys",
+		},
+		{
+			name:        "summary too long",
+			files:       []workspacetypes.File{small, large},
+			tokenBudget: 100,
+			summary:     strings.Repeat("a config map of repeated keys\n", 100),
+			want:        "more lines truncated",
+		},
+		{
+			name:        "summarizing fails",
+			files:       []workspacetypes.File{small, large},
+			tokenBudget: 100,
+			summaryErr:  errors.New("rate limited"),
+			want:        "key: value\nkey: value\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := summarizeFeedbackFile
+			t.Cleanup(func() { summarizeFeedbackFile = original })
+			summarized := []string{}
+			summarizeFeedbackFile = func(ctx context.Context, content string) (string, error) {
+				summarized = append(summarized, content)
+				return tt.summary, tt.summaryErr
+			}
+
+			budgeted := summarizeFileContents(context.Background(), tt.files, tt.tokenBudget)
+			require.Len(t, budgeted, len(tt.files))
+
+			if tt.want == "" {
+				assert.Equal(t, tt.files, budgeted)
+				assert.Empty(t, summarized)
+				return
+			}
+
+			// only the file longer than its share is summarized
+			assert.Equal(t, []string{large.Content}, summarized)
+			assert.Equal(t, small, budgeted[0])
+			assert.Contains(t, budgeted[1].Content, tt.want)
+
+			// allow for the truncation marker
+			maxChars := tt.tokenBudget * approxCharsPerToken / len(tt.files)
+			assert.LessOrEqual(t, len(budgeted[1].Content), maxChars+40)
+
+			// the original files are not modified
+			assert.Equal(t, large.Content, tt.files[1].Content)
+		})
+	}
+}
+
+func TestFeedbackTokenBudget(t *testing.T) {
+	budget, err := feedbackTokenBudget("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFeedbackTokenBudget, budget)
+
+	budget, err = feedbackTokenBudget("2000")
+	require.NoError(t, err)
+	assert.Equal(t, 2000, budget)
+
+	for _, invalid := range []string{"0", "-1", "lots"} {
+		_, err := feedbackTokenBudget(invalid)
+		assert.ErrorContains(t, err, "CHARTSMITH_FEEDBACK_TOKEN_BUDGET", invalid)
+	}
+}
@@ -0,0 +1,313 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPlanDryRunMaxFiles is how many files a dry run previews
+	DefaultPlanDryRunMaxFiles = 5
+	// DefaultPlanDryRunMaxTokens is how many input and output tokens a dry run may spend. The
+	// action that crosses it finishes, the ones after it aren't previewed.
+	DefaultPlanDryRunMaxTokens = 200000
+)
+
+// PlanDryRunBudget caps what a dry run spends on the LLM
+type PlanDryRunBudget struct {
+	MaxFiles  int
+	MaxTokens int64
+}
+
+// these are vars so that dry runs can be tested without a database or LLM
+var (
+	getDryRunWorkspace      = workspace.GetWorkspace
+	getDryRunValuesProfile  = workspace.GetValuesProfile
+	getPlanDryRun           = workspace.GetPlanDryRun
+	setPlanDryRun           = workspace.SetPlanDryRun
+	chooseDryRunFiles       = ChooseExecutePlanFiles
+	createDryRunExecutePlan = CreateExecutePlan
+	executeDryRunAction     = ExecuteAction
+)
+
+// DryRunPlan previews the changes a plan would make before the user proceeds with it. Each of its
+// actions is executed against a copy of the current content of its file, and the results are
+// returned with their diffs without writing anything to the workspace. A plan whose action files
+// haven't been detailed yet has them detailed for the preview only, the real execution details
+// its own. The preview is stored on the plan and returned again while the plan and the files are
+// unchanged, so that a second preview doesn't spend tokens.
+func DryRunPlan(ctx context.Context, plan *workspacetypes.Plan) (*workspacetypes.PlanDryRun, error) {
+	if plan.Status != workspacetypes.PlanStatusReview && plan.Status != workspacetypes.PlanStatusReviewFiles {
+		return nil, fmt.Errorf("%w: plan %s is %s", workspace.ErrPlanNotPreviewable, plan.ID, plan.Status)
+	}
+	ctx = WithUsageAttribution(ctx, UsageAttribution{WorkspaceID: plan.WorkspaceID, PlanID: plan.ID})
+
+	budget, err := planDryRunBudget(param.Get().PlanDryRunMaxFiles, param.Get().PlanDryRunMaxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := getDryRunWorkspace(ctx, plan.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	fingerprint := planDryRunFingerprint(w, plan)
+	cached, err := getPlanDryRun(ctx, plan.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached dry run: %w", err)
+	}
+	if cached != nil && cached.Fingerprint == fingerprint {
+		cached.Cached = true
+		return cached, nil
+	}
+
+	meter := &UsageMeter{}
+	ctx = WithUsageMeter(ctx, meter)
+
+	actionFiles := workspace.ActionFilesToApply(plan)
+	if len(plan.ActionFiles) == 0 {
+		actionFiles, err = detailPlanActions(ctx, w, plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dryRun, err := dryRunActions(ctx, w, plan, actionFiles, budget, meter)
+	if err != nil {
+		return nil, err
+	}
+	dryRun.Fingerprint = fingerprint
+
+	// the preview is still worth returning when it can't be cached
+	if err := setPlanDryRun(ctx, plan.ID, *dryRun); err != nil {
+		logger.Warn("Failed to store plan dry run", zap.String("planID", plan.ID), zap.Error(err))
+	}
+
+	return dryRun, nil
+}
+
+// dryRunActions executes actions against in-memory copies of the files until they're done or the
+// budget is spent
+func dryRunActions(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan, actionFiles []workspacetypes.ActionFile, budget PlanDryRunBudget, meter *UsageMeter) (*workspacetypes.PlanDryRun, error) {
+	type fileKey struct{ chartID, path string }
+	original := map[fileKey]*string{}
+	for _, chart := range w.Charts {
+		for _, file := range chart.Files {
+			content := file.Content
+			original[fileKey{chart.ID, file.FilePath}] = &content
+		}
+	}
+
+	dryRun := &workspacetypes.PlanDryRun{
+		PlanID:         plan.ID,
+		RevisionNumber: w.CurrentRevision,
+		CreatedAt:      time.Now(),
+		Complete:       true,
+		Files:          []workspacetypes.PlanDryRunFile{},
+		Actions:        len(actionFiles),
+	}
+	// index of each previewed file in dryRun.Files, a file with more than one action is executed
+	// again on the content of the previous one
+	previewed := map[fileKey]int{}
+
+	for _, actionFile := range actionFiles {
+		chart, err := workspace.FindChart(w, actionFile.ChartID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find chart for action file: %w", err)
+		}
+		key := fileKey{chart.ID, actionFile.Path}
+
+		index, seen := previewed[key]
+		inputTokens, outputTokens := meter.Tokens()
+		if !seen && len(dryRun.Files) >= budget.MaxFiles || inputTokens+outputTokens >= budget.MaxTokens {
+			dryRun.Complete = false
+			break
+		}
+
+		before := original[key]
+		if before == nil {
+			// an action on values-<name>.yaml updates the values profile of that name, unless the
+			// chart has its own file at that path
+			if name, ok := workspace.ValuesProfileNameFromFilename(actionFile.Path); ok {
+				profile, err := getDryRunValuesProfile(ctx, w.ID, chart.ID, name)
+				if err != nil && !errors.Is(err, workspace.ErrValuesProfileNotFound) {
+					return nil, fmt.Errorf("failed to get values profile: %w", err)
+				}
+				if profile != nil {
+					before = &profile.Content
+				}
+			}
+		}
+
+		currentContent := ""
+		if seen {
+			currentContent = dryRun.Files[index].Content
+		} else if before != nil {
+			currentContent = *before
+		}
+
+		apwp := types.ActionPlanWithPath{
+			ActionPlan: types.ActionPlan{
+				Action: actionFile.Action,
+				Type:   "file",
+				Status: types.ActionPlanStatusPending,
+			},
+			Path:       actionFile.Path,
+			ChartID:    chart.ID,
+			ReviewNote: actionFile.ReviewNote,
+		}
+		content, err := executeDryRunAction(ctx, apwp, plan, currentContent, nil)
+		if err != nil && isDryRunFatal(ctx, err) {
+			return nil, fmt.Errorf("failed to execute action: %w", err)
+		}
+
+		file := workspacetypes.PlanDryRunFile{
+			ChartID: chart.ID,
+			Path:    actionFile.Path,
+			Action:  actionFile.Action,
+			Content: currentContent,
+		}
+		if seen {
+			file = dryRun.Files[index]
+		}
+		if err != nil {
+			file.Error = err.Error()
+		} else {
+			file.Content = content
+			file.Diff = workspace.DiffContents(actionFile.Path, before, content)
+			if file.Diff != nil {
+				file.Diff.ChartID = chart.ID
+				file.Diff.FromRevision = w.CurrentRevision
+				file.Diff.ToRevision = w.CurrentRevision
+			}
+		}
+
+		if seen {
+			dryRun.Files[index] = file
+		} else {
+			previewed[key] = len(dryRun.Files)
+			dryRun.Files = append(dryRun.Files, file)
+		}
+	}
+
+	dryRun.InputTokens, dryRun.OutputTokens = meter.Tokens()
+	return dryRun, nil
+}
+
+// isDryRunFatal returns true for the errors that would fail every action, the others only fail
+// the preview of their file
+func isDryRunFatal(ctx context.Context, err error) bool {
+	return ctx.Err() != nil ||
+		errors.Is(err, circuitbreaker.ErrOpen) ||
+		errors.Is(err, workspace.ErrSecretsNotAcknowledged)
+}
+
+// detailPlanActions lists the action files of a plan that hasn't been executed yet, the same way
+// executing it does, without storing them on the plan
+func detailPlanActions(ctx context.Context, w *workspacetypes.Workspace, plan *workspacetypes.Plan) ([]workspacetypes.ActionFile, error) {
+	if len(w.Charts) == 0 {
+		return nil, fmt.Errorf("workspace %s has no charts", w.ID)
+	}
+
+	relevantFiles, err := chooseDryRunFiles(ctx, w, plan.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	actionCh := make(chan types.ActionPlanWithPath, 1)
+	// a preview doesn't change the plan's description, malformed actions are only left out
+	skippedCh := make(chan types.SkippedActionPlan)
+	streamCh := make(chan string, 1)
+	// CreateExecutePlan sends a stream error and then nil
+	doneCh := make(chan error, 2)
+	go func() {
+		if err := createDryRunExecutePlan(ctx, actionCh, skippedCh, streamCh, doneCh, w, plan, &w.Charts[0], relevantFiles); err != nil {
+			doneCh <- err
+		}
+	}()
+
+	actionFiles := []workspacetypes.ActionFile{}
+	add := func(action types.ActionPlanWithPath) {
+		actionFiles = AddActionFile(actionFiles, action)
+	}
+	for {
+		select {
+		case <-streamCh:
+		case <-skippedCh:
+		case action := <-actionCh:
+			add(action)
+		case err := <-doneCh:
+			if err != nil {
+				return nil, fmt.Errorf("failed to detail plan actions: %w", err)
+			}
+			// the last action can still be buffered when done is received
+			select {
+			case action := <-actionCh:
+				add(action)
+			default:
+			}
+			return actionFiles, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// planDryRunFingerprint identifies what a preview depends on: the plan's description and action
+// files, and the revision and content of the workspace's files
+func planDryRunFingerprint(w *workspacetypes.Workspace, plan *workspacetypes.Plan) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "revision %d\n%s\n", w.CurrentRevision, plan.Description)
+	for _, actionFile := range plan.ActionFiles {
+		fmt.Fprintf(h, "action %q %q %q %q %q %q\n", actionFile.ChartID, actionFile.Path, actionFile.Action, actionFile.Status, actionFile.Review, actionFile.ReviewNote)
+	}
+
+	files := []string{}
+	for _, chart := range w.Charts {
+		for _, file := range chart.Files {
+			content := sha256.Sum256([]byte(file.Content))
+			files = append(files, fmt.Sprintf("file %q %q %x\n", chart.ID, file.FilePath, content))
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		h.Write([]byte(file))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// planDryRunBudget parses CHARTSMITH_PLAN_DRY_RUN_MAX_FILES and CHARTSMITH_PLAN_DRY_RUN_MAX_TOKENS
+func planDryRunBudget(maxFiles string, maxTokens string) (PlanDryRunBudget, error) {
+	budget := PlanDryRunBudget{MaxFiles: DefaultPlanDryRunMaxFiles, MaxTokens: DefaultPlanDryRunMaxTokens}
+	if maxFiles != "" {
+		n, err := strconv.Atoi(maxFiles)
+		if err != nil || n < 1 {
+			return PlanDryRunBudget{}, fmt.Errorf("invalid CHARTSMITH_PLAN_DRY_RUN_MAX_FILES %q: must be a whole number, at least 1", maxFiles)
+		}
+		budget.MaxFiles = n
+	}
+	if maxTokens != "" {
+		n, err := strconv.ParseInt(maxTokens, 10, 64)
+		if err != nil || n < 1 {
+			return PlanDryRunBudget{}, fmt.Errorf("invalid CHARTSMITH_PLAN_DRY_RUN_MAX_TOKENS %q: must be a whole number, at least 1", maxTokens)
+		}
+		budget.MaxTokens = n
+	}
+	return budget, nil
+}
@@ -0,0 +1,324 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/circuitbreaker"
+	types "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dryRunStubs replaces the dependencies of DryRunPlan. Each executed action appends "# <action>"
+// to the file and spends tokensPerAction, stored holds the last stored preview.
+type dryRunStubs struct {
+	workspace       *workspacetypes.Workspace
+	tokensPerAction int64
+	executed        []string
+	stored          *workspacetypes.PlanDryRun
+	executeErr      map[string]error
+}
+
+func stubDryRun(t *testing.T, maxFiles string, maxTokens string) *dryRunStubs {
+	t.Setenv("CHARTSMITH_PLAN_DRY_RUN_MAX_FILES", maxFiles)
+	t.Setenv("CHARTSMITH_PLAN_DRY_RUN_MAX_TOKENS", maxTokens)
+	require.NoError(t, param.Init(nil))
+
+	stubs := &dryRunStubs{
+		workspace: &workspacetypes.Workspace{
+			ID:              "ws",
+			CurrentRevision: 2,
+			Charts: []workspacetypes.Chart{{
+				ID: "chart",
+				Files: []workspacetypes.File{
+					{FilePath: "values.yaml", Content: "replicas: 1\n"},
+					{FilePath: "templates/deployment.yaml", Content: "kind: Deployment\n"},
+					{FilePath: "templates/service.yaml", Content: "kind: Service\n"},
+				},
+			}},
+		},
+		tokensPerAction: 10,
+		executeErr:      map[string]error{},
+	}
+
+	originals := []func(){}
+	restore := func(f func()) { originals = append(originals, f) }
+	{
+		original := getDryRunWorkspace
+		restore(func() { getDryRunWorkspace = original })
+	}
+	{
+		original := getDryRunValuesProfile
+		restore(func() { getDryRunValuesProfile = original })
+	}
+	{
+		original := getPlanDryRun
+		restore(func() { getPlanDryRun = original })
+	}
+	{
+		original := setPlanDryRun
+		restore(func() { setPlanDryRun = original })
+	}
+	{
+		original := executeDryRunAction
+		restore(func() { executeDryRunAction = original })
+	}
+	{
+		original := recordUsage
+		restore(func() { recordUsage = original })
+	}
+	t.Cleanup(func() {
+		for _, f := range originals {
+			f()
+		}
+	})
+
+	getDryRunWorkspace = func(ctx context.Context, id string) (*workspacetypes.Workspace, error) {
+		return stubs.workspace, nil
+	}
+	getDryRunValuesProfile = func(ctx context.Context, workspaceID string, chartID string, name string) (*workspacetypes.ValuesProfile, error) {
+		if name == "staging" {
+			return &workspacetypes.ValuesProfile{Name: name, Content: "replicas: 2\n"}, nil
+		}
+		return nil, workspace.ErrValuesProfileNotFound
+	}
+	getPlanDryRun = func(ctx context.Context, planID string) (*workspacetypes.PlanDryRun, error) {
+		return stubs.stored, nil
+	}
+	setPlanDryRun = func(ctx context.Context, planID string, dryRun workspacetypes.PlanDryRun) error {
+		stubs.stored = &dryRun
+		return nil
+	}
+	executeDryRunAction = func(ctx context.Context, action types.ActionPlanWithPath, plan *workspacetypes.Plan, currentContent string, interimContentCh chan types.InterimContent) (string, error) {
+		stubs.executed = append(stubs.executed, action.Path)
+		recordLLMUsage(ctx, OperationExecute, "model", stubs.tokensPerAction, 0)
+		if err := stubs.executeErr[action.Path]; err != nil {
+			return "", err
+		}
+		return currentContent + "# " + action.Action + "\n", nil
+	}
+	recordUsage = func(ctx context.Context, usage workspacetypes.LLMUsage) error { return nil }
+
+	return stubs
+}
+
+func reviewFilesPlan(paths ...string) *workspacetypes.Plan {
+	plan := &workspacetypes.Plan{ID: "plan", WorkspaceID: "ws", Status: workspacetypes.PlanStatusReviewFiles, Description: "tidy the chart"}
+	for _, path := range paths {
+		plan.ActionFiles = append(plan.ActionFiles, workspacetypes.ActionFile{ChartID: "chart", Path: path, Action: "update " + path, Status: "pending"})
+	}
+	return plan
+}
+
+func TestDryRunPlan(t *testing.T) {
+	stubs := stubDryRun(t, "", "")
+	plan := reviewFilesPlan("values.yaml", "templates/ingress.yaml", "values.yaml", "values-staging.yaml")
+
+	dryRun, err := DryRunPlan(context.Background(), plan)
+	require.NoError(t, err)
+
+	assert.True(t, dryRun.Complete)
+	assert.False(t, dryRun.Cached)
+	assert.Equal(t, 2, dryRun.RevisionNumber)
+	assert.Equal(t, 4, dryRun.Actions)
+	assert.Equal(t, int64(40), dryRun.InputTokens)
+	require.Len(t, dryRun.Files, 3)
+
+	// a second action on a file is executed on the result of the first
+	assert.Equal(t, "values.yaml", dryRun.Files[0].Path)
+	assert.Equal(t, "replicas: 1\n# update values.yaml\n# update values.yaml\n", dryRun.Files[0].Content)
+	require.NotNil(t, dryRun.Files[0].Diff)
+	assert.Equal(t, 2, dryRun.Files[0].Diff.LinesAdded)
+	assert.Equal(t, "chart", dryRun.Files[0].Diff.ChartID)
+
+	assert.Equal(t, "templates/ingress.yaml", dryRun.Files[1].Path)
+	assert.Equal(t, "# update templates/ingress.yaml\n", dryRun.Files[1].Content)
+	require.NotNil(t, dryRun.Files[1].Diff)
+	assert.Contains(t, dryRun.Files[1].Diff.Diff, "@@ -0,0 +1 @@")
+
+	// a values profile is previewed from its content
+	assert.Equal(t, "replicas: 2\n# update values-staging.yaml\n", dryRun.Files[2].Content)
+
+	// nothing in the workspace changes, the preview is stored on the plan
+	assert.Equal(t, "replicas: 1\n", stubs.workspace.Charts[0].Files[0].Content)
+	require.NotNil(t, stubs.stored)
+	assert.Equal(t, dryRun.Fingerprint, stubs.stored.Fingerprint)
+	assert.Equal(t, workspacetypes.PlanStatusReviewFiles, plan.Status)
+	for _, actionFile := range plan.ActionFiles {
+		assert.Equal(t, "pending", actionFile.Status)
+	}
+}
+
+func TestDryRunPlanBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxFiles  string
+		maxTokens string
+		paths     []string
+		wantFiles []string
+	}{
+		{
+			name:      "file limit",
+			maxFiles:  "2",
+			paths:     []string{"values.yaml", "templates/deployment.yaml", "values.yaml", "templates/service.yaml"},
+			wantFiles: []string{"values.yaml", "templates/deployment.yaml"},
+		},
+		{
+			name:      "token limit stops after the action that crosses it",
+			maxTokens: "15",
+			paths:     []string{"values.yaml", "templates/deployment.yaml", "templates/service.yaml"},
+			wantFiles: []string{"values.yaml", "templates/deployment.yaml"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubs := stubDryRun(t, tt.maxFiles, tt.maxTokens)
+
+			dryRun, err := DryRunPlan(context.Background(), reviewFilesPlan(tt.paths...))
+			require.NoError(t, err)
+
+			assert.False(t, dryRun.Complete)
+			paths := []string{}
+			for _, file := range dryRun.Files {
+				paths = append(paths, file.Path)
+			}
+			assert.Equal(t, tt.wantFiles, paths)
+			assert.Equal(t, int64(10*len(stubs.executed)), dryRun.InputTokens)
+		})
+	}
+}
+
+func TestDryRunPlanCached(t *testing.T) {
+	stubs := stubDryRun(t, "", "")
+	plan := reviewFilesPlan("values.yaml")
+
+	first, err := DryRunPlan(context.Background(), plan)
+	require.NoError(t, err)
+	require.Len(t, stubs.executed, 1)
+
+	second, err := DryRunPlan(context.Background(), plan)
+	require.NoError(t, err)
+	assert.True(t, second.Cached)
+	assert.Equal(t, first.Files, second.Files)
+	assert.Len(t, stubs.executed, 1, "a cached preview doesn't execute actions again")
+
+	t.Run("a change to a file previews again", func(t *testing.T) {
+		stubs.workspace.Charts[0].Files[1].Content = "kind: StatefulSet\n"
+
+		third, err := DryRunPlan(context.Background(), plan)
+		require.NoError(t, err)
+		assert.False(t, third.Cached)
+		assert.Len(t, stubs.executed, 2)
+	})
+
+	t.Run("a review previews again", func(t *testing.T) {
+		plan.ActionFiles[0].Review = workspacetypes.ActionFileReviewApproved
+
+		fourth, err := DryRunPlan(context.Background(), plan)
+		require.NoError(t, err)
+		assert.False(t, fourth.Cached)
+		assert.Len(t, stubs.executed, 3)
+	})
+}
+
+func TestDryRunPlanErrors(t *testing.T) {
+	t.Run("failed action is reported on its file", func(t *testing.T) {
+		stubs := stubDryRun(t, "", "")
+		stubs.executeErr["templates/service.yaml"] = errors.New("no tool use in response")
+
+		dryRun, err := DryRunPlan(context.Background(), reviewFilesPlan("templates/service.yaml", "values.yaml"))
+		require.NoError(t, err)
+		require.Len(t, dryRun.Files, 2)
+		assert.Equal(t, "no tool use in response", dryRun.Files[0].Error)
+		assert.Equal(t, "kind: Service\n", dryRun.Files[0].Content)
+		assert.Nil(t, dryRun.Files[0].Diff)
+		assert.Empty(t, dryRun.Files[1].Error)
+	})
+
+	t.Run("open circuit fails the preview", func(t *testing.T) {
+		stubs := stubDryRun(t, "", "")
+		stubs.executeErr["values.yaml"] = fmt.Errorf("failed to call anthropic: %w", circuitbreaker.ErrOpen)
+
+		_, err := DryRunPlan(context.Background(), reviewFilesPlan("values.yaml", "templates/service.yaml"))
+		assert.ErrorIs(t, err, circuitbreaker.ErrOpen)
+		assert.Equal(t, []string{"values.yaml"}, stubs.executed)
+		assert.Nil(t, stubs.stored)
+	})
+
+	t.Run("applied plan", func(t *testing.T) {
+		stubs := stubDryRun(t, "", "")
+		plan := reviewFilesPlan("values.yaml")
+		plan.Status = workspacetypes.PlanStatusApplied
+
+		_, err := DryRunPlan(context.Background(), plan)
+		assert.ErrorIs(t, err, workspace.ErrPlanNotPreviewable)
+		assert.Empty(t, stubs.executed)
+	})
+
+	t.Run("invalid budget", func(t *testing.T) {
+		stubDryRun(t, "none", "")
+
+		_, err := DryRunPlan(context.Background(), reviewFilesPlan("values.yaml"))
+		assert.ErrorContains(t, err, "CHARTSMITH_PLAN_DRY_RUN_MAX_FILES")
+	})
+}
+
+func TestDryRunPlanDetailsActions(t *testing.T) {
+	stubs := stubDryRun(t, "", "")
+
+	originalChoose, originalCreate := chooseDryRunFiles, createDryRunExecutePlan
+	t.Cleanup(func() { chooseDryRunFiles, createDryRunExecutePlan = originalChoose, originalCreate })
+	chooseDryRunFiles = func(ctx context.Context, w *workspacetypes.Workspace, description string) ([]workspacetypes.File, error) {
+		return w.Charts[0].Files[:1], nil
+	}
+	createDryRunExecutePlan = func(ctx context.Context, actionCh chan types.ActionPlanWithPath, skippedCh chan types.SkippedActionPlan, streamCh chan string, doneCh chan error, w *workspacetypes.Workspace, plan *workspacetypes.Plan, c *workspacetypes.Chart, relevantFiles []workspacetypes.File) error {
+		streamCh <- "planning"
+		for _, path := range []string{"values.yaml", "templates/configmap.yaml"} {
+			actionCh <- types.ActionPlanWithPath{ActionPlan: types.ActionPlan{Action: "create " + path}, Path: path, ChartID: c.ID}
+		}
+		doneCh <- nil
+		return nil
+	}
+
+	plan := &workspacetypes.Plan{ID: "plan", WorkspaceID: "ws", Status: workspacetypes.PlanStatusReview, Description: "add a configmap"}
+	dryRun, err := DryRunPlan(context.Background(), plan)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"values.yaml", "templates/configmap.yaml"}, stubs.executed)
+	assert.Equal(t, 2, dryRun.Actions)
+	assert.True(t, strings.HasSuffix(dryRun.Files[1].Content, "# create templates/configmap.yaml\n"))
+	assert.Empty(t, plan.ActionFiles, "the detailed actions aren't stored on the plan")
+}
+
+func TestPlanDryRunBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxFiles  string
+		maxTokens string
+		want      PlanDryRunBudget
+		wantErr   string
+	}{
+		{name: "defaults", want: PlanDryRunBudget{MaxFiles: DefaultPlanDryRunMaxFiles, MaxTokens: DefaultPlanDryRunMaxTokens}},
+		{name: "configured", maxFiles: "3", maxTokens: "50000", want: PlanDryRunBudget{MaxFiles: 3, MaxTokens: 50000}},
+		{name: "zero files", maxFiles: "0", wantErr: "CHARTSMITH_PLAN_DRY_RUN_MAX_FILES"},
+		{name: "negative tokens", maxTokens: "-1", wantErr: "CHARTSMITH_PLAN_DRY_RUN_MAX_TOKENS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget, err := planDryRunBudget(tt.maxFiles, tt.maxTokens)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, budget)
+		})
+	}
+}
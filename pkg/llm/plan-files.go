@@ -0,0 +1,184 @@
+package llm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/replicatedhq/chartsmith/pkg/yamlpatch"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// planFilesTokenBudget is the estimated number of tokens of chart files given to the planner
+	// before large YAML files are replaced by a digest of their structure
+	planFilesTokenBudget = 40000
+
+	// planFileDigestMinTokens is the size under which a file is never digested, a digest of a small
+	// file saves little and loses every value
+	planFileDigestMinTokens = 1000
+
+	// planFileDigestDepth is how many levels of keys a digest lists
+	planFileDigestDepth = 3
+
+	// planFileDigestPreviewLength is the most characters of a value a digest shows
+	planFileDigestPreviewLength = 40
+
+	// promptKeyMinSquashedLength is the shortest key that's found in a prompt written without
+	// its separators, podDisruptionBudget in "pod disruption budget", shorter keys match too often
+	promptKeyMinSquashedLength = 6
+)
+
+// budgetedPlanFile is a file as it's given to the planner
+type budgetedPlanFile struct {
+	workspacetypes.File
+	// Note says how the content was cut down to fit the budget, it's empty when the file is whole
+	Note string
+}
+
+// budgetPlanFiles fits the content of files in tokenBudget. When they're over it, the largest YAML
+// files are replaced by a digest of their keys, largest first, until they fit. The digest of a
+// values.yaml keeps the sections of the top level keys the prompt names verbatim. Files that still
+// don't fit are truncated, like attachments.
+func budgetPlanFiles(files []workspacetypes.File, prompt string, tokenBudget int) []budgetedPlanFile {
+	budgeted := make([]budgetedPlanFile, 0, len(files))
+	total := 0
+	for _, file := range files {
+		budgeted = append(budgeted, budgetedPlanFile{File: file})
+		total += EstimateTokens(file.Content)
+	}
+	if total <= tokenBudget {
+		return budgeted
+	}
+
+	candidates := []int{}
+	for i, file := range files {
+		ext := path.Ext(file.FilePath)
+		if (ext == ".yaml" || ext == ".yml") && EstimateTokens(file.Content) >= planFileDigestMinTokens {
+			candidates = append(candidates, i)
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return len(files[candidates[a]].Content) > len(files[candidates[b]].Content)
+	})
+
+	for _, i := range candidates {
+		if total <= tokenBudget {
+			break
+		}
+
+		file := files[i]
+		verbatim := []string{}
+		if path.Base(file.FilePath) == "values.yaml" {
+			verbatim = promptReferencedKeys(file.Content, prompt)
+		}
+		digest, depth := digestPlanFile(file.Content, verbatim, tokenBudget-total+EstimateTokens(file.Content))
+		if digest == "" {
+			continue
+		}
+
+		note := fmt.Sprintf("%s has %d characters, too many for the prompt. This is a digest of its keys to depth %d with the type and a preview of each value, not its content.", file.FilePath, len(file.Content), depth)
+		if len(verbatim) > 0 {
+			note += fmt.Sprintf(" The sections under %s are complete.", strings.Join(verbatim, ", "))
+		}
+
+		total += EstimateTokens(digest) - EstimateTokens(file.Content)
+		budgeted[i].Content = digest
+		budgeted[i].Note = note
+	}
+	if total <= tokenBudget {
+		return budgeted
+	}
+
+	current := make([]workspacetypes.File, 0, len(budgeted))
+	for _, file := range budgeted {
+		current = append(current, file.File)
+	}
+	for i, file := range budgetFileContents(current, tokenBudget) {
+		if file.Content == budgeted[i].Content {
+			continue
+		}
+		budgeted[i].Content = file.Content
+		if budgeted[i].Note == "" {
+			budgeted[i].Note = fmt.Sprintf("%s was truncated from %d characters to fit in the prompt.", file.FilePath, len(files[i].Content))
+		} else {
+			budgeted[i].Note += " The digest was truncated too."
+		}
+	}
+
+	return budgeted
+}
+
+// digestPlanFile returns the deepest digest of a YAML file that fits in tokenBudget, down to a
+// depth of 1, or the shallowest when none fit. It returns an empty digest when the file doesn't
+// parse, templates aren't YAML until they're rendered, or when no digest is smaller than the file.
+func digestPlanFile(content string, verbatim []string, tokenBudget int) (string, int) {
+	for depth := planFileDigestDepth; depth >= 1; depth-- {
+		digest, err := yamlpatch.Digest(content, yamlpatch.DigestOpts{
+			Depth:         depth,
+			PreviewLength: planFileDigestPreviewLength,
+			Verbatim:      verbatim,
+		})
+		if err != nil {
+			return "", 0
+		}
+		if EstimateTokens(digest) <= tokenBudget || (depth == 1 && len(digest) < len(content)) {
+			return digest, depth
+		}
+	}
+	return "", 0
+}
+
+// nonAlphanumeric matches what's left out of keys and prompts to compare them without separators
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+// promptReferencedKeys returns the top level keys of a YAML document that a prompt names, either as
+// a word ("ingress") or, for longer keys, written out ("pod disruption budget"). The keys are in
+// the order of the document.
+func promptReferencedKeys(content string, prompt string) []string {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return []string{}
+	}
+
+	lowerPrompt := strings.ToLower(prompt)
+	squashedPrompt := nonAlphanumeric.ReplaceAllString(lowerPrompt, "")
+
+	keys := []string{}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i].Value
+		lowerKey := strings.ToLower(key)
+		if lowerKey == "" {
+			continue
+		}
+
+		word := regexp.MustCompile(`(^|[^a-z0-9])` + regexp.QuoteMeta(lowerKey) + `([^a-z0-9]|$)`)
+		squashedKey := nonAlphanumeric.ReplaceAllString(lowerKey, "")
+		if word.MatchString(lowerPrompt) || (len(squashedKey) >= promptKeyMinSquashedLength && strings.Contains(squashedPrompt, squashedKey)) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// formatPlanFile writes a file the way the planner is given it, with the note on how it was cut
+// down after its content
+func formatPlanFile(filePath string, file budgetedPlanFile) string {
+	text := fmt.Sprintf(`File: %s, Content: %s`, filePath, file.Content)
+	if file.Note != "" {
+		text += fmt.Sprintf("\n(%s)", file.Note)
+	}
+	return text
+}
+
+// latestPrompt is the prompt of the last of chatMessages, what the plan is for
+func latestPrompt(chatMessages []workspacetypes.Chat) string {
+	if len(chatMessages) == 0 {
+		return ""
+	}
+	return chatMessages[len(chatMessages)-1].Prompt
+}
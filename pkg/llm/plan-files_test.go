@@ -0,0 +1,97 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// largeValues is a values.yaml of about 50KB, like the ones of charts with many components
+func largeValues() string {
+	var sb strings.Builder
+	sb.WriteString("ingress:\n  enabled: false\n  className: nginx\n  tls: []\npodDisruptionBudget:\n  enabled: false\n  minAvailable: 1\n")
+	for i := 0; i < 120; i++ {
+		fmt.Fprintf(&sb, "component%d:\n  enabled: true\n  image:\n    repository: registry.example.com/component-%d\n    tag: 1.2.%d\n  resources:\n    limits:\n      cpu: 500m\n      memory: 512Mi\n  env:\n    - name: LOG_LEVEL\n      value: debug\n  config:\n    banner: %s\n", i, i, i, strings.Repeat("welcome ", 25))
+	}
+	return sb.String()
+}
+
+func TestBudgetPlanFiles(t *testing.T) {
+	values := largeValues()
+	require.Greater(t, len(values), 45000)
+	deployment := workspacetypes.File{FilePath: "templates/deployment.yaml", Content: "kind: Deployment\nspec:\n  replicas: {{ .Values.replicaCount }}\n"}
+	files := []workspacetypes.File{deployment, {FilePath: "values.yaml", Content: values}}
+
+	t.Run("under budget", func(t *testing.T) {
+		budgeted := budgetPlanFiles(files, "enable the ingress", 16000)
+		for i, file := range budgeted {
+			assert.Equal(t, files[i].Content, file.Content)
+			assert.Empty(t, file.Note)
+		}
+	})
+
+	t.Run("values digested", func(t *testing.T) {
+		budgeted := budgetPlanFiles(files, "Enable the Ingress with TLS and add a pod disruption budget", 12000)
+		require.Len(t, budgeted, 2)
+
+		assert.Equal(t, deployment.Content, budgeted[0].Content, "small files are left whole")
+		assert.Empty(t, budgeted[0].Note)
+
+		digest := budgeted[1]
+		assert.Less(t, EstimateTokens(deployment.Content)+EstimateTokens(digest.Content), 12000)
+		assert.True(t, strings.HasPrefix(digest.Content, "ingress:\n  enabled: false\n  className: nginx\n  tls: []\npodDisruptionBudget:\n  enabled: false\n  minAvailable: 1\n"), "the sections the prompt names are verbatim")
+		assert.Contains(t, digest.Content, "component7: map (5 keys)\n  enabled: bool = true\n  image: map (2 keys)\n    repository: string = \"registry.example.com/component-7\"\n")
+		assert.Contains(t, digest.Content, "  env: list (1 item)\n  config: map (1 key)\n    banner: string = \"welcome welcome welcome welcome welcome …\"\n")
+		assert.Contains(t, digest.Note, "values.yaml has 52461 characters")
+		assert.Contains(t, digest.Note, "digest of its keys to depth 3")
+		assert.Contains(t, digest.Note, "The sections under ingress, podDisruptionBudget are complete.")
+
+		formatted := formatPlanFile("mychart/values.yaml", digest)
+		assert.True(t, strings.HasPrefix(formatted, "File: mychart/values.yaml, Content: ingress:"))
+		assert.True(t, strings.HasSuffix(formatted, "\n("+digest.Note+")"))
+	})
+
+	t.Run("shallower digest", func(t *testing.T) {
+		budgeted := budgetPlanFiles(files, "", 6000)
+
+		assert.Less(t, EstimateTokens(budgeted[0].Content)+EstimateTokens(budgeted[1].Content), 6000)
+		assert.Contains(t, budgeted[1].Content, "component7: map (5 keys)\n  enabled: bool = true\n  image: map (2 keys)\n  resources:")
+		assert.Contains(t, budgeted[1].Note, "digest of its keys to depth 2")
+	})
+
+	t.Run("still over budget", func(t *testing.T) {
+		template := workspacetypes.File{FilePath: "templates/configmap.yaml", Content: "data:\n" + strings.Repeat("  {{- include \"config\" . }}\n", 500)}
+		budgeted := budgetPlanFiles([]workspacetypes.File{template, {FilePath: "values.yaml", Content: values}}, "", 1000)
+
+		assert.Contains(t, budgeted[0].Note, "templates/configmap.yaml was truncated from", "templates don't parse as YAML, they're truncated")
+		assert.Contains(t, budgeted[1].Note, "The digest was truncated too.")
+		assert.NotContains(t, budgeted[1].Note, "sections under")
+	})
+}
+
+func TestPromptReferencedKeys(t *testing.T) {
+	values := "replicaCount: 1\ningress:\n  enabled: false\nnameOverride: \"\"\npodDisruptionBudget: {}\nserviceAccount: {}\nimage: {}\n"
+
+	tests := []struct {
+		prompt string
+		want   []string
+	}{
+		{prompt: "add an Ingress", want: []string{"ingress"}},
+		{prompt: "scale to 3 replicas", want: []string{}},
+		{prompt: "set replicaCount to 3 and add a pod disruption budget", want: []string{"replicaCount", "podDisruptionBudget"}},
+		{prompt: "use a service account named app", want: []string{"serviceAccount"}},
+		{prompt: "imagePullSecrets for the registry", want: []string{}},
+		{prompt: "", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			assert.Equal(t, tt.want, promptReferencedKeys(values, tt.prompt))
+		})
+	}
+
+	assert.Empty(t, promptReferencedKeys("{{ .Values }}: [", "values"))
+}
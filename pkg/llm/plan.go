@@ -3,19 +3,37 @@ package llm
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 
 	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/recommendations"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
 	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"go.uber.org/zap"
 )
 
+var valuesCleanupRegex = regexp.MustCompile(`(?i)\b(clean\s*-?\s*up|tidy|prune|unused|dead)\b.{0,30}\bvalues\b|\bvalues\b.{0,30}\b(clean\s*-?\s*up|tidy|prune|unused|dead)\b`)
+
+var dependencyUpgradeRegex = regexp.MustCompile(`(?i)\b(upgrade|update|bump|outdated|latest|newer)\b.{0,40}\b(dependenc(y|ies)|subcharts?)\b|\b(dependenc(y|ies)|subcharts?)\b.{0,40}\b(upgrade|update|bump|outdated|latest|newer)\b`)
+
+var refactorRegex = regexp.MustCompile(`(?i)\b(clean\s*-?\s*up|refactor(ing)?|dedupe|de-?duplicate|duplicat(e|es|ed|ion)|consolidate|simplify)\b`)
+
 type CreatePlanOpts struct {
-	ChatMessages  []workspacetypes.Chat
-	Chart         *workspacetypes.Chart
-	RelevantFiles []workspacetypes.File
-	IsUpdate      bool
+	ChatMessages        []workspacetypes.Chat
+	ConversationSummary string                    // summary of the chat messages before ChatMessages, see CondenseConversation
+	Workspace           *workspacetypes.Workspace // when set, plans across every chart in the workspace
+	Chart               *workspacetypes.Chart
+	RelevantFiles       []workspacetypes.File
+	IsUpdate            bool
+	// RecentChanges is how files changed in the current revision, so that an update plan doesn't
+	// suggest what was just done, see workspace.DiffFilesWithParentRevision
+	RecentChanges []workspacetypes.FileDiff
+	// AdditionalFiles are files the user attached to the messages the plan is for, like
+	// CreateInitialPlanOpts.AdditionalFiles
+	AdditionalFiles []workspacetypes.File
 }
 
 func CreatePlan(ctx context.Context, streamCh chan string, doneCh chan error, opts CreatePlanOpts) error {
@@ -34,41 +52,12 @@ func CreatePlan(ctx context.Context, streamCh chan string, doneCh chan error, op
 		return fmt.Errorf("failed to create anthropic client: %w", err)
 	}
 
-	chartStructure, err := getChartStructure(ctx, opts.Chart)
+	chartStructure, err := getPlanStructure(ctx, opts.Workspace, opts.Chart)
 	if err != nil {
 		return fmt.Errorf("failed to get chart structure: %w", err)
 	}
 
-	messages := []anthropic.MessageParam{}
-
-	if !opts.IsUpdate {
-		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(initialPlanSystemPrompt)))
-		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(initialPlanInstructions)))
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`Chart structure: %s`, chartStructure))))
-
-	} else {
-		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(updatePlanSystemPrompt)))
-		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(updatePlanInstructions)))
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`Chart structure: %s`, chartStructure))))
-		for _, file := range opts.RelevantFiles {
-			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`File: %s, Content: %s`, file.FilePath, file.Content))))
-		}
-	}
-
-	for _, chatMessage := range opts.ChatMessages {
-		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(chatMessage.Prompt)))
-		if chatMessage.Response != "" {
-			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(chatMessage.Response)))
-		}
-	}
-
-	verb := "create"
-	if opts.IsUpdate {
-		verb = "edit"
-	}
-	initialUserMessage := fmt.Sprintf("Describe the plan only (do not write code) to %s a helm chart based on the previous discussion. ", verb)
-
-	messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(initialUserMessage)))
+	ctx, messages := planMessages(ctx, opts, chartStructure)
 
 	// tools := []anthropic.ToolParam{
 	// 	{
@@ -87,12 +76,17 @@ func CreatePlan(ctx context.Context, streamCh chan string, doneCh chan error, op
 	// 	},
 	// }
 
-	stream := client.Messages.NewStreaming(context.TODO(), anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationPlan)),
 		MaxTokens: anthropic.F(int64(8192)),
 		// Tools:     anthropic.F(tools),
 		Messages: anthropic.F(messages),
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return err
+	}
+
+	stream := client.Messages.NewStreaming(ctx, params)
 
 	message := anthropic.Message{}
 	for stream.Next() {
@@ -102,15 +96,279 @@ func CreatePlan(ctx context.Context, streamCh chan string, doneCh chan error, op
 		switch delta := event.Delta.(type) {
 		case anthropic.ContentBlockDeltaEventDelta:
 			if delta.Text != "" {
-				streamCh <- delta.Text
+				if err := sendContext(ctx, streamCh, delta.Text); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
-	if stream.Err() != nil {
-		doneCh <- stream.Err()
+	if err := stream.Err(); err != nil {
+		return sendContext(ctx, doneCh, err)
 	}
+	recordAnthropicUsage(ctx, OperationPlan, &message)
 
-	doneCh <- nil
+	if err := sendContext(ctx, doneCh, nil); err != nil {
+		return err
+	}
 	return nil
 }
+
+// planMessages returns the messages that ask for a plan, starting with the instructions and the
+// chart, then the conversation, and a context that records the prompts they were given
+func planMessages(ctx context.Context, opts CreatePlanOpts, chartStructure string) (context.Context, []anthropic.MessageParam) {
+	messages := []anthropic.MessageParam{}
+
+	var conventionMessages []anthropic.MessageParam
+	if opts.Workspace != nil {
+		var conventions userConventions
+		conventionMessages, conventions = userConventionsMessages(ctx, opts.Workspace.ID)
+		recordUserConventions(ctx, opts.Workspace.ID, "plan", conventions)
+	}
+
+	if !opts.IsUpdate {
+		var systemPrompt, instructions string
+		ctx, systemPrompt = withPrompt(ctx, promptInitialPlanSystem)
+		ctx, instructions = withPrompt(ctx, promptInitialPlanInstructions)
+		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)))
+		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(instructions)))
+		messages = append(messages, integrationPlanMessages(ctx, opts.Workspace)...)
+		messages = append(messages, valuesProfileMessages(ctx, opts.Workspace)...)
+		messages = append(messages, conventionMessages...)
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`Chart structure: %s`, chartStructure))))
+
+	} else {
+		var systemPrompt, instructions string
+		ctx, systemPrompt = withPrompt(ctx, promptUpdatePlanSystem)
+		ctx, instructions = withPrompt(ctx, promptUpdatePlanInstructions)
+		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(systemPrompt)))
+		messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(instructions)))
+		messages = append(messages, integrationPlanMessages(ctx, opts.Workspace)...)
+		messages = append(messages, valuesProfileMessages(ctx, opts.Workspace)...)
+		messages = append(messages, conventionMessages...)
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(`Chart structure: %s`, chartStructure))))
+		for _, file := range budgetPlanFiles(opts.RelevantFiles, latestPrompt(opts.ChatMessages), planFilesTokenBudget) {
+			if file.Note != "" {
+				logger.InfoCtx(ctx, "Cut down a file to fit the plan prompt", zap.String("path", file.FilePath), zap.String("note", file.Note))
+			}
+			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(formatPlanFile(planFilePath(opts.Workspace, file.File), file))))
+		}
+		messages = append(messages, recentChangesMessages(opts)...)
+		if len(opts.ChatMessages) > 0 && isValuesCleanupRequest(opts.ChatMessages[len(opts.ChatMessages)-1].Prompt) {
+			messages = append(messages, valuesAnalysisMessages(opts)...)
+		}
+		if len(opts.ChatMessages) > 0 && isDependencyUpgradeRequest(opts.ChatMessages[len(opts.ChatMessages)-1].Prompt) {
+			messages = append(messages, dependencyStatusMessages(ctx, opts)...)
+		}
+		if len(opts.ChatMessages) > 0 && isRefactorRequest(opts.ChatMessages[len(opts.ChatMessages)-1].Prompt) {
+			messages = append(messages, duplicateFilesMessages(ctx, opts)...)
+		}
+	}
+
+	conversation := Conversation{Summary: opts.ConversationSummary, Messages: opts.ChatMessages}
+	messages = append(messages, conversation.MessageParams()...)
+	messages = append(messages, additionalFilesMessages(opts.AdditionalFiles)...)
+
+	verb := "create"
+	if opts.IsUpdate {
+		verb = "edit"
+	}
+	initialUserMessage := fmt.Sprintf("Describe the plan only (do not write code) to %s a helm chart based on the previous discussion. ", verb)
+
+	messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(initialUserMessage)))
+	return ctx, messages
+}
+
+// recentChangesMessages shows the planner the diffs of the current revision, between markers so
+// that they aren't mistaken for changes to make
+func recentChangesMessages(opts CreatePlanOpts) []anthropic.MessageParam {
+	if len(opts.RecentChanges) == 0 {
+		return nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString("These changes were already made in the current revision of the chart. Don't plan them again, build on them.\n")
+	sb.WriteString("=== BEGIN RECENT CHANGES ===\n")
+	for _, change := range opts.RecentChanges {
+		path := change.FilePath
+		if opts.Workspace != nil {
+			path = planFilePath(opts.Workspace, workspacetypes.File{FilePath: change.FilePath, ChartID: change.ChartID})
+		}
+		fmt.Fprintf(&sb, "File: %s (+%d -%d)\n%s", path, change.LinesAdded, change.LinesRemoved, change.Diff)
+		if change.Truncated {
+			sb.WriteString("... (diff truncated)\n")
+		}
+	}
+	sb.WriteString("=== END RECENT CHANGES ===")
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(sb.String()))}
+}
+
+// integrationPlanMessages returns the planner instructions of the enabled integrations as a
+// single message, or no messages when no integration has any
+func integrationPlanMessages(ctx context.Context, w *workspacetypes.Workspace) []anthropic.MessageParam {
+	instructions := integrations.PlanContext(ctx, w)
+	if len(instructions) == 0 {
+		return nil
+	}
+
+	text := ""
+	for _, instruction := range instructions {
+		text += fmt.Sprintf("- %s\n", instruction)
+	}
+	return []anthropic.MessageParam{anthropic.NewAssistantMessage(anthropic.NewTextBlock(text))}
+}
+
+// listValuesProfiles is a var so that the plan context can be tested without a database
+var listValuesProfiles = workspace.ListValuesProfiles
+
+// valuesProfileMessages tells the planner about the values profiles of the workspace, so that a
+// plan that changes the structure of values.yaml also updates the profiles layered over it
+func valuesProfileMessages(ctx context.Context, w *workspacetypes.Workspace) []anthropic.MessageParam {
+	if w == nil {
+		return nil
+	}
+
+	profiles, err := listValuesProfiles(ctx, w.ID, "")
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to list values profiles", zap.Error(err))
+		return nil
+	}
+
+	text := formatValuesProfiles(w, profiles)
+	if text == "" {
+		return nil
+	}
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))}
+}
+
+// formatValuesProfiles describes the values profiles of each chart, or returns an empty string if
+// there are none
+func formatValuesProfiles(w *workspacetypes.Workspace, profiles []workspacetypes.ValuesProfile) string {
+	if len(profiles) == 0 {
+		return ""
+	}
+
+	charts := map[string]*workspacetypes.Chart{}
+	for i := range w.Charts {
+		charts[w.Charts[i].ID] = &w.Charts[i]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("The charts have values profiles that are layered over values.yaml when rendering for an environment. ")
+	sb.WriteString("When the plan renames, moves or removes a key in values.yaml, it must also update every profile that sets that key, using the profile path as the file path.\n")
+	for _, profile := range profiles {
+		chart, ok := charts[profile.ChartID]
+		if !ok {
+			continue
+		}
+		path := workspace.ChartScopedPath(w, chart, workspace.ValuesProfileFilename(profile.Name))
+		fmt.Fprintf(&sb, "Profile %s of chart %s:\n%s\n", path, chart.Name, profile.Content)
+	}
+	return sb.String()
+}
+
+// isValuesCleanupRequest returns true if the user is asking to remove values that aren't used
+func isValuesCleanupRequest(prompt string) bool {
+	return valuesCleanupRegex.MatchString(prompt)
+}
+
+// valuesAnalysisMessages gives the planner the static analysis of values usage, so that it doesn't
+// have to work out which keys are unused from the file contents alone
+func valuesAnalysisMessages(opts CreatePlanOpts) []anthropic.MessageParam {
+	charts := []workspacetypes.Chart{}
+	if opts.Workspace != nil {
+		charts = opts.Workspace.Charts
+	} else if opts.Chart != nil {
+		charts = append(charts, *opts.Chart)
+	}
+
+	messages := []anthropic.MessageParam{}
+	for i := range charts {
+		analysis, err := workspace.AnalyzeValuesUsage(&charts[i])
+		if err != nil {
+			logger.Warn("failed to analyze values usage", zap.String("chartID", charts[i].ID), zap.Error(err))
+			continue
+		}
+
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(
+			"Values analysis for chart %s. Only remove keys listed as unused, never keys under an unknown reference:\n%s",
+			charts[i].Name, workspace.FormatValuesAnalysis(analysis)))))
+	}
+
+	return messages
+}
+
+// isDependencyUpgradeRequest returns true if the user is asking about upgrading chart dependencies
+func isDependencyUpgradeRequest(prompt string) bool {
+	return dependencyUpgradeRegex.MatchString(prompt)
+}
+
+// chartDependencyStatus is a var so that the plan context can be tested without a network
+var chartDependencyStatus = workspace.ChartDependencyStatus
+
+// dependencyStatusMessages gives the planner the versions available for each chart dependency, so
+// that it proposes concrete version bumps instead of guessing at the latest versions
+func dependencyStatusMessages(ctx context.Context, opts CreatePlanOpts) []anthropic.MessageParam {
+	charts := []workspacetypes.Chart{}
+	if opts.Workspace != nil {
+		charts = opts.Workspace.Charts
+	} else if opts.Chart != nil {
+		charts = append(charts, *opts.Chart)
+	}
+
+	messages := []anthropic.MessageParam{}
+	for i := range charts {
+		report, err := chartDependencyStatus(ctx, &charts[i])
+		if err != nil {
+			logger.WarnCtx(ctx, "failed to check chart dependencies", zap.String("chartID", charts[i].ID), zap.Error(err))
+			continue
+		}
+		if len(report.Dependencies) == 0 {
+			continue
+		}
+
+		messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(
+			"Dependency status for chart %s. When upgrading, set the version in Chart.yaml to the latest version listed here, and call out major version bumps as possibly breaking:\n%s",
+			charts[i].Name, recommendations.FormatDependencyReport(report)))))
+	}
+
+	return messages
+}
+
+// isRefactorRequest returns true if the user is asking to clean up or refactor the chart
+func isRefactorRequest(prompt string) bool {
+	return refactorRegex.MatchString(prompt)
+}
+
+// findDuplicateFiles is a var so that the plan context can be tested without a database
+var findDuplicateFiles = workspace.FindDuplicateFiles
+
+// duplicateFilesMessages gives the planner the files that are suspected to be copies of each other,
+// so that a cleanup can merge them into a shared template instead of editing each copy
+func duplicateFilesMessages(ctx context.Context, opts CreatePlanOpts) []anthropic.MessageParam {
+	if opts.Workspace == nil {
+		return nil
+	}
+
+	report, err := findDuplicateFiles(ctx, opts.Workspace.ID, opts.Workspace.CurrentRevision)
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to find duplicate files", zap.String("workspaceID", opts.Workspace.ID), zap.Error(err))
+		return nil
+	}
+	if len(report.Groups) == 0 {
+		return nil
+	}
+
+	chartNames := map[string]string{}
+	for _, chart := range opts.Workspace.Charts {
+		chartNames[chart.ID] = chart.Name
+	}
+
+	var sb strings.Builder
+	for _, group := range report.Groups {
+		fmt.Fprintf(&sb, "- chart %s: %s (at least %.0f%% similar)\n", chartNames[group.ChartID], strings.Join(group.FilePaths, ", "), group.Similarity*100)
+	}
+
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(
+		"These files are suspected duplicates of each other. Consider moving what they share into a helper in _helpers.tpl or a single template driven by values, and check that they really are copies before merging them:\n" + sb.String()))}
+}
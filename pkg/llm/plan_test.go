@@ -0,0 +1,278 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
+	"github.com/replicatedhq/chartsmith/pkg/integrations/replicated"
+	"github.com/replicatedhq/chartsmith/pkg/recommendations"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValuesCleanupRequest(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   bool
+	}{
+		{prompt: "clean up values", want: true},
+		{prompt: "Can you cleanup the values.yaml file?", want: true},
+		{prompt: "remove unused values", want: true},
+		{prompt: "are there any values that are dead?", want: true},
+		{prompt: "add a value for the replica count", want: false},
+		{prompt: "clean up the deployment template", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			assert.Equal(t, tt.want, isValuesCleanupRequest(tt.prompt))
+		})
+	}
+}
+
+func TestIsRefactorRequest(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   bool
+	}{
+		{prompt: "clean up the deployment template", want: true},
+		{prompt: "refactor the chart", want: true},
+		{prompt: "are any of the templates duplicated?", want: true},
+		{prompt: "consolidate the api and worker deployments", want: true},
+		{prompt: "do a dry run of the upgrade", want: false},
+		{prompt: "add an ingress", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			assert.Equal(t, tt.want, isRefactorRequest(tt.prompt))
+		})
+	}
+}
+
+func TestIsDependencyUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		prompt string
+		want   bool
+	}{
+		{prompt: "upgrade the dependencies", want: true},
+		{prompt: "Are any of my subcharts outdated?", want: true},
+		{prompt: "bump the redis dependency to the latest version", want: true},
+		{prompt: "add a dependency on postgresql", want: false},
+		{prompt: "update the service port", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			assert.Equal(t, tt.want, isDependencyUpgradeRequest(tt.prompt))
+		})
+	}
+}
+
+func TestPlanMessagesDependencyStatus(t *testing.T) {
+	stubUserConventions(t, nil)
+	originalProfiles, originalStatus := listValuesProfiles, chartDependencyStatus
+	t.Cleanup(func() { listValuesProfiles, chartDependencyStatus = originalProfiles, originalStatus })
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+	chartDependencyStatus = func(ctx context.Context, c *workspacetypes.Chart) (*recommendations.DependencyReport, error) {
+		if c.ID != "chart-backend" {
+			return &recommendations.DependencyReport{Dependencies: []recommendations.DependencyStatus{}}, nil
+		}
+		return &recommendations.DependencyReport{Dependencies: []recommendations.DependencyStatus{
+			{Name: "redis", Version: "17.0.0", Repository: "https://charts.example.com", Current: "17.0.0", Latest: "18.1.0", Status: recommendations.DependencyMajorBehind},
+			{Name: "nginx", Version: "15.0.0", Repository: "oci://registry.example.com/charts", Status: recommendations.DependencyNotChecked, Reason: "OCI registries are not checked"},
+		}}, nil
+	}
+
+	w := twoChartPlanWorkspace()
+	opts := CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "upgrade the dependencies"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		IsUpdate:     true,
+	}
+	promptText := func(opts CreatePlanOpts) string {
+		_, messages := planMessages(context.Background(), opts, "File: Chart.yaml")
+		b, err := json.Marshal(messages)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	text := promptText(opts)
+	assert.Contains(t, text, "Dependency status for chart backend")
+	assert.Contains(t, text, "- redis 17.0.0 from https://charts.example.com: resolves to 17.0.0, latest is 18.1.0 (major version behind)")
+	assert.Contains(t, text, "- nginx 15.0.0 from oci://registry.example.com/charts: not checked (OCI registries are not checked)")
+	assert.Equal(t, 1, strings.Count(text, "Dependency status for chart"))
+
+	opts.ChatMessages = []workspacetypes.Chat{{Prompt: "add an ingress"}}
+	assert.NotContains(t, promptText(opts), "Dependency status")
+}
+
+func TestPlanMessagesDuplicateFiles(t *testing.T) {
+	stubUserConventions(t, nil)
+	originalProfiles, originalDuplicates := listValuesProfiles, findDuplicateFiles
+	t.Cleanup(func() { listValuesProfiles, findDuplicateFiles = originalProfiles, originalDuplicates })
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+	findDuplicateFiles = func(ctx context.Context, workspaceID string, revisionNumber int) (*workspacetypes.DuplicateReport, error) {
+		assert.Equal(t, "workspace", workspaceID)
+		return &workspacetypes.DuplicateReport{Groups: []workspacetypes.DuplicateFileGroup{
+			{ChartID: "chart-backend", FilePaths: []string{"templates/api.yaml", "templates/worker.yaml"}, Similarity: 0.954},
+		}}, nil
+	}
+
+	w := twoChartPlanWorkspace()
+	opts := CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "refactor the deployments"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		IsUpdate:     true,
+	}
+	promptText := func(opts CreatePlanOpts) string {
+		_, messages := planMessages(context.Background(), opts, "File: Chart.yaml")
+		b, err := json.Marshal(messages)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	text := promptText(opts)
+	assert.Contains(t, text, "suspected duplicates")
+	assert.Contains(t, text, "- chart backend: templates/api.yaml, templates/worker.yaml (at least 95% similar)")
+
+	opts.ChatMessages = []workspacetypes.Chat{{Prompt: "add an ingress"}}
+	assert.NotContains(t, promptText(opts), "suspected duplicates")
+}
+
+func TestIntegrationPlanMessages(t *testing.T) {
+	if !slices.Contains(integrations.Registered(), replicated.Name) {
+		integrations.Register(replicated.New())
+	}
+	t.Cleanup(func() { require.NoError(t, integrations.Enable(nil)) })
+
+	promptText := func() string {
+		b, err := json.Marshal(integrationPlanMessages(context.Background(), nil))
+		require.NoError(t, err)
+		return strings.ToLower(string(b))
+	}
+
+	require.NoError(t, integrations.Enable([]string{replicated.Name}))
+	assert.Contains(t, promptText(), "replicated")
+
+	require.NoError(t, integrations.Enable(nil))
+	assert.Empty(t, integrationPlanMessages(context.Background(), nil))
+	assert.NotContains(t, promptText(), "replicated")
+	assert.NotContains(t, strings.ToLower(initialPlanInstructions+updatePlanInstructions+commonSystemPrompt+initialPlanSystemSection+updatePlanSystemSection), "replicated")
+}
+
+func TestValuesProfileMessages(t *testing.T) {
+	original := listValuesProfiles
+	t.Cleanup(func() { listValuesProfiles = original })
+
+	w := &workspacetypes.Workspace{ID: "ws", Charts: []workspacetypes.Chart{{ID: "c1", Name: "app"}}}
+
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+	assert.Empty(t, valuesProfileMessages(context.Background(), w))
+	assert.Empty(t, valuesProfileMessages(context.Background(), nil))
+
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return []workspacetypes.ValuesProfile{
+			{ChartID: "c1", Name: "prod", Content: "resources:\n  limits:\n    cpu: 500m\n"},
+			{ChartID: "deleted-chart", Name: "dev", Content: "debug: true\n"},
+		}, nil
+	}
+	messages := valuesProfileMessages(context.Background(), w)
+	require.Len(t, messages, 1)
+	b, err := json.Marshal(messages)
+	require.NoError(t, err)
+	text := string(b)
+	assert.Contains(t, text, "Profile values-prod.yaml of chart app")
+	assert.Contains(t, text, "cpu: 500m")
+	assert.Contains(t, text, "must also update every profile")
+	assert.NotContains(t, text, "values-dev.yaml")
+}
+
+func TestPlanMessagesRecentChanges(t *testing.T) {
+	stubUserConventions(t, nil)
+	original := listValuesProfiles
+	t.Cleanup(func() { listValuesProfiles = original })
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+
+	w := twoChartPlanWorkspace()
+	opts := CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "add an ingress"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		RecentChanges: []workspacetypes.FileDiff{
+			{FilePath: "values.yaml", ChartID: "chart-backend", LinesAdded: 1, LinesRemoved: 1, Diff: "-replicaCount: 1\n+replicaCount: 2\n"},
+		},
+	}
+	promptText := func(opts CreatePlanOpts) string {
+		_, messages := planMessages(context.Background(), opts, "File: values.yaml")
+		b, err := json.Marshal(messages)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.NotContains(t, promptText(opts), "BEGIN RECENT CHANGES")
+
+	opts.IsUpdate = true
+	text := promptText(opts)
+	assert.Contains(t, text, "=== BEGIN RECENT CHANGES ===")
+	assert.Contains(t, text, `File: backend/values.yaml (+1 -1)\n-replicaCount: 1\n+replicaCount: 2\n=== END RECENT CHANGES ===`)
+
+	opts.RecentChanges = nil
+	assert.NotContains(t, promptText(opts), "BEGIN RECENT CHANGES")
+}
+
+func TestPlanMessagesAdditionalFiles(t *testing.T) {
+	stubUserConventions(t, nil)
+	original := listValuesProfiles
+	t.Cleanup(func() { listValuesProfiles = original })
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+
+	w := twoChartPlanWorkspace()
+	opts := CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "deploy this like the attached manifest"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		IsUpdate:     true,
+		AdditionalFiles: AttachmentFiles([]workspacetypes.ChatAttachment{
+			{Filename: "deployment.yaml", Content: "kind: Deployment\nmetadata:\n  name: legacy-api\n"},
+			{Filename: "huge.log", Content: strings.Repeat("a line of a very long log\n", 20000)},
+		}),
+	}
+
+	_, messages := planMessages(context.Background(), opts, "File: values.yaml")
+	b, err := json.Marshal(messages)
+	require.NoError(t, err)
+	text := string(b)
+
+	assert.Contains(t, text, `=== BEGIN ATTACHMENT: deployment.yaml ===\nkind: Deployment\nmetadata:\n  name: legacy-api\n=== END ATTACHMENT ===`)
+	assert.Contains(t, text, "=== BEGIN ATTACHMENT: huge.log ===")
+	assert.Contains(t, text, "more lines truncated")
+	assert.Contains(t, text, "(huge.log was truncated from 520000 characters to fit in the prompt)")
+	assert.Less(t, len(text), additionalFilesTokenBudget*approxCharsPerToken+10000)
+
+	// the attachments come after the conversation, right before the request for a plan
+	assert.Less(t, strings.Index(text, "deploy this like the attached manifest"), strings.Index(text, "BEGIN ATTACHMENT"))
+
+	opts.AdditionalFiles = nil
+	_, messages = planMessages(context.Background(), opts, "File: values.yaml")
+	b, err = json.Marshal(messages)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "BEGIN ATTACHMENT")
+}
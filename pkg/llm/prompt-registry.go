@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// PromptName names a prompt of the prompt registry
+type PromptName string
+
+// the names of the prompts of the registry. The names of the prompts given as system messages end
+// with system, and of the ones given after them with instructions.
+const (
+	promptCommonSystem                 PromptName = "common-system"
+	promptEndUserSystem                PromptName = "end-user-system"
+	promptChatOnlySystem               PromptName = "chat-only-system"
+	promptInitialPlanSystem            PromptName = "initial-plan-system"
+	promptUpdatePlanSystem             PromptName = "update-plan-system"
+	promptDetailedPlanSystem           PromptName = "detailed-plan-system"
+	promptCleanupConvertedValuesSystem PromptName = "cleanup-converted-values-system"
+	promptExecutePlanSystem            PromptName = "execute-plan-system"
+	promptConvertFileSystem            PromptName = "convert-file-system"
+	promptChatOnlyInstructions         PromptName = "chat-only-instructions"
+	promptInitialPlanInstructions      PromptName = "initial-plan-instructions"
+	promptUpdatePlanInstructions       PromptName = "update-plan-instructions"
+	promptDetailedPlanInstructions     PromptName = "detailed-plan-instructions"
+)
+
+// RegisteredPrompt is a prompt of the registry with the default it's seeded with and falls back to
+type RegisteredPrompt struct {
+	Name    PromptName `json:"name"`
+	Default string     `json:"default"`
+	// Extends is the prompt this one is appended to, the LLM is given the active version of both
+	Extends PromptName `json:"extends,omitempty"`
+}
+
+var registeredPrompts = []RegisteredPrompt{
+	{Name: promptCommonSystem, Default: commonSystemPrompt},
+	{Name: promptEndUserSystem, Default: endUserSystemPrompt},
+	{Name: promptChatOnlySystem, Default: chatOnlySystemSection, Extends: promptCommonSystem},
+	{Name: promptInitialPlanSystem, Default: initialPlanSystemSection, Extends: promptCommonSystem},
+	{Name: promptUpdatePlanSystem, Default: updatePlanSystemSection, Extends: promptCommonSystem},
+	{Name: promptDetailedPlanSystem, Default: detailedPlanSystemSection, Extends: promptCommonSystem},
+	{Name: promptCleanupConvertedValuesSystem, Default: cleanupConvertedValuesSystemSection, Extends: promptCommonSystem},
+	{Name: promptExecutePlanSystem, Default: executePlanSystemSection, Extends: promptCommonSystem},
+	{Name: promptConvertFileSystem, Default: convertFileSystemSection, Extends: promptCommonSystem},
+	{Name: promptChatOnlyInstructions, Default: chatOnlyInstructions},
+	{Name: promptInitialPlanInstructions, Default: initialPlanInstructions},
+	{Name: promptUpdatePlanInstructions, Default: updatePlanInstructions},
+	{Name: promptDetailedPlanInstructions, Default: detailedPlanInstructions},
+}
+
+// RegisteredPrompts returns the prompts of the registry
+func RegisteredPrompts() []RegisteredPrompt {
+	return append([]RegisteredPrompt{}, registeredPrompts...)
+}
+
+// FindRegisteredPrompt returns the prompt of the registry named name
+func FindRegisteredPrompt(name string) (RegisteredPrompt, bool) {
+	for _, prompt := range registeredPrompts {
+		if string(prompt.Name) == name {
+			return prompt, true
+		}
+	}
+	return RegisteredPrompt{}, false
+}
+
+const (
+	// promptCacheTTL is how long the active prompts are used before they're read again, so that a
+	// version activated on another worker is given within it
+	promptCacheTTL = time.Minute
+	// promptLoadTimeout bounds reading the active prompts, the defaults are given when it runs out
+	promptLoadTimeout = 2 * time.Second
+)
+
+// these are vars so that the registry can be tested without a database
+var (
+	listActiveSystemPrompts = workspace.ListActiveSystemPrompts
+	seedSystemPrompts       = workspace.SeedSystemPrompts
+)
+
+// promptCache holds the active version of each prompt. When they can't be read, the versions read
+// before are kept, and prompts that were never read are given their defaults.
+type promptCache struct {
+	mu       sync.Mutex
+	active   map[PromptName]workspacetypes.SystemPrompt
+	loadedAt time.Time
+}
+
+var activePrompts = &promptCache{}
+
+// InvalidatePromptCache makes the next prompt given to the LLM read the active prompts again, call
+// it after creating or activating a version
+func InvalidatePromptCache() {
+	activePrompts.mu.Lock()
+	defer activePrompts.mu.Unlock()
+	activePrompts.loadedAt = time.Time{}
+}
+
+func (c *promptCache) get(ctx context.Context, now time.Time) map[PromptName]workspacetypes.SystemPrompt {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loadedAt.IsZero() && now.Sub(c.loadedAt) < promptCacheTTL {
+		return c.active
+	}
+
+	// the prompts are shared by every caller, so reading them isn't cancelled with the caller
+	loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), promptLoadTimeout)
+	defer cancel()
+
+	// a failed read isn't retried until the TTL runs out, so that every call doesn't wait for it
+	c.loadedAt = now
+	prompts, err := listActiveSystemPrompts(loadCtx)
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to read the active system prompts, using the prompts read before or the defaults", zap.Error(err))
+		return c.active
+	}
+
+	active := map[PromptName]workspacetypes.SystemPrompt{}
+	for _, prompt := range prompts {
+		active[PromptName(prompt.Name)] = prompt
+	}
+	c.active = active
+	return c.active
+}
+
+type promptVersionsKey struct{}
+
+// promptVersionsFromContext returns the versions of the prompts given with the LLM calls made with
+// ctx, by name
+func promptVersionsFromContext(ctx context.Context) map[string]int {
+	if versions, ok := ctx.Value(promptVersionsKey{}).(map[string]int); ok {
+		return versions
+	}
+	return nil
+}
+
+// withPrompt returns the active version of a prompt, appended to the prompt it extends, and a
+// context that records the versions given on the usage of the LLM calls made with it. A prompt that
+// can't be read is given its default, recorded as version 0.
+func withPrompt(ctx context.Context, name PromptName) (context.Context, string) {
+	prompt, ok := FindRegisteredPrompt(string(name))
+	if !ok {
+		logger.ErrorCtx(ctx, fmt.Errorf("prompt %s isn't registered", name))
+		return ctx, ""
+	}
+	chain := []RegisteredPrompt{prompt}
+	if prompt.Extends != "" {
+		extended, _ := FindRegisteredPrompt(string(prompt.Extends))
+		chain = []RegisteredPrompt{extended, prompt}
+	}
+
+	active := activePrompts.get(ctx, time.Now())
+	versions := map[string]int{}
+	for promptName, version := range promptVersionsFromContext(ctx) {
+		versions[promptName] = version
+	}
+
+	content := ""
+	for _, p := range chain {
+		if version, ok := active[p.Name]; ok {
+			content += version.Content
+			versions[string(p.Name)] = version.Version
+			continue
+		}
+		content += p.Default
+		versions[string(p.Name)] = 0
+	}
+
+	return context.WithValue(ctx, promptVersionsKey{}, versions), content
+}
+
+// SeedPrompts adds the default of each prompt to the registry as its first version, active, unless
+// the registry already has a version of the prompt
+func SeedPrompts(ctx context.Context) error {
+	prompts := []workspacetypes.SystemPrompt{}
+	for _, prompt := range registeredPrompts {
+		prompts = append(prompts, workspacetypes.SystemPrompt{Name: string(prompt.Name), Content: prompt.Default})
+	}
+
+	seeded, err := seedSystemPrompts(ctx, prompts)
+	if err != nil {
+		return fmt.Errorf("failed to seed system prompts: %w", err)
+	}
+	if len(seeded) > 0 {
+		logger.Info("Seeded system prompts", zap.Strings("names", seeded))
+	}
+	InvalidatePromptCache()
+	return nil
+}
@@ -0,0 +1,159 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubActivePrompts empties the prompt cache and reads the active prompts from list, returning how
+// many times they were read
+func stubActivePrompts(t *testing.T, list func(ctx context.Context) ([]workspacetypes.SystemPrompt, error)) *int {
+	original := listActiveSystemPrompts
+	reads := 0
+	listActiveSystemPrompts = func(ctx context.Context) ([]workspacetypes.SystemPrompt, error) {
+		reads++
+		return list(ctx)
+	}
+	activePrompts = &promptCache{}
+	t.Cleanup(func() {
+		listActiveSystemPrompts = original
+		activePrompts = &promptCache{}
+	})
+	return &reads
+}
+
+func TestRegisteredPrompts(t *testing.T) {
+	names := map[PromptName]bool{}
+	for _, prompt := range RegisteredPrompts() {
+		assert.False(t, names[prompt.Name], "%s is registered once", prompt.Name)
+		names[prompt.Name] = true
+		assert.NotEmpty(t, prompt.Default, prompt.Name)
+		if prompt.Extends != "" {
+			extended, ok := FindRegisteredPrompt(string(prompt.Extends))
+			require.True(t, ok, "%s extends a registered prompt", prompt.Name)
+			assert.Empty(t, extended.Extends, "%s extends a prompt that doesn't extend another", prompt.Name)
+		}
+	}
+
+	_, ok := FindRegisteredPrompt("missing")
+	assert.False(t, ok)
+}
+
+func TestWithPromptFallback(t *testing.T) {
+	stubActivePrompts(t, func(ctx context.Context) ([]workspacetypes.SystemPrompt, error) {
+		return nil, errors.New("failed to acquire from Postgres pool: connection refused")
+	})
+
+	ctx, content := withPrompt(context.Background(), promptExecutePlanSystem)
+	assert.Equal(t, commonSystemPrompt+executePlanSystemSection, content, "the defaults are given when the registry can't be read")
+	ctx, content = withPrompt(ctx, promptDetailedPlanInstructions)
+	assert.Equal(t, detailedPlanInstructions, content)
+	assert.Equal(t, map[string]int{
+		"common-system":              0,
+		"execute-plan-system":        0,
+		"detailed-plan-instructions": 0,
+	}, promptVersionsFromContext(ctx))
+}
+
+func TestWithPromptActiveVersions(t *testing.T) {
+	failing := false
+	reads := stubActivePrompts(t, func(ctx context.Context) ([]workspacetypes.SystemPrompt, error) {
+		if failing {
+			return nil, errors.New("connection refused")
+		}
+		return []workspacetypes.SystemPrompt{
+			{Name: "common-system", Version: 3, Content: "You are ChartSmith v3.\n", IsActive: true},
+			{Name: "execute-plan-system", Version: 2, Content: "Edit one file.\n", IsActive: true},
+		}, nil
+	})
+
+	parent := context.Background()
+	ctx, content := withPrompt(parent, promptExecutePlanSystem)
+	assert.Equal(t, "You are ChartSmith v3.\nEdit one file.\n", content)
+	assert.Equal(t, map[string]int{"common-system": 3, "execute-plan-system": 2}, promptVersionsFromContext(ctx))
+	assert.Nil(t, promptVersionsFromContext(parent), "the context given isn't changed")
+
+	_, content = withPrompt(ctx, promptConvertFileSystem)
+	assert.Equal(t, "You are ChartSmith v3.\n"+convertFileSystemSection, content, "a prompt without an active version is given its default")
+	assert.Equal(t, 1, *reads, "the active prompts are cached")
+
+	activePrompts.get(context.Background(), time.Now().Add(promptCacheTTL))
+	assert.Equal(t, 2, *reads, "the active prompts are read again once the TTL runs out")
+
+	failing = true
+	InvalidatePromptCache()
+	_, content = withPrompt(parent, promptExecutePlanSystem)
+	assert.Equal(t, "You are ChartSmith v3.\nEdit one file.\n", content, "the prompts read before are kept when they can't be read again")
+	assert.Equal(t, 3, *reads)
+}
+
+func TestPromptVersionsRecordedOnUsage(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("PLAN_MODEL", "")
+	require.NoError(t, param.Init(nil))
+
+	fake := newFakeAnthropic(t)
+	stubUserConventions(t, nil)
+	originalListValuesProfiles := listValuesProfiles
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+	t.Cleanup(func() { listValuesProfiles = originalListValuesProfiles })
+	stubActivePrompts(t, func(ctx context.Context) ([]workspacetypes.SystemPrompt, error) {
+		return []workspacetypes.SystemPrompt{
+			{Name: "common-system", Version: 3, Content: commonSystemPrompt, IsActive: true},
+			{Name: "update-plan-instructions", Version: 5, Content: updatePlanInstructions, IsActive: true},
+		}, nil
+	})
+
+	ctx := WithUsageAttribution(context.Background(), UsageAttribution{WorkspaceID: "workspace", PlanID: "plan"})
+	w := twoChartPlanWorkspace()
+	streamCh := make(chan string, 10)
+	doneCh := make(chan error, 2)
+	require.NoError(t, CreatePlan(ctx, streamCh, doneCh, CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "add an ingress"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		IsUpdate:     true,
+	}))
+	assert.NoError(t, <-doneCh)
+
+	_, err := summarizeContentWithClaude(ctx, "kind: Service")
+	require.NoError(t, err)
+
+	require.Len(t, fake.usage, 2)
+	assert.Equal(t, map[string]int{
+		"common-system":            3,
+		"update-plan-system":       0,
+		"update-plan-instructions": 5,
+	}, fake.usage[0].PromptVersions)
+	assert.Empty(t, fake.usage[1].PromptVersions, "a call given no registered prompts records none")
+}
+
+func TestSeedPrompts(t *testing.T) {
+	original := seedSystemPrompts
+	t.Cleanup(func() { seedSystemPrompts = original })
+
+	var seeded []workspacetypes.SystemPrompt
+	seedSystemPrompts = func(ctx context.Context, prompts []workspacetypes.SystemPrompt) ([]string, error) {
+		seeded = prompts
+		return []string{"common-system"}, nil
+	}
+	require.NoError(t, SeedPrompts(context.Background()))
+
+	require.Len(t, seeded, len(registeredPrompts))
+	assert.Contains(t, seeded, workspacetypes.SystemPrompt{Name: "common-system", Content: commonSystemPrompt})
+	assert.Contains(t, seeded, workspacetypes.SystemPrompt{Name: "execute-plan-system", Content: executePlanSystemSection}, "a prompt that extends another is seeded with what it adds")
+
+	seedSystemPrompts = func(ctx context.Context, prompts []workspacetypes.SystemPrompt) ([]string, error) {
+		return nil, errors.New("relation \"system_prompt\" does not exist")
+	}
+	assert.ErrorContains(t, SeedPrompts(context.Background()), "failed to seed system prompts")
+}
@@ -0,0 +1,350 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ValuesTableRow is one leaf of a values.yaml, keyed by its dotted path
+type ValuesTableRow struct {
+	Key         string
+	Type        string
+	Default     string
+	Description string // the comment above or beside the key, empty when there isn't one
+}
+
+// readmeProse is what the LLM writes for a README, everything else is generated from the chart
+type readmeProse struct {
+	Intro        string            `json:"intro"`
+	Descriptions map[string]string `json:"descriptions"`
+}
+
+// completeReadmeProse is a var so that README generation can be tested without an LLM
+var completeReadmeProse = completeReadmeProseWithClaude
+
+// GenerateChartReadme writes a README.md for a chart with an intro, installation instructions and a
+// table of its values. The table is built from values.yaml, the LLM only writes the intro and the
+// descriptions of values that don't have a comment.
+func GenerateChartReadme(ctx context.Context, chart *workspacetypes.Chart, valuesYAML string, templatesSummary string) (string, error) {
+	rows, err := ParseValuesTable(valuesYAML)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse values: %w", err)
+	}
+
+	undocumented := []string{}
+	for _, row := range rows {
+		if row.Description == "" {
+			undocumented = append(undocumented, row.Key)
+		}
+	}
+
+	prose, err := completeReadmeProse(ctx, chart.Name, valuesYAML, templatesSummary, undocumented)
+	if err != nil {
+		return "", fmt.Errorf("failed to write readme prose: %w", err)
+	}
+
+	// descriptions only fill in rows that exist, keys the LLM made up are dropped
+	for i := range rows {
+		if rows[i].Description == "" {
+			rows[i].Description = strings.TrimSpace(prose.Descriptions[rows[i].Key])
+		}
+	}
+
+	readme := strings.Builder{}
+	fmt.Fprintf(&readme, "# %s\n\n", chart.Name)
+	if intro := strings.TrimSpace(prose.Intro); intro != "" {
+		fmt.Fprintf(&readme, "%s\n\n", intro)
+	}
+	fmt.Fprintf(&readme, "## Installing the Chart\n\nTo install the chart with the release name `my-release`:\n\n```console\nhelm install my-release ./%s\n```\n\n", chart.Name)
+	fmt.Fprintf(&readme, "To uninstall it:\n\n```console\nhelm uninstall my-release\n```\n\n")
+	fmt.Fprintf(&readme, "## Values\n\n%s", ValuesTableMarkdown(rows))
+
+	return readme.String(), nil
+}
+
+// RefreshChartReadme generates the README.md of a chart in the current revision of a workspace and
+// writes it as pending content, for the user to review like any other change
+func RefreshChartReadme(ctx context.Context, workspaceID string, chartID string) (string, error) {
+	ctx = WithUsageAttribution(ctx, UsageAttribution{WorkspaceID: workspaceID})
+
+	w, err := workspace.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	var chart *workspacetypes.Chart
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			chart = &w.Charts[i]
+		}
+	}
+	if chart == nil {
+		return "", fmt.Errorf("%w: %s in workspace %s", workspace.ErrChartNotFound, chartID, workspaceID)
+	}
+
+	valuesYAML := ""
+	templatesSummary := strings.Builder{}
+	for _, file := range chart.Files {
+		content := file.Content
+		if file.ContentPending != nil {
+			content = *file.ContentPending
+		}
+		if file.FilePath == "values.yaml" {
+			valuesYAML = content
+		}
+		if strings.HasPrefix(file.FilePath, "templates/") {
+			fmt.Fprintf(&templatesSummary, "- %s%s\n", file.FilePath, templateKinds(content))
+		}
+	}
+
+	readme, err := GenerateChartReadme(ctx, chart, valuesYAML, templatesSummary.String())
+	if err != nil {
+		return "", err
+	}
+
+	if err := workspace.SetFileContentPending(ctx, "README.md", w.CurrentRevision, chart.ID, w.ID, readme, nil); err != nil {
+		return "", fmt.Errorf("failed to write README.md: %w", err)
+	}
+
+	return readme, nil
+}
+
+// templateKinds returns the kinds a template declares, such as " (Deployment, Service)"
+func templateKinds(content string) string {
+	kinds := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if kind, ok := strings.CutPrefix(strings.TrimSpace(line), "kind:"); ok {
+			kinds = append(kinds, strings.TrimSpace(kind))
+		}
+	}
+	if len(kinds) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(kinds, ", ") + ")"
+}
+
+// ParseValuesTable returns a row for every leaf of values.yaml in file order. Empty maps and
+// lists are leaves, so every top level key has at least one row.
+func ParseValuesTable(valuesYAML string) ([]ValuesTableRow, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(valuesYAML), &doc); err != nil {
+		return nil, err
+	}
+
+	rows := []ValuesTableRow{}
+	if len(doc.Content) == 0 {
+		return rows, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("values.yaml is not a map")
+	}
+
+	if err := appendValuesRows(&rows, "", root); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func appendValuesRows(rows *[]ValuesTableRow, prefix string, mapping *yaml.Node) error {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode, valueNode := mapping.Content[i], mapping.Content[i+1]
+		key := keyNode.Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if valueNode.Kind == yaml.AliasNode {
+			valueNode = valueNode.Alias
+		}
+		if valueNode.Kind == yaml.MappingNode && len(valueNode.Content) > 0 {
+			if err := appendValuesRows(rows, key, valueNode); err != nil {
+				return err
+			}
+			continue
+		}
+
+		defaultValue, err := formatValuesDefault(valueNode)
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", key, err)
+		}
+
+		*rows = append(*rows, ValuesTableRow{
+			Key:         key,
+			Type:        valuesType(valueNode),
+			Default:     defaultValue,
+			Description: valuesComment(keyNode, valueNode),
+		})
+	}
+	return nil
+}
+
+func valuesType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "list"
+	}
+
+	switch node.ShortTag() {
+	case "!!int":
+		return "int"
+	case "!!float":
+		return "float"
+	case "!!bool":
+		return "bool"
+	case "!!null":
+		return "string"
+	}
+	return "string"
+}
+
+// formatValuesDefault returns the default as JSON, the way it's written with --set-json
+func formatValuesDefault(node *yaml.Node) (string, error) {
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(normalizeYAMLValue(value))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// normalizeYAMLValue converts the map[interface{}]interface{} maps that can't be marshaled to JSON
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAMLValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeYAMLValue(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeYAMLValue(item)
+		}
+		return v
+	}
+	return value
+}
+
+func valuesComment(keyNode *yaml.Node, valueNode *yaml.Node) string {
+	comment := keyNode.HeadComment
+	if comment == "" {
+		comment = valueNode.LineComment
+	}
+	if comment == "" {
+		comment = keyNode.LineComment
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+		// helm-docs annotations such as "-- description" and "@default"
+		line = strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		if line != "" && !strings.HasPrefix(line, "@") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, " ")
+}
+
+// ValuesTableMarkdown renders rows as a markdown table
+func ValuesTableMarkdown(rows []ValuesTableRow) string {
+	table := strings.Builder{}
+	table.WriteString("| Key | Type | Default | Description |\n")
+	table.WriteString("|-----|------|---------|-------------|\n")
+	for _, row := range rows {
+		fmt.Fprintf(&table, "| `%s` | %s | `%s` | %s |\n",
+			escapeTableCell(row.Key), row.Type, escapeTableCell(row.Default), escapeTableCell(row.Description))
+	}
+	return table.String()
+}
+
+func escapeTableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+func completeReadmeProseWithClaude(ctx context.Context, chartName string, valuesYAML string, templatesSummary string, undocumented []string) (*readmeProse, error) {
+	client, err := newAnthropicClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic client: %w", err)
+	}
+
+	sort.Strings(undocumented)
+	keys, err := json.Marshal(undocumented)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal keys: %w", err)
+	}
+
+	userMessage := fmt.Sprintf(`You are writing parts of the README.md of the Helm chart %q.
+
+Templates:
+%s
+
+values.yaml:
+%s
+
+Respond with only a JSON object with two fields:
+- "intro": one or two short paragraphs of markdown describing what the chart deploys. Don't include a heading, installation instructions or a list of values.
+- "descriptions": an object with a one sentence description of each of these values keys, using exactly these keys: %s`, chartName, templatesSummary, valuesYAML, string(keys))
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationSummarize)),
+		MaxTokens: anthropic.F(int64(4096)),
+		Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage))}),
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	resp, err := client.Messages.New(requestCtx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write readme: %w", err)
+	}
+	recordAnthropicUsage(ctx, OperationSummarize, resp)
+
+	logger.Debug("Wrote readme prose", zap.String("chart", chartName), zap.Duration("duration", time.Since(startTime)))
+
+	if len(resp.Content) == 0 {
+		return nil, fmt.Errorf("empty readme response")
+	}
+	return parseReadmeProse(resp.Content[0].Text)
+}
+
+// parseReadmeProse reads the JSON object out of a response, ignoring any text around it
+func parseReadmeProse(text string) (*readmeProse, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in readme response")
+	}
+
+	prose := readmeProse{}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &prose); err != nil {
+		return nil, fmt.Errorf("failed to parse readme response: %w", err)
+	}
+	return &prose, nil
+}
@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const readmeValuesYAML = `# Number of pods to run
+replicaCount: 1
+
+image:
+  repository: nginx
+  # -- Overrides the image tag, defaults to the chart appVersion
+  tag: ""
+  pullPolicy: IfNotPresent
+
+imagePullSecrets: []
+podAnnotations: {}
+
+service:
+  type: ClusterIP
+  port: 80 # the port the service listens on
+
+resources: {}
+ingress:
+  enabled: false
+  hosts:
+    - host: chart-example.local
+      paths: ["/"]
+tolerations:
+nodeSelector:
+  disktype: ssd
+ratio: 0.5
+`
+
+func TestParseValuesTable(t *testing.T) {
+	rows, err := ParseValuesTable(readmeValuesYAML)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ValuesTableRow{
+		{Key: "replicaCount", Type: "int", Default: "1", Description: "Number of pods to run"},
+		{Key: "image.repository", Type: "string", Default: `"nginx"`},
+		{Key: "image.tag", Type: "string", Default: `""`, Description: "Overrides the image tag, defaults to the chart appVersion"},
+		{Key: "image.pullPolicy", Type: "string", Default: `"IfNotPresent"`},
+		{Key: "imagePullSecrets", Type: "list", Default: "[]"},
+		{Key: "podAnnotations", Type: "object", Default: "{}"},
+		{Key: "service.type", Type: "string", Default: `"ClusterIP"`},
+		{Key: "service.port", Type: "int", Default: "80", Description: "the port the service listens on"},
+		{Key: "resources", Type: "object", Default: "{}"},
+		{Key: "ingress.enabled", Type: "bool", Default: "false"},
+		{Key: "ingress.hosts", Type: "list", Default: `[{"host":"chart-example.local","paths":["/"]}]`},
+		{Key: "tolerations", Type: "string", Default: "null"},
+		{Key: "nodeSelector.disktype", Type: "string", Default: `"ssd"`},
+		{Key: "ratio", Type: "float", Default: "0.5"},
+	}, rows)
+}
+
+func TestGenerateChartReadmeHasEveryTopLevelKey(t *testing.T) {
+	original := completeReadmeProse
+	t.Cleanup(func() { completeReadmeProse = original })
+
+	var undocumentedKeys []string
+	completeReadmeProse = func(ctx context.Context, chartName string, valuesYAML string, templatesSummary string, undocumented []string) (*readmeProse, error) {
+		undocumentedKeys = undocumented
+		return &readmeProse{
+			Intro: "Deploys nginx.",
+			Descriptions: map[string]string{
+				"image.repository": "The image to run",
+				"replicaCount":     "ignored, the comment in values.yaml wins",
+				"made.up.key":      "a key that isn't in values.yaml",
+			},
+		}, nil
+	}
+
+	readme, err := GenerateChartReadme(context.Background(), &workspacetypes.Chart{Name: "nginx"}, readmeValuesYAML, "- templates/deployment.yaml (Deployment)\n")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(readme, "# nginx\n\nDeploys nginx.\n\n## Installing the Chart"))
+	assert.Contains(t, readme, "helm install my-release ./nginx")
+
+	var values map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(readmeValuesYAML), &values))
+	require.NotEmpty(t, values)
+	for key := range values {
+		assert.Regexp(t, "(?m)^\\| `"+key+"(\\.[^`]*)?` \\|", readme, "top level key %s isn't in the values table", key)
+	}
+
+	assert.Contains(t, readme, "| `image.repository` | string | `\"nginx\"` | The image to run |")
+	assert.Contains(t, readme, "| `replicaCount` | int | `1` | Number of pods to run |")
+	assert.NotContains(t, readme, "made.up.key")
+	assert.NotContains(t, undocumentedKeys, "replicaCount")
+	assert.Contains(t, undocumentedKeys, "image.repository")
+}
+
+func TestParseReadmeProse(t *testing.T) {
+	prose, err := parseReadmeProse("Here is the README content:\n```json\n{\"intro\": \"Deploys nginx.\", \"descriptions\": {\"replicaCount\": \"Pods to run\"}}\n```")
+	require.NoError(t, err)
+	assert.Equal(t, "Deploys nginx.", prose.Intro)
+	assert.Equal(t, map[string]string{"replicaCount": "Pods to run"}, prose.Descriptions)
+
+	_, err = parseReadmeProse("I can't help with that")
+	assert.Error(t, err)
+}
+
+func TestValuesTableMarkdownEscapesPipes(t *testing.T) {
+	table := ValuesTableMarkdown([]ValuesTableRow{{Key: "regex", Type: "string", Default: `"a|b"`, Description: "one\ntwo"}})
+	assert.Contains(t, table, "| `regex` | string | `\"a\\|b\"` | one two |")
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+)
+
+// checkSecretsForLLM is a var so that LLM calls can be tested without a database
+var checkSecretsForLLM = workspace.CheckSecretsForLLM
+
+// guardSecrets returns an error wrapping workspace.ErrSecretsNotAcknowledged when the request of
+// an LLM call has a secret that was found in a file of the workspace the call is attributed to,
+// and hasn't been acknowledged. It's called with the params of every call before they're sent.
+func guardSecrets(ctx context.Context, params any) error {
+	workspaceID := usageAttributionFromContext(ctx).WorkspaceID
+	if workspaceID == "" {
+		return nil
+	}
+
+	// the params are walked as JSON so that every text in them is checked, whatever field of the
+	// request it's in
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode llm request: %w", err)
+	}
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return fmt.Errorf("failed to decode llm request: %w", err)
+	}
+
+	return checkSecretsForLLM(ctx, workspaceID, collectStrings(decoded, nil))
+}
+
+func collectStrings(value any, texts []string) []string {
+	switch v := value.(type) {
+	case string:
+		texts = append(texts, v)
+	case []any:
+		for _, item := range v {
+			texts = collectStrings(item, texts)
+		}
+	case map[string]any:
+		for _, item := range v {
+			texts = collectStrings(item, texts)
+		}
+	}
+	return texts
+}
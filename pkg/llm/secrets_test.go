@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardSecrets(t *testing.T) {
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationPlan)),
+		MaxTokens: anthropic.F(int64(8192)),
+		Messages: anthropic.F([]anthropic.MessageParam{
+			anthropic.NewAssistantMessage(anthropic.NewTextBlock("You are a helm chart developer")),
+			anthropic.NewUserMessage(anthropic.NewTextBlock("File: values.yaml, Content: accessKeyId: AKIAUJZDE8GXD6NCF10E")),
+		}),
+	}
+
+	tests := []struct {
+		name        string
+		attribution UsageAttribution
+		checkErr    error
+		wantChecked bool
+		wantErr     error
+	}{
+		{name: "not attributed", wantChecked: false},
+		{name: "allowed", attribution: UsageAttribution{WorkspaceID: "ws"}, wantChecked: true},
+		{name: "blocked", attribution: UsageAttribution{WorkspaceID: "ws", PlanID: "plan"}, checkErr: workspace.ErrSecretsNotAcknowledged, wantChecked: true, wantErr: workspace.ErrSecretsNotAcknowledged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := checkSecretsForLLM
+			t.Cleanup(func() { checkSecretsForLLM = original })
+
+			checked := false
+			var gotWorkspaceID string
+			var gotTexts []string
+			checkSecretsForLLM = func(ctx context.Context, workspaceID string, texts []string) error {
+				checked = true
+				gotWorkspaceID, gotTexts = workspaceID, texts
+				return tt.checkErr
+			}
+
+			ctx := WithUsageAttribution(context.Background(), tt.attribution)
+			err := guardSecrets(ctx, params)
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, tt.wantErr))
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantChecked, checked)
+			if tt.wantChecked {
+				assert.Equal(t, "ws", gotWorkspaceID)
+				assert.Contains(t, gotTexts, "You are a helm chart developer")
+				assert.Contains(t, gotTexts, "File: values.yaml, Content: accessKeyId: AKIAUJZDE8GXD6NCF10E")
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StrReplaceFailureKind classifies why a str_replace old_str wasn't found in a file
+type StrReplaceFailureKind string
+
+const (
+	StrReplaceFailureLineEndings        StrReplaceFailureKind = "line_endings"
+	StrReplaceFailureTrailingWhitespace StrReplaceFailureKind = "trailing_whitespace"
+	StrReplaceFailureIndentation        StrReplaceFailureKind = "indentation"
+	StrReplaceFailureDifferentSection   StrReplaceFailureKind = "different_section"
+	StrReplaceFailureAbsent             StrReplaceFailureKind = "absent"
+)
+
+// strReplaceExcerptContextLines is the number of lines shown on each side of the closest match
+const strReplaceExcerptContextLines = 1
+
+// StrReplaceDiagnosis is the result of comparing a failed old_str against the file content
+type StrReplaceDiagnosis struct {
+	Kind      StrReplaceFailureKind
+	Hint      string
+	Excerpt   string // the closest matching region of the file, verbatim
+	StartLine int    // 1-based line number of the excerpt, 0 if there is no excerpt
+}
+
+// ToolResponse is the str_replace tool result returned to the model
+func (d StrReplaceDiagnosis) ToolResponse() string {
+	response := fmt.Sprintf("Error: String to replace not found in file. %s", d.Hint)
+	if d.Excerpt != "" {
+		response += fmt.Sprintf("\nClosest matching region (starting at line %d):\n%s", d.StartLine, d.Excerpt)
+	}
+	return response
+}
+
+// diagnoseStrReplaceFailure compares oldStr against content to work out the most likely reason
+// the replacement failed, so the model can correct itself instead of repeating the same mistake
+func diagnoseStrReplaceFailure(content string, oldStr string) StrReplaceDiagnosis {
+	if strings.Contains(content, "\r\n") != strings.Contains(oldStr, "\r\n") &&
+		strings.Contains(normalizeLineEndings(content), normalizeLineEndings(oldStr)) {
+		lineEnding := "LF (\\n)"
+		if strings.Contains(content, "\r\n") {
+			lineEnding = "CRLF (\\r\\n)"
+		}
+		return StrReplaceDiagnosis{
+			Kind: StrReplaceFailureLineEndings,
+			Hint: fmt.Sprintf("The text exists but the file uses %s line endings; retry with matching line endings.", lineEnding),
+		}
+	}
+
+	contentLines := strings.Split(normalizeLineEndings(content), "\n")
+	oldLines := splitOldStrLines(normalizeLineEndings(oldStr))
+	if len(oldLines) == 0 {
+		return StrReplaceDiagnosis{
+			Kind: StrReplaceFailureAbsent,
+			Hint: "old_str is empty; view the file and include the exact text to replace.",
+		}
+	}
+
+	if start := findLineSequence(contentLines, oldLines, trimTrailingWhitespace); start >= 0 {
+		d := StrReplaceDiagnosis{
+			Kind: StrReplaceFailureTrailingWhitespace,
+			Hint: "The text exists but trailing whitespace differs; retry with the exact whitespace at the end of each line.",
+		}
+		d.Excerpt, d.StartLine = excerptLines(contentLines, start, len(oldLines))
+		return d
+	}
+
+	if start := findLineSequence(contentLines, oldLines, strings.TrimSpace); start >= 0 {
+		d := StrReplaceDiagnosis{
+			Kind: StrReplaceFailureIndentation,
+			Hint: fmt.Sprintf("The text exists but with %s; retry with exact indentation.", describeIndentation(contentLines[start:start+len(oldLines)])),
+		}
+		d.Excerpt, d.StartLine = excerptLines(contentLines, start, len(oldLines))
+		return d
+	}
+
+	if start, matched, total := closestLineWindow(contentLines, oldLines); total > 0 && matched*2 >= total {
+		d := StrReplaceDiagnosis{
+			Kind: StrReplaceFailureDifferentSection,
+			Hint: fmt.Sprintf("%d of %d lines exist in the file, but not together as given; the surrounding content is different. View the file and copy the exact region.", matched, total),
+		}
+		d.Excerpt, d.StartLine = excerptLines(contentLines, start, len(oldLines))
+		return d
+	}
+
+	return StrReplaceDiagnosis{
+		Kind: StrReplaceFailureAbsent,
+		Hint: "The text does not exist in the file; view the file before making further replacements.",
+	}
+}
+
+func normalizeLineEndings(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+func trimTrailingWhitespace(s string) string {
+	return strings.TrimRight(s, " \t")
+}
+
+// splitOldStrLines splits oldStr into lines, ignoring leading and trailing blank lines
+func splitOldStrLines(oldStr string) []string {
+	lines := strings.Split(oldStr, "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// findLineSequence returns the index of the first line in contentLines where all of oldLines
+// match after applying normalize to both, or -1
+func findLineSequence(contentLines []string, oldLines []string, normalize func(string) string) int {
+	for i := 0; i+len(oldLines) <= len(contentLines); i++ {
+		matched := true
+		for j, oldLine := range oldLines {
+			if normalize(contentLines[i+j]) != normalize(oldLine) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
+
+// closestLineWindow finds the window of len(oldLines) lines in the file that contains the most
+// of the non-blank lines in oldLines, ignoring whitespace and order
+func closestLineWindow(contentLines []string, oldLines []string) (int, int, int) {
+	wanted := map[string]int{}
+	total := 0
+	for _, line := range oldLines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		wanted[trimmed]++
+		total++
+	}
+
+	bestStart, bestMatched := -1, 0
+	for i := 0; i < len(contentLines); i++ {
+		// only consider windows that start on a matching line
+		if wanted[strings.TrimSpace(contentLines[i])] == 0 {
+			continue
+		}
+
+		remaining := map[string]int{}
+		for k, v := range wanted {
+			remaining[k] = v
+		}
+
+		matched := 0
+		for j := i; j < i+len(oldLines) && j < len(contentLines); j++ {
+			trimmed := strings.TrimSpace(contentLines[j])
+			if remaining[trimmed] > 0 {
+				remaining[trimmed]--
+				matched++
+			}
+		}
+
+		if matched > bestMatched {
+			bestStart, bestMatched = i, matched
+		}
+	}
+
+	return bestStart, bestMatched, total
+}
+
+// describeIndentation describes the indentation used by the first indented line
+func describeIndentation(lines []string) string {
+	for _, line := range lines {
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if indent == "" {
+			continue
+		}
+		if strings.Contains(indent, "\t") {
+			return fmt.Sprintf("%d tab indentation", strings.Count(indent, "\t"))
+		}
+		return fmt.Sprintf("%d-space indentation", len(indent))
+	}
+	return "no indentation"
+}
+
+// excerptLines returns the lines of a region with some context around it, and the 1-based line number it starts at
+func excerptLines(contentLines []string, start int, count int) (string, int) {
+	from := start - strReplaceExcerptContextLines
+	if from < 0 {
+		from = 0
+	}
+	to := start + count + strReplaceExcerptContextLines
+	if to > len(contentLines) {
+		to = len(contentLines)
+	}
+	return strings.Join(contentLines[from:to], "\n"), from + 1
+}
@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const diagnoseFixture = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "app.fullname" . }}
+spec:
+  replicas: {{ .Values.replicaCount }}
+  template:
+    spec:
+      containers:
+        - name: app
+          image: "{{ .Values.image.repository }}"
+          ports:
+            - containerPort: 80
+      nodeSelector:
+        {{- toYaml .Values.nodeSelector | nindent 8 }}
+`
+
+func TestDiagnoseStrReplaceFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		oldStr        string
+		wantKind      StrReplaceFailureKind
+		wantHint      string
+		wantExcerpt   string
+		wantStartLine int
+		wantNoExcerpt bool
+	}{
+		{
+			name:    "line endings",
+			content: strings.ReplaceAll(diagnoseFixture, "\n", "\r\n"),
+			oldStr: `metadata:
+  name: {{ include "app.fullname" . }}`,
+			wantKind:      StrReplaceFailureLineEndings,
+			wantHint:      "CRLF",
+			wantNoExcerpt: true,
+		},
+		{
+			name:          "trailing whitespace",
+			content:       diagnoseFixture,
+			oldStr:        "spec:  \n  replicas: {{ .Values.replicaCount }}\t\n",
+			wantKind:      StrReplaceFailureTrailingWhitespace,
+			wantHint:      "trailing whitespace",
+			wantExcerpt:   "spec:",
+			wantStartLine: 4,
+		},
+		{
+			name:    "indentation",
+			content: diagnoseFixture,
+			oldStr: `    containers:
+      - name: app
+        image: "{{ .Values.image.repository }}"`,
+			wantKind:      StrReplaceFailureIndentation,
+			wantHint:      "6-space indentation",
+			wantExcerpt:   `          image: "{{ .Values.image.repository }}"`,
+			wantStartLine: 8,
+		},
+		{
+			name:    "different section",
+			content: diagnoseFixture,
+			oldStr: `          ports:
+            - containerPort: 80
+          resources: {}`,
+			wantKind:      StrReplaceFailureDifferentSection,
+			wantHint:      "2 of 3 lines exist",
+			wantExcerpt:   "- containerPort: 80",
+			wantStartLine: 11,
+		},
+		{
+			name:    "absent",
+			content: diagnoseFixture,
+			oldStr: `  strategy:
+    type: RollingUpdate`,
+			wantKind:      StrReplaceFailureAbsent,
+			wantHint:      "does not exist",
+			wantNoExcerpt: true,
+		},
+		{
+			name:          "empty old_str",
+			content:       diagnoseFixture,
+			oldStr:        "\n\n",
+			wantKind:      StrReplaceFailureAbsent,
+			wantHint:      "empty",
+			wantNoExcerpt: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// sanity check that the fixture really fails an exact match
+			assert.NotContains(t, tt.content, tt.oldStr)
+
+			d := diagnoseStrReplaceFailure(tt.content, tt.oldStr)
+			assert.Equal(t, tt.wantKind, d.Kind)
+			assert.Contains(t, d.Hint, tt.wantHint)
+
+			if tt.wantNoExcerpt {
+				assert.Empty(t, d.Excerpt)
+				assert.Equal(t, 0, d.StartLine)
+				return
+			}
+
+			assert.Contains(t, d.Excerpt, tt.wantExcerpt)
+			assert.Equal(t, tt.wantStartLine, d.StartLine)
+		})
+	}
+}
+
+func TestStrReplaceDiagnosisToolResponse(t *testing.T) {
+	d := StrReplaceDiagnosis{
+		Kind:      StrReplaceFailureIndentation,
+		Hint:      "The text exists but with 2-space indentation; retry with exact indentation.",
+		Excerpt:   "spec:\n  replicas: 1",
+		StartLine: 5,
+	}
+
+	response := d.ToolResponse()
+	assert.True(t, strings.HasPrefix(response, "Error: String to replace not found in file."))
+	assert.Contains(t, response, "2-space indentation")
+	assert.Contains(t, response, "starting at line 5")
+	assert.True(t, strings.HasSuffix(response, d.Excerpt))
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// StrReplaceFailureCursor is the position after the last failure of a page. Failures are ordered
+// newest first, by created_at and then id.
+type StrReplaceFailureCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// ErrInvalidStrReplaceFailureCursor is returned for a cursor that wasn't made by
+// EncodeStrReplaceFailureCursor
+var ErrInvalidStrReplaceFailureCursor = errors.New("invalid cursor")
+
+// EncodeStrReplaceFailureCursor encodes a cursor for clients, to whom it's opaque
+func EncodeStrReplaceFailureCursor(cursor StrReplaceFailureCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor.CreatedAt.UTC().Format(time.RFC3339Nano) + "/" + cursor.ID))
+}
+
+// DecodeStrReplaceFailureCursor decodes a cursor made by EncodeStrReplaceFailureCursor
+func DecodeStrReplaceFailureCursor(encoded string) (*StrReplaceFailureCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidStrReplaceFailureCursor
+	}
+	createdAt, id, ok := strings.Cut(string(decoded), "/")
+	if !ok || id == "" {
+		return nil, ErrInvalidStrReplaceFailureCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidStrReplaceFailureCursor
+	}
+	return &StrReplaceFailureCursor{CreatedAt: t, ID: id}, nil
+}
+
+// StrReplaceFailureFilter selects failed str_replace operations
+type StrReplaceFailureFilter struct {
+	Limit    int
+	FilePath string
+	Since    *time.Time
+	After    *StrReplaceFailureCursor
+}
+
+type strReplaceFailureDB interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// ListStrReplaceFailures returns a page of str_replace operations where old_str wasn't found,
+// newest first, and the cursor for the next page, or nil if this is the last page
+func ListStrReplaceFailures(ctx context.Context, db strReplaceFailureDB, filter StrReplaceFailureFilter) ([]StrReplaceLog, *StrReplaceFailureCursor, error) {
+	query := strings.Builder{}
+	query.WriteString(`SELECT
+			id, created_at, file_path, found, old_str, new_str,
+			updated_content, old_str_len, new_str_len,
+			context_before, context_after, error_message, failure_kind
+		FROM str_replace_log
+		WHERE found = false`)
+
+	args := []any{}
+	if filter.FilePath != "" {
+		args = append(args, filter.FilePath)
+		query.WriteString(fmt.Sprintf(" AND file_path = $%d", len(args)))
+	}
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		query.WriteString(fmt.Sprintf(" AND created_at >= $%d", len(args)))
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		query.WriteString(fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	query.WriteString(" ORDER BY created_at DESC, id DESC")
+
+	// fetch one more than the limit to know if there's a next page
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit+1)
+		query.WriteString(fmt.Sprintf(" LIMIT $%d", len(args)))
+	}
+
+	rows, err := db.Query(ctx, query.String(), args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query str_replace failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := []StrReplaceLog{}
+	for rows.Next() {
+		var log StrReplaceLog
+		var contextBefore, contextAfter, errorMessage, failureKind sql.NullString
+		if err := rows.Scan(
+			&log.ID, &log.CreatedAt, &log.FilePath, &log.Found, &log.OldStr, &log.NewStr,
+			&log.UpdatedContent, &log.OldStrLen, &log.NewStrLen,
+			&contextBefore, &contextAfter, &errorMessage, &failureKind,
+		); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan str_replace failure: %w", err)
+		}
+		log.ContextBefore = contextBefore.String
+		log.ContextAfter = contextAfter.String
+		log.ErrorMessage = errorMessage.String
+		log.FailureKind = failureKind.String
+
+		failures = append(failures, log)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating str_replace failures: %w", err)
+	}
+
+	if filter.Limit <= 0 || len(failures) <= filter.Limit {
+		return failures, nil, nil
+	}
+
+	failures = failures[:filter.Limit]
+	last := failures[len(failures)-1]
+	return failures, &StrReplaceFailureCursor{CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
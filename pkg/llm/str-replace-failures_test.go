@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedStrReplaceLog connects to the database in CHARTSMITH_TEST_PG_URI, skipping the test if it
+// isn't set, and inserts one success and five failures a minute apart, the newest first
+func seedStrReplaceLog(t *testing.T) (*pgx.Conn, string, time.Time) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping str_replace failures integration test")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	// a unique path so that the test doesn't see rows from other runs
+	filePath := "templates/" + t.Name() + time.Now().Format("150405.000000") + ".yaml"
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM str_replace_log WHERE file_path = $1`, filePath)
+	})
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	insert := `INSERT INTO str_replace_log (id, created_at, file_path, found, old_str, new_str, updated_content, old_str_len, new_str_len, error_message, failure_kind)
+		VALUES ($1, $2, $3, $4, 'old', 'new', 'content', 3, 3, $5, $6)`
+
+	_, err = conn.Exec(ctx, insert, filePath+"-found", now, filePath, true, nil, nil)
+	require.NoError(t, err)
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		_, err = conn.Exec(ctx, insert, filePath+"-"+id, now.Add(-time.Duration(i)*time.Minute), filePath, false, "not found", "indentation")
+		require.NoError(t, err)
+	}
+
+	return conn, filePath, now
+}
+
+func TestListStrReplaceFailuresPagination(t *testing.T) {
+	conn, filePath, _ := seedStrReplaceLog(t)
+	ctx := context.Background()
+
+	ids := []string{}
+	filter := StrReplaceFailureFilter{Limit: 2, FilePath: filePath}
+	for page := 0; page < 5; page++ {
+		failures, next, err := ListStrReplaceFailures(ctx, conn, filter)
+		require.NoError(t, err)
+		for _, failure := range failures {
+			assert.False(t, failure.Found)
+			assert.Equal(t, "not found", failure.ErrorMessage)
+			assert.Equal(t, "indentation", failure.FailureKind)
+			ids = append(ids, failure.ID)
+		}
+		if next == nil {
+			break
+		}
+		filter.After = next
+	}
+
+	assert.Equal(t, []string{filePath + "-a", filePath + "-b", filePath + "-c", filePath + "-d", filePath + "-e"}, ids)
+}
+
+func TestListStrReplaceFailuresSince(t *testing.T) {
+	conn, filePath, now := seedStrReplaceLog(t)
+
+	since := now.Add(-90 * time.Second)
+	failures, next, err := ListStrReplaceFailures(context.Background(), conn, StrReplaceFailureFilter{FilePath: filePath, Since: &since})
+	require.NoError(t, err)
+	assert.Nil(t, next)
+	require.Len(t, failures, 2)
+	assert.Equal(t, filePath+"-a", failures[0].ID)
+	assert.Equal(t, filePath+"-b", failures[1].ID)
+}
+
+func TestStrReplaceFailureCursor(t *testing.T) {
+	cursor := StrReplaceFailureCursor{CreatedAt: time.Date(2026, 10, 17, 9, 0, 0, 123456000, time.UTC), ID: "templates/a.yaml-b"}
+
+	decoded, err := DecodeStrReplaceFailureCursor(EncodeStrReplaceFailureCursor(cursor))
+	require.NoError(t, err)
+	assert.Equal(t, cursor, *decoded)
+
+	for _, invalid := range []string{"not base64!", "bm8gc2xhc2g", "bm90LWEtdGltZS9pZA"} {
+		_, err := DecodeStrReplaceFailureCursor(invalid)
+		assert.ErrorIs(t, err, ErrInvalidStrReplaceFailureCursor, invalid)
+	}
+}
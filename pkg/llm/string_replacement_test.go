@@ -2,8 +2,14 @@ package llm
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPerformStringReplacement(t *testing.T) {
@@ -49,6 +55,14 @@ func TestPerformStringReplacement(t *testing.T) {
 			wantContent: "Hello, world! a test.",
 			wantSuccess: true,
 		},
+		{
+			name:        "CRLF content with LF old string",
+			content:     "replicaCount: 1\r\nimage:\r\n  repository: nginx\r\n  tag: 1.25.0\r\n",
+			oldStr:      "image:\n  repository: nginx\n  tag: 1.25.0\n",
+			newStr:      "image:\n  repository: nginx\n  tag: 1.27.0\n",
+			wantContent: "replicaCount: 1\r\nimage:\r\n  repository: nginx\r\n  tag: 1.27.0\r\n",
+			wantSuccess: true,
+		},
 		{
 			name:        "Real world success - Chart.yaml dependencies",
 			content:     "dependencies:\n- condition: ingress-nginx.enabled\n  name: ingress-nginx\n  repository: https://kubernetes.github.io/ingress-nginx\n  version: 4.12.0\n- alias: okteto-nginx\n  condition: okteto-nginx.enabled\n  name: ingress-nginx\n  repository: https://kubernetes.github.io/ingress-nginx\n  version: 4.12.0",
@@ -99,3 +113,19 @@ func TestPerformStringReplacement(t *testing.T) {
 		})
 	}
 }
+
+func TestPerformStringReplacementFuzzyMatchTimeout(t *testing.T) {
+	t.Setenv("CHARTSMITH_TIMEOUT_FUZZY_MATCH", "1ns")
+	require.NoError(t, param.Init(nil))
+	t.Cleanup(func() {
+		os.Unsetenv("CHARTSMITH_TIMEOUT_FUZZY_MATCH")
+		require.NoError(t, param.Init(nil))
+	})
+
+	content := strings.Repeat("replicaCount: 1\nimage: nginx:1.25\n", 2000)
+	oldStr := strings.Repeat("replicaCount: 2\nimage: nginx:1.26\n", 5)
+
+	_, found, err := PerformStringReplacement(content, oldStr, "replaced")
+	assert.False(t, found)
+	assert.EqualError(t, err, "fuzzy matching timed out after 1ns")
+}
@@ -2,7 +2,6 @@ package llm
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -10,13 +9,10 @@ import (
 	"time"
 
 	anthropic "github.com/anthropics/anthropic-sdk-go"
-	"github.com/jackc/pgx/v5"
 	"github.com/jpoz/groq"
 	"github.com/ollama/ollama/api"
 	ollama "github.com/ollama/ollama/api"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
-	"github.com/replicatedhq/chartsmith/pkg/param"
-	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
@@ -25,35 +21,31 @@ import (
 var (
 	// 5 requests per second with burst of 10
 	claudeRateLimiter = rate.NewLimiter(rate.Every(200*time.Millisecond), 10)
-	// Debug flag to bypass cache
-	bypassCache = false // We can set this to false after testing
 )
 
 // SummarizeContent will summarize the content of a helm chart file.
-// It will first check if the content has already been summarized, and if so, return the cached summary.
-// If not, it will summarize the content and cache the result.
+// Summaries are cached by content and model, identical files in other workspaces reuse them unless
+// CHARTSMITH_SUMMARY_CACHE_DISABLED is true. A cache that can't be read is skipped.
 func SummarizeContent(ctx context.Context, content string) (string, error) {
 	if content == "" {
 		return "", nil
 	}
 
-	conn := persistence.MustGetPooledPostgresSession()
-	defer conn.Release()
-
-	sha256 := sha256.Sum256([]byte(content))
-
-	if !bypassCache {
-		query := `SELECT summary FROM summary_cache WHERE content_sha256 = $1`
-		row := conn.QueryRow(ctx, query, fmt.Sprintf("%x", sha256))
-		var summary string
-		err := row.Scan(&summary)
-		if err == nil {
+	model := ModelFor(OperationSummarize)
+	cacheKey := summaryCacheKey(model, content)
+	cacheEnabled := summaryCacheEnabled()
+
+	if cacheEnabled {
+		summary, ok, err := getCachedSummary(ctx, cacheKey)
+		if err != nil {
+			summaryCacheErrors.Add(1)
+			logger.Warn("failed to get cached summary", zap.Error(err))
+		} else if ok {
+			summaryCacheHits.Add(1)
 			logger.Debug("Found cached summary")
 			return summary, nil
-		}
-
-		if err != pgx.ErrNoRows {
-			return "", fmt.Errorf("failed to query summary cache: %w", err)
+		} else {
+			summaryCacheMisses.Add(1)
 		}
 	}
 
@@ -87,11 +79,12 @@ func SummarizeContent(ctx context.Context, content string) (string, error) {
 		return "", fmt.Errorf("all attempts to summarize content failed: %w", lastErr)
 	}
 
-	// Cache the successful result
-	insertQuery := `INSERT INTO summary_cache (content_sha256, summary) VALUES ($1, $2)`
-	if _, err := conn.Exec(ctx, insertQuery, fmt.Sprintf("%x", sha256), summary); err != nil {
-		logger.Error(fmt.Errorf("failed to insert summary into cache: %w", err))
-		// Don't return error here, we still have the summary
+	if cacheEnabled {
+		if err := setCachedSummary(ctx, cacheKey, model, summary); err != nil {
+			summaryCacheErrors.Add(1)
+			// Don't return error here, we still have the summary
+			logger.Warn("failed to cache summary", zap.Error(err))
+		}
 	}
 
 	return summary, nil
@@ -108,15 +101,23 @@ func summarizeContentWithClaude(ctx context.Context, content string) (string, er
 	logger.Debug("Sending request to Claude API")
 	startTime := time.Now()
 
-	resp, err := client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.F(anthropic.ModelClaude3_7Sonnet20250219),
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationSummarize)),
 		MaxTokens: anthropic.F(int64(8192)),
 		Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage))}),
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return "", err
+	}
+
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	resp, err := client.Messages.New(requestCtx, params)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to summarize content: %w", err)
 	}
+	recordAnthropicUsage(ctx, OperationSummarize, resp)
 
 	logger.Debug("Received response from Claude API",
 		zap.Duration("duration", time.Since(startTime)))
@@ -125,11 +126,9 @@ func summarizeContentWithClaude(ctx context.Context, content string) (string, er
 }
 
 func summarizeContentWithGroq(ctx context.Context, content string) (string, error) {
-	client := groq.NewClient(groq.WithAPIKey(param.Get().GroqAPIKey))
-
 	userMessage := "My helm chart includes the following file. Summarize it, including all names, variables, etc that it uses: " + content
 
-	chatCompletion, err := client.CreateChatCompletion(groq.CompletionCreateParams{
+	params := groq.CompletionCreateParams{
 		Model: "deepseek-r1-distill-llama-70b",
 		Messages: []groq.Message{
 			{
@@ -137,7 +136,12 @@ func summarizeContentWithGroq(ctx context.Context, content string) (string, erro
 				Content: userMessage,
 			},
 		},
-	})
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return "", err
+	}
+
+	chatCompletion, err := createGroqChatCompletion(ctx, params)
 
 	if err != nil {
 		return "", fmt.Errorf("failed to summarize content: %w", err)
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultSummaryCacheTTL is how long a summary is kept after it was last used
+	DefaultSummaryCacheTTL = 30 * 24 * time.Hour
+
+	// DefaultSummaryCacheMaxEntries is how many summaries are kept, the least recently used are
+	// pruned first
+	DefaultSummaryCacheMaxEntries = 100000
+
+	// SummaryCachePruneInterval is how often expired and excess summaries are pruned
+	SummaryCachePruneInterval = time.Hour
+)
+
+// these are vars so that summarizing can be tested without a database
+var (
+	getCachedSummary = getCachedSummaryFromDB
+	setCachedSummary = setCachedSummaryInDB
+)
+
+var (
+	summaryCacheHits   atomic.Int64
+	summaryCacheMisses atomic.Int64
+	summaryCacheErrors atomic.Int64
+)
+
+// SummaryCacheStats counts the lookups of the summary cache since the worker started
+type SummaryCacheStats struct {
+	Hits   int64
+	Misses int64
+	// Errors are lookups and writes that failed, the content is summarized without the cache
+	Errors int64
+}
+
+// GetSummaryCacheStats returns the lookups of the summary cache since the worker started
+func GetSummaryCacheStats() SummaryCacheStats {
+	return SummaryCacheStats{
+		Hits:   summaryCacheHits.Load(),
+		Misses: summaryCacheMisses.Load(),
+		Errors: summaryCacheErrors.Load(),
+	}
+}
+
+// summaryCacheEnabled is false when CHARTSMITH_SUMMARY_CACHE_DISABLED is true
+func summaryCacheEnabled() bool {
+	return !strings.EqualFold(strings.TrimSpace(param.Get().SummaryCacheDisabled), "true")
+}
+
+// summaryCacheKey addresses a summary by the content and the model that summarized it, so that
+// changing the summarize model doesn't serve summaries of the previous one
+func summaryCacheKey(model string, content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(model+"\n"+content)))
+}
+
+// getCachedSummaryFromDB returns the cached summary for a key and marks it used, false when there's none
+func getCachedSummaryFromDB(ctx context.Context, cacheKey string) (string, bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var summary string
+	err := conn.QueryRow(ctx, `UPDATE llm_summary_cache SET last_used_at = NOW() WHERE cache_key = $1 RETURNING summary`, cacheKey).Scan(&summary)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to query summary cache: %w", err)
+	}
+
+	return summary, true, nil
+}
+
+func setCachedSummaryInDB(ctx context.Context, cacheKey string, model string, summary string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO llm_summary_cache (cache_key, model, summary, created_at, last_used_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (cache_key) DO UPDATE SET summary = EXCLUDED.summary, last_used_at = EXCLUDED.last_used_at`
+	if _, err := conn.Exec(ctx, query, cacheKey, model, summary); err != nil {
+		return fmt.Errorf("failed to insert summary cache: %w", err)
+	}
+
+	return nil
+}
+
+// PruneSummaryCache deletes the summaries that weren't used within ttl, then the least recently
+// used summaries beyond maxEntries
+func PruneSummaryCache(ctx context.Context, ttl time.Duration, maxEntries int) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	expired, err := conn.Exec(ctx, `DELETE FROM llm_summary_cache WHERE last_used_at < $1`, time.Now().Add(-ttl))
+	if err != nil {
+		return fmt.Errorf("failed to prune expired summaries: %w", err)
+	}
+
+	excess, err := conn.Exec(ctx, `DELETE FROM llm_summary_cache WHERE cache_key IN (
+		SELECT cache_key FROM llm_summary_cache ORDER BY last_used_at DESC OFFSET $1
+	)`, maxEntries)
+	if err != nil {
+		return fmt.Errorf("failed to prune excess summaries: %w", err)
+	}
+
+	if expired.RowsAffected() > 0 || excess.RowsAffected() > 0 {
+		logger.Info("Pruned summary cache",
+			zap.Int64("expired", expired.RowsAffected()),
+			zap.Int64("excess", excess.RowsAffected()))
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubSummaryCache replaces the summary cache table with a map, getErr fails every lookup
+func stubSummaryCache(t *testing.T, getErr error) map[string]string {
+	t.Helper()
+	cache := map[string]string{}
+	originalGet, originalSet := getCachedSummary, setCachedSummary
+	t.Cleanup(func() { getCachedSummary, setCachedSummary = originalGet, originalSet })
+
+	getCachedSummary = func(ctx context.Context, cacheKey string) (string, bool, error) {
+		if getErr != nil {
+			return "", false, getErr
+		}
+		summary, ok := cache[cacheKey]
+		return summary, ok, nil
+	}
+	setCachedSummary = func(ctx context.Context, cacheKey string, model string, summary string) error {
+		cache[cacheKey] = summary
+		return nil
+	}
+	return cache
+}
+
+func TestSummarizeContentCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		disabled  string
+		getErr    error
+		wantCalls int
+		wantStats SummaryCacheStats
+	}{
+		{name: "cached", wantCalls: 1, wantStats: SummaryCacheStats{Hits: 1, Misses: 1}},
+		{name: "disabled", disabled: "true", wantCalls: 2},
+		{name: "cache unavailable", getErr: errors.New("connection refused"), wantCalls: 2, wantStats: SummaryCacheStats{Errors: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ANTHROPIC_API_KEY", "test")
+			t.Setenv("CHARTSMITH_SUMMARY_CACHE_DISABLED", tt.disabled)
+			require.NoError(t, param.Init(nil))
+			fake := newFakeAnthropic(t)
+			fake.text = "a ConfigMap named from the fullname helper"
+			stubSummaryCache(t, tt.getErr)
+			before := GetSummaryCacheStats()
+
+			for i := 0; i < 2; i++ {
+				summary, err := SummarizeContent(context.Background(), "kind: ConfigMap\n")
+				require.NoError(t, err)
+				assert.Equal(t, "a ConfigMap named from the fullname helper", summary)
+			}
+
+			assert.Len(t, fake.models, tt.wantCalls)
+			after := GetSummaryCacheStats()
+			assert.Equal(t, tt.wantStats, SummaryCacheStats{
+				Hits:   after.Hits - before.Hits,
+				Misses: after.Misses - before.Misses,
+				Errors: after.Errors - before.Errors,
+			})
+		})
+	}
+}
+
+func TestSummarizeContentCacheModel(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+	fake := newFakeAnthropic(t)
+	cache := stubSummaryCache(t, nil)
+
+	_, err := SummarizeContent(context.Background(), "kind: Service\n")
+	require.NoError(t, err)
+
+	// a summary of the previous model isn't reused
+	t.Setenv("SUMMARIZE_MODEL", "claude-3-5-haiku-latest")
+	require.NoError(t, param.Init(nil))
+	_, err = SummarizeContent(context.Background(), "kind: Service\n")
+	require.NoError(t, err)
+
+	assert.Len(t, fake.models, 2)
+	assert.Len(t, cache, 2)
+}
@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var (
+	helperActionRegex = regexp.MustCompile(`(?s)\{\{-?(.*?)-?\}\}`)
+	helperDefineRegex = regexp.MustCompile(`^define\s+"([^"]+)"\s*$`)
+	helperFieldRegex  = regexp.MustCompile(`(^|[\s(|,])\.(\w+)`)
+
+	helperQuotedStringRegex = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|` + "`[^`]*`")
+)
+
+// builtin objects that mean a helper expects the root context
+var helperRootObjects = map[string]bool{
+	"Values":       true,
+	"Chart":        true,
+	"Release":      true,
+	"Capabilities": true,
+	"Template":     true,
+	"Files":        true,
+}
+
+// helperDefinition is a named template defined in a .tpl file
+type helperDefinition struct {
+	Name      string
+	FilePath  string
+	Signature string
+}
+
+// getDefinedHelpers returns the named templates defined in the .tpl files, sorted by name.
+// The signature is inferred from the fields the helper reads from ".": helpers that read the
+// builtin objects take the root context, helpers that read other fields take a dict with those keys.
+func getDefinedHelpers(files []workspacetypes.File) []helperDefinition {
+	helpers := []helperDefinition{}
+
+	for _, file := range files {
+		if filepath.Ext(file.FilePath) != ".tpl" {
+			continue
+		}
+
+		// every open block, so that "end" closes the right one. fields are only recorded while "."
+		// is still the define's argument, i.e. not inside a with or range
+		type block struct {
+			define     *helperDefinition
+			fields     map[string]bool
+			dotChanged bool
+		}
+		blocks := []block{}
+
+		for _, match := range helperActionRegex.FindAllStringSubmatch(file.Content, -1) {
+			action := strings.TrimSpace(match[1])
+			if action == "" || strings.HasPrefix(action, "/*") {
+				continue
+			}
+			keyword := strings.Fields(action)[0]
+
+			if m := helperDefineRegex.FindStringSubmatch(action); m != nil {
+				blocks = append(blocks, block{
+					define: &helperDefinition{Name: m[1], FilePath: file.FilePath},
+					fields: map[string]bool{},
+				})
+				continue
+			}
+
+			// the define that "." currently belongs to, if any
+			var fields map[string]bool
+			for i := len(blocks) - 1; i >= 0; i-- {
+				if blocks[i].define != nil {
+					fields = blocks[i].fields
+					break
+				}
+				if blocks[i].dotChanged {
+					break
+				}
+			}
+			if fields != nil {
+				for _, m := range helperFieldRegex.FindAllStringSubmatch(helperQuotedStringRegex.ReplaceAllString(action, `""`), -1) {
+					fields[m[2]] = true
+				}
+			}
+
+			switch keyword {
+			case "if", "block":
+				blocks = append(blocks, block{})
+			case "with", "range":
+				blocks = append(blocks, block{dotChanged: true})
+			case "end":
+				if len(blocks) == 0 {
+					continue
+				}
+				closed := blocks[len(blocks)-1]
+				blocks = blocks[:len(blocks)-1]
+				if closed.define != nil {
+					closed.define.Signature = helperSignature(closed.define.Name, closed.fields)
+					helpers = append(helpers, *closed.define)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(helpers, func(i, j int) bool {
+		return helpers[i].Name < helpers[j].Name
+	})
+
+	return helpers
+}
+
+func helperSignature(name string, fields map[string]bool) string {
+	keys := []string{}
+	for field := range fields {
+		if helperRootObjects[field] {
+			return fmt.Sprintf(`include %q .`, name)
+		}
+		keys = append(keys, field)
+	}
+	if len(keys) == 0 {
+		return fmt.Sprintf(`include %q .`, name)
+	}
+
+	sort.Strings(keys)
+	args := []string{}
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf(`%q <%s>`, key, key))
+	}
+	return fmt.Sprintf(`include %q (dict %s)`, name, strings.Join(args, " "))
+}
+
+// formatDefinedHelpers lists the helpers for the planner, so it reuses them instead of defining new ones
+func formatDefinedHelpers(helpers []helperDefinition) string {
+	var sb strings.Builder
+	sb.WriteString("The chart defines the following template helpers. Use them by name instead of duplicating their logic:\n")
+	for _, helper := range helpers {
+		sb.WriteString(fmt.Sprintf("- %s (defined in %s): {{ %s }}\n", helper.Name, helper.FilePath, helper.Signature))
+	}
+	return sb.String()
+}
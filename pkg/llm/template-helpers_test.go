@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"testing"
+
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testHelpersTpl = `{{/*
+Expand the name of the chart.
+*/}}
+{{- define "myapp.name" -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" }}
+{{- end }}
+
+{{/*
+Create a default fully qualified app name.
+*/}}
+{{- define "myapp.fullname" -}}
+{{- if .Values.fullnameOverride }}
+{{- .Values.fullnameOverride | trunc 63 | trimSuffix "-" }}
+{{- else }}
+{{- $name := default .Chart.Name .Values.nameOverride }}
+{{- if contains $name .Release.Name }}
+{{- .Release.Name | trunc 63 | trimSuffix "-" }}
+{{- else }}
+{{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{/*
+Common labels
+*/}}
+{{- define "myapp.labels" -}}
+helm.sh/chart: {{ printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" }}
+{{ include "myapp.selectorLabels" . }}
+{{- with .Chart.AppVersion }}
+app.kubernetes.io/version: {{ . | quote }}
+{{- end }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- end }}
+
+{{/*
+Selector labels
+*/}}
+{{- define "myapp.selectorLabels" -}}
+app.kubernetes.io/name: {{ include "myapp.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end }}
+
+{{/*
+Render an image reference, called with a dict
+*/}}
+{{- define "myapp.image" -}}
+{{- $tag := default .defaultTag .image.tag }}
+{{- with .image }}
+{{- printf "%s:%s" .repository $tag }}
+{{- end }}
+{{- end }}
+`
+
+func TestGetDefinedHelpers(t *testing.T) {
+	helpers := getDefinedHelpers([]workspacetypes.File{
+		{FilePath: "templates/_helpers.tpl", Content: testHelpersTpl},
+		{FilePath: "templates/deployment.yaml", Content: `{{ define "ignored" }}{{ end }}`},
+	})
+
+	assert.Equal(t, []helperDefinition{
+		{Name: "myapp.fullname", FilePath: "templates/_helpers.tpl", Signature: `include "myapp.fullname" .`},
+		{Name: "myapp.image", FilePath: "templates/_helpers.tpl", Signature: `include "myapp.image" (dict "defaultTag" <defaultTag> "image" <image>)`},
+		{Name: "myapp.labels", FilePath: "templates/_helpers.tpl", Signature: `include "myapp.labels" .`},
+		{Name: "myapp.name", FilePath: "templates/_helpers.tpl", Signature: `include "myapp.name" .`},
+		{Name: "myapp.selectorLabels", FilePath: "templates/_helpers.tpl", Signature: `include "myapp.selectorLabels" .`},
+	}, helpers)
+}
+
+func TestGetDefinedHelpersNested(t *testing.T) {
+	helpers := getDefinedHelpers([]workspacetypes.File{
+		{FilePath: "templates/_outer.tpl", Content: `{{- define "outer" -}}
+{{- define "inner" -}}{{ .name }}{{- end -}}
+{{ if .enabled }}{{ .Values.x }}{{ end }}
+{{- end -}}`},
+		{FilePath: "templates/_other.tpl", Content: `{{ define "other" }}{{ range .items }}{{ .name }}{{ end }}{{ end }}`},
+	})
+
+	assert.Equal(t, []helperDefinition{
+		{Name: "inner", FilePath: "templates/_outer.tpl", Signature: `include "inner" (dict "name" <name>)`},
+		{Name: "other", FilePath: "templates/_other.tpl", Signature: `include "other" (dict "items" <items>)`},
+		{Name: "outer", FilePath: "templates/_outer.tpl", Signature: `include "outer" .`},
+	}, helpers)
+}
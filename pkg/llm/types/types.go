@@ -1,7 +1,10 @@
 package types
 
 type ActionPlanWithPath struct {
-	Path       string `json:"path"`
+	Path    string `json:"path"`
+	ChartID string `json:"chartId,omitempty"` // empty means the first chart in the workspace
+	// ReviewNote is the reviewer's note on the file, the LLM adjusts the change to it
+	ReviewNote string `json:"reviewNote,omitempty"`
 	ActionPlan `json:",inline"`
 }
 
@@ -11,6 +14,7 @@ const (
 	ActionPlanStatusPending  ActionPlanStatus = "pending"
 	ActionPlanStatusCreating ActionPlanStatus = "creating"
 	ActionPlanStatusCreated  ActionPlanStatus = "created"
+	ActionPlanStatusFailed   ActionPlanStatus = "failed"
 )
 
 type ActionPlan struct {
@@ -19,7 +23,23 @@ type ActionPlan struct {
 	Status ActionPlanStatus `json:"status"`
 }
 
+// SkippedActionPlan is an action of a plan that wasn't queued because it's malformed, such as an
+// unknown action or a path outside the chart
+type SkippedActionPlan struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
 type Artifact struct {
 	Path    string
 	Content string
 }
+
+// InterimContent is the content of a file while an action is changing it. Version increases with
+// every change, so a consumer that sees it skip knows that intermediate states were dropped.
+type InterimContent struct {
+	Version int
+	Content string
+}
@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/chartunittest"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// maxEnrichedTestCases bounds the test cases the LLM adds to each suite
+const maxEnrichedTestCases = 5
+
+// ErrChartNotRendered is returned when tests are generated for a chart without a successful render
+// of the current revision, the generated assertions come from the rendered output
+var ErrChartNotRendered = errors.New("chart has no successful render of the current revision")
+
+// GeneratedUnitTests is the suite written for a template
+type GeneratedUnitTests struct {
+	TemplatePath string `json:"templatePath"`
+	// FilePath is the path of the suite in the chart, such as tests/deployment_test.yaml
+	FilePath string `json:"filePath"`
+	Content  string `json:"content"`
+	// EnrichedCases is the number of test cases the LLM added to the generated ones
+	EnrichedCases int `json:"enrichedCases"`
+}
+
+// unitTestCase is a test case the LLM writes, with assertions in their helm-unittest form
+type unitTestCase struct {
+	It      string                   `json:"it"`
+	Set     map[string]interface{}   `json:"set"`
+	Asserts []map[string]interface{} `json:"asserts"`
+}
+
+// completeUnitTestCases is a var so that enrichment can be tested without an LLM
+var completeUnitTestCases = completeUnitTestCasesWithClaude
+
+// GenerateChartUnitTests writes a helm-unittest suite for each template of a chart in the current
+// revision of a workspace, as pending content for the user to review like any other change. With
+// no templates, every template that renders manifests gets a suite. The assertions are generated
+// from the latest render of the chart with its own values, enrich asks the LLM for test cases
+// that override values too.
+func GenerateChartUnitTests(ctx context.Context, workspaceID string, chartID string, templates []string, enrich bool) ([]GeneratedUnitTests, error) {
+	ctx = WithUsageAttribution(ctx, UsageAttribution{WorkspaceID: workspaceID})
+
+	w, err := workspace.GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	var chart *workspacetypes.Chart
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			chart = &w.Charts[i]
+		}
+	}
+	if chart == nil {
+		return nil, fmt.Errorf("%w: %s in workspace %s", workspace.ErrChartNotFound, chartID, workspaceID)
+	}
+
+	contents := map[string]string{}
+	for _, file := range chart.Files {
+		contents[file.FilePath] = file.Content
+	}
+
+	if len(templates) == 0 {
+		for _, file := range chart.Files {
+			if chartunittest.IsTestableTemplate(file.FilePath) {
+				templates = append(templates, file.FilePath)
+			}
+		}
+	}
+	for _, template := range templates {
+		if _, ok := contents[template]; !ok || !chartunittest.IsTestableTemplate(template) {
+			return nil, fmt.Errorf("%w: %s", chartunittest.ErrNotTemplate, template)
+		}
+	}
+
+	rendered, err := workspace.GetPreviousRenderedChart(ctx, w.ID, w.CurrentRevision, chart.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rendered chart: %w", err)
+	}
+	if rendered == nil {
+		return nil, fmt.Errorf("%w: %s", ErrChartNotRendered, chart.Name)
+	}
+	documents := chartunittest.RenderedDocuments(rendered.HelmTemplateStdout, chart.Name)
+
+	generated := []GeneratedUnitTests{}
+	for _, template := range templates {
+		suite := chartunittest.GenerateSuite(template, documents[template])
+
+		enriched := 0
+		if enrich {
+			enriched, err = EnrichUnitTestSuite(ctx, &suite, contents[template], contents["values.yaml"])
+			if err != nil {
+				// the generated cases are still worth writing
+				logger.Warn("failed to enrich unit tests", zap.String("template", template), zap.Error(err))
+			}
+		}
+
+		content, err := suite.YAML()
+		if err != nil {
+			return nil, err
+		}
+
+		filePath := chartunittest.TestFilePath(template)
+		if err := workspace.SetFileContentPending(ctx, filePath, w.CurrentRevision, chart.ID, w.ID, content, nil); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+
+		generated = append(generated, GeneratedUnitTests{
+			TemplatePath:  template,
+			FilePath:      filePath,
+			Content:       content,
+			EnrichedCases: enriched,
+		})
+	}
+
+	return generated, nil
+}
+
+// EnrichUnitTestSuite asks the LLM for test cases that render the template with overridden values,
+// and adds the valid ones to the suite. A case is dropped when it doesn't set a value or has an
+// assertion helm-unittest doesn't know. It returns the number of cases added.
+func EnrichUnitTestSuite(ctx context.Context, suite *chartunittest.Suite, templateContent string, valuesYAML string) (int, error) {
+	current, err := suite.YAML()
+	if err != nil {
+		return 0, err
+	}
+
+	cases, err := completeUnitTestCases(ctx, templateContent, valuesYAML, current)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write unit test cases: %w", err)
+	}
+
+	added := 0
+	for _, c := range cases {
+		if added == maxEnrichedTestCases {
+			break
+		}
+
+		testCase, err := parseUnitTestCase(c)
+		if err != nil {
+			logger.Debug("dropping generated unit test case", zap.String("it", c.It), zap.Error(err))
+			continue
+		}
+		suite.Tests = append(suite.Tests, testCase)
+		added++
+	}
+
+	return added, nil
+}
+
+func parseUnitTestCase(c unitTestCase) (chartunittest.TestCase, error) {
+	if strings.TrimSpace(c.It) == "" {
+		return chartunittest.TestCase{}, errors.New("no description")
+	}
+	if len(c.Set) == 0 {
+		return chartunittest.TestCase{}, errors.New("no values set")
+	}
+	if len(c.Asserts) == 0 {
+		return chartunittest.TestCase{}, errors.New("no assertions")
+	}
+
+	testCase := chartunittest.TestCase{It: strings.TrimSpace(c.It), Set: c.Set}
+	for _, raw := range c.Asserts {
+		assertion, err := chartunittest.ParseAssertion(raw)
+		if err != nil {
+			return chartunittest.TestCase{}, err
+		}
+		testCase.Asserts = append(testCase.Asserts, assertion)
+	}
+	return testCase, nil
+}
+
+func completeUnitTestCasesWithClaude(ctx context.Context, templateContent string, valuesYAML string, suiteYAML string) ([]unitTestCase, error) {
+	client, err := newAnthropicClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic client: %w", err)
+	}
+
+	userMessage := fmt.Sprintf(`You are writing helm-unittest test cases for a Helm chart template.
+
+Template:
+%s
+
+values.yaml:
+%s
+
+The test suite already has these tests, which render the template with the chart's values:
+%s
+
+Write up to %d more test cases that each override values with "set" and assert how the output changes, such as a feature that's turned on or off, or a value that's copied into a manifest. Only use values the template reads.
+
+Respond with only a JSON object with a "tests" array. Each test has "it" (a short description), "set" (an object of dotted value paths to values) and "asserts" (helm-unittest assertions such as {"equal": {"path": "spec.replicas", "value": 3}, "documentIndex": 0} or {"hasDocuments": {"count": 0}}).`, templateContent, valuesYAML, suiteYAML, maxEnrichedTestCases)
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(ModelFor(OperationExecute)),
+		MaxTokens: anthropic.F(int64(4096)),
+		Messages:  anthropic.F([]anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(userMessage))}),
+	}
+	if err := guardSecrets(ctx, params); err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	requestCtx, cancel := withLLMRequestTimeout(ctx)
+	defer cancel()
+	resp, err := client.Messages.New(requestCtx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write unit test cases: %w", err)
+	}
+	recordAnthropicUsage(ctx, OperationExecute, resp)
+
+	logger.Debug("Wrote unit test cases", zap.Duration("duration", time.Since(startTime)))
+
+	if len(resp.Content) == 0 {
+		return nil, fmt.Errorf("empty unit test response")
+	}
+	return parseUnitTestCases(resp.Content[0].Text)
+}
+
+// parseUnitTestCases reads the JSON object out of a response, ignoring any text around it
+func parseUnitTestCases(text string) ([]unitTestCase, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil, fmt.Errorf("no JSON object in unit test response")
+	}
+
+	var response struct {
+		Tests []unitTestCase `json:"tests"`
+	}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse unit test response: %w", err)
+	}
+	return response.Tests, nil
+}
@@ -0,0 +1,48 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/chartunittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrichUnitTestSuiteKeepsValidCases(t *testing.T) {
+	original := completeUnitTestCases
+	t.Cleanup(func() { completeUnitTestCases = original })
+
+	completeUnitTestCases = func(ctx context.Context, templateContent string, valuesYAML string, suiteYAML string) ([]unitTestCase, error) {
+		return parseUnitTestCases(`Here are the tests:
+{"tests": [
+  {"it": "scales", "set": {"replicaCount": 3}, "asserts": [{"equal": {"path": "spec.replicas", "value": 3}, "documentIndex": 0}]},
+  {"it": "sets nothing", "set": {}, "asserts": [{"hasDocuments": {"count": 1}}]},
+  {"it": "made up assertion", "set": {"a": 1}, "asserts": [{"isAwesome": {}}]},
+  {"it": "disables the service", "set": {"service.enabled": false}, "asserts": [{"hasDocuments": {"count": 0}}]}
+]}`)
+	}
+
+	suite := chartunittest.GenerateSuite("templates/deployment.yaml", nil)
+	added, err := EnrichUnitTestSuite(context.Background(), &suite, "kind: Deployment", "replicaCount: 1")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, added)
+	require.Len(t, suite.Tests, 3)
+	assert.Equal(t, "scales", suite.Tests[1].It)
+	assert.Equal(t, 0, *suite.Tests[1].Asserts[0].DocumentIndex)
+	assert.Equal(t, "disables the service", suite.Tests[2].It)
+
+	content, err := suite.YAML()
+	require.NoError(t, err)
+	assert.Contains(t, content, "    set:\n      replicaCount: 3\n")
+}
+
+func TestParseUnitTestCases(t *testing.T) {
+	_, err := parseUnitTestCases("I can't write tests for this template")
+	assert.Error(t, err)
+
+	cases, err := parseUnitTestCases(`{"tests": []}`)
+	require.NoError(t, err)
+	assert.Empty(t, cases)
+}
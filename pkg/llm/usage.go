@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"context"
+	"sync/atomic"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/jpoz/groq"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// UsageAttribution is what LLM calls made with a context are made for, so their token usage
+// can be attributed to a workspace, plan or chat message
+type UsageAttribution struct {
+	WorkspaceID   string
+	PlanID        string
+	ChatMessageID string
+}
+
+type usageAttributionKey struct{}
+
+// WithUsageAttribution returns a context that attributes the usage of LLM calls made with it.
+// Empty fields are inherited from any attribution already on ctx.
+func WithUsageAttribution(ctx context.Context, attribution UsageAttribution) context.Context {
+	existing := usageAttributionFromContext(ctx)
+	if attribution.WorkspaceID == "" {
+		attribution.WorkspaceID = existing.WorkspaceID
+	}
+	if attribution.PlanID == "" {
+		attribution.PlanID = existing.PlanID
+	}
+	if attribution.ChatMessageID == "" {
+		attribution.ChatMessageID = existing.ChatMessageID
+	}
+	return context.WithValue(ctx, usageAttributionKey{}, attribution)
+}
+
+func usageAttributionFromContext(ctx context.Context) UsageAttribution {
+	if attribution, ok := ctx.Value(usageAttributionKey{}).(UsageAttribution); ok {
+		return attribution
+	}
+	return UsageAttribution{}
+}
+
+// UsageMeter adds up the tokens of the LLM calls made with a context it's on, so that a caller
+// can stop once it has spent a budget. It's safe to share between goroutines.
+type UsageMeter struct {
+	inputTokens  atomic.Int64
+	outputTokens atomic.Int64
+}
+
+type usageMeterKey struct{}
+
+// WithUsageMeter returns a context whose LLM calls are added to meter
+func WithUsageMeter(ctx context.Context, meter *UsageMeter) context.Context {
+	return context.WithValue(ctx, usageMeterKey{}, meter)
+}
+
+// Tokens returns the input and output tokens metered so far
+func (m *UsageMeter) Tokens() (int64, int64) {
+	return m.inputTokens.Load(), m.outputTokens.Load()
+}
+
+// recordUsage writes usage, tests replace it to capture usage without a database
+var recordUsage = workspace.RecordLLMUsage
+
+// recordAnthropicUsage records the usage of a message. For streaming calls, pass the message the
+// events were accumulated into: its output tokens are from the final message_delta event.
+func recordAnthropicUsage(ctx context.Context, op Operation, message *anthropic.Message) {
+	if message == nil {
+		return
+	}
+	model := string(message.Model)
+	if model == "" {
+		model = ModelFor(op)
+	}
+	recordLLMUsage(ctx, op, model, message.Usage.InputTokens, message.Usage.OutputTokens)
+}
+
+// recordGroqUsage records the usage reported by Groq, which may leave the token counts out
+func recordGroqUsage(ctx context.Context, op Operation, model string, usage *groq.Usage) {
+	if usage == nil {
+		return
+	}
+	var inputTokens, outputTokens int64
+	if usage.PromptTokens != nil {
+		inputTokens = int64(*usage.PromptTokens)
+	}
+	if usage.CompletionTokens != nil {
+		outputTokens = int64(*usage.CompletionTokens)
+	}
+	recordLLMUsage(ctx, op, model, inputTokens, outputTokens)
+}
+
+// recordLLMUsage never fails the call it's recording, a missing usage row is only logged
+func recordLLMUsage(ctx context.Context, op Operation, model string, inputTokens int64, outputTokens int64) {
+	if meter, ok := ctx.Value(usageMeterKey{}).(*UsageMeter); ok {
+		meter.inputTokens.Add(inputTokens)
+		meter.outputTokens.Add(outputTokens)
+	}
+
+	attribution := usageAttributionFromContext(ctx)
+	usage := workspacetypes.LLMUsage{
+		WorkspaceID:   attribution.WorkspaceID,
+		PlanID:        attribution.PlanID,
+		ChatMessageID: attribution.ChatMessageID,
+		Operation:     string(op),
+		Model:         model,
+		InputTokens:   inputTokens,
+		OutputTokens:  outputTokens,
+
+		PromptVersions: promptVersionsFromContext(ctx),
+	}
+
+	if err := recordUsage(ctx, usage); err != nil {
+		logger.Warn("failed to record llm usage",
+			zap.String("workspace_id", usage.WorkspaceID),
+			zap.String("operation", usage.Operation),
+			zap.Error(err))
+	}
+}
+
+// streamGroqCompletion sends the content of a streaming completion to streamCh and records the
+// usage Groq reports on the final chunk. It returns ctx's error when ctx is done first.
+func streamGroqCompletion(ctx context.Context, op Operation, chatCompletion *groq.ChatCompletion, streamCh chan string) error {
+	var usage *groq.Usage
+	for delta := range chatCompletion.Stream {
+		if delta.XGroq != nil {
+			usage = &delta.XGroq.Usage
+		}
+		if len(delta.Choices) > 0 {
+			if err := sendContext(ctx, streamCh, delta.Choices[0].Delta.Content); err != nil {
+				return err
+			}
+		}
+	}
+	recordGroqUsage(ctx, op, ModelFor(op), usage)
+	return ctx.Err()
+}
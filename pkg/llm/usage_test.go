@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageRecordedAndAggregated(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("PLAN_MODEL", "")
+	require.NoError(t, param.Init(nil))
+
+	fake := newFakeAnthropic(t)
+
+	originalListValuesProfiles := listValuesProfiles
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return nil, nil
+	}
+	t.Cleanup(func() { listValuesProfiles = originalListValuesProfiles })
+	stubUserConventions(t, nil)
+
+	ctx := WithUsageAttribution(context.Background(), UsageAttribution{WorkspaceID: "workspace"})
+	ctx = WithUsageAttribution(ctx, UsageAttribution{PlanID: "plan"})
+
+	_, err := ExpandPrompt(ctx, "add an ingress")
+	require.NoError(t, err)
+
+	w := twoChartPlanWorkspace()
+	streamCh := make(chan string, 10)
+	doneCh := make(chan error, 2)
+	require.NoError(t, CreatePlan(ctx, streamCh, doneCh, CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "add an ingress"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		IsUpdate:     true,
+	}))
+	assert.NoError(t, <-doneCh)
+	assert.Equal(t, "expanded", <-streamCh)
+
+	_, err = summarizeContentWithClaude(ctx, "kind: Service")
+	require.NoError(t, err)
+
+	require.Len(t, fake.usage, 3)
+	for _, usage := range fake.usage {
+		assert.Equal(t, "workspace", usage.WorkspaceID)
+		assert.Equal(t, "plan", usage.PlanID)
+		assert.Equal(t, Model_Sonnet37, usage.Model)
+		// streaming usage is the final message_delta count, not the placeholder in message_start
+		assert.Equal(t, int64(120), usage.InputTokens)
+		assert.Equal(t, int64(30), usage.OutputTokens)
+	}
+	assert.Equal(t, []string{"plan", "plan", "summarize"}, []string{fake.usage[0].Operation, fake.usage[1].Operation, fake.usage[2].Operation})
+
+	summary := workspace.AggregateUsage("workspace", fake.usage)
+	assert.Equal(t, int64(3), summary.Calls)
+	assert.Equal(t, int64(360), summary.InputTokens)
+	assert.Equal(t, int64(90), summary.OutputTokens)
+	require.Len(t, summary.Totals, 2)
+	assert.Equal(t, "plan", summary.Totals[0].Operation)
+	assert.Equal(t, int64(2), summary.Totals[0].Calls)
+	assert.Equal(t, int64(240), summary.Totals[0].InputTokens)
+	assert.Equal(t, int64(60), summary.Totals[0].OutputTokens)
+	assert.Equal(t, "summarize", summary.Totals[1].Operation)
+	assert.Equal(t, int64(1), summary.Totals[1].Calls)
+}
+
+func TestUsageAttributionWithoutContext(t *testing.T) {
+	assert.Equal(t, UsageAttribution{}, usageAttributionFromContext(context.Background()))
+}
+
+func TestUsageMeter(t *testing.T) {
+	originalRecordUsage := recordUsage
+	recordUsage = func(ctx context.Context, usage workspacetypes.LLMUsage) error { return nil }
+	t.Cleanup(func() { recordUsage = originalRecordUsage })
+
+	meter := &UsageMeter{}
+	ctx := WithUsageMeter(context.Background(), meter)
+	recordLLMUsage(ctx, OperationExecute, Model_Sonnet37, 100, 20)
+	recordLLMUsage(ctx, OperationExecute, Model_Sonnet37, 50, 5)
+	// calls without the meter aren't counted
+	recordLLMUsage(context.Background(), OperationExecute, Model_Sonnet37, 1000, 1000)
+
+	inputTokens, outputTokens := meter.Tokens()
+	assert.Equal(t, int64(150), inputTokens)
+	assert.Equal(t, int64(25), outputTokens)
+}
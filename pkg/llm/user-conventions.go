@@ -0,0 +1,121 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// userConventionsTokenBudget is the estimated number of tokens of prompt snippets given with a
+// prompt. The snippet that crosses it is truncated and the ones after it are left out.
+const userConventionsTokenBudget = 2000
+
+// these are vars so that user conventions can be tested without a database
+var (
+	listAutoApplySnippets = workspace.ListAutoApplyPromptSnippets
+	auditAppliedSnippets  = workspace.Audit
+)
+
+// userConventions is the block of the prompt snippets that apply automatically to a workspace
+type userConventions struct {
+	Text string
+	// Applied are the names of the snippets in the block, in the order they're given
+	Applied []string
+	// Truncated are the names of the snippets that were cut short or left out to fit the budget
+	Truncated []string
+}
+
+// userConventionsMessages gives the LLM the prompt snippets the creator of a workspace applies to
+// every prompt, as a single message between markers. It returns no messages when there are none.
+func userConventionsMessages(ctx context.Context, workspaceID string) ([]anthropic.MessageParam, userConventions) {
+	if workspaceID == "" {
+		return nil, userConventions{}
+	}
+
+	snippets, err := listAutoApplySnippets(ctx, workspaceID)
+	if err != nil {
+		logger.WarnCtx(ctx, "failed to list prompt snippets", zap.String("workspaceID", workspaceID), zap.Error(err))
+		return nil, userConventions{}
+	}
+
+	conventions := formatUserConventions(snippets, userConventionsTokenBudget)
+	if len(conventions.Truncated) > 0 {
+		logger.WarnCtx(ctx, "Prompt snippets were truncated to fit the prompt",
+			zap.String("workspaceID", workspaceID),
+			zap.Strings("truncated", conventions.Truncated),
+			zap.Int("tokenBudget", userConventionsTokenBudget))
+	}
+	if conventions.Text == "" {
+		return nil, conventions
+	}
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(conventions.Text))}, conventions
+}
+
+// recordUserConventions adds the names of the snippets given to the LLM for a plan to the audit
+// log of the workspace, so that what the plan was asked to follow can be explained
+func recordUserConventions(ctx context.Context, workspaceID string, stage string, conventions userConventions) {
+	if len(conventions.Applied) == 0 {
+		return
+	}
+
+	payload := map[string]interface{}{
+		"planId":   usageAttributionFromContext(ctx).PlanID,
+		"stage":    stage,
+		"snippets": conventions.Applied,
+	}
+	if len(conventions.Truncated) > 0 {
+		payload["truncated"] = conventions.Truncated
+	}
+	if err := auditAppliedSnippets(ctx, workspaceID, workspace.AuditActorSystem, workspace.AuditPromptSnippetsApplied, payload); err != nil {
+		logger.WarnCtx(ctx, "failed to record applied prompt snippets", zap.String("workspaceID", workspaceID), zap.Error(err))
+	}
+}
+
+// formatUserConventions writes the snippets in order between markers, keeping whole lines of each
+// until tokenBudget is spent
+func formatUserConventions(snippets []workspacetypes.PromptSnippet, tokenBudget int) userConventions {
+	conventions := userConventions{}
+	if len(snippets) == 0 {
+		return conventions
+	}
+
+	remaining := tokenBudget * approxCharsPerToken
+	var sb strings.Builder
+	for _, snippet := range snippets {
+		header := fmt.Sprintf("--- %s ---\n", snippet.Name)
+		if remaining <= len(header) {
+			conventions.Truncated = append(conventions.Truncated, snippet.Name)
+			continue
+		}
+		remaining -= len(header)
+
+		content := strings.TrimSuffix(snippet.Content, "\n") + "\n"
+		if len(content) > remaining {
+			content = truncateFileContent(content, remaining) + "\n"
+			content += fmt.Sprintf("(%s was truncated from %d characters to fit in the prompt)\n", snippet.Name, len(snippet.Content))
+			conventions.Truncated = append(conventions.Truncated, snippet.Name)
+			remaining = 0
+		} else {
+			remaining -= len(content)
+		}
+
+		sb.WriteString(header)
+		sb.WriteString(content)
+		conventions.Applied = append(conventions.Applied, snippet.Name)
+	}
+	if len(conventions.Applied) == 0 {
+		return conventions
+	}
+
+	conventions.Text = "The user follows these conventions in every chart. Apply them to the changes unless the request says otherwise.\n" +
+		"=== BEGIN USER CONVENTIONS ===\n" +
+		sb.String() +
+		"=== END USER CONVENTIONS ==="
+	return conventions
+}
@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubUserConventions makes snippets the workspace's auto-apply prompt snippets and returns the
+// payloads of the audit events recorded for them
+func stubUserConventions(t *testing.T, snippets []workspacetypes.PromptSnippet) *[]map[string]interface{} {
+	originalList, originalAudit := listAutoApplySnippets, auditAppliedSnippets
+	t.Cleanup(func() { listAutoApplySnippets, auditAppliedSnippets = originalList, originalAudit })
+
+	recorded := []map[string]interface{}{}
+	listAutoApplySnippets = func(ctx context.Context, workspaceID string) ([]workspacetypes.PromptSnippet, error) {
+		return snippets, nil
+	}
+	auditAppliedSnippets = func(ctx context.Context, workspaceID string, actor string, eventType string, payload map[string]interface{}) error {
+		assert.Equal(t, workspace.AuditPromptSnippetsApplied, eventType)
+		recorded = append(recorded, payload)
+		return nil
+	}
+	return &recorded
+}
+
+func TestFormatUserConventions(t *testing.T) {
+	tests := []struct {
+		name          string
+		snippets      []workspacetypes.PromptSnippet
+		tokenBudget   int
+		wantApplied   []string
+		wantTruncated []string
+		wantText      []string
+	}{
+		{
+			name:        "none",
+			tokenBudget: 100,
+		},
+		{
+			name: "in order",
+			snippets: []workspacetypes.PromptSnippet{
+				{Name: "labels", Content: "Add app.kubernetes.io/part-of labels.\n"},
+				{Name: "naming", Content: "Prefix resource names with the release name."},
+			},
+			tokenBudget: 100,
+			wantApplied: []string{"labels", "naming"},
+			wantText: []string{
+				"=== BEGIN USER CONVENTIONS ===\n--- labels ---\nAdd app.kubernetes.io/part-of labels.\n--- naming ---\nPrefix resource names with the release name.\n=== END USER CONVENTIONS ===",
+			},
+		},
+		{
+			name: "over budget",
+			snippets: []workspacetypes.PromptSnippet{
+				{Name: "labels", Content: "Add app.kubernetes.io/part-of labels.\n"},
+				{Name: "naming", Content: strings.Repeat("Prefix resource names with the release name.\n", 10)},
+				{Name: "probes", Content: "Every container has liveness and readiness probes.\n"},
+			},
+			tokenBudget:   50,
+			wantApplied:   []string{"labels", "naming"},
+			wantTruncated: []string{"naming", "probes"},
+			wantText: []string{
+				"--- labels ---\nAdd app.kubernetes.io/part-of labels.\n--- naming ---\nPrefix resource names with the release name.\n",
+				"name.\n... (9 more lines truncated)\n(naming was truncated from 450 characters to fit in the prompt)\n=== END USER CONVENTIONS ===",
+			},
+		},
+		{
+			name: "budget spent by the first",
+			snippets: []workspacetypes.PromptSnippet{
+				{Name: "labels", Content: strings.Repeat("Add app.kubernetes.io/part-of labels.\n", 10)},
+				{Name: "naming", Content: "Prefix resource names with the release name."},
+			},
+			tokenBudget:   20,
+			wantApplied:   []string{"labels"},
+			wantTruncated: []string{"labels", "naming"},
+			wantText:      []string{"--- labels ---\nAdd app.kubernetes.io/part-of labels.\n... ("},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conventions := formatUserConventions(tt.snippets, tt.tokenBudget)
+			assert.Equal(t, tt.wantApplied, conventions.Applied)
+			assert.Equal(t, tt.wantTruncated, conventions.Truncated)
+			if len(tt.wantApplied) == 0 {
+				assert.Empty(t, conventions.Text)
+				return
+			}
+			for _, want := range tt.wantText {
+				assert.Contains(t, conventions.Text, want)
+			}
+			assert.NotContains(t, conventions.Text, "probes")
+			// the block stays near the budget, the truncation note is the only overrun
+			assert.Less(t, len(conventions.Text), tt.tokenBudget*approxCharsPerToken+250)
+		})
+	}
+}
+
+func TestPlanMessagesUserConventions(t *testing.T) {
+	original := listValuesProfiles
+	t.Cleanup(func() { listValuesProfiles = original })
+	listValuesProfiles = func(ctx context.Context, workspaceID string, chartID string) ([]workspacetypes.ValuesProfile, error) {
+		return []workspacetypes.ValuesProfile{{ChartID: "chart-backend", Name: "prod", Content: "replicaCount: 3\n"}}, nil
+	}
+	recorded := stubUserConventions(t, []workspacetypes.PromptSnippet{
+		{Name: "labels", Content: "Add app.kubernetes.io/part-of labels."},
+		{Name: "naming", Content: "Prefix resource names with the release name."},
+	})
+
+	w := twoChartPlanWorkspace()
+	opts := CreatePlanOpts{
+		ChatMessages: []workspacetypes.Chat{{Prompt: "add an ingress"}},
+		Workspace:    w,
+		Chart:        &w.Charts[0],
+		IsUpdate:     true,
+	}
+	ctx := WithUsageAttribution(context.Background(), UsageAttribution{WorkspaceID: w.ID, PlanID: "plan-1"})
+	_, messages := planMessages(ctx, opts, "File: values.yaml")
+	b, err := json.Marshal(messages)
+	require.NoError(t, err)
+	text := string(b)
+
+	// the conventions come after the instructions and the values profiles, before the chart and
+	// the conversation
+	instructions, err := json.Marshal(updatePlanInstructions)
+	require.NoError(t, err)
+	order := []string{
+		strings.Trim(string(instructions), `"`),
+		"Profile backend/values-prod.yaml",
+		"=== BEGIN USER CONVENTIONS ===",
+		"--- labels ---",
+		"--- naming ---",
+		"=== END USER CONVENTIONS ===",
+		"Chart structure: File: values.yaml",
+		"add an ingress",
+	}
+	last := -1
+	for _, want := range order {
+		index := strings.Index(text, want)
+		require.NotEqual(t, -1, index, "prompt is missing %q", want)
+		assert.Greater(t, index, last, "%q is out of order", want)
+		last = index
+	}
+
+	require.Len(t, *recorded, 1)
+	assert.Equal(t, "plan-1", (*recorded)[0]["planId"])
+	assert.Equal(t, "plan", (*recorded)[0]["stage"])
+	assert.Equal(t, []string{"labels", "naming"}, (*recorded)[0]["snippets"])
+	assert.NotContains(t, (*recorded)[0], "truncated")
+}
+
+func TestUserConventionsMessages(t *testing.T) {
+	recorded := stubUserConventions(t, nil)
+
+	messages, conventions := userConventionsMessages(context.Background(), "ws")
+	assert.Empty(t, messages)
+	recordUserConventions(context.Background(), "ws", "plan", conventions)
+	assert.Empty(t, *recorded, "nothing is recorded when no snippet applies")
+
+	messages, _ = userConventionsMessages(context.Background(), "")
+	assert.Empty(t, messages)
+
+	listAutoApplySnippets = func(ctx context.Context, workspaceID string) ([]workspacetypes.PromptSnippet, error) {
+		return nil, errors.New("database unavailable")
+	}
+	messages, conventions = userConventionsMessages(context.Background(), "ws")
+	assert.Empty(t, messages, "a prompt is still made when the snippets can't be listed")
+	assert.Empty(t, conventions.Applied)
+}
@@ -0,0 +1,389 @@
+package llm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// errValuesNotMapping is returned by mergeValuesNodes when either values isn't a single YAML
+// mapping, which the legacy merge appends as text
+var errValuesNotMapping = errors.New("values aren't a single mapping")
+
+// mergeValuesYAML merges the new values into the existing values. Mappings are merged key by key
+// and other values are replaced. Only the lines of the keys being added or changed are written,
+// so the order, comments and anchors of the rest of the existing values are kept. When that can't
+// be done, or CHARTSMITH_LEGACY_VALUES_MERGE is true, the top level keys of the new values replace
+// the existing ones and the result is re-marshaled, see legacyMergeValuesYAML.
+func mergeValuesYAML(existingYAML, newYAML string) (string, error) {
+	// Check if the newYAML is empty
+	if strings.TrimSpace(newYAML) == "" {
+		return existingYAML, nil
+	}
+
+	if legacyValuesMerge() {
+		return legacyMergeValuesYAML(existingYAML, newYAML)
+	}
+
+	merged, err := mergeValuesNodes(existingYAML, newYAML)
+	if err != nil {
+		if !errors.Is(err, errValuesNotMapping) {
+			logger.Warn("Failed to merge values in place, re-marshaling them", zap.Error(err))
+		}
+		return legacyMergeValuesYAML(existingYAML, newYAML)
+	}
+	return merged, nil
+}
+
+// legacyValuesMerge is true when CHARTSMITH_LEGACY_VALUES_MERGE is true
+func legacyValuesMerge() bool {
+	return strings.EqualFold(strings.TrimSpace(param.Get().LegacyValuesMerge), "true")
+}
+
+// legacyMergeValuesYAML replaces the top level keys of the existing values with the new values
+// and marshals the result, which expands anchors, drops comments and sorts the keys
+func legacyMergeValuesYAML(existingYAML, newYAML string) (string, error) {
+	// Try to parse both as YAML to see if they're valid
+	var existingValues, newValues map[string]interface{}
+	existingErr := yaml.Unmarshal([]byte(existingYAML), &existingValues)
+	newErr := yaml.Unmarshal([]byte(newYAML), &newValues)
+
+	// If either isn't valid YAML or is null after parsing, treat as text
+	if existingErr != nil || newErr != nil || existingValues == nil || newValues == nil {
+		logger.Info("One or both YAML files couldn't be parsed as maps, treating as text")
+		// Simple text append with a separator if both have content
+		if strings.TrimSpace(existingYAML) != "" && strings.TrimSpace(newYAML) != "" {
+			return existingYAML + "\n# Added by conversion\n" + newYAML, nil
+		}
+		// If existing is empty, just use new
+		if strings.TrimSpace(existingYAML) == "" {
+			return newYAML, nil
+		}
+		// Otherwise return existing
+		return existingYAML, nil
+	}
+
+	// Merge new values into existing values
+	for k, v := range newValues {
+		existingValues[k] = v
+	}
+
+	// Marshal back to YAML
+	mergedYAML, err := yaml.Marshal(existingValues)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal merged values: %w", err)
+	}
+
+	return string(mergedYAML), nil
+}
+
+// valuesEdit replaces lines[start:end] of the existing values, an insert when start is end
+type valuesEdit struct {
+	start int
+	end   int
+	lines []string
+}
+
+// valuesMerger merges values into the lines of an existing values.yaml
+type valuesMerger struct {
+	lines  []string
+	indent int
+	edits  []valuesEdit
+}
+
+// mergeValuesNodes merges newYAML into existingYAML by editing the lines of existingYAML. Keys
+// that are added are written after the last key of their mapping, and a key whose value changes is
+// written again, in both cases with the indentation of the mapping. Keys that are in both with
+// the same value aren't written. The result is parsed again and compared with the values merged
+// in memory, an error is returned when they differ, such as when a changed key has an anchor
+// that other keys are aliases of.
+func mergeValuesNodes(existingYAML string, newYAML string) (string, error) {
+	existing, err := parseValuesMapping(existingYAML)
+	if err != nil {
+		return "", err
+	}
+	incoming, err := parseValuesMapping(newYAML)
+	if err != nil {
+		return "", err
+	}
+
+	trailingNewline := strings.HasSuffix(existingYAML, "\n")
+	m := &valuesMerger{
+		lines:  strings.Split(strings.TrimSuffix(existingYAML, "\n"), "\n"),
+		indent: valuesIndent(existing),
+	}
+	if err := m.mergeMapping(existing, incoming, len(m.lines)); err != nil {
+		return "", err
+	}
+	if len(m.edits) == 0 {
+		return existingYAML, nil
+	}
+
+	merged := m.apply()
+	if trailingNewline {
+		merged += "\n"
+	}
+
+	if err := checkMergedValues(existingYAML, newYAML, merged); err != nil {
+		return "", err
+	}
+	return merged, nil
+}
+
+// parseValuesMapping parses values that are a single YAML document with a mapping at the top
+func parseValuesMapping(content string) (*yaml.Node, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	var doc yaml.Node
+	if err := decoder.Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, errValuesNotMapping
+		}
+		return nil, fmt.Errorf("%w: %v", errValuesNotMapping, err)
+	}
+	var next yaml.Node
+	if err := decoder.Decode(&next); err != io.EOF {
+		return nil, errValuesNotMapping
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode || len(doc.Content[0].Content) == 0 {
+		return nil, errValuesNotMapping
+	}
+	return doc.Content[0], nil
+}
+
+// mergeMapping merges incoming into existing, a block mapping whose last key ends before line end
+func (m *valuesMerger) mergeMapping(existing *yaml.Node, incoming *yaml.Node, end int) error {
+	column := existing.Content[0].Column - 1
+
+	additions := []*yaml.Node{}
+	for i := 0; i+1 < len(incoming.Content); i += 2 {
+		key, value := incoming.Content[i], incoming.Content[i+1]
+
+		index := -1
+		for j := 0; j+1 < len(existing.Content); j += 2 {
+			if existing.Content[j].Value == key.Value {
+				index = j
+			}
+		}
+		if index < 0 {
+			additions = append(additions, plainValuesKey(key), plainValuesNode(value))
+			continue
+		}
+
+		current := existing.Content[index+1]
+		if sameValues(current, value) {
+			continue
+		}
+		start, pairEnd := m.pairLines(existing, index, end)
+		if isBlockMapping(current) && current.Line > existing.Content[index].Line && value.Kind == yaml.MappingNode {
+			if err := m.mergeMapping(current, value, pairEnd); err != nil {
+				return err
+			}
+			continue
+		}
+
+		replacement := mergedValuesNode(current, value)
+		// aliases of the key keep working, with the new value
+		replacement.Anchor = current.Anchor
+		lines, err := m.render(column, []*yaml.Node{plainValuesKey(existing.Content[index]), replacement})
+		if err != nil {
+			return err
+		}
+		m.edits = append(m.edits, valuesEdit{start: start, end: pairEnd, lines: lines})
+	}
+
+	if len(additions) > 0 {
+		_, lastEnd := m.pairLines(existing, len(existing.Content)-2, end)
+		lines, err := m.render(column, additions)
+		if err != nil {
+			return err
+		}
+		m.edits = append(m.edits, valuesEdit{start: lastEnd, end: lastEnd, lines: lines})
+	}
+	return nil
+}
+
+// pairLines returns the lines of the key at index of a mapping and its value. The blank lines
+// and comments after the value that aren't indented more than the key are left out, they're
+// usually about the next key.
+func (m *valuesMerger) pairLines(mapping *yaml.Node, index int, end int) (int, int) {
+	key := mapping.Content[index]
+	start := key.Line - 1
+	pairEnd := end
+	if index+2 < len(mapping.Content) {
+		pairEnd = mapping.Content[index+2].Line - 1
+	}
+
+	column := key.Column - 1
+	for pairEnd > start+1 {
+		line := m.lines[pairEnd-1]
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if trimmed != "" && !(strings.HasPrefix(trimmed, "#") && indent <= column) {
+			break
+		}
+		pairEnd--
+	}
+	return start, pairEnd
+}
+
+// render writes key and value pairs as a mapping indented to column
+func (m *valuesMerger) render(column int, pairs []*yaml.Node) ([]string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(m.indent)
+	if err := encoder.Encode(&yaml.Node{Kind: yaml.MappingNode, Content: pairs}); err != nil {
+		return nil, fmt.Errorf("failed to encode values: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode values: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	prefix := strings.Repeat(" ", column)
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return lines, nil
+}
+
+// apply returns the existing lines with the edits made, later edits first so that the line
+// numbers of the earlier ones still hold
+func (m *valuesMerger) apply() string {
+	sort.SliceStable(m.edits, func(i, j int) bool {
+		return m.edits[i].start > m.edits[j].start
+	})
+	lines := m.lines
+	for _, edit := range m.edits {
+		edited := append([]string{}, lines[:edit.start]...)
+		edited = append(edited, edit.lines...)
+		lines = append(edited, lines[edit.end:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// valuesIndent returns how many spaces the existing values indent a nested mapping by, 2 when
+// there's none
+func valuesIndent(mapping *yaml.Node) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		value := mapping.Content[i+1]
+		if isBlockMapping(value) && value.Line > mapping.Content[i].Line {
+			if indent := value.Content[0].Column - mapping.Content[i].Column; indent > 0 {
+				return indent
+			}
+		}
+	}
+	return 2
+}
+
+func isBlockMapping(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0
+}
+
+// sameValues returns true if two nodes decode to the same value
+func sameValues(a *yaml.Node, b *yaml.Node) bool {
+	var decodedA, decodedB interface{}
+	if err := a.Decode(&decodedA); err != nil {
+		return false
+	}
+	if err := b.Decode(&decodedB); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(decodedA, decodedB)
+}
+
+// mergedValuesNode returns incoming merged into existing as a new node, mappings are merged key by
+// key and anything else is replaced
+func mergedValuesNode(existing *yaml.Node, incoming *yaml.Node) *yaml.Node {
+	if existing.Kind == yaml.AliasNode {
+		existing = existing.Alias
+	}
+	if existing.Kind != yaml.MappingNode || incoming.Kind != yaml.MappingNode {
+		return plainValuesNode(incoming)
+	}
+
+	merged := plainValuesNode(existing)
+	merged.Style = 0
+	for i := 0; i+1 < len(incoming.Content); i += 2 {
+		key, value := incoming.Content[i], incoming.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = mergedValuesNode(existing.Content[j+1], value)
+				found = true
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, plainValuesKey(key), plainValuesNode(value))
+		}
+	}
+	return merged
+}
+
+// plainValuesKey copies a mapping key without its comments, which are written with the lines
+// around it
+func plainValuesKey(key *yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: key.Kind, Tag: key.Tag, Value: key.Value, Style: key.Style}
+}
+
+// plainValuesNode copies a node with its aliases expanded and without anchors, so that it can be
+// written where the anchors it refers to aren't
+func plainValuesNode(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		return plainValuesNode(node.Alias)
+	}
+	copied := *node
+	copied.Anchor = ""
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = plainValuesNode(child)
+	}
+	return &copied
+}
+
+// checkMergedValues returns an error when merged doesn't decode to newYAML merged into existingYAML
+func checkMergedValues(existingYAML string, newYAML string, merged string) error {
+	var existing, incoming, got map[string]interface{}
+	if err := yaml.Unmarshal([]byte(existingYAML), &existing); err != nil {
+		return fmt.Errorf("failed to parse values: %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(newYAML), &incoming); err != nil {
+		return fmt.Errorf("failed to parse new values: %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(merged), &got); err != nil {
+		return fmt.Errorf("failed to parse merged values: %w", err)
+	}
+
+	want := mergeValueMaps(existing, incoming)
+	if !reflect.DeepEqual(want, got) {
+		return errors.New("merged values don't match the values being merged")
+	}
+	return nil
+}
+
+func mergeValueMaps(existing map[string]interface{}, incoming map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range existing {
+		merged[key] = value
+	}
+	for key, value := range incoming {
+		existingMap, existingIsMap := merged[key].(map[string]interface{})
+		incomingMap, incomingIsMap := value.(map[string]interface{})
+		if existingIsMap && incomingIsMap {
+			merged[key] = mergeValueMaps(existingMap, incomingMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const anchoredValuesYAML = `# Default values for web.
+replicaCount: 1
+
+defaults: &defaults
+  pullPolicy: IfNotPresent
+  # the registry every image is pulled from
+  registry: docker.io
+
+image:
+  <<: *defaults
+  repository: nginx
+  tag: "1.10"
+
+sidecar:
+  <<: *defaults
+  repository: envoy
+
+# ports the service listens on
+service:
+  type: ClusterIP
+  ports:
+    - 80
+    - 443
+
+resources: {}
+`
+
+// stubLegacyValuesMerge sets CHARTSMITH_LEGACY_VALUES_MERGE for a test
+func stubLegacyValuesMerge(t *testing.T, value string) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	t.Setenv("CHARTSMITH_LEGACY_VALUES_MERGE", value)
+	require.NoError(t, param.Init(nil))
+}
+
+// addedLines returns the lines that were added to before to get after, and fails the test when
+// any line was removed
+func addedLines(t *testing.T, before string, after string) []string {
+	t.Helper()
+	matcher := difflib.NewMatcher(difflib.SplitLines(before), difflib.SplitLines(after))
+	added := []string{}
+	for _, op := range matcher.GetOpCodes() {
+		switch op.Tag {
+		case 'e':
+		case 'i':
+			for _, line := range difflib.SplitLines(after)[op.J1:op.J2] {
+				added = append(added, strings.TrimSuffix(line, "\n"))
+			}
+		default:
+			t.Fatalf("lines %d to %d were changed:\n%s", op.I1+1, op.I2, after)
+		}
+	}
+	return added
+}
+
+func TestMergeValuesYAMLMinimalDiff(t *testing.T) {
+	stubLegacyValuesMerge(t, "")
+
+	tests := []struct {
+		name      string
+		newValues string
+		wantAdded []string
+	}{
+		{
+			name:      "top level key",
+			newValues: "ingress:\n  enabled: false\n  hosts:\n    - chart.local\n",
+			wantAdded: []string{"ingress:", "  enabled: false", "  hosts:", "    - chart.local"},
+		},
+		{
+			name:      "key of a nested mapping",
+			newValues: "service:\n  port: 8080\n",
+			wantAdded: []string{"  port: 8080"},
+		},
+		{
+			name:      "key of a mapping with a merge key",
+			newValues: "image:\n  digest: sha256:abc\n",
+			wantAdded: []string{"  digest: sha256:abc"},
+		},
+		{
+			name:      "values that are already there",
+			newValues: "replicaCount: 1\nimage:\n  repository: nginx\n",
+			wantAdded: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := mergeValuesYAML(anchoredValuesYAML, tt.newValues)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAdded, addedLines(t, anchoredValuesYAML, merged))
+		})
+	}
+}
+
+func TestMergeValuesYAML(t *testing.T) {
+	stubLegacyValuesMerge(t, "")
+
+	tests := []struct {
+		name      string
+		existing  string
+		newValues string
+		want      string
+	}{
+		{
+			name:      "changed value keeps its place and comments",
+			existing:  "# replicas\nreplicaCount: 1 # one is enough\n\n# the image\nimage: nginx\n",
+			newValues: "replicaCount: 3\n",
+			want:      "# replicas\nreplicaCount: 3\n\n# the image\nimage: nginx\n",
+		},
+		{
+			name:      "changed value of an anchor keeps the anchor",
+			existing:  "defaults: &defaults\n  tag: 1.0.0\nimage:\n  <<: *defaults\n  repository: nginx\n",
+			newValues: "defaults:\n  tag: 1.1.0\nimage:\n  tag: 1.0.0\n",
+			want:      "defaults: &defaults\n  tag: 1.1.0\nimage:\n  <<: *defaults\n  repository: nginx\n  tag: 1.0.0\n",
+		},
+		{
+			name:      "flow mapping is merged",
+			existing:  "resources: {}\nreplicaCount: 1\n",
+			newValues: "resources:\n  limits:\n    cpu: 100m\n",
+			want:      "resources:\n  limits:\n    cpu: 100m\nreplicaCount: 1\n",
+		},
+		{
+			name:      "indentation of the existing values",
+			existing:  "image:\n    repository: nginx\n",
+			newValues: "service:\n  ports:\n    http: 80\n",
+			want:      "image:\n    repository: nginx\nservice:\n    ports:\n        http: 80\n",
+		},
+		{
+			name:      "alias is replaced with its value merged",
+			existing:  "defaults: &defaults\n  tag: 1.0.0\nimage: *defaults\n",
+			newValues: "image:\n  repository: nginx\n",
+			want:      "defaults: &defaults\n  tag: 1.0.0\nimage:\n  tag: 1.0.0\n  repository: nginx\n",
+		},
+		{
+			name:      "empty existing values",
+			existing:  "",
+			newValues: "image: nginx\n",
+			want:      "image: nginx\n",
+		},
+		{
+			name:      "values that aren't a mapping are appended",
+			existing:  "image: nginx\n",
+			newValues: "- not a mapping\n",
+			want:      "image: nginx\n\n# Added by conversion\n- not a mapping\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := mergeValuesYAML(tt.existing, tt.newValues)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, merged)
+		})
+	}
+}
+
+func TestMergeValuesYAMLFallsBack(t *testing.T) {
+	tests := []struct {
+		name      string
+		legacy    string
+		existing  string
+		newValues string
+		want      string
+	}{
+		{
+			name:      "legacy merge",
+			legacy:    "true",
+			existing:  "# replicas\nreplicaCount: 1\nimage:\n  repository: nginx\n",
+			newValues: "image:\n  tag: latest\n",
+			want:      "image:\n    tag: latest\nreplicaCount: 1\n",
+		},
+		{
+			// the new value of the key with the anchor would change the key that's an alias of it
+			name:      "changed value of an anchor with an alias",
+			existing:  "defaults: &defaults\n  tag: 1.0.0\nimage: *defaults\n",
+			newValues: "defaults:\n  tag: 1.1.0\n",
+			want:      "defaults:\n    tag: 1.1.0\nimage:\n    tag: 1.0.0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubLegacyValuesMerge(t, tt.legacy)
+
+			merged, err := mergeValuesYAML(tt.existing, tt.newValues)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, merged)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/yamlpatch"
+	"go.uber.org/zap"
+)
+
+// textEditorToolDescription tells the model when to use yaml_patch and how to write its operations
+const textEditorToolDescription = `Edit files with view, create and str_replace. For values.yaml, use yaml_patch instead of str_replace: it edits the YAML structure and keeps comments and key order, so the file stays valid.
+yaml_patch takes "operations", applied in order:
+- {"op": "set", "path": "image.tag", "value": "1.25"} sets a value, creating the maps on the way to it
+- {"op": "delete", "path": "ingress.tls"} removes a key or list item
+- {"op": "append", "path": "tolerations", "value": {"key": "dedicated", "operator": "Exists"}} adds to the end of a list, creating it if it's missing
+Paths are keys separated by dots, with numbers for list items (ingress.hosts.0.host). Escape a dot that's part of a key with a backslash (podAnnotations.prometheus\.io/scrape). Values can be strings, numbers, booleans, lists or maps.`
+
+// yamlPatchInstructions is added to the instructions of an action on a values.yaml
+const yamlPatchInstructions = `
+		4. This is a values.yaml file, change it with "yaml_patch" rather than "str_replace". Use "str_replace" only for a change yaml_patch can't make, like rewording a comment.
+		`
+
+var (
+	valuesYAMLPatches        atomic.Int64
+	valuesYAMLPatchFailures  atomic.Int64
+	valuesStrReplaces        atomic.Int64
+	valuesStrReplaceFailures atomic.Int64
+	valuesCommentsRestored   atomic.Int64
+)
+
+// ValuesEditStats counts the edits made to values.yaml files by each command, to measure how often
+// yaml_patch is chosen over str_replace and how often each fails, and the comments the edits
+// dropped that were restored
+type ValuesEditStats struct {
+	YAMLPatches        int64
+	YAMLPatchFailures  int64
+	StrReplaces        int64
+	StrReplaceFailures int64
+	CommentsRestored   int64
+}
+
+// GetValuesEditStats returns the edits made to values.yaml files since the worker started
+func GetValuesEditStats() ValuesEditStats {
+	return ValuesEditStats{
+		YAMLPatches:        valuesYAMLPatches.Load(),
+		YAMLPatchFailures:  valuesYAMLPatchFailures.Load(),
+		StrReplaces:        valuesStrReplaces.Load(),
+		StrReplaceFailures: valuesStrReplaceFailures.Load(),
+		CommentsRestored:   valuesCommentsRestored.Load(),
+	}
+}
+
+// isValuesFile reports whether a file is a values.yaml, of the chart or of a subchart
+func isValuesFile(filePath string) bool {
+	return path.Base(strings.TrimSpace(filePath)) == "values.yaml"
+}
+
+// recordValuesEdit counts an edit of a values.yaml by command
+func recordValuesEdit(filePath string, command string, succeeded bool) {
+	if !isValuesFile(filePath) {
+		return
+	}
+
+	switch command {
+	case "yaml_patch":
+		valuesYAMLPatches.Add(1)
+		if !succeeded {
+			valuesYAMLPatchFailures.Add(1)
+		}
+	case "str_replace":
+		valuesStrReplaces.Add(1)
+		if !succeeded {
+			valuesStrReplaceFailures.Add(1)
+		}
+	}
+}
+
+// applyYAMLPatch applies the operations of a yaml_patch command to the content of a file. It
+// returns the new content, the tool result for the model and whether the result is an error. When
+// an operation fails the content is returned unchanged.
+func applyYAMLPatch(ctx context.Context, filePath string, content string, operations []yamlpatch.Operation) (string, string, bool) {
+	if content == "" {
+		recordValuesEdit(filePath, "yaml_patch", false)
+		return content, "Error: File does not exist. Use create instead.", true
+	}
+	if len(operations) == 0 {
+		recordValuesEdit(filePath, "yaml_patch", false)
+		return content, "Error: yaml_patch needs at least one operation.", true
+	}
+
+	ops := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		ops = append(ops, operation.Op+" "+operation.Path)
+	}
+
+	patched, err := yamlpatch.Apply(content, operations)
+	if err != nil {
+		recordValuesEdit(filePath, "yaml_patch", false)
+		logger.InfoCtx(ctx, "LLM yaml_patch failed",
+			zap.String("path", filePath),
+			zap.Strings("operations", ops),
+			zap.Error(err))
+		return content, "Error: " + err.Error() + ". No operations were applied, view the file and try again.", true
+	}
+
+	recordValuesEdit(filePath, "yaml_patch", true)
+	logger.InfoCtx(ctx, "LLM yaml_patch applied",
+		zap.String("path", filePath),
+		zap.Strings("operations", ops))
+	return patched, "Patched", false
+}
+
+// restoreValuesComments puts back the comments above the keys of a values.yaml that an action
+// dropped without changing the key's value, see yamlpatch.RestoreHeadComments. The edited content
+// is returned unchanged when either version can't be parsed.
+func restoreValuesComments(ctx context.Context, filePath string, original string, edited string) string {
+	if original == "" || edited == original {
+		return edited
+	}
+
+	restored, count, err := yamlpatch.RestoreHeadComments(original, edited)
+	if err != nil {
+		logger.InfoCtx(ctx, "Failed to restore values.yaml comments", zap.String("path", filePath), zap.Error(err))
+		return edited
+	}
+	if count > 0 {
+		valuesCommentsRestored.Add(int64(count))
+		logger.InfoCtx(ctx, "Restored values.yaml comments dropped by an action", zap.String("path", filePath), zap.Int("count", count))
+	}
+	return restored
+}
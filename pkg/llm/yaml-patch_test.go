@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/replicatedhq/chartsmith/pkg/yamlpatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValuesFile(t *testing.T) {
+	assert.True(t, isValuesFile("values.yaml"))
+	assert.True(t, isValuesFile("/values.yaml"))
+	assert.True(t, isValuesFile("charts/redis/values.yaml"))
+	assert.False(t, isValuesFile("values.schema.json"))
+	assert.False(t, isValuesFile("templates/values.tpl"))
+}
+
+func TestApplyYAMLPatch(t *testing.T) {
+	content := "image:\n  tag: \"\"\n"
+
+	before := GetValuesEditStats()
+
+	patched, response, isError := applyYAMLPatch(context.Background(), "values.yaml", content, []yamlpatch.Operation{{Op: yamlpatch.OpSet, Path: "image.tag", Value: "1.25"}})
+	assert.False(t, isError)
+	assert.Equal(t, "Patched", response)
+	assert.Equal(t, "image:\n  tag: \"1.25\"\n", patched)
+
+	patched, response, isError = applyYAMLPatch(context.Background(), "values.yaml", content, []yamlpatch.Operation{{Op: yamlpatch.OpDelete, Path: "image.digest"}})
+	assert.True(t, isError)
+	assert.Contains(t, response, "path not found: image.digest")
+	assert.Equal(t, content, patched)
+
+	_, _, isError = applyYAMLPatch(context.Background(), "values.yaml", content, nil)
+	assert.True(t, isError)
+
+	_, response, isError = applyYAMLPatch(context.Background(), "values.yaml", "", []yamlpatch.Operation{{Op: yamlpatch.OpSet, Path: "a", Value: "b"}})
+	assert.True(t, isError)
+	assert.Contains(t, response, "File does not exist")
+
+	// only values.yaml files are counted
+	_, _, isError = applyYAMLPatch(context.Background(), "templates/configmap.yaml", "data: {}\n", []yamlpatch.Operation{{Op: yamlpatch.OpSet, Path: "data.a", Value: "b"}})
+	assert.False(t, isError)
+
+	after := GetValuesEditStats()
+	assert.Equal(t, int64(4), after.YAMLPatches-before.YAMLPatches)
+	assert.Equal(t, int64(3), after.YAMLPatchFailures-before.YAMLPatchFailures)
+}
+
+func TestExecuteActionYAMLPatch(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test")
+	require.NoError(t, param.Init(nil))
+
+	actionPlanWithPath := llmtypes.ActionPlanWithPath{
+		ActionPlan: llmtypes.ActionPlan{Action: "update"},
+		Path:       "values.yaml",
+	}
+	plan := &workspacetypes.Plan{Description: "Enable the ingress"}
+	content := "# ingress settings\ningress:\n  enabled: false # off by default\n  hosts: []\n"
+
+	fake := newScriptedAnthropic(t,
+		[]fakeToolUse{{Command: "yaml_patch", Path: "values.yaml", Operations: []yamlpatch.Operation{
+			{Op: yamlpatch.OpSet, Path: "ingress.enabled", Value: true},
+			{Op: yamlpatch.OpDelete, Path: "ingress.tls"},
+		}}},
+		[]fakeToolUse{{Command: "yaml_patch", Path: "values.yaml", Operations: []yamlpatch.Operation{
+			{Op: yamlpatch.OpSet, Path: "ingress.enabled", Value: true},
+			{Op: yamlpatch.OpAppend, Path: "ingress.hosts", Value: map[string]interface{}{"host": "example.com"}},
+		}}},
+	)
+
+	interimContentCh := make(chan llmtypes.InterimContent, 10)
+	updated, err := ExecuteAction(context.Background(), actionPlanWithPath, plan, content, interimContentCh)
+	require.NoError(t, err)
+
+	want := "# ingress settings\ningress:\n  enabled: true # off by default\n  hosts:\n    - host: example.com\n"
+	assert.Equal(t, want, updated)
+	assert.Equal(t, []llmtypes.InterimContent{{Version: 1, Content: want}}, drain(interimContentCh))
+
+	require.Len(t, fake.requests, 3)
+	assert.Contains(t, fake.requests[0], "yaml_patch", "the tool offers yaml_patch")
+	assert.Contains(t, fake.requests[0], `change it with \"yaml_patch\" rather than \"str_replace\"`)
+
+	// the failed patch is reported to the model and changes nothing
+	assert.Contains(t, fake.requests[1], `"is_error":true`)
+	assert.Contains(t, fake.requests[1], "path not found: ingress.tls")
+	assert.Contains(t, fake.requests[2], `"is_error":false`)
+	assert.Contains(t, fake.requests[2], "Patched")
+}
+
+func TestRestoreValuesComments(t *testing.T) {
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join("testdata", "values-comments", name))
+		require.NoError(t, err)
+		return string(b)
+	}
+	before, edited, want := read("before.yaml"), read("edited.yaml"), read("want.yaml")
+
+	// the edit dropped four comments, the one above ingress stays dropped because ingress changed
+	stats := GetValuesEditStats()
+	assert.Equal(t, want, restoreValuesComments(context.Background(), "values.yaml", before, edited))
+	assert.Equal(t, int64(3), GetValuesEditStats().CommentsRestored-stats.CommentsRestored)
+
+	// an edit that kept the comments, or a new file, is returned as it was
+	assert.Equal(t, before, restoreValuesComments(context.Background(), "values.yaml", before, before))
+	assert.Equal(t, edited, restoreValuesComments(context.Background(), "values.yaml", "", edited))
+
+	// content that isn't YAML is returned as it was
+	assert.Equal(t, "image: [nginx\n", restoreValuesComments(context.Background(), "values.yaml", before, "image: [nginx\n"))
+	assert.Equal(t, int64(3), GetValuesEditStats().CommentsRestored-stats.CommentsRestored)
+}
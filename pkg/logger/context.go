@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx that carries fields, every line logged with it by the Ctx
+// functions includes them. A field replaces a field ctx already carries with the same key.
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, fieldsKey{}, mergeFields(Fields(ctx), fields))
+}
+
+// Fields returns the fields ctx carries
+func Fields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	return fields
+}
+
+// mergeFields returns the fields of base followed by fields, leaving out the fields of base that
+// fields has a key of. base isn't changed.
+func mergeFields(base []zap.Field, fields []zap.Field) []zap.Field {
+	if len(base) == 0 {
+		return fields
+	}
+
+	keys := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		keys[f.Key] = true
+	}
+	merged := make([]zap.Field, 0, len(base)+len(fields))
+	for _, f := range base {
+		if !keys[f.Key] {
+			merged = append(merged, f)
+		}
+	}
+	return append(merged, fields...)
+}
+
+func ErrorCtx(ctx context.Context, err error, fields ...zap.Field) {
+	log.Error("error", mergeFields(Fields(ctx), append([]zap.Field{zap.Error(err)}, fields...))...)
+}
+
+func WarnCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	log.Warn(msg, mergeFields(Fields(ctx), fields)...)
+}
+
+func InfoCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	log.Info(msg, mergeFields(Fields(ctx), fields)...)
+}
+
+func DebugCtx(ctx context.Context, msg string, fields ...zap.Field) {
+	log.Debug(msg, mergeFields(Fields(ctx), fields)...)
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observeLogs sends the lines logged by the package to the returned observer until the test ends
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zapcore.DebugLevel)
+	original := log
+	log = zap.New(core)
+	t.Cleanup(func() { log = original })
+	return logs
+}
+
+func TestWithFields(t *testing.T) {
+	logs := observeLogs(t)
+
+	ctx := WithFields(context.Background(), zap.String("workspaceID", "ws"), zap.String("renderID", "render-1"))
+	// a nested call adds its own fields and replaces the ones with the same key
+	chartCtx := WithFields(ctx, zap.String("chartID", "chart-1"), zap.String("renderID", "render-2"))
+
+	InfoCtx(ctx, "started")
+	WarnCtx(chartCtx, "slow", zap.Int("seconds", 30))
+	ErrorCtx(chartCtx, errors.New("failed"), zap.String("workspaceID", "explicit"))
+	DebugCtx(context.Background(), "no fields")
+
+	entries := logs.All()
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, map[string]interface{}{"workspaceID": "ws", "renderID": "render-1"}, entries[0].ContextMap())
+	assert.Equal(t, map[string]interface{}{"workspaceID": "ws", "renderID": "render-2", "chartID": "chart-1", "seconds": int64(30)}, entries[1].ContextMap())
+	assert.Equal(t, map[string]interface{}{"workspaceID": "explicit", "renderID": "render-2", "chartID": "chart-1", "error": "failed"}, entries[2].ContextMap())
+	assert.Empty(t, entries[3].ContextMap())
+
+	// the parent context isn't changed by the nested call
+	assert.Len(t, Fields(ctx), 2)
+}
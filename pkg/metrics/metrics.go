@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// Sample is the current value of a gauge, or of a counter when Counter is set. Samples of one
+// metric with different labels, such as one per channel, are returned one after another with the
+// same name and help.
+type Sample struct {
+	Name    string
+	Help    string
+	Labels  map[string]string
+	Value   float64
+	Counter bool
+}
+
+// Collector measures a set of gauges and counters when metrics are scraped
+type Collector func() ([]Sample, error)
+
+var (
+	collectorsMu sync.Mutex
+	collectors   = map[string]Collector{}
+)
+
+// Register adds a collector, replacing any collector registered with the same name
+func Register(name string, collector Collector) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	collectors[name] = collector
+}
+
+// Handler serves the samples of every collector in the Prometheus text format. A collector that
+// fails is logged and left out, so that one failure doesn't hide the other metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		collectorsMu.Lock()
+		names := []string{}
+		for name := range collectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		registered := map[string]Collector{}
+		for name, collector := range collectors {
+			registered[name] = collector
+		}
+		collectorsMu.Unlock()
+
+		out := strings.Builder{}
+		for _, name := range names {
+			samples, err := registered[name]()
+			if err != nil {
+				logger.Warn("failed to collect metrics", zap.String("collector", name), zap.Error(err))
+				continue
+			}
+			for i, s := range samples {
+				if i == 0 || samples[i-1].Name != s.Name {
+					metricType := "gauge"
+					if s.Counter {
+						metricType = "counter"
+					}
+					fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", s.Name, s.Help, s.Name, metricType)
+				}
+				fmt.Fprintf(&out, "%s%s %v\n", s.Name, formatLabels(s.Labels), s.Value)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(out.String()))
+	})
+}
+
+// labelValueEscaper escapes label values as the Prometheus text format requires
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats labels as {name="value",...} sorted by name, empty without labels
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(labels[name])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Serve serves /metrics on address until ctx is done
+func Serve(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Serving metrics", zap.String("address", address))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	Register("b", func() ([]Sample, error) {
+		return []Sample{{Name: "chartsmith_b", Help: "The b gauge.", Value: 2.5}}, nil
+	})
+	Register("a", func() ([]Sample, error) {
+		return []Sample{
+			{Name: "chartsmith_a", Help: "The a gauge.", Value: 1},
+			{Name: "chartsmith_a_total", Help: "The a counter.", Value: 3, Counter: true},
+		}, nil
+	})
+	Register("c", func() ([]Sample, error) {
+		return []Sample{
+			{Name: "chartsmith_c", Help: "The c gauge.", Labels: map[string]string{"queue": "x", "channel": "new_intent"}, Value: 4},
+			{Name: "chartsmith_c", Help: "The c gauge.", Labels: map[string]string{"channel": `say "hi"`}, Value: 0},
+		}, nil
+	})
+	Register("failing", func() ([]Sample, error) {
+		return nil, errors.New("unavailable")
+	})
+	t.Cleanup(func() {
+		collectors = map[string]Collector{}
+	})
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP chartsmith_a The a gauge.
+# TYPE chartsmith_a gauge
+chartsmith_a 1
+# HELP chartsmith_a_total The a counter.
+# TYPE chartsmith_a_total counter
+chartsmith_a_total 3
+# HELP chartsmith_b The b gauge.
+# TYPE chartsmith_b gauge
+chartsmith_b 2.5
+# HELP chartsmith_c The c gauge.
+# TYPE chartsmith_c gauge
+chartsmith_c{channel="new_intent",queue="x"} 4
+chartsmith_c{channel="say \"hi\""} 0
+`, string(body))
+}
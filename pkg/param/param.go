@@ -14,15 +14,64 @@ var params *Params
 var awsSession *session.Session
 
 var paramLookup = map[string]string{
-	"ANTHROPIC_API_KEY":             "/chartsmith/anthropic_api_key",
-	"GROQ_API_KEY":                  "/chartsmith/groq_api_key",
-	"VOYAGE_API_KEY":                "/chartsmith/voyage_api_key",
-	"CHARTSMITH_PG_URI":             "/chartsmith/pg_uri",
-	"CHARTSMITH_CENTRIFUGO_ADDRESS": "/chartsmith/centrifugo_address",
-	"CHARTSMITH_CENTRIFUGO_API_KEY": "/chartsmith/centrifugo_api_key",
-	"CHARTSMITH_TOKEN_ENCRYPTION":   "/chartsmith/token_encryption",
-	"CHARTSMITH_SLACK_TOKEN":        "/chartsmith/slack_token",
-	"CHARTSMITH_SLACK_CHANNEL":      "/chartsmith/slack_channel",
+	"ANTHROPIC_API_KEY":                    "/chartsmith/anthropic_api_key",
+	"GROQ_API_KEY":                         "/chartsmith/groq_api_key",
+	"VOYAGE_API_KEY":                       "/chartsmith/voyage_api_key",
+	"CHARTSMITH_PG_URI":                    "/chartsmith/pg_uri",
+	"CHARTSMITH_CENTRIFUGO_ADDRESS":        "/chartsmith/centrifugo_address",
+	"CHARTSMITH_CENTRIFUGO_API_KEY":        "/chartsmith/centrifugo_api_key",
+	"CHARTSMITH_TOKEN_ENCRYPTION":          "/chartsmith/token_encryption",
+	"CHARTSMITH_SLACK_TOKEN":               "/chartsmith/slack_token",
+	"CHARTSMITH_SLACK_CHANNEL":             "/chartsmith/slack_channel",
+	"CHARTSMITH_SLACK_NOTIFICATIONS":       "/chartsmith/slack_notifications",
+	"INTENT_MODEL":                         "",
+	"CHAT_MODEL":                           "",
+	"PLAN_MODEL":                           "",
+	"EXECUTE_MODEL":                        "",
+	"SUMMARIZE_MODEL":                      "",
+	"CONVERT_MODEL":                        "",
+	"CONVERT_VALUES_MODEL":                 "",
+	"DISABLED_LINT_RULES":                  "",
+	"CHARTSMITH_HELM_TMP_DIR":              "",
+	"CHARTSMITH_HELM_MIN_FREE_MB":          "",
+	"CHARTSMITH_METRICS_ADDRESS":           "",
+	"CHARTSMITH_HEALTH_ADDRESS":            "",
+	"CHARTSMITH_INTERNAL_API_ADDRESS":      "",
+	"CHARTSMITH_INTERNAL_API_KEY":          "",
+	"CHARTSMITH_INTEGRATIONS":              "",
+	"CHARTSMITH_EXPORT_SIGNING":            "",
+	"CHARTSMITH_EXPORT_PGP_KEYRING":        "",
+	"CHARTSMITH_EXPORT_PGP_KEY":            "",
+	"CHARTSMITH_EXPORT_PGP_PASSPHRASE":     "/chartsmith/export_pgp_passphrase",
+	"CHARTSMITH_EXPORT_COSIGN_KEY":         "",
+	"CHARTSMITH_TIMEOUT_RENDER":            "",
+	"CHARTSMITH_TIMEOUT_RENDER_CHART":      "",
+	"CHARTSMITH_TIMEOUT_RENDER_STALL":      "",
+	"CHARTSMITH_TIMEOUT_DB":                "",
+	"CHARTSMITH_TIMEOUT_LLM_INACTIVITY":    "",
+	"CHARTSMITH_TIMEOUT_LLM_REQUEST":       "",
+	"CHARTSMITH_TIMEOUT_FUZZY_MATCH":       "",
+	"CHARTSMITH_TIMEOUT_CLUSTER_DRY_RUN":   "",
+	"CHARTSMITH_QUEUE_CLAIM_INTERVAL":      "",
+	"CHARTSMITH_ARCHIVE_RETENTION_DAYS":    "",
+	"CHARTSMITH_AUDIT_RETENTION_DAYS":      "",
+	"CHARTSMITH_RENDER_ARTIFACTS_KEPT":     "",
+	"CHARTSMITH_RENDER_COMPACTION_DRY_RUN": "",
+	"CHARTSMITH_HELM_UNITTEST":             "",
+	"CHARTSMITH_INTENT_CONCURRENCY":        "",
+	"CHARTSMITH_CLUSTER_DRY_RUN":           "",
+	"CHARTSMITH_EMBEDDING_PROVIDER":        "",
+	"CHARTSMITH_SUMMARY_CACHE_DISABLED":    "",
+	"CHARTSMITH_SUMMARY_CACHE_TTL_DAYS":    "",
+	"CHARTSMITH_SUMMARY_CACHE_MAX":         "",
+	"CHARTSMITH_PLAN_DRY_RUN_MAX_FILES":    "",
+	"CHARTSMITH_PLAN_DRY_RUN_MAX_TOKENS":   "",
+	"CHARTSMITH_QUEUE_ALERT_AGE":           "",
+	"CHARTSMITH_QUEUE_ALERT_COOLDOWN":      "",
+	"CHARTSMITH_FILE_TREE_MAX_FILES":       "",
+	"CHARTSMITH_FEEDBACK_TOKEN_BUDGET":     "",
+	"CHARTSMITH_PRESENCE_STORE":            "",
+	"CHARTSMITH_LEGACY_VALUES_MERGE":       "",
 }
 
 type Params struct {
@@ -35,6 +84,106 @@ type Params struct {
 	TokenEncryption   string
 	SlackToken        string
 	SlackChannel      string
+
+	// JSON routing of slack notifications by event type to webhooks and templates, see pkg/slack
+	SlackNotifications string
+
+	// model overrides per operation, empty uses the default in pkg/llm
+	IntentModel        string
+	ChatModel          string
+	PlanModel          string
+	ExecuteModel       string
+	SummarizeModel     string
+	ConvertModel       string
+	ConvertValuesModel string
+
+	// comma separated IDs of the pkg/lintrules rules that don't run
+	DisabledLintRules string
+
+	// where helm commands get temp directories, and the free space in MB below which they fail fast
+	HelmTempDir   string
+	HelmMinFreeMB string
+
+	// the address the worker serves /metrics on, empty doesn't serve metrics
+	MetricsAddress string
+
+	// the address the worker serves /healthz, /readyz and /status on, empty doesn't serve them
+	HealthAddress string
+
+	// the address the worker serves the internal API on, and the key other services send in
+	// X-Internal-API-Key, empty doesn't serve the internal API
+	InternalAPIAddress string
+	InternalAPIKey     string
+
+	// comma separated names of the pkg/integrations integrations to enable, "none" for none
+	Integrations string
+
+	// how exported charts are signed, "pgp" or "cosign", empty doesn't sign. The keys are paths to
+	// files that are read when exporting, see pkg/provenance
+	ExportSigning       string
+	ExportPGPKeyring    string
+	ExportPGPKey        string
+	ExportPGPPassphrase string
+	ExportCosignKey     string
+
+	// render, database, LLM and queue timeouts, parsed from durations like "15m", see timeouts.go
+	Timeouts Timeouts
+
+	// days an archived workspace is kept before it's deleted, empty uses the default in pkg/workspace
+	ArchiveRetentionDays string
+
+	// days audit events are kept, empty uses the default in pkg/workspace
+	AuditRetentionDays string
+
+	// how many of the latest renders of a workspace keep their helm output, empty uses the default
+	// in pkg/workspace, and "true" to only log what compacting older renders would drop
+	RenderArtifactsKept    string
+	RenderCompactionDryRun string
+
+	// "true" when helm has the helm-unittest plugin and chart unit tests may be run
+	HelmUnittest string
+
+	// how many chat messages the worker classifies at once, empty uses the default in pkg/listener
+	IntentConcurrency string
+
+	// "true" to allow validating renders against a cluster with a server side dry run
+	ClusterDryRun string
+
+	// the pkg/embedding provider that embeds files and prompts, empty uses the default
+	EmbeddingProvider string
+
+	// "true" to summarize every file instead of reusing the summaries of identical content, and
+	// the days and number of summaries the cache keeps, empty uses the defaults in pkg/llm
+	SummaryCacheDisabled   string
+	SummaryCacheTTLDays    string
+	SummaryCacheMaxEntries string
+
+	// how many files a plan dry run previews and how many LLM tokens it may spend, empty uses the
+	// defaults in pkg/llm
+	PlanDryRunMaxFiles  string
+	PlanDryRunMaxTokens string
+
+	// how long the oldest unclaimed message of a work queue channel can wait before a
+	// queue_backlog notification is sent, empty sends none, and how long before another is sent
+	// for the same channel, empty uses the default in pkg/listener
+	QueueAlertAge      string
+	QueueAlertCooldown string
+
+	// how many files a file tree has before its directories are loaded one at a time, empty uses
+	// the default in pkg/workspace
+	FileTreeMaxFiles string
+
+	// the estimated tokens of file content included with a persona response before files are
+	// summarized, empty uses the default in pkg/llm
+	FeedbackTokenBudget string
+
+	// where who has each workspace open is kept, "memory" or "postgres" for workers with more
+	// than one replica, empty uses the default in pkg/realtime
+	PresenceStore string
+
+	// "true" to merge values.yaml by re-marshaling it, which expands anchors and sorts keys,
+	// instead of changing only the keys being merged
+	LegacyValuesMerge string
 }
 
 func Get() Params {
@@ -58,6 +207,11 @@ func Init(sess *session.Session) error {
 		paramsMap = GetParamsFromEnv(paramLookup)
 	}
 
+	timeouts, err := parseTimeouts(paramsMap)
+	if err != nil {
+		return fmt.Errorf("invalid timeouts: %w", err)
+	}
+
 	params = &Params{
 		AnthropicAPIKey:   paramsMap["ANTHROPIC_API_KEY"],
 		GroqAPIKey:        paramsMap["GROQ_API_KEY"],
@@ -68,6 +222,69 @@ func Init(sess *session.Session) error {
 		TokenEncryption:   paramsMap["CHARTSMITH_TOKEN_ENCRYPTION"],
 		SlackToken:        paramsMap["CHARTSMITH_SLACK_TOKEN"],
 		SlackChannel:      paramsMap["CHARTSMITH_SLACK_CHANNEL"],
+
+		SlackNotifications: paramsMap["CHARTSMITH_SLACK_NOTIFICATIONS"],
+
+		IntentModel:        paramsMap["INTENT_MODEL"],
+		ChatModel:          paramsMap["CHAT_MODEL"],
+		PlanModel:          paramsMap["PLAN_MODEL"],
+		ExecuteModel:       paramsMap["EXECUTE_MODEL"],
+		SummarizeModel:     paramsMap["SUMMARIZE_MODEL"],
+		ConvertModel:       paramsMap["CONVERT_MODEL"],
+		ConvertValuesModel: paramsMap["CONVERT_VALUES_MODEL"],
+
+		DisabledLintRules: paramsMap["DISABLED_LINT_RULES"],
+
+		HelmTempDir:   paramsMap["CHARTSMITH_HELM_TMP_DIR"],
+		HelmMinFreeMB: paramsMap["CHARTSMITH_HELM_MIN_FREE_MB"],
+
+		MetricsAddress: paramsMap["CHARTSMITH_METRICS_ADDRESS"],
+		HealthAddress:  paramsMap["CHARTSMITH_HEALTH_ADDRESS"],
+
+		InternalAPIAddress: paramsMap["CHARTSMITH_INTERNAL_API_ADDRESS"],
+		InternalAPIKey:     paramsMap["CHARTSMITH_INTERNAL_API_KEY"],
+
+		Integrations: paramsMap["CHARTSMITH_INTEGRATIONS"],
+
+		ExportSigning:       paramsMap["CHARTSMITH_EXPORT_SIGNING"],
+		ExportPGPKeyring:    paramsMap["CHARTSMITH_EXPORT_PGP_KEYRING"],
+		ExportPGPKey:        paramsMap["CHARTSMITH_EXPORT_PGP_KEY"],
+		ExportPGPPassphrase: paramsMap["CHARTSMITH_EXPORT_PGP_PASSPHRASE"],
+		ExportCosignKey:     paramsMap["CHARTSMITH_EXPORT_COSIGN_KEY"],
+
+		Timeouts: timeouts,
+
+		ArchiveRetentionDays: paramsMap["CHARTSMITH_ARCHIVE_RETENTION_DAYS"],
+		AuditRetentionDays:   paramsMap["CHARTSMITH_AUDIT_RETENTION_DAYS"],
+
+		RenderArtifactsKept:    paramsMap["CHARTSMITH_RENDER_ARTIFACTS_KEPT"],
+		RenderCompactionDryRun: paramsMap["CHARTSMITH_RENDER_COMPACTION_DRY_RUN"],
+
+		HelmUnittest: paramsMap["CHARTSMITH_HELM_UNITTEST"],
+
+		IntentConcurrency: paramsMap["CHARTSMITH_INTENT_CONCURRENCY"],
+
+		ClusterDryRun: paramsMap["CHARTSMITH_CLUSTER_DRY_RUN"],
+
+		EmbeddingProvider: paramsMap["CHARTSMITH_EMBEDDING_PROVIDER"],
+
+		SummaryCacheDisabled:   paramsMap["CHARTSMITH_SUMMARY_CACHE_DISABLED"],
+		SummaryCacheTTLDays:    paramsMap["CHARTSMITH_SUMMARY_CACHE_TTL_DAYS"],
+		SummaryCacheMaxEntries: paramsMap["CHARTSMITH_SUMMARY_CACHE_MAX"],
+
+		PlanDryRunMaxFiles:  paramsMap["CHARTSMITH_PLAN_DRY_RUN_MAX_FILES"],
+		PlanDryRunMaxTokens: paramsMap["CHARTSMITH_PLAN_DRY_RUN_MAX_TOKENS"],
+
+		QueueAlertAge:      paramsMap["CHARTSMITH_QUEUE_ALERT_AGE"],
+		QueueAlertCooldown: paramsMap["CHARTSMITH_QUEUE_ALERT_COOLDOWN"],
+
+		FileTreeMaxFiles: paramsMap["CHARTSMITH_FILE_TREE_MAX_FILES"],
+
+		FeedbackTokenBudget: paramsMap["CHARTSMITH_FEEDBACK_TOKEN_BUDGET"],
+
+		PresenceStore: paramsMap["CHARTSMITH_PRESENCE_STORE"],
+
+		LegacyValuesMerge: paramsMap["CHARTSMITH_LEGACY_VALUES_MERGE"],
 	}
 
 	return nil
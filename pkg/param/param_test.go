@@ -0,0 +1,22 @@
+package param
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitFromEnv(t *testing.T) {
+	t.Setenv("USE_EC2_PARAMETERS", "")
+	t.Setenv("CHARTSMITH_RENDER_ARTIFACTS_KEPT", "5")
+	t.Setenv("CHARTSMITH_RENDER_COMPACTION_DRY_RUN", "true")
+
+	previous := params
+	t.Cleanup(func() { params = previous })
+
+	require.NoError(t, Init(nil))
+
+	assert.Equal(t, "5", Get().RenderArtifactsKept)
+	assert.Equal(t, "true", Get().RenderCompactionDryRun)
+}
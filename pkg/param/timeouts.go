@@ -0,0 +1,106 @@
+package param
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timeouts are how long the worker waits on renders, the database and the LLM before giving up
+type Timeouts struct {
+	// RenderTotal bounds handling a render_workspace notification, including finalizing the render
+	RenderTotal time.Duration
+	// RenderChart bounds rendering a chart, however much progress it's making
+	RenderChart time.Duration
+	// RenderStall is how long a chart can render without a heartbeat from helm before it's stalled
+	RenderStall time.Duration
+	// DBOperation bounds a single database operation made while rendering
+	DBOperation time.Duration
+	// LLMInactivity is how long a streaming LLM response can go without output before it's stalled
+	LLMInactivity time.Duration
+	// LLMRequest bounds an LLM call that doesn't stream its response
+	LLMRequest time.Duration
+	// FuzzyMatch bounds the search for an approximate match of a str_replace
+	FuzzyMatch time.Duration
+	// QueueClaimInterval is how often each queue is polled for work to claim
+	QueueClaimInterval time.Duration
+	// ClusterDryRun bounds validating a render against a cluster, a cluster that doesn't answer
+	// fails the documents that haven't been validated yet
+	ClusterDryRun time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used when none are configured
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		RenderTotal:        35 * time.Minute,
+		RenderChart:        30 * time.Minute,
+		RenderStall:        2 * time.Minute,
+		DBOperation:        30 * time.Second,
+		LLMInactivity:      2 * time.Minute,
+		LLMRequest:         5 * time.Minute,
+		FuzzyMatch:         10 * time.Second,
+		QueueClaimInterval: 5 * time.Second,
+		ClusterDryRun:      time.Minute,
+	}
+}
+
+// timeoutParams maps the params that override each timeout to the field they set
+var timeoutParams = []struct {
+	name  string
+	field func(*Timeouts) *time.Duration
+}{
+	{"CHARTSMITH_TIMEOUT_RENDER", func(t *Timeouts) *time.Duration { return &t.RenderTotal }},
+	{"CHARTSMITH_TIMEOUT_RENDER_CHART", func(t *Timeouts) *time.Duration { return &t.RenderChart }},
+	{"CHARTSMITH_TIMEOUT_RENDER_STALL", func(t *Timeouts) *time.Duration { return &t.RenderStall }},
+	{"CHARTSMITH_TIMEOUT_DB", func(t *Timeouts) *time.Duration { return &t.DBOperation }},
+	{"CHARTSMITH_TIMEOUT_LLM_INACTIVITY", func(t *Timeouts) *time.Duration { return &t.LLMInactivity }},
+	{"CHARTSMITH_TIMEOUT_LLM_REQUEST", func(t *Timeouts) *time.Duration { return &t.LLMRequest }},
+	{"CHARTSMITH_TIMEOUT_FUZZY_MATCH", func(t *Timeouts) *time.Duration { return &t.FuzzyMatch }},
+	{"CHARTSMITH_QUEUE_CLAIM_INTERVAL", func(t *Timeouts) *time.Duration { return &t.QueueClaimInterval }},
+	{"CHARTSMITH_TIMEOUT_CLUSTER_DRY_RUN", func(t *Timeouts) *time.Duration { return &t.ClusterDryRun }},
+}
+
+// parseTimeouts overrides the defaults with the durations that are set, like "15m" or "45s"
+func parseTimeouts(paramsMap map[string]string) (Timeouts, error) {
+	timeouts := DefaultTimeouts()
+	for _, p := range timeoutParams {
+		value := paramsMap[p.name]
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("invalid %s %q: %w", p.name, value, err)
+		}
+		*p.field(&timeouts) = d
+	}
+
+	if err := timeouts.Validate(); err != nil {
+		return Timeouts{}, err
+	}
+	return timeouts, nil
+}
+
+// Validate checks that every timeout is positive, that the charts of a render have to finish with
+// time left to finalize the render, and that a chart can stall before it runs out of time
+func (t Timeouts) Validate() error {
+	for _, p := range timeoutParams {
+		if d := *p.field(&t); d <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", p.name, d)
+		}
+	}
+	if t.RenderChart >= t.RenderTotal {
+		return fmt.Errorf("CHARTSMITH_TIMEOUT_RENDER_CHART (%s) must be less than CHARTSMITH_TIMEOUT_RENDER (%s)", t.RenderChart, t.RenderTotal)
+	}
+	if t.RenderStall >= t.RenderChart {
+		return fmt.Errorf("CHARTSMITH_TIMEOUT_RENDER_STALL (%s) must be less than CHARTSMITH_TIMEOUT_RENDER_CHART (%s)", t.RenderStall, t.RenderChart)
+	}
+	return nil
+}
+
+// GetTimeouts returns the configured timeouts, or the defaults when params aren't initialized
+func GetTimeouts() Timeouts {
+	if params == nil {
+		return DefaultTimeouts()
+	}
+	return params.Timeouts
+}
@@ -0,0 +1,69 @@
+package param
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    func(*Timeouts)
+		wantErr string
+	}{
+		{name: "defaults", params: map[string]string{}},
+		{
+			name:   "overrides",
+			params: map[string]string{"CHARTSMITH_TIMEOUT_RENDER": "30m", "CHARTSMITH_TIMEOUT_RENDER_CHART": "25m", "CHARTSMITH_TIMEOUT_RENDER_STALL": "5m", "CHARTSMITH_QUEUE_CLAIM_INTERVAL": "500ms"},
+			want: func(t *Timeouts) {
+				t.RenderTotal = 30 * time.Minute
+				t.RenderChart = 25 * time.Minute
+				t.RenderStall = 5 * time.Minute
+				t.QueueClaimInterval = 500 * time.Millisecond
+			},
+		},
+		{name: "not a duration", params: map[string]string{"CHARTSMITH_TIMEOUT_DB": "30"}, wantErr: `invalid CHARTSMITH_TIMEOUT_DB "30"`},
+		{name: "not positive", params: map[string]string{"CHARTSMITH_TIMEOUT_FUZZY_MATCH": "0s"}, wantErr: "CHARTSMITH_TIMEOUT_FUZZY_MATCH must be positive"},
+		{name: "llm request", params: map[string]string{"CHARTSMITH_TIMEOUT_LLM_REQUEST": "90s"}, want: func(t *Timeouts) { t.LLMRequest = 90 * time.Second }},
+		{name: "chart render exceeds total", params: map[string]string{"CHARTSMITH_TIMEOUT_RENDER_CHART": "40m"}, wantErr: "CHARTSMITH_TIMEOUT_RENDER_CHART (40m0s) must be less than CHARTSMITH_TIMEOUT_RENDER (35m0s)"},
+		{name: "chart render equals total", params: map[string]string{"CHARTSMITH_TIMEOUT_RENDER": "30m"}, wantErr: "must be less than"},
+		{name: "stall exceeds chart render", params: map[string]string{"CHARTSMITH_TIMEOUT_RENDER_CHART": "90s"}, wantErr: "CHARTSMITH_TIMEOUT_RENDER_STALL (2m0s) must be less than CHARTSMITH_TIMEOUT_RENDER_CHART (1m30s)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeouts, err := parseTimeouts(tt.params)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			want := DefaultTimeouts()
+			if tt.want != nil {
+				tt.want(&want)
+			}
+			assert.Equal(t, want, timeouts)
+		})
+	}
+}
+
+func TestInitTimeouts(t *testing.T) {
+	original := params
+	t.Cleanup(func() { params = original })
+
+	params = nil
+	assert.Equal(t, DefaultTimeouts(), GetTimeouts(), "defaults before Init")
+
+	t.Setenv("CHARTSMITH_TIMEOUT_LLM_INACTIVITY", "5m")
+	require.NoError(t, Init(nil))
+	assert.Equal(t, 5*time.Minute, GetTimeouts().LLMInactivity)
+	assert.Equal(t, 5*time.Minute, Get().Timeouts.LLMInactivity)
+
+	t.Setenv("CHARTSMITH_TIMEOUT_LLM_INACTIVITY", "soon")
+	assert.ErrorContains(t, Init(nil), "invalid timeouts")
+}
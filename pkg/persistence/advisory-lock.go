@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultLockTimeout is how long LockTx waits for locks held by another transaction
+const DefaultLockTimeout = 5 * time.Second
+
+// ErrLockBusy is returned when a lock is held by another transaction for longer than the lock
+// timeout
+var ErrLockBusy = errors.New("lock is held by another transaction")
+
+// lockNotAvailable is the SQLSTATE of a lock wait that exceeded lock_timeout
+const lockNotAvailable = "55P03"
+
+// Execer is the subset of pgx.Tx used to take locks
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// LockTx takes a transaction scoped advisory lock on each of keys, they're released when the
+// transaction ends. The keys are locked in sorted order so that two transactions locking some of
+// the same keys can't deadlock. Waiting longer than timeout for a lock returns ErrLockBusy, the
+// transaction is aborted then and has to be rolled back.
+func LockTx(ctx context.Context, tx Execer, timeout time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+
+	if _, err := tx.Exec(ctx, `SELECT set_config('lock_timeout', $1, true)`, fmt.Sprintf("%dms", timeout.Milliseconds())); err != nil {
+		return fmt.Errorf("failed to set lock timeout: %w", err)
+	}
+
+	// unnest returns the keys in array order, so they're locked one after the other in that order
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended(key, 0)) FROM unnest($1::text[]) AS keys(key)`, keys)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailable {
+			return fmt.Errorf("%w: waited %s", ErrLockBusy, timeout)
+		}
+		return fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `SET LOCAL lock_timeout TO DEFAULT`); err != nil {
+		return fmt.Errorf("failed to reset lock timeout: %w", err)
+	}
+
+	return nil
+}
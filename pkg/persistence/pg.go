@@ -146,6 +146,21 @@ func MustGetPooledPostgresSession() *pgxpool.Conn {
 	panic("failed to acquire from Postgres pool: " + err.Error())
 }
 
+// GetPooledPostgresSession acquires a connection from the pool once, returning an error instead of
+// panicking when the pool isn't initialized or a connection can't be acquired before ctx is done.
+// It's for callers that have something to fall back to without the database.
+func GetPooledPostgresSession(ctx context.Context) (*pgxpool.Conn, error) {
+	if pool == nil {
+		return nil, errors.New("Postgres pool is not initialized")
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire from Postgres pool: %w", err)
+	}
+	return conn, nil
+}
+
 // monitorPoolHealth periodically checks the database connection pool health
 // and logs statistics to help identify connection issues
 func monitorPoolHealth() {
@@ -7,24 +7,50 @@ import (
 	"github.com/tuvistavie/securerandom"
 )
 
+// Work queue priorities. Higher priorities are claimed first within a channel. They aren't
+// compared across channels, each channel has its own workers and is claimed on its own.
+const (
+	WorkPriorityLow    = -10
+	WorkPriorityNormal = 0
+	WorkPriorityHigh   = 10
+)
+
+// EnqueueWork adds a message to the work queue using the channel's default priority
 func EnqueueWork(ctx context.Context, channel string, payload interface{}) error {
+	_, err := enqueueWork(ctx, channel, payload, nil)
+	return err
+}
+
+// EnqueueWorkWithPriority adds a message to the work queue, overriding the channel's default priority
+func EnqueueWorkWithPriority(ctx context.Context, channel string, payload interface{}, priority int) error {
+	_, err := enqueueWork(ctx, channel, payload, &priority)
+	return err
+}
+
+// EnqueueWorkReturningID adds a message to the work queue using the channel's default priority and
+// returns the ID of the message
+func EnqueueWorkReturningID(ctx context.Context, channel string, payload interface{}) (string, error) {
+	return enqueueWork(ctx, channel, payload, nil)
+}
+
+func enqueueWork(ctx context.Context, channel string, payload interface{}, priority *int) (string, error) {
 	conn := MustGetPooledPostgresSession()
 	defer conn.Release()
 
 	id, err := securerandom.Hex(6)
 	if err != nil {
-		return fmt.Errorf("failed to generate id: %w", err)
+		return "", fmt.Errorf("failed to generate id: %w", err)
 	}
 
-	_, err = conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1, $2, $3, NOW())`, id, channel, payload)
+	_, err = conn.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at, priority) VALUES ($1, $2, $3, NOW(), $4)`, id, channel, payload, priority)
 	if err != nil {
-		return fmt.Errorf("failed to insert work: %w", err)
+		return "", fmt.Errorf("failed to insert work: %w", err)
 	}
 
 	_, err = conn.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, id)
 	if err != nil {
-		return fmt.Errorf("failed to notify: %w", err)
+		return "", fmt.Errorf("failed to notify: %w", err)
 	}
 
-	return nil
+	return id, nil
 }
@@ -0,0 +1,360 @@
+// Package provenance signs exported chart archives. PGP signing produces a .prov file with the
+// same format as helm package --sign, cosign signing produces the signature cosign sign-blob does.
+package provenance
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// MethodPGP signs with a PGP key, producing a .prov file
+	MethodPGP = "pgp"
+	// MethodCosign signs with a cosign (ECDSA) key, producing a .sig file
+	MethodCosign = "cosign"
+)
+
+// Config is how exported charts are signed. Method is empty when exports aren't signed.
+type Config struct {
+	Method string
+
+	// PGPKeyring is the path of the secret keyring, PGPKey selects a key in it by name, email or
+	// ID the way helm package --key does, and PGPPassphrase decrypts the key if it's encrypted
+	PGPKeyring    string
+	PGPKey        string
+	PGPPassphrase string
+
+	// CosignKey is the path of an unencrypted PEM ECDSA private key
+	CosignKey string
+}
+
+// Signature is a signature of an archive, written next to it when exported
+type Signature struct {
+	Filename string
+	Content  []byte
+}
+
+// ConfigFromParams returns the signing configuration of the worker
+func ConfigFromParams() Config {
+	return Config{
+		Method:        strings.ToLower(strings.TrimSpace(param.Get().ExportSigning)),
+		PGPKeyring:    param.Get().ExportPGPKeyring,
+		PGPKey:        param.Get().ExportPGPKey,
+		PGPPassphrase: param.Get().ExportPGPPassphrase,
+		CosignKey:     param.Get().ExportCosignKey,
+	}
+}
+
+// Warnings returns the problems with a configuration that requests signing. Exports still succeed
+// when signing is misconfigured, they're just not signed, so these are warnings and not errors.
+func (c Config) Warnings() []string {
+	switch c.Method {
+	case "":
+		return nil
+	case MethodPGP:
+		return keyFileWarnings("CHARTSMITH_EXPORT_PGP_KEYRING", c.PGPKeyring)
+	case MethodCosign:
+		return keyFileWarnings("CHARTSMITH_EXPORT_COSIGN_KEY", c.CosignKey)
+	default:
+		return []string{fmt.Sprintf("CHARTSMITH_EXPORT_SIGNING is %q, expected %q or %q, exports won't be signed", c.Method, MethodPGP, MethodCosign)}
+	}
+}
+
+func keyFileWarnings(paramName string, path string) []string {
+	if path == "" {
+		return []string{fmt.Sprintf("export signing is enabled but %s isn't set, exports won't be signed", paramName)}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return []string{fmt.Sprintf("export signing is enabled but the key in %s can't be read, exports won't be signed: %v", paramName, err)}
+	}
+	return nil
+}
+
+// Sign signs an archive with the configured key. It returns nil when signing isn't configured.
+// Key material is only held in memory and never included in errors.
+func (c Config) Sign(archiveName string, archive []byte, chartYAML []byte) (*Signature, error) {
+	switch c.Method {
+	case "":
+		return nil, nil
+
+	case MethodPGP:
+		keyring, err := os.Open(c.PGPKeyring)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pgp keyring: %w", err)
+		}
+		defer keyring.Close()
+
+		prov, err := SignPGP(keyring, c.PGPKey, c.PGPPassphrase, archiveName, archive, chartYAML)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{Filename: archiveName + ".prov", Content: prov}, nil
+
+	case MethodCosign:
+		keyPEM, err := os.ReadFile(c.CosignKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cosign key: %w", err)
+		}
+
+		sig, err := SignCosign(keyPEM, archive)
+		if err != nil {
+			return nil, err
+		}
+		return &Signature{Filename: archiveName + ".sig", Content: sig}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown signing method %q", c.Method)
+	}
+}
+
+// SignPGP returns the provenance file of an archive, the way helm package --sign writes it: the
+// chart metadata and the digest of the archive, clearsigned with the key in keyring
+func SignPGP(keyring io.Reader, keyName string, passphrase string, archiveName string, archive []byte, chartYAML []byte) ([]byte, error) {
+	entity, err := signingEntity(keyring, keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, errors.New("failed to decrypt pgp key, check the passphrase")
+		}
+	}
+
+	message, err := provenanceMessage(archiveName, archive, chartYAML)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	w, err := clearsign.Encode(&out, entity.PrivateKey, &packet.Config{DefaultHash: crypto.SHA512})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign provenance: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return nil, fmt.Errorf("failed to sign provenance: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to sign provenance: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// VerifyPGP checks that prov was signed by a key in keyring and that it's the provenance of archive
+func VerifyPGP(keyring io.Reader, prov []byte, archiveName string, archive []byte) error {
+	entities, err := readKeyring(keyring)
+	if err != nil {
+		return err
+	}
+
+	block, _ := clearsign.Decode(prov)
+	if block == nil {
+		return errors.New("provenance isn't a clearsigned message")
+	}
+	if _, err := openpgp.CheckDetachedSignature(entities, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body, nil); err != nil {
+		return fmt.Errorf("invalid provenance signature: %w", err)
+	}
+
+	parts := strings.SplitN(string(block.Plaintext), "\n...\n", 2)
+	if len(parts) != 2 {
+		return errors.New("provenance has no file digests")
+	}
+	var sums provenanceSums
+	if err := yaml.Unmarshal([]byte(parts[1]), &sums); err != nil {
+		return fmt.Errorf("failed to parse provenance file digests: %w", err)
+	}
+
+	want, ok := sums.Files[archiveName]
+	if !ok {
+		return fmt.Errorf("provenance has no digest for %s", archiveName)
+	}
+	if got := archiveDigest(archive); got != want {
+		return fmt.Errorf("digest of %s is %s, provenance has %s", archiveName, got, want)
+	}
+	return nil
+}
+
+// provenanceSums is the part of a provenance file after the chart metadata
+type provenanceSums struct {
+	Files map[string]string `yaml:"files"`
+}
+
+// provenanceMessage is the plaintext of a provenance file. Like helm, it separates the chart
+// metadata from the digests with a YAML document end marker because --- isn't allowed in a
+// clearsigned message.
+func provenanceMessage(archiveName string, archive []byte, chartYAML []byte) ([]byte, error) {
+	var metadata map[string]interface{}
+	if err := yaml.Unmarshal(chartYAML, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+	metadataYAML, err := yaml.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chart metadata: %w", err)
+	}
+
+	sumsYAML, err := yaml.Marshal(provenanceSums{Files: map[string]string{archiveName: archiveDigest(archive)}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal file digests: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.Write(metadataYAML)
+	b.WriteString("\n...\n")
+	b.Write(sumsYAML)
+	return b.Bytes(), nil
+}
+
+func archiveDigest(archive []byte) string {
+	sum := sha256.Sum256(archive)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// signingEntity returns the key in keyring that keyName selects. With no name the keyring must
+// contain a single key.
+func signingEntity(keyring io.Reader, keyName string) (*openpgp.Entity, error) {
+	entities, err := readKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*openpgp.Entity
+	for _, entity := range entities {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if keyName == "" || entityMatches(entity, keyName) {
+			candidates = append(candidates, entity)
+		}
+	}
+
+	switch {
+	case len(candidates) == 0 && keyName == "":
+		return nil, errors.New("no private key in pgp keyring")
+	case len(candidates) == 0:
+		return nil, fmt.Errorf("no private key named %q in pgp keyring", keyName)
+	case len(candidates) > 1:
+		return nil, errors.New("more than one private key in pgp keyring, set CHARTSMITH_EXPORT_PGP_KEY to choose one")
+	}
+	return candidates[0], nil
+}
+
+func entityMatches(entity *openpgp.Entity, keyName string) bool {
+	if strings.EqualFold(entity.PrimaryKey.KeyIdString(), keyName) || strings.EqualFold(entity.PrimaryKey.KeyIdShortString(), keyName) {
+		return true
+	}
+	for name := range entity.Identities {
+		if strings.Contains(name, keyName) {
+			return true
+		}
+	}
+	return false
+}
+
+// readKeyring reads an armored or binary keyring
+func readKeyring(r io.Reader) (openpgp.EntityList, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pgp keyring: %w", err)
+	}
+
+	if entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data)); err == nil {
+		return entities, nil
+	}
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pgp keyring: %w", err)
+	}
+	return entities, nil
+}
+
+// SignCosign returns the base64 ECDSA signature of the SHA-256 digest of archive, which is what
+// cosign sign-blob writes and cosign verify-blob --key checks
+func SignCosign(keyPEM []byte, archive []byte) ([]byte, error) {
+	key, err := parseCosignKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(archive)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign archive: %w", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// VerifyCosign checks a signature from SignCosign against the PEM public key of the signer
+func VerifyCosign(publicKeyPEM []byte, archive []byte, signature []byte) error {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return errors.New("cosign public key isn't PEM encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse cosign public key: %w", err)
+	}
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("cosign public key isn't an ECDSA key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature isn't base64: %w", err)
+	}
+
+	digest := sha256.Sum256(archive)
+	if !ecdsa.VerifyASN1(ecdsaPub, digest[:], sig) {
+		return errors.New("invalid cosign signature")
+	}
+	return nil
+}
+
+func parseCosignKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("cosign key isn't PEM encoded")
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.New("failed to parse cosign EC private key")
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.New("failed to parse cosign PKCS8 private key")
+		}
+		ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("cosign key isn't an ECDSA key")
+		}
+		return ecdsaKey, nil
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		return nil, errors.New("encrypted cosign keys aren't supported, export the key as an unencrypted PEM ECDSA key")
+	default:
+		return nil, fmt.Errorf("unsupported cosign key type %q", block.Type)
+	}
+}
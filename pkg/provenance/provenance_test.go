@@ -0,0 +1,216 @@
+package provenance
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChartYAML = `apiVersion: v2
+name: nginx
+description: A chart for nginx
+version: 1.2.3
+appVersion: "1.25"
+`
+
+// throwawayPGPKey generates a key and returns its armored secret and public keyrings
+func throwawayPGPKey(t *testing.T, name string) ([]byte, []byte) {
+	t.Helper()
+
+	entity := throwawayPGPEntity(t, name)
+	return armoredSecretKeyring(t, entity), armoredPublicKeyring(t, entity)
+}
+
+func throwawayPGPEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity(name, "test", name+"@example.com", &packet.Config{RSABits: 2048})
+	require.NoError(t, err)
+	return entity
+}
+
+func armoredSecretKeyring(t *testing.T, entities ...*openpgp.Entity) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	for _, entity := range entities {
+		require.NoError(t, entity.SerializePrivate(w, nil))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func armoredPublicKeyring(t *testing.T, entities ...*openpgp.Entity) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	for _, entity := range entities {
+		require.NoError(t, entity.Serialize(w))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// throwawayCosignKey generates an ECDSA key and returns its PKCS8 private key and public key PEMs
+func throwawayCosignKey(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func TestSignPGP(t *testing.T) {
+	secret, public := throwawayPGPKey(t, "chartsmith")
+	_, otherPublic := throwawayPGPKey(t, "someone-else")
+	archive := []byte("packaged chart bytes")
+
+	prov, err := SignPGP(bytes.NewReader(secret), "", "", "nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	require.NoError(t, err)
+
+	text := string(prov)
+	assert.True(t, strings.HasPrefix(text, "-----BEGIN PGP SIGNED MESSAGE-----"))
+	assert.Contains(t, text, "name: nginx")
+	assert.Contains(t, text, "\n...\n")
+	assert.Contains(t, text, "nginx-1.2.3.tgz: sha256:")
+	assert.NotContains(t, text, "PRIVATE KEY")
+
+	require.NoError(t, VerifyPGP(bytes.NewReader(public), prov, "nginx-1.2.3.tgz", archive))
+
+	err = VerifyPGP(bytes.NewReader(public), prov, "nginx-1.2.3.tgz", []byte("tampered chart bytes"))
+	assert.ErrorContains(t, err, "digest of nginx-1.2.3.tgz")
+
+	err = VerifyPGP(bytes.NewReader(otherPublic), prov, "nginx-1.2.3.tgz", archive)
+	assert.ErrorContains(t, err, "invalid provenance signature")
+}
+
+func TestSignPGPSelectsKey(t *testing.T) {
+	first := throwawayPGPEntity(t, "first")
+	second := throwawayPGPEntity(t, "second")
+	keyring := armoredSecretKeyring(t, first, second)
+	secondPublic := armoredPublicKeyring(t, second)
+	archive := []byte("packaged chart bytes")
+
+	_, err := SignPGP(bytes.NewReader(keyring), "", "", "nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	assert.ErrorContains(t, err, "more than one private key")
+
+	_, err = SignPGP(bytes.NewReader(keyring), "third", "", "nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	assert.ErrorContains(t, err, `no private key named "third"`)
+
+	prov, err := SignPGP(bytes.NewReader(keyring), "second@example.com", "", "nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	require.NoError(t, err)
+	require.NoError(t, VerifyPGP(bytes.NewReader(secondPublic), prov, "nginx-1.2.3.tgz", archive))
+}
+
+func TestSignCosign(t *testing.T) {
+	private, public := throwawayCosignKey(t)
+	_, otherPublic := throwawayCosignKey(t)
+	archive := []byte("packaged chart bytes")
+
+	sig, err := SignCosign(private, archive)
+	require.NoError(t, err)
+
+	require.NoError(t, VerifyCosign(public, archive, sig))
+	assert.ErrorContains(t, VerifyCosign(public, []byte("tampered chart bytes"), sig), "invalid cosign signature")
+	assert.ErrorContains(t, VerifyCosign(otherPublic, archive, sig), "invalid cosign signature")
+}
+
+func TestSignCosignRejectsKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     []byte
+		wantErr string
+	}{
+		{name: "not pem", key: []byte("not a key"), wantErr: "isn't PEM encoded"},
+		{name: "encrypted", key: pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED SIGSTORE PRIVATE KEY", Bytes: []byte("secret")}), wantErr: "encrypted cosign keys aren't supported"},
+		{name: "garbage", key: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("secret")}), wantErr: "failed to parse cosign EC private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := SignCosign(tt.key, []byte("archive"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.NotContains(t, err.Error(), "secret")
+		})
+	}
+}
+
+func TestConfigWarnings(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, []byte("key"), 0600))
+
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "not signing", config: Config{}},
+		{name: "pgp with keyring", config: Config{Method: MethodPGP, PGPKeyring: keyPath}},
+		{name: "pgp without keyring", config: Config{Method: MethodPGP}, want: "CHARTSMITH_EXPORT_PGP_KEYRING isn't set"},
+		{name: "cosign with missing key", config: Config{Method: MethodCosign, CosignKey: filepath.Join(t.TempDir(), "missing.pem")}, want: "can't be read"},
+		{name: "cosign without key", config: Config{Method: MethodCosign}, want: "CHARTSMITH_EXPORT_COSIGN_KEY isn't set"},
+		{name: "unknown method", config: Config{Method: "gpg"}, want: `CHARTSMITH_EXPORT_SIGNING is "gpg"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := tt.config.Warnings()
+			if tt.want == "" {
+				assert.Empty(t, warnings)
+				return
+			}
+			require.Len(t, warnings, 1)
+			assert.Contains(t, warnings[0], tt.want)
+		})
+	}
+}
+
+func TestConfigSign(t *testing.T) {
+	dir := t.TempDir()
+	secret, public := throwawayPGPKey(t, "chartsmith")
+	keyringPath := filepath.Join(dir, "secring.asc")
+	require.NoError(t, os.WriteFile(keyringPath, secret, 0600))
+
+	cosignPrivate, cosignPublic := throwawayCosignKey(t)
+	cosignPath := filepath.Join(dir, "cosign.key")
+	require.NoError(t, os.WriteFile(cosignPath, cosignPrivate, 0600))
+
+	archive := []byte("packaged chart bytes")
+
+	sig, err := Config{}.Sign("nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	require.NoError(t, err)
+	assert.Nil(t, sig)
+
+	sig, err = Config{Method: MethodPGP, PGPKeyring: keyringPath}.Sign("nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	require.NoError(t, err)
+	assert.Equal(t, "nginx-1.2.3.tgz.prov", sig.Filename)
+	require.NoError(t, VerifyPGP(bytes.NewReader(public), sig.Content, "nginx-1.2.3.tgz", archive))
+
+	sig, err = Config{Method: MethodCosign, CosignKey: cosignPath}.Sign("nginx-1.2.3.tgz", archive, []byte(testChartYAML))
+	require.NoError(t, err)
+	assert.Equal(t, "nginx-1.2.3.tgz.sig", sig.Filename)
+	require.NoError(t, VerifyCosign(cosignPublic, archive, sig.Content))
+}
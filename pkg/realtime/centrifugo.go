@@ -45,12 +45,20 @@ func Init(c *types.Config) {
 	}()
 }
 
+// journalSequenceKey is the key in each message that holds the event's journal sequence. Clients
+// that reconnect pass the last sequence they saw to replay the events they missed.
+const journalSequenceKey = "eventSequence"
+
 func SendEvent(ctx context.Context, r types.Recipient, e types.Event) error {
 	messageData, err := e.GetMessageData()
 	if err != nil {
 		return err
 	}
 
+	if err := journalEvent(ctx, e, messageData); err != nil {
+		logger.Errorf("Failed to store event in journal: %v", err)
+	}
+
 	for _, userID := range r.GetUserIDs() {
 		if err := storeEventForReplay(ctx, r, e, messageData); err != nil {
 			logger.Errorf("Failed to store event for replay: %v", err)
@@ -65,6 +73,20 @@ func SendEvent(ctx context.Context, r types.Recipient, e types.Event) error {
 	return nil
 }
 
+// journalEvent stores the event in the workspace's journal and adds its sequence to messageData
+func journalEvent(ctx context.Context, e types.Event, messageData map[string]interface{}) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	sequence, err := appendToJournal(ctx, conn, e.GetChannelName(), messageData)
+	if err != nil {
+		return err
+	}
+	messageData[journalSequenceKey] = sequence
+
+	return nil
+}
+
 func storeEventForReplay(ctx context.Context, r types.Recipient, e types.Event, messageData map[string]interface{}) error {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
@@ -0,0 +1,120 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+)
+
+const (
+	// JournalPruneInterval is how often old events are removed from the journal
+	JournalPruneInterval = 5 * time.Minute
+
+	// journalRetention is how long events are kept for reconnecting clients to replay
+	journalRetention = time.Hour
+
+	// journalMaxEventsPerWorkspace bounds the journal for workspaces that send a lot of events,
+	// such as long renders
+	journalMaxEventsPerWorkspace = 1000
+)
+
+// JournalEvent is an event that was sent to a workspace, as stored in the journal
+type JournalEvent struct {
+	Sequence    int64                  `json:"sequence"`
+	CreatedAt   time.Time              `json:"createdAt"`
+	MessageData map[string]interface{} `json:"messageData"`
+}
+
+type journalDB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ListJournalEventsSince returns the events sent to a workspace after the given sequence, oldest first
+func ListJournalEventsSince(ctx context.Context, workspaceID string, since int64) ([]JournalEvent, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return listJournalEventsSince(ctx, conn, workspaceID, since)
+}
+
+// PruneJournal removes events older than the retention window, and events beyond the most recent
+// journalMaxEventsPerWorkspace for each workspace
+func PruneJournal(ctx context.Context) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if _, err := pruneJournal(ctx, conn, time.Now().Add(-journalRetention), journalMaxEventsPerWorkspace); err != nil {
+		return fmt.Errorf("failed to prune realtime event journal: %w", err)
+	}
+
+	return nil
+}
+
+// appendToJournal stores an event and returns its sequence. Sequences are allocated from a
+// per-workspace counter so they keep increasing after old events are pruned. They're allocated
+// before the event is published, so events sent at the same time can arrive out of order, and
+// clients replay the sequences they skipped instead of dropping events below the highest one.
+func appendToJournal(ctx context.Context, db journalDB, workspaceID string, messageData map[string]interface{}) (int64, error) {
+	query := `WITH next AS (
+		INSERT INTO realtime_event_sequence (workspace_id, last_sequence) VALUES ($1, 1)
+		ON CONFLICT (workspace_id) DO UPDATE SET last_sequence = realtime_event_sequence.last_sequence + 1
+		RETURNING last_sequence
+	)
+	INSERT INTO realtime_event_journal (workspace_id, sequence, created_at, message_data)
+	SELECT $1, last_sequence, now(), $2 FROM next
+	RETURNING sequence`
+
+	var sequence int64
+	if err := db.QueryRow(ctx, query, workspaceID, messageData).Scan(&sequence); err != nil {
+		return 0, fmt.Errorf("failed to append event to journal: %w", err)
+	}
+
+	return sequence, nil
+}
+
+func listJournalEventsSince(ctx context.Context, db journalDB, workspaceID string, since int64) ([]JournalEvent, error) {
+	query := `SELECT sequence, created_at, message_data FROM realtime_event_journal
+		WHERE workspace_id = $1 AND sequence > $2
+		ORDER BY sequence ASC`
+
+	rows, err := db.Query(ctx, query, workspaceID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []JournalEvent{}
+	for rows.Next() {
+		var event JournalEvent
+		if err := rows.Scan(&event.Sequence, &event.CreatedAt, &event.MessageData); err != nil {
+			return nil, fmt.Errorf("failed to scan journal event: %w", err)
+		}
+		event.MessageData[journalSequenceKey] = event.Sequence
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating journal events: %w", err)
+	}
+
+	return events, nil
+}
+
+func pruneJournal(ctx context.Context, db journalDB, olderThan time.Time, maxEventsPerWorkspace int) (int64, error) {
+	query := `DELETE FROM realtime_event_journal j
+		WHERE j.created_at < $1
+		OR j.sequence <= (SELECT s.last_sequence - $2 FROM realtime_event_sequence s WHERE s.workspace_id = j.workspace_id)`
+
+	tag, err := db.Exec(ctx, query, olderThan, maxEventsPerWorkspace)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete journal events: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,117 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJournalDB connects to the database in CHARTSMITH_TEST_PG_URI, skipping the test if it isn't set
+func testJournalDB(t *testing.T) *pgx.Conn {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping journal integration test")
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, connStr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	return conn
+}
+
+var testWorkspaceCount int
+
+func testWorkspaceID(t *testing.T, conn *pgx.Conn) string {
+	testWorkspaceCount++
+	id := fmt.Sprintf("journal-test-%d-%d", time.Now().UnixNano(), testWorkspaceCount)
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM realtime_event_journal WHERE workspace_id = $1`, id)
+		conn.Exec(context.Background(), `DELETE FROM realtime_event_sequence WHERE workspace_id = $1`, id)
+	})
+	return id
+}
+
+func journalSequences(events []JournalEvent) []int64 {
+	sequences := []int64{}
+	for _, event := range events {
+		sequences = append(sequences, event.Sequence)
+	}
+	return sequences
+}
+
+func TestJournalOrdering(t *testing.T) {
+	conn := testJournalDB(t)
+	ctx := context.Background()
+
+	workspaceID := testWorkspaceID(t, conn)
+	otherWorkspaceID := testWorkspaceID(t, conn)
+
+	for i := 1; i <= 5; i++ {
+		sequence, err := appendToJournal(ctx, conn, workspaceID, map[string]interface{}{"eventType": "plan-updated", "n": i})
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), sequence)
+
+		// sequences are per workspace, events to other workspaces don't create gaps
+		_, err = appendToJournal(ctx, conn, otherWorkspaceID, map[string]interface{}{"eventType": "render-file"})
+		require.NoError(t, err)
+	}
+
+	events, err := listJournalEventsSince(ctx, conn, workspaceID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4, 5}, journalSequences(events))
+
+	for _, event := range events {
+		assert.Equal(t, "plan-updated", event.MessageData["eventType"])
+		assert.Equal(t, event.Sequence, event.MessageData[journalSequenceKey])
+	}
+
+	events, err = listJournalEventsSince(ctx, conn, workspaceID, 5)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestJournalPruning(t *testing.T) {
+	conn := testJournalDB(t)
+	ctx := context.Background()
+
+	workspaceID := testWorkspaceID(t, conn)
+	for i := 0; i < 5; i++ {
+		_, err := appendToJournal(ctx, conn, workspaceID, map[string]interface{}{"eventType": "render-stream"})
+		require.NoError(t, err)
+	}
+
+	// keep the 2 most recent events
+	_, err := pruneJournal(ctx, conn, time.Now().Add(-time.Hour), 2)
+	require.NoError(t, err)
+
+	events, err := listJournalEventsSince(ctx, conn, workspaceID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, journalSequences(events))
+
+	// everything is older than the retention window
+	_, err = pruneJournal(ctx, conn, time.Now().Add(time.Hour), 1000)
+	require.NoError(t, err)
+
+	events, err = listJournalEventsSince(ctx, conn, workspaceID, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	// sequences keep increasing after the journal is emptied, so clients can't mistake new events for old ones
+	sequence, err := appendToJournal(ctx, conn, workspaceID, map[string]interface{}{"eventType": "render-stream"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), sequence)
+}
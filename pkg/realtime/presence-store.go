@@ -0,0 +1,213 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/realtime/types"
+)
+
+// MemoryPresenceStore holds presence in the worker's memory, so each replica only knows about the
+// heartbeats it received
+type MemoryPresenceStore struct {
+	mu sync.Mutex
+	// presence is keyed by workspace and then by user
+	presence map[string]map[string]types.Presence
+}
+
+var _ PresenceStore = &MemoryPresenceStore{}
+
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{presence: map[string]map[string]types.Presence{}}
+}
+
+func (s *MemoryPresenceStore) Touch(ctx context.Context, presence types.Presence) (*types.Presence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, ok := s.presence[presence.WorkspaceID]
+	if !ok {
+		users = map[string]types.Presence{}
+		s.presence[presence.WorkspaceID] = users
+	}
+
+	var previous *types.Presence
+	if p, ok := users[presence.UserID]; ok {
+		previous = &p
+	}
+	users[presence.UserID] = presence
+	return previous, nil
+}
+
+func (s *MemoryPresenceStore) Remove(ctx context.Context, workspaceID string, userID string) (*types.Presence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.presence[workspaceID][userID]
+	if !ok {
+		return nil, nil
+	}
+	s.remove(workspaceID, userID)
+	return &p, nil
+}
+
+func (s *MemoryPresenceStore) List(ctx context.Context, workspaceID string, since time.Time) ([]types.Presence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	present := []types.Presence{}
+	for _, p := range s.presence[workspaceID] {
+		if p.LastSeenAt.After(since) {
+			present = append(present, p)
+		}
+	}
+	sort.Slice(present, func(i, j int) bool { return present[i].UserID < present[j].UserID })
+	return present, nil
+}
+
+func (s *MemoryPresenceStore) Expire(ctx context.Context, before time.Time) ([]types.Presence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := []types.Presence{}
+	for workspaceID, users := range s.presence {
+		for userID, p := range users {
+			if p.LastSeenAt.Before(before) {
+				expired = append(expired, p)
+				s.remove(workspaceID, userID)
+			}
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].WorkspaceID != expired[j].WorkspaceID {
+			return expired[i].WorkspaceID < expired[j].WorkspaceID
+		}
+		return expired[i].UserID < expired[j].UserID
+	})
+	return expired, nil
+}
+
+// remove deletes a user's presence, and the workspace once nobody is in it. s.mu must be held.
+func (s *MemoryPresenceStore) remove(workspaceID string, userID string) {
+	delete(s.presence[workspaceID], userID)
+	if len(s.presence[workspaceID]) == 0 {
+		delete(s.presence, workspaceID)
+	}
+}
+
+// postgresPresenceStore holds presence in the workspace_presence table, shared by every replica.
+// Expire deletes the rows it returns, so only one replica sends the left event for each user.
+type postgresPresenceStore struct{}
+
+var _ PresenceStore = &postgresPresenceStore{}
+
+const presenceColumns = `workspace_id, user_id, user_name, file_path, last_seen_at`
+
+func (s *postgresPresenceStore) Touch(ctx context.Context, presence types.Presence) (*types.Presence, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	// the previous row is read in the same statement, so two heartbeats of a user don't both
+	// see themselves as a join
+	query := `WITH previous AS (
+		SELECT file_path, last_seen_at FROM workspace_presence
+		WHERE workspace_id = $1 AND user_id = $2
+		FOR UPDATE
+	), touched AS (
+		INSERT INTO workspace_presence (workspace_id, user_id, user_name, file_path, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET
+			user_name = EXCLUDED.user_name, file_path = EXCLUDED.file_path, last_seen_at = EXCLUDED.last_seen_at
+	)
+	SELECT file_path, last_seen_at FROM previous`
+
+	var filePath string
+	var lastSeenAt time.Time
+	rows, err := conn.Query(ctx, query, presence.WorkspaceID, presence.UserID, presence.UserName, presence.FilePath, presence.LastSeenAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert presence: %w", err)
+	}
+	defer rows.Close()
+
+	var previous *types.Presence
+	if rows.Next() {
+		if err := rows.Scan(&filePath, &lastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan presence: %w", err)
+		}
+		previous = &types.Presence{
+			WorkspaceID: presence.WorkspaceID,
+			UserID:      presence.UserID,
+			UserName:    presence.UserName,
+			FilePath:    filePath,
+			LastSeenAt:  lastSeenAt,
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to upsert presence: %w", err)
+	}
+
+	return previous, nil
+}
+
+func (s *postgresPresenceStore) Remove(ctx context.Context, workspaceID string, userID string) (*types.Presence, error) {
+	presence, err := s.query(ctx, `DELETE FROM workspace_presence WHERE workspace_id = $1 AND user_id = $2
+		RETURNING `+presenceColumns, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(presence) == 0 {
+		return nil, nil
+	}
+	return &presence[0], nil
+}
+
+func (s *postgresPresenceStore) List(ctx context.Context, workspaceID string, since time.Time) ([]types.Presence, error) {
+	return s.query(ctx, `SELECT `+presenceColumns+` FROM workspace_presence
+		WHERE workspace_id = $1 AND last_seen_at > $2
+		ORDER BY user_id`, workspaceID, since)
+}
+
+func (s *postgresPresenceStore) Expire(ctx context.Context, before time.Time) ([]types.Presence, error) {
+	expired, err := s.query(ctx, `DELETE FROM workspace_presence WHERE last_seen_at < $1
+		RETURNING `+presenceColumns, before)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].WorkspaceID != expired[j].WorkspaceID {
+			return expired[i].WorkspaceID < expired[j].WorkspaceID
+		}
+		return expired[i].UserID < expired[j].UserID
+	})
+	return expired, nil
+}
+
+func (s *postgresPresenceStore) query(ctx context.Context, query string, args ...any) ([]types.Presence, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query presence: %w", err)
+	}
+	defer rows.Close()
+
+	presence := []types.Presence{}
+	for rows.Next() {
+		var p types.Presence
+		if err := rows.Scan(&p.WorkspaceID, &p.UserID, &p.UserName, &p.FilePath, &p.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan presence: %w", err)
+		}
+		presence = append(presence, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating presence: %w", err)
+	}
+
+	return presence, nil
+}
@@ -0,0 +1,196 @@
+package realtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/realtime/types"
+)
+
+const (
+	// PresenceTTL is how long a user is present after their last heartbeat. Clients send one
+	// every 10 seconds while a workspace is open.
+	PresenceTTL = 30 * time.Second
+
+	// PresenceSweepInterval is how often the users whose heartbeats stopped are removed and a
+	// left event is sent for them
+	PresenceSweepInterval = 10 * time.Second
+)
+
+// PresenceStore holds who is present in each workspace. The memory store is enough for a single
+// worker, workers with more than one replica share the postgres store.
+type PresenceStore interface {
+	// Touch records a heartbeat and returns the presence it replaced, nil when the user wasn't
+	// present
+	Touch(ctx context.Context, presence types.Presence) (*types.Presence, error)
+	// Remove forgets a user in a workspace and returns their presence, nil when they weren't present
+	Remove(ctx context.Context, workspaceID string, userID string) (*types.Presence, error)
+	// List returns the users in a workspace whose last heartbeat is after since, ordered by user
+	List(ctx context.Context, workspaceID string, since time.Time) ([]types.Presence, error)
+	// Expire removes the users whose last heartbeat is before before and returns them
+	Expire(ctx context.Context, before time.Time) ([]types.Presence, error)
+}
+
+// DefaultPresenceStore is the presence store used when CHARTSMITH_PRESENCE_STORE isn't set
+const DefaultPresenceStore = "memory"
+
+// presenceStores are the presence stores that can be configured, by name
+var presenceStores = map[string]func() PresenceStore{
+	"memory":   func() PresenceStore { return NewMemoryPresenceStore() },
+	"postgres": func() PresenceStore { return &postgresPresenceStore{} },
+}
+
+var presenceStore PresenceStore = NewMemoryPresenceStore()
+
+// sendPresenceEvent is a var so that presence can be tested without centrifugo
+var sendPresenceEvent = SendEvent
+
+// InitPresence selects the presence store named by CHARTSMITH_PRESENCE_STORE, or the default for
+// an empty name
+func InitPresence(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultPresenceStore
+	}
+
+	construct, ok := presenceStores[name]
+	if !ok {
+		names := []string{}
+		for n := range presenceStores {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown presence store %q, must be one of %s", name, strings.Join(names, ", "))
+	}
+	presenceStore = construct()
+	return nil
+}
+
+// Heartbeat records that a user has a workspace open with a file, and sends a presence-changed
+// event to r when they joined or opened another file. It returns everyone in the workspace.
+func Heartbeat(ctx context.Context, r types.Recipient, presence types.Presence) ([]types.Presence, error) {
+	return heartbeat(ctx, presenceStore, r, presence, time.Now())
+}
+
+// Leave forgets a user in a workspace, and sends a presence-changed event to r if they were present
+func Leave(ctx context.Context, r types.Recipient, workspaceID string, userID string) error {
+	return leave(ctx, presenceStore, r, workspaceID, userID, time.Now())
+}
+
+// GetPresence returns the users that have a workspace open, ordered by user
+func GetPresence(ctx context.Context, workspaceID string) ([]types.Presence, error) {
+	present, err := presenceStore.List(ctx, workspaceID, time.Now().Add(-PresenceTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presence: %w", err)
+	}
+	return present, nil
+}
+
+// PresentOnFile returns the users other than userID that have a file of a workspace open
+func PresentOnFile(ctx context.Context, workspaceID string, filePath string, userID string) ([]types.Presence, error) {
+	present, err := GetPresence(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	onFile := []types.Presence{}
+	for _, p := range present {
+		if p.UserID != userID && p.FilePath == filePath {
+			onFile = append(onFile, p)
+		}
+	}
+	return onFile, nil
+}
+
+// ExpirePresence removes the users whose heartbeats stopped and sends a presence-changed event for
+// each of them to the users of their workspace
+func ExpirePresence(ctx context.Context, listUserIDs func(ctx context.Context, workspaceID string) ([]string, error)) error {
+	return expirePresence(ctx, presenceStore, listUserIDs, time.Now())
+}
+
+func heartbeat(ctx context.Context, store PresenceStore, r types.Recipient, presence types.Presence, now time.Time) ([]types.Presence, error) {
+	presence.LastSeenAt = now
+	previous, err := store.Touch(ctx, presence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record presence: %w", err)
+	}
+
+	present, err := store.List(ctx, presence.WorkspaceID, now.Add(-PresenceTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list presence: %w", err)
+	}
+
+	change := ""
+	switch {
+	// a heartbeat after the TTL is a join even when the sweep hasn't removed the user yet
+	case previous == nil || !previous.LastSeenAt.After(now.Add(-PresenceTTL)):
+		change = types.PresenceJoined
+	case previous.FilePath != presence.FilePath:
+		change = types.PresenceFileChanged
+	default:
+		return present, nil
+	}
+
+	if err := sendPresenceChanged(ctx, r, change, presence, present); err != nil {
+		return nil, err
+	}
+	return present, nil
+}
+
+func leave(ctx context.Context, store PresenceStore, r types.Recipient, workspaceID string, userID string, now time.Time) error {
+	previous, err := store.Remove(ctx, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove presence: %w", err)
+	}
+	if previous == nil {
+		return nil
+	}
+
+	present, err := store.List(ctx, workspaceID, now.Add(-PresenceTTL))
+	if err != nil {
+		return fmt.Errorf("failed to list presence: %w", err)
+	}
+	return sendPresenceChanged(ctx, r, types.PresenceLeft, *previous, present)
+}
+
+func expirePresence(ctx context.Context, store PresenceStore, listUserIDs func(ctx context.Context, workspaceID string) ([]string, error), now time.Time) error {
+	expired, err := store.Expire(ctx, now.Add(-PresenceTTL))
+	if err != nil {
+		return fmt.Errorf("failed to expire presence: %w", err)
+	}
+
+	for _, presence := range expired {
+		userIDs, err := listUserIDs(ctx, presence.WorkspaceID)
+		if err != nil {
+			return fmt.Errorf("failed to list users of workspace %s: %w", presence.WorkspaceID, err)
+		}
+		present, err := store.List(ctx, presence.WorkspaceID, now.Add(-PresenceTTL))
+		if err != nil {
+			return fmt.Errorf("failed to list presence: %w", err)
+		}
+		if err := sendPresenceChanged(ctx, types.Recipient{UserIDs: userIDs}, types.PresenceLeft, presence, present); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendPresenceChanged(ctx context.Context, r types.Recipient, change string, presence types.Presence, present []types.Presence) error {
+	if len(r.GetUserIDs()) == 0 {
+		return nil
+	}
+
+	event := types.PresenceChangedEvent{
+		WorkspaceID: presence.WorkspaceID,
+		Change:      change,
+		Presence:    presence,
+		Present:     present,
+	}
+	if err := sendPresenceEvent(ctx, r, event); err != nil {
+		return fmt.Errorf("failed to send presence changed event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/realtime/types"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPresenceEvents records the presence events that would be sent
+func stubPresenceEvents(t *testing.T) *[]types.PresenceChangedEvent {
+	original := sendPresenceEvent
+	t.Cleanup(func() { sendPresenceEvent = original })
+
+	events := []types.PresenceChangedEvent{}
+	sendPresenceEvent = func(ctx context.Context, r types.Recipient, e types.Event) error {
+		events = append(events, e.(types.PresenceChangedEvent))
+		return nil
+	}
+	return &events
+}
+
+func presenceChanges(events []types.PresenceChangedEvent) []string {
+	changes := []string{}
+	for _, e := range events {
+		changes = append(changes, e.Change+" "+e.Presence.UserID+" "+e.Presence.FilePath)
+	}
+	return changes
+}
+
+func TestHeartbeatEvents(t *testing.T) {
+	ctx := context.Background()
+	events := stubPresenceEvents(t)
+	store := NewMemoryPresenceStore()
+	r := types.Recipient{UserIDs: []string{"alice", "bob"}}
+	start := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	_, err := heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "alice", UserName: "Alice", FilePath: "values.yaml"}, start)
+	require.NoError(t, err)
+	present, err := heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "bob", FilePath: "Chart.yaml"}, start.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []types.Presence{
+		{WorkspaceID: "ws", UserID: "alice", UserName: "Alice", FilePath: "values.yaml", LastSeenAt: start},
+		{WorkspaceID: "ws", UserID: "bob", FilePath: "Chart.yaml", LastSeenAt: start.Add(time.Second)},
+	}, present)
+
+	_, err = heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "alice", UserName: "Alice", FilePath: "values.yaml"}, start.Add(10*time.Second))
+	require.NoError(t, err)
+	_, err = heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "bob", FilePath: "values.yaml"}, start.Add(11*time.Second))
+	require.NoError(t, err)
+	require.NoError(t, leave(ctx, store, r, "ws", "alice", start.Add(12*time.Second)))
+	require.NoError(t, leave(ctx, store, r, "ws", "alice", start.Add(13*time.Second)))
+
+	assert.Equal(t, []string{
+		"joined alice values.yaml",
+		"joined bob Chart.yaml",
+		"file-changed bob values.yaml",
+		"left alice values.yaml",
+	}, presenceChanges(*events), "a heartbeat on the same file and leaving twice send nothing")
+	assert.Len(t, (*events)[1].Present, 2, "the event has everyone present after the change")
+	assert.Len(t, (*events)[3].Present, 1)
+}
+
+func TestPresenceTTL(t *testing.T) {
+	ctx := context.Background()
+	events := stubPresenceEvents(t)
+	store := NewMemoryPresenceStore()
+	r := types.Recipient{UserIDs: []string{"alice", "bob"}}
+	start := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	_, err := heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "alice", FilePath: "values.yaml"}, start)
+	require.NoError(t, err)
+	_, err = heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "bob", FilePath: "values.yaml"}, start.Add(20*time.Second))
+	require.NoError(t, err)
+
+	expiresAt := start.Add(PresenceTTL + time.Second)
+	present, err := store.List(ctx, "ws", expiresAt.Add(-PresenceTTL))
+	require.NoError(t, err)
+	require.Len(t, present, 1, "a user isn't present once their heartbeats stop for the TTL")
+	assert.Equal(t, "bob", present[0].UserID)
+
+	var listedFor []string
+	listUserIDs := func(ctx context.Context, workspaceID string) ([]string, error) {
+		listedFor = append(listedFor, workspaceID)
+		return []string{"alice", "bob"}, nil
+	}
+	require.NoError(t, expirePresence(ctx, store, listUserIDs, expiresAt))
+	assert.Equal(t, []string{"ws"}, listedFor)
+	assert.Equal(t, []string{
+		"joined alice values.yaml",
+		"joined bob values.yaml",
+		"left alice values.yaml",
+	}, presenceChanges(*events))
+	assert.Equal(t, []types.Presence{{WorkspaceID: "ws", UserID: "bob", FilePath: "values.yaml", LastSeenAt: start.Add(20 * time.Second)}}, (*events)[2].Present)
+
+	require.NoError(t, expirePresence(ctx, store, listUserIDs, expiresAt.Add(time.Second)))
+	assert.Len(t, *events, 3, "a user is only expired once")
+
+	// a heartbeat after the TTL that the sweep didn't see yet is a join
+	_, err = heartbeat(ctx, store, r, types.Presence{WorkspaceID: "ws", UserID: "bob", FilePath: "values.yaml"}, start.Add(20*time.Second+PresenceTTL+time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, "joined bob values.yaml", presenceChanges(*events)[3])
+}
+
+func TestPresenceEventFailure(t *testing.T) {
+	original := sendPresenceEvent
+	t.Cleanup(func() { sendPresenceEvent = original })
+	sendPresenceEvent = func(ctx context.Context, r types.Recipient, e types.Event) error {
+		return errors.New("centrifugo unavailable")
+	}
+
+	_, err := heartbeat(context.Background(), NewMemoryPresenceStore(), types.Recipient{UserIDs: []string{"alice"}}, types.Presence{WorkspaceID: "ws", UserID: "alice"}, time.Now())
+	assert.ErrorContains(t, err, "failed to send presence changed event")
+}
+
+func TestInitPresence(t *testing.T) {
+	original := presenceStore
+	t.Cleanup(func() { presenceStore = original })
+
+	require.NoError(t, InitPresence(""))
+	assert.IsType(t, &MemoryPresenceStore{}, presenceStore)
+	require.NoError(t, InitPresence("postgres"))
+	assert.IsType(t, &postgresPresenceStore{}, presenceStore)
+	assert.ErrorContains(t, InitPresence("redis"), `unknown presence store "redis", must be one of memory, postgres`)
+}
+
+// TestPostgresPresenceStore runs against the database in CHARTSMITH_TEST_PG_URI
+func TestPostgresPresenceStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping presence integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := fmt.Sprintf("presence-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		conn := persistence.MustGetPooledPostgresSession()
+		defer conn.Release()
+		conn.Exec(context.Background(), `DELETE FROM workspace_presence WHERE workspace_id = $1`, workspaceID)
+	})
+
+	store := &postgresPresenceStore{}
+	start := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	previous, err := store.Touch(ctx, types.Presence{WorkspaceID: workspaceID, UserID: "alice", UserName: "Alice", FilePath: "values.yaml", LastSeenAt: start})
+	require.NoError(t, err)
+	assert.Nil(t, previous)
+	previous, err = store.Touch(ctx, types.Presence{WorkspaceID: workspaceID, UserID: "alice", UserName: "Alice", FilePath: "Chart.yaml", LastSeenAt: start.Add(10 * time.Second)})
+	require.NoError(t, err)
+	require.NotNil(t, previous)
+	assert.Equal(t, "values.yaml", previous.FilePath)
+	assert.True(t, previous.LastSeenAt.Equal(start))
+	_, err = store.Touch(ctx, types.Presence{WorkspaceID: workspaceID, UserID: "bob", FilePath: "Chart.yaml", LastSeenAt: start.Add(20 * time.Second)})
+	require.NoError(t, err)
+
+	present, err := store.List(ctx, workspaceID, start.Add(5*time.Second))
+	require.NoError(t, err)
+	require.Len(t, present, 2)
+	assert.Equal(t, "Alice", present[0].UserName)
+	assert.Equal(t, "Chart.yaml", present[0].FilePath)
+
+	expired, err := store.Expire(ctx, start.Add(15*time.Second))
+	require.NoError(t, err)
+	expiredHere := []string{}
+	for _, p := range expired {
+		if p.WorkspaceID == workspaceID {
+			expiredHere = append(expiredHere, p.UserID)
+		}
+	}
+	assert.Equal(t, []string{"alice"}, expiredHere)
+
+	removed, err := store.Remove(ctx, workspaceID, "bob")
+	require.NoError(t, err)
+	require.NotNil(t, removed)
+	assert.Equal(t, "bob", removed.UserID)
+	removed, err = store.Remove(ctx, workspaceID, "bob")
+	require.NoError(t, err)
+	assert.Nil(t, removed)
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var _ Event = ClusterDryRunEvent{}
+
+// ClusterDryRunEvent is sent when a rendered chart was validated against a cluster
+type ClusterDryRunEvent struct {
+	WorkspaceID     string                               `json:"workspaceId"`
+	RenderID        string                               `json:"renderId"`
+	RenderedChartID string                               `json:"renderedChartId"`
+	Results         []workspacetypes.ClusterDryRunResult `json:"results"`
+}
+
+func (e ClusterDryRunEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId":     e.WorkspaceID,
+		"eventType":       "cluster-dry-run",
+		"renderId":        e.RenderID,
+		"renderedChartId": e.RenderedChartID,
+		"results":         e.Results,
+	}, nil
+}
+
+func (e ClusterDryRunEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
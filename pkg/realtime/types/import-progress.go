@@ -0,0 +1,45 @@
+package types
+
+import (
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var _ Event = ImportProgressEvent{}
+var _ Event = ImportCompleteEvent{}
+
+// ImportProgressEvent is sent as the files of an imported chart are inserted, and when the
+// import fails
+type ImportProgressEvent struct {
+	WorkspaceID string                        `json:"workspaceId"`
+	Progress    workspacetypes.ImportProgress `json:"progress"`
+}
+
+func (e ImportProgressEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId": e.WorkspaceID,
+		"eventType":   "import-progress",
+		"progress":    e.Progress,
+	}, nil
+}
+
+func (e ImportProgressEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
+
+// ImportCompleteEvent is sent when every file of an imported chart is in the workspace
+type ImportCompleteEvent struct {
+	WorkspaceID string                     `json:"workspaceId"`
+	Stats       workspacetypes.ImportStats `json:"stats"`
+}
+
+func (e ImportCompleteEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId": e.WorkspaceID,
+		"eventType":   "import-complete",
+		"stats":       e.Stats,
+	}, nil
+}
+
+func (e ImportCompleteEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var _ Event = ImportReportEvent{}
+
+// ImportReportEvent is sent when an imported chart is in the workspace, with what validating its
+// files found
+type ImportReportEvent struct {
+	WorkspaceID string                      `json:"workspaceId"`
+	Report      workspacetypes.ImportReport `json:"report"`
+}
+
+func (e ImportReportEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId": e.WorkspaceID,
+		"eventType":   "import-report",
+		"report":      e.Report,
+	}, nil
+}
+
+func (e ImportReportEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -6,17 +6,43 @@ import (
 
 var _ Event = PlanUpdatedEvent{}
 
+// PlanUpdatedEvent sends a plan, or only what changed in it while it's executed and applied
 type PlanUpdatedEvent struct {
 	WorkspaceID string               `json:"workspaceId"`
 	Plan        *workspacetypes.Plan `json:"plan"`
+	// Changes is sent instead of Plan for changes to the action files of a plan, clients that
+	// don't have the plan fetch it
+	Changes *PlanChanges `json:"planChanges,omitempty"`
+	// LintFindings is the number of lint findings in the workspace, set when an action completes
+	LintFindings *int `json:"lintFindings,omitempty"`
+	// HealthScore is the health score of the plan's revision, set when the plan is applied
+	HealthScore *int `json:"healthScore,omitempty"`
 }
 
 func (e PlanUpdatedEvent) GetMessageData() (map[string]interface{}, error) {
-	return map[string]interface{}{
+	data := map[string]interface{}{
 		"workspaceId": e.WorkspaceID,
 		"eventType":   "plan-updated",
-		"plan":        e.Plan,
-	}, nil
+	}
+	if e.Changes != nil {
+		data["planChanges"] = e.Changes
+	} else {
+		data["plan"] = e.Plan
+	}
+	if e.LintFindings != nil {
+		data["lintFindings"] = *e.LintFindings
+	}
+	if e.HealthScore != nil {
+		data["healthScore"] = *e.HealthScore
+	}
+	return data, nil
+}
+
+// PlanChanges is the status of a plan and the action files of it that changed, each as it is now
+type PlanChanges struct {
+	PlanID      string                      `json:"id"`
+	Status      workspacetypes.PlanStatus   `json:"status"`
+	ActionFiles []workspacetypes.ActionFile `json:"actionFiles"`
 }
 
 func (e PlanUpdatedEvent) GetChannelName() string {
@@ -0,0 +1,45 @@
+package types
+
+import "time"
+
+// Presence is a user that has a workspace open, and the file they're viewing
+type Presence struct {
+	WorkspaceID string `json:"workspaceId"`
+	UserID      string `json:"userId"`
+	UserName    string `json:"userName,omitempty"`
+	// FilePath is the file the user has open, empty when they don't have one open
+	FilePath   string    `json:"filePath,omitempty"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+}
+
+// the changes a PresenceChangedEvent is sent for
+const (
+	PresenceJoined      = "joined"
+	PresenceLeft        = "left"
+	PresenceFileChanged = "file-changed"
+)
+
+var _ Event = PresenceChangedEvent{}
+
+// PresenceChangedEvent is sent when a user opens a workspace, leaves it or stops sending
+// heartbeats, or opens another file. Present is everyone in the workspace after the change.
+type PresenceChangedEvent struct {
+	WorkspaceID string     `json:"workspaceId"`
+	Change      string     `json:"change"`
+	Presence    Presence   `json:"presence"`
+	Present     []Presence `json:"present"`
+}
+
+func (e PresenceChangedEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId": e.WorkspaceID,
+		"eventType":   "presence-changed",
+		"change":      e.Change,
+		"presence":    e.Presence,
+		"present":     e.Present,
+	}, nil
+}
+
+func (e PresenceChangedEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -0,0 +1,27 @@
+package types
+
+import (
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var _ Event = RenderInventoryEvent{}
+
+// RenderInventoryEvent is sent when a render completes with what it deploys
+type RenderInventoryEvent struct {
+	WorkspaceID string                         `json:"workspaceId"`
+	RenderID    string                         `json:"renderId"`
+	Inventory   workspacetypes.RenderInventory `json:"inventory"`
+}
+
+func (e RenderInventoryEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId": e.WorkspaceID,
+		"eventType":   "render-inventory",
+		"renderId":    e.RenderID,
+		"inventory":   e.Inventory,
+	}, nil
+}
+
+func (e RenderInventoryEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -0,0 +1,29 @@
+package types
+
+var _ Event = RenderNotesEvent{}
+
+// RenderNotesEvent is sent when the NOTES.txt of a rendered chart has been rendered
+type RenderNotesEvent struct {
+	WorkspaceID   string `json:"workspaceId"`
+	RenderID      string `json:"renderId"`
+	RenderChartID string `json:"renderChartId"`
+	// Notes is nil when the chart and its subcharts have no NOTES.txt
+	Notes *string `json:"notes"`
+	// Warning is why the notes couldn't be rendered
+	Warning string `json:"warning,omitempty"`
+}
+
+func (e RenderNotesEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"workspaceId":   e.WorkspaceID,
+		"eventType":     "render-notes",
+		"renderId":      e.RenderID,
+		"renderChartId": e.RenderChartID,
+		"notes":         e.Notes,
+		"warning":       e.Warning,
+	}, nil
+}
+
+func (e RenderNotesEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -2,17 +2,34 @@ package types
 
 import "time"
 
+// RenderStreamStatusSkippedUnchanged is sent when a chart wasn't rendered because none of its
+// files changed since the parent revision, and the output of the previous render was reused.
+const RenderStreamStatusSkippedUnchanged = "skipped-unchanged"
+
+// RenderStreamEvent carries the output of a chart render. The command and output fields
+// contain only what was produced since the previous event for the same render chart;
+// Sequence increases by one with each event so a client can detect a gap and fetch the
+// full render instead.
 type RenderStreamEvent struct {
 	WorkspaceID         string     `json:"workspaceId"`
 	RenderID            string     `json:"renderId"`
 	RenderChartID       string     `json:"renderChartId"`
+	Sequence            int64      `json:"sequence"`
+	Status              string     `json:"status,omitempty"`
 	CompletedAt         *time.Time `json:"completedAt,omitempty"`
+	Error               string     `json:"error,omitempty"`
 	DepUpdateCommand    string     `json:"depUpdateCommand,omitempty"`
 	DepUpdateStdout     string     `json:"depUpdateStdout,omitempty"`
 	DepUpdateStderr     string     `json:"depUpdateStderr,omitempty"`
 	HelmTemplateCommand string     `json:"helmTemplateCommand,omitempty"`
 	HelmTemplateStdout  string     `json:"helmTemplateStdout,omitempty"`
 	HelmTemplateStderr  string     `json:"helmTemplateStderr,omitempty"`
+	// Warnings are the lines of helm template stderr that are non-fatal warnings, only the
+	// warnings since the previous event
+	Warnings []string `json:"warnings,omitempty"`
+	// Compatibility is a one line summary of the Kubernetes versions the chart's output can be
+	// installed on, sent with the completion of a successful render
+	Compatibility string `json:"compatibility,omitempty"`
 }
 
 func (e RenderStreamEvent) GetMessageData() (map[string]interface{}, error) {
@@ -21,13 +38,18 @@ func (e RenderStreamEvent) GetMessageData() (map[string]interface{}, error) {
 		"eventType":           "render-stream",
 		"renderId":            e.RenderID,
 		"renderChartId":       e.RenderChartID,
+		"sequence":            e.Sequence,
+		"status":              e.Status,
 		"completedAt":         e.CompletedAt,
+		"error":               e.Error,
 		"depUpdateCommand":    e.DepUpdateCommand,
 		"depUpdateStdout":     e.DepUpdateStdout,
 		"depUpdateStderr":     e.DepUpdateStderr,
 		"helmTemplateCommand": e.HelmTemplateCommand,
 		"helmTemplateStdout":  e.HelmTemplateStdout,
 		"helmTemplateStderr":  e.HelmTemplateStderr,
+		"warnings":            e.Warnings,
+		"compatibility":       e.Compatibility,
 	}, nil
 }
 
@@ -0,0 +1,26 @@
+package types
+
+import (
+	workspacetypes "github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var _ Event = SecretFindingsEvent{}
+
+// SecretFindingsEvent warns that secrets were found in files written to a workspace. The values
+// in the findings are redacted.
+type SecretFindingsEvent struct {
+	WorkspaceID string                         `json:"workspaceId"`
+	Findings    []workspacetypes.SecretFinding `json:"findings"`
+}
+
+func (e SecretFindingsEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"eventType":   "secret-findings",
+		"workspaceId": e.WorkspaceID,
+		"findings":    e.Findings,
+	}, nil
+}
+
+func (e SecretFindingsEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -0,0 +1,21 @@
+package types
+
+var _ Event = SettingsUpdatedEvent{}
+
+// SettingsUpdatedEvent carries every setting of a workspace after some of them changed
+type SettingsUpdatedEvent struct {
+	WorkspaceID string         `json:"workspaceId"`
+	Settings    map[string]any `json:"settings"`
+}
+
+func (e SettingsUpdatedEvent) GetMessageData() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"eventType":   "settings-updated",
+		"workspaceId": e.WorkspaceID,
+		"settings":    e.Settings,
+	}, nil
+}
+
+func (e SettingsUpdatedEvent) GetChannelName() string {
+	return e.WorkspaceID
+}
@@ -0,0 +1,296 @@
+package recommendations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// repositoryIndexTTL is how long a repository's index.yaml is reused before it's fetched again
+	repositoryIndexTTL = 30 * time.Minute
+	// repositoryIndexTimeout bounds fetching a single index.yaml, some are tens of MB
+	repositoryIndexTimeout = 15 * time.Second
+	// maxRepositoryIndexSize is the largest index.yaml that is read
+	maxRepositoryIndexSize = 64 << 20
+)
+
+// these are how far a dependency is behind the latest version of its chart
+const (
+	DependencyUpToDate     = "up-to-date"
+	DependencyPatchBehind  = "patch"
+	DependencyMinorBehind  = "minor"
+	DependencyMajorBehind  = "major"
+	DependencyNotChecked   = "not checked"
+	DependencyUnreachable  = "unreachable"
+	DependencyNotInIndex   = "not found"
+	DependencyInvalidRange = "invalid version"
+)
+
+// DependencyStatus compares a dependency declared in Chart.yaml with the versions of the chart in
+// its repository
+type DependencyStatus struct {
+	Name       string `json:"name"`
+	Alias      string `json:"alias,omitempty"`
+	Repository string `json:"repository"`
+	// Version is the version or range declared in Chart.yaml
+	Version string `json:"version"`
+	// Current is the highest version in the repository that Version allows
+	Current string `json:"current,omitempty"`
+	// Latest is the highest stable version in the repository
+	Latest string `json:"latest,omitempty"`
+	// Status is one of the Dependency* constants
+	Status string `json:"status"`
+	// Reason explains a status that isn't a comparison, like an unreachable repository
+	Reason string `json:"reason,omitempty"`
+}
+
+// DependencyReport is the status of every dependency of a chart, in Chart.yaml order
+type DependencyReport struct {
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// fetchRepositoryIndex is a var so that dependencies can be checked without a network
+var fetchRepositoryIndex = fetchRepositoryIndexHTTP
+
+type cachedRepositoryIndex struct {
+	versions  map[string][]string
+	fetchedAt time.Time
+}
+
+var (
+	repositoryIndexesMu sync.Mutex
+	repositoryIndexes   = map[string]cachedRepositoryIndex{}
+)
+
+// CheckChartDependencies reports how far each dependency in a Chart.yaml is behind the latest
+// version in its repository. Each repository's index is fetched once. A repository that can't be
+// reached is reported on its dependencies instead of failing the report, and dependencies in OCI
+// registries or on the local filesystem aren't checked.
+func CheckChartDependencies(ctx context.Context, chartYAML string) (*DependencyReport, error) {
+	var chart struct {
+		Dependencies []struct {
+			Name       string `yaml:"name"`
+			Alias      string `yaml:"alias"`
+			Version    string `yaml:"version"`
+			Repository string `yaml:"repository"`
+		} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal([]byte(chartYAML), &chart); err != nil {
+		return nil, fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+
+	report := &DependencyReport{Dependencies: []DependencyStatus{}}
+	indexes := map[string]map[string][]string{}
+	indexErrors := map[string]error{}
+	for _, dep := range chart.Dependencies {
+		status := DependencyStatus{
+			Name:       dep.Name,
+			Alias:      dep.Alias,
+			Repository: dep.Repository,
+			Version:    dep.Version,
+		}
+
+		repoURL := strings.TrimSuffix(strings.TrimSpace(dep.Repository), "/")
+		switch {
+		case strings.HasPrefix(repoURL, "oci://"):
+			status.Status = DependencyNotChecked
+			status.Reason = "OCI registries are not checked"
+		case repoURL == "" || strings.HasPrefix(repoURL, "file://"):
+			status.Status = DependencyNotChecked
+			status.Reason = "local charts are not checked"
+		case !strings.HasPrefix(repoURL, "http://") && !strings.HasPrefix(repoURL, "https://"):
+			// @name and alias:name refer to repositories added to the helm client, which we don't have
+			status.Status = DependencyNotChecked
+			status.Reason = "repository references a helm repo name, not a URL"
+		default:
+			index, fetched := indexes[repoURL]
+			if !fetched && indexErrors[repoURL] == nil {
+				var err error
+				index, err = getRepositoryIndex(ctx, repoURL)
+				if err != nil {
+					indexErrors[repoURL] = err
+				} else {
+					indexes[repoURL] = index
+				}
+			}
+			if err := indexErrors[repoURL]; err != nil {
+				status.Status = DependencyUnreachable
+				status.Reason = err.Error()
+			} else {
+				compareDependencyVersions(&status, index[dep.Name])
+			}
+		}
+
+		report.Dependencies = append(report.Dependencies, status)
+	}
+
+	return report, nil
+}
+
+// compareDependencyVersions sets the current and latest versions of a dependency from the versions
+// of its chart in the repository, and classifies how far behind it is
+func compareDependencyVersions(status *DependencyStatus, available []string) {
+	versions := []*semver.Version{}
+	for _, v := range available {
+		if parsed, err := semver.NewVersion(v); err == nil {
+			versions = append(versions, parsed)
+		}
+	}
+	if len(versions) == 0 {
+		status.Status = DependencyNotInIndex
+		status.Reason = fmt.Sprintf("%s is not in the repository index", status.Name)
+		return
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+
+	var latest *semver.Version
+	for _, v := range versions {
+		if v.Prerelease() == "" {
+			latest = v
+			break
+		}
+	}
+	if latest == nil {
+		latest = versions[0]
+	}
+	status.Latest = latest.Original()
+
+	constraint, err := semver.NewConstraint(status.Version)
+	if err != nil {
+		status.Status = DependencyInvalidRange
+		status.Reason = err.Error()
+		return
+	}
+	var current *semver.Version
+	for _, v := range versions {
+		if constraint.Check(v) {
+			current = v
+			break
+		}
+	}
+	if current == nil {
+		status.Status = DependencyNotInIndex
+		status.Reason = fmt.Sprintf("no version of %s in the repository matches %s", status.Name, status.Version)
+		return
+	}
+	status.Current = current.Original()
+	status.Status = classifyVersionGap(current, latest)
+}
+
+func classifyVersionGap(current *semver.Version, latest *semver.Version) string {
+	switch {
+	case !current.LessThan(latest):
+		return DependencyUpToDate
+	case current.Major() != latest.Major():
+		return DependencyMajorBehind
+	case current.Minor() != latest.Minor():
+		return DependencyMinorBehind
+	default:
+		return DependencyPatchBehind
+	}
+}
+
+// getRepositoryIndex returns the chart versions in a repository by chart name, from the cache
+// when it was fetched recently
+func getRepositoryIndex(ctx context.Context, repoURL string) (map[string][]string, error) {
+	repositoryIndexesMu.Lock()
+	cached, ok := repositoryIndexes[repoURL]
+	repositoryIndexesMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < repositoryIndexTTL {
+		return cached.versions, nil
+	}
+
+	versions, err := fetchRepositoryIndex(ctx, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	repositoryIndexesMu.Lock()
+	repositoryIndexes[repoURL] = cachedRepositoryIndex{versions: versions, fetchedAt: time.Now()}
+	repositoryIndexesMu.Unlock()
+	return versions, nil
+}
+
+var errRepositoryIndexTooLarge = errors.New("index.yaml is too large")
+
+func fetchRepositoryIndexHTTP(ctx context.Context, repoURL string) (map[string][]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, repositoryIndexTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", repoURL+"/index.yaml", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "chartsmith/1.0")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch index.yaml: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch index.yaml: unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRepositoryIndexSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index.yaml: %w", err)
+	}
+	if len(body) > maxRepositoryIndexSize {
+		return nil, errRepositoryIndexTooLarge
+	}
+
+	return parseRepositoryIndex(body)
+}
+
+// parseRepositoryIndex returns the versions of each chart in a helm repository index.yaml
+func parseRepositoryIndex(body []byte) (map[string][]string, error) {
+	var index struct {
+		Entries map[string][]struct {
+			Version string `yaml:"version"`
+		} `yaml:"entries"`
+	}
+	if err := yaml.Unmarshal(body, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse index.yaml: %w", err)
+	}
+
+	versions := map[string][]string{}
+	for name, entries := range index.Entries {
+		for _, entry := range entries {
+			versions[name] = append(versions[name], entry.Version)
+		}
+	}
+	return versions, nil
+}
+
+// FormatDependencyReport renders a report as plain text for the planner
+func FormatDependencyReport(report *DependencyReport) string {
+	var sb strings.Builder
+	for _, dep := range report.Dependencies {
+		name := dep.Name
+		if dep.Alias != "" {
+			name = fmt.Sprintf("%s (alias %s)", dep.Name, dep.Alias)
+		}
+
+		switch dep.Status {
+		case DependencyUpToDate:
+			fmt.Fprintf(&sb, "- %s %s from %s: up to date\n", name, dep.Version, dep.Repository)
+		case DependencyPatchBehind, DependencyMinorBehind, DependencyMajorBehind:
+			fmt.Fprintf(&sb, "- %s %s from %s: resolves to %s, latest is %s (%s version behind)\n", name, dep.Version, dep.Repository, dep.Current, dep.Latest, dep.Status)
+		default:
+			fmt.Fprintf(&sb, "- %s %s from %s: %s (%s)\n", name, dep.Version, dep.Repository, dep.Status, dep.Reason)
+		}
+	}
+	return sb.String()
+}
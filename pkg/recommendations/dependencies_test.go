@@ -0,0 +1,119 @@
+package recommendations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckChartDependencies(t *testing.T) {
+	originalFetch := fetchRepositoryIndex
+	t.Cleanup(func() {
+		fetchRepositoryIndex = originalFetch
+		repositoryIndexesMu.Lock()
+		repositoryIndexes = map[string]cachedRepositoryIndex{}
+		repositoryIndexesMu.Unlock()
+	})
+
+	fetches := map[string]int{}
+	fetchRepositoryIndex = func(ctx context.Context, repoURL string) (map[string][]string, error) {
+		fetches[repoURL]++
+		if repoURL == "https://down.example.com" {
+			return nil, errors.New("failed to fetch index.yaml: connection refused")
+		}
+		return parseRepositoryIndex([]byte(`apiVersion: v1
+entries:
+  redis:
+  - version: 18.0.0-rc.1
+  - version: 17.3.1
+  - version: 17.0.2
+  - version: 16.9.0
+  postgresql:
+  - version: 12.1.6
+  - version: 12.1.2
+  common:
+  - version: 2.2.0
+`))
+	}
+
+	chartYAML := `apiVersion: v2
+name: app
+version: 0.1.0
+dependencies:
+- name: redis
+  version: ~17.0.0
+  repository: https://charts.example.com/
+- name: postgresql
+  version: 12.1.6
+  repository: https://charts.example.com
+- name: common
+  alias: lib
+  version: 1.x.x
+  repository: https://charts.example.com
+- name: memcached
+  version: 6.0.0
+  repository: https://down.example.com
+- name: nginx
+  version: 15.0.0
+  repository: oci://registry-1.docker.io/bitnamicharts
+- name: local
+  version: 0.1.0
+  repository: file://../local
+- name: mysql
+  version: 9.0.0
+  repository: https://charts.example.com
+`
+	report, err := CheckChartDependencies(context.Background(), chartYAML)
+	require.NoError(t, err)
+
+	statuses := map[string]DependencyStatus{}
+	for _, dep := range report.Dependencies {
+		statuses[dep.Name] = dep
+	}
+	require.Len(t, report.Dependencies, 7)
+	assert.Equal(t, "redis", report.Dependencies[0].Name)
+
+	assert.Equal(t, DependencyMinorBehind, statuses["redis"].Status)
+	assert.Equal(t, "17.0.2", statuses["redis"].Current)
+	assert.Equal(t, "17.3.1", statuses["redis"].Latest)
+	assert.Equal(t, DependencyUpToDate, statuses["postgresql"].Status)
+	assert.Equal(t, DependencyNotInIndex, statuses["common"].Status)
+	assert.Equal(t, "2.2.0", statuses["common"].Latest)
+	assert.Equal(t, DependencyUnreachable, statuses["memcached"].Status)
+	assert.Contains(t, statuses["memcached"].Reason, "connection refused")
+	assert.Equal(t, DependencyNotChecked, statuses["nginx"].Status)
+	assert.Equal(t, DependencyNotChecked, statuses["local"].Status)
+	assert.Equal(t, DependencyNotInIndex, statuses["mysql"].Status)
+
+	// every repository is fetched once, and cached for the next report
+	assert.Equal(t, map[string]int{"https://charts.example.com": 1, "https://down.example.com": 1}, fetches)
+	_, err = CheckChartDependencies(context.Background(), chartYAML)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches["https://charts.example.com"])
+	assert.Equal(t, 2, fetches["https://down.example.com"])
+
+	assert.Contains(t, FormatDependencyReport(report), "- redis ~17.0.0 from https://charts.example.com/: resolves to 17.0.2, latest is 17.3.1 (minor version behind)")
+}
+
+func TestClassifyVersionGap(t *testing.T) {
+	tests := []struct {
+		current string
+		latest  string
+		want    string
+	}{
+		{current: "1.2.3", latest: "1.2.3", want: DependencyUpToDate},
+		{current: "1.2.3", latest: "1.2.4", want: DependencyPatchBehind},
+		{current: "1.2.3", latest: "1.3.0", want: DependencyMinorBehind},
+		{current: "1.2.3", latest: "2.0.0", want: DependencyMajorBehind},
+		{current: "2.0.0", latest: "1.9.0", want: DependencyUpToDate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current+"-"+tt.latest, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifyVersionGap(semver.MustParse(tt.current), semver.MustParse(tt.latest)))
+		})
+	}
+}
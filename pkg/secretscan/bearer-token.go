@@ -0,0 +1,25 @@
+package secretscan
+
+import "regexp"
+
+var bearerTokenRegex = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{20,}=*)`)
+
+// bearerTokenDetector finds bearer tokens written into headers, such as in a probe or a
+// webhook URL
+type bearerTokenDetector struct{}
+
+func (bearerTokenDetector) ID() string {
+	return "bearer-token"
+}
+
+func (bearerTokenDetector) Find(content string) []match {
+	matches := []match{}
+	for _, loc := range bearerTokenRegex.FindAllStringSubmatchIndex(content, -1) {
+		value := content[loc[2]:loc[3]]
+		if entropy(value) < 3.5 {
+			continue
+		}
+		matches = append(matches, match{offset: loc[2], value: value})
+	}
+	return matches
+}
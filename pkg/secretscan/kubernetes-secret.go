@@ -0,0 +1,116 @@
+package secretscan
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+)
+
+var (
+	secretKindRegex    = regexp.MustCompile(`^kind:\s*["']?Secret["']?\s*(#.*)?$`)
+	secretSectionRegex = regexp.MustCompile(`^(\s*)(data|stringData):\s*(#.*)?$`)
+	secretEntryRegex   = regexp.MustCompile(`^\s+["']?[A-Za-z0-9._-]+["']?:\s*(.*?)\s*$`)
+)
+
+// minSecretValueLength skips values too short to be a credential, such as "true". The data of a
+// Secret is measured once it's decoded.
+const minSecretValueLength = 8
+
+// kubernetesSecretDetector finds the values in the data and stringData of Secret manifests.
+// Values that are templated are left alone, they come from the values of the release.
+type kubernetesSecretDetector struct{}
+
+func (kubernetesSecretDetector) ID() string {
+	return "kubernetes-secret"
+}
+
+type contentLine struct {
+	offset int
+	text   string
+}
+
+func (d kubernetesSecretDetector) Find(content string) []match {
+	matches := []match{}
+	doc := []contentLine{}
+	offset := 0
+	for _, raw := range strings.SplitAfter(content, "\n") {
+		text := strings.TrimRight(raw, "\r\n")
+		if strings.TrimSpace(text) == "---" {
+			matches = append(matches, d.findInDocument(doc)...)
+			doc = doc[:0]
+		} else {
+			doc = append(doc, contentLine{offset: offset, text: text})
+		}
+		offset += len(raw)
+	}
+	return append(matches, d.findInDocument(doc)...)
+}
+
+func (d kubernetesSecretDetector) findInDocument(lines []contentLine) []match {
+	isSecret := false
+	for _, line := range lines {
+		if secretKindRegex.MatchString(line.text) {
+			isSecret = true
+			break
+		}
+	}
+	if !isSecret {
+		return nil
+	}
+
+	matches := []match{}
+	section := ""
+	sectionIndent := 0
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line.text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line.text) - len(strings.TrimLeft(line.text, " \t"))
+
+		if section != "" && indent <= sectionIndent {
+			section = ""
+		}
+		if section == "" {
+			if m := secretSectionRegex.FindStringSubmatch(line.text); m != nil {
+				section = m[2]
+				sectionIndent = len(m[1])
+			}
+			continue
+		}
+
+		loc := secretEntryRegex.FindStringSubmatchIndex(line.text)
+		if loc == nil {
+			continue
+		}
+		value, valueStart := unquoteSecretValue(line.text[loc[2]:loc[3]], loc[2])
+		if !isSecretValue(section, value) {
+			continue
+		}
+		matches = append(matches, match{offset: line.offset + valueStart, value: value})
+	}
+	return matches
+}
+
+// unquoteSecretValue strips the quotes around a YAML scalar, moving start past the opening quote
+func unquoteSecretValue(value string, start int) (string, int) {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1], start + 1
+	}
+	return value, start
+}
+
+func isSecretValue(section string, value string) bool {
+	if len(value) < minSecretValueLength || strings.Contains(value, "{{") {
+		return false
+	}
+	// block scalars and flow collections aren't followed onto the lines after them
+	if strings.ContainsAny(value[:1], "|>[{&*") {
+		return false
+	}
+	if section == "data" {
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		return err == nil && len(decoded) >= minSecretValueLength
+	}
+	return true
+}
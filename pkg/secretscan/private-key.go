@@ -0,0 +1,34 @@
+package secretscan
+
+import (
+	"regexp"
+	"strings"
+)
+
+var privateKeyRegex = regexp.MustCompile(`(?s)(-----BEGIN ([A-Z ]*)PRIVATE KEY( BLOCK)?-----)(.*?)-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----`)
+
+// privateKeyDetector finds PEM and PGP private key blocks
+type privateKeyDetector struct{}
+
+func (privateKeyDetector) ID() string {
+	return "private-key"
+}
+
+func (privateKeyDetector) Find(content string) []match {
+	matches := []match{}
+	for _, loc := range privateKeyRegex.FindAllStringSubmatchIndex(content, -1) {
+		// the body is compared without whitespace, so the key has the same fingerprint however
+		// it's indented
+		body := strings.Join(strings.Fields(content[loc[8]:loc[9]]), "")
+		// an empty block is a placeholder, a key in a template comes from values
+		if len(body) < 32 || strings.Contains(body, "{{") {
+			continue
+		}
+		matches = append(matches, match{
+			offset:  loc[0],
+			value:   body,
+			preview: content[loc[2]:loc[3]],
+		})
+	}
+	return matches
+}
@@ -0,0 +1,129 @@
+// Package secretscan finds credentials in chart files, such as cloud keys, private keys, tokens
+// and the data of Kubernetes Secrets, so that they aren't sent to LLM providers unnoticed.
+// Detectors match the content of a single file and never return the secret itself, only a
+// fingerprint of it and a redacted preview.
+package secretscan
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Finding is a secret found by a detector, at a 1-based line of a file
+type Finding struct {
+	Detector string `json:"detector"`
+	FilePath string `json:"filePath"`
+	Line     int    `json:"line"`
+	// Fingerprint identifies the secret, the same secret has the same fingerprint in every file
+	Fingerprint string `json:"fingerprint"`
+	// Redacted is enough of the secret to recognize it
+	Redacted string `json:"redacted"`
+}
+
+// match is a secret a detector found at a byte offset of the content it scanned. preview is
+// shown instead of the redacted value when it's set.
+type match struct {
+	offset  int
+	value   string
+	preview string
+}
+
+type detector interface {
+	// ID identifies the detector in findings and fingerprints
+	ID() string
+	Find(content string) []match
+}
+
+var detectors = []detector{
+	awsAccessKeyDetector{},
+	awsSecretKeyDetector{},
+	privateKeyDetector{},
+	bearerTokenDetector{},
+	kubernetesSecretDetector{},
+}
+
+// DetectorIDs returns the IDs of the detectors, in the order they run
+func DetectorIDs() []string {
+	ids := make([]string, 0, len(detectors))
+	for _, d := range detectors {
+		ids = append(ids, d.ID())
+	}
+	return ids
+}
+
+// Scan runs every detector over the content of a file and returns the findings ordered by line
+func Scan(filePath string, content string) []Finding {
+	findings := []Finding{}
+	for _, d := range detectors {
+		for _, m := range d.Find(content) {
+			preview := m.preview
+			if preview == "" {
+				preview = redact(m.value)
+			}
+			findings = append(findings, Finding{
+				Detector:    d.ID(),
+				FilePath:    filePath,
+				Line:        strings.Count(content[:m.offset], "\n") + 1,
+				Fingerprint: Fingerprint(d.ID(), m.value),
+				Redacted:    preview,
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// Fingerprint identifies a secret found by a detector without revealing it
+func Fingerprint(detectorID string, value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(detectorID+":"+value)))[:16]
+}
+
+// IsFingerprint reports whether s has the form of a fingerprint
+func IsFingerprint(s string) bool {
+	if len(s) != 16 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// redact keeps the first characters of a secret, long secrets keep a few more
+func redact(value string) string {
+	keep := 2
+	if len(value) >= 16 {
+		keep = 4
+	}
+	if len(value) <= keep {
+		return "****"
+	}
+	return value[:keep] + "****"
+}
+
+// entropy is the Shannon entropy of s in bits per character. Generated credentials are above 3,
+// words and placeholders like xxxx or changeme are below it.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	for _, c := range s {
+		counts[c]++
+	}
+	n := float64(len([]rune(s)))
+	e := 0.0
+	for _, count := range counts {
+		p := float64(count) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
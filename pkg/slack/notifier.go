@@ -0,0 +1,249 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/slack/types"
+)
+
+const (
+	EventNewWorkspace = "new_workspace"
+	EventPlanFailed   = "plan_failed"
+	EventRenderFailed = "render_failed"
+	EventQueueBacklog = "queue_backlog"
+
+	// defaultRoute is the route for event types that don't have a webhook of their own
+	defaultRoute = "default"
+
+	// MaxWebhookAttempts is how many times a message is posted before giving up on rate limits
+	MaxWebhookAttempts = 4
+)
+
+// DefaultTemplates are the messages for each event type when the config doesn't set a template
+var DefaultTemplates = map[string]string{
+	EventNewWorkspace: "*Chartsmith Workspace Created* {{ .WorkspaceID }}\n*Initial Prompt:* {{ .Data.prompt }}",
+	EventPlanFailed:   "*Plan failed* in workspace {{ .WorkspaceID }} (plan {{ .Data.planId }})\n```{{ .Data.error }}```",
+	EventRenderFailed: "*Render failed* in workspace {{ .WorkspaceID }} at revision {{ .Data.revision }}\n```{{ .Data.error }}```",
+	EventQueueBacklog: "*Queue backlog* in {{ .Data.channel }}: the oldest unclaimed message has waited {{ .Data.age }}, longer than {{ .Data.threshold }}",
+}
+
+// Route is where notifications of an event type go and how they're written
+type Route struct {
+	WebhookURL string `json:"webhookUrl"`
+	Template   string `json:"template,omitempty"`
+}
+
+// Config routes notifications by event type. The "default" route applies to event types that
+// don't have a webhook of their own.
+type Config map[string]Route
+
+// TemplateData is what templates are executed with, Data is the payload of the notification
+type TemplateData struct {
+	ID          string
+	Type        string
+	WorkspaceID string
+	UserID      string
+	CreatedAt   time.Time
+	Data        map[string]interface{}
+}
+
+// ParseConfig parses CHARTSMITH_SLACK_NOTIFICATIONS, empty is a config without routes
+func ParseConfig(raw string) (Config, error) {
+	config := Config{}
+	if strings.TrimSpace(raw) == "" {
+		return config, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse slack notifications config: %w", err)
+	}
+
+	for eventType, route := range config {
+		if route.Template == "" {
+			continue
+		}
+		if _, err := template.New(eventType).Parse(route.Template); err != nil {
+			return nil, fmt.Errorf("invalid slack template for %s: %w", eventType, err)
+		}
+	}
+
+	return config, nil
+}
+
+// ValidateConfig returns an error when CHARTSMITH_SLACK_NOTIFICATIONS can't be parsed
+func ValidateConfig() error {
+	_, err := ParseConfig(param.Get().SlackNotifications)
+	return err
+}
+
+// route returns the webhook and template for an event type, ok is false when it has no webhook
+func (c Config) route(eventType string) (Route, bool) {
+	route := c[eventType]
+	if route.WebhookURL == "" {
+		route.WebhookURL = c[defaultRoute].WebhookURL
+	}
+	if route.Template == "" {
+		route.Template = DefaultTemplates[eventType]
+	}
+	return route, route.WebhookURL != ""
+}
+
+// Notifier posts notifications to Slack incoming webhooks
+type Notifier struct {
+	Config Config
+	Client *http.Client
+
+	// Backoff is the wait before another attempt when Slack doesn't send Retry-After
+	Backoff func(attempt int) time.Duration
+	// Sleep waits between attempts, it returns early with an error when ctx is done
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewNotifier(config Config) *Notifier {
+	return &Notifier{
+		Config: config,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		Backoff: func(attempt int) time.Duration {
+			return time.Second << (attempt - 1)
+		},
+		Sleep: func(ctx context.Context, d time.Duration) error {
+			select {
+			case <-time.After(d):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// Routed returns true if notifications of the event type have a webhook to go to
+func (n *Notifier) Routed(eventType string) bool {
+	_, ok := n.Config.route(eventType)
+	return ok
+}
+
+// Render executes the template of the notification's event type
+func (n *Notifier) Render(raw types.SlackNotificationRaw) (string, error) {
+	route, _ := n.Config.route(raw.NotificationType)
+	if route.Template == "" {
+		return "", fmt.Errorf("no slack template for %s", raw.NotificationType)
+	}
+
+	tmpl, err := template.New(raw.NotificationType).Option("missingkey=zero").Parse(route.Template)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse slack template for %s: %w", raw.NotificationType, err)
+	}
+
+	data := TemplateData{
+		ID:        raw.ID,
+		Type:      raw.NotificationType,
+		CreatedAt: raw.CreatedAt,
+		Data:      map[string]interface{}{},
+	}
+	if raw.WorkspaceID != nil {
+		data.WorkspaceID = *raw.WorkspaceID
+	}
+	if raw.UserID != nil {
+		data.UserID = *raw.UserID
+	}
+	if raw.AdditionalData != nil && *raw.AdditionalData != "" {
+		if err := json.Unmarshal([]byte(*raw.AdditionalData), &data.Data); err != nil {
+			return "", fmt.Errorf("failed to unmarshal additional data: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute slack template for %s: %w", raw.NotificationType, err)
+	}
+	return buf.String(), nil
+}
+
+// webhookMessage is the body of a post to an incoming webhook. Text is the fallback for
+// notifications, the block is what's shown in the channel.
+type webhookMessage struct {
+	Text   string         `json:"text"`
+	Blocks []webhookBlock `json:"blocks"`
+}
+
+type webhookBlock struct {
+	Type string      `json:"type"`
+	Text webhookText `json:"text"`
+}
+
+type webhookText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Send renders a notification and posts it to the webhook of its event type
+func (n *Notifier) Send(ctx context.Context, raw types.SlackNotificationRaw) error {
+	route, ok := n.Config.route(raw.NotificationType)
+	if !ok {
+		return fmt.Errorf("no slack webhook for %s", raw.NotificationType)
+	}
+
+	text, err := n.Render(raw)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookMessage{
+		Text: text,
+		Blocks: []webhookBlock{
+			{Type: "section", Text: webhookText{Type: "mrkdwn", Text: text}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+
+	return n.post(ctx, route.WebhookURL, body)
+}
+
+// post sends body to the webhook, waiting and trying again when Slack rate limits it
+func (n *Notifier) post(ctx context.Context, webhookURL string, body []byte) error {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create slack request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := n.Client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to post to slack: %w", err)
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("slack returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+		if attempt == MaxWebhookAttempts {
+			return fmt.Errorf("slack rate limited %d attempts", attempt)
+		}
+
+		wait := n.Backoff(attempt)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		if err := n.Sleep(ctx, wait); err != nil {
+			return fmt.Errorf("waiting to retry slack: %w", err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/slack/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSlack is an incoming webhook that answers with the statuses it's given, then 200
+type fakeSlack struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	bodies   []webhookMessage
+}
+
+func newFakeSlack(t *testing.T, statuses ...int) *fakeSlack {
+	f := &fakeSlack{statuses: statuses}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body webhookMessage
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.bodies = append(f.bodies, body)
+
+		status := http.StatusOK
+		if len(f.statuses) > 0 {
+			status, f.statuses = f.statuses[0], f.statuses[1:]
+		}
+		if status == http.StatusTooManyRequests && len(f.bodies) == 1 {
+			w.Header().Set("Retry-After", "3")
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeSlack) requests() []webhookMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]webhookMessage{}, f.bodies...)
+}
+
+// testNotifier records the waits between attempts instead of sleeping
+func testNotifier(config Config) (*Notifier, *[]time.Duration) {
+	waits := []time.Duration{}
+	n := NewNotifier(config)
+	n.Sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return n, &waits
+}
+
+func notification(eventType string, data string) types.SlackNotificationRaw {
+	workspaceID := "ws-1"
+	return types.SlackNotificationRaw{
+		ID:               "notification",
+		CreatedAt:        time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		WorkspaceID:      &workspaceID,
+		NotificationType: eventType,
+		AdditionalData:   &data,
+	}
+}
+
+func TestSendRoutesByEventType(t *testing.T) {
+	plans := newFakeSlack(t)
+	fallback := newFakeSlack(t)
+
+	n, _ := testNotifier(Config{
+		"default":       {WebhookURL: fallback.URL},
+		EventPlanFailed: {WebhookURL: plans.URL, Template: "plan {{ .Data.planId }} in {{ .WorkspaceID }}: {{ .Data.error }}"},
+	})
+
+	require.NoError(t, n.Send(context.Background(), notification(EventPlanFailed, `{"planId":"plan-1","error":"stream closed"}`)))
+	require.NoError(t, n.Send(context.Background(), notification(EventRenderFailed, `{"revision":4,"error":"helm template failed"}`)))
+
+	require.Len(t, plans.requests(), 1)
+	assert.Equal(t, webhookMessage{
+		Text: "plan plan-1 in ws-1: stream closed",
+		Blocks: []webhookBlock{
+			{Type: "section", Text: webhookText{Type: "mrkdwn", Text: "plan plan-1 in ws-1: stream closed"}},
+		},
+	}, plans.requests()[0])
+
+	require.Len(t, fallback.requests(), 1)
+	assert.Equal(t, "*Render failed* in workspace ws-1 at revision 4\n```helm template failed```", fallback.requests()[0].Text)
+}
+
+func TestSendWithoutWebhook(t *testing.T) {
+	n, _ := testNotifier(Config{EventPlanFailed: {Template: "plan failed"}})
+
+	assert.False(t, n.Routed(EventPlanFailed))
+	assert.Error(t, n.Send(context.Background(), notification(EventPlanFailed, `{}`)))
+}
+
+func TestSendRetriesRateLimits(t *testing.T) {
+	slack := newFakeSlack(t, http.StatusTooManyRequests, http.StatusTooManyRequests)
+	n, waits := testNotifier(Config{"default": {WebhookURL: slack.URL}})
+
+	require.NoError(t, n.Send(context.Background(), notification(EventRenderFailed, `{"revision":1,"error":"failed"}`)))
+
+	assert.Len(t, slack.requests(), 3)
+	// the first 429 has Retry-After: 3, the second falls back to the backoff for attempt 2
+	assert.Equal(t, []time.Duration{3 * time.Second, 2 * time.Second}, *waits)
+}
+
+func TestSendGivesUpOnRateLimits(t *testing.T) {
+	statuses := make([]int, MaxWebhookAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusTooManyRequests
+	}
+	slack := newFakeSlack(t, statuses...)
+	n, waits := testNotifier(Config{"default": {WebhookURL: slack.URL}})
+
+	err := n.Send(context.Background(), notification(EventRenderFailed, `{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rate limited")
+	assert.Len(t, slack.requests(), MaxWebhookAttempts)
+	assert.Len(t, *waits, MaxWebhookAttempts-1)
+}
+
+func TestSendDoesNotRetryOtherErrors(t *testing.T) {
+	slack := newFakeSlack(t, http.StatusNotFound)
+	n, waits := testNotifier(Config{"default": {WebhookURL: slack.URL}})
+
+	err := n.Send(context.Background(), notification(EventRenderFailed, `{}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+	assert.Len(t, slack.requests(), 1)
+	assert.Empty(t, *waits)
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig("")
+	require.NoError(t, err)
+	assert.Empty(t, config)
+
+	config, err = ParseConfig(`{"default":{"webhookUrl":"https://hooks.slack.com/a"},"plan_failed":{"webhookUrl":"https://hooks.slack.com/b","template":"{{ .Data.error }}"}}`)
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.slack.com/b", config[EventPlanFailed].WebhookURL)
+
+	_, err = ParseConfig(`{"plan_failed":{"webhookUrl":"https://hooks.slack.com/b","template":"{{ .Data.error"}}`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid slack template for plan_failed")
+
+	_, err = ParseConfig(`not json`)
+	assert.Error(t, err)
+}
+
+func TestRenderQueueBacklog(t *testing.T) {
+	raw := notification(EventQueueBacklog, `{"channel":"new_intent","age":"25m0s","threshold":"15m0s"}`)
+	raw.WorkspaceID = nil
+
+	text, err := NewNotifier(Config{}).Render(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "*Queue backlog* in new_intent: the oldest unclaimed message has waited 25m0s, longer than 15m0s", text)
+}
@@ -0,0 +1,136 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+)
+
+// NotificationChannel is the work queue channel notifications are delivered from
+const NotificationChannel = "new_slack_notification"
+
+// loadNotifier builds the notifier from CHARTSMITH_SLACK_NOTIFICATIONS
+func loadNotifier() (*Notifier, error) {
+	config, err := ParseConfig(param.Get().SlackNotifications)
+	if err != nil {
+		return nil, err
+	}
+	return NewNotifier(config), nil
+}
+
+// NotifyPlanFailed queues a notification that creating a plan failed
+func NotifyPlanFailed(ctx context.Context, workspaceID string, planID string, planErr error) error {
+	return enqueueNotification(ctx, EventPlanFailed, workspaceID, map[string]interface{}{
+		"planId": planID,
+		"error":  planErr.Error(),
+	})
+}
+
+// NotifyRenderFailed queues a notification that rendering a revision failed
+func NotifyRenderFailed(ctx context.Context, workspaceID string, revisionNumber int, renderErr error) error {
+	return enqueueNotification(ctx, EventRenderFailed, workspaceID, map[string]interface{}{
+		"revision": revisionNumber,
+		"error":    renderErr.Error(),
+	})
+}
+
+// NotifyQueueBacklog queues a notification that the oldest unclaimed message of a work queue
+// channel has waited longer than threshold. It's delivered through the queue itself, so a backlog
+// in the notification channel can hold it up.
+func NotifyQueueBacklog(ctx context.Context, channel string, age time.Duration, threshold time.Duration) error {
+	return enqueueNotification(ctx, EventQueueBacklog, "", map[string]interface{}{
+		"channel":   channel,
+		"age":       age.String(),
+		"threshold": threshold.String(),
+	})
+}
+
+// enqueueNotification stores a notification and queues it for delivery. Event types without a
+// webhook are skipped here, so that there's nothing to deliver. Notifications that aren't about a
+// workspace have an empty workspaceID.
+func enqueueNotification(ctx context.Context, eventType string, workspaceID string, data map[string]interface{}) error {
+	notifier, err := loadNotifier()
+	if err != nil {
+		return err
+	}
+	if !notifier.Routed(eventType) {
+		return nil
+	}
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return fmt.Errorf("failed to generate slack notification id: %w", err)
+	}
+
+	additionalData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack notification data: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO slack_notification (id, created_at, workspace_id, notification_type, additional_data) VALUES ($1, $2, NULLIF($3, ''), $4, $5)`
+	if _, err := conn.Exec(ctx, query, id, time.Now(), workspaceID, eventType, string(additionalData)); err != nil {
+		return fmt.Errorf("failed to insert slack notification: %w", err)
+	}
+
+	if err := persistence.EnqueueWork(ctx, NotificationChannel, map[string]interface{}{"id": id}); err != nil {
+		return fmt.Errorf("failed to enqueue slack notification: %w", err)
+	}
+
+	return nil
+}
+
+// DeliverNotification sends a stored notification to the webhook of its event type. New
+// workspace notifications without a webhook are posted with CHARTSMITH_SLACK_TOKEN as before.
+func DeliverNotification(ctx context.Context, id string) error {
+	raw, err := GetSlackNotificationRaw(ctx, id)
+	if err != nil {
+		return err
+	}
+	if raw.SentAt != nil {
+		return nil
+	}
+
+	notifier, err := loadNotifier()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case notifier.Routed(raw.NotificationType):
+		if err := notifier.Send(ctx, *raw); err != nil {
+			return fmt.Errorf("failed to send slack notification: %w", err)
+		}
+	case raw.NotificationType == EventNewWorkspace && param.Get().SlackToken != "":
+		notification, err := GetSlackNotification(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := SendNotificationToSlack(notification); err != nil {
+			return err
+		}
+	default:
+		logger.Warn("No slack webhook for notification, not sending it",
+			zap.String("id", id),
+			zap.String("type", raw.NotificationType))
+		return nil
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `UPDATE slack_notification SET sent_at = $1 WHERE id = $2`, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to mark slack notification sent: %w", err)
+	}
+
+	return nil
+}
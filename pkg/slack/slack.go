@@ -42,6 +42,25 @@ func SendNotificationToSlack(e types.SlackNotification) error {
 }
 
 func GetSlackNotification(ctx context.Context, id string) (types.SlackNotification, error) {
+	raw, err := GetSlackNotificationRaw(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch raw.NotificationType {
+	case EventNewWorkspace:
+		e := types.WorkspaceCreated{}
+		if err := e.FromData(*raw); err != nil {
+			return nil, fmt.Errorf("error parsing workspace created slack notification: %w", err)
+		}
+		return &e, nil
+	default:
+		return nil, fmt.Errorf("unknown slack notification type: %s", raw.NotificationType)
+	}
+}
+
+// GetSlackNotificationRaw returns a notification as it's stored, for any event type
+func GetSlackNotificationRaw(ctx context.Context, id string) (*types.SlackNotificationRaw, error) {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
@@ -51,7 +70,8 @@ func GetSlackNotification(ctx context.Context, id string) (types.SlackNotificati
 		slack_notification.user_id,
 		slack_notification.workspace_id,
 		slack_notification.notification_type,
-		slack_notification.additional_data
+		slack_notification.additional_data,
+		slack_notification.sent_at
 	FROM
 		slack_notification
 	WHERE
@@ -61,6 +81,7 @@ func GetSlackNotification(ctx context.Context, id string) (types.SlackNotificati
 	raw := types.SlackNotificationRaw{}
 	var userID, workspaceID sql.NullString
 	var additionalData sql.NullString
+	var sentAt sql.NullTime
 	err := row.Scan(
 		&raw.ID,
 		&raw.CreatedAt,
@@ -68,6 +89,7 @@ func GetSlackNotification(ctx context.Context, id string) (types.SlackNotificati
 		&workspaceID,
 		&raw.NotificationType,
 		&additionalData,
+		&sentAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error scanning slack notification: %w", err)
@@ -82,15 +104,9 @@ func GetSlackNotification(ctx context.Context, id string) (types.SlackNotificati
 	if additionalData.Valid {
 		raw.AdditionalData = &additionalData.String
 	}
-
-	switch raw.NotificationType {
-	case "new_workspace":
-		e := types.WorkspaceCreated{}
-		if err := e.FromData(raw); err != nil {
-			return nil, fmt.Errorf("error parsing workspace created slack notification: %w", err)
-		}
-		return &e, nil
-	default:
-		return nil, fmt.Errorf("unknown slack notification type: %s", raw.NotificationType)
+	if sentAt.Valid {
+		raw.SentAt = &sentAt.Time
 	}
+
+	return &raw, nil
 }
@@ -22,4 +22,5 @@ type SlackNotificationRaw struct {
 	WorkspaceID      *string
 	NotificationType string
 	AdditionalData   *string
+	SentAt           *time.Time // set once the notification is delivered
 }
@@ -0,0 +1,198 @@
+package testhelpers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaLockID serializes schema setup between test packages that share a database, concurrent
+// CREATE TABLE IF NOT EXISTS statements for the same table can fail
+const schemaLockID = 7238021
+
+// Execer is the part of a postgres connection or pool the schema is applied with
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+type schemaExtension struct {
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		Postgres struct {
+			Name string `yaml:"name"`
+		} `yaml:"postgres"`
+	} `yaml:"spec"`
+}
+
+type schemaTable struct {
+	Name     string   `yaml:"name"`
+	Requires []string `yaml:"requires"`
+	Schema   struct {
+		Postgres struct {
+			PrimaryKey []string       `yaml:"primaryKey"`
+			Indexes    []schemaIndex  `yaml:"indexes"`
+			Columns    []schemaColumn `yaml:"columns"`
+		} `yaml:"postgres"`
+	} `yaml:"schema"`
+}
+
+type schemaIndex struct {
+	Name     string   `yaml:"name"`
+	Columns  []string `yaml:"columns"`
+	IsUnique bool     `yaml:"isUnique"`
+}
+
+type schemaColumn struct {
+	Name        string  `yaml:"name"`
+	Type        string  `yaml:"type"`
+	Default     *string `yaml:"default"`
+	Constraints struct {
+		NotNull bool `yaml:"notNull"`
+	} `yaml:"constraints"`
+}
+
+// ApplySchema creates the tables in db/schema/tables, the same definitions the migrations run, so
+// that tests against CHARTSMITH_TEST_PG_URI see the production schema. It's safe to run on a
+// database an earlier run set up, missing columns are added to tables that already exist.
+func ApplySchema(ctx context.Context, conn Execer) error {
+	ddl, err := SchemaDDL()
+	if err != nil {
+		return err
+	}
+
+	// a multi statement query runs in one transaction, which holds the lock until it's done
+	statements := append([]string{fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", schemaLockID)}, ddl...)
+	if _, err := conn.Exec(ctx, strings.Join(statements, ";\n")); err != nil {
+		return fmt.Errorf("failed to apply schema: %w", err)
+	}
+	return nil
+}
+
+// SchemaDDL returns the statements ApplySchema runs, the extensions the tables require first
+func SchemaDDL() ([]string, error) {
+	dir := schemaDir()
+
+	extensions := map[string]string{}
+	extensionFiles, err := filepath.Glob(filepath.Join(dir, "extensions", "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range extensionFiles {
+		var extension schemaExtension
+		if err := readSchemaFile(filename, &extension); err != nil {
+			return nil, err
+		}
+		extensions[extension.Metadata.Name] = extension.Spec.Postgres.Name
+	}
+
+	tableFiles, err := filepath.Glob(filepath.Join(dir, "tables", "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(tableFiles) == 0 {
+		return nil, fmt.Errorf("no table definitions in %s", dir)
+	}
+	sort.Strings(tableFiles)
+
+	required := map[string]bool{}
+	tableDDL := []string{}
+	for _, filename := range tableFiles {
+		var table schemaTable
+		if err := readSchemaFile(filename, &table); err != nil {
+			return nil, err
+		}
+		for _, name := range table.Requires {
+			extension, ok := extensions[name]
+			if !ok {
+				return nil, fmt.Errorf("table %s requires unknown extension %s", table.Name, name)
+			}
+			required[extension] = true
+		}
+		tableDDL = append(tableDDL, table.ddl()...)
+	}
+
+	ddl := []string{}
+	for _, extension := range sortedKeys(required) {
+		ddl = append(ddl, fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", extension))
+	}
+	return append(ddl, tableDDL...), nil
+}
+
+func (t schemaTable) ddl() []string {
+	pg := t.Schema.Postgres
+
+	definitions := []string{}
+	for _, column := range pg.Columns {
+		definition := column.Name + " " + column.Type
+		if column.Constraints.NotNull {
+			definition += " NOT NULL"
+		}
+		if column.Default != nil {
+			definition += " DEFAULT " + *column.Default
+		}
+		definitions = append(definitions, definition)
+	}
+	if len(pg.PrimaryKey) > 0 {
+		definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(pg.PrimaryKey, ", ")))
+	}
+
+	ddl := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", t.Name, strings.Join(definitions, ",\n\t"))}
+
+	// rows a previous run left in the table have no value for a new column, so it can only be
+	// required when there's a default to fill them with
+	for _, column := range pg.Columns {
+		statement := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", t.Name, column.Name, column.Type)
+		if column.Default != nil {
+			statement += " DEFAULT " + *column.Default
+			if column.Constraints.NotNull {
+				statement += " NOT NULL"
+			}
+		}
+		ddl = append(ddl, statement)
+	}
+
+	for _, index := range pg.Indexes {
+		unique := ""
+		if index.IsUnique {
+			unique = "UNIQUE "
+		}
+		ddl = append(ddl, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)", unique, index.Name, t.Name, strings.Join(index.Columns, ", ")))
+	}
+
+	return ddl
+}
+
+// schemaDir is db/schema in the source tree this package was built from
+func schemaDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "db", "schema")
+}
+
+func readSchemaFile(filename string, out interface{}) error {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	if err := yaml.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,21 @@
+package testhelpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaDDL(t *testing.T) {
+	ddl, err := SchemaDDL()
+	require.NoError(t, err)
+
+	// the extension comes before the tables that need it
+	assert.Equal(t, "CREATE EXTENSION IF NOT EXISTS vector", ddl[0])
+
+	assert.Contains(t, ddl, "CREATE TABLE IF NOT EXISTS workspace_rendered_file (\n\tfile_id text NOT NULL,\n\tworkspace_id text NOT NULL,\n\trevision_number integer NOT NULL,\n\tfile_path text NOT NULL,\n\tcontent text NOT NULL,\n\tworkspace_rendered_chart_id text,\n\tPRIMARY KEY (file_id, workspace_id, revision_number)\n)")
+	assert.Contains(t, ddl, "ALTER TABLE workspace_file ADD COLUMN IF NOT EXISTS version integer DEFAULT 0 NOT NULL")
+	assert.Contains(t, ddl, "ALTER TABLE workspace ADD COLUMN IF NOT EXISTS archived_at timestamp")
+	assert.Contains(t, ddl, "CREATE UNIQUE INDEX IF NOT EXISTS share_link_token_sha_idx ON share_link (token_sha)")
+}
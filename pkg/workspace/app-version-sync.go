@@ -0,0 +1,322 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// AppVersionSyncMapping is an entry of the app_version_sync setting, the value at ValuesPath in
+// the values.yaml of a chart becomes the appVersion of its Chart.yaml
+type AppVersionSyncMapping struct {
+	// Chart is the name or ID of the chart, empty for every chart that no other entry names
+	Chart string `json:"chart,omitempty"`
+	// ValuesPath is a dotted path to a key in values.yaml, such as image.tag
+	ValuesPath string `json:"valuesPath"`
+}
+
+// AppVersionSync is an appVersion that SyncAppVersions changed
+type AppVersionSync struct {
+	ChartID    string
+	ChartName  string
+	ValuesPath string
+	// From is the appVersion before the sync, empty when the chart didn't have one
+	From string
+	To   string
+	// ChartYAML is the Chart.yaml of the chart, with the synced appVersion as its pending content
+	ChartYAML types.File
+}
+
+// these are vars so that syncs can be tested without a database
+var (
+	getSyncWorkspace        = GetWorkspace
+	getCommittedValuesYAML  = committedValuesYAMLFromDB
+	saveSyncedChartManifest = SaveChartManifest
+)
+
+// SyncAppVersions sets the appVersion of each chart that the app_version_sync setting maps to a
+// values path whose value differs from the revision before the current one. A mapping whose
+// values path isn't a key of values.yaml, or isn't a string, number or boolean, is logged and
+// skipped. The Chart.yaml files are written as pending content of the current revision.
+func SyncAppVersions(ctx context.Context, workspaceID string) ([]AppVersionSync, error) {
+	mappings, err := GetSetting[[]AppVersionSyncMapping](ctx, workspaceID, SettingAppVersionSync)
+	if err != nil {
+		return nil, err
+	}
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+
+	w, err := getSyncWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	syncs := []AppVersionSync{}
+	for _, chart := range w.Charts {
+		mapping, ok := appVersionSyncMappingFor(&chart, mappings)
+		if !ok {
+			continue
+		}
+		ctx := logger.WithFields(ctx, zap.String("chartID", chart.ID), zap.String("valuesPath", mapping.ValuesPath))
+
+		value, ok, err := valueAtValuesPath(currentContent(&chart, "values.yaml"), mapping.ValuesPath)
+		if err != nil {
+			logger.WarnCtx(ctx, "Skipping appVersion sync", zap.Error(err))
+			continue
+		}
+		if !ok {
+			logger.WarnCtx(ctx, "Skipping appVersion sync, the values path isn't a string, number or boolean in values.yaml")
+			continue
+		}
+
+		if w.CurrentRevision > 0 {
+			previousValues, err := getCommittedValuesYAML(ctx, w.ID, chart.ID, w.CurrentRevision-1)
+			if err != nil {
+				return syncs, fmt.Errorf("failed to get values.yaml of revision %d: %w", w.CurrentRevision-1, err)
+			}
+			// a values.yaml that didn't parse before is a change like any other
+			previous, ok, _ := valueAtValuesPath(previousValues, mapping.ValuesPath)
+			if ok && previous == value {
+				continue
+			}
+		}
+
+		manifest, err := chartManifestOf(w, chart.ID)
+		if errors.Is(err, ErrChartManifestNotFound) {
+			continue
+		}
+		if err != nil {
+			return syncs, err
+		}
+		if manifest.AppVersion == value {
+			continue
+		}
+
+		from := manifest.AppVersion
+		if err := manifest.SetAppVersion(value); err != nil {
+			logger.WarnCtx(ctx, "Skipping appVersion sync", zap.Error(err))
+			continue
+		}
+		content, err := manifest.Content()
+		if err != nil {
+			return syncs, err
+		}
+		if err := saveSyncedChartManifest(ctx, manifest); err != nil {
+			return syncs, fmt.Errorf("failed to save Chart.yaml of chart %s: %w", chart.ID, err)
+		}
+		syncs = append(syncs, AppVersionSync{
+			ChartID:    chart.ID,
+			ChartName:  chart.Name,
+			ValuesPath: mapping.ValuesPath,
+			From:       from,
+			To:         value,
+			ChartYAML:  syncedChartYAML(&chart, content),
+		})
+	}
+	return syncs, nil
+}
+
+// AppVersionSyncWarnings describes the mappings of the app_version_sync setting that won't sync,
+// because the chart they name isn't in the workspace or their values path isn't a string, number
+// or boolean in the chart's values.yaml. Such mappings are kept, the path may be added later.
+func AppVersionSyncWarnings(ctx context.Context, workspaceID string) ([]string, error) {
+	mappings, err := GetSetting[[]AppVersionSyncMapping](ctx, workspaceID, SettingAppVersionSync)
+	if err != nil {
+		return nil, err
+	}
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+
+	w, err := getSyncWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	warnings := []string{}
+	for _, mapping := range mappings {
+		if mapping.Chart == "" {
+			continue
+		}
+		found := false
+		for _, chart := range w.Charts {
+			found = found || chart.ID == mapping.Chart || chart.Name == mapping.Chart
+		}
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("chart %s isn't in the workspace", mapping.Chart))
+		}
+	}
+	for _, chart := range w.Charts {
+		mapping, ok := appVersionSyncMappingFor(&chart, mappings)
+		if !ok {
+			continue
+		}
+		if _, ok, err := valueAtValuesPath(currentContent(&chart, "values.yaml"), mapping.ValuesPath); err != nil || !ok {
+			warnings = append(warnings, fmt.Sprintf("%s isn't a string, number or boolean in the values.yaml of chart %s", mapping.ValuesPath, chart.Name))
+		}
+	}
+	return warnings, nil
+}
+
+// appVersionSyncMappingFor returns the mapping that names a chart, or else the one for every chart
+func appVersionSyncMappingFor(c *types.Chart, mappings []AppVersionSyncMapping) (AppVersionSyncMapping, bool) {
+	var every *AppVersionSyncMapping
+	for i, mapping := range mappings {
+		if mapping.Chart == "" {
+			every = &mappings[i]
+		} else if mapping.Chart == c.ID || mapping.Chart == c.Name {
+			return mapping, true
+		}
+	}
+	if every == nil {
+		return AppVersionSyncMapping{}, false
+	}
+	return *every, true
+}
+
+// syncedChartYAML returns the Chart.yaml of a chart as SaveChartManifest left it, with content
+// pending at the next version
+func syncedChartYAML(c *types.Chart, content string) types.File {
+	for _, file := range c.Files {
+		if file.FilePath != "Chart.yaml" {
+			continue
+		}
+		file.ContentPending = &content
+		file.Version++
+		return file
+	}
+	return types.File{ChartID: c.ID, FilePath: "Chart.yaml", ContentPending: &content}
+}
+
+// currentContent returns the content of a file of a chart, pending content included, or an empty
+// string when the chart doesn't have it
+func currentContent(c *types.Chart, path string) string {
+	for _, file := range c.Files {
+		if file.FilePath != path {
+			continue
+		}
+		if file.ContentPending != nil {
+			return *file.ContentPending
+		}
+		return file.Content
+	}
+	return ""
+}
+
+// valueAtValuesPath returns the value at a dotted path of values.yaml as it's written, so that a
+// tag such as 1.10 isn't read as a number. ok is false when the path isn't a key, or its value
+// isn't a string, number or boolean.
+func valueAtValuesPath(valuesYAML string, valuesPath string) (string, bool, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(valuesYAML), &doc); err != nil {
+		return "", false, fmt.Errorf("failed to parse values.yaml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return "", false, nil
+	}
+
+	node := doc.Content[0]
+	for _, key := range strings.Split(valuesPath, ".") {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		if node.Kind != yaml.MappingNode {
+			return "", false, nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+			}
+		}
+		if next == nil {
+			return "", false, nil
+		}
+		node = next
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return "", false, nil
+	}
+	switch node.Tag {
+	case "!!str", "!!int", "!!float", "!!bool":
+		return node.Value, true, nil
+	}
+	return "", false, nil
+}
+
+// coerceAppVersionSync accepts a list of mappings, each with a dotted valuesPath. A chart can only
+// be named once, and only one mapping can be for every chart.
+func coerceAppVersionSync(value json.RawMessage) (json.RawMessage, error) {
+	if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+		return json.RawMessage(`[]`), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.DisallowUnknownFields()
+	var mappings []AppVersionSyncMapping
+	if err := decoder.Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("%s is not a list of chart and valuesPath mappings", string(value))
+	}
+
+	seen := map[string]bool{}
+	for i := range mappings {
+		mappings[i].Chart = strings.TrimSpace(mappings[i].Chart)
+		mappings[i].ValuesPath = strings.TrimSpace(mappings[i].ValuesPath)
+		mapping := mappings[i]
+
+		if mapping.ValuesPath == "" {
+			return nil, fmt.Errorf("mapping %d has no valuesPath", i)
+		}
+		for _, key := range strings.Split(mapping.ValuesPath, ".") {
+			if key == "" {
+				return nil, fmt.Errorf("%q is not a dotted values path", mapping.ValuesPath)
+			}
+		}
+
+		if seen[mapping.Chart] {
+			if mapping.Chart == "" {
+				return nil, errors.New("only one mapping can be for every chart")
+			}
+			return nil, fmt.Errorf("chart %s is mapped twice", mapping.Chart)
+		}
+		seen[mapping.Chart] = true
+	}
+
+	if mappings == nil {
+		mappings = []AppVersionSyncMapping{}
+	}
+	return json.Marshal(mappings)
+}
+
+func committedValuesYAMLFromDB(ctx context.Context, workspaceID string, chartID string, revisionNumber int) (string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var content sql.NullString
+	err := conn.QueryRow(ctx, `SELECT content FROM workspace_file
+		WHERE workspace_id = $1 AND chart_id = $2 AND file_path = 'values.yaml' AND revision_number = $3`,
+		workspaceID, chartID, revisionNumber).Scan(&content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return content.String, nil
+}
@@ -0,0 +1,144 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueAtValuesPath(t *testing.T) {
+	values := `image:
+  repository: nginx
+  tag: "1.10"
+replicaCount: 2
+defaults: &defaults
+  tag: 1.27.0
+sidecar: *defaults
+resources: {}
+digest:
+`
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "image.tag", want: "1.10", wantOK: true},
+		{path: "replicaCount", want: "2", wantOK: true},
+		{path: "sidecar.tag", want: "1.27.0", wantOK: true},
+		{path: "image", wantOK: false},
+		{path: "image.digest", wantOK: false},
+		{path: "image.tag.major", wantOK: false},
+		{path: "resources", wantOK: false},
+		{path: "digest", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok, err := valueAtValuesPath(values, tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSyncAppVersions(t *testing.T) {
+	saved := stubAppVersionSync(t, `[{"valuesPath": "image.tag"}, {"chart": "backend", "valuesPath": "server.image.tag"}]`)
+
+	syncs, err := SyncAppVersions(context.Background(), "ws-sync")
+	require.NoError(t, err)
+
+	frontendChartYAML := "apiVersion: v2\nname: frontend\nversion: 0.1.0\nappVersion: \"1.1.0\"\n"
+	backendChartYAML := "apiVersion: v2\nname: backend\nversion: 0.2.0\nappVersion: \"2.0.0\"\n"
+	assert.Equal(t, []AppVersionSync{
+		{ChartID: "chart-frontend", ChartName: "frontend", ValuesPath: "image.tag", From: "1.0.0", To: "1.1.0", ChartYAML: types.File{
+			FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: frontend\nversion: 0.1.0\nappVersion: \"1.0.0\"\n", ContentPending: &frontendChartYAML, Version: 1,
+		}},
+		{ChartID: "chart-backend", ChartName: "backend", ValuesPath: "server.image.tag", From: "", To: "2.0.0", ChartYAML: types.File{
+			FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: backend\nversion: 0.2.0\n", ContentPending: &backendChartYAML, Version: 1,
+		}},
+	}, syncs)
+	assert.Equal(t, []string{frontendChartYAML, backendChartYAML}, *saved)
+
+	warnings, err := AppVersionSyncWarnings(context.Background(), "ws-sync")
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestSyncAppVersionsMissingValuesPath(t *testing.T) {
+	saved := stubAppVersionSync(t, `[{"chart": "frontend", "valuesPath": "image.digest"}, {"chart": "worker", "valuesPath": "image.tag"}]`)
+
+	syncs, err := SyncAppVersions(context.Background(), "ws-sync")
+	require.NoError(t, err, "a missing values path is skipped")
+	assert.Empty(t, syncs)
+	assert.Empty(t, *saved)
+
+	warnings, err := AppVersionSyncWarnings(context.Background(), "ws-sync")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"chart worker isn't in the workspace",
+		"image.digest isn't a string, number or boolean in the values.yaml of chart frontend",
+	}, warnings)
+}
+
+// stubAppVersionSync stubs a workspace with a frontend chart whose image.tag went from 1.0.0 to
+// 1.1.0 with pending content, and a backend chart whose server.image.tag was added, and the
+// app_version_sync setting. It returns the Chart.yaml files that are saved.
+func stubAppVersionSync(t *testing.T, mappings string) *[]string {
+	originalQuery, originalWorkspace, originalCommitted, originalSave := querySettings, getSyncWorkspace, getCommittedValuesYAML, saveSyncedChartManifest
+	t.Cleanup(func() {
+		querySettings, getSyncWorkspace, getCommittedValuesYAML, saveSyncedChartManifest = originalQuery, originalWorkspace, originalCommitted, originalSave
+		InvalidateSettings("ws-sync")
+	})
+	InvalidateSettings("ws-sync")
+
+	querySettings = func(ctx context.Context, workspaceID string) (map[string]json.RawMessage, error) {
+		return map[string]json.RawMessage{SettingAppVersionSync: json.RawMessage(mappings)}, nil
+	}
+
+	pendingValues := "image:\n  tag: 1.1.0\n"
+	getSyncWorkspace = func(ctx context.Context, id string) (*types.Workspace, error) {
+		return &types.Workspace{
+			ID:              id,
+			CurrentRevision: 3,
+			Charts: []types.Chart{
+				{ID: "chart-frontend", Name: "frontend", Files: []types.File{
+					{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: frontend\nversion: 0.1.0\nappVersion: \"1.0.0\"\n"},
+					{FilePath: "values.yaml", Content: "image:\n  tag: 1.0.0\n", ContentPending: &pendingValues},
+				}},
+				{ID: "chart-backend", Name: "backend", Files: []types.File{
+					{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: backend\nversion: 0.2.0\n"},
+					{FilePath: "values.yaml", Content: "server:\n  image:\n    tag: 2.0.0\n"},
+				}},
+				{ID: "chart-docs", Name: "docs", Files: []types.File{
+					{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: docs\nversion: 0.1.0\nappVersion: \"0.9\"\n"},
+					{FilePath: "values.yaml", Content: "image:\n  tag: \"0.9\"\n"},
+				}},
+			},
+		}, nil
+	}
+	getCommittedValuesYAML = func(ctx context.Context, workspaceID string, chartID string, revisionNumber int) (string, error) {
+		assert.Equal(t, 2, revisionNumber)
+		switch chartID {
+		case "chart-frontend":
+			return "image:\n  tag: 1.0.0\n", nil
+		case "chart-docs":
+			return "image:\n  tag: \"0.9\"\n", nil
+		}
+		return "server: {}\n", nil
+	}
+
+	saved := []string{}
+	saveSyncedChartManifest = func(ctx context.Context, manifest *ChartManifest) error {
+		content, err := manifest.Content()
+		if err != nil {
+			return err
+		}
+		saved = append(saved, content)
+		return nil
+	}
+	return &saved
+}
@@ -0,0 +1,257 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/slack"
+	"go.uber.org/zap"
+)
+
+const (
+	// ArchivePurgeInterval is how often workspaces archived for longer than the retention period
+	// are deleted
+	ArchivePurgeInterval = time.Hour
+
+	// DefaultArchiveRetention is how long an archived workspace is kept before it's deleted
+	DefaultArchiveRetention = 30 * 24 * time.Hour
+
+	// archivePurgeBatchSize bounds the workspaces deleted by each run of the purge
+	archivePurgeBatchSize = 50
+)
+
+var (
+	// ErrWorkspaceNotFound is returned when archiving a workspace that doesn't exist
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	// ErrWorkspaceArchived is returned when work is enqueued for an archived workspace
+	ErrWorkspaceArchived = errors.New("workspace is archived")
+)
+
+// purgeStatement deletes the rows of one table that belong to the workspace in $1
+type purgeStatement struct {
+	table string
+	query string
+}
+
+// purgeStatements delete everything that belongs to a workspace, in dependency order: queue
+// messages that reference the workspace's plans, renders, chats, conversions and files first, then
+// rows keyed by a plan, render or conversion before the rows they're keyed by, and the workspace
+// itself last. realtime_replay isn't here, its rows are removed seconds after they're sent.
+var purgeStatements = []purgeStatement{
+	{table: "work_queue", query: `DELETE FROM work_queue WHERE
+		payload->>'workspaceId' = $1
+		OR payload->>'planId' IN (SELECT id FROM workspace_plan WHERE workspace_id = $1)
+		OR payload->>'chatMessageId' IN (SELECT id FROM workspace_chat WHERE workspace_id = $1)
+		OR payload->>'conversionId' IN (SELECT id FROM workspace_conversion WHERE workspace_id = $1)
+		OR payload->>'fileId' IN (SELECT id FROM workspace_file WHERE workspace_id = $1)
+		OR (channel = 'render_workspace' AND payload->>'id' IN (SELECT id FROM workspace_rendered WHERE workspace_id = $1))
+		OR (channel = '` + slack.NotificationChannel + `' AND payload->>'id' IN (SELECT id FROM slack_notification WHERE workspace_id = $1))`},
+	{table: "workspace_plan_action_file", query: `DELETE FROM workspace_plan_action_file WHERE plan_id IN (SELECT id FROM workspace_plan WHERE workspace_id = $1)`},
+	{table: "workspace_plan", query: `DELETE FROM workspace_plan WHERE workspace_id = $1`},
+	{table: "workspace_execution_lock", query: `DELETE FROM workspace_execution_lock WHERE workspace_id = $1`},
+	{table: "workspace_rendered_explanation", query: `DELETE FROM workspace_rendered_explanation WHERE workspace_id = $1`},
+	{table: "workspace_rendered_chart", query: `DELETE FROM workspace_rendered_chart WHERE workspace_render_id IN (SELECT id FROM workspace_rendered WHERE workspace_id = $1)`},
+	{table: "workspace_rendered_file", query: `DELETE FROM workspace_rendered_file WHERE workspace_id = $1`},
+	{table: "workspace_rendered", query: `DELETE FROM workspace_rendered WHERE workspace_id = $1`},
+	{table: "workspace_conversion_file", query: `DELETE FROM workspace_conversion_file WHERE conversion_id IN (SELECT id FROM workspace_conversion WHERE workspace_id = $1)`},
+	{table: "workspace_conversion", query: `DELETE FROM workspace_conversion WHERE workspace_id = $1`},
+	{table: "workspace_lint_finding", query: `DELETE FROM workspace_lint_finding WHERE workspace_id = $1`},
+	{table: "workspace_secret_finding", query: `DELETE FROM workspace_secret_finding WHERE workspace_id = $1`},
+	{table: "workspace_publish", query: `DELETE FROM workspace_publish WHERE workspace_id = $1`},
+	{table: "workspace_values_profile", query: `DELETE FROM workspace_values_profile WHERE workspace_id = $1`},
+	{table: "workspace_settings", query: `DELETE FROM workspace_settings WHERE workspace_id = $1`},
+	{table: "share_link", query: `DELETE FROM share_link WHERE workspace_id = $1`},
+	{table: "workspace_member", query: `DELETE FROM workspace_member WHERE workspace_id = $1`},
+	{table: "chat_message_attachment", query: `DELETE FROM chat_message_attachment WHERE workspace_id = $1`},
+	{table: "workspace_chat", query: `DELETE FROM workspace_chat WHERE workspace_id = $1`},
+	{table: "workspace_file", query: `DELETE FROM workspace_file WHERE workspace_id = $1`},
+	{table: "workspace_chart", query: `DELETE FROM workspace_chart WHERE workspace_id = $1`},
+	{table: "workspace_revision", query: `DELETE FROM workspace_revision WHERE workspace_id = $1`},
+	{table: "realtime_event_journal", query: `DELETE FROM realtime_event_journal WHERE workspace_id = $1`},
+	{table: "realtime_event_sequence", query: `DELETE FROM realtime_event_sequence WHERE workspace_id = $1`},
+	{table: "workspace_presence", query: `DELETE FROM workspace_presence WHERE workspace_id = $1`},
+	{table: "slack_notification", query: `DELETE FROM slack_notification WHERE workspace_id = $1`},
+	{table: "llm_usage", query: `DELETE FROM llm_usage WHERE workspace_id = $1`},
+	{table: "audit_log", query: `DELETE FROM audit_log WHERE workspace_id = $1`},
+	{table: "workspace", query: `DELETE FROM workspace WHERE id = $1`},
+}
+
+type purgeDB interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type archiveQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// ArchiveWorkspace archives a workspace and returns when it was archived. Archiving an archived
+// workspace keeps the original time, so it doesn't postpone the purge.
+func ArchiveWorkspace(ctx context.Context, workspaceID string) (time.Time, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return archiveWorkspace(ctx, conn, workspaceID)
+}
+
+// UnarchiveWorkspace restores an archived workspace that hasn't been purged yet
+func UnarchiveWorkspace(ctx context.Context, workspaceID string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return unarchiveWorkspace(ctx, conn, workspaceID)
+}
+
+// IsWorkspaceArchived reports whether a workspace is archived
+func IsWorkspaceArchived(ctx context.Context, workspaceID string) (bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return isWorkspaceArchived(ctx, conn, workspaceID)
+}
+
+// IsFileWorkspaceArchived reports whether the workspace a file belongs to is archived
+func IsFileWorkspaceArchived(ctx context.Context, fileID string) (bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT EXISTS (
+		SELECT 1 FROM workspace_file f JOIN workspace w ON w.id = f.workspace_id
+		WHERE f.id = $1 AND w.archived_at IS NOT NULL
+	)`
+	var archived bool
+	if err := conn.QueryRow(ctx, query, fileID).Scan(&archived); err != nil {
+		return false, fmt.Errorf("failed to check if workspace of file is archived: %w", err)
+	}
+	return archived, nil
+}
+
+// PurgeArchivedWorkspaces deletes workspaces that were archived more than retention ago, with
+// everything that belongs to them
+func PurgeArchivedWorkspaces(ctx context.Context, retention time.Duration) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	purged, err := purgeArchivedWorkspaces(ctx, conn, time.Now().Add(-retention), archivePurgeBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to purge archived workspaces: %w", err)
+	}
+	if purged > 0 {
+		logger.Info("Purged archived workspaces", zap.Int("count", purged))
+	}
+
+	return nil
+}
+
+func archiveWorkspace(ctx context.Context, db archiveQuerier, workspaceID string) (time.Time, error) {
+	query := `UPDATE workspace SET archived_at = COALESCE(archived_at, now()) WHERE id = $1 RETURNING archived_at`
+	var archivedAt time.Time
+	if err := db.QueryRow(ctx, query, workspaceID).Scan(&archivedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, ErrWorkspaceNotFound
+		}
+		return time.Time{}, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+	return archivedAt, nil
+}
+
+func unarchiveWorkspace(ctx context.Context, db archiveQuerier, workspaceID string) error {
+	tag, err := db.Exec(ctx, `UPDATE workspace SET archived_at = NULL WHERE id = $1`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to unarchive workspace: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+func isWorkspaceArchived(ctx context.Context, db archiveQuerier, workspaceID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM workspace WHERE id = $1 AND archived_at IS NOT NULL)`
+	var archived bool
+	if err := db.QueryRow(ctx, query, workspaceID).Scan(&archived); err != nil {
+		return false, fmt.Errorf("failed to check if workspace is archived: %w", err)
+	}
+	return archived, nil
+}
+
+// ensureNotArchived returns ErrWorkspaceArchived for an archived workspace
+func ensureNotArchived(ctx context.Context, db archiveQuerier, workspaceID string) error {
+	archived, err := isWorkspaceArchived(ctx, db, workspaceID)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return fmt.Errorf("%w: %s", ErrWorkspaceArchived, workspaceID)
+	}
+	return nil
+}
+
+// purgeArchivedWorkspaces deletes up to limit workspaces archived before cutoff, each in its own
+// transaction so that a failure leaves the workspace whole, and returns how many it deleted
+func purgeArchivedWorkspaces(ctx context.Context, db purgeDB, cutoff time.Time, limit int) (int, error) {
+	rows, err := db.Query(ctx, `SELECT id FROM workspace WHERE archived_at < $1 ORDER BY archived_at LIMIT $2`, cutoff, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list archived workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaceIDs := []string{}
+	for rows.Next() {
+		var workspaceID string
+		if err := rows.Scan(&workspaceID); err != nil {
+			return 0, fmt.Errorf("failed to scan archived workspace: %w", err)
+		}
+		workspaceIDs = append(workspaceIDs, workspaceID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list archived workspaces: %w", err)
+	}
+	rows.Close()
+
+	purged := 0
+	for _, workspaceID := range workspaceIDs {
+		if err := purgeWorkspace(ctx, db, workspaceID, cutoff); err != nil {
+			return purged, fmt.Errorf("failed to purge workspace %s: %w", workspaceID, err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func purgeWorkspace(ctx context.Context, db purgeDB, workspaceID string, cutoff time.Time) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// lock the workspace, and skip it if it was unarchived since it was listed
+	var locked bool
+	err = tx.QueryRow(ctx, `SELECT true FROM workspace WHERE id = $1 AND archived_at < $2 FOR UPDATE`, workspaceID, cutoff).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock workspace: %w", err)
+	}
+
+	for _, statement := range purgeStatements {
+		if _, err := tx.Exec(ctx, statement.query, workspaceID); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", statement.table, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// TestPurgeStatementsCoverWorkspaceTables fails when a table with a workspace_id column is added
+// to the schema without deleting its rows when a workspace is purged
+func TestPurgeStatementsCoverWorkspaceTables(t *testing.T) {
+	purged := map[string]bool{}
+	for _, statement := range purgeStatements {
+		assert.True(t, strings.HasPrefix(statement.query, "DELETE FROM "+statement.table+" WHERE"), statement.table)
+		purged[statement.table] = true
+	}
+	assert.Equal(t, "workspace", purgeStatements[len(purgeStatements)-1].table, "the workspace must be deleted last")
+
+	paths, err := filepath.Glob("../../db/schema/tables/*.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		var table struct {
+			Name   string `yaml:"name"`
+			Schema struct {
+				Postgres struct {
+					Columns []struct {
+						Name string `yaml:"name"`
+					} `yaml:"columns"`
+				} `yaml:"postgres"`
+			} `yaml:"schema"`
+		}
+		require.NoError(t, yaml.Unmarshal(b, &table), path)
+
+		// bootstrap tables belong to bootstrap workspaces, which are templates
+		if strings.HasPrefix(table.Name, "bootstrap_") {
+			continue
+		}
+		for _, column := range table.Schema.Postgres.Columns {
+			if column.Name == "workspace_id" {
+				assert.True(t, purged[table.Name], "%s has a workspace_id but isn't purged", table.Name)
+			}
+		}
+	}
+}
+
+// seedWorkspace inserts a row into every table a workspace has rows in, and a queue message for
+// each kind of ID that queue messages reference
+func seedWorkspace(t *testing.T, ctx context.Context, q revisionQuerier, id string, archivedAt *time.Time) {
+	t.Helper()
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number, archived_at) VALUES ($1, now(), 'archive', 'user', 'test', 1, $2)`, []any{id, archivedAt}},
+		{`INSERT INTO workspace_revision (workspace_id, revision_number, created_at, created_by_user_id, created_type, is_complete) VALUES ($1, 1, now(), 'user', 'test', true)`, []any{id}},
+		{`INSERT INTO workspace_chart (id, workspace_id, name, revision_number) VALUES ($1 || '-chart', $1, 'chart', 1)`, []any{id}},
+		{`INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content) VALUES ($1 || '-file', 1, $1 || '-chart', $1, 'values.yaml', '')`, []any{id}},
+		{`INSERT INTO workspace_chat (id, workspace_id, revision_number, created_at, sent_by, prompt) VALUES ($1 || '-chat', $1, 1, now(), 'user', 'hi')`, []any{id}},
+		{`INSERT INTO chat_message_attachment (id, message_id, workspace_id, filename, content, content_type, created_at) VALUES ($1 || '-attachment', $1 || '-chat', $1, 'values.yaml', '', 'application/yaml', now())`, []any{id}},
+		{`INSERT INTO workspace_plan (id, workspace_id, chat_message_ids, created_at, updated_at, version, status) VALUES ($1 || '-plan', $1, '{}', now(), now(), 1, 'review')`, []any{id}},
+		{`INSERT INTO workspace_plan_action_file (plan_id, path, action, status, created_at) VALUES ($1 || '-plan', 'values.yaml', 'update', 'pending', now())`, []any{id}},
+		{`INSERT INTO workspace_execution_lock (workspace_id, plan_id, acquired_at) VALUES ($1, $1 || '-plan', now())`, []any{id}},
+		{`INSERT INTO workspace_rendered (id, workspace_id, revision_number, created_at) VALUES ($1 || '-render', $1, 1, now())`, []any{id}},
+		{`INSERT INTO workspace_rendered_chart (id, workspace_render_id, chart_id, is_success, created_at) VALUES ($1 || '-rendered-chart', $1 || '-render', $1 || '-chart', true, now())`, []any{id}},
+		{`INSERT INTO workspace_rendered_file (file_id, workspace_id, revision_number, file_path, content) VALUES ($1 || '-file', $1, 1, 'templates/configmap.yaml', '')`, []any{id}},
+		{`INSERT INTO workspace_rendered_explanation (workspace_render_id, file_path, workspace_id, model, explanation, created_at) VALUES ($1 || '-render', 'templates/deployment.yaml', $1, 'model', 'a Deployment', now())`, []any{id}},
+		{`INSERT INTO workspace_conversion (id, workspace_id, created_at, updated_at, source_type, status) VALUES ($1 || '-conversion', $1, now(), now(), 'k8s', 'pending')`, []any{id}},
+		{`INSERT INTO workspace_conversion_file (id, conversion_id, file_status) VALUES ($1 || '-conversion-file', $1 || '-conversion', 'pending')`, []any{id}},
+		{`INSERT INTO workspace_lint_finding (workspace_id, revision_number, chart_id, idx, rule_id, severity, file_path, line, message, created_at) VALUES ($1, 1, $1 || '-chart', 0, 'values-guard', 'warning', 'values.yaml', 1, 'unguarded value', now())`, []any{id}},
+		{`INSERT INTO workspace_secret_finding (workspace_id, file_path, content_sha, idx, detector, line, fingerprint, redacted, created_at) VALUES ($1, 'values.yaml', '', 0, 'private-key', 1, '0123456789abcdef', '****', now())`, []any{id}},
+		{`INSERT INTO workspace_publish (workspace_id, revision_number, chart_name, chart_version, status, created_at) VALUES ($1, 1, 'chart', '0.1.0', 'pending', now())`, []any{id}},
+		{`INSERT INTO workspace_values_profile (id, workspace_id, chart_id, name, content, created_at, updated_at) VALUES ($1 || '-profile', $1, $1 || '-chart', 'prod', '', now(), now())`, []any{id}},
+		{`INSERT INTO realtime_event_sequence (workspace_id, last_sequence) VALUES ($1, 1)`, []any{id}},
+		{`INSERT INTO realtime_event_journal (workspace_id, sequence, created_at, message_data) VALUES ($1, 1, now(), '{}')`, []any{id}},
+		{`INSERT INTO workspace_presence (workspace_id, user_id, user_name, file_path, last_seen_at) VALUES ($1, 'editor', 'Editor', 'values.yaml', now())`, []any{id}},
+		{`INSERT INTO slack_notification (id, workspace_id, created_at, notification_type) VALUES ($1 || '-slack', $1, now(), 'plan_applied')`, []any{id}},
+		{`INSERT INTO llm_usage (id, workspace_id, created_at, operation, model, input_tokens, output_tokens) VALUES ($1 || '-usage', $1, now(), 'plan', 'model', 1, 1)`, []any{id}},
+		{`INSERT INTO workspace_settings (workspace_id, key, value, updated_at) VALUES ($1, 'auto_generate_readme', 'true', now())`, []any{id}},
+		{`INSERT INTO workspace_member (workspace_id, user_id, role, created_at) VALUES ($1, 'editor', 'editor', now())`, []any{id}},
+		{`INSERT INTO share_link (id, token_sha, workspace_id, revision_number, created_at, expires_at) VALUES ($1 || '-share', $1 || '-token', $1, 1, now(), now())`, []any{id}},
+		{`INSERT INTO audit_log (id, workspace_id, created_at, actor, event_type, payload) VALUES ($1 || '-audit', $1, now(), 'system', 'render_started', '{}')`, []any{id}},
+	}
+	for _, statement := range statements {
+		_, err := q.Exec(ctx, statement.query, statement.args...)
+		require.NoError(t, err, statement.query)
+	}
+
+	payloads := map[string]map[string]any{
+		"new_intent":             {"workspaceId": id, "chatMessageId": id + "-chat"},
+		"new_plan":               {"planId": id + "-plan"},
+		"new_summarize":          {"fileId": id + "-file", "revision": 1},
+		"new_conversion":         {"conversionId": id + "-conversion"},
+		"render_workspace":       {"id": id + "-render"},
+		"new_slack_notification": {"id": id + "-slack"},
+	}
+	for channel, payload := range payloads {
+		_, err := q.Exec(ctx, `INSERT INTO work_queue (id, channel, payload, created_at) VALUES ($1, $2, $3, now())`, id+"-"+channel, channel, payload)
+		require.NoError(t, err)
+	}
+}
+
+// countWorkspaceRows counts the rows each purge statement would delete for a workspace
+func countWorkspaceRows(t *testing.T, ctx context.Context, q revisionQuerier, id string) map[string]int {
+	t.Helper()
+	counts := map[string]int{}
+	for _, statement := range purgeStatements {
+		query := strings.Replace(statement.query, "DELETE FROM", "SELECT count(*) FROM", 1)
+		var count int
+		require.NoError(t, q.QueryRow(ctx, query, id).Scan(&count), statement.table)
+		counts[statement.table] = count
+	}
+	return counts
+}
+
+// TestPurgeArchivedWorkspaces archives workspaces and purges the ones archived before the cutoff,
+// checking that no row of a purged workspace is left behind and that other workspaces are whole.
+// It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestPurgeArchivedWorkspaces(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping archive integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	suffix := time.Now().Format("150405.000000")
+	expired, recent, active := "expired-"+suffix, "recent-"+suffix, "active-"+suffix
+	t.Cleanup(func() {
+		for _, id := range []string{expired, recent, active} {
+			for _, statement := range purgeStatements {
+				conn.Exec(context.Background(), statement.query, id)
+			}
+		}
+	})
+
+	longAgo := time.Now().Add(-60 * 24 * time.Hour)
+	seedWorkspace(t, ctx, conn, expired, &longAgo)
+	seedWorkspace(t, ctx, conn, recent, nil)
+	seedWorkspace(t, ctx, conn, active, nil)
+
+	for table, count := range countWorkspaceRows(t, ctx, conn, expired) {
+		assert.NotZero(t, count, "%s isn't seeded", table)
+	}
+
+	_, err := archiveWorkspace(ctx, conn, recent)
+	require.NoError(t, err)
+	_, err = archiveWorkspace(ctx, conn, "missing-"+suffix)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+
+	err = ensureNotArchived(ctx, conn, recent)
+	assert.ErrorIs(t, err, ErrWorkspaceArchived)
+	assert.NoError(t, ensureNotArchived(ctx, conn, active))
+
+	before := countWorkspaceRows(t, ctx, conn, recent)
+
+	// only the workspace archived before the cutoff is purged
+	_, err = purgeArchivedWorkspaces(ctx, conn, time.Now().Add(-30*24*time.Hour), archivePurgeBatchSize)
+	require.NoError(t, err)
+
+	for table, count := range countWorkspaceRows(t, ctx, conn, expired) {
+		assert.Zero(t, count, "%s has rows of a purged workspace", table)
+	}
+	assert.Equal(t, before, countWorkspaceRows(t, ctx, conn, recent))
+	assert.Equal(t, before, countWorkspaceRows(t, ctx, conn, active))
+
+	// an unarchived workspace is never purged, and a purged one can't be unarchived
+	require.NoError(t, unarchiveWorkspace(ctx, conn, recent))
+	_, err = purgeArchivedWorkspaces(ctx, conn, time.Now().Add(time.Hour), archivePurgeBatchSize)
+	require.NoError(t, err)
+	assert.Equal(t, before, countWorkspaceRows(t, ctx, conn, recent))
+	assert.ErrorIs(t, unarchiveWorkspace(ctx, conn, expired), ErrWorkspaceNotFound)
+}
@@ -0,0 +1,205 @@
+package workspace
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+)
+
+// the actors of audit events
+const (
+	// AuditActorUser is a person, through the API or a chat message
+	AuditActorUser = "user"
+	// AuditActorSystem is the worker, such as a render or a revision being completed
+	AuditActorSystem = "system"
+	// AuditActorLLMExecutor is the LLM applying the action files of a plan
+	AuditActorLLMExecutor = "llm-executor"
+)
+
+// the types of audit events
+const (
+	AuditPlanCreated           = "plan_created"
+	AuditPlanProceeded         = "plan_proceeded"
+	AuditActionStarted         = "action_started"
+	AuditActionFinished        = "action_finished"
+	AuditRevisionCompleted     = "revision_completed"
+	AuditRenderStarted         = "render_started"
+	AuditRenderFinished        = "render_finished"
+	AuditRenderFailed          = "render_failed"
+	AuditFileEdited            = "file_edited"
+	AuditMemberChanged         = "member_changed"
+	AuditPromptSnippetsApplied = "prompt_snippets_applied"
+	AuditShareLinkCreated      = "share_link_created"
+	AuditShareLinkRevoked      = "share_link_revoked"
+	AuditAppVersionSynced      = "app_version_synced"
+)
+
+const (
+	// AuditPruneInterval is how often audit events older than the retention period are deleted
+	AuditPruneInterval = time.Hour
+
+	// DefaultAuditRetention is how long audit events are kept
+	DefaultAuditRetention = 90 * 24 * time.Hour
+
+	// DefaultAuditPageSize and MaxAuditPageSize bound the events returned by ListAuditEvents
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 500
+)
+
+// ErrInvalidAuditCursor is returned for a cursor that wasn't returned by ListAuditEvents
+var ErrInvalidAuditCursor = errors.New("invalid audit cursor")
+
+// AuditFilter selects the audit events of a workspace
+type AuditFilter struct {
+	// EventTypes limits the events to these types, all types when it's empty
+	EventTypes []string
+	// After is the cursor returned with the previous page
+	After string
+	Limit int
+}
+
+type auditDB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Audit records a significant state transition of a workspace. Audit events are for debugging,
+// callers log a failure to record one rather than failing what they were doing.
+func Audit(ctx context.Context, workspaceID string, actor string, eventType string, payload map[string]interface{}) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return insertAuditEvent(ctx, conn, workspaceID, actor, eventType, payload)
+}
+
+// ListAuditEvents returns a page of the audit events of a workspace, oldest first, and the cursor
+// for the next page, or "" if this is the last page
+func ListAuditEvents(ctx context.Context, workspaceID string, filter AuditFilter) ([]types.AuditEvent, string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return listAuditEvents(ctx, conn, workspaceID, filter)
+}
+
+// PruneAuditLog deletes audit events that were recorded more than retention ago
+func PruneAuditLog(ctx context.Context, retention time.Duration) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, `DELETE FROM audit_log WHERE created_at < $1`, time.Now().Add(-retention))
+	if err != nil {
+		return fmt.Errorf("failed to prune audit log: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		logger.Info("Pruned audit log", zap.Int64("count", tag.RowsAffected()))
+	}
+
+	return nil
+}
+
+func insertAuditEvent(ctx context.Context, db auditDB, workspaceID string, actor string, eventType string, payload map[string]interface{}) error {
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return fmt.Errorf("failed to generate audit event id: %w", err)
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	// clock_timestamp and not now, events recorded in one transaction are still ordered
+	query := `INSERT INTO audit_log (id, workspace_id, created_at, actor, event_type, payload)
+		VALUES ($1, $2, clock_timestamp(), $3, $4, $5)`
+	if _, err := db.Exec(ctx, query, id, workspaceID, actor, eventType, payload); err != nil {
+		return fmt.Errorf("failed to record %s audit event: %w", eventType, err)
+	}
+
+	return nil
+}
+
+func listAuditEvents(ctx context.Context, db auditDB, workspaceID string, filter AuditFilter) ([]types.AuditEvent, string, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultAuditPageSize
+	}
+	if limit > MaxAuditPageSize {
+		limit = MaxAuditPageSize
+	}
+
+	query := strings.Builder{}
+	query.WriteString(`SELECT id, workspace_id, created_at, actor, event_type, payload FROM audit_log WHERE workspace_id = $1`)
+	args := []any{workspaceID}
+	if len(filter.EventTypes) > 0 {
+		args = append(args, filter.EventTypes)
+		query.WriteString(fmt.Sprintf(" AND event_type = ANY($%d)", len(args)))
+	}
+	if filter.After != "" {
+		createdAt, id, err := decodeAuditCursor(filter.After)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, createdAt, id)
+		query.WriteString(fmt.Sprintf(" AND (created_at, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	// fetch one more than the limit to know if there's a next page
+	args = append(args, limit+1)
+	query.WriteString(fmt.Sprintf(" ORDER BY created_at, id LIMIT $%d", len(args)))
+
+	rows, err := db.Query(ctx, query.String(), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []types.AuditEvent{}
+	for rows.Next() {
+		var event types.AuditEvent
+		if err := rows.Scan(&event.ID, &event.WorkspaceID, &event.CreatedAt, &event.Actor, &event.EventType, &event.Payload); err != nil {
+			return nil, "", fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	if len(events) <= limit {
+		return events, "", nil
+	}
+
+	events = events[:limit]
+	last := events[len(events)-1]
+	return events, encodeAuditCursor(last.CreatedAt, last.ID), nil
+}
+
+// audit cursors are the created_at and id of the last event of a page. They're opaque to clients.
+func encodeAuditCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "/" + id))
+}
+
+func decodeAuditCursor(cursor string) (time.Time, string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidAuditCursor
+	}
+	createdAt, id, ok := strings.Cut(string(decoded), "/")
+	if !ok || id == "" {
+		return time.Time{}, "", ErrInvalidAuditCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidAuditCursor
+	}
+	return t, id, nil
+}
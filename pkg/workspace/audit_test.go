@@ -0,0 +1,88 @@
+package workspace
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditCursor(t *testing.T) {
+	createdAt := time.Date(2026, 3, 1, 12, 30, 0, 123456000, time.UTC)
+	cursor := encodeAuditCursor(createdAt, "abc123")
+
+	decodedAt, id, err := decodeAuditCursor(cursor)
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(decodedAt))
+	assert.Equal(t, "abc123", id)
+
+	for _, invalid := range []string{"not base64!", encodeCursorText("2026-03-01T12:30:00Z"), encodeCursorText("yesterday/abc123"), encodeCursorText("2026-03-01T12:30:00Z/")} {
+		_, _, err := decodeAuditCursor(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAuditCursor, invalid)
+	}
+}
+
+func encodeCursorText(text string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(text))
+}
+
+// TestListAuditEvents records events and pages through them with and without filters. It runs
+// against the database in CHARTSMITH_TEST_PG_URI.
+func TestListAuditEvents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping audit integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "audit-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM audit_log WHERE workspace_id = $1`, workspaceID)
+	})
+
+	recorded := []string{AuditPlanCreated, AuditPlanProceeded, AuditActionStarted, AuditActionFinished, AuditRevisionCompleted}
+	for _, eventType := range recorded {
+		require.NoError(t, insertAuditEvent(ctx, conn, workspaceID, AuditActorSystem, eventType, map[string]interface{}{"planId": "plan"}))
+	}
+
+	eventTypes := []string{}
+	after := ""
+	for {
+		events, next, err := listAuditEvents(ctx, conn, workspaceID, AuditFilter{Limit: 2, After: after})
+		require.NoError(t, err)
+		for _, event := range events {
+			assert.Equal(t, "plan", event.Payload["planId"])
+			eventTypes = append(eventTypes, event.EventType)
+		}
+		if next == "" {
+			break
+		}
+		after = next
+	}
+	assert.Equal(t, recorded, eventTypes)
+
+	events, next, err := listAuditEvents(ctx, conn, workspaceID, AuditFilter{EventTypes: []string{AuditActionStarted, AuditActionFinished}})
+	require.NoError(t, err)
+	assert.Empty(t, next)
+	require.Len(t, events, 2)
+	assert.Equal(t, AuditActionStarted, events[0].EventType)
+	assert.Equal(t, AuditActionFinished, events[1].EventType)
+
+	_, _, err = listAuditEvents(ctx, conn, workspaceID, AuditFilter{After: "garbage"})
+	assert.ErrorIs(t, err, ErrInvalidAuditCursor)
+}
@@ -0,0 +1,279 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/secretscan"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// BootstrapChange is how a file of a scaffold template differs between the database and a directory
+type BootstrapChange string
+
+const (
+	BootstrapFileAdded    BootstrapChange = "added"
+	BootstrapFileModified BootstrapChange = "modified"
+	BootstrapFileDeleted  BootstrapChange = "deleted"
+)
+
+// BootstrapFileChange is a file that a sync adds to, changes in or deletes from a scaffold template
+type BootstrapFileChange struct {
+	ChartName string
+	FilePath  string
+	Change    BootstrapChange
+}
+
+// embedBootstrapFile is a var so that syncs can be tested without an embedding provider
+var embedBootstrapFile = embedding.Embeddings
+
+// ReadBootstrapCharts reads the charts of a scaffold template from disk, each directory in the
+// charts directory of workspaceDir is a chart named by its Chart.yaml
+func ReadBootstrapCharts(workspaceDir string) ([]types.Chart, error) {
+	chartsDir := filepath.Join(workspaceDir, "charts")
+	entries, err := os.ReadDir(chartsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read charts directory: %w", err)
+	}
+
+	charts := []types.Chart{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		chartDir := filepath.Join(chartsDir, entry.Name())
+
+		chart := types.Chart{}
+		err := filepath.WalkDir(chartDir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			relativePath, err := filepath.Rel(chartDir, path)
+			if err != nil {
+				return fmt.Errorf("failed to get relative path: %w", err)
+			}
+			relativePath = filepath.ToSlash(relativePath)
+
+			if relativePath == "Chart.yaml" {
+				var metadata struct {
+					Name string `yaml:"name"`
+				}
+				if err := yaml.Unmarshal(content, &metadata); err != nil {
+					return fmt.Errorf("failed to parse Chart.yaml: %w", err)
+				}
+				chart.Name = metadata.Name
+			}
+
+			chart.Files = append(chart.Files, types.File{FilePath: relativePath, Content: string(content)})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart %s: %w", entry.Name(), err)
+		}
+		if chart.Name == "" {
+			return nil, fmt.Errorf("chart %s has no name in its Chart.yaml", entry.Name())
+		}
+
+		charts = append(charts, chart)
+	}
+
+	return charts, nil
+}
+
+// DiffBootstrapCharts returns the changes that make the stored charts of a scaffold template match
+// the local ones, sorted by chart and path. Charts are matched by name.
+func DiffBootstrapCharts(stored []types.Chart, local []types.Chart) []BootstrapFileChange {
+	storedContent := map[string]map[string]string{}
+	for _, chart := range stored {
+		files := map[string]string{}
+		for _, file := range chart.Files {
+			files[file.FilePath] = file.Content
+		}
+		storedContent[chart.Name] = files
+	}
+
+	changes := []BootstrapFileChange{}
+	localPaths := map[string]map[string]bool{}
+	for _, chart := range local {
+		paths := map[string]bool{}
+		for _, file := range chart.Files {
+			paths[file.FilePath] = true
+			content, ok := storedContent[chart.Name][file.FilePath]
+			switch {
+			case !ok:
+				changes = append(changes, BootstrapFileChange{ChartName: chart.Name, FilePath: file.FilePath, Change: BootstrapFileAdded})
+			case content != file.Content:
+				changes = append(changes, BootstrapFileChange{ChartName: chart.Name, FilePath: file.FilePath, Change: BootstrapFileModified})
+			}
+		}
+		localPaths[chart.Name] = paths
+	}
+
+	for _, chart := range stored {
+		for _, file := range chart.Files {
+			if !localPaths[chart.Name][file.FilePath] {
+				changes = append(changes, BootstrapFileChange{ChartName: chart.Name, FilePath: file.FilePath, Change: BootstrapFileDeleted})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].ChartName != changes[j].ChartName {
+			return changes[i].ChartName < changes[j].ChartName
+		}
+		return changes[i].FilePath < changes[j].FilePath
+	})
+	return changes
+}
+
+// SyncBootstrapWorkspace stores the local charts as a new revision of a scaffold template and makes
+// it the current revision, returning its number. Added and modified files are embedded again, the
+// others keep their embeddings. The template's current revision is read as usual until the new
+// one is complete, and the revision before it is kept for reads that started before the switch.
+func SyncBootstrapWorkspace(ctx context.Context, bootstrapWorkspace *types.BootstrapWorkspace, local []types.Chart) (int, error) {
+	provider, err := embedding.Configured()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get embedding provider: %w", err)
+	}
+
+	changed := map[string]bool{}
+	for _, change := range DiffBootstrapCharts(bootstrapWorkspace.Charts, local) {
+		changed[change.ChartName+"/"+change.FilePath] = true
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	// the revision is reserved before the files are embedded, which can take a while
+	var revisionNumber int
+	err = conn.QueryRow(ctx, `INSERT INTO bootstrap_revision (workspace_id, revision_number, is_complete)
+		SELECT $1, COALESCE(MAX(revision_number), 0) + 1, false FROM bootstrap_revision WHERE workspace_id = $1
+		RETURNING revision_number`, bootstrapWorkspace.ID).Scan(&revisionNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create revision: %w", err)
+	}
+
+	// empty files have no embeddings
+	embeddings := map[string]*string{}
+	for _, chart := range local {
+		for _, file := range chart.Files {
+			key := chart.Name + "/" + file.FilePath
+			if !changed[key] {
+				continue
+			}
+			// a scaffold isn't in a workspace that can acknowledge a secret, so files with one
+			// aren't sent to the embedding provider
+			if len(secretscan.Scan(file.FilePath, file.Content)) > 0 {
+				logger.Warn("Not embedding bootstrap file with a secret", zap.String("file", key))
+				continue
+			}
+			e, err := embedBootstrapFile(file.Content)
+			if err != nil {
+				return 0, fmt.Errorf("failed to get embeddings for %s: %w", key, err)
+			}
+			if e != "" {
+				embeddings[key] = &e
+			}
+		}
+	}
+
+	storedCharts := map[string]types.Chart{}
+	for _, chart := range bootstrapWorkspace.Charts {
+		storedCharts[chart.Name] = chart
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, chart := range local {
+		storedChart, ok := storedCharts[chart.Name]
+		chartID := storedChart.ID
+		if !ok {
+			chartID, err = securerandom.Hex(6)
+			if err != nil {
+				return 0, fmt.Errorf("failed to generate chart ID: %w", err)
+			}
+		}
+		storedFileIDs := map[string]string{}
+		for _, file := range storedChart.Files {
+			storedFileIDs[file.FilePath] = file.ID
+		}
+
+		_, err := tx.Exec(ctx, `INSERT INTO bootstrap_chart (id, workspace_id, name, revision_number) VALUES ($1, $2, $3, $4)`,
+			chartID, bootstrapWorkspace.ID, chart.Name, revisionNumber)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert chart %s: %w", chart.Name, err)
+		}
+
+		for _, file := range chart.Files {
+			key := chart.Name + "/" + file.FilePath
+			if !changed[key] {
+				_, err := tx.Exec(ctx, `INSERT INTO bootstrap_file (id, chart_id, workspace_id, file_path, content, embeddings, embeddings_provider, revision_number)
+					SELECT id, $3, workspace_id, file_path, content, embeddings, embeddings_provider, $4
+					FROM bootstrap_file WHERE id = $1 AND revision_number = $2`,
+					storedFileIDs[file.FilePath], bootstrapWorkspace.CurrentRevision, chartID, revisionNumber)
+				if err != nil {
+					return 0, fmt.Errorf("failed to copy file %s: %w", key, err)
+				}
+				continue
+			}
+
+			fileID, ok := storedFileIDs[file.FilePath]
+			if !ok {
+				fileID, err = securerandom.Hex(6)
+				if err != nil {
+					return 0, fmt.Errorf("failed to generate file ID: %w", err)
+				}
+			}
+			_, err := tx.Exec(ctx, `INSERT INTO bootstrap_file (id, chart_id, workspace_id, file_path, content, embeddings, embeddings_provider, revision_number)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				fileID, chartID, bootstrapWorkspace.ID, file.FilePath, file.Content, embeddings[key], provider.Name(), revisionNumber)
+			if err != nil {
+				return 0, fmt.Errorf("failed to insert file %s: %w", key, err)
+			}
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE bootstrap_revision SET is_complete = true WHERE workspace_id = $1 AND revision_number = $2`, bootstrapWorkspace.ID, revisionNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to complete revision: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE bootstrap_workspace SET current_revision = $2 WHERE id = $1`, bootstrapWorkspace.ID, revisionNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set current revision: %w", err)
+	}
+
+	// older revisions, and the ones of syncs that didn't complete, are no longer read
+	for _, table := range []string{"bootstrap_file", "bootstrap_chart", "bootstrap_revision"} {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE workspace_id = $1 AND revision_number NOT IN ($2, $3)`, table), bootstrapWorkspace.ID, bootstrapWorkspace.CurrentRevision, revisionNumber)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete old revisions from %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return revisionNumber, nil
+}
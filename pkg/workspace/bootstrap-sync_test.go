@@ -0,0 +1,210 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBootstrapDir writes a scaffold template directory with files by path under charts/
+func writeBootstrapDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		fullPath := filepath.Join(dir, "charts", filepath.FromSlash(path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestReadBootstrapCharts(t *testing.T) {
+	dir := writeBootstrapDir(t, map[string]string{
+		"new-chart/Chart.yaml":                "apiVersion: v2\nname: nginx\nversion: 0.1.0\n",
+		"new-chart/values.yaml":               "replicaCount: 1\n",
+		"new-chart/templates/deployment.yaml": "kind: Deployment\n",
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "charts", "README.md"), []byte("not a chart"), 0644))
+
+	charts, err := ReadBootstrapCharts(dir)
+	require.NoError(t, err)
+	require.Len(t, charts, 1)
+	assert.Equal(t, "nginx", charts[0].Name)
+
+	paths := map[string]string{}
+	for _, file := range charts[0].Files {
+		paths[file.FilePath] = file.Content
+	}
+	assert.Equal(t, map[string]string{
+		"Chart.yaml":                "apiVersion: v2\nname: nginx\nversion: 0.1.0\n",
+		"values.yaml":               "replicaCount: 1\n",
+		"templates/deployment.yaml": "kind: Deployment\n",
+	}, paths)
+
+	t.Run("chart without a name", func(t *testing.T) {
+		dir := writeBootstrapDir(t, map[string]string{"nameless/values.yaml": "a: 1\n"})
+		_, err := ReadBootstrapCharts(dir)
+		assert.ErrorContains(t, err, "chart nameless has no name")
+	})
+
+	t.Run("missing charts directory", func(t *testing.T) {
+		_, err := ReadBootstrapCharts(t.TempDir())
+		assert.ErrorContains(t, err, "failed to read charts directory")
+	})
+}
+
+func TestDiffBootstrapCharts(t *testing.T) {
+	stored := []types.Chart{
+		{ID: "chart", Name: "nginx", Files: []types.File{
+			{ID: "chart-yaml", FilePath: "Chart.yaml", Content: "name: nginx\n"},
+			{ID: "values", FilePath: "values.yaml", Content: "replicaCount: 1\n"},
+			{ID: "hpa", FilePath: "templates/hpa.yaml", Content: "kind: HorizontalPodAutoscaler\n"},
+		}},
+		{ID: "old", Name: "retired", Files: []types.File{
+			{ID: "retired-chart-yaml", FilePath: "Chart.yaml", Content: "name: retired\n"},
+		}},
+	}
+
+	dir := writeBootstrapDir(t, map[string]string{
+		"nginx/Chart.yaml":               "name: nginx\n",
+		"nginx/values.yaml":              "replicaCount: 2\n",
+		"nginx/templates/service.yaml":   "kind: Service\n",
+		"redis/Chart.yaml":               "name: redis\n",
+		"redis/templates/configmap.yaml": "kind: ConfigMap\n",
+	})
+	local, err := ReadBootstrapCharts(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []BootstrapFileChange{
+		{ChartName: "nginx", FilePath: "templates/hpa.yaml", Change: BootstrapFileDeleted},
+		{ChartName: "nginx", FilePath: "templates/service.yaml", Change: BootstrapFileAdded},
+		{ChartName: "nginx", FilePath: "values.yaml", Change: BootstrapFileModified},
+		{ChartName: "redis", FilePath: "Chart.yaml", Change: BootstrapFileAdded},
+		{ChartName: "redis", FilePath: "templates/configmap.yaml", Change: BootstrapFileAdded},
+		{ChartName: "retired", FilePath: "Chart.yaml", Change: BootstrapFileDeleted},
+	}, DiffBootstrapCharts(stored, local))
+
+	assert.Empty(t, DiffBootstrapCharts(local, local))
+}
+
+// TestSyncBootstrapWorkspace syncs a bootstrap workspace twice, checking that only changed files are
+// embedded and that the template is read at its last complete revision. It runs against the
+// database in CHARTSMITH_TEST_PG_URI.
+func TestSyncBootstrapWorkspace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping bootstrap sync integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+	stubEmbeddingProvider(t, "test-provider")
+
+	embedded := []string{}
+	original := embedBootstrapFile
+	t.Cleanup(func() { embedBootstrapFile = original })
+	embedBootstrapFile = func(content string) (string, error) {
+		embedded = append(embedded, content)
+		return vector("0.5", 4), nil
+	}
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	id := "bootstrap-" + time.Now().Format("150405.000000")
+	name := "sync-test-" + id
+	t.Cleanup(func() {
+		for _, table := range []string{"bootstrap_file", "bootstrap_chart", "bootstrap_revision"} {
+			conn.Exec(context.Background(), `DELETE FROM `+table+` WHERE workspace_id = $1`, id)
+		}
+		conn.Exec(context.Background(), `DELETE FROM bootstrap_workspace WHERE id = $1`, id)
+	})
+
+	_, err := conn.Exec(ctx, `INSERT INTO bootstrap_workspace (id, name, current_revision) VALUES ($1, $2, 0)`, id, name)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `INSERT INTO bootstrap_revision (workspace_id, revision_number, is_complete) VALUES ($1, 0, true)`, id)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `INSERT INTO bootstrap_chart (id, workspace_id, name) VALUES ($1 || '-chart', $1, 'nginx')`, id)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `INSERT INTO bootstrap_file (id, chart_id, workspace_id, file_path, content, embeddings, embeddings_provider)
+		VALUES ($1 || '-chart-yaml', $1 || '-chart', $1, 'Chart.yaml', 'name: nginx\n', $2, 'test-provider'),
+			($1 || '-values', $1 || '-chart', $1, 'values.yaml', 'replicaCount: 1\n', $2, 'test-provider')`, id, vector("0.25", 4))
+	require.NoError(t, err)
+
+	sync := func(files map[string]string) int {
+		t.Helper()
+		bootstrapWorkspace, err := GetBootstrapWorkspaceByName(ctx, name)
+		require.NoError(t, err)
+		local, err := ReadBootstrapCharts(writeBootstrapDir(t, files))
+		require.NoError(t, err)
+		revisionNumber, err := SyncBootstrapWorkspace(ctx, bootstrapWorkspace, local)
+		require.NoError(t, err)
+		return revisionNumber
+	}
+
+	assert.Equal(t, 1, sync(map[string]string{
+		"nginx/Chart.yaml":             "name: nginx\n",
+		"nginx/values.yaml":            "replicaCount: 2\n",
+		"nginx/templates/service.yaml": "kind: Service\n",
+		"nginx/templates/secret.yaml":  "awsAccessKeyId: AKIAUJZDE8GXD6NCF10E\n",
+	}))
+	assert.ElementsMatch(t, []string{"replicaCount: 2\n", "kind: Service\n"}, embedded, "only changed files without secrets are embedded")
+
+	bootstrapWorkspace, err := GetBootstrapWorkspaceByName(ctx, name)
+	require.NoError(t, err)
+	assert.Equal(t, 1, bootstrapWorkspace.CurrentRevision)
+	require.Len(t, bootstrapWorkspace.Charts, 1)
+	files := map[string]types.File{}
+	for _, file := range bootstrapWorkspace.Charts[0].Files {
+		files[file.FilePath] = file
+	}
+	require.Len(t, files, 4)
+	var secretEmbedded bool
+	require.NoError(t, conn.QueryRow(ctx, `SELECT embeddings IS NOT NULL FROM bootstrap_file WHERE workspace_id = $1 AND file_path = 'templates/secret.yaml' AND revision_number = 1`, id).Scan(&secretEmbedded))
+	assert.False(t, secretEmbedded)
+	assert.Equal(t, id+"-values", files["values.yaml"].ID, "a changed file keeps its ID")
+	assert.Equal(t, "replicaCount: 2\n", files["values.yaml"].Content)
+
+	var unchangedEmbeddings string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT embeddings::text FROM bootstrap_file WHERE id = $1 AND revision_number = 1`, id+"-chart-yaml").Scan(&unchangedEmbeddings))
+	assert.Equal(t, vector("0.25", 4), unchangedEmbeddings, "an unchanged file keeps its embeddings")
+
+	// a sync that hasn't completed isn't read
+	_, err = conn.Exec(ctx, `INSERT INTO bootstrap_revision (workspace_id, revision_number, is_complete) VALUES ($1, 2, false)`, id)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `INSERT INTO bootstrap_chart (id, workspace_id, name, revision_number) VALUES ($1 || '-partial', $1, 'partial', 2)`, id)
+	require.NoError(t, err)
+	bootstrapWorkspace, err = GetBootstrapWorkspaceByName(ctx, name)
+	require.NoError(t, err)
+	assert.Equal(t, 1, bootstrapWorkspace.CurrentRevision)
+	require.Len(t, bootstrapWorkspace.Charts, 1)
+	assert.Equal(t, "nginx", bootstrapWorkspace.Charts[0].Name)
+
+	// the next sync skips the abandoned revision, and keeps only the one before it
+	assert.Equal(t, 3, sync(map[string]string{
+		"nginx/Chart.yaml":  "name: nginx\n",
+		"nginx/values.yaml": "replicaCount: 3\n",
+	}))
+	var revisions []int
+	rows, err := conn.Query(ctx, `SELECT revision_number FROM bootstrap_revision WHERE workspace_id = $1 ORDER BY revision_number`, id)
+	require.NoError(t, err)
+	for rows.Next() {
+		var revision int
+		require.NoError(t, rows.Scan(&revision))
+		revisions = append(revisions, revision)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []int{1, 3}, revisions)
+}
@@ -8,7 +8,57 @@ import (
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
 )
 
+// DefaultBootstrapTemplate is the scaffold used when a workspace doesn't specify a template
+const DefaultBootstrapTemplate = "default-workspace"
+
+// GetBootstrapWorkspace returns the default scaffold template
 func GetBootstrapWorkspace(ctx context.Context) (*types.BootstrapWorkspace, error) {
+	return GetBootstrapWorkspaceByName(ctx, DefaultBootstrapTemplate)
+}
+
+// ListBootstrapTemplates returns the available scaffold templates, without their charts
+func ListBootstrapTemplates(ctx context.Context) ([]types.BootstrapWorkspace, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT
+		bootstrap_workspace.id,
+		bootstrap_workspace.name,
+		bootstrap_workspace.current_revision
+	FROM
+		bootstrap_workspace
+	ORDER BY
+		bootstrap_workspace.name`
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing bootstrap workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []types.BootstrapWorkspace{}
+	for rows.Next() {
+		var template types.BootstrapWorkspace
+		if err := rows.Scan(&template.ID, &template.Name, &template.CurrentRevision); err != nil {
+			return nil, fmt.Errorf("error scanning bootstrap workspace: %w", err)
+		}
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating bootstrap workspaces: %w", err)
+	}
+
+	return templates, nil
+}
+
+// GetBootstrapWorkspaceByName returns the scaffold template with the given name, including the charts
+// of its current revision. An empty name returns the default template. The current revision only
+// moves once a sync has completed the next one, so a template is never read mid-update.
+func GetBootstrapWorkspaceByName(ctx context.Context, name string) (*types.BootstrapWorkspace, error) {
+	if name == "" {
+		name = DefaultBootstrapTemplate
+	}
+
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
@@ -21,7 +71,7 @@ func GetBootstrapWorkspace(ctx context.Context) (*types.BootstrapWorkspace, erro
 	WHERE
 		bootstrap_workspace.name = $1`
 
-	row := conn.QueryRow(ctx, query, "default-workspace")
+	row := conn.QueryRow(ctx, query, name)
 	var bootstrapWorkspace types.BootstrapWorkspace
 	err := row.Scan(
 		&bootstrapWorkspace.ID,
@@ -54,9 +104,10 @@ func listChartsForBootstrapWorkspace(ctx context.Context, bootstrapWorkspaceID s
 	FROM
 		bootstrap_chart
 	WHERE
-		bootstrap_chart.workspace_id = $1`
+		bootstrap_chart.workspace_id = $1 AND
+		bootstrap_chart.revision_number = $2`
 
-	rows, err := conn.Query(ctx, query, bootstrapWorkspaceID)
+	rows, err := conn.Query(ctx, query, bootstrapWorkspaceID, revisionNumber)
 	if err != nil {
 		return nil, fmt.Errorf("error scanning bootstrap workspace charts: %w", err)
 	}
@@ -102,9 +153,10 @@ func listFilesForBootstrapChart(ctx context.Context, bootstrapChartID string, re
 	FROM
 		bootstrap_file
 	WHERE
-		bootstrap_file.chart_id = $1`
+		bootstrap_file.chart_id = $1 AND
+		bootstrap_file.revision_number = $2`
 
-	rows, err := conn.Query(ctx, query, bootstrapChartID)
+	rows, err := conn.Query(ctx, query, bootstrapChartID, revisionNumber)
 	if err != nil {
 		return nil, fmt.Errorf("error scanning bootstrap chart files: %w", err)
 	}
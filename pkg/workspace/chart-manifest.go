@@ -0,0 +1,290 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrChartManifestNotFound is returned when a chart has no Chart.yaml
+var ErrChartManifestNotFound = errors.New("chart has no Chart.yaml")
+
+// ErrInvalidChartManifest is returned when a Chart.yaml can't be parsed or a change would make it
+// invalid
+var ErrInvalidChartManifest = errors.New("invalid chart manifest")
+
+// ChartDependency is a dependency in a Chart.yaml
+type ChartDependency struct {
+	Name         string        `yaml:"name" json:"name"`
+	Version      string        `yaml:"version,omitempty" json:"version,omitempty"`
+	Repository   string        `yaml:"repository,omitempty" json:"repository,omitempty"`
+	Condition    string        `yaml:"condition,omitempty" json:"condition,omitempty"`
+	Tags         []string      `yaml:"tags,omitempty" json:"tags,omitempty"`
+	ImportValues []interface{} `yaml:"import-values,omitempty" json:"importValues,omitempty"`
+	Alias        string        `yaml:"alias,omitempty" json:"alias,omitempty"`
+}
+
+// ChartManifest is a parsed Chart.yaml. Fields it doesn't model are kept in Extra and written back
+// as they were. Writing it back orders the keys and drops the comments, except for the comment
+// block at the top of the file.
+type ChartManifest struct {
+	APIVersion   string            `json:"apiVersion"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Type         string            `json:"type,omitempty"`
+	Version      string            `json:"version"`
+	AppVersion   string            `json:"appVersion,omitempty"`
+	Dependencies []ChartDependency `json:"dependencies,omitempty"`
+	// Extra has the other top level fields, such as keywords and maintainers
+	Extra map[string]interface{} `json:"extra,omitempty"`
+
+	// headComment is the comment block at the top of the file, with the blank lines after it
+	headComment string
+
+	// where the manifest was loaded from, so that it's saved back to the same file
+	workspaceID    string
+	chartID        string
+	revisionNumber int
+	fileVersion    int
+}
+
+// chartManifestFields are the fields ChartManifest models, in the order they're written
+var chartManifestFields = []string{"apiVersion", "name", "description", "type", "version", "appVersion"}
+
+// ParseChartManifest parses the content of a Chart.yaml. An empty file is an empty manifest.
+func ParseChartManifest(content string) (*ChartManifest, error) {
+	var fields struct {
+		APIVersion   string            `yaml:"apiVersion"`
+		Name         string            `yaml:"name"`
+		Description  string            `yaml:"description"`
+		Type         string            `yaml:"type"`
+		Version      string            `yaml:"version"`
+		AppVersion   string            `yaml:"appVersion"`
+		Dependencies []ChartDependency `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &fields); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse Chart.yaml: %w", ErrInvalidChartManifest, err)
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &raw); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse Chart.yaml: %w", ErrInvalidChartManifest, err)
+	}
+
+	extra := map[string]interface{}{}
+	for key, value := range raw {
+		if key != "dependencies" && !slices.Contains(chartManifestFields, key) {
+			extra[key] = value
+		}
+	}
+
+	return &ChartManifest{
+		APIVersion:   fields.APIVersion,
+		Name:         fields.Name,
+		Description:  fields.Description,
+		Type:         fields.Type,
+		Version:      fields.Version,
+		AppVersion:   fields.AppVersion,
+		Dependencies: fields.Dependencies,
+		Extra:        extra,
+		headComment:  leadingComment(content),
+	}, nil
+}
+
+// leadingComment returns the comment lines at the top of content and the blank lines after them
+func leadingComment(content string) string {
+	end := 0
+	for end < len(content) {
+		lineEnd := strings.IndexByte(content[end:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(content) - end
+		} else {
+			lineEnd++
+		}
+		line := strings.TrimSpace(content[end : end+lineEnd])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			break
+		}
+		end += lineEnd
+	}
+	if strings.TrimSpace(content[:end]) == "" {
+		return ""
+	}
+	return content[:end]
+}
+
+// SetVersion sets the version of the chart, which has to be semver
+func (m *ChartManifest) SetVersion(version string) error {
+	if _, err := semver.StrictNewVersion(version); err != nil {
+		return fmt.Errorf("%w: version %q is not semver: %v", ErrInvalidChartManifest, version, err)
+	}
+	m.Version = version
+	return nil
+}
+
+// SetAppVersion sets the version of the app the chart deploys, which doesn't have to be semver
+func (m *ChartManifest) SetAppVersion(appVersion string) error {
+	if strings.ContainsAny(appVersion, "\n\r") {
+		return fmt.Errorf("%w: appVersion can't span lines", ErrInvalidChartManifest)
+	}
+	m.AppVersion = appVersion
+	return nil
+}
+
+// SetDependencies replaces the dependencies of the chart. Each needs a name, and a name or alias
+// can only be used once.
+func (m *ChartManifest) SetDependencies(dependencies []ChartDependency) error {
+	seen := map[string]bool{}
+	for i, dependency := range dependencies {
+		if dependency.Name == "" {
+			return fmt.Errorf("%w: dependency %d has no name", ErrInvalidChartManifest, i)
+		}
+		key := dependency.Name
+		if dependency.Alias != "" {
+			key = dependency.Alias
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: dependency %s is listed twice", ErrInvalidChartManifest, key)
+		}
+		seen[key] = true
+	}
+	m.Dependencies = dependencies
+	return nil
+}
+
+// Content returns the manifest as a Chart.yaml. The modeled fields come first in the order helm
+// create writes them, then the other fields sorted by key, then the dependencies, so that the same
+// manifest is always written the same way.
+func (m *ChartManifest) Content() (string, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value interface{}) error {
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, valueNode)
+		return nil
+	}
+
+	values := map[string]string{
+		"apiVersion":  m.APIVersion,
+		"name":        m.Name,
+		"description": m.Description,
+		"type":        m.Type,
+		"version":     m.Version,
+		"appVersion":  m.AppVersion,
+	}
+	for _, key := range chartManifestFields {
+		if values[key] == "" {
+			continue
+		}
+		if err := add(key, values[key]); err != nil {
+			return "", err
+		}
+		// helm recommends quoting appVersion, which is often a number or tag
+		if key == "appVersion" {
+			root.Content[len(root.Content)-1].Style = yaml.DoubleQuotedStyle
+		}
+	}
+
+	extraKeys := make([]string, 0, len(m.Extra))
+	for key := range m.Extra {
+		extraKeys = append(extraKeys, key)
+	}
+	sort.Strings(extraKeys)
+	for _, key := range extraKeys {
+		if err := add(key, m.Extra[key]); err != nil {
+			return "", err
+		}
+	}
+
+	if len(m.Dependencies) > 0 {
+		if err := add("dependencies", m.Dependencies); err != nil {
+			return "", err
+		}
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return "", fmt.Errorf("failed to encode Chart.yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode Chart.yaml: %w", err)
+	}
+
+	return m.headComment + buf.String(), nil
+}
+
+// LoadChartManifest parses the Chart.yaml of a chart in the current revision of a workspace,
+// pending content included
+func LoadChartManifest(ctx context.Context, workspaceID string, chartID string) (*ChartManifest, error) {
+	w, err := GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	return chartManifestOf(w, chartID)
+}
+
+// chartManifestOf parses the Chart.yaml of a chart in a workspace loaded with its current
+// revision, pending content included
+func chartManifestOf(w *types.Workspace, chartID string) (*ChartManifest, error) {
+	var chart *types.Chart
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			chart = &w.Charts[i]
+		}
+	}
+	if chart == nil {
+		return nil, fmt.Errorf("%w: %s in workspace %s", ErrChartNotFound, chartID, w.ID)
+	}
+
+	for _, file := range chart.Files {
+		if file.FilePath != "Chart.yaml" {
+			continue
+		}
+		content := file.Content
+		if file.ContentPending != nil {
+			content = *file.ContentPending
+		}
+		manifest, err := ParseChartManifest(content)
+		if err != nil {
+			return nil, err
+		}
+		manifest.workspaceID = w.ID
+		manifest.chartID = chartID
+		manifest.revisionNumber = w.CurrentRevision
+		manifest.fileVersion = file.Version
+		return manifest, nil
+	}
+
+	return nil, fmt.Errorf("%w: chart %s in workspace %s", ErrChartManifestNotFound, chartID, w.ID)
+}
+
+// SaveChartManifest writes a manifest loaded with LoadChartManifest back to its Chart.yaml as
+// pending content. ErrConflict is returned when the file was written since it was loaded.
+func SaveChartManifest(ctx context.Context, manifest *ChartManifest) error {
+	if manifest.workspaceID == "" {
+		return errors.New("chart manifest wasn't loaded from a workspace")
+	}
+
+	content, err := manifest.Content()
+	if err != nil {
+		return err
+	}
+
+	fileVersion := manifest.fileVersion
+	if err := SetFileContentPending(ctx, "Chart.yaml", manifest.revisionNumber, manifest.chartID, manifest.workspaceID, content, &fileVersion); err != nil {
+		return fmt.Errorf("failed to write Chart.yaml: %w", err)
+	}
+	manifest.fileVersion++
+
+	return nil
+}
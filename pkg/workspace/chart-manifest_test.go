@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChartManifestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "helm create chart",
+			content: `apiVersion: v2
+name: nginx
+description: A Helm chart for Kubernetes
+type: application
+version: 0.1.0
+appVersion: "1.16.0"
+`,
+			want: `apiVersion: v2
+name: nginx
+description: A Helm chart for Kubernetes
+type: application
+version: 0.1.0
+appVersion: "1.16.0"
+`,
+		},
+		{
+			name: "top of file comment is kept, the others are dropped",
+			content: `# Copyright Example Inc.
+# Licensed under the Apache License
+
+apiVersion: v2
+name: nginx
+# bumped by CI
+version: 1.2.3
+`,
+			want: `# Copyright Example Inc.
+# Licensed under the Apache License
+
+apiVersion: v2
+name: nginx
+version: 1.2.3
+`,
+		},
+		{
+			name: "unknown fields are kept, sorted after the known ones",
+			content: `name: nginx
+maintainers:
+  - name: jane
+    email: jane@example.com
+version: 0.1.0
+dependencies:
+  - name: redis
+    version: 17.0.0
+    repository: https://charts.bitnami.com/bitnami
+    condition: redis.enabled
+keywords:
+  - web
+apiVersion: v2
+annotations:
+  category: Infrastructure
+`,
+			want: `apiVersion: v2
+name: nginx
+version: 0.1.0
+annotations:
+  category: Infrastructure
+keywords:
+  - web
+maintainers:
+  - email: jane@example.com
+    name: jane
+dependencies:
+  - name: redis
+    version: 17.0.0
+    repository: https://charts.bitnami.com/bitnami
+    condition: redis.enabled
+`,
+		},
+		{
+			name:    "versions that look like numbers stay strings",
+			content: "apiVersion: v2\nname: nginx\nversion: 1.0\nappVersion: 2\n",
+			want:    "apiVersion: v2\nname: nginx\nversion: \"1.0\"\nappVersion: \"2\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := ParseChartManifest(tt.content)
+			require.NoError(t, err)
+
+			content, err := manifest.Content()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, content)
+
+			// writing it back is stable
+			again, err := ParseChartManifest(content)
+			require.NoError(t, err)
+			content, err = again.Content()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, content)
+		})
+	}
+}
+
+func TestParseChartManifestInvalid(t *testing.T) {
+	_, err := ParseChartManifest("name: [nginx\n")
+	assert.ErrorIs(t, err, ErrInvalidChartManifest)
+}
+
+func TestChartManifestSetters(t *testing.T) {
+	manifest, err := ParseChartManifest("apiVersion: v2\nname: nginx\nversion: 0.1.0\n")
+	require.NoError(t, err)
+
+	assert.NoError(t, manifest.SetVersion("0.2.0-rc.1"))
+	assert.Equal(t, "0.2.0-rc.1", manifest.Version)
+	assert.ErrorIs(t, manifest.SetVersion("v1"), ErrInvalidChartManifest)
+	assert.Equal(t, "0.2.0-rc.1", manifest.Version, "an invalid version isn't set")
+
+	assert.NoError(t, manifest.SetAppVersion("latest"))
+	assert.ErrorIs(t, manifest.SetAppVersion("1\nname: other"), ErrInvalidChartManifest)
+
+	assert.NoError(t, manifest.SetDependencies([]ChartDependency{
+		{Name: "redis", Version: "17.0.0", Repository: "https://charts.bitnami.com/bitnami"},
+		{Name: "redis", Alias: "cache", Version: "17.0.0", Repository: "https://charts.bitnami.com/bitnami"},
+	}))
+	assert.ErrorIs(t, manifest.SetDependencies([]ChartDependency{{Name: "redis"}, {Name: "redis"}}), ErrInvalidChartManifest)
+	assert.ErrorIs(t, manifest.SetDependencies([]ChartDependency{{Version: "1.0.0"}}), ErrInvalidChartManifest)
+	assert.Len(t, manifest.Dependencies, 2)
+
+	content, err := manifest.Content()
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: v2
+name: nginx
+version: 0.2.0-rc.1
+appVersion: "latest"
+dependencies:
+  - name: redis
+    version: 17.0.0
+    repository: https://charts.bitnami.com/bitnami
+  - name: redis
+    version: 17.0.0
+    repository: https://charts.bitnami.com/bitnami
+    alias: cache
+`, content)
+
+	assert.NoError(t, manifest.SetDependencies(nil))
+	content, err = manifest.Content()
+	require.NoError(t, err)
+	assert.NotContains(t, content, "dependencies")
+}
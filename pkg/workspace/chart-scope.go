@@ -0,0 +1,81 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrChartNotFound is returned when a chart isn't in the workspace
+var ErrChartNotFound = errors.New("chart not found")
+
+// FindChart returns the chart with the given ID. An empty ID means the first chart in the
+// workspace, which is what plans created before charts were scoped expect.
+func FindChart(w *types.Workspace, chartID string) (*types.Chart, error) {
+	if len(w.Charts) == 0 {
+		return nil, fmt.Errorf("no charts found in workspace %s", w.ID)
+	}
+
+	if chartID == "" {
+		return &w.Charts[0], nil
+	}
+
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			return &w.Charts[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("chart %s not found in workspace %s", chartID, w.ID)
+}
+
+// ChartScopedPath returns the path the planner uses for a file. When a workspace has more than one
+// chart, paths are prefixed with the chart name so that files with the same name aren't ambiguous.
+func ChartScopedPath(w *types.Workspace, c *types.Chart, path string) string {
+	if len(w.Charts) <= 1 {
+		return path
+	}
+	return fmt.Sprintf("%s/%s", c.Name, path)
+}
+
+// ResolveChartPath is the inverse of ChartScopedPath. It returns the chart a planner path refers to
+// and the path of the file relative to that chart.
+func ResolveChartPath(w *types.Workspace, path string) (*types.Chart, string, error) {
+	if len(w.Charts) == 0 {
+		return nil, "", fmt.Errorf("no charts found in workspace %s", w.ID)
+	}
+
+	for i := range w.Charts {
+		prefix := w.Charts[i].Name + "/"
+		if strings.HasPrefix(path, prefix) {
+			return &w.Charts[i], strings.TrimPrefix(path, prefix), nil
+		}
+	}
+
+	if len(w.Charts) == 1 {
+		return &w.Charts[0], path, nil
+	}
+
+	// no chart prefix, but the path might still only exist in one chart
+	var match *types.Chart
+	for i := range w.Charts {
+		for _, file := range w.Charts[i].Files {
+			if file.FilePath != path {
+				continue
+			}
+			if match != nil {
+				return nil, "", fmt.Errorf("path %s is ambiguous, it exists in charts %s and %s", path, match.Name, w.Charts[i].Name)
+			}
+			match = &w.Charts[i]
+			break
+		}
+	}
+
+	if match == nil {
+		return nil, "", fmt.Errorf("path %s does not start with a chart name", path)
+	}
+
+	return match, path, nil
+}
@@ -0,0 +1,141 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func twoChartWorkspace() *types.Workspace {
+	return &types.Workspace{
+		ID: "workspace",
+		Charts: []types.Chart{
+			{
+				ID:   "chart-frontend",
+				Name: "frontend",
+				Files: []types.File{
+					{ChartID: "chart-frontend", FilePath: "Chart.yaml", Content: "name: frontend"},
+					{ChartID: "chart-frontend", FilePath: "templates/deployment.yaml", Content: "frontend deployment"},
+					{ChartID: "chart-frontend", FilePath: "templates/ingress.yaml", Content: "frontend ingress"},
+				},
+			},
+			{
+				ID:   "chart-backend",
+				Name: "backend",
+				Files: []types.File{
+					{ChartID: "chart-backend", FilePath: "Chart.yaml", Content: "name: backend"},
+					{ChartID: "chart-backend", FilePath: "templates/deployment.yaml", Content: "backend deployment"},
+				},
+			},
+		},
+	}
+}
+
+func TestResolveChartPath(t *testing.T) {
+	w := twoChartWorkspace()
+
+	tests := []struct {
+		name        string
+		path        string
+		wantChartID string
+		wantPath    string
+		wantErr     bool
+	}{
+		{
+			name:        "prefixed frontend",
+			path:        "frontend/templates/deployment.yaml",
+			wantChartID: "chart-frontend",
+			wantPath:    "templates/deployment.yaml",
+		},
+		{
+			name:        "prefixed backend",
+			path:        "backend/templates/deployment.yaml",
+			wantChartID: "chart-backend",
+			wantPath:    "templates/deployment.yaml",
+		},
+		{
+			name:        "unprefixed path that only exists in one chart",
+			path:        "templates/ingress.yaml",
+			wantChartID: "chart-frontend",
+			wantPath:    "templates/ingress.yaml",
+		},
+		{
+			name:    "unprefixed path in both charts is ambiguous",
+			path:    "templates/deployment.yaml",
+			wantErr: true,
+		},
+		{
+			name:    "unprefixed new file",
+			path:    "templates/service.yaml",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, path, err := ResolveChartPath(w, tt.path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChartID, c.ID)
+			assert.Equal(t, tt.wantPath, path)
+		})
+	}
+}
+
+func TestResolveChartPathSingleChart(t *testing.T) {
+	w := &types.Workspace{
+		ID:     "workspace",
+		Charts: []types.Chart{{ID: "chart", Name: "app"}},
+	}
+
+	c, path, err := ResolveChartPath(w, "templates/service.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "chart", c.ID)
+	assert.Equal(t, "templates/service.yaml", path)
+
+	// a single chart workspace doesn't need a prefix, but tolerates one
+	c, path, err = ResolveChartPath(w, "app/templates/service.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "chart", c.ID)
+	assert.Equal(t, "templates/service.yaml", path)
+
+	assert.Equal(t, "templates/service.yaml", ChartScopedPath(w, c, "templates/service.yaml"))
+}
+
+func TestChartScopedPathRoundTrip(t *testing.T) {
+	w := twoChartWorkspace()
+
+	for i := range w.Charts {
+		for _, file := range w.Charts[i].Files {
+			scoped := ChartScopedPath(w, &w.Charts[i], file.FilePath)
+			c, path, err := ResolveChartPath(w, scoped)
+			require.NoError(t, err)
+			assert.Equal(t, w.Charts[i].ID, c.ID)
+			assert.Equal(t, file.FilePath, path)
+		}
+	}
+}
+
+func TestFindChart(t *testing.T) {
+	w := twoChartWorkspace()
+
+	c, err := FindChart(w, "chart-backend")
+	require.NoError(t, err)
+	assert.Equal(t, "backend", c.Name)
+
+	// plans created before chart scoping have no chart id
+	c, err = FindChart(w, "")
+	require.NoError(t, err)
+	assert.Equal(t, "frontend", c.Name)
+
+	_, err = FindChart(w, "missing")
+	assert.Error(t, err)
+
+	_, err = FindChart(&types.Workspace{ID: "empty"}, "")
+	assert.Error(t, err)
+}
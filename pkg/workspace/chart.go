@@ -6,10 +6,10 @@ import (
 	"time"
 
 	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"github.com/tuvistavie/securerandom"
-	"gopkg.in/yaml.v2"
 )
 
 func CreateChart(ctx context.Context, workspaceID string, revisionNumber int) (*types.Chart, error) {
@@ -35,7 +35,18 @@ func CreateChart(ctx context.Context, workspaceID string, revisionNumber int) (*
 	}, nil
 }
 
+// AddFileToChart inserts a file into a chart, normalizing its content with NormalizeFileContent and
+// recording the secrets in it
 func AddFileToChart(ctx context.Context, chartID string, workspaceID string, revisionNumber int, path string, content string) error {
+	preserveLineEndings, err := GetSetting[bool](ctx, workspaceID, SettingPreserveLineEndings)
+	if err != nil {
+		return fmt.Errorf("failed to get workspace line endings: %w", err)
+	}
+	content, lineEnding, err := NormalizeFileContent(path, content, !preserveLineEndings)
+	if err != nil {
+		return err
+	}
+
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
@@ -44,11 +55,14 @@ func AddFileToChart(ctx context.Context, chartID string, workspaceID string, rev
 		return fmt.Errorf("failed to generate random ID: %w", err)
 	}
 
-	query := `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content) VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err = conn.Exec(ctx, query, fileID, revisionNumber, chartID, workspaceID, path, content)
+	query := `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, line_ending) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))`
+	_, err = conn.Exec(ctx, query, fileID, revisionNumber, chartID, workspaceID, path, content, contentSHA(content), lineEnding)
 	if err != nil {
 		return fmt.Errorf("failed to insert file: %w", err)
 	}
+	if _, err := recordSecretFindings(ctx, conn, workspaceID, path, content); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -100,27 +114,30 @@ func ListCharts(ctx context.Context, workspaceID string, revisionNumber int) ([]
 }
 
 func PublishChart(ctx context.Context, chart *types.Chart, workspaceID string, revisionNumber int) (string, string, string, error) {
+	files, err := integrations.MutateExport(ctx, &types.Workspace{ID: workspaceID}, chart.Files)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to apply integrations to chart: %w", err)
+	}
+
 	// Use the root ttl.sh URL since that's all that works reliably
 	displayUrl := "ttl.sh"
 
 	// parse the files, find the chart yaml and get the chart version from it
 	chartVersion := "0.1.0" // Default version if not found
-	for _, file := range chart.Files {
+	for _, file := range files {
 		if file.FilePath == "Chart.yaml" {
-			// parse the chart yaml
-			var chartYaml map[interface{}]interface{}
-			err := yaml.Unmarshal([]byte(file.Content), &chartYaml)
+			manifest, err := ParseChartManifest(file.Content)
 			if err != nil {
-				return "", "", "", fmt.Errorf("failed to unmarshal chart yaml: %w", err)
+				return "", "", "", fmt.Errorf("failed to parse chart yaml: %w", err)
 			}
-			if chartYaml["version"] != nil {
-				chartVersion = chartYaml["version"].(string)
+			if manifest.Version != "" {
+				chartVersion = manifest.Version
 			}
 		}
 	}
 
 	// Publish the chart
-	if err := helmutils.PublishChartExec(chart.Files, workspaceID, chart.Name); err != nil {
+	if err := helmutils.PublishChartExec(files, workspaceID, chart.Name); err != nil {
 		return "", "", "", fmt.Errorf("failed to publish chart: %w", err)
 	}
 
@@ -132,7 +149,7 @@ func PublishChart(ctx context.Context, chart *types.Chart, workspaceID string, r
 			(workspace_id, revision_number, chart_name, chart_version, status, created_at, processing_started_at, completed_at)
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (workspace_id, revision_number, chart_name, chart_version) DO UPDATE SET
 			status = $5, completed_at = $8`
-	_, err := conn.Exec(ctx, query,
+	_, err = conn.Exec(ctx, query,
 		workspaceID, revisionNumber, chart.Name, chartVersion,
 		"completed", time.Now(), time.Now(), time.Now())
 	if err != nil {
@@ -0,0 +1,181 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+)
+
+const (
+	// MaxChatAttachments is how many files can be attached to one chat message
+	MaxChatAttachments = 5
+
+	// MaxChatAttachmentBytes limits the size of each attached file. Attachments are included in
+	// prompts, so anything larger would be truncated anyway.
+	MaxChatAttachmentBytes = 256 << 10
+
+	// defaultAttachmentContentType is the content type of an attachment uploaded without one
+	defaultAttachmentContentType = "text/plain"
+)
+
+// attachmentContentTypes are the content types given to attachments uploaded without one, by
+// file extension
+var attachmentContentTypes = map[string]string{
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".json": "application/json",
+	".md":   "text/markdown",
+	".tpl":  "text/plain",
+	".txt":  "text/plain",
+}
+
+// ValidateChatAttachments returns an error if there are too many attachments, or one of them has
+// no filename, is too large or isn't text. Only text can be included in a prompt.
+func ValidateChatAttachments(attachments []types.ChatAttachment) error {
+	if len(attachments) > MaxChatAttachments {
+		return fmt.Errorf("at most %d attachments can be uploaded with a message", MaxChatAttachments)
+	}
+	for i, attachment := range attachments {
+		filename := strings.TrimSpace(attachment.Filename)
+		if filename == "" {
+			return fmt.Errorf("attachments[%d]: filename is required", i)
+		}
+		if strings.ContainsAny(filename, "/\\") {
+			return fmt.Errorf("attachments[%d]: filename must not contain a path", i)
+		}
+		if len(attachment.Content) > MaxChatAttachmentBytes {
+			return fmt.Errorf("attachments[%d]: %s is larger than %d bytes", i, filename, MaxChatAttachmentBytes)
+		}
+		if !utf8.ValidString(attachment.Content) {
+			return fmt.Errorf("attachments[%d]: %w: %s", i, ErrInvalidEncoding, filename)
+		}
+	}
+	return nil
+}
+
+// attachmentContentType returns the content type of an attachment, guessing it from the filename
+// when it wasn't uploaded with one
+func attachmentContentType(attachment types.ChatAttachment) string {
+	if contentType := strings.TrimSpace(attachment.ContentType); contentType != "" {
+		return contentType
+	}
+	if contentType, ok := attachmentContentTypes[strings.ToLower(path.Ext(attachment.Filename))]; ok {
+		return contentType
+	}
+	return defaultAttachmentContentType
+}
+
+// CreateChatMessageWithAttachments creates a chat message sent by userID with files attached, and
+// enqueues it to have its intent classified, like a message created by the app. The message and
+// its attachments are written together, so the worker never sees a message without them.
+func CreateChatMessageWithAttachments(ctx context.Context, workspaceID string, userID string, prompt string, attachments []types.ChatAttachment) (*types.Chat, error) {
+	if err := ValidateChatAttachments(attachments); err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if err := ensureNotArchived(ctx, conn, workspaceID); err != nil {
+		return nil, err
+	}
+
+	var currentRevision int
+	if err := conn.QueryRow(ctx, `SELECT current_revision_number FROM workspace WHERE id = $1`, workspaceID).Scan(&currentRevision); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, workspaceID)
+		}
+		return nil, fmt.Errorf("failed to get workspace revision: %w", err)
+	}
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate random ID: %w", err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO workspace_chat (
+		id, workspace_id, created_at, sent_by, prompt, response, revision_number, is_canceled,
+		is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic,
+		is_intent_chart_developer, is_intent_chart_operator, is_intent_render
+	)
+	VALUES ($1, $2, now(), $3, $4, null, $5, false, false, false, false, false, false, false, false)`
+	if _, err := tx.Exec(ctx, query, id, workspaceID, userID, prompt, currentRevision); err != nil {
+		return nil, fmt.Errorf("failed to insert chat message: %w", err)
+	}
+
+	for _, attachment := range attachments {
+		attachmentID, err := securerandom.Hex(12)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate random ID: %w", err)
+		}
+
+		query := `INSERT INTO chat_message_attachment (id, message_id, workspace_id, filename, content, content_type, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, now())`
+		if _, err := tx.Exec(ctx, query, attachmentID, id, workspaceID, strings.TrimSpace(attachment.Filename), attachment.Content, attachmentContentType(attachment)); err != nil {
+			return nil, fmt.Errorf("failed to insert chat message attachment: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if err := persistence.EnqueueWork(ctx, "new_intent", map[string]interface{}{
+		"chatMessageId": id,
+		"workspaceId":   workspaceID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to enqueue intent: %w", err)
+	}
+
+	return GetChatMessage(ctx, id)
+}
+
+// ListChatMessageAttachments returns the attachments of chat messages, in the order the messages
+// are given and then the order they were uploaded in
+func ListChatMessageAttachments(ctx context.Context, messageIDs ...string) ([]types.ChatAttachment, error) {
+	if len(messageIDs) == 0 {
+		return []types.ChatAttachment{}, nil
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT a.id, a.message_id, a.filename, a.content, a.content_type, a.created_at
+		FROM chat_message_attachment a
+		JOIN unnest($1::text[]) WITH ORDINALITY AS m(id, position) ON m.id = a.message_id
+		ORDER BY m.position, a.created_at, a.id`
+
+	rows, err := conn.Query(ctx, query, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat message attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []types.ChatAttachment{}
+	for rows.Next() {
+		var attachment types.ChatAttachment
+		if err := rows.Scan(&attachment.ID, &attachment.MessageID, &attachment.Filename, &attachment.Content, &attachment.ContentType, &attachment.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message attachment: %w", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list chat message attachments: %w", err)
+	}
+
+	return attachments, nil
+}
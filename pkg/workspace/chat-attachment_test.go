@@ -0,0 +1,43 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateChatAttachments(t *testing.T) {
+	tests := []struct {
+		name        string
+		attachments []types.ChatAttachment
+		wantErr     string
+	}{
+		{name: "none"},
+		{name: "text", attachments: []types.ChatAttachment{{Filename: "values.yaml", Content: "replicaCount: 1\n"}}},
+		{name: "too many", attachments: make([]types.ChatAttachment, MaxChatAttachments+1), wantErr: "at most 5 attachments"},
+		{name: "no filename", attachments: []types.ChatAttachment{{Filename: " ", Content: "a"}}, wantErr: "attachments[0]: filename is required"},
+		{name: "path", attachments: []types.ChatAttachment{{Filename: "templates/a.yaml"}}, wantErr: "must not contain a path"},
+		{name: "too large", attachments: []types.ChatAttachment{{Filename: "a.txt", Content: strings.Repeat("a", MaxChatAttachmentBytes+1)}}, wantErr: "a.txt is larger than"},
+		{name: "binary", attachments: []types.ChatAttachment{{Filename: "a.txt"}, {Filename: "a.png", Content: "\x89PNG\xff"}}, wantErr: "attachments[1]: file is not valid UTF-8: a.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChatAttachments(tt.attachments)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	assert.ErrorIs(t, ValidateChatAttachments([]types.ChatAttachment{{Filename: "a", Content: "\xff"}}), ErrInvalidEncoding)
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	assert.Equal(t, "text/csv", attachmentContentType(types.ChatAttachment{Filename: "a.yaml", ContentType: "text/csv"}))
+	assert.Equal(t, "application/yaml", attachmentContentType(types.ChatAttachment{Filename: "Values.YML"}))
+	assert.Equal(t, "text/plain", attachmentContentType(types.ChatAttachment{Filename: "Dockerfile"}))
+}
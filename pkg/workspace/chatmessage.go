@@ -93,7 +93,8 @@ func GetChatMessage(ctx context.Context, chatMessageId string) (*types.Chat, err
 		workspace_chat.response_conversion_id,
 		workspace_chat.response_rollback_to_revision_number,
 		workspace_chat.revision_number,
-		workspace_chat.message_from_persona
+		workspace_chat.message_from_persona,
+		workspace_chat.is_system_generated
 	FROM
 		workspace_chat
 	WHERE
@@ -133,6 +134,7 @@ func GetChatMessage(ctx context.Context, chatMessageId string) (*types.Chat, err
 		&responseRollbackToRevisionNumber,
 		&chat.RevisionNumber,
 		&messageFromPersona,
+		&chat.IsSystemGenerated,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan chat message in getChatMessage: %w", err)
@@ -174,7 +176,7 @@ func ListChatMessagesForWorkspace(ctx context.Context, workspaceID string) ([]ty
 
 	query := `SELECT
 id, prompt, response, created_at,
-is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic, is_intent_chart_developer, is_intent_chart_operator, is_intent_proceed, revision_number, message_from_persona
+is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic, is_intent_chart_developer, is_intent_chart_operator, is_intent_proceed, revision_number, message_from_persona, is_system_generated
 FROM workspace_chat
 WHERE workspace_id = $1
 ORDER BY created_at DESC`
@@ -195,7 +197,7 @@ ORDER BY created_at DESC`
 		var isIntentChartOperator sql.NullBool
 		var isIntentProceed sql.NullBool
 		var messageFromPersona sql.NullString
-		if err := rows.Scan(&chat.ID, &chat.Prompt, &response, &chat.CreatedAt, &chat.IsIntentComplete, &isIntentConversational, &isIntentPlan, &isIntentOffTopic, &isIntentChartDeveloper, &isIntentChartOperator, &isIntentProceed, &chat.RevisionNumber, &messageFromPersona); err != nil {
+		if err := rows.Scan(&chat.ID, &chat.Prompt, &response, &chat.CreatedAt, &chat.IsIntentComplete, &isIntentConversational, &isIntentPlan, &isIntentOffTopic, &isIntentChartDeveloper, &isIntentChartOperator, &isIntentProceed, &chat.RevisionNumber, &messageFromPersona, &chat.IsSystemGenerated); err != nil {
 			return nil, fmt.Errorf("failed to scan chat message in listChatMessagesForWorkspace: %w", err)
 		}
 
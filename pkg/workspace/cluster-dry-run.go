@@ -0,0 +1,84 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/clusterdryrun"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrRenderNotFound is returned for a render that doesn't exist or is of another workspace
+var ErrRenderNotFound = errors.New("render not found")
+
+// ClusterDryRunEnabled reports whether CHARTSMITH_CLUSTER_DRY_RUN allows validating renders
+// against a cluster
+func ClusterDryRunEnabled() bool {
+	return strings.EqualFold(strings.TrimSpace(param.Get().ClusterDryRun), "true")
+}
+
+// these are vars so that DryRunRender can be tested without a database or a cluster
+var (
+	getRendered              = GetRendered
+	validateAgainstCluster   = clusterdryrun.Validate
+	setRenderedClusterDryRun = SetRenderedChartClusterDryRun
+)
+
+// DryRunRender validates the manifests of each chart of a render that rendered successfully
+// against the cluster of the kubeconfig, and stores the results on the chart. The kubeconfig isn't
+// stored. Charts that failed to render are returned without results.
+func DryRunRender(ctx context.Context, workspaceID string, renderID string, kubeconfig string) ([]types.RenderedChart, error) {
+	rendered, err := getRendered(ctx, renderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRenderNotFound
+		}
+		return nil, fmt.Errorf("failed to get render: %w", err)
+	}
+	if rendered.WorkspaceID != workspaceID {
+		return nil, ErrRenderNotFound
+	}
+
+	// the timeout is for the cluster, the results are stored even when it doesn't answer, they say
+	// which documents weren't validated
+	dryRunCtx, cancel := context.WithTimeout(ctx, param.GetTimeouts().ClusterDryRun)
+	defer cancel()
+
+	charts := rendered.Charts
+	for i := range charts {
+		if !charts[i].IsSuccess {
+			continue
+		}
+
+		results, err := validateAgainstCluster(dryRunCtx, kubeconfig, charts[i].HelmTemplateStdout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dry run chart %s: %w", charts[i].ChartID, err)
+		}
+		charts[i].ClusterDryRun = results
+
+		if err := setRenderedClusterDryRun(ctx, charts[i].ID, results); err != nil {
+			return nil, err
+		}
+	}
+
+	return charts, nil
+}
+
+// SetRenderedChartClusterDryRun stores the results of a dry run of a rendered chart against a
+// cluster, replacing the results of an earlier one
+func SetRenderedChartClusterDryRun(ctx context.Context, renderedChartID string, results []types.ClusterDryRunResult) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered_chart SET cluster_dry_run = $2 WHERE id = $1`
+	if _, err := conn.Exec(ctx, query, renderedChartID, results); err != nil {
+		return fmt.Errorf("failed to set rendered chart cluster dry run: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunRender(t *testing.T) {
+	originalGet, originalValidate, originalSet := getRendered, validateAgainstCluster, setRenderedClusterDryRun
+	t.Cleanup(func() {
+		getRendered, validateAgainstCluster, setRenderedClusterDryRun = originalGet, originalValidate, originalSet
+	})
+
+	getRendered = func(ctx context.Context, id string) (*types.Rendered, error) {
+		if id == "missing" {
+			return nil, fmt.Errorf("failed to get rendered: %w", pgx.ErrNoRows)
+		}
+		return &types.Rendered{ID: id, WorkspaceID: "ws", Charts: []types.RenderedChart{
+			{ID: "rendered-a", IsSuccess: true, HelmTemplateStdout: "kind: ConfigMap\n"},
+			{ID: "rendered-b", IsSuccess: false, HelmTemplateStdout: "kind: Secret\n"},
+		}}, nil
+	}
+	validated := []string{}
+	validateAgainstCluster = func(ctx context.Context, kubeconfig string, manifests string) ([]types.ClusterDryRunResult, error) {
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		assert.Equal(t, "kubeconfig", kubeconfig)
+		validated = append(validated, manifests)
+		return []types.ClusterDryRunResult{{Kind: "ConfigMap", Status: types.ClusterDryRunAccepted}}, nil
+	}
+	stored := map[string][]types.ClusterDryRunResult{}
+	setRenderedClusterDryRun = func(ctx context.Context, renderedChartID string, results []types.ClusterDryRunResult) error {
+		stored[renderedChartID] = results
+		return nil
+	}
+
+	charts, err := DryRunRender(context.Background(), "ws", "render", "kubeconfig")
+	require.NoError(t, err)
+	require.Len(t, charts, 2)
+	assert.Equal(t, []string{"kind: ConfigMap\n"}, validated, "only successful renders are validated")
+	assert.Equal(t, types.ClusterDryRunAccepted, charts[0].ClusterDryRun[0].Status)
+	assert.Empty(t, charts[1].ClusterDryRun)
+	assert.Equal(t, map[string][]types.ClusterDryRunResult{"rendered-a": charts[0].ClusterDryRun}, stored)
+
+	_, err = DryRunRender(context.Background(), "other", "render", "kubeconfig")
+	assert.ErrorIs(t, err, ErrRenderNotFound)
+	_, err = DryRunRender(context.Background(), "ws", "missing", "kubeconfig")
+	assert.ErrorIs(t, err, ErrRenderNotFound)
+
+	setRenderedClusterDryRun = func(ctx context.Context, renderedChartID string, results []types.ClusterDryRunResult) error {
+		return errors.New("connection refused")
+	}
+	_, err = DryRunRender(context.Background(), "ws", "render", "kubeconfig")
+	assert.ErrorContains(t, err, "connection refused")
+}
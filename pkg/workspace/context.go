@@ -40,6 +40,10 @@ func ChooseRelevantFilesForChatMessage(
 	)
 
 	// Get embeddings for the prompt
+	provider, err := embedding.Configured()
+	if err != nil {
+		return nil, fmt.Errorf("error getting embedding provider: %w", err)
+	}
 	promptEmbeddings, err := embedding.Embeddings(expandedPrompt)
 	if err != nil {
 		return nil, fmt.Errorf("error getting embeddings for prompt: %w", err)
@@ -70,10 +74,10 @@ func ChooseRelevantFilesForChatMessage(
 	}
 
 	// get the values.yaml
-	query = `SELECT id, revision_number, chart_id, workspace_id, file_path, content FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 AND file_path = 'values.yaml'`
+	query = `SELECT id, revision_number, chart_id, workspace_id, file_path, content, content_pending FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 AND file_path = 'values.yaml'`
 	row = conn.QueryRow(ctx, query, w.ID, revisionNumber)
 	var valuesYAML types.File
-	err = row.Scan(&valuesYAML.ID, &valuesYAML.RevisionNumber, &valuesYAML.ChartID, &valuesYAML.WorkspaceID, &valuesYAML.FilePath, &valuesYAML.Content)
+	err = row.Scan(&valuesYAML.ID, &valuesYAML.RevisionNumber, &valuesYAML.ChartID, &valuesYAML.WorkspaceID, &valuesYAML.FilePath, &valuesYAML.Content, &valuesYAML.ContentPending)
 	if err != nil && err != pgx.ErrNoRows {
 		return nil, fmt.Errorf("error scanning values.yaml: %w", err)
 	} else if err == nil {
@@ -84,11 +88,111 @@ func ChooseRelevantFilesForChatMessage(
 			file:       valuesYAML,
 			similarity: 1.0,
 		}
+
+		// editing values.yaml means editing the templates that use the keys being changed, which
+		// are rarely similar to the prompt
+		templates, err := listTemplatesUsingValues(ctx, conn, valuesYAML, expandedPrompt)
+		if err != nil {
+			return nil, err
+		}
+		for _, template := range templates {
+			fileMap[template.ID] = struct {
+				file       types.File
+				similarity float64
+			}{
+				file:       template,
+				similarity: valuesReferenceSimilarity,
+			}
+		}
 	}
 
-	// Query files with embeddings and calculate cosine similarity
+	// template helpers are referenced by name from other templates, so they are rarely similar to
+	// the prompt, but any change to a template needs to know which helpers exist
+	query = `SELECT id, revision_number, chart_id, workspace_id, file_path, content FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number = $2 AND file_path LIKE '%.tpl' AND ($3::text IS NULL OR chart_id = $3)`
+	helperRows, err := conn.Query(ctx, query, w.ID, revisionNumber, filter.ChartID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying template helpers: %w", err)
+	}
+	for helperRows.Next() {
+		var helper types.File
+		var chartID sql.NullString
+		if err := helperRows.Scan(&helper.ID, &helper.RevisionNumber, &chartID, &helper.WorkspaceID, &helper.FilePath, &helper.Content); err != nil {
+			helperRows.Close()
+			return nil, fmt.Errorf("error scanning template helper: %w", err)
+		}
+		helper.ChartID = chartID.String
+
+		fileMap[helper.ID] = struct {
+			file       types.File
+			similarity float64
+		}{
+			file:       helper,
+			similarity: 1.0,
+		}
+	}
+	helperRows.Close()
+	if err := helperRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating template helpers: %w", err)
+	}
+
+	similarFiles, err := listSimilarFiles(ctx, conn, w.ID, revisionNumber, promptEmbeddings, provider.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	extensionsWithHighSimilarity := []string{".yaml", ".yml", ".tpl"}
+	for _, similarFile := range similarFiles {
+		file := similarFile.File
+		similarity := similarFile.Similarity
+
+		if !slices.Contains(extensionsWithHighSimilarity, filepath.Ext(file.FilePath)) {
+			similarity = similarity - 0.25
+		}
+
+		if file.FilePath == "Chart.yaml" || file.FilePath == "values.yaml" {
+			similarity = 1.0
+		}
+
+		if existing, ok := fileMap[file.ID]; ok && existing.similarity > similarity {
+			continue
+		}
+
+		fileMap[file.ID] = struct {
+			file       types.File
+			similarity float64
+		}{
+			file:       file,
+			similarity: similarity,
+		}
+	}
+
+	sorted := make([]RelevantFile, 0, len(fileMap))
+	for _, item := range fileMap {
+		sorted = append(sorted, RelevantFile{
+			File:       item.file,
+			Similarity: item.similarity,
+		})
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Similarity > sorted[j].Similarity
+	})
+
+	return sorted, nil
+}
+
+type similarFilesQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// listSimilarFiles returns the files of a revision by the cosine similarity of their embeddings to
+// the prompt's, most similar first. Only embeddings of the provider that embedded the prompt are
+// compared, vectors of other providers mean nothing next to it. Embeddings stored before the
+// provider was recorded are from embedding.LegacyProvider.
+func listSimilarFiles(ctx context.Context, db similarFilesQuerier, workspaceID string, revisionNumber int, promptEmbeddings string, provider string) ([]RelevantFile, error) {
 	// Note: Using pgvector's <=> operator for cosine distance
-	query = `
+	query := `
 		WITH similarities AS (
 			SELECT
 				id,
@@ -97,12 +201,12 @@ func ChooseRelevantFilesForChatMessage(
 				workspace_id,
 				file_path,
 				content,
-				embeddings,
 				1 - (embeddings <=> $1) as similarity
 			FROM workspace_file
 			WHERE workspace_id = $2
 			AND revision_number = $3
 			AND embeddings IS NOT NULL
+			AND COALESCE(embeddings_provider, $5) = $4
 		)
 		SELECT
 			id,
@@ -116,13 +220,13 @@ func ChooseRelevantFilesForChatMessage(
 		ORDER BY similarity DESC
 	`
 
-	rows, err := conn.Query(ctx, query, promptEmbeddings, w.ID, revisionNumber)
+	rows, err := db.Query(ctx, query, promptEmbeddings, workspaceID, revisionNumber, provider, embedding.LegacyProvider)
 	if err != nil {
 		return nil, fmt.Errorf("error querying relevant files: %w", err)
 	}
 	defer rows.Close()
 
-	extensionsWithHighSimilarity := []string{".yaml", ".yml", ".tpl"}
+	files := []RelevantFile{}
 	for rows.Next() {
 		var file types.File
 		var similarity float64
@@ -141,35 +245,11 @@ func ChooseRelevantFilesForChatMessage(
 		}
 
 		file.ChartID = chartID.String
-
-		if !slices.Contains(extensionsWithHighSimilarity, filepath.Ext(file.FilePath)) {
-			similarity = similarity - 0.25
-		}
-
-		if file.FilePath == "Chart.yaml" || file.FilePath == "values.yaml" {
-			similarity = 1.0
-		}
-
-		fileMap[file.ID] = struct {
-			file       types.File
-			similarity float64
-		}{
-			file:       file,
-			similarity: similarity,
-		}
+		files = append(files, RelevantFile{File: file, Similarity: similarity})
 	}
-
-	sorted := make([]RelevantFile, 0, len(fileMap))
-	for _, item := range fileMap {
-		sorted = append(sorted, RelevantFile{
-			File:       item.file,
-			Similarity: item.similarity,
-		})
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating relevant files: %w", err)
 	}
 
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].Similarity > sorted[j].Similarity
-	})
-
-	return sorted, nil
+	return files, nil
 }
@@ -0,0 +1,55 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// GetConversationMemory returns the summary of the older chat messages of a workspace, which is
+// empty until the chat history first outgrows the token budget
+func GetConversationMemory(ctx context.Context, workspaceID string) (*types.ConversationMemory, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT conversation_summary, conversation_summarized_through FROM workspace WHERE id = $1`
+
+	var summary sql.NullString
+	var summarizedThrough sql.NullTime
+	if err := conn.QueryRow(ctx, query, workspaceID).Scan(&summary, &summarizedThrough); err != nil {
+		return nil, fmt.Errorf("failed to get conversation memory: %w", err)
+	}
+
+	memory := &types.ConversationMemory{Summary: summary.String}
+	if summarizedThrough.Valid {
+		t := summarizedThrough.Time
+		memory.SummarizedThrough = &t
+	}
+	return memory, nil
+}
+
+// SetConversationMemory replaces the conversation memory of a workspace if it's still the memory
+// previous was read as. It returns false without writing when another plan or chat message updated
+// the memory first, the caller's summary would repeat or drop messages.
+func SetConversationMemory(ctx context.Context, workspaceID string, previous *types.ConversationMemory, memory *types.ConversationMemory) (bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var previousThrough *time.Time
+	if previous != nil {
+		previousThrough = previous.SummarizedThrough
+	}
+
+	query := `UPDATE workspace SET conversation_summary = $2, conversation_summarized_through = $3
+		WHERE id = $1 AND conversation_summarized_through IS NOT DISTINCT FROM $4`
+	tag, err := conn.Exec(ctx, query, workspaceID, memory.Summary, memory.SummarizedThrough, previousThrough)
+	if err != nil {
+		return false, fmt.Errorf("failed to set conversation memory: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
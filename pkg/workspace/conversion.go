@@ -5,30 +5,102 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
 )
 
 func GetConversion(ctx context.Context, id string) (*types.Conversion, error) {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
-	query := `SELECT id, workspace_id, chat_message_ids, created_at, status, chart_yaml, values_yaml FROM workspace_conversion WHERE id = $1`
+	query := `SELECT id, workspace_id, chat_message_ids, created_at, source_type, status, chart_yaml, values_yaml, log FROM workspace_conversion WHERE id = $1`
 
 	var c types.Conversion
 	var valuesYAML sql.NullString
 	var chartYAML sql.NullString
-	if err := conn.QueryRow(ctx, query, id).Scan(&c.ID, &c.WorkspaceID, &c.ChatMessageIDs, &c.CreatedAt, &c.Status, &chartYAML, &valuesYAML); err != nil {
+	var log sql.NullString
+	if err := conn.QueryRow(ctx, query, id).Scan(&c.ID, &c.WorkspaceID, &c.ChatMessageIDs, &c.CreatedAt, &c.SourceType, &c.Status, &chartYAML, &valuesYAML, &log); err != nil {
 		return nil, err
 	}
 
 	c.ValuesYAML = valuesYAML.String
 	c.ChartYAML = chartYAML.String
+	c.Log = log.String
 
 	return &c, nil
 }
 
+// AppendConversionLog adds lines to the log of a conversion
+func AppendConversionLog(ctx context.Context, id string, lines ...string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_conversion SET log = COALESCE(log, '') || $1 WHERE id = $2`
+	if _, err := conn.Exec(ctx, query, strings.Join(lines, "\n")+"\n", id); err != nil {
+		return fmt.Errorf("failed to append conversion log: %w", err)
+	}
+
+	return nil
+}
+
+// ReplaceConversionSourceFiles replaces the files of a conversion that haven't been converted
+// with sourceFiles, which are converted instead. convertedFiles are added to the chart as they are.
+func ReplaceConversionSourceFiles(ctx context.Context, conversionID string, sourceFiles map[string]string, convertedFiles map[string]string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM workspace_conversion_file WHERE conversion_id = $1 AND converted_files IS NULL`
+	if _, err := tx.Exec(ctx, query, conversionID); err != nil {
+		return fmt.Errorf("failed to delete conversion files: %w", err)
+	}
+
+	for filePath, content := range sourceFiles {
+		id, err := securerandom.Hex(12)
+		if err != nil {
+			return fmt.Errorf("failed to generate conversion file ID: %w", err)
+		}
+		query := `INSERT INTO workspace_conversion_file (id, conversion_id, file_path, file_content, file_status) VALUES ($1, $2, $3, $4, $5)`
+		if _, err := tx.Exec(ctx, query, id, conversionID, filePath, content, types.ConversionFileStatusPending); err != nil {
+			return fmt.Errorf("failed to insert conversion file %s: %w", filePath, err)
+		}
+	}
+
+	if len(convertedFiles) > 0 {
+		id, err := securerandom.Hex(12)
+		if err != nil {
+			return fmt.Errorf("failed to generate conversion file ID: %w", err)
+		}
+		marshalled, err := json.Marshal(convertedFiles)
+		if err != nil {
+			return fmt.Errorf("failed to marshal converted files: %w", err)
+		}
+		query := `INSERT INTO workspace_conversion_file (id, conversion_id, file_status, converted_files) VALUES ($1, $2, $3, $4)`
+		if _, err := tx.Exec(ctx, query, id, conversionID, types.ConversionFileStatusCompleted, string(marshalled)); err != nil {
+			return fmt.Errorf("failed to insert converted files: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 func SetConversionStatus(ctx context.Context, id string, status types.ConversionStatus) error {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
@@ -136,17 +208,10 @@ func AddDefaultFilesToConversion(ctx context.Context, conversionID string) error
 }
 
 func addChartYAMLToConversion(ctx context.Context, conversionID string) error {
-	content := `apiVersion: v2
-name: converted-chart
-description: Converted chart
-version: 0.0.0
-appVersion: "0.0.0"
-
-dependencies:
-- name: replicated
-  repository: oci://registry.replicated.com/library
-  version: 1.0.0-beta.32
-`
+	content, err := conversionChartYAML(ctx)
+	if err != nil {
+		return err
+	}
 
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
@@ -159,6 +224,29 @@ dependencies:
 	return nil
 }
 
+// conversionChartYAML returns the Chart.yaml of a converted chart, after the enabled
+// integrations have changed it
+func conversionChartYAML(ctx context.Context) (string, error) {
+	content := `apiVersion: v2
+name: converted-chart
+description: Converted chart
+version: 0.0.0
+appVersion: "0.0.0"
+`
+
+	files, err := integrations.MutateExport(ctx, nil, []types.File{{FilePath: "Chart.yaml", Content: content}})
+	if err != nil {
+		return "", fmt.Errorf("failed to apply integrations to Chart.yaml: %w", err)
+	}
+	for _, file := range files {
+		if file.FilePath == "Chart.yaml" {
+			return file.Content, nil
+		}
+	}
+
+	return content, nil
+}
+
 func addValuesYAMLToConversion(ctx context.Context, conversionID string) error {
 	content := `# Default values for converted-chart.
 
@@ -0,0 +1,30 @@
+package workspace
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
+	"github.com/replicatedhq/chartsmith/pkg/integrations/replicated"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversionChartYAML(t *testing.T) {
+	if !slices.Contains(integrations.Registered(), replicated.Name) {
+		integrations.Register(replicated.New())
+	}
+	t.Cleanup(func() { require.NoError(t, integrations.Enable(nil)) })
+
+	require.NoError(t, integrations.Enable([]string{replicated.Name}))
+	content, err := conversionChartYAML(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, content, replicated.SDKRepository)
+
+	require.NoError(t, integrations.Enable(nil))
+	content, err = conversionChartYAML(context.Background())
+	require.NoError(t, err)
+	assert.NotContains(t, content, "replicated")
+	assert.Contains(t, content, "name: converted-chart")
+}
@@ -0,0 +1,44 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/replicatedhq/chartsmith/pkg/recommendations"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// checkChartDependencies is a var so that dependency status can be tested without a network
+var checkChartDependencies = recommendations.CheckChartDependencies
+
+// GetChartDependencyStatus reports how far the dependencies in the Chart.yaml of a chart in the
+// current revision of a workspace are behind their latest versions. Pending content is checked.
+func GetChartDependencyStatus(ctx context.Context, workspaceID string, chartID string) (*recommendations.DependencyReport, error) {
+	w, err := GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			return ChartDependencyStatus(ctx, &w.Charts[i])
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in workspace %s", ErrChartNotFound, chartID, workspaceID)
+}
+
+// ChartDependencyStatus reports how far the dependencies of a chart are behind their latest
+// versions, a chart without a Chart.yaml has no dependencies
+func ChartDependencyStatus(ctx context.Context, c *types.Chart) (*recommendations.DependencyReport, error) {
+	for _, file := range c.Files {
+		if file.FilePath != "Chart.yaml" {
+			continue
+		}
+		content := file.Content
+		if file.ContentPending != nil {
+			content = *file.ContentPending
+		}
+		return checkChartDependencies(ctx, content)
+	}
+	return &recommendations.DependencyReport{Dependencies: []recommendations.DependencyStatus{}}, nil
+}
@@ -0,0 +1,313 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/diff"
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+const (
+	// duplicateEmbeddingSimilarity is the lowest cosine similarity of two files' embeddings for them
+	// to be reported as duplicates. Templates of different kinds share enough boilerplate to be
+	// close to 0.9.
+	duplicateEmbeddingSimilarity = 0.95
+	// duplicateContentSimilarity is the lowest share of normalized lines two files have in common
+	// for them to be reported as duplicates
+	duplicateContentSimilarity = 0.9
+	// minDuplicateLines is the fewest normalized lines a file needs to be compared, short files such
+	// as an empty values.yaml or a one line helper are alike without being duplicates
+	minDuplicateLines = 5
+)
+
+// queryDuplicateCandidates is a var so that duplicates can be found without a database
+var queryDuplicateCandidates = queryDuplicateCandidatesFromDB
+
+// duplicateCandidate is a file of a revision that can be reported as a duplicate
+type duplicateCandidate struct {
+	chartID string
+	path    string
+	// content is the pending content of the file when it has any
+	content string
+	// embedded is true when the file's embeddings are of its content and of the configured
+	// provider, the similarity of its pairs with other embedded files is in embeddingSimilarities
+	embedded bool
+}
+
+// embeddingSimilarity is the cosine similarity of the embeddings of two files of a chart
+type embeddingSimilarity struct {
+	chartID    string
+	path       string
+	otherPath  string
+	similarity float64
+}
+
+// FindDuplicateFiles returns the files of each chart of a revision that are suspected to be
+// duplicates of each other, such as a template that was copied and had a label changed. Files
+// are compared by their embeddings when both have them, and by their normalized content otherwise.
+// Files matched by the workspace's duplicate_exclusions setting aren't compared.
+func FindDuplicateFiles(ctx context.Context, workspaceID string, revisionNumber int) (*types.DuplicateReport, error) {
+	exclusions, err := GetSetting[[]string](ctx, workspaceID, SettingDuplicateExclusions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get duplicate exclusions: %w", err)
+	}
+
+	candidates, similarities, err := queryDuplicateCandidates(ctx, workspaceID, revisionNumber, duplicateEmbeddingSimilarity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files to compare: %w", err)
+	}
+
+	return findDuplicateFiles(candidates, similarities, exclusions), nil
+}
+
+// findDuplicateFiles pairs the candidates of each chart that are similar enough to be duplicates
+// and groups the pairs that share a file
+func findDuplicateFiles(candidates []duplicateCandidate, similarities []embeddingSimilarity, exclusions []string) *types.DuplicateReport {
+	type fileKey struct{ chartID, path string }
+
+	byChart := map[string][]duplicateCandidate{}
+	normalized := map[fileKey][]string{}
+	embedded := map[fileKey]bool{}
+	for _, candidate := range candidates {
+		if isDuplicateExcluded(candidate.path, exclusions) {
+			continue
+		}
+		lines := normalizeForDuplicates(candidate.content)
+		if len(lines) < minDuplicateLines {
+			continue
+		}
+		key := fileKey{candidate.chartID, candidate.path}
+		byChart[candidate.chartID] = append(byChart[candidate.chartID], candidate)
+		normalized[key] = lines
+		embedded[key] = candidate.embedded
+	}
+
+	pairs := []types.DuplicateFilePair{}
+	for _, s := range similarities {
+		a, b := fileKey{s.chartID, s.path}, fileKey{s.chartID, s.otherPath}
+		if !embedded[a] || !embedded[b] || s.similarity < duplicateEmbeddingSimilarity {
+			continue
+		}
+		pairs = append(pairs, newDuplicateFilePair(s.chartID, s.path, s.otherPath, s.similarity, types.DuplicateMethodEmbeddings))
+	}
+
+	for chartID, files := range byChart {
+		for i, a := range files {
+			for _, b := range files[i+1:] {
+				aKey, bKey := fileKey{chartID, a.path}, fileKey{chartID, b.path}
+				if embedded[aKey] && embedded[bKey] {
+					continue
+				}
+				aLines, bLines := normalized[aKey], normalized[bKey]
+				if diff.MaxSimilarity(len(aLines), len(bLines)) < duplicateContentSimilarity {
+					continue
+				}
+				similarity := diff.Similarity(strings.Join(aLines, "\n"), strings.Join(bLines, "\n"))
+				if similarity < duplicateContentSimilarity {
+					continue
+				}
+				pairs = append(pairs, newDuplicateFilePair(chartID, a.path, b.path, similarity, types.DuplicateMethodContent))
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Similarity != pairs[j].Similarity {
+			return pairs[i].Similarity > pairs[j].Similarity
+		}
+		if pairs[i].ChartID != pairs[j].ChartID {
+			return pairs[i].ChartID < pairs[j].ChartID
+		}
+		if pairs[i].FilePath != pairs[j].FilePath {
+			return pairs[i].FilePath < pairs[j].FilePath
+		}
+		return pairs[i].OtherFilePath < pairs[j].OtherFilePath
+	})
+
+	return &types.DuplicateReport{Pairs: pairs, Groups: groupDuplicatePairs(pairs)}
+}
+
+// newDuplicateFilePair orders the paths of a pair so that the same two files are always reported
+// the same way
+func newDuplicateFilePair(chartID string, filePath string, otherFilePath string, similarity float64, method types.DuplicateMethod) types.DuplicateFilePair {
+	if otherFilePath < filePath {
+		filePath, otherFilePath = otherFilePath, filePath
+	}
+	return types.DuplicateFilePair{
+		ChartID:       chartID,
+		FilePath:      filePath,
+		OtherFilePath: otherFilePath,
+		Similarity:    similarity,
+		Method:        method,
+	}
+}
+
+// groupDuplicatePairs joins pairs that share a file into groups, a group's similarity is the
+// lowest of its pairs
+func groupDuplicatePairs(pairs []types.DuplicateFilePair) []types.DuplicateFileGroup {
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(key string) string {
+		if parent[key] == key {
+			return key
+		}
+		parent[key] = find(parent[key])
+		return parent[key]
+	}
+	fileKey := func(chartID string, filePath string) string {
+		return chartID + "\x00" + filePath
+	}
+
+	for _, pair := range pairs {
+		for _, key := range []string{fileKey(pair.ChartID, pair.FilePath), fileKey(pair.ChartID, pair.OtherFilePath)} {
+			if _, ok := parent[key]; !ok {
+				parent[key] = key
+			}
+		}
+		parent[find(fileKey(pair.ChartID, pair.FilePath))] = find(fileKey(pair.ChartID, pair.OtherFilePath))
+	}
+
+	groups := map[string]*types.DuplicateFileGroup{}
+	for _, pair := range pairs {
+		root := find(fileKey(pair.ChartID, pair.FilePath))
+		group, ok := groups[root]
+		if !ok {
+			group = &types.DuplicateFileGroup{ChartID: pair.ChartID, Similarity: pair.Similarity}
+			groups[root] = group
+		}
+		if pair.Similarity < group.Similarity {
+			group.Similarity = pair.Similarity
+		}
+		for _, filePath := range []string{pair.FilePath, pair.OtherFilePath} {
+			found := false
+			for _, existing := range group.FilePaths {
+				found = found || existing == filePath
+			}
+			if !found {
+				group.FilePaths = append(group.FilePaths, filePath)
+			}
+		}
+	}
+
+	sorted := make([]types.DuplicateFileGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.FilePaths)
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Similarity != sorted[j].Similarity {
+			return sorted[i].Similarity > sorted[j].Similarity
+		}
+		if sorted[i].ChartID != sorted[j].ChartID {
+			return sorted[i].ChartID < sorted[j].ChartID
+		}
+		return sorted[i].FilePaths[0] < sorted[j].FilePaths[0]
+	})
+	return sorted
+}
+
+// normalizeForDuplicates trims the lines of content and drops blank lines and YAML comments, so
+// that files that differ only in indentation or comments are compared as the same
+func normalizeForDuplicates(content string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// isDuplicateExcluded is true when filePath is matched by one of exclusions. An exclusion that
+// ends with a slash matches the files under that directory, any other is a path.Match pattern.
+func isDuplicateExcluded(filePath string, exclusions []string) bool {
+	for _, exclusion := range exclusions {
+		if strings.HasSuffix(exclusion, "/") {
+			if strings.HasPrefix(filePath, exclusion) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(exclusion, filePath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func queryDuplicateCandidatesFromDB(ctx context.Context, workspaceID string, revisionNumber int, minSimilarity float64) ([]duplicateCandidate, []embeddingSimilarity, error) {
+	provider, err := embedding.Configured()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get embedding provider: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	// pending content isn't embedded yet, the embeddings of a file with pending content are of
+	// the content it had before
+	query := `SELECT chart_id, file_path, COALESCE(content_pending, content),
+			embeddings IS NOT NULL AND content_pending IS NULL AND COALESCE(embeddings_provider, $4) = $3
+		FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number = $2 AND chart_id IS NOT NULL`
+	rows, err := conn.Query(ctx, query, workspaceID, revisionNumber, provider.Name(), embedding.LegacyProvider)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying files: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := []duplicateCandidate{}
+	for rows.Next() {
+		var candidate duplicateCandidate
+		if err := rows.Scan(&candidate.chartID, &candidate.path, &candidate.content, &candidate.embedded); err != nil {
+			return nil, nil, fmt.Errorf("error scanning file: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating files: %w", err)
+	}
+	rows.Close()
+
+	// Note: Using pgvector's <=> operator for cosine distance
+	query = `SELECT a.chart_id, a.file_path, b.file_path, 1 - (a.embeddings <=> b.embeddings) AS similarity
+		FROM workspace_file a
+		JOIN workspace_file b ON b.workspace_id = a.workspace_id AND b.revision_number = a.revision_number
+			AND b.chart_id = a.chart_id AND b.file_path > a.file_path
+			AND b.embeddings_dimensions IS NOT DISTINCT FROM a.embeddings_dimensions
+		WHERE a.workspace_id = $1 AND a.revision_number = $2
+			AND a.embeddings IS NOT NULL AND b.embeddings IS NOT NULL
+			AND a.content_pending IS NULL AND b.content_pending IS NULL
+			AND COALESCE(a.embeddings_provider, $5) = $4 AND COALESCE(b.embeddings_provider, $5) = $4
+			AND 1 - (a.embeddings <=> b.embeddings) >= $3`
+	rows, err = conn.Query(ctx, query, workspaceID, revisionNumber, minSimilarity, provider.Name(), embedding.LegacyProvider)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying embedding similarities: %w", err)
+	}
+	defer rows.Close()
+
+	similarities := []embeddingSimilarity{}
+	for rows.Next() {
+		var s embeddingSimilarity
+		var chartID sql.NullString
+		if err := rows.Scan(&chartID, &s.path, &s.otherPath, &s.similarity); err != nil {
+			return nil, nil, fmt.Errorf("error scanning embedding similarity: %w", err)
+		}
+		s.chartID = chartID.String
+		similarities = append(similarities, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating embedding similarities: %w", err)
+	}
+
+	return candidates, similarities, nil
+}
@@ -0,0 +1,174 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDuplicateFiles(t *testing.T) {
+	fixture := func(name string) string {
+		content, err := os.ReadFile(filepath.Join("testdata", "duplicates", name))
+		require.NoError(t, err)
+		return string(content)
+	}
+	api, worker, service := fixture("api-deployment.yaml"), fixture("worker-deployment.yaml"), fixture("service.yaml")
+
+	tests := []struct {
+		name         string
+		candidates   []duplicateCandidate
+		similarities []embeddingSimilarity
+		settings     map[string]string
+		wantPairs    []string
+		wantGroups   [][]string
+		wantMethod   types.DuplicateMethod
+	}{
+		{
+			name: "copied template",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api},
+				{chartID: "app", path: "templates/worker-deployment.yaml", content: worker},
+				{chartID: "app", path: "templates/service.yaml", content: service},
+			},
+			wantPairs:  []string{"templates/api-deployment.yaml templates/worker-deployment.yaml"},
+			wantGroups: [][]string{{"templates/api-deployment.yaml", "templates/worker-deployment.yaml"}},
+			wantMethod: types.DuplicateMethodContent,
+		},
+		{
+			name: "excluded by the setting",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api},
+				{chartID: "app", path: "templates/worker-deployment.yaml", content: worker},
+			},
+			settings: map[string]string{SettingDuplicateExclusions: `["templates/worker-*.yaml"]`},
+		},
+		{
+			name: "tests are excluded by default",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api},
+				{chartID: "app", path: "templates/tests/api-deployment.yaml", content: api},
+				{chartID: "app", path: "crds/api-deployment.yaml", content: api},
+			},
+		},
+		{
+			name: "files of other charts",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api},
+				{chartID: "other", path: "templates/worker-deployment.yaml", content: worker},
+			},
+		},
+		{
+			name: "embeddings",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api, embedded: true},
+				{chartID: "app", path: "templates/worker-deployment.yaml", content: worker, embedded: true},
+				{chartID: "app", path: "templates/service.yaml", content: service, embedded: true},
+			},
+			similarities: []embeddingSimilarity{
+				{chartID: "app", path: "templates/worker-deployment.yaml", otherPath: "templates/api-deployment.yaml", similarity: 0.97},
+				{chartID: "app", path: "templates/service.yaml", otherPath: "templates/api-deployment.yaml", similarity: 0.91},
+			},
+			wantPairs:  []string{"templates/api-deployment.yaml templates/worker-deployment.yaml"},
+			wantGroups: [][]string{{"templates/api-deployment.yaml", "templates/worker-deployment.yaml"}},
+			wantMethod: types.DuplicateMethodEmbeddings,
+		},
+		{
+			name: "embeddings that aren't similar enough",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api, embedded: true},
+				{chartID: "app", path: "templates/worker-deployment.yaml", content: worker, embedded: true},
+			},
+		},
+		{
+			name: "a file without embeddings",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api, embedded: true},
+				{chartID: "app", path: "templates/worker-deployment.yaml", content: worker},
+			},
+			wantPairs:  []string{"templates/api-deployment.yaml templates/worker-deployment.yaml"},
+			wantGroups: [][]string{{"templates/api-deployment.yaml", "templates/worker-deployment.yaml"}},
+			wantMethod: types.DuplicateMethodContent,
+		},
+		{
+			name: "pairs that share a file are one group",
+			candidates: []duplicateCandidate{
+				{chartID: "app", path: "templates/api-deployment.yaml", content: api},
+				{chartID: "app", path: "templates/worker-deployment.yaml", content: worker},
+				{chartID: "app", path: "templates/copy-deployment.yaml", content: api},
+			},
+			wantPairs: []string{
+				"templates/api-deployment.yaml templates/copy-deployment.yaml",
+				"templates/api-deployment.yaml templates/worker-deployment.yaml",
+				"templates/copy-deployment.yaml templates/worker-deployment.yaml",
+			},
+			wantGroups: [][]string{{"templates/api-deployment.yaml", "templates/copy-deployment.yaml", "templates/worker-deployment.yaml"}},
+			wantMethod: types.DuplicateMethodContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalSettings, originalCandidates := querySettings, queryDuplicateCandidates
+			t.Cleanup(func() {
+				querySettings, queryDuplicateCandidates = originalSettings, originalCandidates
+				InvalidateSettings("ws")
+			})
+			InvalidateSettings("ws")
+
+			querySettings = func(ctx context.Context, workspaceID string) (map[string]json.RawMessage, error) {
+				values := map[string]json.RawMessage{}
+				for key, value := range tt.settings {
+					values[key] = json.RawMessage(value)
+				}
+				return values, nil
+			}
+			queryDuplicateCandidates = func(ctx context.Context, workspaceID string, revisionNumber int, minSimilarity float64) ([]duplicateCandidate, []embeddingSimilarity, error) {
+				return tt.candidates, tt.similarities, nil
+			}
+
+			report, err := FindDuplicateFiles(context.Background(), "ws", 1)
+			require.NoError(t, err)
+
+			pairs := []string{}
+			for _, pair := range report.Pairs {
+				pairs = append(pairs, pair.FilePath+" "+pair.OtherFilePath)
+				assert.Equal(t, tt.wantMethod, pair.Method)
+				assert.Equal(t, "app", pair.ChartID)
+			}
+			assert.ElementsMatch(t, tt.wantPairs, pairs)
+
+			groups := [][]string{}
+			for _, group := range report.Groups {
+				groups = append(groups, group.FilePaths)
+			}
+			assert.Equal(t, len(tt.wantGroups), len(groups))
+			if len(tt.wantGroups) > 0 {
+				assert.Equal(t, tt.wantGroups, groups)
+			}
+		})
+	}
+}
+
+func TestFindDuplicateFilesSimilarity(t *testing.T) {
+	api, err := os.ReadFile(filepath.Join("testdata", "duplicates", "api-deployment.yaml"))
+	require.NoError(t, err)
+	worker, err := os.ReadFile(filepath.Join("testdata", "duplicates", "worker-deployment.yaml"))
+	require.NoError(t, err)
+
+	report := findDuplicateFiles([]duplicateCandidate{
+		{chartID: "app", path: "templates/worker-deployment.yaml", content: string(worker)},
+		{chartID: "app", path: "templates/api-deployment.yaml", content: string(api)},
+	}, nil, nil)
+
+	require.Len(t, report.Pairs, 1)
+	// the worker's comment is dropped, 42 of the 44 lines of each are the same
+	assert.InDelta(t, 0.95, report.Pairs[0].Similarity, 0.01)
+	assert.Equal(t, "templates/api-deployment.yaml", report.Pairs[0].FilePath)
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, report.Pairs[0].Similarity, report.Groups[0].Similarity)
+}
@@ -0,0 +1,130 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+)
+
+// ExecutionLockStaleAfter is how long a workspace's execution lock is held before another plan can
+// take it. A worker that stops while executing a plan never releases its lock, this keeps the
+// workspace from being locked forever. It's longer than the apply_plan handler's timeout.
+const ExecutionLockStaleAfter = 30 * time.Minute
+
+// executionLockRetryAfter is how long a queue message refused by another plan's lock is held
+// before it's handled again
+const executionLockRetryAfter = 30 * time.Second
+
+// ErrPlanExecuting is returned when a plan is executed while another plan of the workspace is
+// executing
+var ErrPlanExecuting = errors.New("another plan is executing")
+
+// ExecutionLockedError is returned for a plan refused by the execution lock of its workspace. It
+// wraps ErrPlanExecuting.
+type ExecutionLockedError struct {
+	WorkspaceID string
+	// PlanID is the plan that holds the lock
+	PlanID     string
+	AcquiredAt time.Time
+}
+
+func (e *ExecutionLockedError) Error() string {
+	return fmt.Sprintf("%s: plan %s is executing in workspace %s", ErrPlanExecuting, e.PlanID, e.WorkspaceID)
+}
+
+func (e *ExecutionLockedError) Unwrap() error {
+	return ErrPlanExecuting
+}
+
+// RetryAfter is how long until the refused plan is tried again, so that the listener holds its
+// message instead of failing it
+func (e *ExecutionLockedError) RetryAfter() time.Duration {
+	return executionLockRetryAfter
+}
+
+// AcquireExecutionLock locks a workspace for the execution of a plan. It returns an
+// *ExecutionLockedError when another plan holds the lock and it isn't stale. Acquiring the lock a
+// plan already holds succeeds and restarts its staleness.
+func AcquireExecutionLock(ctx context.Context, workspaceID string, planID string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return acquireExecutionLock(ctx, conn, workspaceID, planID, ExecutionLockStaleAfter)
+}
+
+// ReleaseExecutionLock releases the execution lock of a workspace if the plan holds it
+func ReleaseExecutionLock(ctx context.Context, workspaceID string, planID string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return releaseExecutionLock(ctx, conn, workspaceID, planID)
+}
+
+// CheckPlanExecutionLock returns an *ExecutionLockedError when another plan of the plan's
+// workspace holds its execution lock, without acquiring it
+func CheckPlanExecutionLock(ctx context.Context, planID string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return checkPlanExecutionLock(ctx, conn, planID, ExecutionLockStaleAfter)
+}
+
+func acquireExecutionLock(ctx context.Context, q revisionQuerier, workspaceID string, planID string, staleAfter time.Duration) error {
+	query := `INSERT INTO workspace_execution_lock (workspace_id, plan_id, acquired_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (workspace_id) DO UPDATE SET plan_id = EXCLUDED.plan_id, acquired_at = now()
+		WHERE workspace_execution_lock.plan_id = EXCLUDED.plan_id
+			OR workspace_execution_lock.acquired_at < now() - make_interval(secs => $3)
+		RETURNING plan_id`
+
+	// the lock can be released between the insert and reading who holds it, so it's tried twice
+	for attempt := 0; attempt < 2; attempt++ {
+		var holder string
+		err := q.QueryRow(ctx, query, workspaceID, planID, staleAfter.Seconds()).Scan(&holder)
+		if err == nil {
+			return nil
+		}
+		if err != pgx.ErrNoRows {
+			return fmt.Errorf("failed to acquire execution lock: %w", err)
+		}
+
+		lockedErr := &ExecutionLockedError{WorkspaceID: workspaceID}
+		err = q.QueryRow(ctx, `SELECT plan_id, acquired_at FROM workspace_execution_lock WHERE workspace_id = $1`, workspaceID).Scan(&lockedErr.PlanID, &lockedErr.AcquiredAt)
+		if err == nil {
+			return lockedErr
+		}
+		if err != pgx.ErrNoRows {
+			return fmt.Errorf("failed to get execution lock: %w", err)
+		}
+	}
+
+	return errors.New("failed to acquire execution lock: it changed hands while acquiring it")
+}
+
+func releaseExecutionLock(ctx context.Context, q revisionQuerier, workspaceID string, planID string) error {
+	if _, err := q.Exec(ctx, `DELETE FROM workspace_execution_lock WHERE workspace_id = $1 AND plan_id = $2`, workspaceID, planID); err != nil {
+		return fmt.Errorf("failed to release execution lock: %w", err)
+	}
+	return nil
+}
+
+func checkPlanExecutionLock(ctx context.Context, q revisionQuerier, planID string, staleAfter time.Duration) error {
+	query := `SELECT l.workspace_id, l.plan_id, l.acquired_at
+		FROM workspace_plan p
+		JOIN workspace_execution_lock l ON l.workspace_id = p.workspace_id
+		WHERE p.id = $1 AND l.plan_id <> p.id AND l.acquired_at >= now() - make_interval(secs => $2)`
+
+	lockedErr := &ExecutionLockedError{}
+	err := q.QueryRow(ctx, query, planID, staleAfter.Seconds()).Scan(&lockedErr.WorkspaceID, &lockedErr.PlanID, &lockedErr.AcquiredAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("failed to check execution lock: %w", err)
+	}
+	return lockedErr
+}
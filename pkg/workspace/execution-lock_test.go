@@ -0,0 +1,116 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutionLockedError(t *testing.T) {
+	var err error = &ExecutionLockedError{WorkspaceID: "ws", PlanID: "plan-a"}
+
+	assert.ErrorIs(t, err, ErrPlanExecuting)
+	assert.Contains(t, err.Error(), "plan-a")
+
+	var retry interface{ RetryAfter() time.Duration }
+	require.True(t, errors.As(err, &retry), "a refused plan is held, not failed")
+	assert.Equal(t, executionLockRetryAfter, retry.RetryAfter())
+}
+
+// TestExecutionLock acquires, refuses, expires and releases the execution lock of a workspace. It
+// runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestExecutionLock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping execution lock integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "lock-" + time.Now().Format("150405.000000")
+	planA, planB := workspaceID+"-a", workspaceID+"-b"
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_execution_lock WHERE workspace_id = $1`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace_plan WHERE workspace_id = $1`, workspaceID)
+	})
+	for _, planID := range []string{planA, planB} {
+		_, err := conn.Exec(ctx, `INSERT INTO workspace_plan (id, workspace_id, chat_message_ids, created_at, updated_at, version, status)
+			VALUES ($1, $2, '{}', now(), now(), 1, 'review')`, planID, workspaceID)
+		require.NoError(t, err)
+	}
+
+	t.Run("acquire", func(t *testing.T) {
+		require.NoError(t, acquireExecutionLock(ctx, conn, workspaceID, planA, time.Hour))
+		// the plan that holds the lock can acquire it again, apply_plan does after execute_plan
+		require.NoError(t, acquireExecutionLock(ctx, conn, workspaceID, planA, time.Hour))
+		assert.NoError(t, checkPlanExecutionLock(ctx, conn, planA, time.Hour))
+	})
+
+	t.Run("refuse", func(t *testing.T) {
+		err := acquireExecutionLock(ctx, conn, workspaceID, planB, time.Hour)
+		var lockedErr *ExecutionLockedError
+		require.ErrorAs(t, err, &lockedErr)
+		assert.Equal(t, planA, lockedErr.PlanID)
+		assert.Equal(t, workspaceID, lockedErr.WorkspaceID)
+
+		err = checkPlanExecutionLock(ctx, conn, planB, time.Hour)
+		require.ErrorAs(t, err, &lockedErr)
+		assert.Equal(t, planA, lockedErr.PlanID)
+
+		// releasing a lock the plan doesn't hold leaves it
+		require.NoError(t, releaseExecutionLock(ctx, conn, workspaceID, planB))
+		assert.ErrorIs(t, checkPlanExecutionLock(ctx, conn, planB, time.Hour), ErrPlanExecuting)
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		_, err := conn.Exec(ctx, `UPDATE workspace_execution_lock SET acquired_at = now() - interval '2 hours' WHERE workspace_id = $1`, workspaceID)
+		require.NoError(t, err)
+
+		assert.NoError(t, checkPlanExecutionLock(ctx, conn, planB, time.Hour), "a stale lock doesn't refuse")
+		require.NoError(t, acquireExecutionLock(ctx, conn, workspaceID, planB, time.Hour))
+		assert.ErrorIs(t, acquireExecutionLock(ctx, conn, workspaceID, planA, time.Hour), ErrPlanExecuting)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		require.NoError(t, releaseExecutionLock(ctx, conn, workspaceID, planB))
+		assert.NoError(t, checkPlanExecutionLock(ctx, conn, planA, time.Hour))
+		require.NoError(t, acquireExecutionLock(ctx, conn, workspaceID, planA, time.Hour))
+	})
+
+	t.Run("proceed refused", func(t *testing.T) {
+		t.Cleanup(func() {
+			conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = $1`, workspaceID)
+		})
+		_, err := conn.Exec(ctx, `INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number)
+			VALUES ($1, now(), 'lock', 'user', 'test', 1)`, workspaceID)
+		require.NoError(t, err)
+
+		_, err = CreatePlanRevision(ctx, planB, "user")
+		var lockedErr *ExecutionLockedError
+		require.ErrorAs(t, err, &lockedErr)
+		assert.Equal(t, planA, lockedErr.PlanID)
+
+		// nothing is created, the plan isn't proceeded and the workspace stays on its revision
+		var currentRevision int
+		var proceeded bool
+		require.NoError(t, conn.QueryRow(ctx, `SELECT current_revision_number FROM workspace WHERE id = $1`, workspaceID).Scan(&currentRevision))
+		require.NoError(t, conn.QueryRow(ctx, `SELECT proceed_at IS NOT NULL FROM workspace_plan WHERE id = $1`, planB).Scan(&proceeded))
+		assert.Equal(t, 1, currentRevision)
+		assert.False(t, proceeded)
+	})
+}
@@ -0,0 +1,196 @@
+package workspace
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/helmignore"
+	"github.com/replicatedhq/chartsmith/pkg/integrations"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/provenance"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
+)
+
+// exportSigning is a var so that tests can sign with a throwaway key
+var exportSigning = provenance.ConfigFromParams
+
+// archiveModTime is the modification time of every file in an exported archive, so that exporting
+// the same files twice produces the same archive and the same digest
+var archiveModTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ChartArchive is a chart packaged the way helm package does, with its provenance when exports
+// are signed
+type ChartArchive struct {
+	// Filename is <name>-<version>.tgz
+	Filename  string
+	Content   []byte
+	Signature *provenance.Signature
+}
+
+// ExportWorkspaceChart packages a chart in the current revision of a workspace. With
+// restoreLineEndings, files are exported with the line endings they were written with.
+func ExportWorkspaceChart(ctx context.Context, workspaceID string, chartID string, restoreLineEndings bool) (*ChartArchive, error) {
+	w, err := GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	for i := range w.Charts {
+		if w.Charts[i].ID != chartID {
+			continue
+		}
+		chart := w.Charts[i]
+		if restoreLineEndings {
+			chart.Files = make([]types.File, 0, len(w.Charts[i].Files))
+			for _, file := range w.Charts[i].Files {
+				file.Content = RestoreLineEnding(file.Content, file.LineEnding)
+				chart.Files = append(chart.Files, file)
+			}
+		}
+		return ExportChartArchive(ctx, w, &chart)
+	}
+	return nil, fmt.Errorf("%w: %s in workspace %s", ErrChartNotFound, chartID, workspaceID)
+}
+
+// ExportChartArchive packages the files of a chart as they leave chartsmith, after the active
+// integrations have changed them. When signing is configured the archive is signed too. When
+// signing is requested but misconfigured, the archive is exported unsigned.
+func ExportChartArchive(ctx context.Context, w *types.Workspace, chart *types.Chart) (*ChartArchive, error) {
+	files, err := integrations.MutateExport(ctx, w, chart.Files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply integrations to chart: %w", err)
+	}
+
+	files, err = helmignore.FilterFiles(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply .helmignore: %w", err)
+	}
+
+	var chartYAML []byte
+	for _, file := range files {
+		if file.FilePath == "Chart.yaml" {
+			chartYAML = []byte(file.Content)
+		}
+	}
+	if chartYAML == nil {
+		return nil, fmt.Errorf("chart %s has no Chart.yaml", chart.Name)
+	}
+
+	name, version, err := chartNameAndVersion(chartYAML)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = chart.Name
+	}
+
+	content, err := packageChart(name, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to package chart: %w", err)
+	}
+
+	archive := &ChartArchive{
+		Filename: fmt.Sprintf("%s-%s.tgz", name, version),
+		Content:  content,
+	}
+
+	signing := exportSigning()
+	if warnings := signing.Warnings(); len(warnings) > 0 {
+		logger.Warn("exporting unsigned chart archive", zap.String("chart", name), zap.Strings("warnings", warnings))
+		return archive, nil
+	}
+
+	signature, err := signing.Sign(archive.Filename, archive.Content, chartYAML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign chart archive: %w", err)
+	}
+	archive.Signature = signature
+
+	return archive, nil
+}
+
+// Zip returns a zip containing the archive and its signature, if it's signed
+func (a *ChartArchive) Zip() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	entries := []provenance.Signature{{Filename: a.Filename, Content: a.Content}}
+	if a.Signature != nil {
+		entries = append(entries, *a.Signature)
+	}
+	for _, entry := range entries {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.Filename, Method: zip.Deflate, Modified: archiveModTime})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to zip: %w", entry.Filename, err)
+		}
+		if _, err := f.Write(entry.Content); err != nil {
+			return nil, fmt.Errorf("failed to write %s to zip: %w", entry.Filename, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// chartNameAndVersion reads the name and version of a chart from its Chart.yaml
+func chartNameAndVersion(chartYAML []byte) (string, string, error) {
+	manifest, err := ParseChartManifest(string(chartYAML))
+	if err != nil {
+		return "", "", err
+	}
+	if manifest.Version == "" {
+		manifest.Version = "0.1.0"
+	}
+	return manifest.Name, manifest.Version, nil
+}
+
+// packageChart writes the files into a gzipped tar under a directory named after the chart, which
+// is the layout helm package produces
+func packageChart(name string, files []types.File) ([]byte, error) {
+	sorted := append([]types.File{}, files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FilePath < sorted[j].FilePath })
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, file := range sorted {
+		filePath := path.Clean(strings.TrimPrefix(file.FilePath, "/"))
+		if filePath == "." || strings.HasPrefix(filePath, "../") {
+			return nil, fmt.Errorf("invalid file path %q", file.FilePath)
+		}
+
+		header := &tar.Header{
+			Name:     path.Join(name, filePath),
+			Mode:     0644,
+			Size:     int64(len(file.Content)),
+			ModTime:  archiveModTime,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write header for %s: %w", file.FilePath, err)
+		}
+		if _, err := tw.Write([]byte(file.Content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.FilePath, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tar: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close gzip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
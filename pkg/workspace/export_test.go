@@ -0,0 +1,170 @@
+package workspace
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/provenance"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func exportTestChart() *types.Chart {
+	return &types.Chart{
+		ID:   "chart-1",
+		Name: "nginx",
+		Files: []types.File{
+			{FilePath: "values.yaml", Content: "replicaCount: 1\n"},
+			{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: nginx\nversion: 1.2.3\n"},
+			{FilePath: "templates/deployment.yaml", Content: "kind: Deployment\n"},
+			{FilePath: ".helmignore", Content: "*.md\n"},
+			{FilePath: "NOTES.md", Content: "ignored\n"},
+		},
+	}
+}
+
+// untar returns the files in a gzipped tar by name
+func untar(t *testing.T, content []byte) map[string]string {
+	t.Helper()
+
+	gr, err := gzip.NewReader(bytes.NewReader(content))
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(data)
+	}
+	return files
+}
+
+// stubExportSigning signs exports with a throwaway pgp key and returns its public keyring
+func stubExportSigning(t *testing.T) []byte {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("Chartsmith Test", "", "test@example.com", &packet.Config{RSABits: 2048})
+	require.NoError(t, err)
+
+	var secret bytes.Buffer
+	w, err := armor.Encode(&secret, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.SerializePrivate(w, nil))
+	require.NoError(t, w.Close())
+
+	var public bytes.Buffer
+	w, err = armor.Encode(&public, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	keyringPath := filepath.Join(t.TempDir(), "secring.asc")
+	require.NoError(t, os.WriteFile(keyringPath, secret.Bytes(), 0600))
+
+	original := exportSigning
+	exportSigning = func() provenance.Config {
+		return provenance.Config{Method: provenance.MethodPGP, PGPKeyring: keyringPath}
+	}
+	t.Cleanup(func() { exportSigning = original })
+
+	return public.Bytes()
+}
+
+func TestPackageChart(t *testing.T) {
+	files := []types.File{
+		{FilePath: "templates/service.yaml", Content: "kind: Service\n"},
+		{FilePath: "Chart.yaml", Content: "name: nginx\n"},
+	}
+
+	content, err := packageChart("nginx", files)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"nginx/Chart.yaml":             "name: nginx\n",
+		"nginx/templates/service.yaml": "kind: Service\n",
+	}, untar(t, content))
+
+	reordered, err := packageChart("nginx", []types.File{files[1], files[0]})
+	require.NoError(t, err)
+	assert.Equal(t, content, reordered, "packaging the same files produces the same archive")
+
+	_, err = packageChart("nginx", []types.File{{FilePath: "../escape.yaml"}})
+	assert.ErrorContains(t, err, "invalid file path")
+}
+
+func TestExportChartArchiveUnsigned(t *testing.T) {
+	original := exportSigning
+	exportSigning = func() provenance.Config { return provenance.Config{} }
+	t.Cleanup(func() { exportSigning = original })
+
+	archive, err := ExportChartArchive(context.Background(), &types.Workspace{ID: "ws"}, exportTestChart())
+	require.NoError(t, err)
+	assert.Equal(t, "nginx-1.2.3.tgz", archive.Filename)
+	assert.Nil(t, archive.Signature)
+
+	files := untar(t, archive.Content)
+	assert.Contains(t, files, "nginx/Chart.yaml")
+	assert.Contains(t, files, "nginx/templates/deployment.yaml")
+	assert.NotContains(t, files, "nginx/NOTES.md", ".helmignore is applied")
+}
+
+func TestExportChartArchiveSigned(t *testing.T) {
+	public := stubExportSigning(t)
+
+	archive, err := ExportChartArchive(context.Background(), &types.Workspace{ID: "ws"}, exportTestChart())
+	require.NoError(t, err)
+	require.NotNil(t, archive.Signature)
+	assert.Equal(t, "nginx-1.2.3.tgz.prov", archive.Signature.Filename)
+	require.NoError(t, provenance.VerifyPGP(bytes.NewReader(public), archive.Signature.Content, archive.Filename, archive.Content))
+
+	bundle, err := archive.Zip()
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	require.NoError(t, err)
+
+	entries := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		entries[f.Name] = data
+	}
+	assert.Equal(t, archive.Content, entries["nginx-1.2.3.tgz"])
+	assert.Equal(t, archive.Signature.Content, entries["nginx-1.2.3.tgz.prov"])
+}
+
+func TestExportChartArchiveMissingKey(t *testing.T) {
+	original := exportSigning
+	exportSigning = func() provenance.Config {
+		return provenance.Config{Method: provenance.MethodPGP, PGPKeyring: filepath.Join(t.TempDir(), "missing.asc")}
+	}
+	t.Cleanup(func() { exportSigning = original })
+
+	archive, err := ExportChartArchive(context.Background(), &types.Workspace{ID: "ws"}, exportTestChart())
+	require.NoError(t, err)
+	assert.Nil(t, archive.Signature, "a misconfigured key exports unsigned rather than failing")
+}
+
+func TestExportChartArchiveRequiresChartYAML(t *testing.T) {
+	chart := &types.Chart{Name: "nginx", Files: []types.File{{FilePath: "values.yaml", Content: "a: 1\n"}}}
+	_, err := ExportChartArchive(context.Background(), &types.Workspace{ID: "ws"}, chart)
+	assert.ErrorContains(t, err, "has no Chart.yaml")
+}
@@ -0,0 +1,178 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/replicatedhq/chartsmith/pkg/diff"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+const (
+	// MaxFileDiffLines is how much of a diff DiffFileBetweenRevisions returns
+	MaxFileDiffLines = 200
+	// maxParentDiffFiles bounds the files DiffFilesWithParentRevision returns
+	maxParentDiffFiles = 10
+)
+
+// DiffFileBetweenRevisions returns how a file of a chart changed from one revision to another, or
+// nil if it didn't. A file that's missing from one of the revisions is diffed against nothing.
+func DiffFileBetweenRevisions(ctx context.Context, workspaceID string, chartID string, filePath string, fromRevision int, toRevision int) (*types.FileDiff, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	contentAt := func(revision int) (*string, error) {
+		var content sql.NullString
+		err := conn.QueryRow(ctx, `SELECT content FROM workspace_file
+			WHERE workspace_id = $1 AND chart_id = $2 AND file_path = $3 AND revision_number = $4`,
+			workspaceID, chartID, filePath, revision).Scan(&content)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s at revision %d: %w", filePath, revision, err)
+		}
+		return &content.String, nil
+	}
+
+	before, err := contentAt(fromRevision)
+	if err != nil {
+		return nil, err
+	}
+	after, err := contentAt(toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	fileDiff := diffFileContents(filePath, before, after, MaxFileDiffLines)
+	if fileDiff != nil {
+		fileDiff.ChartID = chartID
+		fileDiff.FromRevision = fromRevision
+		fileDiff.ToRevision = toRevision
+	}
+	return fileDiff, nil
+}
+
+// DiffFilesWithParentRevision returns how files changed from the revision before the current
+// revision of a workspace, so that a plan knows what was just done. The values.yaml and
+// Chart.yaml of the files' charts are always diffed and come first, unchanged files are left out.
+func DiffFilesWithParentRevision(ctx context.Context, w *types.Workspace, files []types.File) ([]types.FileDiff, error) {
+	if w.CurrentRevision < 1 {
+		return nil, nil
+	}
+
+	type chartFile struct{ chartID, path string }
+	seen := map[chartFile]bool{}
+	candidates := []chartFile{}
+	add := func(chartID string, path string) {
+		key := chartFile{chartID: chartID, path: path}
+		if chartID == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		candidates = append(candidates, key)
+	}
+	for _, file := range files {
+		add(file.ChartID, "values.yaml")
+		add(file.ChartID, "Chart.yaml")
+	}
+	for _, file := range files {
+		add(file.ChartID, file.FilePath)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return diffPriority(candidates[i].path) < diffPriority(candidates[j].path)
+	})
+
+	diffs := []types.FileDiff{}
+	for _, candidate := range candidates {
+		if len(diffs) == maxParentDiffFiles {
+			break
+		}
+		fileDiff, err := DiffFileBetweenRevisions(ctx, w.ID, candidate.chartID, candidate.path, w.CurrentRevision-1, w.CurrentRevision)
+		if err != nil {
+			return nil, err
+		}
+		if fileDiff != nil {
+			diffs = append(diffs, *fileDiff)
+		}
+	}
+	return diffs, nil
+}
+
+// diffPriority orders values.yaml and Chart.yaml before the templates, they change what every
+// template renders
+func diffPriority(path string) int {
+	switch path {
+	case "values.yaml":
+		return 0
+	case "Chart.yaml":
+		return 1
+	}
+	return 2
+}
+
+// diffFileContents diffs two versions of a file, nil meaning the file doesn't exist. It returns
+// nil when they're the same. The diff is cut to maxLines, zero only counts the changed lines.
+func diffFileContents(filePath string, before *string, after *string, maxLines int) *types.FileDiff {
+	if before == nil && after == nil {
+		return nil
+	}
+	if before != nil && after != nil && *before == *after {
+		return nil
+	}
+
+	beforeContent, afterContent := "", ""
+	if before != nil {
+		beforeContent = *before
+	}
+	if after != nil {
+		afterContent = *after
+	}
+
+	fileDiff := &types.FileDiff{FilePath: filePath}
+	fileDiff.LinesAdded, fileDiff.LinesRemoved = diff.Stat(beforeContent, afterContent)
+	if maxLines == 0 {
+		return fileDiff
+	}
+
+	unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(beforeContent),
+		B:        diffLines(afterContent),
+		FromFile: filePath,
+		ToFile:   filePath,
+		Context:  3,
+	})
+	if err != nil {
+		// only returned by the writer, a strings.Builder never fails
+		return fileDiff
+	}
+
+	lines := strings.SplitAfter(unified, "\n")
+	if len(lines) > maxLines {
+		unified = strings.Join(lines[:maxLines], "")
+		fileDiff.Truncated = true
+	}
+	fileDiff.Diff = unified
+	return fileDiff
+}
+
+// diffLines splits content into lines that each end with a newline, difflib.SplitLines adds an
+// empty line to content that ends with one
+func diffLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
@@ -0,0 +1,55 @@
+package workspace
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffFileContents(t *testing.T) {
+	before := "replicaCount: 1\nimage:\n  tag: 1.0.0\n"
+	after := "replicaCount: 2\nimage:\n  tag: 1.0.0\n"
+
+	fileDiff := diffFileContents("values.yaml", &before, &after, MaxFileDiffLines)
+	require.NotNil(t, fileDiff)
+	assert.Equal(t, `--- values.yaml
++++ values.yaml
+@@ -1,3 +1,3 @@
+-replicaCount: 1
++replicaCount: 2
+ image:
+   tag: 1.0.0
+`, fileDiff.Diff)
+	assert.Equal(t, 1, fileDiff.LinesAdded)
+	assert.Equal(t, 1, fileDiff.LinesRemoved)
+	assert.False(t, fileDiff.Truncated)
+
+	assert.Nil(t, diffFileContents("values.yaml", &before, &before, MaxFileDiffLines))
+	assert.Nil(t, diffFileContents("values.yaml", nil, nil, MaxFileDiffLines))
+
+	created := diffFileContents("templates/service.yaml", nil, &after, MaxFileDiffLines)
+	require.NotNil(t, created)
+	assert.Equal(t, 3, created.LinesAdded)
+	assert.Contains(t, created.Diff, "@@ -0,0 +1,3 @@")
+
+	counted := diffFileContents("values.yaml", &before, &after, 0)
+	assert.Empty(t, counted.Diff)
+	assert.Equal(t, 1, counted.LinesAdded)
+}
+
+func TestDiffFileContentsTruncated(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("key%d: value", i))
+	}
+	after := strings.Join(lines, "\n") + "\n"
+
+	fileDiff := diffFileContents("values.yaml", nil, &after, MaxFileDiffLines)
+	require.NotNil(t, fileDiff)
+	assert.True(t, fileDiff.Truncated)
+	assert.Equal(t, MaxFileDiffLines, strings.Count(fileDiff.Diff, "\n"))
+	assert.Equal(t, 500, fileDiff.LinesAdded)
+}
@@ -0,0 +1,112 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// fileHistoryPromptLength is how much of the chat message behind a change is returned
+const fileHistoryPromptLength = 80
+
+// fileRevision is a file as it was in a revision, Content is nil when it didn't exist
+type fileRevision struct {
+	RevisionNumber int
+	CreatedAt      time.Time
+	PlanID         string
+	Prompt         string
+	Content        *string
+}
+
+// GetFileHistory returns the revisions of a workspace that created, changed or deleted the file
+// at filePath, oldest first. Revisions that copied the file unchanged are left out.
+func GetFileHistory(ctx context.Context, workspaceID string, filePath string) ([]types.FileHistoryEntry, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	// every chart of a workspace could have a file at filePath, the first chart's is followed
+	query := `SELECT r.revision_number, r.created_at, r.plan_id, f.content,
+			(SELECT c.prompt FROM workspace_chat c
+				WHERE c.workspace_id = r.workspace_id AND r.plan_id IS NOT NULL AND c.response_plan_id = r.plan_id
+				ORDER BY c.created_at LIMIT 1)
+		FROM workspace_revision r
+		LEFT JOIN LATERAL (
+			SELECT content FROM workspace_file
+			WHERE workspace_id = r.workspace_id AND revision_number = r.revision_number AND file_path = $2
+			ORDER BY chart_id LIMIT 1
+		) f ON true
+		WHERE r.workspace_id = $1
+		ORDER BY r.revision_number`
+	rows, err := conn.Query(ctx, query, workspaceID, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions of %s: %w", filePath, err)
+	}
+	defer rows.Close()
+
+	revisions := []fileRevision{}
+	for rows.Next() {
+		var revision fileRevision
+		var planID, content, prompt sql.NullString
+		if err := rows.Scan(&revision.RevisionNumber, &revision.CreatedAt, &planID, &content, &prompt); err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revision.PlanID = planID.String
+		revision.Prompt = prompt.String
+		if content.Valid {
+			revision.Content = &content.String
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list revisions of %s: %w", filePath, err)
+	}
+
+	return buildFileHistory(revisions), nil
+}
+
+// buildFileHistory compares each revision of a file with the one before it, revisions must be
+// in order
+func buildFileHistory(revisions []fileRevision) []types.FileHistoryEntry {
+	history := []types.FileHistoryEntry{}
+
+	var previous *string
+	for _, revision := range revisions {
+		if fileDiff := diffFileContents("", previous, revision.Content, 0); fileDiff != nil {
+			change := "modified"
+			switch {
+			case previous == nil:
+				change = "created"
+			case revision.Content == nil:
+				change = "deleted"
+			}
+
+			history = append(history, types.FileHistoryEntry{
+				RevisionNumber: revision.RevisionNumber,
+				Change:         change,
+				CreatedAt:      revision.CreatedAt,
+				PlanID:         revision.PlanID,
+				Prompt:         promptExcerpt(revision.Prompt),
+				LinesAdded:     fileDiff.LinesAdded,
+				LinesRemoved:   fileDiff.LinesRemoved,
+			})
+		}
+
+		previous = revision.Content
+	}
+
+	return history
+}
+
+func promptExcerpt(prompt string) string {
+	prompt = strings.Join(strings.Fields(prompt), " ")
+	runes := []rune(prompt)
+	if len(runes) <= fileHistoryPromptLength {
+		return prompt
+	}
+	return strings.TrimSpace(string(runes[:fileHistoryPromptLength])) + "…"
+}
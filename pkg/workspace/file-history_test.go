@@ -0,0 +1,47 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildFileHistory(t *testing.T) {
+	content := func(s string) *string { return &s }
+	at := func(revision int) time.Time { return time.Date(2025, 1, revision, 0, 0, 0, 0, time.UTC) }
+
+	// the file appears in revision 2, is copied unchanged into 3, changed by a plan in 4 and deleted in 5
+	revisions := []fileRevision{
+		{RevisionNumber: 1, CreatedAt: at(1)},
+		{RevisionNumber: 2, CreatedAt: at(2), PlanID: "plan-2", Prompt: "add an ingress", Content: content("kind: Ingress\nspec: {}\n")},
+		{RevisionNumber: 3, CreatedAt: at(3), PlanID: "plan-3", Prompt: "add a service", Content: content("kind: Ingress\nspec: {}\n")},
+		{RevisionNumber: 4, CreatedAt: at(4), PlanID: "plan-4", Prompt: strings.Repeat("make the ingress class configurable ", 4), Content: content("kind: Ingress\nspec:\n  ingressClassName: nginx\n")},
+		{RevisionNumber: 5, CreatedAt: at(5)},
+	}
+
+	history := buildFileHistory(revisions)
+
+	assert.Equal(t, []types.FileHistoryEntry{
+		{RevisionNumber: 2, Change: "created", CreatedAt: at(2), PlanID: "plan-2", Prompt: "add an ingress", LinesAdded: 2},
+		{RevisionNumber: 4, Change: "modified", CreatedAt: at(4), PlanID: "plan-4", Prompt: "make the ingress class configurable make the ingress class configurable make the…", LinesAdded: 2, LinesRemoved: 1},
+		{RevisionNumber: 5, Change: "deleted", CreatedAt: at(5), LinesRemoved: 3},
+	}, history)
+}
+
+func TestBuildFileHistoryRecreated(t *testing.T) {
+	content := "kind: ConfigMap\n"
+	history := buildFileHistory([]fileRevision{
+		{RevisionNumber: 1, Content: &content},
+		{RevisionNumber: 2},
+		{RevisionNumber: 3, Content: &content},
+	})
+
+	changes := []string{}
+	for _, entry := range history {
+		changes = append(changes, entry.Change)
+	}
+	assert.Equal(t, []string{"created", "deleted", "created"}, changes)
+}
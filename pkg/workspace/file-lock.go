@@ -0,0 +1,39 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+)
+
+// ErrFileBusy is returned when a file was held by another writer for longer than fileLockTimeout
+var ErrFileBusy = errors.New("file is being written by another writer")
+
+// fileLockTimeout is a var so that tests can wait less
+var fileLockTimeout = persistence.DefaultLockTimeout
+
+// fileLockKey is the advisory lock key of the file at path in a revision
+func fileLockKey(workspaceID string, revisionNumber int, path string) string {
+	return fmt.Sprintf("workspace_file:%s:%d:%s", workspaceID, revisionNumber, path)
+}
+
+// lockFiles locks the files at paths in a revision until tx ends. Plans, the editor, patch reviews
+// and new revisions all write files, and each of them reads a file before writing it, so without
+// the lock two of them could interleave and leave a file with parts of both writes.
+func lockFiles(ctx context.Context, tx persistence.Execer, workspaceID string, revisionNumber int, paths ...string) error {
+	keys := make([]string, 0, len(paths))
+	for _, path := range paths {
+		keys = append(keys, fileLockKey(workspaceID, revisionNumber, path))
+	}
+
+	if err := persistence.LockTx(ctx, tx, fileLockTimeout, keys...); err != nil {
+		if errors.Is(err, persistence.ErrLockBusy) {
+			return fmt.Errorf("%w: %s at revision %d: %w", ErrFileBusy, strings.Join(paths, ", "), revisionNumber, err)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+const (
+	// DefaultFileTreeMaxFiles is how many files a file tree has before its directories are loaded
+	// one at a time
+	DefaultFileTreeMaxFiles = 500
+
+	// fileTreeGVKBytes is how much of a file is read for its GVK, apiVersion and kind are at the top
+	fileTreeGVKBytes = 8 << 10
+)
+
+// ErrFileTreePathNotFound is returned when asking for the subtree of a directory the revision doesn't have
+var ErrFileTreePathNotFound = errors.New("directory not found")
+
+// FileTreeOptions scope a file tree to a chart, or to a directory of a chart. Files that aren't in
+// a chart are scoped by a Path without a ChartID.
+type FileTreeOptions struct {
+	ChartID string
+	Path    string
+	// SummaryModel is the model that summarizes files, a file has a summary when the summary cache
+	// has one of its content by this model. Files have none when it's empty.
+	SummaryModel string
+}
+
+// fileTreeEntry is a file of a revision with what the tree shows about it
+type fileTreeEntry struct {
+	id           string
+	chartID      string
+	path         string
+	size         int
+	hasSummary   bool
+	hasEmbedding bool
+	changed      bool
+}
+
+// fileTreeChart is a chart of a revision
+type fileTreeChart struct {
+	id   string
+	name string
+}
+
+// effectiveContentSHA is the hash of a file's pending content when it has any and of its content
+// otherwise, for files written before content_sha was
+func effectiveContentSHA(alias string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s.content_pending IS NULL
+		THEN COALESCE(%[1]s.content_sha, encode(sha256(convert_to(%[1]s.content, 'UTF8')), 'hex'))
+		ELSE encode(sha256(convert_to(%[1]s.content_pending, 'UTF8')), 'hex') END`, alias)
+}
+
+// GetFileTree returns the files of a revision as a tree grouped by chart, the current revision
+// when revisionNumber is 0. Each file is flagged as changed when it's new or its content hash
+// differs from the file at the same path in the revision before. A tree with more files than
+// CHARTSMITH_FILE_TREE_MAX_FILES is lazy, opts scope it to the subtree of a directory.
+func GetFileTree(ctx context.Context, workspaceID string, revisionNumber int, opts FileTreeOptions) (*types.FileTree, error) {
+	maxFiles, err := fileTreeMaxFiles(param.Get().FileTreeMaxFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if revisionNumber == 0 {
+		if err := conn.QueryRow(ctx, `SELECT current_revision_number FROM workspace WHERE id = $1`, workspaceID).Scan(&revisionNumber); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrWorkspaceNotFound
+			}
+			return nil, fmt.Errorf("failed to get current revision: %w", err)
+		}
+	} else {
+		var exists bool
+		if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM workspace_revision WHERE workspace_id = $1 AND revision_number = $2)`, workspaceID, revisionNumber).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check revision: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, revisionNumber)
+		}
+	}
+	parentRevisionNumber := revisionNumber - 1
+
+	rows, err := conn.Query(ctx, `SELECT id, name FROM workspace_chart WHERE workspace_id = $1 AND revision_number = $2 ORDER BY name, id`, workspaceID, revisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list charts: %w", err)
+	}
+	defer rows.Close()
+
+	charts := []fileTreeChart{}
+	for rows.Next() {
+		var chart fileTreeChart
+		if err := rows.Scan(&chart.id, &chart.name); err != nil {
+			return nil, fmt.Errorf("failed to scan chart: %w", err)
+		}
+		charts = append(charts, chart)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list charts: %w", err)
+	}
+	rows.Close()
+
+	// the parent revision is joined by chart and path, so that a file that was deleted and written
+	// again with the same content isn't changed
+	query := fmt.Sprintf(`SELECT f.id, COALESCE(f.chart_id, ''), f.file_path, octet_length(COALESCE(f.content_pending, f.content)),
+			f.embeddings IS NOT NULL,
+			$3::text <> '' AND EXISTS (SELECT 1 FROM llm_summary_cache s
+				WHERE s.cache_key = encode(sha256(convert_to($3 || chr(10) || COALESCE(f.content_pending, f.content), 'UTF8')), 'hex')),
+			$4 > 0 AND (p.id IS NULL OR %s IS DISTINCT FROM %s)
+		FROM workspace_file f
+		LEFT JOIN workspace_file p ON p.workspace_id = f.workspace_id AND p.revision_number = $4
+			AND p.chart_id IS NOT DISTINCT FROM f.chart_id AND p.file_path = f.file_path
+		WHERE f.workspace_id = $1 AND f.revision_number = $2
+			AND ($5::text = '' AND $6::text = '' OR f.chart_id IS NOT DISTINCT FROM NULLIF($5, ''))
+			AND ($6 = '' OR f.file_path LIKE $7)
+		ORDER BY f.chart_id, f.file_path`, effectiveContentSHA("f"), effectiveContentSHA("p"))
+	dir := strings.Trim(opts.Path, "/")
+	rows, err = conn.Query(ctx, query, workspaceID, revisionNumber, opts.SummaryModel, parentRevisionNumber, opts.ChartID, dir, escapeLike(dir)+"/%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []fileTreeEntry{}
+	for rows.Next() {
+		var entry fileTreeEntry
+		if err := rows.Scan(&entry.id, &entry.chartID, &entry.path, &entry.size, &entry.hasEmbedding, &entry.hasSummary, &entry.changed); err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	rows.Close()
+
+	tree, err := buildFileTree(charts, entries, opts.ChartID, dir, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	tree.RevisionNumber = revisionNumber
+	if parentRevisionNumber > 0 {
+		tree.ParentRevisionNumber = parentRevisionNumber
+	}
+
+	// only the files that are returned are read for their GVK, not the ones a lazy tree left out
+	nodes := map[string]*types.FileTreeNode{}
+	collectYAMLFileNodes(tree, nodes)
+	if len(nodes) == 0 {
+		return tree, nil
+	}
+	fileIDs := make([]string, 0, len(nodes))
+	for id := range nodes {
+		fileIDs = append(fileIDs, id)
+	}
+
+	query = `SELECT id, left(COALESCE(content_pending, content), $3) FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 AND id = ANY($4)`
+	rows, err = conn.Query(ctx, query, workspaceID, revisionNumber, fileTreeGVKBytes, fileIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read files: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		nodes[id].GVK = ParseGVK(content)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read files: %w", err)
+	}
+
+	return tree, nil
+}
+
+// fileTreeMaxFiles parses CHARTSMITH_FILE_TREE_MAX_FILES
+func fileTreeMaxFiles(maxFiles string) (int, error) {
+	if maxFiles == "" {
+		return DefaultFileTreeMaxFiles, nil
+	}
+	n, err := strconv.Atoi(maxFiles)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid CHARTSMITH_FILE_TREE_MAX_FILES %q: must be a whole number, at least 1", maxFiles)
+	}
+	return n, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// buildFileTree nests the entries of a revision by chart and directory, entries must be of the
+// scope of chartID and dir. When there are more than maxFiles, directories are returned without
+// their children.
+func buildFileTree(charts []fileTreeChart, entries []fileTreeEntry, chartID string, dir string, maxFiles int) (*types.FileTree, error) {
+	tree := &types.FileTree{
+		Charts: []types.FileTreeChart{},
+		Files:  []types.FileTreeNode{},
+		Lazy:   len(entries) > maxFiles,
+	}
+
+	byChart := map[string][]fileTreeEntry{}
+	for _, entry := range entries {
+		byChart[entry.chartID] = append(byChart[entry.chartID], entry)
+		tree.FileCount++
+		if entry.changed {
+			tree.ChangedFileCount++
+		}
+	}
+
+	if dir != "" && len(entries) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrFileTreePathNotFound, dir)
+	}
+	if dir != "" && chartID == "" {
+		tree.Files = fileTreeChildren(dir, byChart[""], tree.Lazy)
+		return tree, nil
+	}
+
+	for _, chart := range charts {
+		if chartID != "" && chart.id != chartID {
+			continue
+		}
+		chartEntries := byChart[chart.id]
+		treeChart := types.FileTreeChart{
+			ID:       chart.id,
+			Name:     chart.name,
+			Children: fileTreeChildren(dir, chartEntries, tree.Lazy),
+		}
+		for _, entry := range chartEntries {
+			treeChart.FileCount++
+			if entry.changed {
+				treeChart.ChangedFileCount++
+			}
+		}
+		tree.Charts = append(tree.Charts, treeChart)
+	}
+	if chartID != "" && len(tree.Charts) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChartNotFound, chartID)
+	}
+	if chartID == "" {
+		tree.Files = fileTreeChildren("", byChart[""], tree.Lazy)
+	}
+
+	return tree, nil
+}
+
+// fileTreeDir is a directory of a file tree while it's being built
+type fileTreeDir struct {
+	path  string
+	dirs  map[string]*fileTreeDir
+	files []types.FileTreeNode
+}
+
+// fileTreeChildren returns the nodes of the files under dir, nested by directory, directories
+// first and then files, by name. When lazy, the directories are returned without their children.
+func fileTreeChildren(dir string, entries []fileTreeEntry, lazy bool) []types.FileTreeNode {
+	root := &fileTreeDir{path: dir, dirs: map[string]*fileTreeDir{}}
+	for _, entry := range entries {
+		relative := entry.path
+		if dir != "" {
+			relative = strings.TrimPrefix(entry.path, dir+"/")
+		}
+
+		parent := root
+		names := strings.Split(relative, "/")
+		for _, name := range names[:len(names)-1] {
+			child, ok := parent.dirs[name]
+			if !ok {
+				child = &fileTreeDir{path: path.Join(parent.path, name), dirs: map[string]*fileTreeDir{}}
+				parent.dirs[name] = child
+			}
+			parent = child
+		}
+
+		parent.files = append(parent.files, types.FileTreeNode{
+			Name:                       names[len(names)-1],
+			Path:                       entry.path,
+			Size:                       entry.size,
+			FileID:                     entry.id,
+			HasSummary:                 entry.hasSummary,
+			HasEmbedding:               entry.hasEmbedding,
+			ChangedSinceParentRevision: entry.changed,
+		})
+	}
+
+	children := root.children()
+	if lazy {
+		for i := range children {
+			if children[i].IsDir {
+				children[i].Children = nil
+				children[i].ChildrenOmitted = true
+			}
+		}
+	}
+	return children
+}
+
+// children returns the nodes of a directory, with the sizes and counts of its subdirectories
+func (d *fileTreeDir) children() []types.FileTreeNode {
+	names := make([]string, 0, len(d.dirs))
+	for name := range d.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	children := make([]types.FileTreeNode, 0, len(d.dirs)+len(d.files))
+	for _, name := range names {
+		node := types.FileTreeNode{Name: name, Path: d.dirs[name].path, IsDir: true, Children: d.dirs[name].children()}
+		for _, child := range node.Children {
+			node.Size += child.Size
+			if child.IsDir {
+				node.FileCount += child.FileCount
+				node.ChangedFileCount += child.ChangedFileCount
+				continue
+			}
+			node.FileCount++
+			if child.ChangedSinceParentRevision {
+				node.ChangedFileCount++
+			}
+		}
+		children = append(children, node)
+	}
+
+	files := append([]types.FileTreeNode{}, d.files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return append(children, files...)
+}
+
+// collectYAMLFileNodes returns the YAML files of a tree by ID, the files a GVK is read from
+func collectYAMLFileNodes(tree *types.FileTree, nodes map[string]*types.FileTreeNode) {
+	var collect func(children []types.FileTreeNode)
+	collect = func(children []types.FileTreeNode) {
+		for i := range children {
+			if children[i].IsDir {
+				collect(children[i].Children)
+				continue
+			}
+			if ext := path.Ext(children[i].Name); ext == ".yaml" || ext == ".yml" {
+				nodes[children[i].FileID] = &children[i]
+			}
+		}
+	}
+	for i := range tree.Charts {
+		collect(tree.Charts[i].Children)
+	}
+	collect(tree.Files)
+}
+
+// ParseGVK returns the group, version and kind of the first document of a manifest or template
+// that has a kind written in it, nil when none has. An apiVersion produced by a template action
+// leaves the group and version empty.
+func ParseGVK(content string) *types.GroupVersionKind {
+	for _, document := range documentSeparator.Split(content, -1) {
+		kind := templateKindLine.FindStringSubmatch(document)
+		if kind == nil {
+			continue
+		}
+
+		gvk := &types.GroupVersionKind{Kind: kind[1]}
+		if apiVersion := templateAPIVersionLine.FindStringSubmatch(document); apiVersion != nil {
+			if group, version, found := strings.Cut(apiVersion[1], "/"); found {
+				gvk.Group, gvk.Version = group, version
+			} else {
+				gvk.Version = apiVersion[1]
+			}
+		}
+		return gvk
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileTreeFixture is a revision of a chart where three files were modified since the revision before
+var fileTreeFixture = []fileTreeEntry{
+	{id: "chart-yaml", chartID: "chart", path: "Chart.yaml", size: 100, hasSummary: true},
+	{id: "values", chartID: "chart", path: "values.yaml", size: 300, hasEmbedding: true, changed: true},
+	{id: "deployment", chartID: "chart", path: "templates/deployment.yaml", size: 1000, hasEmbedding: true, changed: true},
+	{id: "helpers", chartID: "chart", path: "templates/_helpers.tpl", size: 200},
+	{id: "service", chartID: "chart", path: "templates/service.yaml", size: 400, hasEmbedding: true},
+	{id: "test-connection", chartID: "chart", path: "templates/tests/test-connection.yaml", size: 50, changed: true},
+	{id: "notes", path: "NOTES.md", size: 10},
+}
+
+func TestBuildFileTree(t *testing.T) {
+	tree, err := buildFileTree([]fileTreeChart{{id: "chart", name: "nginx"}}, fileTreeFixture, "", "", DefaultFileTreeMaxFiles)
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, tree.FileCount)
+	assert.Equal(t, 3, tree.ChangedFileCount)
+	assert.False(t, tree.Lazy)
+	require.Len(t, tree.Charts, 1)
+
+	chart := tree.Charts[0]
+	assert.Equal(t, "nginx", chart.Name)
+	assert.Equal(t, 6, chart.FileCount)
+	assert.Equal(t, 3, chart.ChangedFileCount)
+
+	changed := map[string]bool{}
+	var walk func(nodes []types.FileTreeNode)
+	walk = func(nodes []types.FileTreeNode) {
+		for _, node := range nodes {
+			if node.IsDir {
+				walk(node.Children)
+				continue
+			}
+			changed[node.Path] = node.ChangedSinceParentRevision
+		}
+	}
+	walk(chart.Children)
+	assert.Equal(t, map[string]bool{
+		"Chart.yaml":                           false,
+		"values.yaml":                          true,
+		"templates/deployment.yaml":            true,
+		"templates/_helpers.tpl":               false,
+		"templates/service.yaml":               false,
+		"templates/tests/test-connection.yaml": true,
+	}, changed)
+
+	// directories come first, then files, by name
+	names := []string{}
+	for _, node := range chart.Children {
+		names = append(names, node.Name)
+	}
+	assert.Equal(t, []string{"templates", "Chart.yaml", "values.yaml"}, names)
+
+	templates := chart.Children[0]
+	assert.True(t, templates.IsDir)
+	assert.Equal(t, "templates", templates.Path)
+	assert.Equal(t, 1650, templates.Size)
+	assert.Equal(t, 4, templates.FileCount)
+	assert.Equal(t, 2, templates.ChangedFileCount)
+	assert.Equal(t, "tests", templates.Children[0].Name)
+	assert.Equal(t, "templates/tests", templates.Children[0].Path)
+	assert.Equal(t, 1, templates.Children[0].ChangedFileCount)
+
+	assert.Equal(t, []types.FileTreeNode{{Name: "NOTES.md", Path: "NOTES.md", Size: 10, FileID: "notes"}}, tree.Files)
+}
+
+func TestBuildFileTreeLazy(t *testing.T) {
+	charts := []fileTreeChart{{id: "chart", name: "nginx"}}
+
+	tree, err := buildFileTree(charts, fileTreeFixture, "", "", 5)
+	require.NoError(t, err)
+	assert.True(t, tree.Lazy)
+	templates := tree.Charts[0].Children[0]
+	assert.True(t, templates.ChildrenOmitted)
+	assert.Nil(t, templates.Children)
+	assert.Equal(t, 4, templates.FileCount)
+	assert.Equal(t, 2, templates.ChangedFileCount)
+
+	// the subtree of a directory is loaded with the entries under it
+	subtree := []fileTreeEntry{}
+	for _, entry := range fileTreeFixture {
+		if entry.chartID == "chart" && strings.HasPrefix(entry.path, "templates/") {
+			subtree = append(subtree, entry)
+		}
+	}
+	tree, err = buildFileTree(charts, subtree, "chart", "templates", 5)
+	require.NoError(t, err)
+	assert.False(t, tree.Lazy)
+	assert.Equal(t, 2, tree.ChangedFileCount)
+	require.Len(t, tree.Charts, 1)
+	paths := []string{}
+	for _, node := range tree.Charts[0].Children {
+		paths = append(paths, node.Path)
+	}
+	assert.Equal(t, []string{"templates/tests", "templates/_helpers.tpl", "templates/deployment.yaml", "templates/service.yaml"}, paths)
+	assert.Empty(t, tree.Files)
+
+	_, err = buildFileTree(charts, nil, "chart", "nope", 5)
+	assert.True(t, errors.Is(err, ErrFileTreePathNotFound))
+
+	_, err = buildFileTree(charts, nil, "other", "", 5)
+	assert.True(t, errors.Is(err, ErrChartNotFound))
+}
+
+func TestParseGVK(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *types.GroupVersionKind
+	}{
+		{name: "grouped", content: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: x\n", want: &types.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}},
+		{name: "core", content: "apiVersion: v1\nkind: Service\n", want: &types.GroupVersionKind{Version: "v1", Kind: "Service"}},
+		{
+			name:    "templated apiVersion",
+			content: "{{- if .Values.ingress.enabled }}\napiVersion: {{ include \"nginx.ingress.apiVersion\" . }}\nkind: Ingress\n{{- end }}\n",
+			want:    &types.GroupVersionKind{Kind: "Ingress"},
+		},
+		{name: "first document with a kind", content: "# comment\n---\napiVersion: v1\nkind: ConfigMap\n---\napiVersion: v1\nkind: Secret\n", want: &types.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}},
+		{name: "values", content: "replicaCount: 1\nimage:\n  kind: nginx\n"},
+		{name: "empty", content: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseGVK(tt.content))
+		})
+	}
+}
+
+func TestFileTreeMaxFiles(t *testing.T) {
+	n, err := fileTreeMaxFiles("")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultFileTreeMaxFiles, n)
+
+	n, err = fileTreeMaxFiles("50")
+	require.NoError(t, err)
+	assert.Equal(t, 50, n)
+
+	for _, invalid := range []string{"0", "-1", "many"} {
+		_, err := fileTreeMaxFiles(invalid)
+		assert.ErrorContains(t, err, "CHARTSMITH_FILE_TREE_MAX_FILES")
+	}
+}
+
+// TestGetFileTree creates a revision where three files were modified since the one before: one
+// changed, one with pending content and one added. It runs against the database in
+// CHARTSMITH_TEST_PG_URI.
+func TestGetFileTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping file tree integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+	require.NoError(t, param.Init(nil))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "test-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		for _, table := range []string{"workspace_file", "workspace_chart", "workspace_revision", "workspace"} {
+			column := "workspace_id"
+			if table == "workspace" {
+				column = "id"
+			}
+			conn.Exec(context.Background(), fmt.Sprintf(`DELETE FROM %s WHERE %s = $1`, table, column), workspaceID)
+		}
+		conn.Exec(context.Background(), `DELETE FROM llm_summary_cache WHERE model = $1`, workspaceID)
+	})
+
+	_, err := conn.Exec(ctx, `INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number) VALUES ($1, now(), 'test', 'user', 'test', 2)`, workspaceID)
+	require.NoError(t, err)
+	for revision := 1; revision <= 2; revision++ {
+		_, err = conn.Exec(ctx, `INSERT INTO workspace_revision (workspace_id, revision_number, created_at, created_by_user_id, created_type, is_complete) VALUES ($1, $2, now(), 'user', 'test', true)`, workspaceID, revision)
+		require.NoError(t, err)
+		_, err = conn.Exec(ctx, `INSERT INTO workspace_chart (id, workspace_id, name, revision_number) VALUES ($1, $2, 'nginx', $3)`, workspaceID+"-chart", workspaceID, revision)
+		require.NoError(t, err)
+	}
+
+	insert := `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, content_pending)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	addFile := func(revision int, name string, filePath string, content string, pending *string) {
+		_, err := conn.Exec(ctx, insert, workspaceID+"-"+name, revision, workspaceID+"-chart", workspaceID, filePath, content, contentSHA(content), pending)
+		require.NoError(t, err)
+	}
+	deployment := "apiVersion: apps/v1\nkind: Deployment\n"
+	service := "apiVersion: v1\nkind: Service\n"
+	for revision := 1; revision <= 2; revision++ {
+		addFile(revision, "chart-yaml", "Chart.yaml", "name: nginx\n", nil)
+		addFile(revision, "service", "templates/service.yaml", service, nil)
+	}
+	addFile(1, "values", "values.yaml", "replicaCount: 1\n", nil)
+	addFile(2, "values", "values.yaml", "replicaCount: 2\n", nil)
+	addFile(1, "deployment", "templates/deployment.yaml", deployment, nil)
+	pending := deployment + "metadata:\n  name: nginx\n"
+	addFile(2, "deployment", "templates/deployment.yaml", deployment, &pending)
+	addFile(2, "ingress", "templates/ingress.yaml", "apiVersion: {{ .Values.apiVersion }}\nkind: Ingress\n", nil)
+
+	// files written before content_sha was are compared by their content
+	_, err = conn.Exec(ctx, `UPDATE workspace_file SET content_sha = NULL WHERE id = $1 AND revision_number = 2`, workspaceID+"-service")
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `INSERT INTO llm_summary_cache (cache_key, model, summary, created_at, last_used_at) VALUES ($1, $2, 'a chart', now(), now())`,
+		contentSHA(workspaceID+"\n"+"name: nginx\n"), workspaceID)
+	require.NoError(t, err)
+
+	tree, err := GetFileTree(ctx, workspaceID, 0, FileTreeOptions{SummaryModel: workspaceID})
+	require.NoError(t, err)
+	assert.Equal(t, 2, tree.RevisionNumber)
+	assert.Equal(t, 1, tree.ParentRevisionNumber)
+	assert.Equal(t, 5, tree.FileCount)
+	assert.Equal(t, 3, tree.ChangedFileCount)
+
+	files := map[string]types.FileTreeNode{}
+	var walk func(nodes []types.FileTreeNode)
+	walk = func(nodes []types.FileTreeNode) {
+		for _, node := range nodes {
+			if node.IsDir {
+				walk(node.Children)
+				continue
+			}
+			files[node.Path] = node
+		}
+	}
+	require.Len(t, tree.Charts, 1)
+	walk(tree.Charts[0].Children)
+
+	changed := map[string]bool{}
+	for filePath, node := range files {
+		changed[filePath] = node.ChangedSinceParentRevision
+	}
+	assert.Equal(t, map[string]bool{
+		"Chart.yaml":                false,
+		"values.yaml":               true,
+		"templates/deployment.yaml": true,
+		"templates/ingress.yaml":    true,
+		"templates/service.yaml":    false,
+	}, changed)
+
+	assert.True(t, files["Chart.yaml"].HasSummary)
+	assert.False(t, files["values.yaml"].HasSummary)
+	assert.Equal(t, len(pending), files["templates/deployment.yaml"].Size)
+	assert.Equal(t, &types.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, files["templates/deployment.yaml"].GVK)
+	assert.Equal(t, &types.GroupVersionKind{Kind: "Ingress"}, files["templates/ingress.yaml"].GVK)
+	assert.Nil(t, files["values.yaml"].GVK)
+
+	// the first revision has nothing to be compared with
+	tree, err = GetFileTree(ctx, workspaceID, 1, FileTreeOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, tree.ChangedFileCount)
+
+	tree, err = GetFileTree(ctx, workspaceID, 2, FileTreeOptions{ChartID: workspaceID + "-chart", Path: "templates"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, tree.FileCount)
+	assert.Equal(t, 2, tree.ChangedFileCount)
+
+	_, err = GetFileTree(ctx, workspaceID, 3, FileTreeOptions{})
+	assert.True(t, errors.Is(err, ErrRevisionNotFound))
+}
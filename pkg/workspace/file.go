@@ -3,6 +3,7 @@ package workspace
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -23,7 +24,8 @@ func GetFile(ctx context.Context, fileID string, revisionNumber int) (*types.Fil
 		workspace_id,
 		file_path,
 		content,
-		content_pending
+		content_pending,
+		version
 	FROM
 		workspace_file
 	WHERE
@@ -36,7 +38,7 @@ func GetFile(ctx context.Context, fileID string, revisionNumber int) (*types.Fil
 	// Use pgtype.Array which is designed to handle PostgreSQL arrays properly
 	var contentPending sql.NullString
 
-	err := row.Scan(&file.ID, &file.RevisionNumber, &chartID, &file.WorkspaceID, &file.FilePath, &file.Content, &contentPending)
+	err := row.Scan(&file.ID, &file.RevisionNumber, &chartID, &file.WorkspaceID, &file.FilePath, &file.Content, &contentPending, &file.Version)
 	if err != nil {
 		return nil, fmt.Errorf("error scanning file: %w", err)
 	}
@@ -49,12 +51,13 @@ func GetFile(ctx context.Context, fileID string, revisionNumber int) (*types.Fil
 	return &file, nil
 }
 
-func SetFileEmbeddings(ctx context.Context, fileID string, revisionNumber int, embeddings string) error {
+// SetFileEmbeddings stores the embeddings of a file revision with the provider that made them
+func SetFileEmbeddings(ctx context.Context, fileID string, revisionNumber int, embeddings string, provider string, dimensions int) error {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
-	query := `UPDATE workspace_file SET embeddings = $1 WHERE id = $2 AND revision_number = $3`
-	_, err := conn.Exec(ctx, query, embeddings, fileID, revisionNumber)
+	query := `UPDATE workspace_file SET embeddings = $1, embeddings_provider = $4, embeddings_dimensions = $5 WHERE id = $2 AND revision_number = $3`
+	_, err := conn.Exec(ctx, query, embeddings, fileID, revisionNumber, provider, dimensions)
 	if err != nil {
 		return err
 	}
@@ -66,7 +69,7 @@ func ListFiles(ctx context.Context, workspaceID string, revisionNumber int, char
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
-	query := `SELECT id, revision_number, chart_id, workspace_id, file_path, content, content_pending FROM workspace_file WHERE chart_id = $1 AND workspace_id = $2 AND revision_number = $3`
+	query := `SELECT id, revision_number, chart_id, workspace_id, file_path, content, content_pending, version FROM workspace_file WHERE chart_id = $1 AND workspace_id = $2 AND revision_number = $3`
 	rows, err := conn.Query(ctx, query, chartID, workspaceID, revisionNumber)
 	if err != nil {
 		return nil, err
@@ -80,7 +83,7 @@ func ListFiles(ctx context.Context, workspaceID string, revisionNumber int, char
 
 		var contentPending sql.NullString
 
-		err := rows.Scan(&file.ID, &file.RevisionNumber, &chartID, &file.WorkspaceID, &file.FilePath, &file.Content, &contentPending)
+		err := rows.Scan(&file.ID, &file.RevisionNumber, &chartID, &file.WorkspaceID, &file.FilePath, &file.Content, &contentPending, &file.Version)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning file row: %w", err)
 		}
@@ -104,7 +107,25 @@ func min(a, b int) int {
 	return b
 }
 
-func SetFileContentPending(ctx context.Context, path string, revisionNumber int, chartID string, workspaceID string, contentPending string) error {
+// ErrConflict is returned when a file was written by someone else since the caller read it
+var ErrConflict = errors.New("file was modified concurrently")
+
+// SetFileContentPending sets the pending content of the file at path, creating the file if it
+// doesn't exist. When expectedVersion is set, an existing file is only updated if it's still at
+// that version, otherwise ErrConflict is returned and nothing is written. Writes to the same file
+// are serialized, ErrFileBusy is returned when another writer holds it for too long. The content is
+// normalized with NormalizeFileContent, content that isn't UTF-8 returns ErrInvalidEncoding. The
+// secrets in the content are recorded with it.
+func SetFileContentPending(ctx context.Context, path string, revisionNumber int, chartID string, workspaceID string, contentPending string, expectedVersion *int) error {
+	preserveLineEndings, err := GetSetting[bool](ctx, workspaceID, SettingPreserveLineEndings)
+	if err != nil {
+		return fmt.Errorf("error getting workspace line endings: %w", err)
+	}
+	contentPending, lineEnding, err := NormalizeFileContent(path, contentPending, !preserveLineEndings)
+	if err != nil {
+		return err
+	}
+
 	// Create dedicated database context with timeout
 	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
@@ -119,6 +140,10 @@ func SetFileContentPending(ctx context.Context, path string, revisionNumber int,
 	}
 	defer tx.Rollback(dbCtx)
 
+	if err := lockFiles(dbCtx, tx, workspaceID, revisionNumber, path); err != nil {
+		return err
+	}
+
 	// get the file id - only filter by path and revision for maximum compatibility with different chart structures
 	query := `SELECT id FROM workspace_file WHERE file_path = $1 AND revision_number = $2 AND workspace_id = $3`
 	row := tx.QueryRow(dbCtx, query, path, revisionNumber, workspaceID)
@@ -137,11 +162,22 @@ func SetFileContentPending(ctx context.Context, path string, revisionNumber int,
 	// set the content pending
 	if fileID != "" {
 		// Update existing file
-		query = `UPDATE workspace_file SET content_pending = $1 WHERE id = $2 AND revision_number = $3`
-		_, err := tx.Exec(dbCtx, query, contentPending, fileID, revisionNumber)
+		// the base is the content the first pending change was written against, later changes
+		// build on the pending content so they keep it
+		query = `UPDATE workspace_file SET content_pending = $1, version = version + 1,
+			content_pending_base_sha = CASE WHEN content_pending IS NULL THEN content_sha ELSE COALESCE(content_pending_base_sha, content_sha) END
+			WHERE id = $2 AND revision_number = $3 AND ($4::integer IS NULL OR version = $4)`
+		tag, err := tx.Exec(dbCtx, query, contentPending, fileID, revisionNumber, expectedVersion)
 		if err != nil {
 			return fmt.Errorf("error updating file content pending: %w", err)
 		}
+		if tag.RowsAffected() == 0 {
+			// without a version, the file can only be missed by being deleted since it was read
+			if expectedVersion == nil {
+				return fmt.Errorf("%w: %s at revision %d was deleted", ErrConflict, path, revisionNumber)
+			}
+			return fmt.Errorf("%w: %s at revision %d is no longer at version %d", ErrConflict, path, revisionNumber, *expectedVersion)
+		}
 	} else {
 		// Create new file
 		id, err := securerandom.Hex(16)
@@ -149,13 +185,17 @@ func SetFileContentPending(ctx context.Context, path string, revisionNumber int,
 			return fmt.Errorf("error generating file id: %w", err)
 		}
 
-		query = `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_pending) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-		_, err = tx.Exec(dbCtx, query, id, revisionNumber, chartID, workspaceID, path, "", contentPending)
+		query = `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, content_pending, content_pending_base_sha, line_ending) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $7, NULLIF($9, ''))`
+		_, err = tx.Exec(dbCtx, query, id, revisionNumber, chartID, workspaceID, path, "", contentSHA(""), contentPending, lineEnding)
 		if err != nil {
 			return fmt.Errorf("error inserting file: %w", err)
 		}
 	}
 
+	if _, err := recordSecretFindings(dbCtx, tx, workspaceID, path, contentPending); err != nil {
+		return err
+	}
+
 	// Try to commit the transaction
 	if err := tx.Commit(dbCtx); err != nil {
 		return fmt.Errorf("error committing transaction: %w", err)
@@ -0,0 +1,159 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetFileContentPendingConcurrentWriters has two writers that read the same version of a file
+// race to set its pending content. It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestSetFileContentPendingConcurrentWriters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping workspace file integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "test-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_file WHERE workspace_id = $1`, workspaceID)
+	})
+
+	_, err := conn.Exec(ctx, `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content)
+		VALUES ($1, 1, 'chart', $2, 'values.yaml', 'replicaCount: 1')`, workspaceID+"-file", workspaceID)
+	require.NoError(t, err)
+
+	files, err := ListFiles(ctx, workspaceID, 1, "chart")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	version := files[0].Version
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, content := range []string{"replicaCount: 2", "replicaCount: 3"} {
+		wg.Add(1)
+		go func(i int, content string) {
+			defer wg.Done()
+			errs[i] = SetFileContentPending(ctx, "values.yaml", 1, "chart", workspaceID, content, &version)
+		}(i, content)
+	}
+	wg.Wait()
+
+	conflicts := 0
+	for _, err := range errs {
+		if err != nil {
+			assert.True(t, errors.Is(err, ErrConflict), err.Error())
+			conflicts++
+		}
+	}
+	assert.Equal(t, 1, conflicts, "exactly one writer should win")
+
+	file, err := GetFile(ctx, workspaceID+"-file", 1)
+	require.NoError(t, err)
+	assert.Equal(t, version+1, file.Version)
+
+	// a writer that doesn't care about the version always writes
+	require.NoError(t, SetFileContentPending(ctx, "values.yaml", 1, "chart", workspaceID, "replicaCount: 4", nil))
+	file, err = GetFile(ctx, workspaceID+"-file", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "replicaCount: 4", *file.ContentPending)
+	assert.Equal(t, version+2, file.Version)
+
+	// a new file written with CRLF line endings is stored with LF, and the style is recorded
+	require.NoError(t, SetFileContentPending(ctx, "templates/service.yaml", 1, "chart", workspaceID, "\ufeffkind: Service\r\nspec: {}\r\n", nil))
+	var contentPending, lineEnding string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT content_pending, line_ending FROM workspace_file WHERE workspace_id = $1 AND file_path = 'templates/service.yaml'`, workspaceID).
+		Scan(&contentPending, &lineEnding))
+	assert.Equal(t, "kind: Service\nspec: {}\n", contentPending)
+	assert.Equal(t, LineEndingCRLF, lineEnding)
+
+	err = SetFileContentPending(ctx, "templates/binary.yaml", 1, "chart", workspaceID, "kind: \xff", nil)
+	assert.True(t, errors.Is(err, ErrInvalidEncoding))
+}
+
+// TestSetFileContentPendingSerializesWriters has many writers set the pending content of a file
+// that doesn't exist yet at once. It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestSetFileContentPendingSerializesWriters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping workspace file integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "test-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_file WHERE workspace_id = $1`, workspaceID)
+	})
+
+	contents := make([]string, 20)
+	for i := range contents {
+		contents[i] = strings.Repeat(fmt.Sprintf("writer%d: line\n", i), 200)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(contents))
+	for i, content := range contents {
+		wg.Add(1)
+		go func(i int, content string) {
+			defer wg.Done()
+			errs[i] = SetFileContentPending(ctx, "values.yaml", 1, "chart", workspaceID, content, nil)
+		}(i, content)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	// the writers didn't each create the file, and the last of them wrote all of its content
+	var files int
+	var contentPending string
+	var version int
+	require.NoError(t, conn.QueryRow(ctx, `SELECT count(*), max(content_pending), max(version) FROM workspace_file WHERE workspace_id = $1 AND file_path = 'values.yaml'`, workspaceID).
+		Scan(&files, &contentPending, &version))
+	assert.Equal(t, 1, files)
+	assert.Contains(t, contents, contentPending)
+	assert.Equal(t, len(contents)-1, version, "each writer after the first updated the file")
+
+	// a writer that can't get the file in time gives up
+	original := fileLockTimeout
+	t.Cleanup(func() { fileLockTimeout = original })
+	fileLockTimeout = 100 * time.Millisecond
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	require.NoError(t, lockFiles(ctx, tx, workspaceID, 1, "values.yaml"))
+
+	err = SetFileContentPending(ctx, "values.yaml", 1, "chart", workspaceID, "replicaCount: 1", nil)
+	assert.True(t, errors.Is(err, ErrFileBusy), err)
+	assert.True(t, errors.Is(err, persistence.ErrLockBusy), err)
+}
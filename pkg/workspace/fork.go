@@ -0,0 +1,168 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+)
+
+// ErrNoCompleteRevision is returned when forking a workspace that has no complete revision to copy
+var ErrNoCompleteRevision = errors.New("workspace has no complete revision")
+
+// ForkWorkspaceOpts are the optional parts of a fork
+type ForkWorkspaceOpts struct {
+	// IncludeChatHistory copies the chat messages and the conversation summary
+	IncludeChatHistory bool
+}
+
+// ForkWorkspace creates a new workspace owned by userID from the latest complete revision of the
+// source workspace. Charts and files are copied with new IDs, along with their embeddings, so the
+// fork doesn't need to be summarized again. Plans, renders and queued work are not copied. The copy
+// happens in a single transaction with a fixed number of statements.
+func ForkWorkspace(ctx context.Context, sourceWorkspaceID string, newName string, userID string, opts ForkWorkspaceOpts) (*types.Workspace, error) {
+	logger.Info("Forking workspace",
+		zap.String("source_workspace_id", sourceWorkspaceID),
+		zap.String("user_id", userID),
+		zap.Bool("include_chat_history", opts.IncludeChatHistory))
+
+	id, err := securerandom.Hex(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate workspace ID: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // Will be ignored if tx.Commit() is called
+
+	if err := forkWorkspaceInTx(ctx, tx, sourceWorkspaceID, id, newName, userID, opts); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return GetWorkspace(ctx, id)
+}
+
+func forkWorkspaceInTx(ctx context.Context, q revisionQuerier, sourceWorkspaceID string, id string, newName string, userID string, opts ForkWorkspaceOpts) error {
+	var revisionNumber int
+	err := q.QueryRow(ctx, `
+        SELECT revision_number FROM workspace_revision
+        WHERE workspace_id = $1 AND is_complete = true
+        ORDER BY revision_number DESC
+        LIMIT 1
+    `, sourceWorkspaceID).Scan(&revisionNumber)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoCompleteRevision
+		}
+		return fmt.Errorf("failed to get latest complete revision: %w", err)
+	}
+
+	// The fork keeps the revision number it was copied from so the chat history lines up with it
+	_, err = q.Exec(ctx, `
+        INSERT INTO workspace (
+            id, created_at, last_updated_at, name, created_by_user_id, created_type,
+            current_revision_number, bootstrap_template, conversation_summary, conversation_summarized_through
+        )
+        SELECT
+            $1, NOW(), NOW(), $2, $3, 'fork',
+            $4, bootstrap_template,
+            CASE WHEN $5 THEN conversation_summary END,
+            CASE WHEN $5 THEN conversation_summarized_through END
+        FROM workspace
+        WHERE id = $6
+    `, id, newName, userID, revisionNumber, opts.IncludeChatHistory, sourceWorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to insert workspace: %w", err)
+	}
+
+	_, err = q.Exec(ctx, `
+        INSERT INTO workspace_revision (
+            workspace_id, revision_number, created_at,
+            created_by_user_id, created_type, is_complete, is_rendered
+        )
+        VALUES ($1, $2, NOW(), $3, 'fork', true, false)
+    `, id, revisionNumber, userID)
+	if err != nil {
+		return fmt.Errorf("failed to insert revision: %w", err)
+	}
+
+	// Chart and file IDs are only unique per revision, so the fork gets new ones. The chart map is
+	// materialized so each chart keeps one new ID for both its own row and its files.
+	_, err = q.Exec(ctx, `
+        WITH chart_map AS MATERIALIZED (
+            SELECT id AS old_id, substr(md5(random()::text || id), 1, 12) AS new_id, name
+            FROM workspace_chart
+            WHERE workspace_id = $2 AND revision_number = $3
+        ),
+        inserted_charts AS (
+            INSERT INTO workspace_chart (id, revision_number, workspace_id, name)
+            SELECT new_id, $3, $1, name FROM chart_map
+        )
+        INSERT INTO workspace_file (
+            id, revision_number, chart_id, workspace_id, file_path,
+            content, content_sha, line_ending, embeddings, embeddings_provider, embeddings_dimensions
+        )
+        SELECT
+            substr(md5(random()::text || f.id), 1, 12), $3, chart_map.new_id, $1, f.file_path,
+            f.content, f.content_sha, f.line_ending, f.embeddings, f.embeddings_provider, f.embeddings_dimensions
+        FROM workspace_file f
+        LEFT JOIN chart_map ON chart_map.old_id = f.chart_id
+        WHERE f.workspace_id = $2 AND f.revision_number = $3
+    `, id, sourceWorkspaceID, revisionNumber)
+	if err != nil {
+		return fmt.Errorf("failed to copy charts and files: %w", err)
+	}
+
+	// the secrets found in the files are copied with them, the settings that acknowledge them aren't
+	_, err = q.Exec(ctx, `
+        INSERT INTO workspace_secret_finding (workspace_id, file_path, content_sha, idx, detector, line, fingerprint, redacted, created_at)
+        SELECT $1, file_path, content_sha, idx, detector, line, fingerprint, redacted, created_at
+        FROM workspace_secret_finding
+        WHERE workspace_id = $2
+    `, id, sourceWorkspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to copy secret findings: %w", err)
+	}
+
+	if !opts.IncludeChatHistory {
+		return nil
+	}
+
+	// Responses that point at plans, renders, conversions or revisions of the source are cleared
+	// since none of those are copied
+	_, err = q.Exec(ctx, `
+        INSERT INTO workspace_chat (
+            id, workspace_id, revision_number, created_at, sent_by, prompt, response,
+            is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic,
+            is_intent_chart_developer, is_intent_chart_operator, is_intent_proceed, is_intent_render,
+            is_canceled, message_from_persona
+        )
+        SELECT
+            substr(md5(random()::text || id), 1, 12), $1, revision_number, created_at, sent_by, prompt, response,
+            is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic,
+            is_intent_chart_developer, is_intent_chart_operator, is_intent_proceed, is_intent_render,
+            is_canceled, message_from_persona
+        FROM workspace_chat
+        WHERE workspace_id = $2 AND revision_number <= $3
+    `, id, sourceWorkspaceID, revisionNumber)
+	if err != nil {
+		return fmt.Errorf("failed to copy chat messages: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestForkWorkspaceIsIndependent forks a workspace and edits both copies, neither edit may show up
+// in the other workspace. It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestForkWorkspaceIsIndependent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping workspace fork integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	sourceID := "src-" + time.Now().Format("150405.000000")
+	forkID := "fork-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		for _, table := range []string{"workspace_file", "workspace_chart", "workspace_chat", "workspace_revision"} {
+			conn.Exec(context.Background(), `DELETE FROM `+table+` WHERE workspace_id = ANY($1)`, []string{sourceID, forkID})
+		}
+		conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = ANY($1)`, []string{sourceID, forkID})
+	})
+
+	seed := []string{
+		`INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number, conversation_summary)
+			VALUES ($1, NOW(), 'source', 'user', 'manual', 2, 'earlier the user added an ingress')`,
+		`INSERT INTO workspace_revision (workspace_id, revision_number, created_at, created_by_user_id, created_type, is_complete)
+			VALUES ($1, 1, NOW(), 'user', 'manual', true), ($1, 2, NOW(), 'user', 'plan', false)`,
+		`INSERT INTO workspace_chart (id, workspace_id, name, revision_number) VALUES ($1 || '-chart', $1, 'nginx', 1), ($1 || '-chart', $1, 'nginx', 2)`,
+		`INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content)
+			VALUES ($1 || '-values', 1, $1 || '-chart', $1, 'values.yaml', 'replicaCount: 1'),
+			       ($1 || '-values', 2, $1 || '-chart', $1, 'values.yaml', 'replicaCount: 5')`,
+		`INSERT INTO workspace_chat (id, workspace_id, revision_number, created_at, sent_by, prompt, response, response_plan_id)
+			VALUES ($1 || '-chat1', $1, 1, NOW(), 'user', 'add an ingress', 'done', 'plan-1'),
+			       ($1 || '-chat2', $1, 2, NOW(), 'user', 'scale up', NULL, 'plan-2')`,
+	}
+	for _, query := range seed {
+		_, err := conn.Exec(ctx, query, sourceID)
+		require.NoError(t, err)
+	}
+
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	require.NoError(t, forkWorkspaceInTx(ctx, tx, sourceID, forkID, "fork", "other-user", ForkWorkspaceOpts{IncludeChatHistory: true}))
+	require.NoError(t, tx.Commit(ctx))
+
+	// the fork is at the latest complete revision, not the incomplete one
+	var currentRevision int
+	var summary string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT current_revision_number, conversation_summary FROM workspace WHERE id = $1`, forkID).Scan(&currentRevision, &summary))
+	assert.Equal(t, 1, currentRevision)
+	assert.Equal(t, "earlier the user added an ingress", summary)
+
+	var forkChartID string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT id FROM workspace_chart WHERE workspace_id = $1 AND revision_number = 1`, forkID).Scan(&forkChartID))
+	assert.NotEqual(t, sourceID+"-chart", forkChartID)
+
+	forkFiles, err := ListFiles(ctx, forkID, 1, forkChartID)
+	require.NoError(t, err)
+	require.Len(t, forkFiles, 1)
+	assert.NotEqual(t, sourceID+"-values", forkFiles[0].ID)
+	assert.Equal(t, "replicaCount: 1", forkFiles[0].Content)
+
+	// only the chat from the copied revision, without its plan
+	var chats int
+	var planID *string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT COUNT(*), MAX(response_plan_id) FROM workspace_chat WHERE workspace_id = $1`, forkID).Scan(&chats, &planID))
+	assert.Equal(t, 1, chats)
+	assert.Nil(t, planID)
+
+	// editing either workspace leaves the other alone
+	_, err = conn.Exec(ctx, `UPDATE workspace_file SET content = 'replicaCount: 3' WHERE id = $1 AND revision_number = 1`, forkFiles[0].ID)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `UPDATE workspace_file SET content = 'replicaCount: 2' WHERE id = $1 AND revision_number = 1`, sourceID+"-values")
+	require.NoError(t, err)
+
+	sourceFiles, err := ListFiles(ctx, sourceID, 1, sourceID+"-chart")
+	require.NoError(t, err)
+	require.Len(t, sourceFiles, 1)
+	assert.Equal(t, "replicaCount: 2", sourceFiles[0].Content)
+
+	forkFiles, err = ListFiles(ctx, forkID, 1, forkChartID)
+	require.NoError(t, err)
+	require.Len(t, forkFiles, 1)
+	assert.Equal(t, "replicaCount: 3", forkFiles[0].Content)
+}
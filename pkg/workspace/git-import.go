@@ -0,0 +1,298 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+)
+
+// importedRevisionNumber is the revision a workspace created from an imported chart starts at, as
+// it is for archive and Artifact Hub imports
+const importedRevisionNumber = 1
+
+// ImportProgressInterval is how many files are imported between two reports of an import's progress
+const ImportProgressInterval = 25
+
+// ImportOpts are the options of CreateWorkspaceFromImport
+type ImportOpts struct {
+	// ImportType is what the imported files must be, a Helm chart when it's empty
+	ImportType types.ImportType
+	// ArchiveName is the name of the uploaded archive the files were read from, it's empty for
+	// imports from a repository
+	ArchiveName string
+	// SkippedBinaries is how many binary files the importer left out, for the import's stats
+	SkippedBinaries int
+	// BinaryFiles and OversizedFiles are the paths of the files the importer left out, for the
+	// import's report
+	BinaryFiles    []string
+	OversizedFiles []string
+	// Progress is called when the import starts, every ImportProgressInterval files, and when it
+	// completes or fails. It's called with the same progress that's stored on the workspace.
+	Progress func(workspaceID string, progress types.ImportProgress)
+}
+
+// CreateWorkspaceFromImport creates a workspace owned by userID with a chart imported from a
+// repository or an uploaded archive, recording the source for provenance. The workspace starts
+// with an answered chat message about the import, and its files are summarized and rendered like
+// the files of any new workspace. Files are normalized with NormalizeFileContent, and the secrets
+// in them are recorded.
+//
+// The files are validated with ValidateImport first, an import with fatal findings returns
+// ErrInvalidImport and no workspace is created. The report is stored on the workspace.
+//
+// The workspace is created first, so that the progress of the import is stored on it while the
+// files are inserted. An import that fails part way is marked failed with the error, and the
+// files it inserted are removed.
+func CreateWorkspaceFromImport(ctx context.Context, userID string, chartName string, files []types.File, source types.WorkspaceSource, opts ImportOpts) (*types.Workspace, error) {
+	logger.Info("Creating workspace from import",
+		zap.String("user_id", userID),
+		zap.String("source_url", source.URL),
+		zap.String("source_commit_sha", source.CommitSHA),
+		zap.String("archive_name", opts.ArchiveName),
+		zap.Int("files", len(files)))
+
+	report := ValidateImport(files, opts)
+	if fatal := report.Fatal(); len(fatal) > 0 {
+		messages := []string{}
+		for _, finding := range fatal {
+			messages = append(messages, finding.Message)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImport, strings.Join(messages, "; "))
+	}
+
+	id, err := securerandom.Hex(6)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate workspace ID: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	chatMessageID, err := importWorkspace(ctx, conn, id, userID, chartName, files, source, opts, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := NotifyWorkerToCaptureEmbeddings(ctx, id, importedRevisionNumber); err != nil {
+		return nil, fmt.Errorf("failed to enqueue summaries: %w", err)
+	}
+	if err := EnqueueRenderWorkspaceForRevision(ctx, id, importedRevisionNumber, chatMessageID); err != nil {
+		return nil, fmt.Errorf("failed to enqueue render: %w", err)
+	}
+
+	return GetWorkspace(ctx, id)
+}
+
+// importWorkspace inserts the workspace, its chart and files and the chat message about the
+// import, reporting progress as it goes, and returns the ID of the chat message
+func importWorkspace(ctx context.Context, q revisionQuerier, id string, userID string, chartName string, files []types.File, source types.WorkspaceSource, opts ImportOpts, report types.ImportReport) (string, error) {
+	progress := types.ImportProgress{Status: types.ImportStatusImporting, FilesTotal: len(files)}
+	encoded, err := json.Marshal(progress)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal import progress: %w", err)
+	}
+	encodedReport, err := json.Marshal(report)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal import report: %w", err)
+	}
+
+	createdType := "git"
+	if opts.ArchiveName != "" {
+		createdType = "archive"
+	}
+	_, err = q.Exec(ctx, `
+        INSERT INTO workspace (
+            id, created_at, last_updated_at, name, created_by_user_id, created_type, current_revision_number,
+            source_url, source_ref, source_subdirectory, source_commit_sha, import_progress, import_report
+        )
+        VALUES ($1, NOW(), NOW(), $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11)
+    `, id, chartName, userID, createdType, importedRevisionNumber, source.URL, source.Ref, source.Subdirectory, source.CommitSHA, encoded, encodedReport)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert workspace: %w", err)
+	}
+	reportImportProgress(opts, id, progress)
+
+	chatMessageID, err := importWorkspaceContent(ctx, q, id, userID, chartName, files, source, opts, &progress)
+	if err != nil {
+		// the import is marked failed even when the request that started it was canceled
+		failImport(context.WithoutCancel(ctx), q, id, opts, progress, err)
+		return "", err
+	}
+
+	progress.Status = types.ImportStatusComplete
+	progress.CurrentPath = ""
+	progress.Stats = &types.ImportStats{
+		Files:           len(files),
+		Charts:          countCharts(files),
+		SkippedBinaries: opts.SkippedBinaries,
+	}
+	if err := setImportProgress(ctx, q, id, progress); err != nil {
+		return "", err
+	}
+	reportImportProgress(opts, id, progress)
+
+	return chatMessageID, nil
+}
+
+// importWorkspaceContent inserts everything of an imported workspace but the workspace itself,
+// and completes its revision
+func importWorkspaceContent(ctx context.Context, q revisionQuerier, id string, userID string, chartName string, files []types.File, source types.WorkspaceSource, opts ImportOpts, progress *types.ImportProgress) (string, error) {
+	// the revision is completed once every file is in
+	_, err := q.Exec(ctx, `
+        INSERT INTO workspace_revision (
+            workspace_id, revision_number, created_at,
+            created_by_user_id, created_type, is_complete, is_rendered
+        )
+        VALUES ($1, $2, NOW(), $3, 'git', false, false)
+    `, id, importedRevisionNumber, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert revision: %w", err)
+	}
+
+	chartID, err := securerandom.Hex(6)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate chart ID: %w", err)
+	}
+	_, err = q.Exec(ctx, `INSERT INTO workspace_chart (id, workspace_id, name, revision_number) VALUES ($1, $2, $3, $4)`,
+		chartID, id, chartName, importedRevisionNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert chart: %w", err)
+	}
+
+	for _, file := range files {
+		// a new workspace doesn't preserve line endings, the style is recorded for export
+		content, lineEnding, err := NormalizeFileContent(file.FilePath, file.Content, true)
+		if err != nil {
+			return "", err
+		}
+		fileID, err := securerandom.Hex(6)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate file ID: %w", err)
+		}
+		_, err = q.Exec(ctx, `
+            INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, line_ending)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+        `, fileID, importedRevisionNumber, chartID, id, file.FilePath, content, contentSHA(content), lineEnding)
+		if err != nil {
+			return "", fmt.Errorf("failed to insert file %s: %w", file.FilePath, err)
+		}
+		if _, err := recordSecretFindings(ctx, q, id, file.FilePath, content); err != nil {
+			return "", err
+		}
+
+		progress.FilesProcessed++
+		progress.CurrentPath = file.FilePath
+		if progress.FilesProcessed%ImportProgressInterval == 0 && progress.FilesProcessed < progress.FilesTotal {
+			if err := setImportProgress(ctx, q, id, *progress); err != nil {
+				return "", err
+			}
+			reportImportProgress(opts, id, *progress)
+		}
+	}
+
+	chatMessageID, err := securerandom.Hex(6)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate chat message ID: %w", err)
+	}
+	followupActions, err := json.Marshal([]types.FollowupAction{{Action: "render", Label: "Render the chart"}})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal followup actions: %w", err)
+	}
+	prompt, response := importChatMessage(chartName, source, opts.ArchiveName)
+	_, err = q.Exec(ctx, `
+        INSERT INTO workspace_chat (
+            id, workspace_id, revision_number, created_at, sent_by, prompt, response,
+            is_canceled, is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic,
+            is_intent_chart_developer, is_intent_chart_operator, is_intent_render,
+            followup_actions, response_rollback_to_revision_number, message_from_persona
+        )
+        VALUES ($1, $2, $3, NOW(), $4, $5, $6, false, true, true, false, false, false, false, false, $7, $3, $8)
+    `, chatMessageID, id, importedRevisionNumber, userID, prompt, response, followupActions, types.ChatMessageFromPersonaAuto)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert chat message: %w", err)
+	}
+
+	_, err = q.Exec(ctx, `UPDATE workspace_revision SET is_complete = true WHERE workspace_id = $1 AND revision_number = $2`, id, importedRevisionNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to complete revision: %w", err)
+	}
+
+	return chatMessageID, nil
+}
+
+// failImport removes the files an import inserted before it failed, and marks it failed
+func failImport(ctx context.Context, q revisionQuerier, id string, opts ImportOpts, progress types.ImportProgress, importErr error) {
+	if _, err := q.Exec(ctx, `DELETE FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2`, id, importedRevisionNumber); err != nil {
+		logger.Error(fmt.Errorf("failed to remove the files of a failed import: %w", err), zap.String("workspaceID", id))
+	}
+	if _, err := q.Exec(ctx, `DELETE FROM workspace_secret_finding WHERE workspace_id = $1`, id); err != nil {
+		logger.Error(fmt.Errorf("failed to remove the secret findings of a failed import: %w", err), zap.String("workspaceID", id))
+	}
+
+	progress.Status = types.ImportStatusFailed
+	progress.Error = importErr.Error()
+	if err := setImportProgress(ctx, q, id, progress); err != nil {
+		logger.Error(err, zap.String("workspaceID", id))
+	}
+	reportImportProgress(opts, id, progress)
+}
+
+func setImportProgress(ctx context.Context, q revisionQuerier, id string, progress types.ImportProgress) error {
+	encoded, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("failed to marshal import progress: %w", err)
+	}
+	if _, err := q.Exec(ctx, `UPDATE workspace SET import_progress = $2 WHERE id = $1`, id, encoded); err != nil {
+		return fmt.Errorf("failed to set import progress: %w", err)
+	}
+	return nil
+}
+
+func reportImportProgress(opts ImportOpts, id string, progress types.ImportProgress) {
+	if opts.Progress != nil {
+		opts.Progress(id, progress)
+	}
+}
+
+// countCharts counts the Chart.yaml files of an import, subcharts included
+func countCharts(files []types.File) int {
+	charts := 0
+	for _, file := range files {
+		if path.Base(file.FilePath) == "Chart.yaml" {
+			charts++
+		}
+	}
+	return charts
+}
+
+func importChatMessage(chartName string, source types.WorkspaceSource, archiveName string) (string, string) {
+	if archiveName != "" {
+		prompt := fmt.Sprintf("Import the Helm chart from the uploaded file named %s", archiveName)
+		response := fmt.Sprintf("Got it. I found a %s chart in the %s file and finished importing it. What's next?", chartName, archiveName)
+		return prompt, response
+	}
+
+	location := source.URL
+	if source.Subdirectory != "" {
+		location = fmt.Sprintf("%s in %s", source.Subdirectory, source.URL)
+	}
+	commit := source.CommitSHA
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+
+	prompt := fmt.Sprintf("Import the Helm chart from the Git repository %s", location)
+	if source.Ref != "" {
+		prompt = fmt.Sprintf("%s at %s", prompt, source.Ref)
+	}
+	response := fmt.Sprintf("Got it. I found a %s chart at commit %s of %s and finished importing it. What's next?", chartName, commit, location)
+	return prompt, response
+}
@@ -0,0 +1,262 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportChatMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       types.WorkspaceSource
+		archiveName  string
+		wantPrompt   string
+		wantResponse string
+	}{
+		{
+			name:         "default branch",
+			source:       types.WorkspaceSource{URL: "https://github.com/org/charts", CommitSHA: "0123456789abcdef0123"},
+			wantPrompt:   "Import the Helm chart from the Git repository https://github.com/org/charts",
+			wantResponse: "Got it. I found a nginx chart at commit 0123456789ab of https://github.com/org/charts and finished importing it. What's next?",
+		},
+		{
+			name:         "ref and subdirectory",
+			source:       types.WorkspaceSource{URL: "https://github.com/org/charts", Ref: "v1.2.0", Subdirectory: "charts/nginx", CommitSHA: "abc"},
+			wantPrompt:   "Import the Helm chart from the Git repository charts/nginx in https://github.com/org/charts at v1.2.0",
+			wantResponse: "Got it. I found a nginx chart at commit abc of charts/nginx in https://github.com/org/charts and finished importing it. What's next?",
+		},
+		{
+			name:         "archive",
+			archiveName:  "nginx-1.2.0.tgz",
+			wantPrompt:   "Import the Helm chart from the uploaded file named nginx-1.2.0.tgz",
+			wantResponse: "Got it. I found a nginx chart in the nginx-1.2.0.tgz file and finished importing it. What's next?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, response := importChatMessage("nginx", tt.source, tt.archiveName)
+			assert.Equal(t, tt.wantPrompt, prompt)
+			assert.Equal(t, tt.wantResponse, response)
+		})
+	}
+}
+
+// TestCreateImportedWorkspace creates a workspace from an imported chart and checks its source,
+// files and chat message. It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestCreateImportedWorkspace(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping git import integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	id := "git-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		for _, table := range []string{"workspace_file", "workspace_chart", "workspace_chat", "workspace_revision"} {
+			conn.Exec(context.Background(), `DELETE FROM `+table+` WHERE workspace_id = $1`, id)
+		}
+		conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = $1`, id)
+	})
+
+	files := []types.File{
+		{FilePath: "Chart.yaml", Content: "name: nginx\n"},
+		{FilePath: "values.yaml", Content: "replicaCount: 1\n"},
+	}
+	source := types.WorkspaceSource{URL: "https://github.com/org/charts", Subdirectory: "charts/nginx", CommitSHA: "0123456789abcdef"}
+
+	report := ValidateImport(files, ImportOpts{})
+	chatMessageID, err := importWorkspace(ctx, conn, id, "user", "nginx", files, source, ImportOpts{}, report)
+	require.NoError(t, err)
+
+	var name, createdType, sourceURL, commitSHA string
+	var ref *string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT name, created_type, source_url, source_ref, source_commit_sha FROM workspace WHERE id = $1`, id).
+		Scan(&name, &createdType, &sourceURL, &ref, &commitSHA))
+	assert.Equal(t, "nginx", name)
+	assert.Equal(t, "git", createdType)
+	assert.Equal(t, source.URL, sourceURL)
+	assert.Nil(t, ref, "the default branch is stored as NULL")
+	assert.Equal(t, source.CommitSHA, commitSHA)
+
+	var chartID string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT id FROM workspace_chart WHERE workspace_id = $1 AND revision_number = 1`, id).Scan(&chartID))
+	stored, err := ListFiles(ctx, id, 1, chartID)
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+
+	var response string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT response FROM workspace_chat WHERE id = $1`, chatMessageID).Scan(&response))
+	assert.Contains(t, response, "found a nginx chart at commit 0123456789ab")
+
+	var isComplete bool
+	require.NoError(t, conn.QueryRow(ctx, `SELECT is_complete FROM workspace_revision WHERE workspace_id = $1 AND revision_number = 1`, id).Scan(&isComplete))
+	assert.True(t, isComplete)
+
+	var progress types.ImportProgress
+	require.NoError(t, conn.QueryRow(ctx, `SELECT import_progress FROM workspace WHERE id = $1`, id).Scan(&progress))
+	assert.Equal(t, types.ImportStatusComplete, progress.Status)
+	assert.Equal(t, &types.ImportStats{Files: 2, Charts: 1}, progress.Stats)
+
+	// the Chart.yaml has no apiVersion or version, the import goes on with the warnings stored
+	var storedReport types.ImportReport
+	require.NoError(t, conn.QueryRow(ctx, `SELECT import_report FROM workspace WHERE id = $1`, id).Scan(&storedReport))
+	assert.Equal(t, report, storedReport)
+	assert.Len(t, storedReport.Findings, 2)
+}
+
+// importRecorder is a database that records the statements of an import, failing the insert of
+// one file
+type importRecorder struct {
+	failPath   string
+	statements []string
+	progress   []types.ImportProgress
+	files      map[string]bool
+	// secrets are the file path and detector of every secret finding inserted
+	secrets []string
+}
+
+func (r *importRecorder) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	statement := strings.Join(strings.Fields(sql), " ")
+	r.statements = append(r.statements, statement)
+	switch {
+	case strings.HasPrefix(statement, "INSERT INTO workspace_file"):
+		if args[4] == r.failPath {
+			return pgconn.CommandTag{}, errors.New("disk full")
+		}
+		r.files[args[4].(string)] = true
+	case strings.HasPrefix(statement, "DELETE FROM workspace_file"):
+		r.files = map[string]bool{}
+	case strings.HasPrefix(statement, "INSERT INTO workspace_secret_finding"):
+		r.secrets = append(r.secrets, fmt.Sprintf("%s %s", args[1], args[4]))
+	case statement == "DELETE FROM workspace_secret_finding WHERE workspace_id = $1":
+		r.secrets = nil
+	case strings.HasPrefix(statement, "UPDATE workspace SET import_progress"):
+		var progress types.ImportProgress
+		if err := json.Unmarshal(args[1].([]byte), &progress); err != nil {
+			return pgconn.CommandTag{}, err
+		}
+		r.progress = append(r.progress, progress)
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (r *importRecorder) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	panic("unexpected query: " + sql)
+}
+
+// syntheticArchive is a chart with a Chart.yaml, a values.yaml and templates, n files in all
+func syntheticArchive(n int) []types.File {
+	files := []types.File{
+		{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: big\nversion: 1.0.0\n"},
+		{FilePath: "values.yaml", Content: "replicaCount: 1\n"},
+	}
+	for i := len(files); i < n; i++ {
+		files = append(files, types.File{
+			FilePath: fmt.Sprintf("templates/configmap-%03d.yaml", i),
+			Content:  fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm-%03d\n", i),
+		})
+	}
+	return files
+}
+
+func TestImportWorkspaceProgress(t *testing.T) {
+	files := syntheticArchive(250)
+	db := &importRecorder{files: map[string]bool{}}
+
+	reported := []types.ImportProgress{}
+	opts := ImportOpts{
+		SkippedBinaries: 3,
+		Progress: func(workspaceID string, progress types.ImportProgress) {
+			assert.Equal(t, "big", workspaceID)
+			reported = append(reported, progress)
+		},
+	}
+
+	_, err := importWorkspace(context.Background(), db, "big", "user", "big", files, types.WorkspaceSource{URL: "https://github.com/org/charts"}, opts, types.ImportReport{})
+	require.NoError(t, err)
+	assert.Len(t, db.files, 250)
+
+	// a report when the import starts, every 25 files, and when it's complete
+	require.Len(t, reported, 1+9+1)
+	assert.Equal(t, types.ImportProgress{Status: types.ImportStatusImporting, FilesTotal: 250}, reported[0])
+	for i, progress := range reported[1:10] {
+		assert.Equal(t, types.ImportStatusImporting, progress.Status)
+		assert.Equal(t, (i+1)*ImportProgressInterval, progress.FilesProcessed)
+		assert.Equal(t, 250, progress.FilesTotal)
+		assert.Equal(t, files[progress.FilesProcessed-1].FilePath, progress.CurrentPath)
+	}
+	assert.Equal(t, types.ImportProgress{
+		Status:         types.ImportStatusComplete,
+		FilesProcessed: 250,
+		FilesTotal:     250,
+		Stats:          &types.ImportStats{Files: 250, Charts: 1, SkippedBinaries: 3},
+	}, reported[10])
+
+	// the progress is stored on the workspace as it's reported
+	assert.Equal(t, reported[1:], db.progress)
+	assert.Equal(t, "UPDATE workspace_revision SET is_complete = true WHERE workspace_id = $1 AND revision_number = $2", db.statements[len(db.statements)-2])
+}
+
+func TestImportWorkspaceFailure(t *testing.T) {
+	files := syntheticArchive(250)
+	db := &importRecorder{files: map[string]bool{}, failPath: files[119].FilePath}
+
+	reported := []types.ImportProgress{}
+	opts := ImportOpts{Progress: func(workspaceID string, progress types.ImportProgress) {
+		reported = append(reported, progress)
+	}}
+
+	_, err := importWorkspace(context.Background(), db, "big", "user", "big", files, types.WorkspaceSource{}, opts, types.ImportReport{})
+	require.ErrorContains(t, err, "failed to insert file templates/configmap-119.yaml: disk full")
+
+	// the files of the aborted revision are removed and the import is marked failed
+	assert.Empty(t, db.files)
+	assert.Empty(t, db.secrets)
+	failed := reported[len(reported)-1]
+	assert.Equal(t, types.ImportStatusFailed, failed.Status)
+	assert.Equal(t, 119, failed.FilesProcessed)
+	assert.Equal(t, 250, failed.FilesTotal)
+	assert.Contains(t, failed.Error, "disk full")
+	assert.Nil(t, failed.Stats)
+	assert.Equal(t, failed, db.progress[len(db.progress)-1])
+
+	for _, statement := range db.statements {
+		assert.NotContains(t, statement, "INSERT INTO workspace_chat")
+		assert.NotContains(t, statement, "SET is_complete = true")
+	}
+}
+
+func TestImportWorkspaceSecrets(t *testing.T) {
+	files := syntheticArchive(3)
+	files[1].Content = "backup:\n  accessKeyId: AKIAUJZDE8GXD6NCF10E\n"
+	db := &importRecorder{files: map[string]bool{}}
+
+	_, err := importWorkspace(context.Background(), db, "secrets", "user", "big", files, types.WorkspaceSource{}, ImportOpts{}, types.ImportReport{})
+	require.NoError(t, err)
+
+	// only the file with a secret has findings to store
+	assert.Equal(t, []string{"values.yaml aws-access-key-id"}, db.secrets)
+}
@@ -0,0 +1,187 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrInvalidImport is returned when validating the files of an import finds a fatal problem, the
+// workspace isn't created
+var ErrInvalidImport = errors.New("invalid import")
+
+// ValidateImport checks the files of an import for what makes a chart fail to render or surprise
+// its users later: a missing or invalid Chart.yaml, templates that don't parse, and paths that
+// differ only in case. The files the importer left out for being binary or too large are reported
+// too. Templates are parsed, not executed, so functions don't have to be defined.
+//
+// A Helm import without a Chart.yaml is fatal, everything else is a warning and the import goes on.
+func ValidateImport(files []types.File, opts ImportOpts) types.ImportReport {
+	report := types.ImportReport{Findings: []types.ImportFinding{}}
+
+	chartYAML := findFile(files, "Chart.yaml")
+	switch {
+	case chartYAML == nil && importTypeOf(opts) == types.ImportTypeHelm:
+		report.Findings = append(report.Findings, types.ImportFinding{
+			Category: types.ImportFindingMissingChartYAML,
+			Severity: types.ImportFindingFatal,
+			Message:  "there's no Chart.yaml at the root of the imported files, they aren't a Helm chart",
+		})
+	case chartYAML != nil:
+		for _, problem := range chartYAMLProblems(chartYAML.Content) {
+			report.Findings = append(report.Findings, types.ImportFinding{
+				Category: types.ImportFindingInvalidChartYAML,
+				Severity: types.ImportFindingWarning,
+				Path:     chartYAML.FilePath,
+				Message:  problem,
+			})
+		}
+	}
+
+	for _, file := range files {
+		if !isTemplateFile(file.FilePath) {
+			continue
+		}
+		if err := parseTemplate(file); err != nil {
+			report.Findings = append(report.Findings, types.ImportFinding{
+				Category: types.ImportFindingTemplateParse,
+				Severity: types.ImportFindingWarning,
+				Path:     file.FilePath,
+				Message:  err.Error(),
+			})
+		}
+	}
+
+	for _, filePath := range opts.OversizedFiles {
+		report.Findings = append(report.Findings, types.ImportFinding{
+			Category: types.ImportFindingFileTooLarge,
+			Severity: types.ImportFindingWarning,
+			Path:     filePath,
+			Message:  "the file is larger than the size limit and wasn't imported",
+		})
+	}
+	for _, filePath := range opts.BinaryFiles {
+		report.Findings = append(report.Findings, types.ImportFinding{
+			Category: types.ImportFindingBinaryFile,
+			Severity: types.ImportFindingWarning,
+			Path:     filePath,
+			Message:  "the file is binary and wasn't imported",
+		})
+	}
+
+	for _, paths := range caseDuplicates(files) {
+		report.Findings = append(report.Findings, types.ImportFinding{
+			Category: types.ImportFindingCaseDuplicate,
+			Severity: types.ImportFindingWarning,
+			Path:     paths[0],
+			Message:  fmt.Sprintf("the paths %s differ only in case, they're the same file on case insensitive file systems", strings.Join(paths, ", ")),
+		})
+	}
+
+	return report
+}
+
+// importTypeOf is the import type of opts, Helm when it isn't set
+func importTypeOf(opts ImportOpts) types.ImportType {
+	if opts.ImportType == "" {
+		return types.ImportTypeHelm
+	}
+	return opts.ImportType
+}
+
+func findFile(files []types.File, filePath string) *types.File {
+	for i := range files {
+		if files[i].FilePath == filePath {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+// chartYAMLProblems returns what's wrong with the fields of a Chart.yaml, the checks helm lint
+// makes that fail an install
+func chartYAMLProblems(content string) []string {
+	manifest, err := ParseChartManifest(content)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	problems := []string{}
+	switch manifest.APIVersion {
+	case "":
+		problems = append(problems, "apiVersion is required")
+	case "v1", "v2":
+	default:
+		problems = append(problems, fmt.Sprintf("apiVersion %q is not v1 or v2", manifest.APIVersion))
+	}
+	if manifest.Name == "" {
+		problems = append(problems, "name is required")
+	} else if strings.ContainsAny(manifest.Name, `/\`) || strings.Contains(manifest.Name, "..") {
+		problems = append(problems, fmt.Sprintf("name %q can't contain a path", manifest.Name))
+	}
+	if manifest.Version == "" {
+		problems = append(problems, "version is required")
+	} else if _, err := semver.NewVersion(manifest.Version); err != nil {
+		problems = append(problems, fmt.Sprintf("version %q is not semver", manifest.Version))
+	}
+	switch manifest.Type {
+	case "", "application", "library":
+	default:
+		problems = append(problems, fmt.Sprintf("type %q is not application or library", manifest.Type))
+	}
+	for i, dependency := range manifest.Dependencies {
+		if dependency.Name == "" {
+			problems = append(problems, fmt.Sprintf("dependency %d has no name", i+1))
+		}
+	}
+	return problems
+}
+
+// isTemplateFile is true for the files helm renders as templates
+func isTemplateFile(filePath string) bool {
+	if !strings.HasPrefix(filePath, "templates/") {
+		return false
+	}
+	switch path.Ext(filePath) {
+	case ".yaml", ".yml", ".tpl", ".txt":
+		return true
+	}
+	return false
+}
+
+// parseTemplate parses a template the way helm does, without checking that the functions it calls
+// exist, helm and sprig define them
+func parseTemplate(file types.File) error {
+	tree := parse.New(file.FilePath)
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(file.Content, "", "", map[string]*parse.Tree{}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// caseDuplicates returns the groups of paths that differ only in case, each sorted, in the order
+// of their first path
+func caseDuplicates(files []types.File) [][]string {
+	byFolded := map[string][]string{}
+	for _, file := range files {
+		folded := strings.ToLower(file.FilePath)
+		byFolded[folded] = append(byFolded[folded], file.FilePath)
+	}
+
+	duplicates := [][]string{}
+	for _, paths := range byFolded {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			duplicates = append(duplicates, paths)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i][0] < duplicates[j][0] })
+	return duplicates
+}
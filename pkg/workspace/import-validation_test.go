@@ -0,0 +1,146 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validChartYAML = "apiVersion: v2\nname: nginx\nversion: 1.2.0\n"
+
+func TestValidateImport(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []types.File
+		opts  ImportOpts
+		want  []types.ImportFinding
+	}{
+		{
+			name: "valid chart",
+			files: []types.File{
+				{FilePath: "Chart.yaml", Content: validChartYAML},
+				{FilePath: "templates/deployment.yaml", Content: "replicas: {{ .Values.replicaCount | default 1 }}\n"},
+				{FilePath: "templates/_helpers.tpl", Content: `{{- define "nginx.name" -}}{{ include "nginx.fullname" . | trunc 63 }}{{- end }}`},
+			},
+			want: []types.ImportFinding{},
+		},
+		{
+			name:  "missing Chart.yaml",
+			files: []types.File{{FilePath: "values.yaml", Content: "replicaCount: 1\n"}},
+			want: []types.ImportFinding{{
+				Category: types.ImportFindingMissingChartYAML,
+				Severity: types.ImportFindingFatal,
+				Message:  "there's no Chart.yaml at the root of the imported files, they aren't a Helm chart",
+			}},
+		},
+		{
+			name:  "Kubernetes manifests don't need a Chart.yaml",
+			files: []types.File{{FilePath: "deployment.yaml", Content: "kind: Deployment\n"}},
+			opts:  ImportOpts{ImportType: types.ImportTypeK8s},
+			want:  []types.ImportFinding{},
+		},
+		{
+			name:  "invalid Chart.yaml fields",
+			files: []types.File{{FilePath: "Chart.yaml", Content: "apiVersion: v3\nname: charts/nginx\nversion: latest\ntype: plugin\ndependencies:\n- version: 1.0.0\n"}},
+			want: []types.ImportFinding{
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: `apiVersion "v3" is not v1 or v2`},
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: `name "charts/nginx" can't contain a path`},
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: `version "latest" is not semver`},
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: `type "plugin" is not application or library`},
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: "dependency 1 has no name"},
+			},
+		},
+		{
+			name:  "missing Chart.yaml fields",
+			files: []types.File{{FilePath: "Chart.yaml", Content: "description: a chart\n"}},
+			want: []types.ImportFinding{
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: "apiVersion is required"},
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: "name is required"},
+				{Category: types.ImportFindingInvalidChartYAML, Severity: types.ImportFindingWarning, Path: "Chart.yaml", Message: "version is required"},
+			},
+		},
+		{
+			name:  "unparseable Chart.yaml",
+			files: []types.File{{FilePath: "Chart.yaml", Content: "name: [nginx\n"}},
+			want: []types.ImportFinding{{
+				Category: types.ImportFindingInvalidChartYAML,
+				Severity: types.ImportFindingWarning,
+				Path:     "Chart.yaml",
+				Message:  "invalid chart manifest: failed to parse Chart.yaml: yaml: line 1: did not find expected ',' or ']'",
+			}},
+		},
+		{
+			name: "template that doesn't parse",
+			files: []types.File{
+				{FilePath: "Chart.yaml", Content: validChartYAML},
+				{FilePath: "templates/deployment.yaml", Content: "metadata:\n  name: {{ .Release.Name }\n"},
+				{FilePath: "templates/NOTES.txt", Content: "{{ if .Values.ingress.enabled }}\nhttp://{{ .Values.ingress.host }}\n"},
+				// files helm doesn't render aren't parsed
+				{FilePath: "templates/README.md", Content: "{{ unclosed"},
+				{FilePath: "files/config.yaml", Content: "{{ unclosed"},
+			},
+			want: []types.ImportFinding{
+				{Category: types.ImportFindingTemplateParse, Severity: types.ImportFindingWarning, Path: "templates/deployment.yaml", Message: `template: templates/deployment.yaml:2: unexpected "}" in operand`},
+				{Category: types.ImportFindingTemplateParse, Severity: types.ImportFindingWarning, Path: "templates/NOTES.txt", Message: "template: templates/NOTES.txt:3: unexpected EOF"},
+			},
+		},
+		{
+			name:  "files left out for their size",
+			files: []types.File{{FilePath: "Chart.yaml", Content: validChartYAML}},
+			opts:  ImportOpts{OversizedFiles: []string{"files/dump.sql"}},
+			want: []types.ImportFinding{{
+				Category: types.ImportFindingFileTooLarge,
+				Severity: types.ImportFindingWarning,
+				Path:     "files/dump.sql",
+				Message:  "the file is larger than the size limit and wasn't imported",
+			}},
+		},
+		{
+			name:  "binary files",
+			files: []types.File{{FilePath: "Chart.yaml", Content: validChartYAML}},
+			opts:  ImportOpts{SkippedBinaries: 1, BinaryFiles: []string{"files/logo.png"}},
+			want: []types.ImportFinding{{
+				Category: types.ImportFindingBinaryFile,
+				Severity: types.ImportFindingWarning,
+				Path:     "files/logo.png",
+				Message:  "the file is binary and wasn't imported",
+			}},
+		},
+		{
+			name: "paths that differ only in case",
+			files: []types.File{
+				{FilePath: "Chart.yaml", Content: validChartYAML},
+				{FilePath: "templates/service.yaml", Content: "kind: Service\n"},
+				{FilePath: "templates/Service.yaml", Content: "kind: Service\n"},
+				{FilePath: "templates/deployment.yaml", Content: "kind: Deployment\n"},
+			},
+			want: []types.ImportFinding{{
+				Category: types.ImportFindingCaseDuplicate,
+				Severity: types.ImportFindingWarning,
+				Path:     "templates/Service.yaml",
+				Message:  "the paths templates/Service.yaml, templates/service.yaml differ only in case, they're the same file on case insensitive file systems",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := ValidateImport(tt.files, tt.opts)
+			assert.Equal(t, tt.want, report.Findings)
+		})
+	}
+}
+
+func TestImportReportFatal(t *testing.T) {
+	report := ValidateImport([]types.File{
+		{FilePath: "values.yaml", Content: "replicaCount: 1\n"},
+		{FilePath: "templates/a.yaml", Content: "{{ unclosed"},
+	}, ImportOpts{})
+	require.Len(t, report.Findings, 2)
+
+	fatal := report.Fatal()
+	require.Len(t, fatal, 1)
+	assert.Equal(t, types.ImportFindingMissingChartYAML, fatal[0].Category)
+}
@@ -0,0 +1,64 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidEncoding is returned when a file written to a workspace isn't valid UTF-8
+var ErrInvalidEncoding = errors.New("file is not valid UTF-8")
+
+// the line ending styles recorded for a file, LF is recorded as an empty string
+const (
+	LineEndingLF   = ""
+	LineEndingCRLF = "crlf"
+)
+
+const utf8BOM = "\ufeff"
+
+// NormalizeFileContent prepares content for storage in a workspace. A UTF-8 byte order mark is
+// removed and, when convertCRLF is set, CRLF line endings are converted to LF so that edits sent
+// with LF line endings match. The line ending style the content arrived with is returned so that
+// it can be restored on export. Content that isn't valid UTF-8 is rejected.
+func NormalizeFileContent(path string, content string, convertCRLF bool) (string, string, error) {
+	if !utf8.ValidString(content) {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidEncoding, path)
+	}
+
+	content = strings.TrimPrefix(content, utf8BOM)
+	lineEnding := DetectLineEnding(content)
+	if convertCRLF {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	return content, lineEnding, nil
+}
+
+// DetectLineEnding returns the line ending style most lines of content end with
+func DetectLineEnding(content string) string {
+	crlf := strings.Count(content, "\r\n")
+	if crlf > 0 && crlf >= strings.Count(content, "\n")-crlf {
+		return LineEndingCRLF
+	}
+	return LineEndingLF
+}
+
+// RestoreLineEnding converts LF line endings in content back to the style it was imported with
+func RestoreLineEnding(content string, lineEnding string) string {
+	if lineEnding != LineEndingCRLF {
+		return content
+	}
+	return strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// SetPreserveLineEndings turns converting CRLF line endings to LF on file writes off or on for a
+// workspace. Byte order marks are removed and encodings are validated either way.
+func SetPreserveLineEndings(ctx context.Context, workspaceID string, preserve bool) error {
+	if err := SetSetting(ctx, workspaceID, SettingPreserveLineEndings, preserve); err != nil {
+		return fmt.Errorf("error updating preserve line endings: %w", err)
+	}
+
+	return nil
+}
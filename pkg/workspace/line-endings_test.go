@@ -0,0 +1,48 @@
+package workspace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeFileContent(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		convertCRLF    bool
+		wantContent    string
+		wantLineEnding string
+	}{
+		{name: "lf", content: "a: 1\nb: 2\n", convertCRLF: true, wantContent: "a: 1\nb: 2\n", wantLineEnding: LineEndingLF},
+		{name: "crlf", content: "a: 1\r\nb: 2\r\n", convertCRLF: true, wantContent: "a: 1\nb: 2\n", wantLineEnding: LineEndingCRLF},
+		{name: "crlf preserved", content: "a: 1\r\nb: 2\r\n", wantContent: "a: 1\r\nb: 2\r\n", wantLineEnding: LineEndingCRLF},
+		{name: "bom", content: "\ufeffa: 1\n", convertCRLF: true, wantContent: "a: 1\n", wantLineEnding: LineEndingLF},
+		{name: "bom removed when preserving", content: "\ufeffa: 1\r\n", wantContent: "a: 1\r\n", wantLineEnding: LineEndingCRLF},
+		{name: "mostly lf", content: "a: 1\nb: 2\nc: 3\r\n", convertCRLF: true, wantContent: "a: 1\nb: 2\nc: 3\n", wantLineEnding: LineEndingLF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, lineEnding, err := NormalizeFileContent("values.yaml", tt.content, tt.convertCRLF)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantContent, content)
+			assert.Equal(t, tt.wantLineEnding, lineEnding)
+		})
+	}
+
+	_, _, err := NormalizeFileContent("templates/latin1.yaml", "name: caf\xe9\n", true)
+	assert.True(t, errors.Is(err, ErrInvalidEncoding))
+	assert.Contains(t, err.Error(), "templates/latin1.yaml")
+}
+
+func TestRestoreLineEnding(t *testing.T) {
+	content, lineEnding, err := NormalizeFileContent("values.yaml", "a: 1\r\nb: 2\r\n", true)
+	require.NoError(t, err)
+
+	// an edit made with LF line endings is exported with the file's CRLF line endings
+	edited := content + "c: 3\n"
+	assert.Equal(t, "a: 1\r\nb: 2\r\nc: 3\r\n", RestoreLineEnding(edited, lineEnding))
+	assert.Equal(t, "a: 1\nb: 2\n", RestoreLineEnding(content, LineEndingLF))
+}
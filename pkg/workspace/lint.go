@@ -0,0 +1,72 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+)
+
+// SetLintFindings replaces the lint findings of a chart at a revision
+func SetLintFindings(ctx context.Context, workspaceID string, revisionNumber int, chartID string, findings []lintrules.Finding) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM workspace_lint_finding WHERE workspace_id = $1 AND revision_number = $2 AND chart_id = $3`
+	if _, err := tx.Exec(ctx, query, workspaceID, revisionNumber, chartID); err != nil {
+		return fmt.Errorf("failed to delete lint findings: %w", err)
+	}
+
+	now := time.Now()
+	query = `INSERT INTO workspace_lint_finding (workspace_id, revision_number, chart_id, idx, rule_id, severity, file_path, line, message, suggestion, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11)`
+	for i, f := range findings {
+		if _, err := tx.Exec(ctx, query, workspaceID, revisionNumber, chartID, i, f.RuleID, f.Severity, f.FilePath, f.Line, f.Message, f.Suggestion, now); err != nil {
+			return fmt.Errorf("failed to insert lint finding: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListLintFindings returns the lint findings of every chart in a workspace at a revision
+func ListLintFindings(ctx context.Context, workspaceID string, revisionNumber int) ([]lintrules.Finding, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT rule_id, severity, file_path, line, message, COALESCE(suggestion, '')
+		FROM workspace_lint_finding
+		WHERE workspace_id = $1 AND revision_number = $2
+		ORDER BY chart_id, idx`
+	rows, err := conn.Query(ctx, query, workspaceID, revisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lint findings: %w", err)
+	}
+	defer rows.Close()
+
+	findings := []lintrules.Finding{}
+	for rows.Next() {
+		var f lintrules.Finding
+		if err := rows.Scan(&f.RuleID, &f.Severity, &f.FilePath, &f.Line, &f.Message, &f.Suggestion); err != nil {
+			return nil, fmt.Errorf("failed to scan lint finding: %w", err)
+		}
+		findings = append(findings, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating lint findings: %w", err)
+	}
+
+	return findings, nil
+}
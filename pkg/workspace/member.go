@@ -0,0 +1,181 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var (
+	// ErrNotWorkspaceMember is returned when a user has no role in a workspace
+	ErrNotWorkspaceMember = errors.New("user is not a member of the workspace")
+	// ErrInvalidWorkspaceRole is returned for a role that isn't owner, editor or viewer
+	ErrInvalidWorkspaceRole = errors.New("role must be owner, editor or viewer")
+	// ErrWorkspaceCreator is returned when changing the role of the user that created a workspace,
+	// who is always an owner
+	ErrWorkspaceCreator = errors.New("the creator of a workspace is always an owner")
+)
+
+// workspaceRoleRanks orders the roles, a role can do everything the roles below it can
+var workspaceRoleRanks = map[types.WorkspaceRole]int{
+	types.WorkspaceRoleViewer: 1,
+	types.WorkspaceRoleEditor: 2,
+	types.WorkspaceRoleOwner:  3,
+}
+
+// ParseWorkspaceRole returns the role named role, or ErrInvalidWorkspaceRole
+func ParseWorkspaceRole(role string) (types.WorkspaceRole, error) {
+	if _, ok := workspaceRoleRanks[types.WorkspaceRole(role)]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidWorkspaceRole, role)
+	}
+	return types.WorkspaceRole(role), nil
+}
+
+// RoleAllows reports whether a member with role can do what required allows
+func RoleAllows(role types.WorkspaceRole, required types.WorkspaceRole) bool {
+	rank, ok := workspaceRoleRanks[role]
+	return ok && rank >= workspaceRoleRanks[required]
+}
+
+// GetWorkspaceRole returns the role of a user in a workspace. The creator of the workspace is an
+// owner, any other user without a role gets ErrNotWorkspaceMember.
+func GetWorkspaceRole(ctx context.Context, workspaceID string, userID string) (types.WorkspaceRole, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT w.created_by_user_id = $2, m.role
+		FROM workspace w
+		LEFT JOIN workspace_member m ON m.workspace_id = w.id AND m.user_id = $2
+		WHERE w.id = $1`
+
+	var isCreator bool
+	var role *string
+	if err := conn.QueryRow(ctx, query, workspaceID, userID).Scan(&isCreator, &role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrWorkspaceNotFound
+		}
+		return "", fmt.Errorf("failed to get workspace role: %w", err)
+	}
+
+	if isCreator {
+		return types.WorkspaceRoleOwner, nil
+	}
+	if role == nil {
+		return "", ErrNotWorkspaceMember
+	}
+	return types.WorkspaceRole(*role), nil
+}
+
+// ListWorkspaceMembers returns the members of a workspace, the creator first and then the others
+// in the order they were added
+func ListWorkspaceMembers(ctx context.Context, workspaceID string) ([]types.WorkspaceMember, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	creator, createdAt, err := getWorkspaceCreator(ctx, conn, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	members := []types.WorkspaceMember{{
+		WorkspaceID: workspaceID,
+		UserID:      creator,
+		Role:        types.WorkspaceRoleOwner,
+		IsCreator:   true,
+		CreatedAt:   createdAt,
+	}}
+
+	query := `SELECT user_id, role, created_at FROM workspace_member
+		WHERE workspace_id = $1 AND user_id != $2
+		ORDER BY created_at, user_id`
+	rows, err := conn.Query(ctx, query, workspaceID, creator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		member := types.WorkspaceMember{WorkspaceID: workspaceID}
+		if err := rows.Scan(&member.UserID, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating workspace members: %w", err)
+	}
+
+	return members, nil
+}
+
+// AddWorkspaceMember gives a user a role in a workspace, or changes the role of a member
+func AddWorkspaceMember(ctx context.Context, workspaceID string, userID string, role types.WorkspaceRole) (*types.WorkspaceMember, error) {
+	if _, err := ParseWorkspaceRole(string(role)); err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	creator, _, err := getWorkspaceCreator(ctx, conn, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == creator {
+		return nil, ErrWorkspaceCreator
+	}
+
+	member := types.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role}
+	query := `INSERT INTO workspace_member (workspace_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role
+		RETURNING created_at`
+	if err := conn.QueryRow(ctx, query, workspaceID, userID, string(role), time.Now()).Scan(&member.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to add workspace member: %w", err)
+	}
+
+	return &member, nil
+}
+
+// RemoveWorkspaceMember takes away the role of a user in a workspace. ErrNotWorkspaceMember is
+// returned when the user has none.
+func RemoveWorkspaceMember(ctx context.Context, workspaceID string, userID string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	creator, _, err := getWorkspaceCreator(ctx, conn, workspaceID)
+	if err != nil {
+		return err
+	}
+	if userID == creator {
+		return ErrWorkspaceCreator
+	}
+
+	result, err := conn.Exec(ctx, `DELETE FROM workspace_member WHERE workspace_id = $1 AND user_id = $2`, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace member: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotWorkspaceMember
+	}
+
+	return nil
+}
+
+// getWorkspaceCreator returns the user that created a workspace and when, or ErrWorkspaceNotFound
+func getWorkspaceCreator(ctx context.Context, conn *pgxpool.Conn, workspaceID string) (string, time.Time, error) {
+	var creator string
+	var createdAt time.Time
+	err := conn.QueryRow(ctx, `SELECT created_by_user_id, created_at FROM workspace WHERE id = $1`, workspaceID).Scan(&creator, &createdAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", time.Time{}, ErrWorkspaceNotFound
+		}
+		return "", time.Time{}, fmt.Errorf("failed to get workspace creator: %w", err)
+	}
+	return creator, createdAt, nil
+}
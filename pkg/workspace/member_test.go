@@ -0,0 +1,107 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role     types.WorkspaceRole
+		required types.WorkspaceRole
+		want     bool
+	}{
+		{types.WorkspaceRoleOwner, types.WorkspaceRoleOwner, true},
+		{types.WorkspaceRoleOwner, types.WorkspaceRoleViewer, true},
+		{types.WorkspaceRoleEditor, types.WorkspaceRoleEditor, true},
+		{types.WorkspaceRoleEditor, types.WorkspaceRoleOwner, false},
+		{types.WorkspaceRoleViewer, types.WorkspaceRoleViewer, true},
+		{types.WorkspaceRoleViewer, types.WorkspaceRoleEditor, false},
+		{"", types.WorkspaceRoleViewer, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, RoleAllows(tt.role, tt.required), "%q allows %q", tt.role, tt.required)
+	}
+
+	_, err := ParseWorkspaceRole("admin")
+	assert.ErrorIs(t, err, ErrInvalidWorkspaceRole)
+	role, err := ParseWorkspaceRole("viewer")
+	require.NoError(t, err)
+	assert.Equal(t, types.WorkspaceRoleViewer, role)
+}
+
+// TestWorkspaceMembers adds, changes and removes members of a workspace. It runs against the
+// database in CHARTSMITH_TEST_PG_URI.
+func TestWorkspaceMembers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping workspace member integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "members-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_member WHERE workspace_id = $1`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = $1`, workspaceID)
+	})
+	_, err := conn.Exec(ctx, `INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number)
+		VALUES ($1, now(), 'members', 'creator', 'manual', 1)`, workspaceID)
+	require.NoError(t, err)
+
+	_, err = AddWorkspaceMember(ctx, workspaceID, "creator", types.WorkspaceRoleViewer)
+	assert.ErrorIs(t, err, ErrWorkspaceCreator)
+	_, err = AddWorkspaceMember(ctx, "missing", "jane", types.WorkspaceRoleViewer)
+	assert.ErrorIs(t, err, ErrWorkspaceNotFound)
+
+	_, err = AddWorkspaceMember(ctx, workspaceID, "jane", types.WorkspaceRoleViewer)
+	require.NoError(t, err)
+	_, err = AddWorkspaceMember(ctx, workspaceID, "sam", types.WorkspaceRoleViewer)
+	require.NoError(t, err)
+	member, err := AddWorkspaceMember(ctx, workspaceID, "jane", types.WorkspaceRoleEditor)
+	require.NoError(t, err)
+	assert.Equal(t, types.WorkspaceRoleEditor, member.Role)
+
+	role, err := GetWorkspaceRole(ctx, workspaceID, "creator")
+	require.NoError(t, err)
+	assert.Equal(t, types.WorkspaceRoleOwner, role)
+	role, err = GetWorkspaceRole(ctx, workspaceID, "jane")
+	require.NoError(t, err)
+	assert.Equal(t, types.WorkspaceRoleEditor, role)
+	_, err = GetWorkspaceRole(ctx, workspaceID, "outsider")
+	assert.ErrorIs(t, err, ErrNotWorkspaceMember)
+
+	members, err := ListWorkspaceMembers(ctx, workspaceID)
+	require.NoError(t, err)
+	require.Len(t, members, 3)
+	assert.True(t, members[0].IsCreator)
+	assert.Equal(t, "creator", members[0].UserID)
+
+	userIDs, err := ListUserIDsForWorkspace(ctx, workspaceID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"creator", "jane", "sam"}, userIDs)
+
+	require.NoError(t, RemoveWorkspaceMember(ctx, workspaceID, "sam"))
+	assert.ErrorIs(t, RemoveWorkspaceMember(ctx, workspaceID, "sam"), ErrNotWorkspaceMember)
+	assert.ErrorIs(t, RemoveWorkspaceMember(ctx, workspaceID, "creator"), ErrWorkspaceCreator)
+
+	userIDs, err = ListUserIDsForWorkspace(ctx, workspaceID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"creator", "jane"}, userIDs)
+}
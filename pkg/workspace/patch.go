@@ -0,0 +1,199 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/diff"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrNoPendingPatch is returned when a file doesn't exist or has no pending content
+var ErrNoPendingPatch = errors.New("file has no pending patch")
+
+// pendingPatchRow is a workspace_file row with pending content
+type pendingPatchRow struct {
+	file       types.File
+	contentSHA sql.NullString
+	baseSHA    sql.NullString
+}
+
+const pendingPatchColumns = `id, revision_number, chart_id, workspace_id, file_path, content, content_pending, version, content_sha, content_pending_base_sha`
+
+func scanPendingPatchRow(row pgx.Row) (*pendingPatchRow, error) {
+	var p pendingPatchRow
+	var chartID, contentPending sql.NullString
+	if err := row.Scan(&p.file.ID, &p.file.RevisionNumber, &chartID, &p.file.WorkspaceID, &p.file.FilePath, &p.file.Content, &contentPending, &p.file.Version, &p.contentSHA, &p.baseSHA); err != nil {
+		return nil, err
+	}
+	p.file.ChartID = chartID.String
+	if contentPending.Valid {
+		p.file.ContentPending = &contentPending.String
+	}
+	return &p, nil
+}
+
+// patch returns the row as a pending patch. Patches written before the base was recorded are
+// never stale, there's nothing to compare them to.
+func (p *pendingPatchRow) patch() types.PendingPatch {
+	return types.PendingPatch{
+		FileID:         p.file.ID,
+		RevisionNumber: p.file.RevisionNumber,
+		ChartID:        p.file.ChartID,
+		FilePath:       p.file.FilePath,
+		Version:        p.file.Version,
+		IsNewFile:      p.file.Content == "",
+		Stale:          p.baseSHA.Valid && p.baseSHA.String != p.currentSHA(),
+	}
+}
+
+// currentSHA returns the stored hash of the content, rows written before it was stored are hashed here
+func (p *pendingPatchRow) currentSHA() string {
+	if p.contentSHA.Valid {
+		return p.contentSHA.String
+	}
+	return contentSHA(p.file.Content)
+}
+
+// ListPendingPatches returns the files of a revision that have pending content, ordered by path
+func ListPendingPatches(ctx context.Context, workspaceID string, revisionNumber int) ([]types.PendingPatch, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT ` + pendingPatchColumns + ` FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number = $2 AND content_pending IS NOT NULL
+		ORDER BY file_path`
+	rows, err := conn.Query(ctx, query, workspaceID, revisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending patches: %w", err)
+	}
+	defer rows.Close()
+
+	patches := []types.PendingPatch{}
+	for rows.Next() {
+		p, err := scanPendingPatchRow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pending patch: %w", err)
+		}
+		patches = append(patches, p.patch())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending patches: %w", err)
+	}
+
+	return patches, nil
+}
+
+func getPendingPatchRow(ctx context.Context, workspaceID string, revisionNumber int, fileID string) (*pendingPatchRow, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT ` + pendingPatchColumns + ` FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number = $2 AND id = $3 AND content_pending IS NOT NULL`
+	p, err := scanPendingPatchRow(conn.QueryRow(ctx, query, workspaceID, revisionNumber, fileID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s at revision %d", ErrNoPendingPatch, fileID, revisionNumber)
+		}
+		return nil, fmt.Errorf("failed to get pending patch: %w", err)
+	}
+	return p, nil
+}
+
+// GetPatchPreview returns the content of a file before and after accepting its pending patch,
+// with a unified diff between them. Nothing is written.
+func GetPatchPreview(ctx context.Context, workspaceID string, revisionNumber int, fileID string) (*types.PatchPreview, error) {
+	p, err := getPendingPatchRow(ctx, workspaceID, revisionNumber, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return buildPatchPreview(p.patch(), p.file.Content, *p.file.ContentPending)
+}
+
+func buildPatchPreview(patch types.PendingPatch, before string, after string) (*types.PatchPreview, error) {
+	unifiedDiff, err := diff.GeneratePatch(before, after, patch.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s: %w", patch.FilePath, err)
+	}
+
+	return &types.PatchPreview{
+		PendingPatch: patch,
+		Before:       before,
+		After:        after,
+		Diff:         unifiedDiff,
+	}, nil
+}
+
+// AcceptPatch replaces the content of a file with its pending content. When expectedVersion is
+// set, the patch is only accepted if the file is still at that version, otherwise ErrConflict
+// is returned.
+func AcceptPatch(ctx context.Context, workspaceID string, revisionNumber int, fileID string, expectedVersion *int) (*types.File, error) {
+	query := `UPDATE workspace_file SET
+			content = content_pending,
+			content_sha = encode(sha256(convert_to(content_pending, 'UTF8')), 'hex'),
+			content_pending = NULL,
+			content_pending_base_sha = NULL,
+			version = version + 1
+		WHERE workspace_id = $1 AND revision_number = $2 AND id = $3 AND content_pending IS NOT NULL
+			AND ($4::integer IS NULL OR version = $4)`
+	return resolvePatch(ctx, query, workspaceID, revisionNumber, fileID, expectedVersion)
+}
+
+// RejectPatch discards the pending content of a file, with the same version check as AcceptPatch
+func RejectPatch(ctx context.Context, workspaceID string, revisionNumber int, fileID string, expectedVersion *int) (*types.File, error) {
+	query := `UPDATE workspace_file SET
+			content_pending = NULL,
+			content_pending_base_sha = NULL,
+			version = version + 1
+		WHERE workspace_id = $1 AND revision_number = $2 AND id = $3 AND content_pending IS NOT NULL
+			AND ($4::integer IS NULL OR version = $4)`
+	return resolvePatch(ctx, query, workspaceID, revisionNumber, fileID, expectedVersion)
+}
+
+func resolvePatch(ctx context.Context, query string, workspaceID string, revisionNumber int, fileID string, expectedVersion *int) (*types.File, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the file is locked by path, the lock is shared with writers that don't know its id
+	var filePath string
+	err = tx.QueryRow(ctx, `SELECT file_path FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 AND id = $3`, workspaceID, revisionNumber, fileID).Scan(&filePath)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get file path: %w", err)
+	}
+	if filePath != "" {
+		if err := lockFiles(ctx, tx, workspaceID, revisionNumber, filePath); err != nil {
+			return nil, err
+		}
+	}
+
+	tag, err := tx.Exec(ctx, query, workspaceID, revisionNumber, fileID, expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update pending patch: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		if expectedVersion == nil {
+			return nil, fmt.Errorf("%w: %s at revision %d", ErrNoPendingPatch, fileID, revisionNumber)
+		}
+		// tell a missing patch apart from a version that moved on
+		p, err := getPendingPatchRow(ctx, workspaceID, revisionNumber, fileID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s at revision %d is at version %d, not %d", ErrConflict, p.file.FilePath, revisionNumber, p.file.Version, *expectedVersion)
+	}
+
+	return GetFile(ctx, fileID, revisionNumber)
+}
@@ -0,0 +1,196 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/diff"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingPatchStale(t *testing.T) {
+	pending := "replicaCount: 2"
+	tests := []struct {
+		name       string
+		content    string
+		contentSHA sql.NullString
+		baseSHA    sql.NullString
+		wantStale  bool
+		wantNew    bool
+	}{
+		{
+			name:       "content unchanged",
+			content:    "replicaCount: 1",
+			contentSHA: sql.NullString{String: contentSHA("replicaCount: 1"), Valid: true},
+			baseSHA:    sql.NullString{String: contentSHA("replicaCount: 1"), Valid: true},
+		},
+		{
+			name:       "content saved after the patch",
+			content:    "replicaCount: 5",
+			contentSHA: sql.NullString{String: contentSHA("replicaCount: 5"), Valid: true},
+			baseSHA:    sql.NullString{String: contentSHA("replicaCount: 1"), Valid: true},
+			wantStale:  true,
+		},
+		{
+			name:      "content without a stored hash",
+			content:   "replicaCount: 5",
+			baseSHA:   sql.NullString{String: contentSHA("replicaCount: 1"), Valid: true},
+			wantStale: true,
+		},
+		{
+			name:       "patch from before bases were recorded",
+			content:    "replicaCount: 5",
+			contentSHA: sql.NullString{String: contentSHA("replicaCount: 5"), Valid: true},
+		},
+		{
+			name:       "new file",
+			content:    "",
+			contentSHA: sql.NullString{String: contentSHA(""), Valid: true},
+			baseSHA:    sql.NullString{String: contentSHA(""), Valid: true},
+			wantNew:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := pendingPatchRow{
+				file: types.File{
+					ID:             "file",
+					RevisionNumber: 2,
+					ChartID:        "chart",
+					FilePath:       "values.yaml",
+					Content:        tt.content,
+					ContentPending: &pending,
+					Version:        4,
+				},
+				contentSHA: tt.contentSHA,
+				baseSHA:    tt.baseSHA,
+			}
+
+			assert.Equal(t, types.PendingPatch{
+				FileID:         "file",
+				RevisionNumber: 2,
+				ChartID:        "chart",
+				FilePath:       "values.yaml",
+				Version:        4,
+				IsNewFile:      tt.wantNew,
+				Stale:          tt.wantStale,
+			}, row.patch())
+		})
+	}
+}
+
+func TestBuildPatchPreview(t *testing.T) {
+	before := "replicaCount: 1\nimage:\n  repository: nginx\n  tag: \"1.25\"\nservice:\n  port: 80\n"
+	after := "replicaCount: 3\nimage:\n  repository: nginx\n  tag: \"1.27\"\nservice:\n  port: 80\n  type: ClusterIP\n"
+
+	preview, err := buildPatchPreview(types.PendingPatch{FileID: "file", FilePath: "values.yaml", Stale: true}, before, after)
+	require.NoError(t, err)
+
+	assert.Equal(t, before, preview.Before)
+	assert.Equal(t, after, preview.After)
+	assert.True(t, preview.Stale)
+	assert.Contains(t, preview.Diff, "--- values.yaml")
+	assert.Contains(t, preview.Diff, "-replicaCount: 1\n+replicaCount: 3\n")
+	assert.Contains(t, preview.Diff, "+  type: ClusterIP\n")
+
+	// the diff is exactly the change, applying it to the current content gives the pending content
+	applied, err := diff.ApplyPatch(before, preview.Diff)
+	require.NoError(t, err)
+	assert.Equal(t, after, applied)
+}
+
+func TestBuildPatchPreviewNewFile(t *testing.T) {
+	after := "apiVersion: v1\nkind: ConfigMap\n"
+
+	preview, err := buildPatchPreview(types.PendingPatch{FileID: "file", FilePath: "templates/configmap.yaml", IsNewFile: true}, "", after)
+	require.NoError(t, err)
+
+	assert.Contains(t, preview.Diff, "+apiVersion: v1\n+kind: ConfigMap\n")
+	assert.NotContains(t, preview.Diff, "\n-")
+}
+
+// TestPendingPatchLifecycle lists, previews and resolves pending patches, including one that went
+// stale when the file was saved after it. It runs against the database in CHARTSMITH_TEST_PG_URI.
+func TestPendingPatchLifecycle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping pending patch integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "test-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_file WHERE workspace_id = $1`, workspaceID)
+	})
+
+	for _, path := range []string{"Chart.yaml", "values.yaml"} {
+		_, err := conn.Exec(ctx, `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha)
+			VALUES ($1, 1, 'chart', $2, $3, 'replicaCount: 1', $4)`, workspaceID+"-"+path, workspaceID, path, contentSHA("replicaCount: 1"))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, SetFileContentPending(ctx, "values.yaml", 1, "chart", workspaceID, "replicaCount: 2", nil))
+	require.NoError(t, SetFileContentPending(ctx, "values.yaml", 1, "chart", workspaceID, "replicaCount: 3", nil))
+	require.NoError(t, SetFileContentPending(ctx, "Chart.yaml", 1, "chart", workspaceID, "replicaCount: 2", nil))
+	require.NoError(t, SetFileContentPending(ctx, "templates/new.yaml", 1, "chart", workspaceID, "kind: ConfigMap", nil))
+
+	// a user saves Chart.yaml after its patch was written
+	_, err := conn.Exec(ctx, `UPDATE workspace_file SET content = 'replicaCount: 5', content_sha = $1, version = version + 1 WHERE id = $2`,
+		contentSHA("replicaCount: 5"), workspaceID+"-Chart.yaml")
+	require.NoError(t, err)
+
+	patches, err := ListPendingPatches(ctx, workspaceID, 1)
+	require.NoError(t, err)
+	require.Len(t, patches, 3)
+	assert.Equal(t, "Chart.yaml", patches[0].FilePath)
+	assert.True(t, patches[0].Stale)
+	assert.Equal(t, "templates/new.yaml", patches[1].FilePath)
+	assert.True(t, patches[1].IsNewFile)
+	assert.False(t, patches[1].Stale)
+	assert.Equal(t, "values.yaml", patches[2].FilePath)
+	assert.False(t, patches[2].Stale, "a second pending change builds on the first, it isn't stale")
+
+	preview, err := GetPatchPreview(ctx, workspaceID, 1, workspaceID+"-values.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "replicaCount: 1", preview.Before)
+	assert.Equal(t, "replicaCount: 3", preview.After)
+
+	stale := patches[0].Version - 1
+	_, err = RejectPatch(ctx, workspaceID, 1, workspaceID+"-Chart.yaml", &stale)
+	assert.True(t, errors.Is(err, ErrConflict), "%v", err)
+
+	file, err := RejectPatch(ctx, workspaceID, 1, workspaceID+"-Chart.yaml", &patches[0].Version)
+	require.NoError(t, err)
+	assert.Nil(t, file.ContentPending)
+	assert.Equal(t, "replicaCount: 5", file.Content)
+
+	file, err = AcceptPatch(ctx, workspaceID, 1, workspaceID+"-values.yaml", nil)
+	require.NoError(t, err)
+	assert.Nil(t, file.ContentPending)
+	assert.Equal(t, "replicaCount: 3", file.Content)
+
+	_, err = AcceptPatch(ctx, workspaceID, 1, workspaceID+"-values.yaml", nil)
+	assert.True(t, errors.Is(err, ErrNoPendingPatch), "%v", err)
+
+	patches, err = ListPendingPatches(ctx, workspaceID, 1)
+	require.NoError(t, err)
+	require.Len(t, patches, 1)
+	assert.Equal(t, "templates/new.yaml", patches[0].FilePath)
+}
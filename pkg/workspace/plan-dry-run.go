@@ -0,0 +1,62 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrPlanNotPreviewable is returned for a dry run of a plan that's no longer waiting for the user
+// to proceed with it
+var ErrPlanNotPreviewable = errors.New("plan can only be previewed before it's applied")
+
+// GetPlanDryRun returns the preview stored on a plan, or nil when it has none
+func GetPlanDryRun(ctx context.Context, planID string) (*types.PlanDryRun, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var b []byte
+	if err := conn.QueryRow(ctx, `SELECT dry_run FROM workspace_plan WHERE id = $1`, planID).Scan(&b); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrNoPlan, planID)
+		}
+		return nil, fmt.Errorf("failed to get plan dry run: %w", err)
+	}
+	if b == nil {
+		return nil, nil
+	}
+
+	var dryRun types.PlanDryRun
+	if err := json.Unmarshal(b, &dryRun); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal plan dry run: %w", err)
+	}
+	return &dryRun, nil
+}
+
+// SetPlanDryRun stores the preview of a plan, replacing any earlier one. It doesn't change the
+// plan's updated_at, the preview isn't a change to the plan.
+func SetPlanDryRun(ctx context.Context, planID string, dryRun types.PlanDryRun) error {
+	b, err := json.Marshal(dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan dry run: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `UPDATE workspace_plan SET dry_run = $2 WHERE id = $1`, planID, b); err != nil {
+		return fmt.Errorf("failed to set plan dry run: %w", err)
+	}
+	return nil
+}
+
+// DiffContents diffs the content of a file before and after a change that isn't in a revision
+// yet, nil before meaning the file doesn't exist. It returns nil when they're the same.
+func DiffContents(filePath string, before *string, after string) *types.FileDiff {
+	return diffFileContents(filePath, before, &after, MaxFileDiffLines)
+}
@@ -0,0 +1,237 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+)
+
+// ErrPlanNotRebaseable is returned when rebasing a plan that's still being written or applied
+var ErrPlanNotRebaseable = errors.New("plan can only be rebased once it's written and isn't being applied")
+
+// these are vars so that rebases can be tested without a database
+var (
+	getRebaseWorkspace  = GetWorkspace
+	getPlanBaseRevision = planBaseRevisionFromDB
+	getRevisionFiles    = revisionFileContentsFromDB
+	insertRebasedPlan   = insertRebasedPlanInDB
+)
+
+// planFileKey is a file of a chart, charts keep their ID from one revision to the next
+type planFileKey struct {
+	chartID string
+	path    string
+}
+
+// RebasePlan clones a plan onto the current revision of its workspace, for a plan that was
+// created against an earlier revision. Each action file is checked against the current files:
+// updating a file that doesn't exist anymore creates it, creating a file that exists now updates
+// it, and deleting a file that doesn't exist anymore is dropped. The adjustments, and the files
+// that changed since the revision the plan was created against, are returned and noted in the
+// description of the new plan, which is waiting for review and references the original plan. The
+// original plan isn't changed.
+func RebasePlan(ctx context.Context, original *types.Plan) (*types.Plan, []types.ActionFileRebase, error) {
+	planID := original.ID
+	switch original.Status {
+	case types.PlanStatusReview, types.PlanStatusReviewFiles, types.PlanStatusApplied:
+	default:
+		return nil, nil, fmt.Errorf("%w: plan %s is %s", ErrPlanNotRebaseable, planID, original.Status)
+	}
+
+	w, err := getRebaseWorkspace(ctx, original.WorkspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	current := map[planFileKey]string{}
+	for _, chart := range w.Charts {
+		for _, file := range chart.Files {
+			content := file.Content
+			if file.ContentPending != nil {
+				content = *file.ContentPending
+			}
+			current[planFileKey{chartID: chart.ID, path: file.FilePath}] = content
+		}
+	}
+
+	// without a chat message there's no telling what the plan saw, nothing is reported as drifted
+	var base map[planFileKey]string
+	if len(original.ChatMessageIDs) > 0 {
+		baseRevision, err := getPlanBaseRevision(ctx, original.ChatMessageIDs[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get the revision of plan %s: %w", planID, err)
+		}
+		base, err = getRevisionFiles(ctx, original.WorkspaceID, baseRevision)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get the files of revision %d: %w", baseRevision, err)
+		}
+	}
+
+	actionFiles, rebases := rebaseActionFiles(original.ActionFiles, base, current)
+
+	rebased := &types.Plan{
+		WorkspaceID:       original.WorkspaceID,
+		ChatMessageIDs:    original.ChatMessageIDs,
+		Description:       original.Description + PlanRebaseNote(w.CurrentRevision, rebases),
+		Version:           1,
+		Status:            types.PlanStatusReview,
+		ActionFiles:       actionFiles,
+		RebasedFromPlanID: original.ID,
+	}
+	created, err := insertRebasedPlan(ctx, rebased)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create rebased plan: %w", err)
+	}
+	return created, rebases, nil
+}
+
+// rebaseActionFiles returns the action files of a plan adjusted to the current files, and how each
+// file that was adjusted or drifted changed. base is nil when the files the plan was created
+// against aren't known.
+func rebaseActionFiles(actionFiles []types.ActionFile, base map[planFileKey]string, current map[planFileKey]string) ([]types.ActionFile, []types.ActionFileRebase) {
+	rebasedFiles := []types.ActionFile{}
+	rebases := []types.ActionFileRebase{}
+	for _, actionFile := range actionFiles {
+		key := planFileKey{chartID: actionFile.ChartID, path: actionFile.Path}
+		after, exists := current[key]
+		before, existed := base[key]
+		drifted := base != nil && (existed != exists || before != after)
+
+		rebase := types.ActionFileRebase{
+			ChartID: actionFile.ChartID,
+			Path:    actionFile.Path,
+			From:    actionFile.Action,
+			To:      actionFile.Action,
+			Drifted: drifted,
+		}
+		switch {
+		case actionFile.Action == "update" && !exists:
+			rebase.To = "create"
+			rebase.Reason = "the file doesn't exist anymore, it's created instead"
+		case actionFile.Action == "create" && exists:
+			rebase.To = "update"
+			rebase.Reason = "the file exists now, it's updated instead"
+		case actionFile.Action == "delete" && !exists:
+			rebase.To = ""
+			rebase.Reason = "the file doesn't exist anymore"
+		case drifted && exists:
+			rebase.Reason = "the file changed since the plan was created"
+		case drifted:
+			rebase.Reason = "the file was deleted since the plan was created"
+		}
+		if rebase.Reason != "" {
+			rebases = append(rebases, rebase)
+		}
+
+		if rebase.To == "" {
+			continue
+		}
+		// reviews and execution are for the original plan, the clone starts over
+		rebasedFiles = append(rebasedFiles, types.ActionFile{
+			Action:  rebase.To,
+			Path:    actionFile.Path,
+			ChartID: actionFile.ChartID,
+			Status:  string(llmtypes.ActionPlanStatusPending),
+		})
+	}
+	return rebasedFiles, rebases
+}
+
+// PlanRebaseNote is the paragraph appended to the description of a rebased plan, so that the user
+// and the LLM executing it know which files moved on. It's empty when nothing was adjusted.
+func PlanRebaseNote(revisionNumber int, rebases []types.ActionFileRebase) string {
+	if len(rebases) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n\n**Rebased onto revision %d**\n", revisionNumber)
+	for _, rebase := range rebases {
+		action := rebase.From
+		switch rebase.To {
+		case rebase.From:
+		case "":
+			action += " dropped"
+		default:
+			action += " → " + rebase.To
+		}
+		fmt.Fprintf(&b, "- `%s` %s: %s\n", rebase.Path, action, rebase.Reason)
+	}
+	return b.String()
+}
+
+func planBaseRevisionFromDB(ctx context.Context, chatMessageID string) (int, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var revisionNumber int
+	if err := conn.QueryRow(ctx, `SELECT revision_number FROM workspace_chat WHERE id = $1`, chatMessageID).Scan(&revisionNumber); err != nil {
+		return 0, err
+	}
+	return revisionNumber, nil
+}
+
+func revisionFileContentsFromDB(ctx context.Context, workspaceID string, revisionNumber int) (map[planFileKey]string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `SELECT COALESCE(chart_id, ''), file_path, COALESCE(content, '') FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number = $2`, workspaceID, revisionNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := map[planFileKey]string{}
+	for rows.Next() {
+		var key planFileKey
+		var content string
+		if err := rows.Scan(&key.chartID, &key.path, &content); err != nil {
+			return nil, fmt.Errorf("failed to scan file: %w", err)
+		}
+		files[key] = content
+	}
+	return files, rows.Err()
+}
+
+func insertRebasedPlanInDB(ctx context.Context, plan *types.Plan) (*types.Plan, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error beginning transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	id, err := securerandom.Hex(6)
+	if err != nil {
+		return nil, fmt.Errorf("error generating plan ID: %w", err)
+	}
+
+	query := `INSERT INTO workspace_plan
+(id, workspace_id, chat_message_ids, created_at, updated_at, version, status, description, proceed_at, rebased_from_plan_id)
+VALUES
+($1, $2, $3, $4, $4, $5, $6, $7, null, $8)`
+	if _, err := tx.Exec(ctx, query, id, plan.WorkspaceID, plan.ChatMessageIDs, time.Now(), plan.Version, plan.Status, plan.Description, plan.RebasedFromPlanID); err != nil {
+		return nil, fmt.Errorf("error creating plan: %w", err)
+	}
+	if err := UpdatePlanActionFiles(ctx, tx, id, plan.ActionFiles); err != nil {
+		return nil, err
+	}
+
+	created, err := GetPlan(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return created, nil
+}
@@ -0,0 +1,176 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebaseActionFiles(t *testing.T) {
+	content := func(s string) *string { return &s }
+	tests := []struct {
+		name        string
+		action      string
+		base        *string
+		current     *string
+		unknownBase bool
+		wantAction  string
+		want        *types.ActionFileRebase
+	}{
+		{name: "create a new file", action: "create", wantAction: "create"},
+		{name: "create a file that exists now", action: "create", current: content("kind: Ingress"), wantAction: "update",
+			want: &types.ActionFileRebase{From: "create", To: "update", Drifted: true, Reason: "the file exists now, it's updated instead"}},
+		{name: "create a file that was deleted", action: "create", base: content("kind: Ingress"), wantAction: "create",
+			want: &types.ActionFileRebase{From: "create", To: "create", Drifted: true, Reason: "the file was deleted since the plan was created"}},
+		{name: "update an unchanged file", action: "update", base: content("kind: Service"), current: content("kind: Service"), wantAction: "update"},
+		{name: "update a file that changed", action: "update", base: content("kind: Service"), current: content("kind: Service\nspec: {}"), wantAction: "update",
+			want: &types.ActionFileRebase{From: "update", To: "update", Drifted: true, Reason: "the file changed since the plan was created"}},
+		{name: "update a file that was deleted", action: "update", base: content("kind: Service"), wantAction: "create",
+			want: &types.ActionFileRebase{From: "update", To: "create", Drifted: true, Reason: "the file doesn't exist anymore, it's created instead"}},
+		{name: "delete a file", action: "delete", base: content("kind: Job"), current: content("kind: Job"), wantAction: "delete"},
+		{name: "delete a file that changed", action: "delete", base: content("kind: Job"), current: content("kind: CronJob"), wantAction: "delete",
+			want: &types.ActionFileRebase{From: "delete", To: "delete", Drifted: true, Reason: "the file changed since the plan was created"}},
+		{name: "delete a file that was deleted", action: "delete", base: content("kind: Job"),
+			want: &types.ActionFileRebase{From: "delete", Drifted: true, Reason: "the file doesn't exist anymore"}},
+		{name: "update without the base revision", action: "update", current: content("kind: Service"), unknownBase: true, wantAction: "update"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := planFileKey{chartID: "chart", path: "templates/app.yaml"}
+			base := map[planFileKey]string{{chartID: "chart", path: "values.yaml"}: ""}
+			if tt.base != nil {
+				base[key] = *tt.base
+			}
+			if tt.unknownBase {
+				base = nil
+			}
+			current := map[planFileKey]string{{chartID: "chart", path: "values.yaml"}: ""}
+			if tt.current != nil {
+				current[key] = *tt.current
+			}
+			// the same path in another chart is another file
+			current[planFileKey{chartID: "other", path: "templates/app.yaml"}] = "kind: Deployment"
+
+			actionFiles, rebases := rebaseActionFiles([]types.ActionFile{{
+				Action: tt.action, Path: "templates/app.yaml", ChartID: "chart", Status: "created", Review: types.ActionFileReviewApproved,
+			}}, base, current)
+
+			if tt.wantAction == "" {
+				assert.Empty(t, actionFiles)
+			} else {
+				assert.Equal(t, []types.ActionFile{{Action: tt.wantAction, Path: "templates/app.yaml", ChartID: "chart", Status: "pending"}}, actionFiles)
+			}
+			if tt.want == nil {
+				assert.Empty(t, rebases)
+				return
+			}
+			tt.want.ChartID, tt.want.Path = "chart", "templates/app.yaml"
+			assert.Equal(t, []types.ActionFileRebase{*tt.want}, rebases)
+		})
+	}
+}
+
+func TestPlanRebaseNote(t *testing.T) {
+	assert.Empty(t, PlanRebaseNote(4, nil))
+
+	note := PlanRebaseNote(4, []types.ActionFileRebase{
+		{Path: "templates/ingress.yaml", From: "update", To: "create", Reason: "the file doesn't exist anymore, it's created instead"},
+		{Path: "templates/job.yaml", From: "delete", Reason: "the file doesn't exist anymore"},
+		{Path: "values.yaml", From: "update", To: "update", Drifted: true, Reason: "the file changed since the plan was created"},
+	})
+	assert.Equal(t, "\n\n**Rebased onto revision 4**\n"+
+		"- `templates/ingress.yaml` update → create: the file doesn't exist anymore, it's created instead\n"+
+		"- `templates/job.yaml` delete dropped: the file doesn't exist anymore\n"+
+		"- `values.yaml` update: the file changed since the plan was created\n", note)
+}
+
+func TestRebasePlan(t *testing.T) {
+	original := &types.Plan{
+		ID:             "old-plan",
+		WorkspaceID:    "ws",
+		ChatMessageIDs: []string{"chat"},
+		Description:    "Add an ingress",
+		Status:         types.PlanStatusReview,
+		ActionFiles: []types.ActionFile{
+			{Action: "create", Path: "templates/ingress.yaml", ChartID: "chart", Status: "pending"},
+			{Action: "update", Path: "values.yaml", ChartID: "chart", Status: "pending"},
+		},
+	}
+	stubPlanRebase(t)
+
+	var inserted *types.Plan
+	insertRebasedPlan = func(ctx context.Context, plan *types.Plan) (*types.Plan, error) {
+		inserted = plan
+		created := *plan
+		created.ID = "new-plan"
+		return &created, nil
+	}
+
+	rebased, rebases, err := RebasePlan(context.Background(), original)
+	require.NoError(t, err)
+	assert.Equal(t, "new-plan", rebased.ID)
+	assert.Equal(t, "old-plan", inserted.RebasedFromPlanID)
+	assert.Equal(t, types.PlanStatusReview, inserted.Status)
+	assert.Equal(t, []string{"chat"}, inserted.ChatMessageIDs)
+	assert.Equal(t, "Add an ingress\n\n**Rebased onto revision 5**\n"+
+		"- `templates/ingress.yaml` create → update: the file exists now, it's updated instead\n"+
+		"- `values.yaml` update: the file changed since the plan was created\n", inserted.Description)
+	assert.Equal(t, []types.ActionFile{
+		{Action: "update", Path: "templates/ingress.yaml", ChartID: "chart", Status: "pending"},
+		{Action: "update", Path: "values.yaml", ChartID: "chart", Status: "pending"},
+	}, inserted.ActionFiles)
+	assert.Len(t, rebases, 2)
+
+	assert.Equal(t, "Add an ingress", original.Description, "the original plan isn't changed")
+	assert.Equal(t, "create", original.ActionFiles[0].Action)
+}
+
+func TestRebasePlanErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  types.PlanStatus
+		wantErr error
+	}{
+		{name: "still planning", status: types.PlanStatusPlanning, wantErr: ErrPlanNotRebaseable},
+		{name: "applying", status: types.PlanStatusApplying, wantErr: ErrPlanNotRebaseable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubPlanRebase(t)
+			insertRebasedPlan = func(ctx context.Context, plan *types.Plan) (*types.Plan, error) {
+				return nil, errors.New("nothing is inserted")
+			}
+
+			_, _, err := RebasePlan(context.Background(), &types.Plan{ID: "old-plan", WorkspaceID: "ws", Status: tt.status})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+// stubPlanRebase stubs a workspace at revision 5 where the plan's chat message was sent at
+// revision 3. templates/ingress.yaml was added and values.yaml changed since.
+func stubPlanRebase(t *testing.T) {
+	originalWorkspace, originalBase, originalFiles, originalInsert := getRebaseWorkspace, getPlanBaseRevision, getRevisionFiles, insertRebasedPlan
+	t.Cleanup(func() {
+		getRebaseWorkspace, getPlanBaseRevision, getRevisionFiles, insertRebasedPlan = originalWorkspace, originalBase, originalFiles, originalInsert
+	})
+
+	pendingValues := "replicaCount: 2\n"
+	getRebaseWorkspace = func(ctx context.Context, id string) (*types.Workspace, error) {
+		return &types.Workspace{ID: id, CurrentRevision: 5, Charts: []types.Chart{{ID: "chart", Files: []types.File{
+			{FilePath: "values.yaml", Content: "replicaCount: 1\n", ContentPending: &pendingValues},
+			{FilePath: "templates/ingress.yaml", Content: "kind: Ingress\n"},
+		}}}}, nil
+	}
+	getPlanBaseRevision = func(ctx context.Context, chatMessageID string) (int, error) {
+		return 3, nil
+	}
+	getRevisionFiles = func(ctx context.Context, workspaceID string, revisionNumber int) (map[planFileKey]string, error) {
+		assert.Equal(t, 3, revisionNumber)
+		return map[planFileKey]string{{chartID: "chart", path: "values.yaml"}: "replicaCount: 1\n"}, nil
+	}
+}
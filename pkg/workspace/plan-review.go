@@ -0,0 +1,165 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+var (
+	// ErrActionFileNotFound is returned when a plan has no action file at a path
+	ErrActionFileNotFound = errors.New("action file not found")
+	// ErrPlanNotInFileReview is returned when files are reviewed on a plan that isn't waiting for it
+	ErrPlanNotInFileReview = errors.New("plan isn't waiting for a review of its files")
+	// ErrPlanReviewIncomplete is returned when a plan proceeds before every file is approved or rejected
+	ErrPlanReviewIncomplete = errors.New("every file must be approved or rejected")
+)
+
+// ValidateActionFileReview checks a review decision, a comment needs a note for the LLM to act on
+func ValidateActionFileReview(review types.ActionFileReview, note string) error {
+	switch review {
+	case types.ActionFileReviewApproved, types.ActionFileReviewRejected:
+		return nil
+	case types.ActionFileReviewCommented:
+		if strings.TrimSpace(note) == "" {
+			return errors.New("a commented file needs a note")
+		}
+		return nil
+	default:
+		return fmt.Errorf("review must be approved, rejected or commented, not %q", review)
+	}
+}
+
+// SetActionFileReview records the review of an action file and returns the updated plan. A note
+// replaces the file's note, and an approval or rejection without a note keeps the earlier one, so
+// a file that was commented on and then approved is applied with the comment.
+func SetActionFileReview(ctx context.Context, workspaceID string, planID string, chartID string, path string, review types.ActionFileReview, note string) (*types.Plan, error) {
+	if err := ValidateActionFileReview(review, note); err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status types.PlanStatus
+	if err := tx.QueryRow(ctx, `SELECT status FROM workspace_plan WHERE id = $1 AND workspace_id = $2 FOR UPDATE`, planID, workspaceID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrNoPlan, planID)
+		}
+		return nil, fmt.Errorf("failed to get plan status: %w", err)
+	}
+	if status != types.PlanStatusReviewFiles {
+		return nil, fmt.Errorf("%w: plan %s is %s", ErrPlanNotInFileReview, planID, status)
+	}
+
+	query := `UPDATE workspace_plan_action_file SET review = $4, review_note = COALESCE(NULLIF($5, ''), review_note)
+		WHERE plan_id = $1 AND chart_id = $2 AND path = $3`
+	tag, err := tx.Exec(ctx, query, planID, chartID, path, review, strings.TrimSpace(note))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set action file review: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, fmt.Errorf("%w: %s in plan %s", ErrActionFileNotFound, path, planID)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE workspace_plan SET updated_at = now() WHERE id = $1`, planID); err != nil {
+		return nil, fmt.Errorf("failed to update plan: %w", err)
+	}
+
+	plan, err := GetPlan(ctx, tx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return plan, nil
+}
+
+// CheckPlanReviewComplete returns ErrPlanReviewIncomplete, naming the files, when a file of the plan
+// isn't approved or rejected
+func CheckPlanReviewComplete(plan *types.Plan) error {
+	unresolved := []string{}
+	for _, actionFile := range plan.ActionFiles {
+		if actionFile.Review != types.ActionFileReviewApproved && actionFile.Review != types.ActionFileReviewRejected {
+			unresolved = append(unresolved, actionFile.Path)
+		}
+	}
+	if len(unresolved) > 0 {
+		return fmt.Errorf("%w: %s", ErrPlanReviewIncomplete, strings.Join(unresolved, ", "))
+	}
+	return nil
+}
+
+// ActionFilesToApply returns the action files of a plan that still need to be applied. When the
+// files of the plan were reviewed, only the approved ones are applied.
+func ActionFilesToApply(plan *types.Plan) []types.ActionFile {
+	reviewed := false
+	for _, actionFile := range plan.ActionFiles {
+		if actionFile.Review != "" {
+			reviewed = true
+			break
+		}
+	}
+
+	toApply := []types.ActionFile{}
+	for _, actionFile := range plan.ActionFiles {
+		if actionFile.Status == string(llmtypes.ActionPlanStatusCreated) {
+			continue
+		}
+		if reviewed && actionFile.Review != types.ActionFileReviewApproved {
+			continue
+		}
+		toApply = append(toApply, actionFile)
+	}
+	return toApply
+}
+
+// ProceedReviewedPlan applies a plan whose files have all been approved or rejected
+func ProceedReviewedPlan(ctx context.Context, workspaceID string, planID string) (*types.Plan, error) {
+	plan, err := GetPlan(ctx, nil, planID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrNoPlan, planID)
+		}
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan.WorkspaceID != workspaceID {
+		return nil, fmt.Errorf("%w: %s in workspace %s", ErrNoPlan, planID, workspaceID)
+	}
+	if plan.Status != types.PlanStatusReviewFiles {
+		return nil, fmt.Errorf("%w: plan %s is %s", ErrPlanNotInFileReview, planID, plan.Status)
+	}
+	if err := CheckPlanReviewComplete(plan); err != nil {
+		return nil, err
+	}
+	// the plan's execution lock was released while its files were reviewed
+	if err := CheckPlanExecutionLock(ctx, plan.ID); err != nil {
+		return nil, err
+	}
+
+	if err := UpdatePlanStatus(ctx, plan.ID, types.PlanStatusApplying); err != nil {
+		return nil, err
+	}
+	plan.Status = types.PlanStatusApplying
+
+	if err := persistence.EnqueueWork(ctx, "apply_plan", map[string]interface{}{
+		"planId": plan.ID,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to enqueue apply plan: %w", err)
+	}
+
+	return plan, nil
+}
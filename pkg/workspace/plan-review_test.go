@@ -0,0 +1,59 @@
+package workspace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateActionFileReview(t *testing.T) {
+	assert.NoError(t, ValidateActionFileReview(types.ActionFileReviewApproved, ""))
+	assert.NoError(t, ValidateActionFileReview(types.ActionFileReviewRejected, ""))
+	assert.NoError(t, ValidateActionFileReview(types.ActionFileReviewCommented, "use a StatefulSet"))
+	assert.ErrorContains(t, ValidateActionFileReview(types.ActionFileReviewCommented, "  "), "needs a note")
+	assert.ErrorContains(t, ValidateActionFileReview("", ""), "review must be")
+}
+
+func TestCheckPlanReviewComplete(t *testing.T) {
+	plan := &types.Plan{ActionFiles: []types.ActionFile{
+		{Path: "values.yaml", Review: types.ActionFileReviewApproved},
+		{Path: "templates/service.yaml", Review: types.ActionFileReviewCommented, ReviewNote: "use a headless service"},
+		{Path: "templates/ingress.yaml"},
+		{Path: "templates/hpa.yaml", Review: types.ActionFileReviewRejected},
+	}}
+
+	err := CheckPlanReviewComplete(plan)
+	require.True(t, errors.Is(err, ErrPlanReviewIncomplete))
+	assert.Contains(t, err.Error(), "templates/service.yaml, templates/ingress.yaml")
+
+	plan.ActionFiles[1].Review = types.ActionFileReviewApproved
+	plan.ActionFiles[2].Review = types.ActionFileReviewRejected
+	assert.NoError(t, CheckPlanReviewComplete(plan))
+}
+
+func TestActionFilesToApply(t *testing.T) {
+	paths := func(actionFiles []types.ActionFile) []string {
+		result := []string{}
+		for _, actionFile := range actionFiles {
+			result = append(result, actionFile.Path)
+		}
+		return result
+	}
+
+	unreviewed := &types.Plan{ActionFiles: []types.ActionFile{
+		{Path: "values.yaml", Status: "created"},
+		{Path: "templates/service.yaml", Status: "pending"},
+		{Path: "templates/ingress.yaml", Status: "failed"},
+	}}
+	assert.Equal(t, []string{"templates/service.yaml", "templates/ingress.yaml"}, paths(ActionFilesToApply(unreviewed)))
+
+	reviewed := &types.Plan{ActionFiles: []types.ActionFile{
+		{Path: "values.yaml", Status: "pending", Review: types.ActionFileReviewApproved},
+		{Path: "templates/service.yaml", Status: "pending", Review: types.ActionFileReviewRejected},
+		{Path: "templates/ingress.yaml", Status: "pending", Review: types.ActionFileReviewApproved, ReviewNote: "use networking.k8s.io/v1"},
+	}}
+	assert.Equal(t, []string{"values.yaml", "templates/ingress.yaml"}, paths(ActionFilesToApply(reviewed)))
+}
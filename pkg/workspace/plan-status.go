@@ -0,0 +1,170 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	llmtypes "github.com/replicatedhq/chartsmith/pkg/llm/types"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// GetPlanExecutionStatus returns a snapshot of how far a plan's execution has got: its action files,
+// the revision it builds and the latest render of that revision. It's read in one transaction so
+// that the snapshot is consistent, and returns ErrNoPlan when the plan doesn't exist.
+func GetPlanExecutionStatus(ctx context.Context, planID string) (*types.PlanExecutionStatus, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	plan, err := GetPlan(ctx, tx, planID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrNoPlan, planID)
+		}
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	status := &types.PlanExecutionStatus{
+		PlanID:      plan.ID,
+		WorkspaceID: plan.WorkspaceID,
+		Status:      plan.Status,
+		ActionFiles: plan.ActionFiles,
+		Counts:      CountActionFiles(plan.ActionFiles),
+		UpdatedAt:   plan.UpdatedAt,
+	}
+	if status.ActionFiles == nil {
+		status.ActionFiles = []types.ActionFile{}
+	}
+
+	var revisionNumber int
+	err = tx.QueryRow(ctx, `SELECT revision_number FROM workspace_revision
+		WHERE workspace_id = $1 AND plan_id = $2 ORDER BY revision_number DESC LIMIT 1`, plan.WorkspaceID, plan.ID).Scan(&revisionNumber)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get plan revision: %w", err)
+	}
+	if err == nil {
+		status.RevisionNumber = &revisionNumber
+
+		render, renderUpdatedAt, err := getLatestPlanRender(ctx, tx, plan.WorkspaceID, revisionNumber)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get plan render: %w", err)
+		}
+		status.Render = render
+		status.UpdatedAt = latestUpdate(status.UpdatedAt, renderUpdatedAt)
+	}
+
+	for _, actionFile := range status.ActionFiles {
+		if actionFile.StartedAt != nil {
+			status.UpdatedAt = latestUpdate(status.UpdatedAt, *actionFile.StartedAt)
+		}
+		if actionFile.FinishedAt != nil {
+			status.UpdatedAt = latestUpdate(status.UpdatedAt, *actionFile.FinishedAt)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return status, nil
+}
+
+// getLatestPlanRender returns the most recent render of a revision with the chart's own values and
+// when it or one of its charts last changed, or nil when the revision hasn't been rendered
+func getLatestPlanRender(ctx context.Context, tx revisionQuerier, workspaceID string, revisionNumber int) (*types.PlanRender, time.Time, error) {
+	query := `SELECT
+		r.id,
+		r.revision_number,
+		r.created_at,
+		r.completed_at,
+		COALESCE(r.error_message, ''),
+		COUNT(c.id),
+		COUNT(c.id) FILTER (WHERE c.completed_at IS NOT NULL AND c.is_success),
+		COUNT(c.id) FILTER (WHERE c.completed_at IS NOT NULL AND NOT c.is_success),
+		COALESCE(jsonb_object_agg(c.chart_id, c.notes) FILTER (WHERE c.notes IS NOT NULL), '{}'::jsonb),
+		r.compatibility,
+		GREATEST(r.created_at, r.completed_at, MAX(c.created_at), MAX(c.completed_at))
+	FROM workspace_rendered r
+	LEFT JOIN workspace_rendered_chart c ON c.workspace_render_id = r.id
+	WHERE r.workspace_id = $1 AND r.revision_number = $2 AND COALESCE(r.values_profile, '') = ''
+	GROUP BY r.id
+	ORDER BY r.created_at DESC
+	LIMIT 1`
+
+	var render types.PlanRender
+	var completedAt sql.NullTime
+	var compatibility []byte
+	var updatedAt time.Time
+	err := tx.QueryRow(ctx, query, workspaceID, revisionNumber).Scan(
+		&render.ID,
+		&render.RevisionNumber,
+		&render.CreatedAt,
+		&completedAt,
+		&render.Error,
+		&render.Charts,
+		&render.ChartsSucceeded,
+		&render.ChartsFailed,
+		&render.Notes,
+		&compatibility,
+		&updatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, time.Time{}, nil
+		}
+		return nil, time.Time{}, fmt.Errorf("error scanning render: %w", err)
+	}
+	if completedAt.Valid {
+		render.CompletedAt = &completedAt.Time
+	}
+	if compatibility != nil {
+		render.Compatibility = &types.RenderCompatibility{}
+		if err := json.Unmarshal(compatibility, render.Compatibility); err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to unmarshal render compatibility: %w", err)
+		}
+	}
+
+	return &render, updatedAt, nil
+}
+
+// CountActionFiles counts action files by where they are in the plan's execution. Files rejected in
+// review are skipped whatever their status.
+func CountActionFiles(actionFiles []types.ActionFile) types.ActionFileCounts {
+	counts := types.ActionFileCounts{}
+	for _, actionFile := range actionFiles {
+		if actionFile.Review == types.ActionFileReviewRejected {
+			counts.Skipped++
+			continue
+		}
+
+		switch llmtypes.ActionPlanStatus(actionFile.Status) {
+		case llmtypes.ActionPlanStatusCreating:
+			counts.Running++
+		case llmtypes.ActionPlanStatusCreated:
+			counts.Done++
+		case llmtypes.ActionPlanStatusFailed:
+			counts.Failed++
+		default:
+			counts.Pending++
+		}
+	}
+	return counts
+}
+
+func latestUpdate(a time.Time, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
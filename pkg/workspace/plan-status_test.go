@@ -0,0 +1,23 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountActionFiles(t *testing.T) {
+	actionFiles := []types.ActionFile{
+		{Path: "a.yaml", Status: "pending"},
+		{Path: "b.yaml", Status: ""},
+		{Path: "c.yaml", Status: "creating"},
+		{Path: "d.yaml", Status: "created"},
+		{Path: "e.yaml", Status: "failed"},
+		{Path: "f.yaml", Status: "pending", Review: types.ActionFileReviewRejected},
+		{Path: "g.yaml", Status: "created", Review: types.ActionFileReviewApproved},
+	}
+
+	assert.Equal(t, types.ActionFileCounts{Pending: 2, Running: 1, Done: 2, Failed: 1, Skipped: 1}, CountActionFiles(actionFiles))
+	assert.Equal(t, types.ActionFileCounts{}, CountActionFiles(nil))
+}
@@ -76,7 +76,8 @@ func listPlans(ctx context.Context, workspaceID string) ([]types.Plan, error) {
 		version,
 		status,
 		description,
-		proceed_at
+		proceed_at,
+		COALESCE(rebased_from_plan_id, '')
 	FROM workspace_plan WHERE workspace_id = $1 ORDER BY created_at DESC`
 
 	rows, err := tx.Query(ctx, query, workspaceID)
@@ -100,6 +101,7 @@ func listPlans(ctx context.Context, workspaceID string) ([]types.Plan, error) {
 			&plan.Status,
 			&description,
 			&proceedAt,
+			&plan.RebasedFromPlanID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning plan: %w", err)
@@ -150,7 +152,8 @@ func GetPlan(ctx context.Context, tx pgx.Tx, planID string) (*types.Plan, error)
 		version,
 		status,
 		description,
-		proceed_at
+		proceed_at,
+		COALESCE(rebased_from_plan_id, '')
 	FROM workspace_plan WHERE id = $1`
 
 	row := tx.QueryRow(ctx, query, planID)
@@ -168,6 +171,7 @@ func GetPlan(ctx context.Context, tx pgx.Tx, planID string) (*types.Plan, error)
 		&plan.Status,
 		&description,
 		&proceedAt,
+		&plan.RebasedFromPlanID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error scanning plan: %w", err)
@@ -196,7 +200,13 @@ func listActionFiles(ctx context.Context, tx pgx.Tx, planID string) ([]types.Act
 	query := `SELECT
 		action,
 		path,
-		status
+		chart_id,
+		status,
+		COALESCE(error, ''),
+		COALESCE(review, ''),
+		COALESCE(review_note, ''),
+		started_at,
+		finished_at
 	FROM workspace_plan_action_file WHERE plan_id = $1 ORDER BY created_at ASC`
 
 	rows, err := tx.Query(ctx, query, planID)
@@ -207,10 +217,17 @@ func listActionFiles(ctx context.Context, tx pgx.Tx, planID string) ([]types.Act
 	var actionFiles []types.ActionFile
 	for rows.Next() {
 		var actionFile types.ActionFile
-		err := rows.Scan(&actionFile.Action, &actionFile.Path, &actionFile.Status)
+		var startedAt, finishedAt sql.NullTime
+		err := rows.Scan(&actionFile.Action, &actionFile.Path, &actionFile.ChartID, &actionFile.Status, &actionFile.Error, &actionFile.Review, &actionFile.ReviewNote, &startedAt, &finishedAt)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning action file: %w", err)
 		}
+		if startedAt.Valid {
+			actionFile.StartedAt = &startedAt.Time
+		}
+		if finishedAt.Valid {
+			actionFile.FinishedAt = &finishedAt.Time
+		}
 		actionFiles = append(actionFiles, actionFile)
 	}
 
@@ -231,7 +248,8 @@ func AppendPlanDescription(ctx context.Context, planID string, description strin
 		SET description = CASE
 			WHEN description IS NULL OR description = '' THEN $1
 			ELSE description || $1
-		END
+		END,
+		updated_at = now()
 		WHERE id = $2`
 
 	_, err := conn.Exec(ctx, query, description, planID)
@@ -245,7 +263,7 @@ func UpdatePlanStatus(ctx context.Context, planID string, status types.PlanStatu
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
-	query := `UPDATE workspace_plan SET status = $1 WHERE id = $2`
+	query := `UPDATE workspace_plan SET status = $1, updated_at = now() WHERE id = $2`
 	_, err := conn.Exec(ctx, query, status, planID)
 	if err != nil {
 		return fmt.Errorf("error updating plan status: %w", err)
@@ -260,15 +278,20 @@ func UpdatePlanActionFiles(ctx context.Context, tx pgx.Tx, planID string, action
 	}
 
 	for _, actionFile := range actionFiles {
-		query := `INSERT INTO workspace_plan_action_file (plan_id, action, path, status, created_at) VALUES ($1, $2, $3, $4, $5)
-	ON CONFLICT (plan_id, path) DO UPDATE SET status = EXCLUDED.status`
+		query := `INSERT INTO workspace_plan_action_file (plan_id, chart_id, action, path, status, created_at, error, review, review_note, started_at, finished_at) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11)
+	ON CONFLICT (plan_id, chart_id, path) DO UPDATE SET status = EXCLUDED.status, error = EXCLUDED.error, review = EXCLUDED.review, review_note = EXCLUDED.review_note, started_at = EXCLUDED.started_at, finished_at = EXCLUDED.finished_at`
 
-		_, err := tx.Exec(ctx, query, planID, actionFile.Action, actionFile.Path, actionFile.Status, time.Now())
+		_, err := tx.Exec(ctx, query, planID, actionFile.ChartID, actionFile.Action, actionFile.Path, actionFile.Status, time.Now(), actionFile.Error, actionFile.Review, actionFile.ReviewNote, actionFile.StartedAt, actionFile.FinishedAt)
 		if err != nil {
 			return fmt.Errorf("error updating plan action files: %w", err)
 		}
 	}
 
+	// the plan's updated_at is what polls of its status compare
+	if _, err := tx.Exec(ctx, `UPDATE workspace_plan SET updated_at = now() WHERE id = $1`, planID); err != nil {
+		return fmt.Errorf("error updating plan updated_at: %w", err)
+	}
+
 	return nil
 }
 
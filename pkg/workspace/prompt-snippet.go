@@ -0,0 +1,154 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+)
+
+// MaxPromptSnippetBytes is the largest content a prompt snippet can have, snippets are
+// instructions and not documents
+const MaxPromptSnippetBytes = 4000
+
+// ErrPromptSnippetNotFound is returned when a user has no prompt snippet with the given name
+var ErrPromptSnippetNotFound = errors.New("prompt snippet not found")
+
+// promptSnippetNameRegex matches the names of prompt snippets, such as labels or naming-v2
+var promptSnippetNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidatePromptSnippet returns an error if name isn't a valid snippet name or content is empty or
+// larger than MaxPromptSnippetBytes
+func ValidatePromptSnippet(name string, content string) error {
+	if !promptSnippetNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid snippet name %q: use lowercase letters, numbers and dashes", name)
+	}
+	if strings.TrimSpace(content) == "" {
+		return errors.New("invalid snippet content: content is empty")
+	}
+	if len(content) > MaxPromptSnippetBytes {
+		return fmt.Errorf("invalid snippet content: %d bytes, the most is %d", len(content), MaxPromptSnippetBytes)
+	}
+	return nil
+}
+
+// ListPromptSnippets returns the prompt snippets of a user ordered by name
+func ListPromptSnippets(ctx context.Context, userID string) ([]types.PromptSnippet, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT id, user_id, name, content, apply_automatically, created_at, updated_at
+		FROM user_prompt_snippet
+		WHERE user_id = $1
+		ORDER BY name`
+
+	return queryPromptSnippets(ctx, conn, query, userID)
+}
+
+// ListAutoApplyPromptSnippets returns the prompt snippets that apply automatically to a workspace,
+// the ones the user that created it marked to apply automatically, ordered by name
+func ListAutoApplyPromptSnippets(ctx context.Context, workspaceID string) ([]types.PromptSnippet, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT s.id, s.user_id, s.name, s.content, s.apply_automatically, s.created_at, s.updated_at
+		FROM user_prompt_snippet s
+		JOIN workspace w ON w.created_by_user_id = s.user_id
+		WHERE w.id = $1 AND s.apply_automatically
+		ORDER BY s.name`
+
+	return queryPromptSnippets(ctx, conn, query, workspaceID)
+}
+
+// GetPromptSnippet returns the named prompt snippet of a user, or ErrPromptSnippetNotFound
+func GetPromptSnippet(ctx context.Context, userID string, name string) (*types.PromptSnippet, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT id, user_id, name, content, apply_automatically, created_at, updated_at
+		FROM user_prompt_snippet
+		WHERE user_id = $1 AND name = $2`
+
+	var snippet types.PromptSnippet
+	err := conn.QueryRow(ctx, query, userID, name).Scan(&snippet.ID, &snippet.UserID, &snippet.Name, &snippet.Content, &snippet.ApplyAutomatically, &snippet.CreatedAt, &snippet.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrPromptSnippetNotFound
+		}
+		return nil, fmt.Errorf("failed to get prompt snippet: %w", err)
+	}
+
+	return &snippet, nil
+}
+
+// SetPromptSnippet creates the named prompt snippet of a user, or replaces it if it already exists
+func SetPromptSnippet(ctx context.Context, userID string, name string, content string, applyAutomatically bool) (*types.PromptSnippet, error) {
+	if err := ValidatePromptSnippet(name, content); err != nil {
+		return nil, err
+	}
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate id: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO user_prompt_snippet (id, user_id, name, content, apply_automatically, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, now(), now())
+		ON CONFLICT (user_id, name) DO UPDATE SET content = EXCLUDED.content, apply_automatically = EXCLUDED.apply_automatically, updated_at = now()
+		RETURNING id, user_id, name, content, apply_automatically, created_at, updated_at`
+
+	var snippet types.PromptSnippet
+	if err := conn.QueryRow(ctx, query, id, userID, name, content, applyAutomatically).Scan(&snippet.ID, &snippet.UserID, &snippet.Name, &snippet.Content, &snippet.ApplyAutomatically, &snippet.CreatedAt, &snippet.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to set prompt snippet: %w", err)
+	}
+
+	return &snippet, nil
+}
+
+// DeletePromptSnippet deletes the named prompt snippet of a user
+func DeletePromptSnippet(ctx context.Context, userID string, name string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, `DELETE FROM user_prompt_snippet WHERE user_id = $1 AND name = $2`, userID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete prompt snippet: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPromptSnippetNotFound
+	}
+	return nil
+}
+
+func queryPromptSnippets(ctx context.Context, conn *pgxpool.Conn, query string, arg string) ([]types.PromptSnippet, error) {
+	rows, err := conn.Query(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompt snippets: %w", err)
+	}
+	defer rows.Close()
+
+	snippets := []types.PromptSnippet{}
+	for rows.Next() {
+		var snippet types.PromptSnippet
+		if err := rows.Scan(&snippet.ID, &snippet.UserID, &snippet.Name, &snippet.Content, &snippet.ApplyAutomatically, &snippet.CreatedAt, &snippet.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan prompt snippet: %w", err)
+		}
+		snippets = append(snippets, snippet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating prompt snippets: %w", err)
+	}
+
+	return snippets, nil
+}
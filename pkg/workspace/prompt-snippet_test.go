@@ -0,0 +1,37 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePromptSnippet(t *testing.T) {
+	tests := []struct {
+		name        string
+		snippetName string
+		content     string
+		wantErr     string
+	}{
+		{name: "instruction", snippetName: "labels", content: "Always add app.kubernetes.io/part-of labels."},
+		{name: "dashes and digits", snippetName: "naming-v2", content: "Prefix resource names with the release name."},
+		{name: "largest content", snippetName: "labels", content: strings.Repeat("a", MaxPromptSnippetBytes)},
+		{name: "uppercase", snippetName: "Labels", content: "Always add labels.", wantErr: "invalid snippet name"},
+		{name: "path", snippetName: "../labels", content: "Always add labels.", wantErr: "invalid snippet name"},
+		{name: "empty content", snippetName: "labels", content: " \n", wantErr: "content is empty"},
+		{name: "too large", snippetName: "labels", content: strings.Repeat("a", MaxPromptSnippetBytes+1), wantErr: "the most is 4000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePromptSnippet(tt.snippetName, tt.content)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
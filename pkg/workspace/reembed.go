@@ -0,0 +1,92 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"go.uber.org/zap"
+)
+
+// DefaultReembedBatchSize is how many stale file revisions EnqueueStaleEmbeddings reads at a time
+const DefaultReembedBatchSize = 500
+
+type staleEmbeddingsQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// EnqueueStaleEmbeddings queues a summarize task for each file revision with embeddings from a
+// provider other than provider, so that the worker embeds it again, and returns how many it
+// queued. It reads batchSize file revisions at a time. Files of archived workspaces are left
+// alone, they're deleted when their retention ends.
+func EnqueueStaleEmbeddings(ctx context.Context, provider string, batchSize int) (int, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return enqueueStaleEmbeddings(ctx, conn, provider, batchSize)
+}
+
+func enqueueStaleEmbeddings(ctx context.Context, db staleEmbeddingsQuerier, provider string, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultReembedBatchSize
+	}
+
+	query := `SELECT f.id, f.revision_number
+	FROM workspace_file f
+	JOIN workspace w ON w.id = f.workspace_id
+	WHERE
+		w.archived_at IS NULL
+		AND f.embeddings IS NOT NULL
+		AND COALESCE(f.embeddings_provider, $2) <> $1
+		AND (f.id, f.revision_number) > ($3, $4)
+	ORDER BY f.id, f.revision_number
+	LIMIT $5`
+
+	type fileRevision struct {
+		id             string
+		revisionNumber int
+	}
+
+	enqueued := 0
+	after := fileRevision{id: "", revisionNumber: -1}
+	for {
+		rows, err := db.Query(ctx, query, provider, embedding.LegacyProvider, after.id, after.revisionNumber, batchSize)
+		if err != nil {
+			return enqueued, fmt.Errorf("failed to list stale embeddings: %w", err)
+		}
+
+		batch := []fileRevision{}
+		for rows.Next() {
+			var file fileRevision
+			if err := rows.Scan(&file.id, &file.revisionNumber); err != nil {
+				rows.Close()
+				return enqueued, fmt.Errorf("failed to scan stale embeddings: %w", err)
+			}
+			batch = append(batch, file)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return enqueued, fmt.Errorf("failed to list stale embeddings: %w", err)
+		}
+
+		for _, file := range batch {
+			if err := enqueueSummarize(ctx, map[string]interface{}{
+				"fileId":   file.id,
+				"revision": file.revisionNumber,
+			}); err != nil {
+				return enqueued, fmt.Errorf("error enqueuing work: %w", err)
+			}
+			enqueued++
+		}
+
+		logger.Info("Enqueued stale embeddings", zap.String("provider", provider), zap.Int("batch", len(batch)), zap.Int("total", enqueued))
+
+		if len(batch) < batchSize {
+			return enqueued, nil
+		}
+		after = batch[len(batch)-1]
+	}
+}
@@ -0,0 +1,145 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEmbeddingProvider struct {
+	name string
+}
+
+func (p fakeEmbeddingProvider) Embed(ctx context.Context, text string) ([]float32, error) {
+	return nil, fmt.Errorf("%s can't embed in tests", p.name)
+}
+
+func (p fakeEmbeddingProvider) Dimensions() int {
+	return 4
+}
+
+func (p fakeEmbeddingProvider) Name() string {
+	return p.name
+}
+
+// stubEmbeddingProvider makes name the configured embedding provider for the test
+func stubEmbeddingProvider(t *testing.T, name string) {
+	original := embedding.Configured
+	t.Cleanup(func() { embedding.Configured = original })
+
+	embedding.Configured = func() (embedding.EmbeddingProvider, error) {
+		return fakeEmbeddingProvider{name: name}, nil
+	}
+}
+
+func vector(value string, dimensions int) string {
+	return "[" + strings.TrimSuffix(strings.Repeat(value+",", dimensions), ",") + "]"
+}
+
+// embeddingsTestWorkspace creates a workspace with files embedded by different providers. It runs
+// against the database in CHARTSMITH_TEST_PG_URI.
+func embeddingsTestWorkspace(t *testing.T) (context.Context, string) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping embeddings integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "embed-" + time.Now().Format("150405.000000")
+	archivedID := workspaceID + "-archived"
+	t.Cleanup(func() {
+		conn := persistence.MustGetPooledPostgresSession()
+		defer conn.Release()
+		conn.Exec(context.Background(), `DELETE FROM workspace_file WHERE workspace_id = $1 OR workspace_id = $2`, workspaceID, archivedID)
+		conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = $1 OR id = $2`, workspaceID, archivedID)
+	})
+
+	insertWorkspace := `INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number, archived_at)
+		VALUES ($1, now(), 'embeddings', 'user', 'manual', 1, $2)`
+	_, err := conn.Exec(ctx, insertWorkspace, workspaceID, nil)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, insertWorkspace, archivedID, time.Now())
+	require.NoError(t, err)
+
+	insertFile := `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, embeddings, embeddings_provider, embeddings_dimensions)
+		VALUES ($1, 1, 'chart', $2, $3, 'kind: ConfigMap', $4, $5, $6)`
+	files := []struct {
+		workspaceID string
+		name        string
+		embeddings  interface{}
+		provider    interface{}
+		dimensions  interface{}
+	}{
+		{workspaceID, "current", vector("0.5", 4), "current", 4},
+		{workspaceID, "other", vector("0.5", 8), "other", 8},
+		{workspaceID, "legacy", vector("0.5", 1024), nil, nil},
+		{workspaceID, "unembedded", nil, nil, nil},
+		{archivedID, "archived", vector("0.5", 8), "other", 8},
+	}
+	for _, f := range files {
+		_, err := conn.Exec(ctx, insertFile, f.workspaceID+"-"+f.name, f.workspaceID, "templates/"+f.name+".yaml", f.embeddings, f.provider, f.dimensions)
+		require.NoError(t, err)
+	}
+
+	return ctx, workspaceID
+}
+
+func TestListSimilarFilesIgnoresOtherProviders(t *testing.T) {
+	ctx, workspaceID := embeddingsTestWorkspace(t)
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	files, err := listSimilarFiles(ctx, conn, workspaceID, 1, vector("0.25", 4), "current")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, workspaceID+"-current", files[0].File.ID)
+	assert.InDelta(t, 1.0, files[0].Similarity, 0.0001)
+
+	// embeddings stored before providers were recorded are the legacy provider's
+	files, err = listSimilarFiles(ctx, conn, workspaceID, 1, vector("0.25", 1024), embedding.LegacyProvider)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, workspaceID+"-legacy", files[0].File.ID)
+}
+
+func TestEnqueueStaleEmbeddings(t *testing.T) {
+	ctx, workspaceID := embeddingsTestWorkspace(t)
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	enqueued := []string{}
+	original := enqueueSummarize
+	enqueueSummarize = func(ctx context.Context, payload map[string]interface{}) error {
+		fileID := payload["fileId"].(string)
+		// other tests' workspaces may have stale embeddings too
+		if strings.HasPrefix(fileID, workspaceID) {
+			enqueued = append(enqueued, fileID)
+		}
+		assert.Equal(t, 1, payload["revision"])
+		return nil
+	}
+	t.Cleanup(func() { enqueueSummarize = original })
+
+	// a batch size of 1 reads one file revision at a time
+	_, err := enqueueStaleEmbeddings(ctx, conn, "current", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{workspaceID + "-legacy", workspaceID + "-other"}, enqueued)
+}
@@ -0,0 +1,255 @@
+package workspace
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// k8sAPIVersionsJSON is the table of Kubernetes APIs the compatibility check knows about: when
+// each was introduced, deprecated and removed, and what replaces it. An API that isn't in the table
+// doesn't narrow the version range.
+//
+//go:embed k8s-api-versions.json
+var k8sAPIVersionsJSON []byte
+
+// k8sAPIVersion is an entry of the table, versions are Kubernetes minor versions such as "1.25"
+type k8sAPIVersion struct {
+	APIVersion   string `json:"apiVersion"`
+	Kind         string `json:"kind"`
+	IntroducedIn string `json:"introducedIn,omitempty"`
+	DeprecatedIn string `json:"deprecatedIn,omitempty"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+	Replacement  string `json:"replacement,omitempty"`
+}
+
+// k8sAPIVersions is the table by apiVersion and kind
+var k8sAPIVersions = mustLoadK8sAPIVersions()
+
+func mustLoadK8sAPIVersions() map[string]k8sAPIVersion {
+	var entries []k8sAPIVersion
+	if err := json.Unmarshal(k8sAPIVersionsJSON, &entries); err != nil {
+		panic(fmt.Sprintf("failed to load kubernetes api versions: %v", err))
+	}
+
+	byKey := map[string]k8sAPIVersion{}
+	for _, entry := range entries {
+		byKey[entry.APIVersion+"/"+entry.Kind] = entry
+	}
+	return byKey
+}
+
+// templateAPIVersionLine and templateKindLine match apiVersion and kind written literally in a
+// template, a value produced by template actions isn't read
+var (
+	templateAPIVersionLine = regexp.MustCompile(`(?m)^apiVersion:[ \t]*["']?([A-Za-z0-9./-]+)["']?[ \t]*$`)
+	templateKindLine       = regexp.MustCompile(`(?m)^kind:[ \t]*["']?([A-Za-z0-9]+)["']?[ \t]*$`)
+)
+
+// compatibilityDocument is the part of a rendered document the compatibility check reads
+type compatibilityDocument struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+}
+
+// CheckRenderCompatibility finds the Kubernetes versions that serve every API used by the rendered
+// manifests of a render, and the resources that use deprecated or removed APIs. templates are the
+// chart's templates by path. An apiVersion written in one of them that the render didn't output
+// is reported too, since other values would render it, but it doesn't narrow the range.
+func CheckRenderCompatibility(manifests []string, templates map[string]string) types.RenderCompatibility {
+	compatibility := types.RenderCompatibility{Findings: []types.CompatibilityFinding{}}
+	minVersion, maxVersion := 0, 0
+	rendered := map[string]bool{}
+
+	for _, manifest := range manifests {
+		for _, document := range documentSeparator.Split(manifest, -1) {
+			if isEmptyDocument(document) {
+				continue
+			}
+
+			var doc compatibilityDocument
+			if err := yaml.Unmarshal([]byte(document), &doc); err != nil || doc.Kind == "" {
+				continue
+			}
+			template := renderedSource(document)
+			rendered[template+"\n"+doc.APIVersion+"/"+doc.Kind] = true
+
+			entry, ok := k8sAPIVersions[doc.APIVersion+"/"+doc.Kind]
+			if !ok {
+				continue
+			}
+			if introduced := minorVersion(entry.IntroducedIn); introduced > minVersion {
+				minVersion = introduced
+			}
+			if removed := minorVersion(entry.RemovedIn); removed > 0 && (maxVersion == 0 || removed-1 < maxVersion) {
+				maxVersion = removed - 1
+			}
+			if entry.DeprecatedIn != "" || entry.RemovedIn != "" {
+				compatibility.Findings = append(compatibility.Findings, compatibilityFinding(entry, doc.Metadata.Name, template, true))
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(templates))
+	for path := range templates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, document := range documentSeparator.Split(templates[path], -1) {
+			apiVersion := templateAPIVersionLine.FindStringSubmatch(document)
+			kind := templateKindLine.FindStringSubmatch(document)
+			if apiVersion == nil || kind == nil {
+				continue
+			}
+			key := apiVersion[1] + "/" + kind[1]
+			if rendered[path+"\n"+key] {
+				continue
+			}
+			entry, ok := k8sAPIVersions[key]
+			if !ok || (entry.DeprecatedIn == "" && entry.RemovedIn == "") {
+				continue
+			}
+			compatibility.Findings = append(compatibility.Findings, compatibilityFinding(entry, "", path, false))
+		}
+	}
+
+	if minVersion > 0 {
+		compatibility.MinKubeVersion = formatMinorVersion(minVersion)
+	}
+	if maxVersion > 0 {
+		compatibility.MaxKubeVersion = formatMinorVersion(maxVersion)
+	}
+	compatibility.Summary = compatibilitySummary(compatibility, minVersion, maxVersion)
+	return compatibility
+}
+
+func compatibilityFinding(entry k8sAPIVersion, name string, template string, rendered bool) types.CompatibilityFinding {
+	return types.CompatibilityFinding{
+		APIVersion:   entry.APIVersion,
+		Kind:         entry.Kind,
+		Name:         name,
+		Template:     template,
+		Rendered:     rendered,
+		DeprecatedIn: entry.DeprecatedIn,
+		RemovedIn:    entry.RemovedIn,
+		Replacement:  entry.Replacement,
+	}
+}
+
+// renderedSource returns the template a rendered document comes from, from the "# Source:" comment
+// helm template prints, without the chart name
+func renderedSource(document string) string {
+	for _, line := range strings.Split(document, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "# Source:") {
+			continue
+		}
+		source := strings.TrimSpace(strings.TrimPrefix(line, "# Source:"))
+		if _, path, found := strings.Cut(source, "/"); found {
+			return path
+		}
+		return source
+	}
+	return ""
+}
+
+// compatibilitySummary describes the range and findings in one line
+func compatibilitySummary(compatibility types.RenderCompatibility, minVersion int, maxVersion int) string {
+	rendered, templates := 0, 0
+	for _, finding := range compatibility.Findings {
+		if finding.Rendered {
+			rendered++
+		} else {
+			templates++
+		}
+	}
+
+	var summary string
+	switch {
+	case maxVersion > 0 && minVersion > maxVersion:
+		summary = fmt.Sprintf("no Kubernetes version serves every API: needs %s, but uses APIs removed after %s", compatibility.MinKubeVersion, compatibility.MaxKubeVersion)
+	case minVersion > 0 && maxVersion > 0:
+		summary = fmt.Sprintf("compatible with Kubernetes %s to %s", compatibility.MinKubeVersion, compatibility.MaxKubeVersion)
+	case minVersion > 0:
+		summary = fmt.Sprintf("compatible with Kubernetes %s and later", compatibility.MinKubeVersion)
+	case maxVersion > 0:
+		summary = fmt.Sprintf("compatible with Kubernetes %s and earlier", compatibility.MaxKubeVersion)
+	default:
+		summary = "no Kubernetes version limits found"
+	}
+
+	if rendered > 0 {
+		summary += fmt.Sprintf(", %d %s deprecated or removed APIs", rendered, pluralize(rendered, "resource uses", "resources use"))
+	}
+	if templates > 0 {
+		summary += fmt.Sprintf(", %d more in templates not rendered with these values", templates)
+	}
+	return summary
+}
+
+func pluralize(n int, singular string, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+// minorVersion returns the minor of a "1.N" version, 0 when it's empty
+func minorVersion(version string) int {
+	minor, err := strconv.Atoi(strings.TrimPrefix(version, "1."))
+	if err != nil {
+		return 0
+	}
+	return minor
+}
+
+func formatMinorVersion(minor int) string {
+	return fmt.Sprintf("1.%d", minor)
+}
+
+// SetRenderedCompatibility stores the compatibility report of a render
+func SetRenderedCompatibility(ctx context.Context, renderID string, compatibility types.RenderCompatibility) error {
+	b, err := json.Marshal(compatibility)
+	if err != nil {
+		return fmt.Errorf("failed to marshal compatibility: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered SET compatibility = $2 WHERE id = $1`
+	if _, err := conn.Exec(ctx, query, renderID, b); err != nil {
+		return fmt.Errorf("failed to set rendered compatibility: %w", err)
+	}
+	return nil
+}
+
+// ChartTemplates returns the content of the files in a chart's templates directories, including
+// those of its subcharts, by path
+func ChartTemplates(files []types.File, usePendingContent bool) map[string]string {
+	templates := map[string]string{}
+	for _, file := range files {
+		if !strings.HasPrefix(file.FilePath, "templates/") && !strings.Contains(file.FilePath, "/templates/") {
+			continue
+		}
+		content := file.Content
+		if usePendingContent && file.ContentPending != nil {
+			content = *file.ContentPending
+		}
+		templates[file.FilePath] = content
+	}
+	return templates
+}
@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRenderCompatibility(t *testing.T) {
+	manifest, err := os.ReadFile(filepath.Join("testdata", "render-compatibility", "legacy.yaml"))
+	require.NoError(t, err)
+	templates := map[string]string{
+		"templates/cronjob.yaml": "apiVersion: batch/v1beta1\nkind: CronJob\nmetadata:\n  name: {{ .Release.Name }}-cleanup\n",
+		"templates/ingress.yaml": "{{- if .Values.ingress.enabled }}\napiVersion: extensions/v1beta1\nkind: Ingress\nmetadata:\n  name: {{ .Release.Name }}\n{{- end }}\n",
+		"templates/hpa.yaml":     "apiVersion: {{ include \"legacy.hpa.apiVersion\" . }}\nkind: HorizontalPodAutoscaler\n",
+	}
+
+	compatibility := CheckRenderCompatibility([]string{string(manifest)}, templates)
+
+	assert.Equal(t, types.RenderCompatibility{
+		// policy/v1 PodDisruptionBudget is served from 1.21, batch/v1beta1 CronJob and
+		// policy/v1beta1 PodSecurityPolicy aren't served from 1.25
+		MinKubeVersion: "1.21",
+		MaxKubeVersion: "1.24",
+		Summary:        "compatible with Kubernetes 1.21 to 1.24, 2 resources use deprecated or removed APIs, 1 more in templates not rendered with these values",
+		Findings: []types.CompatibilityFinding{
+			{APIVersion: "batch/v1beta1", Kind: "CronJob", Name: "legacy-cleanup", Template: "templates/cronjob.yaml", Rendered: true, DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "batch/v1"},
+			{APIVersion: "policy/v1beta1", Kind: "PodSecurityPolicy", Name: "legacy", Template: "templates/psp.yaml", Rendered: true, DeprecatedIn: "1.21", RemovedIn: "1.25"},
+			{APIVersion: "extensions/v1beta1", Kind: "Ingress", Template: "templates/ingress.yaml", DeprecatedIn: "1.14", RemovedIn: "1.22", Replacement: "networking.k8s.io/v1"},
+		},
+	}, compatibility)
+}
+
+func TestCheckRenderCompatibilitySummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{
+			name:     "no known apis",
+			manifest: "kind: ConfigMap\napiVersion: v1\n---\nkind: Widget\napiVersion: example.com/v1\n",
+			want:     "no Kubernetes version limits found",
+		},
+		{
+			name:     "only a minimum",
+			manifest: "apiVersion: autoscaling/v2\nkind: HorizontalPodAutoscaler\n---\napiVersion: apps/v1\nkind: Deployment\n",
+			want:     "compatible with Kubernetes 1.23 and later",
+		},
+		{
+			name:     "only a maximum",
+			manifest: "apiVersion: extensions/v1beta1\nkind: Ingress\n",
+			want:     "compatible with Kubernetes 1.21 and earlier, 1 resource uses deprecated or removed APIs",
+		},
+		{
+			name:     "no version serves every api",
+			manifest: "apiVersion: autoscaling/v2\nkind: HorizontalPodAutoscaler\n---\napiVersion: extensions/v1beta1\nkind: Deployment\n",
+			want:     "no Kubernetes version serves every API: needs 1.23, but uses APIs removed after 1.15, 1 resource uses deprecated or removed APIs",
+		},
+		{
+			name:     "unparseable documents are skipped",
+			manifest: "apiVersion: batch/v1\nkind: CronJob\n---\n: not yaml [\n",
+			want:     "compatible with Kubernetes 1.21 and later",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CheckRenderCompatibility([]string{tt.manifest}, nil).Summary)
+		})
+	}
+}
+
+func TestChartTemplates(t *testing.T) {
+	pending := "kind: Pending"
+	files := []types.File{
+		{FilePath: "Chart.yaml", Content: "name: app"},
+		{FilePath: "values.yaml", Content: "replicas: 1"},
+		{FilePath: "templates/deployment.yaml", Content: "kind: Deployment", ContentPending: &pending},
+		{FilePath: "charts/redis/templates/statefulset.yaml", Content: "kind: StatefulSet"},
+	}
+
+	assert.Equal(t, map[string]string{
+		"templates/deployment.yaml":               "kind: Deployment",
+		"charts/redis/templates/statefulset.yaml": "kind: StatefulSet",
+	}, ChartTemplates(files, false))
+	assert.Equal(t, "kind: Pending", ChartTemplates(files, true)["templates/deployment.yaml"])
+}
@@ -0,0 +1,246 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+)
+
+const (
+	// maxFixPlanErrorLines limits the error lines of each chart quoted in a fix plan message
+	maxFixPlanErrorLines = 20
+	// maxFixPlanTemplates limits the templates of each chart quoted in a fix plan message, the
+	// first ones the errors point to
+	maxFixPlanTemplates = 3
+	// maxFixPlanTemplateBytes limits how much of each template is quoted in a fix plan message
+	maxFixPlanTemplateBytes = 32 << 10
+
+	// fixPlanInstruction is what a fix plan message asks for
+	fixPlanInstruction = "Fix the chart so that helm template renders it without these errors. Change only what's needed to fix them and keep the chart's values and behavior otherwise the same."
+)
+
+// ErrRenderHasNoErrors is returned when asking to fix a render that has no failed charts
+var ErrRenderHasNoErrors = errors.New("render has no template errors")
+
+// renderFailure is a chart that failed to render, with the templates its errors point to
+type renderFailure struct {
+	ChartName string
+	Errors    []string
+	Templates []failedTemplate
+}
+
+// failedTemplate is a template an error points to, with its content as it was rendered
+type failedTemplate struct {
+	Location helmutils.TemplateErrorLocation
+	Content  string
+}
+
+// GetRenderWorkspaceID returns the ID of the workspace a render is of
+func GetRenderWorkspaceID(ctx context.Context, renderID string) (string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var workspaceID string
+	if err := conn.QueryRow(ctx, `SELECT workspace_id FROM workspace_rendered WHERE id = $1`, renderID).Scan(&workspaceID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrRenderNotFound
+		}
+		return "", fmt.Errorf("failed to get render: %w", err)
+	}
+	return workspaceID, nil
+}
+
+// CreateFixPlanChatMessage creates a chat message on behalf of userID that asks for the template
+// errors of a render to be fixed, and enqueues it to have a plan created for it. The message
+// quotes the errors of each failed chart and the templates they point to, and is flagged as
+// system generated.
+func CreateFixPlanChatMessage(ctx context.Context, renderID string, userID string) (*types.Chat, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var workspaceID string
+	var revisionNumber int
+	err := conn.QueryRow(ctx, `SELECT workspace_id, revision_number FROM workspace_rendered WHERE id = $1`, renderID).Scan(&workspaceID, &revisionNumber)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRenderNotFound
+		}
+		return nil, fmt.Errorf("failed to get render: %w", err)
+	}
+
+	if err := ensureNotArchived(ctx, conn, workspaceID); err != nil {
+		return nil, err
+	}
+
+	// helm_template_errors outlives compaction, the stderr is split again for renders from before
+	// it was stored
+	query := `SELECT rc.chart_id, COALESCE(c.name, ''), COALESCE(rc.helm_template_stderr, ''), rc.helm_template_errors
+		FROM workspace_rendered_chart rc
+		LEFT JOIN workspace_chart c ON c.id = rc.chart_id AND c.workspace_id = $2 AND c.revision_number = $3
+		WHERE rc.workspace_render_id = $1 AND rc.is_success = false AND rc.completed_at IS NOT NULL
+		ORDER BY c.name, rc.chart_id`
+	rows, err := conn.Query(ctx, query, renderID, workspaceID, revisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed charts: %w", err)
+	}
+	defer rows.Close()
+
+	chartIDs := []string{}
+	failures := []renderFailure{}
+	for rows.Next() {
+		var chartID, stderr string
+		var failure renderFailure
+		var templateErrors []string
+		if err := rows.Scan(&chartID, &failure.ChartName, &stderr, &templateErrors); err != nil {
+			return nil, fmt.Errorf("failed to scan failed chart: %w", err)
+		}
+		if templateErrors == nil {
+			_, templateErrors = helmutils.SplitHelmTemplateStderr(stderr)
+		}
+		if len(templateErrors) == 0 {
+			continue
+		}
+		failure.Errors = helmutils.TrimHelmTemplateErrors(templateErrors, maxFixPlanErrorLines)
+		chartIDs = append(chartIDs, chartID)
+		failures = append(failures, failure)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list failed charts: %w", err)
+	}
+	rows.Close()
+
+	if len(failures) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRenderHasNoErrors, renderID)
+	}
+
+	for i := range failures {
+		for _, location := range helmutils.HelmTemplateErrorLocations(failures[i].Errors) {
+			if len(failures[i].Templates) == maxFixPlanTemplates {
+				break
+			}
+			if hasFailedTemplate(failures[i].Templates, location.Path) {
+				continue
+			}
+
+			// templates are quoted as the revision rendered them, with their pending content.
+			// Subchart templates that aren't files of the workspace aren't found and are skipped.
+			var content string
+			query := `SELECT COALESCE(content_pending, content) FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 AND chart_id = $3 AND file_path = $4`
+			err := conn.QueryRow(ctx, query, workspaceID, revisionNumber, chartIDs[i], location.Path).Scan(&content)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					continue
+				}
+				return nil, fmt.Errorf("failed to get template %s: %w", location.Path, err)
+			}
+			failures[i].Templates = append(failures[i].Templates, failedTemplate{Location: location, Content: content})
+		}
+	}
+
+	var currentRevision int
+	if err := conn.QueryRow(ctx, `SELECT current_revision_number FROM workspace WHERE id = $1`, workspaceID).Scan(&currentRevision); err != nil {
+		return nil, fmt.Errorf("failed to get workspace revision: %w", err)
+	}
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate random ID: %w", err)
+	}
+
+	query = `INSERT INTO workspace_chat (
+		id, workspace_id, created_at, sent_by, prompt, response, revision_number, is_canceled,
+		is_intent_complete, is_intent_conversational, is_intent_plan, is_intent_off_topic,
+		is_intent_chart_developer, is_intent_chart_operator, is_intent_render, is_system_generated
+	)
+	VALUES ($1, $2, now(), $3, $4, null, $5, false, false, false, false, false, false, false, false, true)`
+	if _, err := conn.Exec(ctx, query, id, workspaceID, userID, fixPlanPrompt(failures), currentRevision); err != nil {
+		return nil, fmt.Errorf("failed to insert chat message: %w", err)
+	}
+
+	// the intent isn't classified, the message always asks for a plan
+	if err := persistence.EnqueueWork(ctx, "new_intent", map[string]interface{}{
+		"chatMessageId": id,
+		"workspaceId":   workspaceID,
+		"forcePlan":     true,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to enqueue intent: %w", err)
+	}
+
+	return GetChatMessage(ctx, id)
+}
+
+// truncateOnRune cuts s to at most n bytes without splitting a multi-byte character
+func truncateOnRune(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func hasFailedTemplate(templates []failedTemplate, filePath string) bool {
+	for _, template := range templates {
+		if template.Location.Path == filePath {
+			return true
+		}
+	}
+	return false
+}
+
+// fixPlanPrompt is the prompt of a chat message that asks for the errors of failed charts to be
+// fixed
+func fixPlanPrompt(failures []renderFailure) string {
+	var b strings.Builder
+	b.WriteString("Rendering the chart with helm template failed.\n")
+
+	for _, failure := range failures {
+		b.WriteString("\n")
+		if failure.ChartName != "" {
+			fmt.Fprintf(&b, "Errors rendering %s:\n", failure.ChartName)
+		} else {
+			b.WriteString("Errors:\n")
+		}
+		b.WriteString("```\n")
+		for _, line := range failure.Errors {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		b.WriteString("```\n")
+
+		for _, template := range failure.Templates {
+			content := template.Content
+			truncated := len(content) > maxFixPlanTemplateBytes
+			if truncated {
+				content = truncateOnRune(content, maxFixPlanTemplateBytes)
+			}
+
+			b.WriteString("\n")
+			if template.Location.Line > 0 {
+				fmt.Fprintf(&b, "%s, helm reports the error at line %d:\n", template.Location.Path, template.Location.Line)
+			} else {
+				fmt.Fprintf(&b, "%s:\n", template.Location.Path)
+			}
+			b.WriteString("```\n")
+			b.WriteString(strings.TrimRight(content, "\n"))
+			b.WriteString("\n")
+			if truncated {
+				b.WriteString("... (truncated)\n")
+			}
+			b.WriteString("```\n")
+		}
+	}
+
+	b.WriteString("\n")
+	b.WriteString(fixPlanInstruction)
+	return b.String()
+}
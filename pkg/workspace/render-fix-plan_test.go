@@ -0,0 +1,52 @@
+package workspace
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixPlanPrompt(t *testing.T) {
+	failures := []renderFailure{
+		{
+			ChartName: "nginx",
+			Errors: []string{
+				`Error: template: nginx/templates/deployment.yaml:3:20: executing "nginx/templates/deployment.yaml" at <.Values.image.tag>: nil pointer evaluating interface {}.tag`,
+			},
+			Templates: []failedTemplate{
+				{
+					Location: helmutils.TemplateErrorLocation{Chart: "nginx", Path: "templates/deployment.yaml", Line: 3, Column: 20},
+					Content:  "kind: Deployment\nspec:\n  image: {{ .Values.image.tag }}\n",
+				},
+				{
+					Location: helmutils.TemplateErrorLocation{Chart: "nginx", Path: "templates/_helpers.tpl"},
+					Content:  strings.Repeat("a", maxFixPlanTemplateBytes+10),
+				},
+			},
+		},
+	}
+
+	prompt := fixPlanPrompt(failures)
+
+	assert.Contains(t, prompt, "Errors rendering nginx:\n```\nError: template: nginx/templates/deployment.yaml:3:20:")
+	assert.Contains(t, prompt, "templates/deployment.yaml, helm reports the error at line 3:\n```\nkind: Deployment\nspec:\n  image: {{ .Values.image.tag }}\n```\n")
+	assert.Contains(t, prompt, "templates/_helpers.tpl:\n```\n")
+	assert.Contains(t, prompt, "... (truncated)\n")
+	assert.NotContains(t, prompt, strings.Repeat("a", maxFixPlanTemplateBytes+1))
+	assert.True(t, strings.HasSuffix(prompt, fixPlanInstruction))
+}
+
+func TestFixPlanPromptTruncatesOnRune(t *testing.T) {
+	// the 3 byte character straddles the limit
+	content := strings.Repeat("a", maxFixPlanTemplateBytes-1) + "€" + "tail"
+	prompt := fixPlanPrompt([]renderFailure{{
+		Templates: []failedTemplate{{Location: helmutils.TemplateErrorLocation{Path: "templates/configmap.yaml"}, Content: content}},
+	}})
+
+	assert.True(t, utf8.ValidString(prompt))
+	assert.Contains(t, prompt, strings.Repeat("a", maxFixPlanTemplateBytes-1)+"\n... (truncated)\n")
+	assert.NotContains(t, prompt, "tail")
+}
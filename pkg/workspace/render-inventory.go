@@ -0,0 +1,181 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// documentSeparator splits a stream of YAML documents, as helm template prints them
+var documentSeparator = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
+// replicatedKinds are the workloads with spec.replicas
+var replicatedKinds = map[string]bool{
+	"Deployment":            true,
+	"StatefulSet":           true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+}
+
+// inventoryDocument is the part of a rendered document the inventory reads
+type inventoryDocument struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec yaml.Node `yaml:"spec"`
+}
+
+// BuildRenderInventory counts what the rendered manifests of each chart deploy. Parsing is best
+// effort, a document that isn't a YAML object with a kind is counted as unparsed and the rest of
+// the manifests are still read.
+func BuildRenderInventory(manifests ...string) types.RenderInventory {
+	inventory := types.RenderInventory{
+		Kinds:      map[string]int{},
+		Namespaces: []string{},
+		Images:     []string{},
+	}
+	namespaces := map[string]bool{}
+	images := map[string]bool{}
+
+	for _, manifest := range manifests {
+		for _, document := range documentSeparator.Split(manifest, -1) {
+			if isEmptyDocument(document) {
+				continue
+			}
+
+			var doc inventoryDocument
+			if err := yaml.Unmarshal([]byte(document), &doc); err != nil || doc.Kind == "" {
+				inventory.Unparsed++
+				continue
+			}
+
+			inventory.Kinds[doc.Kind]++
+			if doc.Metadata.Namespace != "" {
+				namespaces[doc.Metadata.Namespace] = true
+			}
+			if doc.Kind == "Namespace" && doc.Metadata.Name != "" {
+				namespaces[doc.Metadata.Name] = true
+			}
+
+			var spec map[string]interface{}
+			if doc.Spec.Kind != 0 {
+				// a spec that isn't an object has nothing to count
+				_ = doc.Spec.Decode(&spec)
+			}
+
+			if replicatedKinds[doc.Kind] {
+				inventory.TotalReplicas += replicas(spec)
+			}
+			for _, image := range podImages(doc.Kind, spec) {
+				images[image] = true
+			}
+		}
+	}
+
+	for namespace := range namespaces {
+		inventory.Namespaces = append(inventory.Namespaces, namespace)
+	}
+	sort.Strings(inventory.Namespaces)
+	for image := range images {
+		inventory.Images = append(inventory.Images, image)
+	}
+	sort.Strings(inventory.Images)
+
+	return inventory
+}
+
+// isEmptyDocument reports whether a document has nothing but comments, like the # Source: line
+// helm prints before a template that rendered empty
+func isEmptyDocument(document string) bool {
+	for _, line := range strings.Split(document, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+func replicas(spec map[string]interface{}) int {
+	switch n := spec["replicas"].(type) {
+	case int:
+		return n
+	case nil:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// podImages returns the images of the pod spec of a document, wherever its kind keeps it
+func podImages(kind string, spec map[string]interface{}) []string {
+	var podSpec interface{}
+	switch kind {
+	case "Pod":
+		podSpec = spec
+	case "CronJob":
+		podSpec = dig(spec, "jobTemplate", "spec", "template", "spec")
+	default:
+		podSpec = dig(spec, "template", "spec")
+	}
+
+	podSpecMap, ok := podSpec.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	images := []string{}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := podSpecMap[field].([]interface{})
+		for _, container := range containers {
+			containerMap, ok := container.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// a tag like 1.25 renders unquoted, so the image isn't always a string
+			image := strings.TrimSpace(fmt.Sprint(containerMap["image"]))
+			if containerMap["image"] == nil || image == "" {
+				continue
+			}
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+func dig(value interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// SetRenderedInventory stores the inventory of a render
+func SetRenderedInventory(ctx context.Context, renderID string, inventory types.RenderInventory) error {
+	b, err := json.Marshal(inventory)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inventory: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered SET inventory = $2 WHERE id = $1`
+	if _, err := conn.Exec(ctx, query, renderID, b); err != nil {
+		return fmt.Errorf("failed to set rendered inventory: %w", err)
+	}
+	return nil
+}
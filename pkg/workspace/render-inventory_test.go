@@ -0,0 +1,86 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readInventoryFixture(t *testing.T, name string) string {
+	content, err := os.ReadFile(filepath.Join("testdata", "render-inventory", name))
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestBuildRenderInventory(t *testing.T) {
+	inventory := BuildRenderInventory(readInventoryFixture(t, "app.yaml"), readInventoryFixture(t, "redis.yaml"))
+
+	assert.Equal(t, types.RenderInventory{
+		Kinds: map[string]int{
+			"Namespace":      1,
+			"ServiceAccount": 1,
+			"Service":        1,
+			"Deployment":     2,
+			"StatefulSet":    1,
+			"CronJob":        1,
+			"DaemonSet":      1,
+			"Pod":            1,
+		},
+		Namespaces: []string{"app-system", "data", "default"},
+		Images: []string{
+			"busybox",
+			"envoyproxy/envoy:v1.29",
+			"oliver006/redis_exporter:v1.58.0",
+			"postgres:16",
+			"redis:7.2",
+			"registry.example.com/app-migrations:2.4.1",
+			"registry.example.com/app:2.4.1",
+		},
+		// 3 + 2 from the deployments and the 1 the statefulset defaults to
+		TotalReplicas: 6,
+		Unparsed:      2,
+	}, inventory)
+}
+
+func TestBuildRenderInventoryEdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     types.RenderInventory
+	}{
+		{
+			name:     "empty",
+			manifest: "",
+			want:     types.RenderInventory{Kinds: map[string]int{}, Namespaces: []string{}, Images: []string{}},
+		},
+		{
+			name:     "single document without separator",
+			manifest: "kind: Deployment\nspec:\n  replicas: 0\n  template:\n    spec:\n      containers:\n        - image: nginx:1.25\n",
+			want:     types.RenderInventory{Kinds: map[string]int{"Deployment": 1}, Namespaces: []string{}, Images: []string{"nginx:1.25"}},
+		},
+		{
+			name:     "templated replicas that didn't render to a number",
+			manifest: "kind: Deployment\nspec:\n  replicas: \"3\"\n",
+			want:     types.RenderInventory{Kinds: map[string]int{"Deployment": 1}, Namespaces: []string{}, Images: []string{}},
+		},
+		{
+			name:     "spec that isn't an object",
+			manifest: "kind: Deployment\nspec: nope\n---\nkind: Pod\nspec:\n  containers:\n    - name: no-image\n",
+			want:     types.RenderInventory{Kinds: map[string]int{"Deployment": 1, "Pod": 1}, Namespaces: []string{}, Images: []string{}, TotalReplicas: 1},
+		},
+		{
+			name:     "list of strings",
+			manifest: "- a\n- b\n",
+			want:     types.RenderInventory{Kinds: map[string]int{}, Namespaces: []string{}, Images: []string{}, Unparsed: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BuildRenderInventory(tt.manifest))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"go.uber.org/zap"
+)
+
+const (
+	// RenderCompactionInterval is how often the artifacts of old renders are compacted
+	RenderCompactionInterval = time.Hour
+
+	// DefaultRenderArtifactsKept is how many of the latest renders of a workspace keep their artifacts
+	DefaultRenderArtifactsKept = 10
+
+	// renderCompactionBatchSize bounds the renders compacted by each statement, so that the rows of
+	// a batch aren't locked for long
+	renderCompactionBatchSize = 100
+)
+
+// compactableRendersQuery selects the renders whose artifacts can be compacted: renders that are
+// complete, aren't one of the $1 latest renders of their workspace, aren't of the workspace's
+// current revision and haven't been compacted yet
+const compactableRendersQuery = `SELECT r.id FROM (
+		SELECT id, workspace_id, revision_number, created_at, completed_at, artifacts_compacted_at,
+			row_number() OVER (PARTITION BY workspace_id ORDER BY created_at DESC, id DESC) AS recency
+		FROM workspace_rendered
+	) r
+	JOIN workspace w ON w.id = r.workspace_id
+	WHERE r.recency > $1
+		AND r.revision_number <> w.current_revision_number
+		AND r.completed_at IS NOT NULL
+		AND r.artifacts_compacted_at IS NULL
+	ORDER BY r.created_at`
+
+// compactRendersQuery compacts a batch of at most $2 renders, nulling the commands and output of
+// their charts and marking them compacted in the same statement, so a render can't become protected
+// between being selected and being compacted. The debug output of debug renders goes with them.
+// Status, warnings, errors, notes, inventory and compatibility are kept.
+const compactRendersQuery = `WITH compactable AS (` + compactableRendersQuery + ` LIMIT $2),
+	charts AS (
+		UPDATE workspace_rendered_chart SET
+			dep_update_command = NULL, dep_update_stdout = NULL, dep_update_stderr = NULL,
+			helm_template_command = NULL, helm_template_stdout = NULL, helm_template_stderr = NULL,
+			helm_template_debug = NULL
+		WHERE workspace_render_id IN (SELECT id FROM compactable)
+	)
+	UPDATE workspace_rendered SET artifacts_compacted_at = now() WHERE id IN (SELECT id FROM compactable)`
+
+// renderArtifactsQuery counts the renders that would be compacted and the bytes of their artifacts
+const renderArtifactsQuery = `WITH compactable AS (` + compactableRendersQuery + `)
+	SELECT
+		(SELECT count(*) FROM compactable),
+		COALESCE(sum(
+			COALESCE(octet_length(c.dep_update_command), 0) + COALESCE(octet_length(c.dep_update_stdout), 0) + COALESCE(octet_length(c.dep_update_stderr), 0) +
+			COALESCE(octet_length(c.helm_template_command), 0) + COALESCE(octet_length(c.helm_template_stdout), 0) + COALESCE(octet_length(c.helm_template_stderr), 0) +
+			COALESCE(octet_length(c.helm_template_debug::text), 0)
+		), 0)
+	FROM workspace_rendered_chart c WHERE c.workspace_render_id IN (SELECT id FROM compactable)`
+
+// renderedFilesKeptQuery selects the revisions whose rendered files are kept: the revisions of the
+// $1 latest renders of each workspace, of the renders that are still running, and each workspace's
+// current revision
+const renderedFilesKeptQuery = `SELECT workspace_id, revision_number FROM (
+		SELECT workspace_id, revision_number, completed_at,
+			row_number() OVER (PARTITION BY workspace_id ORDER BY created_at DESC, id DESC) AS recency
+		FROM workspace_rendered
+	) r WHERE r.recency <= $1 OR r.completed_at IS NULL
+	UNION
+	SELECT id, current_revision_number FROM workspace`
+
+// compactableRenderedFilesQuery selects the rendered files of the revisions that aren't kept
+const compactableRenderedFilesQuery = `SELECT f.ctid, f.content FROM workspace_rendered_file f
+	WHERE NOT EXISTS (
+		SELECT 1 FROM kept k WHERE k.workspace_id = f.workspace_id AND k.revision_number = f.revision_number
+	)`
+
+// compactRenderedFilesQuery deletes a batch of at most $2 rendered files of revisions that aren't kept
+const compactRenderedFilesQuery = `WITH kept AS (` + renderedFilesKeptQuery + `),
+	compactable AS (` + compactableRenderedFilesQuery + ` LIMIT $2)
+	DELETE FROM workspace_rendered_file WHERE ctid IN (SELECT ctid FROM compactable)`
+
+// renderedFilesQuery counts the rendered files that would be deleted and the bytes of their content
+const renderedFilesQuery = `WITH kept AS (` + renderedFilesKeptQuery + `),
+	compactable AS (` + compactableRenderedFilesQuery + `)
+	SELECT count(*), COALESCE(sum(octet_length(content)), 0) FROM compactable`
+
+type renderCompactionDB interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CompactRenderArtifacts drops the helm commands and output of the renders that aren't among the
+// latest keep renders of their workspace or of its current revision, keeping their status and
+// summaries. The rendered files of the revisions that none of those renders are of are deleted. With
+// dryRun nothing is changed, what would be compacted is logged instead.
+func CompactRenderArtifacts(ctx context.Context, keep int, dryRun bool) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if dryRun {
+		renders, bytes, err := countCompactableRenders(ctx, conn, keep)
+		if err != nil {
+			return fmt.Errorf("failed to count compactable renders: %w", err)
+		}
+		files, fileBytes, err := countCompactableRenderedFiles(ctx, conn, keep)
+		if err != nil {
+			return fmt.Errorf("failed to count compactable rendered files: %w", err)
+		}
+		logger.Info("Render artifacts would be compacted (dry run)", zap.Int("renders", renders), zap.Int64("bytes", bytes),
+			zap.Int("renderedFiles", files), zap.Int64("renderedFileBytes", fileBytes), zap.Int("kept", keep))
+		return nil
+	}
+
+	compacted, err := compactRenderArtifacts(ctx, conn, keep, renderCompactionBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to compact render artifacts: %w", err)
+	}
+	deleted, err := compactRenderedFiles(ctx, conn, keep, renderCompactionBatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to compact rendered files: %w", err)
+	}
+	if compacted > 0 || deleted > 0 {
+		logger.Info("Compacted render artifacts", zap.Int64("renders", compacted), zap.Int64("renderedFiles", deleted))
+	}
+
+	return nil
+}
+
+// compactRenderArtifacts compacts the compactable renders batchSize at a time until none are left
+// and returns how many were compacted
+func compactRenderArtifacts(ctx context.Context, db renderCompactionDB, keep int, batchSize int) (int64, error) {
+	var compacted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return compacted, err
+		}
+		tag, err := db.Exec(ctx, compactRendersQuery, keep, batchSize)
+		if err != nil {
+			return compacted, fmt.Errorf("failed to compact renders: %w", err)
+		}
+		compacted += tag.RowsAffected()
+		if tag.RowsAffected() < int64(batchSize) {
+			return compacted, nil
+		}
+	}
+}
+
+// compactRenderedFiles deletes the rendered files of the revisions that aren't kept batchSize at a
+// time until none are left and returns how many were deleted
+func compactRenderedFiles(ctx context.Context, db renderCompactionDB, keep int, batchSize int) (int64, error) {
+	var deleted int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+		tag, err := db.Exec(ctx, compactRenderedFilesQuery, keep, batchSize)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete rendered files: %w", err)
+		}
+		deleted += tag.RowsAffected()
+		if tag.RowsAffected() < int64(batchSize) {
+			return deleted, nil
+		}
+	}
+}
+
+func countCompactableRenderedFiles(ctx context.Context, db renderCompactionDB, keep int) (int, int64, error) {
+	var files int
+	var bytes int64
+	if err := db.QueryRow(ctx, renderedFilesQuery, keep).Scan(&files, &bytes); err != nil {
+		return 0, 0, err
+	}
+	return files, bytes, nil
+}
+
+func countCompactableRenders(ctx context.Context, db renderCompactionDB, keep int) (int, int64, error) {
+	var renders int
+	var bytes int64
+	if err := db.QueryRow(ctx, renderArtifactsQuery, keep).Scan(&renders, &bytes); err != nil {
+		return 0, 0, err
+	}
+	return renders, bytes, nil
+}
@@ -0,0 +1,150 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompactRenderArtifacts compacts the renders of a workspace and checks that the latest
+// renders, the renders of the current revision and renders in progress keep their artifacts and the
+// rendered files of the revisions none of them are of are deleted. It runs against the database in
+// CHARTSMITH_TEST_PG_URI.
+func TestCompactRenderArtifacts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping render retention integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "retention-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_rendered_file WHERE workspace_id = $1`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace_rendered_chart WHERE workspace_render_id IN (SELECT id FROM workspace_rendered WHERE workspace_id = $1)`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace_rendered WHERE workspace_id = $1`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = $1`, workspaceID)
+	})
+	_, err := conn.Exec(ctx, `INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number) VALUES ($1, now(), 'retention', 'user', 'test', 3)`, workspaceID)
+	require.NoError(t, err)
+
+	// oldest first: two old renders, a render of the current revision that's older than the latest
+	// two, a render that's still running, and the latest two
+	renders := []struct {
+		name      string
+		revision  int
+		completed bool
+		compacted bool
+	}{
+		{name: "old-1", revision: 1, completed: true, compacted: true},
+		{name: "old-2", revision: 2, completed: true, compacted: true},
+		{name: "current-revision", revision: 3, completed: true},
+		{name: "running", revision: 2, completed: false},
+		{name: "latest-2", revision: 2, completed: true},
+		{name: "latest-1", revision: 3, completed: true},
+	}
+	start := time.Now().Add(-time.Hour)
+	for i, render := range renders {
+		id := workspaceID + "-" + render.name
+		var completedAt *time.Time
+		if render.completed {
+			at := start.Add(time.Duration(i)*time.Minute + time.Second)
+			completedAt = &at
+		}
+		_, err := conn.Exec(ctx, `INSERT INTO workspace_rendered (id, workspace_id, revision_number, created_at, completed_at) VALUES ($1, $2, $3, $4, $5)`,
+			id, workspaceID, render.revision, start.Add(time.Duration(i)*time.Minute), completedAt)
+		require.NoError(t, err)
+		_, err = conn.Exec(ctx, `INSERT INTO workspace_rendered_chart (id, workspace_render_id, chart_id, created_at, is_success, dep_update_command, dep_update_stdout, dep_update_stderr, helm_template_command, helm_template_stdout, helm_template_stderr, notes, helm_template_debug)
+			VALUES ($1 || '-chart', $1, 'chart', now(), true, 'helm dep update', 'updated', '', 'helm template', 'kind: Deployment', 'warning', 'installed', '{"computedValues": "port: 80\n"}')`, id)
+		require.NoError(t, err)
+	}
+
+	// only old-1 is of revision 1, revision 2 has the running and latest-2 renders
+	for revision := 1; revision <= 3; revision++ {
+		_, err := conn.Exec(ctx, `INSERT INTO workspace_rendered_file (file_id, workspace_id, revision_number, file_path, content, workspace_rendered_chart_id) VALUES ('deployment', $1, $2, 'templates/deployment.yaml', 'kind: Deployment', 'chart')`,
+			workspaceID, revision)
+		require.NoError(t, err)
+	}
+	renderedFiles := func() []int {
+		rows, err := conn.Query(ctx, `SELECT revision_number FROM workspace_rendered_file WHERE workspace_id = $1 ORDER BY revision_number`, workspaceID)
+		require.NoError(t, err)
+		defer rows.Close()
+		revisions := []int{}
+		for rows.Next() {
+			var revision int
+			require.NoError(t, rows.Scan(&revision))
+			revisions = append(revisions, revision)
+		}
+		require.NoError(t, rows.Err())
+		return revisions
+	}
+
+	artifacts := func(name string) (sql.NullString, sql.NullString, *time.Time) {
+		var stdout, notes sql.NullString
+		var compactedAt *time.Time
+		err := conn.QueryRow(ctx, `SELECT c.helm_template_stdout, c.notes, r.artifacts_compacted_at
+			FROM workspace_rendered r JOIN workspace_rendered_chart c ON c.workspace_render_id = r.id WHERE r.id = $1`, workspaceID+"-"+name).Scan(&stdout, &notes, &compactedAt)
+		require.NoError(t, err)
+		return stdout, notes, compactedAt
+	}
+
+	renderCount, bytes, err := countCompactableRenders(ctx, conn, 2)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, renderCount, 2)
+	assert.GreaterOrEqual(t, bytes, int64(2*len("helm dep updateupdatedhelm templatekind: Deploymentwarning")))
+	stdout, _, compactedAt := artifacts("old-1")
+	assert.Equal(t, "kind: Deployment", stdout.String, "counting doesn't compact")
+	assert.Nil(t, compactedAt)
+
+	fileCount, _, err := countCompactableRenderedFiles(ctx, conn, 2)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, fileCount, 1)
+	assert.Equal(t, []int{1, 2, 3}, renderedFiles(), "counting doesn't delete")
+
+	// a batch size of 1 compacts the renders one statement at a time
+	_, err = compactRenderArtifacts(ctx, conn, 2, 1)
+	require.NoError(t, err)
+
+	for _, render := range renders {
+		stdout, notes, compactedAt := artifacts(render.name)
+		assert.Equal(t, "installed", notes.String, render.name)
+		var hasDebug bool
+		require.NoError(t, conn.QueryRow(ctx, `SELECT helm_template_debug IS NOT NULL FROM workspace_rendered_chart WHERE workspace_render_id = $1`, workspaceID+"-"+render.name).Scan(&hasDebug))
+		assert.Equal(t, !render.compacted, hasDebug, render.name)
+		if render.compacted {
+			assert.False(t, stdout.Valid, render.name)
+			assert.NotNil(t, compactedAt, render.name)
+			continue
+		}
+		assert.Equal(t, "kind: Deployment", stdout.String, render.name)
+		assert.Nil(t, compactedAt, render.name)
+	}
+
+	_, err = compactRenderedFiles(ctx, conn, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, renderedFiles(), "the rendered files of revision 1 are deleted")
+
+	// compacting again finds nothing of this workspace to compact
+	var compactedAt1 time.Time
+	require.NoError(t, conn.QueryRow(ctx, `SELECT artifacts_compacted_at FROM workspace_rendered WHERE id = $1`, workspaceID+"-old-1").Scan(&compactedAt1))
+	_, err = compactRenderArtifacts(ctx, conn, 2, renderCompactionBatchSize)
+	require.NoError(t, err)
+	_, _, compactedAt = artifacts("old-1")
+	require.NotNil(t, compactedAt)
+	assert.True(t, compactedAt1.Equal(*compactedAt), "old-1 was compacted again")
+}
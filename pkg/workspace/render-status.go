@@ -0,0 +1,26 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// GetRenderOfWorkspace returns a render of a workspace with its charts, including the debug output
+// of a debug render. It returns ErrRenderNotFound for a render of another workspace.
+func GetRenderOfWorkspace(ctx context.Context, workspaceID string, renderID string) (*types.Rendered, error) {
+	rendered, err := getRendered(ctx, renderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRenderNotFound
+		}
+		return nil, fmt.Errorf("failed to get render: %w", err)
+	}
+	if rendered.WorkspaceID != workspaceID {
+		return nil, ErrRenderNotFound
+	}
+	return rendered, nil
+}
@@ -0,0 +1,105 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrRenderedFileNotFound is returned for a path that a render has no rendered file for
+var ErrRenderedFileNotFound = errors.New("rendered file not found")
+
+// RenderedResource is a file of a render with the template it was rendered from and the values
+// that template references
+type RenderedResource struct {
+	RenderID string
+	FilePath string
+	Rendered string
+	Template string
+	// Values are the values.yaml keys the template references, by dotted path, with their values
+	Values map[string]interface{}
+}
+
+// GetRenderedResource returns a rendered file of a render of a workspace, with its template and
+// the values it references. The template and values.yaml are read as the revision renders them,
+// with their pending content.
+func GetRenderedResource(ctx context.Context, workspaceID string, renderID string, filePath string) (*RenderedResource, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var renderWorkspaceID string
+	var revisionNumber int
+	err := conn.QueryRow(ctx, `SELECT workspace_id, revision_number FROM workspace_rendered WHERE id = $1`, renderID).Scan(&renderWorkspaceID, &revisionNumber)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRenderNotFound
+		}
+		return nil, fmt.Errorf("failed to get render: %w", err)
+	}
+	if renderWorkspaceID != workspaceID {
+		return nil, ErrRenderNotFound
+	}
+
+	// rendered files are keyed by the ID of the template they were rendered from
+	query := `SELECT rf.content, COALESCE(f.content_pending, f.content), f.chart_id
+		FROM workspace_rendered_file rf
+		JOIN workspace_file f ON f.id = rf.file_id AND f.workspace_id = rf.workspace_id AND f.revision_number = rf.revision_number
+		WHERE rf.workspace_id = $1 AND rf.revision_number = $2 AND rf.file_path = $3`
+	resource := RenderedResource{RenderID: renderID, FilePath: filePath}
+	var chartID string
+	err = conn.QueryRow(ctx, query, workspaceID, revisionNumber, filePath).Scan(&resource.Rendered, &resource.Template, &chartID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRenderedFileNotFound
+		}
+		return nil, fmt.Errorf("failed to get rendered file: %w", err)
+	}
+
+	valuesYAML := ""
+	query = `SELECT COALESCE(content_pending, content) FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 AND chart_id = $3 AND file_path = 'values.yaml'`
+	if err := conn.QueryRow(ctx, query, workspaceID, revisionNumber, chartID).Scan(&valuesYAML); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get values.yaml: %w", err)
+	}
+
+	resource.Values, err = ReferencedValues(types.File{FilePath: filePath, Content: resource.Template}, valuesYAML)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resource, nil
+}
+
+// GetRenderedExplanation returns the cached explanation of a rendered file of a render of a
+// workspace, false when there's none
+func GetRenderedExplanation(ctx context.Context, workspaceID string, renderID string, filePath string) (string, bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT explanation FROM workspace_rendered_explanation WHERE workspace_render_id = $1 AND file_path = $2 AND workspace_id = $3`
+	var explanation string
+	if err := conn.QueryRow(ctx, query, renderID, filePath, workspaceID).Scan(&explanation); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to get rendered explanation: %w", err)
+	}
+	return explanation, true, nil
+}
+
+// SetRenderedExplanation caches the explanation of a rendered file of a render
+func SetRenderedExplanation(ctx context.Context, workspaceID string, renderID string, filePath string, model string, explanation string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO workspace_rendered_explanation (workspace_render_id, file_path, workspace_id, model, explanation, created_at)
+		VALUES ($1, $2, $3, $4, $5, now())
+		ON CONFLICT (workspace_render_id, file_path) DO UPDATE SET model = EXCLUDED.model, explanation = EXCLUDED.explanation, created_at = EXCLUDED.created_at`
+	if _, err := conn.Exec(ctx, query, renderID, filePath, workspaceID, model, explanation); err != nil {
+		return fmt.Errorf("failed to cache rendered explanation: %w", err)
+	}
+	return nil
+}
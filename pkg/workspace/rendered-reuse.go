@@ -0,0 +1,210 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ListChangedFilesBetweenRevisions returns the files that were added, removed or modified between
+// two revisions of a workspace. Only the ID, chart ID and path of each file are populated. When
+// usePendingContent is set, files in toRevision with pending content are also considered changed.
+func ListChangedFilesBetweenRevisions(ctx context.Context, workspaceID string, fromRevision int, toRevision int, usePendingContent bool) ([]types.File, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT
+		COALESCE(n.id, o.id),
+		COALESCE(n.chart_id, o.chart_id),
+		COALESCE(n.file_path, o.file_path)
+	FROM (SELECT * FROM workspace_file WHERE workspace_id = $1 AND revision_number = $3) n
+	FULL OUTER JOIN (SELECT * FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2) o ON n.id = o.id
+	WHERE n.id IS NULL
+		OR o.id IS NULL
+		OR n.content IS DISTINCT FROM o.content
+		OR n.file_path IS DISTINCT FROM o.file_path
+		OR n.chart_id IS DISTINCT FROM o.chart_id
+		OR ($4 AND n.content_pending IS NOT NULL)`
+
+	rows, err := conn.Query(ctx, query, workspaceID, fromRevision, toRevision, usePendingContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changed files: %w", err)
+	}
+	defer rows.Close()
+
+	var files []types.File
+	for rows.Next() {
+		var file types.File
+		if err := rows.Scan(&file.ID, &file.ChartID, &file.FilePath); err != nil {
+			return nil, fmt.Errorf("failed to scan changed file: %w", err)
+		}
+		file.WorkspaceID = workspaceID
+		file.RevisionNumber = toRevision
+		files = append(files, file)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating changed files: %w", err)
+	}
+
+	return files, nil
+}
+
+// ChartsWithChanges returns the set of chart IDs that have at least one changed file
+func ChartsWithChanges(changedFiles []types.File) map[string]bool {
+	charts := map[string]bool{}
+	for _, file := range changedFiles {
+		charts[file.ChartID] = true
+	}
+	return charts
+}
+
+// GetPreviousRenderedChart returns the most recent successful render of a chart at a revision,
+// or nil if the chart has never been rendered successfully at that revision. Renders with a values
+// profile are skipped, their output isn't what the chart's own values render to, and so are debug
+// renders, renders whose artifacts were compacted and renders from before rendered files were
+// recorded with their chart, none of them stored files to reuse.
+func GetPreviousRenderedChart(ctx context.Context, workspaceID string, revisionNumber int, chartID string) (*types.RenderedChart, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT
+		rc.id, rc.chart_id, rc.is_success,
+		rc.dep_update_command, rc.dep_update_stdout, rc.dep_update_stderr,
+		rc.helm_template_command, rc.helm_template_stdout, rc.helm_template_stderr,
+		rc.helm_template_warnings, rc.helm_template_errors, rc.notes,
+		rc.created_at, rc.completed_at
+	FROM workspace_rendered_chart rc
+	JOIN workspace_rendered r ON r.id = rc.workspace_render_id
+	WHERE r.workspace_id = $1 AND r.revision_number = $2 AND rc.chart_id = $3
+		AND rc.completed_at IS NOT NULL AND rc.is_success = true AND r.values_profile IS NULL AND NOT r.is_debug AND r.artifacts_compacted_at IS NULL
+		AND EXISTS (SELECT 1 FROM workspace_rendered_file rf WHERE rf.workspace_id = r.workspace_id AND rf.revision_number = r.revision_number AND rf.workspace_rendered_chart_id = rc.id)
+	ORDER BY rc.completed_at DESC
+	LIMIT 1`
+
+	var renderedChart types.RenderedChart
+	var depUpdateCommand, depUpdateStdout, depUpdateStderr sql.NullString
+	var helmTemplateCommand, helmTemplateStdout, helmTemplateStderr sql.NullString
+	var completedAt sql.NullTime
+
+	err := conn.QueryRow(ctx, query, workspaceID, revisionNumber, chartID).Scan(
+		&renderedChart.ID, &renderedChart.ChartID, &renderedChart.IsSuccess,
+		&depUpdateCommand, &depUpdateStdout, &depUpdateStderr,
+		&helmTemplateCommand, &helmTemplateStdout, &helmTemplateStderr,
+		&renderedChart.HelmTemplateWarnings, &renderedChart.HelmTemplateErrors, &renderedChart.Notes,
+		&renderedChart.CreatedAt, &completedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get previous rendered chart: %w", err)
+	}
+
+	renderedChart.WorkspaceID = workspaceID
+	renderedChart.DepupdateCommand = depUpdateCommand.String
+	renderedChart.DepupdateStdout = depUpdateStdout.String
+	renderedChart.DepupdateStderr = depUpdateStderr.String
+	renderedChart.HelmTemplateCommand = helmTemplateCommand.String
+	renderedChart.HelmTemplateStdout = helmTemplateStdout.String
+	renderedChart.HelmTemplateStderr = helmTemplateStderr.String
+	renderedChart.CompletedAt = &completedAt.Time
+
+	return &renderedChart, nil
+}
+
+// ReuseRenderedChart completes a rendered chart using the output of a previous render of the same
+// chart, and copies the files that render stored forward to toRevision. It returns the copied files.
+func ReuseRenderedChart(ctx context.Context, workspaceID string, fromRevision int, toRevision int, renderedChartID string, previous *types.RenderedChart, chartFiles []types.File) ([]types.RenderedFile, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `SELECT file_id, file_path, content FROM workspace_rendered_file WHERE workspace_id = $1 AND revision_number = $2 AND workspace_rendered_chart_id = $3`,
+		workspaceID, fromRevision, previous.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list previous rendered files: %w", err)
+	}
+
+	var previousFiles []types.RenderedFile
+	for rows.Next() {
+		var file types.RenderedFile
+		if err := rows.Scan(&file.ID, &file.FilePath, &file.RenderedContent); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan previous rendered file: %w", err)
+		}
+		file.WorkspaceID = workspaceID
+		file.RevisionNumber = fromRevision
+		previousFiles = append(previousFiles, file)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating previous rendered files: %w", err)
+	}
+
+	copied := copyForwardRenderedFiles(previousFiles, chartFiles, toRevision)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, file := range copied {
+		batch.Queue(`INSERT INTO workspace_rendered_file (file_id, workspace_id, revision_number, file_path, content, workspace_rendered_chart_id) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (file_id, workspace_id, revision_number) DO UPDATE SET content = EXCLUDED.content, workspace_rendered_chart_id = EXCLUDED.workspace_rendered_chart_id`,
+			file.ID, workspaceID, toRevision, file.FilePath, file.RenderedContent, renderedChartID)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, fmt.Errorf("failed to copy rendered files: %w", err)
+	}
+
+	query := `UPDATE workspace_rendered_chart
+		SET dep_update_command = $2, dep_update_stdout = $3, dep_update_stderr = $4, helm_template_command = $5, helm_template_stdout = $6, helm_template_stderr = $7, completed_at = now(), is_success = $8,
+			helm_template_warnings = $9, helm_template_errors = $10, notes = $11
+		WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, renderedChartID,
+		previous.DepupdateCommand, previous.DepupdateStdout, previous.DepupdateStderr,
+		previous.HelmTemplateCommand, previous.HelmTemplateStdout, previous.HelmTemplateStderr,
+		previous.IsSuccess, previous.HelmTemplateWarnings, previous.HelmTemplateErrors, previous.Notes); err != nil {
+		return nil, fmt.Errorf("failed to update rendered chart: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return copied, nil
+}
+
+// copyForwardRenderedFiles returns the previously rendered files that belong to the chart, moved to
+// toRevision. File IDs are stable across revisions, so the rendered files keep the same IDs.
+func copyForwardRenderedFiles(previousFiles []types.RenderedFile, chartFiles []types.File, toRevision int) []types.RenderedFile {
+	chartFileIDs := map[string]types.File{}
+	for _, file := range chartFiles {
+		chartFileIDs[file.ID] = file
+	}
+
+	copied := []types.RenderedFile{}
+	for _, previous := range previousFiles {
+		chartFile, ok := chartFileIDs[previous.ID]
+		if !ok {
+			continue
+		}
+
+		copied = append(copied, types.RenderedFile{
+			ID:              previous.ID,
+			RevisionNumber:  toRevision,
+			ChartID:         chartFile.ChartID,
+			WorkspaceID:     previous.WorkspaceID,
+			FilePath:        chartFile.FilePath,
+			RenderedContent: previous.RenderedContent,
+		})
+	}
+
+	return copied
+}
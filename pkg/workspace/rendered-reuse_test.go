@@ -0,0 +1,45 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyForwardRenderedFiles(t *testing.T) {
+	previous := []types.RenderedFile{
+		{ID: "deployment", WorkspaceID: "ws", RevisionNumber: 3, FilePath: "templates/deployment.yaml", RenderedContent: "kind: Deployment"},
+		{ID: "service", WorkspaceID: "ws", RevisionNumber: 3, FilePath: "templates/service.yaml", RenderedContent: "kind: Service"},
+		{ID: "other-chart", WorkspaceID: "ws", RevisionNumber: 3, FilePath: "templates/configmap.yaml", RenderedContent: "kind: ConfigMap"},
+	}
+
+	chartFiles := []types.File{
+		{ID: "deployment", ChartID: "chart-a", FilePath: "templates/deployment.yaml"},
+		{ID: "service", ChartID: "chart-a", FilePath: "templates/service.yaml"},
+		{ID: "values", ChartID: "chart-a", FilePath: "values.yaml"},
+	}
+
+	copied := copyForwardRenderedFiles(previous, chartFiles, 4)
+
+	assert.Equal(t, []types.RenderedFile{
+		{ID: "deployment", WorkspaceID: "ws", RevisionNumber: 4, ChartID: "chart-a", FilePath: "templates/deployment.yaml", RenderedContent: "kind: Deployment"},
+		{ID: "service", WorkspaceID: "ws", RevisionNumber: 4, ChartID: "chart-a", FilePath: "templates/service.yaml", RenderedContent: "kind: Service"},
+	}, copied)
+}
+
+func TestCopyForwardRenderedFilesNoPrevious(t *testing.T) {
+	copied := copyForwardRenderedFiles(nil, []types.File{{ID: "deployment", ChartID: "chart-a"}}, 2)
+	assert.Empty(t, copied)
+}
+
+func TestChartsWithChanges(t *testing.T) {
+	changed := ChartsWithChanges([]types.File{
+		{ID: "a", ChartID: "chart-a"},
+		{ID: "b", ChartID: "chart-a"},
+		{ID: "c", ChartID: "chart-c"},
+	})
+
+	assert.Equal(t, map[string]bool{"chart-a": true, "chart-c": true}, changed)
+	assert.False(t, changed["chart-b"])
+}
@@ -3,12 +3,14 @@ package workspace
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"runtime/debug"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/param"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
 	"github.com/tuvistavie/securerandom"
@@ -33,7 +35,7 @@ func FailRendered(ctx context.Context, id string, errorMessage string) error {
 	// Use a background context if the provided context is already done
 	if ctx.Err() != nil {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel = context.WithTimeout(context.Background(), param.GetTimeouts().DBOperation)
 		defer cancel()
 	}
 
@@ -81,7 +83,7 @@ func GetRendered(ctx context.Context, id string) (*types.Rendered, error) {
 	defer conn.Release()
 	logger.Debug("Got DB connection", zap.String("id", id))
 
-	query := `SELECT id, workspace_id, revision_number, created_at, completed_at, is_autorender FROM workspace_rendered WHERE id = $1`
+	query := `SELECT id, workspace_id, revision_number, created_at, completed_at, is_autorender, COALESCE(values_profile, ''), is_debug, inventory, compatibility, artifacts_compacted_at FROM workspace_rendered WHERE id = $1`
 	logger.Debug("Executing first query", 
 		zap.String("id", id),
 		zap.String("query", query))
@@ -91,9 +93,11 @@ func GetRendered(ctx context.Context, id string) (*types.Rendered, error) {
 
 	var rendered types.Rendered
 	var completedAt sql.NullTime
+	var inventory []byte
+	var compatibility []byte
 	
 	logger.Debug("About to scan row", zap.String("id", id))
-	if err := row.Scan(&rendered.ID, &rendered.WorkspaceID, &rendered.RevisionNumber, &rendered.CreatedAt, &completedAt, &rendered.IsAutorender); err != nil {
+	if err := row.Scan(&rendered.ID, &rendered.WorkspaceID, &rendered.RevisionNumber, &rendered.CreatedAt, &completedAt, &rendered.IsAutorender, &rendered.ValuesProfile, &rendered.IsDebug, &inventory, &compatibility, &rendered.ArtifactsCompactedAt); err != nil {
 		logger.Error(fmt.Errorf("failed to scan row: %w", err),
 			zap.String("id", id))
 		return nil, fmt.Errorf("failed to get rendered: %w", err)
@@ -104,8 +108,20 @@ func GetRendered(ctx context.Context, id string) (*types.Rendered, error) {
 		zap.Int("revisionNumber", rendered.RevisionNumber))
 
 	rendered.CompletedAt = &completedAt.Time
+	if inventory != nil {
+		rendered.Inventory = &types.RenderInventory{}
+		if err := json.Unmarshal(inventory, rendered.Inventory); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rendered inventory: %w", err)
+		}
+	}
+	if compatibility != nil {
+		rendered.Compatibility = &types.RenderCompatibility{}
+		if err := json.Unmarshal(compatibility, rendered.Compatibility); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rendered compatibility: %w", err)
+		}
+	}
 	
-	query = `SELECT id, chart_id, is_success, dep_update_command, dep_update_stdout, dep_update_stderr, helm_template_command, helm_template_stdout, helm_template_stderr, created_at, completed_at FROM workspace_rendered_chart WHERE workspace_render_id = $1`
+	query = `SELECT id, chart_id, is_success, dep_update_command, dep_update_stdout, dep_update_stderr, helm_template_command, helm_template_stdout, helm_template_stderr, helm_template_warnings, helm_template_errors, cluster_dry_run, notes, helm_template_debug, created_at, completed_at FROM workspace_rendered_chart WHERE workspace_render_id = $1`
 	
 	logger.Debug("Executing second query for charts", 
 		zap.String("id", id),
@@ -150,7 +166,7 @@ func GetRendered(ctx context.Context, id string) (*types.Rendered, error) {
 			zap.String("id", id),
 			zap.Int("rowNumber", rowCount))
 			
-		if err := rows.Scan(&renderedChart.ID, &renderedChart.ChartID, &renderedChart.IsSuccess, &depUpdateCommand, &depUpdateStdout, &depUpdateStderr, &helmTemplateCommand, &helmTemplateStdout, &helmTemplateStderr, &renderedChart.CreatedAt, &completedAt); err != nil {
+		if err := rows.Scan(&renderedChart.ID, &renderedChart.ChartID, &renderedChart.IsSuccess, &depUpdateCommand, &depUpdateStdout, &depUpdateStderr, &helmTemplateCommand, &helmTemplateStdout, &helmTemplateStderr, &renderedChart.HelmTemplateWarnings, &renderedChart.HelmTemplateErrors, &renderedChart.ClusterDryRun, &renderedChart.Notes, &renderedChart.Debug, &renderedChart.CreatedAt, &completedAt); err != nil {
 			logger.Error(fmt.Errorf("failed to scan chart row: %w", err),
 				zap.String("id", id),
 				zap.Int("rowNumber", rowCount))
@@ -267,7 +283,9 @@ func SetRenderedChartHelmTemplateStdout(ctx context.Context, renderedChartID str
 	return nil
 }
 
-func SetRenderedFileContents(ctx context.Context, workspaceID string, revisionNumber int, filePath string, renderedContent string) error {
+// SetRenderedFileContents stores a file rendered by a rendered chart as the rendered file of the
+// revision. Only renders with the chart's own values are stored, see GetPreviousRenderedChart.
+func SetRenderedFileContents(ctx context.Context, workspaceID string, revisionNumber int, renderedChartID string, filePath string, renderedContent string) error {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
@@ -282,8 +300,9 @@ func SetRenderedFileContents(ctx context.Context, workspaceID string, revisionNu
 		return fmt.Errorf("failed to get file id: %w", err)
 	}
 
-	query = `INSERT INTO workspace_rendered_file (file_id, workspace_id, revision_number, file_path, content) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (file_id, workspace_id, revision_number) DO UPDATE SET content = $5`
-	_, err = conn.Exec(ctx, query, fileID, workspaceID, revisionNumber, filePath, renderedContent)
+	query = `INSERT INTO workspace_rendered_file (file_id, workspace_id, revision_number, file_path, content, workspace_rendered_chart_id) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (file_id, workspace_id, revision_number) DO UPDATE SET content = $5, workspace_rendered_chart_id = $6`
+	_, err = conn.Exec(ctx, query, fileID, workspaceID, revisionNumber, filePath, renderedContent, renderedChartID)
 	if err != nil {
 		return fmt.Errorf("failed to insert rendered file: %w", err)
 	}
@@ -304,6 +323,62 @@ func SetRenderedChartHelmTemplateStderr(ctx context.Context, renderedChartID str
 	return nil
 }
 
+// SetRenderedChartHelmTemplateWarnings stores the warnings split out of the helm template stderr
+func SetRenderedChartHelmTemplateWarnings(ctx context.Context, renderedChartID string, warnings []string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered_chart SET helm_template_warnings = $2 WHERE id = $1`
+	_, err := conn.Exec(ctx, query, renderedChartID, warnings)
+	if err != nil {
+		return fmt.Errorf("failed to update rendered chart helmTemplateWarnings: %w", err)
+	}
+
+	return nil
+}
+
+// SetRenderedChartNotes stores the rendered NOTES.txt of a chart, nil when it has none
+func SetRenderedChartNotes(ctx context.Context, renderedChartID string, notes *string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered_chart SET notes = $2 WHERE id = $1`
+	_, err := conn.Exec(ctx, query, renderedChartID, notes)
+	if err != nil {
+		return fmt.Errorf("failed to update rendered chart notes: %w", err)
+	}
+
+	return nil
+}
+
+// SetRenderedChartDebug stores what helm template --debug printed for a chart of a debug render
+func SetRenderedChartDebug(ctx context.Context, renderedChartID string, debug types.RenderDebug) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered_chart SET helm_template_debug = $2 WHERE id = $1`
+	_, err := conn.Exec(ctx, query, renderedChartID, debug)
+	if err != nil {
+		return fmt.Errorf("failed to update rendered chart debug: %w", err)
+	}
+
+	return nil
+}
+
+// SetRenderedChartHelmTemplateErrors stores the errors split out of the helm template stderr
+func SetRenderedChartHelmTemplateErrors(ctx context.Context, renderedChartID string, templateErrors []string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `UPDATE workspace_rendered_chart SET helm_template_errors = $2 WHERE id = $1`
+	_, err := conn.Exec(ctx, query, renderedChartID, templateErrors)
+	if err != nil {
+		return fmt.Errorf("failed to update rendered chart helmTemplateErrors: %w", err)
+	}
+
+	return nil
+}
+
 func EnqueueRenderWorkspaceForRevisionWithPendingContent(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string) error {
 	logger.Info("EnqueueRenderWorkspaceForRevisionWithPendingContent",
 		zap.String("workspaceID", workspaceID),
@@ -311,7 +386,7 @@ func EnqueueRenderWorkspaceForRevisionWithPendingContent(ctx context.Context, wo
 		zap.String("chatMessageID", chatMessageID),
 	)
 
-	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, true)
+	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, true, false, "", false)
 }
 
 func EnqueueRenderWorkspaceForRevision(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string) error {
@@ -321,15 +396,59 @@ func EnqueueRenderWorkspaceForRevision(ctx context.Context, workspaceID string,
 		zap.String("chatMessageID", chatMessageID),
 	)
 
-	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, false)
+	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, false, false, "", false)
+}
+
+// EnqueueFullRenderWorkspaceForRevision renders every chart in the revision, including charts
+// that haven't changed since the parent revision
+func EnqueueFullRenderWorkspaceForRevision(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string) error {
+	logger.Info("EnqueueFullRenderWorkspaceForRevision",
+		zap.String("workspaceID", workspaceID),
+		zap.Int("revisionNumber", revisionNumber),
+		zap.String("chatMessageID", chatMessageID),
+	)
+
+	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, false, true, "", false)
+}
+
+// EnqueueRenderWorkspaceWithValuesProfile renders every chart in the revision with the named values
+// profile layered over values.yaml. Charts without a profile of that name render with values.yaml.
+func EnqueueRenderWorkspaceWithValuesProfile(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string, valuesProfile string) error {
+	logger.Info("EnqueueRenderWorkspaceWithValuesProfile",
+		zap.String("workspaceID", workspaceID),
+		zap.Int("revisionNumber", revisionNumber),
+		zap.String("chatMessageID", chatMessageID),
+		zap.String("valuesProfile", valuesProfile),
+	)
+
+	// renders of the parent revision used different values, so nothing can be reused
+	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, false, true, valuesProfile, false)
+}
+
+// EnqueueDebugRenderWorkspace renders every chart in the revision with helm template --debug, with
+// the named values profile layered over values.yaml when valuesProfile isn't empty. The debug
+// output is kept on the rendered charts and is only returned by the render status API.
+func EnqueueDebugRenderWorkspace(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string, valuesProfile string) error {
+	logger.Info("EnqueueDebugRenderWorkspace",
+		zap.String("workspaceID", workspaceID),
+		zap.Int("revisionNumber", revisionNumber),
+		zap.String("chatMessageID", chatMessageID),
+		zap.String("valuesProfile", valuesProfile),
+	)
+
+	// renders of the parent revision have no debug output to reuse
+	return enqueueRenderWorkspaceForRevision(ctx, workspaceID, revisionNumber, chatMessageID, false, true, valuesProfile, true)
 }
 
-func enqueueRenderWorkspaceForRevision(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string, usePendingContent bool) error {
+func enqueueRenderWorkspaceForRevision(ctx context.Context, workspaceID string, revisionNumber int, chatMessageID string, usePendingContent bool, forceAll bool, valuesProfile string, isDebug bool) error {
 	// Get workspace to retrieve charts
 	w, err := GetWorkspace(ctx, workspaceID)
 	if err != nil {
 		return fmt.Errorf("failed to get workspace: %w", err)
 	}
+	if w.ArchivedAt != nil {
+		return fmt.Errorf("failed to enqueue render: %w: %s", ErrWorkspaceArchived, workspaceID)
+	}
 
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
@@ -383,8 +502,8 @@ func enqueueRenderWorkspaceForRevision(ctx context.Context, workspaceID string,
 	}
 	defer tx.Rollback(ctx)
 
-	query = `INSERT INTO workspace_rendered (id, workspace_id, revision_number, created_at, is_autorender) VALUES ($1, $2, $3, now(), $4)`
-	_, err = tx.Exec(ctx, query, id, workspaceID, revisionNumber, usePendingContent)
+	query = `INSERT INTO workspace_rendered (id, workspace_id, revision_number, created_at, is_autorender, values_profile, is_debug) VALUES ($1, $2, $3, now(), $4, NULLIF($5, ''), $6)`
+	_, err = tx.Exec(ctx, query, id, workspaceID, revisionNumber, usePendingContent, valuesProfile, isDebug)
 	if err != nil {
 		return fmt.Errorf("failed to enqueue render workspace: %w", err)
 	}
@@ -415,10 +534,18 @@ func enqueueRenderWorkspaceForRevision(ctx context.Context, workspaceID string,
 		}
 	}
 
-	if err := persistence.EnqueueWork(ctx, "render_workspace", map[string]interface{}{
+	// renders requested from a chat message have a user waiting on them,
+	// so they're prioritized over system triggered re-renders
+	priority := persistence.WorkPriorityNormal
+	if chatMessageID != "" {
+		priority = persistence.WorkPriorityHigh
+	}
+
+	if err := persistence.EnqueueWorkWithPriority(ctx, "render_workspace", map[string]interface{}{
 		"id":                id,
 		"usePendingContent": usePendingContent,
-	}); err != nil {
+		"forceAll":          forceAll,
+	}, priority); err != nil {
 		return fmt.Errorf("failed to enqueue render workspace: %w", err)
 	}
 
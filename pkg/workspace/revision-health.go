@@ -0,0 +1,97 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// SetRevisionHealth stores the health score of a revision, replacing the score it had
+func SetRevisionHealth(ctx context.Context, workspaceID string, revisionNumber int, health lintrules.Health) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return setRevisionHealth(ctx, conn, workspaceID, revisionNumber, health)
+}
+
+// GetRevisionHealth returns the health score of a revision, or nil if it hasn't been scored
+func GetRevisionHealth(ctx context.Context, workspaceID string, revisionNumber int) (*lintrules.Health, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return getRevisionHealth(ctx, conn, workspaceID, revisionNumber)
+}
+
+// ListRevisionHealth returns the health scores of the revisions of a workspace that were scored,
+// oldest first
+func ListRevisionHealth(ctx context.Context, workspaceID string) ([]types.RevisionHealth, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT revision_number, created_at, health_score
+		FROM workspace_revision
+		WHERE workspace_id = $1 AND health_score IS NOT NULL
+		ORDER BY revision_number`
+	rows, err := conn.Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revision health: %w", err)
+	}
+	defer rows.Close()
+
+	history := []types.RevisionHealth{}
+	for rows.Next() {
+		var h types.RevisionHealth
+		if err := rows.Scan(&h.RevisionNumber, &h.CreatedAt, &h.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan revision health: %w", err)
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating revision health: %w", err)
+	}
+
+	return history, nil
+}
+
+func setRevisionHealth(ctx context.Context, q revisionQuerier, workspaceID string, revisionNumber int, health lintrules.Health) error {
+	marshaled, err := json.Marshal(health)
+	if err != nil {
+		return fmt.Errorf("failed to marshal health: %w", err)
+	}
+
+	query := `UPDATE workspace_revision SET health_score = $3, health = $4 WHERE workspace_id = $1 AND revision_number = $2`
+	tag, err := q.Exec(ctx, query, workspaceID, revisionNumber, health.Score, marshaled)
+	if err != nil {
+		return fmt.Errorf("failed to set revision health: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("revision %d of workspace %s not found", revisionNumber, workspaceID)
+	}
+	return nil
+}
+
+func getRevisionHealth(ctx context.Context, q revisionQuerier, workspaceID string, revisionNumber int) (*lintrules.Health, error) {
+	var marshaled []byte
+	err := q.QueryRow(ctx, `SELECT health FROM workspace_revision WHERE workspace_id = $1 AND revision_number = $2`, workspaceID, revisionNumber).Scan(&marshaled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get revision health: %w", err)
+	}
+	if marshaled == nil {
+		return nil, nil
+	}
+
+	var health lintrules.Health
+	if err := json.Unmarshal(marshaled, &health); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revision health: %w", err)
+	}
+	return &health, nil
+}
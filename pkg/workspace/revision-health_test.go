@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRevisionHealth stores and reads the health scores of revisions. It runs against the database
+// in CHARTSMITH_TEST_PG_URI.
+func TestRevisionHealth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping revision health integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "health-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_revision WHERE workspace_id = $1`, workspaceID)
+	})
+	_, err := conn.Exec(ctx, `INSERT INTO workspace_revision (workspace_id, revision_number, created_at, created_by_user_id, created_type, is_complete)
+		VALUES ($1, 1, NOW(), 'user', 'manual', true), ($1, 2, NOW(), 'user', 'plan', true), ($1, 3, NOW(), 'user', 'plan', false)`, workspaceID)
+	require.NoError(t, err)
+
+	health, err := getRevisionHealth(ctx, conn, workspaceID, 3)
+	require.NoError(t, err)
+	assert.Nil(t, health, "a revision that wasn't scored has no health")
+
+	scored := lintrules.Health{
+		Score:   70,
+		Charts:  []lintrules.ChartHealth{{ChartID: "chart", Score: 70, Categories: []lintrules.HealthCategory{{Name: "lint", Points: 40, MaxPoints: 60, Detail: "1 error, 1 warning"}}}},
+		Weights: lintrules.DefaultHealthWeights,
+	}
+	require.NoError(t, setRevisionHealth(ctx, conn, workspaceID, 1, lintrules.Health{Score: 40, Charts: []lintrules.ChartHealth{}}))
+	require.NoError(t, setRevisionHealth(ctx, conn, workspaceID, 3, lintrules.Health{Score: 55}))
+	// scoring a revision again replaces its score
+	require.NoError(t, setRevisionHealth(ctx, conn, workspaceID, 3, scored))
+	assert.Error(t, setRevisionHealth(ctx, conn, workspaceID, 4, scored))
+
+	health, err = getRevisionHealth(ctx, conn, workspaceID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, &scored, health)
+
+	history, err := ListRevisionHealth(ctx, workspaceID)
+	require.NoError(t, err)
+	scores := []int{}
+	for _, h := range history {
+		scores = append(scores, h.Score)
+	}
+	assert.Equal(t, []int{40, 70}, scores, "revision 2 wasn't scored")
+	assert.Equal(t, 3, history[1].RevisionNumber)
+}
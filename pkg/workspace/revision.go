@@ -2,7 +2,11 @@ package workspace
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/replicatedhq/chartsmith/pkg/logger"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
@@ -44,24 +48,209 @@ func GetRevision(ctx context.Context, workspaceID string, revisionNumber int) (*
 	return &revision, nil
 }
 
-func CreateRevision(ctx context.Context, workspaceID string, planID *string, userID string) (types.Revision, error) {
+// CreateRevisionOpts describes who and what created a new revision
+type CreateRevisionOpts struct {
+	PlanID      *string
+	UserID      string
+	CreatedType string // defaults to the created type of the latest revision
+}
+
+// revisionQuerier is the subset of pgx.Tx used to create a revision
+type revisionQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CreateRevision creates a new revision of the workspace with a copy of the charts and files
+// from fromRevision, and makes it the current revision. The copy happens in a single transaction
+// so a failure never leaves a partial revision behind, and waits for writes to the files being
+// copied. It returns the new revision number.
+func CreateRevision(ctx context.Context, workspaceID string, fromRevision int, opts CreateRevisionOpts) (int, error) {
 	logger.Info("Creating revision",
 		zap.String("workspace_id", workspaceID),
-		zap.String("user_id", userID))
+		zap.Int("from_revision", fromRevision),
+		zap.String("user_id", opts.UserID))
 
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
-	// Start transaction
 	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return types.Revision{}, err
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx) // Will be ignored if tx.Commit() is called
 
-	// Get next revision number
+	if err := lockRevisionFiles(ctx, tx, workspaceID, fromRevision); err != nil {
+		return 0, err
+	}
+
+	newRevisionNumber, err := createRevisionInTx(ctx, tx, workspaceID, fromRevision, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return newRevisionNumber, nil
+}
+
+// CreatePlanRevision is proceeding with a plan: it marks the plan proceeded and creates the
+// revision it's applied to from the workspace's current revision. When another plan of the
+// workspace is executing it returns an *ExecutionLockedError and creates nothing, the lock is
+// checked in the same transaction. It returns the new revision number.
+func CreatePlanRevision(ctx context.Context, planID string, userID string) (int, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var workspaceID string
+	var currentRevision int
+	err = tx.QueryRow(ctx, `SELECT p.workspace_id, w.current_revision_number FROM workspace_plan p
+		JOIN workspace w ON w.id = p.workspace_id
+		WHERE p.id = $1
+		FOR UPDATE OF w`, planID).Scan(&workspaceID, &currentRevision)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("%w: %s", ErrNoPlan, planID)
+		}
+		return 0, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	if err := checkPlanExecutionLock(ctx, tx, planID, ExecutionLockStaleAfter); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE workspace_plan SET proceed_at = now() WHERE id = $1`, planID); err != nil {
+		return 0, fmt.Errorf("failed to mark plan proceeded: %w", err)
+	}
+
+	if err := lockRevisionFiles(ctx, tx, workspaceID, currentRevision); err != nil {
+		return 0, err
+	}
+
+	newRevisionNumber, err := createRevisionInTx(ctx, tx, workspaceID, currentRevision, CreateRevisionOpts{
+		PlanID: &planID,
+		UserID: userID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return newRevisionNumber, nil
+}
+
+// Rollback is the revision a workspace was rolled back to
+type Rollback struct {
+	// RevisionNumber is the new revision with the files of the revision rolled back to
+	RevisionNumber int
+	// ChatMessageID is the latest chat message that offered the rollback, empty when there's none
+	ChatMessageID string
+}
+
+// RollbackToRevision restores the charts and files of a revision as a new, complete revision
+// that's made the current one. The revisions after it are kept in the history. It returns an
+// *ExecutionLockedError while a plan of the workspace is executing, so that the rollback isn't
+// overwritten by the plan, and ErrRevisionNotFound for a revision the workspace doesn't have.
+func RollbackToRevision(ctx context.Context, workspaceID string, revisionNumber int, userID string) (*Rollback, error) {
+	logger.Info("Rolling back to revision",
+		zap.String("workspace_id", workspaceID),
+		zap.Int("revision_number", revisionNumber),
+		zap.String("user_id", userID))
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM workspace_revision WHERE workspace_id = $1 AND revision_number = $2)
+		FROM workspace WHERE id = $1 FOR UPDATE`, workspaceID, revisionNumber).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, revisionNumber)
+	}
+
+	lockedErr := &ExecutionLockedError{WorkspaceID: workspaceID}
+	err = tx.QueryRow(ctx, `SELECT plan_id, acquired_at FROM workspace_execution_lock
+		WHERE workspace_id = $1 AND acquired_at >= now() - make_interval(secs => $2)`, workspaceID, ExecutionLockStaleAfter.Seconds()).Scan(&lockedErr.PlanID, &lockedErr.AcquiredAt)
+	if err == nil {
+		return nil, lockedErr
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to check execution lock: %w", err)
+	}
+
+	if err := lockRevisionFiles(ctx, tx, workspaceID, revisionNumber); err != nil {
+		return nil, err
+	}
+
+	newRevisionNumber, err := createRevisionInTx(ctx, tx, workspaceID, revisionNumber, CreateRevisionOpts{
+		UserID:      userID,
+		CreatedType: "rollback",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// no plan is applied to the copy, it's complete as soon as it exists
+	if _, err := tx.Exec(ctx, `UPDATE workspace_revision SET is_complete = true WHERE workspace_id = $1 AND revision_number = $2`, workspaceID, newRevisionNumber); err != nil {
+		return nil, fmt.Errorf("failed to complete revision: %w", err)
+	}
+
+	rollback := &Rollback{RevisionNumber: newRevisionNumber}
+	err = tx.QueryRow(ctx, `SELECT id FROM workspace_chat WHERE workspace_id = $1 AND response_rollback_to_revision_number = $2
+		ORDER BY created_at DESC LIMIT 1`, workspaceID, revisionNumber).Scan(&rollback.ChatMessageID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get rollback chat message: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return rollback, nil
+}
+
+// lockRevisionFiles locks the files of a revision so that copying it doesn't take a file halfway
+// through a write to it
+func lockRevisionFiles(ctx context.Context, tx pgx.Tx, workspaceID string, revisionNumber int) error {
+	var paths []string
+	err := tx.QueryRow(ctx, `SELECT COALESCE(array_agg(file_path), '{}') FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2`, workspaceID, revisionNumber).Scan(&paths)
+	if err != nil {
+		return fmt.Errorf("failed to list files to copy: %w", err)
+	}
+	return lockFiles(ctx, tx, workspaceID, revisionNumber, paths...)
+}
+
+// createRevisionInTx runs a fixed number of statements regardless of the number of charts and files
+func createRevisionInTx(ctx context.Context, q revisionQuerier, workspaceID string, fromRevision int, opts CreateRevisionOpts) (int, error) {
+	var createdType *string
+	if opts.CreatedType != "" {
+		createdType = &opts.CreatedType
+	}
+
 	var newRevisionNumber int
-	err = tx.QueryRow(ctx, `
+	err := q.QueryRow(ctx, `
         WITH latest_revision AS (
             SELECT * FROM workspace_revision
             WHERE workspace_id = $1
@@ -82,76 +271,56 @@ func CreateRevision(ctx context.Context, workspaceID string, planID *string, use
             next_num,
             NOW(),
             $2,
-            COALESCE(lr.created_type, 'manual'),
+            COALESCE($4, lr.created_type, 'manual'),
             false,
             false,
             $3
         FROM next_revision
         LEFT JOIN latest_revision lr ON true
         RETURNING revision_number
-    `, workspaceID, userID, planID).Scan(&newRevisionNumber)
+    `, workspaceID, opts.UserID, opts.PlanID, createdType).Scan(&newRevisionNumber)
 	if err != nil {
-		return types.Revision{}, err
+		return 0, fmt.Errorf("failed to insert revision: %w", err)
 	}
 
-	previousRevisionNumber := newRevisionNumber - 1
-
-	// Copy workspace_chart records from previous revision
-	_, err = tx.Exec(ctx, `
+	// Copy workspace_chart records from the source revision
+	_, err = q.Exec(ctx, `
         INSERT INTO workspace_chart (id, revision_number, workspace_id, name)
         SELECT id, $1, workspace_id, name
         FROM workspace_chart
         WHERE workspace_id = $2 AND revision_number = $3
-    `, newRevisionNumber, workspaceID, previousRevisionNumber)
+    `, newRevisionNumber, workspaceID, fromRevision)
 	if err != nil {
-		return types.Revision{}, err
+		return 0, fmt.Errorf("failed to copy charts: %w", err)
 	}
 
-	// Copy workspace_file records from previous revision
-	_, err = tx.Exec(ctx, `
+	// Copy workspace_file records from the source revision
+	_, err = q.Exec(ctx, `
         INSERT INTO workspace_file (
             id, revision_number, chart_id, workspace_id, file_path,
-            content, embeddings
+            content, content_sha, line_ending, embeddings, embeddings_provider, embeddings_dimensions
         )
         SELECT
             id, $1, chart_id, workspace_id, file_path,
-            content, embeddings
+            content, content_sha, line_ending, embeddings, embeddings_provider, embeddings_dimensions
         FROM workspace_file
         WHERE workspace_id = $2 AND revision_number = $3
-    `, newRevisionNumber, workspaceID, previousRevisionNumber)
+    `, newRevisionNumber, workspaceID, fromRevision)
 	if err != nil {
-		return types.Revision{}, err
+		return 0, fmt.Errorf("failed to copy files: %w", err)
 	}
 
 	// Update workspace current revision
-	_, err = tx.Exec(ctx, `
+	_, err = q.Exec(ctx, `
         UPDATE workspace
         SET current_revision_number = $1
         WHERE id = $2
     `, newRevisionNumber, workspaceID)
 	if err != nil {
-		return types.Revision{}, err
+		return 0, fmt.Errorf("failed to update current revision: %w", err)
 	}
 
-	// Commit transaction
-	err = tx.Commit(ctx)
-	if err != nil {
-		return types.Revision{}, err
-	}
-
-	if err := persistence.EnqueueWork(ctx, "execute_plan", map[string]interface{}{
-		"planId": planID,
-	}); err != nil {
-		logger.Warn("failed to enqueue execute_plan notification", zap.Error(err))
-		// but do not exit
-	}
-
-	// Get and return the newly created revision
-	revision, err := GetRevision(ctx, workspaceID, newRevisionNumber)
-	if err != nil {
-		return types.Revision{}, err
-	}
-	return *revision, nil
+	return newRevisionNumber, nil
 }
 
 func SetRevisionComplete(ctx context.Context, workspaceID string, revisionNumber int) error {
@@ -0,0 +1,81 @@
+package workspace
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRevisionDB models a workspace's files in memory and counts the round trips made against it
+type fakeRevisionDB struct {
+	files      map[int][]string // revision number -> file ids
+	revisions  int
+	queryCount int
+}
+
+type fakeRow struct {
+	value int
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	*(dest[0].(*int)) = r.value
+	return nil
+}
+
+func (f *fakeRevisionDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	f.queryCount++
+	f.revisions++
+	return fakeRow{value: f.revisions}
+}
+
+func (f *fakeRevisionDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	f.queryCount++
+
+	if strings.Contains(sql, "INSERT INTO workspace_file") {
+		newRevision := args[0].(int)
+		fromRevision := args[2].(int)
+		f.files[newRevision] = append([]string{}, f.files[fromRevision]...)
+	}
+
+	return pgconn.CommandTag{}, nil
+}
+
+func TestCreateRevisionInTxBoundedQueries(t *testing.T) {
+	fileIDs := make([]string, 500)
+	for i := range fileIDs {
+		fileIDs[i] = strings.Repeat("f", i%10+1)
+	}
+
+	db := &fakeRevisionDB{
+		files:     map[int][]string{1: fileIDs},
+		revisions: 1,
+	}
+
+	newRevision, err := createRevisionInTx(context.Background(), db, "workspace", 1, CreateRevisionOpts{UserID: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, newRevision)
+
+	// revision insert, chart copy, file copy, current revision update
+	assert.Equal(t, 4, db.queryCount)
+	assert.Len(t, db.files[2], 500)
+}
+
+func TestCreateRevisionInTxFromOlderRevision(t *testing.T) {
+	db := &fakeRevisionDB{
+		files: map[int][]string{
+			1: {"a", "b"},
+			2: {"a", "b", "c"},
+		},
+		revisions: 2,
+	}
+
+	newRevision, err := createRevisionInTx(context.Background(), db, "workspace", 1, CreateRevisionOpts{UserID: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, newRevision)
+	assert.Equal(t, []string{"a", "b"}, db.files[3])
+}
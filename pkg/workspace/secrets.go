@@ -0,0 +1,296 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/secretscan"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// ErrSecretsNotAcknowledged is returned when content sent to an LLM has secrets that were found in
+// the workspace's files and haven't been acknowledged
+var ErrSecretsNotAcknowledged = errors.New("content has secrets that haven't been acknowledged")
+
+// querySecretFingerprints is a var so that the LLM check can be tested without a database
+var querySecretFingerprints = querySecretFingerprintsFromDB
+
+// RecordSecretFindings scans content of a workspace that isn't written to a file yet, such as a
+// file uploaded to convert, and stores the secrets found in it. It returns the findings that
+// aren't allowlisted.
+func RecordSecretFindings(ctx context.Context, workspaceID string, filePath string, content string) ([]types.SecretFinding, error) {
+	overrides, err := getSecretOverrides(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	recorded, err := recordSecretFindings(ctx, conn, workspaceID, filePath, content)
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []types.SecretFinding{}
+	for _, f := range recorded {
+		if overrides.allowlist[f.Fingerprint] {
+			continue
+		}
+		findings = append(findings, types.SecretFinding{
+			FilePath:     f.FilePath,
+			Detector:     f.Detector,
+			Line:         f.Line,
+			Fingerprint:  f.Fingerprint,
+			Redacted:     f.Redacted,
+			Acknowledged: overrides.acknowledged(f.FilePath),
+		})
+	}
+	return findings, nil
+}
+
+// recordSecretFindings scans content written to a file of a workspace and stores the secrets found
+// in it. Findings are kept by the content they were found in, so they follow it into later
+// revisions, forks and rollbacks without being scanned again.
+func recordSecretFindings(ctx context.Context, q revisionQuerier, workspaceID string, filePath string, content string) ([]secretscan.Finding, error) {
+	findings := secretscan.Scan(filePath, content)
+	// the same content always has the same findings, so content without any has nothing to replace
+	if len(findings) == 0 {
+		return findings, nil
+	}
+
+	sha := contentSHA(content)
+	query := `DELETE FROM workspace_secret_finding WHERE workspace_id = $1 AND file_path = $2 AND content_sha = $3`
+	if _, err := q.Exec(ctx, query, workspaceID, filePath, sha); err != nil {
+		return nil, fmt.Errorf("failed to delete secret findings: %w", err)
+	}
+
+	now := time.Now()
+	query = `INSERT INTO workspace_secret_finding (workspace_id, file_path, content_sha, idx, detector, line, fingerprint, redacted, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	for i, f := range findings {
+		if _, err := q.Exec(ctx, query, workspaceID, filePath, sha, i, f.Detector, f.Line, f.Fingerprint, f.Redacted, now); err != nil {
+			return nil, fmt.Errorf("failed to insert secret finding: %w", err)
+		}
+	}
+
+	return findings, nil
+}
+
+// ListSecretFindings returns the secrets in the files of a workspace at a revision, as the files
+// will be once their pending content is accepted. Allowlisted findings are left out.
+func ListSecretFindings(ctx context.Context, workspaceID string, revisionNumber int) ([]types.SecretFinding, error) {
+	overrides, err := getSecretOverrides(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT s.file_path, s.detector, s.line, s.fingerprint, s.redacted
+		FROM workspace_file f
+		JOIN workspace_secret_finding s ON s.workspace_id = f.workspace_id AND s.file_path = f.file_path
+			AND s.content_sha = CASE WHEN f.content_pending IS NULL THEN f.content_sha
+				ELSE encode(sha256(convert_to(f.content_pending, 'UTF8')), 'hex') END
+		WHERE f.workspace_id = $1 AND f.revision_number = $2
+		ORDER BY s.file_path, s.idx`
+	rows, err := conn.Query(ctx, query, workspaceID, revisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secret findings: %w", err)
+	}
+	defer rows.Close()
+
+	findings := []types.SecretFinding{}
+	for rows.Next() {
+		var f types.SecretFinding
+		if err := rows.Scan(&f.FilePath, &f.Detector, &f.Line, &f.Fingerprint, &f.Redacted); err != nil {
+			return nil, fmt.Errorf("failed to scan secret finding: %w", err)
+		}
+		if overrides.allowlist[f.Fingerprint] {
+			continue
+		}
+		f.Acknowledged = overrides.acknowledged(f.FilePath)
+		findings = append(findings, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secret findings: %w", err)
+	}
+
+	return findings, nil
+}
+
+// CheckSecretsForLLM returns ErrSecretsNotAcknowledged when texts about to be sent to an LLM have a
+// secret that was found in a file of the workspace, and neither the workspace nor that file has
+// been acknowledged. Secrets that were never in a file, such as one typed into a prompt, aren't
+// flagged.
+func CheckSecretsForLLM(ctx context.Context, workspaceID string, texts []string) error {
+	if workspaceID == "" {
+		return nil
+	}
+
+	found := map[string]bool{}
+	for _, text := range texts {
+		for _, f := range secretscan.Scan("", text) {
+			found[f.Fingerprint] = true
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	overrides, err := getSecretOverrides(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if overrides.all {
+		return nil
+	}
+
+	flagged, err := querySecretFingerprints(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	blockedPaths := map[string]bool{}
+	for _, f := range flagged {
+		if found[f.Fingerprint] && !overrides.allowlist[f.Fingerprint] && !overrides.acknowledged(f.FilePath) {
+			blockedPaths[f.FilePath] = true
+		}
+	}
+	if len(blockedPaths) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(blockedPaths))
+	for path := range blockedPaths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Errorf("%w: found in %s", ErrSecretsNotAcknowledged, strings.Join(paths, ", "))
+}
+
+// UnacknowledgedDebugSecrets returns the secrets in the debug output of a render that it can't be
+// shown with. It's stricter than CheckSecretsForLLM because the computed values include values
+// profiles, which aren't scanned: a secret is only let through when the workspace is acknowledged,
+// the secret is allowlisted, or it's in a file that's acknowledged. FilePath is the file it was
+// found in, empty when it wasn't found in one.
+func UnacknowledgedDebugSecrets(ctx context.Context, workspaceID string, debug types.RenderDebug) ([]types.SecretFinding, error) {
+	texts := append([]string{debug.UserSuppliedValues, debug.ComputedValues}, debug.Log...)
+	found := map[string]secretscan.Finding{}
+	fingerprints := []string{}
+	for _, text := range texts {
+		for _, f := range secretscan.Scan("", text) {
+			if _, ok := found[f.Fingerprint]; !ok {
+				fingerprints = append(fingerprints, f.Fingerprint)
+			}
+			found[f.Fingerprint] = f
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	overrides, err := getSecretOverrides(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if overrides.all {
+		return nil, nil
+	}
+
+	flagged, err := querySecretFingerprints(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	acknowledged := map[string]bool{}
+	filePaths := map[string]string{}
+	for _, f := range flagged {
+		if overrides.acknowledged(f.FilePath) {
+			acknowledged[f.Fingerprint] = true
+		} else if filePaths[f.Fingerprint] == "" || f.FilePath < filePaths[f.Fingerprint] {
+			filePaths[f.Fingerprint] = f.FilePath
+		}
+	}
+
+	findings := []types.SecretFinding{}
+	for _, fingerprint := range fingerprints {
+		if overrides.allowlist[fingerprint] || acknowledged[fingerprint] {
+			continue
+		}
+		f := found[fingerprint]
+		findings = append(findings, types.SecretFinding{
+			FilePath:    filePaths[fingerprint],
+			Detector:    f.Detector,
+			Fingerprint: fingerprint,
+			Redacted:    f.Redacted,
+		})
+	}
+	return findings, nil
+}
+
+// secretOverrides are the settings that let secrets through to LLMs
+type secretOverrides struct {
+	all       bool
+	files     map[string]bool
+	allowlist map[string]bool
+}
+
+func (o secretOverrides) acknowledged(filePath string) bool {
+	return o.all || o.files[filePath]
+}
+
+func getSecretOverrides(ctx context.Context, workspaceID string) (secretOverrides, error) {
+	all, err := GetSetting[bool](ctx, workspaceID, SettingSendSecretsToLLM)
+	if err != nil {
+		return secretOverrides{}, err
+	}
+	files, err := GetSetting[[]string](ctx, workspaceID, SettingSecretAcknowledgedFiles)
+	if err != nil {
+		return secretOverrides{}, err
+	}
+	allowlist, err := GetSetting[[]string](ctx, workspaceID, SettingSecretAllowlist)
+	if err != nil {
+		return secretOverrides{}, err
+	}
+
+	overrides := secretOverrides{all: all, files: map[string]bool{}, allowlist: map[string]bool{}}
+	for _, path := range files {
+		overrides.files[path] = true
+	}
+	for _, fingerprint := range allowlist {
+		overrides.allowlist[fingerprint] = true
+	}
+	return overrides, nil
+}
+
+// querySecretFingerprintsFromDB returns the fingerprint and file of every secret found in a
+// workspace
+func querySecretFingerprintsFromDB(ctx context.Context, workspaceID string) ([]types.SecretFinding, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `SELECT DISTINCT file_path, fingerprint FROM workspace_secret_finding WHERE workspace_id = $1`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secret fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	findings := []types.SecretFinding{}
+	for rows.Next() {
+		var f types.SecretFinding
+		if err := rows.Scan(&f.FilePath, &f.Fingerprint); err != nil {
+			return nil, fmt.Errorf("failed to scan secret fingerprint: %w", err)
+		}
+		findings = append(findings, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secret fingerprints: %w", err)
+	}
+
+	return findings, nil
+}
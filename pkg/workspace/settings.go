@@ -0,0 +1,394 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/lintrules"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/secretscan"
+)
+
+// the keys of the settings a workspace can have
+const (
+	// SettingAutoGenerateReadme refreshes the README.md of a chart when a plan changes its values.yaml
+	SettingAutoGenerateReadme = "auto_generate_readme"
+	// SettingPreserveLineEndings keeps CRLF line endings in files written to the workspace
+	SettingPreserveLineEndings = "preserve_line_endings"
+	// SettingDisabledLintRules are lint rule IDs that don't run for the workspace, on top of
+	// DISABLED_LINT_RULES
+	SettingDisabledLintRules = "disabled_lint_rules"
+	// SettingSendSecretsToLLM acknowledges every secret found in the workspace's files, so content
+	// with them can be sent to LLMs
+	SettingSendSecretsToLLM = "send_secrets_to_llm"
+	// SettingSecretAcknowledgedFiles are paths of files whose secrets can be sent to LLMs
+	SettingSecretAcknowledgedFiles = "secret_acknowledged_files"
+	// SettingSecretAllowlist are fingerprints of findings that aren't secrets
+	SettingSecretAllowlist = "secret_allowlist"
+	// SettingDuplicateExclusions are the paths of files that aren't checked for duplicates,
+	// directories end with a slash and anything else is a path.Match pattern
+	SettingDuplicateExclusions = "duplicate_exclusions"
+	// SettingAppVersionSync maps a values path of each chart to its appVersion, see
+	// AppVersionSyncMapping
+	SettingAppVersionSync = "app_version_sync"
+)
+
+var (
+	// ErrUnknownSetting is returned for a setting key that isn't one of the Setting* keys
+	ErrUnknownSetting = errors.New("unknown setting")
+	// ErrInvalidSetting is returned for a setting value that can't be coerced to the setting's type
+	ErrInvalidSetting = errors.New("invalid setting")
+)
+
+// settingDefinition is how the value of a setting is stored, coerce turns a value a client sent,
+// or one that was stored, into the canonical JSON of the setting's type
+type settingDefinition struct {
+	defaultValue json.RawMessage
+	coerce       func(json.RawMessage) (json.RawMessage, error)
+}
+
+var knownSettings = map[string]settingDefinition{
+	SettingAutoGenerateReadme:      {defaultValue: json.RawMessage(`false`), coerce: coerceBool},
+	SettingPreserveLineEndings:     {defaultValue: json.RawMessage(`false`), coerce: coerceBool},
+	SettingDisabledLintRules:       {defaultValue: json.RawMessage(`[]`), coerce: coerceLintRules},
+	SettingSendSecretsToLLM:        {defaultValue: json.RawMessage(`false`), coerce: coerceBool},
+	SettingSecretAcknowledgedFiles: {defaultValue: json.RawMessage(`[]`), coerce: coerceFilePaths},
+	SettingSecretAllowlist:         {defaultValue: json.RawMessage(`[]`), coerce: coerceFingerprints},
+	SettingDuplicateExclusions:     {defaultValue: json.RawMessage(`["tests/","templates/tests/","crds/"]`), coerce: coercePathPatterns},
+	SettingAppVersionSync:          {defaultValue: json.RawMessage(`[]`), coerce: coerceAppVersionSync},
+}
+
+// settingsCacheTTL bounds how long a setting written by another process can go unnoticed, writes
+// in this process invalidate the cache immediately
+const settingsCacheTTL = 30 * time.Second
+
+// maxCachedWorkspaceSettings bounds the workspaces whose settings are kept in memory
+const maxCachedWorkspaceSettings = 1000
+
+type cachedSettings struct {
+	values   map[string]json.RawMessage
+	loadedAt time.Time
+}
+
+var (
+	settingsCacheMu sync.Mutex
+	settingsCache   = map[string]cachedSettings{}
+)
+
+// these are vars so that settings can be tested without a database
+var (
+	querySettings  = querySettingsFromDB
+	upsertSettings = upsertSettingsInDB
+)
+
+// SettingKeys returns the keys of every setting, sorted
+func SettingKeys() []string {
+	keys := make([]string, 0, len(knownSettings))
+	for key := range knownSettings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetSetting returns the value of a setting of a workspace, or its default when it isn't set
+func GetSetting[T any](ctx context.Context, workspaceID string, key string) (T, error) {
+	var value T
+	raw, err := getSettingValue(ctx, workspaceID, key)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, fmt.Errorf("setting %s can't be read as %T: %w", key, value, err)
+	}
+	return value, nil
+}
+
+// GetSettings returns every setting of a workspace, with defaults for the ones that aren't set
+func GetSettings(ctx context.Context, workspaceID string) (map[string]any, error) {
+	settings := map[string]any{}
+	for _, key := range SettingKeys() {
+		raw, err := getSettingValue(ctx, workspaceID, key)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode setting %s: %w", key, err)
+		}
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// SetSetting sets one setting of a workspace
+func SetSetting(ctx context.Context, workspaceID string, key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode setting %s: %w", key, err)
+	}
+	return SetSettings(ctx, workspaceID, map[string]json.RawMessage{key: raw})
+}
+
+// SetSettings validates and sets settings of a workspace. Nothing is written unless every key is
+// known and every value can be coerced to its setting's type.
+func SetSettings(ctx context.Context, workspaceID string, values map[string]json.RawMessage) error {
+	coerced := map[string]json.RawMessage{}
+	for key, value := range values {
+		raw, err := coerceSetting(key, value)
+		if err != nil {
+			return err
+		}
+		coerced[key] = raw
+	}
+
+	if err := upsertSettings(ctx, workspaceID, coerced); err != nil {
+		return err
+	}
+	InvalidateSettings(workspaceID)
+	return nil
+}
+
+// InvalidateSettings drops the cached settings of a workspace
+func InvalidateSettings(workspaceID string) {
+	settingsCacheMu.Lock()
+	defer settingsCacheMu.Unlock()
+	delete(settingsCache, workspaceID)
+}
+
+func getSettingValue(ctx context.Context, workspaceID string, key string) (json.RawMessage, error) {
+	definition, ok := knownSettings[key]
+	if !ok {
+		return nil, unknownSettingError(key)
+	}
+
+	values, err := loadSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := values[key]
+	if !ok {
+		return definition.defaultValue, nil
+	}
+
+	// values written to the table by hand may not be canonical
+	coerced, err := definition.coerce(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: stored value of %s: %v", ErrInvalidSetting, key, err)
+	}
+	return coerced, nil
+}
+
+func loadSettings(ctx context.Context, workspaceID string) (map[string]json.RawMessage, error) {
+	settingsCacheMu.Lock()
+	cached, ok := settingsCache[workspaceID]
+	settingsCacheMu.Unlock()
+	if ok && time.Since(cached.loadedAt) < settingsCacheTTL {
+		return cached.values, nil
+	}
+
+	values, err := querySettings(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace settings: %w", err)
+	}
+
+	settingsCacheMu.Lock()
+	defer settingsCacheMu.Unlock()
+	if _, ok := settingsCache[workspaceID]; !ok && len(settingsCache) >= maxCachedWorkspaceSettings {
+		for id := range settingsCache {
+			delete(settingsCache, id)
+			break
+		}
+	}
+	settingsCache[workspaceID] = cachedSettings{values: values, loadedAt: time.Now()}
+	return values, nil
+}
+
+func coerceSetting(key string, value json.RawMessage) (json.RawMessage, error) {
+	definition, ok := knownSettings[key]
+	if !ok {
+		return nil, unknownSettingError(key)
+	}
+	raw, err := definition.coerce(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidSetting, key, err)
+	}
+	return raw, nil
+}
+
+func unknownSettingError(key string) error {
+	return fmt.Errorf("%w %q, valid settings are %s", ErrUnknownSetting, key, strings.Join(SettingKeys(), ", "))
+}
+
+// coerceBool accepts a boolean, "true", "false", "on", "off", "1" and "0", or the numbers 1 and 0
+func coerceBool(value json.RawMessage) (json.RawMessage, error) {
+	var decoded any
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return nil, err
+	}
+
+	var b bool
+	switch v := decoded.(type) {
+	case bool:
+		b = v
+	case float64:
+		if v != 0 && v != 1 {
+			return nil, fmt.Errorf("%v is not a boolean", v)
+		}
+		b = v == 1
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "on":
+			b = true
+		case "off":
+			b = false
+		default:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a boolean", v)
+			}
+			b = parsed
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a boolean", string(value))
+	}
+	return json.Marshal(b)
+}
+
+// coerceStringList accepts a list of strings or a comma separated string
+func coerceStringList(value json.RawMessage) ([]string, error) {
+	var decoded any
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return nil, err
+	}
+
+	items := []string{}
+	switch v := decoded.(type) {
+	case nil:
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", item)
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a list of strings", string(value))
+	}
+	return items, nil
+}
+
+func coerceLintRules(value json.RawMessage) (json.RawMessage, error) {
+	ids, err := coerceStringList(value)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, rule := range lintrules.Rules() {
+		known[rule.ID()] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			return nil, fmt.Errorf("%q is not a lint rule", id)
+		}
+	}
+	return json.Marshal(ids)
+}
+
+func coerceFilePaths(value json.RawMessage) (json.RawMessage, error) {
+	paths, err := coerceStringList(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(paths)
+}
+
+func coercePathPatterns(value json.RawMessage) (json.RawMessage, error) {
+	patterns, err := coerceStringList(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q is not a path pattern", pattern)
+		}
+	}
+	return json.Marshal(patterns)
+}
+
+func coerceFingerprints(value json.RawMessage) (json.RawMessage, error) {
+	fingerprints, err := coerceStringList(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, fingerprint := range fingerprints {
+		if !secretscan.IsFingerprint(fingerprint) {
+			return nil, fmt.Errorf("%q is not a secret fingerprint", fingerprint)
+		}
+	}
+	return json.Marshal(fingerprints)
+}
+
+func querySettingsFromDB(ctx context.Context, workspaceID string) (map[string]json.RawMessage, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `SELECT key, value FROM workspace_settings WHERE workspace_id = $1`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[string]json.RawMessage{}
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+func upsertSettingsInDB(ctx context.Context, workspaceID string, values map[string]json.RawMessage) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `INSERT INTO workspace_settings (workspace_id, key, value, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (workspace_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`
+	for key, value := range values {
+		if _, err := tx.Exec(ctx, query, workspaceID, key, string(value)); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit settings: %w", err)
+	}
+	return nil
+}
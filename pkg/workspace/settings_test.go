@@ -0,0 +1,126 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoerceSetting(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		value   string
+		want    string
+		wantErr error
+	}{
+		{name: "bool", key: SettingAutoGenerateReadme, value: `true`, want: `true`},
+		{name: "bool string", key: SettingAutoGenerateReadme, value: `"false"`, want: `false`},
+		{name: "bool on", key: SettingPreserveLineEndings, value: `"On"`, want: `true`},
+		{name: "bool number", key: SettingPreserveLineEndings, value: `0`, want: `false`},
+		{name: "bool other number", key: SettingPreserveLineEndings, value: `2`, wantErr: ErrInvalidSetting},
+		{name: "bool other string", key: SettingAutoGenerateReadme, value: `"maybe"`, wantErr: ErrInvalidSetting},
+		{name: "bool list", key: SettingAutoGenerateReadme, value: `[true]`, wantErr: ErrInvalidSetting},
+		{name: "list", key: SettingDisabledLintRules, value: `["resource-limits"]`, want: `["resource-limits"]`},
+		{name: "comma separated list", key: SettingDisabledLintRules, value: `"resource-limits, hardcoded-image,"`, want: `["resource-limits","hardcoded-image"]`},
+		{name: "empty list", key: SettingDisabledLintRules, value: `null`, want: `[]`},
+		{name: "unknown lint rule", key: SettingDisabledLintRules, value: `["no-such-rule"]`, wantErr: ErrInvalidSetting},
+		{name: "list of numbers", key: SettingDisabledLintRules, value: `[1]`, wantErr: ErrInvalidSetting},
+		{name: "file paths", key: SettingSecretAcknowledgedFiles, value: `"values.yaml, templates/secret.yaml"`, want: `["values.yaml","templates/secret.yaml"]`},
+		{name: "fingerprints", key: SettingSecretAllowlist, value: `["0123456789abcdef"]`, want: `["0123456789abcdef"]`},
+		{name: "not a fingerprint", key: SettingSecretAllowlist, value: `["AKIAUJZDE8GXD6NCF10E"]`, wantErr: ErrInvalidSetting},
+		{name: "path patterns", key: SettingDuplicateExclusions, value: `"crds/, templates/*-test.yaml"`, want: `["crds/","templates/*-test.yaml"]`},
+		{name: "not a path pattern", key: SettingDuplicateExclusions, value: `["templates/[.yaml"]`, wantErr: ErrInvalidSetting},
+		{name: "app version sync", key: SettingAppVersionSync, value: `[{"chart": " frontend ", "valuesPath": "image.tag"}, {"valuesPath": "image.tag"}]`, want: `[{"chart":"frontend","valuesPath":"image.tag"},{"valuesPath":"image.tag"}]`},
+		{name: "app version sync without mappings", key: SettingAppVersionSync, value: `null`, want: `[]`},
+		{name: "app version sync without a path", key: SettingAppVersionSync, value: `[{"chart": "frontend"}]`, wantErr: ErrInvalidSetting},
+		{name: "app version sync with an empty key", key: SettingAppVersionSync, value: `[{"valuesPath": "image..tag"}]`, wantErr: ErrInvalidSetting},
+		{name: "app version sync naming a chart twice", key: SettingAppVersionSync, value: `[{"chart": "frontend", "valuesPath": "image.tag"}, {"chart": "frontend", "valuesPath": "tag"}]`, wantErr: ErrInvalidSetting},
+		{name: "app version sync with unknown fields", key: SettingAppVersionSync, value: `[{"valuesPath": "image.tag", "target": "version"}]`, wantErr: ErrInvalidSetting},
+		{name: "unknown key", key: "theme", value: `"dark"`, wantErr: ErrUnknownSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coerceSetting(tt.key, json.RawMessage(tt.value))
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, tt.wantErr), err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+
+	_, err := coerceSetting("theme", json.RawMessage(`"dark"`))
+	assert.EqualError(t, err, `unknown setting "theme", valid settings are app_version_sync, auto_generate_readme, disabled_lint_rules, duplicate_exclusions, preserve_line_endings, secret_acknowledged_files, secret_allowlist, send_secrets_to_llm`)
+}
+
+func TestSettingsCache(t *testing.T) {
+	originalQuery, originalUpsert := querySettings, upsertSettings
+	t.Cleanup(func() {
+		querySettings, upsertSettings = originalQuery, originalUpsert
+		InvalidateSettings("ws-settings")
+	})
+
+	stored := map[string]json.RawMessage{SettingDisabledLintRules: json.RawMessage(`"resource-limits"`)}
+	queries := 0
+	querySettings = func(ctx context.Context, workspaceID string) (map[string]json.RawMessage, error) {
+		queries++
+		values := map[string]json.RawMessage{}
+		for key, value := range stored {
+			values[key] = value
+		}
+		return values, nil
+	}
+	upsertSettings = func(ctx context.Context, workspaceID string, values map[string]json.RawMessage) error {
+		for key, value := range values {
+			stored[key] = value
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	preserve, err := GetSetting[bool](ctx, "ws-settings", SettingPreserveLineEndings)
+	require.NoError(t, err)
+	assert.False(t, preserve, "unset settings have their default")
+
+	// a value stored in its non-canonical form is coerced when it's read
+	rules, err := GetSetting[[]string](ctx, "ws-settings", SettingDisabledLintRules)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"resource-limits"}, rules)
+	assert.Equal(t, 1, queries)
+
+	_, err = GetSetting[string](ctx, "ws-settings", SettingPreserveLineEndings)
+	assert.Error(t, err, "a setting can't be read as another type")
+
+	require.NoError(t, SetSetting(ctx, "ws-settings", SettingPreserveLineEndings, "true"))
+	preserve, err = GetSetting[bool](ctx, "ws-settings", SettingPreserveLineEndings)
+	require.NoError(t, err)
+	assert.True(t, preserve)
+	assert.Equal(t, 2, queries, "a write invalidates the cache")
+
+	// nothing is written when any of the settings is invalid
+	err = SetSettings(ctx, "ws-settings", map[string]json.RawMessage{
+		SettingAutoGenerateReadme: json.RawMessage(`true`),
+		"theme":                   json.RawMessage(`"dark"`),
+	})
+	assert.True(t, errors.Is(err, ErrUnknownSetting))
+	settings, err := GetSettings(ctx, "ws-settings")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		SettingAutoGenerateReadme:      false,
+		SettingPreserveLineEndings:     true,
+		SettingDisabledLintRules:       []any{"resource-limits"},
+		SettingAppVersionSync:          []any{},
+		SettingSendSecretsToLLM:        false,
+		SettingSecretAcknowledgedFiles: []any{},
+		SettingSecretAllowlist:         []any{},
+		SettingDuplicateExclusions:     []any{"tests/", "templates/tests/", "crds/"},
+	}, settings)
+	assert.Equal(t, 2, queries)
+}
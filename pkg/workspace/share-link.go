@@ -0,0 +1,222 @@
+package workspace
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+)
+
+const (
+	// DefaultShareLinkTTL is how long a share link works when its creator doesn't say
+	DefaultShareLinkTTL = 7 * 24 * time.Hour
+	// MaxShareLinkTTL is the longest a share link can work
+	MaxShareLinkTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrShareLinkNotFound is returned for a share link that doesn't exist, has expired or was
+	// revoked, or whose workspace was archived. They aren't told apart, so that a token can't be
+	// probed for whether it was ever valid.
+	ErrShareLinkNotFound = errors.New("share link not found")
+	// ErrRevisionNotFound is returned for a revision the workspace doesn't have, such as one being
+	// shared or rolled back to
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+// CreateShareLink creates a link to a revision of a workspace that works for ttl, the current
+// revision when revisionNumber is 0. It returns the link and its token, which isn't stored and
+// can't be read again.
+func CreateShareLink(ctx context.Context, workspaceID string, revisionNumber int, createdByUserID string, ttl time.Duration) (*types.ShareLink, string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	if err := ensureNotArchived(ctx, conn, workspaceID); err != nil {
+		return nil, "", err
+	}
+
+	if revisionNumber == 0 {
+		if err := conn.QueryRow(ctx, `SELECT current_revision_number FROM workspace WHERE id = $1`, workspaceID).Scan(&revisionNumber); err != nil {
+			return nil, "", fmt.Errorf("failed to get current revision: %w", err)
+		}
+	} else {
+		var exists bool
+		if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM workspace_revision WHERE workspace_id = $1 AND revision_number = $2)`, workspaceID, revisionNumber).Scan(&exists); err != nil {
+			return nil, "", fmt.Errorf("failed to check revision: %w", err)
+		}
+		if !exists {
+			return nil, "", fmt.Errorf("%w: %d", ErrRevisionNotFound, revisionNumber)
+		}
+	}
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate share link id: %w", err)
+	}
+	token, err := securerandom.Hex(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate share link token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	link := &types.ShareLink{
+		ID:              id,
+		WorkspaceID:     workspaceID,
+		RevisionNumber:  revisionNumber,
+		CreatedByUserID: createdByUserID,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(ttl),
+	}
+
+	query := `INSERT INTO share_link (id, token_sha, workspace_id, revision_number, created_by_user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)`
+	if _, err := conn.Exec(ctx, query, link.ID, shareTokenSHA(token), link.WorkspaceID, link.RevisionNumber, link.CreatedByUserID, link.CreatedAt, link.ExpiresAt); err != nil {
+		return nil, "", fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return link, token, nil
+}
+
+// ListShareLinks returns the share links of a workspace that haven't expired or been revoked,
+// newest first
+func ListShareLinks(ctx context.Context, workspaceID string) ([]types.ShareLink, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT id, workspace_id, revision_number, COALESCE(created_by_user_id, ''), created_at, expires_at
+		FROM share_link
+		WHERE workspace_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC`
+	rows, err := conn.Query(ctx, query, workspaceID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []types.ShareLink{}
+	for rows.Next() {
+		var link types.ShareLink
+		if err := rows.Scan(&link.ID, &link.WorkspaceID, &link.RevisionNumber, &link.CreatedByUserID, &link.CreatedAt, &link.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// RevokeShareLink stops a share link of a workspace from working. Revoking a revoked link keeps
+// the time it was first revoked.
+func RevokeShareLink(ctx context.Context, workspaceID string, shareLinkID string) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tag, err := conn.Exec(ctx, `UPDATE share_link SET revoked_at = COALESCE(revoked_at, $3) WHERE id = $1 AND workspace_id = $2`, shareLinkID, workspaceID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrShareLinkNotFound, shareLinkID)
+	}
+	return nil
+}
+
+// GetSharedSnapshot returns what the share link with token shows. Only the shared revision's
+// files, as they were committed, its charts and its latest render are read.
+func GetSharedSnapshot(ctx context.Context, token string) (*types.SharedSnapshot, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var link types.ShareLink
+	var workspaceName string
+	var archivedAt sql.NullTime
+	query := `SELECT l.id, l.workspace_id, l.revision_number, l.created_at, l.expires_at, l.revoked_at, w.name, w.archived_at
+		FROM share_link l
+		JOIN workspace w ON w.id = l.workspace_id
+		WHERE l.token_sha = $1`
+	err := conn.QueryRow(ctx, query, shareTokenSHA(token)).Scan(&link.ID, &link.WorkspaceID, &link.RevisionNumber, &link.CreatedAt, &link.ExpiresAt, &link.RevokedAt, &workspaceName, &archivedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+	if !shareLinkUsable(link, archivedAt.Valid, time.Now()) {
+		return nil, ErrShareLinkNotFound
+	}
+
+	snapshot := &types.SharedSnapshot{
+		WorkspaceName:  workspaceName,
+		RevisionNumber: link.RevisionNumber,
+		ExpiresAt:      link.ExpiresAt,
+		Charts:         []types.SharedChart{},
+		Files:          []types.SharedFile{},
+	}
+
+	rows, err := conn.Query(ctx, `SELECT id, name FROM workspace_chart WHERE workspace_id = $1 AND revision_number = $2 ORDER BY name, id`, link.WorkspaceID, link.RevisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared charts: %w", err)
+	}
+	defer rows.Close()
+	chartIndex := map[string]int{}
+	for rows.Next() {
+		var chartID, name string
+		if err := rows.Scan(&chartID, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan shared chart: %w", err)
+		}
+		chartIndex[chartID] = len(snapshot.Charts)
+		snapshot.Charts = append(snapshot.Charts, types.SharedChart{Name: name, Files: []types.SharedFile{}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list shared charts: %w", err)
+	}
+	rows.Close()
+
+	// pending content hasn't been accepted into the revision, so it isn't shared
+	rows, err = conn.Query(ctx, `SELECT chart_id, file_path, content FROM workspace_file WHERE workspace_id = $1 AND revision_number = $2 ORDER BY file_path`, link.WorkspaceID, link.RevisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared files: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var chartID sql.NullString
+		var file types.SharedFile
+		if err := rows.Scan(&chartID, &file.Path, &file.Content); err != nil {
+			return nil, fmt.Errorf("failed to scan shared file: %w", err)
+		}
+		if i, ok := chartIndex[chartID.String]; ok {
+			snapshot.Charts[i].Files = append(snapshot.Charts[i].Files, file)
+			continue
+		}
+		snapshot.Files = append(snapshot.Files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list shared files: %w", err)
+	}
+	rows.Close()
+
+	render, _, err := getLatestPlanRender(ctx, conn, link.WorkspaceID, link.RevisionNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shared render: %w", err)
+	}
+	snapshot.Render = render
+
+	return snapshot, nil
+}
+
+// shareLinkUsable is true while a link hasn't expired or been revoked and its workspace isn't
+// archived
+func shareLinkUsable(link types.ShareLink, workspaceArchived bool, now time.Time) bool {
+	return link.RevokedAt == nil && now.Before(link.ExpiresAt) && !workspaceArchived
+}
+
+// shareTokenSHA is the hash of a share link token that's stored in share_link.token_sha
+func shareTokenSHA(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
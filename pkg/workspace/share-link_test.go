@@ -0,0 +1,143 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareLinkUsable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	revokedAt := now.Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		link     types.ShareLink
+		archived bool
+		want     bool
+	}{
+		{name: "active", link: types.ShareLink{ExpiresAt: now.Add(time.Hour)}, want: true},
+		{name: "expired", link: types.ShareLink{ExpiresAt: now.Add(-time.Second)}},
+		{name: "expires now", link: types.ShareLink{ExpiresAt: now}},
+		{name: "revoked", link: types.ShareLink{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}},
+		{name: "archived workspace", link: types.ShareLink{ExpiresAt: now.Add(time.Hour)}, archived: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, shareLinkUsable(tt.link, tt.archived, now))
+		})
+	}
+}
+
+// TestShareLinks shares an earlier revision of a workspace and checks that the snapshot has only
+// that revision's files, and that the link stops working when it expires or is revoked. It runs
+// against the database in CHARTSMITH_TEST_PG_URI.
+func TestShareLinks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping share link integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "share-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		for _, statement := range purgeStatements {
+			conn.Exec(context.Background(), statement.query, workspaceID)
+		}
+	})
+
+	seed := []string{
+		`INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number) VALUES ($1, now(), 'shared', 'user', 'test', 2)`,
+		`INSERT INTO workspace_revision (workspace_id, revision_number, created_at, created_by_user_id, created_type, is_complete) VALUES ($1, 1, now(), 'user', 'test', true), ($1, 2, now(), 'user', 'test', true)`,
+		`INSERT INTO workspace_chart (id, workspace_id, name, revision_number) VALUES ($1 || '-chart', $1, 'app', 1), ($1 || '-chart', $1, 'app', 2)`,
+		`INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_pending) VALUES
+			($1 || '-values', 1, $1 || '-chart', $1, 'values.yaml', 'replicaCount: 1', 'replicaCount: 5'),
+			($1 || '-values', 2, $1 || '-chart', $1, 'values.yaml', 'replicaCount: 2', NULL),
+			($1 || '-ingress', 2, $1 || '-chart', $1, 'templates/ingress.yaml', 'kind: Ingress', NULL)`,
+		`INSERT INTO workspace_chat (id, workspace_id, revision_number, created_at, sent_by, prompt) VALUES ($1 || '-chat', $1, 1, now(), 'user', 'make it private')`,
+		`INSERT INTO workspace_rendered (id, workspace_id, revision_number, created_at, completed_at) VALUES ($1 || '-render', $1, 1, now(), now())`,
+		`INSERT INTO workspace_rendered_chart (id, workspace_render_id, chart_id, is_success, created_at, completed_at) VALUES ($1 || '-rendered-chart', $1 || '-render', $1 || '-chart', true, now(), now())`,
+	}
+	for _, statement := range seed {
+		_, err := conn.Exec(ctx, statement, workspaceID)
+		require.NoError(t, err, statement)
+	}
+
+	_, _, err := CreateShareLink(ctx, workspaceID, 3, "user", time.Hour)
+	assert.True(t, errors.Is(err, ErrRevisionNotFound), err)
+
+	link, token, err := CreateShareLink(ctx, workspaceID, 1, "user", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, link.RevisionNumber)
+	assert.Len(t, token, 64)
+
+	var storedSHA string
+	require.NoError(t, conn.QueryRow(ctx, `SELECT token_sha FROM share_link WHERE id = $1`, link.ID).Scan(&storedSHA))
+	assert.NotEqual(t, token, storedSHA, "only a hash of the token is stored")
+
+	snapshot, err := GetSharedSnapshot(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", snapshot.WorkspaceName)
+	assert.Equal(t, 1, snapshot.RevisionNumber)
+	require.Len(t, snapshot.Charts, 1)
+	assert.Equal(t, []types.SharedFile{{Path: "values.yaml", Content: "replicaCount: 1"}}, snapshot.Charts[0].Files, "only the shared revision's committed content")
+	require.NotNil(t, snapshot.Render)
+	assert.Equal(t, workspaceID+"-render", snapshot.Render.ID)
+	assert.Equal(t, 1, snapshot.Render.ChartsSucceeded)
+
+	b, err := json.Marshal(snapshot)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "make it private")
+	assert.NotContains(t, string(b), "replicaCount: 2")
+	assert.NotContains(t, string(b), "replicaCount: 5")
+
+	current, _, err := CreateShareLink(ctx, workspaceID, 0, "", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, current.RevisionNumber, "the current revision is shared by default")
+
+	links, err := ListShareLinks(ctx, workspaceID)
+	require.NoError(t, err)
+	assert.Len(t, links, 2)
+
+	_, err = GetSharedSnapshot(ctx, token+"0")
+	assert.True(t, errors.Is(err, ErrShareLinkNotFound))
+
+	// an expired link is the same as one that never existed
+	_, err = conn.Exec(ctx, `UPDATE share_link SET expires_at = $2 WHERE id = $1`, link.ID, time.Now().UTC().Add(-time.Minute))
+	require.NoError(t, err)
+	_, err = GetSharedSnapshot(ctx, token)
+	assert.True(t, errors.Is(err, ErrShareLinkNotFound))
+	_, err = conn.Exec(ctx, `UPDATE share_link SET expires_at = $2 WHERE id = $1`, link.ID, time.Now().UTC().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = GetSharedSnapshot(ctx, token)
+	require.NoError(t, err)
+
+	require.NoError(t, RevokeShareLink(ctx, workspaceID, link.ID))
+	_, err = GetSharedSnapshot(ctx, token)
+	assert.True(t, errors.Is(err, ErrShareLinkNotFound))
+	require.NoError(t, RevokeShareLink(ctx, workspaceID, link.ID), "revoking twice is fine")
+	assert.True(t, errors.Is(RevokeShareLink(ctx, "other-workspace", current.ID), ErrShareLinkNotFound), "links are revoked through their own workspace")
+
+	links, err = ListShareLinks(ctx, workspaceID)
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, current.ID, links[0].ID)
+}
@@ -0,0 +1,160 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// MaxSystemPromptBytes is the largest content a version of a system prompt can have
+const MaxSystemPromptBytes = 64 * 1024
+
+// ErrSystemPromptNotFound is returned for a version of a system prompt that doesn't exist
+var ErrSystemPromptNotFound = errors.New("system prompt version not found")
+
+// ValidateSystemPrompt returns an error if content is empty or larger than MaxSystemPromptBytes
+func ValidateSystemPrompt(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return errors.New("invalid prompt content: content is empty")
+	}
+	if len(content) > MaxSystemPromptBytes {
+		return fmt.Errorf("invalid prompt content: %d bytes, the most is %d", len(content), MaxSystemPromptBytes)
+	}
+	return nil
+}
+
+// SeedSystemPrompts adds each prompt as version 1, active, unless a version of a prompt with its
+// name already exists, and returns the names of the prompts it added. Prompts that were changed
+// since are left alone, so it runs every time the worker starts.
+func SeedSystemPrompts(ctx context.Context, prompts []types.SystemPrompt) ([]string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO system_prompt (name, version, content, is_active, created_at, created_by)
+		SELECT $1, 1, $2, true, now(), 'chartsmith'
+		WHERE NOT EXISTS (SELECT 1 FROM system_prompt WHERE name = $1)
+		ON CONFLICT (name, version) DO NOTHING`
+
+	seeded := []string{}
+	for _, prompt := range prompts {
+		tag, err := conn.Exec(ctx, query, prompt.Name, prompt.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed system prompt %s: %w", prompt.Name, err)
+		}
+		if tag.RowsAffected() > 0 {
+			seeded = append(seeded, prompt.Name)
+		}
+	}
+	return seeded, nil
+}
+
+// ListSystemPrompts returns every version of every system prompt, ordered by name and version
+func ListSystemPrompts(ctx context.Context) ([]types.SystemPrompt, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	return querySystemPrompts(ctx, conn, `SELECT name, version, content, is_active, created_at, COALESCE(created_by, '')
+		FROM system_prompt
+		ORDER BY name, version`)
+}
+
+// ListActiveSystemPrompts returns the active version of each system prompt. Unlike the other
+// queries, it returns an error when the database can't be reached, callers fall back to the
+// prompts built into chartsmith.
+func ListActiveSystemPrompts(ctx context.Context) ([]types.SystemPrompt, error) {
+	conn, err := persistence.GetPooledPostgresSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	return querySystemPrompts(ctx, conn, `SELECT name, version, content, is_active, created_at, COALESCE(created_by, '')
+		FROM system_prompt
+		WHERE is_active
+		ORDER BY name`)
+}
+
+// CreateSystemPromptVersion adds content as the next version of a system prompt. The new version
+// isn't given to the LLM until it's activated.
+func CreateSystemPromptVersion(ctx context.Context, name string, content string, createdBy string) (*types.SystemPrompt, error) {
+	if err := ValidateSystemPrompt(content); err != nil {
+		return nil, err
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO system_prompt (name, version, content, is_active, created_at, created_by)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, false, now(), NULLIF($3, '')
+		FROM system_prompt WHERE name = $1
+		RETURNING name, version, content, is_active, created_at, COALESCE(created_by, '')`
+
+	var prompt types.SystemPrompt
+	if err := conn.QueryRow(ctx, query, name, content, createdBy).Scan(&prompt.Name, &prompt.Version, &prompt.Content, &prompt.IsActive, &prompt.CreatedAt, &prompt.CreatedBy); err != nil {
+		return nil, fmt.Errorf("failed to create system prompt version: %w", err)
+	}
+
+	return &prompt, nil
+}
+
+// ActivateSystemPromptVersion makes a version of a system prompt the one given to the LLM, and
+// deactivates the version that was, or returns ErrSystemPromptNotFound
+func ActivateSystemPromptVersion(ctx context.Context, name string, version int) (*types.SystemPrompt, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var prompt types.SystemPrompt
+	query := `UPDATE system_prompt SET is_active = true WHERE name = $1 AND version = $2
+		RETURNING name, version, content, is_active, created_at, COALESCE(created_by, '')`
+	if err := tx.QueryRow(ctx, query, name, version).Scan(&prompt.Name, &prompt.Version, &prompt.Content, &prompt.IsActive, &prompt.CreatedAt, &prompt.CreatedBy); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s version %d", ErrSystemPromptNotFound, name, version)
+		}
+		return nil, fmt.Errorf("failed to activate system prompt version: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE system_prompt SET is_active = false WHERE name = $1 AND version <> $2 AND is_active`, name, version); err != nil {
+		return nil, fmt.Errorf("failed to deactivate system prompt versions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &prompt, nil
+}
+
+func querySystemPrompts(ctx context.Context, conn *pgxpool.Conn, query string) ([]types.SystemPrompt, error) {
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list system prompts: %w", err)
+	}
+	defer rows.Close()
+
+	prompts := []types.SystemPrompt{}
+	for rows.Next() {
+		var prompt types.SystemPrompt
+		if err := rows.Scan(&prompt.Name, &prompt.Version, &prompt.Content, &prompt.IsActive, &prompt.CreatedAt, &prompt.CreatedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan system prompt: %w", err)
+		}
+		prompts = append(prompts, prompt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating system prompts: %w", err)
+	}
+
+	return prompts, nil
+}
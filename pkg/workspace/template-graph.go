@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+
+	chartanalysis "github.com/replicatedhq/chartsmith/pkg/analysis"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// valuesReferenceSimilarity is the similarity given to the templates that use the values keys being
+// edited, high enough that they're kept with the files most similar to the prompt
+const valuesReferenceSimilarity = 0.9
+
+// GetChartTemplateGraph returns which templates of a chart in the current revision include which
+// helpers and reference which values keys, as the files will be once their pending content is
+// accepted
+func GetChartTemplateGraph(ctx context.Context, workspaceID string, chartID string) (*chartanalysis.TemplateGraph, error) {
+	w, err := GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			return chartanalysis.BuildTemplateGraph(filesWithPendingContent(w.Charts[i].Files)), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in workspace %s", ErrChartNotFound, chartID, workspaceID)
+}
+
+func filesWithPendingContent(files []types.File) []types.File {
+	pending := make([]types.File, 0, len(files))
+	for _, file := range files {
+		if file.ContentPending != nil {
+			file.Content = *file.ContentPending
+		}
+		pending = append(pending, file)
+	}
+	return pending
+}
+
+// listTemplatesUsingValues returns the templates of the chart of valuesYAML that use the values keys
+// that are being edited in it or that the prompt names
+func listTemplatesUsingValues(ctx context.Context, db similarFilesQuerier, valuesYAML types.File, prompt string) ([]types.File, error) {
+	query := `SELECT id, revision_number, chart_id, workspace_id, file_path, content, content_pending FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number = $2 AND chart_id = $3 AND file_path LIKE 'templates/%'`
+	rows, err := db.Query(ctx, query, valuesYAML.WorkspaceID, valuesYAML.RevisionNumber, valuesYAML.ChartID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []types.File{}
+	for rows.Next() {
+		var template types.File
+		var chartID sql.NullString
+		if err := rows.Scan(&template.ID, &template.RevisionNumber, &chartID, &template.WorkspaceID, &template.FilePath, &template.Content, &template.ContentPending); err != nil {
+			return nil, fmt.Errorf("error scanning template: %w", err)
+		}
+		template.ChartID = chartID.String
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating templates: %w", err)
+	}
+
+	return templatesUsingValues(templates, valuesYAML, prompt), nil
+}
+
+// templatesUsingValues returns the templates that use the values keys that are being edited in
+// valuesYAML, or that prompt names, directly or through the helpers they include
+func templatesUsingValues(templates []types.File, valuesYAML types.File, prompt string) []types.File {
+	keys := touchedValuesKeys(valuesYAML, prompt)
+	if len(keys) == 0 {
+		return []types.File{}
+	}
+
+	paths := chartanalysis.BuildTemplateGraph(filesWithPendingContent(templates)).FilesUsingValues(keys)
+	using := map[string]bool{}
+	for _, path := range paths {
+		using[path] = true
+	}
+
+	files := []types.File{}
+	for _, template := range templates {
+		if using[template.FilePath] {
+			files = append(files, template)
+		}
+	}
+	return files
+}
+
+// touchedValuesKeys returns the values keys that the pending content of valuesYAML adds, removes
+// or changes, and the keys that prompt names by their dotted path, such as "image.tag" or
+// "replicaCount". Content that doesn't parse has no keys.
+func touchedValuesKeys(valuesYAML types.File, prompt string) []string {
+	committed := map[string]interface{}{}
+	flattenValuesKeys("", parseValuesForKeys(valuesYAML.Content), committed)
+	current := committed
+	if valuesYAML.ContentPending != nil {
+		current = map[string]interface{}{}
+		flattenValuesKeys("", parseValuesForKeys(*valuesYAML.ContentPending), current)
+	}
+
+	touched := map[string]bool{}
+	for path, value := range current {
+		if m, isMap := value.(map[string]interface{}); isMap && len(m) > 0 {
+			continue
+		}
+		if previous, ok := committed[path]; !ok || !reflect.DeepEqual(previous, value) {
+			touched[path] = true
+		}
+	}
+	for path, value := range committed {
+		if m, isMap := value.(map[string]interface{}); isMap && len(m) > 0 {
+			continue
+		}
+		if _, ok := current[path]; !ok {
+			touched[path] = true
+		}
+	}
+
+	for path := range current {
+		if promptNamesValuesKey(prompt, path) {
+			touched[path] = true
+		}
+	}
+
+	keys := make([]string, 0, len(touched))
+	for key := range touched {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseValuesForKeys(content string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(content), &values); err != nil {
+		return map[string]interface{}{}
+	}
+	return values
+}
+
+// promptNamesValuesKey reports whether prompt names the values key by its whole path, on its own or
+// after .Values, so that "image" matches neither "images" nor "image.tag", and "tag" doesn't match
+// "image.tag"
+func promptNamesValuesKey(prompt string, path string) bool {
+	return regexp.MustCompile(`(^|[^\w.]|\.Values\.)` + regexp.QuoteMeta(path) + `($|[^\w.]|\.($|\W))`).MatchString(prompt)
+}
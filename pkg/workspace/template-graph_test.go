@@ -0,0 +1,76 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTouchedValuesKeys(t *testing.T) {
+	committed := "replicaCount: 1\nimage:\n  repository: nginx\n  tag: latest\npodAnnotations: {}\nservice:\n  port: 80\n"
+	pending := func(content string) *string { return &content }
+
+	tests := []struct {
+		name    string
+		pending *string
+		prompt  string
+		want    []string
+	}{
+		{name: "nothing pending or named", prompt: "add a liveness probe", want: []string{}},
+		{
+			name:    "changed, added and removed keys",
+			pending: pending("replicaCount: 3\nimage:\n  repository: nginx\n  tag: latest\n  pullPolicy: Always\npodAnnotations: {}\n"),
+			want:    []string{"image.pullPolicy", "replicaCount", "service.port"},
+		},
+		{
+			name:    "an empty map that gets keys",
+			pending: pending("replicaCount: 1\nimage:\n  repository: nginx\n  tag: latest\npodAnnotations:\n  team: web\nservice:\n  port: 80\n"),
+			want:    []string{"podAnnotations.team"},
+		},
+		{name: "a key the prompt names", prompt: "bump image.tag to 1.2", want: []string{"image.tag"}},
+		{name: "a key that ends a sentence", prompt: "double the replicaCount.", want: []string{"replicaCount"}},
+		{name: "a key the prompt names after .Values", prompt: "default .Values.image.tag to the app version", want: []string{"image.tag"}},
+		{name: "only whole paths are named", prompt: "pin the images and the tag", want: []string{}},
+		{name: "content that doesn't parse", pending: pending("image: [\n"), want: []string{"image.repository", "image.tag", "podAnnotations", "replicaCount", "service.port"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valuesYAML := types.File{FilePath: "values.yaml", Content: committed, ContentPending: tt.pending}
+			assert.Equal(t, tt.want, touchedValuesKeys(valuesYAML, tt.prompt))
+		})
+	}
+}
+
+func TestTemplatesUsingValues(t *testing.T) {
+	pendingService := "port: {{ .Values.service.targetPort }}\nname: {{ include \"app.fullname\" . }}\n"
+	templates := []types.File{
+		{ID: "helpers", FilePath: "templates/_helpers.tpl", Content: "{{- define \"app.fullname\" -}}\n{{ .Release.Name }}-{{ .Values.nameOverride }}\n{{- end }}\n"},
+		{ID: "deployment", FilePath: "templates/deployment.yaml", Content: "replicas: {{ .Values.replicaCount }}\nname: {{ include \"app.fullname\" . }}\n"},
+		{ID: "service", FilePath: "templates/service.yaml", Content: "port: {{ .Values.service.port }}\n", ContentPending: &pendingService},
+	}
+	committed := "replicaCount: 1\nnameOverride: \"\"\nservice:\n  port: 80\n  targetPort: 8080\n"
+
+	tests := []struct {
+		name    string
+		pending string
+		prompt  string
+		want    []string
+	}{
+		{name: "no keys touched", pending: committed, want: []string{}},
+		{name: "a key one template uses", pending: "replicaCount: 2\nnameOverride: \"\"\nservice:\n  port: 80\n  targetPort: 8080\n", want: []string{"deployment"}},
+		{name: "a key a helper uses", prompt: "set nameOverride to web", pending: committed, want: []string{"helpers", "deployment", "service"}},
+		{name: "the pending content of a template", prompt: "change service.targetPort", pending: committed, want: []string{"service"}},
+		{name: "the committed content of a template isn't used", prompt: "change service.port", pending: committed, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valuesYAML := types.File{FilePath: "values.yaml", Content: committed, ContentPending: &tt.pending}
+			ids := []string{}
+			for _, file := range templatesUsingValues(templates, valuesYAML, tt.prompt) {
+				ids = append(ids, file.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
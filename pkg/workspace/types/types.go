@@ -12,6 +12,33 @@ type File struct {
 	FilePath       string  `json:"filePath"`
 	Content        string  `json:"content"`
 	ContentPending *string `json:"content_pending,omitempty"`
+	// Version is incremented by every write to the content or pending content, writers that
+	// read the file first pass it back to detect concurrent writes
+	Version int `json:"version"`
+	// LineEnding is the line ending style the file was written with before it was normalized,
+	// "crlf" or empty for LF
+	LineEnding string `json:"line_ending,omitempty"`
+}
+
+// PendingPatch is a file with pending content that hasn't been accepted or rejected yet
+type PendingPatch struct {
+	FileID         string `json:"fileId"`
+	RevisionNumber int    `json:"revisionNumber"`
+	ChartID        string `json:"chartId,omitempty"`
+	FilePath       string `json:"filePath"`
+	Version        int    `json:"version"`
+	IsNewFile      bool   `json:"isNewFile"`
+	// Stale is true when the file's content was changed after the patch was written, accepting
+	// the patch would discard that change
+	Stale bool `json:"stale"`
+}
+
+// PatchPreview is what a file would look like if its pending patch was accepted
+type PatchPreview struct {
+	PendingPatch
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Diff   string `json:"diff"`
 }
 
 type Chart struct {
@@ -35,6 +62,25 @@ type Workspace struct {
 	LastUpdatedAt time.Time `json:"last_updated_at"`
 	Name          string    `json:"name"`
 
+	// BootstrapTemplate is the name of the scaffold template the workspace was created from
+	BootstrapTemplate string `json:"bootstrap_template,omitempty"`
+
+	// AutoGenerateReadme refreshes the README.md of a chart when a plan changes its values.yaml
+	AutoGenerateReadme bool `json:"auto_generate_readme"`
+	// Source is where the workspace's chart was imported from, it's nil unless it came from a repository
+	Source *WorkspaceSource `json:"source,omitempty"`
+
+	// Import is the progress of the import that created the workspace, it's nil for workspaces
+	// that weren't imported or were imported before progress was recorded
+	Import *ImportProgress `json:"import,omitempty"`
+	// ImportReport is what validating the imported files found, it's nil for workspaces that
+	// weren't imported or were imported before imports were validated
+	ImportReport *ImportReport `json:"importReport,omitempty"`
+
+	// ArchivedAt is when the workspace was archived, archived workspaces are purged after the
+	// retention period and nothing can be enqueued for them
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+
 	CurrentRevision          int  `json:"current_revision"`
 	IncompleteRevisionNumber *int `json:"incomplete_revision_number,omitempty"`
 
@@ -45,6 +91,16 @@ type Workspace struct {
 	PreviousPlans []Plan `json:"previous_plans"`
 }
 
+// WorkspaceSource is the repository a workspace's chart was imported from, for provenance
+type WorkspaceSource struct {
+	URL string `json:"url"`
+	// Ref is the branch, tag or commit that was asked for, empty for the default branch
+	Ref          string `json:"ref,omitempty"`
+	Subdirectory string `json:"subdirectory,omitempty"`
+	// CommitSHA is the commit the chart was read from
+	CommitSHA string `json:"commitSha"`
+}
+
 type Revision struct {
 	WorkspaceID     string    `json:"workspaceId"`
 	RevisionNumber  int       `json:"revisionNumber"`
@@ -55,6 +111,14 @@ type Revision struct {
 	IsRendered      bool      `json:"isRendered"`
 }
 
+// RevisionHealth is the health score of a revision, computed from its lint findings, best practices
+// and render
+type RevisionHealth struct {
+	RevisionNumber int       `json:"revisionNumber"`
+	CreatedAt      time.Time `json:"createdAt"`
+	Score          int       `json:"score"`
+}
+
 type PlanStatus string
 
 const (
@@ -63,6 +127,10 @@ const (
 	PlanStatusReview   PlanStatus = "review"
 	PlanStatusApplying PlanStatus = "applying"
 	PlanStatusApplied  PlanStatus = "applied"
+
+	// PlanStatusReviewFiles is a plan whose action files are waiting for a review of each file
+	// before they're applied
+	PlanStatusReviewFiles PlanStatus = "review-files"
 )
 
 type Plan struct {
@@ -76,14 +144,123 @@ type Plan struct {
 	Status         PlanStatus   `json:"status"`
 	ActionFiles    []ActionFile `json:"actionFiles"`
 	ProceedAt      *time.Time   `json:"proceedAt"`
+	// RebasedFromPlanID is the plan this plan was cloned from onto a later revision
+	RebasedFromPlanID string `json:"rebasedFromPlanId,omitempty"`
 }
 
 type ActionFile struct {
-	Action string `json:"action"`
-	Path   string `json:"path"`
-	Status string `json:"status"`
+	Action  string `json:"action"`
+	Path    string `json:"path"`
+	ChartID string `json:"chartId,omitempty"`
+	Status  string `json:"status"`
+	// Error is why the action failed, when Status is failed
+	Error string `json:"error,omitempty"`
+	// Review is the reviewer's decision on the file, empty when it hasn't been reviewed
+	Review ActionFileReview `json:"review,omitempty"`
+	// ReviewNote is the reviewer's note, it's given to the LLM when the file is applied
+	ReviewNote string `json:"reviewNote,omitempty"`
+	// StartedAt is when the file was last started being applied
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	// FinishedAt is when the file was created or failed, it's cleared when the file is started again
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ActionFileRebase is how rebasing a plan onto the current revision changed one of its action files
+type ActionFileRebase struct {
+	ChartID string `json:"chartId,omitempty"`
+	Path    string `json:"path"`
+	// From is the action in the original plan and To the action in the rebased plan, empty when
+	// the action was dropped
+	From string `json:"from"`
+	To   string `json:"to,omitempty"`
+	// Drifted is true when the file changed since the revision the original plan was created against
+	Drifted bool   `json:"drifted,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// PlanExecutionStatus is a snapshot of how far the execution of a plan has got, computed from the
+// plan, its action files, its revision and the render of that revision
+type PlanExecutionStatus struct {
+	PlanID      string           `json:"planId"`
+	WorkspaceID string           `json:"workspaceId"`
+	Status      PlanStatus       `json:"status"`
+	ActionFiles []ActionFile     `json:"actionFiles"`
+	Counts      ActionFileCounts `json:"counts"`
+	// RevisionNumber is the revision the plan builds, nil until it's created
+	RevisionNumber *int `json:"revisionNumber,omitempty"`
+	// Render is the most recent render of the revision, nil until it's rendered
+	Render *PlanRender `json:"render,omitempty"`
+	// UpdatedAt is the latest change to any of the above
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ActionFileCounts counts the action files of a plan by where they are in its execution
+type ActionFileCounts struct {
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+	Done    int `json:"done"`
+	Failed  int `json:"failed"`
+	// Skipped are the files that won't be applied because their review rejected them
+	Skipped int `json:"skipped"`
+}
+
+// PlanRender is a render of the revision a plan builds
+type PlanRender struct {
+	ID              string     `json:"id"`
+	RevisionNumber  int        `json:"revisionNumber"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	Charts          int        `json:"charts"`
+	ChartsSucceeded int        `json:"chartsSucceeded"`
+	ChartsFailed    int        `json:"chartsFailed"`
+	// Notes are the rendered NOTES.txt of the charts that have one, by chart ID
+	Notes map[string]string `json:"notes,omitempty"`
+	// Compatibility is the Kubernetes versions the render can be installed on, nil until it completes
+	Compatibility *RenderCompatibility `json:"compatibility,omitempty"`
+}
+
+// PlanDryRun is a preview of the changes a plan would make, from executing its actions against
+// copies of the current files. Nothing is written to the workspace.
+type PlanDryRun struct {
+	PlanID         string    `json:"planId"`
+	RevisionNumber int       `json:"revisionNumber"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// Fingerprint identifies the plan and files the preview was made from, a preview is only
+	// reused while they're unchanged
+	Fingerprint string `json:"fingerprint"`
+	// Complete is false when the budget ran out before every action was previewed
+	Complete bool             `json:"complete"`
+	Files    []PlanDryRunFile `json:"files"`
+	// Actions is how many actions the plan has, including the ones that weren't previewed
+	Actions      int   `json:"actions"`
+	InputTokens  int64 `json:"inputTokens"`
+	OutputTokens int64 `json:"outputTokens"`
+	// Cached is set on a preview that was reused instead of made for the request
+	Cached bool `json:"cached"`
+}
+
+// PlanDryRunFile is the previewed content of a file a plan changes
+type PlanDryRunFile struct {
+	ChartID string `json:"chartId,omitempty"`
+	Path    string `json:"path"`
+	Action  string `json:"action"`
+	Content string `json:"content"`
+	// Diff is from the content in the revision, nil when the action left the file unchanged
+	Diff *FileDiff `json:"diff,omitempty"`
+	// Error is why the action failed, the other files are still previewed
+	Error string `json:"error,omitempty"`
 }
 
+// ActionFileReview is a reviewer's decision on an action file of a plan
+type ActionFileReview string
+
+const (
+	ActionFileReviewApproved  ActionFileReview = "approved"
+	ActionFileReviewRejected  ActionFileReview = "rejected"
+	ActionFileReviewCommented ActionFileReview = "commented"
+)
+
 type ChatMessageFromPersona string
 
 const (
@@ -107,6 +284,103 @@ type Chat struct {
 	ResponseRollbackToRevisionNumber *int                    `json:"responseRollbackToRevisionNumber"`
 	RevisionNumber                   int                     `json:"revisionNumber"`
 	MessageFromPersona               *ChatMessageFromPersona `json:"messageFromPersona"`
+	// IsSystemGenerated is true for messages chartsmith created on behalf of the user, such as one
+	// asking for the errors of a render to be fixed
+	IsSystemGenerated bool `json:"isSystemGenerated"`
+}
+
+// Import statuses of a workspace created from an imported chart
+const (
+	ImportStatusImporting = "importing"
+	ImportStatusComplete  = "complete"
+	ImportStatusFailed    = "failed"
+)
+
+// ImportProgress is how far the import of a chart into a new workspace has got
+type ImportProgress struct {
+	Status         string `json:"status"`
+	FilesProcessed int    `json:"filesProcessed"`
+	FilesTotal     int    `json:"filesTotal"`
+	// CurrentPath is the last file that was imported
+	CurrentPath string `json:"currentPath,omitempty"`
+	// Error is why a failed import failed
+	Error string `json:"error,omitempty"`
+	// Stats describe a complete import
+	Stats *ImportStats `json:"stats,omitempty"`
+}
+
+// ImportStats describe what a complete import imported
+type ImportStats struct {
+	Files           int `json:"files"`
+	Charts          int `json:"charts"`
+	SkippedBinaries int `json:"skippedBinaries"`
+}
+
+// ImportType is what an import expects to find in the imported files
+type ImportType string
+
+const (
+	// ImportTypeHelm is a Helm chart, it must have a Chart.yaml
+	ImportTypeHelm ImportType = "helm"
+	// ImportTypeK8s is Kubernetes manifests, they're converted to a chart
+	ImportTypeK8s ImportType = "k8s"
+)
+
+// ImportFindingCategory is the kind of problem an import validation finding is
+type ImportFindingCategory string
+
+const (
+	ImportFindingMissingChartYAML ImportFindingCategory = "missing_chart_yaml"
+	ImportFindingInvalidChartYAML ImportFindingCategory = "invalid_chart_yaml"
+	ImportFindingTemplateParse    ImportFindingCategory = "template_parse"
+	ImportFindingFileTooLarge     ImportFindingCategory = "file_too_large"
+	ImportFindingBinaryFile       ImportFindingCategory = "binary_file"
+	ImportFindingCaseDuplicate    ImportFindingCategory = "case_duplicate"
+)
+
+// ImportFindingSeverity is whether an import can go on with a finding
+type ImportFindingSeverity string
+
+const (
+	ImportFindingWarning ImportFindingSeverity = "warning"
+	// ImportFindingFatal findings abort the import
+	ImportFindingFatal ImportFindingSeverity = "fatal"
+)
+
+// ImportFinding is a problem found in the files of an import
+type ImportFinding struct {
+	Category ImportFindingCategory `json:"category"`
+	Severity ImportFindingSeverity `json:"severity"`
+	// Path is the file the finding is about, empty for findings about the whole import
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport is what validating the files of an import found
+type ImportReport struct {
+	Findings []ImportFinding `json:"findings"`
+}
+
+// Fatal returns the findings that abort the import
+func (r ImportReport) Fatal() []ImportFinding {
+	fatal := []ImportFinding{}
+	for _, finding := range r.Findings {
+		if finding.Severity == ImportFindingFatal {
+			fatal = append(fatal, finding)
+		}
+	}
+	return fatal
+}
+
+// ChatAttachment is a file uploaded with a chat message, its content is given to the intent
+// classifier and the planner along with the prompt
+type ChatAttachment struct {
+	ID          string    `json:"id"`
+	MessageID   string    `json:"messageId"`
+	Filename    string    `json:"filename"`
+	Content     string    `json:"content"`
+	ContentType string    `json:"contentType"`
+	CreatedAt   time.Time `json:"createdAt"`
 }
 
 type FollowupAction struct {
@@ -132,6 +406,64 @@ type Rendered struct {
 	CompletedAt    *time.Time      `json:"completedAt"`
 	IsAutorender   bool            `json:"isAutorender"`
 	Charts         []RenderedChart `json:"charts"`
+	// ValuesProfile is the name of the values profile layered over values.yaml, if any
+	ValuesProfile string `json:"valuesProfile,omitempty"`
+	// IsDebug renders with helm template --debug, the debug output of each chart is kept on it
+	IsDebug bool `json:"isDebug,omitempty"`
+	// Inventory summarizes what the render deploys, it's set once the render completes
+	Inventory *RenderInventory `json:"inventory,omitempty"`
+	// Compatibility is the Kubernetes versions the render can be installed on, it's set once the
+	// render completes
+	Compatibility *RenderCompatibility `json:"compatibility,omitempty"`
+	// ArtifactsCompactedAt is when the commands and output of the render's charts were dropped to
+	// save space, nil while they're kept
+	ArtifactsCompactedAt *time.Time `json:"artifactsCompactedAt,omitempty"`
+}
+
+// RenderInventory is what a render deploys, across all of its charts
+type RenderInventory struct {
+	// Kinds counts the documents of each kind
+	Kinds map[string]int `json:"kinds"`
+	// Namespaces are the namespaces documents are in and the namespaces the render creates
+	Namespaces []string `json:"namespaces"`
+	// Images are the images of the containers and init containers
+	Images []string `json:"images"`
+	// TotalReplicas adds up the replicas of the workloads that have them, a workload without
+	// replicas counts as the 1 Kubernetes defaults it to
+	TotalReplicas int `json:"totalReplicas"`
+	// Unparsed counts the documents that aren't YAML objects with a kind
+	Unparsed int `json:"unparsed"`
+}
+
+// RenderCompatibility is the range of Kubernetes minor versions that serve every API a render uses,
+// and the resources that use deprecated or removed APIs
+type RenderCompatibility struct {
+	// MinKubeVersion is the oldest version that serves every rendered API, empty when none of them
+	// is newer than the versions the table knows about
+	MinKubeVersion string `json:"minKubeVersion,omitempty"`
+	// MaxKubeVersion is the newest version that serves every rendered API, empty when none of them
+	// has been removed
+	MaxKubeVersion string `json:"maxKubeVersion,omitempty"`
+	// Summary is a one line description of the above, for the render stream
+	Summary  string                 `json:"summary"`
+	Findings []CompatibilityFinding `json:"findings"`
+}
+
+// CompatibilityFinding is a resource that uses a deprecated or removed API
+type CompatibilityFinding struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Name is the name of the rendered resource, empty for a finding in a template
+	Name string `json:"name,omitempty"`
+	// Template is the template the resource comes from, relative to the chart
+	Template string `json:"template,omitempty"`
+	// Rendered is false for an apiVersion written in a template that the render didn't output, for
+	// example one behind a condition. These don't narrow the version range.
+	Rendered     bool   `json:"rendered"`
+	DeprecatedIn string `json:"deprecatedIn,omitempty"`
+	RemovedIn    string `json:"removedIn,omitempty"`
+	// Replacement is the API to move to, empty when the API was removed without one
+	Replacement string `json:"replacement,omitempty"`
 }
 
 type RenderedChart struct {
@@ -150,10 +482,62 @@ type RenderedChart struct {
 	HelmTemplateStdout  string `json:"helmTemplateStdout,omitempty"`
 	HelmTemplateStderr  string `json:"helmTemplateStderr,omitempty"`
 
+	// HelmTemplateWarnings and HelmTemplateErrors are the lines of HelmTemplateStderr, split into
+	// the non-fatal warnings helm prints on successful renders and everything else
+	HelmTemplateWarnings []string `json:"helmTemplateWarnings,omitempty"`
+	HelmTemplateErrors   []string `json:"helmTemplateErrors,omitempty"`
+
+	// ClusterDryRun are the results of the latest server side dry run of the rendered manifests
+	// against a cluster, empty when the render wasn't validated against one
+	ClusterDryRun []ClusterDryRunResult `json:"clusterDryRun,omitempty"`
+
+	// Notes is the rendered NOTES.txt of the chart and its subcharts, nil when there is none
+	Notes *string `json:"notes"`
+
+	// Debug is what helm template --debug printed, nil unless the render was a debug render. It can
+	// have secrets from the values, so it's never marshalled with the chart, the render status API
+	// returns it on its own.
+	Debug *RenderDebug `json:"-"`
+
 	CreatedAt   time.Time  `json:"createdAt"`
 	CompletedAt *time.Time `json:"completedAt"`
 }
 
+// RenderDebug is what helm template --debug prints, taken out of the output of helm template
+type RenderDebug struct {
+	// UserSuppliedValues are the values layered over the values of the chart
+	UserSuppliedValues string `json:"userSuppliedValues"`
+	// ComputedValues are the values the templates were rendered with, the user-supplied values
+	// coalesced with the values of the chart and its subcharts
+	ComputedValues string `json:"computedValues"`
+	// Log are the debug log lines of helm, with the stack trace of the error when it failed
+	Log []string `json:"log,omitempty"`
+	// Warning is why the values couldn't be computed. It doesn't fail the render.
+	Warning string `json:"warning,omitempty"`
+}
+
+// the outcomes of a server side dry run of a rendered document
+const (
+	ClusterDryRunAccepted          = "accepted"
+	ClusterDryRunRejected          = "rejected"
+	ClusterDryRunNamespaceNotFound = "namespace-not-found"
+	// ClusterDryRunError is a document the cluster didn't answer for, such as on a timeout or
+	// when the kubeconfig can't connect
+	ClusterDryRunError = "error"
+)
+
+// ClusterDryRunResult is what a cluster said about applying one rendered document
+type ClusterDryRunResult struct {
+	// Source is the template that rendered the document, from helm's # Source: comment
+	Source    string `json:"source,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Status    string `json:"status"`
+	// Message is kubectl's output, the reason for a rejection or an error
+	Message string `json:"message,omitempty"`
+}
+
 type RenderedFile struct {
 	ID              string `json:"id"`
 	RevisionNumber  int    `json:"-"`
@@ -181,11 +565,21 @@ type Conversion struct {
 	WorkspaceID    string           `json:"workspaceId"`
 	ChatMessageIDs []string         `json:"chatMessageIds"`
 	CreatedAt      time.Time        `json:"createdAt"`
+	SourceType     string           `json:"sourceType"`
 	Status         ConversionStatus `json:"status"`
 	ChartYAML      string           `json:"chartYAML"`
 	ValuesYAML     string           `json:"valuesYAML"`
+	Log            string           `json:"log,omitempty"`
 }
 
+const (
+	// ConversionSourceTypeK8s is a conversion of loose Kubernetes manifests
+	ConversionSourceTypeK8s = "k8s"
+	// ConversionSourceTypeKustomize is a conversion of a Kustomize project, which is built into
+	// manifests before they're converted
+	ConversionSourceTypeKustomize = "kustomize"
+)
+
 type ConversionFileStatus string
 
 const (
@@ -204,3 +598,306 @@ type ConversionFile struct {
 	FileStatus     ConversionFileStatus `json:"status"`
 	ConvertedFiles map[string]string    `json:"convertedFiles"`
 }
+
+// ValuesReference is a reference to a values key from a template file
+type ValuesReference struct {
+	Path     string `json:"path"`
+	FilePath string `json:"filePath"`
+}
+
+// ValuesAnalysis compares the keys defined in a chart's values.yaml with the keys its templates reference
+type ValuesAnalysis struct {
+	ChartID string `json:"chartId"`
+
+	// UnusedKeys are keys in values.yaml that no template references
+	UnusedKeys []string `json:"unusedKeys"`
+	// UndefinedKeys are referenced by templates but not defined in values.yaml
+	UndefinedKeys []ValuesReference `json:"undefinedKeys"`
+	// Unknown are references that can't be resolved statically, such as index with a variable key.
+	// Keys under these paths are never reported as unused.
+	Unknown []ValuesReference `json:"unknown"`
+}
+
+// DuplicateMethod is how the similarity of two files was measured
+type DuplicateMethod string
+
+const (
+	// DuplicateMethodEmbeddings is the cosine similarity of the files' embeddings
+	DuplicateMethodEmbeddings DuplicateMethod = "embeddings"
+	// DuplicateMethodContent is the share of lines the files have in common, after normalizing
+	// whitespace and dropping comments. It's used when either file has no embeddings, or has
+	// pending content its embeddings don't cover.
+	DuplicateMethodContent DuplicateMethod = "content"
+)
+
+// DuplicateFilePair is two files of a chart that are suspected to be duplicates of each other
+type DuplicateFilePair struct {
+	ChartID       string          `json:"chartId"`
+	FilePath      string          `json:"filePath"`
+	OtherFilePath string          `json:"otherFilePath"`
+	Similarity    float64         `json:"similarity"`
+	Method        DuplicateMethod `json:"method"`
+}
+
+// DuplicateFileGroup is files of a chart connected by suspected duplicate pairs
+type DuplicateFileGroup struct {
+	ChartID   string   `json:"chartId"`
+	FilePaths []string `json:"filePaths"`
+	// Similarity is the lowest similarity of the pairs that connect the group
+	Similarity float64 `json:"similarity"`
+}
+
+// DuplicateReport is the suspected duplicate files of a revision, most similar first
+type DuplicateReport struct {
+	Pairs  []DuplicateFilePair  `json:"pairs"`
+	Groups []DuplicateFileGroup `json:"groups"`
+}
+
+// LLMUsage is the token usage of a single LLM call. The workspace, plan and chat message are the
+// ones the call was made for, when known.
+type LLMUsage struct {
+	WorkspaceID   string `json:"workspaceId"`
+	PlanID        string `json:"planId,omitempty"`
+	ChatMessageID string `json:"chatMessageId,omitempty"`
+	Operation     string `json:"operation"`
+	Model         string `json:"model"`
+	InputTokens   int64  `json:"inputTokens"`
+	OutputTokens  int64  `json:"outputTokens"`
+	// PromptVersions are the versions of the system prompts the call was given, by name. Version 0
+	// is the default built into chartsmith, given when the prompts couldn't be read.
+	PromptVersions map[string]int `json:"promptVersions,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// UsageTotal is the token usage of an operation on a day
+type UsageTotal struct {
+	Operation    string `json:"operation"`
+	Day          string `json:"day"`
+	Calls        int64  `json:"calls"`
+	InputTokens  int64  `json:"inputTokens"`
+	OutputTokens int64  `json:"outputTokens"`
+}
+
+// UsageSummary is the token usage of a workspace, in total and grouped by operation and day
+type UsageSummary struct {
+	WorkspaceID  string       `json:"workspaceId"`
+	Calls        int64        `json:"calls"`
+	InputTokens  int64        `json:"inputTokens"`
+	OutputTokens int64        `json:"outputTokens"`
+	Totals       []UsageTotal `json:"totals"`
+}
+
+// ConversationMemory is the summary of the chat messages of a workspace that are too old to send
+// to the LLM in full
+type ConversationMemory struct {
+	Summary string `json:"summary"`
+	// SummarizedThrough is when the newest chat message in the summary was created
+	SummarizedThrough *time.Time `json:"summarizedThrough,omitempty"`
+}
+
+// ValuesProfile is a set of values for an environment, such as values-prod.yaml, that's layered
+// over the values.yaml of a chart when rendering
+type ValuesProfile struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspaceId"`
+	ChartID     string    `json:"chartId"`
+	Name        string    `json:"name"`
+	Content     string    `json:"content"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// PromptSnippet is an instruction a user saved to reuse in their prompts, such as their labeling
+// conventions. Snippets that apply automatically are given to the LLM when planning and executing
+// changes to the workspaces the user created.
+type PromptSnippet struct {
+	ID                 string    `json:"id"`
+	UserID             string    `json:"userId"`
+	Name               string    `json:"name"`
+	Content            string    `json:"content"`
+	ApplyAutomatically bool      `json:"applyAutomatically"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+// SystemPrompt is a version of a system prompt the LLM is given. Only the active version of each
+// prompt is given, and a prompt is changed by creating a new version and activating it.
+type SystemPrompt struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"`
+	IsActive  bool      `json:"isActive"`
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+}
+
+// WorkspaceRole is what a member of a workspace can do in it
+type WorkspaceRole string
+
+const (
+	// WorkspaceRoleOwner can also manage the members of the workspace
+	WorkspaceRoleOwner WorkspaceRole = "owner"
+	// WorkspaceRoleEditor can change the workspace, such as its files, plans and settings
+	WorkspaceRoleEditor WorkspaceRole = "editor"
+	// WorkspaceRoleViewer can read the workspace and receives its realtime events
+	WorkspaceRoleViewer WorkspaceRole = "viewer"
+)
+
+// WorkspaceMember is a user with a role in a workspace
+type WorkspaceMember struct {
+	WorkspaceID string        `json:"workspaceId"`
+	UserID      string        `json:"userId"`
+	Role        WorkspaceRole `json:"role"`
+	// IsCreator is set for the user that created the workspace, who is always an owner
+	IsCreator bool      `json:"isCreator"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SecretFinding is a credential found in a file of a workspace
+type SecretFinding struct {
+	FilePath    string `json:"filePath"`
+	Detector    string `json:"detector"`
+	Line        int    `json:"line"`
+	Fingerprint string `json:"fingerprint"`
+	Redacted    string `json:"redacted"`
+	// Acknowledged is set when content with the secret can be sent to LLMs
+	Acknowledged bool `json:"acknowledged"`
+}
+
+// FileHistoryEntry is a revision that created, changed or deleted a file
+type FileHistoryEntry struct {
+	RevisionNumber int `json:"revisionNumber"`
+	// Change is "created", "modified" or "deleted". A renamed file is deleted at its old path and
+	// created at its new one.
+	Change    string    `json:"change"`
+	CreatedAt time.Time `json:"createdAt"`
+	PlanID    string    `json:"planId,omitempty"`
+	// Prompt is the beginning of the chat message the plan that created the revision answered
+	Prompt       string `json:"prompt,omitempty"`
+	LinesAdded   int    `json:"linesAdded"`
+	LinesRemoved int    `json:"linesRemoved"`
+}
+
+// FileDiff is how a file changed between two revisions
+type FileDiff struct {
+	FilePath     string `json:"filePath"`
+	ChartID      string `json:"chartId,omitempty"`
+	FromRevision int    `json:"fromRevision"`
+	ToRevision   int    `json:"toRevision"`
+	// Diff is a unified diff, cut to a maximum number of lines when Truncated is set
+	Diff         string `json:"diff"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	LinesAdded   int    `json:"linesAdded"`
+	LinesRemoved int    `json:"linesRemoved"`
+}
+
+// FileTree is the files of a revision as a tree, grouped by chart. A tree of a subtree has the
+// chart the subtree is in, with the children of the directory that was asked for.
+type FileTree struct {
+	RevisionNumber int `json:"revisionNumber"`
+	// ParentRevisionNumber is the revision changes are compared with, 0 for the first revision
+	ParentRevisionNumber int `json:"parentRevisionNumber,omitempty"`
+	FileCount            int `json:"fileCount"`
+	ChangedFileCount     int `json:"changedFileCount"`
+	// Lazy is true when the tree has more files than are returned at once, directories below the
+	// first level then have ChildrenOmitted set and are loaded one at a time
+	Lazy   bool            `json:"lazy,omitempty"`
+	Charts []FileTreeChart `json:"charts"`
+	// Files are the files of the workspace that aren't in a chart
+	Files []FileTreeNode `json:"files"`
+}
+
+// FileTreeChart is a chart of a file tree
+type FileTreeChart struct {
+	ID               string         `json:"id"`
+	Name             string         `json:"name"`
+	FileCount        int            `json:"fileCount"`
+	ChangedFileCount int            `json:"changedFileCount"`
+	Children         []FileTreeNode `json:"children"`
+}
+
+// FileTreeNode is a directory or a file of a file tree, paths are relative to the chart
+type FileTreeNode struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+	// Size is the size in bytes of a file's content, its pending content when it has any, and the
+	// total of a directory's files
+	Size int `json:"size"`
+
+	// FileID, GVK and the flags are of files. GVK is nil for a file without a kind written in it.
+	FileID       string            `json:"fileId,omitempty"`
+	GVK          *GroupVersionKind `json:"gvk,omitempty"`
+	HasSummary   bool              `json:"hasSummary,omitempty"`
+	HasEmbedding bool              `json:"hasEmbedding,omitempty"`
+	// ChangedSinceParentRevision is true for a file that's new in the revision or whose content
+	// differs from the parent revision's
+	ChangedSinceParentRevision bool `json:"changedSinceParentRevision,omitempty"`
+
+	// FileCount and ChangedFileCount are of the files under a directory
+	FileCount        int            `json:"fileCount,omitempty"`
+	ChangedFileCount int            `json:"changedFileCount,omitempty"`
+	Children         []FileTreeNode `json:"children,omitempty"`
+	// ChildrenOmitted is true for a directory of a lazy tree, its children are loaded by asking
+	// for its subtree
+	ChildrenOmitted bool `json:"childrenOmitted,omitempty"`
+}
+
+// GroupVersionKind is the group, version and kind of a Kubernetes resource. Group and Version are
+// empty when the apiVersion is produced by a template action.
+type GroupVersionKind struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version,omitempty"`
+	Kind    string `json:"kind"`
+}
+
+// AuditEvent is a significant state transition of a workspace, such as a plan being created or
+// a render failing
+type AuditEvent struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspaceId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Actor is user, system or llm-executor
+	Actor     string                 `json:"actor"`
+	EventType string                 `json:"eventType"`
+	Payload   map[string]interface{} `json:"payload"`
+}
+
+// ShareLink gives read-only access to one revision of a workspace, without an account, until it
+// expires or is revoked. Only a hash of its token is stored.
+type ShareLink struct {
+	ID              string     `json:"id"`
+	WorkspaceID     string     `json:"workspaceId"`
+	RevisionNumber  int        `json:"revisionNumber"`
+	CreatedByUserID string     `json:"createdByUserId,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	ExpiresAt       time.Time  `json:"expiresAt"`
+	RevokedAt       *time.Time `json:"revokedAt,omitempty"`
+}
+
+// SharedSnapshot is what a share link shows: the files and charts of the shared revision and its
+// latest render. Nothing else of the workspace, such as its chat, plans or other revisions, is in
+// it.
+type SharedSnapshot struct {
+	WorkspaceName  string        `json:"workspaceName"`
+	RevisionNumber int           `json:"revisionNumber"`
+	ExpiresAt      time.Time     `json:"expiresAt"`
+	Charts         []SharedChart `json:"charts"`
+	// Files are the files that don't belong to a chart
+	Files []SharedFile `json:"files"`
+	// Render is the latest render of the revision, nil when it wasn't rendered
+	Render *PlanRender `json:"render"`
+}
+
+// SharedChart is a chart of a shared revision
+type SharedChart struct {
+	Name  string       `json:"name"`
+	Files []SharedFile `json:"files"`
+}
+
+// SharedFile is a file of a shared revision, with the content it was committed with
+type SharedFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
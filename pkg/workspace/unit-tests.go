@@ -0,0 +1,92 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/param"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+)
+
+// UnitTestResult is the outcome of running the helm-unittest suites of a chart
+type UnitTestResult struct {
+	Passed bool   `json:"passed"`
+	Cmd    string `json:"cmd"`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// UnitTestsEnabled reports whether CHARTSMITH_HELM_UNITTEST says helm has the helm-unittest plugin
+func UnitTestsEnabled() bool {
+	return strings.EqualFold(strings.TrimSpace(param.Get().HelmUnittest), "true")
+}
+
+// runUnitTests is a var so that RunChartUnitTests can be tested without helm
+var runUnitTests = helmutils.RunUnitTests
+
+// RunChartUnitTests runs helm unittest on a chart in the current revision of a workspace. Pending
+// content is tested, so that generated suites can be run before they're accepted. Failing tests
+// aren't an error, they're reported in the result.
+func RunChartUnitTests(ctx context.Context, workspaceID string, chartID string) (*UnitTestResult, error) {
+	w, err := GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	var chart *types.Chart
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			chart = &w.Charts[i]
+		}
+	}
+	if chart == nil {
+		return nil, fmt.Errorf("%w: %s in workspace %s", ErrChartNotFound, chartID, workspaceID)
+	}
+
+	return runChartUnitTests(fmt.Sprintf("%s-%d-%s", w.ID, w.CurrentRevision, chart.ID), chart.Files)
+}
+
+func runChartUnitTests(runID string, chartFiles []types.File) (*UnitTestResult, error) {
+	files := make([]types.File, 0, len(chartFiles))
+	for _, file := range chartFiles {
+		if file.ContentPending != nil {
+			file.Content = *file.ContentPending
+		}
+		files = append(files, file)
+	}
+
+	// unbuffered, so every line has been read by the time Done is
+	channels := helmutils.UnitTestChannels{
+		Cmd:    make(chan string),
+		Stdout: make(chan string),
+		Stderr: make(chan string),
+		Done:   make(chan error),
+	}
+	go runUnitTests(runID, files, channels)
+
+	result := &UnitTestResult{}
+	var stdout, stderr strings.Builder
+	for {
+		select {
+		case cmd := <-channels.Cmd:
+			result.Cmd = cmd
+		case line := <-channels.Stdout:
+			stdout.WriteString(line)
+		case line := <-channels.Stderr:
+			stderr.WriteString(line)
+		case err := <-channels.Done:
+			result.Stdout, result.Stderr = stdout.String(), stderr.String()
+			if errors.Is(err, helmutils.ErrUnitTestsFailed) {
+				return result, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to run unit tests: %w", err)
+			}
+			result.Passed = true
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	helmutils "github.com/replicatedhq/chartsmith/helm-utils"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunChartUnitTests(t *testing.T) {
+	pending := "suite: pending\n"
+	files := []types.File{
+		{FilePath: "Chart.yaml", Content: "name: nginx\n"},
+		{FilePath: "tests/service_test.yaml", Content: "suite: accepted\n", ContentPending: &pending},
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantPassed bool
+		wantErr    string
+	}{
+		{name: "passing", wantPassed: true},
+		{name: "failing", err: fmt.Errorf("exited with 1: %w", helmutils.ErrUnitTestsFailed)},
+		{name: "plugin not installed", err: helmutils.ErrUnitTestPluginNotInstalled, wantErr: "not installed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := runUnitTests
+			t.Cleanup(func() { runUnitTests = original })
+
+			var gotFiles []types.File
+			runUnitTests = func(runID string, files []types.File, channels helmutils.UnitTestChannels) error {
+				gotFiles = files
+				channels.Cmd <- "helm unittest ."
+				channels.Stdout <- "PASS\n"
+				channels.Stderr <- "warning\n"
+				channels.Done <- tt.err
+				return tt.err
+			}
+
+			result, err := runChartUnitTests("run", files)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.True(t, errors.Is(err, tt.err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, &UnitTestResult{Passed: tt.wantPassed, Cmd: "helm unittest .", Stdout: "PASS\n", Stderr: "warning\n"}, result)
+			require.Len(t, gotFiles, 2)
+			assert.Equal(t, pending, gotFiles[1].Content)
+			assert.Equal(t, "suite: accepted\n", files[1].Content)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+)
+
+// RecordLLMUsage writes the token usage of an LLM call, a zero CreatedAt is recorded as now. The
+// prompt versions of a call made for a plan are added to the plan too, so that the prompts a plan
+// was made with can be found without its usage.
+func RecordLLMUsage(ctx context.Context, usage types.LLMUsage) error {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return fmt.Errorf("failed to generate usage ID: %w", err)
+	}
+
+	createdAt := usage.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	var promptVersions []byte
+	if len(usage.PromptVersions) > 0 {
+		promptVersions, err = json.Marshal(usage.PromptVersions)
+		if err != nil {
+			return fmt.Errorf("failed to marshal prompt versions: %w", err)
+		}
+	}
+
+	query := `INSERT INTO llm_usage (id, created_at, workspace_id, plan_id, chat_message_id, operation, model, input_tokens, output_tokens, prompt_versions)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10)`
+	if _, err := conn.Exec(ctx, query, id, createdAt, usage.WorkspaceID, usage.PlanID, usage.ChatMessageID, usage.Operation, usage.Model, usage.InputTokens, usage.OutputTokens, promptVersions); err != nil {
+		return fmt.Errorf("failed to insert llm usage: %w", err)
+	}
+
+	if usage.PlanID != "" && promptVersions != nil {
+		query = `UPDATE workspace_plan SET prompt_versions = COALESCE(prompt_versions, '{}'::jsonb) || $2::jsonb WHERE id = $1`
+		if _, err := conn.Exec(ctx, query, usage.PlanID, promptVersions); err != nil {
+			return fmt.Errorf("failed to record prompt versions on plan: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetUsageSummary returns the token usage of a workspace, in total and grouped by operation and day
+func GetUsageSummary(ctx context.Context, workspaceID string) (*types.UsageSummary, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT operation, model, COALESCE(plan_id, ''), COALESCE(chat_message_id, ''), input_tokens, output_tokens, created_at
+		FROM llm_usage
+		WHERE workspace_id = $1`
+
+	rows, err := conn.Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query llm usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []types.LLMUsage{}
+	for rows.Next() {
+		u := types.LLMUsage{WorkspaceID: workspaceID}
+		if err := rows.Scan(&u.Operation, &u.Model, &u.PlanID, &u.ChatMessageID, &u.InputTokens, &u.OutputTokens, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan llm usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating llm usage: %w", err)
+	}
+
+	return AggregateUsage(workspaceID, usage), nil
+}
+
+// AggregateUsage totals the usage of LLM calls, overall and by operation and day. created_at has no
+// time zone and is read as UTC, so a day is the date as it's stored.
+func AggregateUsage(workspaceID string, usage []types.LLMUsage) *types.UsageSummary {
+	summary := &types.UsageSummary{
+		WorkspaceID: workspaceID,
+		Totals:      []types.UsageTotal{},
+	}
+
+	index := map[string]int{}
+	for _, u := range usage {
+		day := u.CreatedAt.UTC().Format("2006-01-02")
+		key := u.Operation + "/" + day
+		i, ok := index[key]
+		if !ok {
+			i = len(summary.Totals)
+			index[key] = i
+			summary.Totals = append(summary.Totals, types.UsageTotal{Operation: u.Operation, Day: day})
+		}
+
+		summary.Totals[i].Calls++
+		summary.Totals[i].InputTokens += u.InputTokens
+		summary.Totals[i].OutputTokens += u.OutputTokens
+
+		summary.Calls++
+		summary.InputTokens += u.InputTokens
+		summary.OutputTokens += u.OutputTokens
+	}
+
+	sort.Slice(summary.Totals, func(i, j int) bool {
+		if summary.Totals[i].Day != summary.Totals[j].Day {
+			return summary.Totals[i].Day < summary.Totals[j].Day
+		}
+		return summary.Totals[i].Operation < summary.Totals[j].Operation
+	})
+
+	return summary
+}
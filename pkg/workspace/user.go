@@ -0,0 +1,40 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+)
+
+// IsAdminUser reports whether a user is a chartsmith admin. A user that doesn't exist isn't.
+func IsAdminUser(ctx context.Context, userID string) (bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var isAdmin bool
+	if err := conn.QueryRow(ctx, `SELECT COALESCE(is_admin, false) FROM chartsmith_user WHERE id = $1`, userID).Scan(&isAdmin); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	return isAdmin, nil
+}
+
+// GetUserName returns a user's name, or an empty name for a user that doesn't exist
+func GetUserName(ctx context.Context, userID string) (string, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	var name string
+	if err := conn.QueryRow(ctx, `SELECT name FROM chartsmith_user WHERE id = $1`, userID).Scan(&name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	return name, nil
+}
@@ -0,0 +1,275 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	chartanalysis "github.com/replicatedhq/chartsmith/pkg/analysis"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"gopkg.in/yaml.v3"
+)
+
+// GetChartValuesAnalysis analyzes the values usage of a chart in the current revision, see
+// AnalyzeValuesUsage
+func GetChartValuesAnalysis(ctx context.Context, workspaceID string, chartID string) (*types.ValuesAnalysis, error) {
+	w, err := GetWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	for i := range w.Charts {
+		if w.Charts[i].ID == chartID {
+			return AnalyzeValuesUsage(&w.Charts[i])
+		}
+	}
+	return nil, fmt.Errorf("%w: %s in workspace %s", ErrChartNotFound, chartID, workspaceID)
+}
+
+// AnalyzeValuesUsage reports values.yaml keys that no template in the chart references, and
+// template references to keys that values.yaml doesn't define. References that can't be resolved
+// statically are reported as unknown, and the keys under them are assumed to be used.
+func AnalyzeValuesUsage(c *types.Chart) (*types.ValuesAnalysis, error) {
+	analysis := &types.ValuesAnalysis{
+		ChartID:       c.ID,
+		UnusedKeys:    []string{},
+		UndefinedKeys: []types.ValuesReference{},
+		Unknown:       []types.ValuesReference{},
+	}
+
+	values := map[string]interface{}{}
+	ignoredKeys := map[string]bool{"global": true}
+	var templates []types.File
+	for _, file := range c.Files {
+		switch {
+		case file.FilePath == "values.yaml":
+			if err := yaml.Unmarshal([]byte(file.Content), &values); err != nil {
+				return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+			}
+		case file.FilePath == "Chart.yaml":
+			// values for subcharts are passed under the dependency name, templates here won't reference them
+			for _, name := range chartDependencyNames(file.Content) {
+				ignoredKeys[name] = true
+			}
+		case strings.HasPrefix(file.FilePath, "templates/"):
+			templates = append(templates, file)
+		}
+	}
+
+	keys := map[string]interface{}{}
+	flattenValuesKeys("", values, keys)
+
+	var references, scoped, unknown []types.ValuesReference
+	for _, template := range templates {
+		refs, withRefs, dynamic := chartanalysis.FindValuesReferences(template)
+		references = append(references, refs...)
+		scoped = append(scoped, withRefs...)
+		unknown = append(unknown, dynamic...)
+	}
+	analysis.Unknown = dedupeValuesReferences(unknown)
+
+	used := map[string]bool{}
+	for _, ref := range append(append([]types.ValuesReference{}, references...), unknown...) {
+		for key := range keys {
+			if valuesPathRelated(key, ref.Path) {
+				used[key] = true
+			}
+		}
+	}
+	// a with block only uses its children through the references inside it
+	for _, ref := range scoped {
+		for key := range keys {
+			if key == ref.Path || strings.HasPrefix(ref.Path, key+".") {
+				used[key] = true
+			}
+		}
+	}
+
+	for key := range keys {
+		if used[key] || ignoredKeys[strings.Split(key, ".")[0]] {
+			continue
+		}
+		// only report the topmost unused key, its children are implied
+		if parent := parentValuesPath(key); parent != "" && !used[parent] {
+			continue
+		}
+		analysis.UnusedKeys = append(analysis.UnusedKeys, key)
+	}
+	sort.Strings(analysis.UnusedKeys)
+
+	for _, ref := range dedupeValuesReferences(append(references, scoped...)) {
+		if !valuesPathDefined(ref.Path, keys) {
+			analysis.UndefinedKeys = append(analysis.UndefinedKeys, ref)
+		}
+	}
+
+	return analysis, nil
+}
+
+// ReferencedValues returns the values.yaml keys a template references, by dotted path, with their
+// values. A reference below a key that isn't a map, such as podAnnotations.foo, returns that key.
+// Keys under another returned key and references values.yaml doesn't define are left out.
+func ReferencedValues(template types.File, valuesYAML string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(valuesYAML), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+	}
+	keys := map[string]interface{}{}
+	flattenValuesKeys("", values, keys)
+
+	refs, scoped, _ := chartanalysis.FindValuesReferences(template)
+	found := map[string]bool{}
+	for _, ref := range dedupeValuesReferences(append(refs, scoped...)) {
+		for path := ref.Path; path != ""; path = parentValuesPath(path) {
+			if _, ok := keys[path]; ok {
+				found[path] = true
+				break
+			}
+		}
+	}
+
+	referenced := map[string]interface{}{}
+	for path := range found {
+		covered := false
+		for parent := parentValuesPath(path); parent != ""; parent = parentValuesPath(parent) {
+			if found[parent] {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			referenced[path] = keys[path]
+		}
+	}
+	return referenced, nil
+}
+
+// flattenValuesKeys records every key path in values, including intermediate maps
+func flattenValuesKeys(prefix string, values map[string]interface{}, keys map[string]interface{}) {
+	for k, v := range values {
+		path := joinValuesPath(prefix, k)
+		keys[path] = v
+		if child, ok := v.(map[string]interface{}); ok {
+			flattenValuesKeys(path, child, keys)
+		}
+	}
+}
+
+// valuesPathDefined returns true if path is a key in values.yaml, or is below a key that isn't a
+// non-empty map (e.g. podAnnotations: {} is commonly extended by users)
+func valuesPathDefined(path string, keys map[string]interface{}) bool {
+	if _, ok := keys[path]; ok {
+		return true
+	}
+
+	for parent := parentValuesPath(path); parent != ""; parent = parentValuesPath(parent) {
+		v, ok := keys[parent]
+		if !ok {
+			continue
+		}
+		m, isMap := v.(map[string]interface{})
+		return !isMap || len(m) == 0
+	}
+
+	return false
+}
+
+// valuesPathRelated returns true if referencing ref uses key, because key is ref, a parent of
+// ref or a child of ref
+func valuesPathRelated(key string, ref string) bool {
+	if ref == "" || key == ref {
+		return true
+	}
+	return strings.HasPrefix(ref, key+".") || strings.HasPrefix(key, ref+".")
+}
+
+func parentValuesPath(path string) string {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+func joinValuesPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if key == "" {
+		return prefix
+	}
+	return prefix + "." + key
+}
+
+func dedupeValuesReferences(refs []types.ValuesReference) []types.ValuesReference {
+	seen := map[string]bool{}
+	deduped := []types.ValuesReference{}
+	for _, ref := range refs {
+		if seen[ref.Path] {
+			continue
+		}
+		seen[ref.Path] = true
+		deduped = append(deduped, ref)
+	}
+	sort.Slice(deduped, func(i, j int) bool {
+		return deduped[i].Path < deduped[j].Path
+	})
+	return deduped
+}
+
+func chartDependencyNames(chartYAML string) []string {
+	var chart struct {
+		Dependencies []struct {
+			Name  string `yaml:"name"`
+			Alias string `yaml:"alias"`
+		} `yaml:"dependencies"`
+	}
+	if err := yaml.Unmarshal([]byte(chartYAML), &chart); err != nil {
+		return nil
+	}
+
+	names := []string{}
+	for _, dep := range chart.Dependencies {
+		if dep.Alias != "" {
+			names = append(names, dep.Alias)
+			continue
+		}
+		names = append(names, dep.Name)
+	}
+	return names
+}
+
+// FormatValuesAnalysis renders an analysis as plain text for the planner and debug console
+func FormatValuesAnalysis(analysis *types.ValuesAnalysis) string {
+	var sb strings.Builder
+
+	sb.WriteString("Unused values keys (defined in values.yaml, not referenced by any template):\n")
+	if len(analysis.UnusedKeys) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for _, key := range analysis.UnusedKeys {
+		sb.WriteString(fmt.Sprintf("  - %s\n", key))
+	}
+
+	sb.WriteString("Undefined values keys (referenced by a template, not defined in values.yaml):\n")
+	if len(analysis.UndefinedKeys) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for _, ref := range analysis.UndefinedKeys {
+		sb.WriteString(fmt.Sprintf("  - %s (%s)\n", ref.Path, ref.FilePath))
+	}
+
+	if len(analysis.Unknown) > 0 {
+		sb.WriteString("Unknown (dynamic references, keys under these are assumed to be used):\n")
+		for _, ref := range analysis.Unknown {
+			path := ".Values"
+			if ref.Path != "" {
+				path = ".Values." + ref.Path
+			}
+			sb.WriteString(fmt.Sprintf("  - %s (%s)\n", path, ref.FilePath))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,176 @@
+package workspace
+
+import (
+	"testing"
+
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const valuesAnalysisValues = `replicaCount: 1
+image:
+  repository: nginx
+  tag: ""
+  pullPolicy: IfNotPresent
+service:
+  type: ClusterIP
+  port: 80
+resources: {}
+podAnnotations: {}
+ingress:
+  enabled: false
+  className: ""
+  hosts: []
+legacy:
+  enabled: true
+  mode: compat
+global:
+  imageRegistry: ""
+redis:
+  enabled: true
+`
+
+func valuesAnalysisChart(templates map[string]string) *types.Chart {
+	c := &types.Chart{
+		ID: "chart",
+		Files: []types.File{
+			{FilePath: "Chart.yaml", Content: "apiVersion: v2\nname: app\ndependencies:\n  - name: redis\n    version: 1.0.0\n"},
+			{FilePath: "values.yaml", Content: valuesAnalysisValues},
+		},
+	}
+	for path, content := range templates {
+		c.Files = append(c.Files, types.File{FilePath: path, Content: content})
+	}
+	return c
+}
+
+func TestAnalyzeValuesUsage(t *testing.T) {
+	c := valuesAnalysisChart(map[string]string{
+		"templates/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+spec:
+  replicas: {{ .Values.replicaCount }}
+  template:
+    metadata:
+      annotations:
+        {{- toYaml .Values.podAnnotations.extra | nindent 8 }}
+    spec:
+      containers:
+        - image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"
+          imagePullPolicy: {{ index .Values "image" "pullPolicy" }}
+          resources:
+            {{- toYaml .Values.resources | nindent 12 }}
+          env:
+            - name: MISSING
+              value: {{ .Values.missing.key | quote }}
+`,
+		"templates/service.yaml": `{{- with .Values.service }}
+apiVersion: v1
+kind: Service
+spec:
+  type: {{ .type }}
+  ports:
+    - port: {{ .port }}
+      targetPort: {{ $.Values.image.containerPort }}
+{{- end }}
+`,
+		"templates/ingress.yaml": `{{- if .Values.ingress.enabled }}
+{{- range .Values.ingress.hosts }}
+host: {{ .host }}
+{{- end }}
+{{- end }}
+`,
+	})
+
+	analysis, err := AnalyzeValuesUsage(c)
+	require.NoError(t, err)
+
+	// legacy is reported once, not legacy.enabled and legacy.mode; global and the redis subchart values are ignored
+	assert.Equal(t, []string{"ingress.className", "legacy"}, analysis.UnusedKeys)
+
+	undefined := []string{}
+	for _, ref := range analysis.UndefinedKeys {
+		undefined = append(undefined, ref.Path)
+	}
+	// podAnnotations.extra is under an empty map, which users are expected to extend
+	assert.Equal(t, []string{"image.containerPort", "missing.key"}, undefined)
+	assert.Empty(t, analysis.Unknown)
+}
+
+func TestAnalyzeValuesUsageDynamicReferences(t *testing.T) {
+	c := valuesAnalysisChart(map[string]string{
+		"templates/configmap.yaml": `{{- $name := "mode" }}
+data:
+  mode: {{ index .Values.legacy $name }}
+  ingress: {{ index .Values "ingress" .Release.Name }}
+`,
+	})
+
+	analysis, err := AnalyzeValuesUsage(c)
+	require.NoError(t, err)
+
+	unknown := []string{}
+	for _, ref := range analysis.Unknown {
+		unknown = append(unknown, ref.Path)
+	}
+	assert.Equal(t, []string{"ingress", "legacy"}, unknown)
+
+	// keys under a dynamic reference are never reported as unused or undefined
+	assert.NotContains(t, analysis.UnusedKeys, "legacy")
+	assert.NotContains(t, analysis.UnusedKeys, "ingress.className")
+	assert.Contains(t, analysis.UnusedKeys, "replicaCount")
+	assert.Empty(t, analysis.UndefinedKeys)
+}
+
+func TestAnalyzeValuesUsageWholeValues(t *testing.T) {
+	c := valuesAnalysisChart(map[string]string{
+		"templates/secret.yaml": `data:
+  values: {{ toYaml .Values | b64enc }}
+`,
+	})
+
+	analysis, err := AnalyzeValuesUsage(c)
+	require.NoError(t, err)
+	assert.Empty(t, analysis.UnusedKeys)
+	require.Len(t, analysis.Unknown, 1)
+	assert.Equal(t, "", analysis.Unknown[0].Path)
+}
+
+func TestAnalyzeValuesUsageWithScopedLeafOnly(t *testing.T) {
+	c := valuesAnalysisChart(map[string]string{
+		"templates/service.yaml": `{{- with .Values.service }}
+port: {{ .port }}
+{{- end }}
+`,
+	})
+
+	analysis, err := AnalyzeValuesUsage(c)
+	require.NoError(t, err)
+	assert.Contains(t, analysis.UnusedKeys, "service.type")
+	assert.NotContains(t, analysis.UnusedKeys, "service")
+	assert.NotContains(t, analysis.UnusedKeys, "service.port")
+}
+
+func TestReferencedValues(t *testing.T) {
+	template := types.File{FilePath: "templates/deployment.yaml", Content: `replicas: {{ .Values.replicaCount }}
+image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default "latest" }}"
+{{- with .Values.image }}
+imagePullPolicy: {{ .pullPolicy }}
+{{- end }}
+annotations: {{ toYaml .Values.podAnnotations.extra }}
+{{- if .Values.ingress.enabled }}{{ .Values.ingress }}{{ end }}
+{{ .Values.missing.key }}`}
+
+	values, err := ReferencedValues(template, valuesAnalysisValues)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"replicaCount":   1,
+		"image":          map[string]interface{}{"repository": "nginx", "tag": "", "pullPolicy": "IfNotPresent"},
+		"podAnnotations": map[string]interface{}{},
+		"ingress":        map[string]interface{}{"enabled": false, "className": "", "hosts": []interface{}{}},
+	}, values, "keys under another key are left out, and so are keys values.yaml doesn't define")
+
+	_, err = ReferencedValues(template, "replicaCount: [")
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"github.com/tuvistavie/securerandom"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrValuesProfileNotFound is returned when a chart has no values profile with the given name
+var ErrValuesProfileNotFound = errors.New("values profile not found")
+
+// valuesProfileNameRegex matches the names of values profiles, such as dev or prod-eu
+var valuesProfileNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidateValuesProfile returns an error if name isn't a valid profile name or content isn't a
+// YAML mapping that helm can layer over values.yaml
+func ValidateValuesProfile(name string, content string) error {
+	if !valuesProfileNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use lowercase letters, numbers and dashes", name)
+	}
+
+	var values interface{}
+	if err := yaml.Unmarshal([]byte(content), &values); err != nil {
+		return fmt.Errorf("invalid profile content: %w", err)
+	}
+	if values == nil {
+		return nil
+	}
+	if _, ok := values.(map[string]interface{}); !ok {
+		return errors.New("invalid profile content: values must be a mapping")
+	}
+	return nil
+}
+
+// ValuesProfileFilename is the file name helm users conventionally give a profile, such as
+// values-prod.yaml
+func ValuesProfileFilename(name string) string {
+	return fmt.Sprintf("values-%s.yaml", name)
+}
+
+// ValuesProfileNameFromFilename is the inverse of ValuesProfileFilename. It only matches files at
+// the root of a chart.
+func ValuesProfileNameFromFilename(path string) (string, bool) {
+	if !strings.HasPrefix(path, "values-") || !strings.HasSuffix(path, ".yaml") {
+		return "", false
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(path, "values-"), ".yaml")
+	if !valuesProfileNameRegex.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// ListValuesProfiles returns the values profiles of a workspace ordered by chart and name. An empty
+// chartID lists the profiles of every chart.
+func ListValuesProfiles(ctx context.Context, workspaceID string, chartID string) ([]types.ValuesProfile, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT id, workspace_id, chart_id, name, content, created_at, updated_at
+		FROM workspace_values_profile
+		WHERE workspace_id = $1 AND ($2 = '' OR chart_id = $2)
+		ORDER BY chart_id, name`
+
+	rows, err := conn.Query(ctx, query, workspaceID, chartID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list values profiles: %w", err)
+	}
+	defer rows.Close()
+
+	profiles := []types.ValuesProfile{}
+	for rows.Next() {
+		var profile types.ValuesProfile
+		if err := rows.Scan(&profile.ID, &profile.WorkspaceID, &profile.ChartID, &profile.Name, &profile.Content, &profile.CreatedAt, &profile.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan values profile: %w", err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating values profiles: %w", err)
+	}
+
+	return profiles, nil
+}
+
+// GetValuesProfile returns the named values profile of a chart, or ErrValuesProfileNotFound
+func GetValuesProfile(ctx context.Context, workspaceID string, chartID string, name string) (*types.ValuesProfile, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `SELECT id, workspace_id, chart_id, name, content, created_at, updated_at
+		FROM workspace_values_profile
+		WHERE workspace_id = $1 AND chart_id = $2 AND name = $3`
+
+	var profile types.ValuesProfile
+	err := conn.QueryRow(ctx, query, workspaceID, chartID, name).Scan(&profile.ID, &profile.WorkspaceID, &profile.ChartID, &profile.Name, &profile.Content, &profile.CreatedAt, &profile.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrValuesProfileNotFound
+		}
+		return nil, fmt.Errorf("failed to get values profile: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// SetValuesProfile creates the named values profile of a chart, or replaces its content if it
+// already exists
+func SetValuesProfile(ctx context.Context, workspaceID string, chartID string, name string, content string) (*types.ValuesProfile, error) {
+	if err := ValidateValuesProfile(name, content); err != nil {
+		return nil, err
+	}
+
+	id, err := securerandom.Hex(12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate id: %w", err)
+	}
+
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	query := `INSERT INTO workspace_values_profile (id, workspace_id, chart_id, name, content, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, now(), now())
+		ON CONFLICT (workspace_id, chart_id, name) DO UPDATE SET content = EXCLUDED.content, updated_at = now()
+		RETURNING id, workspace_id, chart_id, name, content, created_at, updated_at`
+
+	var profile types.ValuesProfile
+	if err := conn.QueryRow(ctx, query, id, workspaceID, chartID, name, content).Scan(&profile.ID, &profile.WorkspaceID, &profile.ChartID, &profile.Name, &profile.Content, &profile.CreatedAt, &profile.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to set values profile: %w", err)
+	}
+
+	return &profile, nil
+}
+
+// DeleteValuesProfile deletes the named values profile of a chart. Deleting a profile that the
+// latest render of the workspace used is allowed, the deletion is recorded on that render so it's
+// clear the render can't be reproduced. It returns whether the latest render used the profile.
+func DeleteValuesProfile(ctx context.Context, workspaceID string, chartID string, name string) (bool, error) {
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM workspace_values_profile WHERE workspace_id = $1 AND chart_id = $2 AND name = $3`, workspaceID, chartID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete values profile: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, ErrValuesProfileNotFound
+	}
+
+	query := `UPDATE workspace_rendered SET values_profile_deleted_at = now()
+		WHERE id = (SELECT id FROM workspace_rendered WHERE workspace_id = $1 ORDER BY created_at DESC LIMIT 1)
+			AND values_profile = $2`
+	tag, err = tx.Exec(ctx, query, workspaceID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to record values profile deletion: %w", err)
+	}
+	referenced := tag.RowsAffected() > 0
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if referenced {
+		logger.Info("Deleted values profile used by the latest render",
+			zap.String("workspaceID", workspaceID),
+			zap.String("chartID", chartID),
+			zap.String("profile", name))
+	}
+
+	return referenced, nil
+}
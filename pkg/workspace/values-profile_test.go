@@ -0,0 +1,126 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateValuesProfile(t *testing.T) {
+	tests := []struct {
+		name        string
+		profileName string
+		content     string
+		wantErr     string
+	}{
+		{name: "nested values", profileName: "prod", content: "resources:\n  limits:\n    cpu: 500m\n"},
+		{name: "empty content", profileName: "dev", content: ""},
+		{name: "dashes and digits", profileName: "prod-eu-2", content: "replicaCount: 3\n"},
+		{name: "uppercase", profileName: "Prod", content: "replicaCount: 3\n", wantErr: "invalid profile name"},
+		{name: "path", profileName: "../prod", content: "replicaCount: 3\n", wantErr: "invalid profile name"},
+		{name: "trailing dash", profileName: "prod-", content: "replicaCount: 3\n", wantErr: "invalid profile name"},
+		{name: "list", profileName: "prod", content: "- replicaCount\n", wantErr: "values must be a mapping"},
+		{name: "scalar", profileName: "prod", content: "prod\n", wantErr: "values must be a mapping"},
+		{name: "invalid yaml", profileName: "prod", content: "image: [nginx\n", wantErr: "invalid profile content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateValuesProfile(tt.profileName, tt.content)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestValuesProfileNameFromFilename(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "values-prod.yaml", want: "prod", wantOK: true},
+		{path: ValuesProfileFilename("prod-eu"), want: "prod-eu", wantOK: true},
+		{path: "values.yaml"},
+		{path: "values-prod.yml"},
+		{path: "templates/values-prod.yaml"},
+		{path: "values-Prod.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := ValuesProfileNameFromFilename(tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestValuesProfileLifecycle creates, replaces and deletes a profile, and checks that deleting the
+// profile used by the latest render is recorded on that render. It runs against the database in
+// CHARTSMITH_TEST_PG_URI.
+func TestValuesProfileLifecycle(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping values profile integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+
+	workspaceID := "test-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_values_profile WHERE workspace_id = $1`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace_rendered WHERE workspace_id = $1`, workspaceID)
+	})
+
+	_, err := SetValuesProfile(ctx, workspaceID, "chart", "prod", "replicaCount: 2\n")
+	require.NoError(t, err)
+	updated, err := SetValuesProfile(ctx, workspaceID, "chart", "prod", "replicaCount: 3\n")
+	require.NoError(t, err)
+	assert.Equal(t, "replicaCount: 3\n", updated.Content)
+	_, err = SetValuesProfile(ctx, workspaceID, "chart", "dev", "debug: true\n")
+	require.NoError(t, err)
+
+	profiles, err := ListValuesProfiles(ctx, workspaceID, "chart")
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "dev", profiles[0].Name)
+	assert.Equal(t, "prod", profiles[1].Name)
+
+	_, err = conn.Exec(ctx, `INSERT INTO workspace_rendered (id, workspace_id, revision_number, created_at, values_profile) VALUES ($1, $2, 1, now(), 'prod')`, workspaceID+"-render", workspaceID)
+	require.NoError(t, err)
+
+	used, err := DeleteValuesProfile(ctx, workspaceID, "chart", "dev")
+	require.NoError(t, err)
+	assert.False(t, used)
+
+	used, err = DeleteValuesProfile(ctx, workspaceID, "chart", "prod")
+	require.NoError(t, err)
+	assert.True(t, used)
+
+	var deletedAt *time.Time
+	require.NoError(t, conn.QueryRow(ctx, `SELECT values_profile_deleted_at FROM workspace_rendered WHERE id = $1`, workspaceID+"-render").Scan(&deletedAt))
+	assert.NotNil(t, deletedAt)
+
+	_, err = GetValuesProfile(ctx, workspaceID, "chart", "prod")
+	assert.True(t, errors.Is(err, ErrValuesProfileNotFound))
+	_, err = DeleteValuesProfile(ctx, workspaceID, "chart", "prod")
+	assert.True(t, errors.Is(err, ErrValuesProfileNotFound))
+}
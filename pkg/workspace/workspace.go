@@ -2,15 +2,22 @@ package workspace
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/logger"
 	"github.com/replicatedhq/chartsmith/pkg/persistence"
 	"github.com/replicatedhq/chartsmith/pkg/workspace/types"
+	"go.uber.org/zap"
 )
 
+// ListUserIDsForWorkspace returns the creator of a workspace and its members, the users its
+// realtime events are sent to
 func ListUserIDsForWorkspace(ctx context.Context, workspaceID string) ([]string, error) {
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
@@ -20,20 +27,37 @@ func ListUserIDsForWorkspace(ctx context.Context, workspaceID string) ([]string,
 	FROM
 		workspace
 	WHERE
-		workspace.id = $1`
-
-	row := conn.QueryRow(ctx, query, workspaceID)
-	var userID string
-
-	err := row.Scan(
-		&userID,
-	)
+		workspace.id = $1
+	UNION
+	SELECT
+		workspace_member.user_id
+	FROM
+		workspace_member
+	WHERE
+		workspace_member.workspace_id = $1`
 
+	rows, err := conn.Query(ctx, query, workspaceID)
 	if err != nil {
-		return nil, fmt.Errorf("error scanning user ID: %w", err)
+		return nil, fmt.Errorf("error querying user IDs: %w", err)
+	}
+	defer rows.Close()
+
+	userIDs := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("error scanning user ID: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user IDs: %w", err)
+	}
+	if len(userIDs) == 0 {
+		return nil, ErrWorkspaceNotFound
 	}
 
-	return []string{userID}, nil
+	return userIDs, nil
 }
 
 func SetChatMessageResponse(ctx context.Context, chatMessageID string, response string) error {
@@ -69,7 +93,16 @@ func GetWorkspace(ctx context.Context, id string) (*types.Workspace, error) {
 		workspace.created_at,
 		workspace.last_updated_at,
 		workspace.name,
-		workspace.current_revision_number
+		workspace.current_revision_number,
+		COALESCE(workspace.bootstrap_template, ''),
+		COALESCE((SELECT (value)::boolean FROM workspace_settings WHERE workspace_id = workspace.id AND key = 'auto_generate_readme'), workspace.auto_generate_readme, false),
+		workspace.source_url,
+		COALESCE(workspace.source_ref, ''),
+		COALESCE(workspace.source_subdirectory, ''),
+		COALESCE(workspace.source_commit_sha, ''),
+		workspace.archived_at,
+		workspace.import_progress,
+		workspace.import_report
 	FROM
 		workspace
 	WHERE
@@ -77,18 +110,47 @@ func GetWorkspace(ctx context.Context, id string) (*types.Workspace, error) {
 
 	row := conn.QueryRow(ctx, query, id)
 	var workspace types.Workspace
+	var sourceURL sql.NullString
+	var source types.WorkspaceSource
+	var importProgress []byte
+	var importReport []byte
 	err := row.Scan(
 		&workspace.ID,
 		&workspace.CreatedAt,
 		&workspace.LastUpdatedAt,
 		&workspace.Name,
 		&workspace.CurrentRevision,
+		&workspace.BootstrapTemplate,
+		&workspace.AutoGenerateReadme,
+		&sourceURL,
+		&source.Ref,
+		&source.Subdirectory,
+		&source.CommitSHA,
+		&workspace.ArchivedAt,
+		&importProgress,
+		&importReport,
 	)
 
 	if err != nil {
 		return nil, fmt.Errorf("error scanning workspace: %w", err)
 	}
 
+	if importProgress != nil {
+		if err := json.Unmarshal(importProgress, &workspace.Import); err != nil {
+			return nil, fmt.Errorf("error unmarshaling import progress: %w", err)
+		}
+	}
+	if importReport != nil {
+		if err := json.Unmarshal(importReport, &workspace.ImportReport); err != nil {
+			return nil, fmt.Errorf("error unmarshaling import report: %w", err)
+		}
+	}
+
+	if sourceURL.Valid {
+		source.URL = sourceURL.String
+		workspace.Source = &source
+	}
+
 	charts, err := listChartsForWorkspace(ctx, id, workspace.CurrentRevision)
 	if err != nil {
 		return nil, fmt.Errorf("error listing charts for workspace: %w", err)
@@ -226,7 +288,8 @@ func listFilesForChart(ctx context.Context, chartID string, revisionNumber int)
 		workspace_id,
 		file_path,
 		content,
-		content_pending
+		content_pending,
+		COALESCE(line_ending, '')
 	FROM
 		workspace_file
 	WHERE
@@ -254,6 +317,7 @@ func listFilesForChart(ctx context.Context, chartID string, revisionNumber int)
 			&file.FilePath,
 			&file.Content,
 			&contentPending,
+			&file.LineEnding,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning file: %w", err)
@@ -377,6 +441,15 @@ func SetCurrentRevision(ctx context.Context, tx pgx.Tx, workspace *types.Workspa
 	return GetWorkspace(ctx, workspace.ID)
 }
 
+// SetAutoGenerateReadme turns refreshing README.md after a plan changes values.yaml on or off
+func SetAutoGenerateReadme(ctx context.Context, workspaceID string, enabled bool) error {
+	if err := SetSetting(ctx, workspaceID, SettingAutoGenerateReadme, enabled); err != nil {
+		return fmt.Errorf("error updating auto generate readme: %w", err)
+	}
+
+	return nil
+}
+
 func SetChartName(ctx context.Context, tx pgx.Tx, workspaceID string, chartID string, name string, revisionNumber int) error {
 	query := `UPDATE workspace_chart SET name = $1 WHERE id = $2 AND workspace_id = $3 AND revision_number = $4`
 	_, err := tx.Exec(ctx, query, name, chartID, workspaceID, revisionNumber)
@@ -386,13 +459,58 @@ func SetChartName(ctx context.Context, tx pgx.Tx, workspaceID string, chartID st
 	return nil
 }
 
+// enqueueSummarize queues a file to be summarized and embedded, it's a var so tests can count the
+// files that would be
+var enqueueSummarize = func(ctx context.Context, payload map[string]interface{}) error {
+	return persistence.EnqueueWork(ctx, "new_summarize", payload)
+}
+
+// NotifyWorkerToCaptureEmbeddings queues the files of a revision that don't have embeddings from
+// the configured provider. Files whose content is unchanged from an earlier revision get that
+// revision's embeddings instead, if they're from the same provider. The files that are queued get
+// their summaries from llm_summary_cache when the same content was summarized by the same model
+// before. Nothing is queued for an archived workspace.
 func NotifyWorkerToCaptureEmbeddings(ctx context.Context, workspaceID string, revisionNumber int) error {
+	provider, err := embedding.Configured()
+	if err != nil {
+		return fmt.Errorf("failed to get embedding provider: %w", err)
+	}
+
 	conn := persistence.MustGetPooledPostgresSession()
 	defer conn.Release()
 
+	if err := ensureNotArchived(ctx, conn, workspaceID); err != nil {
+		return fmt.Errorf("failed to enqueue summaries: %w", err)
+	}
+
+	query := `UPDATE workspace_file f
+	SET embeddings = previous.embeddings, embeddings_provider = $3, embeddings_dimensions = previous.embeddings_dimensions
+	FROM (
+		SELECT DISTINCT ON (id) id, content_sha, embeddings, embeddings_dimensions
+		FROM workspace_file
+		WHERE workspace_id = $1 AND revision_number < $2 AND embeddings IS NOT NULL AND content_sha IS NOT NULL
+			AND COALESCE(embeddings_provider, $4) = $3
+		ORDER BY id, revision_number DESC
+	) previous
+	WHERE
+		f.workspace_id = $1 AND f.revision_number = $2
+		AND (f.embeddings IS NULL OR COALESCE(f.embeddings_provider, $4) <> $3)
+		AND f.id = previous.id AND f.content_sha = previous.content_sha`
+
+	tag, err := conn.Exec(ctx, query, workspaceID, revisionNumber, provider.Name(), embedding.LegacyProvider)
+	if err != nil {
+		return fmt.Errorf("error copying embeddings of unchanged files: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		logger.Debug("Copied embeddings of unchanged files",
+			zap.String("workspaceID", workspaceID),
+			zap.Int("revisionNumber", revisionNumber),
+			zap.Int64("files", tag.RowsAffected()))
+	}
+
 	filesNeedingEmbeddings := []types.File{}
 
-	query := `SELECT
+	query = `SELECT
 		id,
 		revision_number,
 		chart_id,
@@ -402,9 +520,10 @@ func NotifyWorkerToCaptureEmbeddings(ctx context.Context, workspaceID string, re
 	FROM
 		workspace_file
 	WHERE
-		workspace_id = $1 AND revision_number = $2 AND embeddings IS NULL`
+		workspace_id = $1 AND revision_number = $2
+		AND (embeddings IS NULL OR COALESCE(embeddings_provider, $4) <> $3)`
 
-	rows, err := conn.Query(ctx, query, workspaceID, revisionNumber)
+	rows, err := conn.Query(ctx, query, workspaceID, revisionNumber, provider.Name(), embedding.LegacyProvider)
 	if err != nil {
 		return fmt.Errorf("error scanning files needing summaries and embeddings: %w", err)
 	}
@@ -429,10 +548,16 @@ func NotifyWorkerToCaptureEmbeddings(ctx context.Context, workspaceID string, re
 			"revision": file.RevisionNumber,
 		}
 
-		if err := persistence.EnqueueWork(ctx, "new_summarize", p); err != nil {
+		if err := enqueueSummarize(ctx, p); err != nil {
 			return fmt.Errorf("error enqueuing work: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// contentSHA is the hash stored in workspace_file.content_sha, the same hex sha256 that keys
+// content_cache
+func contentSHA(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
@@ -0,0 +1,91 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/replicatedhq/chartsmith/pkg/embedding"
+	"github.com/replicatedhq/chartsmith/pkg/persistence"
+	"github.com/replicatedhq/chartsmith/pkg/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNotifyWorkerToCaptureEmbeddingsSkipsUnchangedFiles creates a revision where only one of ten
+// files changed and checks that only that file is summarized again. It runs against the database
+// in CHARTSMITH_TEST_PG_URI.
+func TestNotifyWorkerToCaptureEmbeddingsSkipsUnchangedFiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	connStr := os.Getenv("CHARTSMITH_TEST_PG_URI")
+	if connStr == "" {
+		t.Skip("CHARTSMITH_TEST_PG_URI not set, skipping embeddings integration test")
+	}
+	require.NoError(t, persistence.InitPostgres(persistence.PostgresOpts{URI: connStr}))
+
+	ctx := context.Background()
+	conn := persistence.MustGetPooledPostgresSession()
+	defer conn.Release()
+
+	require.NoError(t, testhelpers.ApplySchema(ctx, conn))
+	stubEmbeddingProvider(t, embedding.LegacyProvider)
+
+	workspaceID := "test-" + time.Now().Format("150405.000000")
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DELETE FROM workspace_file WHERE workspace_id = $1`, workspaceID)
+		conn.Exec(context.Background(), `DELETE FROM workspace WHERE id = $1`, workspaceID)
+	})
+
+	// capturing embeddings checks that the workspace isn't archived
+	_, err := conn.Exec(ctx, `INSERT INTO workspace (id, created_at, name, created_by_user_id, created_type, current_revision_number)
+		VALUES ($1, now(), 'embeddings', 'user', 'test', 2)`, workspaceID)
+	require.NoError(t, err)
+
+	embeddings := "[" + strings.TrimSuffix(strings.Repeat("0.5,", 1024), ",") + "]"
+	insert := `INSERT INTO workspace_file (id, revision_number, chart_id, workspace_id, file_path, content, content_sha, embeddings)
+		VALUES ($1, $2, 'chart', $3, $4, $5, $6, $7)`
+
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("%s-file-%d", workspaceID, i)
+		path := fmt.Sprintf("templates/file-%d.yaml", i)
+		content := fmt.Sprintf("kind: ConfigMap\nname: file-%d\n", i)
+		_, err := conn.Exec(ctx, insert, id, 1, workspaceID, path, content, contentSHA(content), embeddings)
+		require.NoError(t, err)
+
+		// the new revision starts without embeddings, and the last file is changed
+		if i == 9 {
+			content += "data: {}\n"
+		}
+		_, err = conn.Exec(ctx, insert, id, 2, workspaceID, path, content, contentSHA(content), nil)
+		require.NoError(t, err)
+	}
+
+	enqueued := []map[string]interface{}{}
+	original := enqueueSummarize
+	enqueueSummarize = func(ctx context.Context, payload map[string]interface{}) error {
+		enqueued = append(enqueued, payload)
+		return nil
+	}
+	t.Cleanup(func() { enqueueSummarize = original })
+
+	require.NoError(t, NotifyWorkerToCaptureEmbeddings(ctx, workspaceID, 2))
+
+	require.Len(t, enqueued, 1)
+	assert.Equal(t, workspaceID+"-file-9", enqueued[0]["fileId"])
+	assert.Equal(t, 2, enqueued[0]["revision"])
+
+	var withEmbeddings int
+	err = conn.QueryRow(ctx, `SELECT COUNT(*) FROM workspace_file WHERE workspace_id = $1 AND revision_number = 2 AND embeddings IS NOT NULL`, workspaceID).Scan(&withEmbeddings)
+	require.NoError(t, err)
+	assert.Equal(t, 9, withEmbeddings)
+}
+
+func TestContentSHA(t *testing.T) {
+	// the same as encode(sha256(convert_to('replicaCount: 1', 'UTF8')), 'hex'), which the app uses
+	assert.Equal(t, "75a7f59a15f92e0e45135036b5c80971b5daea9d8de64ffb34b7ff10ef5a7e18", contentSHA("replicaCount: 1"))
+}
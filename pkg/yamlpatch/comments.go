@@ -0,0 +1,103 @@
+package yamlpatch
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RestoreHeadComments puts back the comments above keys that an edit of a document dropped. A
+// comment is restored on a key that's at the same path in both documents, with the same value,
+// when the edited key has no comment and the edited document doesn't have the comment elsewhere.
+// It returns the edited document and how many comments it restored. The edited document is only
+// encoded again when a comment is restored, otherwise it's returned as it was.
+func RestoreHeadComments(original string, edited string) (string, int, error) {
+	originalRoot, err := mappingRoot(original)
+	if err != nil {
+		return edited, 0, fmt.Errorf("failed to parse original document: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(edited), &doc); err != nil {
+		return edited, 0, fmt.Errorf("failed to parse edited document: %w", err)
+	}
+	if originalRoot == nil || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return edited, 0, nil
+	}
+
+	restored, err := restoreMappingComments(originalRoot, doc.Content[0], edited)
+	if err != nil {
+		return edited, 0, err
+	}
+	if restored == 0 {
+		return edited, 0, nil
+	}
+
+	encoded, err := encode(&doc, edited)
+	if err != nil {
+		return edited, 0, err
+	}
+	return encoded, restored, nil
+}
+
+// mappingRoot returns the root of a document when it's a map, or nil
+func mappingRoot(content string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// restoreMappingComments restores the head comments of the keys of edited from original, and of
+// the keys of the maps under them
+func restoreMappingComments(original *yaml.Node, edited *yaml.Node, editedContent string) (int, error) {
+	restored := 0
+	for i := 0; i+1 < len(edited.Content); i += 2 {
+		key, value := edited.Content[i], edited.Content[i+1]
+		at := mappingKeyIndex(original, key.Value)
+		if at < 0 {
+			continue
+		}
+		originalKey, originalValue := original.Content[at], original.Content[at+1]
+
+		if originalValue.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			n, err := restoreMappingComments(originalValue, value, editedContent)
+			if err != nil {
+				return restored, err
+			}
+			restored += n
+		}
+
+		if originalKey.HeadComment == "" || key.HeadComment != "" || strings.Contains(editedContent, originalKey.HeadComment) {
+			continue
+		}
+		same, err := sameValue(originalValue, value)
+		if err != nil {
+			return restored, err
+		}
+		if same {
+			key.HeadComment = originalKey.HeadComment
+			restored++
+		}
+	}
+	return restored, nil
+}
+
+// sameValue reports whether two nodes decode to the same value, regardless of their style and
+// comments
+func sameValue(a *yaml.Node, b *yaml.Node) (bool, error) {
+	var aValue, bValue interface{}
+	if err := a.Decode(&aValue); err != nil {
+		return false, fmt.Errorf("failed to decode value: %w", err)
+	}
+	if err := b.Decode(&bValue); err != nil {
+		return false, fmt.Errorf("failed to decode value: %w", err)
+	}
+	return reflect.DeepEqual(aValue, bValue), nil
+}
@@ -0,0 +1,99 @@
+package yamlpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreHeadComments(t *testing.T) {
+	tests := []struct {
+		name         string
+		original     string
+		edited       string
+		want         string
+		wantRestored int
+	}{
+		{
+			name:         "unchanged key",
+			original:     "# how many pods\nreplicaCount: 1\nimage: nginx\n",
+			edited:       "replicaCount: 1\nimage: httpd\n",
+			want:         "# how many pods\nreplicaCount: 1\nimage: httpd\n",
+			wantRestored: 1,
+		},
+		{
+			name:     "changed value",
+			original: "# how many pods\nreplicaCount: 1\n",
+			edited:   "replicaCount: 2\n",
+			want:     "replicaCount: 2\n",
+		},
+		{
+			name:         "nested key of a changed map",
+			original:     "image:\n    # the tag defaults to the appVersion\n    tag: \"\"\n    repository: nginx\n",
+			edited:       "image:\n    tag: \"\"\n    repository: httpd\n",
+			want:         "image:\n    # the tag defaults to the appVersion\n    tag: \"\"\n    repository: httpd\n",
+			wantRestored: 1,
+		},
+		{
+			name:         "same value in another style",
+			original:     "# the ports\nports: [80, 443]\n",
+			edited:       "ports:\n  - 80\n  - 443\n",
+			want:         "# the ports\nports:\n  - 80\n  - 443\n",
+			wantRestored: 1,
+		},
+		{
+			name:     "comment replaced",
+			original: "# how many pods\nreplicaCount: 1\n",
+			edited:   "# pods to run\nreplicaCount: 1\n",
+			want:     "# pods to run\nreplicaCount: 1\n",
+		},
+		{
+			name:     "comment moved",
+			original: "# how many pods\nreplicaCount: 1\nimage: nginx\n",
+			edited:   "replicaCount: 1\n# how many pods\nimage: nginx\n",
+			want:     "replicaCount: 1\n# how many pods\nimage: nginx\n",
+		},
+		{
+			name:     "key removed",
+			original: "# how many pods\nreplicaCount: 1\nimage: nginx\n",
+			edited:   "image: nginx\n",
+			want:     "image: nginx\n",
+		},
+		{
+			name:         "blank lines between sections",
+			original:     "# how many pods\nreplicaCount: 1\n\n# the image\nimage: nginx\n",
+			edited:       "replicaCount: 1\n\nimage: nginx\n",
+			want:         "# how many pods\nreplicaCount: 1\n\n# the image\nimage: nginx\n",
+			wantRestored: 2,
+		},
+		{
+			name:         "comment at the top of the document",
+			original:     "# Default values for web.\n\n# how many pods\nreplicaCount: 1\n",
+			edited:       "# Default values for web.\n\nreplicaCount: 1\n",
+			want:         "# Default values for web.\n\n# how many pods\nreplicaCount: 1\n",
+			wantRestored: 1,
+		},
+		{
+			name:     "list root",
+			original: "# first\n- a\n",
+			edited:   "- a\n",
+			want:     "- a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, restored, err := RestoreHeadComments(tt.original, tt.edited)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantRestored, restored)
+		})
+	}
+}
+
+func TestRestoreHeadCommentsInvalid(t *testing.T) {
+	got, restored, err := RestoreHeadComments("# how many pods\nreplicaCount: 1\n", "replicaCount: [1\n")
+	assert.Error(t, err)
+	assert.Equal(t, "replicaCount: [1\n", got)
+	assert.Zero(t, restored)
+}
@@ -0,0 +1,127 @@
+package yamlpatch
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DigestOpts is how much of a document Digest describes
+type DigestOpts struct {
+	// Depth is how many levels of keys are listed, deeper mappings and sequences are only counted
+	Depth int
+	// PreviewLength is the most characters of a scalar value that are shown
+	PreviewLength int
+	// Verbatim are top level keys whose section is copied from the document as it is
+	Verbatim []string
+}
+
+// Digest describes the structure of a YAML document in less space than the document: each key to
+// opts.Depth with the type of its value and a short preview of scalars, one per line and indented
+// like the document. The sections of the top level keys in opts.Verbatim are copied instead, with
+// their comments. A document that isn't a mapping is an error.
+func Digest(content string, opts DigestOpts) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse document: %w", err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("document is not a mapping")
+	}
+	root := doc.Content[0]
+
+	verbatim := map[string]bool{}
+	for _, key := range opts.Verbatim {
+		verbatim[key] = true
+	}
+	lines := strings.Split(content, "\n")
+
+	var sb strings.Builder
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if verbatim[key.Value] {
+			end := len(lines)
+			if i+2 < len(root.Content) {
+				end = root.Content[i+2].Line - 1
+			}
+			sb.WriteString(verbatimSection(lines, key.Line-1, end))
+			continue
+		}
+		writeDigest(&sb, key.Value, value, 0, opts)
+	}
+
+	return sb.String(), nil
+}
+
+// verbatimSection returns lines[start:end], without the blank and comment lines at its end, which
+// belong to the next key
+func verbatimSection(lines []string, start int, end int) string {
+	for end > start+1 {
+		trimmed := strings.TrimSpace(lines[end-1])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		end--
+	}
+	return strings.Join(lines[start:end], "\n") + "\n"
+}
+
+func writeDigest(sb *strings.Builder, key string, value *yaml.Node, level int, opts DigestOpts) {
+	indent := strings.Repeat("  ", level)
+	if value.Kind == yaml.AliasNode && value.Alias != nil {
+		value = value.Alias
+	}
+
+	switch value.Kind {
+	case yaml.MappingNode:
+		fmt.Fprintf(sb, "%s%s: map (%s)\n", indent, key, pluralize(len(value.Content)/2, "key", "keys"))
+		if level+1 >= opts.Depth {
+			return
+		}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			writeDigest(sb, value.Content[i].Value, value.Content[i+1], level+1, opts)
+		}
+	case yaml.SequenceNode:
+		fmt.Fprintf(sb, "%s%s: list (%s)\n", indent, key, pluralize(len(value.Content), "item", "items"))
+	default:
+		fmt.Fprintf(sb, "%s%s: %s%s\n", indent, key, scalarType(value), scalarPreview(value, opts.PreviewLength))
+	}
+}
+
+// scalarType names the type of a scalar the way it'd be described in values documentation
+func scalarType(value *yaml.Node) string {
+	switch value.ShortTag() {
+	case "!!int":
+		return "int"
+	case "!!float":
+		return "float"
+	case "!!bool":
+		return "bool"
+	case "!!null":
+		return "null"
+	default:
+		return "string"
+	}
+}
+
+func scalarPreview(value *yaml.Node, maxLength int) string {
+	if value.ShortTag() == "!!null" {
+		return ""
+	}
+	preview := value.Value
+	if runes := []rune(preview); maxLength > 0 && len(runes) > maxLength {
+		preview = string(runes[:maxLength]) + "…"
+	}
+	if value.ShortTag() == "!!str" {
+		return fmt.Sprintf(" = %q", preview)
+	}
+	return " = " + preview
+}
+
+func pluralize(n int, singular string, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
@@ -0,0 +1,124 @@
+package yamlpatch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const digestValues = `# how many pods
+replicaCount: 2
+image:
+  repository: nginx
+  tag: ""
+  pullPolicy: IfNotPresent
+ingress-nginx:
+  enabled: true
+  controller:
+    image:
+      registry: docker.io
+      tag: 1.29.0-rc.2
+    config:
+      log-format-upstream: '{"time": "$time_iso8601", "remote_addr": "$remote_addr"}'
+    extraArgs: {}
+    tolerations:
+      - key: dedicated
+      - key: gpu
+
+# pods are scheduled anywhere by default
+nodeSelector:
+resources:
+  limits:
+    cpu: 0.5
+`
+
+func TestDigest(t *testing.T) {
+	tests := []struct {
+		name string
+		opts DigestOpts
+		want string
+	}{
+		{
+			name: "depth 3",
+			opts: DigestOpts{Depth: 3, PreviewLength: 20},
+			want: `replicaCount: int = 2
+image: map (3 keys)
+  repository: string = "nginx"
+  tag: string = ""
+  pullPolicy: string = "IfNotPresent"
+ingress-nginx: map (2 keys)
+  enabled: bool = true
+  controller: map (4 keys)
+    image: map (2 keys)
+    config: map (1 key)
+    extraArgs: map (0 keys)
+    tolerations: list (2 items)
+nodeSelector: null
+resources: map (1 key)
+  limits: map (1 key)
+    cpu: float = 0.5
+`,
+		},
+		{
+			name: "depth 1",
+			opts: DigestOpts{Depth: 1},
+			want: `replicaCount: int = 2
+image: map (3 keys)
+ingress-nginx: map (2 keys)
+nodeSelector: null
+resources: map (1 key)
+`,
+		},
+		{
+			name: "verbatim section",
+			opts: DigestOpts{Depth: 2, PreviewLength: 20, Verbatim: []string{"ingress-nginx", "missing"}},
+			want: `replicaCount: int = 2
+image: map (3 keys)
+  repository: string = "nginx"
+  tag: string = ""
+  pullPolicy: string = "IfNotPresent"
+ingress-nginx:
+  enabled: true
+  controller:
+    image:
+      registry: docker.io
+      tag: 1.29.0-rc.2
+    config:
+      log-format-upstream: '{"time": "$time_iso8601", "remote_addr": "$remote_addr"}'
+    extraArgs: {}
+    tolerations:
+      - key: dedicated
+      - key: gpu
+nodeSelector: null
+resources: map (1 key)
+  limits: map (1 key)
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, err := Digest(digestValues, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, digest)
+		})
+	}
+}
+
+func TestDigestPreviews(t *testing.T) {
+	digest, err := Digest("motd: |\n  hello\n  world\nlong: "+strings.Repeat("é", 50)+"\n", DigestOpts{Depth: 3, PreviewLength: 12})
+	require.NoError(t, err)
+	assert.Equal(t, `motd: string = "hello\nworld\n"
+long: string = "éééééééééééé…"
+`, digest)
+}
+
+func TestDigestErrors(t *testing.T) {
+	_, err := Digest("- a\n- b\n", DigestOpts{Depth: 3})
+	assert.Error(t, err)
+
+	_, err = Digest("key: [unclosed\n", DigestOpts{Depth: 3})
+	assert.Error(t, err)
+}
@@ -0,0 +1,430 @@
+// Package yamlpatch applies structured edits to a YAML document, such as a chart's values.yaml.
+// The document is edited as a YAML node tree rather than as text, so an edit can't produce
+// invalid YAML, and comments and the order of keys are kept.
+package yamlpatch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The operations of a patch
+const (
+	// OpSet sets the value at a path, creating the maps on the way to it that don't exist
+	OpSet = "set"
+	// OpDelete removes the key or list item at a path
+	OpDelete = "delete"
+	// OpAppend adds a value to the end of the list at a path, creating the list if there's none
+	OpAppend = "append"
+)
+
+var (
+	// ErrInvalidOperation is returned for an operation that isn't set, delete or append, or has
+	// no path
+	ErrInvalidOperation = errors.New("invalid operation")
+	// ErrInvalidPath is returned for a path that can't be parsed
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrPathNotFound is returned when a path doesn't lead to a value that the operation needs
+	ErrPathNotFound = errors.New("path not found")
+)
+
+// Operation is one edit of a patch. Path is a dotted path of map keys and list indexes, such as
+// ingress.hosts.0.host. A dot that's part of a key is escaped with a backslash, such as
+// podAnnotations.prometheus\.io/scrape.
+type Operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Apply applies the operations to a YAML document in order and returns the new document. An
+// empty document is treated as an empty map. If an operation fails, none are applied.
+func Apply(content string, operations []Operation) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return "", fmt.Errorf("failed to parse document: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if len(doc.Content) != 1 {
+		return "", errors.New("document must have a single root")
+	}
+
+	root := doc.Content[0]
+	if isNull(root) {
+		toCollection(root, yaml.MappingNode)
+	}
+	if root.Kind != yaml.MappingNode {
+		return "", errors.New("document root must be a map")
+	}
+
+	for i, operation := range operations {
+		if err := apply(root, operation); err != nil {
+			return "", fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+
+	return encode(&doc, content)
+}
+
+// encode writes doc with the indentation and the blank lines between top level keys of content,
+// the document it was parsed from
+func encode(doc *yaml.Node, content string) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(detectIndent(content))
+	if err := encoder.Encode(doc); err != nil {
+		return "", fmt.Errorf("failed to encode document: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode document: %w", err)
+	}
+	return restoreBlankLines(content, buf.String()), nil
+}
+
+// ParsePath splits a dotted path into its segments, unescaping dots and backslashes
+func ParsePath(path string) ([]string, error) {
+	segments := []string{}
+	var current strings.Builder
+	escaped := false
+	for _, r := range path {
+		switch {
+		case escaped:
+			if r != '.' && r != '\\' {
+				return nil, fmt.Errorf("%w: %q: only dots and backslashes can be escaped", ErrInvalidPath, path)
+			}
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("%w: %q ends with a backslash", ErrInvalidPath, path)
+	}
+	segments = append(segments, current.String())
+
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("%w: %q has an empty key", ErrInvalidPath, path)
+		}
+	}
+	return segments, nil
+}
+
+func apply(root *yaml.Node, operation Operation) error {
+	if strings.TrimSpace(operation.Path) == "" {
+		return fmt.Errorf("%w: path is required", ErrInvalidOperation)
+	}
+	path, err := ParsePath(operation.Path)
+	if err != nil {
+		return err
+	}
+
+	switch operation.Op {
+	case OpSet:
+		value, err := valueNode(operation.Value)
+		if err != nil {
+			return err
+		}
+		return set(root, path, value)
+	case OpDelete:
+		return remove(root, path)
+	case OpAppend:
+		value, err := valueNode(operation.Value)
+		if err != nil {
+			return err
+		}
+		return appendTo(root, path, value)
+	default:
+		return fmt.Errorf("%w: op must be %s, %s or %s", ErrInvalidOperation, OpSet, OpDelete, OpAppend)
+	}
+}
+
+func set(root *yaml.Node, path []string, value *yaml.Node) error {
+	parent, err := walk(root, path[:len(path)-1], true)
+	if err != nil {
+		return err
+	}
+	key := path[len(path)-1]
+
+	switch parent.Kind {
+	case yaml.MappingNode:
+		if i := mappingKeyIndex(parent, key); i >= 0 {
+			replace(parent.Content[i+1], value)
+			return nil
+		}
+		addMappingEntry(parent, key, value)
+		return nil
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(parent, key)
+		if err != nil {
+			return err
+		}
+		replace(parent.Content[i], value)
+		return nil
+	default:
+		return notCollection(path[:len(path)-1])
+	}
+}
+
+func remove(root *yaml.Node, path []string) error {
+	parent, err := walk(root, path[:len(path)-1], false)
+	if err != nil {
+		return err
+	}
+	key := path[len(path)-1]
+
+	switch parent.Kind {
+	case yaml.MappingNode:
+		i := mappingKeyIndex(parent, key)
+		if i < 0 {
+			return fmt.Errorf("%w: %s", ErrPathNotFound, joinPath(path))
+		}
+		parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+		return nil
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(parent, key)
+		if err != nil {
+			return err
+		}
+		parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+		return nil
+	default:
+		return notCollection(path[:len(path)-1])
+	}
+}
+
+func appendTo(root *yaml.Node, path []string, value *yaml.Node) error {
+	parent, err := walk(root, path[:len(path)-1], true)
+	if err != nil {
+		return err
+	}
+	key := path[len(path)-1]
+
+	var list *yaml.Node
+	switch parent.Kind {
+	case yaml.MappingNode:
+		i := mappingKeyIndex(parent, key)
+		if i < 0 {
+			addMappingEntry(parent, key, &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{value}})
+			return nil
+		}
+		list = parent.Content[i+1]
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(parent, key)
+		if err != nil {
+			return err
+		}
+		list = parent.Content[i]
+	default:
+		return notCollection(path[:len(path)-1])
+	}
+
+	if isNull(list) {
+		toCollection(list, yaml.SequenceNode)
+	}
+	if list.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%w: %s is not a list", ErrPathNotFound, joinPath(path))
+	}
+	if len(list.Content) == 0 {
+		// an empty flow list, [], becomes a block list
+		list.Style = 0
+	}
+	list.Content = append(list.Content, value)
+	return nil
+}
+
+// walk follows path from node and returns the map or list it leads to. With create, missing keys
+// and null values on the way become maps.
+func walk(node *yaml.Node, path []string, create bool) (*yaml.Node, error) {
+	for depth, segment := range path {
+		switch node.Kind {
+		case yaml.MappingNode:
+			i := mappingKeyIndex(node, segment)
+			if i < 0 {
+				if !create {
+					return nil, fmt.Errorf("%w: %s", ErrPathNotFound, joinPath(path[:depth+1]))
+				}
+				child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				addMappingEntry(node, segment, child)
+				node = child
+				continue
+			}
+			node = node.Content[i+1]
+		case yaml.SequenceNode:
+			i, err := sequenceIndex(node, segment)
+			if err != nil {
+				return nil, err
+			}
+			node = node.Content[i]
+		default:
+			return nil, notCollection(path[:depth])
+		}
+
+		if node.Kind == yaml.AliasNode {
+			return nil, fmt.Errorf("%w: %s is an alias, change the anchor it refers to instead", ErrPathNotFound, joinPath(path[:depth+1]))
+		}
+		if create && isNull(node) {
+			toCollection(node, yaml.MappingNode)
+		}
+	}
+	return node, nil
+}
+
+// valueNode encodes a value of an operation as a YAML node
+func valueNode(value interface{}) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return nil, fmt.Errorf("%w: failed to encode value: %v", ErrInvalidOperation, err)
+	}
+	return &node, nil
+}
+
+// replace replaces a value with another, keeping the comments of the value it replaces
+func replace(old *yaml.Node, value *yaml.Node) {
+	value.HeadComment = old.HeadComment
+	value.FootComment = old.FootComment
+	if value.Kind == yaml.ScalarNode {
+		value.LineComment = old.LineComment
+	}
+	*old = *value
+}
+
+func addMappingEntry(mapping *yaml.Node, key string, value *yaml.Node) {
+	if len(mapping.Content) == 0 {
+		// an empty flow map, {}, becomes a block map
+		mapping.Style = 0
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func mappingKeyIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func sequenceIndex(sequence *yaml.Node, segment string) (int, error) {
+	i, err := strconv.Atoi(segment)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not an index of a list", ErrInvalidPath, segment)
+	}
+	if i < 0 || i >= len(sequence.Content) {
+		return 0, fmt.Errorf("%w: index %d of a list of %d items", ErrPathNotFound, i, len(sequence.Content))
+	}
+	return i, nil
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null"
+}
+
+// toCollection turns a null value into an empty map or list, keeping its comments
+func toCollection(node *yaml.Node, kind yaml.Kind) {
+	node.Kind = kind
+	node.Value = ""
+	node.Style = 0
+	node.Tag = "!!map"
+	if kind == yaml.SequenceNode {
+		node.Tag = "!!seq"
+	}
+}
+
+func notCollection(path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("%w: the document root is not a map", ErrPathNotFound)
+	}
+	return fmt.Errorf("%w: %s is not a map or a list", ErrPathNotFound, joinPath(path))
+}
+
+// joinPath is the inverse of ParsePath
+func joinPath(path []string) string {
+	escaped := make([]string, len(path))
+	for i, segment := range path {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(segment, `\`, `\\`), ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
+
+// restoreBlankLines puts back the blank lines that separated top level keys in the original
+// document, the encoder drops them. A values.yaml is usually split into sections this way.
+func restoreBlankLines(original string, encoded string) string {
+	separated := map[string]bool{}
+	lines := strings.Split(original, "\n")
+	for i, line := range lines {
+		key, ok := topLevelKey(line)
+		if !ok {
+			continue
+		}
+		// the blank line goes before the comments of the key
+		j := i - 1
+		for j >= 0 && strings.HasPrefix(lines[j], "#") {
+			j--
+		}
+		if j >= 0 && strings.TrimSpace(lines[j]) == "" {
+			separated[key] = true
+		}
+	}
+	if len(separated) == 0 {
+		return encoded
+	}
+
+	lines = strings.Split(encoded, "\n")
+	restored := make([]string, 0, len(lines)+len(separated))
+	comments := 0
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			comments++
+		} else {
+			// the encoder keeps the blank line after the comment at the top of the document
+			if key, ok := topLevelKey(line); ok && separated[key] && len(restored) > comments && restored[len(restored)-comments-1] != "" {
+				at := len(restored) - comments
+				restored = append(restored[:at], append([]string{""}, restored[at:]...)...)
+			}
+			comments = 0
+		}
+		restored = append(restored, line)
+	}
+	return strings.Join(restored, "\n")
+}
+
+// topLevelKey returns the key of a line that starts an entry of the root map
+func topLevelKey(line string) (string, bool) {
+	if line == "" || strings.ContainsAny(line[:1], " \t#-") {
+		return "", false
+	}
+	key, _, ok := strings.Cut(line, ":")
+	return key, ok
+}
+
+// detectIndent returns the indentation of the first indented line of content, 2 if there's none
+func detectIndent(content string) int {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent > 0 {
+			if indent > 8 {
+				return 2
+			}
+			return indent
+		}
+	}
+	return 2
+}
@@ -0,0 +1,331 @@
+package yamlpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const valuesYAML = `# Default values for the chart
+replicaCount: 1 # how many pods
+
+image:
+  repository: nginx
+  # the tag defaults to the appVersion
+  tag: ""
+
+podAnnotations: {}
+
+ingress:
+  enabled: false
+  hosts:
+    - host: chart-example.local
+      paths:
+        - path: /
+          pathType: ImplementationSpecific
+
+tolerations: []
+
+nodeSelector:
+`
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		operations []Operation
+		want       string
+	}{
+		{
+			name:       "set a nested value",
+			content:    "image:\n  repository: nginx\n  tag: \"\"\n",
+			operations: []Operation{{Op: OpSet, Path: "image.tag", Value: "1.25"}},
+			want:       "image:\n  repository: nginx\n  tag: \"1.25\"\n",
+		},
+		{
+			name:       "set creates intermediate maps",
+			content:    "replicaCount: 1\n",
+			operations: []Operation{{Op: OpSet, Path: "resources.limits.cpu", Value: "500m"}},
+			want:       "replicaCount: 1\nresources:\n  limits:\n    cpu: 500m\n",
+		},
+		{
+			name:       "set through a null value",
+			content:    "nodeSelector:\n",
+			operations: []Operation{{Op: OpSet, Path: "nodeSelector.disktype", Value: "ssd"}},
+			want:       "nodeSelector:\n  disktype: ssd\n",
+		},
+		{
+			name:       "set in an empty flow map",
+			content:    "podAnnotations: {}\n",
+			operations: []Operation{{Op: OpSet, Path: `podAnnotations.prometheus\.io/scrape`, Value: "true"}},
+			want:       "podAnnotations:\n  prometheus.io/scrape: \"true\"\n",
+		},
+		{
+			name:       "set a key with dots that exists",
+			content:    "podAnnotations:\n  prometheus.io/port: \"8080\"\n",
+			operations: []Operation{{Op: OpSet, Path: `podAnnotations.prometheus\.io/port`, Value: "9090"}},
+			want:       "podAnnotations:\n  prometheus.io/port: \"9090\"\n",
+		},
+		{
+			name:       "set in a list of maps",
+			content:    "ingress:\n  hosts:\n    - host: a.local\n    - host: b.local\n",
+			operations: []Operation{{Op: OpSet, Path: "ingress.hosts.1.host", Value: "c.local"}},
+			want:       "ingress:\n  hosts:\n    - host: a.local\n    - host: c.local\n",
+		},
+		{
+			name:       "set a list item",
+			content:    "args:\n  - --verbose\n  - --port=80\n",
+			operations: []Operation{{Op: OpSet, Path: "args.1", Value: "--port=8080"}},
+			want:       "args:\n  - --verbose\n  - --port=8080\n",
+		},
+		{
+			name:       "set a map value",
+			content:    "service:\n  type: ClusterIP\n",
+			operations: []Operation{{Op: OpSet, Path: "service", Value: map[string]interface{}{"type": "NodePort", "port": float64(80)}}},
+			want:       "service:\n  port: 80\n  type: NodePort\n",
+		},
+		{
+			name:       "set keeps the order of keys",
+			content:    "b: 1\na: 2\nc: 3\n",
+			operations: []Operation{{Op: OpSet, Path: "a", Value: float64(4)}, {Op: OpSet, Path: "d", Value: true}},
+			want:       "b: 1\na: 4\nc: 3\nd: true\n",
+		},
+		{
+			name:       "set keeps comments",
+			content:    "# replicas\nreplicaCount: 1 # how many pods\n",
+			operations: []Operation{{Op: OpSet, Path: "replicaCount", Value: float64(3)}},
+			want:       "# replicas\nreplicaCount: 3 # how many pods\n",
+		},
+		{
+			name:       "set keeps the indentation",
+			content:    "image:\n    repository: nginx\n",
+			operations: []Operation{{Op: OpSet, Path: "image.tag", Value: "1.25"}},
+			want:       "image:\n    repository: nginx\n    tag: \"1.25\"\n",
+		},
+		{
+			name:       "set in an empty document",
+			content:    "",
+			operations: []Operation{{Op: OpSet, Path: "replicaCount", Value: float64(1)}},
+			want:       "replicaCount: 1\n",
+		},
+		{
+			name:       "delete a key",
+			content:    "image:\n  repository: nginx\n  tag: \"\"\n",
+			operations: []Operation{{Op: OpDelete, Path: "image.tag"}},
+			want:       "image:\n  repository: nginx\n",
+		},
+		{
+			name:       "delete a list item",
+			content:    "ingress:\n  hosts:\n    - host: a.local\n    - host: b.local\n",
+			operations: []Operation{{Op: OpDelete, Path: "ingress.hosts.0"}},
+			want:       "ingress:\n  hosts:\n    - host: b.local\n",
+		},
+		{
+			name:       "delete a key with dots",
+			content:    "podAnnotations:\n  prometheus.io/scrape: \"true\"\n  team: web\n",
+			operations: []Operation{{Op: OpDelete, Path: `podAnnotations.prometheus\.io/scrape`}},
+			want:       "podAnnotations:\n  team: web\n",
+		},
+		{
+			name:       "append to a list",
+			content:    "args:\n  - --verbose\n",
+			operations: []Operation{{Op: OpAppend, Path: "args", Value: "--port=80"}},
+			want:       "args:\n  - --verbose\n  - --port=80\n",
+		},
+		{
+			name:    "append a map to an empty flow list",
+			content: "tolerations: []\n",
+			operations: []Operation{{Op: OpAppend, Path: "tolerations", Value: map[string]interface{}{
+				"key": "dedicated", "operator": "Exists",
+			}}},
+			want: "tolerations:\n  - key: dedicated\n    operator: Exists\n",
+		},
+		{
+			name:       "append creates the list",
+			content:    "image:\n  repository: nginx\n",
+			operations: []Operation{{Op: OpAppend, Path: "imagePullSecrets", Value: map[string]interface{}{"name": "regcred"}}},
+			want:       "image:\n  repository: nginx\nimagePullSecrets:\n  - name: regcred\n",
+		},
+		{
+			name:       "append to a null value",
+			content:    "extraEnv:\n",
+			operations: []Operation{{Op: OpAppend, Path: "extraEnv", Value: map[string]interface{}{"name": "DEBUG", "value": "1"}}},
+			want:       "extraEnv:\n  - name: DEBUG\n    value: \"1\"\n",
+		},
+		{
+			name:       "append to a list in a list of maps",
+			content:    "ingress:\n  hosts:\n    - host: a.local\n      paths:\n        - path: /\n",
+			operations: []Operation{{Op: OpAppend, Path: "ingress.hosts.0.paths", Value: map[string]interface{}{"path": "/api"}}},
+			want:       "ingress:\n  hosts:\n    - host: a.local\n      paths:\n        - path: /\n        - path: /api\n",
+		},
+		{
+			name:    "operations apply in order",
+			content: "image:\n  tag: \"\"\n",
+			operations: []Operation{
+				{Op: OpSet, Path: "image.pullPolicy", Value: "Always"},
+				{Op: OpDelete, Path: "image.tag"},
+				{Op: OpSet, Path: "image.pullPolicy", Value: "IfNotPresent"},
+			},
+			want: "image:\n  pullPolicy: IfNotPresent\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.content, tt.operations)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApplyValuesFile(t *testing.T) {
+	got, err := Apply(valuesYAML, []Operation{
+		{Op: OpSet, Path: "replicaCount", Value: float64(2)},
+		{Op: OpSet, Path: "ingress.enabled", Value: true},
+		{Op: OpSet, Path: "ingress.hosts.0.host", Value: "example.com"},
+		{Op: OpAppend, Path: "ingress.hosts.0.paths", Value: map[string]interface{}{"path": "/api", "pathType": "Prefix"}},
+	})
+	require.NoError(t, err)
+
+	want := `# Default values for the chart
+replicaCount: 2 # how many pods
+
+image:
+  repository: nginx
+  # the tag defaults to the appVersion
+  tag: ""
+
+podAnnotations: {}
+
+ingress:
+  enabled: true
+  hosts:
+    - host: example.com
+      paths:
+        - path: /
+          pathType: ImplementationSpecific
+        - path: /api
+          pathType: Prefix
+
+tolerations: []
+
+nodeSelector:
+`
+	assert.Equal(t, want, got)
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		operation Operation
+		wantErr   error
+	}{
+		{
+			name:      "unknown op",
+			content:   "a: 1\n",
+			operation: Operation{Op: "replace", Path: "a", Value: float64(2)},
+			wantErr:   ErrInvalidOperation,
+		},
+		{
+			name:      "missing path",
+			content:   "a: 1\n",
+			operation: Operation{Op: OpSet, Value: float64(2)},
+			wantErr:   ErrInvalidOperation,
+		},
+		{
+			name:      "empty key",
+			content:   "a: 1\n",
+			operation: Operation{Op: OpSet, Path: "a..b", Value: float64(2)},
+			wantErr:   ErrInvalidPath,
+		},
+		{
+			name:      "delete a missing key",
+			content:   "a: 1\n",
+			operation: Operation{Op: OpDelete, Path: "b"},
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:      "delete under a missing key",
+			content:   "a: 1\n",
+			operation: Operation{Op: OpDelete, Path: "b.c"},
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:      "set under a scalar",
+			content:   "image: nginx\n",
+			operation: Operation{Op: OpSet, Path: "image.tag", Value: "1.25"},
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:      "index out of range",
+			content:   "args:\n  - --verbose\n",
+			operation: Operation{Op: OpSet, Path: "args.1", Value: "--port=80"},
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:      "key of a list",
+			content:   "args:\n  - --verbose\n",
+			operation: Operation{Op: OpSet, Path: "args.first", Value: "--port=80"},
+			wantErr:   ErrInvalidPath,
+		},
+		{
+			name:      "append to a map",
+			content:   "image:\n  tag: \"\"\n",
+			operation: Operation{Op: OpAppend, Path: "image", Value: "x"},
+			wantErr:   ErrPathNotFound,
+		},
+		{
+			name:      "set through an alias",
+			content:   "base: &base\n  a: 1\ncopy: *base\n",
+			operation: Operation{Op: OpSet, Path: "copy.a", Value: float64(2)},
+			wantErr:   ErrPathNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Apply(tt.content, []Operation{tt.operation})
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestApplyRejectsDocuments(t *testing.T) {
+	_, err := Apply("- a\n- b\n", []Operation{{Op: OpSet, Path: "a", Value: "b"}})
+	assert.Error(t, err)
+
+	_, err = Apply("a: [\n", []Operation{{Op: OpSet, Path: "a", Value: "b"}})
+	assert.Error(t, err)
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "image.tag", want: []string{"image", "tag"}},
+		{path: "hosts.0.host", want: []string{"hosts", "0", "host"}},
+		{path: `podAnnotations.prometheus\.io/scrape`, want: []string{"podAnnotations", "prometheus.io/scrape"}},
+		{path: `a\\.b`, want: []string{`a\`, "b"}},
+		{path: "a.", wantErr: true},
+		{path: `a\b`, wantErr: true},
+		{path: `a\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ParsePath(tt.path)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidPath)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.path, joinPath(got))
+		})
+	}
+}